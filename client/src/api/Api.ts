@@ -39,7 +39,10 @@ class Api {
                     return false;
                 }
 
-                throw new Error(`${errorPath} | ${error.response.data} | ${error.response.status}`);
+                const { data } = error.response;
+                const message = data?.message ?? data;
+
+                throw new Error(`${errorPath} | ${message} | ${error.response.status}`);
             }
 
             throw new Error(`${errorPath} | ${error.message || error}`);
@@ -130,6 +130,14 @@ const INPUT_FIELDS = [
         subtitle: 'fastest_addr_desc',
         placeholder: 'fastest_addr',
     },
+    {
+        name: UPSTREAM_MODE_NAME,
+        type: 'radio',
+        value: DNS_REQUEST_OPTIONS.WEIGHTED,
+        component: renderRadioField,
+        subtitle: 'weighted_upstreams_desc',
+        placeholder: 'weighted_upstreams',
+    },
 ];
 
 interface FormProps {
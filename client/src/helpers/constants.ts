@@ -229,6 +229,10 @@ export const FILTERED_STATUS = {
     FILTERED_SAFE_SEARCH: 'FilteredSafeSearch',
     FILTERED_SAFE_BROWSING: 'FilteredSafeBrowsing',
     FILTERED_PARENTAL: 'FilteredParental',
+    FILTERED_PAUSED: 'FilteredPaused',
+    FILTERED_QUIC: 'FilteredQUIC',
+    FILTERED_ANSWER_IP: 'FilteredAnswerIP',
+    FILTERED_REBINDING: 'FilteredRebinding',
 };
 
 export const RESPONSE_FILTER = {
@@ -338,6 +342,22 @@ export const FILTERED_STATUS_TO_META_MAP = {
         LABEL: RESPONSE_FILTER.BLOCKED_ADULT_WEBSITES.LABEL,
         COLOR: QUERY_STATUS_COLORS.YELLOW,
     },
+    [FILTERED_STATUS.FILTERED_PAUSED]: {
+        LABEL: 'client_paused',
+        COLOR: QUERY_STATUS_COLORS.RED,
+    },
+    [FILTERED_STATUS.FILTERED_QUIC]: {
+        LABEL: 'quic_blocked',
+        COLOR: QUERY_STATUS_COLORS.RED,
+    },
+    [FILTERED_STATUS.FILTERED_ANSWER_IP]: {
+        LABEL: 'answer_ip_filtered',
+        COLOR: QUERY_STATUS_COLORS.RED,
+    },
+    [FILTERED_STATUS.FILTERED_REBINDING]: {
+        LABEL: 'rebinding_filtered',
+        COLOR: QUERY_STATUS_COLORS.RED,
+    },
 };
 
 export const DEFAULT_TIME_FORMAT = 'HH:mm:ss';
@@ -391,6 +411,7 @@ export const DNS_REQUEST_OPTIONS = {
     PARALLEL: 'parallel',
     FASTEST_ADDR: 'fastest_addr',
     LOAD_BALANCING: 'load_balance',
+    WEIGHTED: 'weighted',
 };
 
 export const DHCP_FORM_NAMES = {
@@ -2,9 +2,17 @@ package aghhttp
 
 // HTTP headers
 
+// HTTP header name constants missing from package httphdr.
+const (
+	HdrNameReferrerPolicy = "Referrer-Policy"
+	HdrNameXFrameOptions  = "X-Frame-Options"
+)
+
 // HTTP header value constants.
 const (
 	HdrValApplicationJSON         = "application/json"
+	HdrValNoSniff                 = "nosniff"
 	HdrValStrictTransportSecurity = "max-age=31536000; includeSubDomains"
+	HdrValTextCSV                 = "text/csv"
 	HdrValTextPlain               = "text/plain"
 )
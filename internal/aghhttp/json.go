@@ -114,13 +114,104 @@ func WriteJSONResponseOK(w http.ResponseWriter, r *http.Request, v any) {
 type ErrorCode string
 
 // ErrorCode constants.
-//
-// TODO(a.garipov): Expand and document codes.
 const (
 	// ErrorCodeTMP000 is the temporary error code used for all errors.
 	ErrorCodeTMP000 = ""
+
+	// ErrorCodeAUT000 means that no or bad authorization credentials have
+	// been provided.
+	ErrorCodeAUT000 ErrorCode = "AUT000"
+
+	// ErrorCodeAUT001 means that the credentials don't allow the request.
+	ErrorCodeAUT001 ErrorCode = "AUT001"
+
+	// ErrorCodeCTP415 means that the content type of the request isn't
+	// supported.
+	ErrorCodeCTP415 ErrorCode = "CTP415"
+
+	// ErrorCodeENT404 means that an entity hasn't been found, as opposed to a
+	// path.
+	ErrorCodeENT404 ErrorCode = "ENT404"
+
+	// ErrorCodeENT409 means that an entity conflicts with an existing one.
+	ErrorCodeENT409 ErrorCode = "ENT409"
+
+	// ErrorCodeJSN000 is a JSON syntax error.
+	ErrorCodeJSN000 ErrorCode = "JSN000"
+
+	// ErrorCodeJSN001 is a JSON type error.
+	ErrorCodeJSN001 ErrorCode = "JSN001"
+
+	// ErrorCodeMTH405 means that the method of the request isn't allowed.
+	ErrorCodeMTH405 ErrorCode = "MTH405"
+
+	// ErrorCodeOSS000 means that the server's operating system doesn't support
+	// the requested functionality.
+	ErrorCodeOSS000 ErrorCode = "OSS000"
+
+	// ErrorCodePTH404 means that a path hasn't been found, as opposed to an
+	// entity.
+	ErrorCodePTH404 ErrorCode = "PTH404"
+
+	// ErrorCodeRNT000 is a server runtime error.
+	ErrorCodeRNT000 ErrorCode = "RNT000"
+
+	// ErrorCodeRTL429 means that there have been too many requests.
+	ErrorCodeRTL429 ErrorCode = "RTL429"
+
+	// ErrorCodeTXT400 is a plaintext bad request error.
+	ErrorCodeTXT400 ErrorCode = "TXT400"
+
+	// ErrorCodeTXT401 is a plaintext unauthorized error.
+	ErrorCodeTXT401 ErrorCode = "TXT401"
+
+	// ErrorCodeTXT404 is a plaintext not found error.
+	ErrorCodeTXT404 ErrorCode = "TXT404"
+
+	// ErrorCodeTXT500 is a plaintext internal server error.
+	ErrorCodeTXT500 ErrorCode = "TXT500"
+
+	// ErrorCodeUNA503 means that the service is temporarily unavailable.
+	ErrorCodeUNA503 ErrorCode = "UNA503"
+
+	// ErrorCodeVAL000 means that the value of a field of the request is
+	// invalid.
+	ErrorCodeVAL000 ErrorCode = "VAL000"
 )
 
+// StatusErrorCode returns the error code for an error response with the HTTP
+// status code, if there is no more specific one.
+func StatusErrorCode(status int) (code ErrorCode) {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrorCodeAUT000
+	case http.StatusForbidden:
+		return ErrorCodeAUT001
+	case http.StatusNotFound:
+		return ErrorCodeTXT404
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMTH405
+	case http.StatusConflict:
+		return ErrorCodeENT409
+	case http.StatusUnsupportedMediaType:
+		return ErrorCodeCTP415
+	case http.StatusUnprocessableEntity:
+		return ErrorCodeVAL000
+	case http.StatusTooManyRequests:
+		return ErrorCodeRTL429
+	case http.StatusNotImplemented:
+		return ErrorCodeOSS000
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUNA503
+	}
+
+	if status >= http.StatusInternalServerError {
+		return ErrorCodeTXT500
+	}
+
+	return ErrorCodeTXT400
+}
+
 // HTTPAPIErrorResp is the error response as used by the HTTP API.  See the
 // BadRequestResp, InternalServerErrorResp, and similar objects in the OpenAPI
 // specification.
@@ -1,7 +1,12 @@
 package aghnet
 
 import (
+	"fmt"
 	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"golang.org/x/net/idna"
 )
 
 // NormalizeDomain returns a lowercased version of host without the final dot,
@@ -16,3 +21,63 @@ func NormalizeDomain(host string) (norm string) {
 
 	return strings.ToLower(strings.TrimSuffix(host, "."))
 }
+
+// idnaProfile is the profile for converting the internationalized domain names
+// into punycode.  The STD3 rules are disabled, since the underscores are valid
+// in the domain names, for example in the names of SRV records.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// wildcardPrefix is the prefix of the domain name patterns matching all the
+// subdomains of a domain.
+const wildcardPrefix = "*."
+
+// ParseDomainName returns the normalized form of the domain name, which is
+// converted into punycode, lowercased, and doesn't have the trailing dot.  It
+// returns an error if name isn't a valid domain name.  Wildcards aren't
+// allowed, see [ParseDomainNamePattern].  It should be used for all the domain
+// names coming from the configuration and the HTTP API, while
+// [NormalizeDomain] is enough for the ones from the DNS messages.
+func ParseDomainName(name string) (norm string, err error) {
+	norm = strings.TrimSuffix(name, ".")
+	if norm == "" {
+		return "", fmt.Errorf("bad domain name %q: %w", name, errors.ErrEmptyValue)
+	} else if strings.Contains(norm, "*") {
+		return "", fmt.Errorf("bad domain name %q: wildcards are not allowed", name)
+	}
+
+	norm, err = idnaProfile.ToASCII(norm)
+	if err != nil {
+		return "", fmt.Errorf("bad domain name %q: %w", name, err)
+	}
+
+	norm = strings.ToLower(norm)
+	err = netutil.ValidateDomainName(norm)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	return norm, nil
+}
+
+// ParseDomainNamePattern is like [ParseDomainName] but also accepts the
+// patterns with the leading wildcard label, like "*.example.org", matching all
+// the subdomains of a domain.
+func ParseDomainNamePattern(pattern string) (norm string, err error) {
+	domain, isWildcard := strings.CutPrefix(pattern, wildcardPrefix)
+	norm, err = ParseDomainName(domain)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	if isWildcard {
+		norm = wildcardPrefix + norm
+	}
+
+	return norm, nil
+}
@@ -0,0 +1,109 @@
+package aghnet_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDomainName(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		want       string
+		wantErrMsg string
+	}{{
+		name:       "simple",
+		in:         "Example.ORG",
+		want:       "example.org",
+		wantErrMsg: "",
+	}, {
+		name:       "trailing_dot",
+		in:         "example.org.",
+		want:       "example.org",
+		wantErrMsg: "",
+	}, {
+		name:       "idn",
+		in:         "Пример.РФ",
+		want:       "xn--e1afmkfd.xn--p1ai",
+		wantErrMsg: "",
+	}, {
+		name:       "punycode",
+		in:         "xn--e1afmkfd.xn--p1ai",
+		want:       "xn--e1afmkfd.xn--p1ai",
+		wantErrMsg: "",
+	}, {
+		name:       "underscore",
+		in:         "_dmarc.example.org",
+		want:       "_dmarc.example.org",
+		wantErrMsg: "",
+	}, {
+		name:       "empty",
+		in:         "",
+		want:       "",
+		wantErrMsg: `bad domain name "": empty value`,
+	}, {
+		name:       "root",
+		in:         ".",
+		want:       "",
+		wantErrMsg: `bad domain name ".": empty value`,
+	}, {
+		name:       "wildcard",
+		in:         "*.example.org",
+		want:       "",
+		wantErrMsg: `bad domain name "*.example.org": wildcards are not allowed`,
+	}, {
+		name: "empty_label",
+		in:   "example..org",
+		want: "",
+		wantErrMsg: `bad domain name "example..org": ` +
+			`bad domain name label "": domain name label is empty`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := aghnet.ParseDomainName(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseDomainNamePattern(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		want       string
+		wantErrMsg string
+	}{{
+		name:       "domain",
+		in:         "Example.ORG.",
+		want:       "example.org",
+		wantErrMsg: "",
+	}, {
+		name:       "wildcard",
+		in:         "*.Пример.РФ",
+		want:       "*.xn--e1afmkfd.xn--p1ai",
+		wantErrMsg: "",
+	}, {
+		name:       "wildcard_inside",
+		in:         "sub.*.example.org",
+		want:       "",
+		wantErrMsg: `bad domain name "sub.*.example.org": wildcards are not allowed`,
+	}, {
+		name:       "wildcard_only",
+		in:         "*.",
+		want:       "",
+		wantErrMsg: `bad domain name "": empty value`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := aghnet.ParseDomainNamePattern(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package aghnet
+
+import (
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// LinkMonitor tracks the addresses of the network interfaces and notifies
+// about their changes.
+type LinkMonitor interface {
+	// Start starts monitoring the addresses.
+	Start() (err error)
+
+	// Close stops monitoring the addresses and closes the events channel.
+	io.Closer
+
+	// Events returns the channel to notify about the changes of the addresses.
+	Events() (e <-chan struct{})
+}
+
+// linkSettleDelay is the time to wait for the other changes after the OS has
+// notified about one, since those usually come in bursts, for example when a
+// DHCP lease is renewed.
+const linkSettleDelay = 1 * time.Second
+
+// linkMonitor is the [LinkMonitor] that checks the addresses of the network
+// interfaces on each notification from the OS, if the OS supports those, and
+// periodically otherwise.
+type linkMonitor struct {
+	// notifier receives the notifications about the possible changes from the
+	// OS.  It's nil if the OS notifications aren't supported.
+	notifier linkNotifier
+
+	// collectAddrs returns the current addresses of the network interfaces.
+	collectAddrs func() (addrs []netip.Addr, err error)
+
+	// events is the channel to notify about the changes.
+	events chan struct{}
+
+	// done is closed when the monitor is closed.
+	done chan struct{}
+
+	// addrs are the sorted addresses of the network interfaces found during
+	// the last check.
+	addrs []netip.Addr
+
+	// pollIvl is the interval of checking the addresses without the OS
+	// notifications.
+	pollIvl time.Duration
+
+	// settleDelay is the time to wait for the other notifications before
+	// checking the addresses.
+	settleDelay time.Duration
+}
+
+// linkNotifier receives the notifications about the possible changes of the
+// addresses of the network interfaces from the OS.
+type linkNotifier interface {
+	// Close stops receiving the notifications and closes the channel.
+	io.Closer
+
+	// Notifications returns the channel receiving the notifications.
+	Notifications() (n <-chan struct{})
+}
+
+// NewLinkMonitor returns a new LinkMonitor tracking the addresses of the
+// network interfaces of the OS.  pollIvl is the interval of checking the
+// addresses if the OS doesn't support notifying about their changes, it must
+// be positive.
+func NewLinkMonitor(pollIvl time.Duration) (m LinkMonitor) {
+	n, err := newLinkNotifier()
+	if err != nil {
+		log.Info("aghnet: link monitor: %s; polling every %s", err, pollIvl)
+	}
+
+	return newLinkMonitor(n, CollectAllIfacesAddrs, pollIvl)
+}
+
+// newLinkMonitor returns a new properly initialized *linkMonitor.  n may be
+// nil, in which case the addresses are polled every pollIvl.
+func newLinkMonitor(
+	n linkNotifier,
+	collectAddrs func() (addrs []netip.Addr, err error),
+	pollIvl time.Duration,
+) (m *linkMonitor) {
+	return &linkMonitor{
+		notifier:     n,
+		collectAddrs: collectAddrs,
+		events:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		pollIvl:      pollIvl,
+		settleDelay:  linkSettleDelay,
+	}
+}
+
+// type check
+var _ LinkMonitor = (*linkMonitor)(nil)
+
+// Start implements the [LinkMonitor] interface for *linkMonitor.  If it fails,
+// the notifier is closed, since m isn't expected to be closed then.
+func (m *linkMonitor) Start() (err error) {
+	m.addrs, err = m.currentAddrs()
+	if err != nil {
+		if m.notifier != nil {
+			err = errors.WithDeferred(err, m.notifier.Close())
+		}
+
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	go m.monitor()
+
+	return nil
+}
+
+// Close implements the [LinkMonitor] interface for *linkMonitor.
+func (m *linkMonitor) Close() (err error) {
+	close(m.done)
+
+	if m.notifier != nil {
+		return m.notifier.Close()
+	}
+
+	return nil
+}
+
+// Events implements the [LinkMonitor] interface for *linkMonitor.
+func (m *linkMonitor) Events() (e <-chan struct{}) {
+	return m.events
+}
+
+// monitor checks the addresses on the notifications or periodically until the
+// monitor is closed.  It's intended to be used as a goroutine.
+func (m *linkMonitor) monitor() {
+	defer log.OnPanic("aghnet: link monitor")
+
+	defer close(m.events)
+
+	var notifications <-chan struct{}
+	var tick <-chan time.Time
+	if m.notifier != nil {
+		notifications = m.notifier.Notifications()
+	} else {
+		ticker := time.NewTicker(m.pollIvl)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	settle := time.NewTimer(m.settleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case _, ok := <-notifications:
+			if !ok {
+				if m.isClosed() {
+					return
+				}
+
+				log.Info("WARNING: aghnet: link monitor: notifier stopped; polling every %s", m.pollIvl)
+
+				// This only happens once, since notifications is nil then.
+				ticker := time.NewTicker(m.pollIvl)
+				defer ticker.Stop()
+
+				notifications, tick = nil, ticker.C
+
+				continue
+			}
+
+			settle.Reset(m.settleDelay)
+
+			continue
+		case <-settle.C:
+		case <-tick:
+		}
+
+		m.check()
+	}
+}
+
+// isClosed returns true if the monitor is closed.
+func (m *linkMonitor) isClosed() (ok bool) {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// check compares the current addresses of the network interfaces with the
+// ones found during the last check and notifies about the changes, if any.
+func (m *linkMonitor) check() {
+	addrs, err := m.currentAddrs()
+	if err != nil {
+		log.Error("aghnet: link monitor: %s", err)
+
+		return
+	}
+
+	if slices.Equal(addrs, m.addrs) {
+		log.Debug("aghnet: link monitor: addresses aren't changed")
+
+		return
+	}
+
+	log.Info("aghnet: link monitor: addresses changed from %s to %s", m.addrs, addrs)
+
+	m.addrs = addrs
+
+	select {
+	case m.events <- struct{}{}:
+	default:
+		// There is already an unhandled event.
+	}
+}
+
+// currentAddrs returns the sorted current addresses of the network interfaces.
+func (m *linkMonitor) currentAddrs() (addrs []netip.Addr, err error) {
+	addrs, err = m.collectAddrs()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	slices.SortFunc(addrs, netip.Addr.Compare)
+
+	return slices.Compact(addrs), nil
+}
@@ -0,0 +1,153 @@
+package aghnet
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testLinkNotifier is the [linkNotifier] for tests.
+type testLinkNotifier struct {
+	notifications chan struct{}
+}
+
+// type check
+var _ linkNotifier = (*testLinkNotifier)(nil)
+
+// Close implements the [linkNotifier] interface for *testLinkNotifier.
+func (n *testLinkNotifier) Close() (err error) {
+	close(n.notifications)
+
+	return nil
+}
+
+// Notifications implements the [linkNotifier] interface for
+// *testLinkNotifier.
+func (n *testLinkNotifier) Notifications() (ch <-chan struct{}) {
+	return n.notifications
+}
+
+// testAddrs is a concurrent-safe source of the addresses for tests.
+type testAddrs struct {
+	mu    *sync.Mutex
+	addrs []netip.Addr
+}
+
+// set sets the current addresses.
+func (a *testAddrs) set(addrs ...netip.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.addrs = addrs
+}
+
+// collect returns a copy of the current addresses.
+func (a *testAddrs) collect() (addrs []netip.Addr, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]netip.Addr(nil), a.addrs...), nil
+}
+
+func TestLinkMonitor(t *testing.T) {
+	addr1 := netip.MustParseAddr("192.168.1.2")
+	addr2 := netip.MustParseAddr("192.168.1.3")
+	addr6 := netip.MustParseAddr("fd00::2")
+
+	t.Run("notifications", func(t *testing.T) {
+		addrs := &testAddrs{mu: &sync.Mutex{}}
+		addrs.set(addr1, addr6)
+
+		n := &testLinkNotifier{notifications: make(chan struct{}, 1)}
+		m := newLinkMonitor(n, addrs.collect, time.Hour)
+		m.settleDelay = time.Millisecond
+
+		require.NoError(t, m.Start())
+
+		// The same addresses in another order.
+		addrs.set(addr6, addr1)
+		n.notifications <- struct{}{}
+
+		assertNoEvent(t, m)
+
+		addrs.set(addr2, addr6)
+		n.notifications <- struct{}{}
+
+		assertEvent(t, m)
+
+		require.NoError(t, m.Close())
+		assertClosed(t, m)
+	})
+
+	t.Run("start_error", func(t *testing.T) {
+		const errCollect errors.Error = "collect error"
+
+		n := &testLinkNotifier{notifications: make(chan struct{}, 1)}
+		m := newLinkMonitor(n, func() (addrs []netip.Addr, err error) {
+			return nil, errCollect
+		}, time.Hour)
+
+		err := m.Start()
+		require.ErrorIs(t, err, errCollect)
+
+		_, ok := <-n.notifications
+		assert.False(t, ok)
+	})
+
+	t.Run("polling", func(t *testing.T) {
+		addrs := &testAddrs{mu: &sync.Mutex{}}
+		addrs.set(addr1)
+
+		m := newLinkMonitor(nil, addrs.collect, time.Millisecond)
+		require.NoError(t, m.Start())
+
+		addrs.set(addr1, addr2)
+		assertEvent(t, m)
+
+		require.NoError(t, m.Close())
+		assertClosed(t, m)
+	})
+}
+
+// assertEvent asserts that an event is received from m in time.
+func assertEvent(t *testing.T, m LinkMonitor) {
+	t.Helper()
+
+	select {
+	case _, ok := <-m.Events():
+		assert.True(t, ok)
+	case <-time.After(testTimeout):
+		t.Error("no event")
+	}
+}
+
+// assertNoEvent asserts that no event is received from m for some time.
+func assertNoEvent(t *testing.T, m LinkMonitor) {
+	t.Helper()
+
+	select {
+	case <-m.Events():
+		t.Error("unexpected event")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// assertClosed asserts that the events channel of m is closed in time.
+func assertClosed(t *testing.T, m LinkMonitor) {
+	t.Helper()
+
+	select {
+	case _, ok := <-m.Events():
+		assert.False(t, ok)
+	case <-time.After(testTimeout):
+		t.Error("events channel isn't closed")
+	}
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package aghnet
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// netlinkNotifier is the [linkNotifier] receiving the notifications about the
+// changes of the links and addresses via the rtnetlink multicast groups.
+type netlinkNotifier struct {
+	conn *netlink.Conn
+
+	// notifications is the channel to send the notifications to.
+	notifications chan struct{}
+
+	// closed is true if the notifier is closed, so that the error of receiving
+	// from the closed connection isn't reported.
+	closed *atomic.Bool
+}
+
+// newLinkNotifier returns a new notifier using the rtnetlink multicast groups.
+func newLinkNotifier() (n linkNotifier, err error) {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to rtnetlink: %w", err)
+	}
+
+	nn := &netlinkNotifier{
+		conn:          conn,
+		notifications: make(chan struct{}, 1),
+		closed:        &atomic.Bool{},
+	}
+
+	go nn.receive()
+
+	return nn, nil
+}
+
+// type check
+var _ linkNotifier = (*netlinkNotifier)(nil)
+
+// Close implements the [linkNotifier] interface for *netlinkNotifier.
+func (n *netlinkNotifier) Close() (err error) {
+	n.closed.Store(true)
+
+	return n.conn.Close()
+}
+
+// Notifications implements the [linkNotifier] interface for *netlinkNotifier.
+func (n *netlinkNotifier) Notifications() (ch <-chan struct{}) {
+	return n.notifications
+}
+
+// receive sends a notification on each received message until the connection
+// is closed.  It's intended to be used as a goroutine.
+func (n *netlinkNotifier) receive() {
+	defer log.OnPanic("aghnet: netlink notifier")
+
+	defer close(n.notifications)
+
+	for {
+		msgs, err := n.conn.Receive()
+		if err != nil {
+			if !n.closed.Load() {
+				log.Error("aghnet: netlink notifier: receiving: %s", err)
+			}
+
+			return
+		}
+
+		if !hasAddrMessages(msgs) {
+			continue
+		}
+
+		select {
+		case n.notifications <- struct{}{}:
+		default:
+			// There is already an unhandled notification.
+		}
+	}
+}
+
+// hasAddrMessages returns true if msgs contain the messages about the changes
+// of the links or their addresses.
+func hasAddrMessages(msgs []netlink.Message) (ok bool) {
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.RTM_NEWADDR, unix.RTM_DELADDR, unix.RTM_NEWLINK, unix.RTM_DELLINK:
+			return true
+		default:
+			// Go on.
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package aghnet
+
+import "github.com/AdguardTeam/golibs/errors"
+
+// newLinkNotifier returns an error, since the notifications about the changes
+// of the addresses aren't supported on the OS yet.
+//
+// TODO: Use the routing sockets on BSD and NotifyIpInterfaceChange on
+// Windows.
+func newLinkNotifier() (n linkNotifier, err error) {
+	return nil, errors.Error("link notifications are not supported")
+}
@@ -265,6 +265,17 @@ func IsAddrInUse(err error) (ok bool) {
 	return isAddrInUse(sysErr)
 }
 
+// IsAddrNotAvailable checks if err is about binding to an address not assigned
+// to any network interface, for example because the network isn't up yet.
+func IsAddrNotAvailable(err error) (ok bool) {
+	var sysErr syscall.Errno
+	if !errors.As(err, &sysErr) {
+		return false
+	}
+
+	return isAddrNotAvailable(sysErr)
+}
+
 // CollectAllIfacesAddrs returns the slice of all network interfaces IP
 // addresses without port number.
 func CollectAllIfacesAddrs() (addrs []netip.Addr, err error) {
@@ -17,3 +17,7 @@ func closePortChecker(c io.Closer) (err error) {
 func isAddrInUse(err syscall.Errno) (ok bool) {
 	return errors.Is(err, syscall.EADDRINUSE)
 }
+
+func isAddrNotAvailable(err syscall.Errno) (ok bool) {
+	return errors.Is(err, syscall.EADDRNOTAVAIL)
+}
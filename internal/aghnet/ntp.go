@@ -0,0 +1,123 @@
+package aghnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// NTP protocol constants, see RFC 4330.
+const (
+	// ntpPort is the default port of NTP servers.
+	ntpPort = "123"
+
+	// ntpPacketLen is the length of an NTP packet without the extensions.
+	ntpPacketLen = 48
+
+	// ntpVersion is the version of the protocol used in requests.
+	ntpVersion = 4
+
+	// ntpModeClient and ntpModeServer are the modes of the requests and the
+	// responses.
+	ntpModeClient = 3
+	ntpModeServer = 4
+
+	// ntpEpochOffset is the number of seconds between the NTP epoch,
+	// 1900-01-01, and the Unix one.
+	ntpEpochOffset = 2_208_988_800
+)
+
+// QueryNTP sends an SNTP request to the server at addr and returns the offset
+// of the server's clock relative to the system one.  The port in addr defaults
+// to 123.
+func QueryNTP(ctx context.Context, addr string) (offset time.Duration, err error) {
+	if _, _, err = net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, ntpPort)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return 0, fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	req := make([]byte, ntpPacketLen)
+	req[0] = ntpVersion<<3 | ntpModeClient
+
+	sent := time.Now()
+	putNTPTime(req[40:48], sent)
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return 0, fmt.Errorf("writing request: %w", err)
+	}
+
+	resp := make([]byte, ntpPacketLen)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, fmt.Errorf("reading response: %w", err)
+	}
+
+	return ntpOffset(req, resp[:n], sent, time.Now())
+}
+
+// ntpOffset validates the response to req and returns the clock offset
+// calculated from it.  sent and recvd are the times of sending the request and
+// receiving the response.
+func ntpOffset(req, resp []byte, sent, recvd time.Time) (offset time.Duration, err error) {
+	if len(resp) < ntpPacketLen {
+		return 0, fmt.Errorf("response length: %w: %d", errors.ErrOutOfRange, len(resp))
+	}
+
+	if mode := resp[0] & 0b111; mode != ntpModeServer {
+		return 0, fmt.Errorf("response mode: %w: %d", errors.ErrBadEnumValue, mode)
+	}
+
+	if resp[1] == 0 {
+		// Stratum 0 means a kiss-o'-death packet.
+		return 0, fmt.Errorf("server refused to serve, code %q", resp[12:16])
+	}
+
+	// The server must copy the transmit timestamp of the request into the
+	// originate one.
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, errors.Error("originate timestamp doesn't match request")
+	}
+
+	received := ntpTime(resp[32:40])
+	transmitted := ntpTime(resp[40:48])
+
+	return (received.Sub(sent) + transmitted.Sub(recvd)) / 2, nil
+}
+
+// putNTPTime writes t to b as an NTP timestamp.  b must be at least 8 bytes
+// long.
+//
+// TODO:  Handle the NTP era overflow in 2036.
+func putNTPTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
+
+// ntpTime returns the time from the NTP timestamp in b.  b must be at least
+// 8 bytes long.
+func ntpTime(b []byte) (t time.Time) {
+	v := binary.BigEndian.Uint64(b)
+	secs, frac := int64(v>>32), v&0xffff_ffff
+
+	return time.Unix(secs-ntpEpochOffset, int64(frac*uint64(time.Second)>>32))
+}
@@ -0,0 +1,70 @@
+package aghnet_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch, 1900-01-01,
+// and the Unix one.
+const ntpEpochOffset = 2_208_988_800
+
+// startNTPServer starts a fake NTP server responding with the time shifted by
+// skew and returns its address.  stratum is the stratum of the responses.
+func startNTPServer(t *testing.T, skew time.Duration, stratum byte) (addr string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		req := make([]byte, 48)
+		for {
+			_, from, rerr := conn.ReadFrom(req)
+			if rerr != nil {
+				return
+			}
+
+			resp := make([]byte, 48)
+			resp[0] = 4<<3 | 4
+			resp[1] = stratum
+			copy(resp[24:32], req[40:48])
+
+			now := time.Now().Add(skew)
+			secs := uint64(now.Unix() + ntpEpochOffset)
+			binary.BigEndian.PutUint64(resp[32:40], secs<<32)
+			binary.BigEndian.PutUint64(resp[40:48], secs<<32)
+
+			_, _ = conn.WriteTo(resp, from)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestQueryNTP(t *testing.T) {
+	const skew = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("success", func(t *testing.T) {
+		offset, err := aghnet.QueryNTP(ctx, startNTPServer(t, skew, 1))
+		require.NoError(t, err)
+
+		assert.InDelta(t, skew, offset, float64(2*time.Second))
+	})
+
+	t.Run("kiss_of_death", func(t *testing.T) {
+		_, err := aghnet.QueryNTP(ctx, startNTPServer(t, skew, 0))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,176 @@
+package aghnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+const (
+	// wolSyncLen is the length of the synchronization stream of a Wake-on-LAN
+	// magic packet.
+	wolSyncLen = 6
+
+	// wolMACRepeats is the number of repetitions of the target MAC address in
+	// a Wake-on-LAN magic packet.
+	wolMACRepeats = 16
+
+	// WakeOnLANPort is the UDP port the Wake-on-LAN magic packets are sent to.
+	WakeOnLANPort uint16 = 9
+)
+
+// NewMagicPacket returns a Wake-on-LAN magic packet for the device with mac,
+// which must be an EUI-48 address.  The packet consists of 6 bytes of 0xFF
+// followed by 16 repetitions of mac.
+func NewMagicPacket(mac net.HardwareAddr) (pkt []byte, err error) {
+	if l := len(mac); l != 6 {
+		return nil, fmt.Errorf("bad mac address %q: expected 6 bytes, got %d", mac, l)
+	}
+
+	pkt = make([]byte, 0, wolSyncLen+wolMACRepeats*len(mac))
+	pkt = append(pkt, bytes.Repeat([]byte{0xFF}, wolSyncLen)...)
+	pkt = append(pkt, bytes.Repeat(mac, wolMACRepeats)...)
+
+	return pkt, nil
+}
+
+// SendMagicPacket sends the Wake-on-LAN magic packet for the device with mac
+// to the broadcast address of each IPv4 subnet of the network interfaces that
+// are up and support broadcasting, from the address on that interface, so that
+// the devices on all attached networks are reached, rather than only the ones
+// on the network of the default route.  If there are no such subnets, the
+// packet is sent to the limited broadcast address.  err is only returned if
+// the packet couldn't be sent at all.
+//
+// UDP datagrams are used instead of raw Ethernet frames, since the network
+// cards accept the magic packet within any payload, and sending those doesn't
+// require the CAP_NET_RAW capability or its equivalents.
+func SendMagicPacket(ctx context.Context, mac net.HardwareAddr) (err error) {
+	pkt, err := NewMagicPacket(mac)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	targets, err := wolTargets()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	var errs []error
+	for _, t := range targets {
+		err = sendMagicPacket(ctx, pkt, t)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == len(targets) {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// wolTarget is a destination of a Wake-on-LAN magic packet.
+type wolTarget struct {
+	// local is the address to send the packet from.  If not valid, it's
+	// chosen by the OS.
+	local netip.Addr
+
+	// broadcast is the broadcast address to send the packet to.
+	broadcast netip.Addr
+}
+
+// wolTargets returns the destinations of the magic packets for the IPv4
+// subnets of the network interfaces, or the limited broadcast address if there
+// are none.
+func wolTargets() (targets []*wolTarget, err error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("getting interfaces: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		const flags = net.FlagUp | net.FlagBroadcast
+		if iface.Flags&flags != flags || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		var addrs []net.Addr
+		addrs, err = iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("getting addresses of %q: %w", iface.Name, err)
+		}
+
+		targets = append(targets, wolTargetsFromAddrs(addrs)...)
+	}
+
+	if len(targets) == 0 {
+		targets = append(targets, &wolTarget{
+			broadcast: netip.AddrFrom4([4]byte{255, 255, 255, 255}),
+		})
+	}
+
+	return targets, nil
+}
+
+// wolTargetsFromAddrs returns the destinations of the magic packets for the
+// IPv4 subnets among the addresses of a network interface.
+func wolTargetsFromAddrs(addrs []net.Addr) (targets []*wolTarget) {
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+
+		ip = ip.Unmap()
+		ones, _ := ipNet.Mask.Size()
+		if !ip.Is4() || ones == 0 || ones >= 31 {
+			continue
+		}
+
+		targets = append(targets, &wolTarget{
+			local:     ip,
+			broadcast: BroadcastFromPref(netip.PrefixFrom(ip, ones)),
+		})
+	}
+
+	return targets
+}
+
+// sendMagicPacket sends pkt to t.
+func sendMagicPacket(ctx context.Context, pkt []byte, t *wolTarget) (err error) {
+	d := &net.Dialer{
+		Control: aghos.BroadcastControl,
+	}
+
+	if t.local.IsValid() {
+		d.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(t.local, 0))
+	}
+
+	dst := netip.AddrPortFrom(t.broadcast, WakeOnLANPort)
+	conn, err := d.DialContext(ctx, "udp4", dst.String())
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", dst, err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.Write(pkt)
+	if err != nil {
+		return fmt.Errorf("sending magic packet to %s: %w", dst, err)
+	}
+
+	return nil
+}
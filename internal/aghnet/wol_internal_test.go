@@ -0,0 +1,37 @@
+package aghnet
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWOLTargetsFromAddrs(t *testing.T) {
+	addrs := []net.Addr{&net.IPNet{
+		IP:   net.IP{192, 168, 1, 2},
+		Mask: net.CIDRMask(24, 32),
+	}, &net.IPNet{
+		IP:   net.IPv4(10, 0, 0, 1),
+		Mask: net.CIDRMask(8, 32),
+	}, &net.IPNet{
+		IP:   net.IP{192, 168, 2, 1},
+		Mask: net.CIDRMask(32, 32),
+	}, &net.IPNet{
+		IP:   net.ParseIP("fd00::1"),
+		Mask: net.CIDRMask(64, 128),
+	}, &net.IPAddr{
+		IP: net.IP{192, 168, 3, 1},
+	}}
+
+	want := []*wolTarget{{
+		local:     netip.MustParseAddr("192.168.1.2"),
+		broadcast: netip.MustParseAddr("192.168.1.255"),
+	}, {
+		local:     netip.MustParseAddr("10.0.0.1"),
+		broadcast: netip.MustParseAddr("10.255.255.255"),
+	}}
+
+	assert.Equal(t, want, wolTargetsFromAddrs(addrs))
+}
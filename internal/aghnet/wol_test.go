@@ -0,0 +1,33 @@
+package aghnet_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMagicPacket(t *testing.T) {
+	mac := net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+
+	pkt, err := aghnet.NewMagicPacket(mac)
+	require.NoError(t, err)
+	require.Len(t, pkt, 102)
+
+	assert.Equal(t, bytes.Repeat([]byte{0xFF}, 6), pkt[:6])
+	for i := 6; i < len(pkt); i += len(mac) {
+		assert.Equal(t, []byte(mac), pkt[i:i+len(mac)])
+	}
+
+	eui64 := net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF, 0x00, 0x11}
+	_, err = aghnet.NewMagicPacket(eui64)
+	testutil.AssertErrorMsg(
+		t,
+		`bad mac address "aa:bb:cc:dd:ee:ff:00:11": expected 6 bytes, got 8`,
+		err,
+	)
+}
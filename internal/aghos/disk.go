@@ -0,0 +1,14 @@
+package aghos
+
+import "fmt"
+
+// DiskFree returns the number of bytes available to unprivileged users on the
+// file system containing path.
+func DiskFree(path string) (free uint64, err error) {
+	free, err = diskFree(path)
+	if err != nil {
+		return 0, fmt.Errorf("getting free disk space: %w", err)
+	}
+
+	return free, nil
+}
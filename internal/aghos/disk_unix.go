@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || linux
+
+package aghos
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskFree returns the number of bytes available to unprivileged users on the
+// file system containing path.
+func diskFree(path string) (free uint64, err error) {
+	st := &unix.Statfs_t{}
+	err = unix.Statfs(path, st)
+	if err != nil {
+		return 0, os.NewSyscallError("statfs", err)
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package aghos
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskFree returns the number of bytes available to unprivileged users on the
+// file system containing path.
+func diskFree(path string) (free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		// Don't wrap the error, since it's wrapped by the caller.
+		return 0, err
+	}
+
+	err = windows.GetDiskFreeSpaceEx(p, &free, nil, nil)
+	if err != nil {
+		return 0, os.NewSyscallError("GetDiskFreeSpaceExW", err)
+	}
+
+	return free, nil
+}
@@ -0,0 +1,27 @@
+package aghos
+
+// FirewallRule is an inbound rule of the OS firewall allowing the traffic to a
+// local port.
+type FirewallRule struct {
+	// Name is the unique name of the rule.
+	Name string
+
+	// Proto is the transport protocol, either "tcp" or "udp".
+	Proto string
+
+	// Port is the local port.
+	Port uint16
+}
+
+// SetFirewallRules replaces the inbound firewall rules of the group with rules
+// for the program at appPath.  It's only implemented on Windows, where the
+// Windows Firewall API is used, and does nothing on the other OSes.
+func SetFirewallRules(group, appPath string, rules []*FirewallRule) (err error) {
+	return setFirewallRules(group, appPath, rules)
+}
+
+// RemoveFirewallRules removes all firewall rules of the group.  It's only
+// implemented on Windows and does nothing on the other OSes.
+func RemoveFirewallRules(group string) (err error) {
+	return removeFirewallRules(group)
+}
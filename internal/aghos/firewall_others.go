@@ -0,0 +1,11 @@
+//go:build !windows
+
+package aghos
+
+func setFirewallRules(_, _ string, _ []*FirewallRule) (err error) {
+	return nil
+}
+
+func removeFirewallRules(_ string) (err error) {
+	return nil
+}
@@ -0,0 +1,188 @@
+//go:build windows
+
+package aghos
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// Constants of the Windows Firewall API.  See
+// https://learn.microsoft.com/en-us/windows/win32/api/icftypes/.
+const (
+	fwRuleDirIn     = 1
+	fwActionAllow   = 1
+	fwProfilesAll   = 0x7fffffff
+	fwIPProtocolTCP = 6
+	fwIPProtocolUDP = 17
+)
+
+// hresultSFalse is the HRESULT returned by CoInitializeEx if COM is already
+// initialized on the thread.
+const hresultSFalse = 1
+
+func setFirewallRules(group, appPath string, rules []*FirewallRule) (err error) {
+	return withFirewallRules(func(fwRules *ole.IDispatch) (err error) {
+		err = removeGroupRules(fwRules, group)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return err
+		}
+
+		for _, r := range rules {
+			err = addFirewallRule(fwRules, group, appPath, r)
+			if err != nil {
+				return fmt.Errorf("adding rule %q: %w", r.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func removeFirewallRules(group string) (err error) {
+	return withFirewallRules(func(fwRules *ole.IDispatch) (err error) {
+		return removeGroupRules(fwRules, group)
+	})
+}
+
+// withFirewallRules calls f with the rules collection of the Windows Firewall
+// policy, the INetFwRules interface.
+func withFirewallRules(f func(fwRules *ole.IDispatch) (err error)) (err error) {
+	// COM is initialized per OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	err = ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED)
+
+	var oleErr *ole.OleError
+	if errors.As(err, &oleErr) && oleErr.Code() == hresultSFalse {
+		err = nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("initializing com: %w", err)
+	}
+	defer ole.CoUninitialize()
+
+	unk, err := oleutil.CreateObject("HNetCfg.FwPolicy2")
+	if err != nil {
+		return fmt.Errorf("creating firewall policy: %w", err)
+	}
+	defer unk.Release()
+
+	policy, err := unk.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("querying firewall policy: %w", err)
+	}
+	defer policy.Release()
+
+	rules, err := oleutil.GetProperty(policy, "Rules")
+	if err != nil {
+		return fmt.Errorf("getting firewall rules: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, rules.Clear()) }()
+
+	return f(rules.ToIDispatch())
+}
+
+// removeGroupRules removes the rules of the group from fwRules.
+func removeGroupRules(fwRules *ole.IDispatch, group string) (err error) {
+	var names []string
+	err = oleutil.ForEach(fwRules, func(v *ole.VARIANT) (err error) {
+		defer func() { err = errors.WithDeferred(err, v.Clear()) }()
+
+		rule := v.ToIDispatch()
+		grouping, err := oleutil.GetProperty(rule, "Grouping")
+		if err != nil {
+			return fmt.Errorf("getting rule grouping: %w", err)
+		}
+		defer func() { err = errors.WithDeferred(err, grouping.Clear()) }()
+
+		if grouping.ToString() != group {
+			return nil
+		}
+
+		name, err := oleutil.GetProperty(rule, "Name")
+		if err != nil {
+			return fmt.Errorf("getting rule name: %w", err)
+		}
+		defer func() { err = errors.WithDeferred(err, name.Clear()) }()
+
+		names = append(names, name.ToString())
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing rules: %w", err)
+	}
+
+	for _, n := range names {
+		_, err = oleutil.CallMethod(fwRules, "Remove", n)
+		if err != nil {
+			return fmt.Errorf("removing rule %q: %w", n, err)
+		}
+	}
+
+	return nil
+}
+
+// addFirewallRule adds the inbound allowing rule r of the group for the program
+// at appPath to fwRules.
+func addFirewallRule(fwRules *ole.IDispatch, group, appPath string, r *FirewallRule) (err error) {
+	var proto int
+	switch r.Proto {
+	case "tcp":
+		proto = fwIPProtocolTCP
+	case "udp":
+		proto = fwIPProtocolUDP
+	default:
+		return fmt.Errorf("protocol: bad value %q", r.Proto)
+	}
+
+	unk, err := oleutil.CreateObject("HNetCfg.FWRule")
+	if err != nil {
+		return fmt.Errorf("creating rule: %w", err)
+	}
+	defer unk.Release()
+
+	rule, err := unk.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("querying rule: %w", err)
+	}
+	defer rule.Release()
+
+	// The protocol must be set before the ports.
+	props := []struct {
+		val  any
+		name string
+	}{
+		{val: r.Name, name: "Name"},
+		{val: group, name: "Grouping"},
+		{val: appPath, name: "ApplicationName"},
+		{val: proto, name: "Protocol"},
+		{val: fmt.Sprint(r.Port), name: "LocalPorts"},
+		{val: fwRuleDirIn, name: "Direction"},
+		{val: fwActionAllow, name: "Action"},
+		{val: fwProfilesAll, name: "Profiles"},
+		{val: true, name: "Enabled"},
+	}
+	for _, p := range props {
+		_, err = oleutil.PutProperty(rule, p.name, p.val)
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", p.name, err)
+		}
+	}
+
+	_, err = oleutil.CallMethod(fwRules, "Add", rule)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	return nil
+}
@@ -145,6 +145,65 @@ func IsOpenWrt() (ok bool) {
 	return isOpenWrt()
 }
 
+// IsContainer returns true if AdGuard Home is running inside a Docker, Podman,
+// or Kubernetes container.  reason describes what the detection is based on.
+// Other environments, such as LXC or systemd-nspawn ones, aren't considered
+// containers, since AdGuard Home is usually updated inside them like on a host.
+func IsContainer() (reason string, ok bool) {
+	return isContainer()
+}
+
+// IsJail returns true if AdGuard Home is running inside a FreeBSD jail.
+func IsJail() (ok bool) {
+	return isJail()
+}
+
+// RawSocketsAllowed returns false if the environment is known to prohibit the
+// raw sockets, for example a FreeBSD jail without the allow.raw_sockets
+// parameter.
+func RawSocketsAllowed() (ok bool) {
+	return rawSocketsAllowed()
+}
+
+// containerCgroupNames are the substrings of the control groups of the init
+// process specific to the Docker, Podman, and Kubernetes containers.
+var containerCgroupNames = []string{
+	"docker",
+	"kubepods",
+	"libpod",
+}
+
+// isContainerFS returns true if the filesystem fsys, rooted at the root
+// directory of a Linux system, belongs to a Docker, Podman, or Kubernetes
+// container.  reason describes what the detection is based on.
+func isContainerFS(fsys fs.FS) (reason string, ok bool) {
+	for _, name := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			return fmt.Sprintf("file /%s exists", name), true
+		}
+	}
+
+	// Don't use ReadFile, since the file may be large on the hosts with many
+	// control groups.
+	f, err := fsys.Open("proc/1/cgroup")
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = f.Close() }()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if slices.ContainsFunc(containerCgroupNames, func(n string) (found bool) {
+			return strings.Contains(line, n)
+		}) {
+			return fmt.Sprintf("init process control group %q", line), true
+		}
+	}
+
+	return "", false
+}
+
 // NotifyReconfigureSignal notifies c on receiving reconfigure signals.
 func NotifyReconfigureSignal(c chan<- os.Signal) {
 	notifyReconfigureSignal(c)
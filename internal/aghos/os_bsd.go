@@ -19,6 +19,18 @@ func haveAdminRights() (bool, error) {
 	return os.Getuid() == 0, nil
 }
 
+func isContainer() (reason string, ok bool) {
+	return "", false
+}
+
 func isOpenWrt() (ok bool) {
 	return false
 }
+
+func isJail() (ok bool) {
+	return false
+}
+
+func rawSocketsAllowed() (ok bool) {
+	return true
+}
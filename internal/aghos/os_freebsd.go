@@ -5,6 +5,8 @@ package aghos
 import (
 	"os"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func setRlimit(val uint64) (err error) {
@@ -19,6 +21,27 @@ func haveAdminRights() (bool, error) {
 	return os.Getuid() == 0, nil
 }
 
+func isContainer() (reason string, ok bool) {
+	return "", false
+}
+
 func isOpenWrt() (ok bool) {
 	return false
 }
+
+func isJail() (ok bool) {
+	jailed, err := unix.SysctlUint32("security.jail.jailed")
+
+	return err == nil && jailed == 1
+}
+
+func rawSocketsAllowed() (ok bool) {
+	if !isJail() {
+		return true
+	}
+
+	// Inside a jail, the sysctl reports the parameter of the jail itself.
+	allowed, err := unix.SysctlUint32("security.jail.allow_raw_sockets")
+
+	return err == nil && allowed == 1
+}
@@ -3,6 +3,7 @@
 package aghos
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"syscall"
@@ -25,6 +26,18 @@ func haveAdminRights() (bool, error) {
 	return os.Getuid() == 0, nil
 }
 
+func isContainer() (reason string, ok bool) {
+	// Podman sets the environment variable of the init process, which is
+	// inherited unless the environment is reset.  Other runtimes, such as LXC
+	// and systemd-nspawn, set it as well, so only check for the known values.
+	switch env := os.Getenv("container"); env {
+	case "docker", "podman":
+		return fmt.Sprintf("environment variable container=%q", env), true
+	default:
+		return isContainerFS(osutil.RootDirFS())
+	}
+}
+
 func isOpenWrt() (ok bool) {
 	const etcReleasePattern = "etc/*release*"
 
@@ -45,3 +58,11 @@ func isOpenWrt() (ok bool) {
 
 	return err == nil && ok
 }
+
+func isJail() (ok bool) {
+	return false
+}
+
+func rawSocketsAllowed() (ok bool) {
+	return true
+}
@@ -3,6 +3,7 @@ package aghos
 import (
 	"bytes"
 	"testing"
+	"testing/fstest"
 
 	"github.com/AdguardTeam/golibs/ioutil"
 	"github.com/stretchr/testify/assert"
@@ -95,3 +96,74 @@ func TestLargestLabeled(t *testing.T) {
 		assert.Equal(t, 1, instances)
 	})
 }
+
+func TestIsContainerFS(t *testing.T) {
+	const cgroupHost = "0::/init.scope\n"
+
+	testCases := []struct {
+		fsys       fstest.MapFS
+		name       string
+		wantReason string
+		want       bool
+	}{{
+		fsys: fstest.MapFS{
+			"proc/1/cgroup": &fstest.MapFile{Data: []byte(cgroupHost)},
+		},
+		name:       "host",
+		wantReason: "",
+		want:       false,
+	}, {
+		fsys: fstest.MapFS{},
+		name:       "no_proc",
+		wantReason: "",
+		want:       false,
+	}, {
+		fsys: fstest.MapFS{
+			".dockerenv":    &fstest.MapFile{},
+			"proc/1/cgroup": &fstest.MapFile{Data: []byte("0::/\n")},
+		},
+		name:       "docker",
+		wantReason: "file /.dockerenv exists",
+		want:       true,
+	}, {
+		fsys: fstest.MapFS{
+			"run/.containerenv": &fstest.MapFile{},
+		},
+		name:       "podman",
+		wantReason: "file /run/.containerenv exists",
+		want:       true,
+	}, {
+		fsys: fstest.MapFS{
+			"proc/1/cgroup": &fstest.MapFile{
+				Data: []byte("12:cpuset:/kubepods/besteffort/pod1234\n" + cgroupHost),
+			},
+		},
+		name:       "kubernetes",
+		wantReason: `init process control group "12:cpuset:/kubepods/besteffort/pod1234"`,
+		want:       true,
+	}, {
+		fsys: fstest.MapFS{
+			"proc/1/cgroup": &fstest.MapFile{Data: []byte("0::/lxc.payload.host\n")},
+		},
+		name:       "lxc",
+		wantReason: "",
+		want:       false,
+	}, {
+		fsys: fstest.MapFS{
+			"proc/1/cgroup": &fstest.MapFile{
+				Data: []byte("0::/system.slice/containerd.service\n"),
+			},
+		},
+		name:       "containerd_host",
+		wantReason: "",
+		want:       false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, ok := isContainerFS(tc.fsys)
+			assert.Equal(t, tc.want, ok)
+			assert.Equal(t, tc.wantReason, reason)
+		})
+	}
+}
@@ -34,10 +34,22 @@ func haveAdminRights() (bool, error) {
 	return true, nil
 }
 
+func isContainer() (reason string, ok bool) {
+	return "", false
+}
+
 func isOpenWrt() (ok bool) {
 	return false
 }
 
+func isJail() (ok bool) {
+	return false
+}
+
+func rawSocketsAllowed() (ok bool) {
+	return true
+}
+
 func notifyReconfigureSignal(c chan<- os.Signal) {
 	signal.Notify(c, windows.SIGHUP)
 }
@@ -0,0 +1,31 @@
+package aghos
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ReplacePFTable replaces the contents of the pf(4) table with the name by
+// prefixes using pfctl(8).  The table is created, if it doesn't exist.
+func ReplacePFTable(name string, prefixes []netip.Prefix) (err error) {
+	args := []string{"-q", "-t", name, "-T", "replace"}
+	if len(prefixes) == 0 {
+		// Load the addresses from an empty file to make sure the table is
+		// created and emptied.
+		args = append(args, "-f", "/dev/null")
+	}
+
+	for _, p := range prefixes {
+		args = append(args, p.String())
+	}
+
+	code, out, err := RunCommand("pfctl", args...)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("pfctl: unexpected exit code %d: %s", code, out)
+	}
+
+	return nil
+}
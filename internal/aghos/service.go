@@ -4,3 +4,16 @@ package aghos
 func PreCheckActionStart() (err error) {
 	return preCheckActionStart()
 }
+
+// EnableService makes the installed service with the name start on boot, if
+// the service manager of the OS requires that explicitly.  Currently, only
+// FreeBSD does, where the rc.conf(5) variable of the service is set.
+func EnableService(name string) (err error) {
+	return enableService(name)
+}
+
+// DisableService reverts the effect of [EnableService] for the service with the
+// name.
+func DisableService(name string) (err error) {
+	return disableService(name)
+}
@@ -0,0 +1,26 @@
+//go:build freebsd
+
+package aghos
+
+import "fmt"
+
+func enableService(name string) (err error) {
+	return runSysrc(name + "_enable=YES")
+}
+
+func disableService(name string) (err error) {
+	return runSysrc("-x", name+"_enable")
+}
+
+// runSysrc runs sysrc(8) with args to change the rc.conf(5) variables.
+func runSysrc(args ...string) (err error) {
+	code, out, err := RunCommand("sysrc", args...)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("sysrc: unexpected exit code %d: %s", code, out)
+	}
+
+	return nil
+}
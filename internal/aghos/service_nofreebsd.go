@@ -0,0 +1,11 @@
+//go:build !freebsd
+
+package aghos
+
+func enableService(_ string) (err error) {
+	return nil
+}
+
+func disableService(_ string) (err error) {
+	return nil
+}
@@ -0,0 +1,24 @@
+package aghos
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// BroadcastControl is the function to be set to [net.Dialer.Control] and
+// [net.ListenConfig.Control].  It configures the socket to allow sending the
+// broadcast datagrams.
+func BroadcastControl(_, _ string, c syscall.RawConn) (err error) {
+	err = setBroadcast(c)
+
+	return errors.Annotate(err, "setting broadcast option: %w")
+}
+
+// KeepOnExec clears the close-on-exec flag of f, so that the descriptor is
+// inherited by the program replacing the current process.  It returns an error
+// wrapping [errors.ErrUnsupported] on the platforms without such a flag.
+func KeepOnExec(f *os.File) (err error) {
+	return keepOnExec(f)
+}
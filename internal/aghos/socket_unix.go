@@ -0,0 +1,40 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package aghos
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setBroadcast enables sending the broadcast datagrams from the socket.
+func setBroadcast(c syscall.RawConn) (err error) {
+	cerr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+		if err != nil {
+			err = os.NewSyscallError("setsockopt", err)
+		}
+	})
+
+	return errors.Join(err, cerr)
+}
+
+// keepOnExec clears the close-on-exec flag of f.  It doesn't use f.Fd, since
+// that puts the descriptor into the blocking mode.
+func keepOnExec(f *os.File) (err error) {
+	c, err := f.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("getting raw conn: %w", err)
+	}
+
+	cerr := c.Control(func(fd uintptr) {
+		_, err = unix.FcntlInt(fd, unix.F_SETFD, 0)
+		err = os.NewSyscallError("fcntl", err)
+	})
+
+	return errors.Join(err, cerr)
+}
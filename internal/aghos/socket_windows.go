@@ -0,0 +1,29 @@
+//go:build windows
+
+package aghos
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/sys/windows"
+)
+
+// setBroadcast enables sending the broadcast datagrams from the socket.
+func setBroadcast(c syscall.RawConn) (err error) {
+	cerr := c.Control(func(fd uintptr) {
+		err = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_BROADCAST, 1)
+		if err != nil {
+			err = os.NewSyscallError("setsockopt", err)
+		}
+	})
+
+	return errors.Join(err, cerr)
+}
+
+// keepOnExec is not supported on Windows, since the processes can't be
+// replaced there.
+func keepOnExec(_ *os.File) (err error) {
+	return Unsupported("keeping descriptors on exec")
+}
@@ -0,0 +1,13 @@
+package aghos
+
+import "io/fs"
+
+// Stat is like [os.Stat], but on Windows the permission bits of the returned
+// [fs.FileInfo] are derived from the access control list of the file instead of
+// the read-only attribute: the access allowed to the owner, the primary group,
+// and everyone else are reported as the user, group, and other bits.  The
+// denying entries are ignored, so the result is an approximation of the actual
+// access there.
+func Stat(name string) (fi fs.FileInfo, err error) {
+	return stat(name)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package aghos
+
+import (
+	"io/fs"
+	"os"
+)
+
+func stat(name string) (fi fs.FileInfo, err error) {
+	return os.Stat(name)
+}
@@ -0,0 +1,167 @@
+//go:build windows
+
+package aghos
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Access rights of the access control entries, see
+// https://learn.microsoft.com/en-us/windows/win32/fileio/file-access-rights-constants.
+const (
+	accessRead    = windows.GENERIC_READ | windows.GENERIC_ALL | windows.FILE_READ_DATA
+	accessWrite   = windows.GENERIC_WRITE | windows.GENERIC_ALL | windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA
+	accessExecute = windows.GENERIC_EXECUTE | windows.GENERIC_ALL | windows.FILE_EXECUTE
+)
+
+func stat(name string) (fi fs.FileInfo, err error) {
+	fi, err = os.Stat(name)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	perm, err := aclPerm(name)
+	if err != nil {
+		return nil, fmt.Errorf("getting permissions of %q: %w", name, err)
+	}
+
+	return &permFileInfo{
+		FileInfo: fi,
+		perm:     perm,
+	}, nil
+}
+
+// permFileInfo is an [fs.FileInfo] with the permission bits replaced.
+type permFileInfo struct {
+	fs.FileInfo
+
+	perm fs.FileMode
+}
+
+// type check
+var _ fs.FileInfo = (*permFileInfo)(nil)
+
+// Mode implements the [fs.FileInfo] interface for *permFileInfo.
+func (fi *permFileInfo) Mode() (m fs.FileMode) {
+	return fi.FileInfo.Mode()&^fs.ModePerm | fi.perm
+}
+
+// aclPerm returns the permission bits derived from the discretionary access
+// control list of the file at name.
+func aclPerm(name string) (perm fs.FileMode, err error) {
+	sd, err := windows.GetNamedSecurityInfo(
+		name,
+		windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|
+			windows.GROUP_SECURITY_INFORMATION|
+			windows.DACL_SECURITY_INFORMATION,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("getting security info: %w", err)
+	}
+
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return 0, fmt.Errorf("getting owner: %w", err)
+	}
+
+	group, _, err := sd.Group()
+	if err != nil {
+		return 0, fmt.Errorf("getting group: %w", err)
+	}
+
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return 0, fmt.Errorf("getting access control list: %w", err)
+	}
+
+	if dacl == nil {
+		// A null list allows full access to everyone.
+		return fs.ModePerm, nil
+	}
+
+	others, err := othersSIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range dacl.AceCount {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		err = windows.GetAce(dacl, uint32(i), &ace)
+		if err != nil {
+			return 0, fmt.Errorf("getting access control entry at index %d: %w", i, err)
+		}
+
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE ||
+			ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 {
+			continue
+		}
+
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		bits := maskPerm(ace.Mask)
+		switch {
+		case sid.Equals(owner):
+			perm |= bits << 6
+		case sid.Equals(group):
+			perm |= bits << 3
+		case isAnyOf(sid, others):
+			perm |= bits
+		}
+	}
+
+	return perm, nil
+}
+
+// othersSIDs returns the security identifiers of the groups containing every
+// user of the system.
+func othersSIDs() (sids []*windows.SID, err error) {
+	for _, t := range []windows.WELL_KNOWN_SID_TYPE{
+		windows.WinWorldSid,
+		windows.WinAuthenticatedUserSid,
+		windows.WinBuiltinUsersSid,
+	} {
+		var sid *windows.SID
+		sid, err = windows.CreateWellKnownSid(t)
+		if err != nil {
+			return nil, fmt.Errorf("creating well-known sid %d: %w", t, err)
+		}
+
+		sids = append(sids, sid)
+	}
+
+	return sids, nil
+}
+
+// isAnyOf returns true if sid equals any of sids.
+func isAnyOf(sid *windows.SID, sids []*windows.SID) (ok bool) {
+	for _, s := range sids {
+		if sid.Equals(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskPerm returns the read, write, and execute bits for the access mask.
+func maskPerm(mask windows.ACCESS_MASK) (bits fs.FileMode) {
+	if mask&accessRead != 0 {
+		bits |= 0o4
+	}
+
+	if mask&accessWrite != 0 {
+		bits |= 0o2
+	}
+
+	if mask&accessExecute != 0 {
+		bits |= 0o1
+	}
+
+	return bits
+}
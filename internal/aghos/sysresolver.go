@@ -0,0 +1,60 @@
+package aghos
+
+import (
+	"bufio"
+	"bytes"
+	"net/netip"
+	"strings"
+)
+
+// SystemResolvers maps the names of the network services of the OS to their
+// DNS servers.  An empty list means that the servers are provided by the
+// network, for example via DHCP.
+type SystemResolvers map[string][]string
+
+// SetSystemResolvers sets the DNS servers of all enabled network services to
+// addrs and returns the previous ones.  It's only supported on macOS, where the
+// DNS settings of the System Configuration, as shown by scutil --dns, are
+// changed using networksetup(8).
+func SetSystemResolvers(addrs []netip.Addr) (prev SystemResolvers, err error) {
+	return setSystemResolvers(addrs)
+}
+
+// RestoreSystemResolvers sets the DNS servers of the network services back to
+// the ones from prev, as returned by [SetSystemResolvers].  It's only supported
+// on macOS.
+func RestoreSystemResolvers(prev SystemResolvers) (err error) {
+	return restoreSystemResolvers(prev)
+}
+
+// parseNetworkServices returns the names of the enabled network services from
+// the output of networksetup -listallnetworkservices.  The disabled services
+// are marked with an asterisk.
+func parseNetworkServices(out []byte) (services []string) {
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "*") || strings.HasPrefix(line, "An asterisk") {
+			continue
+		}
+
+		services = append(services, line)
+	}
+
+	return services
+}
+
+// parseDNSServers returns the DNS servers from the output of networksetup
+// -getdnsservers.  Any line that isn't an IP address, like the message about
+// the absence of the servers, is skipped.
+func parseDNSServers(out []byte) (servers []string) {
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if _, err := netip.ParseAddr(line); err == nil {
+			servers = append(servers, line)
+		}
+	}
+
+	return servers
+}
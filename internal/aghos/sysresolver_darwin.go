@@ -0,0 +1,97 @@
+//go:build darwin
+
+package aghos
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// networkSetupEmpty is the networksetup argument that removes the manually set
+// DNS servers.
+const networkSetupEmpty = "Empty"
+
+func setSystemResolvers(addrs []netip.Addr) (prev SystemResolvers, err error) {
+	out, err := networkSetup("-listallnetworkservices")
+	if err != nil {
+		return nil, fmt.Errorf("listing network services: %w", err)
+	}
+
+	services := parseNetworkServices(out)
+	prev = make(SystemResolvers, len(services))
+	for _, svc := range services {
+		out, err = networkSetup("-getdnsservers", svc)
+		if err != nil {
+			return nil, fmt.Errorf("getting dns servers of %q: %w", svc, err)
+		}
+
+		prev[svc] = parseDNSServers(out)
+	}
+
+	servers := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		servers = append(servers, a.String())
+	}
+
+	for _, svc := range services {
+		_, err = networkSetup(append([]string{"-setdnsservers", svc}, servers...)...)
+		if err != nil {
+			// Put back the servers of the services set so far.
+			return nil, errors.Join(
+				fmt.Errorf("setting dns servers of %q: %w", svc, err),
+				restoreSystemResolvers(prev),
+			)
+		}
+	}
+
+	flushDNSCache()
+
+	return prev, nil
+}
+
+func restoreSystemResolvers(prev SystemResolvers) (err error) {
+	var errs []error
+	for svc, servers := range prev {
+		if len(servers) == 0 {
+			servers = []string{networkSetupEmpty}
+		}
+
+		_, err = networkSetup(append([]string{"-setdnsservers", svc}, servers...)...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restoring dns servers of %q: %w", svc, err))
+		}
+	}
+
+	flushDNSCache()
+
+	return errors.Join(errs...)
+}
+
+// networkSetup runs networksetup(8) with args and returns its output.
+func networkSetup(args ...string) (out []byte, err error) {
+	code, out, err := RunCommand("networksetup", args...)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	} else if code != 0 {
+		return nil, fmt.Errorf("networksetup: unexpected exit code %d: %s", code, out)
+	}
+
+	return out, nil
+}
+
+// flushDNSCache makes the system resolver and mDNSResponder drop the cached
+// responses, so that the new DNS servers are used right away.
+func flushDNSCache() {
+	for _, cmd := range [][]string{
+		{"dscacheutil", "-flushcache"},
+		{"killall", "-HUP", "mDNSResponder"},
+	} {
+		if _, _, err := RunCommand(cmd[0], cmd[1:]...); err != nil {
+			log.Debug("flushing dns cache: running %s: %s", cmd[0], err)
+		}
+	}
+}
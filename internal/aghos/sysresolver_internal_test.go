@@ -0,0 +1,40 @@
+package aghos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetworkServices(t *testing.T) {
+	const out = `An asterisk (*) denotes that a network service is disabled.
+Wi-Fi
+*Thunderbolt Bridge
+USB 10/100/1000 LAN
+
+`
+
+	assert.Equal(t, []string{"Wi-Fi", "USB 10/100/1000 LAN"}, parseNetworkServices([]byte(out)))
+}
+
+func TestParseDNSServers(t *testing.T) {
+	testCases := []struct {
+		name string
+		out  string
+		want []string
+	}{{
+		name: "servers",
+		out:  "192.0.2.1\n2001:db8::1\n",
+		want: []string{"192.0.2.1", "2001:db8::1"},
+	}, {
+		name: "none",
+		out:  "There aren't any DNS Servers set on Wi-Fi.\n",
+		want: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseDNSServers([]byte(tc.out)))
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package aghos
+
+import "net/netip"
+
+func setSystemResolvers(_ []netip.Addr) (_ SystemResolvers, err error) {
+	return nil, Unsupported("setting system resolvers")
+}
+
+func restoreSystemResolvers(_ SystemResolvers) (err error) {
+	return Unsupported("restoring system resolvers")
+}
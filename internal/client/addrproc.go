@@ -1,6 +1,7 @@
 package client
 
 import (
+	"cmp"
 	"context"
 	"log/slog"
 	"net/netip"
@@ -63,6 +64,10 @@ type DefaultAddrProcConfig struct {
 	// immediately by [NewDefaultAddrProc].
 	InitialAddresses []netip.Addr
 
+	// WHOISTimeout is the timeout for WHOIS requests.  If it's zero, the
+	// default timeout of 5 seconds is used.
+	WHOISTimeout time.Duration
+
 	// CatchPanics, if true, makes the address processor catch and log panics.
 	//
 	// TODO(a.garipov): Consider better ways to do this or apply this method to
@@ -164,7 +169,11 @@ func NewDefaultAddrProc(c *DefaultAddrProcConfig) (p *DefaultAddrProc) {
 	}
 
 	if c.UseWHOIS {
-		p.whois = newWHOIS(c.BaseLogger.With(slogutil.KeyPrefix, "whois"), c.DialContext)
+		p.whois = newWHOIS(
+			c.BaseLogger.With(slogutil.KeyPrefix, "whois"),
+			c.DialContext,
+			c.WHOISTimeout,
+		)
 	}
 
 	// TODO(s.chzhen):  Pass context.
@@ -180,9 +189,12 @@ func NewDefaultAddrProc(c *DefaultAddrProcConfig) (p *DefaultAddrProc) {
 }
 
 // newWHOIS returns a whois.Interface instance using the given function for
-// dialing.
-func newWHOIS(logger *slog.Logger, dialFunc aghnet.DialContextFunc) (w whois.Interface) {
-	// TODO(s.chzhen):  Consider making configurable.
+// dialing.  If timeout is zero, the default one is used.
+func newWHOIS(
+	logger *slog.Logger,
+	dialFunc aghnet.DialContextFunc,
+	timeout time.Duration,
+) (w whois.Interface) {
 	const (
 		// defaultTimeout is the timeout for WHOIS requests.
 		defaultTimeout = 5 * time.Second
@@ -203,7 +215,7 @@ func newWHOIS(logger *slog.Logger, dialFunc aghnet.DialContextFunc) (w whois.Int
 		DialContext:     dialFunc,
 		ServerAddr:      whois.DefaultServer,
 		Port:            whois.DefaultPort,
-		Timeout:         defaultTimeout,
+		Timeout:         cmp.Or(timeout, defaultTimeout),
 		CacheSize:       defaultCacheSize,
 		MaxConnReadSize: defaultMaxConnReadSize,
 		MaxRedirects:    defaultMaxRedirects,
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DNSSECMode defines whether DNSSEC is enabled for a persistent client.
+type DNSSECMode string
+
+// DNSSECMode values.
+const (
+	// DNSSECModeDefault means that the DNSSEC setting of the DNS server is
+	// used.  The empty DNSSECMode is also treated as this one.
+	DNSSECModeDefault DNSSECMode = "default"
+
+	// DNSSECModeEnabled means that DNSSEC is enabled for the client regardless
+	// of the setting of the DNS server.
+	DNSSECModeEnabled DNSSECMode = "enabled"
+
+	// DNSSECModeDisabled means that DNSSEC is disabled for the client
+	// regardless of the setting of the DNS server, and the upstreams are asked
+	// not to validate the responses.  It's intended for the devices breaking
+	// when getting SERVFAIL for the domains with broken signatures.
+	DNSSECModeDisabled DNSSECMode = "disabled"
+)
+
+// validate returns an error if m isn't a valid DNSSECMode.
+func (m DNSSECMode) validate() (err error) {
+	switch m {
+	case "", DNSSECModeDefault, DNSSECModeEnabled, DNSSECModeDisabled:
+		return nil
+	default:
+		return fmt.Errorf("dnssec: %w: %q", errors.ErrBadEnumValue, m)
+	}
+}
+
+// NullBool returns the DNSSEC setting overriding the one of the DNS server, or
+// [aghalg.NBNull] if m doesn't override it.
+func (m DNSSECMode) NullBool() (nb aghalg.NullBool) {
+	switch m {
+	case DNSSECModeEnabled:
+		return aghalg.NBTrue
+	case DNSSECModeDisabled:
+		return aghalg.NBFalse
+	default:
+		return aghalg.NBNull
+	}
+}
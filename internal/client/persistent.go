@@ -9,8 +9,11 @@ import (
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
@@ -64,6 +67,10 @@ type Persistent struct {
 	// upstream must be used.
 	UpstreamConfig *proxy.CustomUpstreamConfig
 
+	// BootstrapResolvers are the resolvers of the client-specific bootstrap DNS
+	// servers used by UpstreamConfig.  They are closed along with it.
+	BootstrapResolvers []*upstream.UpstreamResolver
+
 	// SafeSearch handles search engine hosts rewrites.
 	SafeSearch filtering.SafeSearch
 
@@ -71,15 +78,36 @@ type Persistent struct {
 	// must not be nil after initialization.
 	BlockedServices *filtering.BlockedServices
 
+	// PauseSchedule is the schedule of pausing the internet access of the
+	// client.  If it's nil, the access isn't paused by schedule.
+	PauseSchedule *schedule.Weekly
+
+	// ServiceSchedules are the schedules of switching the client to other
+	// profiles of blocked services.  The first active one is used, see
+	// [Persistent.ActiveServiceSchedule].
+	ServiceSchedules []*ServiceSchedule
+
 	// Name of the persistent client.  Must not be empty.
 	Name string
 
 	// Tags is a list of client tags that categorize the client.
 	Tags []string
 
+	// Group is the name of the group of the client, for example a class or a
+	// department.  It only categorizes the client and may be empty.
+	Group string
+
 	// Upstreams is a list of custom upstream DNS servers for the client.
 	Upstreams []string
 
+	// BootstrapDNS is a list of custom bootstrap DNS servers resolving the
+	// hostnames of Upstreams.  If it's empty, the global ones are used.
+	BootstrapDNS []string
+
+	// UpstreamMode is the way the requests are distributed among Upstreams.  If
+	// it's empty, the upstream mode of the DNS server is used.
+	UpstreamMode UpstreamMode
+
 	// IPs is a list of IP addresses that identify the client.  The client must
 	// have at least one ID (IP, subnet, MAC, or ClientID).
 	IPs []netip.Addr
@@ -98,6 +126,21 @@ type Persistent struct {
 	// (IP, subnet, MAC, or ClientID).
 	ClientIDs []string
 
+	// PauseAllowlist are the domain names, including their subdomains, which
+	// are still resolved for the client while its internet access is paused.
+	PauseAllowlist []string
+
+	// DNS64Exclusions are the domain names, including their subdomains, for
+	// which AAAA records are never synthesized by DNS64 for the client.
+	DNS64Exclusions []string
+
+	// DNS64Prefix, if valid, is the NAT64 prefix used instead of the global one
+	// to synthesize AAAA records by DNS64 for the client.
+	DNS64Prefix netip.Prefix
+
+	// DNSSEC defines whether DNSSEC is enabled for the client.
+	DNSSEC DNSSECMode
+
 	// UID is the unique identifier of the persistent client.
 	UID UID
 
@@ -128,6 +171,15 @@ type Persistent struct {
 	// IgnoreStatistics  specifies whether the client requests are counted.
 	IgnoreStatistics bool
 
+	// Paused specifies whether the internet access of the client is paused
+	// regardless of PauseSchedule.
+	Paused bool
+
+	// BlockQUIC specifies whether the client is prevented from using QUIC by
+	// answering the requests for the well-known QUIC bootstrap hostnames with
+	// NXDOMAIN and removing the "h3" ALPN values from the HTTPS records.
+	BlockQUIC bool
+
 	// SafeSearchConf is the safe search filtering configuration.
 	//
 	// TODO(d.kolyshev): Make SafeSearchConf a pointer.
@@ -156,6 +208,30 @@ func (c *Persistent) validate(ctx context.Context, l *slog.Logger, allTags []str
 		l.ErrorContext(ctx, "client: closing upstream config", slogutil.KeyError, err)
 	}
 
+	boots, err := aghnet.ParseBootstraps(c.BootstrapDNS, nil)
+	if err != nil {
+		return fmt.Errorf("invalid bootstrap servers: %w", err)
+	}
+
+	for _, b := range boots {
+		err = b.Close()
+		if err != nil {
+			l.ErrorContext(ctx, "client: closing bootstrap", slogutil.KeyError, err)
+		}
+	}
+
+	err = c.DNSSEC.validate()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	err = c.UpstreamMode.validate()
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
 	for _, t := range c.Tags {
 		_, ok := slices.BinarySearch(allTags, t)
 		if !ok {
@@ -166,6 +242,86 @@ func (c *Persistent) validate(ctx context.Context, l *slog.Logger, allTags []str
 	// TODO(s.chzhen):  Move to the constructor.
 	slices.Sort(c.Tags)
 
+	for i, d := range c.PauseAllowlist {
+		c.PauseAllowlist[i], err = aghnet.ParseDomainName(d)
+		if err != nil {
+			return fmt.Errorf("pause allowlist: at index %d: %w", i, err)
+		}
+	}
+
+	err = validateDNS64Prefix(c.DNS64Prefix)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	for i, d := range c.DNS64Exclusions {
+		c.DNS64Exclusions[i], err = aghnet.ParseDomainName(d)
+		if err != nil {
+			return fmt.Errorf("dns64 exclusions: at index %d: %w", i, err)
+		}
+	}
+
+	return validateServiceSchedules(c.ServiceSchedules)
+}
+
+// validateServiceSchedules returns an error if any of scheds is invalid or if
+// their names aren't unique.
+func validateServiceSchedules(scheds []*ServiceSchedule) (err error) {
+	names := make(map[string]struct{}, len(scheds))
+	for i, s := range scheds {
+		if s == nil {
+			return fmt.Errorf("service schedules: at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		err = s.validate()
+		if err != nil {
+			return fmt.Errorf("service schedules: at index %d: %w", i, err)
+		}
+
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("service schedules: at index %d: duplicate name %q", i, s.Name)
+		}
+
+		names[s.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// maxDNS64PrefixLen is the maximum length of a NAT64 prefix, see RFC 6052.
+const maxDNS64PrefixLen = 96
+
+// validateDNS64Prefix returns an error if pref is neither empty nor a valid
+// NAT64 prefix.
+func validateDNS64Prefix(pref netip.Prefix) (err error) {
+	switch {
+	case pref == netip.Prefix{}:
+		return nil
+	case !pref.Addr().Is6() || pref.Addr().Is4In6():
+		return fmt.Errorf("dns64 prefix: %s is not an ipv6 prefix", pref)
+	case pref.Bits() > maxDNS64PrefixLen:
+		return fmt.Errorf("dns64 prefix: %s is longer than %d bits", pref, maxDNS64PrefixLen)
+	default:
+		return nil
+	}
+}
+
+// IsPaused returns true if the internet access of the client is paused at now,
+// either manually or by the schedule.
+func (c *Persistent) IsPaused(now time.Time) (ok bool) {
+	return c.Paused || (c.PauseSchedule != nil && c.PauseSchedule.Contains(now))
+}
+
+// ActiveServiceSchedule returns the first service schedule of the client which
+// contains now or nil if there is none.
+func (c *Persistent) ActiveServiceSchedule(now time.Time) (s *ServiceSchedule) {
+	for _, s = range c.ServiceSchedules {
+		if s.Contains(now) {
+			return s
+		}
+	}
+
 	return nil
 }
 
@@ -302,8 +458,13 @@ func (c *Persistent) ShallowClone() (clone *Persistent) {
 	*clone = *c
 
 	clone.BlockedServices = c.BlockedServices.Clone()
+	clone.PauseSchedule = c.PauseSchedule.Clone()
+	clone.ServiceSchedules = CloneServiceSchedules(c.ServiceSchedules)
+	clone.PauseAllowlist = slices.Clone(c.PauseAllowlist)
+	clone.DNS64Exclusions = slices.Clone(c.DNS64Exclusions)
 	clone.Tags = slices.Clone(c.Tags)
 	clone.Upstreams = slices.Clone(c.Upstreams)
+	clone.BootstrapDNS = slices.Clone(c.BootstrapDNS)
 
 	clone.IPs = slices.Clone(c.IPs)
 	clone.Subnets = slices.Clone(c.Subnets)
@@ -321,5 +482,11 @@ func (c *Persistent) CloseUpstreams() (err error) {
 		}
 	}
 
+	for _, b := range c.BootstrapResolvers {
+		if err = b.Close(); err != nil {
+			return fmt.Errorf("closing bootstraps of client %q: %w", c.Name, err)
+		}
+	}
+
 	return nil
 }
@@ -2,7 +2,9 @@ package client
 
 import (
 	"testing"
+	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -122,3 +124,45 @@ func TestPersistent_EqualIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestPersistent_IsPaused(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		sch    *schedule.Weekly
+		want   assert.BoolAssertionFunc
+		name   string
+		paused bool
+	}{{
+		sch:    nil,
+		want:   assert.False,
+		name:   "not_paused",
+		paused: false,
+	}, {
+		sch:    nil,
+		want:   assert.True,
+		name:   "paused",
+		paused: true,
+	}, {
+		sch:    schedule.EmptyWeekly(),
+		want:   assert.False,
+		name:   "empty_schedule",
+		paused: false,
+	}, {
+		sch:    schedule.FullWeekly(),
+		want:   assert.True,
+		name:   "full_schedule",
+		paused: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Persistent{
+				PauseSchedule: tc.sch,
+				Paused:        tc.paused,
+			}
+
+			tc.want(t, c.IsPaused(now))
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// serviceScheduleTimeLayout is the layout of the times of day in the
+// configuration of the service schedules.
+const serviceScheduleTimeLayout = "15:04"
+
+// weekdayNames are the short names of the days of the week used in the
+// configuration.  The indexes of this array are the [time.Weekday] values.
+var weekdayNames = [7]string{
+	time.Sunday:    "sun",
+	time.Monday:    "mon",
+	time.Tuesday:   "tue",
+	time.Wednesday: "wed",
+	time.Thursday:  "thu",
+	time.Friday:    "fri",
+	time.Saturday:  "sat",
+}
+
+// ServiceSchedule is a schedule of switching a persistent client to its own
+// profile of blocked services, for example blocking social media at night.
+type ServiceSchedule struct {
+	// Location is the time zone of the schedule.  It must not be nil.
+	Location *time.Location
+
+	// Name is the name of the schedule.  It must not be empty and must be
+	// unique within the client.
+	Name string
+
+	// BlockedServices are the IDs of the services blocked while the schedule
+	// is active.  They replace the other blocked services of the client.
+	BlockedServices []string
+
+	// Days are the days of the week on which the schedule begins.
+	Days []time.Weekday
+
+	// Start is the offset from the beginning of the day at which the schedule
+	// becomes active.  It must be less than 24h.
+	Start time.Duration
+
+	// End is the offset from the beginning of the day at which the schedule
+	// becomes inactive.  It must be less than 24h.  If it isn't greater than
+	// Start, the schedule ends on the next day.
+	End time.Duration
+}
+
+// Clone returns a deep copy of s.
+func (s *ServiceSchedule) Clone() (c *ServiceSchedule) {
+	if s == nil {
+		return nil
+	}
+
+	c = &ServiceSchedule{}
+	*c = *s
+
+	c.BlockedServices = slices.Clone(s.BlockedServices)
+	c.Days = slices.Clone(s.Days)
+
+	return c
+}
+
+// CloneServiceSchedules returns a deep copy of scheds.
+func CloneServiceSchedules(scheds []*ServiceSchedule) (clone []*ServiceSchedule) {
+	if scheds == nil {
+		return nil
+	}
+
+	clone = make([]*ServiceSchedule, 0, len(scheds))
+	for _, s := range scheds {
+		clone = append(clone, s.Clone())
+	}
+
+	return clone
+}
+
+// Contains returns true if t is within the schedule in the schedule's time
+// zone.
+func (s *ServiceSchedule) Contains(t time.Time) (ok bool) {
+	t = t.In(s.Location)
+
+	// NOTE: Do not use [time.Truncate] since it requires UTC time zone.
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, s.Location))
+
+	wd := t.Weekday()
+	if s.Start < s.End {
+		return slices.Contains(s.Days, wd) && s.Start <= offset && offset < s.End
+	}
+
+	prev := (wd + 6) % 7
+
+	return (slices.Contains(s.Days, wd) && offset >= s.Start) ||
+		(slices.Contains(s.Days, prev) && offset < s.End)
+}
+
+// validate returns an error if the schedule is invalid.
+func (s *ServiceSchedule) validate() (err error) {
+	switch {
+	case s.Name == "":
+		return errors.Error("empty name")
+	case s.Location == nil:
+		return errors.Error("no time zone")
+	case s.Start < 0 || s.Start >= 24*time.Hour:
+		return fmt.Errorf("start %s is out of range", s.Start)
+	case s.End < 0 || s.End >= 24*time.Hour:
+		return fmt.Errorf("end %s is out of range", s.End)
+	case s.Start == s.End:
+		return fmt.Errorf("start %s is equal to end", s.Start)
+	case len(s.Days) == 0:
+		return errors.Error("no days")
+	default:
+		return nil
+	}
+}
+
+// serviceScheduleConf is the JSON and YAML configuration structure of
+// ServiceSchedule.
+type serviceScheduleConf struct {
+	// Name is the name of the schedule.
+	Name string `json:"name" yaml:"name"`
+
+	// TimeZone is the time zone of the schedule.
+	TimeZone string `json:"time_zone" yaml:"time_zone"`
+
+	// Start is the time of day at which the schedule becomes active, in the
+	// "15:04" layout.
+	Start string `json:"start" yaml:"start"`
+
+	// End is the time of day at which the schedule becomes inactive, in the
+	// "15:04" layout.
+	End string `json:"end" yaml:"end"`
+
+	// Days are the short names of the days of the week, e.g. "mon".
+	Days []string `json:"days" yaml:"days"`
+
+	// BlockedServices are the IDs of the blocked services.
+	BlockedServices []string `json:"blocked_services" yaml:"blocked_services"`
+}
+
+// toConf returns the configuration structure of s.
+func (s *ServiceSchedule) toConf() (conf *serviceScheduleConf) {
+	days := make([]string, 0, len(s.Days))
+	for _, d := range s.Days {
+		days = append(days, weekdayNames[d])
+	}
+
+	return &serviceScheduleConf{
+		Name:            s.Name,
+		TimeZone:        s.Location.String(),
+		Start:           formatDayOffset(s.Start),
+		End:             formatDayOffset(s.End),
+		Days:            days,
+		BlockedServices: slices.Clone(s.BlockedServices),
+	}
+}
+
+// fromConf sets the fields of s from conf and validates them.
+func (s *ServiceSchedule) fromConf(conf *serviceScheduleConf) (err error) {
+	sched := ServiceSchedule{
+		Name:            conf.Name,
+		BlockedServices: conf.BlockedServices,
+	}
+
+	sched.Location, err = time.LoadLocation(conf.TimeZone)
+	if err != nil {
+		return fmt.Errorf("time zone: %w", err)
+	}
+
+	sched.Start, err = parseDayOffset(conf.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+
+	sched.End, err = parseDayOffset(conf.End)
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+
+	for i, name := range conf.Days {
+		wd := slices.Index(weekdayNames[:], name)
+		if wd < 0 {
+			return fmt.Errorf("days: at index %d: bad value %q", i, name)
+		}
+
+		if !slices.Contains(sched.Days, time.Weekday(wd)) {
+			sched.Days = append(sched.Days, time.Weekday(wd))
+		}
+	}
+
+	err = sched.validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	*s = sched
+
+	return nil
+}
+
+// parseDayOffset parses s in the [serviceScheduleTimeLayout] layout and returns
+// the offset from the beginning of the day.
+func parseDayOffset(s string) (offset time.Duration, err error) {
+	t, err := time.Parse(serviceScheduleTimeLayout, s)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// formatDayOffset formats the offset from the beginning of the day in the
+// [serviceScheduleTimeLayout] layout.
+func formatDayOffset(offset time.Duration) (s string) {
+	return time.Time{}.Add(offset).Format(serviceScheduleTimeLayout)
+}
+
+// type check
+var _ json.Marshaler = (*ServiceSchedule)(nil)
+
+// MarshalJSON implements the [json.Marshaler] interface for *ServiceSchedule.
+func (s *ServiceSchedule) MarshalJSON() (data []byte, err error) {
+	return json.Marshal(s.toConf())
+}
+
+// type check
+var _ json.Unmarshaler = (*ServiceSchedule)(nil)
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface for
+// *ServiceSchedule.
+func (s *ServiceSchedule) UnmarshalJSON(data []byte) (err error) {
+	conf := &serviceScheduleConf{}
+	err = json.Unmarshal(data, conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return s.fromConf(conf)
+}
+
+// type check
+var _ yaml.Marshaler = (*ServiceSchedule)(nil)
+
+// MarshalYAML implements the [yaml.Marshaler] interface for *ServiceSchedule.
+func (s *ServiceSchedule) MarshalYAML() (v any, err error) {
+	return s.toConf(), nil
+}
+
+// type check
+var _ yaml.Unmarshaler = (*ServiceSchedule)(nil)
+
+// UnmarshalYAML implements the [yaml.Unmarshaler] interface for
+// *ServiceSchedule.
+func (s *ServiceSchedule) UnmarshalYAML(value *yaml.Node) (err error) {
+	conf := &serviceScheduleConf{}
+	err = value.Decode(conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return s.fromConf(conf)
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestServiceSchedule_Contains(t *testing.T) {
+	// bedtime is active from Friday 22:00 until Saturday 07:00 and from
+	// Saturday 22:00 until Sunday 07:00.
+	bedtime := &ServiceSchedule{
+		Location: time.UTC,
+		Name:     "bedtime",
+		Days:     []time.Weekday{time.Friday, time.Saturday},
+		Start:    22 * time.Hour,
+		End:      7 * time.Hour,
+	}
+
+	daytime := &ServiceSchedule{
+		Location: time.UTC,
+		Name:     "daytime",
+		Days:     []time.Weekday{time.Monday},
+		Start:    9 * time.Hour,
+		End:      17 * time.Hour,
+	}
+
+	// fri returns the time on Friday, 2 January 2026, shifted by d.
+	fri := func(d time.Duration) (t time.Time) {
+		return time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC).Add(d)
+	}
+
+	testCases := []struct {
+		sched *ServiceSchedule
+		t     time.Time
+		want  assert.BoolAssertionFunc
+		name  string
+	}{{
+		sched: bedtime,
+		t:     fri(22 * time.Hour),
+		want:  assert.True,
+		name:  "overnight_start",
+	}, {
+		sched: bedtime,
+		t:     fri(21*time.Hour + 59*time.Minute),
+		want:  assert.False,
+		name:  "overnight_before",
+	}, {
+		sched: bedtime,
+		t:     fri(30 * time.Hour),
+		want:  assert.True,
+		name:  "overnight_next_day",
+	}, {
+		sched: bedtime,
+		t:     fri(31 * time.Hour),
+		want:  assert.False,
+		name:  "overnight_end",
+	}, {
+		sched: bedtime,
+		t:     fri(-time.Hour),
+		want:  assert.False,
+		name:  "overnight_other_day",
+	}, {
+		sched: bedtime,
+		t:     fri(54 * time.Hour),
+		want:  assert.True,
+		name:  "overnight_sunday",
+	}, {
+		sched: daytime,
+		t:     fri(3*24*time.Hour + 9*time.Hour),
+		want:  assert.True,
+		name:  "daytime_start",
+	}, {
+		sched: daytime,
+		t:     fri(3*24*time.Hour + 17*time.Hour),
+		want:  assert.False,
+		name:  "daytime_end",
+	}, {
+		sched: daytime,
+		t:     fri(12 * time.Hour),
+		want:  assert.False,
+		name:  "daytime_other_day",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, tc.sched.Contains(tc.t))
+		})
+	}
+}
+
+func TestServiceSchedule_encoding(t *testing.T) {
+	const data = `{"name":"bedtime","time_zone":"UTC","start":"22:00","end":"07:30",` +
+		`"days":["fri","sat"],"blocked_services":["tiktok"]}`
+
+	want := &ServiceSchedule{
+		Location:        time.UTC,
+		Name:            "bedtime",
+		BlockedServices: []string{"tiktok"},
+		Days:            []time.Weekday{time.Friday, time.Saturday},
+		Start:           22 * time.Hour,
+		End:             7*time.Hour + 30*time.Minute,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		s := &ServiceSchedule{}
+		err := json.Unmarshal([]byte(data), s)
+		require.NoError(t, err)
+
+		assert.Equal(t, want, s)
+
+		b, err := json.Marshal(s)
+		require.NoError(t, err)
+
+		assert.JSONEq(t, data, string(b))
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		b, err := yaml.Marshal(want)
+		require.NoError(t, err)
+
+		s := &ServiceSchedule{}
+		err = yaml.Unmarshal(b, s)
+		require.NoError(t, err)
+
+		assert.Equal(t, want, s)
+	})
+}
+
+func TestServiceSchedule_UnmarshalJSON_errors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		wantErrMsg string
+	}{{
+		name:       "bad_day",
+		data:       `{"name":"a","start":"22:00","end":"07:00","days":["monday"]}`,
+		wantErrMsg: `days: at index 0: bad value "monday"`,
+	}, {
+		name:       "bad_start",
+		data:       `{"name":"a","start":"25:00","end":"07:00","days":["mon"]}`,
+		wantErrMsg: `start: parsing time "25:00": hour out of range`,
+	}, {
+		name:       "equal",
+		data:       `{"name":"a","start":"07:00","end":"07:00","days":["mon"]}`,
+		wantErrMsg: "start 7h0m0s is equal to end",
+	}, {
+		name:       "no_days",
+		data:       `{"name":"a","start":"22:00","end":"07:00","days":[]}`,
+		wantErrMsg: "no days",
+	}, {
+		name:       "no_name",
+		data:       `{"start":"22:00","end":"07:00","days":["mon"]}`,
+		wantErrMsg: "empty name",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := json.Unmarshal([]byte(tc.data), &ServiceSchedule{})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestPersistent_ActiveServiceSchedule(t *testing.T) {
+	newSched := func(name string, start, end time.Duration) (s *ServiceSchedule) {
+		return &ServiceSchedule{
+			Location: time.UTC,
+			Name:     name,
+			Days:     []time.Weekday{time.Friday},
+			Start:    start,
+			End:      end,
+		}
+	}
+
+	c := &Persistent{
+		ServiceSchedules: []*ServiceSchedule{
+			newSched("evening", 18*time.Hour, 23*time.Hour),
+			newSched("night", 20*time.Hour, 6*time.Hour),
+		},
+	}
+
+	fri := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, c.ActiveServiceSchedule(fri.Add(12*time.Hour)))
+	assert.Equal(t, "evening", c.ActiveServiceSchedule(fri.Add(21*time.Hour)).Name)
+	assert.Equal(t, "night", c.ActiveServiceSchedule(fri.Add(23*time.Hour)).Name)
+
+	err := validateServiceSchedules(append(c.ServiceSchedules, newSched("night", 0, time.Hour)))
+	testutil.AssertErrorMsg(t, `service schedules: at index 2: duplicate name "night"`, err)
+}
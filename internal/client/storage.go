@@ -19,7 +19,7 @@ import (
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 )
 
-// allowedTags is the list of available client tags.
+// allowedTags is the list of built-in client tags.
 var allowedTags = []string{
 	"device_audio",
 	"device_camera",
@@ -103,6 +103,14 @@ type StorageConfig struct {
 	// configuration file.  Each client must not be nil.
 	InitialClients []*Persistent
 
+	// CustomTags are the client tags added by the user in addition to the
+	// built-in ones.
+	CustomTags []string
+
+	// TagRules are the rules tagging the clients automatically.  Their tags
+	// must be either the built-in tags or CustomTags.
+	TagRules []*TagRuleConfig
+
 	// ARPClientsUpdatePeriod defines how often [SourceARP] runtime client
 	// information is updated.
 	ARPClientsUpdatePeriod time.Duration
@@ -139,11 +147,19 @@ type Storage struct {
 	// done is the shutdown signaling channel.
 	done chan struct{}
 
-	// allowedTags is a sorted list of all allowed tags.  It must not be
+	// builtinTags is a sorted list of the built-in tags.  It must not be
 	// modified after initialization.
 	//
 	// TODO(s.chzhen):  Use custom type.
-	allowedTags []string
+	builtinTags []string
+
+	// customTags is a sorted list of the tags added by the user.  It's
+	// protected by mu.
+	customTags []string
+
+	// tagRules are the rules tagging the clients automatically.  It's
+	// protected by mu.
+	tagRules []*tagRule
 
 	// arpClientsUpdatePeriod defines how often [SourceARP] runtime client
 	// information is updated.  It must be greater than zero.
@@ -168,11 +184,24 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 		etcHosts:               conf.EtcHosts,
 		arpDB:                  conf.ARPDB,
 		done:                   make(chan struct{}),
-		allowedTags:            tags,
+		builtinTags:            tags,
 		arpClientsUpdatePeriod: conf.ARPClientsUpdatePeriod,
 		runtimeSourceDHCP:      conf.RuntimeSourceDHCP,
 	}
 
+	for i, t := range conf.CustomTags {
+		err = s.addTagLocked(t)
+		if err != nil {
+			return nil, fmt.Errorf("custom tag at index %d: %w", i, err)
+		}
+	}
+
+	s.tagRules, err = newTagRules(conf.TagRules, s.allowedTagsLocked())
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
 	for i, p := range conf.InitialClients {
 		err = s.Add(ctx, p)
 		if err != nil {
@@ -395,7 +424,7 @@ func (s *Storage) setWHOISInfo(ctx context.Context, ip netip.Addr, wi *whois.Inf
 func (s *Storage) Add(ctx context.Context, p *Persistent) (err error) {
 	defer func() { err = errors.Annotate(err, "adding client: %w") }()
 
-	err = p.validate(ctx, s.logger, s.allowedTags)
+	err = p.validate(ctx, s.logger, s.AllowedTags())
 	if err != nil {
 		// Don't wrap the error since there is already an annotation deferred.
 		return err
@@ -524,12 +553,69 @@ func (s *Storage) RemoveByName(name string) (ok bool) {
 	return true
 }
 
+// PersistentSet is a validated set of persistent clients to replace the stored
+// ones with, see [Storage.NewPersistentSet].
+type PersistentSet struct {
+	// index contains the persistent clients of the set.
+	index *index
+}
+
+// NewPersistentSet validates persistent and returns the set of them to replace
+// the stored persistent clients with, see [Storage.ReplacePersistent].  The
+// stored clients aren't changed.  persistent must not contain nil items.
+func (s *Storage) NewPersistentSet(
+	ctx context.Context,
+	persistent []*Persistent,
+) (set *PersistentSet, err error) {
+	tags := s.AllowedTags()
+	ci := newIndex()
+	for _, p := range persistent {
+		err = p.validate(ctx, s.logger, tags)
+		if err != nil {
+			return nil, fmt.Errorf("client %q: %w", p.Name, err)
+		}
+
+		err = ci.clashesUID(p)
+		if err == nil {
+			err = ci.clashes(p)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("client %q: %w", p.Name, err)
+		}
+
+		ci.add(p)
+	}
+
+	return &PersistentSet{
+		index: ci,
+	}, nil
+}
+
+// ReplacePersistent replaces all stored persistent clients with the ones from
+// set and closes the upstream configurations of the replaced ones.  set must
+// not be nil and must not be used afterwards.
+func (s *Storage) ReplacePersistent(ctx context.Context, set *PersistentSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.index
+	s.index = set.index
+
+	err := prev.closeUpstreams()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "closing upstreams of replaced clients", slogutil.KeyError, err)
+	}
+
+	s.logger.DebugContext(ctx, "clients replaced", "clients_count", s.index.size())
+}
+
 // Update finds the stored persistent client by its name and updates its
 // information from p.
 func (s *Storage) Update(ctx context.Context, name string, p *Persistent) (err error) {
 	defer func() { err = errors.Annotate(err, "updating client: %w") }()
 
-	err = p.validate(ctx, s.logger, s.allowedTags)
+	err = p.validate(ctx, s.logger, s.AllowedTags())
 	if err != nil {
 		// Don't wrap the error since there is already an annotation deferred.
 		return err
@@ -618,8 +704,11 @@ func (s *Storage) RangeRuntime(f func(rc *Runtime) (cont bool)) {
 	s.runtimeIndex.rangeClients(f)
 }
 
-// AllowedTags returns the list of available client tags.  tags must not be
-// modified.
+// AllowedTags returns the sorted list of available client tags, both built-in
+// and custom ones.
 func (s *Storage) AllowedTags() (tags []string) {
-	return s.allowedTags
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.allowedTagsLocked()
 }
@@ -670,6 +670,39 @@ func TestStorage_Add(t *testing.T) {
 			UID:  client.MustNewUID(),
 		},
 		wantErrMsg: "",
+	}, {
+		name: "bad_pause_allowlist",
+		cli: &client.Persistent{
+			Name:           "bad_pause_allowlist",
+			IPs:            []netip.Addr{netip.MustParseAddr("5.5.5.6")},
+			UID:            client.MustNewUID(),
+			PauseAllowlist: []string{"example.org", "bad domain"},
+		},
+		wantErrMsg: `adding client: pause allowlist: at index 1: ` +
+			`bad domain name "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
+	}, {
+		name: "bad_dns64_prefix",
+		cli: &client.Persistent{
+			Name:        "bad_dns64_prefix",
+			IPs:         []netip.Addr{netip.MustParseAddr("5.5.5.7")},
+			UID:         client.MustNewUID(),
+			DNS64Prefix: netip.MustParsePrefix("2001:db8::/120"),
+		},
+		wantErrMsg: `adding client: dns64 prefix: 2001:db8::/120 is longer than 96 bits`,
+	}, {
+		name: "bad_dns64_exclusions",
+		cli: &client.Persistent{
+			Name:            "bad_dns64_exclusions",
+			IPs:             []netip.Addr{netip.MustParseAddr("5.5.5.8")},
+			UID:             client.MustNewUID(),
+			DNS64Exclusions: []string{"bad domain"},
+		},
+		wantErrMsg: `adding client: dns64 exclusions: at index 0: ` +
+			`bad domain name "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
 	}, {
 		name: "",
 		cli: &client.Persistent{
@@ -749,6 +782,51 @@ func TestStorage_RemoveByName(t *testing.T) {
 	})
 }
 
+func TestStorage_ReplacePersistent(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s := newTestStorage(t)
+
+	err := s.Add(ctx, &client.Persistent{
+		Name: "old",
+		IPs:  []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		UID:  client.MustNewUID(),
+	})
+	require.NoError(t, err)
+
+	_, err = s.NewPersistentSet(ctx, []*client.Persistent{{
+		Name:      "first",
+		ClientIDs: []string{"dup"},
+		UID:       client.MustNewUID(),
+	}, {
+		Name:      "second",
+		ClientIDs: []string{"dup"},
+		UID:       client.MustNewUID(),
+	}})
+	testutil.AssertErrorMsg(t, `client "second": another client "first" uses the same ClientID "dup"`, err)
+
+	set, err := s.NewPersistentSet(ctx, []*client.Persistent{{
+		Name: "new",
+		IPs:  []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		UID:  client.MustNewUID(),
+	}})
+	require.NoError(t, err)
+
+	// The stored clients must only be replaced when the set is applied.
+	_, ok := s.FindByName("old")
+	require.True(t, ok)
+
+	s.ReplacePersistent(ctx, set)
+
+	_, ok = s.FindByName("old")
+	assert.False(t, ok)
+
+	p, ok := s.Find("1.2.3.4")
+	require.True(t, ok)
+
+	assert.Equal(t, "new", p.Name)
+	assert.Equal(t, 1, s.Size())
+}
+
 func TestStorage_Find(t *testing.T) {
 	const (
 		cliIPNone = "1.2.3.4"
@@ -1171,3 +1249,123 @@ func TestStorage_RangeByName(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_Tags(t *testing.T) {
+	const (
+		tag      = "user_guest"
+		otherTag = "user_visitor"
+		cliName  = "client"
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger:     slogutil.NewDiscardLogger(),
+		DHCP:       client.EmptyDHCP{},
+		CustomTags: []string{tag},
+		TagRules: []*client.TagRuleConfig{{
+			Tag:     tag,
+			Subnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{tag}, s.CustomTags())
+	assert.Contains(t, s.AllowedTags(), tag)
+
+	err = s.Add(ctx, &client.Persistent{
+		Name: cliName,
+		UID:  client.MustNewUID(),
+		IPs:  []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		Tags: []string{"device_pc", tag},
+	})
+	require.NoError(t, err)
+
+	testutil.AssertErrorMsg(t, `tag "device_pc" is built-in`, s.AddTag("device_pc"))
+	testutil.AssertErrorMsg(t, `tag "user_guest" already exists`, s.AddTag(tag))
+	testutil.AssertErrorMsg(t, `tag "user_guest" is used by client "client"`, s.RemoveTag(tag))
+
+	require.NoError(t, s.RenameTag(tag, otherTag))
+
+	assert.Equal(t, []string{otherTag}, s.CustomTags())
+
+	c, ok := s.FindByName(cliName)
+	require.True(t, ok)
+
+	assert.Equal(t, []string{"device_pc", otherTag}, c.Tags)
+
+	rules := s.TagRules()
+	require.Len(t, rules, 1)
+
+	assert.Equal(t, otherTag, rules[0].Tag)
+
+	require.True(t, s.RemoveByName(cliName))
+
+	testutil.AssertErrorMsg(
+		t,
+		`tag "user_visitor" is used by tag rule at index 0`,
+		s.RemoveTag(otherTag),
+	)
+
+	require.NoError(t, s.SetTagRules(nil))
+	require.NoError(t, s.RemoveTag(otherTag))
+
+	assert.Empty(t, s.CustomTags())
+}
+
+func TestStorage_AutoTags(t *testing.T) {
+	var (
+		cliIP    = netip.MustParseAddr("192.168.1.2")
+		otherIP  = netip.MustParseAddr("192.168.2.2")
+		dhcpMAC  = mustParseMAC("aa:bb:cc:01:02:03")
+		cliMAC   = mustParseMAC("dd:ee:ff:01:02:03")
+		hostname = "tv-kitchen"
+	)
+
+	d := &testDHCP{
+		OnLeases: func() (ls []*dhcpsvc.Lease) { return nil },
+		OnHostBy: func(ip netip.Addr) (host string) {
+			if ip == cliIP {
+				return hostname
+			}
+
+			return ""
+		},
+		OnMACBy: func(ip netip.Addr) (mac net.HardwareAddr) {
+			if ip == cliIP {
+				return dhcpMAC
+			}
+
+			return nil
+		},
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		DHCP:   d,
+		TagRules: []*client.TagRuleConfig{{
+			Tag:      "device_tv",
+			Hostname: "^tv-",
+		}, {
+			Tag:  "device_tv",
+			OUIs: []string{"aa:bb:cc"},
+		}, {
+			Tag:  "user_child",
+			OUIs: []string{"dd:ee:ff"},
+		}, {
+			Tag:     "device_other",
+			Subnets: []netip.Prefix{netip.MustParsePrefix("192.168.2.0/24")},
+		}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"device_tv"}, s.AutoTags(cliIP, nil))
+	assert.Equal(t, []string{"device_other"}, s.AutoTags(otherIP, nil))
+
+	p := &client.Persistent{
+		MACs: []net.HardwareAddr{cliMAC},
+	}
+
+	assert.Equal(t, []string{"device_tv", "user_child"}, s.AutoTags(cliIP, p))
+	assert.Empty(t, s.AutoTags(netip.MustParseAddr("10.0.0.1"), nil))
+}
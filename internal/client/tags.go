@@ -0,0 +1,386 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ouiLen is the length of an organizationally unique identifier in bytes.
+const ouiLen = 3
+
+// validateTag returns an error if tag can't be used in the $ctag modifier of
+// the filtering rules.
+func validateTag(tag string) (err error) {
+	if tag == "" {
+		return errors.ErrEmptyValue
+	}
+
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return fmt.Errorf(
+				"bad tag %q: only lowercase latin letters, digits, and underscores are allowed",
+				tag,
+			)
+		}
+	}
+
+	return nil
+}
+
+// TagRuleConfig is the configuration of a rule tagging the clients
+// automatically.  A client matches the rule if it matches all of its
+// non-empty criteria.
+type TagRuleConfig struct {
+	// Tag is the tag of the matching clients.  It must be one of the allowed
+	// tags.
+	Tag string
+
+	// Hostname is the regular expression matching the hostname of the client,
+	// if any.
+	Hostname string
+
+	// OUIs are the organizationally unique identifiers of the manufacturers of
+	// the network adapters, which are the first three bytes of the MAC
+	// addresses, for example "aa:bb:cc".  The client matches if any of its MAC
+	// addresses matches any of them.
+	OUIs []string
+
+	// Subnets are the networks the client may belong to.
+	Subnets []netip.Prefix
+}
+
+// clone returns a deep copy of c.
+func (c *TagRuleConfig) clone() (cloned *TagRuleConfig) {
+	return &TagRuleConfig{
+		Tag:      c.Tag,
+		Hostname: c.Hostname,
+		OUIs:     slices.Clone(c.OUIs),
+		Subnets:  slices.Clone(c.Subnets),
+	}
+}
+
+// tagRule is a validated [TagRuleConfig].
+type tagRule struct {
+	// conf is the configuration of the rule.  It must not be nil.
+	conf *TagRuleConfig
+
+	// hostname is the compiled [TagRuleConfig.Hostname], if any.
+	hostname *regexp.Regexp
+
+	// ouis are the parsed [TagRuleConfig.OUIs].
+	ouis [][ouiLen]byte
+}
+
+// newTagRules returns the validated rules from confs.  tags are the sorted
+// allowed tags.
+func newTagRules(confs []*TagRuleConfig, tags []string) (rules []*tagRule, err error) {
+	for i, c := range confs {
+		var r *tagRule
+		r, err = newTagRule(c, tags)
+		if err != nil {
+			return nil, fmt.Errorf("tag rule at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newTagRule validates c and returns the rule prepared from it.  tags are the
+// sorted allowed tags.
+func newTagRule(c *TagRuleConfig, tags []string) (r *tagRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	if _, ok := slices.BinarySearch(tags, c.Tag); !ok {
+		return nil, fmt.Errorf("tag: invalid tag: %q", c.Tag)
+	}
+
+	if c.Hostname == "" && len(c.OUIs) == 0 && len(c.Subnets) == 0 {
+		return nil, errors.Error("no criteria")
+	}
+
+	r = &tagRule{
+		conf: c.clone(),
+	}
+
+	if c.Hostname != "" {
+		r.hostname, err = regexp.Compile(c.Hostname)
+		if err != nil {
+			return nil, fmt.Errorf("hostname: %w", err)
+		}
+	}
+
+	for i, s := range c.OUIs {
+		var oui [ouiLen]byte
+		oui, err = parseOUI(s)
+		if err != nil {
+			return nil, fmt.Errorf("ouis: at index %d: %w", i, err)
+		}
+
+		r.ouis = append(r.ouis, oui)
+	}
+
+	for i, subnet := range c.Subnets {
+		if !subnet.IsValid() {
+			return nil, fmt.Errorf("subnets: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+
+		r.conf.Subnets[i] = subnet.Masked()
+	}
+
+	return r, nil
+}
+
+// parseOUI parses an organizationally unique identifier with the bytes
+// separated by colons or hyphens.
+func parseOUI(s string) (oui [ouiLen]byte, err error) {
+	b, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(s))
+	if err != nil {
+		return oui, fmt.Errorf("bad oui %q: %w", s, err)
+	} else if len(b) != ouiLen {
+		return oui, fmt.Errorf("bad oui %q: want %d bytes, got %d", s, ouiLen, len(b))
+	}
+
+	return [ouiLen]byte(b), nil
+}
+
+// matches returns true if the client with ip, host, and macs matches r.
+func (r *tagRule) matches(ip netip.Addr, host string, macs []net.HardwareAddr) (ok bool) {
+	if r.hostname != nil && (host == "" || !r.hostname.MatchString(host)) {
+		return false
+	}
+
+	if len(r.ouis) > 0 && !slices.ContainsFunc(macs, r.matchesMAC) {
+		return false
+	}
+
+	return len(r.conf.Subnets) == 0 || slices.ContainsFunc(r.conf.Subnets, func(p netip.Prefix) (c bool) {
+		return p.Contains(ip)
+	})
+}
+
+// matchesMAC returns true if mac starts with one of the OUIs of r.
+func (r *tagRule) matchesMAC(mac net.HardwareAddr) (ok bool) {
+	return len(mac) >= ouiLen && slices.Contains(r.ouis, [ouiLen]byte(mac[:ouiLen]))
+}
+
+// allowedTagsLocked returns the sorted list of both built-in and custom tags.
+// s.mu is expected to be locked.
+func (s *Storage) allowedTagsLocked() (tags []string) {
+	tags = slices.Concat(s.builtinTags, s.customTags)
+	slices.Sort(tags)
+
+	return tags
+}
+
+// addTagLocked validates and adds the custom tag.  s.mu is expected to be
+// locked.
+func (s *Storage) addTagLocked(tag string) (err error) {
+	err = validateTag(tag)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if _, ok := slices.BinarySearch(s.builtinTags, tag); ok {
+		return fmt.Errorf("tag %q is built-in", tag)
+	}
+
+	i, ok := slices.BinarySearch(s.customTags, tag)
+	if ok {
+		return fmt.Errorf("tag %q already exists", tag)
+	}
+
+	s.customTags = slices.Insert(s.customTags, i, tag)
+
+	return nil
+}
+
+// CustomTags returns the sorted list of the tags added by the user.
+func (s *Storage) CustomTags() (tags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.customTags)
+}
+
+// AddTag adds a new custom tag.
+func (s *Storage) AddTag(tag string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Don't wrap the error since it's informative enough as is.
+	return s.addTagLocked(tag)
+}
+
+// RemoveTag removes the custom tag.  The tag must not be used by any
+// persistent client or tagging rule.
+func (s *Storage) RemoveTag(tag string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := slices.BinarySearch(s.customTags, tag)
+	if !ok {
+		return fmt.Errorf("custom tag %q is not found", tag)
+	}
+
+	var user string
+	s.index.rangeByName(func(p *Persistent) (cont bool) {
+		if slices.Contains(p.Tags, tag) {
+			user = p.Name
+		}
+
+		return user == ""
+	})
+	if user != "" {
+		return fmt.Errorf("tag %q is used by client %q", tag, user)
+	}
+
+	for j, r := range s.tagRules {
+		if r.conf.Tag == tag {
+			return fmt.Errorf("tag %q is used by tag rule at index %d", tag, j)
+		}
+	}
+
+	s.customTags = slices.Delete(s.customTags, i, i+1)
+
+	return nil
+}
+
+// RenameTag renames the custom tag in the list of tags, the persistent
+// clients, and the tagging rules.
+func (s *Storage) RenameTag(oldTag, newTag string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := slices.BinarySearch(s.customTags, oldTag)
+	if !ok {
+		return fmt.Errorf("custom tag %q is not found", oldTag)
+	}
+
+	s.customTags = slices.Delete(s.customTags, i, i+1)
+	err = s.addTagLocked(newTag)
+	if err != nil {
+		s.customTags = slices.Insert(s.customTags, i, oldTag)
+
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	var tagged []*Persistent
+	s.index.rangeByName(func(p *Persistent) (cont bool) {
+		if slices.Contains(p.Tags, oldTag) {
+			tagged = append(tagged, p)
+		}
+
+		return true
+	})
+
+	// Replace the clients instead of modifying them, since they may be used
+	// concurrently.
+	for _, p := range tagged {
+		renamed := p.ShallowClone()
+		renamed.Tags = slices.DeleteFunc(renamed.Tags, func(t string) (ok bool) { return t == oldTag })
+		renamed.Tags = append(renamed.Tags, newTag)
+		slices.Sort(renamed.Tags)
+
+		s.index.remove(p)
+		s.index.add(renamed)
+	}
+
+	rules := make([]*tagRule, 0, len(s.tagRules))
+	for _, r := range s.tagRules {
+		if r.conf.Tag == oldTag {
+			renamed := *r
+			renamed.conf = r.conf.clone()
+			renamed.conf.Tag = newTag
+			r = &renamed
+		}
+
+		rules = append(rules, r)
+	}
+
+	s.tagRules = rules
+
+	return nil
+}
+
+// TagRules returns the configurations of the rules tagging the clients
+// automatically.
+func (s *Storage) TagRules() (confs []*TagRuleConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	confs = make([]*TagRuleConfig, 0, len(s.tagRules))
+	for _, r := range s.tagRules {
+		confs = append(confs, r.conf.clone())
+	}
+
+	return confs
+}
+
+// SetTagRules validates and replaces the rules tagging the clients
+// automatically.
+func (s *Storage) SetTagRules(confs []*TagRuleConfig) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := newTagRules(confs, s.allowedTagsLocked())
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	s.tagRules = rules
+
+	return nil
+}
+
+// AutoTags returns the sorted tags of the rules matching the client with ip.
+// p is the persistent client with ip, if any.  The hostname and the MAC
+// addresses of the client are taken from the runtime client information, the
+// DHCP leases, and p.
+func (s *Storage) AutoTags(ip netip.Addr, p *Persistent) (tags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.tagRules) == 0 {
+		return nil
+	}
+
+	var host string
+	if rc := s.runtimeIndex.client(ip); rc != nil {
+		_, host = rc.Info()
+	} else {
+		host = s.dhcp.HostByIP(ip)
+	}
+
+	var macs []net.HardwareAddr
+	if mac := s.dhcp.MACByIP(ip); mac != nil {
+		macs = append(macs, mac)
+	}
+
+	if p != nil {
+		macs = append(macs, p.MACs...)
+	}
+
+	for _, r := range s.tagRules {
+		if r.matches(ip, host, macs) {
+			tags = append(tags, r.conf.Tag)
+		}
+	}
+
+	slices.Sort(tags)
+
+	return slices.Compact(tags)
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTag(t *testing.T) {
+	testCases := []struct {
+		name       string
+		tag        string
+		wantErrMsg string
+	}{{
+		name:       "success",
+		tag:        "user_guest_2",
+		wantErrMsg: "",
+	}, {
+		name:       "empty",
+		tag:        "",
+		wantErrMsg: "empty value",
+	}, {
+		name: "uppercase",
+		tag:  "User",
+		wantErrMsg: `bad tag "User": only lowercase latin letters, digits, ` +
+			`and underscores are allowed`,
+	}, {
+		name: "hyphen",
+		tag:  "user-guest",
+		wantErrMsg: `bad tag "user-guest": only lowercase latin letters, ` +
+			`digits, and underscores are allowed`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateTag(tc.tag))
+		})
+	}
+}
+
+func TestNewTagRule(t *testing.T) {
+	tags := []string{"device_tv", "user_guest"}
+
+	testCases := []struct {
+		conf       *TagRuleConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &TagRuleConfig{
+			Tag:      "device_tv",
+			Hostname: "^tv-",
+			OUIs:     []string{"aa:bb:cc", "dd-ee-ff"},
+			Subnets:  []netip.Prefix{netip.MustParsePrefix("192.168.1.1/24")},
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "no value",
+	}, {
+		conf: &TagRuleConfig{
+			Tag:      "device_pc",
+			Hostname: "^pc-",
+		},
+		name:       "unknown_tag",
+		wantErrMsg: `tag: invalid tag: "device_pc"`,
+	}, {
+		conf: &TagRuleConfig{
+			Tag: "device_tv",
+		},
+		name:       "no_criteria",
+		wantErrMsg: "no criteria",
+	}, {
+		conf: &TagRuleConfig{
+			Tag:      "device_tv",
+			Hostname: "(",
+		},
+		name:       "bad_hostname",
+		wantErrMsg: "hostname: error parsing regexp: missing closing ): `(`",
+	}, {
+		conf: &TagRuleConfig{
+			Tag:  "device_tv",
+			OUIs: []string{"aa:bb"},
+		},
+		name:       "short_oui",
+		wantErrMsg: `ouis: at index 0: bad oui "aa:bb": want 3 bytes, got 2`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newTagRule(tc.conf, tags)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestTagRule_matches(t *testing.T) {
+	r, err := newTagRule(&TagRuleConfig{
+		Tag:      "device_tv",
+		Hostname: "^tv-",
+		OUIs:     []string{"aa:bb:cc"},
+		Subnets:  []netip.Prefix{netip.MustParsePrefix("192.168.1.1/24")},
+	}, []string{"device_tv"})
+	require.NoError(t, err)
+
+	var (
+		ip       = netip.MustParseAddr("192.168.1.2")
+		otherIP  = netip.MustParseAddr("192.168.2.2")
+		mac      = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0x01, 0x02, 0x03}
+		otherMAC = net.HardwareAddr{0xaa, 0xbb, 0xcd, 0x01, 0x02, 0x03}
+	)
+
+	testCases := []struct {
+		ip   netip.Addr
+		name string
+		host string
+		macs []net.HardwareAddr
+		want assert.BoolAssertionFunc
+	}{{
+		ip:   ip,
+		name: "all",
+		host: "tv-kitchen",
+		macs: []net.HardwareAddr{otherMAC, mac},
+		want: assert.True,
+	}, {
+		ip:   ip,
+		name: "no_host",
+		host: "",
+		macs: []net.HardwareAddr{mac},
+		want: assert.False,
+	}, {
+		ip:   ip,
+		name: "other_host",
+		host: "pc-kitchen",
+		macs: []net.HardwareAddr{mac},
+		want: assert.False,
+	}, {
+		ip:   ip,
+		name: "other_mac",
+		host: "tv-kitchen",
+		macs: []net.HardwareAddr{otherMAC},
+		want: assert.False,
+	}, {
+		ip:   otherIP,
+		name: "other_subnet",
+		host: "tv-kitchen",
+		macs: []net.HardwareAddr{mac},
+		want: assert.False,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, r.matches(tc.ip, tc.host, tc.macs))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// UpstreamMode defines the way the requests of a persistent client are
+// distributed among its custom upstreams.  The values are the same as the ones
+// of the upstream mode of the DNS server.
+type UpstreamMode string
+
+// UpstreamMode values.
+const (
+	// UpstreamModeDefault means that the upstream mode of the DNS server is
+	// used.
+	UpstreamModeDefault UpstreamMode = ""
+
+	// UpstreamModeLoadBalance distributes the requests among the upstreams
+	// according to their latencies.
+	UpstreamModeLoadBalance UpstreamMode = "load_balance"
+
+	// UpstreamModeParallel sends each request to all the upstreams at once and
+	// uses the first response.
+	UpstreamModeParallel UpstreamMode = "parallel"
+
+	// UpstreamModeFastestAddr sends each request to all the upstreams and
+	// responds with the fastest of the resolved IP addresses.
+	UpstreamModeFastestAddr UpstreamMode = "fastest_addr"
+
+	// UpstreamModeFailOver sends the requests to the first upstream and tries
+	// the next ones in order only if it fails.
+	UpstreamModeFailOver UpstreamMode = "fail_over"
+)
+
+// validate returns an error if m isn't a valid UpstreamMode.
+func (m UpstreamMode) validate() (err error) {
+	switch m {
+	case
+		UpstreamModeDefault,
+		UpstreamModeLoadBalance,
+		UpstreamModeParallel,
+		UpstreamModeFastestAddr,
+		UpstreamModeFailOver:
+		return nil
+	default:
+		return fmt.Errorf("upstream_mode: %w: %q", errors.ErrBadEnumValue, m)
+	}
+}
@@ -1729,3 +1729,70 @@ func TestUpgradeSchema27to28(t *testing.T) {
 		})
 	}
 }
+
+func TestUpgradeSchema29to30(t *testing.T) {
+	const newSchemaVer = 30
+
+	testCases := []struct {
+		in   yobj
+		want yobj
+		name string
+	}{{
+		name: "empty",
+		in:   yobj{},
+		want: yobj{
+			"schema_version": newSchemaVer,
+		},
+	}, {
+		name: "no_timeout",
+		in: yobj{
+			"dns": yobj{},
+		},
+		want: yobj{
+			"dns":            yobj{},
+			"schema_version": newSchemaVer,
+		},
+	}, {
+		name: "timeout",
+		in: yobj{
+			"dns": yobj{
+				"upstream_timeout": "5s",
+			},
+		},
+		want: yobj{
+			"dns": yobj{},
+			"timeouts": yobj{
+				"upstream": "5s",
+			},
+			"schema_version": newSchemaVer,
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := migrateTo30(tc.in)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, tc.in)
+		})
+	}
+}
+
+func TestArgon2idUsers(t *testing.T) {
+	diskConf := yobj{
+		"users": yarr{
+			yobj{
+				"name":     "bcrypt",
+				"password": "$2y$10$p3Kb9Ew4SwdfjLlsj1zEUuASw9WbXcQI2WhEpqT0Kkvo3eAsz6Hcy",
+			},
+			yobj{
+				"name":     "argon2id",
+				"password": "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA",
+			},
+			"bad",
+		},
+	}
+
+	assert.Equal(t, []string{"argon2id"}, argon2idUsers(diskConf))
+	assert.Empty(t, argon2idUsers(yobj{}))
+}
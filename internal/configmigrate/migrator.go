@@ -3,6 +3,7 @@ package configmigrate
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/AdguardTeam/golibs/log"
 	yaml "gopkg.in/yaml.v3"
@@ -35,22 +36,16 @@ func New(c *Config) (m *Migrator) {
 // schema version, if needed.  It returns the body of the upgraded config file,
 // whether the file was upgraded, and an error, if any.  If upgraded is false,
 // the body is the same as the input.
+//
+// target may also be one version lower than the current one, if the current
+// version supports downgrading, see [Migrator.Downgrade].
 func (m *Migrator) Migrate(body []byte, target uint) (newBody []byte, upgraded bool, err error) {
-	diskConf := yobj{}
-	err = yaml.Unmarshal(body, &diskConf)
-	if err != nil {
-		return body, false, fmt.Errorf("parsing config file for upgrade: %w", err)
-	}
-
-	currentInt, _, err := fieldVal[int](diskConf, "schema_version")
+	diskConf, current, err := parseDiskConf(body)
 	if err != nil {
 		// Don't wrap the error, since it's informative enough as is.
 		return body, false, err
 	}
 
-	current := uint(currentInt)
-	log.Debug("got schema version %v", current)
-
 	if err = validateVersion(current, target); err != nil {
 		// Don't wrap the error, since it's informative enough as is.
 		return body, false, err
@@ -58,29 +53,102 @@ func (m *Migrator) Migrate(body []byte, target uint) (newBody []byte, upgraded b
 		return body, false, nil
 	}
 
-	if err = m.upgradeConfigSchema(current, target, diskConf); err != nil {
+	if target < current {
+		err = downgradeConfigSchema(current, diskConf)
+	} else {
+		err = m.upgradeConfigSchema(current, target, diskConf)
+	}
+
+	if err != nil {
 		// Don't wrap the error, since it's informative enough as is.
 		return body, false, err
 	}
 
-	buf := bytes.NewBuffer(newBody)
+	newBody, err = encodeDiskConf(diskConf)
+	if err != nil {
+		return body, false, err
+	}
+
+	return newBody, true, nil
+}
+
+// Downgrade downgrades the configuration file one schema version down.  It
+// returns the body of the downgraded config file and the schema version it was
+// downgraded to.  Not every schema version can be downgraded.
+func (m *Migrator) Downgrade(body []byte) (newBody []byte, target uint, err error) {
+	diskConf, current, err := parseDiskConf(body)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return body, 0, err
+	}
+
+	if current > LastSchemaVersion {
+		return body, 0, fmt.Errorf("unknown current schema version %d", current)
+	}
+
+	if err = downgradeConfigSchema(current, diskConf); err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return body, 0, err
+	}
+
+	newBody, err = encodeDiskConf(diskConf)
+	if err != nil {
+		return body, 0, err
+	}
+
+	return newBody, current - 1, nil
+}
+
+// SchemaVersion returns the schema version of the configuration file.
+func SchemaVersion(body []byte) (v uint, err error) {
+	_, v, err = parseDiskConf(body)
+
+	// Don't wrap the error, since it's informative enough as is.
+	return v, err
+}
+
+// parseDiskConf parses the configuration file and its schema version.
+func parseDiskConf(body []byte) (diskConf yobj, current uint, err error) {
+	diskConf = yobj{}
+	err = yaml.Unmarshal(body, &diskConf)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing config file for upgrade: %w", err)
+	}
+
+	currentInt, _, err := fieldVal[int](diskConf, "schema_version")
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, 0, err
+	}
+
+	current = uint(currentInt)
+	log.Debug("got schema version %v", current)
+
+	return diskConf, current, nil
+}
+
+// encodeDiskConf returns the YAML representation of the migrated diskConf.
+func encodeDiskConf(diskConf yobj) (body []byte, err error) {
+	buf := &bytes.Buffer{}
 	enc := yaml.NewEncoder(buf)
 	enc.SetIndent(2)
 
 	if err = enc.Encode(diskConf); err != nil {
-		return body, false, fmt.Errorf("generating new config: %w", err)
+		return nil, fmt.Errorf("generating new config: %w", err)
 	}
 
-	return buf.Bytes(), true, nil
+	return buf.Bytes(), nil
 }
 
 // validateVersion validates the current and desired schema versions.
 func validateVersion(current, target uint) (err error) {
 	switch {
-	case current > target:
+	case current > LastSchemaVersion:
 		return fmt.Errorf("unknown current schema version %d", current)
 	case target > LastSchemaVersion:
 		return fmt.Errorf("unknown target schema version %d", target)
+	case target+1 == current && downgrades[current] != nil:
+		return nil
 	case target < current:
 		return fmt.Errorf("target schema version %d lower than current %d", target, current)
 	default:
@@ -125,6 +193,7 @@ func (m *Migrator) upgradeConfigSchema(current, target uint, diskConf yobj) (err
 		26: migrateTo27,
 		27: migrateTo28,
 		28: m.migrateTo29,
+		29: migrateTo30,
 	}
 
 	for i, migrate := range upgrades[current:target] {
@@ -140,3 +209,61 @@ func (m *Migrator) upgradeConfigSchema(current, target uint, diskConf yobj) (err
 
 	return nil
 }
+
+// downgrades are the functions reverting the changes of the corresponding
+// upgrades, indexed by the schema version they downgrade from.  Each of them
+// downgrades the configuration one schema version down.
+//
+// TODO: Add a downgrade for each new schema version, so that the configuration
+// file could be reverted after rolling back a failed update.
+var downgrades = map[uint]migrateFunc{
+	29: downgradeFrom29,
+	30: downgradeFrom30,
+}
+
+// downgradeConfigSchema downgrades the configuration schema in diskConf from
+// current version one version down.
+func downgradeConfigSchema(current uint, diskConf yobj) (err error) {
+	downgrade := downgrades[current]
+	if downgrade == nil {
+		return fmt.Errorf("schema version %d can't be downgraded", current)
+	}
+
+	log.Printf("Downgrade yaml: %d to %d", current, current-1)
+
+	if err = downgrade(diskConf); err != nil {
+		return fmt.Errorf("migrating schema %d to %d: %w", current, current-1, err)
+	}
+
+	for _, name := range argon2idUsers(diskConf) {
+		log.Info(
+			"warning: the password of user %q is hashed with argon2id, which the "+
+				"previous versions don't support; set it again after rolling back",
+			name,
+		)
+	}
+
+	return nil
+}
+
+// argon2idUsers returns the names of the users from diskConf, whose passwords
+// are hashed with Argon2id.  The versions of AdGuard Home before it was
+// introduced only support bcrypt, so these users can't log in after rolling
+// back.
+func argon2idUsers(diskConf yobj) (names []string) {
+	users, _, _ := fieldVal[yarr](diskConf, "users")
+	for _, u := range users {
+		user, ok := u.(yobj)
+		if !ok {
+			continue
+		}
+
+		pass, _, _ := fieldVal[string](user, "password")
+		if strings.HasPrefix(pass, "$argon2id$") {
+			name, _, _ := fieldVal[string](user, "name")
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 	yaml "gopkg.in/yaml.v3"
@@ -193,6 +194,10 @@ func TestMigrateConfig_Migrate(t *testing.T) {
 		yamlEqFunc:    require.YAMLEq,
 		name:          "v27",
 		targetVersion: 27,
+	}, {
+		yamlEqFunc:    require.YAMLEq,
+		name:          "v30",
+		targetVersion: 30,
 	}}
 
 	for _, tc := range testCases {
@@ -255,3 +260,40 @@ func TestMigrateConfig_Migrate_v29(t *testing.T) {
 
 	require.YAMLEq(t, string(wantBody), string(newBody))
 }
+
+func TestMigrator_Downgrade(t *testing.T) {
+	body, err := fs.ReadFile(testdata, "TestMigrateConfig_Migrate/v29/output.yml")
+	require.NoError(t, err)
+
+	wantBody, err := fs.ReadFile(testdata, "TestMigrateConfig_Migrate/v29/input.yml")
+	require.NoError(t, err)
+
+	migrator := configmigrate.New(&configmigrate.Config{
+		WorkingDir: t.Name(),
+		DataDir:    filepath.Join(t.Name(), "data"),
+	})
+
+	t.Run("success", func(t *testing.T) {
+		newBody, target, dErr := migrator.Downgrade(body)
+		require.NoError(t, dErr)
+
+		assert.Equal(t, uint(28), target)
+		assert.YAMLEq(t, string(wantBody), string(newBody))
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		newBody, upgraded, mErr := migrator.Migrate(body, 28)
+		require.NoError(t, mErr)
+
+		assert.True(t, upgraded)
+		assert.YAMLEq(t, string(wantBody), string(newBody))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, _, dErr := migrator.Downgrade(wantBody)
+		testutil.AssertErrorMsg(t, "schema version 28 can't be downgraded", dErr)
+
+		_, _, dErr = migrator.Migrate(body, 27)
+		testutil.AssertErrorMsg(t, "target schema version 27 lower than current 29", dErr)
+	})
+}
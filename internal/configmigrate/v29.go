@@ -61,3 +61,28 @@ func (m Migrator) migrateTo29(diskConf yobj) (err error) {
 
 	return nil
 }
+
+// downgradeFrom29 reverts the changes made by [Migrator.migrateTo29]:
+//
+//	# BEFORE:
+//	'filtering':
+//	  'safe_fs_patterns':
+//	    - '/opt/AdGuardHome/data/userfilters/*'
+//	    - '/path/to/file.txt'
+//	  # …
+//
+//	# AFTER:
+//	'filtering':
+//	  # …
+func downgradeFrom29(diskConf yobj) (err error) {
+	diskConf["schema_version"] = 28
+
+	fltConf, ok, err := fieldVal[yobj](diskConf, "filtering")
+	if !ok {
+		return err
+	}
+
+	delete(fltConf, "safe_fs_patterns")
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package configmigrate
+
+// migrateTo30 performs the following changes:
+//
+//	# BEFORE:
+//	'dns':
+//	  'upstream_timeout': '10s'
+//	  # …
+//	# …
+//
+//	# AFTER:
+//	'dns':
+//	  # …
+//	'timeouts':
+//	  'upstream': '10s'
+//	# …
+func migrateTo30(diskConf yobj) (err error) {
+	diskConf["schema_version"] = 30
+
+	dns, ok, err := fieldVal[yobj](diskConf, "dns")
+	if !ok {
+		return err
+	}
+
+	timeouts, _, err := fieldVal[yobj](diskConf, "timeouts")
+	if err != nil {
+		return err
+	} else if timeouts == nil {
+		timeouts = yobj{}
+	}
+
+	err = moveVal[any](dns, timeouts, "upstream_timeout", "upstream")
+	if err != nil {
+		return err
+	}
+
+	if len(timeouts) > 0 {
+		diskConf["timeouts"] = timeouts
+	}
+
+	return nil
+}
+
+// downgradeFrom30 reverts the changes made by [migrateTo30]:
+//
+//	# BEFORE:
+//	'dns':
+//	  # …
+//	'timeouts':
+//	  'upstream': '10s'
+//	  # …
+//	# …
+//
+//	# AFTER:
+//	'dns':
+//	  'upstream_timeout': '10s'
+//	  # …
+//	# …
+func downgradeFrom30(diskConf yobj) (err error) {
+	diskConf["schema_version"] = 29
+
+	timeouts, ok, err := fieldVal[yobj](diskConf, "timeouts")
+	if !ok {
+		return err
+	}
+
+	delete(diskConf, "timeouts")
+
+	dns, ok, err := fieldVal[yobj](diskConf, "dns")
+	if !ok {
+		return err
+	}
+
+	return moveVal[any](timeouts, dns, "upstream", "upstream_timeout")
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
 )
@@ -21,6 +22,15 @@ type ServerConfig struct {
 	// Register an HTTP handler
 	HTTPRegister aghhttp.RegisterFunc `yaml:"-"`
 
+	// ARPDB is the network neighborhood database used to detect the IP address
+	// conflicts with the devices which don't reply to ICMP echo requests.  It
+	// may be nil.
+	ARPDB arpdb.Interface `yaml:"-"`
+
+	// OnPoolUsage is called with the usage of each address pool each time the
+	// leases change.  It may be nil.
+	OnPoolUsage func(u *PoolUsage) `yaml:"-"`
+
 	Enabled       bool   `yaml:"enabled"`
 	InterfaceName string `yaml:"interface_name"`
 
@@ -32,6 +42,19 @@ type ServerConfig struct {
 	// [Interface.Enabled].
 	LocalDomainName string `yaml:"local_domain_name"`
 
+	// ReservedHostnames are the hostnames the DHCP clients can't use, for
+	// example the ones of the router and the other infrastructure.  The
+	// clients requesting them get the hostnames with a numeric suffix.
+	ReservedHostnames []string `yaml:"reserved_hostnames"`
+
+	// HostnameOwner, if not nil, returns the owner of a hostname used within
+	// the local domain by the sources other than the DHCP server.
+	HostnameOwner HostnameOwnerFunc `yaml:"-"`
+
+	// PoolAlertThreshold is the occupancy of an address pool in percents,
+	// exceeding which raises an alert.  Zero disables the alerts.
+	PoolAlertThreshold uint8 `yaml:"pool_alert_threshold"`
+
 	Conf4 V4ServerConf `yaml:"dhcpv4"`
 	Conf6 V6ServerConf `yaml:"dhcpv6"`
 
@@ -83,6 +106,14 @@ type DHCPServer interface {
 	// Stop - stop server
 	Stop() (err error)
 	getLeasesRef() []*dhcpsvc.Lease
+
+	// poolUsage returns the usage of the address pool, or nil if the server
+	// is disabled.
+	poolUsage() (u *PoolUsage)
+
+	// delegatedPrefixes returns deep clones of the current leases of the
+	// delegated IPv6 prefixes.
+	delegatedPrefixes() (leases []*dhcpsvc.Lease)
 }
 
 // V4ServerConf - server configuration
@@ -133,6 +164,17 @@ type V4ServerConf struct {
 	// TODO(a.garipov): This is utter madness and must be refactored.  It just
 	// begs for deadlock bugs and other nastiness.
 	notify func(uint32)
+
+	// arpDB is used to detect the IP address conflicts after sending an ICMP
+	// echo request.  It may be nil.
+	arpDB arpdb.Interface
+
+	// conflicts is the log of the detected IP address conflicts.
+	conflicts *conflictLog
+
+	// hostnames enforces the uniqueness of the hostnames of the clients.  It
+	// may be nil.
+	hostnames *hostnamePolicy
 }
 
 // errNilConfig is an error returned by validation method if the config is nil.
@@ -238,10 +280,23 @@ type V6ServerConf struct {
 	RASLAACOnly  bool `yaml:"ra_slaac_only" json:"-"`  // send ICMPv6.RA packets without MO flags
 	RAAllowSLAAC bool `yaml:"ra_allow_slaac" json:"-"` // send ICMPv6.RA packets with MO flags
 
+	// DelegatedPrefix is the pool of the IPv6 prefixes delegated to the
+	// requesting routers, see RFC 8415 Section 6.3.  If it's not valid, the
+	// prefix delegation is disabled.
+	DelegatedPrefix netip.Prefix `yaml:"delegated_prefix" json:"delegated_prefix"`
+
+	// DelegatedPrefixLen is the length of each of the prefixes delegated from
+	// DelegatedPrefix.  It must be greater than the length of DelegatedPrefix
+	// by no more than [maxDelegatedPrefixBits] and not greater than 64.
+	DelegatedPrefixLen int `yaml:"delegated_prefix_len" json:"delegated_prefix_len"`
+
 	ipStart    net.IP        // starting IP address for dynamic leases
 	leaseTime  time.Duration // the time during which a dynamic lease is considered valid
 	dnsIPAddrs []net.IP      // IPv6 addresses to return to DHCP clients as DNS server addresses
 
 	// Server calls this function when leases data changes
 	notify func(uint32)
+
+	// conflicts is the log of the detected IP address conflicts.
+	conflicts *conflictLog
 }
@@ -0,0 +1,109 @@
+package dhcpd
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// conflictSource is the way an IP address conflict has been detected.
+type conflictSource string
+
+// conflictSource values.
+const (
+	// conflictSourceICMP means that the address replied to an ICMP echo
+	// request sent before offering it.
+	conflictSourceICMP conflictSource = "icmp"
+
+	// conflictSourceARP means that the address has been resolved into a
+	// hardware address of another device in the neighbor table after probing
+	// it.  It catches the devices which don't reply to ICMP echo requests.
+	conflictSourceARP conflictSource = "arp"
+
+	// conflictSourceDecline means that the client declined the address,
+	// since it has detected that the address is already in use.
+	conflictSourceDecline conflictSource = "decline"
+)
+
+// conflict is an event of detecting that an IP address is already in use by
+// another device.
+type conflict struct {
+	// Time is the time when the conflict has been detected.
+	Time time.Time
+
+	// IP is the conflicting address.
+	IP netip.Addr
+
+	// HWAddr is the hardware address of the device using IP, if known.
+	HWAddr net.HardwareAddr
+
+	// Source is the way the conflict has been detected.
+	Source conflictSource
+}
+
+// maxConflicts is the maximum number of the recent conflicts kept in the
+// conflict log.
+const maxConflicts = 100
+
+// conflictLog is the log of the recent IP address conflicts.  It's safe for
+// concurrent use.
+type conflictLog struct {
+	// mu protects buf.
+	mu *sync.Mutex
+
+	// buf is the ring buffer of the recent conflicts.
+	buf *container.RingBuffer[*conflict]
+}
+
+// newConflictLog returns a new properly initialized *conflictLog.
+func newConflictLog() (cl *conflictLog) {
+	return &conflictLog{
+		mu:  &sync.Mutex{},
+		buf: container.NewRingBuffer[*conflict](maxConflicts),
+	}
+}
+
+// add logs the conflict and appends it to the log.  It doesn't call any
+// callbacks, so it's safe to call it within locked sections.
+func (cl *conflictLog) add(c *conflict) {
+	log.Info(
+		"dhcp: ip conflict: %s is used by another device %s, detected by %s, quarantined",
+		c.IP,
+		c.HWAddr,
+		c.Source,
+	)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.buf.Push(c)
+}
+
+// list returns the recent conflicts from the newest to the oldest.
+func (cl *conflictLog) list() (conflicts []*conflict) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	conflicts = make([]*conflict, 0, cl.buf.Len())
+	cl.buf.ReverseRange(func(c *conflict) (cont bool) {
+		conflicts = append(conflicts, c)
+
+		return true
+	})
+
+	return conflicts
+}
+
+// isZeroHWAddr returns true if mac is a non-empty hardware address consisting
+// of zeroes only.  Such addresses are used to mark the quarantined leases and
+// the unresolved neighbors.
+func isZeroHWAddr(mac net.HardwareAddr) (ok bool) {
+	return len(mac) > 0 && !slices.ContainsFunc(mac, func(b byte) (nonZero bool) {
+		return b != 0
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/google/renameio/v2/maybe"
 )
 
@@ -42,7 +44,14 @@ type dbLease struct {
 	IP       netip.Addr `json:"ip"`
 	Hostname string     `json:"hostname"`
 	HWAddr   string     `json:"mac"`
-	IsStatic bool       `json:"static"`
+	DUID     string     `json:"duid,omitempty"`
+	IAID     uint32     `json:"iaid,omitempty"`
+
+	// Prefix is the delegated IPv6 prefix, if the lease is a DHCPv6 prefix
+	// delegation.
+	Prefix string `json:"prefix,omitempty"`
+
+	IsStatic bool `json:"static"`
 }
 
 // fromLease converts *dhcpsvc.Lease to *dbLease.
@@ -56,20 +65,48 @@ func fromLease(l *dhcpsvc.Lease) (dl *dbLease) {
 		expiryStr = l.Expiry.Format(time.RFC3339)
 	}
 
+	var prefixStr string
+	if l.Prefix.IsValid() {
+		prefixStr = l.Prefix.String()
+	}
+
 	return &dbLease{
 		Expiry:   expiryStr,
 		Hostname: l.Hostname,
 		HWAddr:   l.HWAddr.String(),
+		DUID:     formatDUID(l.DUID),
+		IAID:     l.IAID,
 		IP:       l.IP,
+		Prefix:   prefixStr,
 		IsStatic: l.IsStatic,
 	}
 }
 
 // toLease converts *dbLease to *dhcpsvc.Lease.
 func (dl *dbLease) toLease() (l *dhcpsvc.Lease, err error) {
-	mac, err := net.ParseMAC(dl.HWAddr)
-	if err != nil {
-		return nil, fmt.Errorf("parsing hardware address: %w", err)
+	var duid []byte
+	if dl.DUID != "" {
+		duid, err = parseDUID(dl.DUID)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	var prefix netip.Prefix
+	if dl.Prefix != "" {
+		prefix, err = netip.ParsePrefix(dl.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("parsing prefix: %w", err)
+		}
+	}
+
+	var mac net.HardwareAddr
+	if dl.HWAddr != "" || duid == nil {
+		mac, err = net.ParseMAC(dl.HWAddr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing hardware address: %w", err)
+		}
 	}
 
 	expiry := time.Time{}
@@ -85,6 +122,9 @@ func (dl *dbLease) toLease() (l *dhcpsvc.Lease, err error) {
 		IP:       dl.IP,
 		Hostname: dl.Hostname,
 		HWAddr:   mac,
+		DUID:     duid,
+		IAID:     dl.IAID,
+		Prefix:   prefix,
 		IsStatic: dl.IsStatic,
 	}, nil
 }
@@ -196,3 +236,72 @@ func writeDB(path string, leases []*dbLease) (err error) {
 
 	return nil
 }
+
+// ImportStaticLeases adds the static leases to the leases database in dataDir
+// and returns the number of the added ones.  The database must not be used by
+// a running DHCP server.  The leases conflicting with the stored ones are
+// skipped and reported in errs.
+func ImportStaticLeases(
+	dataDir string,
+	leases []*dhcpsvc.Lease,
+) (n int, errs []error, err error) {
+	path := filepath.Join(dataDir, dataFilename)
+	dl := &dataLeases{}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, dl)
+		if err != nil {
+			return 0, nil, fmt.Errorf("decoding db: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, nil, fmt.Errorf("reading db: %w", err)
+	}
+
+	for _, l := range leases {
+		err = validateImportedLease(dl.Leases, l)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("static lease %s: %w", l.HWAddr, err))
+
+			continue
+		}
+
+		l.IsStatic = true
+		dl.Leases = append(dl.Leases, fromLease(l))
+		n++
+	}
+
+	if n == 0 {
+		return 0, errs, nil
+	}
+
+	return n, errs, writeDB(path, dl.Leases)
+}
+
+// validateImportedLease returns an error if l is not a valid IPv4 static lease
+// or conflicts with one of the stored leases.
+func validateImportedLease(stored []*dbLease, l *dhcpsvc.Lease) (err error) {
+	if !l.IP.Is4() {
+		return fmt.Errorf("invalid IP %q: only IPv4 is supported", l.IP)
+	}
+
+	err = netutil.ValidateMAC(l.HWAddr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	mac := l.HWAddr.String()
+	for _, dl := range stored {
+		switch {
+		case dl.HWAddr == mac:
+			return fmt.Errorf("hardware address already leased to %s", dl.IP)
+		case dl.IP == l.IP:
+			return fmt.Errorf("ip %s already leased to %s", l.IP, dl.HWAddr)
+		case l.Hostname != "" && dl.Hostname == l.Hostname:
+			return fmt.Errorf("hostname %q already used by %s", l.Hostname, dl.HWAddr)
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/netip"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
@@ -97,6 +98,31 @@ type server struct {
 
 	// Called when the leases DB is modified
 	onLeaseChanged []OnLeaseChangedT
+
+	// conflicts is the log of the IP address conflicts detected by both the
+	// DHCPv4 and the DHCPv6 servers.
+	conflicts *conflictLog
+
+	// hostnames enforces the uniqueness of the hostnames of the DHCPv4
+	// clients.
+	hostnames *hostnamePolicy
+
+	// poolAlerts is the state of the alerts about the address pools exceeding
+	// the occupancy threshold.
+	poolAlerts *poolAlerts
+
+	// poolUsageReqs are the requests for the update of the usage of the
+	// address pools.  Its capacity is one, so that the requests made before the
+	// previous one is handled are coalesced.
+	poolUsageReqs chan struct{}
+
+	// poolUsageStop stops the goroutine updating the usage of the address
+	// pools.  It's nil if the goroutine isn't running.
+	poolUsageStop chan struct{}
+
+	// poolUsageDone is closed when the goroutine updating the usage of the
+	// address pools exits.
+	poolUsageDone chan struct{}
 }
 
 // type check
@@ -111,13 +137,35 @@ func Create(conf *ServerConfig) (s *server, err error) {
 
 			HTTPRegister: conf.HTTPRegister,
 
+			ARPDB: conf.ARPDB,
+
+			OnPoolUsage: conf.OnPoolUsage,
+
 			Enabled:       conf.Enabled,
 			InterfaceName: conf.InterfaceName,
 
 			LocalDomainName: conf.LocalDomainName,
 
+			ReservedHostnames: slices.Clone(conf.ReservedHostnames),
+			HostnameOwner:     conf.HostnameOwner,
+
+			PoolAlertThreshold: conf.PoolAlertThreshold,
+
 			dbFilePath: filepath.Join(conf.DataDir, dataFilename),
 		},
+		conflicts:     newConflictLog(),
+		poolAlerts:    newPoolAlerts(),
+		poolUsageReqs: make(chan struct{}, 1),
+	}
+
+	if conf.PoolAlertThreshold > 100 {
+		return nil, fmt.Errorf("pool_alert_threshold: must be at most 100, got %d", conf.PoolAlertThreshold)
+	}
+
+	s.hostnames, err = newHostnamePolicy(conf.ReservedHostnames, conf.HostnameOwner)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
 	}
 
 	// TODO(e.burkov):  Don't register handlers, see TODO on
@@ -161,6 +209,9 @@ func (s *server) setServers(conf *ServerConfig) (v4Enabled, v6Enabled bool, err
 	v4conf := conf.Conf4
 	v4conf.InterfaceName = s.conf.InterfaceName
 	v4conf.notify = s.onNotify
+	v4conf.arpDB = s.conf.ARPDB
+	v4conf.conflicts = s.conflicts
+	v4conf.hostnames = s.hostnames
 	v4conf.Enabled = s.conf.Enabled && v4conf.RangeStart.IsValid()
 
 	s.srv4, err = v4Create(&v4conf)
@@ -175,6 +226,7 @@ func (s *server) setServers(conf *ServerConfig) (v4Enabled, v6Enabled bool, err
 	v6conf := conf.Conf6
 	v6conf.InterfaceName = s.conf.InterfaceName
 	v6conf.notify = s.onNotify
+	v6conf.conflicts = s.conflicts
 	v6conf.Enabled = s.conf.Enabled && len(v6conf.RangeStart) != 0
 
 	s.srv6, err = v6Create(v6conf)
@@ -215,6 +267,10 @@ func (s *server) onNotify(flags uint32) {
 			log.Error("updating db: %s", err)
 		}
 
+		// Don't update the usage of the pools here, since the servers may send
+		// this notification with their leases locked.
+		s.schedulePoolUsage()
+
 		return
 	}
 
@@ -232,6 +288,8 @@ func (s *server) WriteDiskConfig(c *ServerConfig) {
 	c.Enabled = s.conf.Enabled
 	c.InterfaceName = s.conf.InterfaceName
 	c.LocalDomainName = s.conf.LocalDomainName
+	c.ReservedHostnames = slices.Clone(s.conf.ReservedHostnames)
+	c.PoolAlertThreshold = s.conf.PoolAlertThreshold
 
 	s.srv4.WriteDiskConfig4(&c.Conf4)
 	s.srv6.WriteDiskConfig6(&c.Conf6)
@@ -249,11 +307,17 @@ func (s *server) Start() (err error) {
 		return err
 	}
 
+	// Report the usage of the pools with the leases loaded from the database.
+	s.updatePoolUsage()
+	s.startPoolUsage()
+
 	return nil
 }
 
 // Stop closes the listening UDP socket
 func (s *server) Stop() (err error) {
+	s.stopPoolUsage()
+
 	err = s.srv4.Stop()
 	if err != nil {
 		return err
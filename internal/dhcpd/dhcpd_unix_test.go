@@ -86,6 +86,66 @@ func TestDB(t *testing.T) {
 	assert.True(t, ll[1].IsStatic)
 }
 
+func TestImportStaticLeases(t *testing.T) {
+	dataDir := t.TempDir()
+	stored := []*dbLease{{
+		Hostname: "stored",
+		HWAddr:   "aa:aa:aa:aa:aa:aa",
+		IP:       netip.MustParseAddr("192.168.10.100"),
+		IsStatic: true,
+	}}
+
+	err := writeDB(filepath.Join(dataDir, dataFilename), stored)
+	require.NoError(t, err)
+
+	n, errs, err := ImportStaticLeases(dataDir, []*dhcpsvc.Lease{{
+		Hostname: "new",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xBB},
+		IP:       netip.MustParseAddr("192.168.10.101"),
+	}, {
+		Hostname: "",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		IP:       netip.MustParseAddr("192.168.10.102"),
+	}, {
+		Hostname: "",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xCC},
+		IP:       netip.MustParseAddr("192.168.10.101"),
+	}, {
+		Hostname: "stored",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xDD},
+		IP:       netip.MustParseAddr("192.168.10.103"),
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, n)
+	assert.Len(t, errs, 3)
+
+	s := server{
+		conf: &ServerConfig{
+			dbFilePath: filepath.Join(dataDir, dataFilename),
+		},
+	}
+
+	s.srv4, err = v4Create(&V4ServerConf{
+		Enabled:    true,
+		RangeStart: netip.MustParseAddr("192.168.10.100"),
+		RangeEnd:   netip.MustParseAddr("192.168.10.200"),
+		GatewayIP:  netip.MustParseAddr("192.168.10.1"),
+		SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		notify:     testNotify,
+	})
+	require.NoError(t, err)
+
+	err = s.dbLoad()
+	require.NoError(t, err)
+
+	ll := s.srv4.GetLeases(LeasesStatic)
+	require.Len(t, ll, 2)
+
+	assert.Equal(t, "new", ll[0].Hostname)
+	assert.Equal(t, netip.MustParseAddr("192.168.10.101"), ll[0].IP)
+}
+
 func TestV4Server_badRange(t *testing.T) {
 	testCases := []struct {
 		name       string
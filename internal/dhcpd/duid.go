@@ -0,0 +1,61 @@
+package dhcpd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// minDUIDLen is the minimum length of a DUID, which is the 2-byte type
+	// followed by at least one byte of the identifier.
+	minDUIDLen = 3
+
+	// maxDUIDLen is the maximum length of a DUID, which is the 2-byte type
+	// followed by at most 128 bytes of the identifier.  See RFC 8415 Section
+	// 11.1.
+	maxDUIDLen = 130
+)
+
+// formatDUID returns the DUID in the colon-separated hexadecimal form, the same
+// as the one of [net.HardwareAddr.String].  It returns an empty string for an
+// empty DUID.
+func formatDUID(duid []byte) (s string) {
+	if len(duid) == 0 {
+		return ""
+	}
+
+	b := &strings.Builder{}
+	b.Grow(len(duid)*3 - 1)
+	for i, octet := range duid {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+
+		b.WriteString(hex.EncodeToString([]byte{octet}))
+	}
+
+	return b.String()
+}
+
+// parseDUID parses the DUID in the hexadecimal form, with the octets
+// optionally separated by colons or hyphens.
+func parseDUID(s string) (duid []byte, err error) {
+	hexStr := strings.NewReplacer(":", "", "-", "").Replace(s)
+	duid, err = hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad duid %q: %w", s, err)
+	}
+
+	if l := len(duid); l < minDUIDLen || l > maxDUIDLen {
+		return nil, fmt.Errorf(
+			"bad duid %q: length must be between %d and %d, got %d",
+			s,
+			minDUIDLen,
+			maxDUIDLen,
+			l,
+		)
+	}
+
+	return duid, nil
+}
@@ -0,0 +1,215 @@
+package dhcpd
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// HostnameOwnerFunc returns the description of the owner of the hostname in the
+// local domain, such as a DNS rewrite or a persistent client, if host is used
+// by a device other than the one with ip.  Otherwise, it returns an empty
+// string.  It must be safe for concurrent use and must not call the DHCP
+// server, since it's called within its locked sections.
+type HostnameOwnerFunc func(host string, ip netip.Addr) (owner string)
+
+// ownerReserved is the description of the owner of the reserved hostnames.
+const ownerReserved = "reserved hostname"
+
+// maxHostnameSuffix is the maximum numeric suffix appended to a hostname
+// requested by a DHCP client in case it's already used.
+const maxHostnameSuffix = 99
+
+// maxHostnameLabelLen is the maximum length of a hostname label.
+const maxHostnameLabelLen = 63
+
+// hostnamePolicy enforces the uniqueness of the hostnames of the DHCP clients
+// within the local domain.  It's safe for concurrent use.
+type hostnamePolicy struct {
+	// reserved are the hostnames the DHCP clients can't use.
+	reserved *container.MapSet[string]
+
+	// owner, if not nil, returns the owner of a hostname used by the other
+	// sources of the local hostnames.
+	owner HostnameOwnerFunc
+
+	// conflicts is the log of the detected hostname conflicts.
+	conflicts *hostnameConflictLog
+}
+
+// newHostnamePolicy validates the reserved hostnames and returns a new
+// properly initialized *hostnamePolicy.  owner may be nil.
+func newHostnamePolicy(reserved []string, owner HostnameOwnerFunc) (p *hostnamePolicy, err error) {
+	p = &hostnamePolicy{
+		reserved:  container.NewMapSet[string](),
+		owner:     owner,
+		conflicts: newHostnameConflictLog(),
+	}
+
+	for i, h := range reserved {
+		h = strings.ToLower(h)
+		err = netutil.ValidateHostname(h)
+		if err != nil {
+			return nil, fmt.Errorf("reserved_hostnames: at index %d: %w", i, err)
+		}
+
+		p.reserved.Add(h)
+	}
+
+	return p, nil
+}
+
+// ownerOf returns the owner of host if the device with ip can't use it.  p may
+// be nil.
+func (p *hostnamePolicy) ownerOf(host string, ip netip.Addr) (owner string) {
+	if p == nil {
+		return ""
+	} else if p.reserved.Has(host) {
+		return ownerReserved
+	} else if p.owner != nil {
+		return p.owner(host, ip)
+	}
+
+	return ""
+}
+
+// unique returns host if it isn't used by anything other than the device with
+// ip.  Otherwise, it returns host with the smallest free numeric suffix, for
+// example "host-2", so that the result only depends on the hostnames already
+// in use.  leaseOwner returns the owner of a hostname among the other leases,
+// if any.  owner is the owner of host, if it's used.  assigned is empty if
+// there is no free hostname.
+func (p *hostnamePolicy) unique(
+	host string,
+	ip netip.Addr,
+	leaseOwner func(h string) (owner string),
+) (assigned, owner string) {
+	owner = p.usedBy(host, ip, leaseOwner)
+	if owner == "" {
+		return host, ""
+	}
+
+	for n := 2; n <= maxHostnameSuffix; n++ {
+		suffix := "-" + strconv.Itoa(n)
+		base := host
+		if len(base)+len(suffix) > maxHostnameLabelLen {
+			base = strings.TrimSuffix(base[:maxHostnameLabelLen-len(suffix)], "-")
+		}
+
+		candidate := base + suffix
+		if p.usedBy(candidate, ip, leaseOwner) == "" {
+			return candidate, owner
+		}
+	}
+
+	return "", owner
+}
+
+// usedBy returns the owner of host among the leases and the other sources of
+// the local hostnames, if the device with ip can't use it.
+func (p *hostnamePolicy) usedBy(
+	host string,
+	ip netip.Addr,
+	leaseOwner func(h string) (owner string),
+) (owner string) {
+	if owner = leaseOwner(host); owner != "" {
+		return owner
+	}
+
+	return p.ownerOf(host, ip)
+}
+
+// report adds the conflict to the log.  p may be nil.
+func (p *hostnamePolicy) report(c *hostnameConflict) {
+	if p != nil {
+		p.conflicts.add(c)
+	}
+}
+
+// hostnameConflict is an event of a DHCP client requesting a hostname already
+// used within the local domain.
+type hostnameConflict struct {
+	// Time is the time when the conflict has been detected.
+	Time time.Time
+
+	// IP is the address of the DHCP client.
+	IP netip.Addr
+
+	// HWAddr is the hardware address of the DHCP client.
+	HWAddr net.HardwareAddr
+
+	// Requested is the hostname requested by the client.
+	Requested string
+
+	// Assigned is the hostname assigned to the client instead.  It's empty if
+	// no hostname has been assigned.
+	Assigned string
+
+	// Owner is the description of the owner of the requested hostname.
+	Owner string
+}
+
+// hostnameConflictLog is the log of the recent hostname conflicts.  It's safe
+// for concurrent use.
+type hostnameConflictLog struct {
+	// mu protects buf.
+	mu *sync.Mutex
+
+	// buf is the ring buffer of the recent conflicts.
+	buf *container.RingBuffer[*hostnameConflict]
+}
+
+// newHostnameConflictLog returns a new properly initialized
+// *hostnameConflictLog.
+func newHostnameConflictLog() (cl *hostnameConflictLog) {
+	return &hostnameConflictLog{
+		mu:  &sync.Mutex{},
+		buf: container.NewRingBuffer[*hostnameConflict](maxConflicts),
+	}
+}
+
+// add logs the conflict and appends it to the log.  It's safe to call it within
+// locked sections.
+func (cl *hostnameConflictLog) add(c *hostnameConflict) {
+	log.Info(
+		"dhcp: hostname conflict: %q requested by %s (%s) is used by %s, assigned %q",
+		c.Requested,
+		c.IP,
+		c.HWAddr,
+		c.Owner,
+		c.Assigned,
+	)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.buf.Push(c)
+}
+
+// list returns the recent conflicts from the newest to the oldest.  cl may be
+// nil.
+func (cl *hostnameConflictLog) list() (conflicts []*hostnameConflict) {
+	if cl == nil {
+		return nil
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	conflicts = make([]*hostnameConflict, 0, cl.buf.Len())
+	cl.buf.ReverseRange(func(c *hostnameConflict) (cont bool) {
+		conflicts = append(conflicts, c)
+
+		return true
+	})
+
+	return conflicts
+}
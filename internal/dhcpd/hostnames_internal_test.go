@@ -0,0 +1,141 @@
+package dhcpd
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHostnamePolicy(t *testing.T) {
+	p, err := newHostnamePolicy([]string{"Router", "nas"}, nil)
+	require.NoError(t, err)
+
+	ip := netip.MustParseAddr("192.168.0.2")
+
+	assert.Equal(t, ownerReserved, p.ownerOf("router", ip))
+	assert.Equal(t, ownerReserved, p.ownerOf("nas", ip))
+	assert.Empty(t, p.ownerOf("laptop", ip))
+
+	_, err = newHostnamePolicy([]string{"router", "bad_host!"}, nil)
+	assert.ErrorContains(t, err, "reserved_hostnames: at index 1")
+}
+
+func TestHostnamePolicy_unique(t *testing.T) {
+	const (
+		ownerLease   = "lease for aa:aa:aa:aa:aa:aa"
+		ownerRewrite = "rewrite for printer.lan"
+	)
+
+	ip := netip.MustParseAddr("192.168.0.2")
+	printerIP := netip.MustParseAddr("192.168.0.10")
+
+	p, err := newHostnamePolicy([]string{"router"}, func(host string, addr netip.Addr) (owner string) {
+		if host == "printer" && addr != printerIP {
+			return ownerRewrite
+		}
+
+		return ""
+	})
+	require.NoError(t, err)
+
+	leased := map[string]bool{
+		"laptop":   true,
+		"laptop-2": true,
+		"router-2": true,
+	}
+	leaseOwner := func(h string) (owner string) {
+		if leased[h] {
+			return ownerLease
+		}
+
+		return ""
+	}
+
+	longHost := strings.Repeat("a", maxHostnameLabelLen)
+
+	testCases := []struct {
+		name         string
+		host         string
+		wantAssigned string
+		wantOwner    string
+		ip           netip.Addr
+	}{{
+		name:         "free",
+		host:         "phone",
+		wantAssigned: "phone",
+		wantOwner:    "",
+		ip:           ip,
+	}, {
+		name:         "leased",
+		host:         "laptop",
+		wantAssigned: "laptop-3",
+		wantOwner:    ownerLease,
+		ip:           ip,
+	}, {
+		name:         "reserved",
+		host:         "router",
+		wantAssigned: "router-3",
+		wantOwner:    ownerReserved,
+		ip:           ip,
+	}, {
+		name:         "rewrite",
+		host:         "printer",
+		wantAssigned: "printer-2",
+		wantOwner:    ownerRewrite,
+		ip:           ip,
+	}, {
+		name:         "rewrite_same_ip",
+		host:         "printer",
+		wantAssigned: "printer",
+		wantOwner:    "",
+		ip:           printerIP,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assigned, owner := p.unique(tc.host, tc.ip, leaseOwner)
+			assert.Equal(t, tc.wantAssigned, assigned)
+			assert.Equal(t, tc.wantOwner, owner)
+		})
+	}
+
+	t.Run("long", func(t *testing.T) {
+		leased[longHost] = true
+		t.Cleanup(func() { delete(leased, longHost) })
+
+		assigned, owner := p.unique(longHost, ip, leaseOwner)
+		assert.Equal(t, ownerLease, owner)
+		assert.Equal(t, longHost[:maxHostnameLabelLen-2]+"-2", assigned)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		allLeased := func(_ string) (owner string) { return ownerLease }
+
+		assigned, owner := p.unique("laptop", ip, allLeased)
+		assert.Empty(t, assigned)
+		assert.Equal(t, ownerLease, owner)
+	})
+}
+
+func TestHostnameConflictLog(t *testing.T) {
+	var nilLog *hostnameConflictLog
+	assert.Nil(t, nilLog.list())
+
+	cl := newHostnameConflictLog()
+	for i := range maxConflicts + 1 {
+		cl.add(&hostnameConflict{
+			Time:      time.Unix(int64(i), 0),
+			Requested: "host",
+		})
+	}
+
+	conflicts := cl.list()
+	require.Len(t, conflicts, maxConflicts)
+
+	assert.Equal(t, time.Unix(maxConflicts, 0), conflicts[0].Time)
+	assert.Equal(t, time.Unix(1, 0), conflicts[len(conflicts)-1].Time)
+}
@@ -47,6 +47,11 @@ func (j *v4ServerConfJSON) toServerConf() *V4ServerConf {
 type v6ServerConfJSON struct {
 	RangeStart    netip.Addr `json:"range_start"`
 	LeaseDuration uint32     `json:"lease_duration"`
+
+	// DelegatedPrefix is the pool of the delegated prefixes.  If it's empty,
+	// the prefix delegation is disabled.
+	DelegatedPrefix    netip.Prefix `json:"delegated_prefix"`
+	DelegatedPrefixLen int          `json:"delegated_prefix_len"`
 }
 
 func v6JSONToServerConf(j *v6ServerConfJSON) V6ServerConf {
@@ -55,8 +60,10 @@ func v6JSONToServerConf(j *v6ServerConfJSON) V6ServerConf {
 	}
 
 	return V6ServerConf{
-		RangeStart:    j.RangeStart.AsSlice(),
-		LeaseDuration: j.LeaseDuration,
+		RangeStart:         j.RangeStart.AsSlice(),
+		LeaseDuration:      j.LeaseDuration,
+		DelegatedPrefix:    j.DelegatedPrefix,
+		DelegatedPrefixLen: j.DelegatedPrefixLen,
 	}
 }
 
@@ -68,6 +75,105 @@ type dhcpStatusResponse struct {
 	Leases       []*leaseDynamic `json:"leases"`
 	StaticLeases []*leaseStatic  `json:"static_leases"`
 	Enabled      bool            `json:"enabled"`
+
+	// Conflicts are the recent IP address conflicts from the newest to the
+	// oldest.
+	Conflicts []*conflictJSON `json:"conflicts"`
+
+	// HostnameConflicts are the recent conflicts of the hostnames requested
+	// by the clients from the newest to the oldest.
+	HostnameConflicts []*hostnameConflictJSON `json:"hostname_conflicts"`
+
+	// Pools are the usage of the address pools of the enabled servers.
+	Pools []*poolUsageJSON `json:"pools"`
+
+	// DelegatedPrefixes are the IPv6 prefixes currently delegated to the
+	// downstream routers.
+	DelegatedPrefixes []*delegatedPrefixJSON `json:"delegated_prefixes"`
+}
+
+// delegatedPrefixJSON is the JSON form of a lease of a delegated IPv6 prefix.
+type delegatedPrefixJSON struct {
+	Prefix netip.Prefix `json:"prefix"`
+	HWAddr string       `json:"mac,omitempty"`
+	DUID   string       `json:"duid"`
+	IAID   uint32       `json:"iaid"`
+	Expiry string       `json:"expires"`
+}
+
+// delegatedPrefixesToJSON converts list of prefix leases to their JSON form.
+func delegatedPrefixesToJSON(leases []*dhcpsvc.Lease) (res []*delegatedPrefixJSON) {
+	res = make([]*delegatedPrefixJSON, 0, len(leases))
+	for _, l := range leases {
+		res = append(res, &delegatedPrefixJSON{
+			Prefix: l.Prefix,
+			HWAddr: l.HWAddr.String(),
+			DUID:   formatDUID(l.DUID),
+			IAID:   l.IAID,
+			Expiry: l.Expiry.Format(time.RFC3339),
+		})
+	}
+
+	return res
+}
+
+// poolUsageJSON is the JSON form of the usage of an address pool.
+type poolUsageJSON struct {
+	*PoolUsage
+
+	// Alert is true if the occupancy of the pool exceeds the threshold.
+	Alert bool `json:"alert"`
+}
+
+// conflictJSON is the JSON form of an IP address conflict.
+type conflictJSON struct {
+	IP     netip.Addr     `json:"ip"`
+	HWAddr string         `json:"mac,omitempty"`
+	Source conflictSource `json:"source"`
+	Time   string         `json:"time"`
+}
+
+// conflictsToJSON converts list of conflicts to their JSON form.
+func conflictsToJSON(conflicts []*conflict) (res []*conflictJSON) {
+	res = make([]*conflictJSON, 0, len(conflicts))
+	for _, c := range conflicts {
+		res = append(res, &conflictJSON{
+			IP:     c.IP,
+			HWAddr: c.HWAddr.String(),
+			Source: c.Source,
+			Time:   c.Time.Format(time.RFC3339),
+		})
+	}
+
+	return res
+}
+
+// hostnameConflictJSON is the JSON form of a hostname conflict.
+type hostnameConflictJSON struct {
+	IP        netip.Addr `json:"ip"`
+	HWAddr    string     `json:"mac"`
+	Requested string     `json:"requested"`
+	Assigned  string     `json:"assigned"`
+	Owner     string     `json:"owner"`
+	Time      string     `json:"time"`
+}
+
+// hostnameConflictsToJSON converts list of hostname conflicts to their JSON
+// form.
+func hostnameConflictsToJSON(conflicts []*hostnameConflict) (res []*hostnameConflictJSON) {
+	res = make([]*hostnameConflictJSON, 0, len(conflicts))
+	for _, c := range conflicts {
+		res = append(res, &hostnameConflictJSON{
+			IP:        c.IP,
+			HWAddr:    c.HWAddr.String(),
+			Requested: c.Requested,
+			Assigned:  c.Assigned,
+			Owner:     c.Owner,
+			Time:      c.Time.Format(time.RFC3339),
+		})
+	}
+
+	return res
 }
 
 // leaseStatic is the JSON form of static DHCP lease.
@@ -75,6 +181,14 @@ type leaseStatic struct {
 	HWAddr   string     `json:"mac"`
 	IP       netip.Addr `json:"ip"`
 	Hostname string     `json:"hostname"`
+
+	// DUID is the DUID of the DHCPv6 client, if the lease is identified by it
+	// instead of HWAddr.
+	DUID string `json:"duid,omitempty"`
+
+	// IAID is the identity association of the DHCPv6 client the lease is
+	// reserved for.  Zero means any.
+	IAID uint32 `json:"iaid,omitempty"`
 }
 
 // leasesToStatic converts list of leases to their JSON form.
@@ -86,21 +200,44 @@ func leasesToStatic(leases []*dhcpsvc.Lease) (static []*leaseStatic) {
 			HWAddr:   l.HWAddr.String(),
 			IP:       l.IP,
 			Hostname: l.Hostname,
+			DUID:     formatDUID(l.DUID),
+			IAID:     l.IAID,
 		}
 	}
 
 	return static
 }
 
-// toLease converts leaseStatic to Lease or returns error.
+// toLease converts leaseStatic to Lease or returns error.  The MAC address may
+// be omitted for the DHCPv6 leases identified by DUID.
 func (l *leaseStatic) toLease() (lease *dhcpsvc.Lease, err error) {
-	addr, err := net.ParseMAC(l.HWAddr)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't parse MAC address: %w", err)
+	var duid []byte
+	if l.DUID != "" {
+		if !l.IP.Is6() {
+			return nil, errors.Error("duid is only supported for ipv6 leases")
+		}
+
+		duid, err = parseDUID(l.DUID)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	} else if l.IAID != 0 {
+		return nil, errors.Error("iaid requires duid")
+	}
+
+	var addr net.HardwareAddr
+	if l.HWAddr != "" || duid == nil {
+		addr, err = net.ParseMAC(l.HWAddr)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse MAC address: %w", err)
+		}
 	}
 
 	return &dhcpsvc.Lease{
 		HWAddr:   addr,
+		DUID:     duid,
+		IAID:     l.IAID,
 		IP:       l.IP,
 		Hostname: l.Hostname,
 		IsStatic: true,
@@ -113,6 +250,9 @@ type leaseDynamic struct {
 	IP       netip.Addr `json:"ip"`
 	Hostname string     `json:"hostname"`
 	Expiry   string     `json:"expires"`
+
+	// DUID is the DUID of the DHCPv6 client, if any.
+	DUID string `json:"duid,omitempty"`
 }
 
 // leasesToDynamic converts list of leases to their JSON form.
@@ -129,6 +269,7 @@ func leasesToDynamic(leases []*dhcpsvc.Lease) (dynamic []*leaseDynamic) {
 			//
 			// See https://github.com/AdguardTeam/AdGuardHome/issues/2692.
 			Expiry: l.Expiry.Format(time.RFC3339),
+			DUID:   formatDUID(l.DUID),
 		}
 	}
 
@@ -167,6 +308,18 @@ func (s *server) handleDHCPStatus(w http.ResponseWriter, r *http.Request) {
 
 	status.Leases = leasesToDynamic(leases[dynamicIdx:])
 	status.StaticLeases = leasesToStatic(leases[:dynamicIdx])
+	status.Conflicts = conflictsToJSON(s.conflicts.list())
+	status.HostnameConflicts = hostnameConflictsToJSON(s.hostnames.conflicts.list())
+
+	status.Pools = []*poolUsageJSON{}
+	for _, u := range s.poolUsage() {
+		status.Pools = append(status.Pools, &poolUsageJSON{
+			PoolUsage: u,
+			Alert:     s.poolAlerts.isActive(u.Name),
+		})
+	}
+
+	status.DelegatedPrefixes = delegatedPrefixesToJSON(s.srv6.delegatedPrefixes())
 
 	aghhttp.WriteJSONResponseOK(w, r, status)
 }
@@ -251,6 +404,9 @@ func (s *server) handleDHCPSetConfigV4(
 	v4Conf.notify = c4.notify
 	v4Conf.ICMPTimeout = c4.ICMPTimeout
 	v4Conf.Options = c4.Options
+	v4Conf.arpDB = s.conf.ARPDB
+	v4Conf.conflicts = s.conflicts
+	v4Conf.hostnames = s.hostnames
 
 	srv4, err := v4Create(v4Conf)
 
@@ -280,6 +436,7 @@ func (s *server) handleDHCPSetConfigV6(
 	enabled = v6Conf.Enabled
 	v6Conf.InterfaceName = conf.InterfaceName
 	v6Conf.notify = s.onNotify
+	v6Conf.conflicts = s.conflicts
 
 	srv6, err = v6Create(v6Conf)
 
@@ -683,8 +840,14 @@ func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 
 		HTTPRegister: s.conf.HTTPRegister,
 
+		ARPDB: s.conf.ARPDB,
+
+		OnPoolUsage: s.conf.OnPoolUsage,
+
 		LocalDomainName: s.conf.LocalDomainName,
 
+		PoolAlertThreshold: s.conf.PoolAlertThreshold,
+
 		DataDir:    s.conf.DataDir,
 		dbFilePath: s.conf.dbFilePath,
 	}
@@ -693,12 +856,15 @@ func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 		LeaseDuration: DefaultDHCPLeaseTTL,
 		ICMPTimeout:   DefaultDHCPTimeoutICMP,
 		notify:        s.onNotify,
+		arpDB:         s.conf.ARPDB,
+		conflicts:     s.conflicts,
 	}
 	s.srv4, _ = v4Create(v4conf)
 
 	v6conf := V6ServerConf{
 		LeaseDuration: DefaultDHCPLeaseTTL,
 		notify:        s.onNotify,
+		conflicts:     s.conflicts,
 	}
 	s.srv6, _ = v6Create(v6conf)
 
@@ -10,6 +10,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,11 +22,16 @@ func defaultResponse() *dhcpStatusResponse {
 	conf4.LeaseDuration = 86400
 
 	resp := &dhcpStatusResponse{
-		V4:           *conf4,
-		V6:           V6ServerConf{},
-		Leases:       []*leaseDynamic{},
-		StaticLeases: []*leaseStatic{},
-		Enabled:      true,
+		V4:                *conf4,
+		V6:                V6ServerConf{},
+		Leases:            []*leaseDynamic{},
+		StaticLeases:      []*leaseStatic{},
+		Enabled:           true,
+		Conflicts:         []*conflictJSON{},
+		HostnameConflicts: []*hostnameConflictJSON{},
+		Pools:             []*poolUsageJSON{},
+
+		DelegatedPrefixes: []*delegatedPrefixJSON{},
 	}
 
 	return resp
@@ -51,6 +57,18 @@ func handleLease(t *testing.T, lease *leaseStatic, handler http.HandlerFunc) (w
 	return w
 }
 
+// newTestPoolUsage is a helper that returns the usage of the pool of the
+// default DHCPv4 server with the given number of leased addresses.
+func newTestPoolUsage(leased uint64) (u *poolUsageJSON) {
+	return &poolUsageJSON{
+		PoolUsage: &PoolUsage{
+			Name:   "dhcpv4",
+			Leased: leased,
+			Size:   101,
+		},
+	}
+}
+
 // checkStatus is a helper that asserts the response of
 // [*server.handleDHCPStatus].
 func checkStatus(t *testing.T, s *server, want *dhcpStatusResponse) {
@@ -93,6 +111,7 @@ func TestServer_handleDHCPStatus(t *testing.T) {
 
 	ok := t.Run("status", func(t *testing.T) {
 		resp := defaultResponse()
+		resp.Pools = []*poolUsageJSON{newTestPoolUsage(0)}
 
 		checkStatus(t, s, resp)
 	})
@@ -105,6 +124,9 @@ func TestServer_handleDHCPStatus(t *testing.T) {
 		resp := defaultResponse()
 		resp.StaticLeases = []*leaseStatic{staticLease}
 
+		// The static lease is outside of the dynamic range.
+		resp.Pools = []*poolUsageJSON{newTestPoolUsage(0)}
+
 		checkStatus(t, s, resp)
 	})
 	require.True(t, ok)
@@ -120,6 +142,7 @@ func TestServer_handleDHCPStatus(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 
 		resp := defaultResponse()
+		resp.Pools = []*poolUsageJSON{newTestPoolUsage(0)}
 
 		checkStatus(t, s, resp)
 	})
@@ -192,9 +215,10 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 	}
 
 	testCases := []struct {
-		name  string
-		pos   int
-		lease *leaseStatic
+		name   string
+		pos    int
+		lease  *leaseStatic
+		leased uint64
 	}{{
 		name: "update_v4_name",
 		pos:  leaseV4Pos,
@@ -203,6 +227,7 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 			IP:       leaseV4IP,
 			Hostname: "updated-client-v4",
 		},
+		leased: 0,
 	}, {
 		name: "update_v4_ip",
 		pos:  leaseV4Pos,
@@ -211,6 +236,7 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 			IP:       netip.MustParseAddr("192.168.10.200"),
 			Hostname: "updated-client-v4",
 		},
+		leased: 1,
 	}, {
 		name: "update_v6_name",
 		pos:  leaseV6Pos,
@@ -219,6 +245,7 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 			IP:       leaseV6IP,
 			Hostname: "updated-client-v6",
 		},
+		leased: 1,
 	}, {
 		name: "update_v6_ip",
 		pos:  leaseV6Pos,
@@ -227,6 +254,7 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 			IP:       netip.MustParseAddr("2001::666"),
 			Hostname: "updated-client-v6",
 		},
+		leased: 1,
 	}}
 
 	for _, tc := range testCases {
@@ -237,6 +265,7 @@ func TestServer_HandleUpdateStaticLease(t *testing.T) {
 			resp := defaultResponse()
 			leases[tc.pos] = tc.lease
 			resp.StaticLeases = leases
+			resp.Pools = []*poolUsageJSON{newTestPoolUsage(tc.leased)}
 
 			checkStatus(t, s, resp)
 		})
@@ -317,3 +346,88 @@ func TestServer_HandleUpdateStaticLease_validation(t *testing.T) {
 		})
 	}
 }
+
+func TestLeaseStatic_toLease(t *testing.T) {
+	const (
+		duidStr = "00:03:00:01:aa:bb:cc:dd:ee:ff"
+		macStr  = "aa:bb:cc:dd:ee:ff"
+	)
+
+	var (
+		ip4 = netip.MustParseAddr("192.168.10.10")
+		ip6 = netip.MustParseAddr("2001::1")
+
+		duid = []byte{0x00, 0x03, 0x00, 0x01, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	)
+
+	testCases := []struct {
+		lease      *leaseStatic
+		name       string
+		wantErrMsg string
+		wantDUID   []byte
+		wantIAID   uint32
+	}{{
+		name: "duid_only",
+		lease: &leaseStatic{
+			DUID: duidStr,
+			IAID: 1,
+			IP:   ip6,
+		},
+		wantErrMsg: "",
+		wantDUID:   duid,
+		wantIAID:   1,
+	}, {
+		name: "duid_hyphens",
+		lease: &leaseStatic{
+			HWAddr: macStr,
+			DUID:   "00-03-00-01-aa-bb-cc-dd-ee-ff",
+			IP:     ip6,
+		},
+		wantErrMsg: "",
+		wantDUID:   duid,
+		wantIAID:   0,
+	}, {
+		name: "duid_v4",
+		lease: &leaseStatic{
+			HWAddr: macStr,
+			DUID:   duidStr,
+			IP:     ip4,
+		},
+		wantErrMsg: "duid is only supported for ipv6 leases",
+	}, {
+		name: "iaid_without_duid",
+		lease: &leaseStatic{
+			HWAddr: macStr,
+			IAID:   1,
+			IP:     ip6,
+		},
+		wantErrMsg: "iaid requires duid",
+	}, {
+		name: "short_duid",
+		lease: &leaseStatic{
+			DUID: "00:03",
+			IP:   ip6,
+		},
+		wantErrMsg: `bad duid "00:03": length must be between 3 and 130, got 2`,
+	}, {
+		name: "no_identity",
+		lease: &leaseStatic{
+			IP: ip6,
+		},
+		wantErrMsg: "couldn't parse MAC address: invalid MAC address",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := tc.lease.toLease()
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			assert.Equal(t, tc.wantDUID, l.DUID)
+			assert.Equal(t, tc.wantIAID, l.IAID)
+			assert.Equal(t, duidStr, formatDUID(l.DUID))
+		})
+	}
+}
@@ -147,3 +147,15 @@ func TestIPRange_Offset(t *testing.T) {
 		})
 	}
 }
+
+func TestIPRange_size(t *testing.T) {
+	r, err := newIPRange(net.IP{0, 0, 0, 1}, net.IP{0, 0, 0, 5})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(5), r.size())
+
+	r, err = newIPRange(net.IP{0, 0, 0, 1}, net.IP{0, 0, 1, 0})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(256), r.size())
+}
@@ -0,0 +1,178 @@
+package dhcpd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// DefaultPoolAlertThreshold is the default occupancy of an address pool in
+// percents, exceeding which raises an alert.
+const DefaultPoolAlertThreshold = 90
+
+// PoolUsage is the usage of the address pool of a DHCP server.
+type PoolUsage struct {
+	// Name is the name of the pool, either "dhcpv4" or "dhcpv6".
+	Name string `json:"name"`
+
+	// Leased is the number of the addresses in the pool which are leased,
+	// including the static leases, or quarantined.
+	Leased uint64 `json:"leased"`
+
+	// Size is the total number of the addresses in the pool.
+	Size uint64 `json:"size"`
+}
+
+// percent returns the occupancy of the pool in percents.
+func (u *PoolUsage) percent() (pct uint64) {
+	if u.Size == 0 {
+		return 0
+	}
+
+	return u.Leased * 100 / u.Size
+}
+
+// poolAlerts keeps the state of the alerts about the address pools exceeding
+// the occupancy threshold.  It's safe for concurrent use.
+type poolAlerts struct {
+	// mu protects active.
+	mu *sync.Mutex
+
+	// active is the set of names of the pools exceeding the threshold.
+	active map[string]struct{}
+}
+
+// newPoolAlerts returns a new properly initialized *poolAlerts.
+func newPoolAlerts() (a *poolAlerts) {
+	return &poolAlerts{
+		mu:     &sync.Mutex{},
+		active: map[string]struct{}{},
+	}
+}
+
+// check raises the alert about u if it exceeds threshold, and clears it once u
+// is back below threshold.  Each of those is logged once.  threshold is in
+// percents, zero disables the alerts.
+func (a *poolAlerts) check(u *PoolUsage, threshold uint8) {
+	exceeds := threshold > 0 && u.percent() >= uint64(threshold)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, alerted := a.active[u.Name]
+	if exceeds == alerted {
+		return
+	}
+
+	if exceeds {
+		a.active[u.Name] = struct{}{}
+		log.Info(
+			"dhcpd: warning: pool %s is %d%% full, %d of %d addresses are in use, threshold is %d%%",
+			u.Name,
+			u.percent(),
+			u.Leased,
+			u.Size,
+			threshold,
+		)
+	} else {
+		delete(a.active, u.Name)
+		log.Info("dhcpd: pool %s is %d%% full, back below the threshold", u.Name, u.percent())
+	}
+}
+
+// isActive returns true if the alert about the pool with name is raised.
+func (a *poolAlerts) isActive(name string) (ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, ok = a.active[name]
+
+	return ok
+}
+
+// poolUsageInterval is the interval between the periodic updates of the usage
+// of the address pools, which account for the expired dynamic leases.
+const poolUsageInterval = 1 * time.Minute
+
+// schedulePoolUsage requests the update of the usage of the address pools from
+// the goroutine started by [server.startPoolUsage].  It's safe to call it within
+// the locked sections of the servers.
+func (s *server) schedulePoolUsage() {
+	select {
+	case s.poolUsageReqs <- struct{}{}:
+	default:
+		// The update is already requested.
+	}
+}
+
+// startPoolUsage starts the goroutine updating the usage of the address pools
+// on requests and periodically.
+func (s *server) startPoolUsage() {
+	s.poolUsageStop = make(chan struct{})
+	s.poolUsageDone = make(chan struct{})
+
+	go s.updatePoolUsageLoop(s.poolUsageStop, s.poolUsageDone)
+}
+
+// stopPoolUsage stops the goroutine started by [server.startPoolUsage] and
+// waits for it to exit.  It does nothing if the goroutine isn't running.
+func (s *server) stopPoolUsage() {
+	if s.poolUsageStop == nil {
+		return
+	}
+
+	close(s.poolUsageStop)
+	<-s.poolUsageDone
+
+	s.poolUsageStop, s.poolUsageDone = nil, nil
+}
+
+// updatePoolUsageLoop updates the usage of the address pools until stop is
+// closed, then closes done.  It's intended to be used as a goroutine.
+func (s *server) updatePoolUsageLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	defer log.OnPanic("dhcpd: updating pool usage")
+
+	ticker := time.NewTicker(poolUsageInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.poolUsageReqs:
+		case <-ticker.C:
+		}
+
+		s.updatePoolUsage()
+	}
+}
+
+// updatePoolUsage reports the usage of the address pools of the enabled servers
+// and checks it against the alert threshold.  It must be called outside of the
+// locked sections of the servers.
+func (s *server) updatePoolUsage() {
+	for _, u := range s.poolUsage() {
+		if s.conf.OnPoolUsage != nil {
+			s.conf.OnPoolUsage(u)
+		}
+
+		s.poolAlerts.check(u, s.conf.PoolAlertThreshold)
+	}
+}
+
+// poolUsage returns the usage of the address pools of the enabled servers.
+func (s *server) poolUsage() (usage []*PoolUsage) {
+	for _, srv := range []DHCPServer{s.srv4, s.srv6} {
+		if srv == nil {
+			continue
+		}
+
+		if u := srv.poolUsage(); u != nil {
+			usage = append(usage, u)
+		}
+	}
+
+	return usage
+}
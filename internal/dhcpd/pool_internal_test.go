@@ -0,0 +1,65 @@
+package dhcpd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolAlerts_check(t *testing.T) {
+	const (
+		poolName  = "dhcpv4"
+		threshold = 90
+	)
+
+	a := newPoolAlerts()
+
+	testCases := []struct {
+		name      string
+		leased    uint64
+		threshold uint8
+		want      bool
+	}{{
+		name:      "below",
+		leased:    89,
+		threshold: threshold,
+		want:      false,
+	}, {
+		name:      "exceeds",
+		leased:    90,
+		threshold: threshold,
+		want:      true,
+	}, {
+		name:      "still_exceeds",
+		leased:    100,
+		threshold: threshold,
+		want:      true,
+	}, {
+		name:      "disabled",
+		leased:    100,
+		threshold: 0,
+		want:      false,
+	}, {
+		name:      "exceeds_again",
+		leased:    95,
+		threshold: threshold,
+		want:      true,
+	}, {
+		name:      "back_below",
+		leased:    10,
+		threshold: threshold,
+		want:      false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a.check(&PoolUsage{
+				Name:   poolName,
+				Leased: tc.leased,
+				Size:   100,
+			}, tc.threshold)
+
+			assert.Equal(t, tc.want, a.isActive(poolName))
+		})
+	}
+}
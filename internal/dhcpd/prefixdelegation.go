@@ -0,0 +1,68 @@
+package dhcpd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+// maxDelegatedPrefixBits is the maximum difference between the lengths of the
+// delegated prefixes and of their pool, which limits the size of the pool to
+// 65536 prefixes.
+const maxDelegatedPrefixBits = 16
+
+// maxDelegatedPrefixLen is the maximum length of a delegated prefix, since the
+// downstream links must be at least /64 for SLAAC to work.
+const maxDelegatedPrefixLen = 64
+
+// validateDelegatedPrefix returns an error if the pool and the length of the
+// delegated prefixes aren't valid.  The invalid pool means that the prefix
+// delegation is disabled.
+func validateDelegatedPrefix(pool netip.Prefix, l int) (err error) {
+	if !pool.IsValid() {
+		return nil
+	}
+
+	switch {
+	case !pool.Addr().Is6() || pool.Addr().Is4In6():
+		return fmt.Errorf("delegated_prefix: %s is not an ipv6 prefix", pool)
+	case l <= pool.Bits() || l > maxDelegatedPrefixLen:
+		return fmt.Errorf(
+			"delegated_prefix_len: %d must be within (%d, %d]",
+			l,
+			pool.Bits(),
+			maxDelegatedPrefixLen,
+		)
+	case l-pool.Bits() > maxDelegatedPrefixBits:
+		return fmt.Errorf(
+			"delegated_prefix_len: %d is longer than the pool length by more than %d",
+			l,
+			maxDelegatedPrefixBits,
+		)
+	default:
+		return nil
+	}
+}
+
+// delegatedPrefixesNum returns the number of the prefixes with length l in the
+// pool.  pool and l must be valid.
+func delegatedPrefixesNum(pool netip.Prefix, l int) (n uint64) {
+	return 1 << (l - pool.Bits())
+}
+
+// nthDelegatedPrefix returns the n-th prefix with length l in the pool.  pool
+// and l must be valid and n must be less than [delegatedPrefixesNum].
+func nthDelegatedPrefix(pool netip.Prefix, l int, n uint64) (p netip.Prefix) {
+	addr := pool.Masked().Addr().As16()
+	hi := binary.BigEndian.Uint64(addr[:8])
+	hi |= n << (maxDelegatedPrefixLen - l)
+	binary.BigEndian.PutUint64(addr[:8], hi)
+
+	return netip.PrefixFrom(netip.AddrFrom16(addr), l)
+}
+
+// isDelegatedPrefix returns true if p is a prefix with length l within the
+// pool.
+func isDelegatedPrefix(pool netip.Prefix, l int, p netip.Prefix) (ok bool) {
+	return pool.IsValid() && p.Bits() == l && pool.Contains(p.Addr()) && p.Masked() == p
+}
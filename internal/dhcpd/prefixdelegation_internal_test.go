@@ -0,0 +1,96 @@
+package dhcpd
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDelegatedPrefix(t *testing.T) {
+	testCases := []struct {
+		pool       netip.Prefix
+		name       string
+		wantErrMsg string
+		l          int
+	}{{
+		pool:       netip.Prefix{},
+		name:       "disabled",
+		wantErrMsg: "",
+		l:          0,
+	}, {
+		pool:       netip.MustParsePrefix("2001:db8::/48"),
+		name:       "valid",
+		wantErrMsg: "",
+		l:          56,
+	}, {
+		pool:       netip.MustParsePrefix("192.168.0.0/16"),
+		name:       "ipv4",
+		wantErrMsg: "delegated_prefix: 192.168.0.0/16 is not an ipv6 prefix",
+		l:          24,
+	}, {
+		pool:       netip.MustParsePrefix("2001:db8::/48"),
+		name:       "too_short",
+		wantErrMsg: "delegated_prefix_len: 48 must be within (48, 64]",
+		l:          48,
+	}, {
+		pool:       netip.MustParsePrefix("2001:db8::/48"),
+		name:       "too_long",
+		wantErrMsg: "delegated_prefix_len: 72 must be within (48, 64]",
+		l:          72,
+	}, {
+		pool:       netip.MustParsePrefix("2001:db8::/32"),
+		name:       "too_many",
+		wantErrMsg: "delegated_prefix_len: 64 is longer than the pool length by more than 16",
+		l:          64,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDelegatedPrefix(tc.pool, tc.l)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestNthDelegatedPrefix(t *testing.T) {
+	pool := netip.MustParsePrefix("2001:db8:1::/48")
+
+	assert.Equal(t, uint64(256), delegatedPrefixesNum(pool, 56))
+
+	testCases := []struct {
+		want netip.Prefix
+		name string
+		n    uint64
+	}{{
+		want: netip.MustParsePrefix("2001:db8:1::/56"),
+		name: "first",
+		n:    0,
+	}, {
+		want: netip.MustParsePrefix("2001:db8:1:100::/56"),
+		name: "second",
+		n:    1,
+	}, {
+		want: netip.MustParsePrefix("2001:db8:1:ff00::/56"),
+		name: "last",
+		n:    255,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := nthDelegatedPrefix(pool, 56, tc.n)
+			assert.Equal(t, tc.want, p)
+			assert.True(t, isDelegatedPrefix(pool, 56, p))
+		})
+	}
+}
+
+func TestIsDelegatedPrefix(t *testing.T) {
+	pool := netip.MustParsePrefix("2001:db8:1::/48")
+
+	assert.False(t, isDelegatedPrefix(pool, 56, netip.MustParsePrefix("2001:db8:2::/56")))
+	assert.False(t, isDelegatedPrefix(pool, 56, netip.MustParsePrefix("2001:db8:1::/64")))
+	assert.False(t, isDelegatedPrefix(pool, 56, netip.MustParsePrefix("2001:db8:1::1/56")))
+	assert.False(t, isDelegatedPrefix(netip.Prefix{}, 56, netip.MustParsePrefix("2001:db8:1::/56")))
+}
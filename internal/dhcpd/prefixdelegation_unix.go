@@ -0,0 +1,212 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// pdEnabled returns true if the prefix delegation is enabled.
+func (s *v6Server) pdEnabled() (ok bool) {
+	return s.conf.DelegatedPrefix.IsValid()
+}
+
+// isValidPrefixLease returns true if the stored prefix lease l may be used with
+// the current configuration.
+func (s *v6Server) isValidPrefixLease(l *dhcpsvc.Lease) (ok bool) {
+	return isDelegatedPrefix(s.conf.DelegatedPrefix, s.conf.DelegatedPrefixLen, l.Prefix)
+}
+
+// delegatedPrefixes implements the [DHCPServer] interface for *v6Server.
+func (s *v6Server) delegatedPrefixes() (leases []*dhcpsvc.Lease) {
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	now := time.Now()
+	for _, l := range s.prefixLeases {
+		if l.Expiry.After(now) {
+			leases = append(leases, l.Clone())
+		}
+	}
+
+	return leases
+}
+
+// findPrefixLease returns the prefix lease of the identity association for
+// prefix delegation with iaid of the client with duid, if any.
+// s.leasesLock is expected to be locked.
+func (s *v6Server) findPrefixLease(duid []byte, iaid uint32) (l *dhcpsvc.Lease) {
+	for _, pl := range s.prefixLeases {
+		if pl.IAID == iaid && bytes.Equal(pl.DUID, duid) {
+			return pl
+		}
+	}
+
+	return nil
+}
+
+// reservePrefixLease reserves a prefix lease for the identity association for
+// prefix delegation with iaid of the client with ia.  It returns nil if the
+// pool is exhausted.  s.leasesLock is expected to be locked.
+func (s *v6Server) reservePrefixLease(ia *clientIA, iaid uint32) (l *dhcpsvc.Lease) {
+	pool, prefLen := s.conf.DelegatedPrefix, s.conf.DelegatedPrefixLen
+
+	used := make(map[netip.Prefix]struct{}, len(s.prefixLeases))
+	for _, pl := range s.prefixLeases {
+		used[pl.Prefix] = struct{}{}
+	}
+
+	for n := range delegatedPrefixesNum(pool, prefLen) {
+		p := nthDelegatedPrefix(pool, prefLen, n)
+		if _, ok := used[p]; ok {
+			continue
+		}
+
+		l = &dhcpsvc.Lease{
+			IP:     p.Addr(),
+			Prefix: p,
+			HWAddr: slices.Clone(ia.mac),
+			DUID:   slices.Clone(ia.duid),
+			IAID:   iaid,
+		}
+		s.prefixLeases = append(s.prefixLeases, l)
+
+		return l
+	}
+
+	now := time.Now()
+	for _, pl := range s.prefixLeases {
+		if !pl.Expiry.After(now) {
+			pl.HWAddr, pl.DUID, pl.IAID = slices.Clone(ia.mac), slices.Clone(ia.duid), iaid
+
+			return pl
+		}
+	}
+
+	return nil
+}
+
+// processPD handles the IA_PD options of msg from the client with ia, if the
+// prefix delegation is enabled, and adds the resulting ones to resp.  pdOnly
+// is true if msg contains IA_PD options but no IA_NA ones, so that the
+// addresses shouldn't be handled.
+func (s *v6Server) processPD(msg *dhcpv6.Message, ia *clientIA, resp dhcpv6.DHCPv6) (pdOnly bool) {
+	iapds := msg.Options.IAPD()
+	if !s.pdEnabled() || len(iapds) == 0 {
+		return false
+	}
+
+	switch mt := msg.Type(); mt {
+	case
+		dhcpv6.MessageTypeSolicit,
+		dhcpv6.MessageTypeRequest,
+		dhcpv6.MessageTypeRenew,
+		dhcpv6.MessageTypeRebind,
+		dhcpv6.MessageTypeRelease:
+		// Go on.
+	default:
+		// Confirm and Decline messages only apply to addresses, see RFC 8415
+		// Sections 18.3.3 and 18.3.8.
+		return false
+	}
+
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	changed := false
+	for _, iapd := range iapds {
+		riapd, c := s.processIAPD(msg.Type(), ia, iapd)
+		changed = changed || c
+		if riapd != nil {
+			resp.AddOption(riapd)
+		}
+	}
+
+	if changed {
+		s.conf.notify(LeaseChangedDBStore)
+	}
+
+	return len(msg.Options.IANA()) == 0
+}
+
+// processIAPD handles a single IA_PD option of the message with type mt from
+// the client with ia and returns the option for the response, if any.  changed
+// is true if the stored leases have changed.  s.leasesLock is expected to be
+// locked.
+func (s *v6Server) processIAPD(
+	mt dhcpv6.MessageType,
+	ia *clientIA,
+	iapd *dhcpv6.OptIAPD,
+) (resp *dhcpv6.OptIAPD, changed bool) {
+	iaid := binary.BigEndian.Uint32(iapd.IaId[:])
+	l := s.findPrefixLease(ia.duid, iaid)
+	resp = &dhcpv6.OptIAPD{
+		IaId: iapd.IaId,
+	}
+
+	switch mt {
+	case dhcpv6.MessageTypeRelease:
+		if l == nil {
+			return nil, false
+		}
+
+		s.prefixLeases = slices.DeleteFunc(s.prefixLeases, func(pl *dhcpsvc.Lease) (ok bool) {
+			return pl == l
+		})
+		log.Debug("dhcpv6: released prefix %s of %s", l.Prefix, formatIA(ia.duid, iaid))
+
+		return nil, true
+	case dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest:
+		if l == nil {
+			l = s.reservePrefixLease(ia, iaid)
+		}
+
+		if l == nil {
+			resp.Options.Add(&dhcpv6.OptStatusCode{
+				StatusCode:    iana.StatusNoPrefixAvail,
+				StatusMessage: "no prefixes available",
+			})
+
+			return resp, false
+		}
+	default:
+		if l == nil {
+			resp.Options.Add(&dhcpv6.OptStatusCode{
+				StatusCode:    iana.StatusNoBinding,
+				StatusMessage: "no binding",
+			})
+
+			return resp, false
+		}
+	}
+
+	lifetime := s.conf.leaseTime
+	if mt != dhcpv6.MessageTypeSolicit {
+		l.Expiry = time.Now().Add(lifetime)
+		changed = true
+		log.Debug("dhcpv6: delegated prefix %s to %s", l.Prefix, formatIA(ia.duid, iaid))
+	}
+
+	resp.T1 = lifetime / 2
+	resp.T2 = time.Duration(float32(lifetime) / 1.5)
+	resp.Options.Add(&dhcpv6.OptIAPrefix{
+		PreferredLifetime: lifetime,
+		ValidLifetime:     lifetime,
+		Prefix: &net.IPNet{
+			IP:   l.Prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(l.Prefix.Bits(), net.IPv6len*8),
+		},
+	})
+
+	return resp, changed
+}
@@ -29,6 +29,8 @@ func (winServer) Start() (err error)                                   { return
 func (winServer) Stop() (err error)                                    { return nil }
 func (winServer) HostByIP(_ netip.Addr) (host string)                  { return "" }
 func (winServer) IPByHost(_ string) (ip netip.Addr)                    { return netip.Addr{} }
+func (winServer) poolUsage() (u *PoolUsage)                            { return nil }
+func (winServer) delegatedPrefixes() (leases []*dhcpsvc.Lease)         { return nil }
 
 func v4Create(_ *V4ServerConf) (s DHCPServer, err error) { return winServer{}, nil }
 func v6Create(_ V6ServerConf) (s DHCPServer, err error)  { return winServer{}, nil }
@@ -157,9 +157,21 @@ func (s *v4Server) ResetLeases(leases []*dhcpsvc.Lease) (err error) {
 	s.ipIndex = make(map[netip.Addr]*dhcpsvc.Lease, len(leases))
 	s.leases = nil
 
+	// Collect the hostnames of the static leases first, since they are chosen
+	// by the user and the dynamic leases may need to be renamed.
+	statics := map[string]*dhcpsvc.Lease{}
+	for _, l := range leases {
+		if l.IsStatic && l.Hostname != "" {
+			statics[l.Hostname] = l
+		}
+	}
+
 	for _, l := range leases {
 		if !l.IsStatic {
 			l.Hostname = s.validHostnameForClient(l.Hostname, l.IP)
+			if l.Hostname != "" {
+				l.Hostname = s.assignHostname(l, l.Hostname, statics)
+			}
 		}
 		err = s.addLease(l)
 		if err != nil {
@@ -173,26 +185,105 @@ func (s *v4Server) ResetLeases(leases []*dhcpsvc.Lease) (err error) {
 	return nil
 }
 
+// leaseOwnerOf returns the description of the lease other than l using host,
+// if any.  statics are the static leases by their hostnames, which may not be
+// added yet.  statics may be nil.  s.leasesLock is expected to be locked.
+func (s *v4Server) leaseOwnerOf(
+	host string,
+	l *dhcpsvc.Lease,
+	statics map[string]*dhcpsvc.Lease,
+) (owner string) {
+	dup, ok := s.hostsIndex[host]
+	if !ok {
+		dup, ok = statics[host]
+	}
+
+	if !ok || dup == l || bytes.Equal(dup.HWAddr, l.HWAddr) {
+		return ""
+	} else if dup.IsStatic {
+		return fmt.Sprintf("static lease for %s", dup.HWAddr)
+	}
+
+	return fmt.Sprintf("lease for %s", dup.HWAddr)
+}
+
+// assignHostname returns the hostname for the dynamic lease l with the valid
+// requested hostname.  If requested is already used within the local domain,
+// the result has a numeric suffix and the conflict is reported, unless l has
+// already got the same hostname before.  statics are described in
+// [v4Server.leaseOwnerOf].  s.leasesLock is expected to be locked.
+func (s *v4Server) assignHostname(
+	l *dhcpsvc.Lease,
+	requested string,
+	statics map[string]*dhcpsvc.Lease,
+) (hostname string) {
+	leaseOwner := func(h string) (owner string) { return s.leaseOwnerOf(h, l, statics) }
+	hostname, owner := s.conf.hostnames.unique(requested, l.IP, leaseOwner)
+	if owner == "" {
+		return hostname
+	}
+
+	if hostname == "" {
+		hostname = aghnet.GenerateHostname(l.IP)
+		if s.conf.hostnames.usedBy(hostname, l.IP, leaseOwner) != "" {
+			hostname = ""
+		}
+	}
+
+	if hostname != l.Hostname {
+		s.conf.hostnames.report(&hostnameConflict{
+			Time:      time.Now(),
+			IP:        l.IP,
+			HWAddr:    slices.Clone(l.HWAddr),
+			Requested: requested,
+			Assigned:  hostname,
+			Owner:     owner,
+		})
+	}
+
+	return hostname
+}
+
 // getLeasesRef returns the actual leases slice.  For internal use only.
 func (s *v4Server) getLeasesRef() []*dhcpsvc.Lease {
 	return s.leases
 }
 
-// isBlocklisted returns true if this lease holds a blocklisted IP.
-//
-// TODO(a.garipov): Make a method of *Lease?
-func (s *v4Server) isBlocklisted(l *dhcpsvc.Lease) (ok bool) {
-	if len(l.HWAddr) == 0 {
-		return false
+// delegatedPrefixes implements the [DHCPServer] interface for *v4Server.  The
+// prefix delegation is only supported by DHCPv6, so it always returns nil.
+func (s *v4Server) delegatedPrefixes() (leases []*dhcpsvc.Lease) {
+	return nil
+}
+
+// poolUsage implements the [DHCPServer] interface for *v4Server.
+func (s *v4Server) poolUsage() (u *PoolUsage) {
+	if !s.enabled() || s.conf.ipRange == nil {
+		return nil
 	}
 
-	for _, b := range l.HWAddr {
-		if b != 0 {
-			return false
+	u = &PoolUsage{
+		Name: "dhcpv4",
+		Size: s.conf.ipRange.size(),
+	}
+
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	now := time.Now()
+	for _, l := range s.leases {
+		if (l.IsStatic || l.Expiry.After(now)) && s.conf.ipRange.contains(l.IP.AsSlice()) {
+			u.Leased++
 		}
 	}
 
-	return true
+	return u
+}
+
+// isBlocklisted returns true if this lease holds a blocklisted IP.
+//
+// TODO(a.garipov): Make a method of *Lease?
+func (s *v4Server) isBlocklisted(l *dhcpsvc.Lease) (ok bool) {
+	return isZeroHWAddr(l.HWAddr)
 }
 
 // GetLeases returns the list of current DHCP leases.  It is safe for concurrent
@@ -492,6 +583,10 @@ func (s *v4Server) validateStaticLease(l *dhcpsvc.Lease) (err error) {
 		return ErrDupHostname
 	}
 
+	if owner := s.conf.hostnames.ownerOf(hostname, l.IP); owner != "" {
+		return fmt.Errorf("hostname %q is used by %s", hostname, owner)
+	}
+
 	dup, ok = s.ipIndex[l.IP]
 	if ok && !bytes.Equal(dup.HWAddr, l.HWAddr) {
 		return ErrDupIP
@@ -561,29 +656,58 @@ func (s *v4Server) RemoveStaticLease(l *dhcpsvc.Lease) (err error) {
 	return s.rmLease(l)
 }
 
-// addrAvailable sends an ICP request to the specified IP address.  It returns
-// true if the remote host doesn't reply, which probably means that the IP
-// address is available.
-//
-// TODO(a.garipov): I'm not sure that this is the best way to do this.
-func (s *v4Server) addrAvailable(target net.IP) (avail bool) {
+// addrAvailable probes the specified IP address before offering it to the
+// client with mac.  It returns true if no other device seems to use the
+// address.  The detected conflicts are added to the conflict log.
+func (s *v4Server) addrAvailable(target netip.Addr, mac net.HardwareAddr) (avail bool) {
 	if s.conf.ICMPTimeout == 0 {
 		return true
 	}
 
+	if s.sendEcho(net.IP(target.AsSlice())) {
+		s.conf.conflicts.add(&conflict{
+			Time:   time.Now(),
+			IP:     target,
+			Source: conflictSourceICMP,
+		})
+
+		return false
+	}
+
+	if usedBy := s.neighborHWAddr(target, mac); usedBy != nil {
+		s.conf.conflicts.add(&conflict{
+			Time:   time.Now(),
+			IP:     target,
+			HWAddr: usedBy,
+			Source: conflictSourceARP,
+		})
+
+		return false
+	}
+
+	log.Debug("dhcpv4: probing is complete: %s is available", target)
+
+	return true
+}
+
+// sendEcho sends an ICMP echo request to the specified IP address.  It returns
+// true if the remote host replies, which means that the IP address is already
+// in use.
+//
+// TODO(a.garipov): I'm not sure that this is the best way to do this.
+func (s *v4Server) sendEcho(target net.IP) (replied bool) {
 	pinger, err := ping.NewPinger(target.String())
 	if err != nil {
 		log.Error("dhcpv4: ping.NewPinger(): %s", err)
 
-		return true
+		return false
 	}
 
 	pinger.SetPrivileged(true)
 	pinger.Timeout = time.Duration(s.conf.ICMPTimeout) * time.Millisecond
 	pinger.Count = 1
-	reply := false
 	pinger.OnRecv = func(_ *ping.Packet) {
-		reply = true
+		replied = true
 	}
 
 	log.Debug("dhcpv4: sending icmp echo to %s", target)
@@ -592,18 +716,35 @@ func (s *v4Server) addrAvailable(target net.IP) (avail bool) {
 	if err != nil {
 		log.Error("dhcpv4: pinger.Run(): %s", err)
 
-		return true
+		return false
 	}
 
-	if reply {
-		log.Info("dhcpv4: ip conflict: %s is already used by another device", target)
+	return replied
+}
 
-		return false
+// neighborHWAddr returns the hardware address which target is resolved into in
+// the neighbor table, unless it's mac or target is unresolved.  The ICMP echo
+// request sent before makes the system resolve target, so this also catches
+// the devices which don't reply to ICMP.
+func (s *v4Server) neighborHWAddr(target netip.Addr, mac net.HardwareAddr) (usedBy net.HardwareAddr) {
+	if s.conf.arpDB == nil {
+		return nil
 	}
 
-	log.Debug("dhcpv4: icmp procedure is complete: %q", target)
+	err := s.conf.arpDB.Refresh()
+	if err != nil {
+		log.Debug("dhcpv4: refreshing arp db: %s", err)
 
-	return true
+		return nil
+	}
+
+	for _, n := range s.conf.arpDB.Neighbors() {
+		if n.IP == target && !isZeroHWAddr(n.MAC) && !bytes.Equal(n.MAC, mac) {
+			return n.MAC
+		}
+	}
+
+	return nil
 }
 
 // findLease finds a lease by its MAC-address.
@@ -683,21 +824,12 @@ func (s *v4Server) reserveLease(mac net.HardwareAddr) (l *dhcpsvc.Lease, err err
 func (s *v4Server) commitLease(l *dhcpsvc.Lease, hostname string) {
 	prev := l.Hostname
 	hostname = s.validHostnameForClient(hostname, l.IP)
-
-	if _, ok := s.hostsIndex[hostname]; ok {
-		log.Info("dhcpv4: hostname %q already exists", hostname)
-
-		if prev == "" {
-			// The lease is just allocated due to DHCPDISCOVER.
-			hostname = aghnet.GenerateHostname(l.IP)
-		} else {
-			hostname = prev
-		}
-	}
-	if l.Hostname != hostname {
-		l.Hostname = hostname
+	if hostname != "" {
+		hostname = s.assignHostname(l, hostname, nil)
 	}
 
+	l.Hostname = hostname
+
 	l.Expiry = time.Now().Add(s.conf.leaseTime)
 	if prev != "" && prev != l.Hostname {
 		delete(s.hostsIndex, prev)
@@ -719,8 +851,7 @@ func (s *v4Server) allocateLease(mac net.HardwareAddr) (l *dhcpsvc.Lease, err er
 			return nil, nil
 		}
 
-		leaseIP := l.IP.AsSlice()
-		if s.addrAvailable(leaseIP) {
+		if s.addrAvailable(l.IP, mac) {
 			return l, nil
 		}
 
@@ -1013,11 +1144,21 @@ func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 		return nil
 	}
 
-	err = s.rmDynamicLease(oldLease)
-	if err != nil {
-		return fmt.Errorf("removing old lease for %s: %w", mac, err)
+	if oldLease.IsStatic {
+		return fmt.Errorf("declined static lease %s for %s", reqIP, mac)
 	}
 
+	// Quarantine the declined address, since the client has detected that
+	// it's already in use by another device.
+	hostname := oldLease.Hostname
+	delete(s.hostsIndex, hostname)
+	s.blocklistLease(oldLease)
+	s.conf.conflicts.add(&conflict{
+		Time:   time.Now(),
+		IP:     oldLease.IP,
+		Source: conflictSourceDecline,
+	})
+
 	newLease, err := s.allocateLease(mac)
 	if err != nil {
 		return fmt.Errorf("allocating new lease for %s: %w", mac, err)
@@ -1030,7 +1171,7 @@ func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 		return nil
 	}
 
-	newLease.Hostname = oldLease.Hostname
+	newLease.Hostname = hostname
 	newLease.Expiry = time.Now().Add(s.conf.leaseTime)
 
 	err = s.addLease(newLease)
@@ -1423,6 +1564,14 @@ func v4Create(conf *V4ServerConf) (srv *v4Server, err error) {
 
 	s.conf = &V4ServerConf{}
 	*s.conf = *conf
+	if s.conf.conflicts == nil {
+		s.conf.conflicts = newConflictLog()
+	}
+
+	if s.conf.hostnames == nil {
+		// Don't check the error, since there are no reserved hostnames.
+		s.conf.hostnames, _ = newHostnamePolicy(nil, nil)
+	}
 
 	// TODO(a.garipov, d.seregin): Check that every lease is inside the IPRange.
 	s.leasedOffsets = newBitSet()
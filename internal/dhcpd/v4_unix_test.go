@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -160,11 +161,13 @@ func TestV4Server_leasing(t *testing.T) {
 			res := s4.handle(req, resp)
 			require.Positive(t, res)
 
-			var netIP netip.Addr
-			netIP, ok = netip.AddrFromSlice(resp.YourIPAddr)
-			require.True(t, ok)
+			assert.Equal(t, staticName+"-2", resp.HostName())
 
-			assert.Equal(t, aghnet.GenerateHostname(netIP), resp.HostName())
+			conflicts := s4.conf.hostnames.conflicts.list()
+			require.Len(t, conflicts, 1)
+
+			assert.Equal(t, staticName, conflicts[0].Requested)
+			assert.Equal(t, staticName+"-2", conflicts[0].Assigned)
 		})
 
 		t.Run("same_mac", func(t *testing.T) {
@@ -872,6 +875,98 @@ func TestV4Server_handleDecline(t *testing.T) {
 	}
 
 	require.Equal(t, wantResp, resp)
+
+	conflicts := s4.conf.conflicts.list()
+	require.Len(t, conflicts, 1)
+
+	assert.Equal(t, dynamicIP, conflicts[0].IP)
+	assert.Equal(t, conflictSourceDecline, conflicts[0].Source)
+
+	i := slices.IndexFunc(s4.leases, func(l *dhcpsvc.Lease) (ok bool) {
+		return l.IP == dynamicIP
+	})
+	require.NotEqual(t, -1, i)
+
+	assert.True(t, s4.isBlocklisted(s4.leases[i]))
+}
+
+// testARPDB is a mock implementation of the [arpdb.Interface].
+type testARPDB struct {
+	onRefresh   func() (err error)
+	onNeighbors func() (ns []arpdb.Neighbor)
+}
+
+// type check
+var _ arpdb.Interface = (*testARPDB)(nil)
+
+// Refresh implements the [arpdb.Interface] interface for *testARPDB.
+func (db *testARPDB) Refresh() (err error) {
+	return db.onRefresh()
+}
+
+// Neighbors implements the [arpdb.Interface] interface for *testARPDB.
+func (db *testARPDB) Neighbors() (ns []arpdb.Neighbor) {
+	return db.onNeighbors()
+}
+
+func TestV4Server_neighborHWAddr(t *testing.T) {
+	var (
+		usedIP     = netip.MustParseAddr("192.168.10.150")
+		unusedIP   = netip.MustParseAddr("192.168.10.151")
+		unresolved = netip.MustParseAddr("192.168.10.152")
+		clientMAC  = net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+		otherMAC   = net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+	)
+
+	conf := defaultV4ServerConf()
+	conf.arpDB = &testARPDB{
+		onRefresh: func() (err error) { return nil },
+		onNeighbors: func() (ns []arpdb.Neighbor) {
+			return []arpdb.Neighbor{{
+				IP:  usedIP,
+				MAC: otherMAC,
+			}, {
+				IP:  unresolved,
+				MAC: make(net.HardwareAddr, defaultHwAddrLen),
+			}}
+		},
+	}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		want   net.HardwareAddr
+		mac    net.HardwareAddr
+		target netip.Addr
+		name   string
+	}{{
+		want:   otherMAC,
+		mac:    clientMAC,
+		target: usedIP,
+		name:   "used",
+	}, {
+		want:   nil,
+		mac:    otherMAC,
+		target: usedIP,
+		name:   "used_by_client",
+	}, {
+		want:   nil,
+		mac:    clientMAC,
+		target: unusedIP,
+		name:   "unused",
+	}, {
+		want:   nil,
+		mac:    clientMAC,
+		target: unresolved,
+		name:   "unresolved",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, s.neighborHWAddr(tc.target, tc.mac))
+		})
+	}
 }
 
 func TestV4Server_handleRelease(t *testing.T) {
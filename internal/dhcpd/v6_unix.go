@@ -4,9 +4,11 @@ package dhcpd
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
 	"time"
 
@@ -32,7 +34,12 @@ type v6Server struct {
 	sid  dhcpv6.DUID
 	srv  *server6.Server
 
-	leases     []*dhcpsvc.Lease
+	leases []*dhcpsvc.Lease
+
+	// prefixLeases are the leases of the delegated prefixes.  It's protected
+	// by leasesLock.
+	prefixLeases []*dhcpsvc.Lease
+
 	leasesLock sync.Mutex
 	ipAddrs    [256]byte
 }
@@ -95,7 +102,18 @@ func (s *v6Server) ResetLeases(leases []*dhcpsvc.Lease) (err error) {
 	defer s.leasesLock.Unlock()
 
 	s.leases = nil
+	s.prefixLeases = nil
 	for _, l := range leases {
+		if l.Prefix.IsValid() {
+			if s.isValidPrefixLease(l) {
+				s.prefixLeases = append(s.prefixLeases, l)
+			} else {
+				log.Debug("dhcpv6: skipping a lease with prefix %s: not within current pool", l.Prefix)
+			}
+
+			continue
+		}
+
 		ip := net.IP(l.IP.AsSlice())
 		if !l.IsStatic && !ip6InRange(s.conf.ipStart, ip) {
 
@@ -126,7 +144,7 @@ func (s *v6Server) GetLeases(flags GetLeasesFlags) (leases []*dhcpsvc.Lease) {
 				leases = append(leases, l.Clone())
 			}
 		} else {
-			if (flags & LeasesDynamic) != 0 {
+			if (flags&LeasesDynamic) != 0 && !s.isBlocklisted(l) {
 				leases = append(leases, l.Clone())
 			}
 		}
@@ -135,9 +153,36 @@ func (s *v6Server) GetLeases(flags GetLeasesFlags) (leases []*dhcpsvc.Lease) {
 	return leases
 }
 
-// getLeasesRef returns the actual leases slice.  For internal use only.
+// getLeasesRef returns the actual leases, including the ones of the delegated
+// prefixes.  For internal use only.
 func (s *v6Server) getLeasesRef() []*dhcpsvc.Lease {
-	return s.leases
+	return slices.Concat(s.leases, s.prefixLeases)
+}
+
+// poolUsage implements the [DHCPServer] interface for *v6Server.
+func (s *v6Server) poolUsage() (u *PoolUsage) {
+	if !s.conf.Enabled || len(s.conf.ipStart) != net.IPv6len {
+		return nil
+	}
+
+	// The range ends with the last address with the same first 15 bytes, see
+	// [ip6InRange].
+	u = &PoolUsage{
+		Name: "dhcpv6",
+		Size: 256 - uint64(s.conf.ipStart[15]),
+	}
+
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	now := time.Now()
+	for _, l := range s.leases {
+		if (l.IsStatic || l.Expiry.After(now)) && ip6InRange(s.conf.ipStart, l.IP.AsSlice()) {
+			u.Leased++
+		}
+	}
+
+	return u
 }
 
 // FindMACbyIP implements the [Interface] for *v6Server.
@@ -181,7 +226,7 @@ func (s *v6Server) rmDynamicLease(lease *dhcpsvc.Lease) (err error) {
 	for i := 0; i < len(s.leases); i++ {
 		l := s.leases[i]
 
-		if bytes.Equal(l.HWAddr, lease.HWAddr) {
+		if isSameClient(l, lease) {
 			if l.IsStatic {
 				return fmt.Errorf("static lease already exists")
 			}
@@ -210,13 +255,10 @@ func (s *v6Server) rmDynamicLease(lease *dhcpsvc.Lease) (err error) {
 func (s *v6Server) AddStaticLease(l *dhcpsvc.Lease) (err error) {
 	defer func() { err = errors.Annotate(err, "dhcpv6: %w") }()
 
-	if !l.IP.Is6() {
-		return fmt.Errorf("invalid IP")
-	}
-
-	err = netutil.ValidateMAC(l.HWAddr)
+	err = validateStaticLease(l)
 	if err != nil {
-		return fmt.Errorf("validating lease: %w", err)
+		// Don't wrap the error since it's informative enough as is.
+		return err
 	}
 
 	l.IsStatic = true
@@ -254,14 +296,14 @@ func (s *v6Server) UpdateStaticLease(l *dhcpsvc.Lease) (err error) {
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
-	found := s.findLease(l.HWAddr)
+	found := s.findStaticLease(l)
 	if found == nil {
-		return fmt.Errorf("can't find lease %s", l.HWAddr)
+		return fmt.Errorf("can't find lease %s", leaseOwner(l))
 	}
 
 	err = s.rmLease(found)
 	if err != nil {
-		return fmt.Errorf("removing previous lease for %s (%s): %w", l.IP, l.HWAddr, err)
+		return fmt.Errorf("removing previous lease for %s (%s): %w", l.IP, leaseOwner(l), err)
 	}
 
 	s.addLease(l)
@@ -273,13 +315,10 @@ func (s *v6Server) UpdateStaticLease(l *dhcpsvc.Lease) (err error) {
 func (s *v6Server) RemoveStaticLease(l *dhcpsvc.Lease) (err error) {
 	defer func() { err = errors.Annotate(err, "dhcpv6: %w") }()
 
-	if !l.IP.Is6() {
-		return fmt.Errorf("invalid IP")
-	}
-
-	err = netutil.ValidateMAC(l.HWAddr)
+	err = validateStaticLease(l)
 	if err != nil {
-		return fmt.Errorf("validating lease: %w", err)
+		// Don't wrap the error since it's informative enough as is.
+		return err
 	}
 
 	s.leasesLock.Lock()
@@ -306,8 +345,7 @@ func (s *v6Server) addLease(l *dhcpsvc.Lease) {
 func (s *v6Server) rmLease(lease *dhcpsvc.Lease) (err error) {
 	for i, l := range s.leases {
 		if l.IP == lease.IP {
-			if !bytes.Equal(l.HWAddr, lease.HWAddr) ||
-				l.Hostname != lease.Hostname {
+			if !isSameIdentity(l, lease) || l.Hostname != lease.Hostname {
 				return fmt.Errorf("lease not found")
 			}
 
@@ -320,17 +358,117 @@ func (s *v6Server) rmLease(lease *dhcpsvc.Lease) (err error) {
 	return fmt.Errorf("lease not found")
 }
 
-// Find lease by MAC.
-func (s *v6Server) findLease(mac net.HardwareAddr) (lease *dhcpsvc.Lease) {
-	for i := range s.leases {
-		if bytes.Equal(mac, s.leases[i].HWAddr) {
-			return s.leases[i]
+// validateStaticLease returns an error if l isn't a valid DHCPv6 static lease.
+// A lease must be identified either by the MAC address or by the DUID.
+func validateStaticLease(l *dhcpsvc.Lease) (err error) {
+	if !l.IP.Is6() {
+		return fmt.Errorf("invalid IP")
+	}
+
+	if len(l.DUID) > 0 && len(l.HWAddr) == 0 {
+		return nil
+	}
+
+	err = netutil.ValidateMAC(l.HWAddr)
+	if err != nil {
+		return fmt.Errorf("validating lease: %w", err)
+	}
+
+	return nil
+}
+
+// leaseOwner returns the identifier of the client of l for logging.
+func leaseOwner(l *dhcpsvc.Lease) (id string) {
+	if len(l.DUID) == 0 {
+		return l.HWAddr.String()
+	}
+
+	return formatIA(l.DUID, l.IAID)
+}
+
+// formatIA returns the DUID and IAID of an identity association for logging.
+func formatIA(duid []byte, iaid uint32) (s string) {
+	return fmt.Sprintf("duid %s iaid %d", formatDUID(duid), iaid)
+}
+
+// isSameIdentity returns true if a and b are identified by the same DUID and
+// IAID or, if those have no DUID, by the same MAC address.
+func isSameIdentity(a, b *dhcpsvc.Lease) (ok bool) {
+	if len(a.DUID) > 0 || len(b.DUID) > 0 {
+		return bytes.Equal(a.DUID, b.DUID) && a.IAID == b.IAID
+	}
+
+	return len(a.HWAddr) > 0 && bytes.Equal(a.HWAddr, b.HWAddr)
+}
+
+// isSameClient is like [isSameIdentity], but it also considers the zero IAID
+// to match any.
+func isSameClient(a, b *dhcpsvc.Lease) (ok bool) {
+	if len(a.DUID) > 0 && bytes.Equal(a.DUID, b.DUID) {
+		return a.IAID == b.IAID || a.IAID == 0 || b.IAID == 0
+	}
+
+	return isSameIdentity(a, b)
+}
+
+// findStaticLease returns the static lease with the same identity as l, if
+// any.
+func (s *v6Server) findStaticLease(l *dhcpsvc.Lease) (found *dhcpsvc.Lease) {
+	for _, sl := range s.leases {
+		if sl.IsStatic && isSameIdentity(sl, l) {
+			return sl
 		}
 	}
 
 	return nil
 }
 
+// clientIA identifies the identity association of a DHCPv6 client.
+type clientIA struct {
+	// mac is the MAC address of the client, if it could be found in the
+	// message.
+	mac net.HardwareAddr
+
+	// duid is the DUID of the client.
+	duid []byte
+
+	// iaid is the identifier of the identity association.
+	iaid uint32
+}
+
+// type check
+var _ fmt.Stringer = (*clientIA)(nil)
+
+// String implements the [fmt.Stringer] interface for *clientIA.
+func (ia *clientIA) String() (s string) {
+	return formatIA(ia.duid, ia.iaid)
+}
+
+// findLease returns the lease of ia, if any.  The leases with the same DUID
+// take precedence over the ones with the same MAC address only.
+func (s *v6Server) findLease(ia *clientIA) (lease *dhcpsvc.Lease) {
+	var anyIA, byMAC *dhcpsvc.Lease
+	for _, l := range s.leases {
+		if len(l.DUID) > 0 {
+			if !bytes.Equal(l.DUID, ia.duid) {
+				continue
+			} else if l.IAID == ia.iaid {
+				return l
+			} else if l.IsStatic && l.IAID == 0 && anyIA == nil {
+				anyIA = l
+			}
+		} else if len(ia.mac) > 0 && bytes.Equal(l.HWAddr, ia.mac) && byMAC == nil {
+			byMAC = l
+		}
+	}
+
+	if anyIA != nil {
+		return anyIA
+	}
+
+	return byMAC
+}
+
 // Find an expired lease and return its index or -1
 func (s *v6Server) findExpiredLease() int {
 	now := time.Now().Unix()
@@ -358,14 +496,14 @@ func (s *v6Server) findFreeIP() net.IP {
 	return nil
 }
 
-// Reserve lease for MAC
-func (s *v6Server) reserveLease(mac net.HardwareAddr) *dhcpsvc.Lease {
+// reserveLease reserves a lease for ia.
+func (s *v6Server) reserveLease(ia *clientIA) *dhcpsvc.Lease {
 	l := dhcpsvc.Lease{
-		HWAddr: make([]byte, len(mac)),
+		HWAddr: slices.Clone(ia.mac),
+		DUID:   slices.Clone(ia.duid),
+		IAID:   ia.iaid,
 	}
 
-	copy(l.HWAddr, mac)
-
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
@@ -376,9 +514,11 @@ func (s *v6Server) reserveLease(mac net.HardwareAddr) *dhcpsvc.Lease {
 			return nil
 		}
 
-		copy(s.leases[i].HWAddr, mac)
+		expired := s.leases[i]
+		expired.HWAddr, expired.DUID, expired.IAID = l.HWAddr, l.DUID, l.IAID
+		expired.Hostname = ""
 
-		return s.leases[i]
+		return expired
 	}
 
 	netIP, ok := netip.AddrFromSlice(ip)
@@ -444,7 +584,6 @@ func (s *v6Server) checkSID(msg *dhcpv6.Message) error {
 func (s *v6Server) checkIA(msg *dhcpv6.Message, lease *dhcpsvc.Lease) error {
 	switch msg.Type() {
 	case dhcpv6.MessageTypeRequest,
-		dhcpv6.MessageTypeConfirm,
 		dhcpv6.MessageTypeRenew,
 		dhcpv6.MessageTypeRebind:
 
@@ -474,9 +613,6 @@ func (s *v6Server) commitLease(msg *dhcpv6.Message, lease *dhcpsvc.Lease) time.D
 	case dhcpv6.MessageTypeSolicit:
 		//
 
-	case dhcpv6.MessageTypeConfirm:
-		lifetime = time.Until(lease.Expiry)
-
 	case dhcpv6.MessageTypeRequest,
 		dhcpv6.MessageTypeRenew,
 		dhcpv6.MessageTypeRebind:
@@ -488,25 +624,36 @@ func (s *v6Server) commitLease(msg *dhcpv6.Message, lease *dhcpsvc.Lease) time.D
 	return lifetime
 }
 
-// Find a lease associated with MAC and prepare response
+// process finds a lease associated with the client's identity association and
+// prepares the response.
 func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 	switch msg.Type() {
 	case dhcpv6.MessageTypeSolicit,
 		dhcpv6.MessageTypeRequest,
 		dhcpv6.MessageTypeConfirm,
 		dhcpv6.MessageTypeRenew,
-		dhcpv6.MessageTypeRebind:
+		dhcpv6.MessageTypeRebind,
+		dhcpv6.MessageTypeRelease,
+		dhcpv6.MessageTypeDecline:
 		// continue
 
 	default:
 		return false
 	}
 
-	mac, err := dhcpv6.ExtractMAC(req)
-	if err != nil {
-		log.Debug("dhcpv6: dhcpv6.ExtractMAC: %s", err)
+	ia := newClientIA(msg, req)
+	if s.processPD(msg, ia, resp) {
+		// The client, usually a router, requests only the delegated prefixes.
+		if msg.IsOptionRequested(dhcpv6.OptionDNSRecursiveNameServer) {
+			resp.UpdateOption(dhcpv6.OptDNS(s.conf.dnsIPAddrs...))
+		}
 
-		return false
+		resp.AddOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "success",
+		})
+
+		return true
 	}
 
 	var lease *dhcpsvc.Lease
@@ -514,16 +661,42 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 		s.leasesLock.Lock()
 		defer s.leasesLock.Unlock()
 
-		lease = s.findLease(mac)
+		lease = s.findLease(ia)
+		if lease != nil && !lease.IsStatic && len(lease.DUID) == 0 {
+			// Migrate the dynamic leases stored before the leases have been
+			// identified by DUID.
+			lease.DUID, lease.IAID = slices.Clone(ia.duid), ia.iaid
+		}
 	}()
 
+	switch msg.Type() {
+	case dhcpv6.MessageTypeRelease:
+		s.releaseLease(msg, lease)
+		resp.AddOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "released",
+		})
+
+		return true
+	case dhcpv6.MessageTypeDecline:
+		s.declineLease(msg, lease)
+		resp.AddOption(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusSuccess,
+			StatusMessage: "declined",
+		})
+
+		return true
+	case dhcpv6.MessageTypeConfirm:
+		return s.confirm(msg, ia, resp)
+	}
+
 	if lease == nil {
-		log.Debug("dhcpv6: no lease for: %s", mac)
+		log.Debug("dhcpv6: no lease for: %s", ia)
 
 		switch msg.Type() {
 
 		case dhcpv6.MessageTypeSolicit:
-			lease = s.reserveLease(mac)
+			lease = s.reserveLease(ia)
 			if lease == nil {
 				return false
 			}
@@ -533,7 +706,7 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 		}
 	}
 
-	err = s.checkIA(msg, lease)
+	err := s.checkIA(msg, lease)
 	if err != nil {
 		log.Debug("dhcpv6: %s", err)
 
@@ -578,6 +751,169 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 	return true
 }
 
+// newClientIA returns the identity association of the client from the message.
+// The client ID option must be present in msg.
+func newClientIA(msg *dhcpv6.Message, req dhcpv6.DHCPv6) (ia *clientIA) {
+	ia = &clientIA{
+		duid: msg.Options.ClientID().ToBytes(),
+	}
+
+	if oia := msg.Options.OneIANA(); oia != nil {
+		ia.iaid = binary.BigEndian.Uint32(oia.IaId[:])
+	}
+
+	mac, err := dhcpv6.ExtractMAC(req)
+	if err != nil {
+		// The clients with the DUIDs not containing the link-layer address
+		// are identified by the DUID only.
+		log.Debug("dhcpv6: dhcpv6.ExtractMAC: %s", err)
+	} else {
+		ia.mac = mac
+	}
+
+	return ia
+}
+
+// releaseLease removes the dynamic lease, if any, if the client releases its
+// address.
+func (s *v6Server) releaseLease(msg *dhcpv6.Message, lease *dhcpsvc.Lease) {
+	if lease == nil || lease.IsStatic {
+		return
+	}
+
+	if !hasIAAddr(msg, lease.IP) {
+		return
+	}
+
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		i := slices.Index(s.leases, lease)
+		if i >= 0 {
+			s.leaseRemoveSwapByIndex(i)
+		}
+	}()
+
+	s.conf.notify(LeaseChangedDBStore)
+}
+
+// declineLease quarantines the address of the dynamic lease, if any, if the
+// client declines it, since the client has detected that the address is
+// already in use by another device.
+func (s *v6Server) declineLease(msg *dhcpv6.Message, lease *dhcpsvc.Lease) {
+	if lease == nil || lease.IsStatic || !hasIAAddr(msg, lease.IP) {
+		return
+	}
+
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		s.blocklistLease(lease)
+		s.conf.conflicts.add(&conflict{
+			Time:   time.Now(),
+			IP:     lease.IP,
+			Source: conflictSourceDecline,
+		})
+	}()
+
+	s.conf.notify(LeaseChangedDBStore)
+}
+
+// blocklistLease quarantines the address of the dynamic lease for the lease
+// duration.  s.leasesLock is expected to be locked.
+func (s *v6Server) blocklistLease(l *dhcpsvc.Lease) {
+	l.HWAddr = make(net.HardwareAddr, defaultHwAddrLen)
+	l.DUID = nil
+	l.IAID = 0
+	l.Hostname = ""
+	l.Expiry = time.Now().Add(s.conf.leaseTime)
+}
+
+// isBlocklisted returns true if the lease holds a quarantined address.
+func (s *v6Server) isBlocklisted(l *dhcpsvc.Lease) (ok bool) {
+	return len(l.DUID) == 0 && isZeroHWAddr(l.HWAddr)
+}
+
+// hasIAAddr returns true if the identity association in msg contains ip.
+func hasIAAddr(msg *dhcpv6.Message, ip netip.Addr) (ok bool) {
+	oia := msg.Options.OneIANA()
+	if oia == nil {
+		return false
+	}
+
+	oiaAddr := oia.Options.OneAddress()
+
+	return oiaAddr != nil && oiaAddr.IPv6Addr.Equal(ip.AsSlice())
+}
+
+// confirm prepares the response to the Confirm message, which the client sends
+// to check if its addresses are still appropriate for the link.  See RFC 8415
+// Section 18.3.3.  The addresses which are out of the range or leased to
+// another client aren't appropriate, so that such clients start over instead
+// of using a conflicting address.  confirm returns false if msg contains no
+// addresses, since the server mustn't reply in that case.
+func (s *v6Server) confirm(msg *dhcpv6.Message, ia *clientIA, resp dhcpv6.DHCPv6) (ok bool) {
+	var addrs []net.IP
+	for _, oia := range msg.Options.IANA() {
+		for _, oiaAddr := range oia.Options.Addresses() {
+			addrs = append(addrs, oiaAddr.IPv6Addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return false
+	}
+
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	for _, ip := range addrs {
+		if !s.isAppropriate(ip, ia) {
+			log.Debug("dhcpv6: confirm: %s is not appropriate for %s", ip, ia)
+
+			resp.AddOption(&dhcpv6.OptStatusCode{
+				StatusCode:    iana.StatusNotOnLink,
+				StatusMessage: "not on link",
+			})
+
+			return true
+		}
+	}
+
+	resp.AddOption(&dhcpv6.OptStatusCode{
+		StatusCode:    iana.StatusSuccess,
+		StatusMessage: "success",
+	})
+
+	return true
+}
+
+// isAppropriate returns true if ip is within the range and isn't leased to or
+// quarantined from a client other than the one with ia.  s.leasesLock is
+// expected to be locked.
+func (s *v6Server) isAppropriate(ip net.IP, ia *clientIA) (ok bool) {
+	if !ip6InRange(s.conf.ipStart, ip) {
+		return false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+
+	own := s.findLease(ia)
+	now := time.Now()
+	for _, l := range s.leases {
+		if l.IP == addr {
+			return l == own || (!l.IsStatic && !l.Expiry.After(now))
+		}
+	}
+
+	return true
+}
+
 // 1.
 // fe80::* (client) --(Solicit + ClientID+IANA())-> ff02::1:2
 // server -(Advertise + ClientID+ServerID+IANA(IAAddress)> fe80::*
@@ -589,7 +925,11 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 // server -(Reply + ClientID+ServerID+IANA(IAAddress)+DNS)> fe80::*
 //
 // 3.
-// fe80::* --(Release + ClientID+ServerID+IANA(IAAddress))-> ff02::1:2
+// fe80::* --(Release|Decline + ClientID+ServerID+IANA(IAAddress))-> ff02::1:2
+// server -(Reply + ClientID+ServerID+StatusCode)> fe80::*
+//
+// The routers may also send IAPD(IAPrefix) along with or instead of IANA, see
+// [v6Server.processPD].
 func (s *v6Server) packetHandler(conn net.PacketConn, peer net.Addr, req dhcpv6.DHCPv6) {
 	msg, err := req.GetInnerMessage()
 	if err != nil {
@@ -630,6 +970,8 @@ func (s *v6Server) packetHandler(conn net.PacketConn, peer net.Addr, req dhcpv6.
 		dhcpv6.MessageTypeRelease,
 		dhcpv6.MessageTypeInformationRequest:
 		resp, err = dhcpv6.NewReplyFromMessage(msg)
+	case dhcpv6.MessageTypeDecline:
+		resp = newDeclineReply(msg)
 	default:
 		log.Error("dhcpv6: message type %d not supported", msg.Type())
 
@@ -655,6 +997,19 @@ func (s *v6Server) packetHandler(conn net.PacketConn, peer net.Addr, req dhcpv6.
 	}
 }
 
+// newDeclineReply returns the Reply message for the Decline message msg, since
+// [dhcpv6.NewReplyFromMessage] doesn't support those.  See RFC 8415 Section
+// 18.3.8.  The client ID option must be present in msg.
+func newDeclineReply(msg *dhcpv6.Message) (resp *dhcpv6.Message) {
+	resp = &dhcpv6.Message{
+		MessageType:   dhcpv6.MessageTypeReply,
+		TransactionID: msg.TransactionID,
+	}
+	resp.AddOption(dhcpv6.OptClientID(msg.Options.ClientID()))
+
+	return resp
+}
+
 // configureDNSIPAddrs updates v6Server configuration with the slice of DNS IP
 // addresses of provided interface iface.  Initializes RA module.
 func (s *v6Server) configureDNSIPAddrs(iface *net.Interface) (ok bool, err error) {
@@ -790,6 +1145,9 @@ func (s *v6Server) Stop() (err error) {
 func v6Create(conf V6ServerConf) (DHCPServer, error) {
 	s := &v6Server{}
 	s.conf = conf
+	if s.conf.conflicts == nil {
+		s.conf.conflicts = newConflictLog()
+	}
 
 	if !conf.Enabled {
 		return s, nil
@@ -800,6 +1158,13 @@ func v6Create(conf V6ServerConf) (DHCPServer, error) {
 		return s, fmt.Errorf("dhcpv6: invalid range-start IP: %s", conf.RangeStart)
 	}
 
+	err := validateDelegatedPrefix(conf.DelegatedPrefix, conf.DelegatedPrefixLen)
+	if err != nil {
+		return s, fmt.Errorf("dhcpv6: %w", err)
+	}
+
+	s.conf.DelegatedPrefix = conf.DelegatedPrefix.Masked()
+
 	if conf.LeaseDuration == 0 {
 		s.conf.leaseTime = timeutil.Day
 		s.conf.LeaseDuration = uint32(s.conf.leaseTime.Seconds())
@@ -3,8 +3,10 @@
 package dhcpd
 
 import (
+	"encoding/binary"
 	"net"
 	"net/netip"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -61,6 +63,75 @@ func TestV6_AddRemove_static(t *testing.T) {
 	assert.Empty(t, s.GetLeases(LeasesStatic))
 }
 
+func TestV6_AddStaticLease_poolAlerts(t *testing.T) {
+	const testTimeout = 1 * time.Second
+
+	usages := make(chan *PoolUsage, 10)
+	s := &server{
+		conf: &ServerConfig{
+			OnPoolUsage: func(u *PoolUsage) {
+				select {
+				case usages <- u:
+				default:
+				}
+			},
+			PoolAlertThreshold: 50,
+			dbFilePath:         filepath.Join(t.TempDir(), dataFilename),
+		},
+		poolAlerts:    newPoolAlerts(),
+		poolUsageReqs: make(chan struct{}, 1),
+	}
+
+	var err error
+	s.srv4, err = v4Create(&V4ServerConf{
+		Enabled:    true,
+		RangeStart: netip.MustParseAddr("192.168.10.100"),
+		RangeEnd:   netip.MustParseAddr("192.168.10.200"),
+		GatewayIP:  netip.MustParseAddr("192.168.10.1"),
+		SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		notify:     testNotify,
+	})
+	require.NoError(t, err)
+
+	s.srv6, err = v6Create(V6ServerConf{
+		Enabled:    true,
+		RangeStart: net.ParseIP("2001::fe"),
+		notify:     s.onNotify,
+	})
+	require.NoError(t, err)
+
+	s.startPoolUsage()
+	t.Cleanup(s.stopPoolUsage)
+
+	added := make(chan error, 1)
+	go func() {
+		added <- s.srv6.AddStaticLease(&dhcpsvc.Lease{
+			IP:     netip.MustParseAddr("2001::fe"),
+			HWAddr: net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		})
+	}()
+
+	select {
+	case err = <-added:
+		require.NoError(t, err)
+	case <-time.After(testTimeout):
+		t.Fatal("adding static lease: timed out")
+	}
+
+	var u *PoolUsage
+	for u == nil || u.Name != "dhcpv6" {
+		select {
+		case u = <-usages:
+		case <-time.After(testTimeout):
+			t.Fatal("reporting pool usage: timed out")
+		}
+	}
+
+	assert.Equal(t, uint64(1), u.Leased)
+	assert.Eventually(t, func() (ok bool) {
+		return s.poolAlerts.isActive("dhcpv6")
+	}, testTimeout, testTimeout/10)
+}
 func TestV6_AddReplace(t *testing.T) {
 	sIface, err := v6Create(V6ServerConf{
 		Enabled:    true,
@@ -203,6 +274,190 @@ func TestV6GetLease(t *testing.T) {
 	})
 }
 
+func TestV6GetLease_duid(t *testing.T) {
+	sIface, err := v6Create(V6ServerConf{
+		Enabled:    true,
+		RangeStart: net.ParseIP("2001::1"),
+		notify:     notify6,
+	})
+	require.NoError(t, err)
+
+	s, ok := sIface.(*v6Server)
+	require.True(t, ok)
+
+	s.sid = &dhcpv6.DUIDLL{
+		HWType:        iana.HWTypeEthernet,
+		LinkLayerAddr: net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+	}
+
+	clientDUID := &dhcpv6.DUIDEN{
+		EnterpriseNumber:     1,
+		EnterpriseIdentifier: []byte{0x01, 0x02, 0x03, 0x04},
+	}
+
+	l := &dhcpsvc.Lease{
+		IP:   netip.MustParseAddr("2001::5"),
+		DUID: clientDUID.ToBytes(),
+	}
+	err = s.AddStaticLease(l)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		duid   dhcpv6.DUID
+		want   netip.Addr
+		name   string
+		mac    net.HardwareAddr
+		static bool
+	}{{
+		duid:   clientDUID,
+		want:   l.IP,
+		name:   "reserved",
+		mac:    net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		static: true,
+	}, {
+		duid: &dhcpv6.DUIDEN{
+			EnterpriseNumber:     1,
+			EnterpriseIdentifier: []byte{0x05, 0x06, 0x07, 0x08},
+		},
+		want:   netip.MustParseAddr("2001::1"),
+		name:   "other",
+		mac:    net.HardwareAddr{0xCC, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC},
+		static: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, reqErr := dhcpv6.NewSolicit(tc.mac, dhcpv6.WithClientID(tc.duid))
+			require.NoError(t, reqErr)
+
+			msg, msgErr := req.GetInnerMessage()
+			require.NoError(t, msgErr)
+
+			resp, respErr := dhcpv6.NewAdvertiseFromSolicit(msg)
+			require.NoError(t, respErr)
+
+			require.True(t, s.process(msg, req, resp))
+
+			oia := resp.Options.OneIANA()
+			require.NotNil(t, oia)
+
+			oiaAddr := oia.Options.OneAddress()
+			require.NotNil(t, oiaAddr)
+
+			assert.Equal(t, net.IP(tc.want.AsSlice()), oiaAddr.IPv6Addr)
+
+			lease := s.findLease(newClientIA(msg, req))
+			require.NotNil(t, lease)
+
+			assert.Equal(t, tc.static, lease.IsStatic)
+			assert.Equal(t, tc.duid.ToBytes(), lease.DUID)
+		})
+	}
+}
+
+func TestV6_declineConfirm(t *testing.T) {
+	sIface, err := v6Create(V6ServerConf{
+		Enabled:    true,
+		RangeStart: net.ParseIP("2001::1"),
+		notify:     notify6,
+	})
+	require.NoError(t, err)
+
+	s, ok := sIface.(*v6Server)
+	require.True(t, ok)
+
+	s.sid = &dhcpv6.DUIDLL{
+		HWType:        iana.HWTypeEthernet,
+		LinkLayerAddr: net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+	}
+
+	leaseIP := netip.MustParseAddr("2001::1")
+	mac := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+	otherMAC := net.HardwareAddr{0xCC, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC}
+
+	// newMsg returns a message of type typ from the client with mac asking
+	// about leaseIP.
+	newMsg := func(
+		t *testing.T,
+		typ dhcpv6.MessageType,
+		mac net.HardwareAddr,
+	) (msg *dhcpv6.Message, resp dhcpv6.DHCPv6) {
+		t.Helper()
+
+		var modErr error
+		msg, modErr = dhcpv6.NewSolicit(
+			mac,
+			dhcpv6.WithClientID(&dhcpv6.DUIDLL{
+				HWType:        iana.HWTypeEthernet,
+				LinkLayerAddr: mac,
+			}),
+			dhcpv6.WithIANA(dhcpv6.OptIAAddress{
+				IPv6Addr: net.IP(leaseIP.AsSlice()),
+			}),
+		)
+		require.NoError(t, modErr)
+
+		if typ == dhcpv6.MessageTypeSolicit {
+			resp, modErr = dhcpv6.NewAdvertiseFromSolicit(msg)
+			require.NoError(t, modErr)
+
+			return msg, resp
+		}
+
+		msg.MessageType = typ
+		if typ == dhcpv6.MessageTypeDecline {
+			msg.AddOption(dhcpv6.OptServerID(s.sid))
+
+			return msg, newDeclineReply(msg)
+		}
+
+		resp, modErr = dhcpv6.NewReplyFromMessage(msg)
+		require.NoError(t, modErr)
+
+		return msg, resp
+	}
+
+	msg, resp := newMsg(t, dhcpv6.MessageTypeSolicit, mac)
+	require.True(t, s.process(msg, msg, resp))
+
+	msg, resp = newMsg(t, dhcpv6.MessageTypeRequest, mac)
+	require.True(t, s.process(msg, msg, resp))
+	require.Len(t, s.GetLeases(LeasesDynamic), 1)
+
+	t.Run("confirm_own", func(t *testing.T) {
+		msg, resp = newMsg(t, dhcpv6.MessageTypeConfirm, mac)
+		require.True(t, s.process(msg, msg, resp))
+
+		status := resp.GetOneOption(dhcpv6.OptionStatusCode)
+		require.NotNil(t, status)
+
+		assert.Equal(t, iana.StatusSuccess, status.(*dhcpv6.OptStatusCode).StatusCode)
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		msg, resp = newMsg(t, dhcpv6.MessageTypeDecline, mac)
+		require.True(t, s.process(msg, msg, resp))
+
+		assert.Empty(t, s.GetLeases(LeasesDynamic))
+
+		conflicts := s.conf.conflicts.list()
+		require.Len(t, conflicts, 1)
+
+		assert.Equal(t, leaseIP, conflicts[0].IP)
+		assert.Equal(t, conflictSourceDecline, conflicts[0].Source)
+	})
+
+	t.Run("confirm_quarantined", func(t *testing.T) {
+		msg, resp = newMsg(t, dhcpv6.MessageTypeConfirm, otherMAC)
+		require.True(t, s.process(msg, msg, resp))
+
+		status := resp.GetOneOption(dhcpv6.OptionStatusCode)
+		require.NotNil(t, status)
+
+		assert.Equal(t, iana.StatusNotOnLink, status.(*dhcpv6.OptStatusCode).StatusCode)
+	})
+}
+
 func TestV6GetDynamicLease(t *testing.T) {
 	sIface, err := v6Create(V6ServerConf{
 		Enabled:    true,
@@ -380,3 +635,79 @@ func TestV6_FindMACbyIP(t *testing.T) {
 		})
 	}
 }
+
+func TestV6_prefixDelegation(t *testing.T) {
+	sIface, err := v6Create(V6ServerConf{
+		Enabled:            true,
+		RangeStart:         net.ParseIP("2001::1"),
+		DelegatedPrefix:    netip.MustParsePrefix("2001:db8::/62"),
+		DelegatedPrefixLen: 64,
+		notify:             notify6,
+	})
+	require.NoError(t, err)
+
+	s, ok := sIface.(*v6Server)
+	require.True(t, ok)
+
+	s.sid = &dhcpv6.DUIDLL{
+		HWType:        iana.HWTypeEthernet,
+		LinkLayerAddr: net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+	}
+
+	mac := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+	iaid := [4]byte{0x01, 0x02, 0x03, 0x04}
+	wantPrefix := netip.MustParsePrefix("2001:db8::/64")
+
+	req, err := dhcpv6.NewSolicit(mac, dhcpv6.WithIAPD(iaid))
+	require.NoError(t, err)
+
+	// Request only the prefix.
+	req.Options.Del(dhcpv6.OptionIANA)
+
+	msg, err := req.GetInnerMessage()
+	require.NoError(t, err)
+
+	// Solicit.
+	resp, err := dhcpv6.NewAdvertiseFromSolicit(msg)
+	require.NoError(t, err)
+
+	require.True(t, s.process(msg, req, resp))
+
+	assert.Nil(t, resp.Options.OneIANA())
+
+	oiapd := resp.Options.OneIAPD()
+	require.NotNil(t, oiapd)
+
+	oiaPrefix := oiapd.Options.Prefixes()
+	require.Len(t, oiaPrefix, 1)
+
+	assert.Equal(t, wantPrefix.String(), oiaPrefix[0].Prefix.String())
+	assert.Empty(t, s.delegatedPrefixes())
+
+	// Request.
+	msg.MessageType = dhcpv6.MessageTypeRequest
+	resp, err = dhcpv6.NewReplyFromMessage(msg)
+	require.NoError(t, err)
+
+	require.True(t, s.process(msg, req, resp))
+
+	oiapd = resp.Options.OneIAPD()
+	require.NotNil(t, oiapd)
+
+	ls := s.delegatedPrefixes()
+	require.Len(t, ls, 1)
+
+	assert.Equal(t, wantPrefix, ls[0].Prefix)
+	assert.Equal(t, binary.BigEndian.Uint32(iaid[:]), ls[0].IAID)
+	assert.Empty(t, s.GetLeases(LeasesAll))
+
+	// Release.
+	msg.MessageType = dhcpv6.MessageTypeRelease
+	resp, err = dhcpv6.NewReplyFromMessage(msg)
+	require.NoError(t, err)
+
+	require.True(t, s.process(msg, req, resp))
+
+	assert.Nil(t, resp.Options.OneIAPD())
+	assert.Empty(t, s.delegatedPrefixes())
+}
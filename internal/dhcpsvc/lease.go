@@ -23,9 +23,25 @@ type Lease struct {
 	// Hostname of the client.
 	Hostname string
 
-	// HWAddr is the physical hardware address (MAC address).
+	// HWAddr is the physical hardware address (MAC address).  It may be empty
+	// for a DHCPv6 lease identified by DUID.
 	HWAddr net.HardwareAddr
 
+	// DUID is the DHCP Unique Identifier of a DHCPv6 client.  It's empty for
+	// DHCPv4 leases and for the DHCPv6 static leases identified by HWAddr.
+	DUID []byte
+
+	// IAID is the identifier of the DHCPv6 client's identity association for
+	// non-temporary addresses or, if Prefix is valid, for prefix delegation.
+	// Zero means any identity association of the client with DUID in a static
+	// lease.
+	IAID uint32
+
+	// Prefix is the IPv6 prefix delegated to the DHCPv6 client, which is
+	// usually a downstream router.  If it's valid, IP is the first address of
+	// Prefix.  It's invalid for the leases of addresses.
+	Prefix netip.Prefix
+
 	// IsStatic defines if the lease is static.
 	IsStatic bool
 }
@@ -40,7 +56,10 @@ func (l *Lease) Clone() (clone *Lease) {
 		Expiry:   l.Expiry,
 		Hostname: l.Hostname,
 		HWAddr:   slices.Clone(l.HWAddr),
+		DUID:     slices.Clone(l.DUID),
+		IAID:     l.IAID,
 		IP:       l.IP,
+		Prefix:   l.Prefix,
 		IsStatic: l.IsStatic,
 	}
 }
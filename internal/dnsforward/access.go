@@ -10,6 +10,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -84,8 +85,18 @@ func newAccessCtx(allowed, blocked, blockedHosts []string) (a *accessManager, er
 	}
 
 	b := &strings.Builder{}
-	for _, h := range blockedHosts {
-		stringutil.WriteToBuilder(b, strings.ToLower(h), "\n")
+	for i, h := range blockedHosts {
+		h, err = normalizeBlockedHost(h)
+		if err != nil {
+			// Don't fail, since the previous versions accepted such hosts in
+			// the configuration file.  The ones set via the HTTP API are
+			// validated by [validateAccessSet].
+			log.Info("dnsforward: warning: skipping blocked host at index %d: %s", i, err)
+
+			continue
+		}
+
+		stringutil.WriteToBuilder(b, h, "\n")
 	}
 
 	lists := []filterlist.RuleList{
@@ -106,6 +117,20 @@ func newAccessCtx(allowed, blocked, blockedHosts []string) (a *accessManager, er
 	return a, nil
 }
 
+// blockedHostRuleChars are the characters which mark a blocked host as a
+// filtering rule instead of a domain name.
+const blockedHostRuleChars = "|^$/@!#"
+
+// normalizeBlockedHost returns the normalized form of h if it's a domain name,
+// optionally with a wildcard, or lowercased h if it's a filtering rule.
+func normalizeBlockedHost(h string) (norm string, err error) {
+	if h == "" || strings.ContainsAny(h, blockedHostRuleChars) {
+		return strings.ToLower(h), nil
+	}
+
+	return aghnet.ParseDomainNamePattern(h)
+}
+
 // allowlistMode returns true if this *accessCtx is in the allowlist mode.
 func (a *accessManager) allowlistMode() (ok bool) {
 	return a.allowedIPs.Len() != 0 || a.allowedClientIDs.Len() != 0 || len(a.allowedNets) != 0
@@ -208,6 +233,13 @@ func validateAccessSet(list *accessListJSON) (err error) {
 		return fmt.Errorf("validating blocked hosts: %w", err)
 	}
 
+	for i, h := range list.BlockedHosts {
+		_, err = normalizeBlockedHost(h)
+		if err != nil {
+			return fmt.Errorf("validating blocked hosts: at index %d: %w", i, err)
+		}
+	}
+
 	merged := allowed.Merge(disallowed)
 	err = merged.Validate()
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +33,7 @@ func TestIsBlockedHost(t *testing.T) {
 		"||host3.com^",
 		"||*^$dnstype=HTTPS",
 		"|.^",
+		"Пример.РФ",
 	})
 	require.NoError(t, err)
 
@@ -95,6 +97,11 @@ func TestIsBlockedHost(t *testing.T) {
 		name: "by_qtype_other",
 		host: "site-with-https-record.example",
 		qt:   dns.TypeA,
+	}, {
+		want: assert.True,
+		name: "idn_match",
+		host: "xn--e1afmkfd.xn--p1ai",
+		qt:   dns.TypeA,
 	}, {
 		want: assert.True,
 		name: "ns_root",
@@ -109,6 +116,32 @@ func TestIsBlockedHost(t *testing.T) {
 	}
 }
 
+func TestNewAccessCtx_badBlockedHost(t *testing.T) {
+	// The invalid hosts from the configuration file are skipped.
+	a, err := newAccessCtx(nil, nil, []string{"host1", "bad..host"})
+	require.NoError(t, err)
+
+	assert.True(t, a.isBlockedHost("host1", dns.TypeA))
+	assert.False(t, a.isBlockedHost("bad..host", dns.TypeA))
+}
+
+func TestValidateAccessSet(t *testing.T) {
+	err := validateAccessSet(&accessListJSON{
+		BlockedHosts: []string{"host1", "||rule.example^", "bad..host"},
+	})
+	testutil.AssertErrorMsg(
+		t,
+		`validating blocked hosts: at index 2: bad domain name "bad..host": `+
+			`bad domain name label "": domain name label is empty`,
+		err,
+	)
+
+	err = validateAccessSet(&accessListJSON{
+		BlockedHosts: []string{"host1", "||rule.example^", "*.Example.ORG"},
+	})
+	assert.NoError(t, err)
+}
+
 func TestIsBlockedIP(t *testing.T) {
 	clients := []string{
 		"1.2.3.4",
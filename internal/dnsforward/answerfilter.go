@@ -0,0 +1,115 @@
+package dnsforward
+
+import (
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// filterAnswerIPs applies the answer filters to the addresses in the A and AAAA
+// records of the response from dctx.  If any of the addresses matches a
+// blocking filter, the response is blocked.  Otherwise, the matching addresses
+// are rewritten.
+func (s *Server) filterAnswerIPs(dctx *dnsContext) {
+	pctx := dctx.proxyCtx
+
+	var (
+		first  *filtering.AnswerFilter
+		block  bool
+		ans    = make([]dns.RR, 0, len(pctx.Res.Answer))
+		edited bool
+	)
+
+	for _, rr := range pctx.Res.Answer {
+		f := s.answerFilterFor(rr, dctx.setts)
+		if f == nil {
+			ans = append(ans, rr)
+
+			continue
+		}
+
+		if first == nil {
+			first = f
+		}
+
+		if f.Action == filtering.AnswerFilterActionBlock {
+			block = true
+
+			break
+		}
+
+		edited = true
+		if rewritten := rewriteAnswerIP(rr, f); rewritten != nil {
+			ans = append(ans, rewritten)
+		}
+	}
+
+	if first == nil {
+		return
+	}
+
+	res := &filtering.Result{
+		AnswerFilter: first.Name,
+		Reason:       filtering.FilteredAnswerIP,
+		IsFiltered:   true,
+	}
+
+	log.Debug(
+		"dnsforward: answer for %q matched answer filter %q",
+		pctx.Req.Question[0].Name,
+		first.Name,
+	)
+
+	dctx.result = res
+	dctx.origResp = pctx.Res
+	if block {
+		pctx.Res = s.genDNSFilterMessage(pctx, res)
+	} else if edited {
+		resp := pctx.Res.Copy()
+		resp.Answer = ans
+		pctx.Res = resp
+	}
+}
+
+// answerFilterFor returns the answer filter matching rr, if it's an A or an
+// AAAA record, for the client with setts.
+func (s *Server) answerFilterFor(rr dns.RR, setts *filtering.Settings) (f *filtering.AnswerFilter) {
+	if t := rr.Header().Rrtype; t != dns.TypeA && t != dns.TypeAAAA {
+		return nil
+	}
+
+	ip := rrAddr(rr)
+	if !ip.IsValid() {
+		return nil
+	}
+
+	return s.dnsFilter.MatchAnswerIP(ip, setts)
+}
+
+// rewriteAnswerIP returns the copy of the A or AAAA record rr with the address
+// replaced according to the rewriting filter f, or nil if the record must be
+// removed.
+func rewriteAnswerIP(rr dns.RR, f *filtering.AnswerFilter) (rewritten dns.RR) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		if !f.RewriteIPv4.IsValid() {
+			return nil
+		}
+
+		a := *rr
+		a.A = f.RewriteIPv4.AsSlice()
+
+		return &a
+	case *dns.AAAA:
+		if !f.RewriteIPv6.IsValid() {
+			return nil
+		}
+
+		aaaa := *rr
+		aaaa.AAAA = f.RewriteIPv6.AsSlice()
+
+		return &aaaa
+	default:
+		return rr
+	}
+}
@@ -0,0 +1,157 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_filterAnswerIPs(t *testing.T) {
+	const excepted = "excepted"
+
+	var (
+		publicIPv4  net.IP = netip.MustParseAddr("203.0.113.1").AsSlice()
+		privateIPv4 net.IP = netip.MustParseAddr("192.168.1.1").AsSlice()
+		loopbackIP  net.IP = netip.MustParseAddr("127.0.0.1").AsSlice()
+		privateIPv6 net.IP = netip.MustParseAddr("fd00::1").AsSlice()
+	)
+
+	rewriteIPv4 := netip.MustParseAddr("192.0.2.1")
+
+	f, err := filtering.New(&filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+		AnswerFilters: []*filtering.AnswerFilter{{
+			Name:          "rebinding",
+			Action:        filtering.AnswerFilterActionBlock,
+			Subnets:       []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+			ExceptClients: []string{excepted},
+			Enabled:       true,
+		}, {
+			Name:   "loopback",
+			Action: filtering.AnswerFilterActionRewrite,
+			Subnets: []netip.Prefix{
+				netip.MustParsePrefix("127.0.0.0/8"),
+				netip.MustParsePrefix("fd00::/8"),
+			},
+			RewriteIPv4: rewriteIPv4,
+			Enabled:     true,
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	f.SetEnabled(true)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  &testDHCP{},
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+		Logger:      slogutil.NewDiscardLogger(),
+	})
+	require.NoError(t, err)
+
+	newA := func(ip net.IP) (rr *dns.A) {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: aghtest.ReqFQDN, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   ip,
+		}
+	}
+
+	newAAAA := func(ip net.IP) (rr *dns.AAAA) {
+		return &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: aghtest.ReqFQDN, Rrtype: dns.TypeAAAA, Class: dns.ClassINET},
+			AAAA: ip,
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		clientName string
+		wantFilter string
+		respAns    []dns.RR
+		wantAns    []dns.RR
+	}{{
+		name:       "pass",
+		clientName: "",
+		wantFilter: "",
+		respAns:    []dns.RR{newA(publicIPv4)},
+		wantAns:    []dns.RR{newA(publicIPv4)},
+	}, {
+		name:       "block",
+		clientName: "",
+		wantFilter: "rebinding",
+		respAns:    []dns.RR{newA(publicIPv4), newA(privateIPv4)},
+		wantAns:    nil,
+	}, {
+		name:       "excepted",
+		clientName: excepted,
+		wantFilter: "",
+		respAns:    []dns.RR{newA(privateIPv4)},
+		wantAns:    []dns.RR{newA(privateIPv4)},
+	}, {
+		name:       "rewrite",
+		clientName: "",
+		wantFilter: "loopback",
+		respAns:    []dns.RR{newA(publicIPv4), newA(loopbackIP), newAAAA(privateIPv6)},
+		wantAns:    []dns.RR{newA(publicIPv4), newA(rewriteIPv4.AsSlice())},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestMessageWithType(aghtest.ReqFQDN, dns.TypeA)
+			resp := newResp(dns.RcodeSuccess, req, tc.respAns)
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Proto: proxy.ProtoUDP,
+					Req:   req,
+					Res:   resp,
+					Addr:  testClientAddrPort,
+				},
+				setts: &filtering.Settings{
+					ClientName:        tc.clientName,
+					ProtectionEnabled: true,
+					FilteringEnabled:  true,
+				},
+			}
+
+			err = s.filterDNSResponse(dctx)
+			require.NoError(t, err)
+
+			if tc.wantFilter == "" {
+				assert.Nil(t, dctx.result)
+				assert.Equal(t, tc.wantAns, dctx.proxyCtx.Res.Answer)
+
+				return
+			}
+
+			require.NotNil(t, dctx.result)
+
+			assert.Equal(t, filtering.FilteredAnswerIP, dctx.result.Reason)
+			assert.Equal(t, tc.wantFilter, dctx.result.AnswerFilter)
+			assert.Same(t, resp, dctx.origResp)
+
+			ans := dctx.proxyCtx.Res.Answer
+			if tc.wantAns != nil {
+				assert.Equal(t, tc.wantAns, ans)
+
+				return
+			}
+
+			require.Len(t, ans, 1)
+
+			a, ok := ans[0].(*dns.A)
+			require.True(t, ok)
+
+			assert.True(t, a.A.IsUnspecified())
+		})
+	}
+}
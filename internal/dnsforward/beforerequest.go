@@ -3,6 +3,7 @@ package dnsforward
 import (
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -15,14 +16,18 @@ import (
 var _ proxy.BeforeRequestHandler = (*Server)(nil)
 
 // HandleBefore is the handler that is called before any other processing,
-// including logs.  It performs access checks and puts the client ID, if there
-// is one, into the server's cache.
+// including logs.  It performs access checks, handles the malformed queries,
+// and puts the client ID, if there is one, into the server's cache.
 //
 // TODO(d.kolyshev): Extract to separate package.
 func (s *Server) HandleBefore(
 	_ *proxy.Proxy,
 	pctx *proxy.DNSContext,
 ) (err error) {
+	if s.malformed.isBanned(pctx.Addr.Addr(), time.Now()) {
+		return s.preBlockedResponse(pctx)
+	}
+
 	clientID, err := s.clientIDFromDNSContext(pctx)
 	if err != nil {
 		return &proxy.BeforeRequestError{
@@ -32,19 +37,23 @@ func (s *Server) HandleBefore(
 	}
 
 	blocked, _ := s.IsBlockedClient(pctx.Addr.Addr(), clientID)
-	if blocked {
+	if blocked || s.isBlockedEncryptedClient(pctx) {
 		return s.preBlockedResponse(pctx)
 	}
 
-	if len(pctx.Req.Question) == 1 {
-		q := pctx.Req.Question[0]
-		qt := q.Qtype
-		host := aghnet.NormalizeDomain(q.Name)
-		if s.access.isBlockedHost(host, qt) {
-			log.Debug("access: request %s %s is in access blocklist", dns.Type(qt), host)
+	err = s.handleMalformed(pctx)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
 
-			return s.preBlockedResponse(pctx)
-		}
+	q := pctx.Req.Question[0]
+	qt := q.Qtype
+	host := aghnet.NormalizeDomain(q.Name)
+	if s.access.isBlockedHost(host, qt) {
+		log.Debug("access: request %s %s is in access blocklist", dns.Type(qt), host)
+
+		return s.preBlockedResponse(pctx)
 	}
 
 	if clientID != "" {
@@ -60,15 +69,22 @@ func (s *Server) HandleBefore(
 // client's DoT or DoQ request or the path of the client's DoH.  If the protocol
 // is not one of these, clientID is an empty string and err is nil.
 func (s *Server) clientIDFromDNSContext(pctx *proxy.DNSContext) (clientID string, err error) {
+	// defaultID is the ClientID of the DNS-over-HTTPS endpoint used when
+	// there is no ClientID in the request.
+	var defaultID string
+
 	proto := pctx.Proto
 	if proto == proxy.ProtoHTTPS {
-		clientID, err = clientIDFromDNSContextHTTPS(pctx)
+		var e *DoHEndpoint
+		clientID, e, err = clientIDFromDNSContextHTTPS(pctx, s.conf.DoHEndpoints)
 		if err != nil {
 			return "", fmt.Errorf("checking url: %w", err)
 		} else if clientID != "" {
 			return clientID, nil
 		}
 
+		defaultID = e.ClientID
+
 		// Go on and check the domain name as well.
 	} else if proto != proxy.ProtoTLS && proto != proxy.ProtoQUIC {
 		return "", nil
@@ -76,7 +92,7 @@ func (s *Server) clientIDFromDNSContext(pctx *proxy.DNSContext) (clientID string
 
 	hostSrvName := s.conf.ServerName
 	if hostSrvName == "" {
-		return "", nil
+		return defaultID, nil
 	}
 
 	cliSrvName, err := clientServerName(pctx, proto)
@@ -91,6 +107,8 @@ func (s *Server) clientIDFromDNSContext(pctx *proxy.DNSContext) (clientID string
 	)
 	if err != nil {
 		return "", fmt.Errorf("clientid check: %w", err)
+	} else if clientID == "" {
+		return defaultID, nil
 	}
 
 	return clientID, nil
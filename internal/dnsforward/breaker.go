@@ -0,0 +1,359 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamBreakerConfig is the configuration of the concurrency limits and the
+// circuit breakers of the upstreams.
+type UpstreamBreakerConfig struct {
+	// OpenTimeout is the time the circuit of an upstream stays open before a
+	// single probe request is sent to it.  If zero,
+	// [defaultBreakerOpenTimeout] is used.
+	OpenTimeout timeutil.Duration `yaml:"open_timeout"`
+
+	// MaxConcurrent is the maximum number of concurrent requests to a single
+	// upstream.  The requests over it fail immediately, so that the next
+	// upstream is used.  If zero, the number isn't limited.
+	MaxConcurrent uint `yaml:"max_concurrent"`
+
+	// FailureThreshold is the number of consecutive failed exchanges with an
+	// upstream after which its circuit opens and the requests to it fail
+	// immediately.  If zero, the circuit never opens.
+	FailureThreshold uint `yaml:"failure_threshold"`
+}
+
+// defaultBreakerOpenTimeout is the default time the circuit of an upstream
+// stays open.
+const defaultBreakerOpenTimeout = 30 * time.Second
+
+// Errors returned by [breakerUpstream] instead of sending the request.
+const (
+	errBreakerOpen      errors.Error = "circuit breaker is open"
+	errConcurrencyLimit errors.Error = "too many concurrent requests"
+)
+
+// breakerState is the state of the circuit of a [breakerUpstream].
+type breakerState uint8
+
+// Valid breakerState values.
+const (
+	// breakerStateClosed means that the requests are sent to the upstream.
+	breakerStateClosed breakerState = iota
+
+	// breakerStateOpen means that the requests fail without being sent.
+	breakerStateOpen
+
+	// breakerStateHalfOpen means that a single probe request is sent to the
+	// upstream to decide whether the circuit should be closed.
+	breakerStateHalfOpen
+)
+
+// String implements the [fmt.Stringer] interface for breakerState.
+func (s breakerState) String() (str string) {
+	switch s {
+	case breakerStateClosed:
+		return "closed"
+	case breakerStateOpen:
+		return "open"
+	case breakerStateHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("!bad_breaker_state_%d", s)
+	}
+}
+
+// breakerUpstream is an [upstream.Upstream] that limits the number of
+// concurrent requests to the underlying upstream and stops sending them for a
+// while after several consecutive failures, so that a hung upstream doesn't
+// exhaust the goroutines and the file descriptors under load.
+type breakerUpstream struct {
+	upstream.Upstream
+
+	// events, if not nil, receives the events about the circuit opening.
+	events events.Publisher
+
+	// mu protects all fields below except the configuration ones.
+	mu *sync.Mutex
+
+	// openedAt is the time the circuit has been opened last.
+	openedAt time.Time
+
+	// stats are the counters of the requests.
+	stats breakerStats
+
+	// openTimeout is the time the circuit stays open.
+	openTimeout time.Duration
+
+	// maxConcurrent is the maximum number of requests in flight.  If zero,
+	// the number isn't limited.
+	maxConcurrent uint
+
+	// threshold is the number of consecutive failures opening the circuit.  If
+	// zero, the circuit never opens.
+	threshold uint
+
+	// inFlight is the number of requests in progress.
+	inFlight uint
+
+	// failures is the number of consecutive failures.
+	failures uint
+
+	// state is the current state of the circuit.
+	state breakerState
+
+	// probing is true while the probe request of the half-open circuit is in
+	// progress.
+	probing bool
+}
+
+// breakerStats are the counters of the requests to a [breakerUpstream].
+type breakerStats struct {
+	// Requests is the number of all requests, including the ones not sent.
+	Requests uint64 `json:"requests"`
+
+	// Failures is the number of failed exchanges.
+	Failures uint64 `json:"failures"`
+
+	// Rejected is the number of requests not sent because of the concurrency
+	// limit.
+	Rejected uint64 `json:"rejected"`
+
+	// ShortCircuited is the number of requests not sent because the circuit
+	// was open.
+	ShortCircuited uint64 `json:"short_circuited"`
+
+	// Opened is the number of times the circuit has been opened.
+	Opened uint64 `json:"opened"`
+}
+
+// type check
+var _ upstream.Upstream = (*breakerUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *breakerUpstream.
+func (u *breakerUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	probe, err := u.begin(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s: %w", u.Address(), err)
+	}
+
+	resp, err = u.Upstream.Exchange(req)
+	if u.end(time.Now(), probe, err != nil) {
+		u.publishDown(err)
+	}
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return resp, err
+}
+
+// begin returns an error if the request mustn't be sent to the upstream at
+// now.  Otherwise, it marks the request as in flight.  probe is true if it's
+// the probe request of the half-open circuit.
+func (u *breakerUpstream) begin(now time.Time) (probe bool, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.stats.Requests++
+
+	if u.maxConcurrent > 0 && u.inFlight >= u.maxConcurrent {
+		u.stats.Rejected++
+
+		return false, errConcurrencyLimit
+	}
+
+	switch u.state {
+	case breakerStateOpen:
+		if now.Sub(u.openedAt) < u.openTimeout {
+			u.stats.ShortCircuited++
+
+			return false, errBreakerOpen
+		}
+
+		log.Debug("dnsforward: upstream %s: circuit is half-open", u.Address())
+		u.state = breakerStateHalfOpen
+	case breakerStateHalfOpen:
+		if u.probing {
+			u.stats.ShortCircuited++
+
+			return false, errBreakerOpen
+		}
+	}
+
+	probe = u.state == breakerStateHalfOpen
+	u.probing = probe
+	u.inFlight++
+
+	return probe, nil
+}
+
+// end marks the request as finished at now and updates the state of the
+// circuit according to its result.  opened is true if the circuit has been
+// opened by the request.
+func (u *breakerUpstream) end(now time.Time, probe, failed bool) (opened bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.inFlight--
+	if probe {
+		u.probing = false
+	}
+
+	if !failed {
+		u.failures = 0
+		if probe {
+			log.Debug("dnsforward: upstream %s: circuit is closed", u.Address())
+			u.state = breakerStateClosed
+		}
+
+		return
+	}
+
+	u.stats.Failures++
+	u.failures++
+
+	if probe || (u.state == breakerStateClosed && u.threshold > 0 && u.failures >= u.threshold) {
+		log.Info("dnsforward: upstream %s: circuit is open after %d failures", u.Address(), u.failures)
+
+		u.state = breakerStateOpen
+		u.openedAt = now
+		u.stats.Opened++
+
+		return !probe
+	}
+
+	return false
+}
+
+// publishDown publishes the event about the circuit of u opening because of
+// err, if the events are configured.
+func (u *breakerUpstream) publishDown(err error) {
+	if u.events == nil {
+		return
+	}
+
+	addr := u.Address()
+	u.events.Publish(context.Background(), &events.Event{
+		Data: map[string]string{
+			"upstream": addr,
+			"error":    err.Error(),
+		},
+		Type:     events.TypeUpstreamDown,
+		Message:  fmt.Sprintf("upstream %s is down: %s", addr, err),
+		Severity: events.SeverityWarning,
+	})
+}
+
+// applyUpstreamBreakers validates conf and wraps the upstreams of uc with the
+// ones applying the concurrency limit and the circuit breaker.  conf may be
+// nil, in which case uc is left as is.  pub, if not nil, receives the events
+// about the circuits opening.  breakers are the wrapping upstreams.
+func applyUpstreamBreakers(
+	uc *proxy.UpstreamConfig,
+	conf *UpstreamBreakerConfig,
+	pub events.Publisher,
+) (breakers []*breakerUpstream, err error) {
+	if conf == nil {
+		return nil, nil
+	} else if conf.OpenTimeout.Duration < 0 {
+		return nil, fmt.Errorf("upstream breaker: open_timeout: %w", errors.ErrNegative)
+	}
+
+	if conf.MaxConcurrent == 0 && conf.FailureThreshold == 0 {
+		return nil, nil
+	}
+
+	wrapped := map[upstream.Upstream]*breakerUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			b, ok := wrapped[u]
+			if !ok {
+				b = &breakerUpstream{
+					Upstream:      u,
+					mu:            &sync.Mutex{},
+					openTimeout:   cmp.Or(conf.OpenTimeout.Duration, defaultBreakerOpenTimeout),
+					maxConcurrent: conf.MaxConcurrent,
+					threshold:     conf.FailureThreshold,
+				}
+				wrapped[u] = b
+				breakers = append(breakers, b)
+			}
+
+			ups[i] = b
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+
+	return breakers, nil
+}
+
+// upstreamBreakerJSON is the state of a single [breakerUpstream].
+type upstreamBreakerJSON struct {
+	breakerStats
+
+	// Upstream is the address of the upstream.
+	Upstream string `json:"upstream"`
+
+	// State is the state of the circuit.
+	State string `json:"state"`
+
+	// InFlight is the number of requests in progress.
+	InFlight uint `json:"in_flight"`
+}
+
+// upstreamBreakersJSON is the response to the GET /control/upstream_breakers
+// HTTP API.
+type upstreamBreakersJSON struct {
+	Upstreams []*upstreamBreakerJSON `json:"upstreams"`
+}
+
+// handleUpstreamBreakers is the handler for the GET /control/upstream_breakers
+// HTTP API.
+func (s *Server) handleUpstreamBreakers(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	resp := &upstreamBreakersJSON{
+		Upstreams: make([]*upstreamBreakerJSON, 0, len(s.upstreamBreakers)),
+	}
+
+	for _, b := range s.upstreamBreakers {
+		resp.Upstreams = append(resp.Upstreams, b.toJSON())
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// toJSON returns the current state of u.
+func (u *breakerUpstream) toJSON() (j *upstreamBreakerJSON) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return &upstreamBreakerJSON{
+		breakerStats: u.stats,
+		Upstream:     u.Address(),
+		State:        u.state.String(),
+		InFlight:     u.inFlight,
+	}
+}
@@ -0,0 +1,180 @@
+package dnsforward
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBreakerTestUpstream returns a *breakerUpstream with the given limits over a
+// mock upstream, which fails while *fail is true.
+func newBreakerTestUpstream(maxConcurrent, threshold uint, fail *bool) (b *breakerUpstream) {
+	return &breakerUpstream{
+		Upstream: &aghtest.UpstreamMock{
+			OnAddress: func() (addr string) { return "udp://192.0.2.1:53" },
+			OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+				if *fail {
+					return nil, errors.Error("test error")
+				}
+
+				return (&dns.Msg{}).SetReply(req), nil
+			},
+			OnClose: func() (err error) { return nil },
+		},
+		mu:            &sync.Mutex{},
+		openTimeout:   time.Minute,
+		maxConcurrent: maxConcurrent,
+		threshold:     threshold,
+	}
+}
+
+// testPublisher is the [events.Publisher] for tests.
+type testPublisher struct {
+	evs []*events.Event
+}
+
+// Publish implements the [events.Publisher] interface for *testPublisher.
+func (p *testPublisher) Publish(_ context.Context, e *events.Event) {
+	p.evs = append(p.evs, e)
+}
+
+func TestBreakerUpstream_Exchange(t *testing.T) {
+	const threshold = 3
+
+	req := createTestMessage("example.org.")
+
+	t.Run("circuit", func(t *testing.T) {
+		fail := true
+		b := newBreakerTestUpstream(0, threshold, &fail)
+
+		pub := &testPublisher{}
+		b.events = pub
+
+		for range threshold {
+			_, err := b.Exchange(req)
+			testutil.AssertErrorMsg(t, "test error", err)
+		}
+
+		require.Equal(t, breakerStateOpen, b.state)
+
+		_, err := b.Exchange(req)
+		assert.ErrorIs(t, err, errBreakerOpen)
+
+		// Let the open timeout pass, and make the probe fail.
+		b.openedAt = b.openedAt.Add(-b.openTimeout)
+
+		_, err = b.Exchange(req)
+		testutil.AssertErrorMsg(t, "test error", err)
+
+		require.Equal(t, breakerStateOpen, b.state)
+
+		// Let the open timeout pass again, and make the probe succeed.
+		b.openedAt = b.openedAt.Add(-b.openTimeout)
+		fail = false
+
+		_, err = b.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, breakerStateClosed, b.state)
+		assert.Equal(t, breakerStats{
+			Requests:       6,
+			Failures:       4,
+			Rejected:       0,
+			ShortCircuited: 1,
+			Opened:         2,
+		}, b.stats)
+
+		// Only the first opening of the circuit is reported, since the failed
+		// probe means that the upstream is still down.
+		require.Len(t, pub.evs, 1)
+
+		assert.Equal(t, events.TypeUpstreamDown, pub.evs[0].Type)
+		assert.Equal(t, "udp://192.0.2.1:53", pub.evs[0].Data["upstream"])
+	})
+
+	t.Run("half_open", func(t *testing.T) {
+		fail := false
+		b := newBreakerTestUpstream(0, threshold, &fail)
+		b.state = breakerStateOpen
+
+		now := time.Now()
+		probe, err := b.begin(now)
+		require.NoError(t, err)
+		require.True(t, probe)
+
+		// Only a single probe is allowed at a time.
+		_, err = b.begin(now)
+		assert.ErrorIs(t, err, errBreakerOpen)
+
+		b.end(now, probe, false)
+
+		assert.Equal(t, breakerStateClosed, b.state)
+		assert.Zero(t, b.inFlight)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		const maxConcurrent = 2
+
+		fail := false
+		b := newBreakerTestUpstream(maxConcurrent, 0, &fail)
+
+		now := time.Now()
+		for range maxConcurrent {
+			_, err := b.begin(now)
+			require.NoError(t, err)
+		}
+
+		_, err := b.Exchange(req)
+		assert.ErrorIs(t, err, errConcurrencyLimit)
+
+		b.end(now, false, false)
+
+		_, err = b.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint(1), b.inFlight)
+		assert.Equal(t, uint64(1), b.stats.Rejected)
+	})
+}
+
+func TestApplyUpstreamBreakers(t *testing.T) {
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		"127.0.0.1:53",
+		"[/example.org/]127.0.0.1:53",
+	}, &upstream.Options{})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+	breakers, err := applyUpstreamBreakers(uc, &UpstreamBreakerConfig{}, nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, breakers)
+
+	breakers, err = applyUpstreamBreakers(uc, &UpstreamBreakerConfig{
+		FailureThreshold: 5,
+	}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, breakers, 1)
+
+	assert.Equal(t, defaultBreakerOpenTimeout, breakers[0].openTimeout)
+	assert.Same(t, breakers[0], uc.Upstreams[0])
+	assert.Same(t, breakers[0], uc.DomainReservedUpstreams["example.org."][0])
+
+	_, err = applyUpstreamBreakers(uc, &UpstreamBreakerConfig{
+		OpenTimeout: timeutil.Duration{Duration: -time.Second},
+	}, nil)
+	testutil.AssertErrorMsg(t, "upstream breaker: open_timeout: negative value", err)
+}
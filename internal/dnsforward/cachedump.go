@@ -0,0 +1,586 @@
+package dnsforward
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
+	"github.com/miekg/dns"
+)
+
+// cacheDumpKey is the key of a persisted response.
+type cacheDumpKey struct {
+	// name is the lowercased FQDN from the question.
+	name string
+
+	qtype  uint16
+	qclass uint16
+
+	// do is true if the DNSSEC OK bit is set in the request.
+	do bool
+}
+
+// newCacheDumpKey returns the key of the response to req.  req must have
+// exactly one question.
+func newCacheDumpKey(req *dns.Msg) (k cacheDumpKey) {
+	q := req.Question[0]
+
+	return cacheDumpKey{
+		name:   strings.ToLower(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+		do:     hasDO(req),
+	}
+}
+
+// cacheDumpItem is a single persisted response.
+type cacheDumpItem struct {
+	// Expires is the time when the response expires.
+	Expires time.Time `json:"expires"`
+
+	// Upstream is the address of the upstream that sent the response.
+	Upstream string `json:"upstream"`
+
+	// Msg is the packed response.
+	Msg []byte `json:"msg"`
+
+	// DO is true if the response was sent to a request with the DNSSEC OK bit
+	// set.
+	DO bool `json:"do"`
+}
+
+// cachePersister keeps the recent cacheable upstream responses to persist them
+// across restarts and to inspect them via the HTTP API, since module dnsproxy
+// doesn't expose the contents of its cache.  It also answers the requests with
+// the restored ones until they expire.  The responses are only recorded if the
+// cache dump is configured, see [Server.recordCacheDump].
+type cachePersister struct {
+	// mu protects all fields.
+	mu *sync.Mutex
+
+	// journal are the recent cacheable upstream responses.
+	journal map[cacheDumpKey]*cacheDumpItem
+
+	// restored are the responses restored from the dump.
+	restored map[cacheDumpKey]*cacheDumpItem
+
+	// size is the total size of the packed responses in journal.
+	size int
+
+	// restoredSize is the total size of the packed responses in restored.
+	restoredSize int
+
+	// maxSize is the maximum total size of the packed responses in journal
+	// and, separately, in restored.
+	maxSize int
+
+	// loaded is true if the dump has already been loaded.
+	loaded bool
+}
+
+// newCachePersister returns a new properly initialized *cachePersister with
+// the limit of maxSize bytes of the recorded responses.
+func newCachePersister(maxSize int) (p *cachePersister) {
+	return &cachePersister{
+		mu:       &sync.Mutex{},
+		journal:  map[cacheDumpKey]*cacheDumpItem{},
+		restored: map[cacheDumpKey]*cacheDumpItem{},
+		maxSize:  maxSize,
+	}
+}
+
+// record stores the response resp to req from the upstream with addr if it's
+// cacheable for ttl seconds.
+func (p *cachePersister) record(req, resp *dns.Msg, addr string, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		log.Debug("dnsforward: cache dump: packing response: %s", err)
+
+		return
+	}
+
+	k := newCacheDumpKey(req)
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if prev, ok := p.journal[k]; ok {
+		p.size -= len(prev.Msg)
+		delete(p.journal, k)
+	}
+
+	if p.size+len(packed) > p.maxSize {
+		p.removeExpiredLocked(now)
+		if p.size+len(packed) > p.maxSize {
+			return
+		}
+	}
+
+	p.journal[k] = &cacheDumpItem{
+		Expires:  now.Add(time.Duration(ttl) * time.Second),
+		Upstream: addr,
+		Msg:      packed,
+		DO:       k.do,
+	}
+	p.size += len(packed)
+}
+
+// addRestoredLocked adds item as the restored response for k, unless the total
+// size of the restored responses would exceed p.maxSize even after removing the
+// ones expired at now.  ok is true if item has been added.  p.mu is expected to
+// be locked.
+func (p *cachePersister) addRestoredLocked(k cacheDumpKey, item *cacheDumpItem, now time.Time) (ok bool) {
+	p.deleteRestoredLocked(k)
+
+	if p.restoredSize+len(item.Msg) > p.maxSize {
+		for rk, ri := range p.restored {
+			if !ri.Expires.After(now) {
+				p.deleteRestoredLocked(rk)
+			}
+		}
+
+		if p.restoredSize+len(item.Msg) > p.maxSize {
+			return false
+		}
+	}
+
+	p.restored[k] = item
+	p.restoredSize += len(item.Msg)
+
+	return true
+}
+
+// deleteRestoredLocked removes the restored response for k, if any.  p.mu is
+// expected to be locked.
+func (p *cachePersister) deleteRestoredLocked(k cacheDumpKey) {
+	if item, ok := p.restored[k]; ok {
+		p.restoredSize -= len(item.Msg)
+		delete(p.restored, k)
+	}
+}
+
+// removeExpiredLocked removes the responses expired at now from the journal.
+// p.mu is expected to be locked.
+func (p *cachePersister) removeExpiredLocked(now time.Time) {
+	for k, item := range p.journal {
+		if !item.Expires.After(now) {
+			p.size -= len(item.Msg)
+			delete(p.journal, k)
+		}
+	}
+}
+
+// restoredResponse returns the restored response to req with the TTLs
+// decreased by the time passed since it was received, if any.  addr is the
+// address of the upstream that sent it.
+func (p *cachePersister) restoredResponse(req *dns.Msg) (resp *dns.Msg, addr string) {
+	k := newCacheDumpKey(req)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item, ok := p.restored[k]
+	if !ok {
+		return nil, ""
+	}
+
+	left := time.Until(item.Expires)
+	if left < time.Second {
+		p.deleteRestoredLocked(k)
+
+		return nil, ""
+	}
+
+	resp = &dns.Msg{}
+	err := resp.Unpack(item.Msg)
+	if err != nil {
+		log.Debug("dnsforward: cache dump: unpacking response for %q: %s", k.name, err)
+		p.deleteRestoredLocked(k)
+
+		return nil, ""
+	}
+
+	resp.Id = req.Id
+	setRespTTL(resp, uint32(left/time.Second))
+
+	return resp, item.Upstream
+}
+
+// setRespTTL sets the TTLs of all resource records of resp except OPT to ttl,
+// if they are greater.
+func setRespTTL(resp *dns.Msg, ttl uint32) {
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			h := rr.Header()
+			if h.Rrtype != dns.TypeOPT && h.Ttl > ttl {
+				h.Ttl = ttl
+			}
+		}
+	}
+}
+
+// setMaxSize sets the maximum total size of the recorded responses.  first is
+// true if it's called for the first time, so that the dump should be loaded.
+func (p *cachePersister) setMaxSize(maxSize int) (first bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxSize = maxSize
+	first, p.loaded = !p.loaded, true
+
+	return first
+}
+
+// clear removes all stored responses.
+func (p *cachePersister) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clear(p.journal)
+	clear(p.restored)
+	p.size, p.restoredSize = 0, 0
+}
+
+// cacheEntry is a single unexpired response known to the cache persister.
+type cacheEntry struct {
+	// item is the response.  It must not be nil.
+	item *cacheDumpItem
+
+	// key is the key of the response.
+	key cacheDumpKey
+
+	// restored is true if the response has been restored from the dump.
+	restored bool
+}
+
+// entries returns the unexpired responses, for which match returns true, sorted
+// by name and type.  The recorded responses take precedence over the restored
+// ones with the same key.
+func (p *cachePersister) entries(now time.Time, match func(name string) (ok bool)) (es []*cacheEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, item := range p.journal {
+		if item.Expires.After(now) && match(k.name) {
+			es = append(es, &cacheEntry{item: item, key: k, restored: false})
+		}
+	}
+
+	for k, item := range p.restored {
+		if _, ok := p.journal[k]; !ok && item.Expires.After(now) && match(k.name) {
+			es = append(es, &cacheEntry{item: item, key: k, restored: true})
+		}
+	}
+
+	slices.SortFunc(es, func(a, b *cacheEntry) (res int) {
+		return cmp.Or(
+			strings.Compare(a.key.name, b.key.name),
+			cmp.Compare(a.key.qtype, b.key.qtype),
+			cmp.Compare(a.key.qclass, b.key.qclass),
+			compareBools(a.key.do, b.key.do),
+		)
+	})
+
+	return es
+}
+
+// compareBools compares a and b, false being less than true.
+func compareBools(a, b bool) (res int) {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// purge removes the restored responses for name, which must be a lowercased
+// FQDN, and also for its subdomains if subtree is true.  Since module dnsproxy
+// can only clear the whole cache, which purging is followed by, all recorded
+// responses are removed as well.  n is the number of the removed responses for
+// name.
+func (p *cachePersister) purge(name string, subtree bool) (n int) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, item := range p.journal {
+		if item.Expires.After(now) && matchesPurge(k.name, name, subtree) {
+			n++
+		}
+	}
+
+	for k, item := range p.restored {
+		_, recorded := p.journal[k]
+		if !matchesPurge(k.name, name, subtree) && item.Expires.After(now) {
+			continue
+		} else if !recorded && item.Expires.After(now) {
+			n++
+		}
+
+		p.deleteRestoredLocked(k)
+	}
+
+	clear(p.journal)
+	p.size = 0
+
+	return n
+}
+
+// matchesPurge returns true if the response for qname should be purged by the
+// request to purge name, optionally with its subtree.  Both names must be
+// lowercased FQDNs.
+func matchesPurge(qname, name string, subtree bool) (ok bool) {
+	if qname == name {
+		return true
+	}
+
+	return subtree && (name == "." || strings.HasSuffix(qname, "."+name))
+}
+
+// dump writes the unexpired recorded and restored responses to w as JSON.
+func (p *cachePersister) dump(w io.Writer) (err error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	items := make([]*cacheDumpItem, 0, len(p.journal)+len(p.restored))
+	for k, item := range p.restored {
+		if _, ok := p.journal[k]; !ok && item.Expires.After(now) {
+			items = append(items, item)
+		}
+	}
+
+	for _, item := range p.journal {
+		if item.Expires.After(now) {
+			items = append(items, item)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(items)
+}
+
+// restore reads the responses dumped by [cachePersister.dump] from r and uses
+// the unexpired ones to answer the requests.  The responses exceeding the size
+// limit are skipped.
+func (p *cachePersister) restore(r io.Reader) (err error) {
+	var items []*cacheDumpItem
+	err = json.NewDecoder(r).Decode(&items)
+	if err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	}
+
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	skipped := 0
+	for i, item := range items {
+		if !item.Expires.After(now) {
+			continue
+		}
+
+		resp := &dns.Msg{}
+		err = resp.Unpack(item.Msg)
+		if err != nil {
+			return fmt.Errorf("item at index %d: unpacking: %w", i, err)
+		} else if len(resp.Question) != 1 {
+			return fmt.Errorf("item at index %d: bad number of questions %d", i, len(resp.Question))
+		}
+
+		q := resp.Question[0]
+		k := cacheDumpKey{
+			name:   strings.ToLower(q.Name),
+			qtype:  q.Qtype,
+			qclass: q.Qclass,
+			do:     item.DO,
+		}
+
+		if !p.addRestoredLocked(k, item, now) {
+			skipped++
+		}
+	}
+
+	if skipped > 0 {
+		log.Info("dnsforward: cache dump: skipped %d responses exceeding cache size", skipped)
+	}
+
+	return nil
+}
+
+// DumpCache writes the recent cacheable responses from the upstreams, which
+// are assumed to be in the DNS cache, to w in a format suitable for
+// [Server.RestoreCache].
+func (s *Server) DumpCache(w io.Writer) (err error) {
+	return s.cachePersist.dump(w)
+}
+
+// RestoreCache reads the responses written by [Server.DumpCache] from r and
+// uses them to answer the requests until their TTLs expire.
+func (s *Server) RestoreCache(r io.Reader) (err error) {
+	return s.cachePersist.restore(r)
+}
+
+// restoreCacheLocked restores the DNS cache from the dump file, if it's
+// configured, once per the lifetime of s.  It also applies the current cache
+// size to the recorded responses.  s.serverLock is expected to be locked.
+func (s *Server) restoreCacheLocked() {
+	if s.conf.CacheSize == 0 {
+		return
+	}
+
+	p := s.cachePersist
+	if !p.setMaxSize(int(s.conf.CacheSize)) || s.conf.CacheDumpPath == "" {
+		return
+	}
+
+	f, err := os.Open(s.conf.CacheDumpPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Error("dnsforward: restoring cache: %s", err)
+		}
+
+		return
+	}
+	defer logCloserErr(f, "dnsforward: closing cache dump %q: %s", s.conf.CacheDumpPath)
+
+	err = p.restore(f)
+	if err != nil {
+		log.Error("dnsforward: restoring cache from %q: %s", s.conf.CacheDumpPath, err)
+
+		return
+	}
+
+	log.Info("dnsforward: restored cache from %q", s.conf.CacheDumpPath)
+}
+
+// dumpCacheLocked writes the DNS cache to the dump file, if it's configured.
+// s.serverLock is expected to be locked.
+func (s *Server) dumpCacheLocked() {
+	if s.conf.CacheDumpPath == "" || s.conf.CacheSize == 0 {
+		return
+	}
+
+	buf := &strings.Builder{}
+	err := s.cachePersist.dump(buf)
+	if err != nil {
+		log.Error("dnsforward: dumping cache: %s", err)
+
+		return
+	}
+
+	err = maybe.WriteFile(s.conf.CacheDumpPath, []byte(buf.String()), aghos.DefaultPermFile)
+	if err != nil {
+		log.Error("dnsforward: dumping cache: %s", err)
+
+		return
+	}
+
+	log.Info("dnsforward: dumped cache to %q", s.conf.CacheDumpPath)
+}
+
+// recordCacheDump records the response in pctx for the cache dump and the cache
+// HTTP API, if it has just been received from a shared upstream and is
+// cacheable.  Since that keeps a packed copy of each such response in addition
+// to the cache of module dnsproxy, it does nothing unless the cache dump is
+// configured.
+func (s *Server) recordCacheDump(pctx *proxy.DNSContext) {
+	switch {
+	case
+		s.conf.CacheSize == 0,
+		s.conf.CacheDumpPath == "",
+		pctx.Upstream == nil,
+		pctx.Res == nil,
+		pctx.CustomUpstreamConfig != nil,
+		pctx.RequestedPrivateRDNS.IsValid(),
+		pctx.ReqECS != nil,
+		pctx.Req.CheckingDisabled:
+		return
+	}
+
+	rc := pctx.Res.Rcode
+	if rc != dns.RcodeSuccess && rc != dns.RcodeNameError {
+		return
+	}
+
+	ttl := respectTTLBounds(respMinTTL(pctx.Res), s.conf.CacheMinTTL, s.conf.CacheMaxTTL)
+	s.cachePersist.record(pctx.Req, pctx.Res, pctx.Upstream.Address(), ttl)
+}
+
+// respMinTTL returns the minimum TTL of the resource records of resp except
+// OPT, or zero if there are none.
+func respMinTTL(resp *dns.Msg) (ttl uint32) {
+	found := false
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			if !found || h.Ttl < ttl {
+				ttl, found = h.Ttl, true
+			}
+		}
+	}
+
+	return ttl
+}
+
+// respectTTLBounds returns ttl bounded by the configured minimum and maximum
+// values of the cache TTL, if they're set.  A zero ttl is kept.
+func respectTTLBounds(ttl, minTTL, maxTTL uint32) (res uint32) {
+	switch {
+	case ttl == 0:
+		return 0
+	case minTTL != 0 && ttl < minTTL:
+		return minTTL
+	case maxTTL != 0 && ttl > maxTTL:
+		return maxTTL
+	default:
+		return ttl
+	}
+}
+
+// setRestoredResp sets the restored response to the request in pctx, if any.
+// ok is true if the response has been set.
+func (s *Server) setRestoredResp(pctx *proxy.DNSContext) (ok bool) {
+	if s.conf.CacheSize == 0 ||
+		pctx.CustomUpstreamConfig != nil ||
+		pctx.RequestedPrivateRDNS.IsValid() ||
+		pctx.ReqECS != nil ||
+		pctx.Req.CheckingDisabled {
+		return false
+	}
+
+	resp, addr := s.cachePersist.restoredResponse(pctx.Req)
+	if resp == nil {
+		return false
+	}
+
+	pctx.Res = resp
+	pctx.CachedUpstreamAddr = addr
+
+	return true
+}
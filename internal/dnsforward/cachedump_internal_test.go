@@ -0,0 +1,297 @@
+package dnsforward
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCacheDumpResp returns a new response to req with a single A record
+// with ttl.
+func newTestCacheDumpResp(t *testing.T, req *dns.Msg, ttl uint32) (resp *dns.Msg) {
+	t.Helper()
+
+	resp = (&dns.Msg{}).SetReply(req)
+	resp.Answer = append(resp.Answer, newRR(t, req.Question[0].Name, dns.TypeA, ttl, net.IP{1, 2, 3, 4}))
+
+	return resp
+}
+
+func TestCachePersister(t *testing.T) {
+	const upsAddr = "tls://dns.example"
+
+	reqHost := createTestMessage("host.example.")
+	reqOther := createTestMessage("other.example.")
+	reqExpired := createTestMessage("expired.example.")
+
+	p := newCachePersister(1024)
+	p.record(reqHost, newTestCacheDumpResp(t, reqHost, 3600), upsAddr, 3600)
+	p.record(reqOther, newTestCacheDumpResp(t, reqOther, 3600), upsAddr, 0)
+	p.record(reqExpired, newTestCacheDumpResp(t, reqExpired, 3600), upsAddr, 3600)
+
+	p.journal[newCacheDumpKey(reqExpired)].Expires = time.Now().Add(-time.Second)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, p.dump(buf))
+
+	restored := newCachePersister(1024)
+	require.NoError(t, restored.restore(buf))
+	require.Len(t, restored.restored, 1)
+
+	// Make the restored response one minute older.
+	item := restored.restored[newCacheDumpKey(reqHost)]
+	require.NotNil(t, item)
+
+	item.Expires = item.Expires.Add(-time.Minute)
+
+	req := createTestMessage("HOST.example.")
+	resp, addr := restored.restoredResponse(req)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+
+	assert.Equal(t, upsAddr, addr)
+	assert.Equal(t, req.Id, resp.Id)
+	assert.InDelta(t, 3600-60, resp.Answer[0].Header().Ttl, 1)
+
+	resp, _ = restored.restoredResponse(reqOther)
+	assert.Nil(t, resp)
+
+	restored.clear()
+	resp, _ = restored.restoredResponse(reqHost)
+	assert.Nil(t, resp)
+}
+
+func TestCachePersister_record_size(t *testing.T) {
+	req := createTestMessage("first.example.")
+	resp := newTestCacheDumpResp(t, req, 3600)
+
+	packed, err := resp.Pack()
+	require.NoError(t, err)
+
+	p := newCachePersister(len(packed))
+	p.record(req, resp, "", 3600)
+	require.Len(t, p.journal, 1)
+
+	// Use a name of the same length for the same size of the response.
+	reqOther := createTestMessage("other.example.")
+	p.record(reqOther, newTestCacheDumpResp(t, reqOther, 3600), "", 3600)
+	assert.Len(t, p.journal, 1)
+
+	// Replacing the response to the same request keeps the size.
+	p.record(req, resp, "", 60)
+	assert.Len(t, p.journal, 1)
+	assert.Equal(t, len(packed), p.size)
+
+	p.journal[newCacheDumpKey(req)].Expires = time.Now().Add(-time.Second)
+	p.record(reqOther, newTestCacheDumpResp(t, reqOther, 3600), "", 3600)
+	require.Len(t, p.journal, 1)
+
+	assert.Contains(t, p.journal, newCacheDumpKey(reqOther))
+}
+
+func TestCachePersister_restore_bad(t *testing.T) {
+	p := newCachePersister(1024)
+
+	err := p.restore(bytes.NewBufferString("bad"))
+	testutil.AssertErrorMsg(t, "decoding: invalid character 'b' looking for beginning of value", err)
+
+	err = p.restore(bytes.NewBufferString(`[{"expires":"2999-01-01T00:00:00Z","msg":"AAAA"}]`))
+	assert.Error(t, err)
+}
+
+func TestCachePersister_restore_size(t *testing.T) {
+	req := createTestMessage("first.example.")
+	resp := newTestCacheDumpResp(t, req, 3600)
+
+	packed, err := resp.Pack()
+	require.NoError(t, err)
+
+	// Use a name of the same length for the same size of the response.
+	reqOther := createTestMessage("other.example.")
+
+	src := newCachePersister(2 * len(packed))
+	src.record(req, resp, "", 3600)
+	src.record(reqOther, newTestCacheDumpResp(t, reqOther, 3600), "", 3600)
+	require.Len(t, src.journal, 2)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, src.dump(buf))
+
+	p := newCachePersister(len(packed))
+	require.NoError(t, p.restore(buf))
+
+	assert.Len(t, p.restored, 1)
+	assert.Equal(t, len(packed), p.restoredSize)
+}
+
+func TestCachePersister_purge(t *testing.T) {
+	names := []string{
+		"example.",
+		"host.example.",
+		"sub.host.example.",
+		"otherhost.example.",
+	}
+
+	testCases := []struct {
+		name      string
+		purged    string
+		wantNames []string
+		subtree   bool
+	}{{
+		name:      "name",
+		purged:    "host.example.",
+		wantNames: []string{"example.", "otherhost.example.", "sub.host.example."},
+		subtree:   false,
+	}, {
+		name:      "subtree",
+		purged:    "host.example.",
+		wantNames: []string{"example.", "otherhost.example."},
+		subtree:   true,
+	}, {
+		name:      "all",
+		purged:    "example.",
+		wantNames: nil,
+		subtree:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := newCachePersister(4096)
+			for _, n := range names {
+				req := createTestMessage(n)
+				src.record(req, newTestCacheDumpResp(t, req, 3600), "", 3600)
+			}
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, src.dump(buf))
+
+			p := newCachePersister(4096)
+			require.NoError(t, p.restore(buf))
+
+			// The recorded responses for the same names are only counted once.
+			for _, n := range names[:2] {
+				req := createTestMessage(n)
+				p.record(req, newTestCacheDumpResp(t, req, 3600), "", 3600)
+			}
+
+			n := p.purge(tc.purged, tc.subtree)
+			assert.Equal(t, len(names)-len(tc.wantNames), n)
+
+			// The whole cache of module dnsproxy is cleared, so the recorded
+			// responses for the other names are removed as well.
+			assert.Empty(t, p.journal)
+			assert.Zero(t, p.size)
+
+			var gotNames []string
+			for _, e := range p.entries(time.Now(), newCacheMatcher("")) {
+				assert.True(t, e.restored)
+				gotNames = append(gotNames, e.key.name)
+			}
+
+			assert.Equal(t, tc.wantNames, gotNames)
+
+			for _, want := range tc.wantNames {
+				resp, _ := p.restoredResponse(createTestMessage(want))
+				assert.NotNil(t, resp)
+			}
+		})
+	}
+}
+
+func TestServer_recordCacheDump(t *testing.T) {
+	ups := &aghtest.UpstreamMock{
+		OnAddress:  func() (addr string) { return "192.0.2.1:53" },
+		OnExchange: func(_ *dns.Msg) (resp *dns.Msg, err error) { panic("not implemented") },
+		OnClose:    func() (err error) { panic("not implemented") },
+	}
+
+	testCases := []struct {
+		name     string
+		dumpPath string
+		want     int
+	}{{
+		name:     "dump",
+		dumpPath: "cache.json",
+		want:     1,
+	}, {
+		name:     "no_dump",
+		dumpPath: "",
+		want:     0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				cachePersist: newCachePersister(4096),
+				conf: ServerConfig{
+					Config: Config{
+						CacheSize:     4096,
+						CacheDumpPath: tc.dumpPath,
+					},
+				},
+			}
+
+			req := createTestMessage("host.example.")
+			s.recordCacheDump(&proxy.DNSContext{
+				Req:      req,
+				Res:      newTestCacheDumpResp(t, req, 3600),
+				Upstream: ups,
+			})
+
+			assert.Len(t, s.cachePersist.journal, tc.want)
+		})
+	}
+}
+
+func TestNewCacheMatcher(t *testing.T) {
+	testCases := []struct {
+		want   assert.BoolAssertionFunc
+		name   string
+		search string
+		qname  string
+	}{{
+		want:   assert.True,
+		name:   "empty",
+		search: "",
+		qname:  "host.example.",
+	}, {
+		want:   assert.True,
+		name:   "substring",
+		search: "ST.EX",
+		qname:  "host.example.",
+	}, {
+		want:   assert.False,
+		name:   "substring_dot",
+		search: "example.",
+		qname:  "host.example.",
+	}, {
+		want:   assert.True,
+		name:   "subtree_name",
+		search: "*.example",
+		qname:  "example.",
+	}, {
+		want:   assert.True,
+		name:   "subtree_sub",
+		search: "*.example",
+		qname:  "host.example.",
+	}, {
+		want:   assert.False,
+		name:   "subtree_other",
+		search: "*.example",
+		qname:  "otherexample.",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, newCacheMatcher(tc.search)(tc.qname))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultCacheEntriesLimit is the default maximum number of the entries
+	// returned by the GET /control/cache HTTP API.
+	defaultCacheEntriesLimit = 100
+
+	// maxCacheEntriesLimit is the maximum number of the entries, which can be
+	// requested from the GET /control/cache HTTP API.
+	maxCacheEntriesLimit = 1000
+)
+
+// cacheEntryJSON is a single entry of the DNS cache in the HTTP API.
+type cacheEntryJSON struct {
+	// Name is the requested domain name without the trailing dot.
+	Name string `json:"name"`
+
+	// Type is the requested resource record type, for example "AAAA".
+	Type string `json:"type"`
+
+	// Upstream is the address of the upstream, which has sent the response.
+	Upstream string `json:"upstream"`
+
+	// TTL is the number of seconds until the entry expires.
+	TTL uint32 `json:"ttl"`
+
+	// DNSSECOK is true if the response has been sent to a request with the
+	// DNSSEC OK bit set.
+	DNSSECOK bool `json:"dnssec_ok"`
+
+	// Restored is true if the response is answered by AdGuard Home itself
+	// instead of the cache of module dnsproxy, which is the case after a
+	// restart with a cache dump.
+	Restored bool `json:"restored"`
+}
+
+// cacheJSON is the response to the GET /control/cache HTTP API.
+type cacheJSON struct {
+	// Entries are the matching entries, no more than the requested limit.
+	Entries []*cacheEntryJSON `json:"entries"`
+
+	// Total is the total number of the matching entries.
+	Total int `json:"total"`
+}
+
+// handleCache is the handler for the GET /control/cache HTTP API.  The search
+// query parameter is either a pattern like "*.example.com", matching the name
+// and its subdomains, or a substring of the names.  The limit query parameter
+// is the maximum number of the returned entries.
+//
+// Only the cacheable responses from the shared upstreams are tracked, and only
+// if the cache dump is configured, see [Server.recordCacheDump].
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultCacheEntriesLimit
+	if limitStr := q.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxCacheEntriesLimit {
+			aghhttp.Error(
+				r,
+				w,
+				http.StatusBadRequest,
+				"limit: must be an integer from 1 to %d, got %q",
+				maxCacheEntriesLimit,
+				limitStr,
+			)
+
+			return
+		}
+	}
+
+	now := time.Now()
+	es := s.cachePersist.entries(now, newCacheMatcher(q.Get("search")))
+
+	resp := &cacheJSON{
+		Entries: make([]*cacheEntryJSON, 0, min(len(es), limit)),
+		Total:   len(es),
+	}
+
+	for _, e := range es[:min(len(es), limit)] {
+		resp.Entries = append(resp.Entries, &cacheEntryJSON{
+			Name:     strings.TrimSuffix(e.key.name, "."),
+			Type:     dns.Type(e.key.qtype).String(),
+			Upstream: e.item.Upstream,
+			TTL:      uint32(e.item.Expires.Sub(now) / time.Second),
+			DNSSECOK: e.key.do,
+			Restored: e.restored,
+		})
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// newCacheMatcher returns a function matching the lowercased FQDNs by the
+// search pattern of the GET /control/cache HTTP API.
+func newCacheMatcher(search string) (match func(name string) (ok bool)) {
+	search = strings.ToLower(search)
+	if search == "" {
+		return func(_ string) (ok bool) { return true }
+	}
+
+	if suffix, ok := strings.CutPrefix(search, "*."); ok {
+		name := dns.Fqdn(suffix)
+
+		return func(qname string) (ok bool) { return matchesPurge(qname, name, true) }
+	}
+
+	return func(qname string) (ok bool) {
+		return strings.Contains(strings.TrimSuffix(qname, "."), search)
+	}
+}
+
+// cachePurgeReq is the request to the POST /control/cache/purge HTTP API.
+type cachePurgeReq struct {
+	// Name is the domain name to purge.
+	Name string `json:"name"`
+
+	// Subtree, if true, also purges the subdomains of Name.
+	Subtree bool `json:"subtree"`
+}
+
+// cachePurgeResp is the response to the POST /control/cache/purge HTTP API.
+type cachePurgeResp struct {
+	// Purged is the number of the purged entries for the name tracked by
+	// AdGuard Home.
+	Purged int `json:"purged"`
+}
+
+// handleCachePurge is the handler for the POST /control/cache/purge HTTP API.
+//
+// TODO:  Module dnsproxy can only clear the whole cache, so the
+// responses for the other names are dropped as well, see
+// [cachePersister.purge].  Remove only the ones for the name once it supports
+// that.
+func (s *Server) handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	req := &cachePurgeReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	name, err := aghnet.ParseDomainName(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "name: %s", err)
+
+		return
+	}
+
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	n := s.cachePersist.purge(dns.Fqdn(name), req.Subtree)
+	s.dnsProxy.ClearCache()
+
+	aghhttp.WriteJSONResponseOK(w, r, &cachePurgeResp{Purged: n})
+}
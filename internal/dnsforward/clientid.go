@@ -3,7 +3,6 @@ package dnsforward
 import (
 	"crypto/tls"
 	"fmt"
-	"path"
 	"strings"
 
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -62,42 +61,39 @@ func clientIDFromClientServerName(
 }
 
 // clientIDFromDNSContextHTTPS extracts the client's ID from the path of the
-// client's DNS-over-HTTPS request.
-func clientIDFromDNSContextHTTPS(pctx *proxy.DNSContext) (clientID string, err error) {
+// client's DNS-over-HTTPS request.  e is the endpoint serving the request.
+// endpoints must be valid.
+func clientIDFromDNSContextHTTPS(
+	pctx *proxy.DNSContext,
+	endpoints []*DoHEndpoint,
+) (clientID string, e *DoHEndpoint, err error) {
 	r := pctx.HTTPRequest
 	if r == nil {
-		return "", fmt.Errorf(
+		return "", nil, fmt.Errorf(
 			"proxy ctx http request of proto %s is nil",
 			pctx.Proto,
 		)
 	}
 
 	origPath := r.URL.Path
-	parts := strings.Split(path.Clean(origPath), "/")
-	if parts[0] == "" {
-		parts = parts[1:]
-	}
-
-	if len(parts) == 0 || parts[0] != "dns-query" {
-		return "", fmt.Errorf("clientid check: invalid path %q", origPath)
+	e, rest, ok := matchDoHEndpoint(endpoints, origPath)
+	if !ok {
+		return "", nil, fmt.Errorf("clientid check: invalid path %q", origPath)
 	}
 
-	switch len(parts) {
-	case 1:
-		// Just /dns-query, no ClientID.
-		return "", nil
-	case 2:
-		clientID = parts[1]
-	default:
-		return "", fmt.Errorf("clientid check: invalid path %q: extra parts", origPath)
+	if rest == "" {
+		// Just the path of the endpoint, no ClientID.
+		return "", e, nil
+	} else if strings.Contains(rest, "/") {
+		return "", nil, fmt.Errorf("clientid check: invalid path %q: extra parts", origPath)
 	}
 
-	err = ValidateClientID(clientID)
+	err = ValidateClientID(rest)
 	if err != nil {
-		return "", fmt.Errorf("clientid check: %w", err)
+		return "", nil, fmt.Errorf("clientid check: %w", err)
 	}
 
-	return strings.ToLower(clientID), nil
+	return strings.ToLower(rest), e, nil
 }
 
 // tlsConn is a narrow interface for *tls.Conn to simplify testing.
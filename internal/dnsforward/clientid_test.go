@@ -315,6 +315,12 @@ func TestClientIDFromDNSContextHTTPS(t *testing.T) {
 		cliSrvName:   "example.com",
 		wantClientID: "insensitive",
 		wantErrMsg:   ``,
+	}, {
+		name:         "unfiltered_clientid",
+		path:         "/dns-query-unfiltered/cli",
+		cliSrvName:   "example.com",
+		wantClientID: "cli",
+		wantErrMsg:   "",
 	}, {
 		name:         "bad_url",
 		path:         "/foo",
@@ -359,10 +365,61 @@ func TestClientIDFromDNSContextHTTPS(t *testing.T) {
 				HTTPRequest: r,
 			}
 
-			clientID, err := clientIDFromDNSContextHTTPS(pctx)
+			clientID, _, err := clientIDFromDNSContextHTTPS(pctx, nil)
 			assert.Equal(t, tc.wantClientID, clientID)
 
 			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
 		})
 	}
 }
+
+func TestIsUnfilteredRequest(t *testing.T) {
+	testCases := []struct {
+		name  string
+		path  string
+		proto proxy.Proto
+		want  bool
+	}{{
+		name:  "doh",
+		path:  "/dns-query",
+		proto: proxy.ProtoHTTPS,
+		want:  false,
+	}, {
+		name:  "unfiltered",
+		path:  "/dns-query-unfiltered",
+		proto: proxy.ProtoHTTPS,
+		want:  true,
+	}, {
+		name:  "unfiltered_clientid",
+		path:  "/dns-query-unfiltered/cli/",
+		proto: proxy.ProtoHTTPS,
+		want:  true,
+	}, {
+		name:  "unfiltered_prefix",
+		path:  "/dns-query-unfiltered-not",
+		proto: proxy.ProtoHTTPS,
+		want:  false,
+	}, {
+		name:  "udp",
+		path:  "",
+		proto: proxy.ProtoUDP,
+		want:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Proto: tc.proto,
+			}
+			if tc.path != "" {
+				pctx.HTTPRequest = &http.Request{
+					URL: &url.URL{
+						Path: tc.path,
+					},
+				}
+			}
+
+			assert.Equal(t, tc.want, isUnfilteredRequest(pctx))
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package dnsforward
+
+import (
+	"sync"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// coalescingUpstream is an [upstream.Upstream] that sends only a single request
+// to the underlying upstream for identical concurrent requests and shares the
+// response among all of them.  Since all listeners use the same upstreams, this
+// works for the requests received over any protocol.
+type coalescingUpstream struct {
+	upstream.Upstream
+
+	// mu protects inflight.
+	mu *sync.Mutex
+
+	// inflight are the exchanges in progress.  The keys are the packed requests
+	// with zero IDs.
+	inflight map[string]*inflightExchange
+}
+
+// type check
+var _ upstream.Upstream = (*coalescingUpstream)(nil)
+
+// inflightExchange is a single exchange with the underlying upstream.
+type inflightExchange struct {
+	// done is closed when resp and err are set.
+	done chan struct{}
+
+	// resp is the response shared with the waiting requests.  It must not be
+	// modified after done is closed.
+	resp *dns.Msg
+
+	// err is the error of the exchange.
+	err error
+
+	// waiting is the number of requests waiting for the exchange.  It's
+	// protected by [coalescingUpstream.mu].
+	waiting int
+}
+
+// newCoalescingUpstream returns a new properly initialized *coalescingUpstream.
+func newCoalescingUpstream(u upstream.Upstream) (c *coalescingUpstream) {
+	return &coalescingUpstream{
+		Upstream: u,
+		mu:       &sync.Mutex{},
+		inflight: map[string]*inflightExchange{},
+	}
+}
+
+// Exchange implements the [upstream.Upstream] interface for
+// *coalescingUpstream.
+func (u *coalescingUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	key, err := inflightKey(req)
+	if err != nil {
+		log.Debug("dnsforward: coalescing requests to %s: %s", u.Address(), err)
+
+		return u.Upstream.Exchange(req)
+	}
+
+	u.mu.Lock()
+	ex, ok := u.inflight[key]
+	if ok {
+		ex.waiting++
+		u.mu.Unlock()
+
+		<-ex.done
+
+		return ex.result(req)
+	}
+
+	ex = &inflightExchange{
+		done: make(chan struct{}),
+	}
+	u.inflight[key] = ex
+	u.mu.Unlock()
+
+	defer u.finish(key, ex)
+
+	ex.resp, ex.err = u.Upstream.Exchange(req)
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return ex.resp, ex.err
+}
+
+// finish removes ex from the exchanges in progress and wakes up the waiting
+// requests.  Since the caller of the first request may modify the response, the
+// waiting ones receive the copies of it.
+func (u *coalescingUpstream) finish(key string, ex *inflightExchange) {
+	u.mu.Lock()
+	delete(u.inflight, key)
+	waiting := ex.waiting
+	u.mu.Unlock()
+
+	if waiting > 0 {
+		log.Debug("dnsforward: coalesced %d requests to %s", waiting, u.Address())
+
+		if ex.resp != nil {
+			ex.resp = ex.resp.Copy()
+		}
+	}
+
+	close(ex.done)
+}
+
+// result returns the copy of the shared response to req.
+func (ex *inflightExchange) result(req *dns.Msg) (resp *dns.Msg, err error) {
+	if ex.resp == nil {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return nil, ex.err
+	}
+
+	resp = ex.resp.Copy()
+	resp.Id = req.Id
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return resp, ex.err
+}
+
+// inflightKey returns the key for req, which is the same for the requests that
+// differ only in their IDs.
+func inflightKey(req *dns.Msg) (key string, err error) {
+	hdr := req.MsgHdr
+	hdr.Id = 0
+
+	// Copy the message shallowly to avoid modifying req.
+	keyMsg := &dns.Msg{
+		MsgHdr:   hdr,
+		Compress: req.Compress,
+		Question: req.Question,
+		Answer:   req.Answer,
+		Ns:       req.Ns,
+		Extra:    req.Extra,
+	}
+
+	b, err := keyMsg.Pack()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// coalesceUpstreams wraps all upstreams of uc so that the identical concurrent
+// requests to each of them are coalesced.  The same upstream used in several
+// rules shares the in-flight exchanges.
+func coalesceUpstreams(uc *proxy.UpstreamConfig) {
+	wrapped := map[upstream.Upstream]*coalescingUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			c, ok := wrapped[u]
+			if !ok {
+				c = newCoalescingUpstream(u)
+				wrapped[u] = c
+			}
+
+			ups[i] = c
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+}
@@ -0,0 +1,112 @@
+package dnsforward
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescingUpstream_Exchange(t *testing.T) {
+	const reqsNum = 10
+
+	var exchNum atomic.Int32
+	release := make(chan struct{})
+	ups := newCoalescingUpstream(&aghtest.UpstreamMock{
+		OnAddress: func() (addr string) { return "mock" },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			exchNum.Add(1)
+			<-release
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+		OnClose: func() (err error) { return nil },
+	})
+
+	reqs := make([]*dns.Msg, reqsNum)
+	resps := make([]*dns.Msg, reqsNum)
+	for i := range reqs {
+		reqs[i] = createTestMessage("example.org.")
+		reqs[i].Id = uint16(i + 1)
+	}
+
+	key, err := inflightKey(reqs[0])
+	require.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(reqsNum)
+
+	go func() {
+		defer wg.Done()
+
+		resps[0], _ = ups.Exchange(reqs[0])
+	}()
+
+	require.Eventually(t, func() (ok bool) {
+		return exchNum.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	for i := 1; i < reqsNum; i++ {
+		go func() {
+			defer wg.Done()
+
+			resps[i], _ = ups.Exchange(reqs[i])
+		}()
+	}
+
+	require.Eventually(t, func() (ok bool) {
+		ups.mu.Lock()
+		defer ups.mu.Unlock()
+
+		return ups.inflight[key].waiting == reqsNum-1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), exchNum.Load())
+	assert.Empty(t, ups.inflight)
+
+	for i, resp := range resps {
+		require.NotNil(t, resp)
+
+		assert.Equal(t, reqs[i].Id, resp.Id)
+	}
+
+	// The next request must be sent anew.
+	_, err = ups.Exchange(createTestMessage("example.org."))
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), exchNum.Load())
+}
+
+func TestInflightKey(t *testing.T) {
+	req := createTestMessage("example.org.")
+	key, err := inflightKey(req)
+	require.NoError(t, err)
+
+	other := createTestMessage("example.org.")
+	other.Id = req.Id + 1
+	otherKey, err := inflightKey(other)
+	require.NoError(t, err)
+
+	assert.Equal(t, key, otherKey)
+
+	aaaa := createTestMessageWithType("example.org.", dns.TypeAAAA)
+	aaaaKey, err := inflightKey(aaaa)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key, aaaaKey)
+
+	do := createTestMessage("example.org.")
+	do.SetEdns0(dns.DefaultMsgSize, true)
+	doKey, err := inflightKey(do)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key, doKey)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"net/http"
 	"net/netip"
 	"os"
 	"slices"
@@ -16,7 +17,9 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/rebinding"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/container"
@@ -74,6 +77,11 @@ type Config struct {
 	// RefuseAny, if true, refuse ANY requests.
 	RefuseAny bool `yaml:"refuse_any"`
 
+	// MinimalANYResponses, if true, makes the server answer ANY requests with
+	// a synthesized HINFO record, as described in RFC 8482, instead of
+	// forwarding them to the upstreams.  RefuseAny takes precedence.
+	MinimalANYResponses bool `yaml:"minimal_any_responses"`
+
 	// Upstream DNS servers configuration
 
 	// UpstreamDNS is the list of upstream DNS servers.
@@ -112,6 +120,11 @@ type Config struct {
 	// BlockedHosts is the list of hosts that should be blocked.
 	BlockedHosts []string `yaml:"blocked_hosts"`
 
+	// EncryptedClientRules are the rules allowing or denying the requests over
+	// the encrypted protocols by the metadata of the clients.  The first
+	// matching rule is used.  The requests not matching any rule are allowed.
+	EncryptedClientRules []*EncryptedClientRule `yaml:"encrypted_client_rules"`
+
 	// TrustedProxies is the list of CIDR networks with proxy servers addresses
 	// from which the DoH requests should be handled.  The value of nil or an
 	// empty slice for this field makes Proxy not trust any address.
@@ -133,6 +146,11 @@ type Config struct {
 	// CacheOptimistic defines if optimistic cache mechanism should be used.
 	CacheOptimistic bool `yaml:"cache_optimistic"`
 
+	// CacheDumpPath is the path to the file the DNS cache is written to on
+	// shutdown and restored from on startup, respecting the remaining TTLs.  If
+	// empty, the cache isn't persisted.
+	CacheDumpPath string `yaml:"cache_dump_path"`
+
 	// Other settings
 
 	// BogusNXDomain is the list of IP addresses, responses with them will be
@@ -171,6 +189,307 @@ type Config struct {
 	// BootstrapPreferIPv6, if true, instructs the bootstrapper to prefer IPv6
 	// addresses to IPv4 ones for DoH, DoQ, and DoT.
 	BootstrapPreferIPv6 bool `yaml:"bootstrap_prefer_ipv6"`
+
+	// UnfilteredDoH is the configuration of the troubleshooting
+	// DNS-over-HTTPS endpoint that bypasses filtering.
+	UnfilteredDoH UnfilteredDoHConfig `yaml:"unfiltered_doh"`
+
+	// DoHEndpoints are the URL paths of the DNS-over-HTTPS endpoints.  If
+	// empty, the only endpoint is [DefaultDoHPath].  Changing them requires
+	// a restart.
+	DoHEndpoints []*DoHEndpoint `yaml:"doh_endpoints"`
+
+	// CoalesceRequests defines if the identical concurrent requests to an
+	// upstream should be sent only once, with the response shared among them.
+	CoalesceRequests bool `yaml:"coalesce_requests"`
+
+	// QUICMaxStreamsPerConn is the maximum number of concurrent requests sent
+	// over a single connection to a DNS-over-QUIC upstream.  When all
+	// connections reach it, a new one is opened.  If zero,
+	// [defaultQUICMaxStreams] is used.
+	QUICMaxStreamsPerConn uint `yaml:"quic_max_streams_per_conn"`
+
+	// UpstreamWeights are the weights of the upstreams in the
+	// [UpstreamModeWeighted] mode.  The upstreams without a weight have the
+	// weight of 1.
+	UpstreamWeights []*UpstreamWeight `yaml:"upstream_weights"`
+
+	// UpstreamRetry is the retry policy of the exchanges with the upstreams.
+	// If nil, the failed exchanges aren't retried and all responses are
+	// returned as is.
+	UpstreamRetry *UpstreamRetryConfig `yaml:"upstream_retry"`
+
+	// UpstreamBreaker is the configuration of the concurrency limits and the
+	// circuit breakers of the upstreams.  If nil, the requests to the
+	// upstreams aren't limited.
+	UpstreamBreaker *UpstreamBreakerConfig `yaml:"upstream_breaker"`
+
+	// UpstreamHealthCheck is the configuration of the active health checks of
+	// the upstreams.  If nil, the upstreams aren't checked.
+	UpstreamHealthCheck *UpstreamHealthCheckConfig `yaml:"upstream_health_check"`
+
+	// UpstreamResponseLimits are the limits of the responses accepted from the
+	// upstreams.  If nil, the responses aren't limited.
+	UpstreamResponseLimits *UpstreamResponseLimits `yaml:"upstream_response_limits"`
+
+	// MalformedQueries is the configuration of the handling of the malformed
+	// queries.  If nil, the malformed queries are counted but their senders
+	// aren't banned.
+	MalformedQueries *MalformedQueriesConfig `yaml:"malformed_queries"`
+
+	// UpstreamTTLOverrides are the TTL bounds applied to the responses of the
+	// matching upstreams before they are cached and sent to the clients.
+	UpstreamTTLOverrides []*UpstreamTTLOverride `yaml:"upstream_ttl_overrides"`
+
+	// DNSCryptFallbacks are the DNS-over-HTTPS upstreams used instead of the
+	// DNSCrypt ones when the exchanges with the latter fail.
+	DNSCryptFallbacks []*DNSCryptFallback `yaml:"dnscrypt_fallbacks"`
+
+	// WarmUpDomains is the list of domain names resolved right after the start
+	// and after the cache is cleared so that their responses are cached.
+	WarmUpDomains []string `yaml:"warm_up_domains"`
+
+	// ReverseZones is the list of reverse DNS zones delegated to the local DNS
+	// servers regardless of the private reverse DNS settings.
+	ReverseZones []*ReverseZoneConfig `yaml:"reverse_zones"`
+
+	// LocalZones is the list of DNS zones served authoritatively by the server
+	// itself before any upstream resolution.
+	LocalZones []*LocalZoneConfig `yaml:"local_zones"`
+
+	// QTypeUpstreams is the list of rules routing the requests of specific
+	// types, optionally within specific domains, to designated upstreams.  The
+	// first matching rule is used.  The rules are checked after
+	// ConditionalForwarding, so a matching conditional forwarding rule takes
+	// precedence even over a rule with [QTypeUpstreamActionRefuse].
+	QTypeUpstreams []*QTypeUpstreamConfig `yaml:"qtype_upstreams"`
+
+	// ConditionalForwarding is the list of rules forwarding the requests
+	// matching domain patterns, client subnets, and query types to designated
+	// upstreams.  The first matching rule is used.  The rules have higher
+	// priority than QTypeUpstreams.
+	ConditionalForwarding []*ForwardingRule `yaml:"conditional_forwarding"`
+
+	// Tor is the configuration of the local Tor SOCKS proxy used by the
+	// conditional forwarding rules with [ForwardingRule.ViaTor] set.
+	Tor *TorConfig `yaml:"tor"`
+
+	// Sortlist is the list of rules reordering the addresses in the responses
+	// to the matching clients, similar to the sortlist statement of BIND.  The
+	// first matching rule is used.
+	Sortlist []*SortlistRule `yaml:"sortlist"`
+
+	// RebindingProtection is the configuration of the DNS rebinding
+	// protection, which blocks the upstream responses resolving the public
+	// hostnames to the internal addresses.  If nil, the protection is
+	// disabled.
+	RebindingProtection *rebinding.Config `yaml:"rebinding_protection"`
+
+	// EDNSBufferSize is the UDP payload size advertised in the EDNS(0) OPT
+	// records of the responses.  If zero, the one from the upstream response
+	// is kept.
+	EDNSBufferSize uint16 `yaml:"edns_buffer_size"`
+
+	// NSID is the name server identifier sent in the responses to the
+	// requests containing the NSID option, see RFC 5001.  If empty, the
+	// option isn't sent.
+	NSID string `yaml:"nsid"`
+
+	// TCPKeepalive defines if the edns-tcp-keepalive option, see RFC 7828, is
+	// sent in the responses to the requests over TCP and TLS containing it.
+	TCPKeepalive bool `yaml:"tcp_keepalive"`
+
+	// ExtendedDNSErrors defines if the Extended DNS Error option, see RFC
+	// 8914, explaining the filtering decision is added to the blocked
+	// responses.
+	ExtendedDNSErrors bool `yaml:"extended_dns_errors"`
+}
+
+// UpstreamTTLOverride defines the bounds of TTLs of the responses from the
+// upstreams matching either Upstream, Domain, or both.  At least one of them
+// must be set.
+type UpstreamTTLOverride struct {
+	// Upstream is the address of the upstream, as written in the upstream
+	// configuration.  If empty, all upstreams of Domain match.
+	Upstream string `yaml:"upstream"`
+
+	// Domain is the domain of a domain-specific upstream rule, e.g.
+	// "corp.example" for "[/corp.example/]10.0.0.1".  If empty, Upstream
+	// matches in all rules as well as in the default upstreams.
+	Domain string `yaml:"domain"`
+
+	// MinTTL is the minimum TTL of the resource records in the responses.
+	MinTTL uint32 `yaml:"min_ttl"`
+
+	// MaxTTL is the maximum TTL of the resource records in the responses.  If
+	// zero, the TTLs aren't limited from above.
+	MaxTTL uint32 `yaml:"max_ttl"`
+}
+
+// ReverseZoneConfig is the configuration of a single reverse DNS zone, such as
+// "10.in-addr.arpa", delegated to the designated local DNS servers.  Responses
+// from these servers are never cached.
+type ReverseZoneConfig struct {
+	// Zone is the ARPA domain name of the zone.  It must not be empty.
+	Zone string `yaml:"zone"`
+
+	// Upstreams are the addresses of the DNS servers serving the zone.  It
+	// must not be empty.
+	Upstreams []string `yaml:"upstreams"`
+
+	// Timeout is the timeout for querying the upstreams of the zone.  If it's
+	// zero, [ServerConfig.PrivateRDNSTimeout] is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+}
+
+// LocalZoneConfig is the configuration of a single DNS zone served
+// authoritatively by the server.
+type LocalZoneConfig struct {
+	// Name is the domain name of the zone, for example "home.example".  It
+	// must not be empty.
+	Name string `yaml:"name" json:"name"`
+
+	// Records are the resource records of the zone in the presentation format
+	// of the RFC 1035 zone files, for example "www 300 A 192.168.1.2".  The
+	// relative names are relative to the zone, and "@" is the zone itself.
+	// The default TTL is [defaultLocalZoneTTL].  There must be exactly one SOA
+	// record, which must be at the zone itself.
+	Records []string `yaml:"records" json:"records"`
+}
+
+// QTypeUpstreamAction is the action of a [QTypeUpstreamConfig] rule.
+type QTypeUpstreamAction string
+
+// Valid QTypeUpstreamAction values.
+const (
+	// QTypeUpstreamActionForward forwards the matching requests to the
+	// upstreams of the rule.  It's the default.
+	QTypeUpstreamActionForward QTypeUpstreamAction = "forward"
+
+	// QTypeUpstreamActionLocal forwards the matching requests to the private
+	// reverse DNS upstreams.  If those are disabled, the matching requests
+	// are forwarded as usual.
+	QTypeUpstreamActionLocal QTypeUpstreamAction = "local"
+
+	// QTypeUpstreamActionRefuse responds to the matching requests with
+	// REFUSED.
+	QTypeUpstreamActionRefuse QTypeUpstreamAction = "refuse"
+)
+
+// QTypeUpstreamConfig is the configuration of a rule routing the requests of
+// specific types, such as PTR or HTTPS, to designated upstreams.  Responses from
+// these upstreams are never cached.
+type QTypeUpstreamConfig struct {
+	// Action is the action applied to the matching requests.  If empty,
+	// [QTypeUpstreamActionForward] is used.
+	Action QTypeUpstreamAction `yaml:"action"`
+
+	// QTypes are the types of the matching requests, either names like "PTR"
+	// or generic ones like "TYPE65".  It must not be empty.
+	QTypes []string `yaml:"qtypes"`
+
+	// Domains, if not empty, restrict the rule to the requests for these
+	// domains and their subdomains.
+	Domains []string `yaml:"domains"`
+
+	// Upstreams are the addresses of the upstreams for
+	// [QTypeUpstreamActionForward] in the same format as [Config.UpstreamDNS],
+	// including domain-specific ones.  At least one of them must not be
+	// domain-specific.  It must be empty for other actions.
+	Upstreams []string `yaml:"upstreams"`
+
+	// UpstreamMode, if not empty, is the way the requests are distributed
+	// among Upstreams regardless of [Config.UpstreamMode].  See
+	// [ApplyUpstreamMode].
+	UpstreamMode UpstreamMode `yaml:"upstream_mode,omitempty"`
+}
+
+// ForwardingRule is the configuration of a conditional forwarding rule.  A
+// request matches the rule if it matches all of its non-empty conditions.
+// Responses from the upstreams of the rules are never cached.
+type ForwardingRule struct {
+	// Name is the optional human-readable name of the rule.
+	Name string `yaml:"name" json:"name"`
+
+	// Domains are the patterns of the domain names of the matching requests.
+	// A pattern like "example.org" matches the name and its subdomains, one
+	// like "*.example.org" matches only the subdomains, and one like
+	// "/^printer[0-9]+\.lan$/" is a regular expression matched against the
+	// lowercased name without the trailing dot.  If empty, all names match.
+	Domains []string `yaml:"domains" json:"domains"`
+
+	// ClientSubnets, if not empty, restrict the rule to the requests from
+	// these subnets.
+	ClientSubnets []netip.Prefix `yaml:"client_subnets" json:"client_subnets"`
+
+	// QTypes, if not empty, restrict the rule to the requests of these types,
+	// either names like "A" or generic ones like "TYPE65".
+	QTypes []string `yaml:"qtypes" json:"qtypes"`
+
+	// Upstreams are the addresses of the upstreams in the same format as
+	// [Config.UpstreamDNS], including domain-specific ones.  At least one of
+	// them must not be domain-specific.
+	Upstreams []string `yaml:"upstreams" json:"upstreams"`
+
+	// UpstreamMode, if not empty, is the way the requests are distributed
+	// among Upstreams regardless of [Config.UpstreamMode].  See
+	// [ApplyUpstreamMode].
+	UpstreamMode UpstreamMode `yaml:"upstream_mode,omitempty" json:"upstream_mode,omitempty"`
+
+	// ViaTor, if true, makes the requests to Upstreams go through the Tor
+	// SOCKS proxy configured in [Config.Tor].  Upstreams must then be
+	// https:// or tcp:// ones, or http:// ones for the onion services, and
+	// must not be domain-specific.
+	ViaTor bool `yaml:"via_tor" json:"via_tor"`
+}
+
+// SortlistRule is the configuration of a rule reordering the A and AAAA
+// records in the responses to the matching clients.
+type SortlistRule struct {
+	// ClientSubnets, if not empty, restrict the rule to the requests from
+	// these subnets.
+	ClientSubnets []netip.Prefix `yaml:"client_subnets"`
+
+	// Prefer are the subnets of the preferred addresses, the most preferred
+	// first.  The addresses not within any of them are put after the others,
+	// keeping their order.
+	Prefer []netip.Prefix `yaml:"prefer"`
+}
+
+// EncryptedClientRule is an access rule matching the metadata of the clients
+// using DNS-over-HTTPS, DNS-over-TLS, or DNS-over-QUIC.  A request matches the
+// rule if it matches all of its non-empty conditions.
+type EncryptedClientRule struct {
+	// Action is the action applied to the matching requests, either "allow" or
+	// "deny".
+	Action string `yaml:"action"`
+
+	// UserAgents are the patterns of the User-Agent header of the
+	// DNS-over-HTTPS requests.  A pattern like "/^curl\//" is a regular
+	// expression, others are case-insensitive substrings.  The requests over
+	// other protocols never match them.
+	UserAgents []string `yaml:"user_agents"`
+
+	// ALPNs are the negotiated TLS ALPN protocols, e.g. "h2" or "doq".
+	ALPNs []string `yaml:"alpns"`
+
+	// TLSFingerprints are the patterns of the coarse fingerprints of the
+	// negotiated TLS parameters in the "<version>:<cipher suite>:<alpn>"
+	// format, e.g. "tls1.2:TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:h2".  Each
+	// part of a pattern may be "*" to match any value.
+	TLSFingerprints []string `yaml:"tls_fingerprints"`
+}
+
+// UnfilteredDoHConfig is the configuration of the troubleshooting
+// DNS-over-HTTPS endpoint.  Requests to it are resolved without any filtering,
+// but are still written to the query log and counted in the statistics.
+type UnfilteredDoHConfig struct {
+	// Enabled defines if the endpoint is served.
+	Enabled bool `yaml:"enabled"`
+
+	// RequireAuth defines if the requests to the endpoint must contain the
+	// credentials of the web interface.
+	RequireAuth bool `yaml:"require_auth"`
 }
 
 // EDNSClientSubnet is the settings list for EDNS Client Subnet.
@@ -178,11 +497,49 @@ type EDNSClientSubnet struct {
 	// CustomIP for EDNS Client Subnet.
 	CustomIP netip.Addr `yaml:"custom_ip"`
 
+	// Domains are the patterns of the domain names, for which the subnet is
+	// sent to the upstreams, e.g. the ones of CDNs.  The syntax is the same as
+	// the one of [ForwardingRule.Domains].  If empty, the subnet is sent for
+	// all domain names.
+	Domains []string `yaml:"domains"`
+
+	// Upstreams are the policies of specific upstreams.  The first matching
+	// policy is used.
+	Upstreams []*ECSUpstreamPolicy `yaml:"upstreams"`
+
 	// Enabled defines if EDNS Client Subnet is enabled.
 	Enabled bool `yaml:"enabled"`
 
 	// UseCustom defines if CustomIP should be used.
 	UseCustom bool `yaml:"use_custom"`
+
+	// PrefixLenV4 is the length of the IPv4 subnet sent to the upstreams.  If
+	// zero, 24 is used.
+	PrefixLenV4 uint8 `yaml:"prefix_len_v4"`
+
+	// PrefixLenV6 is the length of the IPv6 subnet sent to the upstreams.  If
+	// zero, 56 is used.
+	PrefixLenV6 uint8 `yaml:"prefix_len_v6"`
+}
+
+// ECSUpstreamPolicy is the EDNS Client Subnet policy of a single upstream.
+type ECSUpstreamPolicy struct {
+	// Upstream is the address of the upstream, as written in the upstream
+	// configuration.  It must not be empty.
+	Upstream string `yaml:"upstream"`
+
+	// Disabled defines if the subnet is never sent to the upstream.
+	Disabled bool `yaml:"disabled"`
+
+	// PrefixLenV4 is the length of the IPv4 subnet sent to the upstream.  If
+	// zero, the length from [EDNSClientSubnet] is used.  It can only shorten
+	// that length.
+	PrefixLenV4 uint8 `yaml:"prefix_len_v4"`
+
+	// PrefixLenV6 is the length of the IPv6 subnet sent to the upstream.  If
+	// zero, the length from [EDNSClientSubnet] is used.  It can only shorten
+	// that length.
+	PrefixLenV6 uint8 `yaml:"prefix_len_v6"`
 }
 
 // TLSConfig is the TLS configuration for HTTPS, DNS-over-HTTPS, and DNS-over-TLS
@@ -264,6 +621,11 @@ type ServerConfig struct {
 	// UpstreamTimeout is the timeout for querying upstream servers.
 	UpstreamTimeout time.Duration
 
+	// PrivateRDNSTimeout is the timeout for querying the private reverse DNS
+	// resolvers and the upstreams of the reverse zones.  If it's zero,
+	// [defaultLocalTimeout] is used.
+	PrivateRDNSTimeout time.Duration
+
 	TLSv12Roots *x509.CertPool // list of root CAs for TLSv1.2
 
 	// TLSCiphers are the IDs of TLS cipher suites to use.
@@ -275,10 +637,23 @@ type ServerConfig struct {
 	// Register an HTTP handler
 	HTTPRegister aghhttp.RegisterFunc
 
+	// IsAuthenticated, if not nil, returns true if r contains valid credentials
+	// of the web interface.  It is used to authenticate requests to the
+	// unfiltered DNS-over-HTTPS endpoint.
+	IsAuthenticated func(r *http.Request) (ok bool)
+
+	// Events, if not nil, receives the events about the upstreams going down.
+	Events events.Publisher
+
 	// LocalPTRResolvers is a slice of addresses to be used as upstreams for
 	// resolving PTR queries for local addresses.
 	LocalPTRResolvers []string
 
+	// DiscoveredPTRResolvers are the addresses of the local DNS servers found
+	// in the network configuration of the host.  Those are used instead of the
+	// OS-provided resolvers when LocalPTRResolvers is empty.
+	DiscoveredPTRResolvers []netip.AddrPort
+
 	// DNS64Prefixes is a slice of NAT64 prefixes to be used for DNS64.
 	DNS64Prefixes []netip.Prefix
 
@@ -310,6 +685,14 @@ const (
 	UpstreamModeLoadBalance UpstreamMode = "load_balance"
 	UpstreamModeParallel    UpstreamMode = "parallel"
 	UpstreamModeFastestAddr UpstreamMode = "fastest_addr"
+
+	// UpstreamModeWeighted distributes the requests among the upstreams
+	// according to [Config.UpstreamWeights] and their latencies.
+	UpstreamModeWeighted UpstreamMode = "weighted"
+
+	// UpstreamModeFailOver sends the requests to the first upstream and tries
+	// the next ones in the order of configuration only if it fails.
+	UpstreamModeFailOver UpstreamMode = "fail_over"
 )
 
 // newProxyConfig creates and validates configuration for the main proxy.
@@ -450,6 +833,10 @@ func (s *Server) initDefaultSettings() {
 	if s.conf.UpstreamTimeout == 0 {
 		s.conf.UpstreamTimeout = DefaultTimeout
 	}
+
+	if s.conf.PrivateRDNSTimeout == 0 {
+		s.conf.PrivateRDNSTimeout = defaultLocalTimeout
+	}
 }
 
 // prepareIpsetListSettings reads and prepares the ipset configuration either
@@ -744,6 +1131,19 @@ func (s *Server) preparePlain(proxyConf *proxy.Config) (err error) {
 	return nil
 }
 
+// SetProtection sets the protection state and saves the configuration.  If
+// disabledUntil is not nil, the protection is disabled until that time.
+func (s *Server) SetProtection(enabled bool, disabledUntil *time.Time) {
+	func() {
+		s.serverLock.Lock()
+		defer s.serverLock.Unlock()
+
+		s.dnsFilter.SetProtectionStatus(enabled, disabledUntil)
+	}()
+
+	s.conf.ConfigModified()
+}
+
 // UpdatedProtectionStatus updates protection state, if the protection was
 // disabled temporarily.  Returns the updated state of protection.
 func (s *Server) UpdatedProtectionStatus() (enabled bool, disabledUntil *time.Time) {
@@ -3,11 +3,13 @@ package dnsforward
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/miekg/dns"
 )
 
@@ -84,6 +86,38 @@ func newUpstreamConfigValidator(
 	return cv
 }
 
+// CheckUpstreams parses the upstream configuration lines and checks the DNS
+// availability of each upstream using the bootstrap servers, or the default
+// ones if there are none.  The returned map is keyed by the original upstream
+// configuration piece and contains the corresponding error or "OK" if there was
+// no error.  err is only returned if bootstraps are invalid.
+func CheckUpstreams(
+	upstreams []string,
+	bootstraps []string,
+	timeout time.Duration,
+) (results map[string]string, err error) {
+	opts := &upstream.Options{
+		Timeout: timeout,
+	}
+
+	var boots []*upstream.UpstreamResolver
+	opts.Bootstrap, boots, err = newBootstrap(
+		stringutil.FilterOut(bootstraps, IsCommentOrEmpty),
+		nil,
+		opts,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bootstrap servers: %w", err)
+	}
+	defer closeBoots(boots)
+
+	cv := newUpstreamConfigValidator(upstreams, nil, nil, opts)
+	cv.check()
+	cv.close()
+
+	return cv.status(), nil
+}
+
 // collectErrResults parses err and returns parsing results containing the
 // original upstream configuration line and the corresponding error.  err can be
 // nil.
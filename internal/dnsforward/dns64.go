@@ -3,8 +3,13 @@ package dnsforward
 import (
 	"net"
 	"net/netip"
+	"slices"
+	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
 )
 
 // setupDNS64 initializes DNS64 settings, the NAT64 prefixes in particular.  If
@@ -32,16 +37,88 @@ func (s *Server) setupDNS64() {
 	}
 }
 
-// mapDNS64 maps ip to IPv6 address using configured DNS64 prefix.  ip must be a
-// valid IPv4.  It panics, if there are no configured DNS64 prefixes, because
-// synthesis should not be performed unless DNS64 function enabled.
-func (s *Server) mapDNS64(ip netip.Addr) (mapped net.IP) {
-	pref := s.dns64Pref.Masked().Addr().As16()
+// mapNAT64 maps ip to IPv6 address within the NAT64 prefix pref.  ip must be a
+// valid IPv4 and pref must be a valid IPv6 prefix no longer than 96 bits.
+func mapNAT64(pref netip.Prefix, ip netip.Addr) (mapped net.IP) {
+	prefData := pref.Masked().Addr().As16()
 	ipData := ip.As4()
 
 	mapped = make(net.IP, net.IPv6len)
-	copy(mapped[:proxy.NAT64PrefixLength], pref[:])
+	copy(mapped[:proxy.NAT64PrefixLength], prefData[:])
 	copy(mapped[proxy.NAT64PrefixLength:], ipData[:])
 
 	return mapped
 }
+
+// clientDNS64Pref returns the NAT64 prefix to synthesize AAAA records for host
+// with for the client with setts.  ok is false if DNS64 is disabled or host is
+// excluded from the DNS64 synthesis for the client.
+func (s *Server) clientDNS64Pref(
+	host string,
+	setts *filtering.Settings,
+) (pref netip.Prefix, ok bool) {
+	if s.dns64Pref == (netip.Prefix{}) {
+		return netip.Prefix{}, false
+	} else if setts == nil {
+		return s.dns64Pref, true
+	}
+
+	if isDNS64Excluded(host, setts.ClientDNS64Exclusions) {
+		return netip.Prefix{}, false
+	} else if setts.ClientDNS64Prefix.IsValid() {
+		return setts.ClientDNS64Prefix, true
+	}
+
+	return s.dns64Pref, true
+}
+
+// isDNS64Excluded returns true if host or any of its parent domains is within
+// exclusions.
+func isDNS64Excluded(host string, exclusions []string) (ok bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	return slices.ContainsFunc(exclusions, func(domain string) (found bool) {
+		return host == domain || netutil.IsSubdomain(host, domain)
+	})
+}
+
+// applyClientDNS64 modifies the AAAA records of resp synthesized by the DNS64
+// function according to the per-client settings, see [Server.clientDNS64Pref].
+// The synthesized records are removed for the excluded hosts and mapped to the
+// client's NAT64 prefix otherwise.
+func (s *Server) applyClientDNS64(resp *dns.Msg, host string, setts *filtering.Settings) {
+	if resp == nil || setts == nil || s.dns64Pref == (netip.Prefix{}) {
+		return
+	}
+
+	pref, ok := s.clientDNS64Pref(host, setts)
+	if ok && pref == s.dns64Pref {
+		return
+	}
+
+	answers := resp.Answer[:0]
+	for _, rr := range resp.Answer {
+		aaaa, isAAAA := rr.(*dns.AAAA)
+		if !isAAAA {
+			answers = append(answers, rr)
+
+			continue
+		}
+
+		addr, err := netutil.IPToAddr(aaaa.AAAA, netutil.AddrFamilyIPv6)
+		if err != nil || !s.dns64Pref.Contains(addr) {
+			answers = append(answers, rr)
+
+			continue
+		}
+
+		if ok {
+			data := addr.As16()
+			ipv4 := netip.AddrFrom4([4]byte(data[proxy.NAT64PrefixLength:]))
+			aaaa.AAAA = mapNAT64(pref, ipv4)
+			answers = append(answers, aaaa)
+		}
+	}
+
+	resp.Answer = answers
+}
@@ -2,6 +2,8 @@ package dnsforward
 
 import (
 	"net"
+	"net/netip"
+	"slices"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
@@ -361,3 +363,67 @@ func TestServer_dns64WithDisabledRDNS(t *testing.T) {
 
 	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
 }
+
+func TestServer_applyClientDNS64(t *testing.T) {
+	const domain = "ipv4.only."
+
+	s := &Server{
+		dns64Pref: netip.MustParsePrefix("64:ff9b::/96"),
+	}
+
+	clientPref := netip.MustParsePrefix("2001:db8:64::/96")
+	synthIP := net.ParseIP("64:ff9b::102:304")
+	realIP := net.ParseIP("2001:db8::1")
+
+	testCases := []struct {
+		setts   *filtering.Settings
+		name    string
+		wantIPs []net.IP
+	}{{
+		setts:   nil,
+		name:    "no_settings",
+		wantIPs: []net.IP{synthIP, realIP},
+	}, {
+		setts:   &filtering.Settings{},
+		name:    "global_prefix",
+		wantIPs: []net.IP{synthIP, realIP},
+	}, {
+		setts: &filtering.Settings{
+			ClientDNS64Prefix: clientPref,
+		},
+		name:    "client_prefix",
+		wantIPs: []net.IP{net.ParseIP("2001:db8:64::102:304"), realIP},
+	}, {
+		setts: &filtering.Settings{
+			ClientDNS64Prefix:     clientPref,
+			ClientDNS64Exclusions: []string{"only"},
+		},
+		name:    "excluded",
+		wantIPs: []net.IP{realIP},
+	}, {
+		setts: &filtering.Settings{
+			ClientDNS64Exclusions: []string{"other.only"},
+		},
+		name:    "not_excluded",
+		wantIPs: []net.IP{synthIP, realIP},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &dns.Msg{
+				Answer: []dns.RR{
+					newRR(t, domain, dns.TypeAAAA, 3600, slices.Clone(synthIP)),
+					newRR(t, domain, dns.TypeAAAA, 3600, slices.Clone(realIP)),
+				},
+			}
+
+			s.applyClientDNS64(resp, domain, tc.setts)
+			require.Len(t, resp.Answer, len(tc.wantIPs))
+
+			for i, rr := range resp.Answer {
+				aaaa := testutil.RequireTypeAssert[*dns.AAAA](t, rr)
+				assert.Equal(t, tc.wantIPs[i], aaaa.AAAA)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/ameshkov/dnsstamps"
+	"github.com/miekg/dns"
+)
+
+// stampScheme is the scheme of the DNS stamps, see
+// https://dnscrypt.info/stamps-specifications.
+const stampScheme = "sdns://"
+
+// DNSCryptFallback is the DNS-over-HTTPS upstream used instead of a DNSCrypt
+// one when the exchange with the latter fails.
+type DNSCryptFallback struct {
+	// Upstream is the DNS stamp of the DNSCrypt upstream, as written in the
+	// upstream configuration.  It must not be empty.
+	Upstream string `yaml:"upstream"`
+
+	// Fallback is the DNS stamp of the DNS-over-HTTPS upstream.  It must not
+	// be empty.
+	Fallback string `yaml:"fallback"`
+}
+
+// parseStamp parses the DNS stamp of an upstream and makes sure that it has
+// one of the protocols in protos.
+func parseStamp(addr string, protos ...dnsstamps.StampProtoType) (stamp dnsstamps.ServerStamp, err error) {
+	stamp, err = dnsstamps.NewServerStampFromString(addr)
+	if err != nil {
+		return stamp, fmt.Errorf("parsing stamp %q: %w", addr, err)
+	}
+
+	for _, p := range protos {
+		if stamp.Proto == p {
+			return stamp, nil
+		}
+	}
+
+	return stamp, fmt.Errorf("stamp %q: unexpected protocol %s", addr, &stamp.Proto)
+}
+
+// dnsCryptUpstream is an [upstream.Upstream] for the DNSCrypt protocol that
+// keeps track of the certificates of the resolver and uses the
+// DNS-over-HTTPS fallback upstream, if any, when the exchange fails.
+type dnsCryptUpstream struct {
+	upstream.Upstream
+
+	// fallback, if not nil, is the DNS-over-HTTPS upstream used when the
+	// exchange with the DNSCrypt upstream fails.
+	fallback upstream.Upstream
+
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	// certNotAfter is the time the current certificate expires.  It's zero if
+	// the certificate has not been fetched yet.
+	certNotAfter time.Time
+
+	// certSerial is the serial number of the current certificate.
+	certSerial uint32
+
+	// rotations is the number of times the certificate has been replaced with
+	// a new one.
+	rotations uint
+}
+
+// type check
+var _ upstream.Upstream = (*dnsCryptUpstream)(nil)
+
+// newDNSCryptUpstream returns a new DNSCrypt upstream with the DNS stamp addr.
+// fallbackAddr is the DNS stamp of the DNS-over-HTTPS fallback upstream, if
+// any.  opts must not be nil.
+func newDNSCryptUpstream(
+	addr string,
+	fallbackAddr string,
+	opts *upstream.Options,
+) (u *dnsCryptUpstream, err error) {
+	u = &dnsCryptUpstream{
+		mu: &sync.Mutex{},
+	}
+
+	if fallbackAddr != "" {
+		_, err = parseStamp(fallbackAddr, dnsstamps.StampProtoTypeDoH)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+
+		u.fallback, err = upstream.AddressToUpstream(fallbackAddr, opts.Clone())
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+	}
+
+	upsOpts := opts.Clone()
+	upsOpts.VerifyDNSCryptCertificate = u.verifyCert
+	u.Upstream, err = upstream.AddressToUpstream(addr, upsOpts)
+	if err != nil {
+		if u.fallback != nil {
+			logCloserErr(u.fallback, "dnsforward: closing upstream %s: %s", fallbackAddr)
+		}
+
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// verifyCert implements the [upstream.Options.VerifyDNSCryptCertificate]
+// callback for *dnsCryptUpstream.  It's called each time the certificate is
+// fetched, which happens when the previous one expires or the resolver stops
+// responding, for example after the key rotation.
+func (u *dnsCryptUpstream) verifyCert(cert *dnscrypt.Cert) (err error) {
+	notAfter := time.Unix(int64(cert.NotAfter), 0)
+	if notAfter.Before(time.Now()) {
+		return fmt.Errorf("certificate %d expired at %s", cert.Serial, notAfter)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.certNotAfter.IsZero() && cert.Serial != u.certSerial {
+		log.Info(
+			"dnsforward: upstream %s: certificate rotated from %d to %d",
+			u.Address(),
+			u.certSerial,
+			cert.Serial,
+		)
+
+		u.rotations++
+	}
+
+	u.certSerial, u.certNotAfter = cert.Serial, notAfter
+
+	return nil
+}
+
+// Exchange implements the [upstream.Upstream] interface for *dnsCryptUpstream.
+func (u *dnsCryptUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(req)
+	if err == nil || u.fallback == nil {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return resp, err
+	}
+
+	log.Debug("dnsforward: upstream %s: using fallback %s: %s", u.Address(), u.fallback.Address(), err)
+
+	resp, fbErr := u.fallback.Exchange(req)
+	if fbErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("fallback %s: %w", u.fallback.Address(), fbErr))
+	}
+
+	return resp, nil
+}
+
+// Close implements the [upstream.Upstream] interface for *dnsCryptUpstream.
+func (u *dnsCryptUpstream) Close() (err error) {
+	err = u.Upstream.Close()
+	if u.fallback != nil {
+		err = errors.Join(err, u.fallback.Close())
+	}
+
+	return err
+}
+
+// certInfo returns the expiration time and the serial number of the current
+// certificate and the number of its rotations.
+func (u *dnsCryptUpstream) certInfo() (notAfter time.Time, serial uint32, rotations uint) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.certNotAfter, u.certSerial, u.rotations
+}
+
+// newDNSCryptFallbacks validates fallbacks and returns the DNS stamps of the
+// fallback upstreams by the ones of the DNSCrypt upstreams.
+func newDNSCryptFallbacks(fallbacks []*DNSCryptFallback) (stamps map[string]string, err error) {
+	stamps = make(map[string]string, len(fallbacks))
+	for i, f := range fallbacks {
+		if f == nil {
+			return nil, fmt.Errorf("at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		_, err = parseStamp(f.Upstream, dnsstamps.StampProtoTypeDNSCrypt)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: upstream: %w", i, err)
+		}
+
+		_, err = parseStamp(f.Fallback, dnsstamps.StampProtoTypeDoH)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: fallback: %w", i, err)
+		}
+
+		var addr string
+		addr, err = upstreamAddress(f.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: upstream: %w", i, err)
+		}
+
+		stamps[addr] = f.Fallback
+	}
+
+	return stamps, nil
+}
+
+// applyDNSCryptUpstreams replaces the DNSCrypt upstreams of uc with the ones
+// keeping track of the certificates and using the fallbacks.  opts are the
+// options the upstreams of uc have been created with.  It must not be nil.
+func applyDNSCryptUpstreams(
+	uc *proxy.UpstreamConfig,
+	fallbacks []*DNSCryptFallback,
+	opts *upstream.Options,
+) (err error) {
+	defer func() { err = errors.Annotate(err, "dnscrypt fallbacks: %w") }()
+
+	stamps, err := newDNSCryptFallbacks(fallbacks)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	replaced := map[upstream.Upstream]upstream.Upstream{}
+	replace := func(ups []upstream.Upstream) (replErr error) {
+		for i, u := range ups {
+			r, ok := replaced[u]
+			if !ok {
+				r, replErr = replaceDNSCryptUpstream(u, stamps, opts)
+				if replErr != nil {
+					return replErr
+				}
+
+				replaced[u] = r
+			}
+
+			ups[i] = r
+		}
+
+		return nil
+	}
+
+	err = replace(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		err = errors.Join(err, replace(ups))
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		err = errors.Join(err, replace(ups))
+	}
+
+	return err
+}
+
+// replaceDNSCryptUpstream returns the [dnsCryptUpstream] replacing u if it's a
+// DNSCrypt upstream.  Otherwise, it returns u.  stamps are the DNS stamps of
+// the fallback upstreams by the ones of the DNSCrypt upstreams.
+func replaceDNSCryptUpstream(
+	u upstream.Upstream,
+	stamps map[string]string,
+	opts *upstream.Options,
+) (r upstream.Upstream, err error) {
+	addr := u.Address()
+	if !strings.HasPrefix(addr, stampScheme) {
+		return u, nil
+	}
+
+	stamp, err := dnsstamps.NewServerStampFromString(addr)
+	if err != nil || stamp.Proto != dnsstamps.StampProtoTypeDNSCrypt {
+		// The other stamps are turned into the upstreams with their own
+		// addresses, so this shouldn't happen.
+		return u, nil
+	}
+
+	dc, err := newDNSCryptUpstream(addr, stamps[addr], opts)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s: %w", addr, err)
+	}
+
+	logCloserErr(u, "dnsforward: closing upstream %s: %s", addr)
+
+	return dc, nil
+}
@@ -0,0 +1,194 @@
+package dnsforward
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/ameshkov/dnsstamps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common DNS stamps for tests.
+var (
+	testDNSCryptStamp = (&dnsstamps.ServerStamp{
+		Proto:         dnsstamps.StampProtoTypeDNSCrypt,
+		ServerAddrStr: "192.0.2.1:443",
+		ServerPk:      make([]byte, 32),
+		ProviderName:  "2.dnscrypt-cert.example.org",
+	}).String()
+
+	testDoHStamp = (&dnsstamps.ServerStamp{
+		Proto:         dnsstamps.StampProtoTypeDoH,
+		ServerAddrStr: "192.0.2.2",
+		ProviderName:  "doh.example.org",
+		Path:          "/dns-query",
+	}).String()
+)
+
+func TestNewDNSCryptFallbacks(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fallbacks  []*DNSCryptFallback
+		wantErrMsg string
+	}{{
+		name: "success",
+		fallbacks: []*DNSCryptFallback{{
+			Upstream: testDNSCryptStamp,
+			Fallback: testDoHStamp,
+		}},
+		wantErrMsg: "",
+	}, {
+		name:       "nil",
+		fallbacks:  []*DNSCryptFallback{nil},
+		wantErrMsg: "at index 0: no value",
+	}, {
+		name: "doh_upstream",
+		fallbacks: []*DNSCryptFallback{{
+			Upstream: testDoHStamp,
+			Fallback: testDoHStamp,
+		}},
+		wantErrMsg: `at index 0: upstream: stamp "` + testDoHStamp +
+			`": unexpected protocol DoH`,
+	}, {
+		name: "dnscrypt_fallback",
+		fallbacks: []*DNSCryptFallback{{
+			Upstream: testDNSCryptStamp,
+			Fallback: testDNSCryptStamp,
+		}},
+		wantErrMsg: `at index 0: fallback: stamp "` + testDNSCryptStamp +
+			`": unexpected protocol DNSCrypt`,
+	}, {
+		name: "bad_stamp",
+		fallbacks: []*DNSCryptFallback{{
+			Upstream: "sdns://bad",
+			Fallback: testDoHStamp,
+		}},
+		wantErrMsg: `at index 0: upstream: parsing stamp "sdns://bad": ` +
+			`unsupported stamp version or protocol`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newDNSCryptFallbacks(tc.fallbacks)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestDNSCryptUpstream_verifyCert(t *testing.T) {
+	u := &dnsCryptUpstream{
+		Upstream: &aghtest.UpstreamMock{
+			OnAddress: func() (addr string) { return testDNSCryptStamp },
+		},
+		mu: &sync.Mutex{},
+	}
+
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	cert := &dnscrypt.Cert{
+		Serial:   1,
+		NotAfter: uint32(notAfter.Unix()),
+	}
+
+	require.NoError(t, u.verifyCert(cert))
+	require.NoError(t, u.verifyCert(cert))
+
+	gotNotAfter, serial, rotations := u.certInfo()
+	assert.True(t, notAfter.Equal(gotNotAfter))
+	assert.Equal(t, uint32(1), serial)
+	assert.Zero(t, rotations)
+
+	cert.Serial = 2
+	require.NoError(t, u.verifyCert(cert))
+
+	_, serial, rotations = u.certInfo()
+	assert.Equal(t, uint32(2), serial)
+	assert.Equal(t, uint(1), rotations)
+
+	cert.NotAfter = uint32(time.Now().Add(-time.Hour).Unix())
+	assert.Error(t, u.verifyCert(cert))
+}
+
+func TestDNSCryptUpstream_Exchange(t *testing.T) {
+	const fallbackAddr = "https://doh.example.org:443/dns-query"
+
+	req := createTestMessage("example.org.")
+
+	var fail, fallbackFail bool
+	newMock := func(addr string, fail *bool) (u *aghtest.UpstreamMock) {
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (a string) { return addr },
+			OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+				if *fail {
+					return nil, errors.Error("test error")
+				}
+
+				return (&dns.Msg{}).SetReply(req), nil
+			},
+			OnClose: func() (err error) { return nil },
+		}
+	}
+
+	u := &dnsCryptUpstream{
+		Upstream: newMock(testDNSCryptStamp, &fail),
+		fallback: newMock(fallbackAddr, &fallbackFail),
+		mu:       &sync.Mutex{},
+	}
+
+	resp, err := u.Exchange(req)
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	fail = true
+	resp, err = u.Exchange(req)
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	fallbackFail = true
+	_, err = u.Exchange(req)
+	testutil.AssertErrorMsg(t, "test error\nfallback "+fallbackAddr+": test error", err)
+}
+
+func TestApplyDNSCryptUpstreams(t *testing.T) {
+	const plainAddr = "192.0.2.3:53"
+
+	uc, err := proxy.ParseUpstreamsConfig(
+		[]string{testDNSCryptStamp, plainAddr},
+		&upstream.Options{},
+	)
+	require.NoError(t, err)
+
+	err = applyDNSCryptUpstreams(uc, []*DNSCryptFallback{{
+		Upstream: testDNSCryptStamp,
+		Fallback: testDoHStamp,
+	}}, &upstream.Options{})
+	require.NoError(t, err)
+	require.Len(t, uc.Upstreams, 2)
+
+	dc := testutil.RequireTypeAssert[*dnsCryptUpstream](t, uc.Upstreams[0])
+	require.NotNil(t, dc.fallback)
+
+	assert.Equal(t, "https://doh.example.org:443/dns-query", dc.fallback.Address())
+	assert.Equal(t, plainAddr, uc.Upstreams[1].Address())
+
+	statuses := applyUpstreamStatuses(uc)
+	require.Len(t, statuses, 2)
+
+	j := statuses[0].toJSON()
+	require.NotNil(t, j.DNSCrypt)
+
+	assert.True(t, j.Healthy)
+	assert.Equal(t, dc.fallback.Address(), j.DNSCrypt.Fallback)
+	assert.Nil(t, j.DNSCrypt.CertNotAfter)
+	assert.Nil(t, statuses[1].toJSON().DNSCrypt)
+
+	require.NoError(t, uc.Close())
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/rdns"
+	"github.com/AdguardTeam/AdGuardHome/internal/rebinding"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
@@ -106,6 +107,11 @@ type Server struct {
 	// dnsProxy is the DNS proxy for forwarding client's DNS requests.
 	dnsProxy *proxy.Proxy
 
+	// listeningProxy is the proxy serving on the listeners after
+	// [Server.Reload] has replaced dnsProxy keeping them open.  It's nil if
+	// dnsProxy serves on the listeners itself.
+	listeningProxy *proxy.Proxy
+
 	// dnsFilter is the DNS filter for filtering client's DNS requests and
 	// responses.
 	dnsFilter *filtering.DNSFilter
@@ -138,6 +144,66 @@ type Server struct {
 	// privateNets is the configured set of IP networks considered private.
 	privateNets netutil.SubnetSet
 
+	// drainer refuses the new requests and waits for the ones being processed
+	// in the drain mode.  It must not be nil.
+	drainer *drainer
+
+	// cachePersist records the cacheable responses to persist the DNS cache
+	// across restarts.  It must not be nil.
+	cachePersist *cachePersister
+
+	// warmUpDomains are the fully-qualified domain names resolved right after
+	// the start and after the cache is cleared.
+	warmUpDomains []string
+
+	// reverseZones are the reverse DNS zones delegated to the local DNS
+	// servers, the most specific ones first.
+	reverseZones []*reverseZone
+
+	// forwardingRules are the conditional forwarding rules followed by the
+	// rules routing the requests by their types.  The first matching rule is
+	// used.
+	forwardingRules []*forwardingRule
+
+	// localZones are the zones served authoritatively by the server, the most
+	// specific ones first.
+	localZones []*localZone
+
+	// encryptedClientRules are the rules allowing or denying the requests over
+	// the encrypted protocols by the metadata of the clients.
+	encryptedClientRules []*encryptedClientRule
+
+	// sortlist are the rules reordering the addresses in the responses.
+	sortlist []*sortlistRule
+
+	// rebinding is the DNS rebinding protection.  It's nil if the protection
+	// is disabled.
+	rebinding *rebinding.Protector
+
+	// usedUpstreams tracks the upstreams used in the [UpstreamModeWeighted]
+	// mode.  It must not be nil.
+	usedUpstreams *usedUpstreams
+
+	// ecsPolicy is the EDNS Client Subnet policy.  It's nil if EDNS Client
+	// Subnet is disabled.
+	ecsPolicy *ecsPolicy
+
+	// upstreamBreakers are the upstreams applying the concurrency limits and
+	// the circuit breakers, if configured.
+	upstreamBreakers []*breakerUpstream
+
+	// healthChecker checks the health of the general and domain-specific
+	// upstreams.  It's nil if the health checks aren't configured.
+	healthChecker *upstreamHealthChecker
+
+	// malformed counts the malformed queries and bans their senders.  It must
+	// not be nil.
+	malformed *malformedTracker
+
+	// statusUpstreams are the upstreams keeping track of the results of the
+	// exchanges with the general and domain-specific upstreams.
+	statusUpstreams []*statusUpstream
+
 	// addrProc, if not nil, is used to process clients' IP addresses with rDNS,
 	// WHOIS, etc.
 	addrProc client.AddressProcessor
@@ -182,6 +248,10 @@ type Server struct {
 	// updating the protection configuration after a pause is running at a time.
 	protectionUpdateInProgress atomic.Bool
 
+	// fallbackInUse is true if the last request resolved by an upstream was
+	// resolved by a fallback one.  See [Server.logFallbackUse].
+	fallbackInUse atomic.Bool
+
 	// conf is the current configuration of the server.
 	conf ServerConfig
 
@@ -221,12 +291,10 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 	if p.LocalDomain == "" {
 		localDomainSuffix = defaultLocalDomainSuffix
 	} else {
-		err = netutil.ValidateDomainName(p.LocalDomain)
+		localDomainSuffix, err = aghnet.ParseDomainName(p.LocalDomain)
 		if err != nil {
 			return nil, fmt.Errorf("local domain: %w", err)
 		}
-
-		localDomainSuffix = p.LocalDomain
 	}
 
 	if p.Anonymizer == nil {
@@ -253,6 +321,11 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 			MaxCount:  defaultClientIDCacheCount,
 		}),
 		anonymizer: p.Anonymizer,
+		drainer:    newDrainer(),
+
+		usedUpstreams: newUsedUpstreams(),
+		malformed:     newMalformedTracker(),
+		cachePersist:  newCachePersister(0),
 		conf: ServerConfig{
 			ServePlainDNS: true,
 		},
@@ -281,6 +354,8 @@ func (s *Server) Close() {
 	s.serverLock.Lock()
 	defer s.serverLock.Unlock()
 
+	s.dumpCacheLocked()
+
 	// TODO(s.chzhen):  Remove it.
 	s.stats = nil
 	s.queryLog = nil
@@ -384,7 +459,11 @@ func (s *Server) Exchange(ip netip.Addr) (host string, ttl time.Duration, err er
 	}
 
 	var errMsg string
-	if s.privateNets.Contains(ip) {
+	if s.setReverseZoneUpstreamLocked(dctx) {
+		// The reverse zones take precedence over the private rDNS settings,
+		// the same way they do for the requests of the private clients.
+		errMsg = "resolving an address in a reverse zone: %w"
+	} else if s.privateNets.Contains(ip) {
 		if !s.conf.UsePrivateRDNS {
 			return "", 0, nil
 		}
@@ -394,6 +473,7 @@ func (s *Server) Exchange(ip netip.Addr) (host string, ttl time.Duration, err er
 	} else {
 		errMsg = "resolving an address: %w"
 	}
+
 	if err = s.internalProxy.Resolve(dctx); err != nil {
 		return "", 0, fmt.Errorf(errMsg, err)
 	}
@@ -458,6 +538,10 @@ func (s *Server) startLocked() error {
 	err := s.dnsProxy.Start(context.Background())
 	if err == nil {
 		s.isRunning = true
+		s.drainer.reset()
+		s.restoreCacheLocked()
+		s.startWarmUpLocked()
+		s.healthChecker.start()
 	}
 
 	return err
@@ -479,6 +563,18 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 
 	s.initDefaultSettings()
 
+	err = validateDoHEndpoints(s.conf.DoHEndpoints)
+	if err != nil {
+		return fmt.Errorf("checking doh endpoints: %w", err)
+	}
+
+	err = s.conf.MalformedQueries.validate()
+	if err != nil {
+		return fmt.Errorf("checking malformed queries: %w", err)
+	}
+
+	s.malformed.setConfig(s.conf.MalformedQueries)
+
 	err = s.prepareInternalDNS()
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
@@ -501,6 +597,11 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		return fmt.Errorf("preparing access: %w", err)
 	}
 
+	s.warmUpDomains, err = newWarmUpDomains(s.conf.WarmUpDomains)
+	if err != nil {
+		return fmt.Errorf("preparing warm-up domains: %w", err)
+	}
+
 	proxyConfig.Fallbacks, err = s.setupFallbackDNS()
 	if err != nil {
 		return fmt.Errorf("setting up fallback dns servers: %w", err)
@@ -529,7 +630,7 @@ func (s *Server) prepareUpstreamSettings(boot upstream.Resolver) (err error) {
 		return fmt.Errorf("loading upstreams: %w", err)
 	}
 
-	uc, err := newUpstreamConfig(upstreams, defaultDNS, &upstream.Options{
+	opts := &upstream.Options{
 		Bootstrap:    boot,
 		Timeout:      s.conf.UpstreamTimeout,
 		HTTPVersions: UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams),
@@ -543,12 +644,74 @@ func (s *Server) prepareUpstreamSettings(boot upstream.Resolver) (err error) {
 		// TODO(a.garipov): Investigate if that's true.
 		RootCAs:      s.conf.TLSv12Roots,
 		CipherSuites: s.conf.TLSCiphers,
-	})
+	}
+
+	uc, err := newUpstreamConfig(upstreams, defaultDNS, opts)
 	if err != nil {
 		return fmt.Errorf("preparing upstream config: %w", err)
 	}
 
+	err = applyUpstreamTimeouts(uc, s.conf.UpstreamRetry, opts)
+	if err == nil {
+		err = applyDNSCryptUpstreams(uc, s.conf.DNSCryptFallbacks, opts)
+	}
+
+	if err != nil {
+		logCloserErr(uc, "dnsforward: closing upstreams: %s")
+
+		return fmt.Errorf("preparing upstream config: %w", err)
+	}
+
+	poolQUICUpstreams(uc, opts, s.conf.QUICMaxStreamsPerConn)
+	statuses := applyUpstreamStatuses(uc)
+	applyResponseLimits(uc, s.conf.UpstreamResponseLimits)
+
+	var breakers []*breakerUpstream
+	err = applyUpstreamRetry(uc, s.conf.UpstreamRetry)
+	if err == nil {
+		err = applyTTLOverrides(uc, s.conf.UpstreamTTLOverrides)
+	}
+
+	if err == nil {
+		breakers, err = applyUpstreamBreakers(uc, s.conf.UpstreamBreaker, s.conf.Events)
+	}
+
+	var checker *upstreamHealthChecker
+	if err == nil {
+		checker, err = applyUpstreamHealthChecks(uc, s.conf.UpstreamHealthCheck, s.conf.Events)
+	}
+
+	var ecs *ecsPolicy
+	if err == nil {
+		ecs, err = applyECSPolicy(uc, s.conf.EDNSClientSubnet)
+	}
+
+	if err == nil && s.conf.CoalesceRequests {
+		coalesceUpstreams(uc)
+	}
+
+	if err == nil {
+		switch s.conf.UpstreamMode {
+		case UpstreamModeWeighted:
+			err = applyUpstreamWeights(uc, s.conf.UpstreamWeights, s.usedUpstreams)
+		case UpstreamModeFailOver:
+			err = ApplyUpstreamMode(uc, UpstreamModeFailOver, 0)
+		default:
+			// Go on, the other modes are implemented by the proxy.
+		}
+	}
+
+	if err != nil {
+		logCloserErr(uc, "dnsforward: closing upstreams: %s")
+
+		return fmt.Errorf("preparing upstream config: %w", err)
+	}
+
 	s.conf.UpstreamConfig = uc
+	s.upstreamBreakers = breakers
+	s.healthChecker = checker
+	s.statusUpstreams = statuses
+	s.ecsPolicy = ecs
 
 	return nil
 }
@@ -590,13 +753,14 @@ func (s *Server) prepareLocalResolvers() (uc *proxy.UpstreamConfig, err error) {
 
 	opts := &upstream.Options{
 		Bootstrap: s.bootstrap,
-		Timeout:   defaultLocalTimeout,
+		Timeout:   s.conf.PrivateRDNSTimeout,
 		// TODO(e.burkov): Should we verify server's certificates?
 		PreferIPv6: s.conf.BootstrapPreferIPv6,
 	}
 
 	addrs := s.conf.LocalPTRResolvers
-	uc, err = newPrivateConfig(addrs, ownAddrs, s.sysResolvers, s.privateNets, opts)
+	sysResolvers := s.defaultPrivateResolvers(ownAddrs)
+	uc, err = newPrivateConfig(addrs, ownAddrs, sysResolvers, s.privateNets, opts)
 	if err != nil {
 		return nil, fmt.Errorf("preparing resolvers: %w", err)
 	}
@@ -642,6 +806,61 @@ func (s *Server) prepareInternalDNS() (err error) {
 		return err
 	}
 
+	s.reverseZones, err = newReverseZones(s.conf.ReverseZones, &upstream.Options{
+		Bootstrap:  s.bootstrap,
+		Timeout:    s.conf.PrivateRDNSTimeout,
+		PreferIPv6: s.conf.BootstrapPreferIPv6,
+	})
+	if err != nil {
+		return fmt.Errorf("preparing reverse zones: %w", err)
+	}
+
+	rulesOpts := &upstream.Options{
+		Bootstrap:    s.bootstrap,
+		Timeout:      s.conf.UpstreamTimeout,
+		HTTPVersions: UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams),
+		PreferIPv6:   s.conf.BootstrapPreferIPv6,
+		RootCAs:      s.conf.TLSv12Roots,
+		CipherSuites: s.conf.TLSCiphers,
+	}
+
+	s.forwardingRules, err = newForwardingRules(s.conf.ConditionalForwarding, rulesOpts, s.conf.Tor)
+	if err != nil {
+		return fmt.Errorf("preparing conditional forwarding: %w", err)
+	}
+
+	qtypeRules, err := newQTypeRules(s.conf.QTypeUpstreams, rulesOpts, s.conf.PrivateRDNSUpstreamConfig)
+	if err != nil {
+		return fmt.Errorf("preparing qtype upstreams: %w", err)
+	}
+
+	// Append the qtype rules, since the conditional forwarding rules have
+	// higher priority.
+	s.forwardingRules = append(s.forwardingRules, qtypeRules...)
+
+	s.localZones, err = newLocalZones(s.conf.LocalZones)
+	if err != nil {
+		return fmt.Errorf("preparing local zones: %w", err)
+	}
+
+	s.encryptedClientRules, err = newEncryptedClientRules(s.conf.EncryptedClientRules)
+	if err != nil {
+		return fmt.Errorf("preparing access: %w", err)
+	}
+
+	s.sortlist, err = newSortlist(s.conf.Sortlist)
+	if err != nil {
+		return fmt.Errorf("preparing sortlist: %w", err)
+	}
+
+	s.rebinding = nil
+	if c := s.conf.RebindingProtection; c != nil && c.Enabled {
+		s.rebinding, err = rebinding.New(c)
+		if err != nil {
+			return fmt.Errorf("preparing rebinding protection: %w", err)
+		}
+	}
+
 	err = s.prepareInternalProxy()
 	if err != nil {
 		return fmt.Errorf("preparing internal proxy: %w", err)
@@ -669,6 +888,8 @@ func (s *Server) setupFallbackDNS() (uc *proxy.UpstreamConfig, err error) {
 		return nil, err
 	}
 
+	markFallbacks(uc)
+
 	return uc, nil
 }
 
@@ -767,7 +988,17 @@ func (s *Server) stopLocked() {
 	// This will require filtering all the non-critical errors in
 	// [upstream.Upstream] implementations.
 
-	if s.dnsProxy != nil {
+	if s.listeningProxy != nil {
+		err := s.listeningProxy.Shutdown(context.Background())
+		if err != nil {
+			log.Error("dnsforward: closing primary resolvers: %s", err)
+		}
+
+		s.listeningProxy = nil
+
+		// dnsProxy isn't started, so closing it doesn't close its upstreams.
+		closeProxyUpstreams(s.dnsProxy)
+	} else if s.dnsProxy != nil {
 		// TODO(e.burkov):  Use context properly.
 		err := s.dnsProxy.Shutdown(context.Background())
 		if err != nil {
@@ -779,6 +1010,14 @@ func (s *Server) stopLocked() {
 		logCloserErr(b, "dnsforward: closing bootstrap %s: %s", b.Address())
 	}
 
+	closeReverseZones(s.reverseZones)
+	s.reverseZones = nil
+
+	closeForwardingRules(s.forwardingRules)
+	s.forwardingRules = nil
+
+	s.healthChecker.shutdown()
+
 	s.isRunning = false
 }
 
@@ -822,6 +1061,12 @@ func (s *Server) Reconfigure(conf *ServerConfig) error {
 	s.serverLock.Lock()
 	defer s.serverLock.Unlock()
 
+	return s.reconfigureLocked(conf)
+}
+
+// reconfigureLocked applies the new configuration to the DNS server.
+// s.serverLock is expected to be locked.
+func (s *Server) reconfigureLocked(conf *ServerConfig) (err error) {
 	log.Info("dnsforward: starting reconfiguring server")
 	defer log.Info("dnsforward: finished reconfiguring server")
 
@@ -843,7 +1088,7 @@ func (s *Server) Reconfigure(conf *ServerConfig) error {
 
 	// TODO(e.burkov):  It seems an error here brings the server down, which is
 	// not reliable enough.
-	err := s.Prepare(conf)
+	err = s.Prepare(conf)
 	if err != nil {
 		return fmt.Errorf("could not reconfigure the server: %w", err)
 	}
@@ -858,6 +1103,12 @@ func (s *Server) Reconfigure(conf *ServerConfig) error {
 
 // ServeHTTP is a HTTP handler method we use to provide DNS-over-HTTPS.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.drainer.isDraining() {
+		serveDrainingHTTP(w)
+
+		return
+	}
+
 	if prx := s.proxy(); prx != nil {
 		prx.ServeHTTP(w, r)
 	}
@@ -0,0 +1,159 @@
+package dnsforward
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DefaultDoHPath is the URL path of the DNS-over-HTTPS endpoint used when no
+// custom endpoints are configured.
+const DefaultDoHPath = "/dns-query"
+
+// DoHEndpoint is a DNS-over-HTTPS endpoint served on a custom URL path.  The
+// ClientID may be appended to the path as an additional path element, as with
+// the default endpoint.
+type DoHEndpoint struct {
+	// Path is the URL path of the endpoint, for example "/dns-query" or
+	// "/family/kids".  It must be absolute and clean.
+	Path string `yaml:"path"`
+
+	// ClientID, if not empty, is the ClientID of the requests to the endpoint
+	// that contain no ClientID either in the path or in the server name.  It
+	// allows applying the settings of a persistent client to all requests to
+	// the endpoint.
+	ClientID string `yaml:"client_id"`
+}
+
+// defaultDoHEndpoints are the endpoints served when no custom ones are
+// configured.
+var defaultDoHEndpoints = []*DoHEndpoint{{
+	Path: DefaultDoHPath,
+}}
+
+// reservedPathElems are the first elements of the URL paths used by the web
+// interface and its API, which can't be used for the DNS-over-HTTPS endpoints.
+// Keep in sync with the handlers registered on the web mux in package home.
+var reservedPathElems = []string{
+	"apple",
+	"assets",
+	"control",
+	"healthz",
+	unfilteredDoHPathElem,
+}
+
+// validateDoHEndpoints returns an error if endpoints contain an invalid or
+// conflicting endpoint.
+func validateDoHEndpoints(endpoints []*DoHEndpoint) (err error) {
+	seen := make(map[string]struct{}, len(endpoints))
+	for i, e := range endpoints {
+		err = validateDoHEndpoint(e)
+		if err != nil {
+			return fmt.Errorf("doh endpoint at index %d: %w", i, err)
+		}
+
+		if _, ok := seen[e.Path]; ok {
+			return fmt.Errorf("doh endpoint at index %d: duplicate path %q", i, e.Path)
+		}
+
+		seen[e.Path] = struct{}{}
+	}
+
+	return nil
+}
+
+// validateDoHEndpoint returns an error if e is not a valid DNS-over-HTTPS
+// endpoint.
+func validateDoHEndpoint(e *DoHEndpoint) (err error) {
+	if e == nil {
+		return errors.Error("no value")
+	}
+
+	p := e.Path
+	if p == "" || p[0] != '/' || p == "/" {
+		return fmt.Errorf("path %q: must be absolute and not root", p)
+	} else if path.Clean(p) != p {
+		return fmt.Errorf("path %q: must be clean", p)
+	} else if strings.ContainsAny(p, "?#%{} \t") {
+		return fmt.Errorf("path %q: bad characters", p)
+	}
+
+	first, _, _ := strings.Cut(p[1:], "/")
+	if slices.Contains(reservedPathElems, first) || strings.Contains(first, ".") {
+		return fmt.Errorf("path %q: conflicts with the web interface", p)
+	}
+
+	if e.ClientID != "" {
+		err = ValidateClientID(e.ClientID)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dohEndpointsOrDefault returns endpoints or the default ones if endpoints are
+// empty.
+func dohEndpointsOrDefault(endpoints []*DoHEndpoint) (res []*DoHEndpoint) {
+	if len(endpoints) == 0 {
+		return defaultDoHEndpoints
+	}
+
+	return endpoints
+}
+
+// PublicDoHPath returns the URL path of the DNS-over-HTTPS endpoint to show to
+// the users, which is the first one without a default ClientID.  endpoints
+// must be valid.
+func PublicDoHPath(endpoints []*DoHEndpoint) (p string) {
+	endpoints = dohEndpointsOrDefault(endpoints)
+
+	i := slices.IndexFunc(endpoints, func(e *DoHEndpoint) (ok bool) {
+		return e.ClientID == ""
+	})
+	if i < 0 {
+		i = 0
+	}
+
+	return endpoints[i].Path
+}
+
+// matchDoHEndpoint returns the endpoint serving the URL path and the rest of
+// the path after the path of the endpoint without the leading slash.  The
+// longest matching endpoint is returned.  ok is false if there is no such
+// endpoint.  The troubleshooting endpoint is always matched.  endpoints must be
+// valid.
+func matchDoHEndpoint(
+	endpoints []*DoHEndpoint,
+	urlPath string,
+) (e *DoHEndpoint, rest string, ok bool) {
+	p := path.Clean("/" + urlPath)
+
+	unfiltered := &DoHEndpoint{Path: "/" + unfilteredDoHPathElem}
+	for _, cand := range append(slices.Clip(dohEndpointsOrDefault(endpoints)), unfiltered) {
+		if e != nil && len(cand.Path) <= len(e.Path) {
+			continue
+		}
+
+		if p == cand.Path {
+			e, rest = cand, ""
+		} else if r, found := strings.CutPrefix(p, cand.Path+"/"); found {
+			e, rest = cand, r
+		}
+	}
+
+	return e, rest, e != nil
+}
+
+// IsDoHPath returns true if urlPath is served by one of endpoints or by the
+// troubleshooting endpoint.  endpoints must be valid.
+func IsDoHPath(endpoints []*DoHEndpoint, urlPath string) (ok bool) {
+	_, _, ok = matchDoHEndpoint(endpoints, urlPath)
+
+	return ok
+}
@@ -0,0 +1,263 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDoHEndpoints(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		endpoints  []*DoHEndpoint
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		endpoints:  nil,
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		endpoints: []*DoHEndpoint{{
+			Path: DefaultDoHPath,
+		}, {
+			Path:     "/family/kids",
+			ClientID: "kids",
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "doh endpoint at index 0: no value",
+		endpoints:  []*DoHEndpoint{nil},
+	}, {
+		name:       "root",
+		wantErrMsg: `doh endpoint at index 0: path "/": must be absolute and not root`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/",
+		}},
+	}, {
+		name:       "not_clean",
+		wantErrMsg: `doh endpoint at index 0: path "/family/": must be clean`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/family/",
+		}},
+	}, {
+		name:       "bad_characters",
+		wantErrMsg: `doh endpoint at index 0: path "/dns{?dns}": bad characters`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/dns{?dns}",
+		}},
+	}, {
+		name: "reserved",
+		wantErrMsg: `doh endpoint at index 0: path "/control/dns": ` +
+			`conflicts with the web interface`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/control/dns",
+		}},
+	}, {
+		name: "health_check",
+		wantErrMsg: `doh endpoint at index 0: path "/healthz": ` +
+			`conflicts with the web interface`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/healthz",
+		}},
+	}, {
+		name: "file",
+		wantErrMsg: `doh endpoint at index 0: path "/index.html": ` +
+			`conflicts with the web interface`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/index.html",
+		}},
+	}, {
+		name: "bad_clientid",
+		wantErrMsg: `doh endpoint at index 0: invalid clientid "!!!": ` +
+			`bad hostname label rune '!'`,
+		endpoints: []*DoHEndpoint{{
+			Path:     "/family",
+			ClientID: "!!!",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `doh endpoint at index 1: duplicate path "/family"`,
+		endpoints: []*DoHEndpoint{{
+			Path: "/family",
+		}, {
+			Path:     "/family",
+			ClientID: "kids",
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDoHEndpoints(tc.endpoints)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestPublicDoHPath(t *testing.T) {
+	testCases := []struct {
+		name      string
+		want      string
+		endpoints []*DoHEndpoint
+	}{{
+		name:      "default",
+		want:      DefaultDoHPath,
+		endpoints: nil,
+	}, {
+		name: "first_without_clientid",
+		want: "/resolve",
+		endpoints: []*DoHEndpoint{{
+			Path:     "/kids",
+			ClientID: "kids",
+		}, {
+			Path: "/resolve",
+		}},
+	}, {
+		name: "all_with_clientid",
+		want: "/kids",
+		endpoints: []*DoHEndpoint{{
+			Path:     "/kids",
+			ClientID: "kids",
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, PublicDoHPath(tc.endpoints))
+		})
+	}
+}
+
+func TestMatchDoHEndpoint(t *testing.T) {
+	family := &DoHEndpoint{
+		Path: "/family",
+	}
+
+	kids := &DoHEndpoint{
+		Path:     "/family/kids",
+		ClientID: "kids",
+	}
+
+	endpoints := []*DoHEndpoint{family, kids}
+
+	testCases := []struct {
+		want     *DoHEndpoint
+		name     string
+		path     string
+		wantRest string
+		wantOK   bool
+	}{{
+		want:     family,
+		name:     "exact",
+		path:     "/family",
+		wantRest: "",
+		wantOK:   true,
+	}, {
+		want:     family,
+		name:     "clientid",
+		path:     "/family/cli/",
+		wantRest: "cli",
+		wantOK:   true,
+	}, {
+		want:     kids,
+		name:     "longest",
+		path:     "/family/kids",
+		wantRest: "",
+		wantOK:   true,
+	}, {
+		want:     kids,
+		name:     "longest_clientid",
+		path:     "/family/kids/cli",
+		wantRest: "cli",
+		wantOK:   true,
+	}, {
+		want:     nil,
+		name:     "prefix_only",
+		path:     "/familyfoo",
+		wantRest: "",
+		wantOK:   false,
+	}, {
+		want:     nil,
+		name:     "default_not_served",
+		path:     DefaultDoHPath,
+		wantRest: "",
+		wantOK:   false,
+	}, {
+		want: &DoHEndpoint{
+			Path: "/" + unfilteredDoHPathElem,
+		},
+		name:     "unfiltered",
+		path:     "/dns-query-unfiltered/cli",
+		wantRest: "cli",
+		wantOK:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, rest, ok := matchDoHEndpoint(endpoints, tc.path)
+			assert.Equal(t, tc.want, e)
+			assert.Equal(t, tc.wantRest, rest)
+			assert.Equal(t, tc.wantOK, ok)
+		})
+	}
+}
+
+func TestServer_clientIDFromDNSContext_dohEndpoint(t *testing.T) {
+	srv := &Server{
+		conf: ServerConfig{
+			TLSConfig: TLSConfig{
+				ServerName: "example.com",
+			},
+			Config: Config{
+				DoHEndpoints: []*DoHEndpoint{{
+					Path:     "/kids",
+					ClientID: "kids",
+				}},
+			},
+		},
+		baseLogger: slogutil.NewDiscardLogger(),
+	}
+
+	testCases := []struct {
+		name         string
+		path         string
+		cliSrvName   string
+		wantClientID string
+	}{{
+		name:         "default",
+		path:         "/kids",
+		cliSrvName:   "example.com",
+		wantClientID: "kids",
+	}, {
+		name:         "path",
+		path:         "/kids/cli",
+		cliSrvName:   "example.com",
+		wantClientID: "cli",
+	}, {
+		name:         "server_name",
+		path:         "/kids",
+		cliSrvName:   "cli.example.com",
+		wantClientID: "cli",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newHTTPReq(tc.cliSrvName, true)
+			r.URL.Path = tc.path
+
+			pctx := &proxy.DNSContext{
+				Proto:       proxy.ProtoHTTPS,
+				HTTPRequest: r,
+			}
+
+			clientID, err := srv.clientIDFromDNSContext(pctx)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantClientID, clientID)
+		})
+	}
+}
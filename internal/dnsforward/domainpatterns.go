@@ -0,0 +1,111 @@
+package dnsforward
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// domainPatterns are the parsed domain patterns, such as the ones of
+// [ForwardingRule.Domains].  A pattern is either a domain name matching along
+// with its subdomains, a "*." wildcard matching only the subdomains, or a
+// regular expression enclosed in slashes.
+type domainPatterns struct {
+	// domains are the lowercased fully-qualified domain names matching along
+	// with their subdomains.
+	domains []string
+
+	// wildcards are the lowercased fully-qualified domain names, only the
+	// subdomains of which match.
+	wildcards []string
+
+	// regexps are the regular expressions matching the lowercased names
+	// without the trailing dot.
+	regexps []*regexp.Regexp
+}
+
+// newDomainPatterns parses the domain patterns pats.
+func newDomainPatterns(pats []string) (p *domainPatterns, err error) {
+	p = &domainPatterns{}
+	for i, pat := range pats {
+		err = p.add(pat)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return p, nil
+}
+
+// add parses the domain pattern pat and adds it to p.
+func (p *domainPatterns) add(pat string) (err error) {
+	if reStr, ok := strings.CutPrefix(pat, "/"); ok {
+		reStr, ok = strings.CutSuffix(reStr, "/")
+		if !ok || reStr == "" {
+			return fmt.Errorf("bad regular expression %q", pat)
+		}
+
+		var re *regexp.Regexp
+		re, err = regexp.Compile(reStr)
+		if err != nil {
+			return fmt.Errorf("compiling regular expression: %w", err)
+		}
+
+		p.regexps = append(p.regexps, re)
+
+		return nil
+	}
+
+	name, isWildcard := strings.CutPrefix(pat, "*.")
+	name, err = aghnet.ParseDomainName(name)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	if isWildcard {
+		p.wildcards = append(p.wildcards, dns.Fqdn(name))
+	} else {
+		p.domains = append(p.domains, dns.Fqdn(name))
+	}
+
+	return nil
+}
+
+// isEmpty returns true if p contains no patterns.
+func (p *domainPatterns) isEmpty() (ok bool) {
+	return len(p.domains) == 0 && len(p.wildcards) == 0 && len(p.regexps) == 0
+}
+
+// matches returns true if name matches any of the patterns of p or if p is
+// empty.  name must be a lowercased fully-qualified domain name.
+func (p *domainPatterns) matches(name string) (ok bool) {
+	if p.isEmpty() {
+		return true
+	}
+
+	for _, d := range p.domains {
+		if name == d || netutil.IsSubdomain(name, d) {
+			return true
+		}
+	}
+
+	for _, d := range p.wildcards {
+		if netutil.IsSubdomain(name, d) {
+			return true
+		}
+	}
+
+	host := strings.TrimSuffix(name, ".")
+	for _, re := range p.regexps {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,154 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// drainer tracks the requests being processed and allows waiting for them to
+// finish while refusing the new ones.
+type drainer struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// idle is closed when the drainer is draining and there are no requests
+	// being processed.
+	idle chan struct{}
+
+	// inflight is the number of requests being processed.
+	inflight uint
+
+	// draining is true if the new requests must be refused.
+	draining bool
+}
+
+// newDrainer returns a new properly initialized *drainer.
+func newDrainer() (d *drainer) {
+	return &drainer{
+		mu:   &sync.Mutex{},
+		idle: make(chan struct{}),
+	}
+}
+
+// begin registers a new request.  If ok is false, the drainer is draining and
+// the request must be refused.  Otherwise, end must be called after the request
+// is processed.
+func (d *drainer) begin() (ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+
+	d.inflight++
+
+	return true
+}
+
+// end unregisters a request registered with begin.
+func (d *drainer) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inflight--
+	if d.draining && d.inflight == 0 {
+		close(d.idle)
+	}
+}
+
+// drain makes the drainer refuse the new requests and waits until the ones
+// being processed are finished or ctx is done.
+func (d *drainer) drain(ctx context.Context) (err error) {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		if d.inflight == 0 {
+			close(d.idle)
+		}
+	}
+
+	idle, inflight := d.idle, d.inflight
+	d.mu.Unlock()
+
+	log.Info("dnsforward: draining: waiting for %d requests", inflight)
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		return fmt.Errorf("%d requests left: %w", d.inflight, ctx.Err())
+	}
+}
+
+// isDraining returns true if the new requests must be refused.
+func (d *drainer) isDraining() (ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.draining
+}
+
+// reset makes the drainer accept the new requests again.
+func (d *drainer) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		d.draining = false
+		d.idle = make(chan struct{})
+	}
+}
+
+// Drain puts s into the drain mode and waits until the requests being
+// processed are answered or ctx is done.  In the drain mode, the connections,
+// which the new requests are received over, are closed, and the new DoH
+// requests are answered with 503 Service Unavailable and closing the
+// connection, so that the clients use other servers.  The new plain UDP and
+// DNSCrypt requests are answered with REFUSED.  Starting s again makes it
+// accept the requests.
+//
+// TODO:  Close the TCP listeners themselves once module dnsproxy allows closing
+// them separately from the UDP ones, which the requests being processed are
+// answered over.
+func (s *Server) Drain(ctx context.Context) (err error) {
+	err = s.drainer.drain(ctx)
+	if err != nil {
+		return fmt.Errorf("draining: %w", err)
+	}
+
+	return nil
+}
+
+// drainResponse returns the response to the request in pctx received in the
+// drain mode.  It's nil for the connection-oriented protocols, so that module
+// dnsproxy closes the connection.
+func (s *Server) drainResponse(pctx *proxy.DNSContext) (resp *dns.Msg) {
+	switch pctx.Proto {
+	case proxy.ProtoTCP, proxy.ProtoTLS, proxy.ProtoQUIC:
+		return nil
+	default:
+		return s.makeResponseREFUSED(pctx.Req)
+	}
+}
+
+// serveDrainingHTTP writes the response to a DoH request received in the drain
+// mode to w.
+func serveDrainingHTTP(w http.ResponseWriter) {
+	h := w.Header()
+	// Module golibs doesn't have a constant for this header.
+	h.Set("Connection", "close")
+	h.Set(httphdr.RetryAfter, "1")
+
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
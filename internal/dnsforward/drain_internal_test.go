@@ -0,0 +1,146 @@
+package dnsforward
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainer(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	t.Run("idle", func(t *testing.T) {
+		d := newDrainer()
+
+		err := d.drain(testutil.ContextWithTimeout(t, timeout))
+		require.NoError(t, err)
+
+		assert.False(t, d.begin())
+	})
+
+	t.Run("inflight", func(t *testing.T) {
+		d := newDrainer()
+		require.True(t, d.begin())
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- d.drain(testutil.ContextWithTimeout(t, time.Second))
+		}()
+
+		require.Eventually(t, func() (ok bool) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			return d.draining
+		}, timeout, time.Millisecond)
+
+		assert.False(t, d.begin())
+
+		d.end()
+
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		d := newDrainer()
+		require.True(t, d.begin())
+
+		err := d.drain(testutil.ContextWithTimeout(t, timeout))
+		testutil.AssertErrorMsg(t, "1 requests left: "+context.DeadlineExceeded.Error(), err)
+
+		d.end()
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		d := newDrainer()
+
+		err := d.drain(testutil.ContextWithTimeout(t, timeout))
+		require.NoError(t, err)
+
+		d.reset()
+		require.True(t, d.begin())
+
+		d.end()
+	})
+}
+
+func TestServer_drainResponse(t *testing.T) {
+	s := &Server{}
+	req := createTestMessage("host.example.")
+
+	testCases := []struct {
+		name      string
+		proto     proxy.Proto
+		wantRcode int
+		wantNil   bool
+	}{{
+		name:      "udp",
+		proto:     proxy.ProtoUDP,
+		wantRcode: dns.RcodeRefused,
+		wantNil:   false,
+	}, {
+		name:      "dnscrypt",
+		proto:     proxy.ProtoDNSCrypt,
+		wantRcode: dns.RcodeRefused,
+		wantNil:   false,
+	}, {
+		name:      "tcp",
+		proto:     proxy.ProtoTCP,
+		wantRcode: 0,
+		wantNil:   true,
+	}, {
+		name:      "tls",
+		proto:     proxy.ProtoTLS,
+		wantRcode: 0,
+		wantNil:   true,
+	}, {
+		name:      "quic",
+		proto:     proxy.ProtoQUIC,
+		wantRcode: 0,
+		wantNil:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := s.drainResponse(&proxy.DNSContext{
+				Proto: tc.proto,
+				Req:   req,
+			})
+			if tc.wantNil {
+				assert.Nil(t, resp)
+
+				return
+			}
+
+			require.NotNil(t, resp)
+
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+		})
+	}
+}
+
+func TestServer_ServeHTTP_drain(t *testing.T) {
+	s := &Server{
+		drainer: newDrainer(),
+	}
+
+	err := s.Drain(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/dns-query", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+	assert.Equal(t, "close", rw.Header().Get("Connection"))
+	assert.Equal(t, "1", rw.Header().Get(httphdr.RetryAfter))
+}
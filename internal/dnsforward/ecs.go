@@ -0,0 +1,402 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultECSPrefixLenV4 is the default length of the IPv4 subnet sent to
+	// the upstreams.  It's the same as the one used by dnsproxy.
+	defaultECSPrefixLenV4 = 24
+
+	// defaultECSPrefixLenV6 is the default length of the IPv6 subnet sent to
+	// the upstreams.  It's the same as the one used by dnsproxy.
+	defaultECSPrefixLenV6 = 56
+)
+
+// EDNS Client Subnet address families.  See RFC 7871 Section 6.
+const (
+	ecsFamilyIPv4 uint16 = 1
+	ecsFamilyIPv6 uint16 = 2
+)
+
+// ecsPolicy is a validated EDNS Client Subnet policy of [EDNSClientSubnet].
+type ecsPolicy struct {
+	// patterns are the domain patterns of the requests, for which the subnet
+	// is sent.  If empty, all requests match.
+	patterns *domainPatterns
+
+	// customIP is the address used instead of the one of the client, if
+	// valid.
+	customIP netip.Addr
+
+	// upstreams are the validated policies of specific upstreams.
+	upstreams []*ecsUpstreamPolicy
+
+	// prefixLenV4 is the length of the IPv4 subnet sent to the upstreams.
+	prefixLenV4 uint8
+
+	// prefixLenV6 is the length of the IPv6 subnet sent to the upstreams.
+	prefixLenV6 uint8
+
+	// setSubnet is true if the subnet isn't the default one, so that it must
+	// be set by AdGuard Home instead of dnsproxy.
+	setSubnet bool
+}
+
+// ecsUpstreamPolicy is a validated [ECSUpstreamPolicy].
+type ecsUpstreamPolicy struct {
+	// addr is the normalized address of the upstream as returned by
+	// [upstream.Upstream.Address].
+	addr string
+
+	// disabled is true if the subnet is never sent to the upstream.
+	disabled bool
+
+	// prefixLenV4 is the maximum length of the IPv4 subnet sent to the
+	// upstream.  Zero means no limit.
+	prefixLenV4 uint8
+
+	// prefixLenV6 is the maximum length of the IPv6 subnet sent to the
+	// upstream.  Zero means no limit.
+	prefixLenV6 uint8
+}
+
+// newECSPolicy validates conf and returns the prepared policy.  p is nil if
+// conf is nil or EDNS Client Subnet is disabled.
+func newECSPolicy(conf *EDNSClientSubnet) (p *ecsPolicy, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = errors.Join(
+		validatePrefixLen("prefix_len_v4", conf.PrefixLenV4, netutil.IPv4BitLen),
+		validatePrefixLen("prefix_len_v6", conf.PrefixLenV6, netutil.IPv6BitLen),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p = &ecsPolicy{
+		prefixLenV4: defaultECSPrefixLenV4,
+		prefixLenV6: defaultECSPrefixLenV6,
+		setSubnet:   conf.PrefixLenV4 != 0 || conf.PrefixLenV6 != 0,
+	}
+
+	if conf.PrefixLenV4 != 0 {
+		p.prefixLenV4 = conf.PrefixLenV4
+	}
+
+	if conf.PrefixLenV6 != 0 {
+		p.prefixLenV6 = conf.PrefixLenV6
+	}
+
+	if conf.UseCustom {
+		p.customIP = conf.CustomIP.Unmap()
+	}
+
+	p.patterns, err = newDomainPatterns(conf.Domains)
+	if err != nil {
+		return nil, fmt.Errorf("domains: %w", err)
+	}
+
+	for i, u := range conf.Upstreams {
+		var up *ecsUpstreamPolicy
+		up, err = newECSUpstreamPolicy(u)
+		if err != nil {
+			return nil, fmt.Errorf("upstreams: at index %d: %w", i, err)
+		}
+
+		p.upstreams = append(p.upstreams, up)
+	}
+
+	return p, nil
+}
+
+// validatePrefixLen returns an error if the prefix length l of the property
+// with name is longer than maxLen.
+func validatePrefixLen(name string, l uint8, maxLen int) (err error) {
+	if int(l) > maxLen {
+		return fmt.Errorf("%s: %w: %d, max %d", name, errors.ErrOutOfRange, l, maxLen)
+	}
+
+	return nil
+}
+
+// newECSUpstreamPolicy validates u and returns the prepared policy.
+func newECSUpstreamPolicy(u *ECSUpstreamPolicy) (up *ecsUpstreamPolicy, err error) {
+	if u == nil {
+		return nil, errors.ErrNoValue
+	} else if u.Upstream == "" {
+		return nil, fmt.Errorf("upstream: %w", errors.ErrEmptyValue)
+	}
+
+	err = errors.Join(
+		validatePrefixLen("prefix_len_v4", u.PrefixLenV4, netutil.IPv4BitLen),
+		validatePrefixLen("prefix_len_v6", u.PrefixLenV6, netutil.IPv6BitLen),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := upstreamAddress(u.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream: %w", err)
+	}
+
+	return &ecsUpstreamPolicy{
+		addr:        addr,
+		disabled:    u.Disabled,
+		prefixLenV4: u.PrefixLenV4,
+		prefixLenV6: u.PrefixLenV6,
+	}, nil
+}
+
+// applyECSPolicy validates conf and wraps the upstreams of uc with the ones
+// applying the policy, if it requires that.
+func applyECSPolicy(uc *proxy.UpstreamConfig, conf *EDNSClientSubnet) (p *ecsPolicy, err error) {
+	p, err = newECSPolicy(conf)
+	if err != nil {
+		return nil, fmt.Errorf("edns client subnet: %w", err)
+	} else if p == nil || (p.patterns.isEmpty() && len(p.upstreams) == 0) {
+		return p, nil
+	}
+
+	p.wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		p.wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		p.wrap(ups)
+	}
+
+	return p, nil
+}
+
+// wrap replaces the upstreams in ups with the ones applying p in place.  The
+// upstreams already wrapped are left as is.
+func (p *ecsPolicy) wrap(ups []upstream.Upstream) {
+	for i, u := range ups {
+		if _, ok := u.(*ecsUpstream); ok {
+			continue
+		}
+
+		eu := &ecsUpstream{
+			Upstream: u,
+			patterns: p.patterns,
+		}
+
+		addr := u.Address()
+		j := slices.IndexFunc(p.upstreams, func(up *ecsUpstreamPolicy) (ok bool) {
+			return up.addr == addr
+		})
+		if j >= 0 {
+			up := p.upstreams[j]
+			eu.disabled = up.disabled
+			eu.prefixLenV4 = up.prefixLenV4
+			eu.prefixLenV6 = up.prefixLenV6
+		}
+
+		ups[i] = eu
+	}
+}
+
+// setReqECS adds the EDNS Client Subnet option with the subnet of the client
+// to the request, if the policy sets the non-default prefix lengths.  dnsproxy
+// then passes the option through instead of adding its own one with the
+// default lengths.  The requests already containing the option are left as
+// is.
+func (s *Server) setReqECS(pctx *proxy.DNSContext) {
+	p := s.ecsPolicy
+	if p == nil || !p.setSubnet || ecsOption(pctx.Req) != nil {
+		return
+	}
+
+	addr := p.customIP
+	if !addr.IsValid() {
+		addr = pctx.Addr.Addr().Unmap()
+	}
+
+	if netutil.IsSpecialPurpose(addr) {
+		return
+	}
+
+	e := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        ecsFamilyIPv4,
+		SourceNetmask: p.prefixLenV4,
+	}
+
+	if addr.Is6() {
+		e.Family = ecsFamilyIPv6
+		e.SourceNetmask = p.prefixLenV6
+	}
+
+	subnet := netip.PrefixFrom(addr, int(e.SourceNetmask)).Masked()
+	e.Address = subnet.Addr().AsSlice()
+
+	req := pctx.Req
+	if opt := req.IsEdns0(); opt != nil {
+		opt.Option = append(opt.Option, e)
+
+		return
+	}
+
+	opt := &dns.OPT{
+		Hdr: dns.RR_Header{
+			Name:   ".",
+			Rrtype: dns.TypeOPT,
+		},
+		Option: []dns.EDNS0{e},
+	}
+	opt.SetUDPSize(dns.DefaultMsgSize)
+	req.Extra = append(req.Extra, opt)
+}
+
+// ecsUpstream is an [upstream.Upstream] that removes or shortens the EDNS
+// Client Subnet option of the requests according to the policy.
+type ecsUpstream struct {
+	upstream.Upstream
+
+	// patterns are the domain patterns of the requests, for which the subnet
+	// is sent.  If empty, all requests match.
+	patterns *domainPatterns
+
+	// disabled is true if the subnet is never sent to the upstream.
+	disabled bool
+
+	// prefixLenV4 is the maximum length of the IPv4 subnet sent to the
+	// upstream.  Zero means no limit.
+	prefixLenV4 uint8
+
+	// prefixLenV6 is the maximum length of the IPv6 subnet sent to the
+	// upstream.  Zero means no limit.
+	prefixLenV6 uint8
+}
+
+// type check
+var _ upstream.Upstream = (*ecsUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *ecsUpstream.
+// req itself is never modified, since it may be sent to several upstreams at
+// once.
+func (u *ecsUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	ecs := ecsOption(req)
+	if ecs == nil || len(req.Question) == 0 {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return u.Upstream.Exchange(req)
+	}
+
+	remove := u.disabled || !u.patterns.matches(strings.ToLower(req.Question[0].Name))
+	prefixLen := u.prefixLen(ecs.Family)
+	if !remove && (prefixLen == 0 || prefixLen >= ecs.SourceNetmask) {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return u.Upstream.Exchange(req)
+	}
+
+	sent := req.Copy()
+	if remove {
+		removeECS(sent)
+	} else {
+		shortenECS(ecsOption(sent), prefixLen)
+	}
+
+	resp, err = u.Upstream.Exchange(sent)
+	if resp != nil {
+		restoreRespECS(resp, ecs, remove)
+	}
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return resp, err
+}
+
+// prefixLen returns the maximum length of the subnet of family sent to u.
+// Zero means no limit.
+func (u *ecsUpstream) prefixLen(family uint16) (l uint8) {
+	switch family {
+	case ecsFamilyIPv4:
+		return u.prefixLenV4
+	case ecsFamilyIPv6:
+		return u.prefixLenV6
+	default:
+		return 0
+	}
+}
+
+// ecsOption returns the first EDNS Client Subnet option of msg or nil if there
+// is none.
+func ecsOption(msg *dns.Msg) (e *dns.EDNS0_SUBNET) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		if sn, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return sn
+		}
+	}
+
+	return nil
+}
+
+// removeECS removes all EDNS Client Subnet options from msg.
+func removeECS(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	opt.Option = slices.DeleteFunc(opt.Option, func(o dns.EDNS0) (ok bool) {
+		return o.Option() == dns.EDNS0SUBNET
+	})
+}
+
+// shortenECS sets the source prefix length of e to prefixLen and masks the
+// address accordingly.  prefixLen must not be longer than the current one.
+func shortenECS(e *dns.EDNS0_SUBNET, prefixLen uint8) {
+	bits := netutil.IPv6BitLen
+	addr := e.Address
+	if e.Family == ecsFamilyIPv4 {
+		bits = netutil.IPv4BitLen
+		addr = addr.To4()
+	}
+
+	e.SourceNetmask = prefixLen
+	e.Address = addr.Mask(net.CIDRMask(int(prefixLen), bits))
+}
+
+// restoreRespECS makes the EDNS Client Subnet option of resp correspond to
+// the original option of the request, reqECS, so that the response is cached
+// and returned as if the request was sent as is.  removed is true if the
+// option has been removed from the request sent.
+func restoreRespECS(resp *dns.Msg, reqECS *dns.EDNS0_SUBNET, removed bool) {
+	if removed {
+		removeECS(resp)
+
+		return
+	}
+
+	e := ecsOption(resp)
+	if e == nil {
+		return
+	}
+
+	// The scope can't be longer than the source prefix length of the request
+	// actually sent.
+	e.SourceScope = min(e.SourceScope, e.SourceNetmask)
+	e.Family = reqECS.Family
+	e.SourceNetmask = reqECS.SourceNetmask
+	e.Address = slices.Clone(reqECS.Address)
+}
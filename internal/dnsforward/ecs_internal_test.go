@@ -0,0 +1,319 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestECSReq returns a new request for name with the EDNS Client Subnet
+// option for subnet, if it's valid.
+func newTestECSReq(name string, subnet netip.Prefix) (req *dns.Msg) {
+	req = (&dns.Msg{}).SetQuestion(name, dns.TypeA)
+	if !subnet.IsValid() {
+		return req
+	}
+
+	family := ecsFamilyIPv4
+	if subnet.Addr().Is6() {
+		family = ecsFamilyIPv6
+	}
+
+	req.SetEdns0(dns.DefaultMsgSize, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(subnet.Bits()),
+		Address:       subnet.Addr().AsSlice(),
+	})
+
+	return req
+}
+
+func TestNewECSPolicy(t *testing.T) {
+	testCases := []struct {
+		conf       *EDNSClientSubnet
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &EDNSClientSubnet{
+			Domains: []string{"cdn.example", "*.akamaized.example"},
+			Upstreams: []*ECSUpstreamPolicy{{
+				Upstream: "1.1.1.1",
+				Disabled: true,
+			}, {
+				Upstream:    "tls://dns.example",
+				PrefixLenV4: 16,
+			}},
+			Enabled:     true,
+			PrefixLenV4: 32,
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		conf: &EDNSClientSubnet{
+			PrefixLenV4: 33,
+		},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &EDNSClientSubnet{
+			Enabled:     true,
+			PrefixLenV4: 33,
+			PrefixLenV6: 129,
+		},
+		name: "bad_prefix_len",
+		wantErrMsg: "prefix_len_v4: out of range: 33, max 32\n" +
+			"prefix_len_v6: out of range: 129, max 128",
+	}, {
+		conf: &EDNSClientSubnet{
+			Domains: []string{"/cdn"},
+			Enabled: true,
+		},
+		name:       "bad_domain",
+		wantErrMsg: `domains: at index 0: bad regular expression "/cdn"`,
+	}, {
+		conf: &EDNSClientSubnet{
+			Upstreams: []*ECSUpstreamPolicy{{
+				Disabled: true,
+			}},
+			Enabled: true,
+		},
+		name:       "no_upstream",
+		wantErrMsg: "upstreams: at index 0: upstream: empty value",
+	}, {
+		conf: &EDNSClientSubnet{
+			Upstreams: []*ECSUpstreamPolicy{nil},
+			Enabled:   true,
+		},
+		name:       "nil_upstream",
+		wantErrMsg: "upstreams: at index 0: no value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newECSPolicy(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestECSUpstream_Exchange(t *testing.T) {
+	var (
+		clientSubnet = netip.MustParsePrefix("192.0.2.0/24")
+		shortSubnet  = netip.MustParsePrefix("192.0.0.0/16")
+	)
+
+	var sent *dns.Msg
+	ups := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		sent = req
+		resp = (&dns.Msg{}).SetReply(req)
+		resp.SetEdns0(dns.DefaultMsgSize, false)
+
+		if e := ecsOption(req); e != nil {
+			respECS := *e
+			respECS.SourceScope = 24
+			resp.IsEdns0().Option = append(resp.IsEdns0().Option, &respECS)
+		}
+
+		return resp, nil
+	})
+
+	patterns, err := newDomainPatterns([]string{"cdn.example"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		ups        *ecsUpstream
+		wantSent   *dns.EDNS0_SUBNET
+		wantResp   *dns.EDNS0_SUBNET
+		name       string
+		host       string
+		subnet     netip.Prefix
+		wantSameIn bool
+	}{{
+		ups:        &ecsUpstream{Upstream: ups, patterns: patterns},
+		wantSent:   nil,
+		wantResp:   nil,
+		name:       "no_ecs",
+		host:       "cdn.example.",
+		subnet:     netip.Prefix{},
+		wantSameIn: true,
+	}, {
+		ups: &ecsUpstream{Upstream: ups, patterns: patterns},
+		wantSent: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			Address:       clientSubnet.Addr().AsSlice(),
+		},
+		wantResp: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			SourceScope:   24,
+			Address:       clientSubnet.Addr().AsSlice(),
+		},
+		name:       "allowed_domain",
+		host:       "static.cdn.example.",
+		subnet:     clientSubnet,
+		wantSameIn: true,
+	}, {
+		ups:        &ecsUpstream{Upstream: ups, patterns: patterns},
+		wantSent:   nil,
+		wantResp:   nil,
+		name:       "other_domain",
+		host:       "www.example.",
+		subnet:     clientSubnet,
+		wantSameIn: false,
+	}, {
+		ups:        &ecsUpstream{Upstream: ups, patterns: &domainPatterns{}, disabled: true},
+		wantSent:   nil,
+		wantResp:   nil,
+		name:       "disabled",
+		host:       "cdn.example.",
+		subnet:     clientSubnet,
+		wantSameIn: false,
+	}, {
+		ups: &ecsUpstream{Upstream: ups, patterns: &domainPatterns{}, prefixLenV4: 16},
+		wantSent: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 16,
+			Address:       shortSubnet.Addr().AsSlice(),
+		},
+		wantResp: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			SourceScope:   16,
+			Address:       clientSubnet.Addr().AsSlice(),
+		},
+		name:       "shortened",
+		host:       "www.example.",
+		subnet:     clientSubnet,
+		wantSameIn: false,
+	}, {
+		ups: &ecsUpstream{Upstream: ups, patterns: &domainPatterns{}, prefixLenV6: 48},
+		wantSent: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			Address:       clientSubnet.Addr().AsSlice(),
+		},
+		wantResp: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			SourceScope:   24,
+			Address:       clientSubnet.Addr().AsSlice(),
+		},
+		name:       "other_family",
+		host:       "www.example.",
+		subnet:     clientSubnet,
+		wantSameIn: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newTestECSReq(tc.host, tc.subnet)
+			resp, exErr := tc.ups.Exchange(req)
+			require.NoError(t, exErr)
+			require.NotNil(t, resp)
+
+			if tc.wantSameIn {
+				assert.Same(t, req, sent)
+			} else {
+				assert.NotSame(t, req, sent)
+				assert.Equal(t, tc.subnet.Addr().AsSlice(), []byte(ecsOption(req).Address))
+			}
+
+			assertECS(t, tc.wantSent, ecsOption(sent))
+			assertECS(t, tc.wantResp, ecsOption(resp))
+		})
+	}
+}
+
+// assertECS is a helper that checks the EDNS Client Subnet option got against
+// want, which may be nil.
+func assertECS(t *testing.T, want, got *dns.EDNS0_SUBNET) {
+	t.Helper()
+
+	if want == nil {
+		assert.Nil(t, got)
+
+		return
+	}
+
+	require.NotNil(t, got)
+
+	assert.Equal(t, want.Family, got.Family)
+	assert.Equal(t, want.SourceNetmask, got.SourceNetmask)
+	assert.Equal(t, want.SourceScope, got.SourceScope)
+	assert.True(t, want.Address.Equal(got.Address), "want %s, got %s", want.Address, got.Address)
+}
+
+func TestServer_SetReqECS(t *testing.T) {
+	p, err := newECSPolicy(&EDNSClientSubnet{
+		Enabled:     true,
+		PrefixLenV4: 20,
+	})
+	require.NoError(t, err)
+
+	s := &Server{
+		ecsPolicy: p,
+	}
+
+	testCases := []struct {
+		want   *dns.EDNS0_SUBNET
+		name   string
+		addr   netip.Addr
+		subnet netip.Prefix
+	}{{
+		want: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 20,
+			Address:       net.IP{8, 8, 0, 0},
+		},
+		name:   "ipv4",
+		addr:   netip.MustParseAddr("8.8.8.8"),
+		subnet: netip.Prefix{},
+	}, {
+		want: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv6,
+			SourceNetmask: defaultECSPrefixLenV6,
+			Address:       net.ParseIP("2606:4700:4700::"),
+		},
+		name:   "ipv6_default",
+		addr:   netip.MustParseAddr("2606:4700:4700::1111"),
+		subnet: netip.Prefix{},
+	}, {
+		want:   nil,
+		name:   "special_purpose",
+		addr:   netip.MustParseAddr("192.168.0.1"),
+		subnet: netip.Prefix{},
+	}, {
+		want: &dns.EDNS0_SUBNET{
+			Family:        ecsFamilyIPv4,
+			SourceNetmask: 24,
+			Address:       net.IP{198, 51, 100, 0},
+		},
+		name:   "client_ecs",
+		addr:   netip.MustParseAddr("8.8.8.8"),
+		subnet: netip.MustParsePrefix("198.51.100.0/24"),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Req:  newTestECSReq("www.example.", tc.subnet),
+				Addr: netip.AddrPortFrom(tc.addr, 53),
+			}
+
+			s.setReqECS(pctx)
+
+			assertECS(t, tc.want, ecsOption(pctx.Req))
+		})
+	}
+}
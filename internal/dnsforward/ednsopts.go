@@ -0,0 +1,151 @@
+package dnsforward
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+)
+
+// tcpIdleTimeout is the timeout of the idle TCP connections used by module
+// dnsproxy.  It's advertised in the edns-tcp-keepalive option.
+//
+// TODO:  Make configurable once module dnsproxy allows it.
+const tcpIdleTimeout = 10 * time.Second
+
+// setEDNSOptions sets the EDNS(0) options configured for s to the response of
+// dctx, if the request contains an OPT record.
+func (s *Server) setEDNSOptions(dctx *dnsContext) {
+	pctx := dctx.proxyCtx
+	resp := pctx.Res
+	if resp == nil {
+		return
+	}
+
+	reqOPT := pctx.Req.IsEdns0()
+	if reqOPT == nil {
+		return
+	}
+
+	var opts []dns.EDNS0
+	if s.conf.NSID != "" && hasEDNSOption(reqOPT, dns.EDNS0NSID) {
+		opts = append(opts, &dns.EDNS0_NSID{
+			Code: dns.EDNS0NSID,
+			Nsid: hex.EncodeToString([]byte(s.conf.NSID)),
+		})
+	}
+
+	if s.conf.TCPKeepalive && isStreamProto(pctx.Proto) && hasEDNSOption(reqOPT, dns.EDNS0TCPKEEPALIVE) {
+		opts = append(opts, &dns.EDNS0_TCP_KEEPALIVE{
+			Code:    dns.EDNS0TCPKEEPALIVE,
+			Timeout: uint16(tcpIdleTimeout / (100 * time.Millisecond)),
+		})
+	}
+
+	if s.conf.ExtendedDNSErrors {
+		if ede := s.filteringEDE(dctx.result); ede != nil {
+			opts = append(opts, ede)
+		}
+	}
+
+	if len(opts) == 0 && s.conf.EDNSBufferSize == 0 {
+		return
+	}
+
+	respOPT := resp.IsEdns0()
+	if respOPT == nil {
+		size := s.conf.EDNSBufferSize
+		if size == 0 {
+			size = reqOPT.UDPSize()
+		}
+
+		resp.SetEdns0(size, reqOPT.Do())
+		respOPT = resp.IsEdns0()
+	} else if s.conf.EDNSBufferSize != 0 {
+		respOPT.SetUDPSize(s.conf.EDNSBufferSize)
+	}
+
+	for _, o := range opts {
+		respOPT.Option = setEDNSOption(respOPT.Option, o)
+	}
+}
+
+// filteringEDE returns the Extended DNS Error option explaining the filtering
+// decision res, if it's an error one.  Otherwise, it returns nil.
+func (s *Server) filteringEDE(res *filtering.Result) (ede *dns.EDNS0_EDE) {
+	if res == nil || !res.IsFiltered {
+		return nil
+	}
+
+	var code uint16
+	switch res.Reason {
+	case
+		filtering.FilteredBlockList,
+		filtering.FilteredBlockedService,
+		filtering.FilteredSafeBrowsing:
+		code = dns.ExtendedErrorCodeBlocked
+	case filtering.FilteredParental:
+		code = dns.ExtendedErrorCodeFiltered
+	case filtering.FilteredPaused:
+		code = dns.ExtendedErrorCodeProhibited
+	default:
+		// Safe search and the other rewrites aren't errors.
+		return nil
+	}
+
+	return &dns.EDNS0_EDE{
+		InfoCode:  code,
+		ExtraText: s.filteringEDEText(res),
+	}
+}
+
+// filteringEDEText returns the extra text of the Extended DNS Error option for
+// the filtering result res, which is the name of the blocked service or the
+// name of the filter list containing the matched rule.  If there is none, it
+// returns the reason.
+func (s *Server) filteringEDEText(res *filtering.Result) (text string) {
+	if res.ServiceName != "" {
+		return res.ServiceName
+	}
+
+	if len(res.Rules) > 0 && s.dnsFilter != nil {
+		name, ok := s.dnsFilter.FilterListName(res.Rules[0].FilterListID)
+		if ok && name != "" {
+			return name
+		}
+	}
+
+	return res.Reason.String()
+}
+
+// isStreamProto returns true if proto is a DNS protocol based on TCP without
+// its own session management, to which the edns-tcp-keepalive option applies.
+func isStreamProto(proto proxy.Proto) (ok bool) {
+	return proto == proxy.ProtoTCP || proto == proxy.ProtoTLS
+}
+
+// hasEDNSOption returns true if opt contains an option with code.
+func hasEDNSOption(opt *dns.OPT, code uint16) (ok bool) {
+	for _, o := range opt.Option {
+		if o.Option() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setEDNSOption replaces the options with the same code as o in opts with o or
+// appends it, if there are none.
+func setEDNSOption(opts []dns.EDNS0, o dns.EDNS0) (res []dns.EDNS0) {
+	res = opts[:0]
+	for _, existing := range opts {
+		if existing.Option() != o.Option() {
+			res = append(res, existing)
+		}
+	}
+
+	return append(res, o)
+}
@@ -0,0 +1,133 @@
+package dnsforward
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SetEDNSOptions(t *testing.T) {
+	const (
+		nsid       = "agh-1"
+		bufferSize = 1232
+		listName   = "Test list"
+		listID     = 1
+	)
+
+	flt, err := filtering.New(&filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+		Filters: []filtering.FilterYAML{{
+			Name:   listName,
+			Filter: filtering.Filter{ID: listID},
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	s := &Server{
+		dnsFilter: flt,
+		conf: ServerConfig{
+			Config: Config{
+				EDNSBufferSize:    bufferSize,
+				NSID:              nsid,
+				TCPKeepalive:      true,
+				ExtendedDNSErrors: true,
+			},
+		},
+	}
+
+	newDctx := func(proto proxy.Proto, res *filtering.Result, reqOpts ...dns.EDNS0) (dctx *dnsContext) {
+		req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+		if reqOpts != nil {
+			req.SetEdns0(4096, false)
+			opt := req.IsEdns0()
+			opt.Option = append(opt.Option, reqOpts...)
+		}
+
+		return &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Proto: proto,
+				Req:   req,
+				Res:   (&dns.Msg{}).SetReply(req),
+			},
+			result: res,
+		}
+	}
+
+	t.Run("no_opt", func(t *testing.T) {
+		dctx := newDctx(proxy.ProtoUDP, &filtering.Result{})
+		s.setEDNSOptions(dctx)
+
+		assert.Nil(t, dctx.proxyCtx.Res.IsEdns0())
+	})
+
+	t.Run("all", func(t *testing.T) {
+		dctx := newDctx(
+			proxy.ProtoTCP,
+			&filtering.Result{
+				Rules: []*filtering.ResultRule{{
+					FilterListID: listID,
+				}},
+				IsFiltered: true,
+				Reason:     filtering.FilteredBlockList,
+			},
+			&dns.EDNS0_NSID{Code: dns.EDNS0NSID},
+			&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE},
+		)
+		s.setEDNSOptions(dctx)
+
+		opt := dctx.proxyCtx.Res.IsEdns0()
+		require.NotNil(t, opt)
+
+		assert.Equal(t, uint16(bufferSize), opt.UDPSize())
+		assert.Equal(t, []dns.EDNS0{
+			&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte(nsid))},
+			&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Timeout: 100},
+			&dns.EDNS0_EDE{
+				InfoCode:  dns.ExtendedErrorCodeBlocked,
+				ExtraText: listName,
+			},
+		}, opt.Option)
+	})
+
+	t.Run("blocked_service", func(t *testing.T) {
+		dctx := newDctx(
+			proxy.ProtoUDP,
+			&filtering.Result{
+				ServiceName: "Example Service",
+				IsFiltered:  true,
+				Reason:      filtering.FilteredBlockedService,
+			},
+			&dns.EDNS0_NSID{Code: dns.EDNS0NSID},
+		)
+		s.setEDNSOptions(dctx)
+
+		opt := dctx.proxyCtx.Res.IsEdns0()
+		require.NotNil(t, opt)
+		require.Len(t, opt.Option, 2)
+
+		assert.Equal(t, &dns.EDNS0_EDE{
+			InfoCode:  dns.ExtendedErrorCodeBlocked,
+			ExtraText: "Example Service",
+		}, opt.Option[1])
+	})
+
+	t.Run("udp_not_filtered", func(t *testing.T) {
+		dctx := newDctx(
+			proxy.ProtoUDP,
+			&filtering.Result{},
+			&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE},
+		)
+		s.setEDNSOptions(dctx)
+
+		opt := dctx.proxyCtx.Res.IsEdns0()
+		require.NotNil(t, opt)
+
+		assert.Equal(t, uint16(bufferSize), opt.UDPSize())
+		assert.Empty(t, opt.Option)
+	})
+}
@@ -0,0 +1,266 @@
+package dnsforward
+
+import (
+	"crypto/tls"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Actions of the encrypted client rules.
+const (
+	encryptedClientActionAllow = "allow"
+	encryptedClientActionDeny  = "deny"
+)
+
+// fingerprintAny is the part of a TLS fingerprint pattern matching any value.
+const fingerprintAny = "*"
+
+// fingerprintParts is the number of parts in a TLS fingerprint.
+const fingerprintParts = 3
+
+// encryptedClientRule is a validated [EncryptedClientRule].
+type encryptedClientRule struct {
+	// alpns are the matching negotiated ALPN protocols.  If nil, all protocols
+	// match.
+	alpns *container.MapSet[string]
+
+	// userAgents are the lowercased substrings of the matching User-Agent
+	// headers.
+	userAgents []string
+
+	// userAgentRegexps are the regular expressions matching the User-Agent
+	// headers.
+	userAgentRegexps []*regexp.Regexp
+
+	// fingerprints are the patterns of the matching TLS fingerprints split
+	// into parts.
+	fingerprints [][fingerprintParts]string
+
+	// allow is true if the matching requests are allowed.
+	allow bool
+}
+
+// newEncryptedClientRules returns the rules prepared from confs.
+func newEncryptedClientRules(confs []*EncryptedClientRule) (rules []*encryptedClientRule, err error) {
+	for i, c := range confs {
+		var r *encryptedClientRule
+		r, err = newEncryptedClientRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("encrypted client rule at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newEncryptedClientRule validates c and returns the rule prepared from it.
+func newEncryptedClientRule(c *EncryptedClientRule) (r *encryptedClientRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	r = &encryptedClientRule{}
+	switch c.Action {
+	case encryptedClientActionAllow:
+		r.allow = true
+	case encryptedClientActionDeny:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, c.Action)
+	}
+
+	for i, ua := range c.UserAgents {
+		err = r.addUserAgent(ua)
+		if err != nil {
+			return nil, fmt.Errorf("user_agents: at index %d: %w", i, err)
+		}
+	}
+
+	if len(c.ALPNs) > 0 {
+		r.alpns = container.NewMapSet(c.ALPNs...)
+	}
+
+	for i, fp := range c.TLSFingerprints {
+		parts := strings.Split(fp, ":")
+		if len(parts) != fingerprintParts {
+			return nil, fmt.Errorf("tls_fingerprints: at index %d: bad fingerprint %q", i, fp)
+		}
+
+		r.fingerprints = append(r.fingerprints, [fingerprintParts]string(parts))
+	}
+
+	return r, nil
+}
+
+// addUserAgent parses the User-Agent pattern p and adds it to r.
+func (r *encryptedClientRule) addUserAgent(p string) (err error) {
+	if p == "" {
+		return errors.ErrEmptyValue
+	}
+
+	reStr, ok := strings.CutPrefix(p, "/")
+	if !ok {
+		r.userAgents = append(r.userAgents, strings.ToLower(p))
+
+		return nil
+	}
+
+	reStr, ok = strings.CutSuffix(reStr, "/")
+	if !ok || reStr == "" {
+		return fmt.Errorf("bad regular expression %q", p)
+	}
+
+	re, err := regexp.Compile(reStr)
+	if err != nil {
+		return fmt.Errorf("compiling regular expression: %w", err)
+	}
+
+	r.userAgentRegexps = append(r.userAgentRegexps, re)
+
+	return nil
+}
+
+// encryptedClientMeta is the metadata of a client using an encrypted protocol.
+type encryptedClientMeta struct {
+	// tls is the state of the TLS connection of the client.  It's nil if it's
+	// unknown, e.g. for the DNS-over-HTTPS requests over plain HTTP from a
+	// reverse proxy.
+	tls *tls.ConnectionState
+
+	// userAgent is the User-Agent header of the DNS-over-HTTPS request.
+	userAgent string
+
+	// isDoH is true if the request is a DNS-over-HTTPS one.
+	isDoH bool
+}
+
+// newEncryptedClientMeta returns the metadata of the client sending the
+// request in pctx.  ok is false if the request wasn't sent over an encrypted
+// protocol.
+func newEncryptedClientMeta(pctx *proxy.DNSContext) (m *encryptedClientMeta, ok bool) {
+	m = &encryptedClientMeta{}
+	switch pctx.Proto {
+	case proxy.ProtoHTTPS:
+		m.isDoH = true
+		if r := pctx.HTTPRequest; r != nil {
+			m.userAgent = r.UserAgent()
+			m.tls = r.TLS
+		}
+	case proxy.ProtoTLS:
+		if tc, isTLS := pctx.Conn.(tlsConn); isTLS {
+			cs := tc.ConnectionState()
+			m.tls = &cs
+		}
+	case proxy.ProtoQUIC:
+		if qc, isQUIC := pctx.QUICConnection.(quicConnection); isQUIC {
+			cs := qc.ConnectionState().TLS
+			m.tls = &cs
+		}
+	default:
+		return nil, false
+	}
+
+	return m, true
+}
+
+// tlsFingerprint returns the coarse fingerprint of the negotiated TLS
+// parameters of cs split into parts, e.g. "tls1.3",
+// "TLS_AES_128_GCM_SHA256", and "h2".
+func tlsFingerprint(cs *tls.ConnectionState) (fp [fingerprintParts]string) {
+	version := strings.ToLower(strings.ReplaceAll(tls.VersionName(cs.Version), " ", ""))
+
+	return [fingerprintParts]string{
+		version,
+		tls.CipherSuiteName(cs.CipherSuite),
+		cs.NegotiatedProtocol,
+	}
+}
+
+// matches returns true if m matches all non-empty conditions of r.
+func (r *encryptedClientRule) matches(m *encryptedClientMeta) (ok bool) {
+	if (len(r.userAgents) > 0 || len(r.userAgentRegexps) > 0) && !r.matchesUserAgent(m) {
+		return false
+	}
+
+	if r.alpns == nil && len(r.fingerprints) == 0 {
+		return true
+	} else if m.tls == nil {
+		return false
+	}
+
+	if r.alpns != nil && !r.alpns.Has(m.tls.NegotiatedProtocol) {
+		return false
+	}
+
+	return len(r.fingerprints) == 0 || r.matchesFingerprint(tlsFingerprint(m.tls))
+}
+
+// matchesUserAgent returns true if the User-Agent header from m matches any of
+// the patterns of r.
+func (r *encryptedClientRule) matchesUserAgent(m *encryptedClientMeta) (ok bool) {
+	if !m.isDoH {
+		return false
+	}
+
+	ua := strings.ToLower(m.userAgent)
+	if slices.ContainsFunc(r.userAgents, func(sub string) (found bool) {
+		return strings.Contains(ua, sub)
+	}) {
+		return true
+	}
+
+	return slices.ContainsFunc(r.userAgentRegexps, func(re *regexp.Regexp) (found bool) {
+		return re.MatchString(m.userAgent)
+	})
+}
+
+// matchesFingerprint returns true if fp matches any of the fingerprint
+// patterns of r.
+func (r *encryptedClientRule) matchesFingerprint(fp [fingerprintParts]string) (ok bool) {
+	return slices.ContainsFunc(r.fingerprints, func(pat [fingerprintParts]string) (found bool) {
+		for i, p := range pat {
+			if p != fingerprintAny && !strings.EqualFold(p, fp[i]) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// isBlockedEncryptedClient returns true if the request in pctx is denied by the
+// first matching encrypted client rule.
+func (s *Server) isBlockedEncryptedClient(pctx *proxy.DNSContext) (blocked bool) {
+	if len(s.encryptedClientRules) == 0 {
+		return false
+	}
+
+	m, ok := newEncryptedClientMeta(pctx)
+	if !ok {
+		return false
+	}
+
+	for i, r := range s.encryptedClientRules {
+		if r.matches(m) {
+			log.Debug(
+				"dnsforward: client %s matches encrypted client rule at index %d, allow: %t",
+				pctx.Addr.Addr(),
+				i,
+				r.allow,
+			)
+
+			return !r.allow
+		}
+	}
+
+	return false
+}
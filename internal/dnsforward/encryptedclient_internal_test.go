@@ -0,0 +1,178 @@
+package dnsforward
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEncryptedClientRules(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*EncryptedClientRule
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*EncryptedClientRule{{
+			Action:          encryptedClientActionAllow,
+			UserAgents:      []string{"Firefox", `/^Mozilla\/5\.0/`},
+			ALPNs:           []string{"h2"},
+			TLSFingerprints: []string{"tls1.3:*:h2"},
+		}, {
+			Action: encryptedClientActionDeny,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "encrypted client rule at index 0: no value",
+		confs:      []*EncryptedClientRule{nil},
+	}, {
+		name:       "bad_action",
+		wantErrMsg: `encrypted client rule at index 0: action: bad enum value: "drop"`,
+		confs: []*EncryptedClientRule{{
+			Action: "drop",
+		}},
+	}, {
+		name:       "empty_user_agent",
+		wantErrMsg: "encrypted client rule at index 0: user_agents: at index 0: empty value",
+		confs: []*EncryptedClientRule{{
+			Action:     encryptedClientActionDeny,
+			UserAgents: []string{""},
+		}},
+	}, {
+		name: "bad_regexp",
+		wantErrMsg: "encrypted client rule at index 0: user_agents: at index 0: " +
+			`bad regular expression "/curl"`,
+		confs: []*EncryptedClientRule{{
+			Action:     encryptedClientActionDeny,
+			UserAgents: []string{"/curl"},
+		}},
+	}, {
+		name: "bad_fingerprint",
+		wantErrMsg: "encrypted client rule at index 1: tls_fingerprints: at index 0: " +
+			`bad fingerprint "tls1.3:h2"`,
+		confs: []*EncryptedClientRule{{
+			Action: encryptedClientActionAllow,
+		}, {
+			Action:          encryptedClientActionDeny,
+			TLSFingerprints: []string{"tls1.3:h2"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newEncryptedClientRules(tc.confs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestServer_IsBlockedEncryptedClient(t *testing.T) {
+	rules, err := newEncryptedClientRules([]*EncryptedClientRule{{
+		Action:     encryptedClientActionAllow,
+		UserAgents: []string{"Good-Bot"},
+	}, {
+		Action:     encryptedClientActionDeny,
+		UserAgents: []string{`/^[a-z-]+bot\//`, "python-requests"},
+	}, {
+		Action:          encryptedClientActionDeny,
+		TLSFingerprints: []string{"tls1.2:*:*"},
+	}, {
+		Action: encryptedClientActionDeny,
+		ALPNs:  []string{"http/1.1"},
+	}})
+	require.NoError(t, err)
+
+	s := &Server{
+		encryptedClientRules: rules,
+	}
+
+	newDoH := func(ua string, version uint16, alpn string) (pctx *proxy.DNSContext) {
+		r := &http.Request{
+			Header: http.Header{},
+			TLS: &tls.ConnectionState{
+				Version:            version,
+				CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+				NegotiatedProtocol: alpn,
+			},
+		}
+		r.Header.Set("User-Agent", ua)
+
+		return &proxy.DNSContext{
+			Proto:       proxy.ProtoHTTPS,
+			HTTPRequest: r,
+			Addr:        netip.MustParseAddrPort("192.0.2.1:443"),
+		}
+	}
+
+	testCases := []struct {
+		pctx        *proxy.DNSContext
+		name        string
+		wantBlocked bool
+	}{{
+		pctx:        newDoH("Mozilla/5.0", tls.VersionTLS13, "h2"),
+		name:        "browser",
+		wantBlocked: false,
+	}, {
+		pctx:        newDoH("evil-bot/1.0", tls.VersionTLS13, "h2"),
+		name:        "regexp",
+		wantBlocked: true,
+	}, {
+		pctx:        newDoH("Python-Requests/2.31", tls.VersionTLS13, "h2"),
+		name:        "substring",
+		wantBlocked: true,
+	}, {
+		pctx:        newDoH("good-bot/1.0", tls.VersionTLS12, "h2"),
+		name:        "allowed_first",
+		wantBlocked: false,
+	}, {
+		pctx:        newDoH("Mozilla/5.0", tls.VersionTLS12, "h2"),
+		name:        "fingerprint",
+		wantBlocked: true,
+	}, {
+		pctx:        newDoH("Mozilla/5.0", tls.VersionTLS13, "http/1.1"),
+		name:        "alpn",
+		wantBlocked: true,
+	}, {
+		pctx: &proxy.DNSContext{
+			Proto: proxy.ProtoTLS,
+			Conn:  testTLSConn{},
+			Addr:  netip.MustParseAddrPort("192.0.2.1:853"),
+		},
+		name:        "dot",
+		wantBlocked: false,
+	}, {
+		pctx: &proxy.DNSContext{
+			Proto: proxy.ProtoUDP,
+			Addr:  netip.MustParseAddrPort("192.0.2.1:53"),
+		},
+		name:        "plain",
+		wantBlocked: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantBlocked, s.isBlockedEncryptedClient(tc.pctx))
+		})
+	}
+}
+
+func TestTLSFingerprint(t *testing.T) {
+	fp := tlsFingerprint(&tls.ConnectionState{
+		Version:            tls.VersionTLS12,
+		CipherSuite:        tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+	})
+
+	assert.Equal(t, [fingerprintParts]string{
+		"tls1.2",
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		"h2",
+	}, fp)
+}
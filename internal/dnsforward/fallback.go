@@ -0,0 +1,66 @@
+package dnsforward
+
+import (
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// fallbackUpstream is an [upstream.Upstream] used as a fallback one.  It only
+// marks the upstream, so that the responses received from the fallback
+// upstreams could be told apart.
+type fallbackUpstream struct {
+	upstream.Upstream
+}
+
+// type check
+var _ upstream.Upstream = (*fallbackUpstream)(nil)
+
+// markFallbacks wraps all upstreams of uc into [fallbackUpstream].
+func markFallbacks(uc *proxy.UpstreamConfig) {
+	mark := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			ups[i] = &fallbackUpstream{Upstream: u}
+		}
+	}
+
+	mark(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		mark(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		mark(ups)
+	}
+}
+
+// isFallback returns true if u is a fallback upstream.
+func isFallback(u upstream.Upstream) (ok bool) {
+	_, ok = u.(*fallbackUpstream)
+
+	return ok
+}
+
+// logFallbackUse logs when the server starts or stops using the fallback
+// upstreams, since all the upstreams have failed or some of them became
+// available again.  pctx must be resolved.
+func (s *Server) logFallbackUse(pctx *proxy.DNSContext) {
+	if pctx.Upstream == nil {
+		return
+	}
+
+	fallback := isFallback(pctx.Upstream)
+	if s.fallbackInUse.Swap(fallback) == fallback {
+		return
+	}
+
+	if fallback {
+		log.Info(
+			"dnsforward: upstreams failed for %q, using fallback %s",
+			pctx.Req.Question[0].Name,
+			pctx.Upstream.Address(),
+		)
+	} else {
+		log.Info("dnsforward: upstreams are available again, not using fallbacks")
+	}
+}
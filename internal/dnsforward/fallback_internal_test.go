@@ -0,0 +1,39 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_LogFallbackUse(t *testing.T) {
+	newUps := func(addr string) (u upstream.Upstream) {
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (a string) { return addr },
+		}
+	}
+
+	primary := newUps("192.0.2.1:53")
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{newUps("192.0.2.2:53")},
+	}
+
+	markFallbacks(uc)
+	fallback := uc.Upstreams[0]
+	require.True(t, isFallback(fallback))
+	require.False(t, isFallback(primary))
+
+	s := &Server{}
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+
+	s.logFallbackUse(&proxy.DNSContext{Req: req, Upstream: fallback})
+	assert.True(t, s.fallbackInUse.Load())
+
+	s.logFallbackUse(&proxy.DNSContext{Req: req, Upstream: primary})
+	assert.False(t, s.fallbackInUse.Load())
+}
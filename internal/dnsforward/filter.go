@@ -8,6 +8,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 )
@@ -32,6 +33,34 @@ func (s *Server) filterDNSRequest(dctx *dnsContext) (res *filtering.Result, err
 	q := req.Question[0]
 	host := strings.TrimSuffix(q.Name, ".")
 
+	if dctx.setts.ClientPaused && !isPauseAllowed(host, dctx.setts.PauseAllowlist) {
+		log.Debug("dnsforward: host %q is refused, client %q is paused", host, dctx.setts.ClientName)
+
+		res = &filtering.Result{
+			IsFiltered: true,
+			Reason:     filtering.FilteredPaused,
+		}
+		pctx.Res = s.makeResponseREFUSED(req)
+
+		return res, nil
+	}
+
+	if dctx.setts.ClientBlockQUIC && isQUICBootstrapHost(host) {
+		log.Debug(
+			"dnsforward: host %q is nxdomain, quic is blocked for client %q",
+			host,
+			dctx.setts.ClientName,
+		)
+
+		res = &filtering.Result{
+			IsFiltered: true,
+			Reason:     filtering.FilteredQUIC,
+		}
+		pctx.Res = s.NewMsgNXDOMAIN(req)
+
+		return res, nil
+	}
+
 	resVal, err := s.dnsFilter.CheckHost(host, q.Qtype, dctx.setts)
 	if err != nil {
 		return nil, fmt.Errorf("checking host %q: %w", host, err)
@@ -59,6 +88,16 @@ func (s *Server) filterDNSRequest(dctx *dnsContext) (res *filtering.Result, err
 	return res, err
 }
 
+// isPauseAllowed returns true if host is one of the domain names in allowlist
+// or a subdomain of any of those.
+func isPauseAllowed(host string, allowlist []string) (ok bool) {
+	host = strings.ToLower(host)
+
+	return slices.ContainsFunc(allowlist, func(domain string) (found bool) {
+		return host == domain || netutil.IsSubdomain(host, domain)
+	})
+}
+
 // isRewrittenCNAME returns true if the request considered to be rewritten with
 // CNAME and has no resolved IPs.
 func isRewrittenCNAME(res *filtering.Result) (ok bool) {
@@ -92,14 +131,21 @@ func (s *Server) checkHostRules(
 // dctx.proxyCtx.Res.  It sets dctx.result and dctx.origResp if at least one of
 // canonical names, IP addresses, or HTTPS RR hints in it matches the filtering
 // rules, as well as sets dctx.proxyCtx.Res to the filtered response.
+// Otherwise, it applies the answer filters, see [Server.filterAnswerIPs].
 func (s *Server) filterDNSResponse(dctx *dnsContext) (err error) {
 	setts := dctx.setts
 	if !setts.FilteringEnabled {
 		return nil
 	}
 
-	var res *filtering.Result
 	pctx := dctx.proxyCtx
+	if qt := pctx.Req.Question[0].Qtype; s.dnsFilter.IsUnfilteredQueryType(qt) {
+		log.Debug("dnsforward: not filtering response to %s query", dns.Type(qt))
+
+		return nil
+	}
+
+	var res *filtering.Result
 	for i, a := range pctx.Res.Answer {
 		host := ""
 		var rrtype rules.RRType
@@ -136,10 +182,12 @@ func (s *Server) filterDNSResponse(dctx *dnsContext) (err error) {
 
 			log.Debug("dnsforward: matched %q by response: %q", pctx.Req.Question[0].Name, host)
 
-			break
+			return nil
 		}
 	}
 
+	s.filterAnswerIPs(dctx)
+
 	return nil
 }
 
@@ -379,3 +379,157 @@ func newSVCBHintsAnswer(target string, hints []dns.SVCBKeyValue) (rrs []dns.RR)
 		},
 	}}
 }
+
+func TestServer_filterDNSRequest_paused(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{
+		ProtectionEnabled: true,
+		BlockingMode:      filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+		},
+		ServePlainDNS: true,
+	})
+
+	testCases := []struct {
+		name        string
+		host        string
+		paused      bool
+		wantRefused bool
+	}{{
+		name:        "not_paused",
+		host:        "example.com.",
+		paused:      false,
+		wantRefused: false,
+	}, {
+		name:        "paused",
+		host:        "example.com.",
+		paused:      true,
+		wantRefused: true,
+	}, {
+		name:        "allowed",
+		host:        "allowed.example.",
+		paused:      true,
+		wantRefused: false,
+	}, {
+		name:        "allowed_subdomain",
+		host:        "Sub.Allowed.Example.",
+		paused:      true,
+		wantRefused: false,
+	}, {
+		name:        "allowed_suffix",
+		host:        "notallowed.example.",
+		paused:      true,
+		wantRefused: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: createTestMessage(tc.host),
+				},
+				setts: &filtering.Settings{
+					PauseAllowlist:    []string{"allowed.example"},
+					ClientPaused:      tc.paused,
+					ProtectionEnabled: true,
+					FilteringEnabled:  true,
+				},
+			}
+
+			res, err := s.filterDNSRequest(dctx)
+			require.NoError(t, err)
+			require.NotNil(t, res)
+
+			if !tc.wantRefused {
+				assert.NotEqual(t, filtering.FilteredPaused, res.Reason)
+				assert.Nil(t, dctx.proxyCtx.Res)
+
+				return
+			}
+
+			assert.True(t, res.IsFiltered)
+			assert.Equal(t, filtering.FilteredPaused, res.Reason)
+
+			require.NotNil(t, dctx.proxyCtx.Res)
+			assert.Equal(t, dns.RcodeRefused, dctx.proxyCtx.Res.Rcode)
+		})
+	}
+}
+
+func TestServer_filterDNSRequest_blockQUIC(t *testing.T) {
+	s := createTestServer(t, &filtering.Config{
+		ProtectionEnabled: true,
+		BlockingMode:      filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		Config: Config{
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+		},
+		ServePlainDNS: true,
+	})
+
+	testCases := []struct {
+		name         string
+		host         string
+		blockQUIC    bool
+		wantNXDomain bool
+	}{{
+		name:         "not_blocked",
+		host:         "mask.icloud.com.",
+		blockQUIC:    false,
+		wantNXDomain: false,
+	}, {
+		name:         "blocked",
+		host:         "Mask.iCloud.com.",
+		blockQUIC:    true,
+		wantNXDomain: true,
+	}, {
+		name:         "blocked_h2",
+		host:         "mask-h2.icloud.com.",
+		blockQUIC:    true,
+		wantNXDomain: true,
+	}, {
+		name:         "other_host",
+		host:         "www.icloud.com.",
+		blockQUIC:    true,
+		wantNXDomain: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: createTestMessage(tc.host),
+				},
+				setts: &filtering.Settings{
+					ClientBlockQUIC:   tc.blockQUIC,
+					ProtectionEnabled: true,
+					FilteringEnabled:  true,
+				},
+			}
+
+			res, err := s.filterDNSRequest(dctx)
+			require.NoError(t, err)
+			require.NotNil(t, res)
+
+			if !tc.wantNXDomain {
+				assert.NotEqual(t, filtering.FilteredQUIC, res.Reason)
+				assert.Nil(t, dctx.proxyCtx.Res)
+
+				return
+			}
+
+			assert.True(t, res.IsFiltered)
+			assert.Equal(t, filtering.FilteredQUIC, res.Reason)
+
+			require.NotNil(t, dctx.proxyCtx.Res)
+			assert.Equal(t, dns.RcodeNameError, dctx.proxyCtx.Res.Rcode)
+		})
+	}
+}
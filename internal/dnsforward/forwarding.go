@@ -0,0 +1,248 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// forwardingRule is a validated [ForwardingRule] or [QTypeUpstreamConfig].
+type forwardingRule struct {
+	// conf is the upstream configuration of the rule.  It's nil for
+	// [QTypeUpstreamActionRefuse] and for [QTypeUpstreamActionLocal] if the
+	// private reverse DNS upstreams are disabled.
+	conf *proxy.CustomUpstreamConfig
+
+	// qtypes are the types of the matching requests.  If nil, all types
+	// match.
+	qtypes *container.MapSet[uint16]
+
+	// patterns are the domain patterns of the matching requests.
+	patterns *domainPatterns
+
+	// name is the human-readable name of the rule.
+	name string
+
+	// action is the action of the rule.  It's always
+	// [QTypeUpstreamActionForward] for the rules made from [ForwardingRule].
+	action QTypeUpstreamAction
+
+	// subnets are the subnets of the matching clients.  If empty, all clients
+	// match.
+	subnets []netip.Prefix
+}
+
+// newForwardingRules returns the rules prepared from confs.  tor is the
+// configuration of the Tor SOCKS proxy, if any.
+func newForwardingRules(
+	confs []*ForwardingRule,
+	opts *upstream.Options,
+	tor *TorConfig,
+) (rules []*forwardingRule, err error) {
+	for i, c := range confs {
+		var r *forwardingRule
+		r, err = newForwardingRule(c, opts, tor)
+		if err != nil {
+			closeForwardingRules(rules)
+
+			return nil, fmt.Errorf("conditional forwarding at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newForwardingRule validates c and returns the rule prepared from it.
+func newForwardingRule(
+	c *ForwardingRule,
+	opts *upstream.Options,
+	tor *TorConfig,
+) (r *forwardingRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	r = &forwardingRule{
+		name:   c.Name,
+		action: QTypeUpstreamActionForward,
+	}
+
+	r.patterns, err = newDomainPatterns(c.Domains)
+	if err != nil {
+		return nil, fmt.Errorf("domains: %w", err)
+	}
+
+	for i, subnet := range c.ClientSubnets {
+		if !subnet.IsValid() {
+			return nil, fmt.Errorf("client_subnets: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+
+		r.subnets = append(r.subnets, subnet.Masked())
+	}
+
+	if len(c.QTypes) > 0 {
+		r.qtypes, err = parseQTypes(c.QTypes)
+		if err != nil {
+			return nil, fmt.Errorf("qtypes: %w", err)
+		}
+	}
+
+	addrs := stringutil.FilterOut(c.Upstreams, IsCommentOrEmpty)
+	if c.ViaTor {
+		r.conf, err = newTorRuleUpstreams(addrs, tor, opts, c.UpstreamMode)
+	} else {
+		r.conf, err = newRuleUpstreams(addrs, opts, c.UpstreamMode)
+	}
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// closeForwardingRules closes the upstreams of rules and logs the errors, if
+// any.  The private reverse DNS upstreams aren't closed, since they're owned by
+// the server.
+func closeForwardingRules(rules []*forwardingRule) {
+	for _, r := range rules {
+		if r.action == QTypeUpstreamActionForward {
+			logCloserErr(r.conf, "dnsforward: closing conditional forwarding upstreams: %s")
+		}
+	}
+}
+
+// matches returns true if the request of type qt for name from the client
+// with addr matches r.  name must be a lowercased fully-qualified domain name.
+func (r *forwardingRule) matches(qt uint16, name string, addr netip.Addr) (ok bool) {
+	if r.qtypes != nil && !r.qtypes.Has(qt) {
+		return false
+	}
+
+	if len(r.subnets) > 0 && !slices.ContainsFunc(r.subnets, func(p netip.Prefix) (c bool) {
+		return p.Contains(addr)
+	}) {
+		return false
+	}
+
+	return r.patterns.matches(name)
+}
+
+// forwardingRuleFor returns the first conditional forwarding rule matching q
+// from the client with addr or nil if there is none.  The rules made from
+// [Config.ConditionalForwarding] come before the ones made from
+// [Config.QTypeUpstreams], see [Server.prepareInternalDNS], so the former win
+// when both match.
+func (s *Server) forwardingRuleFor(q dns.Question, addr netip.Addr) (r *forwardingRule) {
+	name := strings.ToLower(q.Name)
+	for _, r = range s.forwardingRules {
+		if r.matches(q.Qtype, name, addr) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// setForwardingUpstream routes the request to the upstreams of the matching
+// conditional forwarding rule, if any.  It must be called after
+// [Server.setCustomUpstream], since the rules have higher priority than the
+// client-specific upstreams.  The requests matching the rules with
+// [QTypeUpstreamActionRefuse] are refused in [Server.processInitial].
+func (s *Server) setForwardingUpstream(pctx *proxy.DNSContext) {
+	if len(s.forwardingRules) == 0 {
+		return
+	}
+
+	r := s.forwardingRuleFor(pctx.Req.Question[0], pctx.Addr.Addr().Unmap())
+	if r == nil || r.conf == nil {
+		return
+	}
+
+	log.Debug("dnsforward: using upstreams of conditional forwarding rule %q", r.name)
+
+	pctx.CustomUpstreamConfig = r.conf
+}
+
+// forwardingRulesJSON is the response of the GET
+// /control/conditional_forwarding HTTP API and the body of the request to the
+// PUT /control/conditional_forwarding/update one.
+type forwardingRulesJSON struct {
+	Rules []*ForwardingRule `json:"rules"`
+}
+
+// handleGetForwardingRules is the handler for the GET
+// /control/conditional_forwarding HTTP API.
+func (s *Server) handleGetForwardingRules(w http.ResponseWriter, r *http.Request) {
+	resp := &forwardingRulesJSON{}
+
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		resp.Rules = slices.Clone(s.conf.ConditionalForwarding)
+	}()
+
+	if resp.Rules == nil {
+		resp.Rules = []*ForwardingRule{}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleSetForwardingRules is the handler for the PUT
+// /control/conditional_forwarding/update HTTP API.
+func (s *Server) handleSetForwardingRules(w http.ResponseWriter, r *http.Request) {
+	req := &forwardingRulesJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	var tor *TorConfig
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		tor = s.conf.Tor
+	}()
+
+	rules, err := newForwardingRules(req.Rules, &upstream.Options{}, tor)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	closeForwardingRules(rules)
+
+	func() {
+		s.serverLock.Lock()
+		defer s.serverLock.Unlock()
+
+		s.conf.ConditionalForwarding = req.Rules
+	}()
+
+	s.conf.ConfigModified()
+
+	err = s.Reconfigure(nil)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+	}
+}
@@ -0,0 +1,193 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewForwardingRules(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*ForwardingRule
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*ForwardingRule{{
+			Name:          "lan",
+			Domains:       []string{"lan", "*.corp.example", `/^printer[0-9]+\.office$/`},
+			ClientSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.1/24")},
+			QTypes:        []string{"A", "AAAA"},
+			Upstreams:     []string{"# comment", "192.168.1.1:53"},
+		}, {
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "conditional forwarding at index 0: no value",
+		confs:      []*ForwardingRule{nil},
+	}, {
+		name:       "bad_regexp",
+		wantErrMsg: `conditional forwarding at index 0: domains: at index 0: bad regular expression "/lan"`,
+		confs: []*ForwardingRule{{
+			Domains:   []string{"/lan"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name: "bad_regexp_syntax",
+		wantErrMsg: "conditional forwarding at index 0: domains: at index 0: " +
+			"compiling regular expression: error parsing regexp: missing closing ]: `[`",
+		confs: []*ForwardingRule{{
+			Domains:   []string{"/[/"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name: "bad_wildcard",
+		wantErrMsg: `conditional forwarding at index 0: domains: at index 0: ` +
+			`bad domain name "*.example": wildcards are not allowed`,
+		confs: []*ForwardingRule{{
+			Domains:   []string{"*.*.example"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "bad_subnet",
+		wantErrMsg: "conditional forwarding at index 0: client_subnets: at index 0: empty value",
+		confs: []*ForwardingRule{{
+			ClientSubnets: []netip.Prefix{{}},
+			Upstreams:     []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "bad_qtype",
+		wantErrMsg: `conditional forwarding at index 0: qtypes: at index 0: unknown query type "BAD"`,
+		confs: []*ForwardingRule{{
+			QTypes:    []string{"bad"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "no_upstreams",
+		wantErrMsg: "conditional forwarding at index 1: upstreams: empty value",
+		confs: []*ForwardingRule{{
+			Upstreams: []string{"127.0.0.1:53"},
+		}, {
+			Domains: []string{"lan"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := newForwardingRules(tc.confs, &upstream.Options{}, nil)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			t.Cleanup(func() { closeForwardingRules(rules) })
+		})
+	}
+}
+
+func TestServer_ForwardingRuleFor(t *testing.T) {
+	rules, err := newForwardingRules([]*ForwardingRule{{
+		Name:          "office",
+		Domains:       []string{`/^printer[0-9]+\.office$/`},
+		ClientSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		Upstreams:     []string{"192.168.1.1:53"},
+	}, {
+		Name:      "corp",
+		Domains:   []string{"*.corp.example"},
+		QTypes:    []string{"A"},
+		Upstreams: []string{"10.0.0.1:53"},
+	}, {
+		Name:      "lan",
+		Domains:   []string{"lan"},
+		Upstreams: []string{"192.168.0.1:53"},
+	}}, &upstream.Options{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeForwardingRules(rules) })
+
+	s := &Server{
+		forwardingRules: rules,
+	}
+
+	var (
+		officeIP = netip.MustParseAddr("192.168.1.2")
+		otherIP  = netip.MustParseAddr("192.168.2.2")
+	)
+
+	testCases := []struct {
+		addr     netip.Addr
+		name     string
+		host     string
+		wantRule string
+		qtype    uint16
+	}{{
+		addr:     officeIP,
+		name:     "regexp",
+		host:     "PRINTER12.office.",
+		wantRule: "office",
+		qtype:    dns.TypeA,
+	}, {
+		addr:     otherIP,
+		name:     "regexp_other_subnet",
+		host:     "printer12.office.",
+		wantRule: "",
+		qtype:    dns.TypeA,
+	}, {
+		addr:     officeIP,
+		name:     "regexp_no_match",
+		host:     "scanner.office.",
+		wantRule: "",
+		qtype:    dns.TypeA,
+	}, {
+		addr:     otherIP,
+		name:     "wildcard",
+		host:     "mail.corp.example.",
+		wantRule: "corp",
+		qtype:    dns.TypeA,
+	}, {
+		addr:     otherIP,
+		name:     "wildcard_itself",
+		host:     "corp.example.",
+		wantRule: "",
+		qtype:    dns.TypeA,
+	}, {
+		addr:     otherIP,
+		name:     "wildcard_other_qtype",
+		host:     "mail.corp.example.",
+		wantRule: "",
+		qtype:    dns.TypeAAAA,
+	}, {
+		addr:     otherIP,
+		name:     "domain",
+		host:     "lan.",
+		wantRule: "lan",
+		qtype:    dns.TypeAAAA,
+	}, {
+		addr:     otherIP,
+		name:     "subdomain",
+		host:     "nas.lan.",
+		wantRule: "lan",
+		qtype:    dns.TypeAAAA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := s.forwardingRuleFor(dns.Question{
+				Name:   tc.host,
+				Qtype:  tc.qtype,
+				Qclass: dns.ClassINET,
+			}, tc.addr)
+			if tc.wantRule == "" {
+				assert.Nil(t, r)
+
+				return
+			}
+
+			require.NotNil(t, r)
+
+			assert.Equal(t, tc.wantRule, r.name)
+		})
+	}
+}
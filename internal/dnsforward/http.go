@@ -110,10 +110,15 @@ type jsonDNSConfig struct {
 	// EDNSCSCustomIP is custom IP for EDNS Client Subnet.
 	EDNSCSCustomIP netip.Addr `json:"edns_cs_custom_ip"`
 
-	// DefaultLocalPTRUpstreams is used to pass the addresses from
-	// systemResolvers to the front-end.  It's not a pointer to the slice since
-	// there is no need to omit it while decoding from JSON.
+	// DefaultLocalPTRUpstreams is used to pass the addresses of the discovered
+	// local DNS servers or the system resolvers to the front-end.  It's not a
+	// pointer to the slice since there is no need to omit it while decoding
+	// from JSON.
 	DefaultLocalPTRUpstreams []string `json:"default_local_ptr_upstreams,omitempty"`
+
+	// UpstreamsStatus is used to pass the health statuses of the upstreams to
+	// the front-end.  It's ignored while decoding from JSON.
+	UpstreamsStatus []*upstreamStatusJSON `json:"upstreams_status,omitempty"`
 }
 
 // jsonUpstreamMode is a enumeration of upstream modes.
@@ -129,6 +134,8 @@ const (
 	jsonUpstreamModeLoadBalance jsonUpstreamMode = "load_balance"
 	jsonUpstreamModeParallel    jsonUpstreamMode = "parallel"
 	jsonUpstreamModeFastestAddr jsonUpstreamMode = "fastest_addr"
+	jsonUpstreamModeWeighted    jsonUpstreamMode = "weighted"
+	jsonUpstreamModeFailOver    jsonUpstreamMode = "fail_over"
 )
 
 func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
@@ -172,6 +179,10 @@ func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
 		upstreamMode = jsonUpstreamModeParallel
 	case UpstreamModeFastestAddr:
 		upstreamMode = jsonUpstreamModeFastestAddr
+	case UpstreamModeWeighted:
+		upstreamMode = jsonUpstreamModeWeighted
+	case UpstreamModeFailOver:
+		upstreamMode = jsonUpstreamModeFailOver
 	}
 
 	defPTRUps, err := s.defaultLocalPTRUpstreams()
@@ -208,6 +219,7 @@ func (s *Server) getDNSConfig() (c *jsonDNSConfig) {
 		LocalPTRUpstreams:        &localPTRUpstreams,
 		DefaultLocalPTRUpstreams: defPTRUps,
 		DisabledUntil:            protectionDisabledUntil,
+		UpstreamsStatus:          s.upstreamStatuses(),
 	}
 }
 
@@ -220,7 +232,8 @@ func (s *Server) defaultLocalPTRUpstreams() (ups []string, err error) {
 		return nil, err
 	}
 
-	sysResolvers := slices.DeleteFunc(slices.Clone(s.sysResolvers.Addrs()), matcher.Has)
+	sysResolvers := s.defaultPrivateResolvers(matcher).Addrs()
+	sysResolvers = slices.DeleteFunc(slices.Clone(sysResolvers), matcher.Has)
 	ups = make([]string, 0, len(sysResolvers))
 	for _, r := range sysResolvers {
 		ups = append(ups, r.String())
@@ -255,7 +268,9 @@ func (req *jsonDNSConfig) checkUpstreamMode() (err error) {
 		jsonUpstreamModeEmpty,
 		jsonUpstreamModeLoadBalance,
 		jsonUpstreamModeParallel,
-		jsonUpstreamModeFastestAddr:
+		jsonUpstreamModeFastestAddr,
+		jsonUpstreamModeWeighted,
+		jsonUpstreamModeFailOver:
 		return nil
 	default:
 		return fmt.Errorf("upstream_mode: incorrect value %q", um)
@@ -311,10 +326,17 @@ func (req *jsonDNSConfig) checkBootstrap() (err error) {
 		return nil
 	}
 
+	// Don't wrap the error because it's informative enough as is.
+	return ValidateBootstraps(*req.Bootstraps)
+}
+
+// ValidateBootstraps returns an error if any of the bootstrap DNS server
+// addresses is invalid.
+func ValidateBootstraps(addrs []string) (err error) {
 	var b string
 	defer func() { err = errors.Annotate(err, "checking bootstrap %s: %w", b) }()
 
-	for _, b = range *req.Bootstraps {
+	for _, b = range addrs {
 		if b == "" {
 			return errors.Error("empty")
 		}
@@ -333,6 +355,14 @@ func (req *jsonDNSConfig) checkBootstrap() (err error) {
 	return nil
 }
 
+// ValidateUpstreams returns an error if the upstream DNS server configuration
+// is invalid.  Comments and empty lines are allowed.
+func ValidateUpstreams(upstreams []string) (err error) {
+	uc, err := proxy.ParseUpstreamsConfig(upstreams, &upstream.Options{})
+
+	return errors.WithDeferred(err, uc.Close())
+}
+
 // containsPrivateRDNS returns true if req contains private RDNS settings and
 // should be validated.
 func (req *jsonDNSConfig) containsPrivateRDNS() (ok bool) {
@@ -368,12 +398,8 @@ func (req *jsonDNSConfig) validateUpstreamDNSServers(
 	sysResolvers SystemResolvers,
 	privateNets netutil.SubnetSet,
 ) (err error) {
-	var uc *proxy.UpstreamConfig
-	opts := &upstream.Options{}
-
 	if req.Upstreams != nil {
-		uc, err = proxy.ParseUpstreamsConfig(*req.Upstreams, opts)
-		err = errors.WithDeferred(err, uc.Close())
+		err = ValidateUpstreams(*req.Upstreams)
 		if err != nil {
 			return fmt.Errorf("upstream servers: %w", err)
 		}
@@ -392,8 +418,7 @@ func (req *jsonDNSConfig) validateUpstreamDNSServers(
 	}
 
 	if req.Fallbacks != nil {
-		uc, err = proxy.ParseUpstreamsConfig(*req.Fallbacks, opts)
-		err = errors.WithDeferred(err, uc.Close())
+		err = ValidateUpstreams(*req.Fallbacks)
 		if err != nil {
 			return fmt.Errorf("fallback servers: %w", err)
 		}
@@ -474,7 +499,7 @@ func (s *Server) handleSetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = req.validate(ourAddrs, s.sysResolvers, s.privateNets)
+	err = req.validate(ourAddrs, s.defaultPrivateResolvers(ourAddrs), s.privateNets)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
@@ -534,6 +559,10 @@ func mustParseUpstreamMode(mode jsonUpstreamMode) (um UpstreamMode) {
 		return UpstreamModeParallel
 	case jsonUpstreamModeFastestAddr:
 		return UpstreamModeFastestAddr
+	case jsonUpstreamModeWeighted:
+		return UpstreamModeWeighted
+	case jsonUpstreamModeFailOver:
+		return UpstreamModeFailOver
 	default:
 		// Should never happen, since the value should be validated.
 		panic(fmt.Errorf("unexpected upstream mode: %q", mode))
@@ -642,7 +671,13 @@ func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 
 // handleCacheClear is the handler for the POST /control/cache_clear HTTP API.
 func (s *Server) handleCacheClear(w http.ResponseWriter, _ *http.Request) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
 	s.dnsProxy.ClearCache()
+	s.cachePersist.clear()
+	s.startWarmUpLocked()
+
 	_, _ = io.WriteString(w, "OK")
 }
 
@@ -679,14 +714,7 @@ func (s *Server) handleSetProtection(w http.ResponseWriter, r *http.Request) {
 		disabledUntil = &calcTime
 	}
 
-	func() {
-		s.serverLock.Lock()
-		defer s.serverLock.Unlock()
-
-		s.dnsFilter.SetProtectionStatus(protectionReq.Enabled, disabledUntil)
-	}()
-
-	s.conf.ConfigModified()
+	s.SetProtection(protectionReq.Enabled, disabledUntil)
 
 	aghhttp.OK(w)
 }
@@ -731,6 +759,28 @@ func (s *Server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/access/set", s.handleAccessSet)
 
 	s.conf.HTTPRegister(http.MethodPost, "/control/cache_clear", s.handleCacheClear)
+	s.conf.HTTPRegister(http.MethodGet, "/control/cache", s.handleCache)
+	s.conf.HTTPRegister(http.MethodPost, "/control/cache/purge", s.handleCachePurge)
+	s.conf.HTTPRegister(http.MethodGet, "/control/upstream_breakers", s.handleUpstreamBreakers)
+	s.conf.HTTPRegister(http.MethodGet, "/control/upstream_status", s.handleUpstreamStatus)
+	s.conf.HTTPRegister(http.MethodGet, "/control/malformed_queries", s.handleMalformedQueries)
+	s.conf.HTTPRegister(
+		http.MethodPost,
+		"/control/malformed_queries/reset",
+		s.handleMalformedQueriesReset,
+	)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/conditional_forwarding", s.handleGetForwardingRules)
+	s.conf.HTTPRegister(
+		http.MethodPut,
+		"/control/conditional_forwarding/update",
+		s.handleSetForwardingRules,
+	)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/zones", s.handleGetLocalZones)
+	s.conf.HTTPRegister(http.MethodPost, "/control/zones/add", s.handleAddLocalZone)
+	s.conf.HTTPRegister(http.MethodPost, "/control/zones/update", s.handleUpdateLocalZone)
+	s.conf.HTTPRegister(http.MethodPost, "/control/zones/delete", s.handleDeleteLocalZone)
 
 	// Register both versions, with and without the trailing slash, to
 	// prevent a 301 Moved Permanently redirect when clients request the
@@ -739,8 +789,13 @@ func (s *Server) registerHandlers() {
 	// See go doc net/http.ServeMux.
 	//
 	// See also https://github.com/AdguardTeam/AdGuardHome/issues/2628.
-	s.conf.HTTPRegister("", "/dns-query", s.handleDoH)
-	s.conf.HTTPRegister("", "/dns-query/", s.handleDoH)
+	for _, e := range dohEndpointsOrDefault(s.conf.DoHEndpoints) {
+		s.conf.HTTPRegister("", e.Path, s.handleDoH)
+		s.conf.HTTPRegister("", e.Path+"/", s.handleDoH)
+	}
+
+	s.conf.HTTPRegister("", "/"+unfilteredDoHPathElem, s.handleUnfilteredDoH)
+	s.conf.HTTPRegister("", "/"+unfilteredDoHPathElem+"/", s.handleUnfilteredDoH)
 
 	webRegistered = true
 }
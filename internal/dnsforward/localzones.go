@@ -0,0 +1,485 @@
+package dnsforward
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// defaultLocalZoneTTL is the TTL of the records of the local zones that have
+// no explicit TTL.
+const defaultLocalZoneTTL = 3600
+
+// maxLocalZoneCNAMEs is the maximum number of CNAME records followed within a
+// local zone when answering a single request.
+const maxLocalZoneCNAMEs = 8
+
+// localZoneTypes are the types of the records supported in the local zones.
+var localZoneTypes = container.NewMapSet[uint16](
+	dns.TypeSOA,
+	dns.TypeNS,
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeMX,
+	dns.TypeTXT,
+	dns.TypeSRV,
+)
+
+// localZone is a validated [LocalZoneConfig].
+type localZone struct {
+	// soa is the SOA record of the zone.
+	soa *dns.SOA
+
+	// records are the records of the zone by their lowercased owner names.
+	records map[string][]dns.RR
+
+	// names are the lowercased names existing in the zone, including the
+	// empty non-terminals, for example "b.example.org." if there is only
+	// "a.b.example.org.".
+	names *container.MapSet[string]
+
+	// fqdn is the lowercased fully-qualified domain name of the zone.
+	fqdn string
+}
+
+// newLocalZones returns the local zones prepared from confs.  The zones are
+// sorted so that the most specific ones come first.
+func newLocalZones(confs []*LocalZoneConfig) (zones []*localZone, err error) {
+	seen := container.NewMapSet[string]()
+	for i, c := range confs {
+		var z *localZone
+		z, err = newLocalZone(c)
+		if err != nil {
+			return nil, fmt.Errorf("local zone at index %d: %w", i, err)
+		}
+
+		if seen.Has(z.fqdn) {
+			return nil, fmt.Errorf("local zone at index %d: duplicate zone %q", i, z.fqdn)
+		}
+
+		seen.Add(z.fqdn)
+		zones = append(zones, z)
+	}
+
+	slices.SortStableFunc(zones, func(a, b *localZone) (res int) {
+		return cmp.Compare(len(b.fqdn), len(a.fqdn))
+	})
+
+	return zones, nil
+}
+
+// newLocalZone validates c and returns the local zone prepared from it.
+func newLocalZone(c *LocalZoneConfig) (z *localZone, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	name, err := aghnet.ParseDomainName(c.Name)
+	if err != nil {
+		return nil, fmt.Errorf("name: %w", err)
+	}
+
+	z = &localZone{
+		records: map[string][]dns.RR{},
+		names:   container.NewMapSet[string](),
+		fqdn:    dns.Fqdn(name),
+	}
+
+	for i, rec := range c.Records {
+		err = z.addRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("zone %q: records: at index %d: %w", name, i, err)
+		}
+	}
+
+	if z.soa == nil {
+		return nil, fmt.Errorf("zone %q: no soa record", name)
+	}
+
+	for owner, rrs := range z.records {
+		if len(rrs) > 1 && slices.ContainsFunc(rrs, isCNAME) {
+			return nil, fmt.Errorf("zone %q: cname at %q along with other records", name, owner)
+		}
+	}
+
+	return z, nil
+}
+
+// isCNAME returns true if rr is a CNAME record.
+func isCNAME(rr dns.RR) (ok bool) {
+	return rr.Header().Rrtype == dns.TypeCNAME
+}
+
+// addRecord parses and validates rec and adds it to z.
+func (z *localZone) addRecord(rec string) (err error) {
+	rr, err := parseLocalZoneRecord(rec, z.fqdn)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	hdr := rr.Header()
+	owner := strings.ToLower(hdr.Name)
+	isApex := owner == z.fqdn
+
+	switch {
+	case hdr.Class != dns.ClassINET:
+		return fmt.Errorf("bad class %s", dns.Class(hdr.Class))
+	case !localZoneTypes.Has(hdr.Rrtype):
+		return fmt.Errorf("unsupported type %s", dns.Type(hdr.Rrtype))
+	case !isApex && !netutil.IsSubdomain(owner, z.fqdn):
+		return fmt.Errorf("name %q is out of zone", hdr.Name)
+	case strings.Contains(owner, "*"):
+		return fmt.Errorf("name %q: wildcards are not supported", hdr.Name)
+	case hdr.Rrtype == dns.TypeNS && !isApex:
+		return fmt.Errorf("name %q: delegations are not supported", hdr.Name)
+	}
+
+	if soa, ok := rr.(*dns.SOA); ok {
+		if !isApex {
+			return fmt.Errorf("name %q: soa must be at the zone itself", hdr.Name)
+		} else if z.soa != nil {
+			return errors.Error("duplicate soa record")
+		}
+
+		z.soa = soa
+	}
+
+	z.records[owner] = append(z.records[owner], rr)
+	for n := owner; n != z.fqdn; {
+		z.names.Add(n)
+		_, n, _ = strings.Cut(n, ".")
+	}
+
+	z.names.Add(z.fqdn)
+
+	return nil
+}
+
+// parseLocalZoneRecord parses a single record in the presentation format with
+// the names relative to origin.
+func parseLocalZoneRecord(rec, origin string) (rr dns.RR, err error) {
+	zp := dns.NewZoneParser(strings.NewReader(rec), origin, "")
+	zp.SetDefaultTTL(defaultLocalZoneTTL)
+
+	rr, ok := zp.Next()
+	if err = zp.Err(); err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if !ok {
+		return nil, errors.ErrEmptyValue
+	}
+
+	if _, ok = zp.Next(); ok {
+		return nil, errors.Error("more than one record")
+	}
+
+	return rr, nil
+}
+
+// contains returns true if name is within z.  name must be a lowercased
+// fully-qualified domain name.
+func (z *localZone) contains(name string) (ok bool) {
+	return name == z.fqdn || netutil.IsSubdomain(name, z.fqdn)
+}
+
+// localZoneFor returns the most specific local zone containing name or nil if
+// there is none.  name must be a lowercased fully-qualified domain name.
+// s.serverLock is expected to be locked.
+func (s *Server) localZoneFor(name string) (z *localZone) {
+	for _, z = range s.localZones {
+		if z.contains(name) {
+			return z
+		}
+	}
+
+	return nil
+}
+
+// localZoneResponse returns the authoritative response to req if the requested
+// name is within a local zone and nil otherwise.
+func (s *Server) localZoneResponse(req *dns.Msg) (resp *dns.Msg) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil
+	}
+
+	name := strings.ToLower(q.Name)
+	z := s.localZoneFor(name)
+	if z == nil {
+		return nil
+	}
+
+	resp = s.replyCompressed(req)
+	resp.Authoritative = true
+	z.answer(resp, name, q.Qtype)
+
+	// Preserve the case of the question in the owner names.
+	for _, rr := range resp.Answer {
+		if hdr := rr.Header(); strings.EqualFold(hdr.Name, q.Name) {
+			hdr.Name = q.Name
+		}
+	}
+
+	return resp
+}
+
+// answer fills resp with the answer to the request of type qt for name, which
+// must be within z and lowercased.  The CNAME records are followed within z.
+func (z *localZone) answer(resp *dns.Msg, name string, qt uint16) {
+	for range maxLocalZoneCNAMEs {
+		if !z.names.Has(name) {
+			resp.Rcode = dns.RcodeNameError
+			resp.Ns = []dns.RR{z.negativeSOA()}
+
+			return
+		}
+
+		rrs := z.records[name]
+		matched := slices.DeleteFunc(slices.Clone(rrs), func(rr dns.RR) (ok bool) {
+			return qt != dns.TypeANY && rr.Header().Rrtype != qt
+		})
+
+		if len(matched) > 0 {
+			for _, rr := range matched {
+				resp.Answer = append(resp.Answer, dns.Copy(rr))
+			}
+
+			z.addGlue(resp, matched)
+
+			return
+		}
+
+		i := slices.IndexFunc(rrs, isCNAME)
+		if i < 0 {
+			// The name exists but has no records of this type.
+			resp.Ns = []dns.RR{z.negativeSOA()}
+
+			return
+		}
+
+		cname := rrs[i].(*dns.CNAME)
+		resp.Answer = append(resp.Answer, dns.Copy(cname))
+
+		name = strings.ToLower(cname.Target)
+		if !z.contains(name) {
+			// Let the client resolve the target out of the zone.
+			return
+		}
+	}
+
+	log.Debug("dnsforward: local zone %q: too many cnames", z.fqdn)
+}
+
+// addGlue adds the addresses of the in-zone targets of the NS, MX, and SRV
+// records in rrs to the additional section of resp.
+func (z *localZone) addGlue(resp *dns.Msg, rrs []dns.RR) {
+	for _, rr := range rrs {
+		var target string
+		switch rr := rr.(type) {
+		case *dns.NS:
+			target = rr.Ns
+		case *dns.MX:
+			target = rr.Mx
+		case *dns.SRV:
+			target = rr.Target
+		default:
+			continue
+		}
+
+		for _, addr := range z.records[strings.ToLower(target)] {
+			switch addr.Header().Rrtype {
+			case dns.TypeA, dns.TypeAAAA:
+				resp.Extra = append(resp.Extra, dns.Copy(addr))
+			}
+		}
+	}
+}
+
+// negativeSOA returns the SOA record of z for the negative responses, the TTL
+// of which is limited by the minimum TTL of the zone as per RFC 2308.
+func (z *localZone) negativeSOA() (soa *dns.SOA) {
+	soa = dns.Copy(z.soa).(*dns.SOA)
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+
+	return soa
+}
+
+// processLocalZones responds to the requests for the names within the local
+// zones, unless the response has already been set.
+func (s *Server) processLocalZones(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing local zones")
+	defer log.Debug("dnsforward: finished processing local zones")
+
+	pctx := dctx.proxyCtx
+	if pctx.Res != nil {
+		return resultCodeSuccess
+	}
+
+	if resp := s.localZoneResponse(pctx.Req); resp != nil {
+		pctx.Res = resp
+	}
+
+	return resultCodeSuccess
+}
+
+// localZonesJSON is the response to the GET /control/zones HTTP API.
+type localZonesJSON struct {
+	Zones []*LocalZoneConfig `json:"zones"`
+}
+
+// localZoneUpdateJSON is the body of the request to the POST
+// /control/zones/update HTTP API.
+type localZoneUpdateJSON struct {
+	// Data is the new configuration of the zone.
+	Data *LocalZoneConfig `json:"data"`
+
+	// Name is the name of the zone to update.
+	Name string `json:"name"`
+}
+
+// localZoneDeleteJSON is the body of the request to the POST
+// /control/zones/delete HTTP API.
+type localZoneDeleteJSON struct {
+	// Name is the name of the zone to delete.
+	Name string `json:"name"`
+}
+
+// handleGetLocalZones is the handler for the GET /control/zones HTTP API.
+func (s *Server) handleGetLocalZones(w http.ResponseWriter, r *http.Request) {
+	resp := &localZonesJSON{}
+
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		resp.Zones = slices.Clone(s.conf.LocalZones)
+	}()
+
+	if resp.Zones == nil {
+		resp.Zones = []*LocalZoneConfig{}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleAddLocalZone is the handler for the POST /control/zones/add HTTP API.
+func (s *Server) handleAddLocalZone(w http.ResponseWriter, r *http.Request) {
+	c := &LocalZoneConfig{}
+	err := json.NewDecoder(r.Body).Decode(c)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	s.updateLocalZones(w, r, func(confs []*LocalZoneConfig) (upd []*LocalZoneConfig, err error) {
+		return append(confs, c), nil
+	})
+}
+
+// handleUpdateLocalZone is the handler for the POST /control/zones/update HTTP
+// API.
+func (s *Server) handleUpdateLocalZone(w http.ResponseWriter, r *http.Request) {
+	req := &localZoneUpdateJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	s.updateLocalZones(w, r, func(confs []*LocalZoneConfig) (upd []*LocalZoneConfig, err error) {
+		i := indexLocalZone(confs, req.Name)
+		if i < 0 {
+			return nil, fmt.Errorf("zone %q: %w", req.Name, errors.ErrNoValue)
+		}
+
+		confs[i] = req.Data
+
+		return confs, nil
+	})
+}
+
+// handleDeleteLocalZone is the handler for the POST /control/zones/delete HTTP
+// API.
+func (s *Server) handleDeleteLocalZone(w http.ResponseWriter, r *http.Request) {
+	req := &localZoneDeleteJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	s.updateLocalZones(w, r, func(confs []*LocalZoneConfig) (upd []*LocalZoneConfig, err error) {
+		i := indexLocalZone(confs, req.Name)
+		if i < 0 {
+			return nil, fmt.Errorf("zone %q: %w", req.Name, errors.ErrNoValue)
+		}
+
+		return slices.Delete(confs, i, i+1), nil
+	})
+}
+
+// updateLocalZones applies update to a copy of the configuration of the local
+// zones, validates the result, and replaces the local zones with it.  The
+// errors are written to w.
+func (s *Server) updateLocalZones(
+	w http.ResponseWriter,
+	r *http.Request,
+	update func(confs []*LocalZoneConfig) (upd []*LocalZoneConfig, err error),
+) {
+	err := func() (err error) {
+		s.serverLock.Lock()
+		defer s.serverLock.Unlock()
+
+		confs, err := update(slices.Clone(s.conf.LocalZones))
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		zones, err := newLocalZones(confs)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		s.conf.LocalZones, s.localZones = confs, zones
+
+		return nil
+	}()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	s.conf.ConfigModified()
+}
+
+// indexLocalZone returns the index of the zone with name in confs or -1 if
+// there is none.
+func indexLocalZone(confs []*LocalZoneConfig, name string) (i int) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	return slices.IndexFunc(confs, func(c *LocalZoneConfig) (ok bool) {
+		return c != nil && strings.ToLower(strings.TrimSuffix(c.Name, ".")) == name
+	})
+}
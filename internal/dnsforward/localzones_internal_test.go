@@ -0,0 +1,249 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocalZoneSOA is the SOA record of the test local zones.
+const testLocalZoneSOA = "@ 3600 SOA ns1 hostmaster 1 7200 3600 1209600 300"
+
+func TestNewLocalZones(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		wantErr string
+		confs   []*LocalZoneConfig
+	}{{
+		name:    "valid",
+		wantErr: "",
+		confs: []*LocalZoneConfig{{
+			Name: "home.example",
+			Records: []string{
+				testLocalZoneSOA,
+				"@ NS ns1",
+				"ns1 A 192.168.1.1",
+				"www CNAME ns1",
+				"@ MX 10 mail",
+				"_sip._tcp SRV 10 5 5060 sip",
+				`@ TXT "v=spf1 -all"`,
+			},
+		}},
+	}, {
+		name:    "nil",
+		wantErr: "local zone at index 0: no value",
+		confs:   []*LocalZoneConfig{nil},
+	}, {
+		name:    "no_soa",
+		wantErr: `local zone at index 0: zone "home.example": no soa record`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{"www A 192.168.1.2"},
+		}},
+	}, {
+		name: "duplicate_soa",
+		wantErr: `local zone at index 0: zone "home.example": records: ` +
+			`at index 1: duplicate soa record`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{testLocalZoneSOA, testLocalZoneSOA},
+		}},
+	}, {
+		name: "out_of_zone",
+		wantErr: `local zone at index 0: zone "home.example": records: ` +
+			`at index 1: name "www.other.example." is out of zone`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{testLocalZoneSOA, "www.other.example. A 192.168.1.2"},
+		}},
+	}, {
+		name: "unsupported_type",
+		wantErr: `local zone at index 0: zone "home.example": records: ` +
+			`at index 1: unsupported type PTR`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{testLocalZoneSOA, "www PTR other.example."},
+		}},
+	}, {
+		name: "delegation",
+		wantErr: `local zone at index 0: zone "home.example": records: ` +
+			`at index 1: name "sub.home.example.": delegations are not supported`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{testLocalZoneSOA, "sub NS ns.other.example."},
+		}},
+	}, {
+		name: "cname_and_other",
+		wantErr: `local zone at index 0: zone "home.example": ` +
+			`cname at "www.home.example." along with other records`,
+		confs: []*LocalZoneConfig{{
+			Name: "home.example",
+			Records: []string{
+				testLocalZoneSOA,
+				"www CNAME @",
+				"www A 192.168.1.2",
+			},
+		}},
+	}, {
+		name:    "duplicate_zone",
+		wantErr: `local zone at index 1: duplicate zone "home.example."`,
+		confs: []*LocalZoneConfig{{
+			Name:    "home.example",
+			Records: []string{testLocalZoneSOA},
+		}, {
+			Name:    "HOME.example.",
+			Records: []string{testLocalZoneSOA},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newLocalZones(tc.confs)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_localZoneResponse(t *testing.T) {
+	t.Parallel()
+
+	zones, err := newLocalZones([]*LocalZoneConfig{{
+		Name: "home.example",
+		Records: []string{
+			testLocalZoneSOA,
+			"@ NS ns1",
+			"ns1 A 192.168.1.1",
+			"printer.office 60 A 192.168.1.3",
+			"www CNAME ns1",
+			"ext CNAME www.other.example.",
+			"@ MX 10 ns1",
+		},
+	}, {
+		Name: "lab.home.example",
+		Records: []string{
+			testLocalZoneSOA,
+			"@ A 192.168.2.1",
+		},
+	}})
+	require.NoError(t, err)
+
+	s := &Server{
+		localZones: zones,
+	}
+
+	testCases := []struct {
+		name       string
+		qname      string
+		wantAnswer []string
+		wantExtra  []string
+		qtype      uint16
+		wantRcode  int
+		wantSOA    bool
+	}{{
+		name:       "a",
+		qname:      "Ns1.Home.Example.",
+		wantAnswer: []string{"Ns1.Home.Example.\t3600\tIN\tA\t192.168.1.1"},
+		qtype:      dns.TypeA,
+		wantRcode:  dns.RcodeSuccess,
+	}, {
+		name:  "cname_in_zone",
+		qname: "www.home.example.",
+		wantAnswer: []string{
+			"www.home.example.\t3600\tIN\tCNAME\tns1.home.example.",
+			"ns1.home.example.\t3600\tIN\tA\t192.168.1.1",
+		},
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:       "cname_out_of_zone",
+		qname:      "ext.home.example.",
+		wantAnswer: []string{"ext.home.example.\t3600\tIN\tCNAME\twww.other.example."},
+		qtype:      dns.TypeA,
+		wantRcode:  dns.RcodeSuccess,
+	}, {
+		name:       "mx_glue",
+		qname:      "home.example.",
+		wantAnswer: []string{"home.example.\t3600\tIN\tMX\t10 ns1.home.example."},
+		wantExtra:  []string{"ns1.home.example.\t3600\tIN\tA\t192.168.1.1"},
+		qtype:      dns.TypeMX,
+		wantRcode:  dns.RcodeSuccess,
+	}, {
+		name:      "nodata",
+		qname:     "ns1.home.example.",
+		qtype:     dns.TypeAAAA,
+		wantRcode: dns.RcodeSuccess,
+		wantSOA:   true,
+	}, {
+		name:      "empty_non_terminal",
+		qname:     "office.home.example.",
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeSuccess,
+		wantSOA:   true,
+	}, {
+		name:      "nxdomain",
+		qname:     "none.home.example.",
+		qtype:     dns.TypeA,
+		wantRcode: dns.RcodeNameError,
+		wantSOA:   true,
+	}, {
+		name:       "more_specific_zone",
+		qname:      "lab.home.example.",
+		wantAnswer: []string{"lab.home.example.\t3600\tIN\tA\t192.168.2.1"},
+		qtype:      dns.TypeA,
+		wantRcode:  dns.RcodeSuccess,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := (&dns.Msg{}).SetQuestion(tc.qname, tc.qtype)
+			resp := s.localZoneResponse(req)
+			require.NotNil(t, resp)
+
+			assert.True(t, resp.Authoritative)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+			assert.Equal(t, tc.wantAnswer, rrStrings(resp.Answer))
+			assert.Equal(t, tc.wantExtra, rrStrings(resp.Extra))
+
+			if !tc.wantSOA {
+				assert.Empty(t, resp.Ns)
+
+				return
+			}
+
+			require.Len(t, resp.Ns, 1)
+
+			soa := testutil.RequireTypeAssert[*dns.SOA](t, resp.Ns[0])
+			assert.Equal(t, uint32(300), soa.Hdr.Ttl)
+		})
+	}
+
+	t.Run("out_of_zones", func(t *testing.T) {
+		t.Parallel()
+
+		req := (&dns.Msg{}).SetQuestion("other.example.", dns.TypeA)
+		assert.Nil(t, s.localZoneResponse(req))
+	})
+}
+
+// rrStrings returns the string representations of rrs or nil if there are
+// none.
+func rrStrings(rrs []dns.RR) (strs []string) {
+	for _, rr := range rrs {
+		strs = append(strs, rr.String())
+	}
+
+	return strs
+}
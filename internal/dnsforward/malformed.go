@@ -0,0 +1,445 @@
+package dnsforward
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// MalformedQueriesConfig is the configuration of the handling of the malformed
+// queries, which are the DNS messages that could be decoded but aren't valid
+// queries.
+type MalformedQueriesConfig struct {
+	// BanThreshold is the number of malformed queries within Window after
+	// which the client's address is banned.  If zero, the clients aren't
+	// banned.
+	BanThreshold uint `yaml:"ban_threshold"`
+
+	// Window is the duration of the window within which the malformed queries
+	// are counted for the ban.  If zero, [defaultMalformedWindow] is used.
+	Window timeutil.Duration `yaml:"window"`
+
+	// BanDuration is the duration of the ban.  If zero,
+	// [defaultMalformedBanDuration] is used.
+	BanDuration timeutil.Duration `yaml:"ban_duration"`
+}
+
+// Default values of [MalformedQueriesConfig].
+const (
+	defaultMalformedWindow      = 1 * time.Minute
+	defaultMalformedBanDuration = 1 * time.Hour
+)
+
+// maxMalformedClients is the maximum number of the clients tracked by
+// [malformedTracker].  It's used to limit the memory consumption when the
+// malformed queries are sent from many spoofed addresses.
+const maxMalformedClients = 1000
+
+// validate returns an error if c is invalid.  A nil c is valid.
+func (c *MalformedQueriesConfig) validate() (err error) {
+	switch {
+	case c == nil:
+		return nil
+	case c.Window.Duration < 0:
+		return fmt.Errorf("window: %w: %s", errors.ErrNegative, c.Window)
+	case c.BanDuration.Duration < 0:
+		return fmt.Errorf("ban_duration: %w: %s", errors.ErrNegative, c.BanDuration)
+	default:
+		return nil
+	}
+}
+
+// malformedClass is the class of a malformed query.
+type malformedClass string
+
+// malformedClass values.
+const (
+	// malformedNone means that the query isn't malformed.
+	malformedNone malformedClass = ""
+
+	// malformedResponse means that the message has the response bit set.
+	malformedResponse malformedClass = "response"
+
+	// malformedOpcode means that the opcode of the message isn't QUERY.
+	malformedOpcode malformedClass = "unsupported_opcode"
+
+	// malformedNoQuestion means that the message has no question.
+	malformedNoQuestion malformedClass = "no_question"
+
+	// malformedMultipleQuestions means that the message has more than one
+	// question.
+	malformedMultipleQuestions malformedClass = "multiple_questions"
+
+	// malformedClassValue means that the class of the question is unknown.
+	malformedClassValue malformedClass = "bad_class"
+
+	// malformedType means that the type of the question is a reserved or a
+	// meta-type which can't be queried.
+	malformedType malformedClass = "bad_type"
+
+	// malformedRecords means that the message has records in the answer or
+	// the authority sections.
+	malformedRecords malformedClass = "unexpected_records"
+
+	// malformedEDNS means that the message has more than one OPT record.
+	malformedEDNS malformedClass = "bad_edns"
+)
+
+// classifyMalformed returns the class of req if it's malformed and
+// [malformedNone] otherwise.  req must not be nil.
+func classifyMalformed(req *dns.Msg) (c malformedClass) {
+	switch {
+	case req.Response:
+		return malformedResponse
+	case req.Opcode != dns.OpcodeQuery:
+		return malformedOpcode
+	case len(req.Question) == 0:
+		return malformedNoQuestion
+	case len(req.Question) > 1:
+		return malformedMultipleQuestions
+	case len(req.Answer) > 0 || len(req.Ns) > 0:
+		return malformedRecords
+	}
+
+	q := req.Question[0]
+	switch q.Qclass {
+	case dns.ClassINET, dns.ClassCHAOS, dns.ClassHESIOD, dns.ClassANY:
+		// Go on.
+	default:
+		return malformedClassValue
+	}
+
+	switch q.Qtype {
+	case dns.TypeNone, dns.TypeOPT, dns.TypeTSIG:
+		return malformedType
+	}
+
+	numOPT := 0
+	for _, rr := range req.Extra {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			numOPT++
+		}
+	}
+
+	if numOPT > 1 {
+		return malformedEDNS
+	}
+
+	return malformedNone
+}
+
+// malformedClient is the statistics of the malformed queries of a single
+// client address.
+type malformedClient struct {
+	// counts are the numbers of the malformed queries by class.
+	counts map[malformedClass]uint64
+
+	// lastSeen is the time of the last malformed query.
+	lastSeen time.Time
+
+	// windowStart is the start of the current ban window.
+	windowStart time.Time
+
+	// bannedUntil is the end of the ban, if the client is banned.
+	bannedUntil time.Time
+
+	// total is the total number of the malformed queries.
+	total uint64
+
+	// windowCount is the number of the malformed queries within the current
+	// ban window.
+	windowCount uint
+}
+
+// malformedTracker counts the malformed queries by client address and bans the
+// addresses sending too many of them.
+//
+// NOTE: The messages which can't be decoded at all are dropped by module
+// dnsproxy before reaching the handlers of the server, so they aren't counted.
+type malformedTracker struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// window is the duration of the ban window.
+	window time.Duration
+
+	// banDuration is the duration of the ban.
+	banDuration time.Duration
+
+	// banThreshold is the number of the malformed queries within the window
+	// after which the client is banned.  If zero, the clients aren't banned.
+	banThreshold uint
+
+	// clients are the statistics of the client addresses.
+	clients map[netip.Addr]*malformedClient
+
+	// totals are the numbers of the malformed queries from all clients by
+	// class, including the ones not tracked individually.
+	totals map[malformedClass]uint64
+}
+
+// newMalformedTracker returns a new properly initialized *malformedTracker.
+func newMalformedTracker() (t *malformedTracker) {
+	return &malformedTracker{
+		mu:      &sync.Mutex{},
+		clients: map[netip.Addr]*malformedClient{},
+		totals:  map[malformedClass]uint64{},
+	}
+}
+
+// setConfig sets the configuration of t.  conf must be valid.  A nil conf
+// disables the bans but keeps the counters.
+func (t *malformedTracker) setConfig(conf *MalformedQueriesConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if conf == nil {
+		t.banThreshold = 0
+
+		return
+	}
+
+	t.banThreshold = conf.BanThreshold
+	t.window = cmp.Or(conf.Window.Duration, defaultMalformedWindow)
+	t.banDuration = cmp.Or(conf.BanDuration.Duration, defaultMalformedBanDuration)
+}
+
+// isBanned returns true if addr is banned at now.  t may be nil.
+func (t *malformedTracker) isBanned(addr netip.Addr, now time.Time) (ok bool) {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.clients[addr]
+
+	return t.banThreshold > 0 && c != nil && now.Before(c.bannedUntil)
+}
+
+// record counts a malformed query of class from addr received at now and
+// returns true if addr has been banned because of it.  t may be nil.
+func (t *malformedTracker) record(
+	addr netip.Addr,
+	class malformedClass,
+	now time.Time,
+) (banned bool) {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.totals[class]++
+
+	c := t.clients[addr]
+	if c == nil {
+		if !t.evictLocked(now) {
+			return false
+		}
+
+		c = &malformedClient{
+			counts: map[malformedClass]uint64{},
+		}
+		t.clients[addr] = c
+	}
+
+	c.counts[class]++
+	c.total++
+	c.lastSeen = now
+
+	if t.banThreshold == 0 || now.Before(c.bannedUntil) {
+		return false
+	}
+
+	if now.Sub(c.windowStart) >= t.window {
+		c.windowStart = now
+		c.windowCount = 0
+	}
+
+	c.windowCount++
+	if c.windowCount < t.banThreshold {
+		return false
+	}
+
+	c.bannedUntil = now.Add(t.banDuration)
+	c.windowCount = 0
+
+	return true
+}
+
+// evictLocked makes room for a new client, if necessary, by removing the least
+// recently seen client which isn't banned at now.  It returns false if there is
+// no room.  t.mu must be locked.
+func (t *malformedTracker) evictLocked(now time.Time) (ok bool) {
+	if len(t.clients) < maxMalformedClients {
+		return true
+	}
+
+	var (
+		oldest     netip.Addr
+		oldestSeen time.Time
+	)
+
+	for addr, c := range t.clients {
+		if now.Before(c.bannedUntil) {
+			continue
+		}
+
+		if !oldest.IsValid() || c.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = addr, c.lastSeen
+		}
+	}
+
+	if !oldest.IsValid() {
+		return false
+	}
+
+	delete(t.clients, oldest)
+
+	return true
+}
+
+// reset removes all counters and lifts all bans.
+func (t *malformedTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clear(t.clients)
+	clear(t.totals)
+}
+
+// handleMalformed checks if the request of pctx is malformed, counts it if so,
+// and returns the error for [Server.HandleBefore].  err is nil if the request
+// isn't malformed.
+func (s *Server) handleMalformed(pctx *proxy.DNSContext) (err error) {
+	req := pctx.Req
+	class := classifyMalformed(req)
+	if class == malformedNone {
+		return nil
+	}
+
+	addr := pctx.Addr.Addr()
+	log.Debug("dnsforward: malformed query from %s: %s", addr, class)
+
+	if s.malformed.record(addr, class, time.Now()) {
+		log.Info("dnsforward: banned %s after too many malformed queries", addr)
+	}
+
+	err = fmt.Errorf("malformed query: %s", class)
+	switch class {
+	case malformedResponse:
+		// Don't reply to the responses to prevent the loops between the
+		// servers.
+		return err
+	case malformedOpcode:
+		return &proxy.BeforeRequestError{
+			Err:      err,
+			Response: s.NewMsgNOTIMPLEMENTED(req),
+		}
+	default:
+		return &proxy.BeforeRequestError{
+			Err:      err,
+			Response: s.reply(req, dns.RcodeFormatError),
+		}
+	}
+}
+
+// malformedClientJSON is the statistics of the malformed queries of a single
+// client address.
+type malformedClientJSON struct {
+	// Classes are the numbers of the malformed queries by class.
+	Classes map[malformedClass]uint64 `json:"classes"`
+
+	// LastSeen is the time of the last malformed query.
+	LastSeen time.Time `json:"last_seen"`
+
+	// BannedUntil is the end of the ban, if the client is currently banned.
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+
+	// IP is the address of the client.
+	IP netip.Addr `json:"ip"`
+
+	// Total is the total number of the malformed queries.
+	Total uint64 `json:"total"`
+}
+
+// malformedQueriesJSON is the response to the GET /control/malformed_queries
+// HTTP API.
+type malformedQueriesJSON struct {
+	// Totals are the numbers of the malformed queries from all clients by
+	// class.
+	Totals map[malformedClass]uint64 `json:"totals"`
+
+	// Clients are the statistics of the client addresses, sorted by the total
+	// number of the malformed queries in descending order.
+	Clients []*malformedClientJSON `json:"clients"`
+
+	// BanEnabled is true if the clients are banned after too many malformed
+	// queries.
+	BanEnabled bool `json:"ban_enabled"`
+}
+
+// toJSON returns the statistics of t at now.
+func (t *malformedTracker) toJSON(now time.Time) (j *malformedQueriesJSON) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j = &malformedQueriesJSON{
+		Totals:     maps.Clone(t.totals),
+		Clients:    make([]*malformedClientJSON, 0, len(t.clients)),
+		BanEnabled: t.banThreshold > 0,
+	}
+
+	for addr, c := range t.clients {
+		cj := &malformedClientJSON{
+			Classes:  maps.Clone(c.counts),
+			LastSeen: c.lastSeen,
+			IP:       addr,
+			Total:    c.total,
+		}
+
+		if now.Before(c.bannedUntil) {
+			until := c.bannedUntil
+			cj.BannedUntil = &until
+		}
+
+		j.Clients = append(j.Clients, cj)
+	}
+
+	slices.SortFunc(j.Clients, func(a, b *malformedClientJSON) (res int) {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), a.IP.Compare(b.IP))
+	})
+
+	return j
+}
+
+// handleMalformedQueries is the handler for the GET /control/malformed_queries
+// HTTP API.
+func (s *Server) handleMalformedQueries(w http.ResponseWriter, r *http.Request) {
+	aghhttp.WriteJSONResponseOK(w, r, s.malformed.toJSON(time.Now()))
+}
+
+// handleMalformedQueriesReset is the handler for the POST
+// /control/malformed_queries/reset HTTP API.  It removes all counters and lifts
+// all bans.
+func (s *Server) handleMalformedQueriesReset(w http.ResponseWriter, _ *http.Request) {
+	s.malformed.reset()
+
+	_, _ = io.WriteString(w, "OK")
+}
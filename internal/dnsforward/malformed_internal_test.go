@@ -0,0 +1,167 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyMalformed(t *testing.T) {
+	t.Parallel()
+
+	newReq := func() (req *dns.Msg) {
+		return (&dns.Msg{}).SetQuestion(testFQDN, dns.TypeA)
+	}
+
+	opt := &dns.OPT{
+		Hdr: dns.RR_Header{
+			Name:   ".",
+			Rrtype: dns.TypeOPT,
+		},
+	}
+
+	testCases := []struct {
+		modify func(req *dns.Msg)
+		name   string
+		want   malformedClass
+	}{{
+		modify: func(_ *dns.Msg) {},
+		name:   "valid",
+		want:   malformedNone,
+	}, {
+		modify: func(req *dns.Msg) { req.Extra = []dns.RR{opt} },
+		name:   "valid_edns",
+		want:   malformedNone,
+	}, {
+		modify: func(req *dns.Msg) { req.Response = true },
+		name:   "response",
+		want:   malformedResponse,
+	}, {
+		modify: func(req *dns.Msg) { req.Opcode = dns.OpcodeNotify },
+		name:   "opcode",
+		want:   malformedOpcode,
+	}, {
+		modify: func(req *dns.Msg) { req.Question = nil },
+		name:   "no_question",
+		want:   malformedNoQuestion,
+	}, {
+		modify: func(req *dns.Msg) { req.Question = append(req.Question, req.Question[0]) },
+		name:   "multiple_questions",
+		want:   malformedMultipleQuestions,
+	}, {
+		modify: func(req *dns.Msg) { req.Question[0].Qclass = 1234 },
+		name:   "bad_class",
+		want:   malformedClassValue,
+	}, {
+		modify: func(req *dns.Msg) { req.Question[0].Qtype = dns.TypeOPT },
+		name:   "bad_type",
+		want:   malformedType,
+	}, {
+		modify: func(req *dns.Msg) {
+			req.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: testFQDN}}}
+		},
+		name: "unexpected_records",
+		want: malformedRecords,
+	}, {
+		modify: func(req *dns.Msg) { req.Extra = []dns.RR{opt, opt} },
+		name:   "bad_edns",
+		want:   malformedEDNS,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := newReq()
+			tc.modify(req)
+
+			assert.Equal(t, tc.want, classifyMalformed(req))
+		})
+	}
+}
+
+func TestMalformedTracker_record(t *testing.T) {
+	t.Parallel()
+
+	addr := netip.MustParseAddr("192.0.2.1")
+	start := time.Unix(0, 0)
+
+	tr := newMalformedTracker()
+	tr.setConfig(&MalformedQueriesConfig{
+		BanThreshold: 3,
+		Window:       timeutil.Duration{Duration: time.Minute},
+		BanDuration:  timeutil.Duration{Duration: time.Hour},
+	})
+
+	// Two queries within the window and one after it.
+	assert.False(t, tr.record(addr, malformedNoQuestion, start))
+	assert.False(t, tr.record(addr, malformedNoQuestion, start.Add(30*time.Second)))
+	assert.False(t, tr.record(addr, malformedResponse, start.Add(2*time.Minute)))
+	assert.False(t, tr.isBanned(addr, start.Add(2*time.Minute)))
+
+	assert.False(t, tr.record(addr, malformedResponse, start.Add(2*time.Minute)))
+	assert.True(t, tr.record(addr, malformedResponse, start.Add(2*time.Minute)))
+
+	bannedAt := start.Add(2 * time.Minute)
+	assert.True(t, tr.isBanned(addr, bannedAt.Add(time.Minute)))
+	assert.False(t, tr.isBanned(addr, bannedAt.Add(time.Hour)))
+	assert.False(t, tr.isBanned(netip.MustParseAddr("192.0.2.2"), bannedAt))
+
+	j := tr.toJSON(bannedAt)
+	assert.True(t, j.BanEnabled)
+	assert.Equal(t, map[malformedClass]uint64{
+		malformedNoQuestion: 2,
+		malformedResponse:   3,
+	}, j.Totals)
+
+	require.Len(t, j.Clients, 1)
+
+	c := j.Clients[0]
+	assert.Equal(t, addr, c.IP)
+	assert.Equal(t, uint64(5), c.Total)
+	require.NotNil(t, c.BannedUntil)
+	assert.Equal(t, bannedAt.Add(time.Hour), *c.BannedUntil)
+
+	tr.setConfig(nil)
+	assert.False(t, tr.isBanned(addr, bannedAt))
+
+	tr.reset()
+	j = tr.toJSON(bannedAt)
+	assert.Empty(t, j.Totals)
+	assert.Empty(t, j.Clients)
+}
+
+func TestMalformedTracker_record_evict(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(0, 0)
+
+	tr := newMalformedTracker()
+	tr.setConfig(&MalformedQueriesConfig{
+		BanThreshold: 1,
+	})
+
+	for i := range maxMalformedClients {
+		addr := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)})
+		require.True(t, tr.record(addr, malformedNoQuestion, start))
+	}
+
+	// All tracked clients are banned, so there is no room for a new one.
+	newAddr := netip.MustParseAddr("192.0.2.1")
+	assert.False(t, tr.record(newAddr, malformedNoQuestion, start))
+	assert.False(t, tr.isBanned(newAddr, start))
+
+	// After the bans expire, the least recently seen client is evicted.
+	later := start.Add(defaultMalformedBanDuration)
+	assert.True(t, tr.record(newAddr, malformedNoQuestion, later))
+	assert.True(t, tr.isBanned(newAddr, later))
+
+	j := tr.toJSON(later)
+	assert.Len(t, j.Clients, maxMalformedClients)
+	assert.Equal(t, uint64(maxMalformedClients+2), j.Totals[malformedNoQuestion])
+}
@@ -339,6 +339,29 @@ func (s *Server) genBlockedHost(request *dns.Msg, newAddr string, d *proxy.DNSCo
 	return resp
 }
 
+// minimalANYTTL is the TTL of the synthesized HINFO resource records in the
+// responses to the ANY requests.  It's the value used by the major public
+// resolvers.
+const minimalANYTTL = 3789
+
+// newMsgMinimalANY returns a minimal response to the ANY request with a single
+// synthesized HINFO resource record, as described in section 4.2 of RFC 8482.
+func (s *Server) newMsgMinimalANY(req *dns.Msg) (resp *dns.Msg) {
+	resp = s.replyCompressed(req)
+	resp.Answer = append(resp.Answer, &dns.HINFO{
+		Hdr: dns.RR_Header{
+			Name:   req.Question[0].Name,
+			Rrtype: dns.TypeHINFO,
+			Class:  dns.ClassINET,
+			Ttl:    minimalANYTTL,
+		},
+		Cpu: "RFC8482",
+		Os:  "",
+	})
+
+	return resp
+}
+
 // Create REFUSED DNS response
 func (s *Server) makeResponseREFUSED(req *dns.Msg) *dns.Msg {
 	return s.reply(req, dns.RcodeRefused)
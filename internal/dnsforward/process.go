@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/log"
@@ -84,12 +85,22 @@ const ddrHostFQDN = "_dns.resolver.arpa."
 
 // handleDNSRequest filters the incoming DNS requests and writes them to the query log
 func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error {
+	if !s.drainer.begin() {
+		log.Debug("dnsforward: draining: refusing request from %s", pctx.Addr)
+		pctx.Res = s.drainResponse(pctx)
+
+		return nil
+	}
+	defer s.drainer.end()
+
 	dctx := &dnsContext{
 		proxyCtx:  pctx,
 		result:    &filtering.Result{},
 		startTime: time.Now(),
 	}
 
+	defer s.setEDNSOptions(dctx)
+
 	type modProcessFunc func(ctx *dnsContext) (rc resultCode)
 
 	// Since (*dnsforward.Server).handleDNSRequest(...) is used as
@@ -103,8 +114,10 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 		s.processDHCPHosts,
 		s.processDHCPAddrs,
 		s.processFilteringBeforeRequest,
+		s.processLocalZones,
 		s.processUpstream,
 		s.processFilteringAfterResponse,
+		s.processSortlist,
 		s.ipset.process,
 		s.processQueryLogsAndStats,
 	}
@@ -118,6 +131,8 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 			return nil
 
 		case resultCodeError:
+			s.recordRolloutResponse(dctx, dns.RcodeServerFailure)
+
 			return dctx.err
 		}
 	}
@@ -165,6 +180,19 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 		return resultCodeFinish
 	}
 
+	if s.conf.MinimalANYResponses && qt == dns.TypeANY {
+		pctx.Res = s.newMsgMinimalANY(pctx.Req)
+
+		return resultCodeFinish
+	}
+
+	r := s.forwardingRuleFor(q, pctx.Addr.Addr().Unmap())
+	if r != nil && r.action == QTypeUpstreamActionRefuse {
+		pctx.Res = s.makeResponseREFUSED(pctx.Req)
+
+		return resultCodeFinish
+	}
+
 	if (qt == dns.TypeA || qt == dns.TypeAAAA) && q.Name == mozillaFQDN {
 		pctx.Res = s.NewMsgNXDOMAIN(pctx.Req)
 
@@ -188,6 +216,13 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 	dctx.protectionEnabled, _ = s.UpdatedProtectionStatus()
 	dctx.setts = s.clientRequestFilteringSettings(dctx)
 
+	if isUnfilteredRequest(pctx) {
+		log.Debug("dnsforward: request %d is for the unfiltered endpoint", pctx.RequestID)
+
+		dctx.protectionEnabled = false
+		disableFiltering(dctx.setts)
+	}
+
 	return resultCodeSuccess
 }
 
@@ -249,11 +284,12 @@ func (s *Server) makeDDRResponse(req *dns.Msg) (resp *dns.Msg) {
 	// name somewhere.
 	domainName := dns.Fqdn(s.conf.ServerName)
 
+	dohTmpl := PublicDoHPath(s.conf.DoHEndpoints) + "{?dns}"
 	for _, addr := range s.conf.HTTPSListenAddrs {
 		values := []dns.SVCBKeyValue{
 			&dns.SVCBAlpn{Alpn: []string{"h2"}},
 			&dns.SVCBPort{Port: uint16(addr.Port)},
-			&dns.SVCBDoHPath{Template: "/dns-query{?dns}"},
+			&dns.SVCBDoHPath{Template: dohTmpl},
 		}
 
 		ans := &dns.SVCB{
@@ -353,12 +389,12 @@ func (s *Server) processDHCPHosts(dctx *dnsContext) (rc resultCode) {
 		}
 		resp.Answer = append(resp.Answer, a)
 	case dns.TypeAAAA:
-		if s.dns64Pref != (netip.Prefix{}) {
+		if pref, ok := s.clientDNS64Pref(q.Name, dctx.setts); ok {
 			// Respond with DNS64-mapped address for IPv4 host if DNS64 is
 			// enabled.
 			aaaa := &dns.AAAA{
 				Hdr:  s.hdr(req, dns.TypeAAAA),
-				AAAA: s.mapDNS64(ip),
+				AAAA: mapNAT64(pref, ip),
 			}
 			resp.Answer = append(resp.Answer, aaaa)
 		}
@@ -482,36 +518,103 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 		return resultCodeFinish
 	}
 
+	// The upstreams set by the later calls override the ones set by the
+	// earlier ones.
 	s.setCustomUpstream(pctx, dctx.clientID)
+	s.setForwardingUpstream(pctx)
+	s.setReverseZoneUpstream(pctx)
+	s.setReqECS(pctx)
 
-	reqWantsDNSSEC := s.setReqAD(req)
+	dnssecEnabled := s.dnssecEnabled(dctx.setts)
+	reqWantsDNSSEC := s.setReqAD(req, dnssecEnabled, dctx.setts)
 
 	// Process the request further since it wasn't filtered.
+	if !s.setRestoredResp(pctx) {
+		if dctx.err = s.resolveUpstream(pctx); dctx.err != nil {
+			return resultCodeError
+		}
+
+		s.recordCacheDump(pctx)
+	}
+
+	dctx.responseFromUpstream = true
+	dctx.responseAD = pctx.Res.AuthenticatedData
+
+	s.setRespAD(pctx, dnssecEnabled, reqWantsDNSSEC)
+
+	if dctx.setts != nil && dctx.setts.ClientBlockQUIC {
+		removeH3ALPN(pctx.Res)
+	}
+
+	if req.Question[0].Qtype == dns.TypeAAAA {
+		s.applyClientDNS64(pctx.Res, req.Question[0].Name, dctx.setts)
+	}
+
+	return resultCodeSuccess
+}
+
+// resolveUpstream resolves the request in pctx using the proxy and sets the
+// actually used upstream.
+func (s *Server) resolveUpstream(pctx *proxy.DNSContext) (err error) {
 	prx := s.proxy()
 	if prx == nil {
-		dctx.err = srvClosedErr
+		return srvClosedErr
+	}
 
-		return resultCodeError
+	req := pctx.Req
+	if s.conf.UpstreamMode == UpstreamModeWeighted {
+		s.usedUpstreams.track(req)
+		defer s.setWeightedUpstream(pctx, req)
 	}
 
-	if dctx.err = prx.Resolve(pctx); dctx.err != nil {
-		return resultCodeError
+	modeUsedUpstreams.track(req)
+	defer setModeUpstream(pctx, req)
+
+	err = prx.Resolve(pctx)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
 	}
 
-	dctx.responseFromUpstream = true
-	dctx.responseAD = pctx.Res.AuthenticatedData
+	s.logFallbackUse(pctx)
+
+	return nil
+}
 
-	s.setRespAD(pctx, reqWantsDNSSEC)
+// dnssecEnabled returns true if DNSSEC is enabled for the client with setts,
+// which may be nil.  The setting of the client overrides the one of the server.
+func (s *Server) dnssecEnabled(setts *filtering.Settings) (ok bool) {
+	if setts == nil {
+		return s.conf.EnableDNSSEC
+	}
 
-	return resultCodeSuccess
+	switch setts.ClientDNSSEC {
+	case aghalg.NBTrue:
+		return true
+	case aghalg.NBFalse:
+		return false
+	default:
+		return s.conf.EnableDNSSEC
+	}
 }
 
-// setReqAD changes the request based on the server settings.  wantsDNSSEC is
-// false if the response should be cleared of the AD bit.
+// setReqAD changes the request based on whether DNSSEC is enabled for the
+// client with setts, which may be nil.  If DNSSEC is explicitly disabled for
+// the client, the upstreams are asked not to validate the response, so that
+// the clients unable to handle SERVFAIL for bogus domains still resolve them.
+// wantsDNSSEC is false if the response should be cleared of the AD bit.
 //
 // TODO(a.garipov, e.burkov): This should probably be done in module dnsproxy.
-func (s *Server) setReqAD(req *dns.Msg) (wantsDNSSEC bool) {
-	if !s.conf.EnableDNSSEC {
+func (s *Server) setReqAD(
+	req *dns.Msg,
+	enabled bool,
+	setts *filtering.Settings,
+) (wantsDNSSEC bool) {
+	if !enabled {
+		if setts != nil && setts.ClientDNSSEC == aghalg.NBFalse {
+			req.CheckingDisabled = true
+		}
+
 		return false
 	}
 
@@ -540,10 +643,10 @@ func hasDO(msg *dns.Msg) (do bool) {
 	return o.Do()
 }
 
-// setRespAD changes the request and response based on the server settings and
-// the original request data.
-func (s *Server) setRespAD(pctx *proxy.DNSContext, reqWantsDNSSEC bool) {
-	if s.conf.EnableDNSSEC && !reqWantsDNSSEC {
+// setRespAD changes the request and response based on whether DNSSEC is
+// enabled for the client and the original request data.
+func (s *Server) setRespAD(pctx *proxy.DNSContext, enabled, reqWantsDNSSEC bool) {
+	if enabled && !reqWantsDNSSEC {
 		pctx.Req.AuthenticatedData = false
 		pctx.Res.AuthenticatedData = false
 	}
@@ -642,5 +745,7 @@ func (s *Server) filterAfterResponse(dctx *dnsContext) (res resultCode) {
 		return resultCodeError
 	}
 
+	s.protectFromRebinding(dctx)
+
 	return resultCodeSuccess
 }
@@ -7,6 +7,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -34,6 +35,7 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode    rules.RCode
 		qType        rules.RRType
 		aaaaDisabled bool
+		minimalANY   bool
 		wantRC       resultCode
 	}{{
 		name:         "success",
@@ -41,6 +43,7 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode:    -1,
 		qType:        dns.TypeA,
 		aaaaDisabled: false,
+		minimalANY:   false,
 		wantRC:       resultCodeSuccess,
 	}, {
 		name:         "aaaa_disabled",
@@ -48,6 +51,7 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode:    dns.RcodeSuccess,
 		qType:        dns.TypeAAAA,
 		aaaaDisabled: true,
+		minimalANY:   false,
 		wantRC:       resultCodeFinish,
 	}, {
 		name:         "aaaa_disabled_a",
@@ -55,6 +59,7 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode:    -1,
 		qType:        dns.TypeA,
 		aaaaDisabled: true,
+		minimalANY:   false,
 		wantRC:       resultCodeSuccess,
 	}, {
 		name:         "mozilla_canary",
@@ -62,6 +67,7 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode:    dns.RcodeNameError,
 		qType:        dns.TypeA,
 		aaaaDisabled: false,
+		minimalANY:   false,
 		wantRC:       resultCodeFinish,
 	}, {
 		name:         "adguardhome_healthcheck",
@@ -69,7 +75,24 @@ func TestServer_ProcessInitial(t *testing.T) {
 		wantRCode:    dns.RcodeSuccess,
 		qType:        dns.TypeA,
 		aaaaDisabled: false,
+		minimalANY:   false,
 		wantRC:       resultCodeFinish,
+	}, {
+		name:         "minimal_any",
+		target:       testQuestionTarget,
+		wantRCode:    dns.RcodeSuccess,
+		qType:        dns.TypeANY,
+		aaaaDisabled: false,
+		minimalANY:   true,
+		wantRC:       resultCodeFinish,
+	}, {
+		name:         "any",
+		target:       testQuestionTarget,
+		wantRCode:    -1,
+		qType:        dns.TypeANY,
+		aaaaDisabled: false,
+		minimalANY:   false,
+		wantRC:       resultCodeSuccess,
 	}}
 
 	for _, tc := range testCases {
@@ -78,9 +101,10 @@ func TestServer_ProcessInitial(t *testing.T) {
 
 			c := ServerConfig{
 				Config: Config{
-					AAAADisabled:     tc.aaaaDisabled,
-					UpstreamMode:     UpstreamModeLoadBalance,
-					EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+					AAAADisabled:        tc.aaaaDisabled,
+					MinimalANYResponses: tc.minimalANY,
+					UpstreamMode:        UpstreamModeLoadBalance,
+					EDNSClientSubnet:    &EDNSClientSubnet{Enabled: false},
 				},
 				ServePlainDNS: true,
 			}
@@ -113,6 +137,12 @@ func TestServer_ProcessInitial(t *testing.T) {
 
 				assert.Equal(t, tc.wantRCode, gotResp.Rcode)
 			}
+
+			if tc.minimalANY {
+				require.Len(t, dctx.proxyCtx.Res.Answer, 1)
+
+				assert.IsType(t, &dns.HINFO{}, dctx.proxyCtx.Res.Answer[0])
+			}
 		})
 	}
 }
@@ -830,6 +860,68 @@ func TestServer_ProcessUpstream_localPTR(t *testing.T) {
 	})
 }
 
+func TestServer_SetReqAD(t *testing.T) {
+	testCases := []struct {
+		setts           *filtering.Settings
+		name            string
+		serverDNSSEC    bool
+		wantEnabled     bool
+		wantAD          bool
+		wantCheckingDis bool
+	}{{
+		setts:           nil,
+		name:            "server_enabled",
+		serverDNSSEC:    true,
+		wantEnabled:     true,
+		wantAD:          true,
+		wantCheckingDis: false,
+	}, {
+		setts:           &filtering.Settings{ClientDNSSEC: aghalg.NBNull},
+		name:            "client_default",
+		serverDNSSEC:    false,
+		wantEnabled:     false,
+		wantAD:          false,
+		wantCheckingDis: false,
+	}, {
+		setts:           &filtering.Settings{ClientDNSSEC: aghalg.NBTrue},
+		name:            "client_enabled",
+		serverDNSSEC:    false,
+		wantEnabled:     true,
+		wantAD:          true,
+		wantCheckingDis: false,
+	}, {
+		setts:           &filtering.Settings{ClientDNSSEC: aghalg.NBFalse},
+		name:            "client_disabled",
+		serverDNSSEC:    true,
+		wantEnabled:     false,
+		wantAD:          false,
+		wantCheckingDis: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				conf: ServerConfig{
+					Config: Config{
+						EnableDNSSEC: tc.serverDNSSEC,
+					},
+				},
+			}
+
+			req := (&dns.Msg{}).SetQuestion(ddrTestFQDN, dns.TypeA)
+
+			enabled := s.dnssecEnabled(tc.setts)
+			require.Equal(t, tc.wantEnabled, enabled)
+
+			wantsDNSSEC := s.setReqAD(req, enabled, tc.setts)
+			assert.False(t, wantsDNSSEC)
+
+			assert.Equal(t, tc.wantAD, req.AuthenticatedData)
+			assert.Equal(t, tc.wantCheckingDis, req.CheckingDisabled)
+		})
+	}
+}
+
 func TestIPStringFromAddr(t *testing.T) {
 	t.Run("not_nil", func(t *testing.T) {
 		addr := net.UDPAddr{
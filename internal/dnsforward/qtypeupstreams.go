@@ -0,0 +1,169 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// newQTypeRules returns the conditional forwarding rules prepared from confs.
+// private is the configuration of the private reverse DNS upstreams used by the
+// rules with [QTypeUpstreamActionLocal], it may be nil.
+func newQTypeRules(
+	confs []*QTypeUpstreamConfig,
+	opts *upstream.Options,
+	private *proxy.UpstreamConfig,
+) (rules []*forwardingRule, err error) {
+	for i, c := range confs {
+		var r *forwardingRule
+		r, err = newQTypeRule(c, opts, private)
+		if err != nil {
+			closeForwardingRules(rules)
+
+			return nil, fmt.Errorf("qtype upstreams at index %d: %w", i, err)
+		}
+
+		r.name = fmt.Sprintf("qtype upstreams at index %d", i)
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newQTypeRule validates c and returns the conditional forwarding rule prepared
+// from it.
+func newQTypeRule(
+	c *QTypeUpstreamConfig,
+	opts *upstream.Options,
+	private *proxy.UpstreamConfig,
+) (r *forwardingRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	r = &forwardingRule{
+		patterns: &domainPatterns{},
+		action:   c.Action,
+	}
+
+	r.qtypes, err = parseQTypes(c.QTypes)
+	if err != nil {
+		return nil, fmt.Errorf("qtypes: %w", err)
+	}
+
+	for i, d := range c.Domains {
+		d, err = aghnet.ParseDomainName(d)
+		if err != nil {
+			return nil, fmt.Errorf("domains: at index %d: %w", i, err)
+		}
+
+		r.patterns.domains = append(r.patterns.domains, dns.Fqdn(d))
+	}
+
+	addrs := stringutil.FilterOut(c.Upstreams, IsCommentOrEmpty)
+
+	switch r.action {
+	case "", QTypeUpstreamActionForward:
+		r.action = QTypeUpstreamActionForward
+		r.conf, err = newRuleUpstreams(addrs, opts, c.UpstreamMode)
+	case QTypeUpstreamActionLocal, QTypeUpstreamActionRefuse:
+		if len(addrs) > 0 {
+			return nil, fmt.Errorf("upstreams: must be empty for action %q", r.action)
+		}
+
+		if r.action == QTypeUpstreamActionLocal && private != nil {
+			r.conf = proxy.NewCustomUpstreamConfig(private, false, 0, false)
+		}
+	default:
+		return nil, fmt.Errorf("action: %w: %q", errors.ErrBadEnumValue, r.action)
+	}
+
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newRuleUpstreams returns the upstream configuration of a rule with
+// [QTypeUpstreamActionForward] or of a conditional forwarding rule.  If mode
+// isn't empty, the upstreams are used according to it, see
+// [ApplyUpstreamMode].
+func newRuleUpstreams(
+	addrs []string,
+	opts *upstream.Options,
+	mode UpstreamMode,
+) (conf *proxy.CustomUpstreamConfig, err error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("upstreams: %w", errors.ErrEmptyValue)
+	}
+
+	uc, err := proxy.ParseUpstreamsConfig(addrs, opts)
+	if err != nil {
+		return nil, fmt.Errorf("upstreams: %w", err)
+	}
+
+	if len(uc.Upstreams) == 0 {
+		logCloserErr(uc, "dnsforward: closing rule upstreams: %s")
+
+		return nil, errors.Error("upstreams: no default upstreams specified")
+	}
+
+	err = ApplyUpstreamMode(uc, mode, 0)
+	if err != nil {
+		logCloserErr(uc, "dnsforward: closing rule upstreams: %s")
+
+		return nil, fmt.Errorf("upstream_mode: %w", err)
+	}
+
+	return proxy.NewCustomUpstreamConfig(uc, false, 0, false), nil
+}
+
+// parseQTypes parses the names of DNS query types, either like "PTR" or like
+// "TYPE65", into a set.
+func parseQTypes(names []string) (qtypes *container.MapSet[uint16], err error) {
+	if len(names) == 0 {
+		return nil, errors.ErrEmptyValue
+	}
+
+	qtypes = container.NewMapSet[uint16]()
+	for i, name := range names {
+		name = strings.ToUpper(name)
+		qt, ok := dns.StringToType[name]
+		if !ok {
+			qt, err = parseGenericQType(name)
+			if err != nil {
+				return nil, fmt.Errorf("at index %d: %w", i, err)
+			}
+		}
+
+		qtypes.Add(qt)
+	}
+
+	return qtypes, nil
+}
+
+// parseGenericQType parses the query type in the generic format of RFC 3597,
+// for example "TYPE65".  name must be uppercased.
+func parseGenericQType(name string) (qt uint16, err error) {
+	numStr, ok := strings.CutPrefix(name, "TYPE")
+	if !ok {
+		return 0, fmt.Errorf("unknown query type %q", name)
+	}
+
+	num, err := strconv.ParseUint(numStr, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad query type %q: %w", name, err)
+	}
+
+	return uint16(num), nil
+}
@@ -0,0 +1,269 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewQTypeRules(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*QTypeUpstreamConfig
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"https", "TYPE64"},
+			Domains:   []string{"example.org."},
+			Upstreams: []string{"# comment", "127.0.0.1:53", "[/corp.example.org/]127.0.0.2:53"},
+		}, {
+			Action: QTypeUpstreamActionLocal,
+			QTypes: []string{"PTR"},
+		}, {
+			Action: QTypeUpstreamActionRefuse,
+			QTypes: []string{"ANY"},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "qtype upstreams at index 0: no value",
+		confs:      []*QTypeUpstreamConfig{nil},
+	}, {
+		name:       "no_qtypes",
+		wantErrMsg: "qtype upstreams at index 0: qtypes: empty value",
+		confs: []*QTypeUpstreamConfig{{
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "bad_qtype",
+		wantErrMsg: `qtype upstreams at index 0: qtypes: at index 1: unknown query type "BAD"`,
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"A", "bad"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name: "bad_generic_qtype",
+		wantErrMsg: `qtype upstreams at index 0: qtypes: at index 0: bad query type "TYPE65536": ` +
+			`strconv.ParseUint: parsing "65536": value out of range`,
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"TYPE65536"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name: "bad_domain",
+		wantErrMsg: `qtype upstreams at index 0: domains: at index 0: ` +
+			`bad domain name "*.example": wildcards are not allowed`,
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"A"},
+			Domains:   []string{"*.example"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "no_upstreams",
+		wantErrMsg: "qtype upstreams at index 0: upstreams: empty value",
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"A"},
+			Upstreams: []string{"# comment"},
+		}},
+	}, {
+		name:       "no_default_upstreams",
+		wantErrMsg: "qtype upstreams at index 1: upstreams: no default upstreams specified",
+		confs: []*QTypeUpstreamConfig{{
+			QTypes:    []string{"A"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}, {
+			QTypes:    []string{"A"},
+			Upstreams: []string{"[/example.org/]127.0.0.1:53"},
+		}},
+	}, {
+		name:       "refuse_upstreams",
+		wantErrMsg: `qtype upstreams at index 0: upstreams: must be empty for action "refuse"`,
+		confs: []*QTypeUpstreamConfig{{
+			Action:    QTypeUpstreamActionRefuse,
+			QTypes:    []string{"ANY"},
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "bad_action",
+		wantErrMsg: `qtype upstreams at index 0: action: bad enum value: "drop"`,
+		confs: []*QTypeUpstreamConfig{{
+			Action: "drop",
+			QTypes: []string{"ANY"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := newQTypeRules(tc.confs, &upstream.Options{}, nil)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			t.Cleanup(func() { closeForwardingRules(rules) })
+		})
+	}
+}
+
+func TestServer_ForwardingRuleFor_qtype(t *testing.T) {
+	rules, err := newQTypeRules([]*QTypeUpstreamConfig{{
+		QTypes:    []string{"HTTPS"},
+		Domains:   []string{"example.org"},
+		Upstreams: []string{"127.0.0.1:53"},
+	}, {
+		Action: QTypeUpstreamActionRefuse,
+		QTypes: []string{"ANY", "HTTPS"},
+	}}, &upstream.Options{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeForwardingRules(rules) })
+
+	s := &Server{
+		forwardingRules: rules,
+	}
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantAction QTypeUpstreamAction
+		qtype      uint16
+	}{{
+		name:       "domain",
+		host:       "example.org.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeHTTPS,
+	}, {
+		name:       "subdomain",
+		host:       "WWW.EXAMPLE.ORG.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeHTTPS,
+	}, {
+		name:       "other_domain",
+		host:       "example.net.",
+		wantAction: QTypeUpstreamActionRefuse,
+		qtype:      dns.TypeHTTPS,
+	}, {
+		name:       "any",
+		host:       "example.org.",
+		wantAction: QTypeUpstreamActionRefuse,
+		qtype:      dns.TypeANY,
+	}, {
+		name:       "none",
+		host:       "example.org.",
+		wantAction: "",
+		qtype:      dns.TypeA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := s.forwardingRuleFor(dns.Question{
+				Name:   tc.host,
+				Qtype:  tc.qtype,
+				Qclass: dns.ClassINET,
+			}, netip.Addr{})
+			if tc.wantAction == "" {
+				assert.Nil(t, r)
+			} else {
+				require.NotNil(t, r)
+				assert.Equal(t, tc.wantAction, r.action)
+			}
+		})
+	}
+}
+
+func TestServer_SetForwardingUpstream_overlap(t *testing.T) {
+	fwdRules, err := newForwardingRules([]*ForwardingRule{{
+		Name:      "lan",
+		Domains:   []string{"lan"},
+		Upstreams: []string{"192.168.0.1:53"},
+	}}, &upstream.Options{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeForwardingRules(fwdRules) })
+
+	qtypeRules, err := newQTypeRules([]*QTypeUpstreamConfig{{
+		QTypes:    []string{"HTTPS"},
+		Upstreams: []string{"127.0.0.1:53"},
+	}, {
+		Action: QTypeUpstreamActionRefuse,
+		QTypes: []string{"ANY"},
+	}}, &upstream.Options{}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeForwardingRules(qtypeRules) })
+
+	s := &Server{
+		forwardingRules: append(slices.Clone(fwdRules), qtypeRules...),
+	}
+
+	testCases := []struct {
+		want       *proxy.CustomUpstreamConfig
+		name       string
+		host       string
+		wantAction QTypeUpstreamAction
+		qtype      uint16
+	}{{
+		want:       fwdRules[0].conf,
+		name:       "both",
+		host:       "nas.lan.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeHTTPS,
+	}, {
+		want:       qtypeRules[0].conf,
+		name:       "qtype",
+		host:       "example.org.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeHTTPS,
+	}, {
+		want:       fwdRules[0].conf,
+		name:       "forwarding",
+		host:       "nas.lan.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeA,
+	}, {
+		want:       fwdRules[0].conf,
+		name:       "forwarding_over_refuse",
+		host:       "nas.lan.",
+		wantAction: QTypeUpstreamActionForward,
+		qtype:      dns.TypeANY,
+	}, {
+		want:       nil,
+		name:       "refuse",
+		host:       "example.org.",
+		wantAction: QTypeUpstreamActionRefuse,
+		qtype:      dns.TypeANY,
+	}, {
+		want:       nil,
+		name:       "none",
+		host:       "example.org.",
+		wantAction: "",
+		qtype:      dns.TypeA,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := dns.Question{
+				Name:   tc.host,
+				Qtype:  tc.qtype,
+				Qclass: dns.ClassINET,
+			}
+
+			pctx := &proxy.DNSContext{
+				Req:  &dns.Msg{Question: []dns.Question{q}},
+				Addr: netip.MustParseAddrPort("192.168.0.2:53"),
+			}
+
+			s.setForwardingUpstream(pctx)
+			assert.Same(t, tc.want, pctx.CustomUpstreamConfig)
+
+			r := s.forwardingRuleFor(q, pctx.Addr.Addr())
+			if tc.wantAction == "" {
+				assert.Nil(t, r)
+			} else {
+				require.NotNil(t, r)
+				assert.Equal(t, tc.wantAction, r.action)
+			}
+		})
+	}
+}
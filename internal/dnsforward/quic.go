@@ -0,0 +1,73 @@
+package dnsforward
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// quicBootstrapHosts are the lowercased well-known hostnames, which the clients
+// resolve before setting up the QUIC connections to the relays, e.g. the ones
+// of iCloud Private Relay.  The networks are expected to answer the requests
+// for these hostnames with NXDOMAIN to make the clients fall back to the
+// ordinary connections.
+//
+// See https://developer.apple.com/support/prepare-your-network-for-icloud-private-relay.
+var quicBootstrapHosts = []string{
+	"mask.icloud.com",
+	"mask-h2.icloud.com",
+}
+
+// isQUICBootstrapHost returns true if host is one of the well-known QUIC
+// bootstrap hostnames.  host must not have a trailing dot.
+func isQUICBootstrapHost(host string) (ok bool) {
+	return slices.Contains(quicBootstrapHosts, strings.ToLower(host))
+}
+
+// isH3ALPN returns true if alpn is the ALPN value of HTTP/3 or of one of its
+// drafts, e.g. "h3-29".
+func isH3ALPN(alpn string) (ok bool) {
+	return alpn == "h3" || strings.HasPrefix(alpn, "h3-")
+}
+
+// removeH3ALPN removes the HTTP/3 ALPN values from the HTTPS resource records
+// of the answer section of resp, so that the clients don't try to connect over
+// QUIC.  resp may be nil.
+func removeH3ALPN(resp *dns.Msg) {
+	if resp == nil {
+		return
+	}
+
+	for _, rr := range resp.Answer {
+		if https, ok := rr.(*dns.HTTPS); ok {
+			https.Value = removeH3ALPNValue(https.Value)
+		}
+	}
+}
+
+// removeH3ALPNValue returns kvs without the HTTP/3 ALPN values.  If no ALPN
+// values are left, the "alpn" and the "no-default-alpn" keys are removed
+// entirely, since the latter requires the former.
+func removeH3ALPNValue(kvs []dns.SVCBKeyValue) (res []dns.SVCBKeyValue) {
+	noALPN := false
+	for _, kv := range kvs {
+		alpn, ok := kv.(*dns.SVCBAlpn)
+		if !ok {
+			continue
+		}
+
+		alpn.Alpn = slices.DeleteFunc(alpn.Alpn, isH3ALPN)
+		noALPN = len(alpn.Alpn) == 0
+	}
+
+	if !noALPN {
+		return kvs
+	}
+
+	return slices.DeleteFunc(kvs, func(kv dns.SVCBKeyValue) (del bool) {
+		k := kv.Key()
+
+		return k == dns.SVCB_ALPN || k == dns.SVCB_NO_DEFAULT_ALPN
+	})
+}
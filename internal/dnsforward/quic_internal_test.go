@@ -0,0 +1,63 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveH3ALPN(t *testing.T) {
+	newHTTPS := func(kvs ...dns.SVCBKeyValue) (rr *dns.HTTPS) {
+		return &dns.HTTPS{
+			SVCB: dns.SVCB{
+				Hdr: dns.RR_Header{
+					Name:   "example.org.",
+					Rrtype: dns.TypeHTTPS,
+					Class:  dns.ClassINET,
+				},
+				Priority: 1,
+				Target:   ".",
+				Value:    kvs,
+			},
+		}
+	}
+
+	port := &dns.SVCBPort{Port: 443}
+
+	testCases := []struct {
+		rr   *dns.HTTPS
+		want *dns.HTTPS
+		name string
+	}{{
+		rr:   newHTTPS(&dns.SVCBAlpn{Alpn: []string{"h3", "h3-29", "h2"}}, port),
+		want: newHTTPS(&dns.SVCBAlpn{Alpn: []string{"h2"}}, port),
+		name: "mixed",
+	}, {
+		rr:   newHTTPS(&dns.SVCBAlpn{Alpn: []string{"h2", "http/1.1"}}),
+		want: newHTTPS(&dns.SVCBAlpn{Alpn: []string{"h2", "http/1.1"}}),
+		name: "no_h3",
+	}, {
+		rr:   newHTTPS(&dns.SVCBAlpn{Alpn: []string{"h3"}}, &dns.SVCBNoDefaultAlpn{}, port),
+		want: newHTTPS(port),
+		name: "only_h3",
+	}, {
+		rr:   newHTTPS(port),
+		want: newHTTPS(port),
+		name: "no_alpn",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &dns.Msg{
+				Answer: []dns.RR{tc.rr},
+			}
+
+			removeH3ALPN(resp)
+
+			assert.Equal(t, tc.want.String(), resp.Answer[0].String())
+		})
+	}
+
+	assert.NotPanics(t, func() { removeH3ALPN(nil) })
+}
@@ -0,0 +1,233 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// defaultQUICMaxStreams is the default maximum number of concurrent requests
+// sent over a single connection to a DNS-over-QUIC upstream.  It's the default
+// limit of incoming streams of the widespread QUIC server implementations, so
+// exceeding it makes the requests wait for the free streams.
+const defaultQUICMaxStreams uint = 100
+
+// Limits of the DNS-over-QUIC connection pools.
+const (
+	// quicPoolMaxConns is the maximum number of connections to a single
+	// DNS-over-QUIC upstream.
+	quicPoolMaxConns = 8
+
+	// quicPoolIdleTimeout is the time after which the additional idle
+	// connections are closed.
+	quicPoolIdleTimeout = 1 * time.Minute
+)
+
+// quicPoolUpstream is an [upstream.Upstream] that sends the requests to a
+// DNS-over-QUIC upstream over several connections, opening a new one when all
+// of the existing connections have the maximum number of streams in use.
+//
+// Each connection is kept by its own underlying upstream, which caches the TLS
+// session tickets and uses them to resume the session with 0-RTT when it
+// reconnects.
+type quicPoolUpstream struct {
+	// Upstream is the upstream of the first connection, which is never closed
+	// until the pool itself is.
+	upstream.Upstream
+
+	// newConn returns a new upstream for an additional connection.
+	newConn func() (u upstream.Upstream, err error)
+
+	// mu protects conns.
+	mu *sync.Mutex
+
+	// conns are the connections of the pool, the first one being the one of
+	// Upstream.
+	conns []*quicPoolConn
+
+	// maxStreams is the maximum number of concurrent requests over a single
+	// connection.
+	maxStreams uint
+}
+
+// quicPoolConn is a single connection of a [quicPoolUpstream].
+type quicPoolConn struct {
+	upstream.Upstream
+
+	// lastUsed is the time the connection was used last.
+	lastUsed time.Time
+
+	// streams is the number of requests in progress.
+	streams uint
+}
+
+// type check
+var _ upstream.Upstream = (*quicPoolUpstream)(nil)
+
+// newQUICPoolUpstream returns a new properly initialized *quicPoolUpstream with
+// u as the first connection.  u must be a DNS-over-QUIC upstream created with
+// opts.
+func newQUICPoolUpstream(
+	u upstream.Upstream,
+	opts *upstream.Options,
+	maxStreams uint,
+) (p *quicPoolUpstream) {
+	addr := u.Address()
+
+	return &quicPoolUpstream{
+		Upstream: u,
+		newConn: func() (u upstream.Upstream, err error) {
+			return upstream.AddressToUpstream(addr, opts)
+		},
+		mu:         &sync.Mutex{},
+		conns:      []*quicPoolConn{{Upstream: u}},
+		maxStreams: maxStreams,
+	}
+}
+
+// Exchange implements the [upstream.Upstream] interface for *quicPoolUpstream.
+func (p *quicPoolUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	c := p.acquire()
+	defer p.release(c)
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return c.Exchange(req)
+}
+
+// acquire returns the least loaded connection, opening a new one if all of
+// them are full, and closes the additional idle ones.
+func (p *quicPoolUpstream) acquire() (c *quicPoolConn) {
+	var idle []*quicPoolConn
+	defer func() { closeQUICPoolConns(idle) }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	idle = p.removeIdle(now)
+
+	c = p.conns[0]
+	for _, conn := range p.conns[1:] {
+		if conn.streams < c.streams {
+			c = conn
+		}
+	}
+
+	if c.streams >= p.maxStreams && len(p.conns) < quicPoolMaxConns {
+		u, err := p.newConn()
+		if err != nil {
+			// Shouldn't happen, since the address has already been parsed.
+			log.Error("dnsforward: adding connection to %s: %s", p.Address(), err)
+		} else {
+			log.Debug("dnsforward: adding connection %d to %s", len(p.conns), p.Address())
+
+			c = &quicPoolConn{Upstream: u}
+			p.conns = append(p.conns, c)
+		}
+	}
+
+	c.streams++
+	c.lastUsed = now
+
+	return c
+}
+
+// removeIdle removes the additional connections unused for
+// [quicPoolIdleTimeout] from the pool and returns them.  p.mu is expected to be
+// locked.
+func (p *quicPoolUpstream) removeIdle(now time.Time) (idle []*quicPoolConn) {
+	if len(p.conns) == 1 {
+		return nil
+	}
+
+	active := p.conns[:1]
+	for _, c := range p.conns[1:] {
+		if c.streams == 0 && now.Sub(c.lastUsed) > quicPoolIdleTimeout {
+			idle = append(idle, c)
+		} else {
+			active = append(active, c)
+		}
+	}
+
+	clear(p.conns[len(active):])
+	p.conns = active
+
+	return idle
+}
+
+// release marks the request over c as finished.
+func (p *quicPoolUpstream) release(c *quicPoolConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.streams--
+}
+
+// Close implements the [upstream.Upstream] interface for *quicPoolUpstream.
+func (p *quicPoolUpstream) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, c := range p.conns {
+		err = c.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("closing connection: %w", err))
+		}
+	}
+
+	p.conns = p.conns[:1]
+
+	return errors.Join(errs...)
+}
+
+// closeQUICPoolConns closes conns and logs the errors, if any.
+func closeQUICPoolConns(conns []*quicPoolConn) {
+	for _, c := range conns {
+		logCloserErr(c, "dnsforward: closing idle connection to %s: %s", c.Address())
+	}
+}
+
+// poolQUICUpstreams wraps the DNS-over-QUIC upstreams of uc, created with opts,
+// so that each of them uses a pool of connections with at most maxStreams
+// concurrent requests over each one.  If maxStreams is zero,
+// [defaultQUICMaxStreams] is used.  It must be called before any other
+// wrapping of the upstreams.
+func poolQUICUpstreams(uc *proxy.UpstreamConfig, opts *upstream.Options, maxStreams uint) {
+	if maxStreams == 0 {
+		maxStreams = defaultQUICMaxStreams
+	}
+
+	wrapped := map[upstream.Upstream]*quicPoolUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			if !strings.HasPrefix(u.Address(), "quic://") {
+				continue
+			}
+
+			p, ok := wrapped[u]
+			if !ok {
+				p = newQUICPoolUpstream(u, opts, maxStreams)
+				wrapped[u] = p
+			}
+
+			ups[i] = p
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+}
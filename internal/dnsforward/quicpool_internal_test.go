@@ -0,0 +1,126 @@
+package dnsforward
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQUICPoolUpstream_Exchange(t *testing.T) {
+	const (
+		maxStreams = 2
+		reqsNum    = 5
+	)
+
+	var (
+		exchNum  atomic.Int32
+		closeNum atomic.Int32
+	)
+
+	release := make(chan struct{})
+	newMock := func() (u upstream.Upstream) {
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (addr string) { return "quic://mock:853" },
+			OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+				exchNum.Add(1)
+				<-release
+
+				return (&dns.Msg{}).SetReply(req), nil
+			},
+			OnClose: func() (err error) {
+				closeNum.Add(1)
+
+				return nil
+			},
+		}
+	}
+
+	p := newQUICPoolUpstream(newMock(), &upstream.Options{}, maxStreams)
+	p.newConn = func() (u upstream.Upstream, err error) { return newMock(), nil }
+
+	wg := &sync.WaitGroup{}
+	wg.Add(reqsNum)
+	for range reqsNum {
+		go func() {
+			defer wg.Done()
+
+			_, _ = p.Exchange(createTestMessage("example.org."))
+		}()
+	}
+
+	require.Eventually(t, func() (ok bool) {
+		return exchNum.Load() == reqsNum
+	}, time.Second, time.Millisecond)
+
+	func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		require.Len(t, p.conns, 3)
+		for _, c := range p.conns {
+			assert.LessOrEqual(t, c.streams, uint(maxStreams))
+		}
+	}()
+
+	close(release)
+	wg.Wait()
+
+	// Make the additional connections idle.
+	func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for _, c := range p.conns {
+			assert.Zero(t, c.streams)
+			c.lastUsed = time.Now().Add(-2 * quicPoolIdleTimeout)
+		}
+	}()
+
+	_, err := p.Exchange(createTestMessage("example.org."))
+	require.NoError(t, err)
+
+	assert.Len(t, p.conns, 1)
+	assert.Equal(t, int32(2), closeNum.Load())
+
+	err = p.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(3), closeNum.Load())
+}
+
+func TestPoolQUICUpstreams(t *testing.T) {
+	opts := &upstream.Options{}
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		"quic://127.0.0.1:853",
+		"127.0.0.1:53",
+		"[/example.org/]quic://127.0.0.1:853",
+	}, opts)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+	poolQUICUpstreams(uc, opts, 0)
+
+	require.Len(t, uc.Upstreams, 2)
+
+	p, ok := uc.Upstreams[0].(*quicPoolUpstream)
+	require.True(t, ok)
+
+	assert.Equal(t, defaultQUICMaxStreams, p.maxStreams)
+
+	_, ok = uc.Upstreams[1].(*quicPoolUpstream)
+	assert.False(t, ok)
+
+	ups := uc.DomainReservedUpstreams["example.org."]
+	require.Len(t, ups, 1)
+
+	assert.IsType(t, (*quicPoolUpstream)(nil), ups[0])
+}
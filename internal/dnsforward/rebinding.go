@@ -0,0 +1,43 @@
+package dnsforward
+
+import (
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// protectFromRebinding blocks the response from dctx if it resolves a public
+// hostname to an internal address, unless the response has already been
+// filtered.  The hostnames within the local domain are never blocked.
+func (s *Server) protectFromRebinding(dctx *dnsContext) {
+	if s.rebinding == nil || dctx.result.IsFiltered {
+		return
+	}
+
+	pctx := dctx.proxyCtx
+	host := aghnet.NormalizeDomain(pctx.Req.Question[0].Name)
+	if host == s.localDomainSuffix || netutil.IsSubdomain(host, s.localDomainSuffix) {
+		return
+	}
+
+	for _, rr := range pctx.Res.Answer {
+		ip := rrAddr(rr)
+		if !ip.IsValid() || !s.rebinding.IsRebinding(host, ip) {
+			continue
+		}
+
+		log.Debug("dnsforward: rebinding: blocked %q resolving to %s", host, ip)
+
+		res := &filtering.Result{
+			Reason:     filtering.FilteredRebinding,
+			IsFiltered: true,
+		}
+
+		dctx.result = res
+		dctx.origResp = pctx.Res
+		pctx.Res = s.genDNSFilterMessage(pctx, res)
+
+		return
+	}
+}
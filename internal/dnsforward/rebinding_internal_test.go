@@ -0,0 +1,127 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/rebinding"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_protectFromRebinding(t *testing.T) {
+	f, err := filtering.New(&filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, nil)
+	require.NoError(t, err)
+
+	s, err := NewServer(DNSCreateParams{
+		DHCPServer:  &testDHCP{},
+		DNSFilter:   f,
+		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
+		Logger:      slogutil.NewDiscardLogger(),
+	})
+	require.NoError(t, err)
+
+	s.rebinding, err = rebinding.New(&rebinding.Config{
+		AllowedDomains: []string{"plex.direct"},
+		Enabled:        true,
+	})
+	require.NoError(t, err)
+
+	var (
+		publicIP  net.IP = netip.MustParseAddr("203.0.113.1").AsSlice()
+		privateIP net.IP = netip.MustParseAddr("192.168.1.1").AsSlice()
+	)
+
+	testCases := []struct {
+		result    *filtering.Result
+		name      string
+		host      string
+		ip        net.IP
+		wantBlock bool
+	}{{
+		result:    &filtering.Result{},
+		name:      "public",
+		host:      "example.com",
+		ip:        publicIP,
+		wantBlock: false,
+	}, {
+		result:    &filtering.Result{},
+		name:      "rebinding",
+		host:      "example.com",
+		ip:        privateIP,
+		wantBlock: true,
+	}, {
+		result:    &filtering.Result{},
+		name:      "allowed",
+		host:      "abc.plex.direct",
+		ip:        privateIP,
+		wantBlock: false,
+	}, {
+		result:    &filtering.Result{},
+		name:      "local_domain",
+		host:      "nas.lan",
+		ip:        privateIP,
+		wantBlock: false,
+	}, {
+		result: &filtering.Result{
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+		name:      "already_filtered",
+		host:      "example.com",
+		ip:        privateIP,
+		wantBlock: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestMessageWithType(dns.Fqdn(tc.host), dns.TypeA)
+			resp := newResp(dns.RcodeSuccess, req, []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   dns.Fqdn(tc.host),
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+				},
+				A: tc.ip,
+			}})
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Proto: proxy.ProtoUDP,
+					Req:   req,
+					Res:   resp,
+					Addr:  testClientAddrPort,
+				},
+				result: tc.result,
+			}
+
+			s.protectFromRebinding(dctx)
+
+			if !tc.wantBlock {
+				assert.Same(t, tc.result, dctx.result)
+				assert.Same(t, resp, dctx.proxyCtx.Res)
+
+				return
+			}
+
+			assert.Equal(t, filtering.FilteredRebinding, dctx.result.Reason)
+			assert.Same(t, resp, dctx.origResp)
+
+			ans := dctx.proxyCtx.Res.Answer
+			require.Len(t, ans, 1)
+
+			a, ok := ans[0].(*dns.A)
+			require.True(t, ok)
+
+			assert.True(t, a.A.IsUnspecified())
+		})
+	}
+}
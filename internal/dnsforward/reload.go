@@ -0,0 +1,260 @@
+package dnsforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// retiredCloseDelay is the time after which the state replaced by
+// [Server.Reload] is closed, so that the requests still using it are answered.
+const retiredCloseDelay = 1 * time.Minute
+
+// retiredState is the state of the server replaced by [Server.Reload].
+type retiredState struct {
+	// addrProc is the replaced address processor.
+	addrProc client.AddressProcessor
+
+	// upstreams are the upstream configurations of the replaced proxy, if it
+	// doesn't serve on the listeners.  Otherwise, they're closed when that
+	// proxy is shut down.
+	upstreams []*proxy.UpstreamConfig
+
+	// bootResolvers are the replaced bootstrap resolvers.
+	bootResolvers []*upstream.UpstreamResolver
+
+	// reverseZones are the replaced reverse zones.
+	reverseZones []*reverseZone
+
+	// forwardingRules are the replaced conditional forwarding rules.
+	forwardingRules []*forwardingRule
+}
+
+// close closes the retired state.
+func (r *retiredState) close() {
+	for _, uc := range r.upstreams {
+		logCloserErr(uc, "dnsforward: closing retired upstreams: %s")
+	}
+
+	for _, b := range r.bootResolvers {
+		logCloserErr(b, "dnsforward: closing retired bootstrap %s: %s", b.Address())
+	}
+
+	closeReverseZones(r.reverseZones)
+	closeForwardingRules(r.forwardingRules)
+
+	if r.addrProc != nil {
+		logCloserErr(r.addrProc, "dnsforward: closing retired address processor: %s")
+	}
+}
+
+// closeProxyUpstreams closes the upstream configurations of p, which may be
+// nil.  It's used for the proxies that aren't started, since shutting them down
+// doesn't close those.
+func closeProxyUpstreams(p *proxy.Proxy) {
+	if p == nil {
+		return
+	}
+
+	for _, uc := range proxyUpstreams(p) {
+		logCloserErr(uc, "dnsforward: closing upstreams: %s")
+	}
+}
+
+// proxyUpstreams returns the non-nil upstream configurations of p.
+func proxyUpstreams(p *proxy.Proxy) (ucs []*proxy.UpstreamConfig) {
+	for _, uc := range []*proxy.UpstreamConfig{
+		p.UpstreamConfig,
+		p.PrivateRDNSUpstreamConfig,
+		p.Fallbacks,
+	} {
+		if uc != nil {
+			ucs = append(ucs, uc)
+		}
+	}
+
+	return ucs
+}
+
+// Reload applies conf to the running DNS server the same way
+// [Server.Reconfigure] does, but keeps serving on the listeners, so that no
+// requests are dropped.  If conf changes the settings of the listeners, such as
+// the addresses or the rate limiting, the listeners are replaced after the
+// requests being processed are answered or ctx is done.  If s isn't running,
+// Reload is the same as [Server.Reconfigure].  conf must not be nil.
+func (s *Server) Reload(ctx context.Context, conf *ServerConfig) (err error) {
+	listening, retired, err := s.reloadLocked(conf)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if retired == nil {
+		return nil
+	}
+
+	log.Info("dnsforward: reloading: listeners changed, restarting them")
+
+	err = s.Drain(ctx)
+	if err != nil {
+		log.Info("dnsforward: warning: reloading: %s", err)
+	}
+
+	s.serverLock.Lock()
+	defer s.serverLock.Unlock()
+
+	if s.listeningProxy != listening {
+		// The server has been reconfigured or stopped in the meantime, which
+		// has closed the listeners.
+		retired.close()
+
+		return nil
+	}
+
+	err = listening.Shutdown(context.Background())
+	if err != nil {
+		log.Error("dnsforward: closing previous listeners: %s", err)
+	}
+
+	s.listeningProxy = nil
+	retired.close()
+
+	// See the comment in [Server.reconfigureLocked].
+	time.Sleep(100 * time.Millisecond)
+
+	err = s.startLocked()
+	if err != nil {
+		s.isRunning = false
+
+		return fmt.Errorf("could not reload the server: %w", err)
+	}
+
+	return nil
+}
+
+// reloadLocked prepares s using conf while the current listeners keep serving
+// and returns them.  If retired isn't nil, the listeners must be replaced and
+// retired closed after that.  Otherwise, the replaced state is closed after
+// [retiredCloseDelay].  It locks s.serverLock.
+func (s *Server) reloadLocked(
+	conf *ServerConfig,
+) (listening *proxy.Proxy, retired *retiredState, err error) {
+	s.serverLock.Lock()
+	defer s.serverLock.Unlock()
+
+	if !s.isRunning {
+		return nil, nil, s.reconfigureLocked(conf)
+	}
+
+	log.Info("dnsforward: reloading server")
+
+	listening = s.listeningProxy
+	if listening == nil {
+		listening = s.dnsProxy
+	}
+
+	retired = s.retireLocked(listening)
+
+	err = s.Prepare(conf)
+	if err != nil {
+		// Prepare has partially replaced the state, so stop serving.
+		s.stopLocked()
+		retired.close()
+
+		return nil, nil, fmt.Errorf("could not reload the server: %w", err)
+	}
+
+	s.listeningProxy = listening
+	if !sameListeners(&listening.Config, &s.dnsProxy.Config) {
+		return listening, retired, nil
+	}
+
+	s.restoreCacheLocked()
+	s.startWarmUpLocked()
+	s.healthChecker.start()
+
+	time.AfterFunc(retiredCloseDelay, retired.close)
+
+	log.Info("dnsforward: reloaded server keeping listeners")
+
+	return listening, nil, nil
+}
+
+// retireLocked detaches the state, which [Server.Prepare] replaces, from s and
+// returns it.  listening becomes the proxy of s until it's prepared again.
+// s.serverLock is expected to be locked.
+func (s *Server) retireLocked(listening *proxy.Proxy) (r *retiredState) {
+	r = &retiredState{
+		addrProc:        s.addrProc,
+		bootResolvers:   s.bootResolvers,
+		reverseZones:    s.reverseZones,
+		forwardingRules: s.forwardingRules,
+	}
+
+	if s.dnsProxy != listening {
+		r.upstreams = proxyUpstreams(s.dnsProxy)
+	}
+
+	s.healthChecker.shutdown()
+
+	s.addrProc = nil
+	s.bootResolvers = nil
+	s.reverseZones = nil
+	s.forwardingRules = nil
+	s.healthChecker = nil
+	s.dnsProxy = listening
+	s.listeningProxy = nil
+
+	return r
+}
+
+// sameListeners returns true if the listeners of the proxy with conf a serve
+// the same way as the ones of the proxy with conf b.  Both must be prepared by
+// [Server.newProxyConfig].
+func sameListeners(a, b *proxy.Config) (ok bool) {
+	return sameAddrs(a.UDPListenAddr, b.UDPListenAddr) &&
+		sameAddrs(a.TCPListenAddr, b.TCPListenAddr) &&
+		sameAddrs(a.TLSListenAddr, b.TLSListenAddr) &&
+		sameAddrs(a.HTTPSListenAddr, b.HTTPSListenAddr) &&
+		sameAddrs(a.QUICListenAddr, b.QUICListenAddr) &&
+		sameAddrs(a.DNSCryptUDPListenAddr, b.DNSCryptUDPListenAddr) &&
+		sameAddrs(a.DNSCryptTCPListenAddr, b.DNSCryptTCPListenAddr) &&
+		sameTLS(a, b) &&
+		a.DNSCryptProviderName == b.DNSCryptProviderName &&
+		reflect.DeepEqual(a.DNSCryptResolverCert, b.DNSCryptResolverCert) &&
+		a.HTTP3 == b.HTTP3 &&
+		a.Ratelimit == b.Ratelimit &&
+		a.RatelimitSubnetLenIPv4 == b.RatelimitSubnetLenIPv4 &&
+		a.RatelimitSubnetLenIPv6 == b.RatelimitSubnetLenIPv6 &&
+		slices.Equal(a.RatelimitWhitelist, b.RatelimitWhitelist) &&
+		a.RefuseAny == b.RefuseAny &&
+		reflect.DeepEqual(a.TrustedProxies, b.TrustedProxies) &&
+		a.MaxGoroutines == b.MaxGoroutines &&
+		a.UDPBufferSize == b.UDPBufferSize
+}
+
+// sameAddrs returns true if a and b contain the same addresses in the same
+// order.
+func sameAddrs[A net.Addr](a, b []A) (ok bool) {
+	return slices.EqualFunc(a, b, func(x, y A) (eq bool) {
+		return x.String() == y.String()
+	})
+}
+
+// sameTLS returns true if the TLS settings of the listeners of the proxies with
+// confs a and b are the same.  The certificates aren't compared, since the
+// listeners get them from the server each time, see
+// [Server.onGetCertificate].
+func sameTLS(a, b *proxy.Config) (ok bool) {
+	if a.TLSConfig == nil || b.TLSConfig == nil {
+		return a.TLSConfig == b.TLSConfig
+	}
+
+	return slices.Equal(a.TLSConfig.CipherSuites, b.TLSConfig.CipherSuites)
+}
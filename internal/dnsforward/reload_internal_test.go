@@ -0,0 +1,102 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAnswerUpstream returns the address of a local upstream answering the
+// A requests with ip.
+func newTestAnswerUpstream(t *testing.T, ip netip.Addr) (addr netip.AddrPort) {
+	t.Helper()
+
+	return newLocalUpstreamListener(t, 0, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := (&dns.Msg{}).SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   req.Question[0].Name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    60,
+			},
+			A: ip.AsSlice(),
+		})
+
+		require.NoError(testutil.PanicT{}, w.WriteMsg(resp))
+	}))
+}
+
+// newTestReloadConfig returns a new *ServerConfig for tests of
+// [Server.Reload].
+func newTestReloadConfig(upsAddr netip.AddrPort, refuseAny bool) (conf *ServerConfig) {
+	return &ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		Config: Config{
+			UpstreamDNS:      []string{"tcp://" + upsAddr.String()},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			RefuseAny:        refuseAny,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+		},
+		ServePlainDNS: true,
+	}
+}
+
+func TestServer_Reload(t *testing.T) {
+	const host = "reload.example."
+
+	firstIP := netip.MustParseAddr("192.0.2.1")
+	secondIP := netip.MustParseAddr("192.0.2.2")
+
+	firstUps := newTestAnswerUpstream(t, firstIP)
+	secondUps := newTestAnswerUpstream(t, secondIP)
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, *newTestReloadConfig(firstUps, false))
+	startDeferStop(t, s)
+
+	listening := s.dnsProxy
+	addr := listening.Addr(proxy.ProtoUDP).String()
+
+	reply, err := dns.Exchange(createTestMessage(host), addr)
+	require.NoError(t, err)
+
+	assertResponse(t, reply, firstIP)
+
+	t.Run("keep_listeners", func(t *testing.T) {
+		err = s.Reload(testutil.ContextWithTimeout(t, testTimeout), newTestReloadConfig(secondUps, false))
+		require.NoError(t, err)
+
+		assert.Same(t, listening, s.listeningProxy)
+		assert.NotSame(t, listening, s.dnsProxy)
+
+		reply, err = dns.Exchange(createTestMessage(host), addr)
+		require.NoError(t, err)
+
+		assertResponse(t, reply, secondIP)
+	})
+
+	t.Run("replace_listeners", func(t *testing.T) {
+		err = s.Reload(testutil.ContextWithTimeout(t, testTimeout), newTestReloadConfig(firstUps, true))
+		require.NoError(t, err)
+
+		assert.Nil(t, s.listeningProxy)
+
+		newAddr := s.dnsProxy.Addr(proxy.ProtoUDP)
+		require.NotNil(t, newAddr)
+
+		reply, err = dns.Exchange(createTestMessage(host), newAddr.String())
+		require.NoError(t, err)
+
+		assertResponse(t, reply, firstIP)
+	})
+}
@@ -0,0 +1,144 @@
+package dnsforward
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// reverseZone is a reverse DNS zone delegated to the local DNS servers.
+type reverseZone struct {
+	// conf is the upstream configuration for the zone.  It has no cache.
+	conf *proxy.CustomUpstreamConfig
+
+	// fqdn is the lowercased fully-qualified domain name of the zone.
+	fqdn string
+}
+
+// newReverseZones returns the reverse zones prepared from confs.  The zones
+// are sorted so that the most specific ones come first.
+func newReverseZones(
+	confs []*ReverseZoneConfig,
+	opts *upstream.Options,
+) (zones []*reverseZone, err error) {
+	for i, c := range confs {
+		var z *reverseZone
+		z, err = newReverseZone(c, opts)
+		if err != nil {
+			closeReverseZones(zones)
+
+			return nil, fmt.Errorf("reverse zone at index %d: %w", i, err)
+		}
+
+		zones = append(zones, z)
+	}
+
+	slices.SortStableFunc(zones, func(a, b *reverseZone) (res int) {
+		return cmp.Compare(len(b.fqdn), len(a.fqdn))
+	})
+
+	return zones, nil
+}
+
+// newReverseZone validates c and returns the reverse zone prepared from it.
+func newReverseZone(c *ReverseZoneConfig, opts *upstream.Options) (z *reverseZone, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	zone, err := aghnet.ParseDomainName(c.Zone)
+	if err != nil {
+		return nil, fmt.Errorf("zone: %w", err)
+	}
+
+	_, err = netutil.PrefixFromReversedAddr(zone)
+	if err != nil {
+		return nil, fmt.Errorf("zone: %w", err)
+	}
+
+	addrs := stringutil.FilterOut(c.Upstreams, IsCommentOrEmpty)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("zone %q: upstreams: %w", zone, errors.ErrEmptyValue)
+	}
+
+	opts = opts.Clone()
+	opts.Timeout = cmp.Or(c.Timeout.Duration, opts.Timeout, defaultLocalTimeout)
+
+	uc, err := proxy.ParseUpstreamsConfig(addrs, opts)
+	if err != nil {
+		return nil, fmt.Errorf("zone %q: upstreams: %w", zone, err)
+	}
+
+	return &reverseZone{
+		conf: proxy.NewCustomUpstreamConfig(uc, false, 0, false),
+		fqdn: dns.Fqdn(zone),
+	}, nil
+}
+
+// closeReverseZones closes the upstreams of zones and logs the errors, if any.
+func closeReverseZones(zones []*reverseZone) {
+	for _, z := range zones {
+		logCloserErr(z.conf, "dnsforward: closing upstreams of reverse zone %q: %s", z.fqdn)
+	}
+}
+
+// reverseZoneFor returns the most specific reverse zone containing name or nil
+// if there is none.  name must be a fully-qualified domain name.
+// s.serverLock is expected to be locked.
+func (s *Server) reverseZoneFor(name string) (z *reverseZone) {
+	name = strings.ToLower(name)
+	for _, z = range s.reverseZones {
+		if name == z.fqdn || netutil.IsSubdomain(name, z.fqdn) {
+			return z
+		}
+	}
+
+	return nil
+}
+
+// setReverseZoneUpstream routes the request of a private client to the
+// upstreams of a reverse zone, if the requested name is within one.  It must be
+// called after [Server.setCustomUpstream] and [Server.setForwardingUpstream],
+// since the zone has higher priority.
+func (s *Server) setReverseZoneUpstream(pctx *proxy.DNSContext) {
+	if !pctx.IsPrivateClient {
+		return
+	}
+
+	// Lock the server, since the zones are replaced on reconfiguration.
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	s.setReverseZoneUpstreamLocked(pctx)
+}
+
+// setReverseZoneUpstreamLocked routes the request to the upstreams of a reverse
+// zone, if the requested name is within one, and returns true if it did.  It's
+// also used for the internal rDNS requests, see [Server.Exchange].
+// s.serverLock is expected to be locked.
+func (s *Server) setReverseZoneUpstreamLocked(pctx *proxy.DNSContext) (ok bool) {
+	z := s.reverseZoneFor(pctx.Req.Question[0].Name)
+	if z == nil {
+		return false
+	}
+
+	log.Debug("dnsforward: using upstreams of reverse zone %q", z.fqdn)
+
+	pctx.CustomUpstreamConfig = z.conf
+
+	// Make sure the private rDNS upstreams aren't used instead.
+	pctx.RequestedPrivateRDNS = netip.Prefix{}
+
+	return true
+}
@@ -0,0 +1,205 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReverseZones(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*ReverseZoneConfig
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*ReverseZoneConfig{{
+			Zone:      "10.in-addr.arpa",
+			Upstreams: []string{"127.0.0.1:53"},
+		}, {
+			Zone:      "D.F.ip6.arpa.",
+			Upstreams: []string{"# comment", "[::1]:53"},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "reverse zone at index 0: no value",
+		confs:      []*ReverseZoneConfig{nil},
+	}, {
+		name:       "empty_zone",
+		wantErrMsg: `reverse zone at index 0: zone: bad domain name "": empty value`,
+		confs: []*ReverseZoneConfig{{
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name: "bad_zone",
+		wantErrMsg: `reverse zone at index 0: zone: bad arpa domain name "example.org": ` +
+			`not a reversed ip network`,
+		confs: []*ReverseZoneConfig{{
+			Zone:      "example.org",
+			Upstreams: []string{"127.0.0.1:53"},
+		}},
+	}, {
+		name:       "no_upstreams",
+		wantErrMsg: `reverse zone at index 1: zone "10.in-addr.arpa": upstreams: empty value`,
+		confs: []*ReverseZoneConfig{{
+			Zone:      "168.192.in-addr.arpa",
+			Upstreams: []string{"127.0.0.1:53"},
+		}, {
+			Zone:      "10.in-addr.arpa",
+			Upstreams: []string{"# comment"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zones, err := newReverseZones(tc.confs, &upstream.Options{})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			t.Cleanup(func() { closeReverseZones(zones) })
+		})
+	}
+}
+
+func TestServer_ReverseZoneFor(t *testing.T) {
+	zones, err := newReverseZones([]*ReverseZoneConfig{{
+		Zone:      "10.in-addr.arpa",
+		Upstreams: []string{"127.0.0.1:53"},
+	}, {
+		Zone:      "1.10.in-addr.arpa",
+		Upstreams: []string{"127.0.0.2:53"},
+	}}, &upstream.Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { closeReverseZones(zones) })
+
+	s := &Server{
+		reverseZones: zones,
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		wantFQDN string
+	}{{
+		name:     "zone",
+		host:     "10.in-addr.arpa.",
+		wantFQDN: "10.in-addr.arpa.",
+	}, {
+		name:     "subdomain",
+		host:     "4.3.2.10.in-addr.arpa.",
+		wantFQDN: "10.in-addr.arpa.",
+	}, {
+		name:     "more_specific",
+		host:     "4.3.1.10.IN-ADDR.ARPA.",
+		wantFQDN: "1.10.in-addr.arpa.",
+	}, {
+		name:     "none",
+		host:     "4.3.2.192.in-addr.arpa.",
+		wantFQDN: "",
+	}, {
+		name:     "partial_label",
+		host:     "110.in-addr.arpa.",
+		wantFQDN: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			z := s.reverseZoneFor(tc.host)
+			if tc.wantFQDN == "" {
+				assert.Nil(t, z)
+			} else {
+				require.NotNil(t, z)
+				assert.Equal(t, tc.wantFQDN, z.fqdn)
+			}
+		})
+	}
+}
+
+// newTestPTRUpstream returns the address of a local upstream answering the PTR
+// requests with host.
+func newTestPTRUpstream(t *testing.T, host string) (addr string) {
+	t.Helper()
+
+	return aghtest.StartLocalhostUpstream(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := (&dns.Msg{}).SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   req.Question[0].Name,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    60,
+			},
+			Ptr: dns.Fqdn(host),
+		})
+
+		require.NoError(testutil.PanicT{}, w.WriteMsg(resp))
+	})).String()
+}
+
+func TestServer_Exchange_reverseZones(t *testing.T) {
+	const (
+		privateHost = "private.example"
+		zoneHost    = "zone.example"
+		publicHost  = "public.example"
+	)
+
+	srv := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		Config: Config{
+			UpstreamDNS:      []string{newTestPTRUpstream(t, publicHost)},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			ReverseZones: []*ReverseZoneConfig{{
+				Zone:      "1.168.192.in-addr.arpa",
+				Upstreams: []string{newTestPTRUpstream(t, zoneHost)},
+			}},
+		},
+		LocalPTRResolvers: []string{newTestPTRUpstream(t, privateHost)},
+		UsePrivateRDNS:    true,
+		ServePlainDNS:     true,
+	})
+
+	testCases := []struct {
+		ip   netip.Addr
+		name string
+		want string
+	}{{
+		ip:   netip.MustParseAddr("192.168.1.1"),
+		name: "zone",
+		want: zoneHost,
+	}, {
+		ip:   netip.MustParseAddr("192.168.2.1"),
+		name: "private",
+		want: privateHost,
+	}, {
+		ip:   netip.MustParseAddr("1.1.1.1"),
+		name: "public",
+		want: publicHost,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			host, _, err := srv.Exchange(tc.ip)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, host)
+		})
+	}
+
+	t.Run("private_rdns_disabled", func(t *testing.T) {
+		srv.conf.UsePrivateRDNS = false
+		t.Cleanup(func() { srv.conf.UsePrivateRDNS = true })
+
+		host, _, err := srv.Exchange(netip.MustParseAddr("192.168.1.1"))
+		require.NoError(t, err)
+
+		assert.Equal(t, zoneHost, host)
+	})
+}
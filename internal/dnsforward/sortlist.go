@@ -0,0 +1,156 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// sortlistRule is a validated [SortlistRule].
+type sortlistRule struct {
+	// subnets are the subnets of the matching clients.  If empty, all clients
+	// match.
+	subnets []netip.Prefix
+
+	// prefer are the subnets of the preferred addresses, the most preferred
+	// first.
+	prefer []netip.Prefix
+}
+
+// newSortlist returns the rules prepared from confs.
+func newSortlist(confs []*SortlistRule) (rules []*sortlistRule, err error) {
+	for i, c := range confs {
+		var r *sortlistRule
+		r, err = newSortlistRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("sortlist rule at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newSortlistRule validates c and returns the rule prepared from it.
+func newSortlistRule(c *SortlistRule) (r *sortlistRule, err error) {
+	if c == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	r = &sortlistRule{}
+	for i, subnet := range c.ClientSubnets {
+		if !subnet.IsValid() {
+			return nil, fmt.Errorf("client_subnets: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+
+		r.subnets = append(r.subnets, subnet.Masked())
+	}
+
+	if len(c.Prefer) == 0 {
+		return nil, fmt.Errorf("prefer: %w", errors.ErrEmptyValue)
+	}
+
+	for i, subnet := range c.Prefer {
+		if !subnet.IsValid() {
+			return nil, fmt.Errorf("prefer: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+
+		r.prefer = append(r.prefer, subnet.Masked())
+	}
+
+	return r, nil
+}
+
+// matches returns true if the request from the client with addr matches r.
+func (r *sortlistRule) matches(addr netip.Addr) (ok bool) {
+	return len(r.subnets) == 0 || slices.ContainsFunc(r.subnets, func(p netip.Prefix) (c bool) {
+		return p.Contains(addr)
+	})
+}
+
+// rank returns the preference of ip, the less the more preferred.  The
+// addresses not within any of the preferred subnets have the greatest rank.
+func (r *sortlistRule) rank(ip netip.Addr) (rank int) {
+	rank = slices.IndexFunc(r.prefer, func(p netip.Prefix) (c bool) {
+		return p.Contains(ip)
+	})
+	if rank < 0 {
+		return len(r.prefer)
+	}
+
+	return rank
+}
+
+// sort reorders the A and AAAA records of answers in accordance with the
+// preferences of r.  The records of the other types keep their positions, and
+// the records with the same rank keep their relative order.
+func (r *sortlistRule) sort(answers []dns.RR) {
+	var idxs []int
+	var addrRRs []dns.RR
+	for i, rr := range answers {
+		switch rr.(type) {
+		case *dns.A, *dns.AAAA:
+			idxs = append(idxs, i)
+			addrRRs = append(addrRRs, rr)
+		default:
+			// Go on.
+		}
+	}
+
+	if len(addrRRs) < 2 {
+		return
+	}
+
+	slices.SortStableFunc(addrRRs, func(a, b dns.RR) (res int) {
+		return r.rank(rrAddr(a)) - r.rank(rrAddr(b))
+	})
+
+	for i, idx := range idxs {
+		answers[idx] = addrRRs[i]
+	}
+}
+
+// rrAddr returns the address from rr, which must be either an A or an AAAA
+// record, or an invalid address if it's malformed.
+func rrAddr(rr dns.RR) (addr netip.Addr) {
+	var err error
+	switch rr := rr.(type) {
+	case *dns.A:
+		addr, err = netutil.IPToAddr(rr.A, netutil.AddrFamilyIPv4)
+	case *dns.AAAA:
+		addr, err = netutil.IPToAddr(rr.AAAA, netutil.AddrFamilyIPv6)
+	}
+
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addr
+}
+
+// processSortlist reorders the addresses in the response in accordance with
+// the first sortlist rule matching the client, if any.
+func (s *Server) processSortlist(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	if len(s.sortlist) == 0 || pctx.Res == nil || len(pctx.Res.Answer) < 2 {
+		return resultCodeSuccess
+	}
+
+	addr := pctx.Addr.Addr().Unmap()
+	for _, r := range s.sortlist {
+		if r.matches(addr) {
+			log.Debug("dnsforward: sorting addresses for %s", addr)
+			r.sort(pctx.Res.Answer)
+
+			break
+		}
+	}
+
+	return resultCodeSuccess
+}
@@ -0,0 +1,137 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSortlist(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*SortlistRule
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*SortlistRule{{
+			ClientSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.1/24")},
+			Prefer:        []netip.Prefix{netip.MustParsePrefix("2001:db8::/32")},
+		}, {
+			Prefer: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "sortlist rule at index 0: no value",
+		confs:      []*SortlistRule{nil},
+	}, {
+		name:       "no_prefer",
+		wantErrMsg: "sortlist rule at index 0: prefer: empty value",
+		confs: []*SortlistRule{{
+			ClientSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.1/24")},
+		}},
+	}, {
+		name:       "bad_subnet",
+		wantErrMsg: "sortlist rule at index 0: client_subnets: at index 0: empty value",
+		confs: []*SortlistRule{{
+			ClientSubnets: []netip.Prefix{{}},
+			Prefer:        []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		}},
+	}, {
+		name:       "bad_prefer",
+		wantErrMsg: "sortlist rule at index 1: prefer: at index 0: empty value",
+		confs: []*SortlistRule{{
+			Prefer: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		}, {
+			Prefer: []netip.Prefix{{}},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newSortlist(tc.confs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestServer_processSortlist(t *testing.T) {
+	const name = "host.example."
+
+	rules, err := newSortlist([]*SortlistRule{{
+		ClientSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		Prefer: []netip.Prefix{
+			netip.MustParsePrefix("192.0.2.0/24"),
+			netip.MustParsePrefix("198.51.100.0/24"),
+		},
+	}})
+	require.NoError(t, err)
+
+	s := &Server{
+		sortlist: rules,
+	}
+
+	var (
+		ipOther    = net.IP{203, 0, 113, 1}
+		ipSecond   = net.IP{198, 51, 100, 1}
+		ipFirst    = net.IP{192, 0, 2, 1}
+		ipFirstToo = net.IP{192, 0, 2, 2}
+	)
+
+	newResp := func(t *testing.T) (resp *dns.Msg) {
+		t.Helper()
+
+		return &dns.Msg{
+			Answer: []dns.RR{
+				newRR(t, name, dns.TypeCNAME, 60, "cname.example."),
+				newRR(t, name, dns.TypeA, 60, ipOther),
+				newRR(t, name, dns.TypeA, 60, ipFirst),
+				newRR(t, name, dns.TypeA, 60, ipSecond),
+				newRR(t, name, dns.TypeA, 60, ipFirstToo),
+			},
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		addr    netip.Addr
+		wantIPs []net.IP
+	}{{
+		name:    "matching",
+		addr:    netip.MustParseAddr("192.168.1.2"),
+		wantIPs: []net.IP{ipFirst, ipFirstToo, ipSecond, ipOther},
+	}, {
+		name:    "mapped",
+		addr:    netip.MustParseAddr("::ffff:192.168.1.2"),
+		wantIPs: []net.IP{ipFirst, ipFirstToo, ipSecond, ipOther},
+	}, {
+		name:    "not_matching",
+		addr:    netip.MustParseAddr("10.0.0.1"),
+		wantIPs: []net.IP{ipOther, ipFirst, ipSecond, ipFirstToo},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Addr: netip.AddrPortFrom(tc.addr, 12345),
+				Res:  newResp(t),
+			}
+
+			rc := s.processSortlist(&dnsContext{proxyCtx: pctx})
+			require.Equal(t, resultCodeSuccess, rc)
+			require.Len(t, pctx.Res.Answer, len(tc.wantIPs)+1)
+
+			assert.IsType(t, (*dns.CNAME)(nil), pctx.Res.Answer[0])
+			for i, rr := range pctx.Res.Answer[1:] {
+				a := testutil.RequireTypeAssert[*dns.A](t, rr)
+				assert.Equal(t, tc.wantIPs[i], a.A)
+			}
+		})
+	}
+}
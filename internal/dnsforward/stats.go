@@ -56,6 +56,10 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 		)
 	}
 
+	if pctx.Res != nil {
+		s.recordRolloutResponse(dctx, pctx.Res.Rcode)
+	}
+
 	if s.shouldCountStat(host, qt, cl, ids) {
 		s.updateStats(dctx, ipStr, processingTime)
 	} else {
@@ -71,6 +75,14 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 	return resultCodeSuccess
 }
 
+// recordRolloutResponse reports the response with rcode to the client of dctx
+// as a breakage signal of the staged rollout of the filter list updates.
+func (s *Server) recordRolloutResponse(dctx *dnsContext, rcode int) {
+	if dctx.setts != nil && s.dnsFilter != nil {
+		s.dnsFilter.RecordResponse(dctx.setts, rcode)
+	}
+}
+
 // shouldLog returns true if the query with the given data should be logged in
 // the query log.  s.serverLock is expected to be locked.
 func (s *Server) shouldLog(host string, qt, cl uint16, ids []string) (ok bool) {
@@ -122,6 +134,7 @@ func (s *Server) logQuery(dctx *dnsContext, ip net.IP, processingTime time.Durat
 
 	if pctx.Upstream != nil {
 		p.Upstream = pctx.Upstream.Address()
+		p.UpstreamFallback = isFallback(pctx.Upstream)
 	} else if cachedUps := pctx.CachedUpstreamAddr; cachedUps != "" {
 		p.Upstream = pctx.CachedUpstreamAddr
 		p.Cached = true
@@ -158,10 +171,15 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		e.Result = stats.RParental
 	case filtering.FilteredSafeSearch:
 		e.Result = stats.RSafeSearch
+	case filtering.FilteredRebinding:
+		e.Result = stats.RRebinding
 	case
 		filtering.FilteredBlockList,
 		filtering.FilteredInvalid,
-		filtering.FilteredBlockedService:
+		filtering.FilteredBlockedService,
+		filtering.FilteredPaused,
+		filtering.FilteredQUIC,
+		filtering.FilteredAnswerIP:
 		e.Result = stats.RFiltered
 	}
 
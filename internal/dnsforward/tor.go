@@ -0,0 +1,285 @@
+package dnsforward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	netproxy "golang.org/x/net/proxy"
+)
+
+// TorConfig is the configuration of the local Tor SOCKS proxy used by the
+// conditional forwarding rules with [ForwardingRule.ViaTor] set.
+type TorConfig struct {
+	// SOCKSAddress is the address of the SOCKS5 proxy of the Tor client, for
+	// example "127.0.0.1:9050".  It must not be empty.
+	SOCKSAddress string `yaml:"socks_address"`
+
+	// Timeout is the timeout of a single exchange with an upstream over Tor.
+	// If zero, [defaultTorTimeout] is used.  It's usually greater than
+	// [Config.UpstreamTimeout], since building the circuits takes time.
+	Timeout timeutil.Duration `yaml:"timeout"`
+}
+
+// defaultTorTimeout is the default timeout of a single exchange with an
+// upstream over Tor.
+const defaultTorTimeout = 30 * time.Second
+
+// onionSuffix is the suffix of the hostnames of the Tor onion services.
+const onionSuffix = ".onion"
+
+// torUpstream is an [upstream.Upstream] sending the requests over the Tor
+// SOCKS proxy either via DNS-over-HTTPS or via plain DNS over TCP, since Tor
+// doesn't carry UDP.  The hostnames of the upstreams, including the .onion
+// ones, are resolved by the proxy.
+type torUpstream struct {
+	// dialer connects to the upstreams through the proxy.
+	dialer netproxy.ContextDialer
+
+	// client is the HTTP client for the DNS-over-HTTPS upstreams.  It's nil
+	// for the TCP ones.
+	client *http.Client
+
+	// addr is the address of the upstream as written in the configuration.
+	addr string
+
+	// endpoint is the URL of the DNS-over-HTTPS upstream or the host and the
+	// port of the TCP one.
+	endpoint string
+
+	// timeout is the timeout of a single exchange.
+	timeout time.Duration
+}
+
+// type check
+var _ upstream.Upstream = (*torUpstream)(nil)
+
+// newTorUpstream returns a new upstream with addr reached through dialer.
+// Only the https:// and tcp:// upstreams are supported, as well as the
+// http:// ones for the .onion hostnames, since the onion services are
+// encrypted by Tor itself.  opts must not be nil.
+func newTorUpstream(
+	addr string,
+	dialer netproxy.ContextDialer,
+	timeout time.Duration,
+	opts *upstream.Options,
+) (u *torUpstream, err error) {
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing upstream %q: %w", addr, err)
+	} else if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("upstream %q: host: %w", addr, errors.ErrEmptyValue)
+	}
+
+	u = &torUpstream{
+		dialer:  dialer,
+		addr:    addr,
+		timeout: timeout,
+	}
+
+	isOnion := strings.HasSuffix(strings.ToLower(parsed.Hostname()), onionSuffix)
+	switch parsed.Scheme {
+	case "tcp":
+		port := parsed.Port()
+		if port == "" {
+			port = "53"
+		}
+
+		u.endpoint = net.JoinHostPort(parsed.Hostname(), port)
+	case "http":
+		if !isOnion {
+			return nil, fmt.Errorf("upstream %q: http is only allowed for onion services", addr)
+		}
+
+		fallthrough
+	case "https":
+		u.endpoint = parsed.String()
+		u.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext:       dialer.DialContext,
+				ForceAttemptHTTP2: true,
+				TLSClientConfig: &tls.Config{
+					RootCAs:      opts.RootCAs,
+					CipherSuites: opts.CipherSuites,
+					MinVersion:   tls.VersionTLS12,
+				},
+			},
+			Timeout: timeout,
+		}
+	default:
+		return nil, fmt.Errorf("upstream %q: scheme %q is not supported over tor", addr, parsed.Scheme)
+	}
+
+	return u, nil
+}
+
+// Exchange implements the [upstream.Upstream] interface for *torUpstream.
+func (u *torUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+
+	if u.client != nil {
+		return u.exchangeHTTPS(ctx, req)
+	}
+
+	return u.exchangeTCP(ctx, req)
+}
+
+// exchangeHTTPS sends req to the DNS-over-HTTPS upstream as described in RFC
+// 8484.
+func (u *torUpstream) exchangeHTTPS(ctx context.Context, req *dns.Msg) (resp *dns.Msg, err error) {
+	// Use the zero ID to make the responses cacheable, as recommended by the
+	// RFC.
+	msg := req.Copy()
+	msg.Id = 0
+
+	data, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("creating http request: %w", err)
+	}
+
+	httpReq.Header.Set("Accept", "application/dns-message")
+	httpReq.Header.Set("Content-Type", "application/dns-message")
+
+	httpResp, err := u.client.Do(httpReq)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, httpResp.Body.Close()) }()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected http status %d", httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	resp = &dns.Msg{}
+	err = resp.Unpack(body)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+
+	resp.Id = req.Id
+
+	return resp, nil
+}
+
+// exchangeTCP sends req to the plain DNS upstream over TCP.
+func (u *torUpstream) exchangeTCP(ctx context.Context, req *dns.Msg) (resp *dns.Msg, err error) {
+	conn, err := u.dialer.DialContext(ctx, "tcp", u.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", u.endpoint, err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return nil, fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	dnsConn := &dns.Conn{Conn: conn}
+	err = dnsConn.WriteMsg(req)
+	if err != nil {
+		return nil, fmt.Errorf("writing request: %w", err)
+	}
+
+	resp, err = dnsConn.ReadMsg()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	} else if resp.Id != req.Id {
+		return nil, dns.ErrId
+	}
+
+	return resp, nil
+}
+
+// Address implements the [upstream.Upstream] interface for *torUpstream.
+func (u *torUpstream) Address() (addr string) {
+	return u.addr
+}
+
+// Close implements the [upstream.Upstream] interface for *torUpstream.
+func (u *torUpstream) Close() (err error) {
+	if u.client != nil {
+		u.client.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+// newTorRuleUpstreams returns the upstream configuration of a rule with the
+// upstreams addrs reached through the Tor SOCKS proxy configured in conf.
+// addrs must not be domain-specific, since the domains are matched by the
+// rule itself.
+func newTorRuleUpstreams(
+	addrs []string,
+	conf *TorConfig,
+	opts *upstream.Options,
+	mode UpstreamMode,
+) (c *proxy.CustomUpstreamConfig, err error) {
+	if conf == nil || conf.SOCKSAddress == "" {
+		return nil, fmt.Errorf("via_tor: tor socks_address: %w", errors.ErrEmptyValue)
+	} else if len(addrs) == 0 {
+		return nil, fmt.Errorf("upstreams: %w", errors.ErrEmptyValue)
+	}
+
+	d, err := netproxy.SOCKS5("tcp", conf.SOCKSAddress, nil, netproxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("tor socks proxy: %w", err)
+	}
+
+	dialer, ok := d.(netproxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("tor socks proxy: unexpected dialer type %T", d)
+	}
+
+	timeout := conf.Timeout.Duration
+	if timeout == 0 {
+		timeout = defaultTorTimeout
+	}
+
+	uc := &proxy.UpstreamConfig{}
+	for i, addr := range addrs {
+		var u *torUpstream
+		u, err = newTorUpstream(addr, dialer, timeout, opts)
+		if err != nil {
+			logCloserErr(uc, "dnsforward: closing tor upstreams: %s")
+
+			return nil, fmt.Errorf("upstreams: at index %d: %w", i, err)
+		}
+
+		uc.Upstreams = append(uc.Upstreams, u)
+	}
+
+	err = ApplyUpstreamMode(uc, mode, 0)
+	if err != nil {
+		logCloserErr(uc, "dnsforward: closing tor upstreams: %s")
+
+		return nil, fmt.Errorf("upstream_mode: %w", err)
+	}
+
+	return proxy.NewCustomUpstreamConfig(uc, false, 0, false), nil
+}
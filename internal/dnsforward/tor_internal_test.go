@@ -0,0 +1,203 @@
+package dnsforward
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDialer is a [netproxy.ContextDialer] connecting to the fixed address
+// instead of the requested one and recording the latter.
+type testDialer struct {
+	dialed chan string
+	target string
+}
+
+// DialContext implements the [netproxy.ContextDialer] interface for
+// *testDialer.
+func (d *testDialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	d.dialed <- addr
+
+	return (&net.Dialer{}).DialContext(ctx, network, d.target)
+}
+
+// newTestTorReq returns a new A request for the hostname used in the Tor
+// tests.
+func newTestTorReq() (req *dns.Msg) {
+	req = (&dns.Msg{}).SetQuestion("example.onion.", dns.TypeA)
+	req.Id = 1234
+
+	return req
+}
+
+// newTestTorResp returns the response to req used in the Tor tests.
+func newTestTorResp(req *dns.Msg) (resp *dns.Msg) {
+	resp = (&dns.Msg{}).SetReply(req)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   net.IP{192, 0, 2, 1},
+	}}
+
+	return resp
+}
+
+func TestNewTorUpstream(t *testing.T) {
+	d := &testDialer{}
+
+	testCases := []struct {
+		name       string
+		addr       string
+		wantErrMsg string
+	}{{
+		name:       "https",
+		addr:       "https://dns.example/dns-query",
+		wantErrMsg: "",
+	}, {
+		name:       "http_onion",
+		addr:       "http://abcdef.onion/dns-query",
+		wantErrMsg: "",
+	}, {
+		name:       "tcp",
+		addr:       "tcp://192.0.2.1",
+		wantErrMsg: "",
+	}, {
+		name:       "http",
+		addr:       "http://dns.example/dns-query",
+		wantErrMsg: `upstream "http://dns.example/dns-query": http is only allowed for onion services`,
+	}, {
+		name:       "udp",
+		addr:       "udp://192.0.2.1:53",
+		wantErrMsg: `upstream "udp://192.0.2.1:53": scheme "udp" is not supported over tor`,
+	}, {
+		name:       "no_host",
+		addr:       "https:///dns-query",
+		wantErrMsg: `upstream "https:///dns-query": host: empty value`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := newTorUpstream(tc.addr, d, time.Second, &upstream.Options{})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if err == nil {
+				assert.Equal(t, tc.addr, u.Address())
+			}
+		})
+	}
+
+	t.Run("tcp_port", func(t *testing.T) {
+		u, err := newTorUpstream("tcp://192.0.2.1", d, time.Second, &upstream.Options{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "192.0.2.1:53", u.endpoint)
+	})
+}
+
+func TestTorUpstream_Exchange(t *testing.T) {
+	t.Run("https", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(testutil.PanicT{}, err)
+
+			req := &dns.Msg{}
+			require.NoError(testutil.PanicT{}, req.Unpack(body))
+			assert.Zero(testutil.PanicT{}, req.Id)
+
+			data, err := newTestTorResp(req).Pack()
+			require.NoError(testutil.PanicT{}, err)
+
+			w.Header().Set("Content-Type", "application/dns-message")
+			_, _ = w.Write(data)
+		}))
+		t.Cleanup(srv.Close)
+
+		d := &testDialer{
+			dialed: make(chan string, 1),
+			target: srv.Listener.Addr().String(),
+		}
+
+		u, err := newTorUpstream("http://abcdef.onion/dns-query", d, time.Second, &upstream.Options{})
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, u.Close)
+
+		req := newTestTorReq()
+		resp, err := u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, req.Id, resp.Id)
+		assert.Len(t, resp.Answer, 1)
+		assert.Equal(t, "abcdef.onion:80", <-d.dialed)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, l.Close)
+
+		go func() {
+			conn, lErr := l.Accept()
+			if lErr != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			dnsConn := &dns.Conn{Conn: conn}
+			req, lErr := dnsConn.ReadMsg()
+			if lErr != nil {
+				return
+			}
+
+			_ = dnsConn.WriteMsg(newTestTorResp(req))
+		}()
+
+		d := &testDialer{
+			dialed: make(chan string, 1),
+			target: l.Addr().String(),
+		}
+
+		u, err := newTorUpstream("tcp://dns.example", d, time.Second, &upstream.Options{})
+		require.NoError(t, err)
+
+		req := newTestTorReq()
+		resp, err := u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, req.Id, resp.Id)
+		assert.Len(t, resp.Answer, 1)
+		assert.Equal(t, "dns.example:53", <-d.dialed)
+	})
+}
+
+func TestNewForwardingRules_viaTor(t *testing.T) {
+	confs := []*ForwardingRule{{
+		Domains:   []string{"onion"},
+		Upstreams: []string{"http://abcdef.onion/dns-query"},
+		ViaTor:    true,
+	}}
+
+	_, err := newForwardingRules(confs, &upstream.Options{}, nil)
+	testutil.AssertErrorMsg(
+		t,
+		"conditional forwarding at index 0: via_tor: tor socks_address: empty value",
+		err,
+	)
+
+	rules, err := newForwardingRules(confs, &upstream.Options{}, &TorConfig{
+		SOCKSAddress: "127.0.0.1:9050",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { closeForwardingRules(rules) })
+
+	require.Len(t, rules, 1)
+
+	assert.NotNil(t, rules[0].conf)
+}
@@ -0,0 +1,73 @@
+package dnsforward
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// unfilteredDoHPathElem is the first element of the URL path of the
+// troubleshooting DNS-over-HTTPS endpoint.  See [UnfilteredDoHConfig].
+const unfilteredDoHPathElem = "dns-query-unfiltered"
+
+// isUnfilteredRequest returns true if pctx is a DNS-over-HTTPS request to the
+// troubleshooting endpoint, which must not be filtered.
+func isUnfilteredRequest(pctx *proxy.DNSContext) (ok bool) {
+	if pctx.Proto != proxy.ProtoHTTPS || pctx.HTTPRequest == nil {
+		return false
+	}
+
+	p := strings.TrimPrefix(path.Clean(pctx.HTTPRequest.URL.Path), "/")
+	elem, _, _ := strings.Cut(p, "/")
+
+	return elem == unfilteredDoHPathElem
+}
+
+// disableFiltering turns off all the filtering features in setts.
+func disableFiltering(setts *filtering.Settings) {
+	setts.ProtectionEnabled = false
+	setts.FilteringEnabled = false
+	setts.SafeSearchEnabled = false
+	setts.SafeBrowsingEnabled = false
+	setts.ParentalEnabled = false
+	setts.ServicesRules = nil
+}
+
+// handleUnfilteredDoH is the handler for the troubleshooting DNS-over-HTTPS
+// endpoint.  It behaves like [Server.handleDoH], but additionally checks the
+// authentication, if configured, and refuses requests when the endpoint is
+// disabled.
+func (s *Server) handleUnfilteredDoH(w http.ResponseWriter, r *http.Request) {
+	conf := s.unfilteredDoHConfig()
+	if !conf.Enabled {
+		aghhttp.Error(r, w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	if conf.RequireAuth && (s.conf.IsAuthenticated == nil || !s.conf.IsAuthenticated(r)) {
+		log.Debug("dnsforward: unauthenticated unfiltered doh request from %s", r.RemoteAddr)
+
+		w.Header().Set(httphdr.WWWAuthenticate, `Basic realm="AdGuard Home"`)
+		aghhttp.Error(r, w, http.StatusUnauthorized, "Unauthorized")
+
+		return
+	}
+
+	s.handleDoH(w, r)
+}
+
+// unfilteredDoHConfig returns the current configuration of the troubleshooting
+// DNS-over-HTTPS endpoint.
+func (s *Server) unfilteredDoHConfig() (conf UnfilteredDoHConfig) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	return s.conf.UnfilteredDoH
+}
@@ -0,0 +1,433 @@
+package dnsforward
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamHealthCheckConfig is the configuration of the active health checks
+// of the upstreams.  The upstreams failing the checks are excluded from the
+// selection until they pass the checks again.
+type UpstreamHealthCheckConfig struct {
+	// Domain is the domain name resolved by the probes.  If empty,
+	// [defaultHealthCheckDomain] is used.
+	Domain string `yaml:"domain"`
+
+	// Interval is the time between the probes of each upstream.  If zero, the
+	// upstreams aren't checked.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// FailureThreshold is the number of consecutive failed probes after which
+	// an upstream is marked down.  If zero, [defaultHealthFailureThreshold] is
+	// used.
+	FailureThreshold uint `yaml:"failure_threshold"`
+
+	// RecoveryThreshold is the number of consecutive successful probes after
+	// which a down upstream is marked up again.  If zero,
+	// [defaultHealthRecoveryThreshold] is used.
+	RecoveryThreshold uint `yaml:"recovery_threshold"`
+}
+
+// Default values of [UpstreamHealthCheckConfig].
+const (
+	defaultHealthCheckDomain       = "example.org"
+	defaultHealthFailureThreshold  = 3
+	defaultHealthRecoveryThreshold = 2
+)
+
+// errUpstreamDown is returned by [healthUpstream] instead of sending the
+// request to an upstream marked down.
+const errUpstreamDown errors.Error = "upstream is down"
+
+// healthUpstream is an [upstream.Upstream] that fails the requests without
+// sending them while the underlying upstream is marked down by the health
+// checks.
+type healthUpstream struct {
+	upstream.Upstream
+
+	// checker is the health checker of the upstream.
+	checker *upstreamHealthChecker
+
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// lastErr is the error of the last failed probe, if any.
+	lastErr error
+
+	// lastCheck is the time of the last probe.
+	lastCheck time.Time
+
+	// latency is the duration of the last successful probe.
+	latency time.Duration
+
+	// failures is the number of consecutive failed probes.
+	failures uint
+
+	// successes is the number of consecutive successful probes.
+	successes uint
+
+	// down is true if the upstream is excluded from the selection.
+	down bool
+}
+
+// type check
+var _ upstream.Upstream = (*healthUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *healthUpstream.
+// If all checked upstreams are down, the requests are still sent, since there
+// is nothing to fail over to.
+func (u *healthUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	if u.isDown() && !u.checker.allDown() {
+		return nil, fmt.Errorf("upstream %s: %w", u.Address(), errUpstreamDown)
+	}
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return u.Upstream.Exchange(req)
+}
+
+// isDown returns true if u is marked down.
+func (u *healthUpstream) isDown() (ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.down
+}
+
+// record updates the health of u with the result of a probe finished at now
+// and returns true if u has been marked down or up by it.
+func (u *healthUpstream) record(
+	now time.Time,
+	latency time.Duration,
+	err error,
+	failThreshold uint,
+	recoverThreshold uint,
+) (changed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastCheck = now
+	if err != nil {
+		u.lastErr = err
+		u.failures++
+		u.successes = 0
+
+		changed = !u.down && u.failures >= failThreshold
+		u.down = u.down || changed
+
+		return changed
+	}
+
+	u.lastErr = nil
+	u.latency = latency
+	u.failures = 0
+	u.successes++
+
+	changed = u.down && u.successes >= recoverThreshold
+	u.down = u.down && !changed
+
+	return changed
+}
+
+// upstreamHealthChecker probes the upstreams periodically and marks them down
+// or up according to the results.
+type upstreamHealthChecker struct {
+	// events, if not nil, receives the events about the upstreams going down
+	// and up.
+	events events.Publisher
+
+	// done is closed when the checks must stop.  It's nil if the checker isn't
+	// running.
+	done chan struct{}
+
+	// upstreams are the checked upstreams.
+	upstreams []*healthUpstream
+
+	// domain is the FQDN resolved by the probes.
+	domain string
+
+	// numDown is the number of the upstreams currently marked down.
+	numDown atomic.Int64
+
+	// interval is the time between the probes of each upstream.
+	interval time.Duration
+
+	// failThreshold is the number of consecutive failed probes marking an
+	// upstream down.
+	failThreshold uint
+
+	// recoverThreshold is the number of consecutive successful probes marking
+	// an upstream up.
+	recoverThreshold uint
+}
+
+// applyUpstreamHealthChecks validates conf and wraps the upstreams of uc with
+// the ones excluded from the selection while failing the health checks.  conf
+// may be nil, in which case uc is left as is and c is nil.  pub, if not nil,
+// receives the events about the upstreams going down and up.
+func applyUpstreamHealthChecks(
+	uc *proxy.UpstreamConfig,
+	conf *UpstreamHealthCheckConfig,
+	pub events.Publisher,
+) (c *upstreamHealthChecker, err error) {
+	if conf == nil {
+		return nil, nil
+	} else if conf.Interval.Duration < 0 {
+		return nil, fmt.Errorf("upstream health check: interval: %w", errors.ErrNegative)
+	} else if conf.Interval.Duration == 0 {
+		return nil, nil
+	}
+
+	domain := cmp.Or(conf.Domain, defaultHealthCheckDomain)
+	err = netutil.ValidateHostname(domain)
+	if err != nil {
+		return nil, fmt.Errorf("upstream health check: domain: %w", err)
+	}
+
+	c = &upstreamHealthChecker{
+		events:           pub,
+		domain:           dns.Fqdn(domain),
+		interval:         conf.Interval.Duration,
+		failThreshold:    cmp.Or(conf.FailureThreshold, defaultHealthFailureThreshold),
+		recoverThreshold: cmp.Or(conf.RecoveryThreshold, defaultHealthRecoveryThreshold),
+	}
+
+	wrapped := map[upstream.Upstream]*healthUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			h, ok := wrapped[u]
+			if !ok {
+				h = &healthUpstream{
+					Upstream: u,
+					checker:  c,
+					mu:       &sync.Mutex{},
+				}
+				wrapped[u] = h
+				c.upstreams = append(c.upstreams, h)
+			}
+
+			ups[i] = h
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+
+	return c, nil
+}
+
+// allDown returns true if all checked upstreams are marked down.
+func (c *upstreamHealthChecker) allDown() (ok bool) {
+	return c.numDown.Load() >= int64(len(c.upstreams))
+}
+
+// start starts probing the upstreams.  c may be nil.
+func (c *upstreamHealthChecker) start() {
+	if c == nil || c.done != nil {
+		return
+	}
+
+	c.done = make(chan struct{})
+	for _, u := range c.upstreams {
+		go c.run(u, c.done)
+	}
+}
+
+// shutdown stops probing the upstreams.  c may be nil.
+func (c *upstreamHealthChecker) shutdown() {
+	if c == nil || c.done == nil {
+		return
+	}
+
+	close(c.done)
+	c.done = nil
+}
+
+// run probes u each interval until done is closed.  It's intended to be used
+// as a goroutine.
+func (c *upstreamHealthChecker) run(u *healthUpstream, done <-chan struct{}) {
+	defer log.OnPanic("dnsforward: upstream health check")
+
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			c.check(u)
+		}
+	}
+}
+
+// check probes u once and updates its health.
+func (c *upstreamHealthChecker) check(u *healthUpstream) {
+	start := time.Now()
+	err := probeUpstream(u.Upstream, c.domain)
+	now := time.Now()
+
+	if !u.record(now, now.Sub(start), err, c.failThreshold, c.recoverThreshold) {
+		return
+	}
+
+	addr := u.Address()
+	if err != nil {
+		c.numDown.Add(1)
+		log.Info("dnsforward: upstream %s: marked down after failed health checks: %s", addr, err)
+		c.publish(events.TypeUpstreamDown, events.SeverityWarning, addr, err)
+
+		return
+	}
+
+	c.numDown.Add(-1)
+	log.Info("dnsforward: upstream %s: marked up after passed health checks", addr)
+	c.publish(events.TypeUpstreamUp, events.SeverityInfo, addr, nil)
+}
+
+// publish publishes the event of type typ about the upstream with addr, if the
+// events are configured.  err is the error of the last probe, if any.
+func (c *upstreamHealthChecker) publish(
+	typ events.Type,
+	sev events.Severity,
+	addr string,
+	err error,
+) {
+	if c.events == nil {
+		return
+	}
+
+	data := map[string]string{
+		"upstream": addr,
+	}
+
+	msg := fmt.Sprintf("upstream %s is up", addr)
+	if err != nil {
+		data["error"] = err.Error()
+		msg = fmt.Sprintf("upstream %s is down: %s", addr, err)
+	}
+
+	c.events.Publish(context.Background(), &events.Event{
+		Data:     data,
+		Type:     typ,
+		Message:  msg,
+		Severity: sev,
+	})
+}
+
+// probeUpstream resolves fqdn using u and returns an error if the exchange
+// fails or the response indicates a failure of the upstream.
+func probeUpstream(u upstream.Upstream, fqdn string) (err error) {
+	req := (&dns.Msg{}).SetQuestion(fqdn, dns.TypeA)
+	resp, err := u.Exchange(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if resp == nil {
+		return errors.Error("no response")
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeServerFailure, dns.RcodeRefused:
+		return fmt.Errorf("response code %s", dns.RcodeToString[resp.Rcode])
+	default:
+		return nil
+	}
+}
+
+// upstreamHealthJSON is the health of a single upstream.
+type upstreamHealthJSON struct {
+	// LastCheck is the time of the last probe, if any.
+	LastCheck *time.Time `json:"last_check,omitempty"`
+
+	// Upstream is the address of the upstream.
+	Upstream string `json:"upstream"`
+
+	// LastError is the error of the last failed probe, if any.
+	LastError string `json:"last_error,omitempty"`
+
+	// LatencyMs is the duration of the last successful probe in milliseconds.
+	LatencyMs float64 `json:"latency_ms"`
+
+	// Failures is the number of consecutive failed probes.
+	Failures uint `json:"failures"`
+
+	// Successes is the number of consecutive successful probes.
+	Successes uint `json:"successes"`
+
+	// Healthy is false if the upstream is excluded from the selection.
+	Healthy bool `json:"healthy"`
+}
+
+// upstreamHealthStatusJSON is the response to the GET /control/upstream_status
+// HTTP API.
+type upstreamHealthStatusJSON struct {
+	Upstreams []*upstreamHealthJSON `json:"upstreams"`
+
+	// Enabled is true if the health checks are configured.
+	Enabled bool `json:"enabled"`
+}
+
+// handleUpstreamStatus is the handler for the GET /control/upstream_status
+// HTTP API.
+func (s *Server) handleUpstreamStatus(w http.ResponseWriter, r *http.Request) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	resp := &upstreamHealthStatusJSON{
+		Upstreams: []*upstreamHealthJSON{},
+	}
+
+	if c := s.healthChecker; c != nil {
+		resp.Enabled = true
+		for _, u := range c.upstreams {
+			resp.Upstreams = append(resp.Upstreams, u.toJSON())
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// toJSON returns the current health of u.
+func (u *healthUpstream) toJSON() (j *upstreamHealthJSON) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	j = &upstreamHealthJSON{
+		Upstream:  u.Address(),
+		LatencyMs: float64(u.latency) / float64(time.Millisecond),
+		Failures:  u.failures,
+		Successes: u.successes,
+		Healthy:   !u.down,
+	}
+
+	if u.lastErr != nil {
+		j.LastError = u.lastErr.Error()
+	}
+
+	if last := u.lastCheck; !last.IsZero() {
+		j.LastCheck = &last
+	}
+
+	return j
+}
@@ -0,0 +1,143 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHealthTestUpstream returns a mock upstream with addr, which fails while
+// *fail is true.
+func newHealthTestUpstream(addr string, fail *bool) (u upstream.Upstream) {
+	return &aghtest.UpstreamMock{
+		OnAddress: func() (a string) { return addr },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+			if *fail {
+				return nil, errors.Error("test error")
+			}
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+}
+
+func TestUpstreamHealthChecker(t *testing.T) {
+	const (
+		addr1 = "udp://192.0.2.1:53"
+		addr2 = "udp://192.0.2.2:53"
+	)
+
+	fail1, fail2 := false, false
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{
+			newHealthTestUpstream(addr1, &fail1),
+			newHealthTestUpstream(addr2, &fail2),
+		},
+	}
+	uc.DomainReservedUpstreams = map[string][]upstream.Upstream{
+		"example.com.": {uc.Upstreams[0]},
+	}
+
+	pub := &testPublisher{}
+	c, err := applyUpstreamHealthChecks(uc, &UpstreamHealthCheckConfig{
+		Interval:          timeutil.Duration{Duration: timeutil.Day},
+		FailureThreshold:  2,
+		RecoveryThreshold: 2,
+	}, pub)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+
+	// The same upstream is wrapped once.
+	require.Len(t, c.upstreams, 2)
+	assert.Same(t, uc.Upstreams[0], uc.DomainReservedUpstreams["example.com."][0])
+
+	h1, h2 := c.upstreams[0], c.upstreams[1]
+	req := createTestMessage("example.org.")
+
+	fail1 = true
+	c.check(h1)
+	assert.False(t, h1.isDown())
+
+	c.check(h1)
+	require.True(t, h1.isDown())
+
+	_, err = h1.Exchange(req)
+	assert.ErrorIs(t, err, errUpstreamDown)
+
+	_, err = h2.Exchange(req)
+	require.NoError(t, err)
+
+	// All upstreams are down, so the requests are sent anyway.
+	fail2 = true
+	c.check(h2)
+	c.check(h2)
+	require.True(t, c.allDown())
+
+	_, err = h1.Exchange(req)
+	testutil.AssertErrorMsg(t, "test error", err)
+
+	fail1 = false
+	c.check(h1)
+	assert.True(t, h1.isDown())
+
+	c.check(h1)
+	assert.False(t, h1.isDown())
+
+	j := h1.toJSON()
+	assert.True(t, j.Healthy)
+	assert.Equal(t, uint(2), j.Successes)
+	assert.Empty(t, j.LastError)
+
+	j = h2.toJSON()
+	assert.False(t, j.Healthy)
+	assert.Equal(t, "test error", j.LastError)
+
+	require.Len(t, pub.evs, 3)
+
+	assert.Equal(t, events.TypeUpstreamDown, pub.evs[0].Type)
+	assert.Equal(t, addr1, pub.evs[0].Data["upstream"])
+	assert.Equal(t, events.TypeUpstreamDown, pub.evs[1].Type)
+	assert.Equal(t, addr2, pub.evs[1].Data["upstream"])
+	assert.Equal(t, events.TypeUpstreamUp, pub.evs[2].Type)
+	assert.Equal(t, addr1, pub.evs[2].Data["upstream"])
+}
+
+func TestApplyUpstreamHealthChecks_errors(t *testing.T) {
+	testCases := []struct {
+		conf       *UpstreamHealthCheckConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &UpstreamHealthCheckConfig{
+			Interval: timeutil.Duration{Duration: -1},
+		},
+		name:       "negative_interval",
+		wantErrMsg: "upstream health check: interval: negative value",
+	}, {
+		conf: &UpstreamHealthCheckConfig{
+			Domain:   "bad domain",
+			Interval: timeutil.Duration{Duration: 1},
+		},
+		name: "bad_domain",
+		wantErrMsg: `upstream health check: domain: bad hostname "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := applyUpstreamHealthChecks(&proxy.UpstreamConfig{}, tc.conf, nil)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
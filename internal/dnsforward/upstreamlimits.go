@@ -0,0 +1,179 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// UpstreamResponseLimits are the limits of the responses accepted from the
+// upstreams.  The responses exceeding any of them are rejected as if the
+// exchange with the upstream has failed, so that they are neither cached nor
+// sent to the clients.
+type UpstreamResponseLimits struct {
+	// MaxSize is the maximum size of the response in bytes when packed without
+	// compression.  Since the compression pointers allow a small message to
+	// unpack into a much larger one, it also limits the memory used by a
+	// single cached response.  If zero, the size isn't limited.
+	MaxSize uint `yaml:"max_size"`
+
+	// MaxRecords is the maximum number of the resource records in all sections
+	// of the response, except for the OPT pseudo-record.  If zero, the number
+	// isn't limited.
+	MaxRecords uint `yaml:"max_records"`
+
+	// MaxCNAMEChain is the maximum number of the CNAME records followed from
+	// the requested name to the final one within the answer section.  If zero,
+	// the length isn't limited, but the CNAME loops are still rejected.
+	MaxCNAMEChain uint `yaml:"max_cname_chain"`
+}
+
+// errResponseLimit is returned by [limitsUpstream] when a response exceeds the
+// limits.
+const errResponseLimit errors.Error = "response exceeds limits"
+
+// limitsUpstream is an [upstream.Upstream] that rejects the responses of the
+// underlying upstream exceeding the limits.
+type limitsUpstream struct {
+	upstream.Upstream
+
+	// limits are the limits of the responses.  It must not be nil.
+	limits *UpstreamResponseLimits
+}
+
+// type check
+var _ upstream.Upstream = (*limitsUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *limitsUpstream.
+func (u *limitsUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(req)
+	if err != nil || resp == nil {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return resp, err
+	}
+
+	err = checkResponseLimits(resp, u.limits)
+	if err != nil {
+		log.Info("dnsforward: upstream %s: rejecting response: %s", u.Address(), err)
+
+		return nil, fmt.Errorf("upstream %s: %w", u.Address(), err)
+	}
+
+	return resp, nil
+}
+
+// checkResponseLimits returns an error if resp exceeds limits.  resp must have
+// no more than one question.
+func checkResponseLimits(resp *dns.Msg, limits *UpstreamResponseLimits) (err error) {
+	if limits.MaxRecords > 0 {
+		n := numRecords(resp)
+		if n > limits.MaxRecords {
+			return fmt.Errorf("%w: %d records, max %d", errResponseLimit, n, limits.MaxRecords)
+		}
+	}
+
+	if len(resp.Question) > 0 {
+		chain, loop := cnameChainLen(resp.Question[0].Name, resp.Answer)
+		if loop {
+			return fmt.Errorf("%w: cname loop", errResponseLimit)
+		} else if limits.MaxCNAMEChain > 0 && chain > limits.MaxCNAMEChain {
+			return fmt.Errorf(
+				"%w: cname chain of %d, max %d",
+				errResponseLimit,
+				chain,
+				limits.MaxCNAMEChain,
+			)
+		}
+	}
+
+	if limits.MaxSize > 0 {
+		// Pack a shallow copy, since the compression is set by the caller
+		// later.
+		msg := *resp
+		msg.Compress = false
+
+		size := uint(msg.Len())
+		if size > limits.MaxSize {
+			return fmt.Errorf("%w: %d bytes, max %d", errResponseLimit, size, limits.MaxSize)
+		}
+	}
+
+	return nil
+}
+
+// numRecords returns the number of the resource records in all sections of
+// msg, except for the OPT pseudo-records.
+func numRecords(msg *dns.Msg) (n uint) {
+	n = uint(len(msg.Answer) + len(msg.Ns))
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			n++
+		}
+	}
+
+	return n
+}
+
+// cnameChainLen returns the number of the CNAME records in answer followed
+// from name.  loop is true if the chain forms a loop.
+func cnameChainLen(name string, answer []dns.RR) (n uint, loop bool) {
+	targets := map[string]string{}
+	for _, rr := range answer {
+		if c, ok := rr.(*dns.CNAME); ok {
+			targets[strings.ToLower(c.Hdr.Name)] = strings.ToLower(c.Target)
+		}
+	}
+
+	visited := map[string]struct{}{}
+	for name = strings.ToLower(name); ; n++ {
+		if _, ok := visited[name]; ok {
+			return n, true
+		}
+
+		target, ok := targets[name]
+		if !ok {
+			return n, false
+		}
+
+		visited[name] = struct{}{}
+		name = target
+	}
+}
+
+// applyResponseLimits wraps the upstreams of uc with the ones rejecting the
+// responses exceeding limits.  If limits is nil, uc isn't changed.
+func applyResponseLimits(uc *proxy.UpstreamConfig, limits *UpstreamResponseLimits) {
+	if limits == nil {
+		return
+	}
+
+	wrapped := map[upstream.Upstream]*limitsUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			lu, ok := wrapped[u]
+			if !ok {
+				lu = &limitsUpstream{
+					Upstream: u,
+					limits:   limits,
+				}
+				wrapped[u] = lu
+			}
+
+			ups[i] = lu
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+}
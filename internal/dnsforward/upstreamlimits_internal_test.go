@@ -0,0 +1,145 @@
+package dnsforward
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsUpstream_Exchange(t *testing.T) {
+	const qname = "example.org."
+
+	newCNAME := func(name, target string) (rr dns.RR) {
+		return &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: target,
+		}
+	}
+
+	newA := func(name string) (rr dns.RR) {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.IP{192, 0, 2, 1},
+		}
+	}
+
+	newTXT := func(n int) (rr dns.RR) {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: []string{strings.Repeat("a", n)},
+		}
+	}
+
+	limits := &UpstreamResponseLimits{
+		MaxSize:       512,
+		MaxRecords:    3,
+		MaxCNAMEChain: 2,
+	}
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		answer     []dns.RR
+		extraOPT   bool
+	}{{
+		name:       "within",
+		wantErrMsg: "",
+		answer: []dns.RR{
+			newCNAME("Example.Org.", "a.example."),
+			newCNAME("a.example.", "b.example."),
+			newA("b.example."),
+		},
+		extraOPT: true,
+	}, {
+		name:       "records",
+		wantErrMsg: "upstream mock: response exceeds limits: 4 records, max 3",
+		answer: []dns.RR{
+			newA(qname),
+			newA(qname),
+			newA(qname),
+			newA(qname),
+		},
+		extraOPT: false,
+	}, {
+		name:       "cname_chain",
+		wantErrMsg: "upstream mock: response exceeds limits: cname chain of 3, max 2",
+		answer: []dns.RR{
+			newCNAME(qname, "a.example."),
+			newCNAME("a.example.", "b.example."),
+			newCNAME("b.example.", "c.example."),
+		},
+		extraOPT: false,
+	}, {
+		name:       "cname_loop",
+		wantErrMsg: "upstream mock: response exceeds limits: cname loop",
+		answer: []dns.RR{
+			newCNAME(qname, "a.example."),
+			newCNAME("a.example.", "Example.Org."),
+		},
+		extraOPT: false,
+	}, {
+		name:       "size",
+		wantErrMsg: "upstream mock: response exceeds limits: 553 bytes, max 512",
+		answer:     []dns.RR{newTXT(500)},
+		extraOPT:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &limitsUpstream{
+				Upstream: &aghtest.UpstreamMock{
+					OnAddress: func() (addr string) { return "mock" },
+					OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+						resp = (&dns.Msg{}).SetReply(req)
+						resp.Answer = tc.answer
+						if tc.extraOPT {
+							resp.SetEdns0(dns.DefaultMsgSize, false)
+						}
+
+						return resp, nil
+					},
+					OnClose: func() (err error) { return nil },
+				},
+				limits: limits,
+			}
+
+			resp, err := u.Exchange(createTestMessage(qname))
+			if tc.wantErrMsg == "" {
+				require.NoError(t, err)
+
+				assert.NotNil(t, resp)
+			} else {
+				testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+				assert.ErrorIs(t, err, errResponseLimit)
+				assert.Nil(t, resp)
+			}
+		})
+	}
+}
+
+func TestApplyResponseLimits(t *testing.T) {
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		"192.0.2.1",
+		"[/corp.example/]192.0.2.1",
+	}, &upstream.Options{})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+	applyResponseLimits(uc, nil)
+
+	_, ok := uc.Upstreams[0].(*limitsUpstream)
+	assert.False(t, ok)
+
+	applyResponseLimits(uc, &UpstreamResponseLimits{})
+
+	u := testutil.RequireTypeAssert[*limitsUpstream](t, uc.Upstreams[0])
+	assert.Same(t, u, uc.DomainReservedUpstreams["corp.example."][0])
+}
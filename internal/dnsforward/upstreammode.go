@@ -0,0 +1,230 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/fastip"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// modeUpstream is an [upstream.Upstream] that distributes the requests among
+// several upstreams according to its own mode instead of the one of the proxy.
+// It's used for the groups of upstreams configured with a mode other than the
+// global one, such as the upstreams of a persistent client.
+type modeUpstream struct {
+	// balancer distributes the requests in the [UpstreamModeLoadBalance] mode
+	// and the requests other than A and AAAA in the [UpstreamModeFastestAddr]
+	// one.  It's nil in the other modes.
+	balancer *weightedUpstream
+
+	// fastest selects the fastest address in the [UpstreamModeFastestAddr]
+	// mode.  It's nil in the other modes.
+	fastest *fastip.FastestAddr
+
+	// used are the requests of which the actually used upstreams are tracked.
+	// It's always [modeUsedUpstreams] outside of the tests.
+	used *usedUpstreams
+
+	// ups are the upstreams requests are distributed among.
+	ups []upstream.Upstream
+
+	// mode is the way the requests are distributed.
+	mode UpstreamMode
+
+	// addr is the address of the upstream reported until the actual one is
+	// known.
+	addr string
+}
+
+// type check
+var _ upstream.Upstream = (*modeUpstream)(nil)
+
+// modeUsedUpstreams tracks the upstreams the [modeUpstream]s actually use for
+// the requests resolved by [Server.resolveUpstream].  It's shared between all
+// of them, since the ones of the persistent clients are created outside of the
+// server.  The requests made by module dnsproxy itself, such as the cache
+// refreshes, aren't tracked.
+var modeUsedUpstreams = newUsedUpstreams()
+
+// newModeUpstream returns a new properly initialized *modeUpstream.  ups must
+// not be empty and mode must be valid.  fastestTimeout is the timeout of
+// dialing the addresses in the [UpstreamModeFastestAddr] mode, if it's zero,
+// [fastip.DefaultPingWaitTimeout] is used.
+func newModeUpstream(
+	ups []upstream.Upstream,
+	mode UpstreamMode,
+	fastestTimeout time.Duration,
+) (m *modeUpstream) {
+	addrs := make([]string, 0, len(ups))
+	for _, u := range ups {
+		addrs = append(addrs, u.Address())
+	}
+
+	m = &modeUpstream{
+		used: modeUsedUpstreams,
+		ups:  ups,
+		mode: mode,
+		addr: fmt.Sprintf("%s(%s)", mode, strings.Join(addrs, ", ")),
+	}
+
+	switch mode {
+	case UpstreamModeLoadBalance:
+		m.balancer = newWeightedUpstream(ups, nil, nil)
+	case UpstreamModeFastestAddr:
+		m.balancer = newWeightedUpstream(ups, nil, nil)
+		m.fastest = fastip.New(&fastip.Config{
+			PingWaitTimeout: fastestTimeout,
+		})
+	default:
+		// Go on, the other modes need no additional state.
+	}
+
+	return m
+}
+
+// Address implements the [upstream.Upstream] interface for *modeUpstream.
+func (m *modeUpstream) Address() (addr string) {
+	return m.addr
+}
+
+// Exchange implements the [upstream.Upstream] interface for *modeUpstream.
+func (m *modeUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	var u upstream.Upstream
+	switch m.mode {
+	case UpstreamModeParallel:
+		resp, u, err = upstream.ExchangeParallel(m.ups, req)
+	case UpstreamModeFastestAddr:
+		if isAddrQuestion(req) {
+			resp, u, err = m.fastest.ExchangeFastest(req, m.ups)
+		} else {
+			resp, u, err = m.balancer.exchange(req)
+		}
+	case UpstreamModeFailOver:
+		resp, u, err = exchangeFailOver(m.ups, req)
+	default:
+		resp, u, err = m.balancer.exchange(req)
+	}
+
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	m.used.set(req, u)
+
+	return resp, nil
+}
+
+// isAddrQuestion returns true if req is a request for the A or AAAA records.
+func isAddrQuestion(req *dns.Msg) (ok bool) {
+	if len(req.Question) == 0 {
+		return false
+	}
+
+	qt := req.Question[0].Qtype
+
+	return qt == dns.TypeA || qt == dns.TypeAAAA
+}
+
+// exchangeFailOver resolves req using the first of ups that doesn't fail.
+func exchangeFailOver(
+	ups []upstream.Upstream,
+	req *dns.Msg,
+) (resp *dns.Msg, u upstream.Upstream, err error) {
+	var errs []error
+	for _, u = range ups {
+		resp, err = u.Exchange(req)
+		if err == nil {
+			return resp, u, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return nil, nil, errors.Join(errs...)
+}
+
+// Close implements the [upstream.Upstream] interface for *modeUpstream.
+func (m *modeUpstream) Close() (err error) {
+	var errs []error
+	for _, u := range m.ups {
+		err = u.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", u.Address(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateGroupUpstreamMode returns an error if mode can't be used for a group
+// of upstreams.  The empty mode is valid and means the global one.
+func validateGroupUpstreamMode(mode UpstreamMode) (err error) {
+	switch mode {
+	case
+		"",
+		UpstreamModeLoadBalance,
+		UpstreamModeParallel,
+		UpstreamModeFastestAddr,
+		UpstreamModeFailOver:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", errors.ErrBadEnumValue, mode)
+	}
+}
+
+// ApplyUpstreamMode validates mode and replaces each list of several upstreams
+// in uc with a single upstream distributing the requests among them according
+// to mode regardless of the global one.  If mode is empty, uc isn't changed.
+// [UpstreamModeWeighted] isn't supported, since the weights are global.
+// fastestTimeout is the timeout of dialing the addresses in the
+// [UpstreamModeFastestAddr] mode, if it's zero, the default one is used.  It
+// must be called after any other wrapping of the upstreams.
+func ApplyUpstreamMode(
+	uc *proxy.UpstreamConfig,
+	mode UpstreamMode,
+	fastestTimeout time.Duration,
+) (err error) {
+	err = validateGroupUpstreamMode(mode)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	} else if mode == "" {
+		return nil
+	}
+
+	wrap := func(ups []upstream.Upstream) (wrapped []upstream.Upstream) {
+		if len(ups) < 2 {
+			return ups
+		}
+
+		return []upstream.Upstream{newModeUpstream(ups, mode, fastestTimeout)}
+	}
+
+	uc.Upstreams = wrap(uc.Upstreams)
+	for d, ups := range uc.DomainReservedUpstreams {
+		uc.DomainReservedUpstreams[d] = wrap(ups)
+	}
+
+	for d, ups := range uc.SpecifiedDomainUpstreams {
+		uc.SpecifiedDomainUpstreams[d] = wrap(ups)
+	}
+
+	return nil
+}
+
+// setModeUpstream replaces the [modeUpstream] in pctx, if any, with the
+// upstream it has actually used for req.  It must be called after resolving
+// req, which must be tracked in [modeUsedUpstreams].
+func setModeUpstream(pctx *proxy.DNSContext, req *dns.Msg) {
+	u := modeUsedUpstreams.finish(req)
+	if _, ok := pctx.Upstream.(*modeUpstream); ok && u != nil {
+		pctx.Upstream = u
+	}
+}
@@ -0,0 +1,73 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyUpstreamMode(t *testing.T) {
+	const errTest errors.Error = "test error"
+
+	var primaryNum, secondaryNum, singleNum int
+	primary := newWeightedTestUpstream("primary", &primaryNum, errTest)
+	secondary := newWeightedTestUpstream("secondary", &secondaryNum, nil)
+	single := newWeightedTestUpstream("single", &singleNum, nil)
+
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{primary, secondary},
+		DomainReservedUpstreams: map[string][]upstream.Upstream{
+			"single.example.": {single},
+		},
+	}
+
+	err := ApplyUpstreamMode(uc, UpstreamModeFailOver, 0)
+	require.NoError(t, err)
+	require.Len(t, uc.Upstreams, 1)
+
+	assert.Equal(t, []upstream.Upstream{single}, uc.DomainReservedUpstreams["single.example."])
+
+	m := testutil.RequireTypeAssert[*modeUpstream](t, uc.Upstreams[0])
+	assert.Equal(t, "fail_over(primary, secondary)", m.Address())
+
+	// The requests not resolved by the server, such as the cache refreshes,
+	// must not be kept.
+	untracked := createTestMessage("untracked.example.")
+	_, err = m.Exchange(untracked)
+	require.NoError(t, err)
+
+	assert.Empty(t, m.used.reqs)
+
+	req := createTestMessage("example.org.")
+	m.used.track(req)
+	for range 3 {
+		_, err = m.Exchange(req)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 4, primaryNum)
+	assert.Equal(t, 4, secondaryNum)
+
+	pctx := &proxy.DNSContext{
+		Upstream: m,
+	}
+	setModeUpstream(pctx, req)
+
+	assert.Equal(t, secondary, pctx.Upstream)
+	assert.Empty(t, m.used.reqs)
+}
+
+func TestApplyUpstreamMode_invalid(t *testing.T) {
+	uc := &proxy.UpstreamConfig{}
+
+	err := ApplyUpstreamMode(uc, UpstreamModeWeighted, 0)
+	testutil.AssertErrorMsg(t, `bad enum value: "weighted"`, err)
+
+	err = ApplyUpstreamMode(uc, "", 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,294 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+)
+
+// UpstreamRetryConfig is the retry policy of the exchanges with the upstreams.
+type UpstreamRetryConfig struct {
+	// FailoverRcodes are the response codes, such as "SERVFAIL" or "REFUSED",
+	// which make the server try the next upstream as if the exchange failed
+	// instead of returning the response as is.  Lame delegations are usually
+	// reported with these.
+	FailoverRcodes []string `yaml:"failover_rcodes"`
+
+	// Timeouts are the timeouts overriding [Config.UpstreamTimeout] for the
+	// particular upstreams.
+	Timeouts []*UpstreamTimeoutOverride `yaml:"timeouts"`
+
+	// Retries is the number of additional attempts to exchange with the same
+	// upstream after a network error before trying the next upstream.  It must
+	// not be greater than [maxUpstreamRetries].
+	Retries uint `yaml:"retries"`
+}
+
+// maxUpstreamRetries is the maximum number of additional attempts to exchange
+// with the same upstream.  The attempts are made one after another, so it
+// limits the time a single request may take.
+const maxUpstreamRetries = 5
+
+// UpstreamTimeoutOverride is the timeout of the exchanges with a single
+// upstream.
+type UpstreamTimeoutOverride struct {
+	// Upstream is the address of the upstream, as written in the upstream
+	// configuration.  It must not be empty.
+	Upstream string `yaml:"upstream"`
+
+	// Timeout is the timeout of a single exchange with the upstream.  It must
+	// be positive.  It only makes sense for it to be less than the global
+	// upstream timeout.
+	Timeout timeutil.Duration `yaml:"timeout"`
+}
+
+// retryUpstream is an [upstream.Upstream] that retries the failed exchanges
+// and turns the responses with the configured response codes into errors, so
+// that the next upstream is used.
+type retryUpstream struct {
+	upstream.Upstream
+
+	// failoverRcodes are the response codes turned into errors.
+	failoverRcodes map[int]struct{}
+
+	// retries is the number of additional attempts after an error.
+	retries uint
+}
+
+// type check
+var _ upstream.Upstream = (*retryUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *retryUpstream.
+func (u *retryUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	for i := uint(0); i <= u.retries; i++ {
+		// Use the copy of req, since the upstreams may modify it.
+		resp, err = u.Upstream.Exchange(req.Copy())
+		if err == nil {
+			break
+		}
+
+		log.Debug("dnsforward: upstream %s: attempt %d: %s", u.Address(), i+1, err)
+	}
+
+	if err != nil {
+		// Don't wrap the error, since the caller expects the upstream's one.
+		return nil, err
+	}
+
+	if _, ok := u.failoverRcodes[resp.Rcode]; ok {
+		return nil, fmt.Errorf("upstream %s: response code %s", u.Address(), dns.RcodeToString[resp.Rcode])
+	}
+
+	return resp, nil
+}
+
+// upstreamAddress returns the address of the upstream addr in the same form as
+// the ones of the upstreams from the parsed configuration.
+func upstreamAddress(addr string) (norm string, err error) {
+	// Create the upstream to get its address.  It doesn't connect anywhere.
+	u, err := upstream.AddressToUpstream(addr, &upstream.Options{})
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	}
+
+	norm = u.Address()
+	logCloserErr(u, "dnsforward: closing upstream %s: %s", norm)
+
+	return norm, nil
+}
+
+// newFailoverRcodes parses the response codes.
+func newFailoverRcodes(rcodes []string) (codes map[int]struct{}, err error) {
+	codes = make(map[int]struct{}, len(rcodes))
+	for i, rc := range rcodes {
+		code, ok := dns.StringToRcode[strings.ToUpper(rc)]
+		if !ok {
+			return nil, fmt.Errorf("failover_rcodes: at index %d: unknown response code %q", i, rc)
+		} else if code == dns.RcodeSuccess {
+			return nil, fmt.Errorf("failover_rcodes: at index %d: %q can't be used", i, rc)
+		}
+
+		codes[code] = struct{}{}
+	}
+
+	return codes, nil
+}
+
+// newUpstreamTimeouts validates overrides and returns the timeouts by the
+// normalized upstream addresses.
+func newUpstreamTimeouts(overrides []*UpstreamTimeoutOverride) (timeouts map[string]time.Duration, err error) {
+	timeouts = make(map[string]time.Duration, len(overrides))
+	for i, o := range overrides {
+		if o == nil {
+			return nil, fmt.Errorf("timeouts: at index %d: %w", i, errors.ErrNoValue)
+		} else if o.Timeout.Duration <= 0 {
+			return nil, fmt.Errorf("timeouts: at index %d: timeout must be positive", i)
+		}
+
+		var addr string
+		addr, err = upstreamAddress(o.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("timeouts: at index %d: upstream: %w", i, err)
+		}
+
+		timeouts[addr] = o.Timeout.Duration
+	}
+
+	return timeouts, nil
+}
+
+// applyUpstreamTimeouts validates the timeout overrides from conf and replaces
+// the upstreams of uc having them with the ones created using opts with the
+// overridden timeout, so that the upstreams themselves limit the time of each
+// exchange.  conf may be nil, in which case uc is left as is.  It must be
+// called before the upstreams of uc are wrapped.
+func applyUpstreamTimeouts(
+	uc *proxy.UpstreamConfig,
+	conf *UpstreamRetryConfig,
+	opts *upstream.Options,
+) (err error) {
+	if conf == nil {
+		return nil
+	}
+
+	defer func() { err = errors.Annotate(err, "upstream retry: %w") }()
+
+	timeouts, err := newUpstreamTimeouts(conf.Timeouts)
+	if err != nil || len(timeouts) == 0 {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	replaced := map[upstream.Upstream]upstream.Upstream{}
+	replace := func(ups []upstream.Upstream) (err error) {
+		for i, u := range ups {
+			r, ok := replaced[u]
+			if !ok {
+				r, err = newTimeoutUpstream(u, timeouts, opts)
+				if err != nil {
+					// Don't wrap the error, since it's informative enough as
+					// is.
+					return err
+				}
+
+				replaced[u] = r
+			}
+
+			ups[i] = r
+		}
+
+		return nil
+	}
+
+	err = replace(uc.Upstreams)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	for _, ups := range uc.DomainReservedUpstreams {
+		err = replace(ups)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return err
+		}
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		err = replace(ups)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newTimeoutUpstream returns the upstream with the same address as u created
+// using opts with the timeout from timeouts and closes u.  If there is no
+// timeout for u, it's returned as is.
+func newTimeoutUpstream(
+	u upstream.Upstream,
+	timeouts map[string]time.Duration,
+	opts *upstream.Options,
+) (r upstream.Upstream, err error) {
+	addr := u.Address()
+	timeout, ok := timeouts[addr]
+	if !ok {
+		return u, nil
+	}
+
+	o := opts.Clone()
+	o.Timeout = timeout
+
+	r, err = upstream.AddressToUpstream(addr, o)
+	if err != nil {
+		return u, fmt.Errorf("timeouts: upstream %s: %w", addr, err)
+	}
+
+	logCloserErr(u, "dnsforward: closing upstream %s: %s", addr)
+
+	return r, nil
+}
+
+// applyUpstreamRetry validates conf and wraps the upstreams of uc with the ones
+// applying the retry policy.  conf may be nil, in which case uc is left as is.
+// The timeouts are applied by [applyUpstreamTimeouts].
+func applyUpstreamRetry(uc *proxy.UpstreamConfig, conf *UpstreamRetryConfig) (err error) {
+	if conf == nil {
+		return nil
+	}
+
+	defer func() { err = errors.Annotate(err, "upstream retry: %w") }()
+
+	rcodes, err := newFailoverRcodes(conf.FailoverRcodes)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	if conf.Retries > maxUpstreamRetries {
+		return fmt.Errorf("retries: must be at most %d, got %d", maxUpstreamRetries, conf.Retries)
+	}
+
+	if len(rcodes) == 0 && conf.Retries == 0 {
+		return nil
+	}
+
+	wrapped := map[upstream.Upstream]*retryUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			r, ok := wrapped[u]
+			if !ok {
+				r = &retryUpstream{
+					Upstream:       u,
+					failoverRcodes: rcodes,
+					retries:        conf.Retries,
+				}
+				wrapped[u] = r
+			}
+
+			ups[i] = r
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package dnsforward
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryUpstream_Exchange(t *testing.T) {
+	const addr = "udp://192.0.2.1:53"
+
+	req := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+
+	newUps := func(rcode int, failures int32) (u *aghtest.UpstreamMock, calls *atomic.Int32) {
+		calls = &atomic.Int32{}
+
+		return &aghtest.UpstreamMock{
+			OnAddress: func() (a string) { return addr },
+			OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+				if calls.Add(1) <= failures {
+					return nil, errors.Error("network error")
+				}
+
+				resp = (&dns.Msg{}).SetRcode(req, rcode)
+
+				return resp, nil
+			},
+			OnClose: func() (err error) { return nil },
+		}, calls
+	}
+
+	failover := map[int]struct{}{dns.RcodeServerFailure: {}}
+
+	t.Run("retry_success", func(t *testing.T) {
+		ups, calls := newUps(dns.RcodeSuccess, 2)
+		u := &retryUpstream{Upstream: ups, failoverRcodes: failover, retries: 2}
+
+		resp, err := u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("retry_failure", func(t *testing.T) {
+		ups, calls := newUps(dns.RcodeSuccess, 2)
+		u := &retryUpstream{Upstream: ups, failoverRcodes: failover, retries: 1}
+
+		_, err := u.Exchange(req)
+		testutil.AssertErrorMsg(t, "network error", err)
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("failover_rcode", func(t *testing.T) {
+		ups, calls := newUps(dns.RcodeServerFailure, 0)
+		u := &retryUpstream{Upstream: ups, failoverRcodes: failover, retries: 2}
+
+		_, err := u.Exchange(req)
+		testutil.AssertErrorMsg(t, "upstream "+addr+": response code SERVFAIL", err)
+
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("returned_rcode", func(t *testing.T) {
+		ups, _ := newUps(dns.RcodeRefused, 0)
+		u := &retryUpstream{Upstream: ups, failoverRcodes: failover}
+
+		resp, err := u.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+	})
+}
+
+func TestApplyUpstreamTimeouts(t *testing.T) {
+	unblock := make(chan struct{})
+	addr := newLocalUpstreamListener(t, 0, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		<-unblock
+	}))
+	t.Cleanup(func() { close(unblock) })
+
+	upsAddr := "tcp://" + addr.String()
+	uc, err := proxy.ParseUpstreamsConfig([]string{upsAddr}, &upstream.Options{
+		Timeout: testTimeout,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+	t.Run("applies", func(t *testing.T) {
+		err = applyUpstreamTimeouts(uc, &UpstreamRetryConfig{
+			Timeouts: []*UpstreamTimeoutOverride{{
+				Upstream: upsAddr,
+				Timeout:  timeutil.Duration{Duration: 10 * time.Millisecond},
+			}},
+		}, &upstream.Options{})
+		require.NoError(t, err)
+		require.Len(t, uc.Upstreams, 1)
+
+		start := time.Now()
+		_, err = uc.Upstreams[0].Exchange(createTestMessage("example.com."))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		assert.Less(t, time.Since(start), testTimeout)
+	})
+
+	t.Run("bad_timeout", func(t *testing.T) {
+		err = applyUpstreamTimeouts(&proxy.UpstreamConfig{}, &UpstreamRetryConfig{
+			Timeouts: []*UpstreamTimeoutOverride{{
+				Upstream: "192.0.2.1",
+			}},
+		}, &upstream.Options{})
+		testutil.AssertErrorMsg(
+			t,
+			"upstream retry: timeouts: at index 0: timeout must be positive",
+			err,
+		)
+	})
+}
+
+func TestApplyUpstreamRetry(t *testing.T) {
+	newUpstream := func(t *testing.T, addr string) (u upstream.Upstream) {
+		t.Helper()
+
+		u, err := upstream.AddressToUpstream(addr, &upstream.Options{})
+		require.NoError(t, err)
+
+		return u
+	}
+
+	t.Run("wraps", func(t *testing.T) {
+		fast, slow := newUpstream(t, "192.0.2.1"), newUpstream(t, "192.0.2.2")
+		uc := &proxy.UpstreamConfig{
+			Upstreams: []upstream.Upstream{fast, slow},
+			SpecifiedDomainUpstreams: map[string][]upstream.Upstream{
+				"example.org.": {slow},
+			},
+		}
+
+		err := applyUpstreamRetry(uc, &UpstreamRetryConfig{
+			FailoverRcodes: []string{"servfail"},
+			Retries:        1,
+		})
+		require.NoError(t, err)
+
+		require.IsType(t, (*retryUpstream)(nil), uc.Upstreams[0])
+		require.IsType(t, (*retryUpstream)(nil), uc.Upstreams[1])
+
+		assert.Same(t, uc.Upstreams[1], uc.SpecifiedDomainUpstreams["example.org."][0])
+	})
+
+	t.Run("bad_rcode", func(t *testing.T) {
+		err := applyUpstreamRetry(&proxy.UpstreamConfig{}, &UpstreamRetryConfig{
+			FailoverRcodes: []string{"BAD"},
+		})
+		testutil.AssertErrorMsg(
+			t,
+			`upstream retry: failover_rcodes: at index 0: unknown response code "BAD"`,
+			err,
+		)
+	})
+
+	t.Run("bad_retries", func(t *testing.T) {
+		err := applyUpstreamRetry(&proxy.UpstreamConfig{}, &UpstreamRetryConfig{
+			Retries: maxUpstreamRetries + 1,
+		})
+		testutil.AssertErrorMsg(t, "upstream retry: retries: must be at most 5, got 6", err)
+	})
+}
@@ -1,13 +1,19 @@
 package dnsforward
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -127,6 +133,32 @@ func newPrivateConfig(
 	return uc, nil
 }
 
+// discoveredResolvers is a [SystemResolvers] containing the addresses of the
+// discovered local DNS servers.
+type discoveredResolvers []netip.AddrPort
+
+// type check
+var _ SystemResolvers = discoveredResolvers(nil)
+
+// Addrs implements the [SystemResolvers] interface for discoveredResolvers.
+func (r discoveredResolvers) Addrs() (addrs []netip.AddrPort) {
+	return r
+}
+
+// defaultPrivateResolvers returns the resolvers to use for private requests
+// when no local PTR resolvers are configured.  Those are the discovered local
+// DNS servers except the unwanted ones, if there are any left, and the
+// OS-provided resolvers otherwise.  It assumes s.serverLock is locked or the
+// Server not running.
+func (s *Server) defaultPrivateResolvers(unwanted addrPortSet) (sysResolvers SystemResolvers) {
+	discovered := slices.DeleteFunc(slices.Clone(s.conf.DiscoveredPTRResolvers), unwanted.Has)
+	if len(discovered) == 0 {
+		return s.sysResolvers
+	}
+
+	return discoveredResolvers(discovered)
+}
+
 // UpstreamHTTPVersions returns the HTTP versions for upstream configuration
 // depending on configuration.
 func UpstreamHTTPVersions(http3 bool) (v []upstream.HTTPVersion) {
@@ -154,7 +186,10 @@ func setProxyUpstreamMode(
 	case UpstreamModeFastestAddr:
 		conf.UpstreamMode = proxy.UpstreamModeFastestAddr
 		conf.FastestPingTimeout = fastestTimeout
-	case UpstreamModeLoadBalance:
+	case UpstreamModeLoadBalance, UpstreamModeWeighted, UpstreamModeFailOver:
+		// The weighted and the fail-over modes are implemented by
+		// [weightedUpstream] and [modeUpstream] respectively, so each list of
+		// upstreams consists of a single one.
 		conf.UpstreamMode = proxy.UpstreamModeLoadBalance
 	default:
 		return fmt.Errorf("unexpected value %q", upstreamMode)
@@ -169,3 +204,55 @@ func setProxyUpstreamMode(
 func IsCommentOrEmpty(s string) (ok bool) {
 	return len(s) == 0 || s[0] == '#'
 }
+
+// ResolveUpstreamHosts resolves the hostnames of the general upstream servers
+// using the bootstrap servers.  It's intended to detect the bootstrap failures,
+// for example while the network isn't up yet on boot, before the first
+// queries, and also fills the bootstrap cache.  err is the joined errors of the
+// failed resolutions, if any.
+func (s *Server) ResolveUpstreamHosts(ctx context.Context) (err error) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	uc, boot := s.conf.UpstreamConfig, s.bootstrap
+	if uc == nil || boot == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, u := range uc.Upstreams {
+		host := upstreamHostname(u.Address())
+		if host == "" {
+			continue
+		}
+
+		_, err = boot.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolving upstream %q: %w", host, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// upstreamHostname returns the hostname from the address of an upstream or an
+// empty string if the address contains an IP address or is a DNS stamp.
+func upstreamHostname(addr string) (host string) {
+	if strings.HasPrefix(addr, "sdns://") {
+		return ""
+	}
+
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		host = u.Hostname()
+	} else if h, _, splitErr := net.SplitHostPort(addr); splitErr == nil {
+		host = h
+	} else {
+		host = addr
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil {
+		return ""
+	}
+
+	return host
+}
@@ -2,12 +2,14 @@ package dnsforward
 
 import (
 	"net"
+	"net/netip"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
@@ -214,3 +216,78 @@ func TestUpstreamConfigValidator_Check_once(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_DefaultPrivateResolvers(t *testing.T) {
+	own := netip.MustParseAddrPort("192.168.1.2:53")
+	gateway := netip.MustParseAddrPort("192.168.1.1:53")
+
+	testCases := []struct {
+		name       string
+		discovered []netip.AddrPort
+		want       []netip.AddrPort
+	}{{
+		name:       "none",
+		discovered: nil,
+		want:       nil,
+	}, {
+		name:       "discovered",
+		discovered: []netip.AddrPort{own, gateway},
+		want:       []netip.AddrPort{gateway},
+	}, {
+		name:       "only_own",
+		discovered: []netip.AddrPort{own},
+		want:       nil,
+	}}
+
+	unwanted := container.NewMapSet(own)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				sysResolvers: emptySysResolvers{},
+				conf: ServerConfig{
+					DiscoveredPTRResolvers: tc.discovered,
+				},
+			}
+
+			assert.Equal(t, tc.want, s.defaultPrivateResolvers(unwanted).Addrs())
+		})
+	}
+}
+
+func TestUpstreamHostname(t *testing.T) {
+	testCases := []struct {
+		addr string
+		want string
+	}{{
+		addr: "tls://dns.example:853",
+		want: "dns.example",
+	}, {
+		addr: "https://dns.example/dns-query",
+		want: "dns.example",
+	}, {
+		addr: "dns.example:53",
+		want: "dns.example",
+	}, {
+		addr: "dns.example",
+		want: "dns.example",
+	}, {
+		addr: "1.1.1.1:53",
+		want: "",
+	}, {
+		addr: "udp://[2001:db8::1]:53",
+		want: "",
+	}, {
+		addr: "8.8.8.8",
+		want: "",
+	}, {
+		addr: "sdns://AQcAAAAAAAAAFDE3Ni4xMDMuMTMwLjEzMDo1NDQz",
+		want: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			assert.Equal(t, tc.want, upstreamHostname(tc.addr))
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package dnsforward
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// statusUpstream is an [upstream.Upstream] that keeps track of the results of
+// the exchanges with the underlying upstream.
+type statusUpstream struct {
+	upstream.Upstream
+
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// lastErr is the error of the last failed exchange, if any.
+	lastErr error
+
+	// lastExchange is the time of the last exchange.
+	lastExchange time.Time
+
+	// lastSuccess is the time of the last successful exchange.
+	lastSuccess time.Time
+
+	// failures is the number of consecutive failed exchanges.
+	failures uint
+}
+
+// type check
+var _ upstream.Upstream = (*statusUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *statusUpstream.
+func (u *statusUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(req)
+	u.record(time.Now(), err)
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return resp, err
+}
+
+// record updates the status of u with the result of an exchange finished at
+// now.
+func (u *statusUpstream) record(now time.Time, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastExchange = now
+	if err != nil {
+		u.lastErr = err
+		u.failures++
+
+		return
+	}
+
+	u.lastSuccess = now
+	u.failures = 0
+}
+
+// applyUpstreamStatuses wraps the upstreams of uc with the ones keeping track
+// of the results of the exchanges.  statuses are the wrapping upstreams.
+func applyUpstreamStatuses(uc *proxy.UpstreamConfig) (statuses []*statusUpstream) {
+	wrapped := map[upstream.Upstream]*statusUpstream{}
+	wrap := func(ups []upstream.Upstream) {
+		for i, u := range ups {
+			su, ok := wrapped[u]
+			if !ok {
+				su = &statusUpstream{
+					Upstream: u,
+					mu:       &sync.Mutex{},
+				}
+				wrapped[u] = su
+				statuses = append(statuses, su)
+			}
+
+			ups[i] = su
+		}
+	}
+
+	wrap(uc.Upstreams)
+	for _, ups := range uc.DomainReservedUpstreams {
+		wrap(ups)
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		wrap(ups)
+	}
+
+	return statuses
+}
+
+// upstreamStatusJSON is the health status of a single upstream.
+type upstreamStatusJSON struct {
+	// LastExchange is the time of the last exchange, if any.
+	LastExchange *time.Time `json:"last_exchange,omitempty"`
+
+	// LastSuccess is the time of the last successful exchange, if any.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+
+	// DNSCrypt is the state of the DNSCrypt certificate, if the upstream uses
+	// the DNSCrypt protocol.
+	DNSCrypt *dnsCryptStatusJSON `json:"dnscrypt,omitempty"`
+
+	// Upstream is the address of the upstream.
+	Upstream string `json:"upstream"`
+
+	// LastError is the error of the last failed exchange, if any.
+	LastError string `json:"last_error,omitempty"`
+
+	// Failures is the number of consecutive failed exchanges.
+	Failures uint `json:"failures"`
+
+	// Healthy is true if the last exchange, if any, has succeeded.
+	Healthy bool `json:"healthy"`
+}
+
+// dnsCryptStatusJSON is the state of the certificate of a DNSCrypt upstream.
+type dnsCryptStatusJSON struct {
+	// CertNotAfter is the time the current certificate expires, if it has
+	// been fetched.
+	CertNotAfter *time.Time `json:"cert_not_after,omitempty"`
+
+	// Fallback is the address of the DNS-over-HTTPS fallback upstream, if any.
+	Fallback string `json:"fallback,omitempty"`
+
+	// CertSerial is the serial number of the current certificate.
+	CertSerial uint32 `json:"cert_serial"`
+
+	// CertRotations is the number of times the certificate has been replaced.
+	CertRotations uint `json:"cert_rotations"`
+}
+
+// toJSON returns the current status of u.
+func (u *statusUpstream) toJSON() (j *upstreamStatusJSON) {
+	j = &upstreamStatusJSON{
+		Upstream: u.Address(),
+	}
+
+	if dc, ok := u.Upstream.(*dnsCryptUpstream); ok {
+		j.DNSCrypt = dc.toJSON()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	j.Failures = u.failures
+	j.Healthy = u.failures == 0
+	if u.lastErr != nil {
+		j.LastError = u.lastErr.Error()
+	}
+
+	if last := u.lastExchange; !last.IsZero() {
+		j.LastExchange = &last
+	}
+
+	if last := u.lastSuccess; !last.IsZero() {
+		j.LastSuccess = &last
+	}
+
+	return j
+}
+
+// toJSON returns the current state of the certificate of u.
+func (u *dnsCryptUpstream) toJSON() (j *dnsCryptStatusJSON) {
+	notAfter, serial, rotations := u.certInfo()
+
+	j = &dnsCryptStatusJSON{
+		CertSerial:    serial,
+		CertRotations: rotations,
+	}
+
+	if !notAfter.IsZero() {
+		j.CertNotAfter = &notAfter
+	}
+
+	if u.fallback != nil {
+		j.Fallback = u.fallback.Address()
+	}
+
+	return j
+}
+
+// upstreamStatuses returns the health statuses of the upstreams.  s.serverLock
+// is expected to be locked.
+func (s *Server) upstreamStatuses() (statuses []*upstreamStatusJSON) {
+	statuses = make([]*upstreamStatusJSON, 0, len(s.statusUpstreams))
+	for _, u := range s.statusUpstreams {
+		statuses = append(statuses, u.toJSON())
+	}
+
+	return statuses
+}
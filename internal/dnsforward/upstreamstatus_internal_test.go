@@ -0,0 +1,67 @@
+package dnsforward
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusUpstream_Exchange(t *testing.T) {
+	const addr = "udp://192.0.2.1:53"
+
+	req := createTestMessage("example.org.")
+
+	fail := false
+	u := &statusUpstream{
+		Upstream: &aghtest.UpstreamMock{
+			OnAddress: func() (a string) { return addr },
+			OnExchange: func(req *dns.Msg) (resp *dns.Msg, err error) {
+				if fail {
+					return nil, errors.Error("test error")
+				}
+
+				return (&dns.Msg{}).SetReply(req), nil
+			},
+		},
+		mu: &sync.Mutex{},
+	}
+
+	j := u.toJSON()
+	assert.Equal(t, addr, j.Upstream)
+	assert.True(t, j.Healthy)
+	assert.Nil(t, j.LastExchange)
+	assert.Nil(t, j.LastSuccess)
+
+	_, err := u.Exchange(req)
+	require.NoError(t, err)
+
+	j = u.toJSON()
+	assert.True(t, j.Healthy)
+	require.NotNil(t, j.LastSuccess)
+	require.NotNil(t, j.LastExchange)
+
+	fail = true
+	for range 2 {
+		_, err = u.Exchange(req)
+		require.Error(t, err)
+	}
+
+	j = u.toJSON()
+	assert.False(t, j.Healthy)
+	assert.Equal(t, uint(2), j.Failures)
+	assert.Equal(t, "test error", j.LastError)
+	assert.True(t, j.LastExchange.After(*j.LastSuccess))
+
+	fail = false
+	_, err = u.Exchange(req)
+	require.NoError(t, err)
+
+	j = u.toJSON()
+	assert.True(t, j.Healthy)
+	assert.Zero(t, j.Failures)
+}
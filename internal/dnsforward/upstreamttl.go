@@ -0,0 +1,155 @@
+package dnsforward
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// ttlUpstream is an [upstream.Upstream] that clamps the TTLs of the resource
+// records of the responses received from the underlying upstream.
+type ttlUpstream struct {
+	upstream.Upstream
+
+	// minTTL is the minimum TTL of the resource records.
+	minTTL uint32
+
+	// maxTTL is the maximum TTL of the resource records.  Zero means no limit.
+	maxTTL uint32
+}
+
+// type check
+var _ upstream.Upstream = (*ttlUpstream)(nil)
+
+// Exchange implements the [upstream.Upstream] interface for *ttlUpstream.
+func (u *ttlUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, err = u.Upstream.Exchange(req)
+	if resp != nil {
+		clampTTLs(resp, u.minTTL, u.maxTTL)
+	}
+
+	// Don't wrap the error, since the caller expects the upstream's one.
+	return resp, err
+}
+
+// clampTTLs sets the TTLs of all resource records in msg, except for the OPT
+// pseudo-records, within the bounds.  maxTTL of zero means no upper bound.
+func clampTTLs(msg *dns.Msg, minTTL, maxTTL uint32) {
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			hdr.Ttl = max(hdr.Ttl, minTTL)
+			if maxTTL > 0 {
+				hdr.Ttl = min(hdr.Ttl, maxTTL)
+			}
+		}
+	}
+}
+
+// ttlOverride is a validated [UpstreamTTLOverride].
+type ttlOverride struct {
+	// addr is the normalized address of the upstream as returned by
+	// [upstream.Upstream.Address].  If empty, all upstreams match.
+	addr string
+
+	// fqdn is the fully-qualified domain name of the domain-specific rule.  If
+	// empty, all rules and the default upstreams match.
+	fqdn string
+
+	// minTTL is the minimum TTL of the resource records.
+	minTTL uint32
+
+	// maxTTL is the maximum TTL of the resource records.  Zero means no limit.
+	maxTTL uint32
+}
+
+// newTTLOverride validates o and returns the prepared override.
+func newTTLOverride(o *UpstreamTTLOverride) (ov *ttlOverride, err error) {
+	if o == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	if o.Upstream == "" && o.Domain == "" {
+		return nil, errors.Error("upstream or domain must be set")
+	}
+
+	if o.MaxTTL > 0 && o.MinTTL > o.MaxTTL {
+		return nil, errors.Error("min_ttl must be less than or equal to max_ttl")
+	}
+
+	ov = &ttlOverride{
+		minTTL: o.MinTTL,
+		maxTTL: o.MaxTTL,
+	}
+
+	if o.Upstream != "" {
+		ov.addr, err = upstreamAddress(o.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("upstream: %w", err)
+		}
+	}
+
+	if o.Domain != "" {
+		var domain string
+		domain, err = aghnet.ParseDomainName(o.Domain)
+		if err != nil {
+			return nil, fmt.Errorf("domain: %w", err)
+		}
+
+		ov.fqdn = dns.Fqdn(domain)
+	}
+
+	return ov, nil
+}
+
+// wrap replaces the matching upstreams of the rule for fqdn with the TTL
+// clamping ones in place.  fqdn is empty for the default upstreams.  The
+// upstreams already wrapped by the previous overrides are left as is.
+func (ov *ttlOverride) wrap(fqdn string, ups []upstream.Upstream) {
+	if ov.fqdn != "" && ov.fqdn != fqdn {
+		return
+	}
+
+	for i, u := range ups {
+		if _, ok := u.(*ttlUpstream); ok || (ov.addr != "" && u.Address() != ov.addr) {
+			continue
+		}
+
+		ups[i] = &ttlUpstream{
+			Upstream: u,
+			minTTL:   ov.minTTL,
+			maxTTL:   ov.maxTTL,
+		}
+	}
+}
+
+// applyTTLOverrides validates overrides and wraps the matching upstreams of uc
+// with the TTL clamping ones.  The first matching override wins.
+func applyTTLOverrides(uc *proxy.UpstreamConfig, overrides []*UpstreamTTLOverride) (err error) {
+	for i, o := range overrides {
+		var ov *ttlOverride
+		ov, err = newTTLOverride(o)
+		if err != nil {
+			return fmt.Errorf("upstream ttl override at index %d: %w", i, err)
+		}
+
+		ov.wrap("", uc.Upstreams)
+		for fqdn, ups := range uc.DomainReservedUpstreams {
+			ov.wrap(fqdn, ups)
+		}
+
+		for fqdn, ups := range uc.SpecifiedDomainUpstreams {
+			ov.wrap(fqdn, ups)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClampTTLs(t *testing.T) {
+	newA := func(ttl uint32) (rr dns.RR) {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: "example.", Rrtype: dns.TypeA, Ttl: ttl},
+			A:   net.IP{192, 0, 2, 1},
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		ttl     uint32
+		minTTL  uint32
+		maxTTL  uint32
+		wantTTL uint32
+	}{{
+		name:    "within",
+		ttl:     100,
+		minTTL:  10,
+		maxTTL:  1000,
+		wantTTL: 100,
+	}, {
+		name:    "below",
+		ttl:     1,
+		minTTL:  10,
+		maxTTL:  1000,
+		wantTTL: 10,
+	}, {
+		name:    "above",
+		ttl:     10000,
+		minTTL:  10,
+		maxTTL:  1000,
+		wantTTL: 1000,
+	}, {
+		name:    "no_max",
+		ttl:     10000,
+		minTTL:  10,
+		maxTTL:  0,
+		wantTTL: 10000,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &dns.Msg{
+				Answer: []dns.RR{newA(tc.ttl)},
+				Ns:     []dns.RR{newA(tc.ttl)},
+			}
+			msg.SetEdns0(dns.DefaultMsgSize, false)
+
+			clampTTLs(msg, tc.minTTL, tc.maxTTL)
+
+			assert.Equal(t, tc.wantTTL, msg.Answer[0].Header().Ttl)
+			assert.Equal(t, tc.wantTTL, msg.Ns[0].Header().Ttl)
+			assert.Zero(t, msg.IsEdns0().Hdr.Ttl)
+		})
+	}
+}
+
+func TestApplyTTLOverrides(t *testing.T) {
+	const (
+		defUps    = "192.0.2.1"
+		corpUps   = "192.0.2.2"
+		corpFQDN  = "corp.example."
+		otherFQDN = "other.example."
+	)
+
+	newConf := func(t *testing.T) (uc *proxy.UpstreamConfig) {
+		t.Helper()
+
+		uc, err := proxy.ParseUpstreamsConfig([]string{
+			defUps,
+			"[/corp.example/]" + corpUps + " " + defUps,
+			"[/other.example/]" + corpUps,
+		}, &upstream.Options{})
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+		return uc
+	}
+
+	isWrapped := func(u upstream.Upstream) (ok bool) {
+		_, ok = u.(*ttlUpstream)
+
+		return ok
+	}
+
+	t.Run("upstream", func(t *testing.T) {
+		uc := newConf(t)
+		err := applyTTLOverrides(uc, []*UpstreamTTLOverride{{
+			Upstream: corpUps,
+			MaxTTL:   60,
+		}})
+		require.NoError(t, err)
+
+		assert.False(t, isWrapped(uc.Upstreams[0]))
+		assert.True(t, isWrapped(uc.DomainReservedUpstreams[corpFQDN][0]))
+		assert.False(t, isWrapped(uc.DomainReservedUpstreams[corpFQDN][1]))
+		assert.True(t, isWrapped(uc.DomainReservedUpstreams[otherFQDN][0]))
+	})
+
+	t.Run("domain", func(t *testing.T) {
+		uc := newConf(t)
+		err := applyTTLOverrides(uc, []*UpstreamTTLOverride{{
+			Domain: "Corp.Example",
+			MinTTL: 10,
+		}})
+		require.NoError(t, err)
+
+		assert.False(t, isWrapped(uc.Upstreams[0]))
+		assert.True(t, isWrapped(uc.DomainReservedUpstreams[corpFQDN][0]))
+		assert.True(t, isWrapped(uc.DomainReservedUpstreams[corpFQDN][1]))
+		assert.False(t, isWrapped(uc.DomainReservedUpstreams[otherFQDN][0]))
+	})
+
+	t.Run("first_wins", func(t *testing.T) {
+		uc := newConf(t)
+		err := applyTTLOverrides(uc, []*UpstreamTTLOverride{{
+			Upstream: defUps,
+			Domain:   corpFQDN,
+			MaxTTL:   60,
+		}, {
+			Upstream: defUps,
+			MaxTTL:   3600,
+		}})
+		require.NoError(t, err)
+
+		u, ok := uc.DomainReservedUpstreams[corpFQDN][1].(*ttlUpstream)
+		require.True(t, ok)
+
+		assert.Equal(t, uint32(60), u.maxTTL)
+
+		u, ok = uc.Upstreams[0].(*ttlUpstream)
+		require.True(t, ok)
+
+		assert.Equal(t, uint32(3600), u.maxTTL)
+	})
+
+	errTestCases := []struct {
+		ov         *UpstreamTTLOverride
+		name       string
+		wantErrMsg string
+	}{{
+		ov:         nil,
+		name:       "nil",
+		wantErrMsg: "upstream ttl override at index 0: no value",
+	}, {
+		ov:         &UpstreamTTLOverride{MinTTL: 10},
+		name:       "no_match",
+		wantErrMsg: "upstream ttl override at index 0: upstream or domain must be set",
+	}, {
+		ov:   &UpstreamTTLOverride{Upstream: defUps, MinTTL: 100, MaxTTL: 10},
+		name: "bad_bounds",
+		wantErrMsg: "upstream ttl override at index 0: " +
+			"min_ttl must be less than or equal to max_ttl",
+	}, {
+		ov:   &UpstreamTTLOverride{Domain: "bad!"},
+		name: "bad_domain",
+		wantErrMsg: `upstream ttl override at index 0: domain: bad domain name "bad!": ` +
+			`bad top-level domain name label "bad!": bad top-level domain name label rune '!'`,
+	}}
+
+	for _, tc := range errTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := applyTTLOverrides(newConf(t), []*UpstreamTTLOverride{tc.ov})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// newWarmUpDomains validates the names of the domains to resolve on startup and
+// returns them as lowercased fully-qualified domain names.
+func newWarmUpDomains(names []string) (fqdns []string, err error) {
+	names = stringutil.FilterOut(names, IsCommentOrEmpty)
+	for i, name := range names {
+		name, err = aghnet.ParseDomainName(name)
+		if err != nil {
+			return nil, fmt.Errorf("warm-up domain at index %d: %w", i, err)
+		}
+
+		fqdns = append(fqdns, dns.Fqdn(name))
+	}
+
+	return fqdns, nil
+}
+
+// warmUpQTypes are the types of queries sent for each warm-up domain.
+var warmUpQTypes = []uint16{dns.TypeA, dns.TypeAAAA}
+
+// startWarmUpLocked starts warming up the cache in the background, if there
+// are any warm-up domains and the cache is enabled.  s.serverLock is expected
+// to be locked.
+func (s *Server) startWarmUpLocked() {
+	if len(s.warmUpDomains) == 0 || s.conf.CacheSize == 0 {
+		return
+	}
+
+	go s.warmUpCache(s.warmUpDomains)
+}
+
+// warmUpCache resolves each of fqdns through the DNS proxy so that the
+// responses are put into the cache.  It is intended to be used as a goroutine.
+func (s *Server) warmUpCache(fqdns []string) {
+	defer log.OnPanic("dnsforward: warming up cache")
+
+	log.Debug("dnsforward: warming up cache with %d domains", len(fqdns))
+
+	for _, fqdn := range fqdns {
+		for _, qt := range warmUpQTypes {
+			prx := s.proxy()
+			if prx == nil {
+				log.Debug("dnsforward: warming up cache: %s", srvClosedErr)
+
+				return
+			}
+
+			dctx := &proxy.DNSContext{
+				Proto: proxy.ProtoUDP,
+				Req:   (&dns.Msg{}).SetQuestion(fqdn, qt),
+				Addr:  netip.AddrPortFrom(netutil.IPv4Localhost(), 0),
+			}
+
+			err := prx.Resolve(dctx)
+			if err != nil {
+				log.Info("dnsforward: warming up cache: resolving %s %s: %s", dns.Type(qt), fqdn, err)
+			}
+		}
+	}
+
+	log.Info("dnsforward: warmed up cache with %d domains", len(fqdns))
+}
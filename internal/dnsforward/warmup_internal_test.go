@@ -0,0 +1,101 @@
+package dnsforward
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWarmUpDomains(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		names      []string
+		want       []string
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		names:      []string{"# comment", "Example.org", "time.example.com."},
+		want:       []string{"example.org.", "time.example.com."},
+	}, {
+		name:       "empty",
+		wantErrMsg: "",
+		names:      nil,
+		want:       nil,
+	}, {
+		name: "bad_domain",
+		wantErrMsg: `warm-up domain at index 1: bad domain name "bad!": ` +
+			`bad top-level domain name label "bad!": bad top-level domain name label rune '!'`,
+		names: []string{"example.org", "bad!"},
+		want:  nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newWarmUpDomains(tc.names)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestServer_warmUpCache(t *testing.T) {
+	const host = "warm.example."
+
+	var reqNum atomic.Int32
+	upsAddr := newLocalUpstreamListener(t, 0, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reqNum.Add(1)
+
+		resp := (&dns.Msg{}).SetReply(req)
+		if req.Question[0].Qtype == dns.TypeA {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    3600,
+				},
+				A: net.IP{192, 0, 2, 1},
+			})
+		}
+
+		require.NoError(testutil.PanicT{}, w.WriteMsg(resp))
+	}))
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		Config: Config{
+			UpstreamDNS:      []string{"tcp://" + upsAddr.String()},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			CacheSize:        64 * 1024,
+			WarmUpDomains:    []string{host},
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+		},
+		ServePlainDNS: true,
+	})
+	startDeferStop(t, s)
+
+	wantReqNum := int32(len(warmUpQTypes))
+	require.Eventually(t, func() (ok bool) {
+		return reqNum.Load() == wantReqNum
+	}, time.Second, 10*time.Millisecond)
+
+	addr := s.dnsProxy.Addr(proxy.ProtoUDP)
+	reply, err := dns.Exchange(createTestMessage(host), addr.String())
+	require.NoError(t, err)
+	require.Len(t, reply.Answer, 1)
+
+	assert.Equal(t, wantReqNum, reqNum.Load())
+}
@@ -0,0 +1,332 @@
+package dnsforward
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// UpstreamWeight is the weight of a single upstream in the
+// [UpstreamModeWeighted] mode.
+type UpstreamWeight struct {
+	// Upstream is the address of the upstream, as written in the upstream
+	// configuration.  It must not be empty.
+	Upstream string `yaml:"upstream"`
+
+	// Weight is the share of the requests sent to the upstream relative to the
+	// other ones, while their latencies are the same.  It must be positive.
+	Weight uint `yaml:"weight"`
+}
+
+// defaultUpstreamWeight is the weight of the upstreams without a configured
+// one.
+const defaultUpstreamWeight = 1
+
+// rttEWMAFactor is the smoothing factor of the exponentially weighted moving
+// average of the round-trip times of the upstreams.
+const rttEWMAFactor = 0.2
+
+// weightedUpstream is an [upstream.Upstream] that distributes the requests
+// among several upstreams using the smooth weighted round-robin algorithm.  The
+// configured weights are scaled by the latencies of the upstreams, so that a
+// slow or an overloaded one receives less requests and the others absorb the
+// overflow.  If the exchange fails, the rest of the upstreams are tried in the
+// order of their weights.
+type weightedUpstream struct {
+	// used are the requests of which the actually used upstreams are tracked.
+	used *usedUpstreams
+
+	// mu protects the dynamic fields of members.
+	mu *sync.Mutex
+
+	// members are the upstreams requests are distributed among.
+	members []*weightedMember
+
+	// addr is the address of the upstream reported until the actual one is
+	// known.
+	addr string
+}
+
+// weightedMember is a single upstream of a [weightedUpstream].
+type weightedMember struct {
+	upstream.Upstream
+
+	// weight is the configured weight.
+	weight float64
+
+	// current is the current weight of the smooth weighted round-robin.
+	current float64
+
+	// rtt is the average round-trip time of the exchanges in microseconds.
+	// It's zero until the first exchange.
+	rtt float64
+}
+
+// type check
+var _ upstream.Upstream = (*weightedUpstream)(nil)
+
+// newWeightedUpstream returns a new properly initialized *weightedUpstream.
+// ups must not be empty.
+func newWeightedUpstream(
+	ups []upstream.Upstream,
+	weights map[string]uint,
+	used *usedUpstreams,
+) (w *weightedUpstream) {
+	addrs := make([]string, 0, len(ups))
+	w = &weightedUpstream{
+		used:    used,
+		mu:      &sync.Mutex{},
+		members: make([]*weightedMember, 0, len(ups)),
+	}
+
+	for _, u := range ups {
+		addr := u.Address()
+		addrs = append(addrs, addr)
+		w.members = append(w.members, &weightedMember{
+			Upstream: u,
+			weight:   float64(cmp.Or(weights[addr], defaultUpstreamWeight)),
+		})
+	}
+
+	w.addr = fmt.Sprintf("weighted(%s)", strings.Join(addrs, ", "))
+
+	return w
+}
+
+// Address implements the [upstream.Upstream] interface for *weightedUpstream.
+func (w *weightedUpstream) Address() (addr string) {
+	return w.addr
+}
+
+// Exchange implements the [upstream.Upstream] interface for *weightedUpstream.
+func (w *weightedUpstream) Exchange(req *dns.Msg) (resp *dns.Msg, err error) {
+	resp, u, err := w.exchange(req)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	w.used.set(req, u)
+
+	return resp, nil
+}
+
+// exchange resolves req using the members and returns the response along with
+// the member that has actually resolved it.
+func (w *weightedUpstream) exchange(req *dns.Msg) (resp *dns.Msg, u upstream.Upstream, err error) {
+	var errs []error
+	for _, m := range w.order() {
+		start := time.Now()
+		resp, err = m.Exchange(req)
+		if err == nil {
+			w.update(m, time.Since(start))
+
+			return resp, m.Upstream, nil
+		}
+
+		errs = append(errs, err)
+
+		// Penalize the failed upstream as if it has timed out.
+		w.update(m, DefaultTimeout)
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return nil, nil, errors.Join(errs...)
+}
+
+// order returns the members in the order they should be tried in for the next
+// request.  The first one is chosen using the smooth weighted round-robin
+// algorithm, while the rest are sorted by their effective weights.
+func (w *weightedUpstream) order() (ordered []*weightedMember) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	minRTT := 0.0
+	for _, m := range w.members {
+		if m.rtt > 0 && (minRTT == 0 || m.rtt < minRTT) {
+			minRTT = m.rtt
+		}
+	}
+
+	effective := make(map[*weightedMember]float64, len(w.members))
+	total := 0.0
+	var chosen *weightedMember
+	for _, m := range w.members {
+		e := m.weight
+		if m.rtt > 0 {
+			e *= minRTT / m.rtt
+		}
+
+		effective[m] = e
+		total += e
+		m.current += e
+		if chosen == nil || m.current > chosen.current {
+			chosen = m
+		}
+	}
+
+	chosen.current -= total
+
+	ordered = slices.Clone(w.members)
+	slices.SortStableFunc(ordered, func(a, b *weightedMember) (res int) {
+		switch {
+		case a == chosen:
+			return -1
+		case b == chosen:
+			return 1
+		default:
+			return cmp.Compare(effective[b], effective[a])
+		}
+	})
+
+	return ordered
+}
+
+// update adds the round-trip time of an exchange with m to its average.
+func (w *weightedUpstream) update(m *weightedMember, rtt time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	us := float64(rtt.Microseconds())
+	if m.rtt == 0 {
+		m.rtt = us
+	} else {
+		m.rtt += rttEWMAFactor * (us - m.rtt)
+	}
+}
+
+// Close implements the [upstream.Upstream] interface for *weightedUpstream.
+func (w *weightedUpstream) Close() (err error) {
+	var errs []error
+	for _, m := range w.members {
+		err = m.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", m.Address(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// usedUpstreams tracks the upstreams a [weightedUpstream] or a [modeUpstream]
+// actually uses for the requests, so that they're reported in the query log and the statistics
+// instead of the weighted one.
+type usedUpstreams struct {
+	// mu protects reqs.
+	mu *sync.Mutex
+
+	// reqs are the tracked requests.  The values are nil until an upstream is
+	// used.
+	reqs map[*dns.Msg]upstream.Upstream
+}
+
+// newUsedUpstreams returns a new properly initialized *usedUpstreams.
+func newUsedUpstreams() (u *usedUpstreams) {
+	return &usedUpstreams{
+		mu:   &sync.Mutex{},
+		reqs: map[*dns.Msg]upstream.Upstream{},
+	}
+}
+
+// track starts tracking the upstream used for req.
+func (u *usedUpstreams) track(req *dns.Msg) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reqs[req] = nil
+}
+
+// set sets the upstream used for req if it's tracked.
+func (u *usedUpstreams) set(req *dns.Msg, ups upstream.Upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.reqs[req]; ok {
+		u.reqs[req] = ups
+	}
+}
+
+// finish stops tracking req and returns the upstream used for it, if any.
+func (u *usedUpstreams) finish(req *dns.Msg) (ups upstream.Upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ups = u.reqs[req]
+	delete(u.reqs, req)
+
+	return ups
+}
+
+// newUpstreamWeights validates weights and returns them by the normalized
+// upstream addresses.
+func newUpstreamWeights(weights []*UpstreamWeight) (byAddr map[string]uint, err error) {
+	byAddr = make(map[string]uint, len(weights))
+	for i, w := range weights {
+		if w == nil {
+			return nil, fmt.Errorf("at index %d: %w", i, errors.ErrNoValue)
+		} else if w.Weight == 0 {
+			return nil, fmt.Errorf("at index %d: weight must be positive", i)
+		}
+
+		var addr string
+		addr, err = upstreamAddress(w.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: upstream: %w", i, err)
+		}
+
+		byAddr[addr] = w.Weight
+	}
+
+	return byAddr, nil
+}
+
+// applyUpstreamWeights validates weights and replaces each list of several
+// upstreams in uc with a single [weightedUpstream] distributing the requests
+// among them.  It must be called after any other wrapping of the upstreams.
+func applyUpstreamWeights(
+	uc *proxy.UpstreamConfig,
+	weights []*UpstreamWeight,
+	used *usedUpstreams,
+) (err error) {
+	byAddr, err := newUpstreamWeights(weights)
+	if err != nil {
+		return fmt.Errorf("upstream weights: %w", err)
+	}
+
+	wrap := func(ups []upstream.Upstream) (wrapped []upstream.Upstream) {
+		if len(ups) < 2 {
+			return ups
+		}
+
+		return []upstream.Upstream{newWeightedUpstream(ups, byAddr, used)}
+	}
+
+	uc.Upstreams = wrap(uc.Upstreams)
+	for d, ups := range uc.DomainReservedUpstreams {
+		uc.DomainReservedUpstreams[d] = wrap(ups)
+	}
+
+	for d, ups := range uc.SpecifiedDomainUpstreams {
+		uc.SpecifiedDomainUpstreams[d] = wrap(ups)
+	}
+
+	return nil
+}
+
+// setWeightedUpstream replaces the [weightedUpstream] in pctx, if any, with the
+// upstream it has actually used for req.  It must be called after resolving
+// req, which must be tracked in s.usedUpstreams.
+func (s *Server) setWeightedUpstream(pctx *proxy.DNSContext, req *dns.Msg) {
+	u := s.usedUpstreams.finish(req)
+	if _, ok := pctx.Upstream.(*weightedUpstream); ok && u != nil {
+		pctx.Upstream = u
+	}
+}
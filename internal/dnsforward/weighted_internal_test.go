@@ -0,0 +1,138 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWeightedTestUpstream returns a mock upstream with addr, which fails if err
+// is not nil, and counts the exchanges in num.
+func newWeightedTestUpstream(addr string, num *int, err error) (u upstream.Upstream) {
+	return &aghtest.UpstreamMock{
+		OnAddress: func() (a string) { return addr },
+		OnExchange: func(req *dns.Msg) (resp *dns.Msg, exchErr error) {
+			*num++
+			if err != nil {
+				return nil, err
+			}
+
+			return (&dns.Msg{}).SetReply(req), nil
+		},
+		OnClose: func() (err error) { return nil },
+	}
+}
+
+func TestWeightedUpstream_Exchange(t *testing.T) {
+	const reqsNum = 100
+
+	t.Run("weights", func(t *testing.T) {
+		var localNum, cloudNum int
+		w := newWeightedUpstream([]upstream.Upstream{
+			newWeightedTestUpstream("local", &localNum, nil),
+			newWeightedTestUpstream("cloud", &cloudNum, nil),
+		}, map[string]uint{"local": 9}, newUsedUpstreams())
+
+		// Make the latencies equal.
+		for _, m := range w.members {
+			m.rtt = 1
+		}
+
+		// Keep the latencies equal by not updating them.
+		for range reqsNum {
+			ordered := w.order()
+			require.Len(t, ordered, 2)
+
+			_, err := ordered[0].Exchange(createTestMessage("example.org."))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 90, localNum)
+		assert.Equal(t, 10, cloudNum)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		var localNum, cloudNum int
+		w := newWeightedUpstream([]upstream.Upstream{
+			newWeightedTestUpstream("local", &localNum, nil),
+			newWeightedTestUpstream("cloud", &cloudNum, nil),
+		}, map[string]uint{"local": 9}, newUsedUpstreams())
+
+		// Make the local upstream nine times slower.
+		w.members[0].rtt = 9
+		w.members[1].rtt = 1
+
+		for range reqsNum {
+			_, err := w.order()[0].Exchange(createTestMessage("example.org."))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, 50, localNum)
+		assert.Equal(t, 50, cloudNum)
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		var localNum, cloudNum int
+		used := newUsedUpstreams()
+		cloud := newWeightedTestUpstream("cloud", &cloudNum, nil)
+		w := newWeightedUpstream([]upstream.Upstream{
+			newWeightedTestUpstream("local", &localNum, errors.Error("test error")),
+			cloud,
+		}, map[string]uint{"local": 9}, used)
+
+		req := createTestMessage("example.org.")
+		used.track(req)
+
+		_, err := w.Exchange(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, localNum)
+		assert.Equal(t, 1, cloudNum)
+		assert.Equal(t, cloud, used.finish(req))
+		assert.Empty(t, used.reqs)
+	})
+}
+
+func TestApplyUpstreamWeights(t *testing.T) {
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		"127.0.0.1:53",
+		"127.0.0.2:53",
+		"[/example.org/]127.0.0.3:53",
+	}, &upstream.Options{})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, uc.Close)
+
+	err = applyUpstreamWeights(uc, []*UpstreamWeight{{
+		Upstream: "127.0.0.1",
+		Weight:   9,
+	}}, newUsedUpstreams())
+	require.NoError(t, err)
+
+	require.Len(t, uc.Upstreams, 1)
+
+	w, ok := uc.Upstreams[0].(*weightedUpstream)
+	require.True(t, ok)
+	require.Len(t, w.members, 2)
+
+	assert.Equal(t, 9.0, w.members[0].weight)
+	assert.Equal(t, 1.0, w.members[1].weight)
+
+	ups := uc.DomainReservedUpstreams["example.org."]
+	require.Len(t, ups, 1)
+
+	_, ok = ups[0].(*weightedUpstream)
+	assert.False(t, ok)
+
+	err = applyUpstreamWeights(uc, []*UpstreamWeight{{
+		Upstream: "127.0.0.1",
+		Weight:   0,
+	}}, newUsedUpstreams())
+	testutil.AssertErrorMsg(t, "upstream weights: at index 0: weight must be positive", err)
+}
@@ -0,0 +1,653 @@
+// Package dnsmasq converts the configuration of dnsmasq into the one of AdGuard
+// Home.
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Config is the configuration converted from dnsmasq.
+type Config struct {
+	// DHCP is the DHCPv4 server configuration converted from the dhcp-range
+	// and dhcp-option directives.  It's nil if there are none.
+	DHCP *DHCP
+
+	// Rules are the filtering rules converted from the address directives
+	// without an IP address.
+	Rules []string
+
+	// Rewrites are the rewrites converted from the address and cname
+	// directives.
+	Rewrites []*Rewrite
+
+	// Upstreams are the upstream DNS servers converted from the server and
+	// local directives.
+	Upstreams []string
+
+	// StaticLeases are the DHCPv4 static leases converted from the dhcp-host
+	// directives.
+	StaticLeases []*StaticLease
+
+	// Warnings describe the directives which couldn't be converted and have
+	// been skipped.
+	Warnings []string
+}
+
+// Rewrite is a DNS rewrite.
+type Rewrite struct {
+	// Domain is the domain name pattern to rewrite.
+	Domain string
+
+	// Answer is the IP address or the domain name of the response.
+	Answer string
+}
+
+// StaticLease is a DHCPv4 static lease.
+type StaticLease struct {
+	// HWAddr is the hardware address of the client.
+	HWAddr net.HardwareAddr
+
+	// IP is the IPv4 address of the lease.
+	IP netip.Addr
+
+	// Hostname is the optional hostname of the client.
+	Hostname string
+}
+
+// DHCP is the DHCPv4 server configuration.  Zero fields are not configured.
+type DHCP struct {
+	// GatewayIP is the IPv4 address of the router.
+	GatewayIP netip.Addr
+
+	// SubnetMask is the subnet mask of the network.
+	SubnetMask netip.Addr
+
+	// RangeStart is the first address of the range of the dynamic leases.
+	RangeStart netip.Addr
+
+	// RangeEnd is the last address of the range of the dynamic leases.
+	RangeEnd netip.Addr
+
+	// Options are the DHCPv4 options in the format of the dhcpd package, for
+	// example "6 ips 192.168.1.1,192.168.1.2".
+	Options []string
+
+	// LeaseDuration is the duration of the dynamic leases.
+	LeaseDuration time.Duration
+}
+
+// Parse converts the dnsmasq configuration file read from r.  Only the
+// address, server, local, cname, dhcp-host, dhcp-range, and dhcp-option
+// directives are converted, the other ones are reported in the warnings.
+func Parse(r io.Reader) (conf *Config, err error) {
+	p := &parser{
+		conf: &Config{},
+	}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		p.line++
+		p.parseLine(s.Text())
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return p.conf, nil
+}
+
+// parser is the state of parsing a dnsmasq configuration file.
+type parser struct {
+	// conf is the resulting configuration.
+	conf *Config
+
+	// line is the number of the current line.
+	line int
+
+	// hasRange is true if a dhcp-range directive has already been converted.
+	hasRange bool
+}
+
+// warn adds a formatted warning about the current line.
+func (p *parser) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	p.conf.Warnings = append(p.conf.Warnings, fmt.Sprintf("line %d: %s", p.line, msg))
+}
+
+// parseLine converts the directive from the line.
+func (p *parser) parseLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return
+	}
+
+	name, val, _ := strings.Cut(line, "=")
+	name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+
+	switch name {
+	case "address":
+		p.parseAddress(val)
+	case "server", "local":
+		p.parseServer(val)
+	case "cname":
+		p.parseCNAME(val)
+	case "dhcp-host":
+		p.parseDHCPHost(val)
+	case "dhcp-range":
+		p.parseDHCPRange(val)
+	case "dhcp-option", "dhcp-option-force":
+		p.parseDHCPOption(val)
+	case "conf-file", "conf-dir", "addn-hosts", "servers-file":
+		p.warn("%s %q: included files must be imported separately", name, val)
+	default:
+		p.warn("directive %q is not supported", name)
+	}
+}
+
+// splitDomains splits the value in the format "/domain[/domain...]/rest" into
+// the domains and the rest.  ok is false if val has no domains.
+func splitDomains(val string) (domains []string, rest string, ok bool) {
+	if !strings.HasPrefix(val, "/") {
+		return nil, val, false
+	}
+
+	parts := strings.Split(val[1:], "/")
+	if len(parts) < 2 {
+		return nil, val, false
+	}
+
+	return parts[:len(parts)-1], parts[len(parts)-1], true
+}
+
+// parseAddress converts the address directive, which makes dnsmasq respond
+// with the IP address for the domains and all their subdomains or block them,
+// if there is no IP address.
+func (p *parser) parseAddress(val string) {
+	domains, answer, ok := splitDomains(val)
+	if !ok {
+		p.warn("address %q: no domains", val)
+
+		return
+	}
+
+	var ip netip.Addr
+	if answer != "" && answer != "#" {
+		var err error
+		ip, err = netip.ParseAddr(answer)
+		if err != nil {
+			p.warn("address %q: %s", val, err)
+
+			return
+		}
+	}
+
+	for _, d := range domains {
+		if d == "" || d == "#" || strings.HasPrefix(d, "*") {
+			p.warn("address %q: domain %q is not supported", val, d)
+
+			continue
+		}
+
+		if !ip.IsValid() {
+			p.conf.Rules = append(p.conf.Rules, "||"+d+"^")
+
+			continue
+		}
+
+		p.conf.Rewrites = append(p.conf.Rewrites, &Rewrite{
+			Domain: d,
+			Answer: ip.String(),
+		}, &Rewrite{
+			Domain: "*." + d,
+			Answer: ip.String(),
+		})
+	}
+}
+
+// parseServer converts the server and local directives into an upstream DNS
+// server, optionally for the domains.
+func (p *parser) parseServer(val string) {
+	domains, addr, hasDomains := splitDomains(val)
+
+	var upstream string
+	switch addr {
+	case "":
+		p.warn("server %q: local-only domains are not supported", val)
+
+		return
+	case "#":
+		if !hasDomains {
+			p.warn("server %q: no domains", val)
+
+			return
+		}
+
+		upstream = "#"
+	default:
+		var err error
+		upstream, err = p.parseServerAddr(val, addr)
+		if err != nil {
+			p.warn("server %q: %s", val, err)
+
+			return
+		}
+	}
+
+	if hasDomains && (len(domains) != 1 || domains[0] != "#") {
+		upstream = "[/" + strings.Join(domains, "/") + "/]" + upstream
+	}
+
+	p.conf.Upstreams = append(p.conf.Upstreams, upstream)
+}
+
+// defaultPort is the default port of the upstream DNS servers.
+const defaultPort = 53
+
+// parseServerAddr converts the address of the upstream server in the format
+// "ip[#port][@source]".  The IPv6 addresses are always converted with the port
+// to avoid ambiguity.
+func (p *parser) parseServerAddr(val, addr string) (upstream string, err error) {
+	addr, src, ok := strings.Cut(addr, "@")
+	if ok {
+		p.warn("server %q: source %q is ignored", val, src)
+	}
+
+	addr, portStr, hasPort := strings.Cut(addr, "#")
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return "", err
+	}
+
+	port := uint64(defaultPort)
+	if hasPort {
+		port, err = strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return "", fmt.Errorf("bad port %q: %w", portStr, err)
+		}
+	}
+
+	if port == defaultPort && ip.Is4() {
+		return ip.String(), nil
+	}
+
+	return netip.AddrPortFrom(ip, uint16(port)).String(), nil
+}
+
+// parseCNAME converts the cname directive in the format
+// "cname[,cname...],target[,ttl]".
+func (p *parser) parseCNAME(val string) {
+	parts := strings.Split(val, ",")
+	if _, err := strconv.ParseUint(parts[len(parts)-1], 10, 32); err == nil {
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) < 2 {
+		p.warn("cname %q: no target", val)
+
+		return
+	}
+
+	target := strings.TrimSpace(parts[len(parts)-1])
+	for _, alias := range parts[:len(parts)-1] {
+		p.conf.Rewrites = append(p.conf.Rewrites, &Rewrite{
+			Domain: strings.TrimSpace(alias),
+			Answer: target,
+		})
+	}
+}
+
+// unsupportedPrefix returns the prefix of the field if it's one of the
+// matching and tagging prefixes, which AdGuard Home doesn't support.
+func unsupportedPrefix(field string) (prefix string, ok bool) {
+	for _, prefix = range []string{
+		"encap:",
+		"id:",
+		"set:",
+		"tag:",
+		"vendor:",
+		"vi-encap:",
+	} {
+		if strings.HasPrefix(field, prefix) {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
+
+// parseDHCPHost converts the dhcp-host directive with a hardware and an IPv4
+// address into a static lease.
+func (p *parser) parseDHCPHost(val string) {
+	l := &StaticLease{}
+	for _, f := range strings.Split(val, ",") {
+		f = strings.TrimSpace(f)
+		if prefix, ok := unsupportedPrefix(f); ok {
+			p.warn("dhcp host %q: %q is not supported", val, prefix)
+
+			return
+		}
+
+		if ip, err := netip.ParseAddr(f); err == nil && ip.Is4() {
+			l.IP = ip
+		} else if mac, macErr := net.ParseMAC(f); macErr == nil {
+			l.HWAddr = mac
+		} else if f == "ignore" || strings.ContainsAny(f, ":[*") {
+			p.warn("dhcp host %q: %q is not supported", val, f)
+
+			return
+		} else if !isLeaseTime(f) {
+			l.Hostname = strings.ToLower(f)
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.IsValid() {
+		p.warn("dhcp host %q: static leases require a hardware and an ipv4 address", val)
+
+		return
+	}
+
+	if l.Hostname != "" {
+		err := netutil.ValidateHostname(l.Hostname)
+		if err != nil {
+			p.warn("dhcp host %q: %s", val, err)
+
+			return
+		}
+	}
+
+	p.conf.StaticLeases = append(p.conf.StaticLeases, l)
+}
+
+// isLeaseTime returns true if s is a lease time of dnsmasq.
+func isLeaseTime(s string) (ok bool) {
+	_, err := parseLeaseTime(s)
+
+	return err == nil || s == "infinite"
+}
+
+// parseLeaseTime parses the lease time in the dnsmasq format, which is a number
+// of seconds optionally followed by the unit.
+func parseLeaseTime(s string) (d time.Duration, err error) {
+	unit := time.Second
+	switch {
+	case strings.HasSuffix(s, "m"):
+		unit = time.Minute
+	case strings.HasSuffix(s, "h"):
+		unit = time.Hour
+	case strings.HasSuffix(s, "d"):
+		unit = timeutil.Day
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * timeutil.Day
+	case strings.HasSuffix(s, "s"):
+		// Go on.
+	default:
+		s += "s"
+	}
+
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return 0, err
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// dhcp returns the DHCP configuration of p.conf, creating it if needed.
+func (p *parser) dhcp() (c *DHCP) {
+	if p.conf.DHCP == nil {
+		p.conf.DHCP = &DHCP{}
+	}
+
+	return p.conf.DHCP
+}
+
+// parseDHCPRange converts the first IPv4 dhcp-range directive in the format
+// "start,end[,netmask[,broadcast]][,lease]".
+func (p *parser) parseDHCPRange(val string) {
+	fields := strings.Split(val, ",")
+	if prefix, ok := unsupportedPrefix(fields[0]); ok {
+		p.warn("dhcp range %q: %q is not supported", val, prefix)
+
+		return
+	} else if p.hasRange {
+		p.warn("dhcp range %q: only one range is supported", val)
+
+		return
+	} else if len(fields) < 2 {
+		p.warn("dhcp range %q: no range end", val)
+
+		return
+	}
+
+	var addrs []netip.Addr
+	for _, f := range fields {
+		ip, err := netip.ParseAddr(strings.TrimSpace(f))
+		if err != nil {
+			break
+		} else if !ip.Is4() {
+			p.warn("dhcp range %q: only ipv4 is supported", val)
+
+			return
+		}
+
+		addrs = append(addrs, ip)
+	}
+
+	if len(addrs) < 2 {
+		p.warn("dhcp range %q: only ranges of addresses are supported", val)
+
+		return
+	}
+
+	c := p.dhcp()
+	c.RangeStart, c.RangeEnd = addrs[0], addrs[1]
+	if len(addrs) > 2 {
+		c.SubnetMask = addrs[2]
+	}
+
+	if len(fields) > len(addrs) {
+		lease := strings.TrimSpace(fields[len(addrs)])
+		d, err := parseLeaseTime(lease)
+		if err != nil {
+			p.warn("dhcp range %q: lease time %q is not supported", val, lease)
+		} else {
+			c.LeaseDuration = d
+		}
+	}
+
+	p.hasRange = true
+}
+
+// Codes of the DHCPv4 options converted into the fields of [DHCP].
+const (
+	optCodeNetmask uint64 = 1
+	optCodeRouter  uint64 = 3
+)
+
+// optNames are the names of the DHCPv4 options supported by dnsmasq mapped to
+// their codes.
+var optNames = map[string]uint64{
+	"netmask":                 optCodeNetmask,
+	"router":                  optCodeRouter,
+	"dns-server":              6,
+	"log-server":              7,
+	"lpr-server":              9,
+	"hostname":                12,
+	"domain-name":             15,
+	"swap-server":             16,
+	"root-path":               17,
+	"extension-path":          18,
+	"ip-forward-enable":       19,
+	"max-datagram-reassembly": 22,
+	"default-ttl":             23,
+	"mtu":                     26,
+	"broadcast":               28,
+	"router-discovery":        31,
+	"tcp-ttl":                 37,
+	"nis-domain":              40,
+	"nis-server":              41,
+	"ntp-server":              42,
+	"netbios-ns":              44,
+	"netbios-dd":              45,
+	"netbios-nodetype":        46,
+	"netbios-scope":           47,
+	"lease-time":              51,
+	"T1":                      58,
+	"T2":                      59,
+	"tftp-server":             66,
+	"bootfile-name":           67,
+	"domain-search":           119,
+}
+
+// optTypes are the types of the values of the supported DHCPv4 options in the
+// format of the dhcpd package.
+var optTypes = map[uint64]string{
+	6:   "ips",
+	7:   "ips",
+	9:   "ips",
+	12:  "text",
+	15:  "text",
+	16:  "ip",
+	17:  "text",
+	18:  "text",
+	19:  "bool",
+	22:  "u16",
+	23:  "u8",
+	26:  "u16",
+	28:  "ip",
+	31:  "bool",
+	37:  "u8",
+	40:  "text",
+	41:  "ips",
+	42:  "ips",
+	44:  "ips",
+	45:  "ips",
+	46:  "u8",
+	47:  "text",
+	51:  "dur",
+	58:  "dur",
+	59:  "dur",
+	66:  "text",
+	67:  "text",
+	252: "text",
+}
+
+// parseDHCPOption converts the dhcp-option directive in the format
+// "opt[,value...]", where opt is either a code or "option:name".
+func (p *parser) parseDHCPOption(val string) {
+	fields := strings.Split(val, ",")
+	for i, f := range fields {
+		fields[i] = strings.Trim(strings.TrimSpace(f), `"`)
+	}
+
+	if prefix, ok := unsupportedPrefix(fields[0]); ok {
+		p.warn("dhcp option %q: %q is not supported", val, prefix)
+
+		return
+	} else if strings.HasPrefix(fields[0], "option6:") {
+		p.warn("dhcp option %q: dhcpv6 options are not supported", val)
+
+		return
+	}
+
+	code, ok := optNames[strings.TrimPrefix(fields[0], "option:")]
+	if !ok {
+		var err error
+		code, err = strconv.ParseUint(fields[0], 10, 8)
+		if err != nil {
+			p.warn("dhcp option %q: unknown option %q", val, fields[0])
+
+			return
+		}
+	}
+
+	vals := fields[1:]
+	if len(vals) == 0 {
+		p.dhcp().Options = append(p.dhcp().Options, fmt.Sprintf("%d del", code))
+
+		return
+	}
+
+	for _, v := range vals {
+		if v == "0.0.0.0" {
+			p.warn("dhcp option %q: the address of the dnsmasq host is not supported", val)
+
+			return
+		}
+	}
+
+	switch code {
+	case optCodeNetmask, optCodeRouter:
+		p.parseDHCPAddrOption(val, code, vals)
+	default:
+		p.parseDHCPGenericOption(val, code, vals)
+	}
+}
+
+// parseDHCPAddrOption converts the router and netmask DHCP options into the
+// fields of [DHCP].
+func (p *parser) parseDHCPAddrOption(val string, code uint64, vals []string) {
+	ip, err := netip.ParseAddr(vals[0])
+	if err != nil || !ip.Is4() {
+		p.warn("dhcp option %q: bad ipv4 address %q", val, vals[0])
+
+		return
+	} else if len(vals) > 1 {
+		p.warn("dhcp option %q: only the first address is used", val)
+	}
+
+	if code == optCodeRouter {
+		p.dhcp().GatewayIP = ip
+	} else {
+		p.dhcp().SubnetMask = ip
+	}
+}
+
+// parseDHCPGenericOption converts the DHCP option with a known type of value.
+func (p *parser) parseDHCPGenericOption(val string, code uint64, vals []string) {
+	typ, ok := optTypes[code]
+	if !ok {
+		p.warn("dhcp option %q: option %d is not supported", val, code)
+
+		return
+	}
+
+	v := strings.Join(vals, ",")
+	switch typ {
+	case "dur":
+		d, err := parseLeaseTime(v)
+		if err != nil {
+			p.warn("dhcp option %q: %s", val, err)
+
+			return
+		}
+
+		v = timeutil.Duration{Duration: d}.String()
+	case "bool":
+		v = strconv.FormatBool(v != "0" && v != "false")
+	case "ips", "text":
+		// Go on.
+	default:
+		if len(vals) > 1 {
+			p.warn("dhcp option %q: only one value is supported", val)
+
+			return
+		}
+	}
+
+	p.dhcp().Options = append(p.dhcp().Options, fmt.Sprintf("%d %s %s", code, typ, v))
+}
@@ -0,0 +1,142 @@
+package dnsmasq_test
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConf is a dnsmasq configuration of a home router.
+const testConf = `# Router configuration
+domain-needed
+bogus-priv
+
+address=/ads.example/
+address=/tracker.example/#
+address=/nas.lan/files.lan/192.168.1.2
+address=/#/127.0.0.1
+
+server=1.1.1.1
+server=8.8.8.8#5353
+server=2606:4700:4700::1111
+server=/corp.example/10.0.0.1@eth0
+server=/a.example/b.example/#
+local=/lan/
+
+cname=alias.lan,nas.lan
+cname=a.lan,b.lan,router.lan,300
+
+dhcp-range=192.168.1.100,192.168.1.200,255.255.255.0,12h
+dhcp-range=192.168.2.100,192.168.2.200,12h
+dhcp-option=option:router,192.168.1.1
+dhcp-option=6,192.168.1.1,192.168.1.2
+dhcp-option=option:domain-name,lan
+dhcp-option=option:T1,3600
+dhcp-option=42
+dhcp-option=tag:guests,option:router,192.168.3.1
+dhcp-option=option:ntp-server,0.0.0.0
+dhcp-option=option6:dns-server,[::]
+
+dhcp-host=aa:bb:cc:dd:ee:01,192.168.1.10,Laptop,infinite
+dhcp-host=192.168.1.11,aa:bb:cc:dd:ee:02
+dhcp-host=aa:bb:cc:dd:ee:03,set:red,192.168.1.12
+dhcp-host=printer,192.168.1.13
+
+conf-dir=/etc/dnsmasq.d
+`
+
+func TestParse(t *testing.T) {
+	conf, err := dnsmasq.Parse(strings.NewReader(testConf))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"||ads.example^", "||tracker.example^"}, conf.Rules)
+
+	assert.Equal(t, []*dnsmasq.Rewrite{{
+		Domain: "nas.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "*.nas.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "files.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "*.files.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "alias.lan",
+		Answer: "nas.lan",
+	}, {
+		Domain: "a.lan",
+		Answer: "router.lan",
+	}, {
+		Domain: "b.lan",
+		Answer: "router.lan",
+	}}, conf.Rewrites)
+
+	assert.Equal(t, []string{
+		"1.1.1.1",
+		"8.8.8.8:5353",
+		"[2606:4700:4700::1111]:53",
+		"[/corp.example/]10.0.0.1",
+		"[/a.example/b.example/]#",
+	}, conf.Upstreams)
+
+	assert.Equal(t, &dnsmasq.DHCP{
+		GatewayIP:  netip.MustParseAddr("192.168.1.1"),
+		SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		RangeStart: netip.MustParseAddr("192.168.1.100"),
+		RangeEnd:   netip.MustParseAddr("192.168.1.200"),
+		Options: []string{
+			"6 ips 192.168.1.1,192.168.1.2",
+			"15 text lan",
+			"58 dur " + timeutil.Duration{Duration: time.Hour}.String(),
+			"42 del",
+		},
+		LeaseDuration: 12 * time.Hour,
+	}, conf.DHCP)
+
+	assert.Equal(t, []*dnsmasq.StaticLease{{
+		HWAddr:   net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01},
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "laptop",
+	}, {
+		HWAddr:   net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02},
+		IP:       netip.MustParseAddr("192.168.1.11"),
+		Hostname: "",
+	}}, conf.StaticLeases)
+
+	wantWarnings := []string{
+		`line 2: directive "domain-needed" is not supported`,
+		`line 3: directive "bogus-priv" is not supported`,
+		`line 8: address "/#/127.0.0.1": domain "#" is not supported`,
+		`line 13: server "/corp.example/10.0.0.1@eth0": source "eth0" is ignored`,
+		`line 15: server "/lan/": local-only domains are not supported`,
+		`line 21: dhcp range "192.168.2.100,192.168.2.200,12h": only one range is supported`,
+		`line 27: dhcp option "tag:guests,option:router,192.168.3.1": "tag:" is not supported`,
+		`line 28: dhcp option "option:ntp-server,0.0.0.0": ` +
+			`the address of the dnsmasq host is not supported`,
+		`line 29: dhcp option "option6:dns-server,[::]": dhcpv6 options are not supported`,
+		`line 33: dhcp host "aa:bb:cc:dd:ee:03,set:red,192.168.1.12": "set:" is not supported`,
+		`line 34: dhcp host "printer,192.168.1.13": ` +
+			`static leases require a hardware and an ipv4 address`,
+		`line 36: conf-dir "/etc/dnsmasq.d": included files must be imported separately`,
+	}
+	assert.Equal(t, wantWarnings, conf.Warnings)
+}
+
+func TestParse_empty(t *testing.T) {
+	conf, err := dnsmasq.Parse(strings.NewReader("# Nothing\n\n"))
+	require.NoError(t, err)
+
+	assert.Nil(t, conf.DHCP)
+	assert.Empty(t, conf.Rewrites)
+	assert.Empty(t, conf.Warnings)
+}
@@ -0,0 +1,246 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/google/renameio/v2/maybe"
+)
+
+// Config is the configuration structure for the event bus.
+type Config struct {
+	// Logger is used to log the operation of the bus.  It must not be nil.
+	Logger *slog.Logger
+
+	// FilePath is the path to the file to store the recent events in.  If
+	// empty, the events aren't stored.
+	FilePath string
+
+	// Size is the maximum number of the recent events kept.  It must be
+	// positive.
+	Size uint
+}
+
+// Bus is the event bus.  It keeps the recent events and delivers the new ones
+// to the subscribers.  It's safe for concurrent use.
+type Bus struct {
+	// logger is used to log the operation of the bus.
+	logger *slog.Logger
+
+	// mu protects all fields below except filePath.
+	mu *sync.Mutex
+
+	// recent are the recent events in the chronological order.
+	recent *container.RingBuffer[*Event]
+
+	// subs are the channels of the subscribers.
+	subs map[*subscription]struct{}
+
+	// filePath is the path to the file to store the recent events in.
+	filePath string
+
+	// lastID is the identifier of the last published event.
+	lastID uint64
+}
+
+// subscription is a single subscriber of a [Bus].
+type subscription struct {
+	ch chan *Event
+}
+
+// type check
+var _ Publisher = (*Bus)(nil)
+
+// New returns a new properly initialized event bus.  It loads the previously
+// stored events, if any.  conf must not be nil.
+func New(ctx context.Context, conf *Config) (b *Bus, err error) {
+	if conf.Size == 0 {
+		return nil, fmt.Errorf("events: size: %w", errors.ErrNotPositive)
+	}
+
+	b = &Bus{
+		logger:   conf.Logger,
+		mu:       &sync.Mutex{},
+		recent:   container.NewRingBuffer[*Event](conf.Size),
+		subs:     map[*subscription]struct{}{},
+		filePath: conf.FilePath,
+	}
+
+	err = b.load(ctx)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Publish implements the [Publisher] interface for *Bus.  It assigns the
+// identifier to e, stores it among the recent events, and sends it to the
+// subscribers which aren't lagging behind.
+func (b *Bus) Publish(ctx context.Context, e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	b.recent.Push(e)
+
+	b.logger.DebugContext(ctx, "published", "id", e.ID, "type", e.Type, "severity", e.Severity)
+
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+			// Go on.
+		default:
+			b.logger.WarnContext(ctx, "subscriber is lagging, dropping event", "id", e.ID)
+		}
+	}
+
+	err := b.storeLocked(ctx)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "storing events", slogutil.KeyError, err)
+	}
+}
+
+// Subscribe returns the channel receiving the events published after the call
+// with the buffer of the given size.  The events are dropped for the
+// subscriber while its buffer is full.  The received events must not be
+// modified.  unsubscribe stops the delivery and closes ch.
+func (b *Bus) Subscribe(size uint) (ch <-chan *Event, unsubscribe func()) {
+	s := &subscription{
+		ch: make(chan *Event, size),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[s] = struct{}{}
+
+	once := &sync.Once{}
+
+	return s.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs, s)
+			close(s.ch)
+		})
+	}
+}
+
+// Recent returns up to limit most recent events with severity at least
+// minSev, newest first.  If limit is zero, all such events are returned.  The
+// returned events must not be modified.
+func (b *Bus) Recent(minSev Severity, limit uint) (evs []*Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	evs = []*Event{}
+	b.recent.ReverseRange(func(e *Event) (cont bool) {
+		if e.Severity >= minSev {
+			evs = append(evs, e)
+		}
+
+		return limit == 0 || uint(len(evs)) < limit
+	})
+
+	return evs
+}
+
+// dataVersion is the current version of the stored events structure.
+const dataVersion = 1
+
+// data is the structure of the stored events.
+type data struct {
+	// Events are the recent events in the chronological order.
+	Events []*Event `json:"events"`
+
+	// Version is the version of the structure.
+	Version int `json:"version"`
+}
+
+// load reads the stored events, if any.
+func (b *Bus) load(ctx context.Context) (err error) {
+	if b.filePath == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(b.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading events: %w", err)
+	}
+
+	d := &data{}
+	err = json.Unmarshal(raw, d)
+	if err != nil {
+		return fmt.Errorf("decoding events: %w", err)
+	}
+
+	if d.Version != dataVersion {
+		b.logger.WarnContext(ctx, "unsupported events version, discarding", "version", d.Version)
+
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range d.Events {
+		b.recent.Push(e)
+		b.lastID = max(b.lastID, e.ID)
+	}
+
+	b.logger.DebugContext(ctx, "loaded events", "num", len(d.Events))
+
+	return nil
+}
+
+// storeLocked writes the recent events to the file, if configured.  b.mu must
+// be locked.
+func (b *Bus) storeLocked(ctx context.Context) (err error) {
+	if b.filePath == "" {
+		return nil
+	}
+
+	d := &data{
+		Events:  make([]*Event, 0, b.recent.Len()),
+		Version: dataVersion,
+	}
+
+	b.recent.Range(func(e *Event) (cont bool) {
+		d.Events = append(d.Events, e)
+
+		return true
+	})
+
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding events: %w", err)
+	}
+
+	err = maybe.WriteFile(b.filePath, raw, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing events: %w", err)
+	}
+
+	b.logger.DebugContext(ctx, "stored events", "path", b.filePath)
+
+	return nil
+}
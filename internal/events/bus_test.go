@@ -0,0 +1,135 @@
+package events_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// newTestEvent returns a new event of the given type and severity.
+func newTestEvent(typ events.Type, sev events.Severity) (e *events.Event) {
+	return &events.Event{
+		Type:     typ,
+		Message:  string(typ),
+		Severity: sev,
+	}
+}
+
+func TestBus(t *testing.T) {
+	const size = 3
+
+	conf := &events.Config{
+		Logger:   slogutil.NewDiscardLogger(),
+		FilePath: filepath.Join(t.TempDir(), "events.json"),
+		Size:     size,
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	b, err := events.New(ctx, conf)
+	require.NoError(t, err)
+
+	ch, unsubscribe := b.Subscribe(1)
+
+	b.Publish(ctx, newTestEvent(events.TypeFilterUpdated, events.SeverityInfo))
+
+	e, ok := testutil.RequireReceive(t, ch, testTimeout)
+	require.True(t, ok)
+
+	assert.Equal(t, uint64(1), e.ID)
+	assert.False(t, e.Time.IsZero())
+
+	// The buffer of the subscriber is full for the rest of the events.
+	b.Publish(ctx, newTestEvent(events.TypeUpstreamDown, events.SeverityWarning))
+	b.Publish(ctx, newTestEvent(events.TypeCertRenewed, events.SeverityInfo))
+	b.Publish(ctx, newTestEvent(events.TypeDiskLow, events.SeverityError))
+
+	unsubscribe()
+	unsubscribe()
+
+	e, ok = testutil.RequireReceive(t, ch, testTimeout)
+	require.True(t, ok)
+
+	assert.Equal(t, events.TypeUpstreamDown, e.Type)
+
+	_, ok = testutil.RequireReceive(t, ch, testTimeout)
+	assert.False(t, ok)
+
+	types := func(evs []*events.Event) (ts []events.Type) {
+		for _, ev := range evs {
+			ts = append(ts, ev.Type)
+		}
+
+		return ts
+	}
+
+	assert.Equal(t, []events.Type{
+		events.TypeDiskLow,
+		events.TypeCertRenewed,
+		events.TypeUpstreamDown,
+	}, types(b.Recent(events.SeverityInfo, 0)))
+
+	assert.Equal(t, []events.Type{
+		events.TypeDiskLow,
+		events.TypeUpstreamDown,
+	}, types(b.Recent(events.SeverityWarning, 0)))
+
+	assert.Equal(t, []events.Type{
+		events.TypeDiskLow,
+	}, types(b.Recent(events.SeverityInfo, 1)))
+
+	t.Run("load", func(t *testing.T) {
+		loaded, loadErr := events.New(ctx, conf)
+		require.NoError(t, loadErr)
+
+		assert.Equal(t, types(b.Recent(events.SeverityInfo, 0)), types(loaded.Recent(events.SeverityInfo, 0)))
+
+		loaded.Publish(ctx, newTestEvent(events.TypeNewClient, events.SeverityInfo))
+
+		recent := loaded.Recent(events.SeverityInfo, 1)
+		require.Len(t, recent, 1)
+
+		assert.Equal(t, uint64(5), recent[0].ID)
+	})
+}
+
+func TestParseSeverity(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+		want       events.Severity
+	}{{
+		name:       "info",
+		in:         "info",
+		wantErrMsg: "",
+		want:       events.SeverityInfo,
+	}, {
+		name:       "error",
+		in:         "error",
+		wantErrMsg: "",
+		want:       events.SeverityError,
+	}, {
+		name:       "bad",
+		in:         "fatal",
+		wantErrMsg: `severity: bad enum value: "fatal"`,
+		want:       0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sev, err := events.ParseSeverity(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, sev)
+		})
+	}
+}
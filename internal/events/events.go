@@ -0,0 +1,156 @@
+// Package events contains the bus of the notable events of AdGuard Home, such
+// as the updates of the filter lists or the failures of the upstreams.  The
+// recent events are kept in a ring buffer persisted to disk, and the sinks,
+// such as notifiers, subscribe to the new ones.
+package events
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Type is the type of an event.
+type Type string
+
+// Type values.
+const (
+	// TypeFilterUpdated means that the rules of a filter list have been
+	// updated.
+	TypeFilterUpdated Type = "filter_updated"
+
+	// TypeUpstreamDown means that an upstream has stopped responding and its
+	// circuit breaker has opened or it has failed the health checks.
+	TypeUpstreamDown Type = "upstream_down"
+
+	// TypeUpstreamUp means that an upstream marked down by the health checks
+	// has passed them again.
+	TypeUpstreamUp Type = "upstream_up"
+
+	// TypeCertRenewed means that the TLS certificate has been replaced.
+	TypeCertRenewed Type = "cert_renewed"
+
+	// TypeCertExpiring means that a configured TLS certificate has reached an
+	// expiry alert threshold or has expired.
+	TypeCertExpiring Type = "cert_expiring"
+
+	// TypeNewClient means that a previously unknown device has been
+	// discovered on the local networks.
+	TypeNewClient Type = "new_client"
+
+	// TypeDiskLow means that the free space on the disk with the data
+	// directory is low.
+	TypeDiskLow Type = "disk_low"
+
+	// TypeUserRuleExpired means that a temporary user rule has been removed
+	// since it has expired.
+	TypeUserRuleExpired Type = "user_rule_expired"
+
+	// TypeFilterRolloutPromoted means that the staged updates of the filter
+	// lists have been applied to everyone.
+	TypeFilterRolloutPromoted Type = "filter_rollout_promoted"
+
+	// TypeFilterRolloutReverted means that the staged updates of the filter
+	// lists have been discarded because of the breakage signals.
+	TypeFilterRolloutReverted Type = "filter_rollout_reverted"
+)
+
+// Severity is the severity of an event.  The zero value is invalid.
+type Severity uint8
+
+// Severity values, from the least to the most severe.
+const (
+	SeverityInfo Severity = iota + 1
+	SeverityWarning
+	SeverityError
+)
+
+// String implements the [fmt.Stringer] interface for Severity.
+func (s Severity) String() (str string) {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("!bad_severity_%d", s)
+	}
+}
+
+// ParseSeverity parses the severity from its string representation.
+func ParseSeverity(str string) (s Severity, err error) {
+	switch str {
+	case "info":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	default:
+		return 0, fmt.Errorf("severity: %w: %q", errors.ErrBadEnumValue, str)
+	}
+}
+
+// type check
+var _ encoding.TextMarshaler = Severity(0)
+
+// MarshalText implements the [encoding.TextMarshaler] interface for Severity.
+func (s Severity) MarshalText() (text []byte, err error) {
+	return []byte(s.String()), nil
+}
+
+// type check
+var _ encoding.TextUnmarshaler = (*Severity)(nil)
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface for
+// *Severity.
+func (s *Severity) UnmarshalText(text []byte) (err error) {
+	*s, err = ParseSeverity(string(text))
+
+	// Don't wrap the error, since it's informative enough as is.
+	return err
+}
+
+// Event is a single notable event.
+type Event struct {
+	// Time is the time of the event.  It's set by [Bus.Publish] if empty.
+	Time time.Time `json:"time"`
+
+	// Data are the additional properties of the event specific to its type,
+	// for example the address of the upstream.
+	Data map[string]string `json:"data,omitempty"`
+
+	// Type is the type of the event.
+	Type Type `json:"type"`
+
+	// Message is the human-readable description of the event.
+	Message string `json:"message"`
+
+	// ID is the identifier of the event, increasing with each published event.
+	// It's set by [Bus.Publish].
+	ID uint64 `json:"id"`
+
+	// Severity is the severity of the event.  It must be valid.
+	Severity Severity `json:"severity"`
+}
+
+// Publisher publishes the events.
+type Publisher interface {
+	// Publish publishes e.  e must not be nil and must not be modified after
+	// the call.
+	Publish(ctx context.Context, e *Event)
+}
+
+// EmptyPublisher is a [Publisher] that drops all events.
+type EmptyPublisher struct{}
+
+// type check
+var _ Publisher = EmptyPublisher{}
+
+// Publish implements the [Publisher] interface for EmptyPublisher.
+func (EmptyPublisher) Publish(_ context.Context, _ *Event) {}
@@ -0,0 +1,255 @@
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// AnswerFilterAction is the action applied to the responses with the answers
+// matching an answer filter.
+type AnswerFilterAction string
+
+// Allowed answer filter actions.
+const (
+	// AnswerFilterActionBlock means that the response is replaced with the
+	// blocked one according to the blocking mode.
+	AnswerFilterActionBlock AnswerFilterAction = "block"
+
+	// AnswerFilterActionRewrite means that the addresses of the matching
+	// answers are replaced with [AnswerFilter.RewriteIPv4] or
+	// [AnswerFilter.RewriteIPv6].
+	AnswerFilterActionRewrite AnswerFilterAction = "rewrite"
+)
+
+// AnswerFilter is a rule filtering the DNS responses by the IP addresses in
+// their A and AAAA records.
+type AnswerFilter struct {
+	// Name is the unique name of the filter.  It must not be empty.
+	Name string `yaml:"name" json:"name"`
+
+	// Action is the action applied to the matching responses.
+	Action AnswerFilterAction `yaml:"action" json:"action"`
+
+	// Subnets are the networks the matching addresses belong to.  It must not
+	// be empty.
+	Subnets []netip.Prefix `yaml:"subnets" json:"subnets"`
+
+	// RewriteIPv4 is the address replacing the matching addresses in the A
+	// records, if the action is [AnswerFilterActionRewrite].  If it's not
+	// valid, the matching A records are removed.
+	RewriteIPv4 netip.Addr `yaml:"rewrite_ipv4" json:"rewrite_ipv4"`
+
+	// RewriteIPv6 is the address replacing the matching addresses in the AAAA
+	// records, if the action is [AnswerFilterActionRewrite].  If it's not
+	// valid, the matching AAAA records are removed.
+	RewriteIPv6 netip.Addr `yaml:"rewrite_ipv6" json:"rewrite_ipv6"`
+
+	// ExceptClients are the names and IP addresses of the clients, as well as
+	// the networks they may belong to, the filter doesn't apply to.
+	ExceptClients []string `yaml:"except_clients" json:"except_clients"`
+
+	// Enabled defines if the filter is applied.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// clone returns a deep copy of f.
+func (f *AnswerFilter) clone() (cloned *AnswerFilter) {
+	cloned = &AnswerFilter{}
+	*cloned = *f
+	cloned.Subnets = slices.Clone(f.Subnets)
+	cloned.ExceptClients = slices.Clone(f.ExceptClients)
+
+	return cloned
+}
+
+// validate returns an error if f is not a valid answer filter.
+func (f *AnswerFilter) validate() (err error) {
+	if f == nil {
+		return errors.ErrNoValue
+	} else if f.Name == "" {
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	} else if len(f.Subnets) == 0 {
+		return fmt.Errorf("subnets: %w", errors.ErrEmptyValue)
+	}
+
+	for i, p := range f.Subnets {
+		if !p.IsValid() {
+			return fmt.Errorf("subnets: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+	}
+
+	switch f.Action {
+	case AnswerFilterActionBlock:
+		// Go on.
+	case AnswerFilterActionRewrite:
+		if f.RewriteIPv4.IsValid() && !f.RewriteIPv4.Is4() {
+			return fmt.Errorf("rewrite_ipv4: %s is not an ipv4 address", f.RewriteIPv4)
+		} else if f.RewriteIPv6.IsValid() && !f.RewriteIPv6.Is6() {
+			return fmt.Errorf("rewrite_ipv6: %s is not an ipv6 address", f.RewriteIPv6)
+		}
+	default:
+		return fmt.Errorf("action: bad value %q", f.Action)
+	}
+
+	for i, c := range f.ExceptClients {
+		if c == "" {
+			return fmt.Errorf("except_clients: at index %d: %w", i, errors.ErrEmptyValue)
+		}
+	}
+
+	return nil
+}
+
+// answerFilter is a validated [AnswerFilter].
+type answerFilter struct {
+	// conf is the configuration of the filter.  It must not be nil.
+	conf *AnswerFilter
+
+	// exceptClients are the names and the IP addresses of the excepted
+	// clients.
+	exceptClients *container.MapSet[string]
+
+	// exceptSubnets are the networks of the excepted clients.
+	exceptSubnets []netip.Prefix
+}
+
+// newAnswerFilters validates confs and returns the answer filters prepared
+// from them.
+func newAnswerFilters(confs []*AnswerFilter) (filters []*answerFilter, err error) {
+	names := container.NewMapSet[string]()
+	for i, c := range confs {
+		err = c.validate()
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if names.Has(c.Name) {
+			return nil, fmt.Errorf("at index %d: duplicate name %q", i, c.Name)
+		}
+
+		names.Add(c.Name)
+
+		f := &answerFilter{
+			conf:          c.clone(),
+			exceptClients: container.NewMapSet[string](),
+		}
+
+		for _, ec := range c.ExceptClients {
+			if p, pErr := netip.ParsePrefix(ec); pErr == nil {
+				f.exceptSubnets = append(f.exceptSubnets, p.Masked())
+			} else {
+				f.exceptClients.Add(ec)
+			}
+		}
+
+		filters = append(filters, f)
+	}
+
+	return filters, nil
+}
+
+// excepts returns true if the filter doesn't apply to the client with setts.
+func (f *answerFilter) excepts(setts *Settings) (ok bool) {
+	if setts.ClientName != "" && f.exceptClients.Has(setts.ClientName) {
+		return true
+	}
+
+	ip := setts.ClientIP
+	if !ip.IsValid() {
+		return false
+	}
+
+	return f.exceptClients.Has(ip.String()) || slices.ContainsFunc(
+		f.exceptSubnets,
+		func(p netip.Prefix) (contains bool) { return p.Contains(ip) },
+	)
+}
+
+// matches returns true if ip belongs to any of the subnets of f.
+func (f *answerFilter) matches(ip netip.Addr) (ok bool) {
+	return slices.ContainsFunc(f.conf.Subnets, func(p netip.Prefix) (contains bool) {
+		return p.Contains(ip)
+	})
+}
+
+// MatchAnswerIP returns the first enabled answer filter matching ip, which is
+// an address from an A or AAAA record of a response to the client with setts,
+// or nil if there is none.  The result must not be modified.
+func (d *DNSFilter) MatchAnswerIP(ip netip.Addr, setts *Settings) (f *AnswerFilter) {
+	ip = ip.Unmap()
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	for _, af := range d.answerFilters {
+		if af.conf.Enabled && af.matches(ip) && !af.excepts(setts) {
+			return af.conf
+		}
+	}
+
+	return nil
+}
+
+// answerFiltersJSON is the object for the GET /control/filtering/answer_filters
+// and PUT /control/filtering/answer_filters/update HTTP APIs.
+type answerFiltersJSON struct {
+	Filters []*AnswerFilter `json:"filters"`
+}
+
+// handleAnswerFiltersGet is the handler for the GET
+// /control/filtering/answer_filters HTTP API.
+func (d *DNSFilter) handleAnswerFiltersGet(w http.ResponseWriter, r *http.Request) {
+	resp := &answerFiltersJSON{
+		Filters: []*AnswerFilter{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, f := range d.conf.AnswerFilters {
+			resp.Filters = append(resp.Filters, f.clone())
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleAnswerFiltersUpdate is the handler for the PUT
+// /control/filtering/answer_filters/update HTTP API.
+func (d *DNSFilter) handleAnswerFiltersUpdate(w http.ResponseWriter, r *http.Request) {
+	req := &answerFiltersJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	filters, err := newAnswerFilters(req.Filters)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.AnswerFilters = req.Filters
+		d.answerFilters = filters
+	}()
+
+	log.Debug("filtering: updated answer filters: %d", len(filters))
+
+	d.conf.ConfigModified()
+}
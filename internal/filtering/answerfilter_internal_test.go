@@ -0,0 +1,170 @@
+package filtering
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAnswerFilters(t *testing.T) {
+	privateNets := []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")}
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*AnswerFilter
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		confs: []*AnswerFilter{{
+			Name:    "block",
+			Action:  AnswerFilterActionBlock,
+			Subnets: privateNets,
+		}, {
+			Name:        "rewrite",
+			Action:      AnswerFilterActionRewrite,
+			Subnets:     privateNets,
+			RewriteIPv4: netip.MustParseAddr("192.0.2.1"),
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "at index 0: no value",
+		confs:      []*AnswerFilter{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "at index 0: name: empty value",
+		confs: []*AnswerFilter{{
+			Action:  AnswerFilterActionBlock,
+			Subnets: privateNets,
+		}},
+	}, {
+		name:       "no_subnets",
+		wantErrMsg: "at index 0: subnets: empty value",
+		confs: []*AnswerFilter{{
+			Name:   "block",
+			Action: AnswerFilterActionBlock,
+		}},
+	}, {
+		name:       "bad_action",
+		wantErrMsg: `at index 0: action: bad value "allow"`,
+		confs: []*AnswerFilter{{
+			Name:    "block",
+			Action:  "allow",
+			Subnets: privateNets,
+		}},
+	}, {
+		name:       "bad_rewrite",
+		wantErrMsg: "at index 0: rewrite_ipv4: 2001:db8::1 is not an ipv4 address",
+		confs: []*AnswerFilter{{
+			Name:        "rewrite",
+			Action:      AnswerFilterActionRewrite,
+			Subnets:     privateNets,
+			RewriteIPv4: netip.MustParseAddr("2001:db8::1"),
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: duplicate name "block"`,
+		confs: []*AnswerFilter{{
+			Name:    "block",
+			Action:  AnswerFilterActionBlock,
+			Subnets: privateNets,
+		}, {
+			Name:    "block",
+			Action:  AnswerFilterActionBlock,
+			Subnets: privateNets,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newAnswerFilters(tc.confs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestDNSFilter_MatchAnswerIP(t *testing.T) {
+	const exceptedName = "excepted"
+
+	d, err := New(&Config{
+		AnswerFilters: []*AnswerFilter{{
+			Name:          "disabled",
+			Action:        AnswerFilterActionBlock,
+			Subnets:       []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")},
+			ExceptClients: nil,
+			Enabled:       false,
+		}, {
+			Name:   "private",
+			Action: AnswerFilterActionBlock,
+			Subnets: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("fd00::/8"),
+			},
+			ExceptClients: []string{exceptedName, "192.0.2.1", "198.51.100.0/24"},
+			Enabled:       true,
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	privateIP := netip.MustParseAddr("10.1.2.3")
+
+	testCases := []struct {
+		setts *Settings
+		ip    netip.Addr
+		name  string
+		want  string
+	}{{
+		setts: &Settings{ClientIP: netip.MustParseAddr("192.0.2.2")},
+		ip:    privateIP,
+		name:  "match",
+		want:  "private",
+	}, {
+		setts: &Settings{ClientIP: netip.MustParseAddr("192.0.2.2")},
+		ip:    netip.MustParseAddr("fd00::1"),
+		name:  "match_ipv6",
+		want:  "private",
+	}, {
+		setts: &Settings{ClientIP: netip.MustParseAddr("192.0.2.2")},
+		ip:    netip.AddrFrom16(privateIP.As16()),
+		name:  "match_mapped",
+		want:  "private",
+	}, {
+		setts: &Settings{ClientIP: netip.MustParseAddr("192.0.2.2")},
+		ip:    netip.MustParseAddr("203.0.113.1"),
+		name:  "no_match",
+		want:  "",
+	}, {
+		setts: &Settings{ClientName: exceptedName},
+		ip:    privateIP,
+		name:  "excepted_name",
+		want:  "",
+	}, {
+		setts: &Settings{ClientIP: netip.MustParseAddr("192.0.2.1")},
+		ip:    privateIP,
+		name:  "excepted_ip",
+		want:  "",
+	}, {
+		setts: &Settings{ClientIP: netip.MustParseAddr("198.51.100.10")},
+		ip:    privateIP,
+		name:  "excepted_subnet",
+		want:  "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := d.MatchAnswerIP(tc.ip, tc.setts)
+			if tc.want == "" {
+				assert.Nil(t, f)
+
+				return
+			}
+
+			require.NotNil(t, f)
+
+			assert.Equal(t, tc.want, f.Name)
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package filtering
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// ExportFormat is the format of the exported blocklist and rewrites.
+type ExportFormat string
+
+// Supported export formats.
+const (
+	// ExportFormatHosts is the hosts file format.  The blocked domains are
+	// mapped to 0.0.0.0 and the subdomains of the blocked domains aren't
+	// blocked, since the format doesn't allow it.
+	ExportFormatHosts ExportFormat = "hosts"
+
+	// ExportFormatDnsmasq is the dnsmasq configuration file format.  The
+	// blocked domains are blocked along with all their subdomains.
+	ExportFormatDnsmasq ExportFormat = "dnsmasq"
+)
+
+// exportMaxLineLen is the maximum length of a rule line read from the filter
+// lists for the export.  Longer lines are skipped.
+const exportMaxLineLen = 64 * 1024
+
+// exportList is a filter list to export.
+type exportList struct {
+	// path is the path to the downloaded filter list.
+	path string
+
+	// allowlist is true if the list is an allowlist.
+	allowlist bool
+}
+
+// exportPolicy is the effective blocking policy containing only the rules
+// which can be represented as lists of domains.
+type exportPolicy struct {
+	// blocked are the blocked domains.
+	blocked *container.MapSet[string]
+
+	// allowed are the domains unblocked along with their subdomains.
+	allowed *container.MapSet[string]
+
+	// skipped is the number of the rules which can't be exported.
+	skipped int
+}
+
+// newExportPolicy returns a new properly initialized *exportPolicy.
+func newExportPolicy() (p *exportPolicy) {
+	return &exportPolicy{
+		blocked: container.NewMapSet[string](),
+		allowed: container.NewMapSet[string](),
+	}
+}
+
+// Export writes the enabled filtering rules, which block or allow whole
+// domains, and the rewrites to w in the format.  The rules and the rewrites
+// which can't be represented in the format are skipped and counted in the
+// header of the output.
+func (d *DNSFilter) Export(w io.Writer, format ExportFormat) (err error) {
+	if format != ExportFormatHosts && format != ExportFormatDnsmasq {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	p, err := d.exportPolicy()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	var rewrites []*LegacyRewrite
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		rewrites = cloneRewrites(d.conf.Rewrites)
+	}()
+
+	bw := bufio.NewWriter(w)
+	if format == ExportFormatHosts {
+		writeHostsExport(bw, p, rewrites)
+	} else {
+		writeDnsmasqExport(bw, p, rewrites)
+	}
+
+	return bw.Flush()
+}
+
+// exportPolicy collects the effective blocking policy from the user rules and
+// the enabled filter lists.  The policy is empty if the filtering is disabled.
+func (d *DNSFilter) exportPolicy() (p *exportPolicy, err error) {
+	p = newExportPolicy()
+	if atomic.LoadUint32(&d.conf.enabled) == 0 {
+		return p, nil
+	}
+
+	var (
+		userRules []string
+		lists     []exportList
+	)
+
+	func() {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		userRules = slices.Clone(d.conf.UserRules)
+		for _, f := range d.conf.Filters {
+			if f.Enabled {
+				lists = append(lists, exportList{path: f.Path(d.conf.DataDir)})
+			}
+		}
+
+		for _, f := range d.conf.WhitelistFilters {
+			if f.Enabled {
+				lists = append(lists, exportList{path: f.Path(d.conf.DataDir), allowlist: true})
+			}
+		}
+	}()
+
+	for _, r := range userRules {
+		p.addRule(r, false)
+	}
+
+	for _, l := range lists {
+		err = p.addList(l.path, l.allowlist)
+		if err != nil {
+			return nil, fmt.Errorf("exporting filter list: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// addList adds the rules from the filter list file at path.  A missing file,
+// which means that the list hasn't been downloaded yet, is skipped.
+func (p *exportPolicy) addList(path string, allowlist bool) (err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	r := bufio.NewReaderSize(f, exportMaxLineLen)
+	for {
+		var line []byte
+		var isPrefix bool
+		line, isPrefix, err = r.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading %q: %w", path, err)
+		}
+
+		if !isPrefix {
+			p.addRule(string(line), allowlist)
+
+			continue
+		}
+
+		// Skip the rest of the line that doesn't fit into the buffer.
+		for isPrefix && err == nil {
+			_, isPrefix, err = r.ReadLine()
+		}
+
+		p.skipped++
+	}
+}
+
+// addRule adds the rule to p, if it blocks or allows whole domains.  All the
+// rules of an allowlist allow the domains.
+func (p *exportPolicy) addRule(rule string, allowlist bool) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || rule[0] == '!' || rule[0] == '#' {
+		return
+	}
+
+	allow := allowlist
+	if r, ok := strings.CutPrefix(rule, "@@"); ok {
+		allow, rule = true, r
+	}
+
+	if r, ok := strings.CutPrefix(rule, "||"); ok {
+		domain, isDomain := strings.CutSuffix(strings.TrimSuffix(r, "|"), "^")
+		if isDomain && p.add(domain, allow) {
+			return
+		}
+
+		p.skipped++
+
+		return
+	}
+
+	fields := strings.Fields(rule)
+	ip, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		if len(fields) != 1 || !p.add(fields[0], allow) {
+			p.skipped++
+		}
+
+		return
+	} else if !ip.IsUnspecified() && !ip.IsLoopback() {
+		// Hosts rules with other addresses are rewrites.
+		p.skipped++
+
+		return
+	}
+
+	for _, f := range fields[1:] {
+		if f[0] == '#' {
+			break
+		}
+
+		// Ignore the invalid domains, since the hosts files usually contain
+		// the entries for localhost and similar names.
+		_ = p.add(f, allow)
+	}
+}
+
+// add adds the domain to the blocked or allowed ones.  ok is false if domain
+// isn't a valid domain name with at least two labels.
+func (p *exportPolicy) add(domain string, allow bool) (ok bool) {
+	domain = strings.ToLower(domain)
+	if !strings.Contains(domain, ".") || domain == "localhost.localdomain" {
+		return false
+	} else if _, err := netip.ParseAddr(domain); err == nil {
+		return false
+	} else if netutil.ValidateHostname(domain) != nil {
+		return false
+	}
+
+	if allow {
+		p.allowed.Add(domain)
+	} else {
+		p.blocked.Add(domain)
+	}
+
+	return true
+}
+
+// isAllowed returns true if domain or one of its parent domains is allowed.
+func (p *exportPolicy) isAllowed(domain string) (ok bool) {
+	for {
+		if p.allowed.Has(domain) {
+			return true
+		}
+
+		var found bool
+		_, domain, found = strings.Cut(domain, ".")
+		if !found {
+			return false
+		}
+	}
+}
+
+// hasBlockedParent returns true if one of the parent domains of domain is
+// blocked.
+func (p *exportPolicy) hasBlockedParent(domain string) (ok bool) {
+	for {
+		var found bool
+		_, domain, found = strings.Cut(domain, ".")
+		if !found {
+			return false
+		} else if p.blocked.Has(domain) {
+			return true
+		}
+	}
+}
+
+// blockedDomains returns the sorted blocked domains which aren't allowed or
+// rewritten.
+func (p *exportPolicy) blockedDomains(rewritten *container.MapSet[string]) (domains []string) {
+	p.blocked.Range(func(d string) (cont bool) {
+		if !p.isAllowed(d) && !rewritten.Has(d) {
+			domains = append(domains, d)
+		}
+
+		return true
+	})
+
+	slices.Sort(domains)
+
+	return domains
+}
+
+// writeExportHeader writes the header with the summary of the exported data.
+func writeExportHeader(
+	w io.Writer,
+	format ExportFormat,
+	p *exportPolicy,
+	blocked int,
+	rewrites int,
+	skippedRewrites int,
+) {
+	_, _ = fmt.Fprintf(w, "# Generated by AdGuard Home in the %s format.\n", format)
+	_, _ = fmt.Fprintf(
+		w,
+		"# Blocked domains: %d.  Rewrites: %d.  Skipped rules: %d.  Skipped rewrites: %d.\n",
+		blocked,
+		rewrites,
+		p.skipped,
+		skippedRewrites,
+	)
+}
+
+// isIPRewrite returns true if rw responds with an IP address.
+func isIPRewrite(rw *LegacyRewrite) (ok bool) {
+	return (rw.Type == dns.TypeA || rw.Type == dns.TypeAAAA) && rw.IP.IsValid()
+}
+
+// writeHostsExport writes the policy and the rewrites in the hosts file format.
+// Only the non-wildcard rewrites with IP addresses can be represented.
+func writeHostsExport(w io.Writer, p *exportPolicy, rewrites []*LegacyRewrite) {
+	var lines []string
+	rewritten := container.NewMapSet[string]()
+	for _, rw := range rewrites {
+		if isIPRewrite(rw) && !isWildcard(rw.Domain) {
+			lines = append(lines, fmt.Sprintf("%s %s", rw.IP, rw.Domain))
+			rewritten.Add(rw.Domain)
+		}
+	}
+
+	blocked := p.blockedDomains(rewritten)
+	writeExportHeader(w, ExportFormatHosts, p, len(blocked), len(lines), len(rewrites)-len(lines))
+
+	for _, l := range lines {
+		_, _ = fmt.Fprintln(w, l)
+	}
+
+	for _, d := range blocked {
+		_, _ = fmt.Fprintf(w, "0.0.0.0 %s\n", d)
+	}
+}
+
+// writeDnsmasqExport writes the policy and the rewrites in the dnsmasq
+// configuration file format.  The allowed subdomains of the blocked domains are
+// forwarded to the upstream servers, and the wildcard CNAME rewrites can't be
+// represented.
+func writeDnsmasqExport(w io.Writer, p *exportPolicy, rewrites []*LegacyRewrite) {
+	var lines []string
+	rewritten := container.NewMapSet[string]()
+	for _, rw := range rewrites {
+		domain, wildcard := strings.CutPrefix(rw.Domain, "*.")
+
+		var line string
+		switch {
+		case isIPRewrite(rw) && wildcard:
+			line = fmt.Sprintf("address=/%s/%s", domain, rw.IP)
+		case isIPRewrite(rw):
+			line = fmt.Sprintf("host-record=%s,%s", domain, rw.IP)
+		case rw.Type == dns.TypeCNAME && !wildcard:
+			line = fmt.Sprintf("cname=%s,%s", domain, rw.Answer)
+		default:
+			continue
+		}
+
+		lines = append(lines, line)
+		rewritten.Add(rw.Domain)
+	}
+
+	blocked := p.blockedDomains(rewritten)
+	writeExportHeader(w, ExportFormatDnsmasq, p, len(blocked), len(lines), len(rewrites)-len(lines))
+
+	for _, l := range lines {
+		_, _ = fmt.Fprintln(w, l)
+	}
+
+	for _, d := range blocked {
+		_, _ = fmt.Fprintf(w, "address=/%s/#\n", d)
+	}
+
+	allowed := p.allowed.Values()
+	slices.Sort(allowed)
+	for _, d := range allowed {
+		if p.hasBlockedParent(d) {
+			_, _ = fmt.Fprintf(w, "server=/%s/#\n", d)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package filtering
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_Export(t *testing.T) {
+	dataDir := t.TempDir()
+	c := &Config{
+		DataDir: dataDir,
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     "https://example.com/1.txt",
+			Filter:  Filter{ID: 1},
+		}, {
+			Enabled: false,
+			URL:     "https://example.com/2.txt",
+			Filter:  Filter{ID: 2},
+		}, {
+			Enabled: true,
+			URL:     "https://example.com/3.txt",
+			Filter:  Filter{ID: 3},
+		}},
+		WhitelistFilters: []FilterYAML{{
+			Enabled: true,
+			URL:     "https://example.com/4.txt",
+			Filter:  Filter{ID: 4},
+		}},
+		UserRules: []string{
+			"! Comment",
+			"||user.example^",
+			"@@||ok.ads.example^",
+			"/regex/",
+		},
+		Rewrites: []*LegacyRewrite{{
+			Domain: "nas.lan",
+			Answer: "192.168.1.2",
+		}, {
+			Domain: "*.lan",
+			Answer: "192.168.1.1",
+		}, {
+			Domain: "alias.lan",
+			Answer: "nas.lan",
+		}, {
+			Domain: "user.example",
+			Answer: "1.2.3.4",
+		}, {
+			Domain: "v4only.example",
+			Answer: "A",
+		}},
+	}
+
+	lists := map[string]string{
+		"1.txt": "# Hosts\n" +
+			"127.0.0.1 localhost\n" +
+			"0.0.0.0 0.0.0.0\n" +
+			"0.0.0.0 tracker.example other.example # Comment\n" +
+			"1.2.3.4 rewrite.example\n",
+		"2.txt": "||disabled.example^\n",
+		"3.txt": "||ads.example^\n" +
+			"||important.example^$important\n" +
+			"domain-only.example\n",
+		"4.txt": "||other.example^\n",
+	}
+
+	filtersDir := filepath.Join(dataDir, filterDir)
+	require.NoError(t, os.MkdirAll(filtersDir, aghos.DefaultPermDir))
+	for name, data := range lists {
+		err := os.WriteFile(filepath.Join(filtersDir, name), []byte(data), aghos.DefaultPermFile)
+		require.NoError(t, err)
+	}
+
+	f, _ := newForTest(t, c, nil)
+	f.SetEnabled(true)
+
+	testCases := []struct {
+		name   string
+		format ExportFormat
+		want   string
+	}{{
+		name:   "hosts",
+		format: ExportFormatHosts,
+		want: "# Generated by AdGuard Home in the hosts format.\n" +
+			"# Blocked domains: 3.  Rewrites: 2.  Skipped rules: 3.  Skipped rewrites: 3.\n" +
+			"192.168.1.2 nas.lan\n" +
+			"1.2.3.4 user.example\n" +
+			"0.0.0.0 ads.example\n" +
+			"0.0.0.0 domain-only.example\n" +
+			"0.0.0.0 tracker.example\n",
+	}, {
+		name:   "dnsmasq",
+		format: ExportFormatDnsmasq,
+		want: "# Generated by AdGuard Home in the dnsmasq format.\n" +
+			"# Blocked domains: 3.  Rewrites: 4.  Skipped rules: 3.  Skipped rewrites: 1.\n" +
+			"host-record=nas.lan,192.168.1.2\n" +
+			"address=/lan/192.168.1.1\n" +
+			"cname=alias.lan,nas.lan\n" +
+			"host-record=user.example,1.2.3.4\n" +
+			"address=/ads.example/#\n" +
+			"address=/domain-only.example/#\n" +
+			"address=/tracker.example/#\n" +
+			"server=/ok.ads.example/#\n",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := f.Export(buf, tc.format)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		f.SetEnabled(false)
+		t.Cleanup(func() { f.SetEnabled(true) })
+
+		buf := &bytes.Buffer{}
+		err := f.Export(buf, ExportFormatHosts)
+		require.NoError(t, err)
+
+		assert.NotContains(t, buf.String(), "0.0.0.0")
+	})
+
+	t.Run("bad_format", func(t *testing.T) {
+		err := f.Export(&bytes.Buffer{}, "bad")
+		assert.Error(t, err)
+	})
+}
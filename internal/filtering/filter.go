@@ -1,6 +1,7 @@
 package filtering
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
@@ -35,6 +37,18 @@ type FilterYAML struct {
 	checksum    uint32    // checksum of the file data
 	white       bool
 
+	// rejected is the checksum of the contents reverted by the staged rollout,
+	// which aren't staged again.
+	rejected uint32
+
+	// staged is true if the update of the filter list must be written into
+	// its canary file for the staged rollout instead of the actual one.
+	staged bool
+
+	// Format is the format of the list contents.  The lists fetched from the
+	// AXFR URLs are always in [ListFormatRPZ].
+	Format ListFormat `yaml:"format,omitempty"`
+
 	Filter `yaml:",inline"`
 }
 
@@ -187,6 +201,38 @@ func (d *DNSFilter) filterExistsLocked(url string) (ok bool) {
 	return false
 }
 
+// FilterListName returns the name of the filter list with id.  ok is false if
+// there is no such filter list.  It's safe for concurrent use.
+func (d *DNSFilter) FilterListName(id rulelist.URLFilterID) (name string, ok bool) {
+	switch id {
+	case rulelist.URLFilterIDCustom:
+		return "Custom filtering rules", true
+	case rulelist.URLFilterIDEtcHosts:
+		return "Hosts file", true
+	case rulelist.URLFilterIDBlockedService:
+		return "Blocked services", true
+	case rulelist.URLFilterIDParentalControl:
+		return "Parental control", true
+	case rulelist.URLFilterIDSafeBrowsing:
+		return "Safe browsing", true
+	case rulelist.URLFilterIDSafeSearch:
+		return "Safe search", true
+	}
+
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	for _, flts := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for _, f := range flts {
+			if f.ID == id {
+				return f.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
 // Add a filter
 // Return FALSE if a filter with this URL exists
 func (d *DNSFilter) filterAdd(flt FilterYAML) (err error) {
@@ -293,6 +339,8 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 			URL:      flt.URL,
 			Name:     flt.Name,
 			checksum: flt.checksum,
+			rejected: flt.rejected,
+			staged:   d.conf.Canary.Enabled,
 		})
 	}
 
@@ -344,6 +392,13 @@ func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int,
 				continue
 			}
 
+			if uf.staged {
+				d.stageUpdate(uf)
+				updateCount++
+
+				continue
+			}
+
 			log.Info(
 				"filtering: updated filter %d; rule count: %d (was %d)",
 				f.ID,
@@ -355,6 +410,8 @@ func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int,
 			f.RulesCount = uf.RulesCount
 			f.checksum = uf.checksum
 			updateCount++
+
+			d.publishFilterUpdated(f)
 		}
 	}
 
@@ -384,6 +441,12 @@ func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
 	log.Debug("filtering: starting updating")
 	defer func() { log.Debug("filtering: finished updating, %d updated", updNum) }()
 
+	if d.rolloutActive.Load() {
+		log.Debug("filtering: staged rollout in progress, postponing updates")
+
+		return 0, false
+	}
+
 	var lists []FilterYAML
 	var toUpd []bool
 	isNetErr := false
@@ -449,13 +512,23 @@ func (d *DNSFilter) updateIntl(flt *FilterYAML) (ok bool, err error) {
 
 	var res *rulelist.ParseResult
 
-	tmpFile, err := aghrenameio.NewPendingFile(flt.Path(d.conf.DataDir), aghos.DefaultPermFile)
+	path := flt.Path(d.conf.DataDir)
+	if flt.staged {
+		path = flt.canaryPath(d.conf.DataDir)
+	}
+
+	tmpFile, err := aghrenameio.NewPendingFile(path, aghos.DefaultPermFile)
 	if err != nil {
 		return false, err
 	}
-	defer func() { err = d.finalizeUpdate(tmpFile, flt, res, err, ok) }()
+	defer func() { err = d.finalizeUpdate(tmpFile, flt, path, res, err, ok) }()
 
-	r, err := d.reader(flt.URL)
+	var r io.ReadCloser
+	if flt.isRPZ() {
+		r, err = d.rpzReader(flt.URL)
+	} else {
+		r, err = d.reader(flt.URL)
+	}
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return false, err
@@ -468,15 +541,16 @@ func (d *DNSFilter) updateIntl(flt *FilterYAML) (ok bool, err error) {
 	p := rulelist.NewParser()
 	res, err = p.Parse(tmpFile, r, *bufPtr)
 
-	return res.Checksum != flt.checksum && err == nil, err
+	return res.Checksum != flt.checksum && res.Checksum != flt.rejected && err == nil, err
 }
 
 // finalizeUpdate closes and gets rid of temporary file f with filter's content
-// according to updated.  It also saves new values of flt's name, rules number
-// and checksum if succeeded.
+// at path according to updated.  It also saves new values of flt's name, rules
+// number and checksum if succeeded.
 func (d *DNSFilter) finalizeUpdate(
 	file aghrenameio.PendingFile,
 	flt *FilterYAML,
+	path string,
 	res *rulelist.ParseResult,
 	returned error,
 	updated bool,
@@ -490,7 +564,7 @@ func (d *DNSFilter) finalizeUpdate(
 		return errors.WithDeferred(returned, file.Cleanup())
 	}
 
-	log.Info("filtering: saving contents of filter %d into %q", id, flt.Path(d.conf.DataDir))
+	log.Info("filtering: saving contents of filter %d into %q", id, path)
 
 	err = file.CloseReplace()
 	if err != nil {
@@ -622,10 +696,31 @@ func (d *DNSFilter) enableFiltersLocked(async bool) {
 		})
 	}
 
-	err := d.setFilters(filters, allowFilters, async)
+	canary := d.canaryFiltersLocked(filters, allowFilters)
+
+	err := d.setFilters(filters, allowFilters, canary, async)
 	if err != nil {
 		log.Error("filtering: enabling filters: %s", err)
 	}
 
 	d.SetEnabled(d.conf.FilteringEnabled)
 }
+
+// publishFilterUpdated publishes the event about the update of f, if the
+// events are configured.
+func (d *DNSFilter) publishFilterUpdated(f *FilterYAML) {
+	if d.conf.Events == nil {
+		return
+	}
+
+	d.conf.Events.Publish(context.Background(), &events.Event{
+		Data: map[string]string{
+			"id":          strconv.FormatInt(int64(f.ID), 10),
+			"url":         f.URL,
+			"rules_count": strconv.Itoa(f.RulesCount),
+		},
+		Type:     events.TypeFilterUpdated,
+		Message:  fmt.Sprintf("filter %q updated, %d rules", f.Name, f.RulesCount),
+		Severity: events.SeverityInfo,
+	})
+}
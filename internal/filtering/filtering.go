@@ -18,8 +18,10 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
@@ -27,6 +29,7 @@ import (
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/mathutil"
 	"github.com/AdguardTeam/golibs/syncutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -55,6 +58,33 @@ type Settings struct {
 
 	// ClientSafeSearch is a client configured safe search.
 	ClientSafeSearch SafeSearch
+
+	// PauseAllowlist are the domain names, including their subdomains, which
+	// are still resolved for the client while its internet access is paused.
+	PauseAllowlist []string
+
+	// ClientPaused is true if the internet access of the client is paused, so
+	// that all requests except the ones for PauseAllowlist are refused
+	// regardless of the other settings.
+	ClientPaused bool
+
+	// ClientDNSSEC overrides the DNSSEC setting of the DNS server for the
+	// client, unless it's [aghalg.NBNull].  If it's [aghalg.NBFalse], the
+	// upstreams are also asked not to validate the responses.
+	ClientDNSSEC aghalg.NullBool
+
+	// ClientBlockQUIC is true if the client must not use QUIC, so that the
+	// requests for the well-known QUIC bootstrap hostnames are answered with
+	// NXDOMAIN and the "h3" ALPN values are removed from the HTTPS records.
+	ClientBlockQUIC bool
+
+	// ClientDNS64Prefix, if valid, is the NAT64 prefix used instead of the
+	// global one to synthesize AAAA records for the client.
+	ClientDNS64Prefix netip.Prefix
+
+	// ClientDNS64Exclusions are the domain names, including their subdomains,
+	// for which AAAA records are never synthesized for the client.
+	ClientDNS64Exclusions []string
 }
 
 // Resolver is the interface for net.Resolver to simplify testing.
@@ -94,9 +124,27 @@ type Config struct {
 	// Register an HTTP handler
 	HTTPRegister aghhttp.RegisterFunc `yaml:"-"`
 
+	// UserName, if not nil, returns the name of the authenticated web user
+	// sending r, which is saved in the metadata of the added user rules.
+	UserName func(r *http.Request) (name string) `yaml:"-"`
+
 	// HTTPClient is the client to use for updating the remote filters.
 	HTTPClient *http.Client `yaml:"-"`
 
+	// ClockSane, if not nil, returns false while the system clock is wrong, so
+	// that the periodic updates of the filters, which depend on the
+	// validation of TLS certificates, are postponed.
+	ClockSane func() (ok bool) `yaml:"-"`
+
+	// MaintenanceActive, if not nil, returns true during the maintenance
+	// windows, so that the periodic updates of the filters are postponed.  The
+	// updates requested manually are still performed.
+	MaintenanceActive func() (ok bool) `yaml:"-"`
+
+	// Events, if not nil, receives the events about the updates of the
+	// filters.
+	Events events.Publisher `yaml:"-"`
+
 	// filtersMu protects filter lists.
 	filtersMu *sync.RWMutex
 
@@ -122,6 +170,10 @@ type Config struct {
 
 	Rewrites []*LegacyRewrite `yaml:"rewrites"`
 
+	// AnswerFilters are the rules filtering the responses by the IP addresses
+	// in their answers.
+	AnswerFilters []*AnswerFilter `yaml:"answer_filters"`
+
 	// Filters are the blocking filter lists.
 	Filters []FilterYAML `yaml:"-"`
 
@@ -131,16 +183,33 @@ type Config struct {
 	// UserRules is the global list of custom rules.
 	UserRules []string `yaml:"-"`
 
+	// UserRulesMeta is the metadata of the user rules.  The rules without
+	// metadata, for example imported ones, are allowed.
+	UserRulesMeta []*UserRuleMeta `yaml:"-"`
+
+	// Canary is the configuration of the staged rollout of the filter list
+	// updates.
+	Canary CanaryConfig `yaml:"canary"`
+
 	// SafeFSPatterns are the patterns for matching which local filtering-rule
 	// files can be added.
 	SafeFSPatterns []string `yaml:"safe_fs_patterns"`
 
+	// UnfilteredQueryTypes are the names of the DNS query types, such as "PTR"
+	// or "SOA", requests of which are never filtered.
+	UnfilteredQueryTypes []string `yaml:"unfiltered_query_types"`
+
 	SafeBrowsingCacheSize uint `yaml:"safebrowsing_cache_size"` // (in bytes)
 	SafeSearchCacheSize   uint `yaml:"safesearch_cache_size"`   // (in bytes)
 	ParentalCacheSize     uint `yaml:"parental_cache_size"`     // (in bytes)
 	// TODO(a.garipov): Use timeutil.Duration
 	CacheTime uint `yaml:"cache_time"` // Element's TTL (in minutes)
 
+	// NegativeCacheTime is the TTL of the cached safe browsing and parental
+	// control lookup results without any blocked hostnames.  If zero,
+	// CacheTime is used.
+	NegativeCacheTime timeutil.Duration `yaml:"negative_cache_time"`
+
 	// enabled is used to be returned within Settings.
 	//
 	// It is of type uint32 to be accessed by atomic.
@@ -207,6 +276,10 @@ type Stats struct {
 
 // Parameters to pass to filters-initializer goroutine
 type filtersInitializerParams struct {
+	// canary are the filters for the canary clients, if there is a staged
+	// rollout in progress.
+	canary *canaryFilters
+
 	allowFilters []Filter
 	blockFilters []Filter
 }
@@ -236,6 +309,15 @@ type DNSFilter struct {
 	rulesStorageAllow    *filterlist.RuleStorage
 	filteringEngineAllow *urlfilter.DNSEngine
 
+	// canaryStorage, canaryEngine, canaryStorageAllow, and canaryEngineAllow
+	// are the rules and the engines for the canary clients.  They're nil
+	// unless there is a staged rollout in progress.  They're protected by
+	// engineLock.
+	canaryStorage      *filterlist.RuleStorage
+	canaryEngine       *urlfilter.DNSEngine
+	canaryStorageAllow *filterlist.RuleStorage
+	canaryEngineAllow  *urlfilter.DNSEngine
+
 	safeSearch SafeSearch
 
 	// safeBrowsingChecker is the safe browsing hash-prefix checker.
@@ -261,9 +343,39 @@ type DNSFilter struct {
 
 	refreshLock *sync.Mutex
 
+	// updatesFailing is true if the last periodic update of the filters has
+	// failed because of a network error.
+	updatesFailing atomic.Bool
+
 	hostCheckers []hostChecker
 
 	safeFSPatterns []string
+
+	// unfilteredQTypes is the set of DNS query types that are never filtered.
+	// It is not modified after the initialization.
+	unfilteredQTypes *container.MapSet[uint16]
+
+	// canaryClients are the names and the IP addresses of the canary clients
+	// of the staged rollout.  It's nil if the staged rollout is disabled.  It
+	// is not modified after the initialization.
+	canaryClients *container.MapSet[string]
+
+	// answerFilters are the validated answer filters.  It's protected by
+	// confMu.
+	answerFilters []*answerFilter
+
+	// rollout is the staged rollout of the filter list updates in progress,
+	// if any.  It's protected by conf.filtersMu.
+	rollout *filterRollout
+
+	// rolloutActive is true while rollout isn't nil, so that the responses
+	// are only counted during the rollout.
+	rolloutActive atomic.Bool
+
+	// canaryResps and baselineResps are the responses to the canary and the
+	// other clients counted during the staged rollout.
+	canaryResps   responseCounters
+	baselineResps responseCounters
 }
 
 // Filter represents a filter list
@@ -322,6 +434,25 @@ const (
 	//
 	// See https://github.com/AdguardTeam/AdGuardHome/issues/2499.
 	RewrittenRule
+
+	// FilteredPaused is returned when the request is refused, because the
+	// internet access of the client is paused.
+	FilteredPaused
+
+	// FilteredQUIC is returned when the request for a well-known QUIC
+	// bootstrap hostname is answered with NXDOMAIN, because QUIC is blocked for
+	// the client.
+	FilteredQUIC
+
+	// FilteredAnswerIP is returned when the response is blocked or its
+	// addresses are rewritten, because the addresses in its answers match an
+	// answer filter.
+	FilteredAnswerIP
+
+	// FilteredRebinding is returned when the response is blocked by the DNS
+	// rebinding protection, because it resolves a public hostname to an
+	// internal address.
+	FilteredRebinding
 )
 
 // TODO(a.garipov): Resync with actual code names or replace completely
@@ -341,6 +472,12 @@ var reasonNames = []string{
 	Rewritten:          "Rewrite",
 	RewrittenAutoHosts: "RewriteEtcHosts",
 	RewrittenRule:      "RewriteRule",
+
+	FilteredPaused: "FilteredPaused",
+	FilteredQUIC:   "FilteredQUIC",
+
+	FilteredAnswerIP:  "FilteredAnswerIP",
+	FilteredRebinding: "FilteredRebinding",
 }
 
 func (r Reason) String() string {
@@ -388,16 +525,24 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 	c.Filters = slices.Clone(d.conf.Filters)
 	c.WhitelistFilters = slices.Clone(d.conf.WhitelistFilters)
 	c.UserRules = slices.Clone(d.conf.UserRules)
+	c.UserRulesMeta = cloneUserRulesMeta(d.conf.UserRulesMeta)
 }
 
 // setFilters sets new filters, synchronously or asynchronously.  When filters
 // are set asynchronously, the old filters continue working until the new
-// filters are ready.
+// filters are ready.  canary are the filters for the canary clients, if there
+// is a staged rollout in progress.
 //
 // In this case the caller must ensure that the old filter files are intact.
-func (d *DNSFilter) setFilters(blockFilters, allowFilters []Filter, async bool) error {
+func (d *DNSFilter) setFilters(
+	blockFilters []Filter,
+	allowFilters []Filter,
+	canary *canaryFilters,
+	async bool,
+) error {
 	if async {
 		params := filtersInitializerParams{
+			canary:       canary,
 			allowFilters: allowFilters,
 			blockFilters: blockFilters,
 		}
@@ -421,7 +566,12 @@ func (d *DNSFilter) setFilters(blockFilters, allowFilters []Filter, async bool)
 		return nil
 	}
 
-	return d.initFiltering(allowFilters, blockFilters)
+	err := d.initFiltering(allowFilters, blockFilters)
+	if err != nil {
+		return err
+	}
+
+	return d.initCanaryFiltering(canary)
 }
 
 // Close - close the object
@@ -434,6 +584,7 @@ func (d *DNSFilter) Close() {
 	}
 
 	d.reset()
+	d.resetCanary()
 }
 
 func (d *DNSFilter) reset() {
@@ -555,6 +706,10 @@ type Result struct {
 	// Reason is set to FilteredBlockedService.
 	ServiceName string `json:",omitempty"`
 
+	// AnswerFilter is the name of the matched answer filter.  It is empty
+	// unless Reason is set to FilteredAnswerIP.
+	AnswerFilter string `json:",omitempty"`
+
 	// IPList is the lookup rewrite result.  It is empty unless Reason is set to
 	// Rewritten.
 	IPList []netip.Addr `json:",omitempty"`
@@ -591,7 +746,7 @@ func (d *DNSFilter) CheckHost(
 ) (res Result, err error) {
 	// Sometimes clients try to resolve ".", which is a request to get root
 	// servers.
-	if host == "" {
+	if host == "" || d.IsUnfilteredQueryType(qtype) {
 		return Result{}, nil
 	}
 
@@ -618,6 +773,27 @@ func (d *DNSFilter) CheckHost(
 	return Result{}, nil
 }
 
+// IsUnfilteredQueryType returns true if requests of type qtype must not be
+// filtered according to the configuration.
+func (d *DNSFilter) IsUnfilteredQueryType(qtype uint16) (ok bool) {
+	return d.unfilteredQTypes.Has(qtype)
+}
+
+// parseQueryTypes parses the names of DNS query types into a set.
+func parseQueryTypes(names []string) (qtypes *container.MapSet[uint16], err error) {
+	qtypes = container.NewMapSet[uint16]()
+	for i, name := range names {
+		qt, ok := dns.StringToType[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("at index %d: unknown query type %q", i, name)
+		}
+
+		qtypes.Add(qt)
+	}
+
+	return qtypes, nil
+}
+
 // processRewrites performs filtering based on the legacy rewrite records.
 //
 // Firstly, it finds CNAME rewrites for host.  If the CNAME is the same as host,
@@ -927,18 +1103,23 @@ func (d *DNSFilter) matchHost(
 	// TODO(e.burkov):  Inspect if the above is true.
 	defer d.engineLock.RUnlock()
 
-	if setts.ProtectionEnabled && d.filteringEngineAllow != nil {
-		dnsres, ok := d.filteringEngineAllow.MatchRequest(ufReq)
+	engine, engineAllow := d.filteringEngine, d.filteringEngineAllow
+	if d.canaryEngine != nil && d.isCanaryClient(setts) {
+		engine, engineAllow = d.canaryEngine, d.canaryEngineAllow
+	}
+
+	if setts.ProtectionEnabled && engineAllow != nil {
+		dnsres, ok := engineAllow.MatchRequest(ufReq)
 		if ok {
 			return d.matchHostProcessAllowList(host, dnsres)
 		}
 	}
 
-	if d.filteringEngine == nil {
+	if engine == nil {
 		return Result{}, nil
 	}
 
-	dnsres, matchedEngine := d.filteringEngine.MatchRequest(ufReq)
+	dnsres, matchedEngine := engine.MatchRequest(ufReq)
 
 	// Check DNS rewrites first, because the API there is a bit awkward.
 	dnsRWRes := d.processDNSResultRewrites(dnsres, host)
@@ -1011,6 +1192,11 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		d.safeFSPatterns = append(d.safeFSPatterns, p)
 	}
 
+	d.unfilteredQTypes, err = parseQueryTypes(c.UnfilteredQueryTypes)
+	if err != nil {
+		return nil, fmt.Errorf("unfiltered_query_types: %w", err)
+	}
+
 	d.hostCheckers = []hostChecker{{
 		check: d.matchSysHosts,
 		name:  "hosts container",
@@ -1036,9 +1222,11 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	d.conf = c
 	d.conf.filtersMu = &sync.RWMutex{}
 
-	err = d.prepareRewrites()
+	d.prepareRewrites()
+
+	d.answerFilters, err = newAnswerFilters(d.conf.AnswerFilters)
 	if err != nil {
-		return nil, fmt.Errorf("rewrites: preparing: %w", err)
+		return nil, fmt.Errorf("answer_filters: %w", err)
 	}
 
 	if d.conf.BlockedServices != nil {
@@ -1048,6 +1236,15 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		}
 	}
 
+	err = d.conf.Canary.validate()
+	if err != nil {
+		return nil, fmt.Errorf("canary: %w", err)
+	}
+
+	if d.conf.Canary.Enabled {
+		d.canaryClients = container.NewMapSet(d.conf.Canary.Clients...)
+	}
+
 	if blockFilters != nil {
 		err = d.initFiltering(nil, blockFilters)
 		if err != nil {
@@ -1064,6 +1261,8 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("making filtering directory: %w", err)
 	}
 
+	d.removeStaleCanaryFiles()
+
 	d.loadFilters(d.conf.Filters)
 	d.loadFilters(d.conf.WhitelistFilters)
 
@@ -1086,13 +1285,20 @@ func (d *DNSFilter) Start() {
 	go d.updatesLoop()
 }
 
-// updatesLoop initializes new filters and checks for filters updates in a loop.
+// updatesLoop initializes new filters, checks for filters updates, removes the
+// expired user rules, and checks the staged rollout in a loop.
 func (d *DNSFilter) updatesLoop() {
 	defer log.OnPanic("filtering: updates loop")
 
 	ivl := time.Second * 5
 	t := time.NewTimer(ivl)
 
+	expiryTicker := time.NewTicker(userRulesExpiryIvl)
+	defer expiryTicker.Stop()
+
+	rolloutTicker := time.NewTicker(rolloutCheckIvl)
+	defer rolloutTicker.Stop()
+
 	for {
 		select {
 		case params := <-d.filtersInitializerChan:
@@ -1102,9 +1308,20 @@ func (d *DNSFilter) updatesLoop() {
 
 				continue
 			}
+
+			err = d.initCanaryFiltering(params.canary)
+			if err != nil {
+				log.Error("filtering: initializing: %s", err)
+
+				continue
+			}
 		case <-t.C:
 			ivl = d.periodicallyRefreshFilters(ivl)
 			t.Reset(ivl)
+		case <-expiryTicker.C:
+			d.expireUserRules()
+		case <-rolloutTicker.C:
+			d.checkRollout()
 		case <-d.done:
 			t.Stop()
 
@@ -1113,6 +1330,12 @@ func (d *DNSFilter) updatesLoop() {
 	}
 }
 
+// UpdatesFailing returns true if the last periodic update of the filters has
+// failed because of a network error.  Such updates are retried with backoff.
+func (d *DNSFilter) UpdatesFailing() (ok bool) {
+	return d.updatesFailing.Load()
+}
+
 // periodicallyRefreshFilters checks for filters updates and returns time
 // interval for the next update.
 func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.Duration) {
@@ -1122,14 +1345,32 @@ func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.
 		return ivl
 	}
 
+	if d.conf.ClockSane != nil && !d.conf.ClockSane() {
+		log.Debug("filtering: system clock is wrong, postponing updates")
+
+		return ivl
+	}
+
+	if d.conf.MaintenanceActive != nil && d.conf.MaintenanceActive() {
+		log.Debug("filtering: maintenance window is active, postponing updates")
+
+		return ivl
+	}
+
 	isNetErr, ok := false, false
 	_, isNetErr, ok = d.tryRefreshFilters(true, true, false)
 
+	if ok {
+		d.updatesFailing.Store(isNetErr)
+	}
+
 	if ok && !isNetErr {
 		ivl = maxInterval
 	} else if isNetErr {
+		// Retry with backoff, since the network may not be up yet, for
+		// example on boot.
 		ivl *= 2
-		ivl = max(ivl, maxInterval)
+		ivl = min(ivl, maxInterval)
 	}
 
 	return ivl
@@ -164,6 +164,54 @@ func TestDNSFilter_CheckHost_hostRules(t *testing.T) {
 	assert.Equal(t, res.Rules[0].IP, netutil.IPv6Localhost())
 }
 
+func TestDNSFilter_CheckHost_unfilteredQueryTypes(t *testing.T) {
+	filters := []Filter{{
+		ID: 0, Data: []byte("||example.org^\n"),
+	}}
+	d, setts := newForTest(t, &Config{
+		UnfilteredQueryTypes: []string{"ptr", "SOA"},
+	}, filters)
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name         string
+		qtype        uint16
+		wantFiltered bool
+	}{{
+		name:         "a",
+		qtype:        dns.TypeA,
+		wantFiltered: true,
+	}, {
+		name:         "ptr",
+		qtype:        dns.TypePTR,
+		wantFiltered: false,
+	}, {
+		name:         "soa",
+		qtype:        dns.TypeSOA,
+		wantFiltered: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := d.CheckHost("example.org", tc.qtype, setts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantFiltered, res.IsFiltered)
+		})
+	}
+
+	t.Run("bad_type", func(t *testing.T) {
+		_, err := New(&Config{
+			UnfilteredQueryTypes: []string{"BAD"},
+		}, nil)
+		testutil.AssertErrorMsg(
+			t,
+			`unfiltered_query_types: at index 0: unknown query type "BAD"`,
+			err,
+		)
+	})
+}
+
 // Safe Browsing.
 
 func TestSafeBrowsing(t *testing.T) {
@@ -548,7 +596,7 @@ func TestWhitelist(t *testing.T) {
 	}}
 	d, setts := newForTest(t, nil, filters)
 
-	err := d.setFilters(filters, whiteFilters, false)
+	err := d.setFilters(filters, whiteFilters, nil, false)
 	require.NoError(t, err)
 
 	t.Cleanup(d.Close)
@@ -1,10 +1,19 @@
 package hashprefix
 
 import (
+	"bufio"
+	"container/list"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
 )
 
 // expirySize is the size of expiry in cacheItem.
@@ -17,6 +26,9 @@ type cacheItem struct {
 
 	// hashes is the hashed hostnames.
 	hashes []hostnameHash
+
+	// pref is the hash prefix the item is stored for.
+	pref prefix
 }
 
 // toCacheItem decodes cacheItem from data.  data must be at least equal to
@@ -53,6 +65,194 @@ func fromCacheItem(item *cacheItem) (data []byte) {
 	return data
 }
 
+// size returns the number of bytes item occupies in the cache.
+func (item *cacheItem) size() (n uint) {
+	return prefixLen + expirySize + uint(len(item.hashes))*hashSize
+}
+
+// cache is the size-bounded LRU cache of the hash-prefix lookup results, which
+// can be saved to and loaded from a file.  It's safe for concurrent use.
+type cache struct {
+	// mu protects all the fields below.
+	mu *sync.Mutex
+
+	// items are the elements of lru by their prefixes.
+	items map[prefix]*list.Element
+
+	// lru contains the items, the most recently used one first.
+	lru *list.List
+
+	// size is the number of bytes occupied by the items.
+	size uint
+
+	// maxSize is the maximum number of bytes occupied by the items.  If zero,
+	// the size is unlimited.
+	maxSize uint
+}
+
+// newCache returns a new properly initialized *cache.
+func newCache(maxSize uint) (c *cache) {
+	return &cache{
+		mu:      &sync.Mutex{},
+		items:   map[prefix]*list.Element{},
+		lru:     list.New(),
+		maxSize: maxSize,
+	}
+}
+
+// get returns the item stored for pref or nil if there is none.
+func (c *cache) get(pref prefix) (item *cacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[pref]
+	if !ok {
+		return nil
+	}
+
+	c.lru.MoveToFront(e)
+
+	return e.Value.(*cacheItem)
+}
+
+// set stores item, evicting the least recently used items if the cache is out
+// of space.  item is not stored if it doesn't fit into the cache at all.
+func (c *cache) set(item *cacheItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(item.pref)
+
+	n := item.size()
+	if c.maxSize > 0 && n > c.maxSize {
+		return
+	}
+
+	for c.maxSize > 0 && c.size+n > c.maxSize {
+		oldest := c.lru.Back()
+		c.removeLocked(oldest.Value.(*cacheItem).pref)
+	}
+
+	c.items[item.pref] = c.lru.PushFront(item)
+	c.size += n
+}
+
+// removeLocked removes the item stored for pref, if any.  c.mu is expected to
+// be locked.
+func (c *cache) removeLocked(pref prefix) {
+	e, ok := c.items[pref]
+	if !ok {
+		return
+	}
+
+	c.lru.Remove(e)
+	delete(c.items, pref)
+	c.size -= e.Value.(*cacheItem).size()
+}
+
+// len returns the number of the items and the number of bytes they occupy.
+func (c *cache) len() (n int, size uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items), c.size
+}
+
+// cacheFileVersion is the version of the format of the cache file.  It must be
+// changed each time the format changes.
+const cacheFileVersion byte = 1
+
+// save writes the items that aren't expired at now to the file at p, the least
+// recently used one first.  The file consists of a version byte followed by the
+// records of a prefix, a big-endian uint32 number of hashes, and the item
+// encoded with [fromCacheItem].
+func (c *cache) save(p string, now time.Time) (err error) {
+	data := []byte{cacheFileVersion}
+
+	func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for e := c.lru.Back(); e != nil; e = e.Prev() {
+			item := e.Value.(*cacheItem)
+			if now.After(item.expiry) {
+				continue
+			}
+
+			data = append(data, item.pref[:]...)
+			data = binary.BigEndian.AppendUint32(data, uint32(len(item.hashes)))
+			data = append(data, fromCacheItem(item)...)
+		}
+	}()
+
+	err = maybe.WriteFile(p, data, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+
+	return nil
+}
+
+// load reads the items saved with [cache.save] from the file at p, skipping the
+// ones expired at now.  It's not an error if there is no file at p.
+func (c *cache) load(p string, now time.Time) (err error) {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("opening cache file: %w", err)
+	}
+
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	r := bufio.NewReader(f)
+	ver, err := r.ReadByte()
+	if errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading version: %w", err)
+	} else if ver != cacheFileVersion {
+		return fmt.Errorf("version: unsupported value %d", ver)
+	}
+
+	for i := 0; ; i++ {
+		var item *cacheItem
+		item, err = readCacheItem(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading item at index %d: %w", i, err)
+		}
+
+		if !now.After(item.expiry) {
+			c.set(item)
+		}
+	}
+}
+
+// readCacheItem reads a single item of the cache file from r.  err is
+// [io.EOF] if there are no more items.
+func readCacheItem(r io.Reader) (item *cacheItem, err error) {
+	var head [prefixLen + 4]byte
+	_, err = io.ReadFull(r, head[:])
+	if err != nil {
+		// Don't wrap the error, since the callers check for [io.EOF].
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(head[prefixLen:])
+	data := make([]byte, expirySize+uint(n)*hashSize)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, fmt.Errorf("reading hashes: %w", io.ErrUnexpectedEOF)
+	}
+
+	item = toCacheItem(data)
+	copy(item.pref[:], head[:prefixLen])
+
+	return item, nil
+}
+
 // findInCache finds hashes in the cache.  If nothing found returns list of
 // hashes, prefixes of which will be sent to upstream.
 func (c *Checker) findInCache(
@@ -62,16 +262,11 @@ func (c *Checker) findInCache(
 
 	i := 0
 	for _, hash := range hashes {
-		data := c.cache.Get(hash[:prefixLen])
-		if data == nil {
-			hashes[i] = hash
-			i++
-
-			continue
-		}
+		var pref prefix
+		copy(pref[:], hash[:])
 
-		item := toCacheItem(data)
-		if now.After(item.expiry) {
+		item := c.cache.get(pref)
+		if item == nil || now.After(item.expiry) {
 			hashes[i] = hash
 			i++
 
@@ -106,23 +301,27 @@ func (c *Checker) storeInCache(hashesToRequest, respHashes []hostnameHash) {
 	}
 
 	for _, hash := range hashesToRequest {
-		val := c.cache.Get(hash[:prefixLen])
-		if val == nil {
-			var pref prefix
-			copy(pref[:], hash[:])
+		var pref prefix
+		copy(pref[:], hash[:])
 
+		if _, ok := hashToStore[pref]; !ok {
 			c.setCache(pref, nil)
 		}
 	}
 }
 
-// setCache stores hash in cache.
+// setCache stores hash in cache.  The prefixes without any hashes are stored
+// for the negative cache time.
 func (c *Checker) setCache(pref prefix, hashes []hostnameHash) {
-	item := &cacheItem{
-		expiry: time.Now().Add(c.cacheTime),
-		hashes: hashes,
+	ttl := c.cacheTime
+	if len(hashes) == 0 {
+		ttl = c.negativeCacheTime
 	}
 
-	c.cache.Set(pref[:], fromCacheItem(item))
+	c.cache.set(&cacheItem{
+		expiry: time.Now().Add(ttl),
+		hashes: hashes,
+		pref:   pref,
+	})
 	log.Debug("%s: stored in cache: %v", c.svc, pref)
 }
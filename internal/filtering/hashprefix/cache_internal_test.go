@@ -1,10 +1,14 @@
 package hashprefix
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCacheItem(t *testing.T) {
@@ -42,3 +46,86 @@ func TestCacheItem(t *testing.T) {
 	gotData = fromCacheItem(newItem)
 	assert.Equal(t, wantData, gotData)
 }
+
+func TestCache_set(t *testing.T) {
+	newItem := func(b byte) (item *cacheItem) {
+		return &cacheItem{
+			expiry: time.Now().Add(time.Hour),
+			hashes: []hostnameHash{{b}},
+			pref:   prefix{b},
+		}
+	}
+
+	itemSize := newItem(0).size()
+	c := newCache(2 * itemSize)
+
+	c.set(newItem(1))
+	c.set(newItem(2))
+
+	// Use the first item to make the second one the least recently used.
+	require.NotNil(t, c.get(prefix{1}))
+
+	c.set(newItem(3))
+
+	n, size := c.len()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2*itemSize, size)
+
+	assert.NotNil(t, c.get(prefix{1}))
+	assert.Nil(t, c.get(prefix{2}))
+	assert.NotNil(t, c.get(prefix{3}))
+
+	// Replacing an item doesn't evict the other ones.
+	c.set(newItem(3))
+
+	n, _ = c.len()
+	assert.Equal(t, 2, n)
+}
+
+func TestCache_saveLoad(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+
+	c := newCache(0)
+	c.set(&cacheItem{
+		expiry: now.Add(time.Hour),
+		hashes: []hostnameHash{{1}, {2}},
+		pref:   prefix{1, 2},
+	})
+	c.set(&cacheItem{
+		expiry: now.Add(time.Minute),
+		hashes: nil,
+		pref:   prefix{3, 4},
+	})
+	c.set(&cacheItem{
+		expiry: now.Add(-time.Minute),
+		hashes: []hostnameHash{{5}},
+		pref:   prefix{5, 6},
+	})
+
+	p := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, c.save(p, now))
+
+	loaded := newCache(0)
+	require.NoError(t, loaded.load(p, now.Add(30*time.Minute)))
+
+	n, _ := loaded.len()
+	assert.Equal(t, 1, n)
+
+	item := loaded.get(prefix{1, 2})
+	require.NotNil(t, item)
+
+	assert.Equal(t, []hostnameHash{{1}, {2}}, item.hashes)
+	assert.Equal(t, now.Add(time.Hour), item.expiry)
+
+	t.Run("no_file", func(t *testing.T) {
+		assert.NoError(t, newCache(0).load(filepath.Join(t.TempDir(), "none"), now))
+	})
+
+	t.Run("bad_version", func(t *testing.T) {
+		badPath := filepath.Join(t.TempDir(), "cache")
+		require.NoError(t, os.WriteFile(badPath, []byte{0}, 0o600))
+
+		err := newCache(0).load(badPath, now)
+		testutil.AssertErrorMsg(t, "version: unsupported value 0", err)
+	})
+}
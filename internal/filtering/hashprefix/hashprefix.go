@@ -7,10 +7,10 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/AdguardTeam/dnsproxy/upstream"
-	"github.com/AdguardTeam/golibs/cache"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -61,20 +61,38 @@ type Config struct {
 	// TXTSuffix is the TXT suffix for DNS request.
 	TXTSuffix string
 
+	// CacheFilePath is the path to the file the cache is saved to on closing
+	// and loaded from on creation.  If empty, the cache isn't persisted.
+	CacheFilePath string
+
 	// CacheTime is the time period to store hash.
 	CacheTime time.Duration
 
-	// CacheSize is the maximum size of the cache.  If it's zero, cache size is
-	// unlimited.
+	// NegativeCacheTime is the time period to store the prefixes without any
+	// blocked hostnames.  If it's zero, CacheTime is used.
+	NegativeCacheTime time.Duration
+
+	// CacheSize is the maximum size of the cache in bytes.  If it's zero, cache
+	// size is unlimited.
 	CacheSize uint
 }
 
+// Checker checks the hostnames against a hash-prefix filter.
 type Checker struct {
 	// upstream is the upstream DNS server.
 	upstream upstream.Upstream
 
 	// cache stores hostname hashes.
-	cache cache.Cache
+	cache *cache
+
+	// hits is the number of checks resolved from the cache.
+	hits *atomic.Uint64
+
+	// misses is the number of checks requiring a request to the upstream.
+	misses *atomic.Uint64
+
+	// cacheFilePath is the path to the file the cache is persisted to, if any.
+	cacheFilePath string
 
 	// svc is the name of the service.
 	svc string
@@ -84,19 +102,81 @@ type Checker struct {
 
 	// cacheTime is the time period to store hash.
 	cacheTime time.Duration
+
+	// negativeCacheTime is the time period to store the prefixes without any
+	// blocked hostnames.
+	negativeCacheTime time.Duration
 }
 
-// New returns Checker.
+// New returns Checker.  The cache is loaded from conf.CacheFilePath, if it's
+// set; the errors of loading are logged, since the cache is only an
+// optimization.
 func New(conf *Config) (c *Checker) {
-	return &Checker{
-		upstream: conf.Upstream,
-		cache: cache.New(cache.Config{
-			EnableLRU: true,
-			MaxSize:   conf.CacheSize,
-		}),
-		svc:       conf.ServiceName,
-		txtSuffix: conf.TXTSuffix,
-		cacheTime: conf.CacheTime,
+	negTime := conf.NegativeCacheTime
+	if negTime == 0 {
+		negTime = conf.CacheTime
+	}
+
+	c = &Checker{
+		upstream:          conf.Upstream,
+		cache:             newCache(conf.CacheSize),
+		hits:              &atomic.Uint64{},
+		misses:            &atomic.Uint64{},
+		cacheFilePath:     conf.CacheFilePath,
+		svc:               conf.ServiceName,
+		txtSuffix:         conf.TXTSuffix,
+		cacheTime:         conf.CacheTime,
+		negativeCacheTime: negTime,
+	}
+
+	if c.cacheFilePath != "" {
+		err := c.cache.load(c.cacheFilePath, time.Now())
+		if err != nil {
+			log.Error("%s: loading cache: %s", c.svc, err)
+		}
+	}
+
+	return c
+}
+
+// Close saves the cache to the file, if it's persisted.
+func (c *Checker) Close() (err error) {
+	if c.cacheFilePath == "" {
+		return nil
+	}
+
+	err = c.cache.save(c.cacheFilePath, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: saving cache: %w", c.svc, err)
+	}
+
+	return nil
+}
+
+// CacheStats is the statistics of the cache of a [Checker].
+type CacheStats struct {
+	// Hits is the number of checks resolved from the cache.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of checks requiring a request to the upstream.
+	Misses uint64 `json:"misses"`
+
+	// Entries is the number of the cached hash prefixes.
+	Entries int `json:"entries"`
+
+	// Size is the number of bytes occupied by the cached data.
+	Size uint `json:"size"`
+}
+
+// CacheStats returns the statistics of the cache.
+func (c *Checker) CacheStats() (s *CacheStats) {
+	entries, size := c.cache.len()
+
+	return &CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+		Size:    size,
 	}
 }
 
@@ -106,11 +186,14 @@ func (c *Checker) Check(host string) (ok bool, err error) {
 
 	found, blocked, hashesToRequest := c.findInCache(hashes)
 	if found {
+		c.hits.Add(1)
 		log.Debug("%s: found %q in cache, blocked: %t", c.svc, host, blocked)
 
 		return blocked, nil
 	}
 
+	c.misses.Add(1)
+
 	question := c.getQuestion(hashesToRequest)
 
 	log.Debug("%s: checking %s: %s", c.svc, host, question)
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
-	"github.com/AdguardTeam/golibs/cache"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -96,11 +95,11 @@ func TestHostnameToHashes(t *testing.T) {
 
 func TestChecker_storeInCache(t *testing.T) {
 	c := &Checker{
-		svc:       "SafeBrowsing",
-		cacheTime: cacheTime,
+		svc:               "SafeBrowsing",
+		cacheTime:         cacheTime,
+		negativeCacheTime: cacheTime,
 	}
-	conf := cache.Config{}
-	c.cache = cache.New(conf)
+	c.cache = newCache(0)
 
 	// store in cache hashes for "3.sub.host.com" and "host.com"
 	//  and empty data for hash-prefix for "sub.host.com"
@@ -153,16 +152,20 @@ func TestChecker_storeInCache(t *testing.T) {
 	assert.True(t, ok)
 
 	c = &Checker{
-		svc:       "SafeBrowsing",
-		cacheTime: cacheTime,
+		svc:               "SafeBrowsing",
+		cacheTime:         cacheTime,
+		negativeCacheTime: cacheTime,
 	}
-	c.cache = cache.New(cache.Config{})
+	c.cache = newCache(0)
 
 	hashes = []hostnameHash{}
 	hash = sha256.Sum256([]byte("sub.host.com"))
 	hashes = append(hashes, hash)
 
-	c.cache.Set(hash[:prefixLen], make([]byte, expirySize+hashSize))
+	// Store an expired item.
+	item := toCacheItem(make([]byte, expirySize+hashSize))
+	copy(item.pref[:], hash[:])
+	c.cache.set(item)
 	found, _, _ = c.findInCache(hashes)
 	assert.False(t, found)
 }
@@ -208,21 +211,21 @@ func TestChecker_Check(t *testing.T) {
 
 		t.Run(tc.name, func(t *testing.T) {
 			// Firstly, check the request blocking.
-			hits := 0
 			res := false
 			res, err := c.Check(hostname)
 			require.NoError(t, err)
 
 			if tc.wantBlock {
 				assert.True(t, res)
-				hits++
 			} else {
 				require.False(t, res)
 			}
 
 			// Check the cache state, check the response is now cached.
-			assert.Equal(t, 1, c.cache.Stats().Count)
-			assert.Equal(t, hits, c.cache.Stats().Hit)
+			stats := c.CacheStats()
+			assert.Equal(t, 1, stats.Entries)
+			assert.Equal(t, uint64(0), stats.Hits)
+			assert.Equal(t, uint64(1), stats.Misses)
 
 			// There was one request to an upstream.
 			assert.Equal(t, 1, numReq)
@@ -238,8 +241,10 @@ func TestChecker_Check(t *testing.T) {
 			}
 
 			// Check the cache state, it should've been used.
-			assert.Equal(t, 1, c.cache.Stats().Count)
-			assert.Equal(t, hits+1, c.cache.Stats().Hit)
+			stats = c.CacheStats()
+			assert.Equal(t, 1, stats.Entries)
+			assert.Equal(t, uint64(1), stats.Hits)
+			assert.Equal(t, uint64(1), stats.Misses)
 
 			// Check that there were no additional requests.
 			assert.Equal(t, 1, numReq)
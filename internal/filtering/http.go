@@ -1,6 +1,7 @@
 package filtering
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,12 +10,15 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/miekg/dns"
 )
@@ -38,6 +42,20 @@ func (d *DNSFilter) validateFilterURL(urlStr string) (err error) {
 		return nil
 	}
 
+	if strings.HasPrefix(urlStr, schemeAXFR+"://") {
+		_, _, err = parseAXFRURL(urlStr)
+
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return validateFilterHTTPURL(urlStr)
+}
+
+// validateFilterHTTPURL returns an error if urlStr is not a valid HTTP(S) URL
+// of a filter list.
+func validateFilterHTTPURL(urlStr string) (err error) {
 	u, err := url.ParseRequestURI(urlStr)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
@@ -59,9 +77,10 @@ func (d *DNSFilter) validateFilterURL(urlStr string) (err error) {
 }
 
 type filterAddJSON struct {
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	Whitelist bool   `json:"whitelist"`
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Format    ListFormat `json:"format"`
+	Whitelist bool       `json:"whitelist"`
 }
 
 func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +93,10 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 	}
 
 	err = d.validateFilterURL(fj.URL)
+	if err == nil {
+		err = validateListFormat(fj.Format)
+	}
+
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
@@ -94,6 +117,7 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 		URL:     fj.URL,
 		Name:    fj.Name,
 		white:   fj.Whitelist,
+		Format:  fj.Format,
 		Filter: Filter{
 			ID: d.idGen.next(),
 		},
@@ -262,6 +286,14 @@ func (d *DNSFilter) handleFilteringSetURL(w http.ResponseWriter, r *http.Request
 // filteringRulesReq is the JSON structure for settings custom filtering rules.
 type filteringRulesReq struct {
 	Rules []string `json:"rules"`
+
+	// Reason is the reason for the change saved in the metadata of the added
+	// rules.
+	Reason string `json:"reason"`
+
+	// ExpiresAt, if not empty, is the time in RFC 3339 format when the added
+	// rules are automatically removed.  It must be in the future.
+	ExpiresAt string `json:"expires_at"`
 }
 
 func (d *DNSFilter) handleFilteringSetRules(w http.ResponseWriter, r *http.Request) {
@@ -277,7 +309,43 @@ func (d *DNSFilter) handleFilteringSetRules(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	d.conf.UserRules = req.Rules
+	now := time.Now()
+	newMeta := &UserRuleMeta{
+		AddedAt: now,
+		Reason:  req.Reason,
+	}
+
+	if req.ExpiresAt != "" {
+		newMeta.ExpiresAt, err = time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "parsing expires_at: %s", err)
+
+			return
+		} else if !newMeta.ExpiresAt.After(now) {
+			aghhttp.Error(r, w, http.StatusBadRequest, "expires_at: must be in the future")
+
+			return
+		}
+	}
+
+	if d.conf.UserName != nil {
+		newMeta.AddedBy = d.conf.UserName(r)
+	}
+
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		d.countRolloutUnblocks(d.conf.UserRules, req.Rules)
+		d.conf.UserRulesMeta = mergeUserRulesMeta(
+			d.conf.UserRulesMeta,
+			d.conf.UserRules,
+			req.Rules,
+			newMeta,
+		)
+		d.conf.UserRules = req.Rules
+	}()
+
 	d.conf.ConfigModified()
 	d.EnableFilters(true)
 }
@@ -319,6 +387,7 @@ type filterJSON struct {
 	URL         string               `json:"url"`
 	Name        string               `json:"name"`
 	LastUpdated string               `json:"last_updated,omitempty"`
+	Format      ListFormat           `json:"format,omitempty"`
 	ID          rulelist.URLFilterID `json:"id"`
 	RulesCount  uint32               `json:"rules_count"`
 	Enabled     bool                 `json:"enabled"`
@@ -338,6 +407,7 @@ func filterToJSON(f FilterYAML) filterJSON {
 		Enabled:    f.Enabled,
 		URL:        f.URL,
 		Name:       f.Name,
+		Format:     f.Format,
 		RulesCount: uint32(f.RulesCount),
 	}
 
@@ -426,6 +496,14 @@ type checkHostResp struct {
 
 func (d *DNSFilter) handleCheckHost(w http.ResponseWriter, r *http.Request) {
 	host := r.URL.Query().Get("name")
+	if _, err := netip.ParseAddr(host); err != nil {
+		host, err = aghnet.ParseDomainName(host)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "name: %s", err)
+
+			return
+		}
+	}
 
 	setts := d.Settings()
 	setts.FilteringEnabled = true
@@ -586,7 +664,55 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/filtering/set_url", d.handleFilteringSetURL)
 	registerHTTP(http.MethodPost, "/control/filtering/refresh", d.handleFilteringRefresh)
 	registerHTTP(http.MethodPost, "/control/filtering/set_rules", d.handleFilteringSetRules)
+	registerHTTP(http.MethodGet, "/control/filtering/user_rules", d.handleUserRules)
+	registerHTTP(http.MethodGet, "/control/filtering/rollout", d.handleRollout)
 	registerHTTP(http.MethodGet, "/control/filtering/check_host", d.handleCheckHost)
+	registerHTTP(http.MethodGet, "/control/filtering/export", d.handleFilteringExport)
+	registerHTTP(http.MethodGet, "/control/filtering/answer_filters", d.handleAnswerFiltersGet)
+	registerHTTP(
+		http.MethodPut,
+		"/control/filtering/answer_filters/update",
+		d.handleAnswerFiltersUpdate,
+	)
+}
+
+// handleFilteringExport is the handler for the GET /control/filtering/export
+// HTTP API.  The format is set by the format query parameter, which is "hosts"
+// by default.
+func (d *DNSFilter) handleFilteringExport(w http.ResponseWriter, r *http.Request) {
+	format := ExportFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ExportFormatHosts
+	}
+
+	var fileName string
+	switch format {
+	case ExportFormatHosts:
+		fileName = "adguardhome.hosts"
+	case ExportFormatDnsmasq:
+		fileName = "adguardhome.dnsmasq.conf"
+	default:
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: unsupported value %q", format)
+
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err := d.Export(buf, format)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "exporting: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, aghhttp.HdrValTextPlain)
+	h.Set(httphdr.ContentDisposition, fmt.Sprintf("attachment; filename=%s", fileName))
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("filtering: writing export: %s", err)
+	}
 }
 
 // ValidateUpdateIvl returns false if i is not a valid filters update interval.
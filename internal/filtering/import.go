@@ -0,0 +1,197 @@
+package filtering
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// ImportedFilter is a filter list imported from another DNS filtering
+// software.
+type ImportedFilter struct {
+	// URL is the HTTP(S) URL of the filter list.
+	URL string
+
+	// Name is the name of the filter list.
+	Name string
+
+	// Enabled defines if the filter list is enabled.
+	Enabled bool
+
+	// Allowlist is true if the filter list is an allowlist.
+	Allowlist bool
+}
+
+// ImportConfig is the filtering configuration imported from another DNS
+// filtering software.
+type ImportConfig struct {
+	// Filters are the filter lists to add.
+	Filters []*ImportedFilter
+
+	// UserRules are the rules to append to the user rules.
+	UserRules []string
+
+	// Rewrites are the rewrites to add.
+	Rewrites []*LegacyRewrite
+}
+
+// ImportResult contains the numbers of the added entities.
+type ImportResult struct {
+	// Filters is the number of the added filter lists.
+	Filters int
+
+	// UserRules is the number of the added user rules.
+	UserRules int
+
+	// Rewrites is the number of the added rewrites.
+	Rewrites int
+}
+
+// Import adds the filter lists, the user rules, and the rewrites from imp to d.
+// The duplicates are skipped, as well as the invalid entities, which are
+// reported in errs.  The added filter lists are downloaded in the background.
+func (d *DNSFilter) Import(imp *ImportConfig) (res *ImportResult, errs []error) {
+	res = &ImportResult{}
+
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		var filtErrs []error
+		res.Filters, filtErrs = d.conf.importFilters(imp.Filters, d.idGen.next)
+		errs = append(errs, filtErrs...)
+
+		res.UserRules = d.conf.importUserRules(imp.UserRules)
+	}()
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		var rwErrs []error
+		res.Rewrites, rwErrs = d.conf.importRewrites(imp.Rewrites)
+		errs = append(errs, rwErrs...)
+	}()
+
+	if *res == (ImportResult{}) {
+		return res, errs
+	}
+
+	d.conf.ConfigModified()
+
+	if res.UserRules > 0 {
+		d.EnableFilters(true)
+	}
+
+	if res.Filters > 0 {
+		go func() {
+			defer log.OnPanic("filtering: downloading imported filters")
+
+			_, _, _ = d.tryRefreshFilters(true, true, false)
+		}()
+	}
+
+	return res, errs
+}
+
+// Import is like [DNSFilter.Import] but adds the entities to c, which must not
+// be used by a [DNSFilter].  The added filter lists receive their IDs once c is
+// loaded.
+func (c *Config) Import(imp *ImportConfig) (res *ImportResult, errs []error) {
+	res = &ImportResult{}
+
+	var filtErrs, rwErrs []error
+	res.Filters, filtErrs = c.importFilters(imp.Filters, func() (id rulelist.URLFilterID) {
+		return 0
+	})
+	res.UserRules = c.importUserRules(imp.UserRules)
+	res.Rewrites, rwErrs = c.importRewrites(imp.Rewrites)
+
+	return res, append(filtErrs, rwErrs...)
+}
+
+// importFilters appends the filters to c, generating the IDs with newID, and
+// returns the number of the added ones.  c.filtersMu must be locked, if c is
+// used concurrently.
+func (c *Config) importFilters(
+	filters []*ImportedFilter,
+	newID func() (id rulelist.URLFilterID),
+) (n int, errs []error) {
+	for _, f := range filters {
+		err := validateFilterHTTPURL(f.URL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter %q: %w", f.URL, err))
+
+			continue
+		}
+
+		hasURL := func(flt FilterYAML) (ok bool) { return flt.URL == f.URL }
+		if slices.ContainsFunc(c.Filters, hasURL) ||
+			slices.ContainsFunc(c.WhitelistFilters, hasURL) {
+			continue
+		}
+
+		flt := FilterYAML{
+			Enabled: f.Enabled,
+			URL:     f.URL,
+			Name:    f.Name,
+			white:   f.Allowlist,
+			Filter: Filter{
+				ID: newID(),
+			},
+		}
+
+		if flt.white {
+			c.WhitelistFilters = append(c.WhitelistFilters, flt)
+		} else {
+			c.Filters = append(c.Filters, flt)
+		}
+
+		n++
+	}
+
+	return n, errs
+}
+
+// importUserRules appends the rules missing from the user rules of c and
+// returns the number of the added ones.  c.filtersMu must be locked, if c is
+// used concurrently.
+func (c *Config) importUserRules(rules []string) (n int) {
+	for _, r := range rules {
+		if !slices.Contains(c.UserRules, r) {
+			c.UserRules = append(c.UserRules, r)
+			n++
+		}
+	}
+
+	return n
+}
+
+// importRewrites appends the rewrites missing from c and returns the number of
+// the added ones.  The [DNSFilter] using c, if any, must be locked.
+func (c *Config) importRewrites(rewrites []*LegacyRewrite) (n int, errs []error) {
+	for _, rw := range rewrites {
+		rw = &LegacyRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		}
+
+		err := rw.normalize()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rewrite %q: %w", rw.Domain, err))
+
+			continue
+		}
+
+		if slices.ContainsFunc(c.Rewrites, rw.equal) {
+			continue
+		}
+
+		c.Rewrites = append(c.Rewrites, rw)
+		n++
+	}
+
+	return n, errs
+}
@@ -0,0 +1,81 @@
+package filtering
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Import(t *testing.T) {
+	c := &Config{
+		Filters: []FilterYAML{{
+			URL:  "https://example.com/existing.txt",
+			Name: "Existing",
+		}},
+		UserRules: []string{"||existing.example^"},
+		Rewrites: []*LegacyRewrite{{
+			Domain: "existing.example",
+			Answer: "1.2.3.4",
+		}},
+	}
+
+	res, errs := c.Import(&ImportConfig{
+		Filters: []*ImportedFilter{{
+			URL:     "https://example.com/existing.txt",
+			Name:    "Duplicate",
+			Enabled: true,
+		}, {
+			URL:     "https://example.com/block.txt",
+			Name:    "Block",
+			Enabled: true,
+		}, {
+			URL:       "https://example.com/allow.txt",
+			Name:      "Allow",
+			Enabled:   false,
+			Allowlist: true,
+		}, {
+			URL:     "/etc/pihole/local.txt",
+			Name:    "Local",
+			Enabled: true,
+		}},
+		UserRules: []string{
+			"||existing.example^",
+			"||new.example^",
+		},
+		Rewrites: []*LegacyRewrite{{
+			Domain: "EXISTING.example",
+			Answer: "1.2.3.4",
+		}, {
+			Domain: "new.example",
+			Answer: "new.target.example",
+		}, {
+			Domain: "",
+			Answer: "1.2.3.4",
+		}},
+	})
+	assert.Len(t, errs, 2)
+
+	require.NotNil(t, res)
+
+	assert.Equal(t, &ImportResult{
+		Filters:   2,
+		UserRules: 1,
+		Rewrites:  1,
+	}, res)
+
+	require.Len(t, c.Filters, 2)
+	require.Len(t, c.WhitelistFilters, 1)
+
+	assert.Equal(t, "Block", c.Filters[1].Name)
+	assert.True(t, c.Filters[1].Enabled)
+	assert.Equal(t, "Allow", c.WhitelistFilters[0].Name)
+	assert.False(t, c.WhitelistFilters[0].Enabled)
+
+	assert.Equal(t, []string{"||existing.example^", "||new.example^"}, c.UserRules)
+
+	require.Len(t, c.Rewrites, 2)
+
+	assert.Equal(t, "new.example", c.Rewrites[1].Domain)
+	assert.Equal(t, "new.target.example", c.Rewrites[1].Answer)
+}
@@ -0,0 +1,87 @@
+package filtering
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Reload applies the settings from c, which is usually read anew from the
+// configuration file, to d without recreating it.  The filtering rule lists,
+// the user rules and their metadata, the rewrites, the blocked services, the
+// protection, and the blocking mode settings are applied.  The other settings
+// of c, such as the cache sizes and the HTTP client, are ignored, since they
+// require a restart.
+//
+// The rule lists are reloaded asynchronously, so the old rules keep working
+// until the new ones are ready.  c must not be nil.  The rewrites of c are
+// normalized in place.
+func (d *DNSFilter) Reload(c *Config) (err error) {
+	err = PrepareReload(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	rewrites := cloneRewrites(c.Rewrites)
+
+	bsvc := c.BlockedServices
+	if bsvc != nil {
+		bsvc = bsvc.Clone()
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.ProtectionEnabled = c.ProtectionEnabled
+		d.conf.ProtectionDisabledUntil = c.ProtectionDisabledUntil
+		d.conf.ParentalEnabled = c.ParentalEnabled
+		d.conf.SafeBrowsingEnabled = c.SafeBrowsingEnabled
+		d.conf.BlockingMode = c.BlockingMode
+		d.conf.BlockingIPv4 = c.BlockingIPv4
+		d.conf.BlockingIPv6 = c.BlockingIPv6
+		d.conf.BlockedResponseTTL = c.BlockedResponseTTL
+		d.conf.Rewrites = rewrites
+		d.conf.BlockedServices = bsvc
+	}()
+
+	filters := deduplicateFilters(slices.Clone(c.Filters))
+	allowFilters := deduplicateFilters(slices.Clone(c.WhitelistFilters))
+
+	d.loadFilters(filters)
+	d.loadFilters(allowFilters)
+
+	d.conf.filtersMu.Lock()
+	defer d.conf.filtersMu.Unlock()
+
+	d.conf.FilteringEnabled = c.FilteringEnabled
+	d.conf.FiltersUpdateIntervalHours = c.FiltersUpdateIntervalHours
+	d.conf.Filters = filters
+	d.conf.WhitelistFilters = allowFilters
+	d.conf.UserRules = slices.Clone(c.UserRules)
+	d.conf.UserRulesMeta = cloneUserRulesMeta(c.UserRulesMeta)
+
+	d.idGen.fix(d.conf.Filters)
+	d.idGen.fix(d.conf.WhitelistFilters)
+
+	d.enableFiltersLocked(true)
+
+	return nil
+}
+
+// PrepareReload normalizes and validates c, so that [DNSFilter.Reload] doesn't
+// fail for it.  It allows checking the whole configuration before applying any
+// of its parts.  c must not be nil.  The rewrites of c are normalized in place
+// and the invalid ones are marked, see [normalizeLoadedRewrites].
+func PrepareReload(c *Config) (err error) {
+	c.Rewrites = normalizeLoadedRewrites(c.Rewrites)
+
+	if c.BlockedServices != nil {
+		err = c.BlockedServices.Validate()
+		if err != nil {
+			return fmt.Errorf("blocked services: %w", err)
+		}
+	}
+
+	return nil
+}
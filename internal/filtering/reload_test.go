@@ -0,0 +1,117 @@
+package filtering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_Reload(t *testing.T) {
+	const (
+		blockedHost   = "blocked.example"
+		rewrittenHost = "rewritten.example"
+	)
+
+	d, err := New(&Config{
+		FilteringEnabled: true,
+		DataDir:          t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	d.Start()
+
+	setts := &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	err = d.Reload(&Config{
+		Rewrites: []*LegacyRewrite{{
+			Domain: rewrittenHost,
+			Answer: "192.0.2.1",
+		}},
+		UserRules:          []string{"||" + blockedHost + "^"},
+		BlockingMode:       BlockingModeNXDOMAIN,
+		BlockedResponseTTL: 10,
+		FilteringEnabled:   true,
+		ProtectionEnabled:  true,
+	})
+	require.NoError(t, err)
+
+	mode, _, _ := d.BlockingMode()
+	assert.Equal(t, BlockingModeNXDOMAIN, mode)
+	assert.Equal(t, uint32(10), d.BlockedResponseTTL())
+
+	status, _ := d.ProtectionStatus()
+	assert.True(t, status)
+
+	res, err := d.CheckHost(rewrittenHost, dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, Rewritten, res.Reason)
+
+	assert.Eventually(t, func() (ok bool) {
+		res, err = d.CheckHost(blockedHost, dns.TypeA, setts)
+
+		return err == nil && res.IsFiltered
+	}, 1*time.Second, 10*time.Millisecond)
+
+	t.Run("bad_blocked_services", func(t *testing.T) {
+		err = d.Reload(&Config{
+			BlockedServices: &BlockedServices{
+				IDs: []string{"bad_service"},
+			},
+		})
+		testutil.AssertErrorMsg(t, `blocked services: unknown blocked-service "bad_service"`, err)
+
+		// The previous settings must be kept.
+		mode, _, _ = d.BlockingMode()
+		assert.Equal(t, BlockingModeNXDOMAIN, mode)
+	})
+
+	t.Run("bad_rewrite", func(t *testing.T) {
+		const invalidHost = "invalid.example"
+
+		invalid := &LegacyRewrite{
+			Domain: invalidHost,
+			Answer: "bad..answer",
+		}
+		c := &Config{
+			Rewrites: []*LegacyRewrite{nil, {
+				Domain: rewrittenHost,
+				Answer: "192.0.2.2",
+			}, invalid},
+			BlockingMode: BlockingModeNXDOMAIN,
+		}
+
+		// The empty rewrites are skipped and the invalid ones are ignored.
+		err = d.Reload(c)
+		require.NoError(t, err)
+		require.Len(t, c.Rewrites, 2)
+
+		res, err = d.CheckHost(rewrittenHost, dns.TypeA, setts)
+		require.NoError(t, err)
+		require.NotEmpty(t, res.IPList)
+
+		assert.Equal(t, "192.0.2.2", res.IPList[0].String())
+
+		res, err = d.CheckHost(invalidHost, dns.TypeA, setts)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, Rewritten, res.Reason)
+		assert.Len(t, d.Rewrites(), 1)
+
+		// The invalid rewrites must survive writing the configuration.
+		written := &Config{}
+		d.WriteDiskConfig(written)
+		require.Len(t, written.Rewrites, 2)
+
+		assert.Equal(t, invalidHost, written.Rewrites[1].Domain)
+		assert.Equal(t, invalid.Answer, written.Rewrites[1].Answer)
+	})
+}
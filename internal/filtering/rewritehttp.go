@@ -52,8 +52,6 @@ func (d *DNSFilter) handleRewriteAdd(w http.ResponseWriter, r *http.Request) {
 
 	err = rw.normalize()
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.Error(r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
@@ -90,6 +88,7 @@ func (d *DNSFilter) handleRewriteDelete(w http.ResponseWriter, r *http.Request)
 		Domain: jsent.Domain,
 		Answer: jsent.Answer,
 	}
+	normalizeTarget(entDel)
 	arr := []*LegacyRewrite{}
 
 	func() {
@@ -111,6 +110,16 @@ func (d *DNSFilter) handleRewriteDelete(w http.ResponseWriter, r *http.Request)
 	d.conf.ConfigModified()
 }
 
+// normalizeTarget normalizes the rewrite entry rw, which is looked up among
+// the existing ones.  The error is only logged, since the invalid entry is
+// still looked up as is and may be found.  rw must not be nil.
+func normalizeTarget(rw *LegacyRewrite) {
+	err := rw.normalize()
+	if err != nil {
+		log.Debug("rewrite: normalizing target: %s", err)
+	}
+}
+
 // rewriteUpdateJSON is a struct for JSON object with rewrite rule update info.
 type rewriteUpdateJSON struct {
 	Target rewriteEntryJSON `json:"target"`
@@ -132,6 +141,7 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 		Domain: updateJSON.Target.Domain,
 		Answer: updateJSON.Target.Answer,
 	}
+	normalizeTarget(rwDel)
 
 	rwAdd := &LegacyRewrite{
 		Domain: updateJSON.Update.Domain,
@@ -140,8 +150,6 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 
 	err = rwAdd.normalize()
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.Error(r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
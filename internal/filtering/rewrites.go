@@ -6,6 +6,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/miekg/dns"
@@ -30,6 +31,11 @@ type LegacyRewrite struct {
 
 	// Type is the DNS record type: A, AAAA, or CNAME.
 	Type uint16 `yaml:"-"`
+
+	// invalid is true if the rewrite is loaded from the configuration file and
+	// is invalid.  Such rewrites never match, but are kept, so that writing the
+	// configuration file doesn't remove them.
+	invalid bool
 }
 
 // equal returns true if the rw is equal to the other.
@@ -55,18 +61,21 @@ func (rw *LegacyRewrite) matchesQType(qt uint16) (ok bool) {
 }
 
 // normalize makes sure that the new or decoded entry is normalized with regards
-// to domain name case, IP length, and so on.
+// to domain name case, punycode, IP length, and so on.  rw.Domain and rw.Answer
+// are only changed if they are valid.
 //
-// If rw is nil, it returns an errors.
+// If rw is nil or contains an invalid domain name, it returns an error.
 func (rw *LegacyRewrite) normalize() (err error) {
 	if rw == nil {
 		return errors.Error("nil rewrite entry")
 	}
 
-	// TODO(a.garipov): Write a case-agnostic version of strings.HasSuffix and
-	// use it in matchDomainWildcard instead of using strings.ToLower
-	// everywhere.
-	rw.Domain = strings.ToLower(rw.Domain)
+	domain, err := aghnet.ParseDomainNamePattern(rw.Domain)
+	if err != nil {
+		return fmt.Errorf("domain: %w", err)
+	}
+
+	rw.Domain = domain
 
 	switch rw.Answer {
 	case "AAAA":
@@ -88,6 +97,16 @@ func (rw *LegacyRewrite) normalize() (err error) {
 		log.Debug("normalizing legacy rewrite: %s", err)
 		rw.Type = dns.TypeCNAME
 
+		var answer string
+		// Allow the wildcards, since the answer equal to the pattern is an
+		// exception.
+		answer, err = aghnet.ParseDomainNamePattern(rw.Answer)
+		if err != nil {
+			return fmt.Errorf("answer: %w", err)
+		}
+
+		rw.Answer = answer
+
 		return nil
 	}
 
@@ -135,16 +154,38 @@ func (rw *LegacyRewrite) Compare(b *LegacyRewrite) (res int) {
 	}
 }
 
-// prepareRewrites normalizes and validates all legacy DNS rewrites.
-func (d *DNSFilter) prepareRewrites() (err error) {
-	for i, r := range d.conf.Rewrites {
-		err = r.normalize()
-		if err != nil {
-			return fmt.Errorf("at index %d: %w", i, err)
+// prepareRewrites normalizes all legacy DNS rewrites loaded from the
+// configuration file and marks the invalid ones, see
+// [normalizeLoadedRewrites].
+func (d *DNSFilter) prepareRewrites() {
+	d.conf.Rewrites = normalizeLoadedRewrites(d.conf.Rewrites)
+}
+
+// normalizeLoadedRewrites normalizes rws, which are loaded from the
+// configuration file, in place and returns them without the nil ones.  The
+// invalid ones are logged and marked instead of failing the load, since the
+// previous versions accepted them.  They are excluded from matching, but kept
+// in the configuration file.  The rewrites added via the HTTP API are
+// validated strictly.
+func normalizeLoadedRewrites(rws []*LegacyRewrite) (res []*LegacyRewrite) {
+	res = rws[:0:0]
+	for i, rw := range rws {
+		if rw == nil {
+			log.Info("filtering: warning: skipping empty rewrite at index %d", i)
+
+			continue
 		}
+
+		err := rw.normalize()
+		rw.invalid = err != nil
+		if rw.invalid {
+			log.Info("filtering: warning: ignoring invalid rewrite at index %d: %s", i, err)
+		}
+
+		res = append(res, rw)
 	}
 
-	return nil
+	return res
 }
 
 // findRewrites returns the list of matched rewrite entries.  If rewrites are
@@ -160,7 +201,7 @@ func findRewrites(
 	qtype uint16,
 ) (rewrites []*LegacyRewrite, matched bool) {
 	for _, e := range entries {
-		if e.Domain != host && !matchDomainWildcard(host, e.Domain) {
+		if e.invalid || e.Domain != host && !matchDomainWildcard(host, e.Domain) {
 			continue
 		}
 
@@ -213,12 +254,25 @@ func cloneRewrites(entries []*LegacyRewrite) (clone []*LegacyRewrite) {
 	clone = make([]*LegacyRewrite, len(entries))
 	for i, rw := range entries {
 		clone[i] = &LegacyRewrite{
-			Domain: rw.Domain,
-			Answer: rw.Answer,
-			IP:     rw.IP,
-			Type:   rw.Type,
+			Domain:  rw.Domain,
+			Answer:  rw.Answer,
+			IP:      rw.IP,
+			Type:    rw.Type,
+			invalid: rw.invalid,
 		}
 	}
 
 	return clone
 }
+
+// Rewrites returns a deep copy of the valid legacy DNS rewrites.
+func (d *DNSFilter) Rewrites() (rewrites []*LegacyRewrite) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	rewrites = cloneRewrites(d.conf.Rewrites)
+
+	return slices.DeleteFunc(rewrites, func(rw *LegacyRewrite) (ok bool) {
+		return rw.invalid
+	})
+}
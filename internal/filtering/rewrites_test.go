@@ -5,6 +5,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -88,7 +89,7 @@ func TestRewrites(t *testing.T) {
 		Answer: addr1v4.String(),
 	}}
 
-	require.NoError(t, d.prepareRewrites())
+	d.prepareRewrites()
 
 	testCases := []struct {
 		name       string
@@ -236,7 +237,7 @@ func TestRewritesLevels(t *testing.T) {
 		Type:   dns.TypeA,
 	}}
 
-	require.NoError(t, d.prepareRewrites())
+	d.prepareRewrites()
 
 	testCases := []struct {
 		name string
@@ -280,7 +281,7 @@ func TestRewritesExceptionCNAME(t *testing.T) {
 		Answer: "*.sub.host.com",
 	}}
 
-	require.NoError(t, d.prepareRewrites())
+	d.prepareRewrites()
 
 	testCases := []struct {
 		name string
@@ -342,7 +343,7 @@ func TestRewritesExceptionIP(t *testing.T) {
 		Type:   dns.TypeA,
 	}}
 
-	require.NoError(t, d.prepareRewrites())
+	d.prepareRewrites()
 
 	testCases := []struct {
 		name       string
@@ -400,3 +401,70 @@ func TestRewritesExceptionIP(t *testing.T) {
 		})
 	}
 }
+
+func TestLegacyRewrite_normalize(t *testing.T) {
+	testCases := []struct {
+		rw         *LegacyRewrite
+		want       *LegacyRewrite
+		name       string
+		wantErrMsg string
+	}{{
+		rw: &LegacyRewrite{Domain: "*.Пример.РФ.", Answer: "1.2.3.4"},
+		want: &LegacyRewrite{
+			Domain: "*.xn--e1afmkfd.xn--p1ai",
+			Answer: "1.2.3.4",
+			IP:     netip.MustParseAddr("1.2.3.4"),
+			Type:   dns.TypeA,
+		},
+		name:       "idn",
+		wantErrMsg: "",
+	}, {
+		rw: &LegacyRewrite{Domain: "host.com", Answer: "Пример.РФ"},
+		want: &LegacyRewrite{
+			Domain: "host.com",
+			Answer: "xn--e1afmkfd.xn--p1ai",
+			Type:   dns.TypeCNAME,
+		},
+		name:       "idn_cname",
+		wantErrMsg: "",
+	}, {
+		rw:         &LegacyRewrite{Domain: "bad..host", Answer: "1.2.3.4"},
+		want:       &LegacyRewrite{Domain: "bad..host", Answer: "1.2.3.4"},
+		name:       "bad_domain",
+		wantErrMsg: `domain: bad domain name "bad..host": bad domain name label "": domain name label is empty`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rw.normalize()
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			assert.Equal(t, tc.want, tc.rw)
+		})
+	}
+}
+
+func TestNormalizeLoadedRewrites(t *testing.T) {
+	valid := &LegacyRewrite{Domain: "Host.Example", Answer: "1.2.3.4"}
+	rws := []*LegacyRewrite{
+		{Domain: "host-.local", Answer: "1.2.3.4"},
+		valid,
+		nil,
+		{Domain: "*example*", Answer: "1.2.3.4"},
+	}
+
+	got := normalizeLoadedRewrites(rws)
+	require.Len(t, got, 3)
+
+	assert.True(t, got[0].invalid)
+	assert.Equal(t, "host-.local", got[0].Domain)
+
+	assert.Same(t, valid, got[1])
+	assert.False(t, got[1].invalid)
+	assert.Equal(t, "host.example", got[1].Domain)
+
+	assert.True(t, got[2].invalid)
+
+	rewrites, matched := findRewrites(got, "host-.local", dns.TypeA)
+	assert.Empty(t, rewrites)
+	assert.False(t, matched)
+}
@@ -0,0 +1,529 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/miekg/dns"
+)
+
+// CanaryConfig is the configuration of the staged rollout of the filter list
+// updates.  When it's enabled, the updated filter lists are first only applied
+// to the canary clients, and then either promoted to everyone or reverted
+// depending on the breakage signals.
+type CanaryConfig struct {
+	// Clients are the names of the persistent clients and the IP addresses of
+	// the clients the updates are applied to first.
+	Clients []string `yaml:"clients"`
+
+	// Duration is the time during which the updates are only applied to
+	// Clients before they're promoted to everyone.
+	Duration timeutil.Duration `yaml:"duration"`
+
+	// MaxFailureIncrease is the maximum excess of the share of the SERVFAIL
+	// and NXDOMAIN responses to Clients over the one to the other clients.  If
+	// it's exceeded, the updates are reverted.  It must be within [0, 1].
+	MaxFailureIncrease float64 `yaml:"max_failure_increase"`
+
+	// MinRequests is the number of the requests from Clients after which the
+	// share of their failed responses is taken into account.
+	MinRequests uint64 `yaml:"min_requests"`
+
+	// MaxUnblocks is the maximum number of the allowlist user rules added
+	// during the rollout.  If it's exceeded, the updates are reverted.
+	MaxUnblocks uint `yaml:"max_unblocks"`
+
+	// Enabled defines if the staged rollout is used.  Otherwise, the updates
+	// are applied to everyone at once.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the enabled configuration is invalid.
+func (c *CanaryConfig) validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch {
+	case len(c.Clients) == 0:
+		return fmt.Errorf("clients: %w", errors.ErrEmptyValue)
+	case c.Duration.Duration <= 0:
+		return fmt.Errorf("duration: %w", errors.ErrNotPositive)
+	case c.MaxFailureIncrease < 0 || c.MaxFailureIncrease > 1:
+		return fmt.Errorf("max_failure_increase: %v must be within [0, 1]", c.MaxFailureIncrease)
+	default:
+		return nil
+	}
+}
+
+// rolloutCheckIvl is the interval of checking the staged rollout for breakage
+// and completion.
+const rolloutCheckIvl = 1 * time.Minute
+
+// filterRollout is a staged rollout of the filter list updates in progress.
+type filterRollout struct {
+	// start is the time when the rollout has started.
+	start time.Time
+
+	// lists are the updated filter lists by their IDs.  Their checksums, rule
+	// numbers, and names are the ones of the updated contents, which are
+	// stored in the canary files.
+	lists map[rulelist.URLFilterID]*FilterYAML
+
+	// unblocks is the number of the allowlist user rules added during the
+	// rollout.
+	unblocks uint
+}
+
+// responseCounters are the numbers of the responses to a group of clients
+// counted during a staged rollout.  It's safe for concurrent use.
+type responseCounters struct {
+	total  atomic.Uint64
+	failed atomic.Uint64
+}
+
+// reset sets the counters to zero.
+func (c *responseCounters) reset() {
+	c.total.Store(0)
+	c.failed.Store(0)
+}
+
+// failureRatio returns the share of the failed responses, or zero if there are
+// none.
+func (c *responseCounters) failureRatio() (r float64) {
+	total := c.total.Load()
+	if total == 0 {
+		return 0
+	}
+
+	return float64(c.failed.Load()) / float64(total)
+}
+
+// canaryFilters are the filters applied to the canary clients during a staged
+// rollout.
+type canaryFilters struct {
+	allowFilters []Filter
+	blockFilters []Filter
+}
+
+// canaryPath returns the path to the updated filter contents, which are only
+// applied to the canary clients during a staged rollout.
+func (filter *FilterYAML) canaryPath(dataDir string) (p string) {
+	return filepath.Join(dataDir, filterDir, strconv.FormatInt(int64(filter.ID), 10)+".canary.txt")
+}
+
+// removeStaleCanaryFiles removes the canary files left from a staged rollout
+// interrupted by a restart.
+func (d *DNSFilter) removeStaleCanaryFiles() {
+	paths, err := filepath.Glob(filepath.Join(d.conf.DataDir, filterDir, "*.canary.txt"))
+	if err != nil {
+		// Generally shouldn't happen, since the pattern is valid.
+		log.Error("filtering: searching canary files: %s", err)
+
+		return
+	}
+
+	for _, p := range paths {
+		err = os.Remove(p)
+		if err != nil {
+			log.Error("filtering: removing stale canary file: %s", err)
+		}
+	}
+}
+
+// isCanaryClient returns true if the client with setts is one of the canary
+// clients.
+func (d *DNSFilter) isCanaryClient(setts *Settings) (ok bool) {
+	if d.canaryClients == nil {
+		return false
+	}
+
+	return d.canaryClients.Has(setts.ClientName) ||
+		(setts.ClientIP.IsValid() && d.canaryClients.Has(setts.ClientIP.String()))
+}
+
+// RecordResponse counts the response with rcode to the client with setts as a
+// breakage signal of the staged rollout of the filter list updates, if there is
+// one in progress.  setts must not be nil.
+func (d *DNSFilter) RecordResponse(setts *Settings, rcode int) {
+	if !d.rolloutActive.Load() {
+		return
+	}
+
+	c := &d.baselineResps
+	if d.isCanaryClient(setts) {
+		c = &d.canaryResps
+	}
+
+	c.total.Add(1)
+	if rcode == dns.RcodeServerFailure || rcode == dns.RcodeNameError {
+		c.failed.Add(1)
+	}
+}
+
+// stageUpdate adds the update uf of a filter list to the staged rollout,
+// starting it if necessary.  d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) stageUpdate(uf *FilterYAML) {
+	if d.rollout == nil {
+		d.rollout = &filterRollout{
+			start: time.Now(),
+			lists: map[rulelist.URLFilterID]*FilterYAML{},
+		}
+
+		d.canaryResps.reset()
+		d.baselineResps.reset()
+		d.rolloutActive.Store(true)
+	}
+
+	staged := *uf
+	d.rollout.lists[uf.ID] = &staged
+
+	log.Info("filtering: staged update of filter %d with %d rules", uf.ID, uf.RulesCount)
+}
+
+// countRolloutUnblocks counts the allowlist rules from rules absent from
+// prevRules as the breakage signals of the staged rollout in progress, if any.
+// d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) countRolloutUnblocks(prevRules, rules []string) {
+	if d.rollout == nil {
+		return
+	}
+
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, "@@") && !slices.Contains(prevRules, rule) {
+			d.rollout.unblocks++
+		}
+	}
+}
+
+// canaryFiltersLocked returns the filters for the canary clients built from
+// the filters for everyone, or nil if there is no staged rollout in progress.
+// d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) canaryFiltersLocked(blockFilters, allowFilters []Filter) (c *canaryFilters) {
+	if d.rollout == nil {
+		return nil
+	}
+
+	stage := func(filters []Filter) (staged []Filter) {
+		staged = slices.Clone(filters)
+		for i, f := range staged {
+			if sf, ok := d.rollout.lists[f.ID]; ok {
+				staged[i].FilePath = sf.canaryPath(d.conf.DataDir)
+			}
+		}
+
+		return staged
+	}
+
+	return &canaryFilters{
+		allowFilters: stage(allowFilters),
+		blockFilters: stage(blockFilters),
+	}
+}
+
+// initCanaryFiltering initializes the filtering engines for the canary clients
+// from c, or removes them if c is nil.
+func (d *DNSFilter) initCanaryFiltering(c *canaryFilters) (err error) {
+	if c == nil {
+		d.engineLock.Lock()
+		defer d.engineLock.Unlock()
+
+		d.resetCanary()
+
+		return nil
+	}
+
+	storage, err := newRuleStorage(c.blockFilters)
+	if err != nil {
+		return fmt.Errorf("canary: %w", err)
+	}
+
+	storageAllow, err := newRuleStorage(c.allowFilters)
+	if err != nil {
+		return fmt.Errorf("canary: %w", err)
+	}
+
+	d.engineLock.Lock()
+	defer d.engineLock.Unlock()
+
+	d.resetCanary()
+	d.canaryStorage = storage
+	d.canaryEngine = urlfilter.NewDNSEngine(storage)
+	d.canaryStorageAllow = storageAllow
+	d.canaryEngineAllow = urlfilter.NewDNSEngine(storageAllow)
+
+	log.Debug("filtering: initialized canary filtering engine")
+
+	return nil
+}
+
+// resetCanary closes and removes the filtering engines for the canary clients.
+// d.engineLock is expected to be locked.
+func (d *DNSFilter) resetCanary() {
+	for _, rs := range []*filterlist.RuleStorage{d.canaryStorage, d.canaryStorageAllow} {
+		if rs == nil {
+			continue
+		}
+
+		if err := rs.Close(); err != nil {
+			log.Error("filtering: closing canary rule storage: %s", err)
+		}
+	}
+
+	d.canaryStorage, d.canaryEngine = nil, nil
+	d.canaryStorageAllow, d.canaryEngineAllow = nil, nil
+}
+
+// rolloutVerdict is the decision about a staged rollout in progress.
+type rolloutVerdict uint8
+
+// rolloutVerdict values.
+const (
+	rolloutVerdictWait rolloutVerdict = iota
+	rolloutVerdictPromote
+	rolloutVerdictRevert
+)
+
+// judgeRollout returns the decision about the staged rollout in progress at
+// now along with its reason.  d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) judgeRollout(now time.Time) (v rolloutVerdict, reason string) {
+	c := &d.conf.Canary
+	if d.rollout == nil {
+		return rolloutVerdictWait, ""
+	}
+
+	if d.rollout.unblocks > c.MaxUnblocks {
+		return rolloutVerdictRevert, fmt.Sprintf(
+			"%d allowlist rules added, max %d",
+			d.rollout.unblocks,
+			c.MaxUnblocks,
+		)
+	}
+
+	if d.canaryResps.total.Load() >= c.MinRequests {
+		canaryRatio, baseRatio := d.canaryResps.failureRatio(), d.baselineResps.failureRatio()
+		if canaryRatio-baseRatio > c.MaxFailureIncrease {
+			return rolloutVerdictRevert, fmt.Sprintf(
+				"failure ratio %.3f exceeds the baseline %.3f by more than %.3f",
+				canaryRatio,
+				baseRatio,
+				c.MaxFailureIncrease,
+			)
+		}
+	}
+
+	if now.Sub(d.rollout.start) >= c.Duration.Duration {
+		return rolloutVerdictPromote, "no breakage detected"
+	}
+
+	return rolloutVerdictWait, ""
+}
+
+// checkRollout promotes or reverts the staged rollout in progress, if any,
+// depending on the breakage signals and its duration.
+func (d *DNSFilter) checkRollout() {
+	var promoted []*FilterYAML
+	var v rolloutVerdict
+	var reason string
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		v, reason = d.judgeRollout(time.Now())
+		switch v {
+		case rolloutVerdictPromote:
+			promoted = d.promoteRolloutLocked()
+		case rolloutVerdictRevert:
+			d.revertRolloutLocked()
+		default:
+			// Go on.
+		}
+	}()
+
+	switch v {
+	case rolloutVerdictPromote:
+		log.Info("filtering: promoted staged update of %d filters: %s", len(promoted), reason)
+		d.publishRollout(events.TypeFilterRolloutPromoted, events.SeverityInfo, reason)
+		for _, f := range promoted {
+			d.publishFilterUpdated(f)
+		}
+
+		d.conf.ConfigModified()
+		d.EnableFilters(false)
+	case rolloutVerdictRevert:
+		log.Info("filtering: reverted staged update of filters: %s", reason)
+		d.publishRollout(events.TypeFilterRolloutReverted, events.SeverityWarning, reason)
+
+		d.EnableFilters(true)
+	default:
+		// Go on.
+	}
+}
+
+// findFilterLocked returns the filter list with id from either the blocklists
+// or the allowlists, or nil if there is none.  d.conf.filtersMu is expected to
+// be locked.
+func (d *DNSFilter) findFilterLocked(id rulelist.URLFilterID) (f *FilterYAML) {
+	for _, filters := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for i := range filters {
+			if filters[i].ID == id {
+				return &filters[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// promoteRolloutLocked replaces the contents of the filter lists with the
+// staged ones and finishes the rollout.  It returns the updated filter lists.
+// d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) promoteRolloutLocked() (promoted []*FilterYAML) {
+	for id, sf := range d.rollout.lists {
+		f := d.findFilterLocked(id)
+		if f == nil {
+			log.Debug("filtering: staged filter %d has been removed", id)
+
+			continue
+		}
+
+		err := os.Rename(sf.canaryPath(d.conf.DataDir), f.Path(d.conf.DataDir))
+		if err != nil {
+			log.Error("filtering: promoting filter %d: %s", id, err)
+
+			continue
+		}
+
+		f.Name = sf.Name
+		f.RulesCount = sf.RulesCount
+		f.checksum = sf.checksum
+		f.LastUpdated = sf.LastUpdated
+
+		promoted = append(promoted, f)
+	}
+
+	d.finishRolloutLocked()
+
+	return promoted
+}
+
+// revertRolloutLocked removes the staged contents of the filter lists, so
+// that they aren't staged again until changed upstream, and finishes the
+// rollout.  d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) revertRolloutLocked() {
+	for id, sf := range d.rollout.lists {
+		err := os.Remove(sf.canaryPath(d.conf.DataDir))
+		if err != nil {
+			log.Error("filtering: reverting filter %d: %s", id, err)
+		}
+
+		if f := d.findFilterLocked(id); f != nil {
+			f.rejected = sf.checksum
+		}
+	}
+
+	d.finishRolloutLocked()
+}
+
+// finishRolloutLocked removes the staged rollout.  d.conf.filtersMu is
+// expected to be locked.
+func (d *DNSFilter) finishRolloutLocked() {
+	d.rollout = nil
+	d.rolloutActive.Store(false)
+}
+
+// publishRollout publishes the event of type t about the staged rollout with
+// the reason, if the events are configured.
+func (d *DNSFilter) publishRollout(t events.Type, sev events.Severity, reason string) {
+	if d.conf.Events == nil {
+		return
+	}
+
+	d.conf.Events.Publish(context.Background(), &events.Event{
+		Data: map[string]string{
+			"canary_requests":   strconv.FormatUint(d.canaryResps.total.Load(), 10),
+			"canary_failures":   strconv.FormatUint(d.canaryResps.failed.Load(), 10),
+			"baseline_requests": strconv.FormatUint(d.baselineResps.total.Load(), 10),
+			"baseline_failures": strconv.FormatUint(d.baselineResps.failed.Load(), 10),
+		},
+		Type:     t,
+		Message:  fmt.Sprintf("staged filter update %s: %s", strings.TrimPrefix(string(t), "filter_rollout_"), reason),
+		Severity: sev,
+	})
+}
+
+// rolloutJSON is the response of the GET /control/filtering/rollout HTTP API.
+type rolloutJSON struct {
+	// StartedAt is the time when the rollout in progress has started in RFC
+	// 3339 format.  It's empty if there is no rollout in progress.
+	StartedAt string `json:"started_at,omitempty"`
+
+	// PromoteAt is the time when the rollout in progress is promoted unless
+	// reverted in RFC 3339 format.  It's empty if there is no rollout in
+	// progress.
+	PromoteAt string `json:"promote_at,omitempty"`
+
+	// FilterIDs are the IDs of the filter lists with the staged updates.
+	FilterIDs []rulelist.URLFilterID `json:"filter_ids"`
+
+	CanaryRequests   uint64 `json:"canary_requests"`
+	CanaryFailures   uint64 `json:"canary_failures"`
+	BaselineRequests uint64 `json:"baseline_requests"`
+	BaselineFailures uint64 `json:"baseline_failures"`
+	Unblocks         uint   `json:"unblocks"`
+
+	Enabled    bool `json:"enabled"`
+	InProgress bool `json:"in_progress"`
+}
+
+// handleRollout is the handler for the GET /control/filtering/rollout HTTP API.
+// It returns the state of the staged rollout of the filter list updates.
+func (d *DNSFilter) handleRollout(w http.ResponseWriter, r *http.Request) {
+	resp := &rolloutJSON{
+		FilterIDs: []rulelist.URLFilterID{},
+		Enabled:   d.conf.Canary.Enabled,
+	}
+
+	func() {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		ro := d.rollout
+		if ro == nil {
+			return
+		}
+
+		resp.InProgress = true
+		resp.StartedAt = ro.start.Format(time.RFC3339)
+		resp.PromoteAt = ro.start.Add(d.conf.Canary.Duration.Duration).Format(time.RFC3339)
+		resp.Unblocks = ro.unblocks
+		for id := range ro.lists {
+			resp.FilterIDs = append(resp.FilterIDs, id)
+		}
+
+		slices.Sort(resp.FilterIDs)
+
+		resp.CanaryRequests = d.canaryResps.total.Load()
+		resp.CanaryFailures = d.canaryResps.failed.Load()
+		resp.BaselineRequests = d.baselineResps.total.Load()
+		resp.BaselineFailures = d.baselineResps.failed.Load()
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
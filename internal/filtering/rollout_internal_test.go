@@ -0,0 +1,239 @@
+package filtering
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRolloutFilter returns a new *DNSFilter with the staged rollout enabled
+// for the canary client named "canary".
+func newTestRolloutFilter(t *testing.T) (d *DNSFilter) {
+	t.Helper()
+
+	d = &DNSFilter{
+		conf: &Config{
+			Canary: CanaryConfig{
+				Clients:            []string{"canary"},
+				Duration:           timeutil.Duration{Duration: time.Hour},
+				MaxFailureIncrease: 0.1,
+				MinRequests:        10,
+				MaxUnblocks:        1,
+				Enabled:            true,
+			},
+			DataDir: t.TempDir(),
+		},
+		canaryClients: container.NewMapSet("canary"),
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(d.conf.DataDir, filterDir), 0o700))
+
+	return d
+}
+
+func TestDNSFilter_judgeRollout(t *testing.T) {
+	canary := &Settings{ClientName: "canary"}
+	other := &Settings{ClientIP: netip.MustParseAddr("192.0.2.1")}
+
+	testCases := []struct {
+		prepare func(d *DNSFilter)
+		name    string
+		elapsed time.Duration
+		want    rolloutVerdict
+	}{{
+		prepare: func(_ *DNSFilter) {},
+		name:    "wait",
+		elapsed: time.Minute,
+		want:    rolloutVerdictWait,
+	}, {
+		prepare: func(_ *DNSFilter) {},
+		name:    "promote",
+		elapsed: time.Hour,
+		want:    rolloutVerdictPromote,
+	}, {
+		prepare: func(d *DNSFilter) {
+			d.countRolloutUnblocks([]string{"@@||old.example^"}, []string{
+				"@@||old.example^",
+				"@@||first.example^",
+				"||blocked.example^",
+				"@@||second.example^",
+			})
+		},
+		name:    "unblocks",
+		elapsed: time.Minute,
+		want:    rolloutVerdictRevert,
+	}, {
+		prepare: func(d *DNSFilter) {
+			for range 10 {
+				d.RecordResponse(canary, dns.RcodeNameError)
+				d.RecordResponse(other, dns.RcodeSuccess)
+			}
+		},
+		name:    "failures",
+		elapsed: time.Hour,
+		want:    rolloutVerdictRevert,
+	}, {
+		prepare: func(d *DNSFilter) {
+			for range 9 {
+				d.RecordResponse(canary, dns.RcodeServerFailure)
+			}
+		},
+		name:    "few_requests",
+		elapsed: time.Minute,
+		want:    rolloutVerdictWait,
+	}, {
+		prepare: func(d *DNSFilter) {
+			for range 10 {
+				d.RecordResponse(canary, dns.RcodeServerFailure)
+				d.RecordResponse(other, dns.RcodeServerFailure)
+			}
+		},
+		name:    "baseline_failures",
+		elapsed: time.Minute,
+		want:    rolloutVerdictWait,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newTestRolloutFilter(t)
+			d.stageUpdate(&FilterYAML{Filter: Filter{ID: 1}})
+
+			tc.prepare(d)
+
+			v, _ := d.judgeRollout(d.rollout.start.Add(tc.elapsed))
+			assert.Equal(t, tc.want, v)
+		})
+	}
+}
+
+func TestDNSFilter_rollout(t *testing.T) {
+	const (
+		stableRules = "||stable.example^\n"
+		stagedRules = "||staged.example^\n"
+
+		id rulelist.URLFilterID = 1
+	)
+
+	d := newTestRolloutFilter(t)
+	d.conf.Filters = []FilterYAML{{
+		Filter:   Filter{ID: id},
+		Enabled:  true,
+		checksum: 1,
+	}}
+
+	f := &d.conf.Filters[0]
+	stablePath, canaryPath := f.Path(d.conf.DataDir), f.canaryPath(d.conf.DataDir)
+	require.NoError(t, os.WriteFile(stablePath, []byte(stableRules), 0o600))
+
+	stage := func(t *testing.T) {
+		t.Helper()
+
+		require.NoError(t, os.WriteFile(canaryPath, []byte(stagedRules), 0o600))
+		d.stageUpdate(&FilterYAML{
+			Filter:     Filter{ID: id},
+			Name:       "Staged",
+			RulesCount: 1,
+			checksum:   2,
+		})
+	}
+
+	stage(t)
+
+	canary := d.canaryFiltersLocked([]Filter{{ID: id, FilePath: stablePath}}, nil)
+	require.NotNil(t, canary)
+	require.Len(t, canary.blockFilters, 1)
+
+	assert.Equal(t, canaryPath, canary.blockFilters[0].FilePath)
+
+	t.Run("revert", func(t *testing.T) {
+		d.revertRolloutLocked()
+
+		assert.Nil(t, d.rollout)
+		assert.False(t, d.rolloutActive.Load())
+		assert.Equal(t, uint32(2), f.rejected)
+		assert.NoFileExists(t, canaryPath)
+		assert.Nil(t, d.canaryFiltersLocked(nil, nil))
+	})
+
+	stage(t)
+
+	t.Run("promote", func(t *testing.T) {
+		promoted := d.promoteRolloutLocked()
+		require.Len(t, promoted, 1)
+
+		assert.Nil(t, d.rollout)
+		assert.Equal(t, "Staged", f.Name)
+		assert.Equal(t, uint32(2), f.checksum)
+		assert.NoFileExists(t, canaryPath)
+
+		data, err := os.ReadFile(stablePath)
+		require.NoError(t, err)
+
+		assert.Equal(t, stagedRules, string(data))
+	})
+}
+
+func TestDNSFilter_matchHost_canary(t *testing.T) {
+	d := newTestRolloutFilter(t)
+
+	err := d.initFiltering(nil, []Filter{{Data: []byte("||stable.example^\n")}})
+	require.NoError(t, err)
+
+	err = d.initCanaryFiltering(&canaryFilters{
+		blockFilters: []Filter{{Data: []byte("||staged.example^\n")}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		d.reset()
+		d.resetCanary()
+	})
+
+	testCases := []struct {
+		name        string
+		clientName  string
+		host        string
+		wantBlocked bool
+	}{{
+		name:        "canary_staged",
+		clientName:  "canary",
+		host:        "staged.example",
+		wantBlocked: true,
+	}, {
+		name:        "canary_stable",
+		clientName:  "canary",
+		host:        "stable.example",
+		wantBlocked: false,
+	}, {
+		name:        "other_staged",
+		clientName:  "other",
+		host:        "staged.example",
+		wantBlocked: false,
+	}, {
+		name:        "other_stable",
+		clientName:  "other",
+		host:        "stable.example",
+		wantBlocked: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, matchErr := d.matchHost(tc.host, dns.TypeA, &Settings{
+				ClientName:        tc.clientName,
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			})
+			require.NoError(t, matchErr)
+
+			assert.Equal(t, tc.wantBlocked, res.IsFiltered)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package filtering
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// ListFormat is the format of a filtering rule list.
+type ListFormat string
+
+// Filtering rule list formats.
+const (
+	// ListFormatAdblock is the default format of the adblock-style rule lists
+	// and hosts files.
+	ListFormatAdblock ListFormat = ""
+
+	// ListFormatRPZ is the format of the DNS Response Policy Zones.  The zones
+	// are converted into the adblock-style rules once downloaded.  See
+	// https://datatracker.ietf.org/doc/draft-vixie-dnsop-dns-rpz.
+	ListFormatRPZ ListFormat = "rpz"
+)
+
+// schemeAXFR is the URL scheme of the RPZ lists fetched using the DNS zone
+// transfer, for example "axfr://ns.example:53/rpz.example".
+const schemeAXFR = "axfr"
+
+// rpzTransferTimeout is the timeout of each of the stages of the DNS zone
+// transfer of an RPZ list.
+const rpzTransferTimeout = 30 * time.Second
+
+// isRPZ returns true if the contents of filter are fetched as an RPZ zone.
+func (filter *FilterYAML) isRPZ() (ok bool) {
+	return filter.Format == ListFormatRPZ || strings.HasPrefix(filter.URL, schemeAXFR+"://")
+}
+
+// validateListFormat returns an error if f is not a known list format.
+func validateListFormat(f ListFormat) (err error) {
+	switch f {
+	case ListFormatAdblock, ListFormatRPZ:
+		return nil
+	default:
+		return fmt.Errorf("format: %w: %q", errors.ErrBadEnumValue, f)
+	}
+}
+
+// parseAXFRURL parses urlStr as the URL of an RPZ list fetched using the DNS
+// zone transfer.  addr is the address of the primary server and zone is the
+// FQDN of the zone.
+func parseAXFRURL(urlStr string) (addr, zone string, err error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", "", err
+	}
+
+	zone = strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != schemeAXFR || u.Hostname() == "" || zone == "" {
+		return "", "", fmt.Errorf("bad axfr url %q, want axfr://host[:port]/zone", urlStr)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "53"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), dns.Fqdn(zone), nil
+}
+
+// rpzReader returns an io.ReadCloser reading the adblock-style rules converted
+// from the RPZ zone at fltURL, which is either an AXFR URL or a URL or file
+// path of the zone file.
+func (d *DNSFilter) rpzReader(fltURL string) (r io.ReadCloser, err error) {
+	var origin string
+	var rrs []dns.RR
+	if strings.HasPrefix(fltURL, schemeAXFR+"://") {
+		origin, rrs, err = transferRPZ(fltURL)
+	} else {
+		origin, rrs, err = d.readRPZ(fltURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching rpz: %w", err)
+	}
+
+	rules, skipped := rpzRules(origin, rrs)
+	if skipped > 0 {
+		log.Debug("filtering: rpz %q: skipped %d unsupported records", origin, skipped)
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "! Title: %s\n", strings.TrimSuffix(origin, "."))
+	for _, rule := range rules {
+		_, _ = buf.WriteString(rule + "\n")
+	}
+
+	return io.NopCloser(buf), nil
+}
+
+// transferRPZ fetches the records of the RPZ zone from the AXFR URL fltURL.
+func transferRPZ(fltURL string) (origin string, rrs []dns.RR, err error) {
+	addr, origin, err := parseAXFRURL(fltURL)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", nil, err
+	}
+
+	tr := &dns.Transfer{
+		DialTimeout:  rpzTransferTimeout,
+		ReadTimeout:  rpzTransferTimeout,
+		WriteTimeout: rpzTransferTimeout,
+	}
+
+	envs, err := tr.In((&dns.Msg{}).SetAxfr(origin), addr)
+	if err != nil {
+		return "", nil, fmt.Errorf("transferring zone %q from %s: %w", origin, addr, err)
+	}
+
+	for env := range envs {
+		if env.Error != nil {
+			return "", nil, fmt.Errorf("transferring zone %q from %s: %w", origin, addr, env.Error)
+		}
+
+		rrs = append(rrs, env.RR...)
+	}
+
+	return origin, rrs, nil
+}
+
+// readRPZ parses the RPZ zone file from the URL or file path fltURL.  The
+// origin of the zone is the owner name of its SOA record.
+func (d *DNSFilter) readRPZ(fltURL string) (origin string, rrs []dns.RR, err error) {
+	r, err := d.reader(fltURL)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, r.Close()) }()
+
+	zp := dns.NewZoneParser(r, "", fltURL)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if soa, isSOA := rr.(*dns.SOA); isSOA && origin == "" {
+			origin = strings.ToLower(soa.Hdr.Name)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	if err = zp.Err(); err != nil {
+		return "", nil, fmt.Errorf("parsing zone: %w", err)
+	} else if origin == "" {
+		return "", nil, errors.Error("parsing zone: no soa record")
+	}
+
+	return origin, rrs, nil
+}
+
+// RPZ policy actions expressed as the CNAME targets.
+const (
+	rpzActionNXDOMAIN = "."
+	rpzActionNODATA   = "*."
+	rpzActionPassthru = "rpz-passthru."
+	rpzActionDrop     = "rpz-drop."
+)
+
+// rpzRules converts the records rrs of the RPZ zone with the origin into the
+// adblock-style rules.  Only the QNAME triggers with the NXDOMAIN, NODATA,
+// PASSTHRU, DROP, CNAME, A, and AAAA actions are supported; skipped is the
+// number of the other records, except for the ones of the origin itself.
+// DROP is approximated by responding with REFUSED.
+func rpzRules(origin string, rrs []dns.RR) (rules []string, skipped int) {
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if name == origin {
+			// Skip SOA, NS, and other zone records.
+			continue
+		}
+
+		rule, ok := rpzRule(origin, name, rr)
+		if !ok {
+			skipped++
+
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, skipped
+}
+
+// rpzRule returns the adblock-style rule for the RPZ record rr with the owner
+// name within the origin.  ok is false if rr isn't supported.
+func rpzRule(origin, name string, rr dns.RR) (rule string, ok bool) {
+	trigger, ok := strings.CutSuffix(name, "."+origin)
+	if !ok || isRPZSpecialTrigger(trigger) {
+		return "", false
+	}
+
+	pattern := "|" + trigger + "^"
+	switch rr := rr.(type) {
+	case *dns.CNAME:
+		return rpzCNAMERule(pattern, strings.ToLower(rr.Target))
+	case *dns.A:
+		return fmt.Sprintf("%s$dnsrewrite=NOERROR;A;%s", pattern, rr.A), true
+	case *dns.AAAA:
+		return fmt.Sprintf("%s$dnsrewrite=NOERROR;AAAA;%s", pattern, rr.AAAA), true
+	default:
+		return "", false
+	}
+}
+
+// rpzCNAMERule returns the rule for the RPZ CNAME record with target applied
+// to the requests matching pattern.
+func rpzCNAMERule(pattern, target string) (rule string, ok bool) {
+	switch target {
+	case rpzActionNXDOMAIN:
+		return pattern + "$dnsrewrite=NXDOMAIN", true
+	case rpzActionNODATA:
+		return pattern + "$dnsrewrite=NOERROR", true
+	case rpzActionPassthru:
+		return "@@" + pattern + "$important", true
+	case rpzActionDrop:
+		return pattern + "$dnsrewrite=REFUSED", true
+	}
+
+	if strings.HasPrefix(target, "*.") || strings.HasPrefix(target, "rpz-") {
+		// The local data relative to the query name and the other special
+		// actions aren't supported.
+		return "", false
+	}
+
+	return pattern + "$dnsrewrite=NOERROR;CNAME;" + strings.TrimSuffix(target, "."), true
+}
+
+// isRPZSpecialTrigger returns true if trigger is any of the triggers other
+// than QNAME, such as the response IP address or the NSDNAME ones.
+func isRPZSpecialTrigger(trigger string) (ok bool) {
+	for _, label := range strings.Split(trigger, ".") {
+		if strings.HasPrefix(label, "rpz-") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,205 @@
+package filtering
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRPZZone is the RPZ zone file for tests.
+const testRPZZone = `$ORIGIN rpz.example.
+$TTL 300
+@                   SOA   ns.rpz.example. admin.rpz.example. 1 3600 600 86400 300
+@                   NS    ns.rpz.example.
+nxdomain.example    CNAME .
+*.nodata.example    CNAME *.
+passthru.example    CNAME rpz-passthru.
+drop.example        CNAME rpz-drop.
+garden.example      CNAME walled.garden.example.
+local.example       A     192.0.2.1
+local.example       AAAA  2001:db8::1
+relative.example    CNAME *.garden.example.
+32.1.2.0.192.rpz-ip CNAME .
+txt.example         TXT   "unsupported"
+`
+
+// testRPZRules are the rules converted from [testRPZZone].
+var testRPZRules = []string{
+	"|nxdomain.example^$dnsrewrite=NXDOMAIN",
+	"|*.nodata.example^$dnsrewrite=NOERROR",
+	"@@|passthru.example^$important",
+	"|drop.example^$dnsrewrite=REFUSED",
+	"|garden.example^$dnsrewrite=NOERROR;CNAME;walled.garden.example",
+	"|local.example^$dnsrewrite=NOERROR;A;192.0.2.1",
+	"|local.example^$dnsrewrite=NOERROR;AAAA;2001:db8::1",
+}
+
+// newTestRPZRecords returns the records of [testRPZZone].
+func newTestRPZRecords(t *testing.T) (rrs []dns.RR) {
+	t.Helper()
+
+	zp := dns.NewZoneParser(strings.NewReader(testRPZZone), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	require.NoError(t, zp.Err())
+
+	return rrs
+}
+
+func TestRPZRules(t *testing.T) {
+	rules, skipped := rpzRules("rpz.example.", newTestRPZRecords(t))
+	assert.Equal(t, testRPZRules, rules)
+	assert.Equal(t, 3, skipped)
+}
+
+func TestParseAXFRURL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		wantAddr   string
+		wantZone   string
+		wantErrMsg string
+	}{{
+		name:       "default_port",
+		in:         "axfr://ns.example/rpz.example",
+		wantAddr:   "ns.example:53",
+		wantZone:   "rpz.example.",
+		wantErrMsg: "",
+	}, {
+		name:       "port",
+		in:         "axfr://192.0.2.1:5353/rpz.example.",
+		wantAddr:   "192.0.2.1:5353",
+		wantZone:   "rpz.example.",
+		wantErrMsg: "",
+	}, {
+		name:     "no_zone",
+		in:       "axfr://ns.example",
+		wantAddr: "",
+		wantZone: "",
+		wantErrMsg: `bad axfr url "axfr://ns.example", ` +
+			`want axfr://host[:port]/zone`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, zone, err := parseAXFRURL(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantAddr, addr)
+			assert.Equal(t, tc.wantZone, zone)
+		})
+	}
+}
+
+// checkTestRPZ is a helper that checks that the rules of [testRPZZone] from
+// flt are applied by d.
+func checkTestRPZ(t *testing.T, d *DNSFilter, flt *FilterYAML) {
+	t.Helper()
+
+	assert.Equal(t, "rpz.example", flt.Name)
+	assert.Equal(t, len(testRPZRules), flt.RulesCount)
+
+	err := d.initFiltering(nil, []Filter{{
+		ID:       flt.ID,
+		FilePath: flt.Path(d.conf.DataDir),
+	}})
+	require.NoError(t, err)
+
+	setts := &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	res, err := d.CheckHost("nxdomain.example", dns.TypeA, setts)
+	require.NoError(t, err)
+	require.NotNil(t, res.DNSRewriteResult)
+
+	assert.Equal(t, dns.RcodeNameError, res.DNSRewriteResult.RCode)
+
+	res, err = d.CheckHost("garden.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, "walled.garden.example", res.CanonName)
+}
+
+func TestDNSFilter_Update_rpzHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(testRPZZone))
+	}))
+	t.Cleanup(srv.Close)
+
+	d, err := New(&Config{
+		HTTPClient: srv.Client(),
+		DataDir:    t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	flt := &FilterYAML{
+		URL:     srv.URL,
+		Format:  ListFormatRPZ,
+		Enabled: true,
+		Filter:  Filter{ID: 1},
+	}
+
+	ok, err := d.update(flt)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	checkTestRPZ(t, d, flt)
+}
+
+func TestDNSFilter_Update_rpzAXFR(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	rrs := newTestRPZRecords(t)
+	srv := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			ch := make(chan *dns.Envelope, 1)
+			ch <- &dns.Envelope{RR: slices.Concat(rrs, rrs[:1])}
+			close(ch)
+
+			_ = (&dns.Transfer{}).Out(w, req, ch)
+			_ = w.Close()
+		}),
+	}
+
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	d, err := New(&Config{
+		DataDir: t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	flt := &FilterYAML{
+		URL:     "axfr://" + l.Addr().String() + "/rpz.example",
+		Enabled: true,
+		Filter:  Filter{ID: 2},
+	}
+
+	require.True(t, flt.isRPZ())
+
+	var ok bool
+	require.Eventually(t, func() (updated bool) {
+		ok, err = d.update(flt)
+
+		return err == nil
+	}, testTimeout, 10*time.Millisecond)
+	require.True(t, ok)
+
+	checkTestRPZ(t, d, flt)
+}
@@ -0,0 +1,268 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// UserRuleMeta is the metadata of a user rule, including comments and group
+// markers.
+type UserRuleMeta struct {
+	// AddedAt is the time when the rule was added.
+	AddedAt time.Time `yaml:"added_at"`
+
+	// Rule is the text of the rule the metadata belongs to.  The same rules
+	// share the metadata.
+	Rule string `yaml:"rule"`
+
+	// AddedBy is the name of the web user who added the rule.  It's empty if
+	// the rule was added without authentication.
+	AddedBy string `yaml:"added_by,omitempty"`
+
+	// Reason is the reason for adding the rule provided by the user.
+	Reason string `yaml:"reason,omitempty"`
+
+	// ExpiresAt is the time when the rule is automatically removed.  If it's
+	// zero, the rule is permanent.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+}
+
+// isExpired returns true if the rule must be removed at now.
+func (m *UserRuleMeta) isExpired(now time.Time) (ok bool) {
+	return !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now)
+}
+
+// isUserRuleComment returns true if rule is a comment or a group marker, for
+// example "! Group: ads" or "# Allowlisted for the printer".
+func isUserRuleComment(rule string) (ok bool) {
+	return strings.HasPrefix(rule, "!") || strings.HasPrefix(rule, "#")
+}
+
+// mergeUserRulesMeta returns the metadata for rules, keeping the one from prev
+// for the rules present there and copying newMeta, with its Rule field set, for
+// the rules missing from prevRules.  The rules from prevRules without metadata,
+// as well as the blank lines, have none.  newMeta must not be nil.
+func mergeUserRulesMeta(
+	prev []*UserRuleMeta,
+	prevRules []string,
+	rules []string,
+	newMeta *UserRuleMeta,
+) (meta []*UserRuleMeta) {
+	prevByRule := make(map[string]*UserRuleMeta, len(prev))
+	for _, m := range prev {
+		prevByRule[m.Rule] = m
+	}
+
+	added := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		if _, ok := added[rule]; ok {
+			continue
+		}
+
+		added[rule] = struct{}{}
+
+		m, ok := prevByRule[rule]
+		if !ok {
+			if slices.Contains(prevRules, rule) {
+				continue
+			}
+
+			c := *newMeta
+			c.Rule = rule
+			m = &c
+		}
+
+		meta = append(meta, m)
+	}
+
+	return meta
+}
+
+// cloneUserRulesMeta returns a deep clone of meta.
+func cloneUserRulesMeta(meta []*UserRuleMeta) (clone []*UserRuleMeta) {
+	if meta == nil {
+		return nil
+	}
+
+	clone = make([]*UserRuleMeta, 0, len(meta))
+	for _, m := range meta {
+		c := *m
+		clone = append(clone, &c)
+	}
+
+	return clone
+}
+
+// userRuleJSON is the JSON representation of a user rule with its metadata.
+type userRuleJSON struct {
+	// AddedAt is the time when the rule was added in RFC 3339 format.  It's
+	// empty if the metadata of the rule is unknown.
+	AddedAt string `json:"added_at,omitempty"`
+
+	// ExpiresAt is the time when the rule is removed in RFC 3339 format.  It's
+	// empty if the rule is permanent.
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	Text    string `json:"text"`
+	AddedBy string `json:"added_by,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+
+	// Comment is true if the rule is a comment or a group marker.
+	Comment bool `json:"comment"`
+}
+
+// userRulesResp is the response of the GET /control/filtering/user_rules HTTP
+// API.
+type userRulesResp struct {
+	Rules []*userRuleJSON `json:"rules"`
+}
+
+// handleUserRules is the handler for the GET /control/filtering/user_rules HTTP
+// API.  It returns the user rules along with their metadata.  The optional
+// query parameters "added_by" and "search" filter the rules by the exact name
+// of the user who added them and by the substring of the rule text or reason,
+// respectively.
+func (d *DNSFilter) handleUserRules(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	addedBy := q.Get("added_by")
+	search := strings.ToLower(q.Get("search"))
+
+	resp := &userRulesResp{
+		Rules: []*userRuleJSON{},
+	}
+
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	metaByRule := make(map[string]*UserRuleMeta, len(d.conf.UserRulesMeta))
+	for _, m := range d.conf.UserRulesMeta {
+		metaByRule[m.Rule] = m
+	}
+
+	for _, rule := range d.conf.UserRules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		rj := &userRuleJSON{
+			Text:    rule,
+			Comment: isUserRuleComment(rule),
+		}
+
+		if m, ok := metaByRule[rule]; ok {
+			rj.AddedAt = m.AddedAt.Format(time.RFC3339)
+			rj.AddedBy = m.AddedBy
+			rj.Reason = m.Reason
+			if !m.ExpiresAt.IsZero() {
+				rj.ExpiresAt = m.ExpiresAt.Format(time.RFC3339)
+			}
+		}
+
+		if matchesUserRuleQuery(rj, addedBy, search) {
+			resp.Rules = append(resp.Rules, rj)
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// matchesUserRuleQuery returns true if rj matches the non-empty query
+// parameters.  search must be lowercased.
+func matchesUserRuleQuery(rj *userRuleJSON, addedBy, search string) (ok bool) {
+	if addedBy != "" && rj.AddedBy != addedBy {
+		return false
+	}
+
+	if search == "" {
+		return true
+	}
+
+	return slices.ContainsFunc([]string{rj.Text, rj.Reason}, func(s string) (found bool) {
+		return strings.Contains(strings.ToLower(s), search)
+	})
+}
+
+// userRulesExpiryIvl is the interval of checking the user rules for expiry.
+const userRulesExpiryIvl = 1 * time.Minute
+
+// removeExpiredUserRules removes the user rules which have expired at now along
+// with their metadata, and returns the removed ones.  d.conf.filtersMu is
+// expected to be locked.
+func (d *DNSFilter) removeExpiredUserRules(now time.Time) (expired []*UserRuleMeta) {
+	d.conf.UserRulesMeta = slices.DeleteFunc(d.conf.UserRulesMeta, func(m *UserRuleMeta) (ok bool) {
+		if !m.isExpired(now) {
+			return false
+		}
+
+		expired = append(expired, m)
+
+		return true
+	})
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	d.conf.UserRules = slices.DeleteFunc(d.conf.UserRules, func(rule string) (ok bool) {
+		return slices.ContainsFunc(expired, func(m *UserRuleMeta) (found bool) {
+			return m.Rule == rule
+		})
+	})
+
+	return expired
+}
+
+// expireUserRules removes the expired user rules, if any, applies the change,
+// and publishes the events about it.
+func (d *DNSFilter) expireUserRules() {
+	var expired []*UserRuleMeta
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		expired = d.removeExpiredUserRules(time.Now())
+	}()
+
+	if len(expired) == 0 {
+		return
+	}
+
+	for _, m := range expired {
+		log.Info("filtering: user rule %q expired at %s", m.Rule, m.ExpiresAt.Format(time.RFC3339))
+		d.publishUserRuleExpired(m)
+	}
+
+	d.conf.ConfigModified()
+	d.EnableFilters(true)
+}
+
+// publishUserRuleExpired publishes the event about the removal of the expired
+// user rule with metadata m, if the events are configured.
+func (d *DNSFilter) publishUserRuleExpired(m *UserRuleMeta) {
+	if d.conf.Events == nil {
+		return
+	}
+
+	d.conf.Events.Publish(context.Background(), &events.Event{
+		Data: map[string]string{
+			"rule":       m.Rule,
+			"added_by":   m.AddedBy,
+			"expires_at": m.ExpiresAt.Format(time.RFC3339),
+		},
+		Type:     events.TypeUserRuleExpired,
+		Message:  fmt.Sprintf("user rule %q expired", m.Rule),
+		Severity: events.SeverityInfo,
+	})
+}
@@ -0,0 +1,186 @@
+package filtering
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeUserRulesMeta(t *testing.T) {
+	var (
+		past = time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+		now  = past.Add(time.Hour)
+	)
+
+	prev := []*UserRuleMeta{{
+		AddedAt: past,
+		Rule:    "||kept.example^",
+		AddedBy: "alice",
+		Reason:  "ads",
+	}, {
+		AddedAt: past,
+		Rule:    "||removed.example^",
+		AddedBy: "alice",
+	}}
+
+	prevRules := []string{
+		"||kept.example^",
+		"||removed.example^",
+		"||imported.example^",
+	}
+
+	got := mergeUserRulesMeta(prev, prevRules, []string{
+		"! Group: work",
+		"||kept.example^",
+		"",
+		"@@||new.example^",
+		"||imported.example^",
+		"||kept.example^",
+	}, &UserRuleMeta{
+		AddedAt: now,
+		AddedBy: "bob",
+		Reason:  "false positive",
+	})
+
+	assert.Equal(t, []*UserRuleMeta{{
+		AddedAt: now,
+		Rule:    "! Group: work",
+		AddedBy: "bob",
+		Reason:  "false positive",
+	}, prev[0], {
+		AddedAt: now,
+		Rule:    "@@||new.example^",
+		AddedBy: "bob",
+		Reason:  "false positive",
+	}}, got)
+}
+
+func TestDNSFilter_handleUserRules(t *testing.T) {
+	d, err := New(&Config{
+		UserRules:      []string{"||imported.example^"},
+		ConfigModified: func() {},
+		UserName:       func(_ *http.Request) (name string) { return "admin" },
+		DataDir:        t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	d.Start()
+
+	rules := []string{
+		"||imported.example^",
+		"! Group: printers",
+		"@@||printer.example^",
+	}
+
+	data, err := json.Marshal(&filteringRulesReq{
+		Rules:  rules,
+		Reason: "Printer updates",
+	})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/control/filtering/set_rules", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	d.handleFilteringSetRules(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	testCases := []struct {
+		name      string
+		query     string
+		wantTexts []string
+	}{{
+		name:      "all",
+		query:     "",
+		wantTexts: rules,
+	}, {
+		name:      "added_by",
+		query:     "?added_by=admin",
+		wantTexts: rules[1:],
+	}, {
+		name:      "search_reason",
+		query:     "?search=printer+UPDATES",
+		wantTexts: rules[1:],
+	}, {
+		name:      "search_text",
+		query:     "?search=imported",
+		wantTexts: rules[:1],
+	}, {
+		name:      "none",
+		query:     "?added_by=guest",
+		wantTexts: []string{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r = httptest.NewRequest(http.MethodGet, "/control/filtering/user_rules"+tc.query, nil)
+			w = httptest.NewRecorder()
+			d.handleUserRules(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			resp := &userRulesResp{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+
+			texts := []string{}
+			for _, rj := range resp.Rules {
+				texts = append(texts, rj.Text)
+				if rj.Text == rules[0] {
+					assert.Empty(t, rj.AddedAt)
+				} else {
+					assert.Equal(t, "admin", rj.AddedBy)
+					assert.Equal(t, "Printer updates", rj.Reason)
+					assert.Equal(t, rj.Text == rules[1], rj.Comment)
+				}
+			}
+
+			assert.Equal(t, tc.wantTexts, texts)
+		})
+	}
+}
+
+func TestDNSFilter_removeExpiredUserRules(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	expiredMeta := &UserRuleMeta{
+		AddedAt:   now.Add(-time.Hour),
+		Rule:      "@@||temporary.example^",
+		ExpiresAt: now,
+	}
+	permanentMeta := &UserRuleMeta{
+		AddedAt: now.Add(-time.Hour),
+		Rule:    "||permanent.example^",
+	}
+	futureMeta := &UserRuleMeta{
+		AddedAt:   now.Add(-time.Hour),
+		Rule:      "@@||future.example^",
+		ExpiresAt: now.Add(time.Second),
+	}
+
+	d := &DNSFilter{
+		conf: &Config{
+			UserRules: []string{
+				"||imported.example^",
+				expiredMeta.Rule,
+				permanentMeta.Rule,
+				futureMeta.Rule,
+			},
+			UserRulesMeta: []*UserRuleMeta{expiredMeta, permanentMeta, futureMeta},
+		},
+	}
+
+	expired := d.removeExpiredUserRules(now)
+	assert.Equal(t, []*UserRuleMeta{expiredMeta}, expired)
+	assert.Equal(t, []string{
+		"||imported.example^",
+		permanentMeta.Rule,
+		futureMeta.Rule,
+	}, d.conf.UserRules)
+	assert.Equal(t, []*UserRuleMeta{permanentMeta, futureMeta}, d.conf.UserRulesMeta)
+
+	assert.Empty(t, d.removeExpiredUserRules(now))
+}
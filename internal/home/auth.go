@@ -4,8 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
-	"fmt"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -14,7 +14,6 @@ import (
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"go.etcd.io/bbolt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // sessionTokenSize is the length of session token in bytes.
@@ -22,6 +21,15 @@ const sessionTokenSize = 16
 
 type session struct {
 	userName string
+
+	// userAgent is the fingerprint of the User-Agent header of the browser the
+	// session has been created by.  See [userAgentFingerprint].
+	userAgent string
+
+	// subnet is the network the session has been created from.  It's invalid
+	// if the session isn't bound to a network.
+	subnet netip.Prefix
+
 	// expire is the expiration time, in seconds.
 	expire uint32
 }
@@ -35,6 +43,20 @@ func (s *session) serialize() []byte {
 	binary.BigEndian.PutUint32(data[0:4], s.expire)
 	binary.BigEndian.PutUint16(data[4:6], uint16(len(s.userName)))
 	copy(data[6:], []byte(s.userName))
+
+	if !s.subnet.IsValid() {
+		return data
+	}
+
+	// The binding is appended to the end, so that the sessions stored by the
+	// previous versions are still readable.
+	addr := s.subnet.Addr().AsSlice()
+	data = append(data, byte(len(addr)))
+	data = append(data, addr...)
+	data = append(data, byte(s.subnet.Bits()))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(s.userAgent)))
+	data = append(data, s.userAgent...)
+
 	return data
 }
 
@@ -49,7 +71,44 @@ func (s *session) deserialize(data []byte) bool {
 	if len(data) < int(nameLen) {
 		return false
 	}
-	s.userName = string(data)
+	s.userName = string(data[:nameLen])
+	data = data[nameLen:]
+
+	if len(data) == 0 {
+		return true
+	}
+
+	return s.deserializeBinding(data)
+}
+
+// deserializeBinding decodes the binding of the session to the network and
+// the browser.
+func (s *session) deserializeBinding(data []byte) (ok bool) {
+	addrLen := int(data[0])
+	data = data[1:]
+	if len(data) < addrLen+1+2 {
+		return false
+	}
+
+	addr, ok := netip.AddrFromSlice(data[:addrLen])
+	if !ok {
+		return false
+	}
+
+	s.subnet = netip.PrefixFrom(addr, int(data[addrLen]))
+	if !s.subnet.IsValid() {
+		return false
+	}
+
+	data = data[addrLen+1:]
+	uaLen := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < uaLen {
+		return false
+	}
+
+	s.userAgent = string(data[:uaLen])
+
 	return true
 }
 
@@ -58,10 +117,34 @@ type Auth struct {
 	trustedProxies netutil.SubnetSet
 	db             *bbolt.DB
 	rateLimiter    *authRateLimiter
-	sessions       map[string]*session
-	users          []webUser
-	lock           sync.Mutex
-	sessionTTL     uint32
+
+	// passwords hashes and checks the passwords of the users.
+	passwords *passwordHashing
+
+	// onUsersChanged, if not nil, is called after the users have been changed
+	// without a request, for example when a password has been rehashed.
+	onUsersChanged func()
+
+	// binding binds the sessions to the networks and browsers they have been
+	// created from.  It's nil if the binding is disabled.
+	binding *sessionBinding
+
+	// webAuthn is the WebAuthn login.  It's nil if the WebAuthn login is
+	// disabled.
+	webAuthn *webAuthnAuth
+
+	// totpPending are the TOTP secrets not yet confirmed by the users by the
+	// names of the users.
+	totpPending map[string]string
+
+	// totpLastCounters are the time steps of the last accepted TOTP codes by
+	// the names of the users.  They prevent the codes from being reused.
+	totpLastCounters map[string]uint64
+
+	sessions   map[string]*session
+	users      []webUser
+	lock       sync.Mutex
+	sessionTTL uint32
 }
 
 // webUser represents a user of the Web UI.
@@ -70,24 +153,43 @@ type Auth struct {
 type webUser struct {
 	Name         string `yaml:"name"`
 	PasswordHash string `yaml:"password"`
+
+	// Role defines the HTTP APIs the user may use to change data.  If empty,
+	// the user is an administrator.
+	Role userRole `yaml:"role,omitempty"`
+
+	// TOTPSecret is the base32-encoded secret of the TOTP codes of the user.
+	// If empty, two-factor authentication is disabled.
+	TOTPSecret string `yaml:"totp_secret,omitempty"`
+
+	// RecoveryCodes are the hashes of the unused recovery codes, which may be
+	// used instead of the TOTP codes.
+	RecoveryCodes []string `yaml:"recovery_codes,omitempty"`
 }
 
-// InitAuth initializes the global authentication object.
+// InitAuth initializes the global authentication object.  passwords must not
+// be nil.
 func InitAuth(
 	dbFilename string,
 	users []webUser,
 	sessionTTL uint32,
 	rateLimiter *authRateLimiter,
 	trustedProxies netutil.SubnetSet,
+	passwords *passwordHashing,
+	onUsersChanged func(),
 ) (a *Auth) {
 	log.Info("Initializing auth module: %s", dbFilename)
 
 	a = &Auth{
-		sessionTTL:     sessionTTL,
-		rateLimiter:    rateLimiter,
-		sessions:       make(map[string]*session),
-		users:          users,
-		trustedProxies: trustedProxies,
+		sessionTTL:       sessionTTL,
+		rateLimiter:      rateLimiter,
+		passwords:        passwords,
+		onUsersChanged:   onUsersChanged,
+		totpPending:      make(map[string]string),
+		totpLastCounters: make(map[string]uint64),
+		sessions:         make(map[string]*session),
+		users:            users,
+		trustedProxies:   trustedProxies,
 	}
 	var err error
 	a.db, err = bbolt.Open(dbFilename, aghos.DefaultPermFile, nil)
@@ -260,10 +362,15 @@ const (
 	checkSessionOK       checkSessionResult = 0
 	checkSessionNotFound checkSessionResult = -1
 	checkSessionExpired  checkSessionResult = 1
+
+	// checkSessionReused means that the session has been used from another
+	// network or browser and has been invalidated.
+	checkSessionReused checkSessionResult = 2
 )
 
-// checkSession checks if the session is valid.
-func (a *Auth) checkSession(sess string) (res checkSessionResult) {
+// checkSession checks if the session is valid.  client is the client using
+// the session, if known.
+func (a *Auth) checkSession(sess string, client *sessionClient) (res checkSessionResult) {
 	now := uint32(time.Now().UTC().Unix())
 	update := false
 
@@ -283,6 +390,18 @@ func (a *Auth) checkSession(sess string) (res checkSessionResult) {
 		return checkSessionExpired
 	}
 
+	if a.binding != nil && client != nil {
+		var invalidate bool
+		invalidate, update = a.binding.check(s, client)
+		if invalidate {
+			delete(a.sessions, sess)
+			key, _ := hex.DecodeString(sess)
+			a.removeSessionFromFile(key)
+
+			return checkSessionReused
+		}
+	}
+
 	newExpire := now + a.sessionTTL
 	if s.expire/(24*60*60) != newExpire/(24*60*60) {
 		// update expiration time once a day
@@ -315,13 +434,12 @@ func (a *Auth) addUser(u *webUser, password string) (err error) {
 		return errors.Error("empty password")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	u.PasswordHash, err = a.passwords.hash(password)
 	if err != nil {
-		return fmt.Errorf("generating hash: %w", err)
+		// Don't wrap the error since it's informative enough as is.
+		return err
 	}
 
-	u.PasswordHash = string(hash)
-
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
@@ -332,19 +450,57 @@ func (a *Auth) addUser(u *webUser, password string) (err error) {
 	return nil
 }
 
-// findUser returns a user if there is one.
+// findUser returns a user if there is one and if the user may log in with a
+// password.  The outdated hash of the password of the user is replaced with the
+// one produced by the current key derivation function.
 func (a *Auth) findUser(login, password string) (u webUser, ok bool) {
+	if !a.passwordAllowed(login) {
+		log.Info("auth: password login of user %q is disabled by password fallback policy", login)
+
+		return webUser{}, false
+	}
+
+	u, ok, rehashed := a.checkPassword(login, password)
+	if rehashed && a.onUsersChanged != nil {
+		a.onUsersChanged()
+	}
+
+	return u, ok
+}
+
+// checkPassword returns a user if there is one and rehashes its password if
+// the hash is outdated.
+func (a *Auth) checkPassword(login, password string) (u webUser, ok, rehashed bool) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	for _, u = range a.users {
-		if u.Name == login &&
-			bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil {
-			return u, true
+	for i, u := range a.users {
+		if u.Name != login || !verifyPassword(u.PasswordHash, password) {
+			continue
+		}
+
+		if a.passwords.kdf.isCurrent(u.PasswordHash) {
+			return u, true, false
+		}
+
+		// Don't check the password against the breached ones, since the user
+		// is already using it.
+		hash, err := a.passwords.kdf.hash(password)
+		if err != nil {
+			log.Error("auth: rehashing password of user %q: %s", u.Name, err)
+
+			return u, true, false
 		}
+
+		u.PasswordHash = hash
+		a.users[i] = u
+
+		log.Info("auth: upgraded password hash of user %q", u.Name)
+
+		return u, true, true
 	}
 
-	return webUser{}, false
+	return webUser{}, false, false
 }
 
 // getCurrentUser returns the current user.  It returns an empty User if the
@@ -380,6 +536,16 @@ func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
 	return webUser{}
 }
 
+// webUserName returns the name of the authenticated web user sending r or an
+// empty string if there is none.
+func webUserName(r *http.Request) (name string) {
+	if Context.auth == nil {
+		return ""
+	}
+
+	return Context.auth.getCurrentUser(r).Name
+}
+
 // usersList returns a copy of a users list.
 func (a *Auth) usersList() (users []webUser) {
 	a.lock.Lock()
@@ -37,14 +37,14 @@ func TestAuth(t *testing.T) {
 		Name:         "name",
 		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
 	}}
-	a := InitAuth(fn, nil, 60, nil, nil)
+	a := InitAuth(fn, nil, 60, nil, nil, newTestPasswordHashing(t), nil)
 	s := session{}
 
 	user := webUser{Name: "name"}
 	err := a.addUser(&user, "password")
 	require.NoError(t, err)
 
-	assert.Equal(t, checkSessionNotFound, a.checkSession("notfound"))
+	assert.Equal(t, checkSessionNotFound, a.checkSession("notfound", nil))
 	a.removeSession("notfound")
 
 	sess, err := newSessionToken()
@@ -55,21 +55,21 @@ func TestAuth(t *testing.T) {
 	// check expiration
 	s.expire = uint32(now)
 	a.addSession(sess, &s)
-	assert.Equal(t, checkSessionExpired, a.checkSession(sessStr))
+	assert.Equal(t, checkSessionExpired, a.checkSession(sessStr, nil))
 
 	// add session with TTL = 2 sec
 	s = session{}
 	s.expire = uint32(time.Now().UTC().Unix() + 2)
 	a.addSession(sess, &s)
-	assert.Equal(t, checkSessionOK, a.checkSession(sessStr))
+	assert.Equal(t, checkSessionOK, a.checkSession(sessStr, nil))
 
 	a.Close()
 
 	// load saved session
-	a = InitAuth(fn, users, 60, nil, nil)
+	a = InitAuth(fn, users, 60, nil, nil, newTestPasswordHashing(t), nil)
 
 	// the session is still alive
-	assert.Equal(t, checkSessionOK, a.checkSession(sessStr))
+	assert.Equal(t, checkSessionOK, a.checkSession(sessStr, nil))
 	// reset our expiration time because checkSession() has just updated it
 	s.expire = uint32(time.Now().UTC().Unix() + 2)
 	a.storeSession(sess, &s)
@@ -82,8 +82,8 @@ func TestAuth(t *testing.T) {
 	time.Sleep(3 * time.Second)
 
 	// load and remove expired sessions
-	a = InitAuth(fn, users, 60, nil, nil)
-	assert.Equal(t, checkSessionNotFound, a.checkSession(sessStr))
+	a = InitAuth(fn, users, 60, nil, nil, newTestPasswordHashing(t), nil)
+	assert.Equal(t, checkSessionNotFound, a.checkSession(sessStr, nil))
 
 	a.Close()
 }
@@ -29,10 +29,22 @@ const sessionCookieName = "agh_session"
 type loginJSON struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
+
+	// TOTP is the TOTP or the recovery code of the user, if the user has
+	// enabled two-factor authentication.
+	TOTP string `json:"totp"`
 }
 
-// newCookie creates a new authentication cookie.
-func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error) {
+// errInvalidCredentials is returned when the login credentials are invalid.
+const errInvalidCredentials errors.Error = "invalid username or password"
+
+// newCookie creates a new authentication cookie.  addr is the address used by
+// the rate limiter.
+func (a *Auth) newCookie(
+	req loginJSON,
+	addr string,
+	client *sessionClient,
+) (c *http.Cookie, err error) {
 	rateLimiter := a.rateLimiter
 	u, ok := a.findUser(req.Name, req.Password)
 	if !ok {
@@ -40,13 +52,38 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 			rateLimiter.inc(addr)
 		}
 
-		return nil, errors.Error("invalid username or password")
+		return nil, errInvalidCredentials
+	}
+
+	if u.TOTPSecret != "" {
+		code := strings.TrimSpace(req.TOTP)
+		if code == "" {
+			// Don't count the first step of the login as a failed attempt.
+			return nil, errTOTPRequired
+		}
+
+		if !a.checkSecondFactor(u.Name, code) {
+			if rateLimiter != nil {
+				rateLimiter.inc(addr)
+			}
+
+			return nil, errTOTPInvalid
+		}
 	}
 
 	if rateLimiter != nil {
 		rateLimiter.remove(addr)
 	}
 
+	return a.newSessionCookie(u.Name, client)
+}
+
+// newSessionCookie creates a new session for the user and returns its cookie.
+// client is the client the session is bound to, if the binding is enabled.
+func (a *Auth) newSessionCookie(
+	userName string,
+	client *sessionClient,
+) (c *http.Cookie, err error) {
 	sess, err := newSessionToken()
 	if err != nil {
 		return nil, fmt.Errorf("generating token: %w", err)
@@ -54,10 +91,16 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 
 	now := time.Now().UTC()
 
-	a.addSession(sess, &session{
-		userName: u.Name,
+	s := &session{
+		userName: userName,
 		expire:   uint32(now.Unix()) + a.sessionTTL,
-	})
+	}
+
+	if a.binding != nil && client != nil {
+		a.binding.bind(s, client)
+	}
+
+	a.addSession(sess, s)
 
 	return &http.Cookie{
 		Name:     sessionCookieName,
@@ -112,7 +155,26 @@ func realIP(r *http.Request) (ip netip.Addr, err error) {
 	return netip.ParseAddr(ipStr)
 }
 
-// writeErrorWithIP is like [aghhttp.Error], but includes the remote IP address
+// clientAddr returns the address of the client of r.  The headers of r are
+// only trusted if the request comes from one of trusted, which may be nil.
+func clientAddr(r *http.Request, trusted netutil.SubnetSet) (addr netip.Addr, err error) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("parsing remote addr %q: %w", r.RemoteAddr, err)
+	}
+
+	addr = addrPort.Addr().Unmap()
+	if trusted != nil && trusted.Contains(addr) {
+		ip, ipErr := realIP(r)
+		if ipErr == nil {
+			addr = ip.Unmap()
+		}
+	}
+
+	return addr, nil
+}
+
+// writeErrorWithIP is like [writeError], but includes the remote IP address
 // when it writes to the log.
 func writeErrorWithIP(
 	r *http.Request,
@@ -124,7 +186,7 @@ func writeErrorWithIP(
 ) {
 	text := fmt.Sprintf(format, args...)
 	log.Error("%s %s %s: from ip %s: %s", r.Method, r.Host, r.URL, remoteIP, text)
-	http.Error(w, text, code)
+	writeErrorResponse(w, r, code, newJSONError(code, text, args))
 }
 
 // handleLogin is the handler for the POST /control/login HTTP API.
@@ -132,12 +194,43 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	req := loginJSON{}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	remoteIP, ok := checkLoginAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	ip, err := realIP(r)
+	if err != nil {
+		log.Error("auth: getting real ip from request with remote ip %s: %s", remoteIP, err)
+	}
+
+	cookie, err := Context.auth.newCookie(req, remoteIP, Context.auth.newSessionClient(r))
+	if err != nil {
+		logIP := remoteIP
+		if Context.auth.trustedProxies.Contains(ip.Unmap()) {
+			logIP = ip.String()
+		}
+
+		writeErrorWithIP(r, w, http.StatusForbidden, logIP, "%s", err)
 
 		return
 	}
 
-	var remoteIP string
+	log.Info("auth: user %q successfully logged in from ip %s", req.Name, ip)
+
+	writeSessionCookie(w, cookie)
+}
+
+// checkLoginAllowed returns the remote address of the login request and true
+// if the client isn't blocked by the rate limiter.  Otherwise, it writes the
+// error response and returns false.
+func checkLoginAllowed(w http.ResponseWriter, r *http.Request) (remoteIP string, ok bool) {
+	var err error
 	// realIP cannot be used here without taking TrustedProxies into account due
 	// to security issues.
 	//
@@ -152,7 +245,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 			err,
 		)
 
-		return
+		return "", false
 	}
 
 	if rateLimiter := Context.auth.rateLimiter; rateLimiter != nil {
@@ -167,29 +260,15 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 				left,
 			)
 
-			return
-		}
-	}
-
-	ip, err := realIP(r)
-	if err != nil {
-		log.Error("auth: getting real ip from request with remote ip %s: %s", remoteIP, err)
-	}
-
-	cookie, err := Context.auth.newCookie(req, remoteIP)
-	if err != nil {
-		logIP := remoteIP
-		if Context.auth.trustedProxies.Contains(ip.Unmap()) {
-			logIP = ip.String()
+			return "", false
 		}
-
-		writeErrorWithIP(r, w, http.StatusForbidden, logIP, "%s", err)
-
-		return
 	}
 
-	log.Info("auth: user %q successfully logged in from ip %s", req.Name, ip)
+	return remoteIP, true
+}
 
+// writeSessionCookie sets the session cookie and responds with OK.
+func writeSessionCookie(w http.ResponseWriter, cookie *http.Cookie) {
 	http.SetCookie(w, cookie)
 
 	h := w.Header()
@@ -234,6 +313,15 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 func RegisterAuthHandlers() {
 	Context.mux.Handle("/control/login", postInstallHandler(ensureHandler(http.MethodPost, handleLogin)))
 	httpRegister(http.MethodGet, "/control/logout", handleLogout)
+	httpRegister(http.MethodGet, "/control/sessions", handleGetSessions)
+	httpRegister(http.MethodPost, "/control/sessions/revoke", handleRevokeSession)
+	httpRegister(http.MethodGet, "/control/sessions/alerts", handleSessionAlerts)
+	httpRegister(http.MethodGet, "/control/totp/status", handleTOTPStatus)
+	httpRegister(http.MethodPost, "/control/totp/enroll", handleTOTPEnroll)
+	httpRegister(http.MethodPost, "/control/totp/confirm", handleTOTPConfirm)
+	httpRegister(http.MethodPost, "/control/totp/disable", handleTOTPDisable)
+
+	registerWebAuthnHandlers()
 }
 
 // optionalAuthThird returns true if a user should authenticate first.
@@ -247,27 +335,7 @@ func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
 	}
 
 	// redirect to login page if not authenticated
-	isAuthenticated := false
-	cookie, err := r.Cookie(sessionCookieName)
-	if err != nil {
-		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
-		// Check Basic authentication.
-		user, pass, hasBasic := r.BasicAuth()
-		if hasBasic {
-			_, isAuthenticated = Context.auth.findUser(user, pass)
-			if !isAuthenticated {
-				log.Info("%s: invalid basic authorization value", pref)
-			}
-		}
-	} else {
-		res := Context.auth.checkSession(cookie.Value)
-		isAuthenticated = res == checkSessionOK
-		if !isAuthenticated {
-			log.Debug("%s: invalid cookie value: %q", pref, cookie)
-		}
-	}
-
-	if isAuthenticated {
+	if isAuthenticated(r, pref) {
 		return false
 	}
 
@@ -280,13 +348,56 @@ func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
 		}
 	} else {
 		log.Debug("%s: responded with forbidden to %s %s", pref, r.Method, p)
-		w.WriteHeader(http.StatusForbidden)
-		_, _ = w.Write([]byte("Forbidden"))
+		writeErrorResponse(w, r, http.StatusForbidden, &jsonError{
+			Code:    aghhttp.ErrorCodeAUT000,
+			Message: http.StatusText(http.StatusForbidden),
+		})
 	}
 
 	return true
 }
 
+// isAuthenticated returns true if r contains either a valid session cookie or
+// valid Basic authentication credentials.  pref is used for logging.
+func isAuthenticated(r *http.Request, pref string) (ok bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
+		// Check Basic authentication.
+		user, pass, hasBasic := r.BasicAuth()
+		if hasBasic {
+			var u webUser
+			u, ok = Context.auth.findUser(user, pass)
+			if !ok {
+				log.Info("%s: invalid basic authorization value", pref)
+			} else if u.TOTPSecret != "" {
+				// Basic authentication can't carry the second factor.
+				log.Info("%s: basic authorization of user %q with totp", pref, u.Name)
+				ok = false
+			}
+		}
+
+		return ok
+	}
+
+	ok = Context.auth.checkSession(cookie.Value, Context.auth.newSessionClient(r)) == checkSessionOK
+	if !ok {
+		log.Debug("%s: invalid cookie value: %q", pref, cookie)
+	}
+
+	return ok
+}
+
+// isAuthenticatedDoH returns true if r, a DNS-over-HTTPS request, contains
+// valid credentials of the web interface or no authentication is configured.
+func isAuthenticatedDoH(r *http.Request) (ok bool) {
+	if Context.auth == nil || !Context.auth.authRequired() {
+		return true
+	}
+
+	return isAuthenticated(r, fmt.Sprintf("auth: doh: raddr %s", r.RemoteAddr))
+}
+
 // TODO(a.garipov): Use [http.Handler] consistently everywhere throughout the
 // project.
 func optionalAuth(
@@ -299,7 +410,7 @@ func optionalAuth(
 			cookie, err := r.Cookie(sessionCookieName)
 			if authRequired && err == nil {
 				// Redirect to the dashboard if already authenticated.
-				res := Context.auth.checkSession(cookie.Value)
+				res := Context.auth.checkSession(cookie.Value, Context.auth.newSessionClient(r))
 				if res == checkSessionOK {
 					http.Redirect(w, r, "", http.StatusFound)
 
@@ -0,0 +1,349 @@
+package home
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// kdfAlgorithm is the name of a key derivation function used to hash the
+// passwords of the users.
+type kdfAlgorithm string
+
+// kdfAlgorithm values.
+const (
+	kdfAlgorithmBcrypt   kdfAlgorithm = "bcrypt"
+	kdfAlgorithmArgon2id kdfAlgorithm = "argon2id"
+)
+
+// argon2idConfig is the configuration of the Argon2id key derivation function.
+type argon2idConfig struct {
+	// Memory is the amount of memory used by the function, in KiB.
+	Memory uint32 `yaml:"memory"`
+
+	// Iterations is the number of passes over the memory.
+	Iterations uint32 `yaml:"iterations"`
+
+	// Parallelism is the number of threads used by the function.
+	Parallelism uint8 `yaml:"parallelism"`
+}
+
+// passwordHashingConfig is the configuration of hashing the passwords of the
+// users.
+type passwordHashingConfig struct {
+	// KDF is the key derivation function used to hash the new passwords.  The
+	// passwords hashed by another function or with other parameters are
+	// rehashed on the next successful login.  It's bcrypt by default, since
+	// the previous versions only support it, so choosing Argon2id makes
+	// rolling back lock the users out.
+	KDF kdfAlgorithm `yaml:"kdf"`
+
+	// BreachedPasswordsDir is the path to the directory with the offline list
+	// of the SHA-1 hashes of known breached passwords split into the files by
+	// the first five hexadecimal digits of the hashes, as published by Have I
+	// Been Pwned.  If empty, the passwords aren't checked.
+	BreachedPasswordsDir string `yaml:"breached_passwords_dir"`
+
+	// Argon2id is the configuration of the Argon2id function.
+	Argon2id argon2idConfig `yaml:"argon2id"`
+
+	// BcryptCost is the cost of the bcrypt function.
+	BcryptCost int `yaml:"bcrypt_cost"`
+}
+
+// passwordKDF is a key derivation function used to hash the passwords of the
+// users.
+type passwordKDF interface {
+	// hash returns the encoded hash of password.
+	hash(password string) (encoded string, err error)
+
+	// isCurrent returns true if encoded has been produced by this function
+	// with its current parameters.
+	isCurrent(encoded string) (ok bool)
+}
+
+// passwordHashing hashes and checks the passwords of the users.
+type passwordHashing struct {
+	// kdf is used to hash the new passwords.
+	kdf passwordKDF
+
+	// breachedDir is the path to the directory with the list of the breached
+	// passwords, if any.
+	breachedDir string
+}
+
+// newPasswordHashing returns a new properly initialized *passwordHashing.
+// conf must not be nil.
+func newPasswordHashing(conf *passwordHashingConfig) (p *passwordHashing, err error) {
+	p = &passwordHashing{
+		breachedDir: conf.BreachedPasswordsDir,
+	}
+
+	switch conf.KDF {
+	case kdfAlgorithmBcrypt:
+		if conf.BcryptCost < bcrypt.MinCost || conf.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf(
+				"bcrypt_cost: must be from %d to %d, got %d",
+				bcrypt.MinCost,
+				bcrypt.MaxCost,
+				conf.BcryptCost,
+			)
+		}
+
+		p.kdf = &bcryptKDF{cost: conf.BcryptCost}
+	case kdfAlgorithmArgon2id:
+		c := conf.Argon2id
+		if c.Memory == 0 || c.Iterations == 0 || c.Parallelism == 0 {
+			return nil, errors.Error("argon2id: memory, iterations, and parallelism must be positive")
+		}
+
+		p.kdf = &argon2idKDF{params: c}
+	default:
+		return nil, fmt.Errorf("kdf: unsupported value %q", conf.KDF)
+	}
+
+	return p, nil
+}
+
+// hash returns the hash of password after checking that it isn't known to be
+// breached.
+func (p *passwordHashing) hash(password string) (encoded string, err error) {
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return "", fmt.Errorf("checking breached passwords: %w", err)
+	} else if breached {
+		return "", errors.Error("password is known to be breached, choose another one")
+	}
+
+	return p.kdf.hash(password)
+}
+
+// isBreached returns true if password is in the list of breached passwords.
+// Only the first five hexadecimal digits of the SHA-1 hash of the password are
+// used to find the file to look into, the same as with the k-anonymity API of
+// Have I Been Pwned.
+func (p *passwordHashing) isBreached(password string) (ok bool, err error) {
+	if p.breachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := h[:5], h[5:]
+
+	f, err := os.Open(filepath.Join(p.breachedDir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(s.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, s.Err()
+}
+
+// verifyPassword returns true if password matches the encoded hash produced by
+// any of the supported key derivation functions.
+func verifyPassword(encoded, password string) (ok bool) {
+	if strings.HasPrefix(encoded, argon2idPrefix) {
+		return verifyArgon2id(encoded, password)
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+// minArgon2idMemoryTime is the minimum product of the memory, in KiB, and the
+// iterations of Argon2id considered strong enough.  It corresponds to the
+// baseline recommended by OWASP, which is 19 MiB and 2 iterations.
+const minArgon2idMemoryTime = 19 * 1024 * 2
+
+// isWeakPasswordHash returns true if encoded is produced with the parameters
+// too weak to resist brute-forcing or can't be recognized.
+func isWeakPasswordHash(encoded string) (ok bool) {
+	if strings.HasPrefix(encoded, argon2idPrefix) {
+		params, _, _, err := decodeArgon2id(encoded)
+
+		return err != nil || uint64(params.Memory)*uint64(params.Iterations) < minArgon2idMemoryTime
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost < bcrypt.DefaultCost
+}
+
+// bcryptKDF is the bcrypt [passwordKDF].
+type bcryptKDF struct {
+	cost int
+}
+
+// type check
+var _ passwordKDF = (*bcryptKDF)(nil)
+
+// hash implements the [passwordKDF] interface for *bcryptKDF.
+func (k *bcryptKDF) hash(password string) (encoded string, err error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), k.cost)
+	if err != nil {
+		return "", fmt.Errorf("generating hash: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// isCurrent implements the [passwordKDF] interface for *bcryptKDF.
+func (k *bcryptKDF) isCurrent(encoded string) (ok bool) {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err == nil && cost == k.cost
+}
+
+const (
+	// argon2idPrefix is the prefix of the hashes encoded in the PHC string
+	// format produced by Argon2id.
+	argon2idPrefix = "$argon2id$"
+
+	// argon2idSaltLen is the length of the salt, in bytes.
+	argon2idSaltLen = 16
+
+	// argon2idKeyLen is the length of the derived key, in bytes.
+	argon2idKeyLen = 32
+)
+
+// argon2idKDF is the Argon2id [passwordKDF].
+type argon2idKDF struct {
+	params argon2idConfig
+}
+
+// type check
+var _ passwordKDF = (*argon2idKDF)(nil)
+
+// hash implements the [passwordKDF] interface for *argon2idKDF.  encoded is in
+// the PHC string format.
+func (k *argon2idKDF) hash(password string) (encoded string, err error) {
+	salt := make([]byte, argon2idSaltLen)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+
+	p := k.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2idKeyLen)
+
+	return encodeArgon2id(p, salt, key), nil
+}
+
+// isCurrent implements the [passwordKDF] interface for *argon2idKDF.
+func (k *argon2idKDF) isCurrent(encoded string) (ok bool) {
+	params, _, key, err := decodeArgon2id(encoded)
+
+	return err == nil && params == k.params && len(key) == argon2idKeyLen
+}
+
+// encodeArgon2id returns the hash in the PHC string format.
+func encodeArgon2id(p argon2idConfig, salt, key []byte) (encoded string) {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		p.Memory,
+		p.Iterations,
+		p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2id parses the hash in the PHC string format.
+func decodeArgon2id(encoded string) (p argon2idConfig, salt, key []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(encoded, argon2idPrefix), "$")
+	if len(parts) != 4 {
+		return p, nil, nil, fmt.Errorf("argon2id: want 4 parts, got %d", len(parts))
+	}
+
+	var version int
+	_, err = fmt.Sscanf(parts[0], "v=%d", &version)
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: parsing version: %w", err)
+	} else if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("argon2id: unsupported version %d", version)
+	}
+
+	_, err = fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: parsing parameters: %w", err)
+	}
+
+	err = validateArgon2idParams(p)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return p, nil, nil, err
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: decoding salt: %w", err)
+	} else if len(salt) == 0 {
+		return p, nil, nil, errors.Error("argon2id: empty salt")
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: decoding key: %w", err)
+	} else if len(key) == 0 {
+		return p, nil, nil, errors.Error("argon2id: empty key")
+	}
+
+	return p, salt, key, nil
+}
+
+// validateArgon2idParams returns an error if the parameters decoded from a hash
+// can't have been produced by Argon2id.  The function itself silently raises
+// the memory to 8 KiB per thread, so such hashes are rejected as well.
+func validateArgon2idParams(p argon2idConfig) (err error) {
+	switch {
+	case p.Iterations == 0:
+		return errors.Error("argon2id: iterations must be positive")
+	case p.Parallelism == 0:
+		return errors.Error("argon2id: parallelism must be positive")
+	case p.Memory < 8*uint32(p.Parallelism):
+		return fmt.Errorf(
+			"argon2id: memory must be at least %d KiB for parallelism %d, got %d",
+			8*uint32(p.Parallelism),
+			p.Parallelism,
+			p.Memory,
+		)
+	default:
+		return nil
+	}
+}
+
+// verifyArgon2id returns true if password matches the Argon2id hash encoded.
+func verifyArgon2id(encoded, password string) (ok bool) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
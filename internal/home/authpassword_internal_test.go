@@ -0,0 +1,256 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idConfig is the cheap Argon2id configuration for tests.
+var testArgon2idConfig = argon2idConfig{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+}
+
+// newTestPasswordHashing is a helper that returns a new *passwordHashing using
+// the cheap Argon2id configuration.
+func newTestPasswordHashing(tb testing.TB) (p *passwordHashing) {
+	tb.Helper()
+
+	p, err := newPasswordHashing(&passwordHashingConfig{
+		KDF:      kdfAlgorithmArgon2id,
+		Argon2id: testArgon2idConfig,
+	})
+	require.NoError(tb, err)
+
+	return p
+}
+
+func TestNewPasswordHashing(t *testing.T) {
+	testCases := []struct {
+		conf       *passwordHashingConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &passwordHashingConfig{
+			KDF:        kdfAlgorithmBcrypt,
+			BcryptCost: bcrypt.DefaultCost,
+		},
+		name:       "bcrypt",
+		wantErrMsg: "",
+	}, {
+		conf: &passwordHashingConfig{
+			KDF:        kdfAlgorithmBcrypt,
+			BcryptCost: bcrypt.MaxCost + 1,
+		},
+		name:       "bad_bcrypt_cost",
+		wantErrMsg: "bcrypt_cost: must be from 4 to 31, got 32",
+	}, {
+		conf: &passwordHashingConfig{
+			KDF:      kdfAlgorithmArgon2id,
+			Argon2id: testArgon2idConfig,
+		},
+		name:       "argon2id",
+		wantErrMsg: "",
+	}, {
+		conf: &passwordHashingConfig{
+			KDF: kdfAlgorithmArgon2id,
+		},
+		name:       "bad_argon2id",
+		wantErrMsg: "argon2id: memory, iterations, and parallelism must be positive",
+	}, {
+		conf: &passwordHashingConfig{
+			KDF: "scrypt",
+		},
+		name:       "bad_kdf",
+		wantErrMsg: `kdf: unsupported value "scrypt"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newPasswordHashing(tc.conf)
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
+
+func TestArgon2idKDF(t *testing.T) {
+	k := &argon2idKDF{params: testArgon2idConfig}
+
+	encoded, err := k.hash("password")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"))
+	assert.True(t, k.isCurrent(encoded))
+
+	assert.True(t, verifyPassword(encoded, "password"))
+	assert.False(t, verifyPassword(encoded, "wrong"))
+
+	other := &argon2idKDF{params: argon2idConfig{
+		Memory:      128,
+		Iterations:  1,
+		Parallelism: 1,
+	}}
+	assert.False(t, other.isCurrent(encoded))
+
+	assert.False(t, k.isCurrent("$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2"))
+	assert.False(t, verifyPassword("$argon2id$v=19$bad", "password"))
+}
+
+func TestVerifyArgon2id(t *testing.T) {
+	k := &argon2idKDF{params: testArgon2idConfig}
+
+	encoded, err := k.hash("password")
+	require.NoError(t, err)
+
+	parts := strings.Split(encoded, "$")
+	require.Len(t, parts, 6)
+
+	salt, key := parts[4], parts[5]
+
+	testCases := []struct {
+		name       string
+		encoded    string
+		wantErrMsg string
+	}{{
+		name:       "valid",
+		encoded:    encoded,
+		wantErrMsg: "",
+	}, {
+		name:       "zero_iterations",
+		encoded:    "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		wantErrMsg: "argon2id: iterations must be positive",
+	}, {
+		name:       "zero_parallelism",
+		encoded:    "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		wantErrMsg: "argon2id: parallelism must be positive",
+	}, {
+		name:       "low_memory",
+		encoded:    "$argon2id$v=19$m=15,t=1,p=2$" + salt + "$" + key,
+		wantErrMsg: "argon2id: memory must be at least 16 KiB for parallelism 2, got 15",
+	}, {
+		name:       "empty_salt",
+		encoded:    "$argon2id$v=19$m=64,t=1,p=1$$" + key,
+		wantErrMsg: "argon2id: empty salt",
+	}, {
+		name:       "empty_key",
+		encoded:    "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+		wantErrMsg: "argon2id: empty key",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, decErr := decodeArgon2id(tc.encoded)
+			if tc.wantErrMsg == "" {
+				require.NoError(t, decErr)
+
+				assert.True(t, verifyArgon2id(tc.encoded, "password"))
+			} else {
+				assert.EqualError(t, decErr, tc.wantErrMsg)
+
+				assert.False(t, verifyArgon2id(tc.encoded, "password"))
+			}
+		})
+	}
+}
+
+func TestIsWeakPasswordHash(t *testing.T) {
+	testCases := []struct {
+		want    assert.BoolAssertionFunc
+		name    string
+		encoded string
+	}{{
+		want:    assert.True,
+		name:    "bcrypt_weak",
+		encoded: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}, {
+		want:    assert.False,
+		name:    "bcrypt_strong",
+		encoded: "$2a$10$Mq4I3v5Cz6fxLg9hQ3CZueLOPjzD7qs1O7Vqwgz6cHPskW6BJ1uWC",
+	}, {
+		want:    assert.True,
+		name:    "argon2id_weak",
+		encoded: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+	}, {
+		want:    assert.False,
+		name:    "argon2id_strong",
+		encoded: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$a2V5",
+	}, {
+		want:    assert.True,
+		name:    "unknown",
+		encoded: "plain",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, isWeakPasswordHash(tc.encoded))
+		})
+	}
+}
+
+func TestPasswordHashing_hash_breached(t *testing.T) {
+	dir := t.TempDir()
+
+	// The SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	data := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" +
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n"
+	err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(data), 0o600)
+	require.NoError(t, err)
+
+	p := newTestPasswordHashing(t)
+	p.breachedDir = dir
+
+	_, err = p.hash("password")
+	assert.EqualError(t, err, "password is known to be breached, choose another one")
+
+	encoded, err := p.hash("correct horse battery staple")
+	require.NoError(t, err)
+
+	assert.True(t, verifyPassword(encoded, "correct horse battery staple"))
+}
+
+func TestAuth_findUser_rehash(t *testing.T) {
+	users := []webUser{{
+		Name:         "name",
+		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}}
+
+	changed := 0
+	a := InitAuth(
+		filepath.Join(t.TempDir(), "sessions.db"),
+		users,
+		60,
+		nil,
+		nil,
+		newTestPasswordHashing(t),
+		func() { changed++ },
+	)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	_, ok := a.findUser("name", "wrong")
+	require.False(t, ok)
+	require.Zero(t, changed)
+
+	u, ok := a.findUser("name", "password")
+	require.True(t, ok)
+
+	assert.Equal(t, 1, changed)
+	assert.True(t, strings.HasPrefix(u.PasswordHash, argon2idPrefix))
+	assert.Equal(t, u.PasswordHash, a.usersList()[0].PasswordHash)
+
+	_, ok = a.findUser("name", "password")
+	require.True(t, ok)
+
+	assert.Equal(t, 1, changed)
+}
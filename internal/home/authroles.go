@@ -0,0 +1,137 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// userRole is the role of a user of the Web UI, which defines the HTTP APIs
+// the user may use to change data.  All roles may use the HTTP APIs that only
+// read data.
+type userRole string
+
+// Allowed [userRole] values.
+const (
+	// userRoleDefault is the role of the users without an explicitly
+	// configured role, which is the same as [userRoleAdmin] for compatibility
+	// with the configurations of the previous versions.
+	userRoleDefault userRole = ""
+
+	// userRoleAdmin is the role of the users who may use all HTTP APIs.
+	userRoleAdmin userRole = "admin"
+
+	// userRoleOperator is the role of the users who may perform the
+	// operational actions and manage persistent clients, but not change the
+	// settings of the server.
+	userRoleOperator userRole = "operator"
+
+	// userRoleReadOnly is the role of the users who may only view the data,
+	// such as the statistics and the query log.
+	userRoleReadOnly userRole = "read_only"
+)
+
+// UnmarshalText implements [encoding.TextUnmarshaler] interface for *userRole.
+func (role *userRole) UnmarshalText(b []byte) (err error) {
+	switch r := userRole(b); r {
+	case userRoleDefault, userRoleAdmin, userRoleOperator, userRoleReadOnly:
+		*role = r
+	default:
+		return fmt.Errorf(
+			"invalid role %q, supported: %q, %q, %q",
+			b,
+			userRoleAdmin,
+			userRoleOperator,
+			userRoleReadOnly,
+		)
+	}
+
+	return nil
+}
+
+// ownDataPaths are the patterns of the data-modifying HTTP APIs which only
+// change the data of the user sending the request, so all roles may use them.
+var ownDataPaths = container.NewMapSet(
+	"/control/sessions/revoke",
+	"/control/totp/confirm",
+	"/control/totp/disable",
+	"/control/totp/enroll",
+	"/control/webauthn/credentials/delete",
+	"/control/webauthn/register/begin",
+	"/control/webauthn/register/finish",
+)
+
+// operatorPaths are the patterns of the data-modifying HTTP APIs that users
+// with [userRoleOperator] may use in addition to [ownDataPaths].
+var operatorPaths = container.NewMapSet(
+	"/control/cache_clear",
+	"/control/clients/add",
+	"/control/clients/delete",
+	"/control/clients/import",
+	"/control/clients/pause",
+	"/control/clients/update",
+	"/control/clients/{id}/wake",
+	"/control/dhcp/find_active_dhcp",
+	"/control/filtering/refresh",
+	"/control/i18n/change_language",
+	"/control/profile/update",
+	"/control/protection",
+	"/control/test_upstream_dns",
+	"/control/tls/validate",
+)
+
+// allows returns true if the users with role may send requests with method to
+// the HTTP API registered with pattern.
+func (role userRole) allows(method, pattern string) (ok bool) {
+	if !modifiesData(method) || ownDataPaths.Has(pattern) {
+		return true
+	}
+
+	switch role {
+	case userRoleDefault, userRoleAdmin:
+		return true
+	case userRoleOperator:
+		return operatorPaths.Has(pattern)
+	default:
+		return false
+	}
+}
+
+// ensureRole returns a wrapped handler that makes sure that the role of the
+// authenticated user allows sending requests with method to the HTTP API
+// registered with pattern.
+func ensureRole(method, pattern string, h http.HandlerFunc) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !roleCheckRequired(method) {
+			h(w, r)
+
+			return
+		}
+
+		u := Context.auth.getCurrentUser(r)
+		if u.Name == "" {
+			// The session may belong to a user that has been removed since.
+			writeError(r, w, http.StatusForbidden, "unknown user")
+
+			return
+		}
+
+		if !u.Role.allows(method, pattern) {
+			log.Info("auth: user %q with role %q is not allowed to %s %s", u.Name, u.Role, method, pattern)
+			writeError(r, w, http.StatusForbidden, "role %q does not allow this request", u.Role)
+
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// roleCheckRequired returns true if the role of the user must be checked for
+// the requests with method.  The users are authenticated by gl-inet in the
+// GL-Inet mode, so their roles aren't known.
+func roleCheckRequired(method string) (ok bool) {
+	return modifiesData(method) && !GLMode && Context.auth != nil && Context.auth.authRequired()
+}
@@ -0,0 +1,215 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRole_UnmarshalText(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+		want       userRole
+	}{{
+		name:       "empty",
+		in:         "",
+		wantErrMsg: "",
+		want:       userRoleDefault,
+	}, {
+		name:       "operator",
+		in:         "operator",
+		wantErrMsg: "",
+		want:       userRoleOperator,
+	}, {
+		name:       "read_only",
+		in:         "read_only",
+		wantErrMsg: "",
+		want:       userRoleReadOnly,
+	}, {
+		name: "bad",
+		in:   "root",
+		wantErrMsg: `invalid role "root", supported: ` +
+			`"admin", "operator", "read_only"`,
+		want: userRoleDefault,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var role userRole
+			err := role.UnmarshalText([]byte(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, role)
+		})
+	}
+}
+
+func TestUserRole_allows(t *testing.T) {
+	const (
+		patternSettings = "/control/dns_config"
+		patternOwn      = "/control/sessions/revoke"
+		patternOperator = "/control/protection"
+	)
+
+	testCases := []struct {
+		role    userRole
+		method  string
+		pattern string
+		want    assert.BoolAssertionFunc
+	}{{
+		role:    userRoleDefault,
+		method:  http.MethodPost,
+		pattern: patternSettings,
+		want:    assert.True,
+	}, {
+		role:    userRoleAdmin,
+		method:  http.MethodPost,
+		pattern: patternSettings,
+		want:    assert.True,
+	}, {
+		role:    userRoleOperator,
+		method:  http.MethodPost,
+		pattern: patternSettings,
+		want:    assert.False,
+	}, {
+		role:    userRoleOperator,
+		method:  http.MethodPost,
+		pattern: patternOperator,
+		want:    assert.True,
+	}, {
+		role:    userRoleReadOnly,
+		method:  http.MethodPost,
+		pattern: patternOperator,
+		want:    assert.False,
+	}, {
+		role:    userRoleReadOnly,
+		method:  http.MethodPost,
+		pattern: patternOwn,
+		want:    assert.True,
+	}, {
+		role:    userRoleReadOnly,
+		method:  http.MethodGet,
+		pattern: "/control/querylog",
+		want:    assert.True,
+	}}
+
+	for _, tc := range testCases {
+		name := strings.Join([]string{string(tc.role), tc.method, tc.pattern}, "_")
+		t.Run(name, func(t *testing.T) {
+			tc.want(t, tc.role.allows(tc.method, tc.pattern))
+		})
+	}
+}
+
+// newTestRolesAuth sets [Context.auth] to a new authentication object with the
+// users having all roles.
+func newTestRolesAuth(t *testing.T) {
+	t.Helper()
+
+	users := []webUser{{
+		Name: "admin",
+	}, {
+		Name: "operator",
+		Role: userRoleOperator,
+	}, {
+		Name: "viewer",
+		Role: userRoleReadOnly,
+	}}
+
+	fn := filepath.Join(t.TempDir(), "sessions.db")
+	prev := Context.auth
+	Context.auth = InitAuth(fn, users, 60, nil, nil, newTestPasswordHashing(t), nil)
+	require.NotNil(t, Context.auth)
+
+	t.Cleanup(func() {
+		Context.auth.Close()
+		Context.auth = prev
+	})
+}
+
+// newTestSessionRequest returns a new request with the cookie of a new session
+// of the user with userName.
+func newTestSessionRequest(t *testing.T, method, userName string) (r *http.Request) {
+	t.Helper()
+
+	cookie, err := Context.auth.newSessionCookie(userName, nil)
+	require.NoError(t, err)
+
+	r = httptest.NewRequest(method, "/", strings.NewReader("{}"))
+	r.Header.Set(httphdr.Cookie, cookie.String())
+	r.Header.Set(httphdr.ContentType, aghhttp.HdrValApplicationJSON)
+
+	return r
+}
+
+func TestEnsureRole(t *testing.T) {
+	newTestRolesAuth(t)
+
+	h := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	testCases := []struct {
+		name     string
+		user     string
+		method   string
+		pattern  string
+		wantCode int
+	}{{
+		name:     "admin_settings",
+		user:     "admin",
+		method:   http.MethodPost,
+		pattern:  "/control/dns_config",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "operator_settings",
+		user:     "operator",
+		method:   http.MethodPost,
+		pattern:  "/control/dns_config",
+		wantCode: http.StatusForbidden,
+	}, {
+		name:     "operator_cache",
+		user:     "operator",
+		method:   http.MethodPost,
+		pattern:  "/control/cache_clear",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "viewer_cache",
+		user:     "viewer",
+		method:   http.MethodPost,
+		pattern:  "/control/cache_clear",
+		wantCode: http.StatusForbidden,
+	}, {
+		name:     "viewer_stats",
+		user:     "viewer",
+		method:   http.MethodGet,
+		pattern:  "/control/stats",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "removed_user",
+		user:     "removed",
+		method:   http.MethodPost,
+		pattern:  "/control/cache_clear",
+		wantCode: http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestSessionRequest(t, tc.method, tc.user)
+			rw := httptest.NewRecorder()
+			ensureRole(tc.method, tc.pattern, h)(rw, r)
+
+			assert.Equal(t, tc.wantCode, rw.Code)
+		})
+	}
+}
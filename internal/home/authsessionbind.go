@@ -0,0 +1,318 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// sessionBindingMode is the way the web sessions reused from another network
+// or browser are handled.
+type sessionBindingMode string
+
+// sessionBindingMode values.
+const (
+	// sessionBindingModeOff means that the sessions aren't bound to the
+	// networks and browsers they have been created from.
+	sessionBindingModeOff sessionBindingMode = "off"
+
+	// sessionBindingModeAlert means that the reuse of a session from another
+	// network or browser is only logged and reported.
+	sessionBindingModeAlert sessionBindingMode = "alert"
+
+	// sessionBindingModeEnforce means that a session reused from another
+	// network or browser is reported and invalidated.
+	sessionBindingModeEnforce sessionBindingMode = "enforce"
+)
+
+// sessionBindingConfig is the configuration of binding the web sessions to the
+// networks and browsers they have been created from.
+type sessionBindingConfig struct {
+	// Mode is the way the reused sessions are handled.
+	Mode sessionBindingMode `yaml:"mode"`
+
+	// IPv4PrefixLen is the length of the prefix of the IPv4 network a session
+	// is bound to.
+	IPv4PrefixLen int `yaml:"ipv4_prefix_len"`
+
+	// IPv6PrefixLen is the length of the prefix of the IPv6 network a session
+	// is bound to.
+	IPv6PrefixLen int `yaml:"ipv6_prefix_len"`
+}
+
+// sessionAlertReason is the reason of a session alert.
+type sessionAlertReason string
+
+// sessionAlertReason values.
+const (
+	// sessionAlertReasonNewNetwork means that the session has been used from
+	// a network other than the one it has been bound to.
+	sessionAlertReasonNewNetwork sessionAlertReason = "new_network"
+
+	// sessionAlertReasonUserAgent means that the session has been used by
+	// a browser other than the one it has been created by.
+	sessionAlertReasonUserAgent sessionAlertReason = "user_agent_changed"
+)
+
+// sessionAlertJSON is the JSON representation of the reuse of a session from
+// another network or browser.
+type sessionAlertJSON struct {
+	// Time is the time of the request, in the RFC 3339 format.
+	Time string `json:"time"`
+
+	// UserName is the name of the user owning the session.
+	UserName string `json:"user_name"`
+
+	// Reason is the reason of the alert.
+	Reason sessionAlertReason `json:"reason"`
+
+	// BoundNetwork is the network the session has been bound to.
+	BoundNetwork string `json:"bound_network"`
+
+	// Network is the network the request has come from.
+	Network string `json:"network"`
+
+	// UserAgent is the User-Agent header of the request.
+	UserAgent string `json:"user_agent"`
+
+	// Invalidated is true if the session has been invalidated.
+	Invalidated bool `json:"invalidated"`
+}
+
+// sessionAlertsJSON is the JSON representation of the recent session alerts.
+type sessionAlertsJSON struct {
+	// Alerts are the recent alerts, the newest first.  It's never nil.
+	Alerts []*sessionAlertJSON `json:"alerts"`
+}
+
+// maxSessionAlerts is the maximum number of the recent session alerts kept in
+// memory.
+const maxSessionAlerts = 100
+
+// maxUserAgentLen is the maximum length of the stored User-Agent fingerprint.
+const maxUserAgentLen = 256
+
+// sessionBinding binds the web sessions to the networks and browsers they have
+// been created from.
+type sessionBinding struct {
+	// alertsMu protects alerts.
+	alertsMu *sync.Mutex
+
+	// alerts are the recent alerts, the oldest first.
+	alerts []*sessionAlertJSON
+
+	// mode is the way the reused sessions are handled.  It's never
+	// [sessionBindingModeOff].
+	mode sessionBindingMode
+
+	// ipv4PrefixLen is the length of the prefix of the bound IPv4 networks.
+	ipv4PrefixLen int
+
+	// ipv6PrefixLen is the length of the prefix of the bound IPv6 networks.
+	ipv6PrefixLen int
+}
+
+// newSessionBinding returns a new properly initialized *sessionBinding.  It
+// returns nil if the binding is disabled.
+func newSessionBinding(conf *sessionBindingConfig) (b *sessionBinding, err error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	switch conf.Mode {
+	case sessionBindingModeOff:
+		return nil, nil
+	case sessionBindingModeAlert, sessionBindingModeEnforce:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("mode: unsupported value %q", conf.Mode)
+	}
+
+	if l := conf.IPv4PrefixLen; l < 0 || l > netutil.IPv4BitLen {
+		return nil, fmt.Errorf("ipv4_prefix_len: must be from 0 to 32, got %d", l)
+	} else if l = conf.IPv6PrefixLen; l < 0 || l > netutil.IPv6BitLen {
+		return nil, fmt.Errorf("ipv6_prefix_len: must be from 0 to 128, got %d", l)
+	}
+
+	return &sessionBinding{
+		alertsMu:      &sync.Mutex{},
+		mode:          conf.Mode,
+		ipv4PrefixLen: conf.IPv4PrefixLen,
+		ipv6PrefixLen: conf.IPv6PrefixLen,
+	}, nil
+}
+
+// sessionClient is the client using a web session.
+type sessionClient struct {
+	// userAgent is the User-Agent header of the request.
+	userAgent string
+
+	// addr is the address of the client.
+	addr netip.Addr
+}
+
+// newSessionClient returns the client of the request.  The headers of r are
+// only trusted if the request comes from one of the trusted proxies.
+func (a *Auth) newSessionClient(r *http.Request) (c *sessionClient) {
+	c = &sessionClient{
+		userAgent: r.UserAgent(),
+	}
+
+	addr, err := clientAddr(r, a.trustedProxies)
+	if err != nil {
+		log.Debug("auth: %s", err)
+
+		return c
+	}
+
+	c.addr = addr
+
+	return c
+}
+
+// subnet returns the network of addr the sessions are bound to.
+func (b *sessionBinding) subnet(addr netip.Addr) (p netip.Prefix) {
+	if !addr.IsValid() {
+		return netip.Prefix{}
+	}
+
+	bits := b.ipv6PrefixLen
+	if addr.Is4() {
+		bits = b.ipv4PrefixLen
+	}
+
+	// The error is only returned for invalid addresses and prefix lengths,
+	// which are checked above and in newSessionBinding.
+	p, _ = addr.Prefix(bits)
+
+	return p
+}
+
+// userAgentFingerprint returns the User-Agent header without the version
+// numbers, so that the updates of the browsers don't change the fingerprint.
+func userAgentFingerprint(ua string) (fp string) {
+	fp = strings.Map(func(r rune) (res rune) {
+		if r >= '0' && r <= '9' {
+			return -1
+		}
+
+		return r
+	}, ua)
+
+	if len(fp) > maxUserAgentLen {
+		fp = fp[:maxUserAgentLen]
+	}
+
+	return fp
+}
+
+// bind binds the session to the network and the browser of the client.
+func (b *sessionBinding) bind(s *session, c *sessionClient) {
+	s.subnet = b.subnet(c.addr)
+	s.userAgent = userAgentFingerprint(c.userAgent)
+}
+
+// check checks if the session is used by the client it has been bound to.  If
+// it isn't, check records an alert.  invalidate is true if the session must be
+// invalidated.  rebound is true if the binding of s has been changed.
+func (b *sessionBinding) check(s *session, c *sessionClient) (invalidate, rebound bool) {
+	if !c.addr.IsValid() {
+		// Don't report the clients with unknown addresses, for example the
+		// ones connecting through a Unix socket.
+		return false, false
+	} else if !s.subnet.IsValid() {
+		// The session has been created before the binding has been enabled.
+		b.bind(s, c)
+
+		return false, true
+	}
+
+	subnet := b.subnet(c.addr)
+	fp := userAgentFingerprint(c.userAgent)
+
+	var reason sessionAlertReason
+	switch {
+	case subnet != s.subnet:
+		reason = sessionAlertReasonNewNetwork
+	case fp != s.userAgent:
+		reason = sessionAlertReasonUserAgent
+	default:
+		return false, false
+	}
+
+	invalidate = b.mode == sessionBindingModeEnforce
+
+	log.Info(
+		"auth: session of user %q bound to %s reused from %s: %s; invalidated: %t",
+		s.userName,
+		s.subnet,
+		subnet,
+		reason,
+		invalidate,
+	)
+
+	b.addAlert(&sessionAlertJSON{
+		Time:         time.Now().Format(time.RFC3339),
+		UserName:     s.userName,
+		Reason:       reason,
+		BoundNetwork: s.subnet.String(),
+		Network:      subnet.String(),
+		UserAgent:    c.userAgent,
+		Invalidated:  invalidate,
+	})
+
+	if invalidate {
+		return true, false
+	}
+
+	// Rebind the session so that the same change isn't reported on every
+	// request.
+	s.subnet, s.userAgent = subnet, fp
+
+	return false, true
+}
+
+// addAlert records the alert, removing the oldest one if there are too many.
+func (b *sessionBinding) addAlert(alert *sessionAlertJSON) {
+	b.alertsMu.Lock()
+	defer b.alertsMu.Unlock()
+
+	if len(b.alerts) >= maxSessionAlerts {
+		b.alerts = slices.Delete(b.alerts, 0, 1)
+	}
+
+	b.alerts = append(b.alerts, alert)
+}
+
+// recentAlerts returns the recent alerts, the newest first.
+func (b *sessionBinding) recentAlerts() (alerts []*sessionAlertJSON) {
+	b.alertsMu.Lock()
+	defer b.alertsMu.Unlock()
+
+	alerts = slices.Clone(b.alerts)
+	slices.Reverse(alerts)
+
+	return alerts
+}
+
+// handleSessionAlerts is the handler for the GET /control/sessions/alerts HTTP
+// API.
+func handleSessionAlerts(w http.ResponseWriter, r *http.Request) {
+	resp := &sessionAlertsJSON{
+		Alerts: []*sessionAlertJSON{},
+	}
+
+	if Context.auth != nil && Context.auth.binding != nil {
+		resp.Alerts = append(resp.Alerts, Context.auth.binding.recentAlerts()...)
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
@@ -0,0 +1,205 @@
+package home
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testUserAgent is the common User-Agent header for tests.
+const testUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+
+func TestSession_serialize(t *testing.T) {
+	testCases := []struct {
+		sess *session
+		name string
+	}{{
+		sess: &session{
+			userName: "name",
+			expire:   1234,
+		},
+		name: "unbound",
+	}, {
+		sess: &session{
+			userName:  "name",
+			userAgent: userAgentFingerprint(testUserAgent),
+			subnet:    netip.MustParsePrefix("192.0.2.0/24"),
+			expire:    1234,
+		},
+		name: "ipv4",
+	}, {
+		sess: &session{
+			userName:  "name",
+			userAgent: "",
+			subnet:    netip.MustParsePrefix("2001:db8::/56"),
+			expire:    1234,
+		},
+		name: "ipv6",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := &session{}
+			require.True(t, got.deserialize(tc.sess.serialize()))
+
+			assert.Equal(t, tc.sess, got)
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		data := testCases[1].sess.serialize()
+
+		assert.False(t, (&session{}).deserialize(data[:len(data)-1]))
+	})
+}
+
+func TestNewSessionBinding(t *testing.T) {
+	testCases := []struct {
+		conf       *sessionBindingConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &sessionBindingConfig{
+			Mode: sessionBindingModeOff,
+		},
+		name:       "off",
+		wantErrMsg: "",
+	}, {
+		conf: &sessionBindingConfig{
+			Mode:          sessionBindingModeEnforce,
+			IPv4PrefixLen: 24,
+			IPv6PrefixLen: 56,
+		},
+		name:       "enforce",
+		wantErrMsg: "",
+	}, {
+		conf: &sessionBindingConfig{
+			Mode: "strict",
+		},
+		name:       "bad_mode",
+		wantErrMsg: `mode: unsupported value "strict"`,
+	}, {
+		conf: &sessionBindingConfig{
+			Mode:          sessionBindingModeAlert,
+			IPv4PrefixLen: 33,
+		},
+		name:       "bad_ipv4_prefix_len",
+		wantErrMsg: "ipv4_prefix_len: must be from 0 to 32, got 33",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newSessionBinding(tc.conf)
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
+
+func TestAuth_checkSession_binding(t *testing.T) {
+	newAuth := func(t *testing.T, mode sessionBindingMode) (a *Auth) {
+		t.Helper()
+
+		a = InitAuth(
+			filepath.Join(t.TempDir(), "sessions.db"),
+			nil,
+			60,
+			nil,
+			nil,
+			newTestPasswordHashing(t),
+			nil,
+		)
+		require.NotNil(t, a)
+		t.Cleanup(a.Close)
+
+		var err error
+		a.binding, err = newSessionBinding(&sessionBindingConfig{
+			Mode:          mode,
+			IPv4PrefixLen: 24,
+			IPv6PrefixLen: 56,
+		})
+		require.NoError(t, err)
+
+		return a
+	}
+
+	origClient := &sessionClient{
+		userAgent: testUserAgent,
+		addr:      netip.MustParseAddr("192.0.2.1"),
+	}
+
+	sameNetClient := &sessionClient{
+		userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:132.0) Gecko/20100101 Firefox/132.0",
+		addr:      netip.MustParseAddr("192.0.2.2"),
+	}
+
+	otherNetClient := &sessionClient{
+		userAgent: testUserAgent,
+		addr:      netip.MustParseAddr("198.51.100.1"),
+	}
+
+	otherUAClient := &sessionClient{
+		userAgent: "curl/8.0.0",
+		addr:      netip.MustParseAddr("192.0.2.1"),
+	}
+
+	addSession := func(t *testing.T, a *Auth) (sess string) {
+		t.Helper()
+
+		token, err := newSessionToken()
+		require.NoError(t, err)
+
+		s := &session{
+			userName: "name",
+			expire:   uint32(time.Now().Unix()) + 60,
+		}
+		a.binding.bind(s, origClient)
+		a.addSession(token, s)
+
+		return hex.EncodeToString(token)
+	}
+
+	t.Run("alert", func(t *testing.T) {
+		a := newAuth(t, sessionBindingModeAlert)
+		sess := addSession(t, a)
+
+		assert.Equal(t, checkSessionOK, a.checkSession(sess, sameNetClient))
+		assert.Empty(t, a.binding.recentAlerts())
+
+		assert.Equal(t, checkSessionOK, a.checkSession(sess, otherNetClient))
+
+		alerts := a.binding.recentAlerts()
+		require.Len(t, alerts, 1)
+
+		assert.Equal(t, sessionAlertReasonNewNetwork, alerts[0].Reason)
+		assert.Equal(t, "192.0.2.0/24", alerts[0].BoundNetwork)
+		assert.Equal(t, "198.51.100.0/24", alerts[0].Network)
+		assert.False(t, alerts[0].Invalidated)
+
+		// The session is rebound, so the same network isn't reported again.
+		assert.Equal(t, checkSessionOK, a.checkSession(sess, otherNetClient))
+		assert.Len(t, a.binding.recentAlerts(), 1)
+	})
+
+	t.Run("enforce", func(t *testing.T) {
+		a := newAuth(t, sessionBindingModeEnforce)
+		sess := addSession(t, a)
+
+		assert.Equal(t, checkSessionReused, a.checkSession(sess, otherUAClient))
+		assert.Equal(t, checkSessionNotFound, a.checkSession(sess, origClient))
+
+		alerts := a.binding.recentAlerts()
+		require.Len(t, alerts, 1)
+
+		assert.Equal(t, sessionAlertReasonUserAgent, alerts[0].Reason)
+		assert.True(t, alerts[0].Invalidated)
+	})
+}
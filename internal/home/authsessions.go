@@ -0,0 +1,169 @@
+package home
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// sessionIDLen is the length of the identifier of a session in bytes.
+const sessionIDLen = 8
+
+// sessionID returns the identifier of the session with the hex-encoded token.
+// Unlike the token, the identifier can't be used to authenticate, so it's safe
+// to show it in the HTTP API.
+func sessionID(token string) (id string) {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:sessionIDLen])
+}
+
+// sessionJSON is the JSON representation of a session of a user.
+type sessionJSON struct {
+	// Expires is the expiration time of the session.
+	Expires time.Time `json:"expires"`
+
+	// Subnet is the network the session is bound to, if any.
+	Subnet *netip.Prefix `json:"subnet,omitempty"`
+
+	ID   string `json:"id"`
+	User string `json:"user"`
+
+	// Current is true if this is the session of the request.
+	Current bool `json:"current"`
+}
+
+// sessionsJSON is the response to the GET /control/sessions HTTP API.
+type sessionsJSON struct {
+	Sessions []*sessionJSON `json:"sessions"`
+}
+
+// sessionRevokeJSON is the request to the POST /control/sessions/revoke HTTP
+// API.
+type sessionRevokeJSON struct {
+	ID string `json:"id"`
+}
+
+// userSessions returns the sessions of the user with userName, or the sessions
+// of all users if all is true, sorted by user name and expiration time.
+// current is the token of the session of the request, if any.
+func (a *Auth) userSessions(userName string, all bool, current string) (sessions []*sessionJSON) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	sessions = []*sessionJSON{}
+	for token, s := range a.sessions {
+		if !all && s.userName != userName {
+			continue
+		}
+
+		sj := &sessionJSON{
+			Expires: time.Unix(int64(s.expire), 0).UTC(),
+			ID:      sessionID(token),
+			User:    s.userName,
+			Current: token == current,
+		}
+
+		if s.subnet.IsValid() {
+			subnet := s.subnet
+			sj.Subnet = &subnet
+		}
+
+		sessions = append(sessions, sj)
+	}
+
+	slices.SortFunc(sessions, func(x, y *sessionJSON) (res int) {
+		if res = strings.Compare(x.User, y.User); res != 0 {
+			return res
+		}
+
+		return x.Expires.Compare(y.Expires)
+	})
+
+	return sessions
+}
+
+// revokeSession removes the session with id if it belongs to the user with
+// userName or if anyUser is true.  ok is false if there is no such session.
+func (a *Auth) revokeSession(id, userName string, anyUser bool) (ok bool) {
+	var token string
+	func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		for t, s := range a.sessions {
+			if sessionID(t) == id && (anyUser || s.userName == userName) {
+				token = t
+				delete(a.sessions, t)
+
+				break
+			}
+		}
+	}()
+
+	if token == "" {
+		return false
+	}
+
+	key, _ := hex.DecodeString(token)
+	a.removeSessionFromFile(key)
+
+	return true
+}
+
+// sessionUser returns the current user and the token of the session of r, if
+// any.  isAdmin is true if the user may manage the sessions of all users.
+func (a *Auth) sessionUser(r *http.Request) (u webUser, token string, isAdmin bool) {
+	u = a.getCurrentUser(r)
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		token = cookie.Value
+	}
+
+	// Don't consider the sessions of the removed users to be the ones of the
+	// administrators.
+	known := u.Name != "" || !a.authRequired()
+	isAdmin = known && (u.Role == userRoleDefault || u.Role == userRoleAdmin)
+
+	return u, token, isAdmin
+}
+
+// handleGetSessions is the handler for the GET /control/sessions HTTP API.
+// The administrators get the sessions of all users.
+func handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	u, token, isAdmin := Context.auth.sessionUser(r)
+
+	aghhttp.WriteJSONResponseOK(w, r, &sessionsJSON{
+		Sessions: Context.auth.userSessions(u.Name, isAdmin, token),
+	})
+}
+
+// handleRevokeSession is the handler for the POST /control/sessions/revoke
+// HTTP API.  The administrators may revoke the sessions of all users.
+func handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	req := &sessionRevokeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	u, _, isAdmin := Context.auth.sessionUser(r)
+	if !Context.auth.revokeSession(req.ID, u.Name, isAdmin) {
+		writeError(r, w, http.StatusNotFound, "session %q not found", req.ID)
+
+		return
+	}
+
+	log.Info("auth: user %q revoked session %s", u.Name, req.ID)
+
+	aghhttp.OK(w)
+}
@@ -0,0 +1,100 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestSessions returns the sessions visible to the sender of r.
+func getTestSessions(t *testing.T, r *http.Request) (sessions []*sessionJSON) {
+	t.Helper()
+
+	rw := httptest.NewRecorder()
+	handleGetSessions(rw, r)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	resp := &sessionsJSON{}
+	err := json.NewDecoder(rw.Body).Decode(resp)
+	require.NoError(t, err)
+
+	return resp.Sessions
+}
+
+// revokeTestSession sends the request to revoke the session with id on behalf
+// of the sender of r and returns the status code of the response.
+func revokeTestSession(t *testing.T, r *http.Request, id string) (code int) {
+	t.Helper()
+
+	body, err := json.Marshal(&sessionRevokeJSON{ID: id})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/control/sessions/revoke", bytes.NewReader(body))
+	req.Header = r.Header.Clone()
+
+	rw := httptest.NewRecorder()
+	handleRevokeSession(rw, req)
+
+	return rw.Code
+}
+
+func TestAuth_sessions(t *testing.T) {
+	newTestRolesAuth(t)
+
+	adminReq := newTestSessionRequest(t, http.MethodGet, "admin")
+	viewerReq := newTestSessionRequest(t, http.MethodGet, "viewer")
+	viewerOtherReq := newTestSessionRequest(t, http.MethodGet, "viewer")
+
+	viewerSessions := getTestSessions(t, viewerReq)
+	require.Len(t, viewerSessions, 2)
+
+	var current, other *sessionJSON
+	for _, s := range viewerSessions {
+		assert.Equal(t, "viewer", s.User)
+		if s.Current {
+			current = s
+		} else {
+			other = s
+		}
+	}
+
+	require.NotNil(t, current)
+	require.NotNil(t, other)
+
+	adminSessions := getTestSessions(t, adminReq)
+	require.Len(t, adminSessions, 3)
+
+	var adminSessID string
+	for _, s := range adminSessions {
+		if s.User == "admin" {
+			adminSessID = s.ID
+		}
+	}
+
+	require.NotEmpty(t, adminSessID)
+
+	assert.Equal(t, http.StatusNotFound, revokeTestSession(t, viewerReq, adminSessID))
+	assert.Equal(t, http.StatusOK, revokeTestSession(t, viewerReq, other.ID))
+	assert.Len(t, getTestSessions(t, viewerReq), 1)
+
+	assert.Equal(t, http.StatusOK, revokeTestSession(t, adminReq, current.ID))
+	assert.Len(t, getTestSessions(t, adminReq), 1)
+
+	res := Context.auth.checkSession(cookieValue(t, viewerOtherReq), nil)
+	assert.Equal(t, checkSessionNotFound, res)
+}
+
+// cookieValue returns the value of the session cookie of r.
+func cookieValue(t *testing.T, r *http.Request) (val string) {
+	t.Helper()
+
+	cookie, err := r.Cookie(sessionCookieName)
+	require.NoError(t, err)
+
+	return cookie.Value
+}
@@ -0,0 +1,470 @@
+package home
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Parameters of the TOTP codes as defined by RFC 6238.  These are the defaults
+// supported by all authenticator apps.
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+
+	// totpSkew is the number of the time steps before and after the current
+	// one, the codes of which are also accepted to tolerate the clock drift.
+	totpSkew = 1
+
+	// totpSecretSize is the size of a TOTP secret in bytes.
+	totpSecretSize = 20
+
+	// totpIssuer is the issuer shown by the authenticator apps.
+	totpIssuer = "AdGuard Home"
+)
+
+// Parameters of the recovery codes.
+const (
+	// recoveryCodesNum is the number of the recovery codes generated on
+	// enabling two-factor authentication.
+	recoveryCodesNum = 10
+
+	// recoveryCodeSize is the size of a recovery code in bytes.
+	recoveryCodeSize = 5
+)
+
+// Errors of the two-factor authentication.
+const (
+	// errTOTPRequired is returned when the login request of a user with
+	// two-factor authentication enabled doesn't contain a code.
+	errTOTPRequired errors.Error = "totp code required"
+
+	// errTOTPInvalid is returned when the code is invalid or has already been
+	// used.
+	errTOTPInvalid errors.Error = "invalid totp code"
+)
+
+// totpEncoding is the encoding of the TOTP secrets, as expected by the
+// authenticator apps.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a new randomly generated base32-encoded TOTP secret.
+func newTOTPSecret() (secret string, err error) {
+	key := make([]byte, totpSecretSize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return "", fmt.Errorf("generating totp secret: %w", err)
+	}
+
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpURI returns the provisioning URI of the secret for the user with
+// userName, which is usually shown as a QR code.  See
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+func totpURI(userName, secret string) (uri string) {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + userName,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
+
+// hotpCode returns the HOTP code of key for counter as defined by RFC 4226.
+func hotpCode(key []byte, counter uint64) (code string) {
+	mac := hmac.New(sha1.New, key)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fff_ffff
+
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod)
+}
+
+// totpCounter returns the time step of t.
+func totpCounter(t time.Time) (counter uint64) {
+	return uint64(t.Unix()) / uint64(totpPeriod.Seconds())
+}
+
+// checkTOTP returns the time step of code if it's a valid code of secret at
+// now and its time step is after last.  ok is false if the code is invalid or
+// has already been used.
+func checkTOTP(secret, code string, now time.Time, last uint64) (counter uint64, ok bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	cur := totpCounter(now)
+	for c := cur - totpSkew; c <= cur+totpSkew; c++ {
+		if c <= last {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hotpCode(key, c)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
+
+// newRecoveryCodes returns new randomly generated recovery codes and their
+// hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodesNum {
+		b := make([]byte, recoveryCodeSize)
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+
+		code := hex.EncodeToString(b)
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the hash of the recovery code to store.  The codes
+// are random and long enough, so a key derivation function isn't necessary.
+func hashRecoveryCode(code string) (hash string) {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// checkSecondFactor returns true if code is either a valid TOTP code of the
+// user with userName or one of its recovery codes.  The used codes can't be
+// used again.  It also returns true if the user hasn't enabled two-factor
+// authentication.
+func (a *Auth) checkSecondFactor(userName, code string) (ok bool) {
+	usersChanged := false
+	defer func() {
+		if usersChanged && a.onUsersChanged != nil {
+			a.onUsersChanged()
+		}
+	}()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := slices.IndexFunc(a.users, func(u webUser) (found bool) { return u.Name == userName })
+	if i < 0 {
+		return false
+	}
+
+	u := &a.users[i]
+	if u.TOTPSecret == "" {
+		return true
+	}
+
+	counter, ok := checkTOTP(u.TOTPSecret, code, time.Now(), a.totpLastCounters[userName])
+	if ok {
+		a.totpLastCounters[userName] = counter
+
+		return true
+	}
+
+	hash := hashRecoveryCode(code)
+	j := slices.IndexFunc(u.RecoveryCodes, func(h string) (found bool) {
+		return subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1
+	})
+	if j < 0 {
+		return false
+	}
+
+	// Don't modify the slice in place, since it may be shared with the copies
+	// returned by [Auth.usersList].
+	u.RecoveryCodes = slices.Delete(slices.Clone(u.RecoveryCodes), j, j+1)
+	usersChanged = true
+
+	log.Info("auth: user %q used a recovery code, %d left", userName, len(u.RecoveryCodes))
+
+	return true
+}
+
+// hasTOTP returns true if the user with userName has enabled two-factor
+// authentication.  left is the number of the recovery codes left.
+func (a *Auth) hasTOTP(userName string) (ok bool, left int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, u := range a.users {
+		if u.Name == userName {
+			return u.TOTPSecret != "", len(u.RecoveryCodes)
+		}
+	}
+
+	return false, 0
+}
+
+// beginTOTP generates and remembers a new TOTP secret for the user with
+// userName, which is only enabled after it's confirmed with a valid code.
+func (a *Auth) beginTOTP(userName string) (secret string, err error) {
+	if ok, _ := a.hasTOTP(userName); ok {
+		return "", errors.Error("totp is already enabled")
+	}
+
+	secret, err = newTOTPSecret()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.totpPending[userName] = secret
+
+	return secret, nil
+}
+
+// finishTOTP enables two-factor authentication for the user with userName if
+// code is valid for the secret generated by [Auth.beginTOTP].  It returns the
+// new recovery codes of the user.
+func (a *Auth) finishTOTP(userName, code string) (recoveryCodes []string, err error) {
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	secret, ok := a.totpPending[userName]
+	if !ok {
+		return nil, errors.Error("totp enrollment not started")
+	}
+
+	counter, ok := checkTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, errTOTPInvalid
+	}
+
+	i := slices.IndexFunc(a.users, func(u webUser) (found bool) { return u.Name == userName })
+	if i < 0 {
+		return nil, errors.Error("unknown user")
+	}
+
+	a.users[i].TOTPSecret = secret
+	a.users[i].RecoveryCodes = hashes
+	a.totpLastCounters[userName] = counter
+	delete(a.totpPending, userName)
+
+	return recoveryCodes, nil
+}
+
+// disableTOTP disables two-factor authentication for the user with userName.
+func (a *Auth) disableTOTP(userName string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for i, u := range a.users {
+		if u.Name == userName {
+			a.users[i].TOTPSecret = ""
+			a.users[i].RecoveryCodes = nil
+		}
+	}
+
+	delete(a.totpLastCounters, userName)
+}
+
+// removeUserSessions removes all sessions of the user with userName except
+// the one with the hex-encoded token keep.
+func (a *Auth) removeUserSessions(userName, keep string) {
+	var tokens []string
+	func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		for token, s := range a.sessions {
+			if s.userName == userName && token != keep {
+				tokens = append(tokens, token)
+				delete(a.sessions, token)
+			}
+		}
+	}()
+
+	for _, token := range tokens {
+		key, _ := hex.DecodeString(token)
+		a.removeSessionFromFile(key)
+	}
+
+	log.Debug("auth: removed %d sessions of user %q", len(tokens), userName)
+}
+
+// totpCodeJSON is the request to the POST /control/totp/confirm and
+// /control/totp/disable HTTP APIs.
+type totpCodeJSON struct {
+	Code string `json:"code"`
+}
+
+// totpEnrollJSON is the response to the POST /control/totp/enroll HTTP API.
+type totpEnrollJSON struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// totpConfirmJSON is the response to the POST /control/totp/confirm HTTP API.
+type totpConfirmJSON struct {
+	// RecoveryCodes are shown only once, since only their hashes are stored.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// totpStatusJSON is the response to the GET /control/totp/status HTTP API.
+type totpStatusJSON struct {
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+	Enabled           bool `json:"enabled"`
+}
+
+// handleTOTPStatus is the handler for the GET /control/totp/status HTTP API.
+func handleTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	enabled, left := Context.auth.hasTOTP(userName)
+	aghhttp.WriteJSONResponseOK(w, r, &totpStatusJSON{
+		RecoveryCodesLeft: left,
+		Enabled:           enabled,
+	})
+}
+
+// handleTOTPEnroll is the handler for the POST /control/totp/enroll HTTP API.
+func handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	secret, err := Context.auth.beginTOTP(userName)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &totpEnrollJSON{
+		Secret: secret,
+		URI:    totpURI(userName, secret),
+	})
+}
+
+// handleTOTPConfirm is the handler for the POST /control/totp/confirm HTTP
+// API.  It invalidates the other sessions of the user.
+func handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	codes, err := Context.auth.finishTOTP(userName, strings.TrimSpace(req.Code))
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	onTOTPChanged(r, userName)
+
+	log.Info("auth: user %q enabled two-factor authentication", userName)
+
+	aghhttp.WriteJSONResponseOK(w, r, &totpConfirmJSON{
+		RecoveryCodes: codes,
+	})
+}
+
+// handleTOTPDisable is the handler for the POST /control/totp/disable HTTP
+// API.  It invalidates the other sessions of the user.
+func handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	if ok, _ := Context.auth.hasTOTP(userName); !ok {
+		writeError(r, w, http.StatusBadRequest, "totp is not enabled")
+
+		return
+	}
+
+	if !Context.auth.checkSecondFactor(userName, strings.TrimSpace(req.Code)) {
+		writeError(r, w, http.StatusBadRequest, "%s", errTOTPInvalid)
+
+		return
+	}
+
+	Context.auth.disableTOTP(userName)
+	onTOTPChanged(r, userName)
+
+	log.Info("auth: user %q disabled two-factor authentication", userName)
+
+	aghhttp.OK(w)
+}
+
+// onTOTPChanged removes the sessions of the user with userName except the one
+// of r and saves the users.
+func onTOTPChanged(r *http.Request, userName string) {
+	var keep string
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		keep = cookie.Value
+	}
+
+	Context.auth.removeUserSessions(userName, keep)
+
+	if Context.auth.onUsersChanged != nil {
+		Context.auth.onUsersChanged()
+	}
+}
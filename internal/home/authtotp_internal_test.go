@@ -0,0 +1,153 @@
+package home
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTOTPKey is the key of the test vectors from RFC 4226 and RFC 6238.
+const testTOTPKey = "12345678901234567890"
+
+func TestHOTPCode(t *testing.T) {
+	// See RFC 4226, Appendix D.
+	want := []string{
+		"755224",
+		"287082",
+		"359152",
+		"969429",
+		"338314",
+		"254676",
+		"287922",
+		"162583",
+		"399871",
+		"520489",
+	}
+
+	for counter, code := range want {
+		assert.Equal(t, code, hotpCode([]byte(testTOTPKey), uint64(counter)))
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte(testTOTPKey))
+
+	// See RFC 6238, Appendix B, with the last six digits of the codes.
+	now := time.Unix(1111111109, 0)
+
+	counter, ok := checkTOTP(secret, "081804", now, 0)
+	require.True(t, ok)
+
+	assert.Equal(t, totpCounter(now), counter)
+
+	_, ok = checkTOTP(secret, "081804", now, counter)
+	assert.False(t, ok)
+
+	_, ok = checkTOTP(secret, "081804", now.Add(10*totpPeriod), 0)
+	assert.False(t, ok)
+
+	_, ok = checkTOTP(secret, "000000", now, 0)
+	assert.False(t, ok)
+
+	_, ok = checkTOTP("bad secret", "081804", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("user", "SECRET")
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/AdGuard Home:user", u.Path)
+	assert.Equal(t, "SECRET", u.Query().Get("secret"))
+	assert.Equal(t, totpIssuer, u.Query().Get("issuer"))
+}
+
+// testTOTPCode returns the TOTP code of secret at t.
+func testTOTPCode(t *testing.T, secret string, at time.Time) (code string) {
+	t.Helper()
+
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+
+	return hotpCode(key, totpCounter(at))
+}
+
+func TestAuth_totp(t *testing.T) {
+	const (
+		userName = "user"
+		password = "password"
+	)
+
+	newTestRolesAuth(t)
+	a := Context.auth
+
+	usersChanged := 0
+	a.onUsersChanged = func() { usersChanged++ }
+
+	require.NoError(t, a.addUser(&webUser{Name: userName}, password))
+
+	otherReq := newTestSessionRequest(t, http.MethodGet, userName)
+
+	secret, err := a.beginTOTP(userName)
+	require.NoError(t, err)
+
+	_, err = a.finishTOTP(userName, "000000")
+	require.ErrorIs(t, err, errTOTPInvalid)
+
+	now := time.Now()
+	codes, err := a.finishTOTP(userName, testTOTPCode(t, secret, now))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodesNum)
+
+	onTOTPChanged(newTestSessionRequest(t, http.MethodGet, "admin"), userName)
+	assert.Equal(t, 1, usersChanged)
+	assert.Equal(t, checkSessionNotFound, a.checkSession(cookieValue(t, otherReq), nil))
+
+	enabled, left := a.hasTOTP(userName)
+	assert.True(t, enabled)
+	assert.Equal(t, recoveryCodesNum, left)
+
+	_, err = a.beginTOTP(userName)
+	assert.Error(t, err)
+
+	req := loginJSON{Name: userName, Password: password}
+	_, err = a.newCookie(req, "", nil)
+	assert.ErrorIs(t, err, errTOTPRequired)
+
+	// The code used for the confirmation can't be used again.
+	req.TOTP = testTOTPCode(t, secret, now)
+	_, err = a.newCookie(req, "", nil)
+	assert.ErrorIs(t, err, errTOTPInvalid)
+
+	req.TOTP = testTOTPCode(t, secret, now.Add(totpPeriod))
+	c, err := a.newCookie(req, "", nil)
+	require.NoError(t, err)
+
+	assert.NotNil(t, c)
+
+	req.TOTP = codes[0]
+	_, err = a.newCookie(req, "", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, usersChanged)
+
+	_, err = a.newCookie(req, "", nil)
+	assert.ErrorIs(t, err, errTOTPInvalid)
+
+	_, left = a.hasTOTP(userName)
+	assert.Equal(t, recoveryCodesNum-1, left)
+
+	a.disableTOTP(userName)
+
+	req.TOTP = ""
+	_, err = a.newCookie(req, "", nil)
+	assert.NoError(t, err)
+}
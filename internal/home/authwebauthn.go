@@ -0,0 +1,611 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+)
+
+// passwordFallback is the policy of logging in with a password when WebAuthn
+// is enabled.
+type passwordFallback string
+
+// passwordFallback values.
+const (
+	// passwordFallbackAlways means that the users may always log in with
+	// their passwords.
+	passwordFallbackAlways passwordFallback = "always"
+
+	// passwordFallbackWithoutKeys means that only the users without any
+	// registered security keys may log in with their passwords.
+	passwordFallbackWithoutKeys passwordFallback = "without_keys"
+)
+
+// webAuthnConfig is the configuration of the passwordless login with the
+// security keys and platform authenticators.
+type webAuthnConfig struct {
+	// RPID is the relying party identifier, which is the domain name of the
+	// web interface, for example "dns.example.com".
+	RPID string `yaml:"rp_id"`
+
+	// UserVerification is the requirement on verifying the user by the
+	// authenticator, either "required", "preferred", or "discouraged".
+	UserVerification webauthn.UserVerification `yaml:"user_verification"`
+
+	// PasswordFallback is the policy of logging in with a password.
+	PasswordFallback passwordFallback `yaml:"password_fallback"`
+
+	// Origins are the allowed origins of the web interface, for example
+	// "https://dns.example.com:3000".
+	Origins []string `yaml:"origins"`
+
+	// Enabled defines if the WebAuthn login is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// webAuthnAuth is the WebAuthn part of [Auth].
+type webAuthnAuth struct {
+	// rp performs the ceremonies.
+	rp *webauthn.RelyingParty
+
+	// fallback is the policy of logging in with a password.
+	fallback passwordFallback
+}
+
+// webAuthnBucketName is the name of the bbolt bucket with the registered
+// WebAuthn credentials.  The keys are the credential identifiers and the
+// values are the JSON-encoded [webauthn.Credential].
+const webAuthnBucketName = "webauthn-credentials"
+
+// initWebAuthn initializes the WebAuthn login if it's enabled in conf.
+func (a *Auth) initWebAuthn(conf *webAuthnConfig) (err error) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	switch conf.PasswordFallback {
+	case passwordFallbackAlways, passwordFallbackWithoutKeys:
+		// Go on.
+	default:
+		return fmt.Errorf("password_fallback: unsupported value %q", conf.PasswordFallback)
+	}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:             conf.RPID,
+		RPName:           "AdGuard Home",
+		Origins:          conf.Origins,
+		UserVerification: conf.UserVerification,
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	a.webAuthn = &webAuthnAuth{
+		rp:       rp,
+		fallback: conf.PasswordFallback,
+	}
+
+	return nil
+}
+
+// passwordAllowed returns true if the user may log in with a password
+// according to the password fallback policy.
+func (a *Auth) passwordAllowed(userName string) (ok bool) {
+	if a.webAuthn == nil || a.webAuthn.fallback != passwordFallbackWithoutKeys {
+		return true
+	}
+
+	creds, err := a.credentials(userName)
+	if err != nil {
+		log.Error("auth: webauthn: getting credentials of user %q: %s", userName, err)
+
+		// Don't let the users with broken storage lock themselves out.
+		return true
+	}
+
+	return len(creds) == 0
+}
+
+// credentials returns the WebAuthn credentials of the user.
+func (a *Auth) credentials(userName string) (creds []*webauthn.Credential, err error) {
+	creds = []*webauthn.Credential{}
+	err = a.db.View(func(tx *bbolt.Tx) (viewErr error) {
+		bkt := tx.Bucket([]byte(webAuthnBucketName))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(_, v []byte) (decErr error) {
+			c := &webauthn.Credential{}
+			decErr = json.Unmarshal(v, c)
+			if decErr != nil {
+				return fmt.Errorf("decoding credential: %w", decErr)
+			}
+
+			if c.UserName == userName {
+				creds = append(creds, c)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+// findCredential returns the WebAuthn credential with the identifier.
+func (a *Auth) findCredential(id []byte) (c *webauthn.Credential, ok bool) {
+	err := a.db.View(func(tx *bbolt.Tx) (viewErr error) {
+		bkt := tx.Bucket([]byte(webAuthnBucketName))
+		if bkt == nil {
+			return nil
+		}
+
+		v := bkt.Get(id)
+		if v == nil {
+			return nil
+		}
+
+		c = &webauthn.Credential{}
+
+		return json.Unmarshal(v, c)
+	})
+	if err != nil {
+		log.Error("auth: webauthn: reading credential: %s", err)
+
+		return nil, false
+	}
+
+	return c, c != nil
+}
+
+// storeCredential adds or replaces the WebAuthn credential.
+func (a *Auth) storeCredential(c *webauthn.Credential) (err error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("encoding credential: %w", err)
+	}
+
+	err = a.db.Update(func(tx *bbolt.Tx) (updErr error) {
+		bkt, updErr := tx.CreateBucketIfNotExists([]byte(webAuthnBucketName))
+		if updErr != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return updErr
+		}
+
+		return bkt.Put(c.ID, data)
+	})
+	if err != nil {
+		return fmt.Errorf("storing credential: %w", err)
+	}
+
+	return nil
+}
+
+// removeCredential removes the WebAuthn credential of the user with the
+// identifier.  ok is false if there is no such credential.
+func (a *Auth) removeCredential(userName string, id []byte) (ok bool, err error) {
+	err = a.db.Update(func(tx *bbolt.Tx) (updErr error) {
+		bkt := tx.Bucket([]byte(webAuthnBucketName))
+		if bkt == nil {
+			return nil
+		}
+
+		v := bkt.Get(id)
+		if v == nil {
+			return nil
+		}
+
+		c := &webauthn.Credential{}
+		updErr = json.Unmarshal(v, c)
+		if updErr != nil {
+			return fmt.Errorf("decoding credential: %w", updErr)
+		} else if c.UserName != userName {
+			return nil
+		}
+
+		ok = true
+
+		return bkt.Delete(id)
+	})
+	if err != nil {
+		return false, fmt.Errorf("removing credential: %w", err)
+	}
+
+	return ok, nil
+}
+
+// userExists returns true if there is a user with the name.
+func (a *Auth) userExists(userName string) (ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return slices.ContainsFunc(a.users, func(u webUser) (found bool) {
+		return u.Name == userName
+	})
+}
+
+// webAuthnCredentialJSON is the JSON representation of a registered WebAuthn
+// credential.
+type webAuthnCredentialJSON struct {
+	// Created is the time when the credential has been registered, in the
+	// RFC 3339 format.
+	Created string `json:"created"`
+
+	// Name is the human-readable name of the credential.
+	Name string `json:"name"`
+
+	// ID is the identifier of the credential.
+	ID webauthn.Base64URL `json:"id"`
+}
+
+// webAuthnCredentialsJSON is the JSON representation of the WebAuthn
+// credentials of the current user.
+type webAuthnCredentialsJSON struct {
+	Credentials []*webAuthnCredentialJSON `json:"credentials"`
+}
+
+// webAuthnRegisterJSON is the JSON structure for finishing the registration of
+// a WebAuthn credential.
+type webAuthnRegisterJSON struct {
+	// Credential is the response of the authenticator.
+	Credential *webauthn.RegistrationResponse `json:"credential"`
+
+	// Name is the human-readable name of the credential.
+	Name string `json:"name"`
+}
+
+// webAuthnLoginBeginJSON is the JSON structure for starting the WebAuthn
+// login.
+type webAuthnLoginBeginJSON struct {
+	// Name is the name of the user.  If empty, the authenticator is asked for
+	// a discoverable credential.
+	Name string `json:"name"`
+}
+
+// webAuthnDeleteJSON is the JSON structure for removing a WebAuthn credential.
+type webAuthnDeleteJSON struct {
+	ID webauthn.Base64URL `json:"id"`
+}
+
+// maxCredentialNameLen is the maximum length of the name of a WebAuthn
+// credential.
+const maxCredentialNameLen = 64
+
+// webAuthnEnabled writes an error response and returns false if the WebAuthn
+// login is disabled.
+func webAuthnEnabled(w http.ResponseWriter, r *http.Request) (ok bool) {
+	if Context.auth == nil || Context.auth.webAuthn == nil {
+		writeError(r, w, http.StatusNotFound, "webauthn is disabled")
+
+		return false
+	}
+
+	return true
+}
+
+// currentUserName writes an error response and returns an empty string if
+// there is no authenticated user.
+func currentUserName(w http.ResponseWriter, r *http.Request) (userName string) {
+	userName = Context.auth.getCurrentUser(r).Name
+	if userName == "" {
+		writeError(r, w, http.StatusForbidden, "no authenticated user")
+	}
+
+	return userName
+}
+
+// handleWebAuthnRegisterBegin is the handler for the
+// POST /control/webauthn/register/begin HTTP API.
+func handleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	creds, err := Context.auth.credentials(userName)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	opts, err := Context.auth.webAuthn.rp.BeginRegistration(userName, creds)
+	if err != nil {
+		writeError(r, w, http.StatusServiceUnavailable, "%s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, opts)
+}
+
+// handleWebAuthnRegisterFinish is the handler for the
+// POST /control/webauthn/register/finish HTTP API.
+func handleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	req := &webAuthnRegisterJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	if l := len(req.Name); l == 0 || l > maxCredentialNameLen {
+		writeError(
+			r,
+			w,
+			http.StatusBadRequest,
+			"name: must be from 1 to %d bytes long, got %d",
+			maxCredentialNameLen,
+			l,
+		)
+
+		return
+	}
+
+	cred, err := Context.auth.webAuthn.rp.FinishRegistration(req.Credential)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "registering credential: %s", err)
+
+		return
+	} else if cred.UserName != userName {
+		writeError(r, w, http.StatusForbidden, "registration started by another user")
+
+		return
+	}
+
+	if _, ok := Context.auth.findCredential(cred.ID); ok {
+		writeError(r, w, http.StatusBadRequest, "credential is already registered")
+
+		return
+	}
+
+	cred.Name = req.Name
+	err = Context.auth.storeCredential(cred)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	log.Info("auth: webauthn: user %q registered credential %q", userName, cred.Name)
+
+	aghhttp.OK(w)
+}
+
+// handleWebAuthnCredentials is the handler for the
+// GET /control/webauthn/credentials HTTP API.
+func handleWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	creds, err := Context.auth.credentials(userName)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	resp := &webAuthnCredentialsJSON{
+		Credentials: make([]*webAuthnCredentialJSON, 0, len(creds)),
+	}
+
+	for _, c := range creds {
+		resp.Credentials = append(resp.Credentials, &webAuthnCredentialJSON{
+			Created: c.Created.Format(time.RFC3339),
+			Name:    c.Name,
+			ID:      c.ID,
+		})
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleWebAuthnCredentialsDelete is the handler for the
+// POST /control/webauthn/credentials/delete HTTP API.
+func handleWebAuthnCredentialsDelete(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	userName := currentUserName(w, r)
+	if userName == "" {
+		return
+	}
+
+	req := &webAuthnDeleteJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	ok, err := Context.auth.removeCredential(userName, req.ID)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	} else if !ok {
+		writeError(r, w, http.StatusNotFound, "credential not found")
+
+		return
+	}
+
+	log.Info("auth: webauthn: user %q removed a credential", userName)
+
+	aghhttp.OK(w)
+}
+
+// handleWebAuthnLoginBegin is the handler for the
+// POST /control/webauthn/login/begin HTTP API.
+func handleWebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	req := &webAuthnLoginBeginJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	// The endpoint requires no authentication, so count each started ceremony
+	// as a login attempt to limit both the brute-force and the flood of the
+	// pending ceremonies.
+	remoteIP, ok := checkLoginAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	if rateLimiter := Context.auth.rateLimiter; rateLimiter != nil {
+		rateLimiter.inc(remoteIP)
+	}
+
+	// Don't reveal if the user exists, just return the options with no
+	// allowed credentials.
+	var creds []*webauthn.Credential
+	if req.Name != "" {
+		creds, err = Context.auth.credentials(req.Name)
+		if err != nil {
+			writeError(r, w, http.StatusInternalServerError, "%s", err)
+
+			return
+		}
+	}
+
+	opts, err := Context.auth.webAuthn.rp.BeginLogin(req.Name, creds)
+	if err != nil {
+		writeError(r, w, http.StatusServiceUnavailable, "%s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, opts)
+}
+
+// handleWebAuthnLoginFinish is the handler for the
+// POST /control/webauthn/login/finish HTTP API.
+func handleWebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if !webAuthnEnabled(w, r) {
+		return
+	}
+
+	resp := &webauthn.AuthenticationResponse{}
+	err := json.NewDecoder(r.Body).Decode(resp)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	remoteIP, ok := checkLoginAllowed(w, r)
+	if !ok {
+		return
+	}
+
+	client := Context.auth.newSessionClient(r)
+	cookie, userName, err := Context.auth.webAuthnLogin(resp, remoteIP, client)
+	if err != nil {
+		writeErrorWithIP(r, w, http.StatusForbidden, remoteIP, "%s", err)
+
+		return
+	}
+
+	log.Info("auth: user %q successfully logged in with webauthn from ip %s", userName, remoteIP)
+
+	writeSessionCookie(w, cookie)
+}
+
+// webAuthnLogin verifies the WebAuthn authentication response and creates a
+// new session for the user owning the credential.  addr is the address used by
+// the rate limiter.  The failed attempts aren't counted here, since each of
+// them has already been counted when the ceremony began, see
+// [handleWebAuthnLoginBegin].
+func (a *Auth) webAuthnLogin(
+	resp *webauthn.AuthenticationResponse,
+	addr string,
+	client *sessionClient,
+) (c *http.Cookie, userName string, err error) {
+	cred, err := a.webAuthn.rp.FinishLogin(resp, a.findCredential)
+	if err == nil && !a.userExists(cred.UserName) {
+		err = errors.Error("credential: unknown user")
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("webauthn login: %w", err)
+	}
+
+	if a.rateLimiter != nil {
+		a.rateLimiter.remove(addr)
+	}
+
+	err = a.storeCredential(cred)
+	if err != nil {
+		// Don't fail the login, since the signature is valid.
+		log.Error("auth: webauthn: updating sign count: %s", err)
+	}
+
+	c, err = a.newSessionCookie(cred.UserName, client)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, "", err
+	}
+
+	return c, cred.UserName, nil
+}
+
+// registerWebAuthnHandlers registers the HTTP handlers of the WebAuthn login.
+func registerWebAuthnHandlers() {
+	Context.mux.Handle(
+		"/control/webauthn/login/begin",
+		postInstallHandler(ensureHandler(http.MethodPost, handleWebAuthnLoginBegin)),
+	)
+	Context.mux.Handle(
+		"/control/webauthn/login/finish",
+		postInstallHandler(ensureHandler(http.MethodPost, handleWebAuthnLoginFinish)),
+	)
+
+	httpRegister(http.MethodPost, "/control/webauthn/register/begin", handleWebAuthnRegisterBegin)
+	httpRegister(http.MethodPost, "/control/webauthn/register/finish", handleWebAuthnRegisterFinish)
+	httpRegister(http.MethodGet, "/control/webauthn/credentials", handleWebAuthnCredentials)
+	httpRegister(
+		http.MethodPost,
+		"/control/webauthn/credentials/delete",
+		handleWebAuthnCredentialsDelete,
+	)
+}
@@ -0,0 +1,105 @@
+package home
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_webAuthnCredentials(t *testing.T) {
+	users := []webUser{{
+		Name:         "name",
+		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}}
+
+	a := InitAuth(
+		filepath.Join(t.TempDir(), "sessions.db"),
+		users,
+		60,
+		nil,
+		nil,
+		newTestPasswordHashing(t),
+		nil,
+	)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	err := a.initWebAuthn(&webAuthnConfig{
+		RPID:             "dns.example",
+		PasswordFallback: passwordFallbackWithoutKeys,
+		Origins:          []string{"https://dns.example"},
+		Enabled:          true,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, a.passwordAllowed("name"))
+
+	cred := &webauthn.Credential{
+		Created:   time.Unix(0, 0).UTC(),
+		UserName:  "name",
+		Name:      "key",
+		ID:        webauthn.Base64URL{1, 2, 3},
+		PublicKey: webauthn.Base64URL{4, 5, 6},
+	}
+
+	err = a.storeCredential(cred)
+	require.NoError(t, err)
+
+	got, ok := a.findCredential(cred.ID)
+	require.True(t, ok)
+
+	assert.Equal(t, cred, got)
+	assert.False(t, a.passwordAllowed("name"))
+
+	_, ok = a.findUser("name", "password")
+	assert.False(t, ok)
+
+	creds, err := a.credentials("other")
+	require.NoError(t, err)
+
+	assert.Empty(t, creds)
+
+	ok, err = a.removeCredential("other", cred.ID)
+	require.NoError(t, err)
+
+	assert.False(t, ok)
+
+	ok, err = a.removeCredential("name", cred.ID)
+	require.NoError(t, err)
+
+	assert.True(t, ok)
+	assert.True(t, a.passwordAllowed("name"))
+
+	_, ok = a.findUser("name", "password")
+	assert.True(t, ok)
+}
+
+func TestAuth_initWebAuthn(t *testing.T) {
+	a := &Auth{}
+
+	err := a.initWebAuthn(&webAuthnConfig{
+		PasswordFallback: passwordFallbackAlways,
+		Enabled:          false,
+	})
+	require.NoError(t, err)
+
+	assert.Nil(t, a.webAuthn)
+
+	err = a.initWebAuthn(&webAuthnConfig{
+		RPID:             "dns.example",
+		PasswordFallback: "never",
+		Origins:          []string{"https://dns.example"},
+		Enabled:          true,
+	})
+	assert.EqualError(t, err, `password_fallback: unsupported value "never"`)
+
+	err = a.initWebAuthn(&webAuthnConfig{
+		PasswordFallback: passwordFallbackAlways,
+		Enabled:          true,
+	})
+	assert.EqualError(t, err, "rp id: empty value")
+}
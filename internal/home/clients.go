@@ -44,6 +44,10 @@ type clientsContainer struct {
 	// more detail.  Use sync.RWMutex.
 	lock sync.Mutex
 
+	// templates are the settings of the clients imported in bulk by the names of
+	// the templates.  It's not modified after initialization.
+	templates map[string]*clientObject
+
 	// safeSearchCacheSize is the size of the safe search cache to use for
 	// persistent clients.
 	safeSearchCacheSize uint
@@ -71,6 +75,7 @@ func (clients *clientsContainer) Init(
 	ctx context.Context,
 	baseLogger *slog.Logger,
 	objects []*clientObject,
+	templates []*clientObject,
 	dhcpServer client.DHCP,
 	etcHosts *aghnet.HostsContainer,
 	arpDB arpdb.Interface,
@@ -96,6 +101,11 @@ func (clients *clientsContainer) Init(
 		confClients = append(confClients, p)
 	}
 
+	clients.templates, err = newClientTemplates(templates)
+	if err != nil {
+		return fmt.Errorf("init client templates: %w", err)
+	}
+
 	// The clients.etcHosts may be nil even if config.Clients.Sources.HostsFile
 	// is true, because of the deprecated option --no-etc-hosts.
 	//
@@ -110,6 +120,8 @@ func (clients *clientsContainer) Init(
 	clients.storage, err = client.NewStorage(ctx, &client.StorageConfig{
 		Logger:                 baseLogger.With(slogutil.KeyPrefix, "client_storage"),
 		InitialClients:         confClients,
+		CustomTags:             config.Clients.CustomTags,
+		TagRules:               tagRulesFromObjects(config.Clients.TagRules),
 		DHCP:                   dhcpServer,
 		EtcHosts:               hosts,
 		ARPDB:                  arpDB,
@@ -150,12 +162,43 @@ type clientObject struct {
 	// BlockedServices is the configuration of blocked services of a client.
 	BlockedServices *filtering.BlockedServices `yaml:"blocked_services"`
 
+	// PauseSchedule is the schedule of pausing the internet access of the
+	// client.
+	PauseSchedule *schedule.Weekly `yaml:"pause_schedule,omitempty"`
+
+	// ServiceSchedules are the schedules of switching the client to other
+	// profiles of blocked services.
+	ServiceSchedules []*client.ServiceSchedule `yaml:"service_schedules,omitempty"`
+
 	Name string `yaml:"name"`
 
 	IDs       []string `yaml:"ids"`
 	Tags      []string `yaml:"tags"`
 	Upstreams []string `yaml:"upstreams"`
 
+	// Group is the name of the group of the client.
+	Group string `yaml:"group,omitempty"`
+
+	// BootstrapDNS are the bootstrap DNS servers resolving the hostnames of
+	// Upstreams.  If empty, the global ones are used.
+	BootstrapDNS []string `yaml:"bootstrap_dns,omitempty"`
+
+	// UpstreamMode is the way the requests are distributed among Upstreams.  If
+	// empty, the global upstream mode is used.
+	UpstreamMode client.UpstreamMode `yaml:"upstream_mode,omitempty"`
+
+	// PauseAllowlist are the domain names which are still resolved for the
+	// client while its internet access is paused.
+	PauseAllowlist []string `yaml:"pause_allowlist,omitempty"`
+
+	// DNS64Exclusions are the domain names for which AAAA records are never
+	// synthesized by DNS64 for the client.
+	DNS64Exclusions []string `yaml:"dns64_exclusions,omitempty"`
+
+	// DNS64Prefix is the NAT64 prefix used to synthesize AAAA records by DNS64
+	// for the client.  If empty, the global one is used.
+	DNS64Prefix netip.Prefix `yaml:"dns64_prefix,omitempty"`
+
 	// UID is the unique identifier of the persistent client.
 	UID client.UID `yaml:"uid"`
 
@@ -175,6 +218,15 @@ type clientObject struct {
 
 	IgnoreQueryLog   bool `yaml:"ignore_querylog"`
 	IgnoreStatistics bool `yaml:"ignore_statistics"`
+
+	// DNSSEC defines whether DNSSEC is enabled for the client.
+	DNSSEC client.DNSSECMode `yaml:"dnssec,omitempty"`
+
+	// Paused specifies whether the internet access of the client is paused.
+	Paused bool `yaml:"paused"`
+
+	// BlockQUIC specifies whether the client is prevented from using QUIC.
+	BlockQUIC bool `yaml:"block_quic"`
 }
 
 // toPersistent returns an initialized persistent client if there are no errors.
@@ -185,9 +237,13 @@ func (o *clientObject) toPersistent(
 	safeSearchCacheTTL time.Duration,
 ) (cli *client.Persistent, err error) {
 	cli = &client.Persistent{
-		Name: o.Name,
+		Name:  o.Name,
+		Group: o.Group,
 
-		Upstreams: o.Upstreams,
+		Upstreams:    o.Upstreams,
+		BootstrapDNS: o.BootstrapDNS,
+		UpstreamMode: o.UpstreamMode,
+		DNS64Prefix:  o.DNS64Prefix,
 
 		UID: o.UID,
 
@@ -199,6 +255,9 @@ func (o *clientObject) toPersistent(
 		UseOwnBlockedServices: !o.UseGlobalBlockedServices,
 		IgnoreQueryLog:        o.IgnoreQueryLog,
 		IgnoreStatistics:      o.IgnoreStatistics,
+		Paused:                o.Paused,
+		BlockQUIC:             o.BlockQUIC,
+		DNSSEC:                o.DNSSEC,
 		UpstreamsCacheEnabled: o.UpstreamsCacheEnabled,
 		UpstreamsCacheSize:    o.UpstreamsCacheSize,
 	}
@@ -248,7 +307,17 @@ func (o *clientObject) toPersistent(
 
 	cli.BlockedServices = o.BlockedServices.Clone()
 
+	err = validateScheduleServices(o.ServiceSchedules)
+	if err != nil {
+		return nil, fmt.Errorf("init service schedules %q: %w", cli.Name, err)
+	}
+
+	cli.ServiceSchedules = client.CloneServiceSchedules(o.ServiceSchedules)
+
 	cli.Tags = slices.Clone(o.Tags)
+	cli.PauseSchedule = o.PauseSchedule.Clone()
+	cli.PauseAllowlist = slices.Clone(o.PauseAllowlist)
+	cli.DNS64Exclusions = slices.Clone(o.DNS64Exclusions)
 
 	return cli, nil
 }
@@ -265,10 +334,20 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			Name: cli.Name,
 
 			BlockedServices: cli.BlockedServices.Clone(),
+			PauseSchedule:   cli.PauseSchedule.Clone(),
+
+			ServiceSchedules: client.CloneServiceSchedules(cli.ServiceSchedules),
 
-			IDs:       cli.IDs(),
-			Tags:      slices.Clone(cli.Tags),
-			Upstreams: slices.Clone(cli.Upstreams),
+			IDs:            cli.IDs(),
+			Tags:           slices.Clone(cli.Tags),
+			Group:          cli.Group,
+			Upstreams:      slices.Clone(cli.Upstreams),
+			BootstrapDNS:   slices.Clone(cli.BootstrapDNS),
+			UpstreamMode:   cli.UpstreamMode,
+			PauseAllowlist: slices.Clone(cli.PauseAllowlist),
+
+			DNS64Exclusions: slices.Clone(cli.DNS64Exclusions),
+			DNS64Prefix:     cli.DNS64Prefix,
 
 			UID: cli.UID,
 
@@ -280,6 +359,9 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			UseGlobalBlockedServices: !cli.UseOwnBlockedServices,
 			IgnoreQueryLog:           cli.IgnoreQueryLog,
 			IgnoreStatistics:         cli.IgnoreStatistics,
+			Paused:                   cli.Paused,
+			BlockQUIC:                cli.BlockQUIC,
+			DNSSEC:                   cli.DNSSEC,
 			UpstreamsCacheEnabled:    cli.UpstreamsCacheEnabled,
 			UpstreamsCacheSize:       cli.UpstreamsCacheSize,
 		})
@@ -290,6 +372,42 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	return objs
 }
 
+// prepareReload returns the validated set of persistent clients from objects,
+// which are usually read anew from the configuration file, to replace all
+// currently known persistent clients with, see [clientsContainer.applyReload].
+// The currently known clients aren't changed.
+func (clients *clientsContainer) prepareReload(
+	ctx context.Context,
+	objects []*clientObject,
+) (set *client.PersistentSet, err error) {
+	persistent := make([]*client.Persistent, 0, len(objects))
+	for i, o := range objects {
+		var p *client.Persistent
+		p, err = o.toPersistent(
+			ctx,
+			clients.baseLogger,
+			clients.safeSearchCacheSize,
+			clients.safeSearchCacheTTL,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("persistent client at index %d: %w", i, err)
+		}
+
+		persistent = append(persistent, p)
+	}
+
+	return clients.storage.NewPersistentSet(ctx, persistent)
+}
+
+// applyReload replaces all currently known persistent clients with the ones
+// from set, see [clientsContainer.prepareReload].
+func (clients *clientsContainer) applyReload(ctx context.Context, set *client.PersistentSet) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	clients.storage.ReplacePersistent(ctx, set)
+}
+
 // arpClientsUpdatePeriod defines how often ARP clients are updated.
 const arpClientsUpdatePeriod = 10 * time.Minute
 
@@ -395,19 +513,38 @@ func (clients *clientsContainer) UpstreamConfigByID(
 		return nil, nil
 	}
 
+	var boots []*upstream.UpstreamResolver
+	if len(c.BootstrapDNS) > 0 {
+		bootstrap, boots, err = newClientBootstrap(c.BootstrapDNS)
+		if err != nil {
+			return nil, fmt.Errorf("bootstrap servers: %w", err)
+		}
+	}
+
 	var upsConf *proxy.UpstreamConfig
 	upsConf, err = proxy.ParseUpstreamsConfig(
 		upstreams,
 		&upstream.Options{
 			Bootstrap:    bootstrap,
-			Timeout:      config.DNS.UpstreamTimeout.Duration,
+			Timeout:      config.Timeouts.Upstream.Duration,
 			HTTPVersions: dnsforward.UpstreamHTTPVersions(config.DNS.UseHTTP3Upstreams),
 			PreferIPv6:   config.DNS.BootstrapPreferIPv6,
 		},
 	)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
-		return nil, err
+		return nil, errors.WithDeferred(err, closeBootstraps(boots))
+	}
+
+	err = dnsforward.ApplyUpstreamMode(
+		upsConf,
+		dnsforward.UpstreamMode(c.UpstreamMode),
+		config.DNS.FastestTimeout.Duration,
+	)
+	if err != nil {
+		err = fmt.Errorf("upstream mode: %w", err)
+
+		return nil, errors.WithDeferred(err, errors.Join(upsConf.Close(), closeBootstraps(boots)))
 	}
 
 	conf = proxy.NewCustomUpstreamConfig(
@@ -417,6 +554,7 @@ func (clients *clientsContainer) UpstreamConfigByID(
 		config.DNS.EDNSClientSubnet.Enabled,
 	)
 	c.UpstreamConfig = conf
+	c.BootstrapResolvers = boots
 
 	// TODO(s.chzhen):  Pass context.
 	err = clients.storage.Update(context.TODO(), c.Name, c)
@@ -427,6 +565,41 @@ func (clients *clientsContainer) UpstreamConfigByID(
 	return conf, nil
 }
 
+// newClientBootstrap returns the resolver of the client-specific bootstrap DNS
+// servers addrs along with the resolvers it uses, which must be closed after
+// use.
+func newClientBootstrap(
+	addrs []string,
+) (r upstream.Resolver, boots []*upstream.UpstreamResolver, err error) {
+	boots, err = aghnet.ParseBootstraps(addrs, &upstream.Options{
+		Timeout:      dnsforward.DefaultTimeout,
+		HTTPVersions: dnsforward.UpstreamHTTPVersions(config.DNS.UseHTTP3Upstreams),
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	var parallel upstream.ParallelResolver
+	for _, b := range boots {
+		parallel = append(parallel, upstream.NewCachingResolver(b))
+	}
+
+	return parallel, boots, nil
+}
+
+// closeBootstraps closes boots.
+func closeBootstraps(boots []*upstream.UpstreamResolver) (err error) {
+	var errs []error
+	for _, b := range boots {
+		if err = b.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing bootstrap %s: %w", b.Address(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // type check
 var _ client.AddressUpdater = (*clientsContainer)(nil)
 
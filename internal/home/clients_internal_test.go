@@ -27,6 +27,7 @@ func newClientsContainer(t *testing.T) (c *clientsContainer) {
 		ctx,
 		slogutil.NewDiscardLogger(),
 		nil,
+		nil,
 		client.EmptyDHCP{},
 		nil,
 		nil,
@@ -62,3 +63,79 @@ func TestClientsCustomUpstream(t *testing.T) {
 	require.NotNil(t, upsConf)
 	assert.NoError(t, err)
 }
+
+func TestClientsContainer_Reload(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	err := clients.storage.Add(ctx, &client.Persistent{
+		Name: "old",
+		UID:  client.MustNewUID(),
+		IPs:  []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+	})
+	require.NoError(t, err)
+
+	set, err := clients.prepareReload(ctx, []*clientObject{{
+		Name: "new",
+		IDs:  []string{"192.0.2.1"},
+	}, {
+		Name: "other",
+		IDs:  []string{"192.0.2.2", "other-id"},
+	}})
+	require.NoError(t, err)
+
+	// The clients must only be replaced when the set is applied.
+	_, ok := clients.storage.FindByName("old")
+	require.True(t, ok)
+
+	clients.applyReload(ctx, set)
+
+	_, ok = clients.storage.FindByName("old")
+	assert.False(t, ok)
+
+	p, ok := clients.storage.Find("192.0.2.1")
+	require.True(t, ok)
+
+	assert.Equal(t, "new", p.Name)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		objects    []*clientObject
+	}{{
+		name: "bad_ids",
+		wantErrMsg: `persistent client at index 0: parsing ids: ` +
+			`invalid clientid "!": bad hostname label rune '!'`,
+		objects: []*clientObject{{
+			Name: "bad",
+			IDs:  []string{"!"},
+		}},
+	}, {
+		name: "duplicate_clientid",
+		wantErrMsg: `client "second": ` +
+			`another client "first" uses the same ClientID "dup-id"`,
+		objects: []*clientObject{{
+			Name: "first",
+			IDs:  []string{"192.0.2.3", "dup-id"},
+		}, {
+			Name: "second",
+			IDs:  []string{"192.0.2.4", "dup-id"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err = clients.prepareReload(ctx, tc.objects)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			// The previous clients must be kept entirely.
+			for _, name := range []string{"new", "other"} {
+				_, ok = clients.storage.FindByName(name)
+				assert.True(t, ok)
+			}
+
+			_, ok = clients.storage.FindByName("first")
+			assert.False(t, ok)
+		})
+	}
+}
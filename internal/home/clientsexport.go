@@ -0,0 +1,229 @@
+package home
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+)
+
+// clientExportJSON is the JSON representation of all the data stored about a
+// client.
+type clientExportJSON struct {
+	// Client is the persistent client, if the client is a persistent one.
+	Client *clientJSON `json:"client,omitempty"`
+
+	// RuntimeClients are the runtime clients with the addresses of the client,
+	// including their WHOIS information.
+	RuntimeClients []runtimeClientJSON `json:"auto_clients"`
+
+	// Leases are the current DHCP leases of the client.  The history of the
+	// leases isn't stored.
+	Leases []*clientExportLeaseJSON `json:"leases"`
+
+	// QueryLog are the query log entries of the client from the oldest to the
+	// newest.
+	QueryLog []map[string]any `json:"querylog"`
+
+	// Stats is the number of requests of the client per hour.
+	Stats []*stats.ClientHour `json:"stats"`
+}
+
+// clientExportLeaseJSON is the JSON representation of a DHCP lease of the
+// exported client.
+type clientExportLeaseJSON struct {
+	// Expires is the expiration time of a dynamic lease in RFC 3339 format.
+	// It's empty for the static leases.
+	Expires string `json:"expires,omitempty"`
+
+	IP       netip.Addr `json:"ip"`
+	Hostname string     `json:"hostname"`
+	MAC      string     `json:"mac"`
+	Static   bool       `json:"static"`
+}
+
+// handleExportClient is the handler for the GET /control/clients/export HTTP
+// API.
+func (clients *clientsContainer) handleExportClient(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(r, w, http.StatusBadRequest, "id is required")
+
+		return
+	}
+
+	exp, err := clients.export(id, Context.queryLog, Context.stats, Context.dhcpServer)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "exporting client: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, exp)
+}
+
+// export returns all the data stored about the client identified by id, which
+// is either a name of a persistent client, or its IP address, MAC address, or
+// ClientID.  Any of ql, st, and dhcp may be nil.
+func (clients *clientsContainer) export(
+	id string,
+	ql querylog.QueryLog,
+	st stats.Interface,
+	dhcp dhcpd.Interface,
+) (exp *clientExportJSON, err error) {
+	exp = &clientExportJSON{
+		RuntimeClients: []runtimeClientJSON{},
+		Leases:         []*clientExportLeaseJSON{},
+		QueryLog:       []map[string]any{},
+		Stats:          []*stats.ClientHour{},
+	}
+
+	m := clients.newClientDataMatcher(id)
+	if m.persistent != nil {
+		exp.Client = clientToJSON(m.persistent)
+	}
+
+	if dhcp != nil {
+		exp.Leases = m.addLeases(exp.Leases, dhcp.Leases())
+	}
+
+	clients.storage.RangeRuntime(func(rc *client.Runtime) (cont bool) {
+		if m.match("", rc.Addr()) {
+			src, host := rc.Info()
+			exp.RuntimeClients = append(exp.RuntimeClients, runtimeClientJSON{
+				WHOIS:  whoisOrEmpty(rc),
+				IP:     rc.Addr(),
+				Name:   host,
+				Source: src,
+			})
+		}
+
+		return true
+	})
+
+	if ql != nil {
+		exp.QueryLog, err = ql.ClientEntries(m.match)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	if st != nil {
+		exp.Stats = append(exp.Stats, st.ClientRequests(m.match)...)
+	}
+
+	return exp, nil
+}
+
+// clientDataMatcher matches the data stored about a client by its identifiers.
+type clientDataMatcher struct {
+	// persistent is the persistent client, if the client is a persistent one.
+	persistent *client.Persistent
+
+	// ips are the IP addresses of the client, including the leased ones.
+	ips []netip.Addr
+
+	// subnets are the subnets of the persistent client.
+	subnets []netip.Prefix
+
+	// macs are the MAC addresses of the client.
+	macs []net.HardwareAddr
+
+	// clientIDs are the ClientIDs of the client.
+	clientIDs []string
+}
+
+// newClientDataMatcher returns a matcher for the client identified by id,
+// which is either a name of a persistent client, or its IP address, MAC
+// address, or ClientID.
+func (clients *clientsContainer) newClientDataMatcher(id string) (m *clientDataMatcher) {
+	p, ok := clients.storage.FindByName(id)
+	if !ok {
+		p, ok = clients.storage.Find(id)
+	}
+
+	if ok {
+		return &clientDataMatcher{
+			persistent: p,
+			ips:        slices.Clone(p.IPs),
+			subnets:    p.Subnets,
+			macs:       p.MACs,
+			clientIDs:  p.ClientIDs,
+		}
+	}
+
+	m = &clientDataMatcher{}
+	if ip, err := netip.ParseAddr(id); err == nil {
+		m.ips = append(m.ips, ip)
+	} else if mac, macErr := net.ParseMAC(id); macErr == nil {
+		m.macs = append(m.macs, mac)
+	} else {
+		m.clientIDs = append(m.clientIDs, id)
+	}
+
+	return m
+}
+
+// match returns true if either clientID or ip belongs to the client.
+func (m *clientDataMatcher) match(clientID string, ip netip.Addr) (ok bool) {
+	if clientID != "" && slices.Contains(m.clientIDs, clientID) {
+		return true
+	}
+
+	if !ip.IsValid() {
+		return false
+	}
+
+	if slices.Contains(m.ips, ip) {
+		return true
+	}
+
+	return slices.ContainsFunc(m.subnets, func(p netip.Prefix) (ok bool) {
+		return p.Contains(ip)
+	})
+}
+
+// addLeases appends the leases of the client to res and returns the result.
+// It also adds the leased IP addresses to the ones of the client.
+func (m *clientDataMatcher) addLeases(
+	res []*clientExportLeaseJSON,
+	leases []*dhcpsvc.Lease,
+) (updated []*clientExportLeaseJSON) {
+	for _, l := range leases {
+		hasMAC := slices.ContainsFunc(m.macs, func(mac net.HardwareAddr) (ok bool) {
+			return slices.Equal(mac, l.HWAddr)
+		})
+
+		if !hasMAC && !m.match("", l.IP) {
+			continue
+		}
+
+		if !slices.Contains(m.ips, l.IP) {
+			m.ips = append(m.ips, l.IP)
+		}
+
+		lj := &clientExportLeaseJSON{
+			IP:       l.IP,
+			Hostname: l.Hostname,
+			MAC:      l.HWAddr.String(),
+			Static:   l.IsStatic,
+		}
+
+		if !l.IsStatic {
+			lj.Expires = l.Expiry.Format(time.RFC3339)
+		}
+
+		res = append(res, lj)
+	}
+
+	return res
+}
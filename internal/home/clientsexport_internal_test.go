@@ -0,0 +1,165 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testExportQueryLog is a [querylog.QueryLog] for tests which stores the
+// entries as the ClientID or IP address of the client.
+type testExportQueryLog struct {
+	// QueryLog is embedded here simply to make testExportQueryLog a
+	// [querylog.QueryLog] without actually implementing all methods.
+	querylog.QueryLog
+
+	clientIDs []string
+	ips       []netip.Addr
+}
+
+// ClientEntries implements the [querylog.QueryLog] interface for
+// *testExportQueryLog.
+func (l *testExportQueryLog) ClientEntries(
+	match func(clientID string, ip netip.Addr) (ok bool),
+) (entries []map[string]any, err error) {
+	for _, id := range l.clientIDs {
+		if match(id, netip.Addr{}) {
+			entries = append(entries, map[string]any{"client_id": id})
+		}
+	}
+
+	for _, ip := range l.ips {
+		if match("", ip) {
+			entries = append(entries, map[string]any{"client": ip.String()})
+		}
+	}
+
+	return entries, nil
+}
+
+// testExportDHCP is a [dhcpd.Interface] for tests.
+type testExportDHCP struct {
+	// Interface is embedded here simply to make testExportDHCP a
+	// [dhcpd.Interface] without actually implementing all methods.
+	dhcpd.Interface
+
+	leases []*dhcpsvc.Lease
+}
+
+// Leases implements the [dhcpd.Interface] interface for *testExportDHCP.
+func (d *testExportDHCP) Leases() (leases []*dhcpsvc.Lease) {
+	return d.leases
+}
+
+func TestClientsContainer_export(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	const (
+		cliName = "client1"
+		cliID   = "cli1"
+	)
+
+	var (
+		cliIP      = netip.MustParseAddr("192.168.0.1")
+		cliMAC     = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+		leasedIP   = netip.MustParseAddr("192.168.0.2")
+		subnetIP   = netip.MustParseAddr("10.0.0.5")
+		otherIP    = netip.MustParseAddr("192.168.0.100")
+		otherMAC   = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00}
+		cliSubnet  = netip.MustParsePrefix("10.0.0.0/24")
+		otherCliID = "cli2"
+	)
+
+	err := clients.storage.Add(ctx, &client.Persistent{
+		Name:      cliName,
+		UID:       client.MustNewUID(),
+		IPs:       []netip.Addr{cliIP},
+		Subnets:   []netip.Prefix{cliSubnet},
+		MACs:      []net.HardwareAddr{cliMAC},
+		ClientIDs: []string{cliID},
+		BlockedServices: &filtering.BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+	})
+	require.NoError(t, err)
+
+	ql := &testExportQueryLog{
+		clientIDs: []string{cliID, otherCliID},
+		ips:       []netip.Addr{cliIP, leasedIP, subnetIP, otherIP},
+	}
+
+	dhcp := &testExportDHCP{
+		leases: []*dhcpsvc.Lease{{
+			IP:       leasedIP,
+			Hostname: "leased",
+			HWAddr:   cliMAC,
+			IsStatic: true,
+		}, {
+			IP:       otherIP,
+			Hostname: "other",
+			HWAddr:   otherMAC,
+			IsStatic: true,
+		}},
+	}
+
+	testCases := []struct {
+		name        string
+		id          string
+		wantEntries int
+		wantLeases  int
+		wantClient  bool
+	}{{
+		name:        "by_name",
+		id:          cliName,
+		wantEntries: 4,
+		wantLeases:  1,
+		wantClient:  true,
+	}, {
+		name:        "by_client_id",
+		id:          cliID,
+		wantEntries: 4,
+		wantLeases:  1,
+		wantClient:  true,
+	}, {
+		name:        "runtime_ip",
+		id:          otherIP.String(),
+		wantEntries: 1,
+		wantLeases:  1,
+		wantClient:  false,
+	}, {
+		name:        "runtime_mac",
+		id:          otherMAC.String(),
+		wantEntries: 1,
+		wantLeases:  1,
+		wantClient:  false,
+	}, {
+		name:        "unknown_client_id",
+		id:          otherCliID,
+		wantEntries: 1,
+		wantLeases:  0,
+		wantClient:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exp, expErr := clients.export(tc.id, ql, nil, dhcp)
+			require.NoError(t, expErr)
+
+			assert.Len(t, exp.QueryLog, tc.wantEntries)
+			assert.Len(t, exp.Leases, tc.wantLeases)
+			assert.Equal(t, tc.wantClient, exp.Client != nil)
+			assert.NotNil(t, exp.Stats)
+		})
+	}
+}
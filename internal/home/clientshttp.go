@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/netip"
+	"slices"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 )
 
@@ -41,6 +44,14 @@ type clientJSON struct {
 	// Schedule is blocked services schedule for every day of the week.
 	Schedule *schedule.Weekly `json:"blocked_services_schedule"`
 
+	// PauseSchedule is the schedule of pausing the internet access of the
+	// client.  If nil, the previous schedule is kept.
+	PauseSchedule *schedule.Weekly `json:"pause_schedule"`
+
+	// ServiceSchedules are the schedules of switching the client to other
+	// profiles of blocked services.  If nil, the previous schedules are kept.
+	ServiceSchedules []*client.ServiceSchedule `json:"service_schedules"`
+
 	Name string `json:"name"`
 
 	// BlockedServices is the names of blocked services.
@@ -49,6 +60,32 @@ type clientJSON struct {
 	Tags            []string `json:"tags"`
 	Upstreams       []string `json:"upstreams"`
 
+	// Group is the name of the group of the client.
+	Group string `json:"group"`
+
+	// BootstrapDNS are the bootstrap DNS servers resolving the hostnames of
+	// Upstreams.  If empty, the global ones are used.
+	BootstrapDNS []string `json:"bootstrap_dns"`
+
+	// UpstreamMode is the way the requests are distributed among Upstreams.  If
+	// empty, the global upstream mode is used.
+	UpstreamMode client.UpstreamMode `json:"upstream_mode,omitempty"`
+
+	// PauseAllowlist are the domain names which are still resolved for the
+	// client while its internet access is paused.  If nil, the previous
+	// allowlist is kept.
+	PauseAllowlist []string `json:"pause_allowlist"`
+
+	// DNS64Prefix is the NAT64 prefix used to synthesize AAAA records by DNS64
+	// for the client.  If nil, the previous prefix is kept, if empty, the
+	// global one is used.
+	DNS64Prefix *netip.Prefix `json:"dns64_prefix,omitempty"`
+
+	// DNS64Exclusions are the domain names for which AAAA records are never
+	// synthesized by DNS64 for the client.  If nil, the previous exclusions
+	// are kept.
+	DNS64Exclusions []string `json:"dns64_exclusions"`
+
 	FilteringEnabled    bool `json:"filtering_enabled"`
 	ParentalEnabled     bool `json:"parental_enabled"`
 	SafeBrowsingEnabled bool `json:"safebrowsing_enabled"`
@@ -60,6 +97,16 @@ type clientJSON struct {
 	IgnoreQueryLog   aghalg.NullBool `json:"ignore_querylog"`
 	IgnoreStatistics aghalg.NullBool `json:"ignore_statistics"`
 
+	// Paused specifies whether the internet access of the client is paused.
+	Paused aghalg.NullBool `json:"paused"`
+
+	// BlockQUIC specifies whether the client is prevented from using QUIC.
+	BlockQUIC aghalg.NullBool `json:"block_quic"`
+
+	// DNSSEC defines whether DNSSEC is enabled for the client.  If empty, the
+	// previous mode is kept.
+	DNSSEC client.DNSSECMode `json:"dnssec,omitempty"`
+
 	UpstreamsCacheSize    uint32          `json:"upstreams_cache_size"`
 	UpstreamsCacheEnabled aghalg.NullBool `json:"upstreams_cache_enabled"`
 }
@@ -134,6 +181,14 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 		uid              client.UID
 		ignoreQueryLog   bool
 		ignoreStatistics bool
+		paused           bool
+		blockQUIC        bool
+		pauseSchedule    *schedule.Weekly
+		serviceScheds    []*client.ServiceSchedule
+		pauseAllowlist   []string
+		dns64Prefix      netip.Prefix
+		dns64Exclusions  []string
+		dnssec           client.DNSSECMode
 		upsCacheEnabled  bool
 		upsCacheSize     uint32
 	)
@@ -142,6 +197,14 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 		uid = prev.UID
 		ignoreQueryLog = prev.IgnoreQueryLog
 		ignoreStatistics = prev.IgnoreStatistics
+		paused = prev.Paused
+		blockQUIC = prev.BlockQUIC
+		pauseSchedule = prev.PauseSchedule.Clone()
+		serviceScheds = client.CloneServiceSchedules(prev.ServiceSchedules)
+		pauseAllowlist = slices.Clone(prev.PauseAllowlist)
+		dns64Prefix = prev.DNS64Prefix
+		dns64Exclusions = slices.Clone(prev.DNS64Exclusions)
+		dnssec = prev.DNSSEC
 		upsCacheEnabled = prev.UpstreamsCacheEnabled
 		upsCacheSize = prev.UpstreamsCacheSize
 	}
@@ -154,6 +217,43 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 		ignoreStatistics = cj.IgnoreStatistics == aghalg.NBTrue
 	}
 
+	if cj.Paused != aghalg.NBNull {
+		paused = cj.Paused == aghalg.NBTrue
+	}
+
+	if cj.BlockQUIC != aghalg.NBNull {
+		blockQUIC = cj.BlockQUIC == aghalg.NBTrue
+	}
+
+	if cj.PauseSchedule != nil {
+		pauseSchedule = cj.PauseSchedule.Clone()
+	}
+
+	if cj.ServiceSchedules != nil {
+		err = validateScheduleServices(cj.ServiceSchedules)
+		if err != nil {
+			return nil, newFieldError("/service_schedules", err)
+		}
+
+		serviceScheds = client.CloneServiceSchedules(cj.ServiceSchedules)
+	}
+
+	if cj.PauseAllowlist != nil {
+		pauseAllowlist = slices.Clone(cj.PauseAllowlist)
+	}
+
+	if cj.DNS64Prefix != nil {
+		dns64Prefix = *cj.DNS64Prefix
+	}
+
+	if cj.DNS64Exclusions != nil {
+		dns64Exclusions = slices.Clone(cj.DNS64Exclusions)
+	}
+
+	if cj.DNSSEC != "" {
+		dnssec = cj.DNSSEC
+	}
+
 	if cj.UpstreamsCacheEnabled != aghalg.NBNull {
 		upsCacheEnabled = cj.UpstreamsCacheEnabled == aghalg.NBTrue
 		upsCacheSize = cj.UpstreamsCacheSize
@@ -161,7 +261,10 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 
 	svcs, err := copyBlockedServices(cj.Schedule, cj.BlockedServices, prev)
 	if err != nil {
-		return nil, fmt.Errorf("invalid blocked services: %w", err)
+		return nil, newFieldError(
+			"/blocked_services",
+			fmt.Errorf("invalid blocked services: %w", err),
+		)
 	}
 
 	if (uid == client.UID{}) {
@@ -176,6 +279,14 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 		UID:                   uid,
 		IgnoreQueryLog:        ignoreQueryLog,
 		IgnoreStatistics:      ignoreStatistics,
+		Paused:                paused,
+		BlockQUIC:             blockQUIC,
+		PauseSchedule:         pauseSchedule,
+		ServiceSchedules:      serviceScheds,
+		PauseAllowlist:        pauseAllowlist,
+		DNS64Prefix:           dns64Prefix,
+		DNS64Exclusions:       dns64Exclusions,
+		DNSSEC:                dnssec,
 		UpstreamsCacheEnabled: upsCacheEnabled,
 		UpstreamsCacheSize:    upsCacheSize,
 	}, nil
@@ -194,16 +305,28 @@ func (clients *clientsContainer) jsonToClient(
 		return nil, err
 	}
 
+	err = dnsforward.ValidateUpstreams(cj.Upstreams)
+	if err != nil {
+		return nil, newFieldError("/upstreams", fmt.Errorf("upstream servers: %w", err))
+	}
+
+	err = dnsforward.ValidateBootstraps(cj.BootstrapDNS)
+	if err != nil {
+		return nil, newFieldError("/bootstrap_dns", err)
+	}
+
 	err = c.SetIDs(cj.IDs)
 	if err != nil {
-		// Don't wrap the error since it's informative enough as is.
-		return nil, err
+		return nil, newFieldError("/ids", err)
 	}
 
 	c.SafeSearchConf = copySafeSearch(cj.SafeSearchConf, cj.SafeSearchEnabled)
 	c.Name = cj.Name
 	c.Tags = cj.Tags
+	c.Group = cj.Group
 	c.Upstreams = cj.Upstreams
+	c.BootstrapDNS = cj.BootstrapDNS
+	c.UpstreamMode = cj.UpstreamMode
 	c.UseOwnSettings = !cj.UseGlobalSettings
 	c.FilteringEnabled = cj.FilteringEnabled
 	c.ParentalEnabled = cj.ParentalEnabled
@@ -298,10 +421,16 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 	cloneVal := c.SafeSearchConf
 	safeSearchConf := &cloneVal
 
+	var dns64Prefix *netip.Prefix
+	if c.DNS64Prefix.IsValid() {
+		dns64Prefix = &c.DNS64Prefix
+	}
+
 	return &clientJSON{
 		Name:                c.Name,
 		IDs:                 c.IDs(),
 		Tags:                c.Tags,
+		Group:               c.Group,
 		UseGlobalSettings:   !c.UseOwnSettings,
 		FilteringEnabled:    c.FilteringEnabled,
 		ParentalEnabled:     c.ParentalEnabled,
@@ -314,10 +443,24 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 		Schedule:        c.BlockedServices.Schedule,
 		BlockedServices: c.BlockedServices.IDs,
 
-		Upstreams: c.Upstreams,
+		Upstreams:    c.Upstreams,
+		BootstrapDNS: c.BootstrapDNS,
+		UpstreamMode: c.UpstreamMode,
+
+		PauseSchedule:  c.PauseSchedule,
+		PauseAllowlist: c.PauseAllowlist,
+
+		ServiceSchedules: c.ServiceSchedules,
+
+		DNS64Prefix:     dns64Prefix,
+		DNS64Exclusions: c.DNS64Exclusions,
 
 		IgnoreQueryLog:   aghalg.BoolToNullBool(c.IgnoreQueryLog),
 		IgnoreStatistics: aghalg.BoolToNullBool(c.IgnoreStatistics),
+		Paused:           aghalg.BoolToNullBool(c.Paused),
+		BlockQUIC:        aghalg.BoolToNullBool(c.BlockQUIC),
+
+		DNSSEC: c.DNSSEC,
 
 		UpstreamsCacheSize:    c.UpstreamsCacheSize,
 		UpstreamsCacheEnabled: aghalg.BoolToNullBool(c.UpstreamsCacheEnabled),
@@ -329,21 +472,21 @@ func (clients *clientsContainer) handleAddClient(w http.ResponseWriter, r *http.
 	cj := clientJSON{}
 	err := json.NewDecoder(r.Body).Decode(&cj)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
 
 		return
 	}
 
 	c, err := clients.jsonToClient(r.Context(), cj, nil)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
 
 	err = clients.storage.Add(r.Context(), c)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -353,24 +496,28 @@ func (clients *clientsContainer) handleAddClient(w http.ResponseWriter, r *http.
 	}
 }
 
+// errEmptyClientName is returned when the name of the persistent client in the
+// request is empty.
+var errEmptyClientName error = newFieldError("/name", errors.Error("client name is required"))
+
 // handleDelClient is the handler for POST /control/clients/delete HTTP API.
 func (clients *clientsContainer) handleDelClient(w http.ResponseWriter, r *http.Request) {
 	cj := clientJSON{}
 	err := json.NewDecoder(r.Body).Decode(&cj)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
 
 		return
 	}
 
 	if len(cj.Name) == 0 {
-		aghhttp.Error(r, w, http.StatusBadRequest, "client's name must be non-empty")
+		writeError(r, w, http.StatusBadRequest, "%s", errEmptyClientName)
 
 		return
 	}
 
 	if !clients.storage.RemoveByName(cj.Name) {
-		aghhttp.Error(r, w, http.StatusBadRequest, "Client not found")
+		writeError(r, w, http.StatusBadRequest, "%s", errClientNotFound)
 
 		return
 	}
@@ -393,27 +540,31 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 	dj := updateJSON{}
 	err := json.NewDecoder(r.Body).Decode(&dj)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
 
 		return
 	}
 
 	if len(dj.Name) == 0 {
-		aghhttp.Error(r, w, http.StatusBadRequest, "Invalid request")
+		writeError(r, w, http.StatusBadRequest, "%s", errEmptyClientName)
 
 		return
 	}
 
-	c, err := clients.jsonToClient(r.Context(), dj.Data, nil)
+	// Keep the settings omitted from the request, such as the pause ones, which
+	// the clients of the API may be unaware of.
+	prev, _ := clients.storage.FindByName(dj.Name)
+
+	c, err := clients.jsonToClient(r.Context(), dj.Data, prev)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
 
 	err = clients.storage.Update(r.Context(), dj.Name, c)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -494,4 +645,25 @@ func (clients *clientsContainer) registerWebHandlers() {
 	httpRegister(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	httpRegister(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	httpRegister(http.MethodGet, "/control/clients/find", clients.handleFindClient)
+	httpRegister(http.MethodGet, "/control/clients/export", clients.handleExportClient)
+	httpRegister(http.MethodGet, "/control/clients/bulk_export", clients.handleBulkExportClients)
+	httpRegister(http.MethodPost, "/control/clients/import", clients.handleImportClients)
+	httpRegister(http.MethodGet, "/control/clients/templates", clients.handleGetClientTemplates)
+	httpRegister(http.MethodGet, "/control/clients/tags", clients.handleGetClientTags)
+	httpRegister(http.MethodPost, "/control/clients/tags/add", clients.handleAddClientTag)
+	httpRegister(http.MethodPost, "/control/clients/tags/delete", clients.handleDelClientTag)
+	httpRegister(http.MethodPost, "/control/clients/tags/rename", clients.handleRenameClientTag)
+	httpRegister(http.MethodPost, "/control/clients/tags/rules", clients.handleSetClientTagRules)
+	httpRegister(http.MethodPost, "/control/clients/{id}/wake", clients.handleWakeClient)
+	httpRegister(
+		http.MethodGet,
+		"/control/clients/{id}/service_schedules",
+		clients.handleGetServiceSchedules,
+	)
+	httpRegister(
+		http.MethodPut,
+		"/control/clients/{id}/service_schedules/update",
+		clients.handleUpdateServiceSchedules,
+	)
+	httpRegister(http.MethodPost, "/control/clients/pause", clients.handlePauseClient)
 }
@@ -84,7 +84,7 @@ func assertClients(tb testing.TB, want, got []*client.Persistent) {
 	slices.SortFunc(want, sortFunc)
 	slices.SortFunc(got, sortFunc)
 
-	slices.CompareFunc(want, got, func(a, b *client.Persistent) (n int) {
+	_ = slices.CompareFunc(want, got, func(a, b *client.Persistent) (n int) {
 		assert.True(tb, a.EqualIDs(b), "%q doesn't have the same ids as %q", a.Name, b.Name)
 
 		return 0
@@ -154,6 +154,17 @@ func TestClientsContainer_HandleAddClient(t *testing.T) {
 	clientEmptyID := newPersistentClient("empty_client_id")
 	clientEmptyID.ClientIDs = []string{""}
 
+	clientBadUpstream := newPersistentClientWithIDs(t, "bad_upstream", []string{"3.3.3.3"})
+	clientBadUpstream.Upstreams = []string{"# comment", "[/example.org/"}
+
+	clientBadBootstrap := newPersistentClientWithIDs(t, "bad_bootstrap", []string{"3.3.3.3"})
+	clientBadBootstrap.Upstreams = []string{"https://dns.example/dns-query"}
+	clientBadBootstrap.BootstrapDNS = []string{"dns.example"}
+
+	clientBootstrap := newPersistentClientWithIDs(t, "bootstrap", []string{"3.3.3.3"})
+	clientBootstrap.Upstreams = []string{"# comment", "https://dns.example/dns-query"}
+	clientBootstrap.BootstrapDNS = []string{"1.1.1.1", "tls://9.9.9.9"}
+
 	testCases := []struct {
 		name       string
 		client     *client.Persistent
@@ -179,6 +190,21 @@ func TestClientsContainer_HandleAddClient(t *testing.T) {
 		client:     clientEmptyID,
 		wantCode:   http.StatusBadRequest,
 		wantClient: []*client.Persistent{clientOne, clientTwo},
+	}, {
+		name:       "bad_upstream",
+		client:     clientBadUpstream,
+		wantCode:   http.StatusBadRequest,
+		wantClient: []*client.Persistent{clientOne, clientTwo},
+	}, {
+		name:       "bad_bootstrap",
+		client:     clientBadBootstrap,
+		wantCode:   http.StatusBadRequest,
+		wantClient: []*client.Persistent{clientOne, clientTwo},
+	}, {
+		name:       "bootstrap",
+		client:     clientBootstrap,
+		wantCode:   http.StatusOK,
+		wantClient: []*client.Persistent{clientOne, clientTwo, clientBootstrap},
 	}}
 
 	for _, tc := range testCases {
@@ -0,0 +1,388 @@
+package home
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Column names of the CSV tables of the imported and exported clients.
+const (
+	clientsCSVColName     = "name"
+	clientsCSVColIDs      = "ids"
+	clientsCSVColTags     = "tags"
+	clientsCSVColGroup    = "group"
+	clientsCSVColTemplate = "template"
+)
+
+// Formats of the exported clients.
+const (
+	clientsExportFormatCSV  = "csv"
+	clientsExportFormatJSON = "json"
+)
+
+// clientImportJSON is the JSON representation of a persistent client imported
+// or exported in bulk.
+type clientImportJSON struct {
+	Name string `json:"name"`
+
+	// Template is the name of the template the settings of the client are
+	// copied from.  If empty, the client uses the global settings.
+	Template string `json:"template,omitempty"`
+
+	// Group is the name of the group of the client.
+	Group string `json:"group"`
+
+	IDs  []string `json:"ids"`
+	Tags []string `json:"tags"`
+}
+
+// clientsImportReqJSON is the request to the POST /control/clients/import HTTP
+// API.
+type clientsImportReqJSON struct {
+	// CSV is the table of the clients to import with a header containing the
+	// names of the columns.  The identifiers and the tags within a cell are
+	// separated by spaces.  These clients are imported after Clients.
+	CSV string `json:"csv"`
+
+	Clients []*clientImportJSON `json:"clients"`
+}
+
+// clientImportErrorJSON is the JSON representation of an error of importing a
+// single client.
+type clientImportErrorJSON struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+
+	// Index is the index of the client in the request, with the clients from
+	// the CSV table going after the JSON ones.
+	Index int `json:"index"`
+}
+
+// clientsImportRespJSON is the response to the POST /control/clients/import
+// HTTP API.
+type clientsImportRespJSON struct {
+	Errors []*clientImportErrorJSON `json:"errors"`
+	Added  int                      `json:"added"`
+}
+
+// clientsBulkExportJSON is the JSON representation of the persistent clients
+// exported in bulk.
+type clientsBulkExportJSON struct {
+	Clients []*clientImportJSON `json:"clients"`
+}
+
+// clientTemplatesJSON is the response to the GET /control/clients/templates
+// HTTP API.
+type clientTemplatesJSON struct {
+	Templates []string `json:"templates"`
+}
+
+// newClientTemplates returns the templates from objs by their names.
+func newClientTemplates(objs []*clientObject) (templates map[string]*clientObject, err error) {
+	templates = make(map[string]*clientObject, len(objs))
+	for i, o := range objs {
+		if o == nil {
+			return nil, fmt.Errorf("template at index %d: %w", i, errors.ErrNoValue)
+		} else if o.Name == "" {
+			return nil, fmt.Errorf("template at index %d: name: %w", i, errors.ErrEmptyValue)
+		} else if _, ok := templates[o.Name]; ok {
+			return nil, fmt.Errorf("template at index %d: duplicate name %q", i, o.Name)
+		}
+
+		templates[o.Name] = o
+	}
+
+	return templates, nil
+}
+
+// handleGetClientTemplates is the handler for the GET
+// /control/clients/templates HTTP API.
+func (clients *clientsContainer) handleGetClientTemplates(w http.ResponseWriter, r *http.Request) {
+	resp := &clientTemplatesJSON{
+		Templates: make([]string, 0, len(clients.templates)),
+	}
+
+	for name := range clients.templates {
+		resp.Templates = append(resp.Templates, name)
+	}
+
+	slices.Sort(resp.Templates)
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleImportClients is the handler for the POST /control/clients/import HTTP
+// API.
+func (clients *clientsContainer) handleImportClients(w http.ResponseWriter, r *http.Request) {
+	req := &clientsImportReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	imps := req.Clients
+	if req.CSV != "" {
+		var csvImps []*clientImportJSON
+		csvImps, err = readClientsCSV(strings.NewReader(req.CSV))
+		if err != nil {
+			writeError(r, w, http.StatusBadRequest, "csv: %s", err)
+
+			return
+		}
+
+		imps = append(imps, csvImps...)
+	}
+
+	resp := clients.importClients(r.Context(), imps)
+	if resp.Added > 0 && !clients.testing {
+		onConfigModified()
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// importClients adds the persistent clients from imps.  The clients that can't
+// be added are reported in the errors of the response.  resp is never nil.
+func (clients *clientsContainer) importClients(
+	ctx context.Context,
+	imps []*clientImportJSON,
+) (resp *clientsImportRespJSON) {
+	resp = &clientsImportRespJSON{
+		Errors: []*clientImportErrorJSON{},
+	}
+
+	for i, imp := range imps {
+		err := clients.importClient(ctx, imp)
+		if err == nil {
+			resp.Added++
+
+			continue
+		}
+
+		var name string
+		if imp != nil {
+			name = imp.Name
+		}
+
+		resp.Errors = append(resp.Errors, &clientImportErrorJSON{
+			Name:  name,
+			Error: err.Error(),
+			Index: i,
+		})
+	}
+
+	return resp
+}
+
+// importClient adds the persistent client from imp using the settings from its
+// template, if any.
+func (clients *clientsContainer) importClient(ctx context.Context, imp *clientImportJSON) (err error) {
+	if imp == nil {
+		return errors.ErrNoValue
+	} else if imp.Name == "" {
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	}
+
+	o, err := clients.templateObject(imp.Template)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	o.Name = imp.Name
+	o.IDs = imp.IDs
+	o.Tags = imp.Tags
+	o.Group = imp.Group
+
+	c, err := o.toPersistent(ctx, clients.baseLogger, clients.safeSearchCacheSize, clients.safeSearchCacheTTL)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return clients.storage.Add(ctx, c)
+}
+
+// templateObject returns a copy of the template with the given name.  If name
+// is empty, it returns the object of a client using the global settings.
+func (clients *clientsContainer) templateObject(name string) (o *clientObject, err error) {
+	if name == "" {
+		return &clientObject{
+			UseGlobalSettings:        true,
+			UseGlobalBlockedServices: true,
+		}, nil
+	}
+
+	t, ok := clients.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template %q: %w", name, errors.ErrBadEnumValue)
+	}
+
+	cloned := *t
+	cloned.BlockedServices = t.BlockedServices.Clone()
+	cloned.Upstreams = slices.Clone(t.Upstreams)
+	cloned.BootstrapDNS = slices.Clone(t.BootstrapDNS)
+
+	// Make sure that each client gets a new UID.
+	cloned.UID = client.UID{}
+
+	return &cloned, nil
+}
+
+// readClientsCSV parses the table of the clients to import from r.  The first
+// record must be the header with the names of the columns.
+func readClientsCSV(r io.Reader) (imps []*clientImportJSON, err error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(col))
+		switch col {
+		case
+			clientsCSVColName,
+			clientsCSVColIDs,
+			clientsCSVColTags,
+			clientsCSVColGroup,
+			clientsCSVColTemplate:
+			cols[col] = i
+		default:
+			return nil, fmt.Errorf("header: column at index %d: %w: %q", i, errors.ErrBadEnumValue, col)
+		}
+	}
+
+	if _, ok := cols[clientsCSVColName]; !ok {
+		return nil, fmt.Errorf("header: column %q: %w", clientsCSVColName, errors.ErrNoValue)
+	}
+
+	for {
+		var rec []string
+		rec, err = cr.Read()
+		if errors.Is(err, io.EOF) {
+			return imps, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading record: %w", err)
+		}
+
+		cell := func(col string) (val string) {
+			if i, ok := cols[col]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+
+			return ""
+		}
+
+		imps = append(imps, &clientImportJSON{
+			Name:     cell(clientsCSVColName),
+			Template: cell(clientsCSVColTemplate),
+			Group:    cell(clientsCSVColGroup),
+			IDs:      strings.Fields(cell(clientsCSVColIDs)),
+			Tags:     strings.Fields(cell(clientsCSVColTags)),
+		})
+	}
+}
+
+// bulkExport returns all persistent clients in the form suitable for bulk
+// import.
+func (clients *clientsContainer) bulkExport() (exp *clientsBulkExportJSON) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	exp = &clientsBulkExportJSON{
+		Clients: make([]*clientImportJSON, 0, clients.storage.Size()),
+	}
+
+	clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
+		exp.Clients = append(exp.Clients, &clientImportJSON{
+			Name:  c.Name,
+			Group: c.Group,
+			IDs:   c.IDs(),
+			Tags:  slices.Clone(c.Tags),
+		})
+
+		return true
+	})
+
+	return exp
+}
+
+// writeClientsCSV writes the table of the clients from exp to w.
+func writeClientsCSV(w io.Writer, exp *clientsBulkExportJSON) (err error) {
+	cw := csv.NewWriter(w)
+	err = cw.Write([]string{
+		clientsCSVColName,
+		clientsCSVColIDs,
+		clientsCSVColTags,
+		clientsCSVColGroup,
+	})
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for _, c := range exp.Clients {
+		err = cw.Write([]string{
+			c.Name,
+			strings.Join(c.IDs, " "),
+			strings.Join(c.Tags, " "),
+			c.Group,
+		})
+		if err != nil {
+			return fmt.Errorf("writing client %q: %w", c.Name, err)
+		}
+	}
+
+	cw.Flush()
+
+	// Don't wrap the error since it's informative enough as is.
+	return cw.Error()
+}
+
+// handleBulkExportClients is the handler for the GET
+// /control/clients/bulk_export HTTP API.
+func (clients *clientsContainer) handleBulkExportClients(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", clientsExportFormatJSON:
+		aghhttp.WriteJSONResponseOK(w, r, clients.bulkExport())
+	case clientsExportFormatCSV:
+		buf := &bytes.Buffer{}
+		err := writeClientsCSV(buf, clients.bulkExport())
+		if err != nil {
+			writeError(r, w, http.StatusInternalServerError, "exporting clients: %s", err)
+
+			return
+		}
+
+		h := w.Header()
+		h.Set(httphdr.ContentType, aghhttp.HdrValTextCSV)
+		h.Set(httphdr.ContentDisposition, "attachment; filename=clients.csv")
+
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			log.Debug("home: writing clients export: %s", err)
+		}
+	default:
+		writeError(r, w, http.StatusBadRequest, "format: unsupported value %q", format)
+	}
+}
@@ -0,0 +1,206 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientTemplates(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		objs       []*clientObject
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		objs:       []*clientObject{{Name: "kids"}, {Name: "staff"}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "template at index 0: no value",
+		objs:       []*clientObject{nil},
+	}, {
+		name:       "empty_name",
+		wantErrMsg: "template at index 0: name: empty value",
+		objs:       []*clientObject{{}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `template at index 1: duplicate name "kids"`,
+		objs:       []*clientObject{{Name: "kids"}, {Name: "kids"}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newClientTemplates(tc.objs)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestClientsContainer_HandleImportClients(t *testing.T) {
+	clients := newClientsContainer(t)
+
+	var err error
+	clients.templates, err = newClientTemplates([]*clientObject{{
+		Name:             "kids",
+		ParentalEnabled:  true,
+		FilteringEnabled: true,
+		Upstreams:        []string{"1.1.1.1"},
+	}})
+	require.NoError(t, err)
+
+	const csvData = "name,ids,tags,group,template\n" +
+		`pupil_1,"1.1.1.1 aa:bb:cc:dd:ee:ff",device_pc,5a,kids` + "\n" +
+		"pupil_2,1.1.1.2,,5a,kids\n" +
+		"pupil_3,1.1.1.3,,5b,unknown\n"
+
+	body, err := json.Marshal(&clientsImportReqJSON{
+		CSV: csvData,
+		Clients: []*clientImportJSON{{
+			Name:  "teacher",
+			Group: "staff",
+			IDs:   []string{"1.1.1.4"},
+		}, {
+			Name: "",
+			IDs:  []string{"1.1.1.5"},
+		}},
+	})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/control/clients/import", bytes.NewReader(body))
+	rw := httptest.NewRecorder()
+	clients.handleImportClients(rw, r)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	resp := &clientsImportRespJSON{}
+	err = json.NewDecoder(rw.Body).Decode(resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, resp.Added)
+	require.Len(t, resp.Errors, 2)
+
+	assert.Equal(t, 1, resp.Errors[0].Index)
+	assert.Equal(t, "name: empty value", resp.Errors[0].Error)
+	assert.Equal(t, 4, resp.Errors[1].Index)
+	assert.Equal(t, "pupil_3", resp.Errors[1].Name)
+	assert.Equal(t, `template "unknown": bad enum value`, resp.Errors[1].Error)
+
+	pupil, ok := clients.storage.FindByName("pupil_1")
+	require.True(t, ok)
+
+	assert.Equal(t, "5a", pupil.Group)
+	assert.Equal(t, []string{"device_pc"}, pupil.Tags)
+	assert.Equal(t, []string{"1.1.1.1"}, pupil.Upstreams)
+	assert.True(t, pupil.UseOwnSettings)
+	assert.True(t, pupil.ParentalEnabled)
+	assert.Len(t, pupil.MACs, 1)
+
+	other, ok := clients.storage.FindByName("pupil_2")
+	require.True(t, ok)
+
+	assert.NotEqual(t, pupil.UID, other.UID)
+
+	teacher, ok := clients.storage.FindByName("teacher")
+	require.True(t, ok)
+
+	assert.Equal(t, "staff", teacher.Group)
+	assert.False(t, teacher.UseOwnSettings)
+	assert.False(t, teacher.UseOwnBlockedServices)
+}
+
+func TestClientsContainer_HandleImportClients_badCSV(t *testing.T) {
+	clients := newClientsContainer(t)
+
+	testCases := []struct {
+		name    string
+		csv     string
+		wantErr string
+	}{{
+		name:    "unknown_column",
+		csv:     "name,color\nclient,red\n",
+		wantErr: "csv: header: column at index 1: bad enum value",
+	}, {
+		name:    "no_name",
+		csv:     "ids\n1.1.1.1\n",
+		wantErr: "no value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(&clientsImportReqJSON{CSV: tc.csv})
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/control/clients/import", bytes.NewReader(body))
+			rw := httptest.NewRecorder()
+			clients.handleImportClients(rw, r)
+			require.Equal(t, http.StatusBadRequest, rw.Code)
+
+			assert.Contains(t, rw.Body.String(), tc.wantErr)
+		})
+	}
+}
+
+func TestClientsContainer_HandleBulkExportClients(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	c := newPersistentClientWithIDs(t, "client", []string{"1.1.1.1", "client-id"})
+	c.Tags = []string{"device_pc", "os_linux"}
+	c.Group = "5a"
+
+	require.NoError(t, clients.storage.Add(ctx, c))
+
+	t.Run("csv", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/bulk_export?format=csv", nil)
+		rw := httptest.NewRecorder()
+		clients.handleBulkExportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		assert.Equal(t, aghhttp.HdrValTextCSV, rw.Header().Get(httphdr.ContentType))
+
+		want := "name,ids,tags,group\n" + "client,1.1.1.1 client-id,device_pc os_linux,5a\n"
+		assert.Equal(t, want, rw.Body.String())
+
+		imps, err := readClientsCSV(strings.NewReader(rw.Body.String()))
+		require.NoError(t, err)
+		require.Len(t, imps, 1)
+
+		assert.Equal(t, []string{"1.1.1.1", "client-id"}, imps[0].IDs)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/bulk_export", nil)
+		rw := httptest.NewRecorder()
+		clients.handleBulkExportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		exp := &clientsBulkExportJSON{}
+		err := json.NewDecoder(rw.Body).Decode(exp)
+		require.NoError(t, err)
+		require.Len(t, exp.Clients, 1)
+
+		assert.Equal(t, &clientImportJSON{
+			Name:  "client",
+			Group: "5a",
+			IDs:   []string{"1.1.1.1", "client-id"},
+			Tags:  []string{"device_pc", "os_linux"},
+		}, exp.Clients[0])
+	})
+
+	t.Run("bad_format", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/bulk_export?format=xml", nil)
+		rw := httptest.NewRecorder()
+		clients.handleBulkExportClients(rw, r)
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
@@ -0,0 +1,54 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// pauseClientJSON is the JSON representation of the request to pause or
+// resume the internet access of a persistent client.
+type pauseClientJSON struct {
+	// Name is the name of the persistent client.
+	Name string `json:"name"`
+
+	// Paused specifies whether the internet access of the client is paused.
+	Paused bool `json:"paused"`
+}
+
+// handlePauseClient is the handler for the POST /control/clients/pause HTTP
+// API.
+func (clients *clientsContainer) handlePauseClient(w http.ResponseWriter, r *http.Request) {
+	req := &pauseClientJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	if req.Name == "" {
+		writeError(r, w, http.StatusBadRequest, "%s", errEmptyClientName)
+
+		return
+	}
+
+	c, ok := clients.storage.FindByName(req.Name)
+	if !ok {
+		writeError(r, w, http.StatusNotFound, "%q: %s", req.Name, errClientNotFound)
+
+		return
+	}
+
+	c.Paused = req.Paused
+
+	err = clients.storage.Update(r.Context(), c.Name, c)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
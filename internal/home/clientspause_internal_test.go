@@ -0,0 +1,79 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientsContainer_HandlePauseClient(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	const cliName = "client1"
+
+	cli := newPersistentClientWithIDs(t, cliName, []string{testClientIP1})
+	cli.PauseAllowlist = []string{"example.org"}
+
+	err := clients.storage.Add(ctx, cli)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		clientName string
+		wantCode   int
+		paused     bool
+		wantPaused bool
+	}{{
+		name:       "pause",
+		clientName: cliName,
+		wantCode:   http.StatusOK,
+		paused:     true,
+		wantPaused: true,
+	}, {
+		name:       "not_found",
+		clientName: "client_not_found",
+		wantCode:   http.StatusNotFound,
+		paused:     false,
+		wantPaused: true,
+	}, {
+		name:       "empty_name",
+		clientName: "",
+		wantCode:   http.StatusBadRequest,
+		paused:     false,
+		wantPaused: true,
+	}, {
+		name:       "resume",
+		clientName: cliName,
+		wantCode:   http.StatusOK,
+		paused:     false,
+		wantPaused: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, mErr := json.Marshal(&pauseClientJSON{
+				Name:   tc.clientName,
+				Paused: tc.paused,
+			})
+			require.NoError(t, mErr)
+
+			r := httptest.NewRequest(http.MethodPost, "/control/clients/pause", bytes.NewReader(body))
+			rw := httptest.NewRecorder()
+			clients.handlePauseClient(rw, r)
+			require.Equal(t, tc.wantCode, rw.Code)
+
+			got, ok := clients.storage.FindByName(cliName)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.wantPaused, got.Paused)
+			assert.Equal(t, []string{"example.org"}, got.PauseAllowlist)
+		})
+	}
+}
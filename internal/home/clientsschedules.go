@@ -0,0 +1,108 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// serviceSchedulesJSON is the JSON representation of the service schedules of
+// a persistent client.
+type serviceSchedulesJSON struct {
+	// Schedules are the schedules of switching the client to other profiles of
+	// blocked services.
+	Schedules []*client.ServiceSchedule `json:"schedules"`
+
+	// Active is the name of the currently active schedule.  It's empty if
+	// there is none.  It's ignored in requests.
+	Active string `json:"active,omitempty"`
+}
+
+// handleGetServiceSchedules is the handler for the GET
+// /control/clients/{id}/service_schedules HTTP API.
+func (clients *clientsContainer) handleGetServiceSchedules(w http.ResponseWriter, r *http.Request) {
+	c, err := clients.findPersistent(r.PathValue("id"))
+	if err != nil {
+		writeError(r, w, http.StatusNotFound, "%s", err)
+
+		return
+	}
+
+	resp := &serviceSchedulesJSON{
+		Schedules: c.ServiceSchedules,
+	}
+
+	if resp.Schedules == nil {
+		resp.Schedules = []*client.ServiceSchedule{}
+	}
+
+	if s := c.ActiveServiceSchedule(time.Now()); s != nil {
+		resp.Active = s.Name
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleUpdateServiceSchedules is the handler for the PUT
+// /control/clients/{id}/service_schedules/update HTTP API.  It replaces all service
+// schedules of the client.
+func (clients *clientsContainer) handleUpdateServiceSchedules(w http.ResponseWriter, r *http.Request) {
+	req := &serviceSchedulesJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = validateScheduleServices(req.Schedules)
+	if err != nil {
+		writeError(r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	c, err := clients.findPersistent(r.PathValue("id"))
+	if err != nil {
+		writeError(r, w, http.StatusNotFound, "%s", err)
+
+		return
+	}
+
+	c.ServiceSchedules = req.Schedules
+
+	err = clients.storage.Update(r.Context(), c.Name, c)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// validateScheduleServices returns an error if any of the service schedules
+// blocks an unknown service.  The rest of the schedules are validated by the
+// clients storage.
+func validateScheduleServices(scheds []*client.ServiceSchedule) (err error) {
+	for i, s := range scheds {
+		if s == nil {
+			return fmt.Errorf("service schedules: at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		err = (&filtering.BlockedServices{IDs: s.BlockedServices}).Validate()
+		if err != nil {
+			return fmt.Errorf("service schedules: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+)
+
+// tagRuleObject is the YAML and JSON representation of a rule tagging the
+// clients automatically.
+type tagRuleObject struct {
+	Tag      string         `yaml:"tag" json:"tag"`
+	Hostname string         `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	OUIs     []string       `yaml:"ouis,omitempty" json:"ouis,omitempty"`
+	Subnets  []netip.Prefix `yaml:"subnets,omitempty" json:"subnets,omitempty"`
+}
+
+// tagRulesFromObjects converts objs into the configurations of the tagging
+// rules.  Nil objects are kept so that the storage reports them.
+func tagRulesFromObjects(objs []*tagRuleObject) (confs []*client.TagRuleConfig) {
+	confs = make([]*client.TagRuleConfig, 0, len(objs))
+	for _, o := range objs {
+		if o == nil {
+			confs = append(confs, nil)
+
+			continue
+		}
+
+		confs = append(confs, &client.TagRuleConfig{
+			Tag:      o.Tag,
+			Hostname: o.Hostname,
+			OUIs:     o.OUIs,
+			Subnets:  o.Subnets,
+		})
+	}
+
+	return confs
+}
+
+// tagRulesToObjects converts the configurations of the tagging rules into
+// their YAML and JSON representations.
+func tagRulesToObjects(confs []*client.TagRuleConfig) (objs []*tagRuleObject) {
+	objs = make([]*tagRuleObject, 0, len(confs))
+	for _, c := range confs {
+		objs = append(objs, &tagRuleObject{
+			Tag:      c.Tag,
+			Hostname: c.Hostname,
+			OUIs:     c.OUIs,
+			Subnets:  c.Subnets,
+		})
+	}
+
+	return objs
+}
+
+// mergeTags returns the sorted union of the tags of a persistent client and
+// the tags assigned by the tagging rules.  tags and auto must be sorted.
+func mergeTags(tags, auto []string) (merged []string) {
+	if len(auto) == 0 {
+		return tags
+	}
+
+	merged = slices.Concat(tags, auto)
+	slices.Sort(merged)
+
+	return slices.Compact(merged)
+}
+
+// clientTagsJSON is the response to the GET /control/clients/tags HTTP API.
+type clientTagsJSON struct {
+	// Tags are all tags available for the clients, both built-in and custom.
+	Tags []string `json:"tags"`
+
+	// Custom are the tags added by the user.
+	Custom []string `json:"custom"`
+
+	Rules []*tagRuleObject `json:"rules"`
+}
+
+// clientTagJSON is the request to the POST /control/clients/tags/add and
+// /control/clients/tags/delete HTTP APIs.
+type clientTagJSON struct {
+	Tag string `json:"tag"`
+}
+
+// clientTagRenameJSON is the request to the POST /control/clients/tags/rename
+// HTTP API.
+type clientTagRenameJSON struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// clientTagRulesJSON is the request to the POST /control/clients/tags/rules
+// HTTP API.
+type clientTagRulesJSON struct {
+	Rules []*tagRuleObject `json:"rules"`
+}
+
+// handleGetClientTags is the handler for the GET /control/clients/tags HTTP
+// API.
+func (clients *clientsContainer) handleGetClientTags(w http.ResponseWriter, r *http.Request) {
+	aghhttp.WriteJSONResponseOK(w, r, &clientTagsJSON{
+		Tags:   clients.storage.AllowedTags(),
+		Custom: clients.storage.CustomTags(),
+		Rules:  tagRulesToObjects(clients.storage.TagRules()),
+	})
+}
+
+// handleAddClientTag is the handler for the POST /control/clients/tags/add
+// HTTP API.
+func (clients *clientsContainer) handleAddClientTag(w http.ResponseWriter, r *http.Request) {
+	req := &clientTagJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = clients.storage.AddTag(req.Tag)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "adding tag: %s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// handleDelClientTag is the handler for the POST /control/clients/tags/delete
+// HTTP API.
+func (clients *clientsContainer) handleDelClientTag(w http.ResponseWriter, r *http.Request) {
+	req := &clientTagJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = clients.storage.RemoveTag(req.Tag)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "removing tag: %s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// handleRenameClientTag is the handler for the POST
+// /control/clients/tags/rename HTTP API.
+func (clients *clientsContainer) handleRenameClientTag(w http.ResponseWriter, r *http.Request) {
+	req := &clientTagRenameJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = clients.storage.RenameTag(req.Old, req.New)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "renaming tag: %s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// handleSetClientTagRules is the handler for the POST
+// /control/clients/tags/rules HTTP API.
+func (clients *clientsContainer) handleSetClientTagRules(w http.ResponseWriter, r *http.Request) {
+	req := &clientTagRulesJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = clients.storage.SetTagRules(tagRulesFromObjects(req.Rules))
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "setting tag rules: %s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
@@ -0,0 +1,125 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// errClientNotFound is returned when the persistent client isn't found.
+const errClientNotFound errors.Error = "client not found"
+
+// errClientNoMACs is returned when no MAC addresses of the persistent client
+// are known.
+const errClientNoMACs errors.Error = "no known mac addresses"
+
+// wakeFunc sends a Wake-on-LAN magic packet to the device with mac.
+type wakeFunc func(ctx context.Context, mac net.HardwareAddr) (err error)
+
+// wakeClientJSON is the JSON representation of the result of waking a client.
+type wakeClientJSON struct {
+	// MACs are the MAC addresses the magic packets have been sent to.
+	MACs []string `json:"macs"`
+}
+
+// handleWakeClient is the handler for the POST /control/clients/{id}/wake HTTP
+// API.
+func (clients *clientsContainer) handleWakeClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(r, w, http.StatusBadRequest, "id is required")
+
+		return
+	}
+
+	macs, err := clients.wake(r.Context(), id, Context.dhcpServer, aghnet.SendMagicPacket)
+	switch {
+	case err == nil:
+		// Go on.
+	case errors.Is(err, errClientNotFound):
+		writeError(r, w, http.StatusNotFound, "%s", err)
+
+		return
+	case errors.Is(err, errClientNoMACs):
+		writeError(r, w, http.StatusBadRequest, "waking client: %s", err)
+
+		return
+	default:
+		writeError(r, w, http.StatusInternalServerError, "waking client: %s", err)
+
+		return
+	}
+
+	resp := &wakeClientJSON{
+		MACs: make([]string, 0, len(macs)),
+	}
+	for _, mac := range macs {
+		resp.MACs = append(resp.MACs, mac.String())
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// findPersistent returns the persistent client identified by id, which is
+// either its name or any of its identifiers.  err is [errClientNotFound] if
+// there is no such client.
+func (clients *clientsContainer) findPersistent(id string) (p *client.Persistent, err error) {
+	p, ok := clients.storage.FindByName(id)
+	if !ok {
+		p, ok = clients.storage.Find(id)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", id, errClientNotFound)
+	}
+
+	return p, nil
+}
+
+// wake sends the Wake-on-LAN magic packets using send to all MAC addresses of
+// the persistent client identified by id, which is either its name or any of
+// its identifiers.  If the client has no MAC addresses, the ones of its IP
+// addresses are looked up in the DHCP leases.  dhcp may be nil.  macs are the
+// addresses the packets have been sent to.
+func (clients *clientsContainer) wake(
+	ctx context.Context,
+	id string,
+	dhcp dhcpd.Interface,
+	send wakeFunc,
+) (macs []net.HardwareAddr, err error) {
+	p, err := clients.findPersistent(id)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	macs = slices.Clone(p.MACs)
+	if len(macs) == 0 && dhcp != nil {
+		for _, ip := range p.IPs {
+			if mac := dhcp.MACByIP(ip); mac != nil {
+				macs = append(macs, mac)
+			}
+		}
+	}
+
+	if len(macs) == 0 {
+		return nil, fmt.Errorf("client %q: %w", p.Name, errClientNoMACs)
+	}
+
+	for _, mac := range macs {
+		err = send(ctx, mac)
+		if err != nil {
+			return nil, fmt.Errorf("sending to %s: %w", mac, err)
+		}
+	}
+
+	return macs, nil
+}
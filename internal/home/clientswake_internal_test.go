@@ -0,0 +1,114 @@
+package home
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWakeDHCP is a [dhcpd.Interface] for tests.
+type testWakeDHCP struct {
+	// Interface is embedded here simply to make testWakeDHCP a
+	// [dhcpd.Interface] without actually implementing all methods.
+	dhcpd.Interface
+
+	macs map[netip.Addr]net.HardwareAddr
+}
+
+// MACByIP implements the [dhcpd.Interface] interface for *testWakeDHCP.
+func (d *testWakeDHCP) MACByIP(ip netip.Addr) (mac net.HardwareAddr) {
+	return d.macs[ip]
+}
+
+func TestClientsContainer_wake(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	var (
+		cliMAC    = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+		leasedMAC = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00}
+		leasedIP  = netip.MustParseAddr("192.168.0.2")
+		otherIP   = netip.MustParseAddr("192.168.0.3")
+	)
+
+	for _, c := range []*client.Persistent{{
+		Name: "with_mac",
+		MACs: []net.HardwareAddr{cliMAC},
+	}, {
+		Name: "leased",
+		IPs:  []netip.Addr{leasedIP},
+	}, {
+		Name: "no_mac",
+		IPs:  []netip.Addr{otherIP},
+	}} {
+		c.UID = client.MustNewUID()
+		c.BlockedServices = &filtering.BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		}
+
+		err := clients.storage.Add(ctx, c)
+		require.NoError(t, err)
+	}
+
+	dhcp := &testWakeDHCP{
+		macs: map[netip.Addr]net.HardwareAddr{leasedIP: leasedMAC},
+	}
+
+	testCases := []struct {
+		name       string
+		id         string
+		wantErrMsg string
+		want       []net.HardwareAddr
+	}{{
+		name:       "by_name",
+		id:         "with_mac",
+		wantErrMsg: "",
+		want:       []net.HardwareAddr{cliMAC},
+	}, {
+		name:       "by_mac",
+		id:         cliMAC.String(),
+		wantErrMsg: "",
+		want:       []net.HardwareAddr{cliMAC},
+	}, {
+		name:       "leased",
+		id:         "leased",
+		wantErrMsg: "",
+		want:       []net.HardwareAddr{leasedMAC},
+	}, {
+		name:       "no_mac",
+		id:         "no_mac",
+		wantErrMsg: `client "no_mac": no known mac addresses`,
+		want:       nil,
+	}, {
+		name:       "not_found",
+		id:         "unknown",
+		wantErrMsg: `"unknown": client not found`,
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent []net.HardwareAddr
+			send := func(_ context.Context, mac net.HardwareAddr) (err error) {
+				sent = append(sent, mac)
+
+				return nil
+			}
+
+			macs, err := clients.wake(ctx, tc.id, dhcp, send)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, macs)
+			assert.Equal(t, tc.want, sent)
+		})
+	}
+}
@@ -3,10 +3,12 @@ package home
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
@@ -16,6 +18,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/rebinding"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/dnsproxy/fastip"
@@ -23,7 +26,11 @@ import (
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/c2h5oh/datasize"
 	"github.com/google/renameio/v2/maybe"
+	"github.com/miekg/dns"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/crypto/bcrypt"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -81,6 +88,11 @@ type osConfig struct {
 	// RlimitNoFile is the maximum number of opened fd's per process.  Zero
 	// means use the default value.
 	RlimitNoFile uint64 `yaml:"rlimit_nofile"`
+	// OpenWrt is the configuration of the integration with OpenWrt.
+	OpenWrt *openWrtConfig `yaml:"openwrt"`
+	// PFTable is the configuration of exporting the disallowed clients into a
+	// pf table.
+	PFTable *pfTableConfig `yaml:"pf_table"`
 }
 
 type clientsConfig struct {
@@ -88,6 +100,14 @@ type clientsConfig struct {
 	Sources *clientSourcesConfig `yaml:"runtime_sources"`
 	// Persistent are the configured clients.
 	Persistent []*clientObject `yaml:"persistent"`
+	// Templates are the named settings of the clients imported in bulk.  Their
+	// identifiers and tags are ignored.
+	Templates []*clientObject `yaml:"templates,omitempty"`
+	// CustomTags are the client tags added by the user in addition to the
+	// built-in ones.
+	CustomTags []string `yaml:"custom_tags,omitempty"`
+	// TagRules are the rules tagging the clients automatically.
+	TagRules []*tagRuleObject `yaml:"tag_rules,omitempty"`
 }
 
 // clientSourceConfig is used to configure where the runtime clients will be
@@ -100,6 +120,15 @@ type clientSourcesConfig struct {
 	HostsFile bool `yaml:"hosts"`
 }
 
+// inventoryConfig is the configuration of the device inventory.
+type inventoryConfig struct {
+	// Interval is the time between the scans of the local networks.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// Enabled defines if the local networks are scanned periodically.
+	Enabled bool `yaml:"enabled"`
+}
+
 // configuration is loaded from YAML.
 //
 // Field ordering is important, YAML fields better not to be reordered, if it's
@@ -109,6 +138,11 @@ type configuration struct {
 	// It's reset after config is parsed
 	fileData []byte
 
+	// includes are the values merged from the included files, which aren't
+	// written into the configuration file.  It's nil if there are no
+	// includes.
+	includes *configIncludes
+
 	// HTTPConfig is the block with http conf.
 	HTTPConfig httpConfig `yaml:"http"`
 	// Users are the clients capable for accessing the web interface.
@@ -119,6 +153,12 @@ type configuration struct {
 	// AuthBlockMin is the duration, in minutes, of the block of new login
 	// attempts after AuthAttempts unsuccessful login attempts.
 	AuthBlockMin uint `yaml:"block_auth_min"`
+	// PasswordHashing is the configuration of hashing the passwords of the
+	// users.
+	PasswordHashing *passwordHashingConfig `yaml:"password_hashing"`
+	// WebAuthn is the configuration of the passwordless login with the
+	// security keys and platform authenticators.
+	WebAuthn *webAuthnConfig `yaml:"webauthn"`
 	// ProxyURL is the address of proxy server for the internal HTTP client.
 	ProxyURL string `yaml:"http_proxy"`
 	// Language is a two-letter ISO 639-1 language code.
@@ -144,6 +184,10 @@ type configuration struct {
 	WhitelistFilters []filtering.FilterYAML `yaml:"whitelist_filters"`
 	UserRules        []string               `yaml:"user_rules"`
 
+	// UserRulesMeta is the metadata of UserRules, such as who added each rule,
+	// when, and why.
+	UserRulesMeta []*filtering.UserRuleMeta `yaml:"user_rules_meta,omitempty"`
+
 	DHCP      *dhcpd.ServerConfig `yaml:"dhcp"`
 	Filtering *filtering.Config   `yaml:"filtering"`
 
@@ -152,11 +196,37 @@ type configuration struct {
 	// Keep this field sorted to ensure consistent ordering.
 	Clients *clientsConfig `yaml:"clients"`
 
+	// Inventory is the configuration of the inventory of the devices on the
+	// local networks.
+	Inventory *inventoryConfig `yaml:"inventory"`
+
+	// Events is the configuration of the bus of the notable events.
+	Events *eventsConfig `yaml:"events"`
+
 	// Log is a block with log configuration settings.
 	Log logSettings `yaml:"log"`
 
 	OSConfig *osConfig `yaml:"os"`
 
+	// TimeSanity is the configuration of checking the system clock.
+	TimeSanity *timeSanityConfig `yaml:"time_sanity"`
+
+	// Timeouts are the deadlines of the requests to the external services.
+	Timeouts *timeoutsConfig `yaml:"timeouts"`
+
+	// UpdateWebhook is the configuration of the webhook notified about the
+	// available updates.
+	UpdateWebhook *updateWebhookConfig `yaml:"update_webhook,omitempty"`
+
+	// Maintenance is the configuration of the maintenance windows.
+	Maintenance *maintenanceConfig `yaml:"maintenance,omitempty"`
+
+	// Include are the glob patterns of the files containing the configuration
+	// fragments merged into the configuration at load, see [mergeIncludes].
+	// Relative patterns are resolved against the directory of the
+	// configuration file.
+	Include []string `yaml:"include,omitempty"`
+
 	sync.RWMutex `yaml:"-"`
 
 	// SchemaVersion is the version of the configuration schema.  See
@@ -178,6 +248,19 @@ type httpConfig struct {
 	// SessionTTL for a web session.
 	// An active session is automatically refreshed once a day.
 	SessionTTL timeutil.Duration `yaml:"session_ttl"`
+
+	// SessionBinding is the configuration of binding the web sessions to the
+	// networks and browsers they have been created from.
+	SessionBinding *sessionBindingConfig `yaml:"session_binding"`
+
+	// SecurityHeaders is the configuration of the security headers of the
+	// responses of the web interface.
+	SecurityHeaders *securityHeadersConfig `yaml:"security_headers"`
+
+	// Routes is the configuration of the access controls and the rate limits
+	// of the DNS-over-HTTPS endpoints and the web interface served on the same
+	// port.
+	Routes *webRoutesConfig `yaml:"routes"`
 }
 
 // httpPprofConfig is the block with pprof HTTP configuration.
@@ -206,9 +289,6 @@ type dnsConfig struct {
 	// TODO(a.garipov): Remove embed.
 	dnsforward.Config `yaml:",inline"`
 
-	// UpstreamTimeout is the timeout for querying upstream servers.
-	UpstreamTimeout timeutil.Duration `yaml:"upstream_timeout"`
-
 	// PrivateNets is the set of IP networks for which the private reverse DNS
 	// resolver should be used.
 	PrivateNets []netutil.Prefix `yaml:"private_networks"`
@@ -227,6 +307,15 @@ type dnsConfig struct {
 	// If empty, the OS-provided resolvers are used for private requests.
 	PrivateRDNSResolvers []string `yaml:"local_ptr_upstreams"`
 
+	// DiscoverPrivateRDNS defines if the local DNS servers and the private
+	// networks are discovered from the DHCP server configuration and the
+	// network interfaces.  The discovered servers are used instead of the
+	// OS-provided ones when PrivateRDNSResolvers is empty, and the discovered
+	// networks extend the locally served ones when PrivateNets is empty.  It's
+	// disabled by default, since the discovery assumes that the gateways serve
+	// DNS on port 53.
+	DiscoverPrivateRDNS bool `yaml:"discover_private_rdns"`
+
 	// UseDNS64 defines if DNS64 should be used for incoming requests.  Requests
 	// of type PTR for addresses within the configured prefixes will be resolved
 	// via [PrivateRDNSResolvers], so those should be valid and UsePrivateRDNS
@@ -255,6 +344,12 @@ type dnsConfig struct {
 	// HostsFileEnabled defines whether to use information from the system hosts
 	// file to resolve queries.
 	HostsFileEnabled bool `yaml:"hostsfile_enabled"`
+
+	// DrainTimeout is the maximum duration of waiting for the DNS requests
+	// being processed to be answered during the graceful shutdown.  The new
+	// requests are refused meanwhile, see [dnsforward.Server.Drain].  If zero,
+	// the DNS server is stopped immediately.
+	DrainTimeout timeutil.Duration `yaml:"drain_timeout"`
 }
 
 type tlsConfigSettings struct {
@@ -278,6 +373,15 @@ type tlsConfigSettings struct {
 	// Allow DoH queries via unencrypted HTTP (e.g. for reverse proxying)
 	AllowUnencryptedDoH bool `yaml:"allow_unencrypted_doh" json:"allow_unencrypted_doh"`
 
+	// Web, if configured, is the separate certificate of the HTTPS server of
+	// the web interface.  Otherwise, the web interface uses the same
+	// certificate as the encrypted DNS listeners.
+	Web *webTLSConfig `yaml:"web,omitempty" json:"-"`
+
+	// ExpiryAlertDays are the numbers of days left until the expiry of a
+	// certificate, reaching each of which emits a warning.
+	ExpiryAlertDays []uint `yaml:"expiry_alert_days" json:"-"`
+
 	dnsforward.TLSConfig `yaml:",inline" json:",inline"`
 }
 
@@ -297,9 +401,29 @@ type queryLogConfig struct {
 	// to disk.
 	MemSize uint `yaml:"size_memory"`
 
+	// SampleRate is the N such that only one of N unfiltered requests is
+	// logged.  If it's zero or one, all requests are logged.
+	SampleRate uint `yaml:"sample_rate"`
+
 	// Enabled defines if the query log is enabled.
 	Enabled bool `yaml:"enabled"`
 
+	// Archive is the configuration for archiving the rotated query log files
+	// to an S3-compatible bucket.
+	Archive *querylog.ArchiveConfig `yaml:"archive,omitempty"`
+
+	// ClickHouse is the configuration for streaming the query log entries
+	// into ClickHouse.
+	ClickHouse *querylog.ClickHouseConfig `yaml:"clickhouse,omitempty"`
+
+	// Syslog is the configuration for sending the query log entries to a
+	// syslog server.
+	Syslog *querylog.SyslogConfig `yaml:"syslog,omitempty"`
+
+	// Aggregates is the opt-in configuration for sharing the anonymous
+	// aggregates of the blocked requests.
+	Aggregates *querylog.AggregatesConfig `yaml:"aggregates,omitempty"`
+
 	// FileEnabled defines, if the query log is written to the file.
 	FileEnabled bool `yaml:"file_enabled"`
 }
@@ -328,155 +452,233 @@ const (
 // config is the global configuration structure.
 //
 // TODO(a.garipov, e.burkov): This global is awful and must be removed.
-var config = &configuration{
-	AuthAttempts: 5,
-	AuthBlockMin: 15,
-	HTTPConfig: httpConfig{
-		Address:    netip.AddrPortFrom(netip.IPv4Unspecified(), 3000),
-		SessionTTL: timeutil.Duration{Duration: 30 * timeutil.Day},
-		Pprof: &httpPprofConfig{
-			Enabled: false,
-			Port:    6060,
+var config = newDefaultConfig()
+
+// newDefaultConfig returns a new configuration structure with the default
+// values.
+func newDefaultConfig() (conf *configuration) {
+	return &configuration{
+		AuthAttempts: 5,
+		AuthBlockMin: 15,
+		PasswordHashing: &passwordHashingConfig{
+			KDF: kdfAlgorithmBcrypt,
+			Argon2id: argon2idConfig{
+				Memory:      19 * 1024,
+				Iterations:  2,
+				Parallelism: 1,
+			},
+			BcryptCost: bcrypt.DefaultCost,
+		},
+		WebAuthn: &webAuthnConfig{
+			PasswordFallback: passwordFallbackAlways,
+			Enabled:          false,
+		},
+		HTTPConfig: httpConfig{
+			Address:    netip.AddrPortFrom(netip.IPv4Unspecified(), 3000),
+			SessionTTL: timeutil.Duration{Duration: 30 * timeutil.Day},
+			SessionBinding: &sessionBindingConfig{
+				Mode:          sessionBindingModeAlert,
+				IPv4PrefixLen: 24,
+				IPv6PrefixLen: 56,
+			},
+			SecurityHeaders: &securityHeadersConfig{
+				Enabled: true,
+			},
+			Routes: &webRoutesConfig{
+				DoH: &webRouteConfig{},
+				Web: &webRouteConfig{},
+			},
+			Pprof: &httpPprofConfig{
+				Enabled: false,
+				Port:    6060,
+			},
+		},
+		DNS: dnsConfig{
+			BindHosts: []netip.Addr{netip.IPv4Unspecified()},
+			Port:      defaultPortDNS,
+			Config: dnsforward.Config{
+				Ratelimit:              20,
+				RatelimitSubnetLenIPv4: 24,
+				RatelimitSubnetLenIPv6: 56,
+				RefuseAny:              true,
+				UpstreamMode:           dnsforward.UpstreamModeLoadBalance,
+				HandleDDR:              true,
+				FastestTimeout: timeutil.Duration{
+					Duration: fastip.DefaultPingWaitTimeout,
+				},
+
+				TrustedProxies: []netutil.Prefix{{
+					Prefix: netip.MustParsePrefix("127.0.0.0/8"),
+				}, {
+					Prefix: netip.MustParsePrefix("::1/128"),
+				}},
+				CacheSize: 4 * 1024 * 1024,
+
+				EDNSClientSubnet: &dnsforward.EDNSClientSubnet{
+					CustomIP:  netip.Addr{},
+					Enabled:   false,
+					UseCustom: false,
+				},
+
+				RebindingProtection: &rebinding.Config{
+					AllowedDomains: []string{"plex.direct"},
+					Enabled:        false,
+				},
+
+				UpstreamResponseLimits: &dnsforward.UpstreamResponseLimits{
+					MaxSize:       dns.MaxMsgSize,
+					MaxRecords:    1000,
+					MaxCNAMEChain: 16,
+				},
+
+				// set default maximum concurrent queries to 300
+				// we introduced a default limit due to this:
+				// https://github.com/AdguardTeam/AdGuardHome/issues/2015#issuecomment-674041912
+				// was later increased to 300 due to https://github.com/AdguardTeam/AdGuardHome/issues/2257
+				MaxGoroutines: 300,
+			},
+			UsePrivateRDNS:      true,
+			DiscoverPrivateRDNS: false,
+			ServePlainDNS:       true,
+			HostsFileEnabled:    true,
+			DrainTimeout:        timeutil.Duration{Duration: 5 * time.Second},
+		},
+		TLS: tlsConfigSettings{
+			PortHTTPS:       defaultPortHTTPS,
+			PortDNSOverTLS:  defaultPortTLS, // needs to be passed through to dnsproxy
+			PortDNSOverQUIC: defaultPortQUIC,
+			ExpiryAlertDays: []uint{30, 14, 7, 1},
+		},
+		QueryLog: queryLogConfig{
+			Enabled:     true,
+			FileEnabled: true,
+			Interval:    timeutil.Duration{Duration: 90 * timeutil.Day},
+			MemSize:     1000,
+			Ignored:     []string{},
+		},
+		Stats: statsConfig{
+			Enabled:  true,
+			Interval: timeutil.Duration{Duration: 1 * timeutil.Day},
+			Ignored:  []string{},
 		},
-	},
-	DNS: dnsConfig{
-		BindHosts: []netip.Addr{netip.IPv4Unspecified()},
-		Port:      defaultPortDNS,
-		Config: dnsforward.Config{
-			Ratelimit:              20,
-			RatelimitSubnetLenIPv4: 24,
-			RatelimitSubnetLenIPv6: 56,
-			RefuseAny:              true,
-			UpstreamMode:           dnsforward.UpstreamModeLoadBalance,
-			HandleDDR:              true,
-			FastestTimeout: timeutil.Duration{
-				Duration: fastip.DefaultPingWaitTimeout,
+		// NOTE: Keep these parameters in sync with the one put into
+		// client/src/helpers/filters/filters.ts by scripts/vetted-filters.
+		//
+		// TODO(a.garipov): Think of a way to make scripts/vetted-filters update
+		// these as well if necessary.
+		Filters: []filtering.FilterYAML{{
+			Filter:  filtering.Filter{ID: 1},
+			Enabled: true,
+			URL:     "https://adguardteam.github.io/HostlistsRegistry/assets/filter_1.txt",
+			Name:    "AdGuard DNS filter",
+		}, {
+			Filter:  filtering.Filter{ID: 2},
+			Enabled: false,
+			URL:     "https://adguardteam.github.io/HostlistsRegistry/assets/filter_2.txt",
+			Name:    "AdAway Default Blocklist",
+		}},
+		Filtering: &filtering.Config{
+			ProtectionEnabled:  true,
+			BlockingMode:       filtering.BlockingModeDefault,
+			BlockedResponseTTL: 10, // in seconds
+
+			FilteringEnabled:           true,
+			FiltersUpdateIntervalHours: 24,
+
+			ParentalEnabled:     false,
+			SafeBrowsingEnabled: false,
+
+			SafeBrowsingCacheSize: 1 * 1024 * 1024,
+			SafeSearchCacheSize:   1 * 1024 * 1024,
+			ParentalCacheSize:     1 * 1024 * 1024,
+			CacheTime:             30,
+
+			SafeSearchConf: filtering.SafeSearchConfig{
+				Enabled:    false,
+				Bing:       true,
+				DuckDuckGo: true,
+				Ecosia:     true,
+				Google:     true,
+				Pixabay:    true,
+				Yandex:     true,
+				YouTube:    true,
 			},
 
-			TrustedProxies: []netutil.Prefix{{
-				Prefix: netip.MustParsePrefix("127.0.0.0/8"),
-			}, {
-				Prefix: netip.MustParsePrefix("::1/128"),
-			}},
-			CacheSize: 4 * 1024 * 1024,
-
-			EDNSClientSubnet: &dnsforward.EDNSClientSubnet{
-				CustomIP:  netip.Addr{},
-				Enabled:   false,
-				UseCustom: false,
+			BlockedServices: &filtering.BlockedServices{
+				Schedule: schedule.EmptyWeekly(),
+				IDs:      []string{},
 			},
 
-			// set default maximum concurrent queries to 300
-			// we introduced a default limit due to this:
-			// https://github.com/AdguardTeam/AdGuardHome/issues/2015#issuecomment-674041912
-			// was later increased to 300 due to https://github.com/AdguardTeam/AdGuardHome/issues/2257
-			MaxGoroutines: 300,
+			ParentalBlockHost:     defaultParentalBlockHost,
+			SafeBrowsingBlockHost: defaultSafeBrowsingBlockHost,
+
+			Canary: filtering.CanaryConfig{
+				Clients:            []string{},
+				Duration:           timeutil.Duration{Duration: 24 * time.Hour},
+				MaxFailureIncrease: 0.05,
+				MinRequests:        100,
+				MaxUnblocks:        2,
+				Enabled:            false,
+			},
 		},
-		UpstreamTimeout:  timeutil.Duration{Duration: dnsforward.DefaultTimeout},
-		UsePrivateRDNS:   true,
-		ServePlainDNS:    true,
-		HostsFileEnabled: true,
-	},
-	TLS: tlsConfigSettings{
-		PortHTTPS:       defaultPortHTTPS,
-		PortDNSOverTLS:  defaultPortTLS, // needs to be passed through to dnsproxy
-		PortDNSOverQUIC: defaultPortQUIC,
-	},
-	QueryLog: queryLogConfig{
-		Enabled:     true,
-		FileEnabled: true,
-		Interval:    timeutil.Duration{Duration: 90 * timeutil.Day},
-		MemSize:     1000,
-		Ignored:     []string{},
-	},
-	Stats: statsConfig{
-		Enabled:  true,
-		Interval: timeutil.Duration{Duration: 1 * timeutil.Day},
-		Ignored:  []string{},
-	},
-	// NOTE: Keep these parameters in sync with the one put into
-	// client/src/helpers/filters/filters.ts by scripts/vetted-filters.
-	//
-	// TODO(a.garipov): Think of a way to make scripts/vetted-filters update
-	// these as well if necessary.
-	Filters: []filtering.FilterYAML{{
-		Filter:  filtering.Filter{ID: 1},
-		Enabled: true,
-		URL:     "https://adguardteam.github.io/HostlistsRegistry/assets/filter_1.txt",
-		Name:    "AdGuard DNS filter",
-	}, {
-		Filter:  filtering.Filter{ID: 2},
-		Enabled: false,
-		URL:     "https://adguardteam.github.io/HostlistsRegistry/assets/filter_2.txt",
-		Name:    "AdAway Default Blocklist",
-	}},
-	Filtering: &filtering.Config{
-		ProtectionEnabled:  true,
-		BlockingMode:       filtering.BlockingModeDefault,
-		BlockedResponseTTL: 10, // in seconds
-
-		FilteringEnabled:           true,
-		FiltersUpdateIntervalHours: 24,
-
-		ParentalEnabled:     false,
-		SafeBrowsingEnabled: false,
-
-		SafeBrowsingCacheSize: 1 * 1024 * 1024,
-		SafeSearchCacheSize:   1 * 1024 * 1024,
-		ParentalCacheSize:     1 * 1024 * 1024,
-		CacheTime:             30,
-
-		SafeSearchConf: filtering.SafeSearchConfig{
-			Enabled:    false,
-			Bing:       true,
-			DuckDuckGo: true,
-			Ecosia:     true,
-			Google:     true,
-			Pixabay:    true,
-			Yandex:     true,
-			YouTube:    true,
+		DHCP: &dhcpd.ServerConfig{
+			LocalDomainName:    "lan",
+			PoolAlertThreshold: dhcpd.DefaultPoolAlertThreshold,
+			Conf4: dhcpd.V4ServerConf{
+				LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
+				ICMPTimeout:   dhcpd.DefaultDHCPTimeoutICMP,
+			},
+			Conf6: dhcpd.V6ServerConf{
+				LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
+			},
 		},
-
-		BlockedServices: &filtering.BlockedServices{
-			Schedule: schedule.EmptyWeekly(),
-			IDs:      []string{},
+		Clients: &clientsConfig{
+			Sources: &clientSourcesConfig{
+				WHOIS:     true,
+				ARP:       true,
+				RDNS:      true,
+				DHCP:      true,
+				HostsFile: true,
+			},
 		},
-
-		ParentalBlockHost:     defaultParentalBlockHost,
-		SafeBrowsingBlockHost: defaultSafeBrowsingBlockHost,
-	},
-	DHCP: &dhcpd.ServerConfig{
-		LocalDomainName: "lan",
-		Conf4: dhcpd.V4ServerConf{
-			LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
-			ICMPTimeout:   dhcpd.DefaultDHCPTimeoutICMP,
+		Inventory: &inventoryConfig{
+			Interval: timeutil.Duration{Duration: 1 * time.Hour},
+			Enabled:  false,
+		},
+		Events: &eventsConfig{
+			DiskFreeMin: 100 * datasize.MB,
+			Size:        1000,
 		},
-		Conf6: dhcpd.V6ServerConf{
-			LeaseDuration: dhcpd.DefaultDHCPLeaseTTL,
+		Log: logSettings{
+			Enabled:    true,
+			File:       "",
+			MaxBackups: 0,
+			MaxSize:    100,
+			MaxAge:     3,
+			Compress:   false,
+			LocalTime:  false,
+			Verbose:    false,
 		},
-	},
-	Clients: &clientsConfig{
-		Sources: &clientSourcesConfig{
-			WHOIS:     true,
-			ARP:       true,
-			RDNS:      true,
-			DHCP:      true,
-			HostsFile: true,
+		OSConfig: &osConfig{
+			OpenWrt: &openWrtConfig{
+				LANInterface: "lan",
+			},
+			PFTable: &pfTableConfig{
+				Name: "adguardhome_disallowed",
+			},
+		},
+		// Don't query any NTP servers by default, since that's a connection to
+		// a third party the user hasn't agreed to.  The clock is then only
+		// compared with the build time.
+		TimeSanity: &timeSanityConfig{
+			NTPServers: []string{},
+			MaxSkew:    timeutil.Duration{Duration: 5 * time.Minute},
+			Enabled:    true,
 		},
-	},
-	Log: logSettings{
-		Enabled:    true,
-		File:       "",
-		MaxBackups: 0,
-		MaxSize:    100,
-		MaxAge:     3,
-		Compress:   false,
-		LocalTime:  false,
-		Verbose:    false,
-	},
-	OSConfig:      &osConfig{},
-	SchemaVersion: configmigrate.LastSchemaVersion,
-	Theme:         ThemeAuto,
+		Timeouts:      newDefaultTimeoutsConfig(),
+		SchemaVersion: configmigrate.LastSchemaVersion,
+		Theme:         ThemeAuto,
+	}
 }
 
 // configFilePath returns the absolute path to the symlink-evaluated path to the
@@ -517,21 +719,19 @@ func validateBindHosts(conf *configuration) (err error) {
 }
 
 // parseConfig loads configuration from the YAML file, upgrading it if
-// necessary.
-func parseConfig() (err error) {
+// necessary.  If dryRun is true, the upgraded configuration isn't written and
+// the changes are printed to stdout instead.
+func parseConfig(dryRun bool) (err error) {
 	// Do the upgrade if necessary.
 	config.fileData, err = readConfigFile()
 	if err != nil {
 		return err
 	}
 
-	migrator := configmigrate.New(&configmigrate.Config{
-		WorkingDir: Context.workDir,
-		DataDir:    Context.getDataDir(),
-	})
+	oldData := config.fileData
 
 	var upgraded bool
-	config.fileData, upgraded, err = migrator.Migrate(
+	config.fileData, upgraded, err = newConfigMigrator().Migrate(
 		config.fileData,
 		configmigrate.LastSchemaVersion,
 	)
@@ -539,59 +739,211 @@ func parseConfig() (err error) {
 		// Don't wrap the error, because it's informative enough as is.
 		return err
 	} else if upgraded {
-		confPath := configFilePath()
-		log.Debug("writing config file %q after config upgrade", confPath)
-
-		err = maybe.WriteFile(confPath, config.fileData, aghos.DefaultPermFile)
+		err = writeUpgradedConfig(oldData, config.fileData, dryRun)
 		if err != nil {
-			return fmt.Errorf("writing new config: %w", err)
+			// Don't wrap the error, because it's informative enough as is.
+			return err
 		}
 	}
 
-	err = yaml.Unmarshal(config.fileData, &config)
+	err = decodeConfig(config, config.fileData)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	// Do not wrap the error because it's informative enough as is.
+	return setContextTLSCipherIDs()
+}
+
+// decodeConfig merges the included configuration files into the upgraded
+// configuration file contents data, decodes the result into conf, and
+// validates it.
+func decodeConfig(conf *configuration, data []byte) (err error) {
+	data, conf.includes, err = mergeIncludes(data, filepath.Dir(configFilePath()))
+	if err != nil {
+		return fmt.Errorf("merging included config files: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, conf)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return err
 	}
 
-	err = validateConfig()
+	err = validateConfig(conf)
 	if err != nil {
 		return err
 	}
 
-	if config.DNS.UpstreamTimeout.Duration == 0 {
-		config.DNS.UpstreamTimeout = timeutil.Duration{Duration: dnsforward.DefaultTimeout}
+	if conf.Timeouts == nil {
+		conf.Timeouts = newDefaultTimeoutsConfig()
 	}
 
-	// Do not wrap the error because it's informative enough as is.
-	return setContextTLSCipherIDs()
+	err = conf.Timeouts.validate()
+	if err != nil {
+		return fmt.Errorf("timeouts: %w", err)
+	}
+
+	return nil
+}
+
+// newConfigMigrator returns a new configuration file migrator for the current
+// working and data directories.
+func newConfigMigrator() (m *configmigrate.Migrator) {
+	return configmigrate.New(&configmigrate.Config{
+		WorkingDir: Context.workDir,
+		DataDir:    Context.getDataDir(),
+	})
+}
+
+// writeUpgradedConfig writes the upgraded configuration file contents
+// newData, backing up the original ones, oldData, first.  If dryRun is true, it
+// only prints the difference between them to stdout.
+func writeUpgradedConfig(oldData, newData []byte, dryRun bool) (err error) {
+	confPath := configFilePath()
+	if dryRun {
+		// Normalize the original contents the same way the migration does, so
+		// that the diff only contains the actual changes.
+		oldData, err = normalizeYAML(oldData)
+		if err != nil {
+			return fmt.Errorf("normalizing config: %w", err)
+		}
+
+		diff, diffErr := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(oldData)),
+			B:        difflib.SplitLines(string(newData)),
+			FromFile: confPath,
+			ToFile:   confPath + " (upgraded)",
+			Context:  3,
+		})
+		if diffErr != nil {
+			return fmt.Errorf("generating config diff: %w", diffErr)
+		}
+
+		_, err = io.WriteString(os.Stdout, diff)
+		if err != nil {
+			return fmt.Errorf("printing config diff: %w", err)
+		}
+
+		return nil
+	}
+
+	err = backupConfigFile(confPath, oldData)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	log.Debug("writing config file %q after config upgrade", confPath)
+
+	err = maybe.WriteFile(confPath, newData, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing new config: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeYAML returns data re-encoded with the sorted keys and the indentation
+// used by [configmigrate.Migrator].
+func normalizeYAML(data []byte) (normData []byte, err error) {
+	obj := map[string]any{}
+	err = yaml.Unmarshal(data, &obj)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(obj)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// backupConfigFile writes the configuration file contents data next to the
+// configuration file at confPath, naming it after the schema version of data,
+// so that it could be restored after a failed update.
+func backupConfigFile(confPath string, data []byte) (err error) {
+	ver, err := configmigrate.SchemaVersion(data)
+	if err != nil {
+		return fmt.Errorf("backing up config: %w", err)
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", confPath, ver)
+	log.Info("backing up config file to %q", backupPath)
+
+	err = maybe.WriteFile(backupPath, data, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("backing up config: %w", err)
+	}
+
+	return nil
+}
+
+// downgradeConfigFile downgrades the configuration file one schema version
+// down, backing up the original one first.
+func downgradeConfigFile() (err error) {
+	data, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	newData, target, err := newConfigMigrator().Downgrade(data)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	confPath := configFilePath()
+	err = backupConfigFile(confPath, data)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	log.Info("writing config file %q downgraded to schema version %d", confPath, target)
+
+	err = maybe.WriteFile(confPath, newData, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing downgraded config: %w", err)
+	}
+
+	return nil
 }
 
 // validateConfig returns error if the configuration is invalid.
-func validateConfig() (err error) {
-	err = validateBindHosts(config)
+func validateConfig(conf *configuration) (err error) {
+	err = validateBindHosts(conf)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return err
 	}
 
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
-	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
+	addPorts(tcpPorts, tcpPort(conf.HTTPConfig.Address.Port()))
 
 	udpPorts := aghalg.UniqChecker[udpPort]{}
-	addPorts(udpPorts, udpPort(config.DNS.Port))
+	addPorts(udpPorts, udpPort(conf.DNS.Port))
 
-	if config.TLS.Enabled {
+	if conf.TLS.Enabled {
 		addPorts(
 			tcpPorts,
-			tcpPort(config.TLS.PortHTTPS),
-			tcpPort(config.TLS.PortDNSOverTLS),
-			tcpPort(config.TLS.PortDNSCrypt),
+			tcpPort(conf.TLS.PortHTTPS),
+			tcpPort(conf.TLS.PortDNSOverTLS),
+			tcpPort(conf.TLS.PortDNSCrypt),
 		)
 
 		// TODO(e.burkov):  Consider adding a udpPort with the same value when
 		// we add support for HTTP/3 for web admin interface.
-		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
+		addPorts(udpPorts, udpPort(conf.TLS.PortDNSOverQUIC))
 	}
 
 	if err = tcpPorts.Validate(); err != nil {
@@ -600,8 +952,8 @@ func validateConfig() (err error) {
 		return fmt.Errorf("validating udp ports: %w", err)
 	}
 
-	if !filtering.ValidateUpdateIvl(config.Filtering.FiltersUpdateIntervalHours) {
-		config.Filtering.FiltersUpdateIntervalHours = 24
+	if !filtering.ValidateUpdateIvl(conf.Filtering.FiltersUpdateIntervalHours) {
+		conf.Filtering.FiltersUpdateIntervalHours = 24
 	}
 
 	return nil
@@ -666,6 +1018,7 @@ func (c *configuration) write() (err error) {
 		config.QueryLog.FileEnabled = dc.FileEnabled
 		config.QueryLog.Interval = timeutil.Duration{Duration: dc.RotationIvl}
 		config.QueryLog.MemSize = dc.MemSize
+		config.QueryLog.SampleRate = dc.SampleRate
 		config.QueryLog.Ignored = dc.Ignored.Values()
 	}
 
@@ -674,6 +1027,7 @@ func (c *configuration) write() (err error) {
 		config.Filters = config.Filtering.Filters
 		config.WhitelistFilters = config.Filtering.WhitelistFilters
 		config.UserRules = config.Filtering.UserRules
+		config.UserRulesMeta = config.Filtering.UserRulesMeta
 	}
 
 	if s := Context.dnsServer; s != nil {
@@ -694,8 +1048,20 @@ func (c *configuration) write() (err error) {
 		Context.dhcpServer.WriteDiskConfig(config.DHCP)
 	}
 
+	if Context.maintenance != nil {
+		config.Maintenance = Context.maintenance.config()
+	}
+
 	config.Clients.Persistent = Context.clients.forConfig()
+	config.Clients.CustomTags = Context.clients.storage.CustomTags()
+	config.Clients.TagRules = tagRulesToObjects(Context.clients.storage.TagRules())
+
+	return writeConfigFile()
+}
 
+// writeConfigFile encodes the global configuration and writes it to the
+// configuration file.
+func writeConfigFile() (err error) {
 	confPath := configFilePath()
 	log.Debug("writing config file %q", confPath)
 
@@ -703,7 +1069,15 @@ func (c *configuration) write() (err error) {
 	enc := yaml.NewEncoder(buf)
 	enc.SetIndent(2)
 
-	err = enc.Encode(config)
+	var doc any = config
+	if config.includes != nil {
+		doc, err = config.includes.exclude(config)
+		if err != nil {
+			return fmt.Errorf("generating config file: %w", err)
+		}
+	}
+
+	err = enc.Encode(doc)
 	if err != nil {
 		return fmt.Errorf("generating config file: %w", err)
 	}
@@ -0,0 +1,370 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// mergeIncludes merges the configuration fragments from the files matching the
+// patterns from the include field of configuration file data into it.  The
+// files are merged in the order of patterns, and the files matching a single
+// pattern are merged in lexical order.  Relative patterns are resolved against
+// confDir.  data is returned as is if there are no patterns.
+//
+// The fragments take precedence over the configuration file and the fragments
+// merged before them:
+//
+//   - objects are merged recursively;
+//   - items of arrays are appended, unless there is an equal item already;
+//   - any other values are replaced.
+//
+// The fragments must have the current schema version and mustn't include other
+// files.  incl is nil if there are no patterns, otherwise it's used to leave
+// the merged values out when writing the configuration file, see
+// [configIncludes.exclude].
+func mergeIncludes(
+	data []byte,
+	confDir string,
+) (merged []byte, incl *configIncludes, err error) {
+	conf := map[string]any{}
+	err = yaml.Unmarshal(data, &conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	patterns, err := includePatterns(conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	} else if len(patterns) == 0 {
+		return data, nil, nil
+	}
+
+	incl = &configIncludes{
+		main:  map[string]any{},
+		frags: map[string]any{},
+	}
+
+	// Unmarshal the data once again instead of copying conf deeply.
+	err = yaml.Unmarshal(data, &incl.main)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	for _, pat := range patterns {
+		if !filepath.IsAbs(pat) {
+			pat = filepath.Join(confDir, pat)
+		}
+
+		var paths []string
+		paths, err = filepath.Glob(pat)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pattern %q: %w", pat, err)
+		}
+
+		for _, p := range paths {
+			err = mergeInclude(conf, incl.frags, p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("file %q: %w", p, err)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+
+	err = enc.Encode(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding merged config: %w", err)
+	}
+
+	return buf.Bytes(), incl, nil
+}
+
+// includePatterns returns the value of the include field of conf.
+func includePatterns(conf map[string]any) (patterns []string, err error) {
+	val, ok := conf["include"]
+	if !ok || val == nil {
+		return nil, nil
+	}
+
+	vals, ok := val.([]any)
+	if !ok {
+		return nil, fmt.Errorf("include: expected array, got %T", val)
+	}
+
+	for i, v := range vals {
+		var pat string
+		pat, ok = v.(string)
+		if !ok {
+			return nil, fmt.Errorf("include: at index %d: expected string, got %T", i, v)
+		}
+
+		patterns = append(patterns, pat)
+	}
+
+	return patterns, nil
+}
+
+// mergeInclude merges the configuration fragment from the file at path into
+// conf and frags.
+func mergeInclude(conf, frags map[string]any, path string) (err error) {
+	log.Debug("merging included config file %q", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	frag := map[string]any{}
+	err = yaml.Unmarshal(data, &frag)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if _, ok := frag["include"]; ok {
+		return errors.Error("nested includes are not supported")
+	} else if v, ok := frag["schema_version"]; ok && v != conf["schema_version"] {
+		return fmt.Errorf("schema version %v doesn't match %v", v, conf["schema_version"])
+	}
+
+	mergeYAMLObjects(conf, frag)
+
+	// Unmarshal the data once again, since merging doesn't copy the values.
+	frag = map[string]any{}
+	err = yaml.Unmarshal(data, &frag)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	mergeYAMLObjects(frags, frag)
+
+	return nil
+}
+
+// mergeYAMLObjects merges src into dst according to the rules described in
+// [mergeIncludes].
+func mergeYAMLObjects(dst, src map[string]any) {
+	for k, srcVal := range src {
+		switch srcVal := srcVal.(type) {
+		case map[string]any:
+			dstObj, ok := dst[k].(map[string]any)
+			if ok {
+				mergeYAMLObjects(dstObj, srcVal)
+
+				continue
+			}
+		case []any:
+			dstArr, ok := dst[k].([]any)
+			if ok {
+				dst[k] = appendNew(dstArr, srcVal)
+
+				continue
+			}
+		}
+
+		dst[k] = srcVal
+	}
+}
+
+// appendNew appends the items of src not already present in dst to it.
+func appendNew(dst, src []any) (res []any) {
+	res = dst
+
+	// TODO:  Use something more efficient than reflect.DeepEqual for
+	// large lists.
+	for _, srcVal := range src {
+		found := false
+		for _, dstVal := range dst {
+			if reflect.DeepEqual(srcVal, dstVal) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			res = append(res, srcVal)
+		}
+	}
+
+	return res
+}
+
+// configIncludes are the values of the configuration merged from the included
+// files.
+type configIncludes struct {
+	// main is the configuration file contents without the included fragments.
+	main map[string]any
+
+	// frags are the included fragments merged together.
+	frags map[string]any
+}
+
+// exclude returns the YAML document of conf without the values merged from the
+// included files, so that they aren't written into the configuration file:
+//
+//   - the values replaced by the fragments are restored from the configuration
+//     file or removed, if they aren't there;
+//   - the items of arrays appended by the fragments are removed.
+//
+// The changes of such values made after loading the configuration are
+// discarded, since the fragments override them on the next load anyway.
+func (incl *configIncludes) exclude(conf any) (doc *yaml.Node, err error) {
+	doc = &yaml.Node{}
+	err = doc.Encode(conf)
+	if err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+
+	err = excludeYAMLObject(doc, incl.main, incl.frags)
+	if err != nil {
+		return nil, fmt.Errorf("excluding included values: %w", err)
+	}
+
+	return doc, nil
+}
+
+// excludeYAMLObject removes the values of frags from the mapping node obj,
+// restoring them from main, where present.
+func excludeYAMLObject(obj *yaml.Node, main, frags map[string]any) (err error) {
+	content := obj.Content[:0]
+	for i := 0; i+1 < len(obj.Content); i += 2 {
+		keyNode, valNode := obj.Content[i], obj.Content[i+1]
+
+		fragVal, ok := frags[keyNode.Value]
+		if !ok {
+			content = append(content, keyNode, valNode)
+
+			continue
+		}
+
+		mainVal, inMain := main[keyNode.Value]
+		valNode, err = excludeYAMLValue(valNode, mainVal, fragVal, inMain)
+		if err != nil {
+			return fmt.Errorf("%s: %w", keyNode.Value, err)
+		}
+
+		if valNode != nil {
+			content = append(content, keyNode, valNode)
+		}
+	}
+
+	obj.Content = content
+
+	return nil
+}
+
+// excludeYAMLValue returns the node val without the value merged from
+// fragVal.  mainVal is the value from the configuration file, inMain is true if
+// it's there.  res is nil if the value must be removed.
+func excludeYAMLValue(
+	val *yaml.Node,
+	mainVal any,
+	fragVal any,
+	inMain bool,
+) (res *yaml.Node, err error) {
+	merged := true
+	switch fragVal := fragVal.(type) {
+	case map[string]any:
+		if val.Kind == yaml.MappingNode {
+			mainObj, _ := mainVal.(map[string]any)
+			err = excludeYAMLObject(val, mainObj, fragVal)
+		} else {
+			merged = false
+		}
+	case []any:
+		if val.Kind == yaml.SequenceNode {
+			mainArr, _ := mainVal.([]any)
+			err = excludeYAMLItems(val, mainArr, fragVal)
+		} else {
+			merged = false
+		}
+	default:
+		merged = false
+	}
+
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if merged && (inMain || len(val.Content) > 0) {
+		return val, nil
+	} else if !inMain {
+		return nil, nil
+	}
+
+	res = &yaml.Node{}
+	err = res.Encode(mainVal)
+	if err != nil {
+		return nil, fmt.Errorf("encoding value: %w", err)
+	}
+
+	return res, nil
+}
+
+// excludeYAMLItems removes the items of fragArr not present in mainArr from the
+// sequence node arr.
+func excludeYAMLItems(arr *yaml.Node, mainArr, fragArr []any) (err error) {
+	content := arr.Content[:0]
+	for _, itemNode := range arr.Content {
+		var item any
+		err = itemNode.Decode(&item)
+		if err != nil {
+			return fmt.Errorf("decoding item: %w", err)
+		}
+
+		if slices.ContainsFunc(mainArr, equalFunc(item)) ||
+			!slices.ContainsFunc(fragArr, matchFunc(item)) {
+			content = append(content, itemNode)
+		}
+	}
+
+	arr.Content = content
+
+	return nil
+}
+
+// equalFunc returns a function reporting whether its argument is deeply equal
+// to v.
+func equalFunc(v any) (f func(other any) (ok bool)) {
+	return func(other any) (ok bool) {
+		return reflect.DeepEqual(v, other)
+	}
+}
+
+// matchFunc returns a function reporting whether v matches its argument, which
+// is a value from an included fragment.  The objects match if v contains all
+// the properties of the fragment's one, since the encoded objects may contain
+// the properties omitted from the fragments, e.g. the ones with default
+// values.
+func matchFunc(v any) (f func(fragVal any) (ok bool)) {
+	return func(fragVal any) (ok bool) {
+		obj, isObj := v.(map[string]any)
+		fragObj, isFragObj := fragVal.(map[string]any)
+		if !isObj || !isFragObj {
+			return reflect.DeepEqual(v, fragVal)
+		}
+
+		for k, fv := range fragObj {
+			if !matchFunc(obj[k])(fv) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
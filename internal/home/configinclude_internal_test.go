@@ -0,0 +1,193 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestMergeIncludes(t *testing.T) {
+	const mainConf = `
+include:
+  - 'conf.d/*.yaml'
+dns:
+  port: 53
+  upstream_dns:
+    - 1.1.1.1
+user_rules:
+  - '||example.org^'
+schema_version: 29
+`
+
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, aghos.DefaultPermDir))
+
+	writeFrag := func(t *testing.T, name, data string) {
+		t.Helper()
+
+		err := os.WriteFile(filepath.Join(confDir, name), []byte(data), aghos.DefaultPermFile)
+		require.NoError(t, err)
+	}
+
+	writeFrag(t, "10-rules.yaml", `
+user_rules:
+  - '||example.org^'
+  - '||example.com^'
+`)
+	writeFrag(t, "20-dns.yaml", `
+dns:
+  port: 5353
+  upstream_dns:
+    - 8.8.8.8
+`)
+	writeFrag(t, "ignored.yml", `
+dns:
+  port: 1
+`)
+
+	merged, incl, err := mergeIncludes([]byte(mainConf), dir)
+	require.NoError(t, err)
+	require.NotNil(t, incl)
+
+	assert.YAMLEq(t, `
+include:
+  - 'conf.d/*.yaml'
+dns:
+  port: 5353
+  upstream_dns:
+    - 1.1.1.1
+    - 8.8.8.8
+user_rules:
+  - '||example.org^'
+  - '||example.com^'
+schema_version: 29
+`, string(merged))
+
+	t.Run("no_includes", func(t *testing.T) {
+		data := []byte("schema_version: 29\n")
+
+		merged, incl, err = mergeIncludes(data, dir)
+		require.NoError(t, err)
+
+		assert.Equal(t, data, merged)
+		assert.Nil(t, incl)
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		writeFrag(t, "30-nested.yaml", "include: ['other/*']\n")
+
+		_, _, err = mergeIncludes([]byte(mainConf), dir)
+		wantErr := `file "` + filepath.Join(confDir, "30-nested.yaml") +
+			`": nested includes are not supported`
+		testutil.AssertErrorMsg(t, wantErr, err)
+	})
+}
+
+func TestConfigIncludes_exclude(t *testing.T) {
+	const mainConf = `
+include:
+  - 'conf.d/*.yaml'
+dns:
+  port: 53
+  upstream_dns:
+    - 1.1.1.1
+users:
+  - name: admin
+    password: main-hash
+schema_version: 29
+`
+
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, aghos.DefaultPermDir))
+
+	err := os.WriteFile(filepath.Join(confDir, "10-secrets.yaml"), []byte(`
+dns:
+  port: 5353
+  upstream_dns:
+    - 8.8.8.8
+  bootstrap_dns:
+    - 9.9.9.9
+users:
+  - name: backup
+    password: secret-hash
+`), aghos.DefaultPermFile)
+	require.NoError(t, err)
+
+	_, incl, err := mergeIncludes([]byte(mainConf), dir)
+	require.NoError(t, err)
+	require.NotNil(t, incl)
+
+	type user struct {
+		Name     string `yaml:"name"`
+		Password string `yaml:"password"`
+		Disabled bool   `yaml:"disabled"`
+	}
+
+	type dnsConf struct {
+		UpstreamDNS  []string `yaml:"upstream_dns"`
+		BootstrapDNS []string `yaml:"bootstrap_dns"`
+		Port         int      `yaml:"port"`
+	}
+
+	// The configuration changed after loading: the port from the fragment is
+	// changed, an upstream and a user are added.
+	conf := &struct {
+		Include       []string `yaml:"include"`
+		DNS           dnsConf  `yaml:"dns"`
+		Users         []user   `yaml:"users"`
+		SchemaVersion int      `yaml:"schema_version"`
+	}{
+		Include: []string{"conf.d/*.yaml"},
+		DNS: dnsConf{
+			UpstreamDNS:  []string{"1.1.1.1", "8.8.8.8", "8.8.4.4"},
+			BootstrapDNS: []string{"9.9.9.9"},
+			Port:         5354,
+		},
+		Users: []user{{
+			Name:     "admin",
+			Password: "main-hash",
+		}, {
+			Name:     "backup",
+			Password: "secret-hash",
+		}, {
+			Name:     "new",
+			Password: "new-hash",
+		}},
+		SchemaVersion: 29,
+	}
+
+	doc, err := incl.exclude(conf)
+	require.NoError(t, err)
+
+	data, err := yaml.Marshal(doc)
+	require.NoError(t, err)
+
+	assert.YAMLEq(t, `
+include:
+  - 'conf.d/*.yaml'
+dns:
+  upstream_dns:
+    - 1.1.1.1
+    - 8.8.4.4
+  port: 53
+users:
+  - name: admin
+    password: main-hash
+    disabled: false
+  - name: new
+    password: new-hash
+    disabled: false
+schema_version: 29
+`, string(data))
+
+	// The order of the fields is preserved.
+	assert.Regexp(t, `(?s)^include:.*dns:.*users:.*schema_version:`, string(data))
+}
@@ -0,0 +1,196 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+)
+
+// lintID is the identifier of a kind of risky configuration.
+type lintID string
+
+// lintID values.
+const (
+	// lintIDOpenResolver means that the DNS server answers anyone on a public
+	// interface without rate limiting, so it may be abused for the
+	// amplification attacks.
+	lintIDOpenResolver lintID = "open_resolver"
+
+	// lintIDPlainHTTPAdmin means that the web interface is served over plain
+	// HTTP on a public interface, so the credentials may be intercepted.
+	lintIDPlainHTTPAdmin lintID = "plain_http_admin"
+
+	// lintIDWeakPasswordHash means that a password of a user is hashed with
+	// too weak parameters, so it may be brute-forced if the configuration file
+	// leaks.
+	lintIDWeakPasswordHash lintID = "weak_password_hash"
+)
+
+// lintSeverity is the severity of a configuration warning.
+type lintSeverity string
+
+// lintSeverity values.
+const (
+	lintSeverityWarning  lintSeverity = "warning"
+	lintSeverityCritical lintSeverity = "critical"
+)
+
+// lintWarningJSON is the JSON representation of a single risky configuration
+// setting.
+type lintWarningJSON struct {
+	// ID is the kind of the risky configuration.
+	ID lintID `json:"id"`
+
+	// Severity is the severity of the warning.
+	Severity lintSeverity `json:"severity"`
+
+	// Setting is the path of the configuration property to change to fix the
+	// warning.
+	Setting string `json:"setting"`
+
+	// Message is the human-readable description of the warning.
+	Message string `json:"message"`
+}
+
+// configLintJSON is the JSON representation of the result of linting the
+// configuration.
+type configLintJSON struct {
+	// Warnings are the risky configuration settings, if any.  It's never nil.
+	Warnings []*lintWarningJSON `json:"warnings"`
+}
+
+// lintConfigData is the part of the live configuration inspected by
+// [lintConfig].
+type lintConfigData struct {
+	// dns is the current configuration of the DNS server.  It must not be
+	// nil.
+	dns *dnsforward.Config
+
+	// tls is the current TLS configuration.  It must not be nil.
+	tls *tlsConfigSettings
+
+	// dnsBindHosts are the addresses the DNS server listens on.
+	dnsBindHosts []netip.Addr
+
+	// users are the users of the web interface.
+	users []webUser
+
+	// httpAddr is the address the web interface is served on.
+	httpAddr netip.AddrPort
+}
+
+// lintConfig returns the warnings about the risky combinations of settings in
+// conf.  conf must not be nil.
+func lintConfig(conf *lintConfigData) (warnings []*lintWarningJSON) {
+	warnings = []*lintWarningJSON{}
+
+	if slices.ContainsFunc(conf.dnsBindHosts, isExposedAddr) &&
+		allowsAnyClient(conf.dns.AllowedClients) &&
+		conf.dns.Ratelimit == 0 {
+		warnings = append(warnings, &lintWarningJSON{
+			ID:       lintIDOpenResolver,
+			Severity: lintSeverityCritical,
+			Setting:  "dns.ratelimit",
+			Message: "the dns server answers any client on a public interface " +
+				"without rate limiting",
+		})
+	}
+
+	httpsOnly := conf.tls.Enabled && conf.tls.ForceHTTPS && conf.tls.PortHTTPS != 0
+	if isExposedAddr(conf.httpAddr.Addr()) && !httpsOnly {
+		warnings = append(warnings, &lintWarningJSON{
+			ID:       lintIDPlainHTTPAdmin,
+			Severity: lintSeverityCritical,
+			Setting:  "tls.force_https",
+			Message: fmt.Sprintf(
+				"the web interface is served over plain http on %s",
+				conf.httpAddr,
+			),
+		})
+	}
+
+	for _, u := range conf.users {
+		if isWeakPasswordHash(u.PasswordHash) {
+			warnings = append(warnings, &lintWarningJSON{
+				ID:       lintIDWeakPasswordHash,
+				Severity: lintSeverityWarning,
+				Setting:  "users.password",
+				Message: fmt.Sprintf(
+					"the password of user %q is hashed with weak parameters",
+					u.Name,
+				),
+			})
+		}
+	}
+
+	return warnings
+}
+
+// isExposedAddr returns true if ip is unspecified or is a public unicast
+// address, so that the service listening on it may be reachable from the
+// internet.
+func isExposedAddr(ip netip.Addr) (ok bool) {
+	ip = ip.Unmap()
+
+	return ip.IsUnspecified() ||
+		(ip.IsGlobalUnicast() && !ip.IsPrivate())
+}
+
+// allowsAnyClient returns true if the allowed clients setting doesn't restrict
+// the access, that is if it's empty or contains a network covering all
+// addresses.
+func allowsAnyClient(allowed []string) (ok bool) {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(allowed, func(s string) (all bool) {
+		p, err := netip.ParsePrefix(s)
+
+		return err == nil && p.Bits() == 0
+	})
+}
+
+// handleConfigLint is the handler for the GET /control/config/lint HTTP API.
+func handleConfigLint(w http.ResponseWriter, r *http.Request) {
+	conf := &lintConfigData{
+		dns: &dnsforward.Config{},
+		tls: &tlsConfigSettings{},
+	}
+
+	if Context.dnsServer != nil {
+		Context.dnsServer.WriteDiskConfig(conf.dns)
+	}
+
+	if Context.tls != nil {
+		Context.tls.WriteDiskConfig(conf.tls)
+	}
+
+	if Context.auth != nil {
+		conf.users = Context.auth.usersList()
+	}
+
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		if Context.dnsServer == nil {
+			*conf.dns = config.DNS.Config
+		}
+
+		if Context.tls == nil {
+			*conf.tls = config.TLS
+		}
+
+		conf.dnsBindHosts = slices.Clone(config.DNS.BindHosts)
+		conf.httpAddr = config.HTTPConfig.Address
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, &configLintJSON{
+		Warnings: lintConfig(conf),
+	})
+}
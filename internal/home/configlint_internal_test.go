@@ -0,0 +1,135 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintConfig(t *testing.T) {
+	const (
+		// weakHash is the hash of "password" with the cost of 5.
+		weakHash = "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2"
+
+		// strongHash is the hash of "password" with the cost of 10.
+		strongHash = "$2a$10$Mq4I3v5Cz6fxLg9hQ3CZueLOPjzD7qs1O7Vqwgz6cHPskW6BJ1uWC"
+	)
+
+	var (
+		publicAddr  = netip.MustParseAddr("203.0.113.1")
+		privateAddr = netip.MustParseAddr("192.168.1.1")
+	)
+
+	// newConf returns the configuration with no warnings.
+	newConf := func() (conf *lintConfigData) {
+		return &lintConfigData{
+			dns: &dnsforward.Config{
+				Ratelimit: 20,
+			},
+			tls: &tlsConfigSettings{},
+			dnsBindHosts: []netip.Addr{
+				netip.IPv4Unspecified(),
+			},
+			users: []webUser{{
+				Name:         "admin",
+				PasswordHash: strongHash,
+			}},
+			httpAddr: netip.AddrPortFrom(privateAddr, 3000),
+		}
+	}
+
+	testCases := []struct {
+		modify func(conf *lintConfigData)
+		name   string
+		want   []lintID
+	}{{
+		modify: func(_ *lintConfigData) {},
+		name:   "safe",
+		want:   nil,
+	}, {
+		modify: func(conf *lintConfigData) { conf.dns.Ratelimit = 0 },
+		name:   "open_resolver",
+		want:   []lintID{lintIDOpenResolver},
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.dns.Ratelimit = 0
+			conf.dns.AllowedClients = []string{"0.0.0.0/0"}
+		},
+		name: "open_resolver_allowed_all",
+		want: []lintID{lintIDOpenResolver},
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.dns.Ratelimit = 0
+			conf.dns.AllowedClients = []string{"192.168.1.0/24"}
+		},
+		name: "no_ratelimit_allowed_clients",
+		want: nil,
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.dns.Ratelimit = 0
+			conf.dnsBindHosts = []netip.Addr{privateAddr}
+		},
+		name: "no_ratelimit_private",
+		want: nil,
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.httpAddr = netip.AddrPortFrom(netip.IPv4Unspecified(), 3000)
+		},
+		name: "plain_http_unspecified",
+		want: []lintID{lintIDPlainHTTPAdmin},
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.httpAddr = netip.AddrPortFrom(publicAddr, 80)
+			conf.tls.Enabled = true
+			conf.tls.PortHTTPS = 443
+		},
+		name: "plain_http_not_forced",
+		want: []lintID{lintIDPlainHTTPAdmin},
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.httpAddr = netip.AddrPortFrom(publicAddr, 80)
+			conf.tls.Enabled = true
+			conf.tls.ForceHTTPS = true
+			conf.tls.PortHTTPS = 443
+		},
+		name: "forced_https",
+		want: nil,
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.users = append(conf.users, webUser{
+				Name:         "weak",
+				PasswordHash: weakHash,
+			})
+		},
+		name: "weak_hash",
+		want: []lintID{lintIDWeakPasswordHash},
+	}, {
+		modify: func(conf *lintConfigData) {
+			conf.dns.Ratelimit = 0
+			conf.httpAddr = netip.AddrPortFrom(publicAddr, 80)
+			conf.users[0].PasswordHash = weakHash
+		},
+		name: "all",
+		want: []lintID{
+			lintIDOpenResolver,
+			lintIDPlainHTTPAdmin,
+			lintIDWeakPasswordHash,
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := newConf()
+			tc.modify(conf)
+
+			var got []lintID
+			for _, w := range lintConfig(conf) {
+				got = append(got, w.ID)
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
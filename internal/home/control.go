@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -111,18 +112,37 @@ type statusResponse struct {
 	// openapi.yaml declares.
 	IsDHCPAvailable bool `json:"dhcp_available"`
 	IsRunning       bool `json:"running"`
+
+	// Sandbox is true if AdGuard Home runs in the sandbox mode, so that the
+	// data are synthetic and DNS isn't served.
+	Sandbox bool `json:"sandbox"`
+
+	// Clock is the state of the system clock.  It's nil if the clock isn't
+	// checked.
+	Clock *clockStatusJSON `json:"clock,omitempty"`
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
-	dnsAddrs, err := collectDNSAddresses()
+	resp, err := newStatusResponse()
 	if err != nil {
 		// Don't add a lot of formatting, since the error is already
 		// wrapped by collectDNSAddresses.
-		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
 
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// newStatusResponse returns the current status of AdGuard Home.
+func newStatusResponse() (resp *statusResponse, err error) {
+	dnsAddrs, err := collectDNSAddresses()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
 	var (
 		fltConf                 *dnsforward.Config
 		protectionDisabledUntil *time.Time
@@ -134,7 +154,6 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		protectionEnabled, protectionDisabledUntil = Context.dnsServer.UpdatedProtectionStatus()
 	}
 
-	var resp statusResponse
 	func() {
 		config.RLock()
 		defer config.RUnlock()
@@ -147,7 +166,7 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 			protectionDisabledDuration = max(0, time.Until(*protectionDisabledUntil).Milliseconds())
 		}
 
-		resp = statusResponse{
+		resp = &statusResponse{
 			Version:                    version.Version(),
 			Language:                   config.Language,
 			DNSAddrs:                   dnsAddrs,
@@ -156,6 +175,8 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 			ProtectionDisabledDuration: protectionDisabledDuration,
 			ProtectionEnabled:          protectionEnabled,
 			IsRunning:                  isRunning(),
+			Sandbox:                    Context.sandbox,
+			Clock:                      clockStatus(),
 		}
 	}()
 
@@ -164,7 +185,19 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		resp.IsDHCPAvailable = Context.dhcpServer != nil
 	}
 
-	aghhttp.WriteJSONResponseOK(w, r, resp)
+	return resp, nil
+}
+
+// handleShutdown is the handler for the POST /control/shutdown HTTP API.  It
+// initiates the graceful shutdown of AdGuard Home, the same as SIGTERM does.
+func handleShutdown(w http.ResponseWriter, r *http.Request) {
+	log.Info("shutdown requested by %s", r.RemoteAddr)
+
+	aghhttp.OK(w)
+
+	// Send the signal asynchronously, since the shutdown waits for the HTTP
+	// handlers to finish.
+	go func() { Context.signals <- syscall.SIGTERM }()
 }
 
 // ------------------------
@@ -176,12 +209,22 @@ func registerControlHandlers(web *webAPI) {
 		postInstall(optionalAuth(web.handleVersionJSON)),
 	)
 	httpRegister(http.MethodPost, "/control/update", web.handleUpdate)
+	httpRegister(http.MethodPost, "/control/shutdown", handleShutdown)
+	httpRegister(http.MethodPost, "/control/reload", handleReload)
 
 	httpRegister(http.MethodGet, "/control/status", handleStatus)
+	httpRegister(http.MethodGet, "/control/config/lint", handleConfigLint)
 	httpRegister(http.MethodPost, "/control/i18n/change_language", handleI18nChangeLanguage)
 	httpRegister(http.MethodGet, "/control/i18n/current_language", handleI18nCurrentLanguage)
 	httpRegister(http.MethodGet, "/control/profile", handleGetProfile)
 	httpRegister(http.MethodPut, "/control/profile/update", handlePutProfile)
+	httpRegister(http.MethodPost, piholeImportPath, handleImportPihole)
+	httpRegister(http.MethodGet, dnsPortConflictPath, handleDNSPortConflict)
+	httpRegister(http.MethodPost, dnsPortTakeoverPath, handleDNSPortTakeover)
+
+	// No auth is necessary for the health check, since it's used by the
+	// service managers and the monitoring.
+	Context.mux.HandleFunc("/healthz", ensureGET(handleHealthz))
 
 	// No auth is necessary for DoH/DoT configurations
 	Context.mux.HandleFunc("/apple/doh.mobileconfig", postInstall(handleMobileConfigDoH))
@@ -196,6 +239,7 @@ func httpRegister(method, url string, handler http.HandlerFunc) {
 		return
 	}
 
+	handler = ensureRole(method, url, handler)
 	Context.mux.Handle(url, postInstallHandler(optionalAuthHandler(gziphandler.GzipHandler(ensureHandler(method, handler)))))
 }
 
@@ -212,7 +256,7 @@ func ensure(
 		defer func() { log.Debug("finished %s %s %s in %s", m, r.Host, u, time.Since(start)) }()
 
 		if m != method {
-			aghhttp.Error(r, w, http.StatusMethodNotAllowed, "only method %s is allowed", method)
+			writeError(r, w, http.StatusMethodNotAllowed, "only method %s is allowed", method)
 
 			return
 		}
@@ -250,7 +294,7 @@ func ensureContentType(w http.ResponseWriter, r *http.Request) (ok bool) {
 		// Assume that browsers always send a content type when submitting HTML
 		// forms and require no content type for requests with no body to make
 		// sure that the request comes from JavaScript.
-		aghhttp.Error(r, w, statusUnsup, "empty body with content-type %q not allowed", cType)
+		writeError(r, w, statusUnsup, "empty body with content-type %q not allowed", cType)
 
 		return false
 
@@ -261,7 +305,7 @@ func ensureContentType(w http.ResponseWriter, r *http.Request) (ok bool) {
 		return true
 	}
 
-	aghhttp.Error(r, w, statusUnsup, "only content-type %s is allowed", wantCType)
+	writeError(r, w, statusUnsup, "only content-type %s is allowed", wantCType)
 
 	return false
 }
@@ -326,7 +370,7 @@ func handleHTTPSRedirect(w http.ResponseWriter, r *http.Request) (proceed bool)
 
 	host, err := netutil.SplitHost(r.Host)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "bad host: %s", err)
+		writeError(r, w, http.StatusBadRequest, "bad host: %s", err)
 
 		return false
 	}
@@ -365,9 +409,11 @@ func handleHTTPSRedirect(w http.ResponseWriter, r *http.Request) (proceed bool)
 			return false
 		}
 
-		// TODO(a.garipov): Consider adding a configurable max-age.  Currently,
-		// the default is 365 days.
-		respHdr.Set(httphdr.StrictTransportSecurity, aghhttp.HdrValStrictTransportSecurity)
+		// Don't override the header with the max-age set in the security
+		// headers configuration.  Otherwise, the default is 365 days.
+		if respHdr.Get(httphdr.StrictTransportSecurity) == "" {
+			respHdr.Set(httphdr.StrictTransportSecurity, aghhttp.HdrValStrictTransportSecurity)
+		}
 	}
 
 	// Allow the frontend from the HTTP origin to send requests to the HTTPS
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 	"net/netip"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -49,7 +48,7 @@ func (web *webAPI) handleInstallGetAddresses(w http.ResponseWriter, r *http.Requ
 
 	ifaces, err := aghnet.GetValidNetInterfacesForWeb()
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "Couldn't get interfaces: %s", err)
+		writeError(r, w, http.StatusInternalServerError, "Couldn't get interfaces: %s", err)
 
 		return
 	}
@@ -156,8 +155,8 @@ func (req *checkConfReq) validateDNS(
 	// Try to fix automatically.
 	canAutofix = checkDNSStubListener()
 	if canAutofix && req.DNS.Autofix {
-		if derr := disableDNSStubListener(); derr != nil {
-			log.Error("disabling DNSStubListener: %s", err)
+		if derr := newDNSPortManager().takeOver(dnsPortOwnerResolved); derr != nil {
+			log.Error("disabling DNSStubListener: %s", derr)
 		}
 
 		err = aghnet.CheckPort("udp", netip.AddrPortFrom(req.DNS.IP, port))
@@ -173,7 +172,7 @@ func (web *webAPI) handleInstallCheckConfig(w http.ResponseWriter, r *http.Reque
 
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "decoding the request: %s", err)
+		writeError(r, w, http.StatusBadRequest, "decoding the request: %s", err)
 
 		return
 	}
@@ -269,40 +268,6 @@ DNSStubListener=no
 )
 const resolvConfPath = "/etc/resolv.conf"
 
-// Deactivate DNSStubListener
-func disableDNSStubListener() (err error) {
-	dir := filepath.Dir(resolvedConfPath)
-	err = os.MkdirAll(dir, 0o755)
-	if err != nil {
-		return fmt.Errorf("os.MkdirAll: %s: %w", dir, err)
-	}
-
-	err = os.WriteFile(resolvedConfPath, []byte(resolvedConfData), 0o644)
-	if err != nil {
-		return fmt.Errorf("os.WriteFile: %s: %w", resolvedConfPath, err)
-	}
-
-	_ = os.Rename(resolvConfPath, resolvConfPath+".backup")
-	err = os.Symlink("/run/systemd/resolve/resolv.conf", resolvConfPath)
-	if err != nil {
-		_ = os.Remove(resolvedConfPath) // remove the file we've just created
-		return fmt.Errorf("os.Symlink: %s: %w", resolvConfPath, err)
-	}
-
-	cmd := exec.Command("systemctl", "reload-or-restart", "systemd-resolved")
-	log.Tracef("executing %s %v", cmd.Path, cmd.Args)
-	_, err = cmd.Output()
-	if err != nil {
-		return err
-	}
-	if cmd.ProcessState.ExitCode() != 0 {
-		return fmt.Errorf("process %s exited with an error: %d",
-			cmd.Path, cmd.ProcessState.ExitCode())
-	}
-
-	return nil
-}
-
 type applyConfigReqEnt struct {
 	IP   netip.Addr `json:"ip"`
 	Port uint16     `json:"port"`
@@ -378,13 +343,13 @@ const PasswordMinRunes = 8
 func (web *webAPI) handleInstallConfigure(w http.ResponseWriter, r *http.Request) {
 	req, restartHTTP, err := decodeApplyConfigReq(r.Body)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
 
 	if utf8.RuneCountInString(req.Password) < PasswordMinRunes {
-		aghhttp.Error(
+		writeError(
 			r,
 			w,
 			http.StatusUnprocessableEntity,
@@ -397,14 +362,14 @@ func (web *webAPI) handleInstallConfigure(w http.ResponseWriter, r *http.Request
 
 	err = aghnet.CheckPort("udp", netip.AddrPortFrom(req.DNS.IP, req.DNS.Port))
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
 
 	err = aghnet.CheckPort("tcp", netip.AddrPortFrom(req.DNS.IP, req.DNS.Port))
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -427,7 +392,7 @@ func (web *webAPI) handleInstallConfigure(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		Context.firstRun = true
 		copyInstallSettings(config, curConfig)
-		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "%s", err)
+		writeError(r, w, http.StatusUnprocessableEntity, "%s", err)
 
 		return
 	}
@@ -440,7 +405,7 @@ func (web *webAPI) handleInstallConfigure(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		Context.firstRun = true
 		copyInstallSettings(config, curConfig)
-		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
@@ -449,11 +414,13 @@ func (web *webAPI) handleInstallConfigure(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		Context.firstRun = true
 		copyInstallSettings(config, curConfig)
-		aghhttp.Error(r, w, http.StatusInternalServerError, "Couldn't write config: %s", err)
+		writeError(r, w, http.StatusInternalServerError, "Couldn't write config: %s", err)
 
 		return
 	}
 
+	syncFirewallRules()
+
 	web.conf.firstRun = false
 	web.conf.BindAddr = netip.AddrPortFrom(req.Web.IP, req.Web.Port)
 
@@ -514,6 +481,7 @@ func decodeApplyConfigReq(r io.Reader) (req *applyConfigReq, restartHTTP bool, e
 
 func (web *webAPI) registerInstallHandlers() {
 	Context.mux.HandleFunc("/control/install/get_addresses", preInstall(ensureGET(web.handleInstallGetAddresses)))
+	Context.mux.HandleFunc("/control/install/preflight", preInstall(ensureGET(web.handleInstallPreflight)))
 	Context.mux.HandleFunc("/control/install/check_config", preInstall(ensurePOST(web.handleInstallCheckConfig)))
 	Context.mux.HandleFunc("/control/install/configure", preInstall(ensurePOST(web.handleInstallConfigure)))
 }
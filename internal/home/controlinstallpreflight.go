@@ -0,0 +1,313 @@
+package home
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// Warnings of the pre-flight network probing.
+const (
+	// preflightWarnPublicAddr means that some of the interfaces have publicly
+	// routable addresses, so that listening on all interfaces could expose the
+	// DNS server to the internet.
+	preflightWarnPublicAddr = "public_address"
+
+	// preflightWarnDNSPortInUse means that the default DNS port is bound by
+	// another resolver.
+	preflightWarnDNSPortInUse = "dns_port_in_use"
+
+	// preflightWarnOtherDHCP means that another DHCP server has been detected
+	// on some of the networks.
+	preflightWarnOtherDHCP = "other_dhcp_server"
+)
+
+// Results of the detection of the other DHCP servers, the same as in the DHCP
+// HTTP API.
+const (
+	preflightDHCPFound    = "yes"
+	preflightDHCPNotFound = "no"
+	preflightDHCPError    = "error"
+)
+
+// preflightResp is the response for the /install/preflight endpoint.
+type preflightResp struct {
+	// Recommended are the recommended addresses for the web interface and the
+	// DNS server.
+	Recommended *preflightRecommended `json:"recommended"`
+
+	// Interfaces are the probed network interfaces.
+	Interfaces []*preflightIface `json:"interfaces"`
+
+	// ResolverConflicts are the existing listeners on the default DNS port.
+	ResolverConflicts []*preflightConflict `json:"resolver_conflicts"`
+
+	// Warnings are the codes of the found problems, see preflightWarn
+	// constants.
+	Warnings []string `json:"warnings"`
+}
+
+// preflightRecommended are the recommended defaults of the initial
+// configuration.
+type preflightRecommended struct {
+	Web *preflightAddr `json:"web"`
+	DNS *preflightAddr `json:"dns"`
+}
+
+// preflightAddr is a recommended address to listen on.
+type preflightAddr struct {
+	IP   netip.Addr `json:"ip"`
+	Port uint16     `json:"port"`
+}
+
+// preflightIface is the result of probing a single network interface.
+type preflightIface struct {
+	// DHCP is the result of the detection of the other DHCP servers.  It's nil
+	// if the interface hasn't been probed, for example because it's a loopback
+	// one.
+	DHCP *preflightDHCP `json:"dhcp,omitempty"`
+
+	Name string `json:"name"`
+
+	// Addresses are the addresses of the interface.
+	Addresses []netip.Addr `json:"ip_addresses"`
+
+	// PublicAddresses are the addresses of the interface which are publicly
+	// routable.
+	PublicAddresses []netip.Addr `json:"public_addresses"`
+}
+
+// preflightDHCP is the result of the detection of the other DHCP servers on a
+// network.
+type preflightDHCP struct {
+	V4      string `json:"v4"`
+	V4Error string `json:"v4_error,omitempty"`
+	V6      string `json:"v6"`
+	V6Error string `json:"v6_error,omitempty"`
+}
+
+// preflightConflict is an existing listener on the default DNS port.
+type preflightConflict struct {
+	Protocol string         `json:"protocol"`
+	Address  netip.AddrPort `json:"address"`
+	Error    string         `json:"error"`
+
+	// CanAutofix is true if the port can be unbound by AdGuard Home
+	// automatically, see [checkDNSStubListener].
+	CanAutofix bool `json:"can_autofix"`
+}
+
+// preflightProber probes the network before the initial configuration.
+type preflightProber struct {
+	// checkDHCP tries to discover other DHCP servers on the network of the
+	// interface.
+	checkDHCP func(ifaceName string) (ok4, ok6 bool, err4, err6 error)
+
+	// checkPort returns an error if the address can't be bound.
+	checkPort func(network string, ipp netip.AddrPort) (err error)
+
+	// stubListener returns true if the DNS port is bound by the stub listener
+	// of systemd-resolved, which can be disabled automatically.
+	stubListener func() (ok bool)
+
+	// installPort is the port of the web interface during the installation,
+	// which is recommended if the default one is busy.
+	installPort uint16
+}
+
+// probe probes the network using ifaces.
+func (p *preflightProber) probe(ifaces []*aghnet.NetInterface) (resp *preflightResp) {
+	resp = &preflightResp{
+		Interfaces: make([]*preflightIface, 0, len(ifaces)),
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, iface := range ifaces {
+		pi := &preflightIface{
+			Name:            iface.Name,
+			Addresses:       iface.Addresses,
+			PublicAddresses: publicAddrs(iface.Addresses),
+		}
+		resp.Interfaces = append(resp.Interfaces, pi)
+
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pi.DHCP = p.probeDHCP(pi.Name)
+		}()
+	}
+
+	resp.ResolverConflicts = p.probeDNSPort()
+
+	wg.Wait()
+
+	resp.Recommended = p.recommend(resp.Interfaces)
+	resp.Warnings = preflightWarnings(resp)
+
+	return resp
+}
+
+// probeDHCP returns the result of the detection of the other DHCP servers on
+// the network of the interface.
+func (p *preflightProber) probeDHCP(ifaceName string) (res *preflightDHCP) {
+	res = &preflightDHCP{
+		V4: preflightDHCPNotFound,
+		V6: preflightDHCPNotFound,
+	}
+
+	found4, found6, err4, err6 := p.checkDHCP(ifaceName)
+	if err4 != nil {
+		res.V4, res.V4Error = preflightDHCPError, err4.Error()
+	} else if found4 {
+		res.V4 = preflightDHCPFound
+	}
+
+	if err6 != nil {
+		res.V6, res.V6Error = preflightDHCPError, err6.Error()
+	} else if found6 {
+		res.V6 = preflightDHCPFound
+	}
+
+	return res
+}
+
+// probeDNSPort returns the existing listeners on the default DNS port.
+func (p *preflightProber) probeDNSPort() (conflicts []*preflightConflict) {
+	conflicts = []*preflightConflict{}
+	addr := netip.AddrPortFrom(netip.IPv4Unspecified(), defaultPortDNS)
+	for _, network := range []string{"udp", "tcp"} {
+		err := p.checkPort(network, addr)
+		if !aghnet.IsAddrInUse(err) {
+			continue
+		}
+
+		conflicts = append(conflicts, &preflightConflict{
+			Protocol: network,
+			Address:  addr,
+			Error:    err.Error(),
+		})
+	}
+
+	if len(conflicts) > 0 && p.stubListener() {
+		for _, c := range conflicts {
+			c.CanAutofix = true
+		}
+	}
+
+	return conflicts
+}
+
+// recommend returns the recommended addresses for the probed ifaces.  If some
+// of them have publicly routable addresses, a private address is recommended
+// instead of all interfaces, so that the DNS server isn't turned into an open
+// resolver.
+func (p *preflightProber) recommend(ifaces []*preflightIface) (rec *preflightRecommended) {
+	ip := netip.IPv4Unspecified()
+	for _, iface := range ifaces {
+		if len(iface.PublicAddresses) > 0 {
+			ip = firstPrivateAddr(ifaces)
+
+			break
+		}
+	}
+
+	webPort := defaultPortHTTP
+	err := p.checkPort("tcp", netip.AddrPortFrom(ip, webPort))
+	if err != nil && p.installPort != 0 {
+		webPort = p.installPort
+	}
+
+	return &preflightRecommended{
+		Web: &preflightAddr{
+			IP:   ip,
+			Port: webPort,
+		},
+		DNS: &preflightAddr{
+			IP:   ip,
+			Port: defaultPortDNS,
+		},
+	}
+}
+
+// preflightWarnings returns the codes of the problems found in resp.
+func preflightWarnings(resp *preflightResp) (warns []string) {
+	warns = []string{}
+
+	var hasPublic, hasDHCP bool
+	for _, iface := range resp.Interfaces {
+		hasPublic = hasPublic || len(iface.PublicAddresses) > 0
+		if d := iface.DHCP; d != nil {
+			hasDHCP = hasDHCP || d.V4 == preflightDHCPFound || d.V6 == preflightDHCPFound
+		}
+	}
+
+	if hasPublic {
+		warns = append(warns, preflightWarnPublicAddr)
+	}
+
+	if len(resp.ResolverConflicts) > 0 {
+		warns = append(warns, preflightWarnDNSPortInUse)
+	}
+
+	if hasDHCP {
+		warns = append(warns, preflightWarnOtherDHCP)
+	}
+
+	return warns
+}
+
+// publicAddrs returns the publicly routable addresses from addrs.
+func publicAddrs(addrs []netip.Addr) (public []netip.Addr) {
+	public = []netip.Addr{}
+	for _, addr := range addrs {
+		if addr.IsGlobalUnicast() && !netutil.IsSpecialPurpose(addr) {
+			public = append(public, addr)
+		}
+	}
+
+	return public
+}
+
+// firstPrivateAddr returns the first private IPv4 address of ifaces or the
+// unspecified address if there is none.
+func firstPrivateAddr(ifaces []*preflightIface) (ip netip.Addr) {
+	for _, iface := range ifaces {
+		for _, addr := range iface.Addresses {
+			if addr.Is4() && addr.IsPrivate() {
+				return addr
+			}
+		}
+	}
+
+	return netip.IPv4Unspecified()
+}
+
+// handleInstallPreflight is the handler for the /install/preflight endpoint.
+// It probes the network to guide the initial configuration.
+func (web *webAPI) handleInstallPreflight(w http.ResponseWriter, r *http.Request) {
+	ifaces, err := aghnet.GetValidNetInterfacesForWeb()
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "Couldn't get interfaces: %s", err)
+
+		return
+	}
+
+	p := &preflightProber{
+		checkDHCP:    aghnet.CheckOtherDHCP,
+		checkPort:    aghnet.CheckPort,
+		stubListener: checkDNSStubListener,
+		installPort:  config.HTTPConfig.Address.Port(),
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, p.probe(ifaces))
+}
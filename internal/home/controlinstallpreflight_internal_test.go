@@ -0,0 +1,116 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflightProber_probe(t *testing.T) {
+	// Bind a real port to get the platform-specific error about the address
+	// being in use.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	busyAddr := testutil.RequireTypeAssert[*net.UDPAddr](t, conn.LocalAddr()).AddrPort()
+
+	var (
+		privateIP = netip.MustParseAddr("192.168.1.2")
+		publicIP  = netip.MustParseAddr("1.2.3.4")
+		loopIP    = netip.MustParseAddr("127.0.0.1")
+	)
+
+	ifaces := []*aghnet.NetInterface{{
+		Addresses: []netip.Addr{loopIP},
+		Name:      "lo",
+		Flags:     net.FlagUp | net.FlagLoopback,
+	}, {
+		Addresses: []netip.Addr{privateIP},
+		Name:      "eth0",
+		Flags:     net.FlagUp,
+	}, {
+		Addresses: []netip.Addr{publicIP},
+		Name:      "eth1",
+		Flags:     net.FlagUp,
+	}}
+
+	p := &preflightProber{
+		checkDHCP: func(ifaceName string) (ok4, ok6 bool, err4, err6 error) {
+			if ifaceName == "eth0" {
+				return true, false, nil, errors.Error("no ipv6")
+			}
+
+			return false, false, nil, nil
+		},
+		checkPort: func(network string, ipp netip.AddrPort) (err error) {
+			if network == "udp" && ipp.Port() == defaultPortDNS {
+				return aghnet.CheckPort(network, busyAddr)
+			} else if network == "tcp" && ipp.Port() == defaultPortHTTP {
+				return errors.Error("permission denied")
+			}
+
+			return nil
+		},
+		stubListener: func() (ok bool) { return true },
+		installPort:  3000,
+	}
+
+	resp := p.probe(ifaces)
+	require.Len(t, resp.Interfaces, 3)
+
+	assert.Nil(t, resp.Interfaces[0].DHCP)
+	assert.Equal(t, &preflightDHCP{
+		V4:      preflightDHCPFound,
+		V6:      preflightDHCPError,
+		V6Error: "no ipv6",
+	}, resp.Interfaces[1].DHCP)
+	assert.Empty(t, resp.Interfaces[1].PublicAddresses)
+	assert.Equal(t, []netip.Addr{publicIP}, resp.Interfaces[2].PublicAddresses)
+
+	require.Len(t, resp.ResolverConflicts, 1)
+
+	c := resp.ResolverConflicts[0]
+	assert.Equal(t, "udp", c.Protocol)
+	assert.True(t, c.CanAutofix)
+
+	assert.Equal(t, &preflightRecommended{
+		Web: &preflightAddr{IP: privateIP, Port: 3000},
+		DNS: &preflightAddr{IP: privateIP, Port: defaultPortDNS},
+	}, resp.Recommended)
+
+	assert.Equal(t, []string{
+		preflightWarnPublicAddr,
+		preflightWarnDNSPortInUse,
+		preflightWarnOtherDHCP,
+	}, resp.Warnings)
+}
+
+func TestPreflightProber_probe_noProblems(t *testing.T) {
+	p := &preflightProber{
+		checkDHCP: func(_ string) (ok4, ok6 bool, err4, err6 error) {
+			return false, false, nil, nil
+		},
+		checkPort:    func(_ string, _ netip.AddrPort) (err error) { return nil },
+		stubListener: func() (ok bool) { panic("not implemented") },
+	}
+
+	resp := p.probe([]*aghnet.NetInterface{{
+		Addresses: []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+		Name:      "eth0",
+		Flags:     net.FlagUp,
+	}})
+
+	assert.Empty(t, resp.ResolverConflicts)
+	assert.Empty(t, resp.Warnings)
+	assert.Equal(t, &preflightRecommended{
+		Web: &preflightAddr{IP: netip.IPv4Unspecified(), Port: defaultPortHTTP},
+		DNS: &preflightAddr{IP: netip.IPv4Unspecified(), Port: defaultPortDNS},
+	}, resp.Recommended)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
@@ -30,7 +31,9 @@ type temporaryError interface {
 //
 // TODO(a.garipov): Find out if this API used with a GET method by anyone.
 func (web *webAPI) handleVersionJSON(w http.ResponseWriter, r *http.Request) {
-	resp := &versionResponse{}
+	resp := &versionResponse{
+		SelfUpdateDisabled: web.conf.noSelfUpdate,
+	}
 	if web.conf.disableUpdate {
 		resp.Disabled = true
 		aghhttp.WriteJSONResponseOK(w, r, resp)
@@ -46,7 +49,7 @@ func (web *webAPI) handleVersionJSON(w http.ResponseWriter, r *http.Request) {
 	if r.ContentLength != 0 {
 		err = json.NewDecoder(r.Body).Decode(req)
 		if err != nil {
-			aghhttp.Error(r, w, http.StatusBadRequest, "parsing request: %s", err)
+			writeError(r, w, http.StatusBadRequest, "parsing request: %s", err)
 
 			return
 		}
@@ -55,15 +58,17 @@ func (web *webAPI) handleVersionJSON(w http.ResponseWriter, r *http.Request) {
 	err = web.requestVersionInfo(resp, req.Recheck)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
-		aghhttp.Error(r, w, http.StatusBadGateway, "%s", err)
+		writeError(r, w, http.StatusBadGateway, "%s", err)
 
 		return
 	}
 
+	resp.UpdateAvailable = resp.NewVersion != "" && resp.NewVersion != version.Version()
+
 	err = resp.setAllowedToAutoUpdate()
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
-		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
@@ -106,9 +111,15 @@ func (web *webAPI) requestVersionInfo(resp *versionResponse, recheck bool) (err
 
 // handleUpdate performs an update to the latest available version procedure.
 func (web *webAPI) handleUpdate(w http.ResponseWriter, r *http.Request) {
-	updater := web.conf.updater
-	if updater.NewVersion() == "" {
-		aghhttp.Error(r, w, http.StatusBadRequest, "/update request isn't allowed now")
+	upd := web.conf.updater
+	if upd.NewVersion() == "" {
+		writeError(r, w, http.StatusBadRequest, "/update request isn't allowed now")
+
+		return
+	}
+
+	if maintenanceActive() {
+		writeError(r, w, http.StatusConflict, "updates are deferred until the end of the maintenance")
 
 		return
 	}
@@ -119,14 +130,18 @@ func (web *webAPI) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	// See https://github.com/AdguardTeam/AdGuardHome/issues/4735.
 	execPath, err := os.Executable()
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "getting path: %s", err)
+		writeError(r, w, http.StatusInternalServerError, "getting path: %s", err)
 
 		return
 	}
 
-	err = updater.Update(false)
-	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+	err = upd.Update(false)
+	if errors.Is(err, updater.ErrNoSelfUpdate) {
+		writeError(r, w, http.StatusForbidden, "%s", err)
+
+		return
+	} else if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
@@ -146,6 +161,15 @@ func (web *webAPI) handleUpdate(w http.ResponseWriter, r *http.Request) {
 type versionResponse struct {
 	updater.VersionInfo
 	Disabled bool `json:"disabled"`
+
+	// UpdateAvailable is true if the new version differs from the running
+	// one.
+	UpdateAvailable bool `json:"update_available"`
+
+	// SelfUpdateDisabled is true if AdGuard Home doesn't replace its own
+	// executable, so the update must be performed externally, for example by
+	// updating the container image.
+	SelfUpdateDisabled bool `json:"self_update_disabled"`
 }
 
 // setAllowedToAutoUpdate sets CanAutoUpdate to true if AdGuard Home is actually
@@ -185,6 +209,19 @@ func finishUpdate(ctx context.Context, execPath string, runningAsService bool) {
 
 	log.Info("stopping all tasks")
 
+	// Keep the listening sockets of the web interface open for the new
+	// process, so that the connections made during the restart are queued
+	// instead of being refused.  Do it before the servers are shut down, since
+	// that closes the listeners.
+	env := os.Environ()
+	if runtime.GOOS != "windows" {
+		env = Context.listeners.environ()
+	}
+
+	// TODO: Pass the DNS sockets to the new process as well once module
+	// dnsproxy supports serving on the provided listeners.  Until then, at
+	// least answer the DNS requests being processed.
+	drainDNSServer(ctx)
 	cleanup(ctx)
 	cleanupAlways()
 
@@ -218,7 +255,7 @@ func finishUpdate(ctx context.Context, execPath string, runningAsService bool) {
 	}
 
 	log.Info("restarting: %q %q", execPath, os.Args[1:])
-	err = syscall.Exec(execPath, os.Args, os.Environ())
+	err = syscall.Exec(execPath, os.Args, env)
 	if err != nil {
 		log.Fatalf("restarting: %s", err)
 	}
@@ -42,6 +42,10 @@ func onConfigModified() {
 	if err != nil {
 		log.Error("writing config: %s", err)
 	}
+
+	exportPFTable()
+	syncFirewallRules()
+	refreshLocalHostnames()
 }
 
 // initDNS updates all the fields of the [Context] needed to initialize the DNS
@@ -76,10 +80,16 @@ func initDNS(l *slog.Logger, statsDir, querylogDir string) (err error) {
 		ConfigModified:    onConfigModified,
 		HTTPRegister:      httpRegister,
 		FindClient:        Context.clients.findMultiple,
+		HTTPClient:        httpClient(writeTimeout),
+		Archive:           config.QueryLog.Archive,
+		ClickHouse:        config.QueryLog.ClickHouse,
+		Syslog:            config.QueryLog.Syslog,
+		Aggregates:        config.QueryLog.Aggregates,
 		BaseDir:           querylogDir,
 		AnonymizeClientIP: config.DNS.AnonymizeClientIP,
 		RotationIvl:       config.QueryLog.Interval.Duration,
 		MemSize:           config.QueryLog.MemSize,
+		SampleRate:        config.QueryLog.SampleRate,
 		Enabled:           config.QueryLog.Enabled,
 		FileEnabled:       config.QueryLog.FileEnabled,
 	}
@@ -101,6 +111,8 @@ func initDNS(l *slog.Logger, statsDir, querylogDir string) (err error) {
 		return err
 	}
 
+	refreshLocalHostnames()
+
 	tlsConf := &tlsConfigSettings{}
 	Context.tls.WriteDiskConfig(tlsConf)
 
@@ -132,12 +144,14 @@ func initDNSServer(
 	tlsConf *tlsConfigSettings,
 	l *slog.Logger,
 ) (err error) {
+	discovered := discoverPrivateRDNS(&config.DNS, config.DHCP)
+	Context.privateNets = newPrivateSubnets(discovered.privateSubnetSet(config.DNS.PrivateNets))
 	Context.dnsServer, err = dnsforward.NewServer(dnsforward.DNSCreateParams{
 		Logger:      l,
 		DNSFilter:   filters,
 		Stats:       sts,
 		QueryLog:    qlog,
-		PrivateNets: parseSubnetSet(config.DNS.PrivateNets),
+		PrivateNets: Context.privateNets,
 		Anonymizer:  anonymizer,
 		DHCPServer:  dhcpSrv,
 		EtcHosts:    Context.etcHosts,
@@ -159,6 +173,8 @@ func initDNSServer(
 		return fmt.Errorf("newServerConfig: %w", err)
 	}
 
+	dnsConf.DiscoveredPTRResolvers = discovered.ptrResolvers()
+
 	// Try to prepare the server with disabled private RDNS resolution if it
 	// failed to prepare as is.  See TODO on [dnsforward.PrivateRDNSError].
 	err = Context.dnsServer.Prepare(dnsConf)
@@ -241,10 +257,12 @@ func newServerConfig(
 		Config:                 fwdConf,
 		TLSConfig:              newDNSTLSConfig(tlsConf, hosts),
 		TLSAllowUnencryptedDoH: tlsConf.AllowUnencryptedDoH,
-		UpstreamTimeout:        dnsConf.UpstreamTimeout.Duration,
+		UpstreamTimeout:        config.Timeouts.Upstream.Duration,
+		PrivateRDNSTimeout:     config.Timeouts.RDNS.Duration,
 		TLSv12Roots:            Context.tlsRoots,
 		ConfigModified:         onConfigModified,
 		HTTPRegister:           httpReg,
+		IsAuthenticated:        isAuthenticatedDoH,
 		LocalPTRResolvers:      dnsConf.PrivateRDNSResolvers,
 		UseDNS64:               dnsConf.UseDNS64,
 		DNS64Prefixes:          dnsConf.DNS64Prefixes,
@@ -254,6 +272,10 @@ func newServerConfig(
 		ServePlainDNS:          dnsConf.ServePlainDNS,
 	}
 
+	if Context.events != nil {
+		newConf.Events = Context.events
+	}
+
 	var initialAddresses []netip.Addr
 	// Context.stats may be nil here if initDNSServer is called from
 	// [cmdlineUpdate].
@@ -268,6 +290,7 @@ func newServerConfig(
 		Exchanger:        Context.dnsServer,
 		AddressUpdater:   &Context.clients,
 		InitialAddresses: initialAddresses,
+		WHOISTimeout:     config.Timeouts.WHOIS.Duration,
 		CatchPanics:      true,
 		UseRDNS:          clientSrcConf.RDNS,
 		UseWHOIS:         clientSrcConf.WHOIS,
@@ -373,7 +396,7 @@ func getDNSEncryption() (de dnsEncryption) {
 		de.https = (&url.URL{
 			Scheme: "https",
 			Host:   addr,
-			Path:   "/dns-query",
+			Path:   dnsforward.PublicDoHPath(config.DNS.DoHEndpoints),
 		}).String()
 	}
 
@@ -415,6 +438,7 @@ func applyAdditionalFiltering(clientIP netip.Addr, clientID string, setts *filte
 		c, ok = Context.clients.storage.Find(clientIP.String())
 		if !ok {
 			log.Debug("%s: no clients with ip %s and clientid %q", pref, clientIP, clientID)
+			setts.ClientTags = Context.clients.storage.AutoTags(clientIP, nil)
 
 			return
 		}
@@ -432,8 +456,26 @@ func applyAdditionalFiltering(clientIP netip.Addr, clientID string, setts *filte
 		}
 	}
 
+	if s := c.ActiveServiceSchedule(time.Now()); s != nil {
+		setts.ServicesRules = nil
+		Context.filters.ApplyBlockedServicesList(setts, s.BlockedServices)
+		log.Debug(
+			"%s: services for client %q set by schedule %q: %s",
+			pref,
+			c.Name,
+			s.Name,
+			s.BlockedServices,
+		)
+	}
+
 	setts.ClientName = c.Name
-	setts.ClientTags = c.Tags
+	setts.ClientTags = mergeTags(c.Tags, Context.clients.storage.AutoTags(clientIP, c))
+	setts.ClientPaused = c.IsPaused(time.Now())
+	setts.PauseAllowlist = c.PauseAllowlist
+	setts.ClientDNSSEC = c.DNSSEC.NullBool()
+	setts.ClientBlockQUIC = c.BlockQUIC
+	setts.ClientDNS64Prefix = c.DNS64Prefix
+	setts.ClientDNS64Exclusions = c.DNS64Exclusions
 	if !c.UseOwnSettings {
 		return
 	}
@@ -473,13 +515,57 @@ func startDNSServer() error {
 	return nil
 }
 
-func reconfigureDNSServer() (err error) {
-	tlsConf := &tlsConfigSettings{}
-	Context.tls.WriteDiskConfig(tlsConf)
+// linkPollIvl is the interval of checking the addresses of the network
+// interfaces on the systems without the notifications about their changes.
+const linkPollIvl = 30 * time.Second
+
+// startLinkMonitor starts tracking the addresses of the network interfaces and
+// reconfigures the DNS server when those change, so that the listeners are
+// bound again and the upstreams' addresses are resolved again.  It does
+// nothing if the monitor can't be started.
+func startLinkMonitor() {
+	m := aghnet.NewLinkMonitor(linkPollIvl)
+	err := m.Start()
+	if err != nil {
+		log.Info("WARNING: starting link monitor: %s; not tracking interface changes", err)
+
+		return
+	}
+
+	Context.linkMonitor = m
+
+	go handleLinkChanges(m.Events())
+}
+
+// handleLinkChanges reconfigures the DNS server on each event until events is
+// closed.  It's intended to be used as a goroutine.
+func handleLinkChanges(events <-chan struct{}) {
+	defer log.OnPanic("link monitor")
+
+	// failed is true if the last reconfiguration failed and brought the
+	// server down, for example because a bound address disappeared.  Retry it
+	// on the next change then.
+	failed := false
+	for range events {
+		if !failed && !isRunning() {
+			continue
+		}
+
+		log.Info("dns: interface addresses changed; reconfiguring")
+
+		err := reconfigureDNSServer()
+		failed = err != nil
+		if failed {
+			log.Error("dns: reconfiguring after interface change: %s", err)
+		}
+	}
+}
 
-	newConf, err := newServerConfig(&config.DNS, config.Clients.Sources, tlsConf, httpRegister)
+func reconfigureDNSServer() (err error) {
+	newConf, err := newReconfigureServerConfig()
 	if err != nil {
-		return fmt.Errorf("generating forwarding dns server config: %w", err)
+		// Don't wrap the error since it's informative enough as is.
+		return err
 	}
 
 	err = Context.dnsServer.Reconfigure(newConf)
@@ -490,6 +576,52 @@ func reconfigureDNSServer() (err error) {
 	return nil
 }
 
+// reloadDNSServer applies the current DNS settings to the running DNS server
+// without closing its listeners, unless their settings have changed, see
+// [dnsforward.Server.Reload].  Replacing the listeners waits for the requests
+// being processed for at most the configured drain timeout.
+func reloadDNSServer(ctx context.Context) (err error) {
+	newConf, err := newReconfigureServerConfig()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.DNS.DrainTimeout.Duration)
+	defer cancel()
+
+	err = Context.dnsServer.Reload(ctx, newConf)
+	if err != nil {
+		return fmt.Errorf("reloading forwarding dns server: %w", err)
+	}
+
+	return nil
+}
+
+// newReconfigureServerConfig returns the configuration of the DNS server for
+// applying the current settings to it.
+func newReconfigureServerConfig() (newConf *dnsforward.ServerConfig, err error) {
+	tlsConf := &tlsConfigSettings{}
+	Context.tls.WriteDiskConfig(tlsConf)
+
+	newConf, err = newServerConfig(&config.DNS, config.Clients.Sources, tlsConf, httpRegister)
+	if err != nil {
+		return nil, fmt.Errorf("generating forwarding dns server config: %w", err)
+	}
+
+	// Rediscover both the resolvers and the private networks, since the network
+	// configuration of the host or the DHCP scopes may have changed.  Update
+	// the networks before reconfiguring, so that the new private upstreams are
+	// validated against them.
+	discovered := discoverPrivateRDNS(&config.DNS, config.DHCP)
+	newConf.DiscoveredPTRResolvers = discovered.ptrResolvers()
+	if Context.privateNets != nil {
+		Context.privateNets.update(discovered.privateSubnetSet(config.DNS.PrivateNets))
+	}
+
+	return newConf, nil
+}
+
 func stopDNSServer() (err error) {
 	if !isRunning() {
 		return nil
@@ -0,0 +1,124 @@
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsmasq"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// importDnsmasqFile imports the dnsmasq configuration from the file at path
+// into the configuration file and the DHCP leases database.  The upstream DNS
+// servers are appended to the configured ones, and the addresses of the DHCP
+// settings are only set if they aren't configured yet.  It must only be called
+// once the configuration file is parsed and before the services are
+// initialized.
+func importDnsmasqFile(path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	conf, err := dnsmasq.Parse(f)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", path, err)
+	}
+
+	imp := &filtering.ImportConfig{
+		UserRules: conf.Rules,
+	}
+
+	for _, rw := range conf.Rewrites {
+		imp.Rewrites = append(imp.Rewrites, &filtering.LegacyRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	res, errs := importFilteringConfig(imp)
+	warnings := appendErrors(conf.Warnings, errs)
+
+	upstreams := 0
+	for _, u := range conf.Upstreams {
+		if !slices.Contains(config.DNS.UpstreamDNS, u) {
+			config.DNS.UpstreamDNS = append(config.DNS.UpstreamDNS, u)
+			upstreams++
+		}
+	}
+
+	if conf.DHCP != nil {
+		warnings = append(warnings, importDnsmasqDHCP(conf.DHCP)...)
+	}
+
+	leases := make([]*dhcpsvc.Lease, 0, len(conf.StaticLeases))
+	for _, l := range conf.StaticLeases {
+		leases = append(leases, &dhcpsvc.Lease{
+			HWAddr:   l.HWAddr,
+			IP:       l.IP,
+			Hostname: l.Hostname,
+		})
+	}
+
+	staticLeases, errs, err := dhcpd.ImportStaticLeases(Context.getDataDir(), leases)
+	if err != nil {
+		return fmt.Errorf("importing static leases: %w", err)
+	}
+
+	warnings = appendErrors(warnings, errs)
+	for _, w := range warnings {
+		log.Info("dnsmasq: warning: %s", w)
+	}
+
+	log.Info(
+		"dnsmasq: imported %d user rules, %d rewrites, %d upstreams, and %d static leases",
+		res.UserRules,
+		res.Rewrites,
+		upstreams,
+		staticLeases,
+	)
+
+	return writeConfigFile()
+}
+
+// importDnsmasqDHCP sets the unconfigured DHCPv4 settings of the global
+// configuration from c and returns the warnings about the configured ones.
+func importDnsmasqDHCP(c *dnsmasq.DHCP) (warnings []string) {
+	conf := &config.DHCP.Conf4
+
+	setAddr := func(name string, dst *netip.Addr, val netip.Addr) {
+		if !val.IsValid() || *dst == val {
+			return
+		} else if dst.IsValid() {
+			warnings = append(warnings, fmt.Sprintf("dhcp: %s is already set to %s", name, *dst))
+
+			return
+		}
+
+		*dst = val
+	}
+
+	setAddr("gateway_ip", &conf.GatewayIP, c.GatewayIP)
+	setAddr("subnet_mask", &conf.SubnetMask, c.SubnetMask)
+	setAddr("range_start", &conf.RangeStart, c.RangeStart)
+	setAddr("range_end", &conf.RangeEnd, c.RangeEnd)
+
+	if c.LeaseDuration > 0 {
+		conf.LeaseDuration = uint32(c.LeaseDuration.Seconds())
+	}
+
+	for _, o := range c.Options {
+		if !slices.Contains(conf.Options, o) {
+			conf.Options = append(conf.Options, o)
+		}
+	}
+
+	return warnings
+}
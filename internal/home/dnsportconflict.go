@@ -0,0 +1,446 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
+)
+
+// dnsPortOwner is a DNS server AdGuard Home can reconfigure to free the DNS
+// port.
+type dnsPortOwner string
+
+// Valid dnsPortOwner values.
+const (
+	dnsPortOwnerNone     dnsPortOwner = ""
+	dnsPortOwnerResolved dnsPortOwner = "systemd-resolved"
+	dnsPortOwnerDnsmasq  dnsPortOwner = "dnsmasq"
+)
+
+// dnsmasqConfPath is the path to the configuration file disabling the DNS
+// server of dnsmasq while keeping its DHCP server.
+const dnsmasqConfPath = "/etc/dnsmasq.d/adguardhome.conf"
+
+// dnsmasqConfData is the contents of the file at [dnsmasqConfPath].
+const dnsmasqConfData = `# Created by AdGuard Home, which serves DNS on this machine.
+port=0
+`
+
+// dnsTakeoverFile is the name of the file in the working directory containing
+// the DNS servers reconfigured by AdGuard Home to free the DNS port.
+const dnsTakeoverFile = "dns_takeover.json"
+
+// dnsTakeoverPath returns the path to the file with the reconfigured DNS
+// servers.
+func dnsTakeoverPath() (p string) {
+	return filepath.Join(Context.workDir, dnsTakeoverFile)
+}
+
+// dnsPortManager detects and reconfigures the DNS servers occupying the DNS
+// port.
+type dnsPortManager struct {
+	// checkPort returns an error if the address can't be bound.
+	checkPort func(network string, ipp netip.AddrPort) (err error)
+
+	// stubListener returns true if the DNS port is bound by the stub listener
+	// of systemd-resolved.
+	stubListener func() (ok bool)
+
+	// pidByCommand returns the PID of the process with the given name, see
+	// [aghos.PIDByCommand].
+	pidByCommand func(command string, except ...int) (pid int, err error)
+
+	// runCommand runs the command and returns its exit code and output, see
+	// [aghos.RunCommand].
+	runCommand func(command string, args ...string) (code int, out []byte, err error)
+
+	// root is the directory containing the configuration files of the DNS
+	// servers.  It's "/" outside of the tests.
+	root string
+
+	// takeoverPath is the path to the file with the reconfigured DNS servers.
+	takeoverPath string
+
+	// detect, if false, disables the detection of the DNS servers, which is
+	// only supported on Linux.
+	detect bool
+}
+
+// newDNSPortManager returns a new *dnsPortManager managing the DNS servers of
+// the current system.
+func newDNSPortManager() (m *dnsPortManager) {
+	return &dnsPortManager{
+		checkPort:    aghnet.CheckPort,
+		stubListener: checkDNSStubListener,
+		pidByCommand: aghos.PIDByCommand,
+		runCommand:   aghos.RunCommand,
+		root:         "/",
+		takeoverPath: dnsTakeoverPath(),
+		detect:       runtime.GOOS == "linux",
+	}
+}
+
+// path returns the path to the system file p within m.root.
+func (m *dnsPortManager) path(p string) (rooted string) {
+	return filepath.Join(m.root, p)
+}
+
+// detectOwner returns the DNS server which AdGuard Home can reconfigure and
+// which is the likely reason the DNS port is in use.
+func (m *dnsPortManager) detectOwner() (owner dnsPortOwner) {
+	if !m.detect {
+		return dnsPortOwnerNone
+	}
+
+	if m.stubListener() {
+		return dnsPortOwnerResolved
+	}
+
+	if _, err := m.pidByCommand(string(dnsPortOwnerDnsmasq)); err == nil {
+		return dnsPortOwnerDnsmasq
+	}
+
+	return dnsPortOwnerNone
+}
+
+// conflict returns the DNS server occupying port on any of hosts, if it's one
+// AdGuard Home can reconfigure.
+func (m *dnsPortManager) conflict(hosts []netip.Addr, port uint16) (owner dnsPortOwner) {
+	if port == 0 {
+		return dnsPortOwnerNone
+	}
+
+	if len(hosts) == 0 {
+		hosts = []netip.Addr{netip.IPv4Unspecified()}
+	}
+
+	for _, host := range hosts {
+		err := m.checkPort("udp", netip.AddrPortFrom(host, port))
+		if aghnet.IsAddrInUse(err) {
+			return m.detectOwner()
+		}
+	}
+
+	return dnsPortOwnerNone
+}
+
+// configuredConflict returns the DNS server occupying the configured DNS port
+// along with the port itself.
+func (m *dnsPortManager) configuredConflict() (owner dnsPortOwner, port uint16) {
+	var hosts []netip.Addr
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		hosts = slices.Clone(config.DNS.BindHosts)
+		port = config.DNS.Port
+	}()
+
+	return m.conflict(hosts, port), port
+}
+
+// checkDNSPortConflict detects the DNS servers occupying the configured DNS
+// port on startup.  If takeOver is true, it reconfigures them to free the port,
+// otherwise it only logs how to do that.
+func checkDNSPortConflict(takeOver bool) {
+	m := newDNSPortManager()
+	owner, port := m.configuredConflict()
+	if owner == dnsPortOwnerNone {
+		return
+	}
+
+	if !takeOver {
+		log.Info(
+			"dns: warning: port %d is used by %s; restart with --take-over-dns-port "+
+				"or request POST %s to reconfigure it",
+			port,
+			owner,
+			dnsPortTakeoverPath,
+		)
+
+		return
+	}
+
+	err := m.takeOver(owner)
+	if err != nil {
+		log.Error("dns: freeing port %d from %s: %s", port, owner, err)
+
+		return
+	}
+
+	log.Info("dns: reconfigured %s to free port %d", owner, port)
+}
+
+// takeOver reconfigures owner to stop serving DNS and records that to revert
+// on uninstallation.
+func (m *dnsPortManager) takeOver(owner dnsPortOwner) (err error) {
+	switch owner {
+	case dnsPortOwnerResolved:
+		err = m.disableStubListener()
+	case dnsPortOwnerDnsmasq:
+		err = m.disableDnsmasqDNS()
+	default:
+		return fmt.Errorf("dns port owner: %w: %q", errors.ErrBadEnumValue, owner)
+	}
+
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	err = recordDNSTakeover(m.takeoverPath, owner)
+	if err != nil {
+		log.Error("dns: saving reconfigured %s: %s", owner, err)
+	}
+
+	return nil
+}
+
+// disableStubListener disables the stub listener of systemd-resolved and
+// restarts it.
+func (m *dnsPortManager) disableStubListener() (err error) {
+	confPath := m.path(resolvedConfPath)
+	dir := filepath.Dir(confPath)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("os.MkdirAll: %s: %w", dir, err)
+	}
+
+	err = os.WriteFile(confPath, []byte(resolvedConfData), 0o644)
+	if err != nil {
+		return fmt.Errorf("os.WriteFile: %s: %w", confPath, err)
+	}
+
+	resolvPath := m.path(resolvConfPath)
+	_ = os.Rename(resolvPath, resolvPath+".backup")
+	err = os.Symlink("/run/systemd/resolve/resolv.conf", resolvPath)
+	if err != nil {
+		_ = os.Remove(confPath) // remove the file we've just created
+		return fmt.Errorf("os.Symlink: %s: %w", resolvPath, err)
+	}
+
+	return m.restartUnit(string(dnsPortOwnerResolved))
+}
+
+// enableStubListener reverts [dnsPortManager.disableStubListener].
+func (m *dnsPortManager) enableStubListener() (err error) {
+	confPath := m.path(resolvedConfPath)
+	err = os.Remove(confPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing %q: %w", confPath, err)
+	}
+
+	resolvPath := m.path(resolvConfPath)
+	backupPath := resolvPath + ".backup"
+	if _, err = os.Lstat(backupPath); err == nil {
+		err = os.Remove(resolvPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing %q: %w", resolvPath, err)
+		}
+
+		err = os.Rename(backupPath, resolvPath)
+		if err != nil {
+			return fmt.Errorf("restoring %q: %w", resolvPath, err)
+		}
+	}
+
+	return m.restartUnit(string(dnsPortOwnerResolved))
+}
+
+// disableDnsmasqDNS disables the DNS server of dnsmasq and restarts it.
+func (m *dnsPortManager) disableDnsmasqDNS() (err error) {
+	confPath := m.path(dnsmasqConfPath)
+	dir := filepath.Dir(confPath)
+	if _, err = os.Stat(dir); err != nil {
+		return fmt.Errorf("dnsmasq configuration directory: %w; set port=0 in its configuration", err)
+	}
+
+	err = maybe.WriteFile(confPath, []byte(dnsmasqConfData), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", confPath, err)
+	}
+
+	err = m.restartUnit(string(dnsPortOwnerDnsmasq))
+	if err != nil {
+		// Remove the file just created.
+		return errors.WithDeferred(err, os.Remove(confPath))
+	}
+
+	return nil
+}
+
+// enableDnsmasqDNS reverts [dnsPortManager.disableDnsmasqDNS].
+func (m *dnsPortManager) enableDnsmasqDNS() (err error) {
+	confPath := m.path(dnsmasqConfPath)
+	err = os.Remove(confPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing %q: %w", confPath, err)
+	}
+
+	return m.restartUnit(string(dnsPortOwnerDnsmasq))
+}
+
+// restartUnit reloads or restarts the systemd unit with the given name.
+func (m *dnsPortManager) restartUnit(name string) (err error) {
+	code, out, err := m.runCommand("systemctl", "reload-or-restart", name)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("restarting %s: systemctl exited with code %d: %s", name, code, out)
+	}
+
+	return nil
+}
+
+// recordDNSTakeover adds owner to the reconfigured DNS servers saved in the
+// file at p.
+func recordDNSTakeover(p string, owner dnsPortOwner) (err error) {
+	owners, err := readDNSTakeover(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	if slices.Contains(owners, owner) {
+		return nil
+	}
+
+	b, err := json.Marshal(append(owners, owner))
+	if err != nil {
+		// Shouldn't happen, since owners are always serializable.
+		panic(err)
+	}
+
+	return maybe.WriteFile(p, b, aghos.DefaultPermFile)
+}
+
+// readDNSTakeover reads the reconfigured DNS servers from the file at p.
+func readDNSTakeover(p string) (owners []dnsPortOwner, err error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		// Don't wrap the error, since it's checked by the callers.
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &owners)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %q: %w", p, err)
+	}
+
+	return owners, nil
+}
+
+// revert restores the configuration of the DNS servers reconfigured by
+// [dnsPortManager.takeOver], if any.
+func (m *dnsPortManager) revert() {
+	p := m.takeoverPath
+	owners, err := readDNSTakeover(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Error("service: reading reconfigured dns servers: %s", err)
+
+		return
+	}
+
+	for _, owner := range owners {
+		switch owner {
+		case dnsPortOwnerResolved:
+			err = m.enableStubListener()
+		case dnsPortOwnerDnsmasq:
+			err = m.enableDnsmasqDNS()
+		default:
+			err = fmt.Errorf("dns port owner: %w: %q", errors.ErrBadEnumValue, owner)
+		}
+
+		if err != nil {
+			log.Error("service: restoring %s: %s", owner, err)
+		} else {
+			log.Printf("service: restored %s", owner)
+		}
+	}
+
+	err = os.Remove(p)
+	if err != nil {
+		log.Info("service: warning: removing %q: %s", p, err)
+	}
+}
+
+// HTTP API paths for the DNS port conflicts.
+const (
+	dnsPortConflictPath = "/control/dns_port_conflict"
+	dnsPortTakeoverPath = "/control/dns_port_conflict/take_over"
+)
+
+// dnsPortConflictJSON is the JSON structure for the DNS port conflict.
+type dnsPortConflictJSON struct {
+	// Owner is the DNS server occupying the port, if it's one AdGuard Home can
+	// reconfigure.  It's empty if there is no conflict.
+	Owner dnsPortOwner `json:"owner"`
+
+	// Port is the configured DNS port.
+	Port uint16 `json:"port"`
+}
+
+// handleDNSPortConflict is the handler for the GET /control/dns_port_conflict
+// HTTP API.
+func handleDNSPortConflict(w http.ResponseWriter, r *http.Request) {
+	owner, port := newDNSPortManager().configuredConflict()
+	aghhttp.WriteJSONResponseOK(w, r, &dnsPortConflictJSON{
+		Owner: owner,
+		Port:  port,
+	})
+}
+
+// handleDNSPortTakeover is the handler for the POST
+// /control/dns_port_conflict/take_over HTTP API.  The request must contain the
+// owner returned by [handleDNSPortConflict] to confirm reconfiguring it.
+func handleDNSPortTakeover(w http.ResponseWriter, r *http.Request) {
+	req := &dnsPortConflictJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "reading req: %s", err)
+
+		return
+	}
+
+	m := newDNSPortManager()
+	owner, port := m.configuredConflict()
+	if owner == dnsPortOwnerNone || owner != req.Owner {
+		writeError(
+			r,
+			w,
+			http.StatusBadRequest,
+			"port %d is not used by %q; detected owner: %q",
+			port,
+			req.Owner,
+			owner,
+		)
+
+		return
+	}
+
+	err = m.takeOver(owner)
+	if err != nil {
+		writeError(r, w, http.StatusInternalServerError, "reconfiguring %s: %s", owner, err)
+
+		return
+	}
+
+	log.Info("dns: reconfigured %s to free port %d", owner, port)
+
+	aghhttp.OK(w)
+}
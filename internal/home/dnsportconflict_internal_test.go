@@ -0,0 +1,26 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordDNSTakeover(t *testing.T) {
+	p := filepath.Join(t.TempDir(), dnsTakeoverFile)
+
+	_, err := readDNSTakeover(p)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, recordDNSTakeover(p, dnsPortOwnerResolved))
+	require.NoError(t, recordDNSTakeover(p, dnsPortOwnerDnsmasq))
+	require.NoError(t, recordDNSTakeover(p, dnsPortOwnerResolved))
+
+	owners, err := readDNSTakeover(p)
+	require.NoError(t, err)
+
+	assert.Equal(t, []dnsPortOwner{dnsPortOwnerResolved, dnsPortOwnerDnsmasq}, owners)
+}
@@ -0,0 +1,353 @@
+//go:build linux
+
+package home
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResolvConfData is the contents of the resolv.conf file for tests.
+const testResolvConfData = "nameserver 192.0.2.1\n"
+
+// errSystemctl is the error returned by the fake systemctl for tests.
+const errSystemctl errors.Error = "systemctl failed"
+
+// newTestDNSPortManager returns a *dnsPortManager with a temporary root
+// directory for tests containing resolv.conf and, if withDnsmasq is true, the
+// dnsmasq configuration directory.  The commands run are appended to cmds.
+// runErr is returned by the fake command runner.
+func newTestDNSPortManager(
+	t *testing.T,
+	withDnsmasq bool,
+	cmds *[][]string,
+	runErr error,
+) (m *dnsPortManager) {
+	t.Helper()
+
+	root := t.TempDir()
+
+	etc := filepath.Join(root, "etc")
+	require.NoError(t, os.MkdirAll(etc, 0o755))
+
+	resolvPath := filepath.Join(root, resolvConfPath)
+	require.NoError(t, os.WriteFile(resolvPath, []byte(testResolvConfData), 0o644))
+
+	if withDnsmasq {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(dnsmasqConfPath)), 0o755))
+	}
+
+	return &dnsPortManager{
+		checkPort:    func(_ string, _ netip.AddrPort) (err error) { panic("not implemented") },
+		stubListener: func() (ok bool) { panic("not implemented") },
+		pidByCommand: func(_ string, _ ...int) (pid int, err error) { panic("not implemented") },
+		runCommand: func(command string, args ...string) (code int, out []byte, err error) {
+			*cmds = append(*cmds, append([]string{command}, args...))
+
+			return 0, nil, runErr
+		},
+		root:         root,
+		takeoverPath: filepath.Join(root, dnsTakeoverFile),
+		detect:       true,
+	}
+}
+
+func TestDNSPortManager_conflict(t *testing.T) {
+	const port uint16 = 53
+
+	errInUse := &os.SyscallError{Syscall: "bind", Err: syscall.EADDRINUSE}
+	errNotFound := errors.Error("not found")
+
+	addr := netip.MustParseAddr("192.0.2.1")
+
+	testCases := []struct {
+		checkErr   error
+		dnsmasqErr error
+		name       string
+		want       dnsPortOwner
+		hosts      []netip.Addr
+		port       uint16
+		stub       bool
+		detect     bool
+	}{{
+		checkErr:   errInUse,
+		dnsmasqErr: nil,
+		name:       "no_port",
+		want:       dnsPortOwnerNone,
+		hosts:      nil,
+		port:       0,
+		stub:       true,
+		detect:     true,
+	}, {
+		checkErr:   nil,
+		dnsmasqErr: nil,
+		name:       "free",
+		want:       dnsPortOwnerNone,
+		hosts:      []netip.Addr{addr},
+		port:       port,
+		stub:       true,
+		detect:     true,
+	}, {
+		checkErr:   syscall.EACCES,
+		dnsmasqErr: nil,
+		name:       "other_error",
+		want:       dnsPortOwnerNone,
+		hosts:      []netip.Addr{addr},
+		port:       port,
+		stub:       true,
+		detect:     true,
+	}, {
+		checkErr:   errInUse,
+		dnsmasqErr: nil,
+		name:       "resolved",
+		want:       dnsPortOwnerResolved,
+		hosts:      nil,
+		port:       port,
+		stub:       true,
+		detect:     true,
+	}, {
+		checkErr:   errInUse,
+		dnsmasqErr: nil,
+		name:       "dnsmasq",
+		want:       dnsPortOwnerDnsmasq,
+		hosts:      []netip.Addr{addr},
+		port:       port,
+		stub:       false,
+		detect:     true,
+	}, {
+		checkErr:   errInUse,
+		dnsmasqErr: errNotFound,
+		name:       "unknown_owner",
+		want:       dnsPortOwnerNone,
+		hosts:      []netip.Addr{addr},
+		port:       port,
+		stub:       false,
+		detect:     true,
+	}, {
+		checkErr:   errInUse,
+		dnsmasqErr: nil,
+		name:       "no_detection",
+		want:       dnsPortOwnerNone,
+		hosts:      []netip.Addr{addr},
+		port:       port,
+		stub:       true,
+		detect:     false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var checked []netip.AddrPort
+			m := &dnsPortManager{
+				checkPort: func(network string, ipp netip.AddrPort) (err error) {
+					assert.Equal(t, "udp", network)
+					checked = append(checked, ipp)
+
+					return tc.checkErr
+				},
+				stubListener: func() (ok bool) { return tc.stub },
+				pidByCommand: func(command string, _ ...int) (pid int, err error) {
+					assert.Equal(t, string(dnsPortOwnerDnsmasq), command)
+
+					return 1, tc.dnsmasqErr
+				},
+				runCommand: func(_ string, _ ...string) (code int, out []byte, err error) {
+					panic("not implemented")
+				},
+				detect: tc.detect,
+			}
+
+			assert.Equal(t, tc.want, m.conflict(tc.hosts, tc.port))
+
+			if tc.port == 0 {
+				assert.Empty(t, checked)
+			} else if len(tc.hosts) == 0 {
+				want := netip.AddrPortFrom(netip.IPv4Unspecified(), tc.port)
+				assert.Equal(t, []netip.AddrPort{want}, checked)
+			}
+		})
+	}
+}
+
+func TestDNSPortManager_takeOver(t *testing.T) {
+	restartResolved := []string{"systemctl", "reload-or-restart", "systemd-resolved"}
+	restartDnsmasq := []string{"systemctl", "reload-or-restart", "dnsmasq"}
+
+	testCases := []struct {
+		runErr       error
+		wantErr      error
+		wantFiles    map[string]string
+		name         string
+		owner        dnsPortOwner
+		wantNoFiles  []string
+		wantCmds     [][]string
+		wantRecorded []dnsPortOwner
+		withDnsmasq  bool
+		wantSymlink  bool
+	}{{
+		runErr:  nil,
+		wantErr: nil,
+		wantFiles: map[string]string{
+			resolvedConfPath:           resolvedConfData,
+			resolvConfPath + ".backup": testResolvConfData,
+		},
+		name:         "resolved",
+		owner:        dnsPortOwnerResolved,
+		wantNoFiles:  nil,
+		wantCmds:     [][]string{restartResolved},
+		wantRecorded: []dnsPortOwner{dnsPortOwnerResolved},
+		withDnsmasq:  false,
+		wantSymlink:  true,
+	}, {
+		runErr:  errSystemctl,
+		wantErr: errSystemctl,
+		wantFiles: map[string]string{
+			resolvedConfPath: resolvedConfData,
+		},
+		name:         "resolved_restart_error",
+		owner:        dnsPortOwnerResolved,
+		wantNoFiles:  nil,
+		wantCmds:     [][]string{restartResolved},
+		wantRecorded: nil,
+		withDnsmasq:  false,
+		wantSymlink:  true,
+	}, {
+		runErr:  nil,
+		wantErr: nil,
+		wantFiles: map[string]string{
+			dnsmasqConfPath: dnsmasqConfData,
+			resolvConfPath:  testResolvConfData,
+		},
+		name:         "dnsmasq",
+		owner:        dnsPortOwnerDnsmasq,
+		wantNoFiles:  []string{resolvedConfPath},
+		wantCmds:     [][]string{restartDnsmasq},
+		wantRecorded: []dnsPortOwner{dnsPortOwnerDnsmasq},
+		withDnsmasq:  true,
+		wantSymlink:  false,
+	}, {
+		runErr:       nil,
+		wantErr:      os.ErrNotExist,
+		wantFiles:    map[string]string{resolvConfPath: testResolvConfData},
+		name:         "dnsmasq_no_dir",
+		owner:        dnsPortOwnerDnsmasq,
+		wantNoFiles:  []string{dnsmasqConfPath},
+		wantCmds:     nil,
+		wantRecorded: nil,
+		withDnsmasq:  false,
+		wantSymlink:  false,
+	}, {
+		runErr:       errSystemctl,
+		wantErr:      errSystemctl,
+		wantFiles:    nil,
+		name:         "dnsmasq_restart_error",
+		owner:        dnsPortOwnerDnsmasq,
+		wantNoFiles:  []string{dnsmasqConfPath},
+		wantCmds:     [][]string{restartDnsmasq},
+		wantRecorded: nil,
+		withDnsmasq:  true,
+		wantSymlink:  false,
+	}, {
+		runErr:       nil,
+		wantErr:      errors.ErrBadEnumValue,
+		wantFiles:    map[string]string{resolvConfPath: testResolvConfData},
+		name:         "bad_owner",
+		owner:        "unbound",
+		wantNoFiles:  []string{resolvedConfPath, dnsmasqConfPath},
+		wantCmds:     nil,
+		wantRecorded: nil,
+		withDnsmasq:  true,
+		wantSymlink:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds [][]string
+			m := newTestDNSPortManager(t, tc.withDnsmasq, &cmds, tc.runErr)
+
+			err := m.takeOver(tc.owner)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.wantCmds, cmds)
+
+			for p, want := range tc.wantFiles {
+				b, readErr := os.ReadFile(m.path(p))
+				require.NoError(t, readErr)
+
+				assert.Equal(t, want, string(b), p)
+			}
+
+			for _, p := range tc.wantNoFiles {
+				assert.NoFileExists(t, m.path(p))
+			}
+
+			if tc.wantSymlink {
+				target, linkErr := os.Readlink(m.path(resolvConfPath))
+				require.NoError(t, linkErr)
+
+				assert.Equal(t, "/run/systemd/resolve/resolv.conf", target)
+			}
+
+			owners, err := readDNSTakeover(m.takeoverPath)
+			if tc.wantRecorded == nil {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			} else {
+				require.NoError(t, err)
+
+				assert.Equal(t, tc.wantRecorded, owners)
+			}
+		})
+	}
+}
+
+func TestDNSPortManager_revert(t *testing.T) {
+	var cmds [][]string
+	m := newTestDNSPortManager(t, true, &cmds, nil)
+
+	require.NoError(t, m.takeOver(dnsPortOwnerResolved))
+	require.NoError(t, m.takeOver(dnsPortOwnerDnsmasq))
+
+	cmds = nil
+	m.revert()
+
+	assert.Equal(t, [][]string{
+		{"systemctl", "reload-or-restart", "systemd-resolved"},
+		{"systemctl", "reload-or-restart", "dnsmasq"},
+	}, cmds)
+
+	resolvPath := m.path(resolvConfPath)
+	fi, err := os.Lstat(resolvPath)
+	require.NoError(t, err)
+
+	assert.True(t, fi.Mode().IsRegular())
+
+	b, err := os.ReadFile(resolvPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, testResolvConfData, string(b))
+
+	for _, p := range []string{
+		m.path(resolvedConfPath),
+		m.path(dnsmasqConfPath),
+		resolvPath + ".backup",
+		m.takeoverPath,
+	} {
+		assert.NoFileExists(t, p)
+	}
+
+	// Reverting again must be a no-op.
+	cmds = nil
+	m.revert()
+
+	assert.Empty(t, cmds)
+}
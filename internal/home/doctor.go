@@ -0,0 +1,519 @@
+package home
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/netip"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// doctorStatus is the status of a self-test check.
+type doctorStatus uint8
+
+// Valid doctorStatus values.
+const (
+	doctorOK doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+// String implements the [fmt.Stringer] interface for doctorStatus.
+func (s doctorStatus) String() (str string) {
+	switch s {
+	case doctorOK:
+		return "OK"
+	case doctorWarn:
+		return "WARN"
+	case doctorFail:
+		return "FAIL"
+	default:
+		return fmt.Sprintf("!bad_status_%d", s)
+	}
+}
+
+// doctorResult is the result of a single self-test check.
+type doctorResult struct {
+	// check is the name of the check.
+	check string
+
+	// msg describes the result.
+	msg string
+
+	// fix is the suggested fix, if any.
+	fix string
+
+	// status is the status of the check.
+	status doctorStatus
+}
+
+// Fixes for the port checks.
+const (
+	fixBindInUse = "stop the program using the port or change the port in the " +
+		"configuration file, see " +
+		"https://github.com/AdguardTeam/AdGuardHome/wiki/FAQ#bindinuse"
+	fixBindPermission = "run AdGuard Home as root or, on Linux, grant it the " +
+		"CAP_NET_BIND_SERVICE capability, see " +
+		"https://github.com/AdguardTeam/AdGuardHome/wiki/Getting-Started#running-without-superuser"
+)
+
+// doctorCertExpiryWarn is the time before the expiration of the TLS certificate
+// starting from which the certificate check warns about it.
+const doctorCertExpiryWarn = 30 * timeutil.Day
+
+// doctorTimeURL is the URL the current time is requested from to check the
+// system clock.
+const doctorTimeURL = "https://static.adtidy.org/"
+
+// doctorMaxClockSkew is the maximum difference between the system clock and
+// the time reported by [doctorTimeURL] considered normal.
+const doctorMaxClockSkew = time.Minute
+
+// runDoctor runs the self-test checks against the current configuration, prints
+// the results to stdout, and returns the exit code, which is non-zero if any of
+// the checks has failed.
+func runDoctor() (code int) {
+	pid := runningInstancePID()
+
+	var results []*doctorResult
+	results = append(results, doctorCheckPorts(pid)...)
+	results = append(results, doctorCheckResolvers()...)
+	results = append(results, doctorCheckCert()...)
+	results = append(results, doctorCheckUpstreams()...)
+	results = append(results, doctorCheckPermissions()...)
+	results = append(results, doctorCheckTime())
+
+	return printDoctorResults(os.Stdout, results)
+}
+
+// printDoctorResults writes results to w along with the summary and returns the
+// exit code.
+func printDoctorResults(w io.Writer, results []*doctorResult) (code int) {
+	b := &strings.Builder{}
+
+	var warns, fails int
+	for _, res := range results {
+		switch res.status {
+		case doctorWarn:
+			warns++
+		case doctorFail:
+			fails++
+		}
+
+		_, _ = fmt.Fprintf(b, "[%-4s] %s: %s\n", res.status, res.check, res.msg)
+		if res.fix != "" {
+			_, _ = fmt.Fprintf(b, "       fix: %s\n", res.fix)
+		}
+	}
+
+	_, _ = fmt.Fprintf(
+		b,
+		"\n%d checks, %d warnings, %d failures\n",
+		len(results),
+		warns,
+		fails,
+	)
+
+	_, err := io.WriteString(w, b.String())
+	if err != nil {
+		log.Error("doctor: writing results: %s", err)
+	}
+
+	if fails > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// runningInstancePID returns the PID of another running AdGuard Home process or
+// zero if there is none or it can't be determined.
+func runningInstancePID() (pid int) {
+	if runtime.GOOS == "windows" {
+		return 0
+	}
+
+	pid, err := aghos.PIDByCommand(serviceName, os.Getpid())
+	if err != nil {
+		log.Debug("doctor: looking for running instance: %s", err)
+
+		return 0
+	}
+
+	return pid
+}
+
+// doctorPort is a port AdGuard Home is configured to serve on.
+type doctorPort struct {
+	// service is the human-readable name of the service.
+	service string
+
+	// network is either "tcp" or "udp".
+	network string
+
+	// addr is the address to bind to.
+	addr netip.AddrPort
+}
+
+// doctorPorts returns the ports of the web interface, the DNS server, and the
+// encrypted DNS servers configured in conf.
+func doctorPorts(conf *configuration) (ports []*doctorPort) {
+	add := func(service, network string, addr netip.Addr, port uint16) {
+		if port == 0 {
+			return
+		}
+
+		ports = append(ports, &doctorPort{
+			service: service,
+			network: network,
+			addr:    netip.AddrPortFrom(addr, port),
+		})
+	}
+
+	webAddr := conf.HTTPConfig.Address
+	add("web interface", "tcp", webAddr.Addr(), webAddr.Port())
+
+	bindHosts := conf.DNS.BindHosts
+	if len(bindHosts) == 0 {
+		bindHosts = []netip.Addr{netip.IPv4Unspecified()}
+	}
+
+	tlsConf := conf.TLS
+	for _, host := range bindHosts {
+		add("DNS", "udp", host, conf.DNS.Port)
+		add("DNS", "tcp", host, conf.DNS.Port)
+
+		if tlsConf.Enabled {
+			add("DNS-over-TLS", "tcp", host, tlsConf.PortDNSOverTLS)
+			add("DNS-over-QUIC", "udp", host, tlsConf.PortDNSOverQUIC)
+			add("DNSCrypt", "udp", host, tlsConf.PortDNSCrypt)
+			add("DNSCrypt", "tcp", host, tlsConf.PortDNSCrypt)
+		}
+	}
+
+	if tlsConf.Enabled {
+		add("HTTPS", "tcp", webAddr.Addr(), tlsConf.PortHTTPS)
+		if conf.DNS.ServeHTTP3 {
+			add("HTTPS", "udp", webAddr.Addr(), tlsConf.PortHTTPS)
+		}
+	}
+
+	return ports
+}
+
+// doctorCheckPorts checks if the configured ports are available for binding.
+// pid is the PID of another running AdGuard Home process, if any.
+func doctorCheckPorts(pid int) (results []*doctorResult) {
+	for _, p := range doctorPorts(config) {
+		res := &doctorResult{
+			check: fmt.Sprintf("port %s %s/%s", p.service, p.addr, p.network),
+			msg:   "available",
+		}
+
+		err := aghnet.CheckPort(p.network, p.addr)
+		switch {
+		case err == nil:
+			// Go on.
+		case aghnet.IsAddrInUse(err) && pid != 0:
+			res.status = doctorWarn
+			res.msg = fmt.Sprintf("in use, probably by the running AdGuard Home with pid %d", pid)
+			res.fix = "stop AdGuard Home to check the ports"
+		case aghnet.IsAddrInUse(err):
+			res.status, res.msg, res.fix = doctorFail, "in use by another program", fixBindInUse
+		case errors.Is(err, os.ErrPermission):
+			res.status, res.msg, res.fix = doctorFail, "permission denied", fixBindPermission
+		default:
+			res.status = doctorFail
+			res.msg = err.Error()
+			res.fix = "check that the address is assigned to a network interface"
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// doctorCheckResolvers checks if the DNS servers commonly conflicting with
+// AdGuard Home are running.
+func doctorCheckResolvers() (results []*doctorResult) {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	for _, r := range []struct {
+		// command is the name of the process, note that Linux truncates them
+		// to 15 characters.
+		command string
+		name    string
+		fix     string
+	}{{
+		command: "systemd-resolve",
+		name:    "systemd-resolved",
+		fix: "if it listens on port 53, disable its DNSStubListener, see " +
+			"https://github.com/AdguardTeam/AdGuardHome/wiki/FAQ#bindinuse",
+	}, {
+		command: "dnsmasq",
+		name:    "dnsmasq",
+		fix: "if it listens on port 53, disable its DNS server with port=0 in " +
+			"its configuration or stop it; its settings can be imported with " +
+			"--import-dnsmasq",
+	}} {
+		res := &doctorResult{
+			check: "resolver " + r.name,
+			msg:   "not running",
+		}
+
+		pid, err := aghos.PIDByCommand(r.command)
+		if err != nil {
+			log.Debug("doctor: looking for %s: %s", r.command, err)
+		} else {
+			res.status = doctorWarn
+			res.msg = fmt.Sprintf("running with pid %d", pid)
+			res.fix = r.fix
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// doctorCheckCert checks the TLS certificate, if the encryption is enabled.
+func doctorCheckCert() (results []*doctorResult) {
+	if !config.TLS.Enabled {
+		return nil
+	}
+
+	res := &doctorResult{
+		check: "certificate",
+	}
+
+	tlsConf := config.TLS
+	status := &tlsConfigStatus{}
+	err := loadTLSConf(&tlsConf, status)
+	if err != nil {
+		res.status = doctorFail
+		res.msg = err.Error()
+		res.fix = "fix the certificate and the private key in the encryption settings"
+
+		return []*doctorResult{res}
+	}
+
+	res.msg = fmt.Sprintf("valid until %s", status.NotAfter.Format(time.DateOnly))
+	untilExpiry := time.Until(status.NotAfter)
+	switch {
+	case untilExpiry <= 0:
+		res.status = doctorFail
+		res.msg = fmt.Sprintf("expired on %s", status.NotAfter.Format(time.DateOnly))
+		res.fix = "renew the certificate"
+	case untilExpiry < doctorCertExpiryWarn:
+		res.status = doctorWarn
+		res.fix = "renew the certificate"
+	case !status.ValidChain:
+		res.status = doctorWarn
+		res.msg = "not issued by a trusted certificate authority"
+		res.fix = "use a certificate from a trusted authority, e.g. Let's Encrypt, " +
+			"since clients may reject it"
+	case status.WarningValidation != "":
+		res.status = doctorWarn
+		res.msg = status.WarningValidation
+		res.fix = "fix the certificate in the encryption settings"
+	}
+
+	return []*doctorResult{res}
+}
+
+// doctorCheckUpstreams checks the availability of the configured upstream DNS
+// servers.
+func doctorCheckUpstreams() (results []*doctorResult) {
+	upstreams := config.DNS.UpstreamDNS
+	if fn := config.DNS.UpstreamDNSFileName; fn != "" {
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			return []*doctorResult{{
+				check:  "upstreams",
+				msg:    err.Error(),
+				fix:    "check the upstream_dns_file setting in the configuration file",
+				status: doctorFail,
+			}}
+		}
+
+		upstreams = stringutil.SplitTrimmed(string(data), "\n")
+	}
+
+	upstreams = stringutil.FilterOut(upstreams, dnsforward.IsCommentOrEmpty)
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	statuses, err := dnsforward.CheckUpstreams(
+		upstreams,
+		config.DNS.BootstrapDNS,
+		config.Timeouts.Upstream.Duration,
+	)
+	if err != nil {
+		return []*doctorResult{{
+			check:  "upstreams",
+			msg:    err.Error(),
+			fix:    "fix the bootstrap DNS servers in the DNS settings",
+			status: doctorFail,
+		}}
+	}
+
+	for _, u := range slices.Sorted(maps.Keys(statuses)) {
+		res := &doctorResult{
+			check: "upstream " + u,
+			msg:   "reachable",
+		}
+
+		if st := statuses[u]; st != "OK" {
+			res.status = doctorFail
+			res.msg = st
+			res.fix = "check the network connection, the address of the upstream, " +
+				"and the bootstrap DNS servers"
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// doctorCheckPermissions checks if the working directory, the configuration
+// file, and the data directory are only accessible by their owner.
+func doctorCheckPermissions() (results []*doctorResult) {
+	for _, p := range []struct {
+		path string
+		want fs.FileMode
+	}{{
+		path: Context.workDir,
+		want: aghos.DefaultPermDir,
+	}, {
+		path: configFilePath(),
+		want: aghos.DefaultPermFile,
+	}, {
+		path: Context.getDataDir(),
+		want: aghos.DefaultPermDir,
+	}} {
+		fi, err := aghos.Stat(p.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			results = append(results, &doctorResult{
+				check:  "permissions " + p.path,
+				msg:    err.Error(),
+				status: doctorWarn,
+			})
+
+			continue
+		}
+
+		results = append(results, permissionsResult(p.path, fi.Mode().Perm(), p.want))
+	}
+
+	return results
+}
+
+// permissionsResult returns the result of checking the permissions perm of the
+// file at p against want.
+func permissionsResult(p string, perm, want fs.FileMode) (res *doctorResult) {
+	res = &doctorResult{
+		check: "permissions " + p,
+		msg:   fmt.Sprintf("%#o", perm),
+	}
+
+	if perm&^want == 0 {
+		return res
+	}
+
+	res.status = doctorWarn
+	res.msg = fmt.Sprintf("%#o allows access to other users; want %#o", perm, want)
+	if runtime.GOOS == "windows" {
+		res.fix = "remove the access of other users in the security properties"
+	} else {
+		res.fix = fmt.Sprintf("chmod %o %q", want, p)
+	}
+
+	return res
+}
+
+// doctorCheckTime checks if the system clock is in sync by comparing it with
+// the time reported by [doctorTimeURL].
+func doctorCheckTime() (res *doctorResult) {
+	remote, err := remoteTime(doctorTimeURL)
+	if err == nil {
+		return clockSkewResult(time.Now(), remote)
+	}
+
+	res = &doctorResult{
+		check:  "time sync",
+		msg:    fmt.Sprintf("can't get current time: %s", err),
+		status: doctorWarn,
+	}
+
+	var certErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) && certErr.Reason == x509.Expired {
+		// An expired or not yet valid certificate is most likely a sign of a
+		// badly wrong system clock.
+		res.status = doctorFail
+		res.fix = "set the system time and enable NTP synchronization"
+	}
+
+	return res
+}
+
+// clockSkewResult returns the result of the time sync check depending on the
+// difference between the local and the remote time.
+func clockSkewResult(local, remote time.Time) (res *doctorResult) {
+	skew := local.Sub(remote).Abs().Truncate(time.Second)
+	res = &doctorResult{
+		check: "time sync",
+		msg:   fmt.Sprintf("clock skew %s", skew),
+	}
+
+	if skew > doctorMaxClockSkew {
+		res.status = doctorWarn
+		res.fix = "enable NTP synchronization; a wrong clock breaks TLS " +
+			"certificate and DNSSEC validation"
+	}
+
+	return res
+}
+
+// remoteTime returns the time from the Date header of the response to the HEAD
+// request to u.
+func remoteTime(u string) (t time.Time, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return time.Time{}, err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	return http.ParseTime(resp.Header.Get("Date"))
+}
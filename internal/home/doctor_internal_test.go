@@ -0,0 +1,123 @@
+package home
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoctorPorts(t *testing.T) {
+	bindHost := netip.MustParseAddr("192.0.2.1")
+	webHost := netip.MustParseAddr("192.0.2.2")
+
+	conf := &configuration{
+		HTTPConfig: httpConfig{
+			Address: netip.AddrPortFrom(webHost, 3000),
+		},
+		DNS: dnsConfig{
+			BindHosts:  []netip.Addr{bindHost},
+			Port:       53,
+			ServeHTTP3: true,
+		},
+		TLS: tlsConfigSettings{
+			Enabled:         true,
+			PortHTTPS:       443,
+			PortDNSOverTLS:  853,
+			PortDNSOverQUIC: 0,
+		},
+	}
+
+	assert.Equal(t, []*doctorPort{{
+		service: "web interface",
+		network: "tcp",
+		addr:    netip.AddrPortFrom(webHost, 3000),
+	}, {
+		service: "DNS",
+		network: "udp",
+		addr:    netip.AddrPortFrom(bindHost, 53),
+	}, {
+		service: "DNS",
+		network: "tcp",
+		addr:    netip.AddrPortFrom(bindHost, 53),
+	}, {
+		service: "DNS-over-TLS",
+		network: "tcp",
+		addr:    netip.AddrPortFrom(bindHost, 853),
+	}, {
+		service: "HTTPS",
+		network: "tcp",
+		addr:    netip.AddrPortFrom(webHost, 443),
+	}, {
+		service: "HTTPS",
+		network: "udp",
+		addr:    netip.AddrPortFrom(webHost, 443),
+	}}, doctorPorts(conf))
+
+	conf.TLS.Enabled = false
+	conf.DNS.BindHosts = nil
+
+	ports := doctorPorts(conf)
+	if assert.Len(t, ports, 3) {
+		assert.Equal(t, netip.IPv4Unspecified(), ports[1].addr.Addr())
+	}
+}
+
+func TestPrintDoctorResults(t *testing.T) {
+	results := []*doctorResult{{
+		check:  "ok check",
+		msg:    "fine",
+		status: doctorOK,
+	}, {
+		check:  "warn check",
+		msg:    "suspicious",
+		fix:    "fix it",
+		status: doctorWarn,
+	}}
+
+	b := &strings.Builder{}
+	code := printDoctorResults(b, results)
+	assert.Zero(t, code)
+	assert.Equal(t, "[OK  ] ok check: fine\n"+
+		"[WARN] warn check: suspicious\n"+
+		"       fix: fix it\n"+
+		"\n2 checks, 1 warnings, 0 failures\n", b.String())
+
+	results = append(results, &doctorResult{
+		check:  "fail check",
+		msg:    "broken",
+		status: doctorFail,
+	})
+
+	b.Reset()
+	code = printDoctorResults(b, results)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, b.String(), "[FAIL] fail check: broken\n")
+}
+
+func TestPermissionsResult(t *testing.T) {
+	res := permissionsResult("dir", 0o700, aghos.DefaultPermDir)
+	assert.Equal(t, doctorOK, res.status)
+
+	res = permissionsResult("file", 0o400, aghos.DefaultPermFile)
+	assert.Equal(t, doctorOK, res.status)
+
+	res = permissionsResult("file", 0o644, aghos.DefaultPermFile)
+	assert.Equal(t, doctorWarn, res.status)
+	assert.NotEmpty(t, res.fix)
+}
+
+func TestClockSkewResult(t *testing.T) {
+	now := time.Now()
+
+	res := clockSkewResult(now, now.Add(-10*time.Second))
+	assert.Equal(t, doctorOK, res.status)
+	assert.Equal(t, "clock skew 10s", res.msg)
+
+	res = clockSkewResult(now, now.Add(time.Hour))
+	assert.Equal(t, doctorWarn, res.status)
+	assert.NotEmpty(t, res.fix)
+}
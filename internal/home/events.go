@@ -0,0 +1,203 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/c2h5oh/datasize"
+)
+
+// eventsConfig is the configuration of the event bus.
+type eventsConfig struct {
+	// DiskFreeMin is the amount of the free space on the disk with the data
+	// directory below which the disk_low event is published.  If zero, the
+	// free space isn't checked.
+	DiskFreeMin datasize.ByteSize `yaml:"disk_free_min"`
+
+	// Size is the maximum number of the recent events kept.
+	Size uint `yaml:"size"`
+}
+
+// initEvents initializes the event bus and registers its HTTP API.
+func initEvents(ctx context.Context, logger *slog.Logger) (err error) {
+	httpRegister(http.MethodGet, "/control/events", handleEvents)
+
+	Context.events, err = events.New(ctx, &events.Config{
+		Logger:   logger.With(slogutil.KeyPrefix, "events"),
+		FilePath: filepath.Join(Context.getDataDir(), "events.json"),
+		Size:     config.Events.Size,
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return nil
+}
+
+// publishEvent publishes e, if the event bus is initialized.
+func publishEvent(e *events.Event) {
+	if Context.events != nil {
+		Context.events.Publish(context.Background(), e)
+	}
+}
+
+// eventsJSON is the response to the GET /control/events HTTP API.
+type eventsJSON struct {
+	// Events are the recent events, newest first.
+	Events []*events.Event `json:"events"`
+}
+
+// handleEvents is the handler for the GET /control/events HTTP API.  The
+// severity query parameter sets the minimum severity of the returned events,
+// and the limit one sets their maximum number.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	minSev := events.SeverityInfo
+	if sevStr := q.Get("severity"); sevStr != "" {
+		var err error
+		minSev, err = events.ParseSeverity(sevStr)
+		if err != nil {
+			writeError(r, w, http.StatusBadRequest, "parsing severity: %s", err)
+
+			return
+		}
+	}
+
+	var limit uint64
+	if limitStr := q.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.ParseUint(limitStr, 10, 0)
+		if err != nil {
+			writeError(r, w, http.StatusBadRequest, "parsing limit: %s", err)
+
+			return
+		}
+	}
+
+	resp := &eventsJSON{
+		Events: []*events.Event{},
+	}
+
+	if b := Context.events; b != nil {
+		resp.Events = b.Recent(minSev, uint(limit))
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// diskCheckIvl is the interval of checking the free space on the disk with the
+// data directory.
+const diskCheckIvl = 10 * time.Minute
+
+// diskMonitor checks the free space on the disk with the data directory in the
+// background and publishes the event once the space becomes low.
+type diskMonitor struct {
+	// free returns the free space on the disk containing path.  It's
+	// [aghos.DiskFree] shadowed for tests.
+	free func(path string) (free uint64, err error)
+
+	// publish publishes the events.
+	publish func(e *events.Event)
+
+	// done is closed to stop the background checks.
+	done chan struct{}
+
+	// path is the path to the data directory.
+	path string
+
+	// min is the free space considered low.
+	min uint64
+
+	// low is true if the low space has been reported and the space hasn't
+	// been freed since then.  It's only accessed in [diskMonitor.check].
+	low bool
+}
+
+// newDiskMonitor returns a new properly initialized *diskMonitor or nil if the
+// checks are disabled.
+func newDiskMonitor(conf *eventsConfig, path string) (m *diskMonitor) {
+	if conf == nil || conf.DiskFreeMin == 0 {
+		return nil
+	}
+
+	return &diskMonitor{
+		free:    aghos.DiskFree,
+		publish: publishEvent,
+		done:    make(chan struct{}),
+		path:    path,
+		min:     conf.DiskFreeMin.Bytes(),
+	}
+}
+
+// start starts checking the free space in the background.
+func (m *diskMonitor) start() {
+	go m.run()
+}
+
+// close stops the background checks.
+func (m *diskMonitor) close() {
+	close(m.done)
+}
+
+// run checks the free space right away and then once in [diskCheckIvl].
+func (m *diskMonitor) run() {
+	defer log.OnPanic("events: disk monitor")
+
+	t := time.NewTicker(diskCheckIvl)
+	defer t.Stop()
+
+	for {
+		// Defer the alerts during the maintenance.
+		if !maintenanceActive() {
+			m.check()
+		}
+
+		select {
+		case <-t.C:
+			// Go on.
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// check checks the free space and publishes the event if it has become low.
+func (m *diskMonitor) check() {
+	free, err := m.free(m.path)
+	if err != nil {
+		log.Error("events: checking disk: %s", err)
+
+		return
+	}
+
+	if free >= m.min {
+		m.low = false
+
+		return
+	} else if m.low {
+		return
+	}
+
+	m.low = true
+	m.publish(&events.Event{
+		Data: map[string]string{
+			"path": m.path,
+			"free": strconv.FormatUint(free, 10),
+		},
+		Type:     events.TypeDiskLow,
+		Message:  fmt.Sprintf("low disk space at %s: %s free", m.path, datasize.ByteSize(free).HR()),
+		Severity: events.SeverityWarning,
+	})
+}
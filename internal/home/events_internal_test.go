@@ -0,0 +1,119 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskMonitor_check(t *testing.T) {
+	const minFree = 100
+
+	var free uint64
+	var published []*events.Event
+	m := &diskMonitor{
+		free: func(_ string) (f uint64, err error) { return free, nil },
+		publish: func(e *events.Event) {
+			published = append(published, e)
+		},
+		path: "/data",
+		min:  minFree,
+	}
+
+	free = minFree
+	m.check()
+	assert.Empty(t, published)
+
+	free = minFree - 1
+	m.check()
+	m.check()
+	require.Len(t, published, 1)
+
+	assert.Equal(t, events.TypeDiskLow, published[0].Type)
+	assert.Equal(t, "99", published[0].Data["free"])
+
+	// The event is published again once the space has been freed and has
+	// become low again.
+	free = minFree
+	m.check()
+
+	free = 0
+	m.check()
+	assert.Len(t, published, 2)
+}
+
+func TestHandleEvents(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	b, err := events.New(ctx, &events.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Size:   10,
+	})
+	require.NoError(t, err)
+
+	prev := Context.events
+	Context.events = b
+	t.Cleanup(func() { Context.events = prev })
+
+	b.Publish(ctx, &events.Event{Type: events.TypeFilterUpdated, Severity: events.SeverityInfo})
+	b.Publish(ctx, &events.Event{Type: events.TypeUpstreamDown, Severity: events.SeverityWarning})
+	b.Publish(ctx, &events.Event{Type: events.TypeDiskLow, Severity: events.SeverityWarning})
+
+	testCases := []struct {
+		name       string
+		query      string
+		wantTypes  []events.Type
+		wantStatus int
+	}{{
+		name:       "all",
+		query:      "",
+		wantTypes:  []events.Type{events.TypeDiskLow, events.TypeUpstreamDown, events.TypeFilterUpdated},
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "severity",
+		query:      "?severity=warning&limit=1",
+		wantTypes:  []events.Type{events.TypeDiskLow},
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "bad_severity",
+		query:      "?severity=fatal",
+		wantTypes:  nil,
+		wantStatus: http.StatusBadRequest,
+	}, {
+		name:       "bad_limit",
+		query:      "?limit=-1",
+		wantTypes:  nil,
+		wantStatus: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/control/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+
+			handleEvents(w, r)
+			require.Equal(t, tc.wantStatus, w.Code)
+
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			resp := &eventsJSON{}
+			err = json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			var types []events.Type
+			for _, e := range resp.Events {
+				types = append(types, e.Type)
+			}
+
+			assert.Equal(t, tc.wantTypes, types)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package home
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// firewallRuleGroup is the group of the firewall rules managed by AdGuard Home.
+const firewallRuleGroup = "AdGuard Home"
+
+// DHCP server ports.
+const (
+	dhcpV4ServerPort = 67
+	dhcpV6ServerPort = 547
+)
+
+// firewallManager keeps the inbound rules of the Windows Firewall in sync with
+// the ports AdGuard Home serves on.
+type firewallManager struct {
+	// set replaces the rules of the group.  It's [aghos.SetFirewallRules]
+	// shadowed for tests.
+	set func(group, appPath string, rules []*aghos.FirewallRule) (err error)
+
+	// mu protects rules.
+	mu *sync.Mutex
+
+	// rules are the rules set last time.
+	rules []*aghos.FirewallRule
+
+	// appPath is the path to the executable the rules allow the traffic for.
+	appPath string
+}
+
+// newFirewallManager returns a new properly initialized *firewallManager for
+// the executable at execPath or nil if the firewall rules aren't managed, that
+// is on operating systems other than Windows and without the administrator
+// rights.
+func newFirewallManager(execPath string) (m *firewallManager) {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+
+	if ok, err := aghos.HaveAdminRights(); !ok || err != nil {
+		log.Debug("firewall: not managing rules without admin rights, err: %v", err)
+
+		return nil
+	}
+
+	return &firewallManager{
+		set:     aghos.SetFirewallRules,
+		mu:      &sync.Mutex{},
+		appPath: execPath,
+	}
+}
+
+// syncFirewallRules updates the firewall rules according to the current
+// configuration, if they're managed.
+func syncFirewallRules() {
+	m := Context.firewall
+	if m == nil {
+		return
+	}
+
+	var rules []*aghos.FirewallRule
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		rules = firewallRules(config)
+	}()
+
+	m.update(rules)
+}
+
+// update sets the rules, unless they're the same as the ones set before.
+func (m *firewallManager) update(rules []*aghos.FirewallRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eq := func(a, b *aghos.FirewallRule) (ok bool) { return *a == *b }
+	if m.rules != nil && slices.EqualFunc(m.rules, rules, eq) {
+		return
+	}
+
+	err := m.set(firewallRuleGroup, m.appPath, rules)
+	if err != nil {
+		log.Error("firewall: setting rules: %s", err)
+
+		return
+	}
+
+	log.Info("firewall: set %d inbound rules", len(rules))
+
+	// Keep the slice non-nil to distinguish the first update.
+	m.rules = append(make([]*aghos.FirewallRule, 0, len(rules)), rules...)
+}
+
+// firewallRules returns the inbound firewall rules for the ports of the DNS,
+// encrypted DNS, and DHCP servers configured in conf.
+func firewallRules(conf *configuration) (rules []*aghos.FirewallRule) {
+	add := func(service, proto string, port uint16) {
+		if port == 0 {
+			return
+		}
+
+		rules = append(rules, &aghos.FirewallRule{
+			Name:  fmt.Sprintf("%s %s (%s %d)", firewallRuleGroup, service, strings.ToUpper(proto), port),
+			Proto: proto,
+			Port:  port,
+		})
+	}
+
+	add("DNS", "udp", conf.DNS.Port)
+	add("DNS", "tcp", conf.DNS.Port)
+
+	if tlsConf := conf.TLS; tlsConf.Enabled {
+		add("DNS-over-TLS", "tcp", tlsConf.PortDNSOverTLS)
+		add("DNS-over-HTTPS", "tcp", tlsConf.PortHTTPS)
+		if conf.DNS.ServeHTTP3 {
+			add("DNS-over-HTTPS", "udp", tlsConf.PortHTTPS)
+		}
+
+		add("DNS-over-QUIC", "udp", tlsConf.PortDNSOverQUIC)
+		add("DNSCrypt", "udp", tlsConf.PortDNSCrypt)
+		add("DNSCrypt", "tcp", tlsConf.PortDNSCrypt)
+	}
+
+	if dhcpConf := conf.DHCP; dhcpConf != nil && dhcpConf.Enabled {
+		add("DHCP", "udp", dhcpV4ServerPort)
+		if dhcpConf.Conf6.RangeStart != nil {
+			add("DHCPv6", "udp", dhcpV6ServerPort)
+		}
+	}
+
+	return rules
+}
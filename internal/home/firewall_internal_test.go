@@ -0,0 +1,109 @@
+package home
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirewallRules(t *testing.T) {
+	conf := &configuration{
+		DNS: dnsConfig{
+			Port:       53,
+			ServeHTTP3: true,
+		},
+		TLS: tlsConfigSettings{
+			Enabled:        true,
+			PortHTTPS:      443,
+			PortDNSOverTLS: 853,
+		},
+		DHCP: &dhcpd.ServerConfig{
+			Enabled: true,
+			Conf6: dhcpd.V6ServerConf{
+				RangeStart: net.ParseIP("2001:db8::1"),
+			},
+		},
+	}
+
+	assert.Equal(t, []*aghos.FirewallRule{{
+		Name:  "AdGuard Home DNS (UDP 53)",
+		Proto: "udp",
+		Port:  53,
+	}, {
+		Name:  "AdGuard Home DNS (TCP 53)",
+		Proto: "tcp",
+		Port:  53,
+	}, {
+		Name:  "AdGuard Home DNS-over-TLS (TCP 853)",
+		Proto: "tcp",
+		Port:  853,
+	}, {
+		Name:  "AdGuard Home DNS-over-HTTPS (TCP 443)",
+		Proto: "tcp",
+		Port:  443,
+	}, {
+		Name:  "AdGuard Home DNS-over-HTTPS (UDP 443)",
+		Proto: "udp",
+		Port:  443,
+	}, {
+		Name:  "AdGuard Home DHCP (UDP 67)",
+		Proto: "udp",
+		Port:  67,
+	}, {
+		Name:  "AdGuard Home DHCPv6 (UDP 547)",
+		Proto: "udp",
+		Port:  547,
+	}}, firewallRules(conf))
+
+	conf.TLS.Enabled = false
+	conf.DHCP.Enabled = false
+
+	assert.Len(t, firewallRules(conf), 2)
+}
+
+func TestFirewallManager_update(t *testing.T) {
+	var (
+		calls int
+		got   []*aghos.FirewallRule
+	)
+
+	m := &firewallManager{
+		set: func(group, appPath string, rules []*aghos.FirewallRule) (err error) {
+			assert.Equal(t, firewallRuleGroup, group)
+			assert.Equal(t, "AdGuardHome.exe", appPath)
+
+			calls++
+			got = rules
+
+			return nil
+		},
+		mu:      &sync.Mutex{},
+		appPath: "AdGuardHome.exe",
+	}
+
+	rules := []*aghos.FirewallRule{{
+		Name:  "AdGuard Home DNS (UDP 53)",
+		Proto: "udp",
+		Port:  53,
+	}}
+
+	m.update(rules)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, rules, got)
+
+	// Equal, but not the same, rules must not be set again.
+	m.update([]*aghos.FirewallRule{{
+		Name:  "AdGuard Home DNS (UDP 53)",
+		Proto: "udp",
+		Port:  53,
+	}})
+	assert.Equal(t, 1, calls)
+
+	m.update(nil)
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, got)
+}
@@ -0,0 +1,50 @@
+package home
+
+import (
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// closeHashPrefixCheckers saves the caches of the safe browsing and parental
+// control checkers, if any.
+func closeHashPrefixCheckers() {
+	for _, c := range []*hashprefix.Checker{Context.safeBrowsing, Context.parental} {
+		if c == nil {
+			continue
+		}
+
+		err := c.Close()
+		if err != nil {
+			log.Error("closing hash-prefix checker: %s", err)
+		}
+	}
+}
+
+// lookupCacheStatsJSON is the response to the GET /control/lookup_cache/stats
+// HTTP API.
+type lookupCacheStatsJSON struct {
+	SafeBrowsing *hashprefix.CacheStats `json:"safebrowsing"`
+	Parental     *hashprefix.CacheStats `json:"parental"`
+}
+
+// handleLookupCacheStats is the handler for the GET /control/lookup_cache/stats
+// HTTP API.
+func handleLookupCacheStats(w http.ResponseWriter, r *http.Request) {
+	resp := &lookupCacheStatsJSON{
+		SafeBrowsing: &hashprefix.CacheStats{},
+		Parental:     &hashprefix.CacheStats{},
+	}
+
+	if c := Context.safeBrowsing; c != nil {
+		resp.SafeBrowsing = c.CacheStats()
+	}
+
+	if c := Context.parental; c != nil {
+		resp.Parental = c.CacheStats()
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
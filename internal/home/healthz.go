@@ -0,0 +1,199 @@
+package home
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Components of AdGuard Home reported by the health check.
+const (
+	healthCompBootstrap = "bootstrap"
+	healthCompClock     = "clock"
+	healthCompDNS       = "dns"
+	healthCompFilters   = "filters"
+)
+
+// healthState contains the problems of the components making AdGuard Home work
+// in a degraded state, for example while the network isn't up yet on boot.
+type healthState struct {
+	// mu protects issues.
+	mu *sync.Mutex
+
+	// issues maps the components to the descriptions of their problems.
+	issues map[string]string
+}
+
+// health is the global health state.
+var health = &healthState{
+	mu:     &sync.Mutex{},
+	issues: map[string]string{},
+}
+
+// set sets the problem of the component, or clears it if err is nil.
+func (h *healthState) set(component string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		delete(h.issues, component)
+	} else {
+		h.issues[component] = err.Error()
+	}
+}
+
+// clone returns a copy of the current problems.
+func (h *healthState) clone() (issues map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return maps.Clone(h.issues)
+}
+
+// Intervals of retrying the startup steps, which depend on the network.
+const (
+	bootRetryMinIvl = 1 * time.Second
+	bootRetryMaxIvl = 1 * time.Minute
+)
+
+// retryWithBackoff calls f until it succeeds, waiting between the attempts for
+// an interval doubled each time, and sets the problem of the component to the
+// error of the last failed attempt.  isRetriable decides if the error is worth
+// retrying; if it's not, retryWithBackoff returns it.  If ctx is canceled while
+// waiting, retryWithBackoff returns ctx.Err().
+func retryWithBackoff(
+	ctx context.Context,
+	component string,
+	f func() (err error),
+	isRetriable func(err error) (ok bool),
+) (err error) {
+	defer health.set(component, nil)
+
+	for ivl := bootRetryMinIvl; ; ivl = min(ivl*2, bootRetryMaxIvl) {
+		err = f()
+		if err == nil || !isRetriable(err) {
+			return err
+		}
+
+		health.set(component, err)
+		log.Info("%s: warning: %s; retrying in %s", component, err, ivl)
+
+		t := time.NewTimer(ivl)
+		select {
+		case <-t.C:
+			// Go on.
+		case <-ctx.Done():
+			t.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// waitDNSBindAddrs waits until the addresses the DNS server is configured to
+// listen on are assigned to the network interfaces, which may happen after
+// AdGuard Home is started on boot.  It stops waiting once ctx is canceled.
+func waitDNSBindAddrs(ctx context.Context) {
+	var (
+		hosts []netip.Addr
+		port  uint16
+	)
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		hosts = slices.Clone(config.DNS.BindHosts)
+		port = config.DNS.Port
+	}()
+
+	if port == 0 {
+		return
+	}
+
+	checkAddrs := func() (err error) {
+		for _, host := range hosts {
+			err = aghnet.CheckPort("udp", netip.AddrPortFrom(host, port))
+			if aghnet.IsAddrNotAvailable(err) {
+				return err
+			}
+		}
+
+		// Don't report other errors, since starting the server reports them
+		// more clearly.
+		return nil
+	}
+
+	_ = retryWithBackoff(ctx, healthCompDNS, checkAddrs, aghnet.IsAddrNotAvailable)
+}
+
+// resolveUpstreamHosts resolves the hostnames of the upstream servers until it
+// succeeds to make sure the bootstrap servers are reachable.  It's intended to
+// be used as a goroutine.  It stops once ctx is canceled.
+func resolveUpstreamHosts(ctx context.Context) {
+	defer log.OnPanic("dns: resolving upstreams")
+
+	srv := Context.dnsServer
+	if srv == nil {
+		return
+	}
+
+	resolve := func() (err error) {
+		resCtx, cancel := context.WithTimeout(ctx, bootRetryMaxIvl)
+		defer cancel()
+
+		return srv.ResolveUpstreamHosts(resCtx)
+	}
+
+	err := retryWithBackoff(ctx, healthCompBootstrap, resolve, func(_ error) (ok bool) {
+		// Stop retrying once the server is reconfigured or stopped.
+		return Context.dnsServer == srv && isRunning()
+	})
+	if err != nil {
+		log.Debug("dns: resolving upstreams: %s", err)
+	}
+}
+
+// healthJSON is the JSON structure for the health check.
+type healthJSON struct {
+	// Issues maps the components working in a degraded state to the
+	// descriptions of their problems.
+	Issues map[string]string `json:"issues,omitempty"`
+
+	// Status is either "ok" or "degraded".
+	Status string `json:"status"`
+}
+
+// handleHealthz is the handler for the GET /healthz HTTP API.  It doesn't
+// require authentication, so that it could be used by the service managers and
+// the monitoring.  It responds with 503 if AdGuard Home works in a degraded
+// state.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	issues := health.clone()
+	if !clockSane() {
+		issues[healthCompClock] = "system clock is wrong"
+	}
+
+	if f := Context.filters; f != nil && f.UpdatesFailing() {
+		issues[healthCompFilters] = "updating filters failed because of a network error"
+	}
+
+	resp := &healthJSON{
+		Status: "ok",
+	}
+
+	code := http.StatusOK
+	if len(issues) > 0 {
+		resp.Status, resp.Issues = "degraded", issues
+		code = http.StatusServiceUnavailable
+	}
+
+	aghhttp.WriteJSONResponse(w, r, code, resp)
+}
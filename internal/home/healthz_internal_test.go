@@ -0,0 +1,105 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	const testComp = "test"
+
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		health.set(testComp, nil)
+
+		return nil
+	})
+
+	testCases := []struct {
+		err      error
+		want     *healthJSON
+		name     string
+		wantCode int
+	}{{
+		err: nil,
+		want: &healthJSON{
+			Status: "ok",
+		},
+		name:     "ok",
+		wantCode: http.StatusOK,
+	}, {
+		err: errors.Error("network is down"),
+		want: &healthJSON{
+			Issues: map[string]string{testComp: "network is down"},
+			Status: "degraded",
+		},
+		name:     "degraded",
+		wantCode: http.StatusServiceUnavailable,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			health.set(testComp, tc.err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			handleHealthz(w, r)
+
+			require.Equal(t, tc.wantCode, w.Code)
+
+			got := &healthJSON{}
+			err := json.NewDecoder(w.Body).Decode(got)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	const testComp = "test"
+
+	errFatal := errors.Error("fatal")
+
+	calls := 0
+	err := retryWithBackoff(context.Background(), testComp, func() (err error) {
+		calls++
+
+		return errFatal
+	}, func(err error) (ok bool) {
+		return !errors.Is(err, errFatal)
+	})
+
+	assert.ErrorIs(t, err, errFatal)
+	assert.Equal(t, 1, calls)
+	assert.NotContains(t, health.clone(), testComp)
+}
+
+func TestRetryWithBackoff_cancel(t *testing.T) {
+	const testComp = "test_cancel"
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errRetriable := errors.Error("retriable")
+
+	calls := 0
+	err := retryWithBackoff(ctx, testComp, func() (err error) {
+		calls++
+		cancel()
+
+		return errRetriable
+	}, func(_ error) (ok bool) {
+		return true
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+	assert.NotContains(t, health.clone(), testComp)
+}
@@ -28,9 +28,12 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/inventory"
+	"github.com/AdguardTeam/AdGuardHome/internal/openwrt"
 	"github.com/AdguardTeam/AdGuardHome/internal/permcheck"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
@@ -64,9 +67,63 @@ type homeContext struct {
 	// configuration files, for example /etc/hosts.
 	etcHosts *aghnet.HostsContainer
 
+	// linkMonitor tracks the addresses of the network interfaces to restart
+	// the DNS server when those change.
+	linkMonitor aghnet.LinkMonitor
+
+	// inventory is the inventory of the devices on the local networks.  It's
+	// nil if the inventory is disabled.
+	inventory *inventory.Inventory
+
+	// events is the bus of the notable events.  It's nil until the
+	// initialization of the modules.
+	events *events.Bus
+
+	// diskMonitor checks the free space on the disk with the data directory.
+	// It's nil if the checks are disabled.
+	diskMonitor *diskMonitor
+
+	// firewall manages the Windows Firewall rules.  It's nil if the rules
+	// aren't managed.
+	firewall *firewallManager
+
+	// pfTable exports the disallowed clients into a pf table.  It's nil if
+	// the export is disabled.
+	pfTable *pfTableExporter
+
+	// safeBrowsing and parental are the hash-prefix checkers of the safe
+	// browsing and the parental control.  Their caches are saved on shutdown.
+	safeBrowsing *hashprefix.Checker
+	parental     *hashprefix.Checker
+
+	// timeChecker checks the system clock.  It's nil if the checks are
+	// disabled.
+	timeChecker *timeChecker
+
+	// maintenance tells if the maintenance is in progress.  It's nil until the
+	// initialization of the modules.
+	maintenance *maintenance
+
+	// ubus is the ubus object of AdGuard Home on OpenWrt.  It's nil if the
+	// ubus integration is disabled.
+	ubus *openwrt.UbusObject
+
 	// mux is our custom http.ServeMux.
 	mux *http.ServeMux
 
+	// listeners are the listening sockets of the web interface passed between
+	// the processes on update.
+	listeners *listenerHandoff
+
+	// privateNets are the private networks used by the DNS server.  It's nil
+	// until the DNS server is initialized.
+	privateNets *privateSubnets
+
+	// localHostnames are the hostnames within the local domain used by the
+	// rewrites and the persistent clients.  The DHCP server doesn't assign
+	// them to its clients.
+	localHostnames *localHostnames
+
 	// Runtime properties
 	// --
 
@@ -82,9 +139,21 @@ type homeContext struct {
 	// tlsCipherIDs are the ID of the cipher suites that AdGuard Home must use.
 	tlsCipherIDs []uint16
 
+	// stopBoot cancels the startup steps retried in the background, such as
+	// waiting for the network.  It's nil until those are started.
+	stopBoot context.CancelFunc
+
+	// signals receives the OS signals handled by AdGuard Home.  It's also used
+	// to initiate the graceful shutdown from the HTTP API.
+	signals chan os.Signal
+
 	// firstRun, if true, tells AdGuard Home to only start the web interface
 	// service, and only serve the first-run APIs.
 	firstRun bool
+
+	// sandbox, if true, tells AdGuard Home to serve the HTTP API with the
+	// synthetic data instead of serving DNS.  See [startSandbox].
+	sandbox bool
 }
 
 // getDataDir returns path to the directory where we store databases and filters
@@ -113,6 +182,7 @@ func Main(clientBuildFS fs.FS) {
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	Context.signals = signals
 
 	go func() {
 		ctx := context.Background()
@@ -123,7 +193,13 @@ func Main(clientBuildFS fs.FS) {
 			case syscall.SIGHUP:
 				Context.clients.storage.ReloadARP(ctx)
 				Context.tls.reload()
+
+				err := reloadConfig(ctx)
+				if err != nil {
+					log.Error("reloading config: %s", err)
+				}
 			default:
+				drainDNSServer(ctx)
 				cleanup(ctx)
 				cleanupAlways()
 				close(done)
@@ -148,6 +224,7 @@ func setupContext(opts options) (err error) {
 
 	Context.tlsRoots = aghtls.SystemRootCAs()
 	Context.mux = http.NewServeMux()
+	Context.listeners = newListenerHandoff()
 
 	if !opts.noEtcHosts {
 		err = setupHostsContainer()
@@ -158,25 +235,72 @@ func setupContext(opts options) (err error) {
 	}
 
 	if Context.firstRun {
+		if opts.doctor {
+			os.Exit(runDoctor())
+		}
+
+		if opts.importPihole != "" || opts.importDnsmasq != "" {
+			log.Error("importing configuration: no configuration file, run the setup wizard first")
+
+			os.Exit(1)
+		}
+
 		log.Info("This is the first time AdGuard Home is launched")
 		checkPermissions()
 
 		return nil
 	}
 
-	err = parseConfig()
+	if opts.downgradeConfig {
+		err = downgradeConfigFile()
+		if err != nil {
+			log.Error("downgrading configuration file: %s", err)
+
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	err = parseConfig(opts.migrationDryRun)
 	if err != nil {
 		log.Error("parsing configuration file: %s", err)
 
 		os.Exit(1)
 	}
 
-	if opts.checkConfig {
+	if opts.checkConfig || opts.migrationDryRun {
 		log.Info("configuration file is ok")
 
 		os.Exit(0)
 	}
 
+	if opts.doctor {
+		os.Exit(runDoctor())
+	}
+
+	if opts.importPihole != "" {
+		err = importPihole(opts.importPihole)
+		if err != nil {
+			log.Error("importing pi-hole configuration: %s", err)
+
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if opts.importDnsmasq != "" {
+		err = importDnsmasqFile(opts.importDnsmasq)
+		if err != nil {
+			log.Error("importing dnsmasq configuration: %s", err)
+
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
 	return nil
 }
 
@@ -278,8 +402,34 @@ func setupOpts(opts options) (err error) {
 	return nil
 }
 
+// onDHCPPoolUsage records the usage of a DHCP address pool in the statistics,
+// if those are initialized.
+func onDHCPPoolUsage(u *dhcpd.PoolUsage) {
+	if Context.stats == nil {
+		return
+	}
+
+	Context.stats.UpdatePoolUsage(&stats.PoolUsage{
+		Name:   u.Name,
+		Leased: u.Leased,
+		Size:   u.Size,
+	})
+}
+
 // initContextClients initializes Context clients and related fields.
 func initContextClients(ctx context.Context, logger *slog.Logger) (err error) {
+	err = initEvents(ctx, logger)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	err = initMaintenance()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
 	err = setupDNSFilteringConf(ctx, logger, config.Filtering)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
@@ -291,6 +441,22 @@ func initContextClients(ctx context.Context, logger *slog.Logger) (err error) {
 	config.DHCP.DataDir = Context.getDataDir()
 	config.DHCP.HTTPRegister = httpRegister
 	config.DHCP.ConfigModified = onConfigModified
+	config.DHCP.OnPoolUsage = onDHCPPoolUsage
+
+	Context.localHostnames = newLocalHostnames()
+	config.DHCP.HostnameOwner = Context.localHostnames.owner
+
+	// The DHCP server always uses the network neighborhood to detect the IP
+	// address conflicts, regardless of whether it's a source of the runtime
+	// clients.
+	arpDB := arpdb.New(logger.With(slogutil.KeyError, "arpdb"))
+	config.DHCP.ARPDB = arpDB
+
+	err = initInventory(ctx, logger, arpDB)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
 
 	Context.dhcpServer, err = dhcpd.Create(config.DHCP)
 	if Context.dhcpServer == nil || err != nil {
@@ -301,18 +467,19 @@ func initContextClients(ctx context.Context, logger *slog.Logger) (err error) {
 		return fmt.Errorf("initing dhcp: %w", err)
 	}
 
-	var arpDB arpdb.Interface
+	var clientsARPDB arpdb.Interface
 	if config.Clients.Sources.ARP {
-		arpDB = arpdb.New(logger.With(slogutil.KeyError, "arpdb"))
+		clientsARPDB = arpDB
 	}
 
 	return Context.clients.Init(
 		ctx,
 		logger,
 		config.Clients.Persistent,
+		config.Clients.Templates,
 		Context.dhcpServer,
 		Context.etcHosts,
-		arpDB,
+		clientsARPDB,
 		config.Filtering,
 	)
 }
@@ -364,15 +531,15 @@ func setupDNSFilteringConf(
 	conf *filtering.Config,
 ) (err error) {
 	const (
-		dnsTimeout = 3 * time.Second
-
 		sbService                 = "safe browsing"
 		defaultSafeBrowsingServer = `https://family.adguard-dns.com/dns-query`
 		sbTXTSuffix               = `sb.dns.adguard.com.`
+		sbCacheFileName           = "safebrowsing_cache.bin"
 
 		pcService             = "parental control"
 		defaultParentalServer = `https://family.adguard-dns.com/dns-query`
 		pcTXTSuffix           = `pc.dns.adguard.com.`
+		pcCacheFileName       = "parental_cache.bin"
 	)
 
 	conf.EtcHosts = Context.etcHosts
@@ -387,12 +554,19 @@ func setupDNSFilteringConf(
 	conf.Filters = slices.Clone(config.Filters)
 	conf.WhitelistFilters = slices.Clone(config.WhitelistFilters)
 	conf.UserRules = slices.Clone(config.UserRules)
-	conf.HTTPClient = httpClient()
+	conf.UserRulesMeta = slices.Clone(config.UserRulesMeta)
+	conf.UserName = webUserName
+	conf.HTTPClient = httpClient(config.Timeouts.FilterDownload.Duration)
+	conf.ClockSane = clockSane
+	conf.MaintenanceActive = maintenanceActive
+	if Context.events != nil {
+		conf.Events = Context.events
+	}
 
 	cacheTime := time.Duration(conf.CacheTime) * time.Minute
 
 	upsOpts := &upstream.Options{
-		Timeout: dnsTimeout,
+		Timeout: config.Timeouts.SafeBrowsing.Duration,
 		Bootstrap: upstream.StaticResolver{
 			// 94.140.14.15.
 			netip.AddrFrom4([4]byte{94, 140, 14, 15}),
@@ -410,13 +584,16 @@ func setupDNSFilteringConf(
 		return fmt.Errorf("converting safe browsing server: %w", err)
 	}
 
-	conf.SafeBrowsingChecker = hashprefix.New(&hashprefix.Config{
-		Upstream:    sbUps,
-		ServiceName: sbService,
-		TXTSuffix:   sbTXTSuffix,
-		CacheTime:   cacheTime,
-		CacheSize:   conf.SafeBrowsingCacheSize,
+	Context.safeBrowsing = hashprefix.New(&hashprefix.Config{
+		Upstream:          sbUps,
+		ServiceName:       sbService,
+		TXTSuffix:         sbTXTSuffix,
+		CacheFilePath:     filepath.Join(conf.DataDir, sbCacheFileName),
+		CacheTime:         cacheTime,
+		NegativeCacheTime: conf.NegativeCacheTime.Duration,
+		CacheSize:         conf.SafeBrowsingCacheSize,
 	})
+	conf.SafeBrowsingChecker = Context.safeBrowsing
 
 	// Protect against invalid configuration, see #6181.
 	//
@@ -434,13 +611,18 @@ func setupDNSFilteringConf(
 		return fmt.Errorf("converting parental server: %w", err)
 	}
 
-	conf.ParentalControlChecker = hashprefix.New(&hashprefix.Config{
-		Upstream:    parUps,
-		ServiceName: pcService,
-		TXTSuffix:   pcTXTSuffix,
-		CacheTime:   cacheTime,
-		CacheSize:   conf.ParentalCacheSize,
+	Context.parental = hashprefix.New(&hashprefix.Config{
+		Upstream:          parUps,
+		ServiceName:       pcService,
+		TXTSuffix:         pcTXTSuffix,
+		CacheFilePath:     filepath.Join(conf.DataDir, pcCacheFileName),
+		CacheTime:         cacheTime,
+		NegativeCacheTime: conf.NegativeCacheTime.Duration,
+		CacheSize:         conf.ParentalCacheSize,
 	})
+	conf.ParentalControlChecker = Context.parental
+
+	httpRegister(http.MethodGet, "/control/lookup_cache/stats", handleLookupCacheStats)
 
 	// Protect against invalid configuration, see #6181.
 	//
@@ -513,7 +695,7 @@ func initWeb(
 		}
 	}
 
-	disableUpdate := opts.disableUpdate
+	disableUpdate := opts.disableUpdate || opts.sandbox
 	switch version.Channel() {
 	case
 		version.ChannelDevelopment,
@@ -525,10 +707,23 @@ func initWeb(
 		log.Info("AdGuard Home updates are disabled")
 	}
 
+	securityHeaders, err := newSecurityHeaders(config.HTTPConfig.SecurityHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("http: security_headers: %w", err)
+	}
+
+	trustedProxies := netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies))
+	routes, err := newWebRoutes(config.HTTPConfig.Routes, config.DNS.DoHEndpoints, trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("http: routes: %w", err)
+	}
+
 	webConf := &webConfig{
 		updater: upd,
 
-		clientFS: clientFS,
+		clientFS:        clientFS,
+		securityHeaders: securityHeaders,
+		routes:          routes,
 
 		BindAddr: config.HTTPConfig.Address,
 
@@ -538,6 +733,7 @@ func initWeb(
 
 		firstRun:         Context.firstRun,
 		disableUpdate:    disableUpdate,
+		noSelfUpdate:     opts.noSelfUpdate,
 		runningAsService: opts.runningAsService,
 		serveHTTP3:       config.DNS.ServeHTTP3,
 	}
@@ -576,6 +772,12 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 
 	// Print the first message after logger is configured.
 	log.Info(version.Full())
+	if opts.sandbox {
+		Context.sandbox = true
+		err = initSandboxWorkDir()
+		fatalOnError(err)
+	}
+
 	log.Debug("current working directory is %s", Context.workDir)
 	if opts.runningAsService {
 		log.Info("AdGuard Home is running as a service")
@@ -587,6 +789,8 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	err = configureOS(config)
 	fatalOnError(err)
 
+	configureFromUCI()
+
 	// Clients package uses filtering package's static data
 	// (filtering.BlockedSvcKnown()), so we have to initialize filtering static
 	// data first, but also to avoid relying on automatic Go init() function.
@@ -604,6 +808,8 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	execPath, err := os.Executable()
 	fatalOnError(errors.Annotate(err, "getting executable path: %w"))
 
+	Context.firewall = newFirewallManager(execPath)
+
 	u := &url.URL{
 		Scheme: "https",
 		// TODO(a.garipov): Make configurable.
@@ -614,6 +820,12 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	confPath := configFilePath()
 	log.Debug("using config path %q for updater", confPath)
 
+	if reason, ok := aghos.IsContainer(); ok && !opts.noSelfUpdate {
+		log.Info("updater: running in a container (%s), self-update is disabled", reason)
+
+		opts.noSelfUpdate = true
+	}
+
 	upd := updater.NewUpdater(&updater.Config{
 		Client:          config.Filtering.HTTPClient,
 		Version:         version.Version(),
@@ -626,6 +838,7 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 		ConfName:        confPath,
 		ExecPath:        execPath,
 		VersionCheckURL: u.String(),
+		NoSelfUpdate:    opts.noSelfUpdate,
 	})
 
 	// TODO(e.burkov): This could be made earlier, probably as the option's
@@ -664,23 +877,77 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	statsDir, querylogDir, err := checkStatsAndQuerylogDirs(&Context, config)
 	fatalOnError(err)
 
-	if !Context.firstRun {
+	Context.timeChecker = newTimeChecker(config.TimeSanity)
+	if Context.timeChecker != nil {
+		Context.timeChecker.start()
+	}
+
+	Context.diskMonitor = newDiskMonitor(config.Events, Context.getDataDir())
+	if Context.diskMonitor != nil {
+		Context.diskMonitor.start()
+	}
+
+	if Context.sandbox {
+		err = startSandbox(slogLogger, statsDir, querylogDir)
+		fatalOnError(err)
+	} else if !Context.firstRun {
+		checkDNSPortConflict(opts.takeOverDNSPort)
+
 		err = initDNS(slogLogger, statsDir, querylogDir)
 		fatalOnError(err)
 
+		initPFTable()
+		syncFirewallRules()
+
 		Context.tls.start()
 
+		var bootCtx context.Context
+		bootCtx, Context.stopBoot = context.WithCancel(ctx)
+
 		go func() {
+			// The network may not be up yet when AdGuard Home is started on
+			// boot, so wait for the addresses instead of exiting.
+			waitDNSBindAddrs(bootCtx)
+			if bootCtx.Err() != nil {
+				// AdGuard Home is shutting down.
+				return
+			}
+
 			startErr := startDNSServer()
 			if startErr != nil {
 				closeDNSServer()
 				fatalOnError(startErr)
 			}
+
+			go resolveUpstreamHosts(bootCtx)
 		}()
 
+		startLinkMonitor()
+
+		if Context.inventory != nil {
+			err = Context.inventory.Start(ctx)
+			if err != nil {
+				log.Error("starting inventory: %s", err)
+			}
+		}
+
+		Context.ubus = initUbus(slogLogger)
+		if Context.ubus != nil {
+			err = Context.ubus.Start(ctx)
+			if err != nil {
+				log.Error("starting ubus object: %s", err)
+			}
+		}
+
 		if Context.dhcpServer != nil {
 			err = Context.dhcpServer.Start()
-			if err != nil {
+			if err != nil && aghos.IsJail() {
+				log.Error(
+					"starting dhcp server: %s; inside a jail, it requires access to bpf devices "+
+						"and raw sockets",
+					err,
+				)
+			} else if err != nil {
 				log.Error("starting dhcp server: %s", err)
 			}
 		}
@@ -692,6 +959,21 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 
 	permcheck.Check(Context.workDir, dataDir, statsDir, querylogDir, confPath)
 
+	if !Context.web.conf.disableUpdate {
+		var notifier *updateNotifier
+		notifier, err = newUpdateNotifier(
+			config.UpdateWebhook,
+			config.Filtering.HTTPClient,
+			upd,
+			opts.noSelfUpdate,
+		)
+		fatalOnError(err)
+
+		if notifier != nil {
+			go notifier.run()
+		}
+	}
+
 	Context.web.start()
 
 	// Wait for other goroutines to complete their job.
@@ -712,12 +994,39 @@ func initUsers() (auth *Auth, err error) {
 
 	trustedProxies := netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies))
 
+	passwords, err := newPasswordHashing(config.PasswordHashing)
+	if err != nil {
+		return nil, fmt.Errorf("password_hashing: %w", err)
+	}
+
+	binding, err := newSessionBinding(config.HTTPConfig.SessionBinding)
+	if err != nil {
+		return nil, fmt.Errorf("http: session_binding: %w", err)
+	}
+
 	sessionTTL := config.HTTPConfig.SessionTTL.Seconds()
-	auth = InitAuth(sessFilename, config.Users, uint32(sessionTTL), rateLimiter, trustedProxies)
+	auth = InitAuth(
+		sessFilename,
+		config.Users,
+		uint32(sessionTTL),
+		rateLimiter,
+		trustedProxies,
+		passwords,
+		onConfigModified,
+	)
 	if auth == nil {
 		return nil, errors.Error("initializing auth module failed")
 	}
 
+	auth.binding = binding
+
+	err = auth.initWebAuthn(config.WebAuthn)
+	if err != nil {
+		auth.Close()
+
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+
 	config.Users = nil
 
 	return auth, nil
@@ -848,6 +1157,10 @@ func initWorkingDir(opts options) (err error) {
 func cleanup(ctx context.Context) {
 	log.Info("stopping AdGuard Home")
 
+	if Context.stopBoot != nil {
+		Context.stopBoot()
+	}
+
 	if Context.web != nil {
 		Context.web.close(ctx)
 		Context.web = nil
@@ -869,15 +1182,72 @@ func cleanup(ctx context.Context) {
 		}
 	}
 
+	if Context.ubus != nil {
+		if err = Context.ubus.Shutdown(ctx); err != nil {
+			log.Error("stopping ubus object: %s", err)
+		}
+
+		Context.ubus = nil
+	}
+
+	if Context.inventory != nil {
+		if err = Context.inventory.Shutdown(ctx); err != nil {
+			log.Error("stopping inventory: %s", err)
+		}
+
+		Context.inventory = nil
+	}
+
 	if Context.etcHosts != nil {
 		if err = Context.etcHosts.Close(); err != nil {
 			log.Error("closing hosts container: %s", err)
 		}
 	}
 
+	if Context.linkMonitor != nil {
+		if err = Context.linkMonitor.Close(); err != nil {
+			log.Error("closing link monitor: %s", err)
+		}
+
+		Context.linkMonitor = nil
+	}
+
 	if Context.tls != nil {
+		Context.tls.close()
 		Context.tls = nil
 	}
+
+	if Context.diskMonitor != nil {
+		Context.diskMonitor.close()
+		Context.diskMonitor = nil
+	}
+
+	closeHashPrefixCheckers()
+
+	if Context.timeChecker != nil {
+		Context.timeChecker.close()
+		Context.timeChecker = nil
+	}
+}
+
+// drainDNSServer puts the DNS server into the drain mode and waits for the
+// requests being processed for at most the configured drain timeout.  It does
+// nothing if the timeout is zero.
+func drainDNSServer(ctx context.Context) {
+	timeout := config.DNS.DrainTimeout.Duration
+	if timeout <= 0 || !isRunning() {
+		return
+	}
+
+	log.Info("draining dns server for at most %s", timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := Context.dnsServer.Drain(ctx)
+	if err != nil {
+		log.Error("draining dns server: %s", err)
+	}
 }
 
 // This function is called before application exits
@@ -941,8 +1311,9 @@ func printHTTPAddresses(proto string) {
 	}
 
 	// TODO(e.burkov): Inspect and perhaps merge with the previous condition.
-	if proto == aghhttp.SchemeHTTPS && tlsConf.ServerName != "" {
-		printWebAddrs(proto, tlsConf.ServerName, tlsConf.PortHTTPS)
+	_, _, srvName := webCertPair(&tlsConf)
+	if proto == aghhttp.SchemeHTTPS && srvName != "" {
+		printWebAddrs(proto, srvName, tlsConf.PortHTTPS)
 
 		return
 	}
@@ -991,15 +1362,6 @@ func detectFirstRun() (ok bool) {
 	return true
 }
 
-// jsonError is a generic JSON error response.
-//
-// TODO(a.garipov): Merge together with the implementations in [dhcpd] and other
-// packages after refactoring the web handler registering.
-type jsonError struct {
-	// Message is the error message, an opaque string.
-	Message string `json:"message"`
-}
-
 // cmdlineUpdate updates current application and exits.  l must not be nil.
 func cmdlineUpdate(opts options, upd *updater.Updater, l *slog.Logger) {
 	if !opts.performUpdate {
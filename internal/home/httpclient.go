@@ -6,14 +6,16 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // httpClient returns a new HTTP client that uses the AdGuard Home's own DNS
-// server for resolving hostnames.  The resulting client should not be used
-// until [Context.dnsServer] is initialized.
+// server for resolving hostnames and gives up on the requests after timeout.
+// The resulting client should not be used until [Context.dnsServer] is
+// initialized.
 //
 // TODO(a.garipov, e.burkov): This is rather messy.  Refactor.
-func httpClient() (c *http.Client) {
+func httpClient(timeout time.Duration) (c *http.Client) {
 	// Do not use Context.dnsServer.DialContext directly in the struct literal
 	// below, since Context.dnsServer may be nil when this function is called.
 	dialContext := func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
@@ -21,8 +23,7 @@ func httpClient() (c *http.Client) {
 	}
 
 	return &http.Client{
-		// TODO(a.garipov): Make configurable.
-		Timeout: writeTimeout,
+		Timeout: timeout,
 		Transport: &http.Transport{
 			DialContext: dialContext,
 			Proxy:       httpProxy,
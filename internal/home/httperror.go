@@ -0,0 +1,128 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// jsonError is the structured error response of the HTTP API.
+//
+// TODO(a.garipov): Merge together with the implementations in [dhcpd] and other
+// packages after refactoring the web handler registering.
+type jsonError struct {
+	// Code is the machine-readable code of the error.
+	Code aghhttp.ErrorCode `json:"code"`
+
+	// Message is the error message, an opaque string.
+	Message string `json:"message"`
+
+	// Field is the JSON pointer to the invalid field of the request, if any.
+	Field string `json:"field,omitempty"`
+}
+
+// fieldError is an error about the value of a single field of the request.
+// The error responses for errors wrapping it contain the pointer to the field.
+type fieldError struct {
+	// err is the underlying error.
+	err error
+
+	// field is the JSON pointer to the field, for example "/upstreams".
+	field string
+}
+
+// type check
+var _ errors.Wrapper = (*fieldError)(nil)
+
+// newFieldError returns a new error about the value of the field.  err must not
+// be nil.
+func newFieldError(field string, err error) (wrapped error) {
+	return &fieldError{
+		err:   err,
+		field: field,
+	}
+}
+
+// Error implements the error interface for *fieldError.
+func (e *fieldError) Error() (msg string) {
+	return e.err.Error()
+}
+
+// Unwrap implements the [errors.Wrapper] interface for *fieldError.
+func (e *fieldError) Unwrap() (err error) {
+	return e.err
+}
+
+// newJSONError returns the structured error response with the HTTP status code
+// and msg.  The code and the field pointer are taken from the first of the
+// errors among args, for which they are known.
+func newJSONError(status int, msg string, args []any) (e *jsonError) {
+	e = &jsonError{
+		Code:    aghhttp.StatusErrorCode(status),
+		Message: msg,
+	}
+
+	for _, arg := range args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+
+		var (
+			fieldErr  *fieldError
+			syntaxErr *json.SyntaxError
+			typeErr   *json.UnmarshalTypeError
+		)
+
+		switch {
+		case errors.As(err, &fieldErr):
+			e.Code, e.Field = aghhttp.ErrorCodeVAL000, fieldErr.field
+		case errors.As(err, &syntaxErr):
+			e.Code = aghhttp.ErrorCodeJSN000
+		case errors.As(err, &typeErr):
+			e.Code, e.Field = aghhttp.ErrorCodeJSN001, jsonPointer(typeErr.Field)
+		case errors.Is(err, errClientNotFound):
+			e.Code = aghhttp.ErrorCodeENT404
+		case errors.Is(err, errInvalidCredentials):
+			e.Code = aghhttp.ErrorCodeAUT000
+		default:
+			continue
+		}
+
+		break
+	}
+
+	return e
+}
+
+// jsonPointer returns the JSON pointer to the field with the dot-separated path
+// as reported by package encoding/json.  If path is empty, pointer is empty.
+func jsonPointer(path string) (pointer string) {
+	if path == "" {
+		return ""
+	}
+
+	return "/" + strings.ReplaceAll(path, ".", "/")
+}
+
+// writeError writes the structured error response with the HTTP status code
+// and the formatted message to w and also logs it.
+func writeError(r *http.Request, w http.ResponseWriter, status int, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	log.Error("%s %s %s: %s", r.Method, r.Host, r.URL, text)
+
+	writeErrorResponse(w, r, status, newJSONError(status, text, args))
+}
+
+// writeErrorResponse writes e as the error response with the HTTP status code
+// to w.
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, e *jsonError) {
+	w.Header().Set(httphdr.XContentTypeOptions, aghhttp.HdrValNoSniff)
+	aghhttp.WriteJSONResponse(w, r, status, e)
+}
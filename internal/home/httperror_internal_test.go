@@ -0,0 +1,110 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewJSONError(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+	require.Error(t, syntaxErr)
+
+	typeErr := json.Unmarshal([]byte(`{"data":{"name":1}}`), &updateJSON{})
+	require.Error(t, typeErr)
+
+	testCases := []struct {
+		name   string
+		want   *jsonError
+		args   []any
+		status int
+	}{{
+		name: "status",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeTXT400,
+			Message: "test",
+		},
+		args:   []any{"test"},
+		status: http.StatusBadRequest,
+	}, {
+		name: "status_forbidden",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeAUT001,
+			Message: "test",
+		},
+		args:   []any{errors.Error("test")},
+		status: http.StatusForbidden,
+	}, {
+		name: "field",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeVAL000,
+			Message: "test",
+			Field:   "/upstreams",
+		},
+		args:   []any{fmt.Errorf("wrapped: %w", newFieldError("/upstreams", errors.Error("test")))},
+		status: http.StatusBadRequest,
+	}, {
+		name: "json_syntax",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeJSN000,
+			Message: "test",
+		},
+		args:   []any{syntaxErr},
+		status: http.StatusBadRequest,
+	}, {
+		name: "json_type",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeJSN001,
+			Message: "test",
+			Field:   "/data/name",
+		},
+		args:   []any{typeErr},
+		status: http.StatusBadRequest,
+	}, {
+		name: "not_found",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeENT404,
+			Message: "test",
+		},
+		args:   []any{"name", fmt.Errorf("%q: %w", "name", errClientNotFound)},
+		status: http.StatusNotFound,
+	}, {
+		name: "credentials",
+		want: &jsonError{
+			Code:    aghhttp.ErrorCodeAUT000,
+			Message: "test",
+		},
+		args:   []any{errInvalidCredentials},
+		status: http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, newJSONError(tc.status, "test", tc.args))
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/control/clients/delete", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+
+	writeError(r, w, http.StatusBadRequest, "%s", errEmptyClientName)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, aghhttp.HdrValApplicationJSON, w.Header().Get(httphdr.ContentType))
+	assert.JSONEq(t, `{
+		"code": "VAL000",
+		"message": "client name is required",
+		"field": "/name"
+	}`, w.Body.String())
+}
@@ -2,6 +2,7 @@ package home
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -72,14 +73,17 @@ func handleI18nChangeLanguage(w http.ResponseWriter, r *http.Request) {
 	langReq := &languageJSON{}
 	err := json.NewDecoder(r.Body).Decode(langReq)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "reading req: %s", err)
+		writeError(r, w, http.StatusInternalServerError, "reading req: %s", err)
 
 		return
 	}
 
 	lang := langReq.Language
 	if !allowedLanguages.Has(lang) {
-		aghhttp.Error(r, w, http.StatusBadRequest, "unknown language: %q", lang)
+		writeError(r, w, http.StatusBadRequest, "%s", newFieldError(
+			"/language",
+			fmt.Errorf("unknown language: %q", lang),
+		))
 
 		return
 	}
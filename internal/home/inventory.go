@@ -0,0 +1,89 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+	"github.com/AdguardTeam/AdGuardHome/internal/inventory"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// inventoryProbeTimeout is the time to wait for the replies of each device
+// inventory prober.
+const inventoryProbeTimeout = 2 * time.Second
+
+// initInventory initializes the device inventory, if it's enabled, and
+// registers its HTTP API.  arpDB must not be nil.
+func initInventory(ctx context.Context, logger *slog.Logger, arpDB arpdb.Interface) (err error) {
+	httpRegister(http.MethodGet, "/control/inventory", handleInventory)
+
+	conf := config.Inventory
+	if !conf.Enabled {
+		return nil
+	}
+
+	if conf.Interval.Duration <= 0 {
+		return fmt.Errorf("inventory: interval: must be positive, got %s", conf.Interval)
+	}
+
+	l := logger.With(slogutil.KeyPrefix, "inventory")
+	var probers []inventory.Prober
+	if aghos.RawSocketsAllowed() {
+		// Go first, since the replies fill the ARP cache of the OS used by
+		// the ARP prober.
+		probers = append(probers, inventory.NewICMPProber(l, inventoryProbeTimeout))
+	} else {
+		l.InfoContext(ctx, "raw sockets are not allowed, icmp probing is disabled")
+	}
+
+	probers = append(
+		probers,
+		inventory.NewARPProber(arpDB),
+		inventory.NewMDNSProber(l, inventoryProbeTimeout),
+		inventory.NewSSDPProber(l, inventoryProbeTimeout),
+	)
+
+	Context.inventory, err = inventory.New(ctx, &inventory.Config{
+		Logger:   l,
+		Subnets:  inventory.LocalSubnets,
+		FilePath: filepath.Join(Context.getDataDir(), "inventory.json"),
+		Probers:  probers,
+		Events:   Context.events,
+		Interval: conf.Interval.Duration,
+	})
+	if err != nil {
+		return fmt.Errorf("inventory: %w", err)
+	}
+
+	return nil
+}
+
+// inventoryJSON is the JSON representation of the device inventory.
+type inventoryJSON struct {
+	// Devices are the known devices sorted by their IP addresses.
+	Devices []*inventory.Device `json:"devices"`
+
+	// Enabled is true if the local networks are scanned periodically.
+	Enabled bool `json:"enabled"`
+}
+
+// handleInventory is the handler for the GET /control/inventory HTTP API.
+func handleInventory(w http.ResponseWriter, r *http.Request) {
+	resp := &inventoryJSON{
+		Devices: []*inventory.Device{},
+	}
+
+	if inv := Context.inventory; inv != nil {
+		resp.Enabled = true
+		resp.Devices = inv.Devices()
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
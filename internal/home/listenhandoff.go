@@ -0,0 +1,194 @@
+package home
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// envInheritedListeners is the environment variable with the listening sockets
+// inherited from the previous process after an update.  Its value is a
+// comma-separated list of "address=descriptor" pairs.
+const envInheritedListeners = "ADGUARDHOME_INHERITED_LISTENERS"
+
+// listenerHandoff passes the TCP listening sockets of the web interface to the
+// process replacing the current one after an update, so that the connections
+// made during the restart are queued by the kernel instead of being refused.
+//
+// TODO:  Hand over the DNS sockets as well once module dnsproxy supports
+// serving on the provided listeners.  Until then, the DNS requests sent during
+// the restart aren't answered.
+type listenerHandoff struct {
+	// mu protects inherited, active, and passed.
+	mu *sync.Mutex
+
+	// inherited are the sockets inherited from the previous process by their
+	// addresses.  The ones that have been used are removed.
+	inherited map[string]*os.File
+
+	// active are the listeners created by the current process by their
+	// addresses.
+	active map[string]*net.TCPListener
+
+	// passed are the duplicates of the active listeners prepared for the new
+	// process.  They are kept here, so that they aren't closed by the garbage
+	// collector before the exec.
+	passed []*os.File
+}
+
+// newListenerHandoff returns a new properly initialized *listenerHandoff with
+// the sockets inherited from the previous process, if any.  It also removes
+// [envInheritedListeners] from the environment, so that the child processes
+// don't inherit it.
+func newListenerHandoff() (h *listenerHandoff) {
+	h = &listenerHandoff{
+		mu:        &sync.Mutex{},
+		inherited: map[string]*os.File{},
+		active:    map[string]*net.TCPListener{},
+	}
+
+	val, ok := os.LookupEnv(envInheritedListeners)
+	if !ok {
+		return h
+	}
+
+	err := os.Unsetenv(envInheritedListeners)
+	if err != nil {
+		log.Debug("web: unsetting %s: %s", envInheritedListeners, err)
+	}
+
+	if val == "" {
+		return h
+	}
+
+	for _, pair := range strings.Split(val, ",") {
+		addr, fdStr, found := strings.Cut(pair, "=")
+		fd, parseErr := strconv.ParseUint(fdStr, 10, 0)
+		if !found || parseErr != nil {
+			log.Info("web: warning: bad inherited listener %q", pair)
+
+			continue
+		}
+
+		h.inherited[addr] = os.NewFile(uintptr(fd), "listener "+addr)
+	}
+
+	return h
+}
+
+// listen returns the listener for the TCP address addr.  It uses the socket
+// inherited from the previous process, if there is one, and creates a new one
+// otherwise.
+func (h *listenerHandoff) listen(addr string) (l net.Listener, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l = h.takeInheritedLocked(addr)
+	if l == nil {
+		l, err = net.Listen("tcp", addr)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	if tl, ok := l.(*net.TCPListener); ok {
+		h.active[addr] = tl
+	}
+
+	return l, nil
+}
+
+// takeInheritedLocked returns the listener inherited for addr, if there is a
+// usable one.  h.mu must be locked.
+func (h *listenerHandoff) takeInheritedLocked(addr string) (l net.Listener) {
+	f, ok := h.inherited[addr]
+	if !ok {
+		return nil
+	}
+
+	delete(h.inherited, addr)
+
+	// Close the inherited descriptor, since FileListener duplicates it.
+	defer func() { _ = f.Close() }()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		log.Info("web: warning: using inherited listener for %s: %s", addr, err)
+
+		return nil
+	}
+
+	log.Info("web: using listener for %s inherited from previous process", addr)
+
+	return l
+}
+
+// environ returns the environment for the process replacing the current one
+// with the active listeners kept open across the exec.  The listeners that
+// can't be passed are skipped, so that the new process creates them.  It must
+// be called before the listeners are closed.
+func (h *listenerHandoff) environ() (env []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var pairs []string
+	for addr, l := range h.active {
+		f, err := l.File()
+		if err != nil {
+			// The listener has likely been closed when the server had been
+			// rebound to another address.
+			log.Debug("web: passing listener for %s: %s", addr, err)
+
+			continue
+		}
+
+		fd, err := keptDescriptor(f)
+		if err != nil {
+			log.Info("web: warning: passing listener for %s: %s", addr, err)
+			_ = f.Close()
+
+			continue
+		}
+
+		// Don't close f, since its descriptor must stay open until the exec.
+		h.passed = append(h.passed, f)
+		pairs = append(pairs, fmt.Sprintf("%s=%d", addr, fd))
+	}
+
+	env = os.Environ()
+	if len(pairs) > 0 {
+		env = append(env, envInheritedListeners+"="+strings.Join(pairs, ","))
+	}
+
+	return env
+}
+
+// keptDescriptor makes the descriptor of f inherited by the program replacing
+// the current process and returns it.  It doesn't use f.Fd, since that puts the
+// socket shared with the running listener into the blocking mode.
+func keptDescriptor(f *os.File) (fd uintptr, err error) {
+	err = aghos.KeepOnExec(f)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, err
+	}
+
+	c, err := f.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("getting raw conn: %w", err)
+	}
+
+	err = c.Control(func(d uintptr) { fd = d })
+	if err != nil {
+		return 0, fmt.Errorf("getting descriptor: %w", err)
+	}
+
+	return fd, nil
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package home
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerHandoff(t *testing.T) {
+	t.Setenv(envInheritedListeners, "")
+
+	prev := newListenerHandoff()
+
+	l, err := prev.listen("127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := l.Addr().String()
+
+	// Register the listener by its actual address, as if it had been
+	// configured.
+	prev.active = map[string]*net.TCPListener{addr: l.(*net.TCPListener)}
+
+	env := prev.environ()
+	require.NoError(t, l.Close())
+
+	var val string
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, envInheritedListeners+"="); ok {
+			val = v
+		}
+	}
+
+	// Pass a duplicate, since the passed descriptor is still owned by prev
+	// within the same process.
+	passedAddr, fdStr, ok := strings.Cut(val, "=")
+	require.True(t, ok)
+	require.Equal(t, addr, passedAddr)
+
+	fd, err := strconv.Atoi(fdStr)
+	require.NoError(t, err)
+
+	dup, err := syscall.Dup(fd)
+	require.NoError(t, err)
+
+	t.Setenv(envInheritedListeners, addr+"="+strconv.Itoa(dup))
+
+	next := newListenerHandoff()
+	require.Len(t, next.inherited, 1)
+
+	inherited, err := next.listen(addr)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, inherited.Close)
+
+	assert.Empty(t, next.inherited)
+	assert.Equal(t, addr, inherited.Addr().String())
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	accepted, err := inherited.Accept()
+	require.NoError(t, err)
+
+	assert.NoError(t, accepted.Close())
+
+	for _, f := range prev.passed {
+		assert.NoError(t, f.Close())
+	}
+}
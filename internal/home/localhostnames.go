@@ -0,0 +1,121 @@
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// localHostOwner is a source of a hostname within the local domain other than
+// the DHCP server.
+type localHostOwner struct {
+	// desc is the human-readable description of the owner.
+	desc string
+
+	// ips are the addresses of the devices allowed to use the hostname.
+	ips []netip.Addr
+}
+
+// localHostnames is the snapshot of the hostnames within the local domain used
+// by the DNS rewrites and the persistent clients.  It's used by the DHCP server
+// to avoid the collisions of the hostnames of its clients with them.  It never
+// locks anything, since it's called from within the locked sections of the
+// DHCP server.
+type localHostnames struct {
+	// owners are the owners by their lowercased hostnames.
+	owners atomic.Pointer[map[string]*localHostOwner]
+}
+
+// newLocalHostnames returns a new empty *localHostnames.
+func newLocalHostnames() (h *localHostnames) {
+	h = &localHostnames{}
+	h.owners.Store(&map[string]*localHostOwner{})
+
+	return h
+}
+
+// owner implements the [dhcpd.HostnameOwnerFunc] for *localHostnames.
+func (h *localHostnames) owner(host string, ip netip.Addr) (owner string) {
+	o, ok := (*h.owners.Load())[host]
+	if !ok || slices.Contains(o.ips, ip) {
+		return ""
+	}
+
+	return o.desc
+}
+
+// update replaces the snapshot with the hostnames of the rewrites and the
+// persistent clients within localDomain.  The rewrites take precedence over
+// the clients.
+func (h *localHostnames) update(
+	localDomain string,
+	rewrites []*filtering.LegacyRewrite,
+	clients []*client.Persistent,
+) {
+	owners := map[string]*localHostOwner{}
+	suffix := "." + strings.ToLower(localDomain)
+	for _, rw := range rewrites {
+		domain := strings.ToLower(strings.TrimSuffix(rw.Domain, "."))
+		host, ok := strings.CutSuffix(domain, suffix)
+		if !ok || netutil.ValidateHostnameLabel(host) != nil {
+			continue
+		}
+
+		o := owners[host]
+		if o == nil {
+			o = &localHostOwner{
+				desc: fmt.Sprintf("rewrite for %s", domain),
+			}
+			owners[host] = o
+		}
+
+		if rw.IP.IsValid() {
+			o.ips = append(o.ips, rw.IP)
+		}
+	}
+
+	for _, c := range clients {
+		host := strings.ToLower(c.Name)
+		if _, ok := owners[host]; ok || netutil.ValidateHostnameLabel(host) != nil {
+			continue
+		}
+
+		owners[host] = &localHostOwner{
+			desc: fmt.Sprintf("client %q", c.Name),
+			ips:  slices.Clone(c.IPs),
+		}
+	}
+
+	h.owners.Store(&owners)
+}
+
+// refreshLocalHostnames updates the snapshot of the local hostnames in
+// [Context] from the current rewrites and persistent clients, if it's set.
+func refreshLocalHostnames() {
+	h := Context.localHostnames
+	if h == nil || config.DHCP == nil {
+		return
+	}
+
+	var rewrites []*filtering.LegacyRewrite
+	if Context.filters != nil {
+		rewrites = Context.filters.Rewrites()
+	}
+
+	var clients []*client.Persistent
+	if Context.clients.storage != nil {
+		Context.clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
+			clients = append(clients, c)
+
+			return true
+		})
+	}
+
+	h.update(config.DHCP.LocalDomainName, rewrites, clients)
+}
@@ -0,0 +1,81 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalHostnames(t *testing.T) {
+	nasIP := netip.MustParseAddr("192.168.0.10")
+	tvIP := netip.MustParseAddr("192.168.0.20")
+	otherIP := netip.MustParseAddr("192.168.0.30")
+
+	h := newLocalHostnames()
+	assert.Empty(t, h.owner("nas", otherIP))
+
+	h.update("lan", []*filtering.LegacyRewrite{{
+		Domain: "NAS.lan",
+		IP:     nasIP,
+	}, {
+		Domain: "nas.example.com",
+		IP:     nasIP,
+	}, {
+		Domain: "*.lan",
+		IP:     nasIP,
+	}}, []*client.Persistent{{
+		Name: "TV",
+		IPs:  []netip.Addr{tvIP},
+	}, {
+		Name: "nas",
+		IPs:  []netip.Addr{otherIP},
+	}, {
+		Name: "Living room",
+	}})
+
+	testCases := []struct {
+		name string
+		host string
+		want string
+		ip   netip.Addr
+	}{{
+		name: "rewrite",
+		host: "nas",
+		want: "rewrite for nas.lan",
+		ip:   otherIP,
+	}, {
+		name: "rewrite_same_ip",
+		host: "nas",
+		want: "",
+		ip:   nasIP,
+	}, {
+		name: "client",
+		host: "tv",
+		want: `client "TV"`,
+		ip:   otherIP,
+	}, {
+		name: "client_same_ip",
+		host: "tv",
+		want: "",
+		ip:   tvIP,
+	}, {
+		name: "invalid_name",
+		host: "living room",
+		want: "",
+		ip:   otherIP,
+	}, {
+		name: "unknown",
+		host: "laptop",
+		want: "",
+		ip:   otherIP,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, h.owner(tc.host, tc.ip))
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// maintenanceConfig is the configuration of the maintenance windows, during
+// which the periodic updates of the filters, the self-updates, and the alert
+// notifications are deferred.
+type maintenanceConfig struct {
+	// Until is the end of the maintenance started manually, if any.
+	Until *time.Time `yaml:"until,omitempty"`
+
+	// Windows are the scheduled maintenance windows.
+	Windows []*maintenanceWindow `yaml:"windows"`
+}
+
+// maintenanceWindow is a single scheduled maintenance window.  It's either a
+// weekly recurring one or a one-off one with the start and the end.
+type maintenanceWindow struct {
+	// Schedule is the weekly schedule of the window.  It must be nil if Start
+	// and End are set.
+	Schedule *schedule.Weekly `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+
+	// Start is the beginning of the one-off window.
+	Start *time.Time `yaml:"start,omitempty" json:"start,omitempty"`
+
+	// End is the end of the one-off window.  It must be after Start.
+	End *time.Time `yaml:"end,omitempty" json:"end,omitempty"`
+
+	// Name is the unique name of the window.  It must not be empty.
+	Name string `yaml:"name" json:"name"`
+}
+
+// validate returns an error if w is not a valid maintenance window.
+func (w *maintenanceWindow) validate() (err error) {
+	switch {
+	case w == nil:
+		return errors.ErrNoValue
+	case w.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case w.Schedule != nil:
+		if w.Start != nil || w.End != nil {
+			return errors.Error("schedule can't be combined with start and end")
+		}
+
+		return nil
+	case w.Start == nil:
+		return fmt.Errorf("start: %w", errors.ErrNoValue)
+	case w.End == nil:
+		return fmt.Errorf("end: %w", errors.ErrNoValue)
+	case !w.End.After(*w.Start):
+		return fmt.Errorf("end: %s is not after start %s", w.End, w.Start)
+	default:
+		return nil
+	}
+}
+
+// contains returns true if t is within w.
+func (w *maintenanceWindow) contains(t time.Time) (ok bool) {
+	if w.Schedule != nil {
+		return w.Schedule.Contains(t)
+	}
+
+	return !t.Before(*w.Start) && t.Before(*w.End)
+}
+
+// clone returns a deep copy of w.
+func (w *maintenanceWindow) clone() (c *maintenanceWindow) {
+	c = &maintenanceWindow{}
+	*c = *w
+	c.Schedule = w.Schedule.Clone()
+
+	return c
+}
+
+// validateMaintenanceWindows returns an error if any of windows is invalid or
+// their names aren't unique.
+func validateMaintenanceWindows(windows []*maintenanceWindow) (err error) {
+	names := container.NewMapSet[string]()
+	for i, w := range windows {
+		err = w.validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if names.Has(w.Name) {
+			return fmt.Errorf("at index %d: duplicate name %q", i, w.Name)
+		}
+
+		names.Add(w.Name)
+	}
+
+	return nil
+}
+
+// maintenance tells if the maintenance is in progress.
+type maintenance struct {
+	// mu protects windows and until.
+	mu *sync.Mutex
+
+	// windows are the scheduled maintenance windows.
+	windows []*maintenanceWindow
+
+	// until is the end of the maintenance started manually.  It's zero if
+	// there is none.
+	until time.Time
+}
+
+// newMaintenance returns a new properly initialized *maintenance.  conf may be
+// nil.
+func newMaintenance(conf *maintenanceConfig) (m *maintenance, err error) {
+	m = &maintenance{
+		mu: &sync.Mutex{},
+	}
+
+	if conf == nil {
+		return m, nil
+	}
+
+	err = validateMaintenanceWindows(conf.Windows)
+	if err != nil {
+		return nil, fmt.Errorf("windows: %w", err)
+	}
+
+	m.windows = conf.Windows
+	if conf.Until != nil {
+		m.until = *conf.Until
+	}
+
+	return m, nil
+}
+
+// active returns the name of the maintenance window containing now, if any.
+// name is empty if ok is true and the maintenance has been started manually.
+func (m *maintenance) active(now time.Time) (name string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Before(m.until) {
+		return "", true
+	}
+
+	for _, w := range m.windows {
+		if w.contains(now) {
+			return w.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// config returns the configuration of m to write into the configuration file.
+// conf is nil if there are no windows and no manual maintenance.
+func (m *maintenance) config() (conf *maintenanceConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if len(m.windows) == 0 && !now.Before(m.until) {
+		return nil
+	}
+
+	conf = &maintenanceConfig{
+		Windows: m.cloneWindows(),
+	}
+
+	if now.Before(m.until) {
+		until := m.until
+		conf.Until = &until
+	}
+
+	return conf
+}
+
+// cloneWindows returns a deep copy of the windows of m.  m.mu is expected to
+// be locked.
+func (m *maintenance) cloneWindows() (windows []*maintenanceWindow) {
+	windows = make([]*maintenanceWindow, 0, len(m.windows))
+	for _, w := range m.windows {
+		windows = append(windows, w.clone())
+	}
+
+	return windows
+}
+
+// maintenanceActive returns true if the maintenance is in progress, so that
+// the updates and the alert notifications must be deferred.
+func maintenanceActive() (ok bool) {
+	m := Context.maintenance
+	if m == nil {
+		return false
+	}
+
+	_, ok = m.active(time.Now())
+
+	return ok
+}
+
+// initMaintenance initializes the maintenance windows and registers their HTTP
+// API.
+func initMaintenance() (err error) {
+	Context.maintenance, err = newMaintenance(config.Maintenance)
+	if err != nil {
+		return fmt.Errorf("maintenance: %w", err)
+	}
+
+	httpRegister(http.MethodGet, "/control/maintenance", handleMaintenance)
+	httpRegister(http.MethodPut, "/control/maintenance/update", handleMaintenanceUpdate)
+	httpRegister(http.MethodPost, "/control/maintenance/start", handleMaintenanceStart)
+	httpRegister(http.MethodPost, "/control/maintenance/stop", handleMaintenanceStop)
+
+	return nil
+}
+
+// maintenanceJSON is the object for the GET /control/maintenance HTTP API.
+type maintenanceJSON struct {
+	// Until is the end of the maintenance started manually, if any.
+	Until *time.Time `json:"until,omitempty"`
+
+	// Windows are the scheduled maintenance windows.
+	Windows []*maintenanceWindow `json:"windows"`
+
+	// ActiveWindow is the name of the active window, if any.
+	ActiveWindow string `json:"active_window,omitempty"`
+
+	// Active is true if the maintenance is in progress.
+	Active bool `json:"active"`
+}
+
+// handleMaintenance is the handler for the GET /control/maintenance HTTP API.
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	m := Context.maintenance
+	now := time.Now()
+
+	resp := &maintenanceJSON{}
+	resp.ActiveWindow, resp.Active = m.active(now)
+
+	func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		resp.Windows = m.cloneWindows()
+		if now.Before(m.until) {
+			until := m.until
+			resp.Until = &until
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// maintenanceWindowsJSON is the object for the PUT /control/maintenance/update
+// HTTP API.
+type maintenanceWindowsJSON struct {
+	Windows []*maintenanceWindow `json:"windows"`
+}
+
+// handleMaintenanceUpdate is the handler for the PUT
+// /control/maintenance/update HTTP API.
+func handleMaintenanceUpdate(w http.ResponseWriter, r *http.Request) {
+	req := &maintenanceWindowsJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	err = validateMaintenanceWindows(req.Windows)
+	if err != nil {
+		writeError(r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	m := Context.maintenance
+	func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.windows = req.Windows
+	}()
+
+	log.Debug("maintenance: updated windows: %d", len(req.Windows))
+
+	onConfigModified()
+}
+
+// maintenanceStartJSON is the object for the POST /control/maintenance/start
+// HTTP API.
+type maintenanceStartJSON struct {
+	// Duration is the duration of the maintenance in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// handleMaintenanceStart is the handler for the POST
+// /control/maintenance/start HTTP API.
+func handleMaintenanceStart(w http.ResponseWriter, r *http.Request) {
+	req := &maintenanceStartJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	if req.Duration <= 0 {
+		writeError(r, w, http.StatusUnprocessableEntity, "duration: %d must be positive", req.Duration)
+
+		return
+	}
+
+	until := time.Now().Add(time.Duration(req.Duration) * time.Millisecond)
+
+	m := Context.maintenance
+	func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.until = until
+	}()
+
+	log.Info("maintenance: started until %s", until.Format(time.RFC3339))
+
+	onConfigModified()
+}
+
+// handleMaintenanceStop is the handler for the POST /control/maintenance/stop
+// HTTP API.  It doesn't affect the scheduled windows.
+func handleMaintenanceStop(w http.ResponseWriter, r *http.Request) {
+	m := Context.maintenance
+	func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.until = time.Time{}
+	}()
+
+	log.Info("maintenance: stopped")
+
+	onConfigModified()
+}
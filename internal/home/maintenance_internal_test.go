@@ -0,0 +1,149 @@
+package home
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMaintenanceWindows(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		windows    []*maintenanceWindow
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		windows: []*maintenanceWindow{{
+			Name:     "weekly",
+			Schedule: schedule.FullWeekly(),
+		}, {
+			Name:  "once",
+			Start: &start,
+			End:   &end,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "at index 0: no value",
+		windows:    []*maintenanceWindow{nil},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "at index 0: name: empty value",
+		windows: []*maintenanceWindow{{
+			Schedule: schedule.FullWeekly(),
+		}},
+	}, {
+		name:       "both",
+		wantErrMsg: "at index 0: schedule can't be combined with start and end",
+		windows: []*maintenanceWindow{{
+			Name:     "both",
+			Schedule: schedule.FullWeekly(),
+			Start:    &start,
+		}},
+	}, {
+		name:       "no_end",
+		wantErrMsg: "at index 0: end: no value",
+		windows: []*maintenanceWindow{{
+			Name:  "once",
+			Start: &start,
+		}},
+	}, {
+		name: "end_before_start",
+		wantErrMsg: "at index 0: end: 2024-10-01 00:00:00 +0000 UTC " +
+			"is not after start 2024-10-01 01:00:00 +0000 UTC",
+		windows: []*maintenanceWindow{{
+			Name:  "once",
+			Start: &end,
+			End:   &start,
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: duplicate name "once"`,
+		windows: []*maintenanceWindow{{
+			Name:  "once",
+			Start: &start,
+			End:   &end,
+		}, {
+			Name:  "once",
+			Start: &start,
+			End:   &end,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMaintenanceWindows(tc.windows)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestMaintenance_active(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	until := end.Add(time.Hour)
+
+	m, err := newMaintenance(&maintenanceConfig{
+		Windows: []*maintenanceWindow{{
+			Name:  "once",
+			Start: &start,
+			End:   &end,
+		}},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		now      time.Time
+		until    time.Time
+		name     string
+		wantName string
+		want     bool
+	}{{
+		now:      start.Add(-time.Minute),
+		until:    time.Time{},
+		name:     "before",
+		wantName: "",
+		want:     false,
+	}, {
+		now:      start,
+		until:    time.Time{},
+		name:     "window",
+		wantName: "once",
+		want:     true,
+	}, {
+		now:      end,
+		until:    time.Time{},
+		name:     "window_end",
+		wantName: "",
+		want:     false,
+	}, {
+		now:      end,
+		until:    until,
+		name:     "manual",
+		wantName: "",
+		want:     true,
+	}, {
+		now:      until,
+		until:    until,
+		name:     "manual_end",
+		wantName: "",
+		want:     false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m.until = tc.until
+
+			name, ok := m.active(tc.now)
+			assert.Equal(t, tc.want, ok)
+			assert.Equal(t, tc.wantName, name)
+		})
+	}
+}
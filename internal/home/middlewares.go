@@ -31,6 +31,10 @@ const (
 	// largerReqBodySzLim is the maximum request body size for APIs expecting
 	// larger requests.
 	largerReqBodySzLim datasize.ByteSize = 4 * datasize.MB
+
+	// importReqBodySzLim is the maximum request body size for the APIs
+	// importing the configuration of other software.
+	importReqBodySzLim datasize.ByteSize = 32 * datasize.MB
 )
 
 // expectsLargerRequests shows if this request should use a larger body size
@@ -60,6 +64,8 @@ func limitRequestBody(h http.Handler) (limited http.Handler) {
 		szLim := defaultReqBodySzLim
 		if expectsLargerRequests(r) {
 			szLim = largerReqBodySzLim
+		} else if r.Method == http.MethodPost && r.URL.Path == piholeImportPath {
+			szLim = importReqBodySzLim
 		}
 
 		reader := ioutil.LimitReader(r.Body, szLim.Bytes())
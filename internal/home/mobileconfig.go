@@ -1,7 +1,6 @@
 package home
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,7 +11,6 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/httphdr"
-	"github.com/AdguardTeam/golibs/log"
 	"github.com/google/uuid"
 	"howett.net/plist"
 )
@@ -78,7 +76,9 @@ const (
 	dnsProtoTLS   = "TLS"
 )
 
-func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
+// encodeMobileConfig returns the encoded profile with the DNS settings.
+// dohPath is the URL path of the DNS-over-HTTPS endpoint.
+func encodeMobileConfig(d *dnsSettings, clientID, dohPath string) ([]byte, error) {
 	var dspName string
 	switch proto := d.DNSProtocol; proto {
 	case dnsProtoHTTPS:
@@ -86,7 +86,7 @@ func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
 		u := &url.URL{
 			Scheme: aghhttp.SchemeHTTPS,
 			Host:   d.ServerName,
-			Path:   path.Join("/dns-query", clientID),
+			Path:   path.Join(dohPath, clientID),
 		}
 		d.ServerURL = u.String()
 
@@ -126,16 +126,6 @@ func encodeMobileConfig(d *dnsSettings, clientID string) ([]byte, error) {
 	return plist.MarshalIndent(data, plist.XMLFormat, "\t")
 }
 
-func respondJSONError(w http.ResponseWriter, status int, msg string) {
-	w.WriteHeader(http.StatusInternalServerError)
-	err := json.NewEncoder(w).Encode(&jsonError{
-		Message: msg,
-	})
-	if err != nil {
-		log.Debug("writing %d json response: %s", status, err)
-	}
-}
-
 const errEmptyHost errors.Error = "no host in query parameters and no server_name"
 
 func handleMobileConfig(w http.ResponseWriter, r *http.Request, dnsp string) {
@@ -144,7 +134,7 @@ func handleMobileConfig(w http.ResponseWriter, r *http.Request, dnsp string) {
 	q := r.URL.Query()
 	host := q.Get("host")
 	if host == "" {
-		respondJSONError(w, http.StatusInternalServerError, string(errEmptyHost))
+		writeError(r, w, http.StatusInternalServerError, "%s", errEmptyHost)
 
 		return
 	}
@@ -153,7 +143,7 @@ func handleMobileConfig(w http.ResponseWriter, r *http.Request, dnsp string) {
 	if clientID != "" {
 		err = dnsforward.ValidateClientID(clientID)
 		if err != nil {
-			respondJSONError(w, http.StatusBadRequest, err.Error())
+			writeError(r, w, http.StatusBadRequest, "%s", err)
 
 			return
 		}
@@ -164,9 +154,13 @@ func handleMobileConfig(w http.ResponseWriter, r *http.Request, dnsp string) {
 		ServerName:  host,
 	}
 
-	mobileconfig, err := encodeMobileConfig(d, clientID)
+	mobileconfig, err := encodeMobileConfig(
+		d,
+		clientID,
+		dnsforward.PublicDoHPath(config.DNS.DoHEndpoints),
+	)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, err.Error())
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
@@ -8,6 +8,7 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"howett.net/plist"
@@ -72,6 +73,7 @@ func TestHandleMobileConfigDoH(t *testing.T) {
 
 		b := &bytes.Buffer{}
 		err = json.NewEncoder(b).Encode(&jsonError{
+			Code:    aghhttp.ErrorCodeTXT500,
 			Message: errEmptyHost.Error(),
 		})
 		require.NoError(t, err)
@@ -144,6 +146,7 @@ func TestHandleMobileConfigDoT(t *testing.T) {
 
 		b := &bytes.Buffer{}
 		err = json.NewEncoder(b).Encode(&jsonError{
+			Code:    aghhttp.ErrorCodeTXT500,
 			Message: errEmptyHost.Error(),
 		})
 		require.NoError(t, err)
@@ -0,0 +1,218 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/openwrt"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/osutil"
+)
+
+// ubusObjectName is the name of the ubus object of AdGuard Home.
+const ubusObjectName = "adguardhome"
+
+// ubusRetryIvl is the time between the attempts to reconnect to ubus.
+const ubusRetryIvl = 10 * time.Second
+
+// openWrtConfig is the configuration of the integration with OpenWrt.  It's
+// ignored on other operating systems.
+type openWrtConfig struct {
+	// UbusSocket is the path to the ubus socket.  If empty, the default paths
+	// are tried.
+	UbusSocket string `yaml:"ubus_socket"`
+
+	// LANInterface is the name of the UCI network interface to take the DHCP
+	// settings from, typically "lan".
+	LANInterface string `yaml:"lan_interface"`
+
+	// Ubus defines if the adguardhome object is registered on ubus.
+	Ubus bool `yaml:"ubus"`
+
+	// UCIAutoConfig defines if the unset DHCP settings are taken from the UCI
+	// configuration of LANInterface on startup.
+	UCIAutoConfig bool `yaml:"uci_autoconfig"`
+}
+
+// openWrtConf returns the OpenWrt configuration, if AdGuard Home is running on
+// OpenWrt.  Otherwise, it returns nil.
+func openWrtConf() (conf *openWrtConfig) {
+	if config.OSConfig == nil || !aghos.IsOpenWrt() {
+		return nil
+	}
+
+	return config.OSConfig.OpenWrt
+}
+
+// configureFromUCI fills the unset DHCP settings from the UCI configuration of
+// the LAN interface, if it's enabled.
+func configureFromUCI() {
+	conf := openWrtConf()
+	if conf == nil || !conf.UCIAutoConfig || config.DHCP == nil {
+		return
+	}
+
+	lan, err := openwrt.ReadLAN(osutil.RootDirFS(), conf.LANInterface)
+	if err != nil {
+		log.Error("openwrt: reading uci config of %q: %s", conf.LANInterface, err)
+
+		return
+	}
+
+	if applyLANConfig(config.DHCP, lan) {
+		log.Info("openwrt: configured dhcp from uci interface %q", conf.LANInterface)
+	}
+}
+
+// applyLANConfig sets the interface name of conf, if it's empty, and the DHCPv4
+// settings, if they are all unset, from lan.  changed is true if conf was
+// modified.
+func applyLANConfig(conf *dhcpd.ServerConfig, lan *openwrt.LANConfig) (changed bool) {
+	if conf.InterfaceName == "" && lan.Device != "" {
+		conf.InterfaceName = lan.Device
+		changed = true
+	}
+
+	conf4 := &conf.Conf4
+	if conf4.GatewayIP.IsValid() || !lan.DHCPStart.IsValid() {
+		return changed
+	}
+
+	conf4.GatewayIP = lan.IPAddr
+	conf4.SubnetMask = lan.Netmask
+	conf4.RangeStart = lan.DHCPStart
+	conf4.RangeEnd = lan.DHCPEnd
+	if lan.LeaseTime > 0 {
+		conf4.LeaseDuration = uint32(lan.LeaseTime.Seconds())
+	}
+
+	return true
+}
+
+// initUbus returns the ubus object of AdGuard Home, if it's enabled.
+// Otherwise, it returns nil.
+func initUbus(logger *slog.Logger) (obj *openwrt.UbusObject) {
+	conf := openWrtConf()
+	if conf == nil || !conf.Ubus {
+		return nil
+	}
+
+	return openwrt.NewUbusObject(&openwrt.UbusConfig{
+		Logger: logger.With(slogutil.KeyPrefix, "ubus"),
+		Methods: map[string]*openwrt.Method{
+			"status": {
+				Handler: ubusStatus,
+			},
+			"set_protection": {
+				Handler: ubusSetProtection,
+				Policy: map[string]openwrt.ArgType{
+					"enabled":  openwrt.ArgTypeBool,
+					"duration": openwrt.ArgTypeInt64,
+				},
+			},
+			"stats": {
+				Handler: ubusStats,
+			},
+		},
+		Name:       ubusObjectName,
+		SocketPath: conf.UbusSocket,
+		RetryIvl:   ubusRetryIvl,
+	})
+}
+
+// ubusStatus is the handler of the status ubus method.
+func ubusStatus(_ context.Context, _ map[string]any) (res map[string]any, err error) {
+	resp, err := newStatusResponse()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	addrs := make([]any, 0, len(resp.DNSAddrs))
+	for _, a := range resp.DNSAddrs {
+		addrs = append(addrs, a)
+	}
+
+	return map[string]any{
+		"version":                      resp.Version,
+		"dns_addresses":                addrs,
+		"dns_port":                     uint32(resp.DNSPort),
+		"http_port":                    uint32(resp.HTTPPort),
+		"protection_disabled_duration": resp.ProtectionDisabledDuration,
+		"protection_enabled":           resp.ProtectionEnabled,
+		"running":                      resp.IsRunning,
+	}, nil
+}
+
+// ubusSetProtection is the handler of the set_protection ubus method.
+func ubusSetProtection(_ context.Context, args map[string]any) (res map[string]any, err error) {
+	enabled, disabledUntil, err := parseProtectionArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", openwrt.ErrInvalidArgument, err)
+	}
+
+	if Context.dnsServer == nil {
+		return nil, errors.Error("dns server is not initialized")
+	}
+
+	Context.dnsServer.SetProtection(enabled, disabledUntil)
+
+	return nil, nil
+}
+
+// parseProtectionArgs parses the arguments of the set_protection ubus method.
+// The duration is in milliseconds and is only allowed with disabling the
+// protection.
+func parseProtectionArgs(args map[string]any) (enabled bool, disabledUntil *time.Time, err error) {
+	enabled, ok := args["enabled"].(bool)
+	if !ok {
+		return false, nil, errors.Error("enabled: must be a boolean")
+	}
+
+	v, ok := args["duration"]
+	if !ok {
+		return enabled, nil, nil
+	}
+
+	dur, ok := v.(int64)
+	if !ok || dur < 0 {
+		return false, nil, errors.Error("duration: must be a non-negative integer")
+	} else if dur == 0 {
+		return enabled, nil, nil
+	} else if enabled {
+		return false, nil, errors.Error("duration: only allowed with disabling protection")
+	}
+
+	until := time.Now().Add(time.Duration(dur) * time.Millisecond)
+
+	return false, &until, nil
+}
+
+// ubusStats is the handler of the stats ubus method.
+func ubusStats(_ context.Context, _ map[string]any) (res map[string]any, err error) {
+	if Context.stats == nil {
+		return nil, errors.Error("statistics are not initialized")
+	}
+
+	resp, ok := Context.stats.Data()
+	if !ok {
+		return nil, errors.Error("couldn't get statistics data")
+	}
+
+	return map[string]any{
+		"time_units":                resp.TimeUnits,
+		"num_dns_queries":           resp.NumDNSQueries,
+		"num_blocked_filtering":     resp.NumBlockedFiltering,
+		"num_replaced_safebrowsing": resp.NumReplacedSafebrowsing,
+		"num_replaced_safesearch":   resp.NumReplacedSafesearch,
+		"num_replaced_parental":     resp.NumReplacedParental,
+		"num_blocked_rebinding":     resp.NumBlockedRebinding,
+		"avg_processing_time":       resp.AvgProcessingTime,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/openwrt"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyLANConfig(t *testing.T) {
+	lan := &openwrt.LANConfig{
+		Device:    "br-lan",
+		IPAddr:    netip.MustParseAddr("192.168.1.1"),
+		Netmask:   netip.MustParseAddr("255.255.255.0"),
+		DHCPStart: netip.MustParseAddr("192.168.1.100"),
+		DHCPEnd:   netip.MustParseAddr("192.168.1.249"),
+		LeaseTime: 12 * time.Hour,
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		conf := &dhcpd.ServerConfig{}
+		require.True(t, applyLANConfig(conf, lan))
+
+		assert.Equal(t, "br-lan", conf.InterfaceName)
+		assert.Equal(t, lan.IPAddr, conf.Conf4.GatewayIP)
+		assert.Equal(t, lan.Netmask, conf.Conf4.SubnetMask)
+		assert.Equal(t, lan.DHCPStart, conf.Conf4.RangeStart)
+		assert.Equal(t, lan.DHCPEnd, conf.Conf4.RangeEnd)
+		assert.Equal(t, uint32(12*60*60), conf.Conf4.LeaseDuration)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		gw := netip.MustParseAddr("10.0.0.1")
+		conf := &dhcpd.ServerConfig{
+			InterfaceName: "eth1",
+			Conf4: dhcpd.V4ServerConf{
+				GatewayIP: gw,
+			},
+		}
+		require.False(t, applyLANConfig(conf, lan))
+
+		assert.Equal(t, "eth1", conf.InterfaceName)
+		assert.Equal(t, gw, conf.Conf4.GatewayIP)
+		assert.False(t, conf.Conf4.RangeStart.IsValid())
+	})
+
+	t.Run("no_dhcp", func(t *testing.T) {
+		conf := &dhcpd.ServerConfig{}
+		require.True(t, applyLANConfig(conf, &openwrt.LANConfig{
+			Device: "br-lan",
+			IPAddr: lan.IPAddr,
+		}))
+
+		assert.Equal(t, "br-lan", conf.InterfaceName)
+		assert.False(t, conf.Conf4.GatewayIP.IsValid())
+	})
+}
+
+func TestParseProtectionArgs(t *testing.T) {
+	testCases := []struct {
+		args        map[string]any
+		name        string
+		wantErrMsg  string
+		wantEnabled bool
+		wantUntil   bool
+	}{{
+		args:        map[string]any{"enabled": true},
+		name:        "enable",
+		wantErrMsg:  "",
+		wantEnabled: true,
+		wantUntil:   false,
+	}, {
+		args:        map[string]any{"enabled": false, "duration": int64(60_000)},
+		name:        "pause",
+		wantErrMsg:  "",
+		wantEnabled: false,
+		wantUntil:   true,
+	}, {
+		args:        map[string]any{"enabled": false, "duration": int64(0)},
+		name:        "disable",
+		wantErrMsg:  "",
+		wantEnabled: false,
+		wantUntil:   false,
+	}, {
+		args:        map[string]any{},
+		name:        "no_enabled",
+		wantErrMsg:  "enabled: must be a boolean",
+		wantEnabled: false,
+		wantUntil:   false,
+	}, {
+		args:        map[string]any{"enabled": true, "duration": int64(1)},
+		name:        "enable_with_duration",
+		wantErrMsg:  "duration: only allowed with disabling protection",
+		wantEnabled: false,
+		wantUntil:   false,
+	}, {
+		args:        map[string]any{"enabled": false, "duration": "1m"},
+		name:        "bad_duration",
+		wantErrMsg:  "duration: must be a non-negative integer",
+		wantEnabled: false,
+		wantUntil:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			enabled, until, err := parseProtectionArgs(tc.args)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantEnabled, enabled)
+			assert.Equal(t, tc.wantUntil, until != nil)
+		})
+	}
+}
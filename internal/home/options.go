@@ -52,15 +52,50 @@ type options struct {
 	// the configuration file and exit.
 	checkConfig bool
 
+	// migrationDryRun is true if the current invocation is only required to
+	// show the changes the configuration file upgrade would make and exit.
+	migrationDryRun bool
+
+	// downgradeConfig is true if the current invocation is only required to
+	// downgrade the configuration file one schema version down and exit.
+	downgradeConfig bool
+
+	// importPihole is the directory with the Pi-hole configuration or the
+	// Pi-hole Teleporter archive to import into the configuration file.  If
+	// it's not empty, the current invocation is only required to import it and
+	// exit.
+	importPihole string
+
+	// importDnsmasq is the path to the dnsmasq configuration file to import
+	// into the configuration file.  If it's not empty, the current invocation
+	// is only required to import it and exit.
+	importDnsmasq string
+
 	// disableUpdate, if set, makes AdGuard Home not check for updates.
 	disableUpdate bool
 
+	// noSelfUpdate, if set, prohibits AdGuard Home from replacing its own
+	// executable, so that the available updates are only reported.
+	noSelfUpdate bool
+
 	// performUpdate, if set, updates AdGuard Home without GUI and exits.
 	performUpdate bool
 
 	// verbose shows if verbose logging is enabled.
 	verbose bool
 
+	// systemResolver, if set, makes the service installation point the system
+	// resolver at AdGuard Home.
+	systemResolver bool
+
+	// takeOverDNSPort, if set, makes AdGuard Home reconfigure systemd-resolved
+	// or dnsmasq to free the DNS port if they use it.
+	takeOverDNSPort bool
+
+	// doctor is true if the current invocation is only required to run the
+	// self-test checks, print the results, and exit.  See [runDoctor].
+	doctor bool
+
 	// runningAsService flag is set to true when options are passed from the
 	// service runner
 	//
@@ -71,6 +106,11 @@ type options struct {
 	// glinetMode shows if the GL-Inet compatibility mode is enabled.
 	glinetMode bool
 
+	// sandbox, if set, makes AdGuard Home serve the HTTP API with the
+	// generated query log and statistics data using a temporary working
+	// directory, without serving DNS.
+	sandbox bool
+
 	// noEtcHosts flag should be provided when /etc/hosts file shouldn't be
 	// used.
 	noEtcHosts bool
@@ -210,6 +250,24 @@ var cmdLineOpts = []cmdLineOpt{{
 		`uninstall (as a service), start, stop, restart, reload (configuration).`,
 	longName:  "service",
 	shortName: "s",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.systemResolver = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.systemResolver },
+	description: "With the install service control action, point the system resolver " +
+		"at AdGuard Home and restore it on uninstall.  Only supported on macOS.",
+	longName:  "system-resolver",
+	shortName: "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.takeOverDNSPort = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.takeOverDNSPort },
+	description: "Reconfigure systemd-resolved or dnsmasq to free the DNS port if they use it " +
+		"and restore them on uninstall.  Only supported on Linux.",
+	longName:  "take-over-dns-port",
+	shortName: "",
 }, {
 	updateWithValue: func(o options, v string) (options, error) { o.logFile = v; return o, nil },
 	updateNoValue:   nil,
@@ -235,6 +293,45 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Check configuration and exit.",
 	longName:        "check-config",
 	shortName:       "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.migrationDryRun = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.migrationDryRun },
+	description: "Print the changes the configuration file upgrade would make and " +
+		"exit without writing them.",
+	longName:  "migration-dry-run",
+	shortName: "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.downgradeConfig = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.downgradeConfig },
+	description: "Downgrade the configuration file one schema version down, " +
+		"e.g. before rolling back an update, and exit.",
+	longName:  "downgrade-config",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.importPihole = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return o.importPihole, o.importPihole != "" },
+	description: "Import the filter lists, the domain lists, the local DNS records, " +
+		"and the clients from the Pi-hole Teleporter archive or the local DNS records " +
+		"from the Pi-hole configuration directory, e.g. /etc/pihole, " +
+		"into the configuration file and exit.",
+	longName:  "import-pihole",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) { o.importDnsmasq = v; return o, nil },
+	updateNoValue:   nil,
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return o.importDnsmasq, o.importDnsmasq != "" },
+	description: "Import the addresses, the upstream servers, the CNAME records, " +
+		"and the DHCP settings from the dnsmasq configuration file " +
+		"into the configuration file and exit.",
+	longName:  "import-dnsmasq",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   func(o options) (options, error) { o.disableUpdate = true; return o, nil },
@@ -243,6 +340,15 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Don't check for updates.",
 	longName:        "no-check-update",
 	shortName:       "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.noSelfUpdate = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.noSelfUpdate },
+	description: "Don't replace the executable when updating, only report the available updates.  " +
+		"Always enabled when running in a container.",
+	longName:  "no-self-update",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   func(o options) (options, error) { o.performUpdate = true; return o, nil },
@@ -305,6 +411,15 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Run in GL-Inet compatibility mode.",
 	longName:        "glinet",
 	shortName:       "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.sandbox = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.sandbox },
+	description: "Serve the HTTP API with generated query log and statistics data in a " +
+		"temporary working directory without serving DNS.",
+	longName:  "sandbox",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   nil,
@@ -335,7 +450,8 @@ func printHelp(exec string) {
 	stringutil.WriteToBuilder(
 		b,
 		"Usage:\n\n",
-		fmt.Sprintf("%s [options]\n\n", exec),
+		fmt.Sprintf("%s [options]\n", exec),
+		fmt.Sprintf("%s %s [options]  checks the setup and suggests fixes\n\n", exec, cmdDoctor),
 		"Options:\n",
 	)
 
@@ -368,8 +484,17 @@ func printHelp(exec string) {
 	}
 }
 
-// parseCmdOpts parses the command-line arguments into options and effects.
+// cmdDoctor is the subcommand running the self-test checks.
+const cmdDoctor = "doctor"
+
+// parseCmdOpts parses the command-line arguments into options and effects.  The
+// first argument may be the [cmdDoctor] subcommand.
 func parseCmdOpts(cmdName string, args []string) (o options, eff effect, err error) {
+	if len(args) > 0 && args[0] == cmdDoctor {
+		o.doctor = true
+		args = args[1:]
+	}
+
 	// Don't use range since the loop changes the loop variable.
 	argsLen := len(args)
 	for i := 0; i < len(args); i++ {
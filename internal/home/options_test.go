@@ -115,11 +115,68 @@ func TestParseCheckConfig(t *testing.T) {
 	assert.True(t, testParseOK(t, "--check-config").checkConfig, "--check-config is check config")
 }
 
+func TestParseMigrationDryRun(t *testing.T) {
+	assert.False(t, testParseOK(t).migrationDryRun, "empty is not migration dry run")
+	assert.True(
+		t,
+		testParseOK(t, "--migration-dry-run").migrationDryRun,
+		"--migration-dry-run is migration dry run",
+	)
+}
+
+func TestParseDowngradeConfig(t *testing.T) {
+	assert.False(t, testParseOK(t).downgradeConfig, "empty is not downgrade config")
+	assert.True(
+		t,
+		testParseOK(t, "--downgrade-config").downgradeConfig,
+		"--downgrade-config is downgrade config",
+	)
+}
+
+func TestParseImportPihole(t *testing.T) {
+	assert.Equal(t, "", testParseOK(t).importPihole, "empty is no pi-hole import")
+	assert.Equal(
+		t,
+		"/etc/pihole",
+		testParseOK(t, "--import-pihole", "/etc/pihole").importPihole,
+		"--import-pihole is pi-hole import",
+	)
+}
+
+func TestParseImportDnsmasq(t *testing.T) {
+	assert.Equal(t, "", testParseOK(t).importDnsmasq, "empty is no dnsmasq import")
+	assert.Equal(
+		t,
+		"/etc/dnsmasq.conf",
+		testParseOK(t, "--import-dnsmasq", "/etc/dnsmasq.conf").importDnsmasq,
+		"--import-dnsmasq is dnsmasq import",
+	)
+}
+
 func TestParseDisableUpdate(t *testing.T) {
 	assert.False(t, testParseOK(t).disableUpdate, "empty is not disable update")
 	assert.True(t, testParseOK(t, "--no-check-update").disableUpdate, "--no-check-update is disable update")
 }
 
+func TestParseNoSelfUpdate(t *testing.T) {
+	assert.False(t, testParseOK(t).noSelfUpdate, "empty is not no self-update")
+	assert.True(t, testParseOK(t, "--no-self-update").noSelfUpdate, "--no-self-update is no self-update")
+}
+
+func TestParseSystemResolver(t *testing.T) {
+	assert.False(t, testParseOK(t).systemResolver, "empty is not system resolver")
+	assert.True(t, testParseOK(t, "--system-resolver").systemResolver, "--system-resolver is system resolver")
+}
+
+func TestParseTakeOverDNSPort(t *testing.T) {
+	assert.False(t, testParseOK(t).takeOverDNSPort, "empty is not take over dns port")
+	assert.True(
+		t,
+		testParseOK(t, "--take-over-dns-port").takeOverDNSPort,
+		"--take-over-dns-port is take over dns port",
+	)
+}
+
 func TestParsePerformUpdate(t *testing.T) {
 	assert.False(t, testParseOK(t).performUpdate, "empty is not perform update")
 	assert.True(t, testParseOK(t, "--update").performUpdate, "--update is perform update")
@@ -145,6 +202,22 @@ func TestParseGLInet(t *testing.T) {
 	assert.True(t, testParseOK(t, "--glinet").glinetMode, "--glinet is GL-Inet mode")
 }
 
+func TestParseSandbox(t *testing.T) {
+	assert.False(t, testParseOK(t).sandbox, "empty is not sandbox mode")
+	assert.True(t, testParseOK(t, "--sandbox").sandbox, "--sandbox is sandbox mode")
+}
+
+func TestParseDoctor(t *testing.T) {
+	assert.False(t, testParseOK(t).doctor, "empty is not doctor")
+	assert.True(t, testParseOK(t, "doctor").doctor, "doctor is doctor")
+
+	o := testParseOK(t, "doctor", "-c", "path")
+	assert.True(t, o.doctor, "doctor with options is doctor")
+	assert.Equal(t, "path", o.confFilename, "doctor with options has options")
+
+	testParseErr(t, "doctor not first", "-v", "doctor")
+}
+
 func TestParseUnknown(t *testing.T) {
 	testParseErr(t, "unknown word", "x")
 	testParseErr(t, "unknown short", "-x")
@@ -191,10 +264,30 @@ func TestOptsToArgs(t *testing.T) {
 		name: "pid_file",
 		args: []string{"--pidfile", "path"},
 		opts: options{pidFile: "path"},
+	}, {
+		name: "import_pihole",
+		args: []string{"--import-pihole", "/etc/pihole"},
+		opts: options{importPihole: "/etc/pihole"},
+	}, {
+		name: "import_dnsmasq",
+		args: []string{"--import-dnsmasq", "/etc/dnsmasq.conf"},
+		opts: options{importDnsmasq: "/etc/dnsmasq.conf"},
 	}, {
 		name: "disable_update",
 		args: []string{"--no-check-update"},
 		opts: options{disableUpdate: true},
+	}, {
+		name: "no_self_update",
+		args: []string{"--no-self-update"},
+		opts: options{noSelfUpdate: true},
+	}, {
+		name: "system_resolver",
+		args: []string{"--system-resolver"},
+		opts: options{systemResolver: true},
+	}, {
+		name: "take_over_dns_port",
+		args: []string{"--take-over-dns-port"},
+		opts: options{takeOverDNSPort: true},
 	}, {
 		name: "perform_update",
 		args: []string{"--update"},
@@ -207,6 +300,10 @@ func TestOptsToArgs(t *testing.T) {
 		name: "glinet_mode",
 		args: []string{"--glinet"},
 		opts: options{glinetMode: true},
+	}, {
+		name: "sandbox",
+		args: []string{"--sandbox"},
+		opts: options{sandbox: true},
 	}, {
 		name: "multiple",
 		args: []string{
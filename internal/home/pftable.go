@@ -0,0 +1,126 @@
+package home
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// pfTableConfig is the configuration of exporting the IP addresses of the
+// disallowed clients into a pf(4) table, so that the firewall could block them,
+// for example on pfSense.
+type pfTableConfig struct {
+	// Name is the name of the table.
+	Name string `yaml:"name"`
+
+	// Enabled defines if the table is filled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// initPFTable sets the pf table exporter in [Context], if it's enabled, and
+// exports the disallowed clients from the configuration.
+func initPFTable() {
+	if config.OSConfig == nil {
+		return
+	}
+
+	Context.pfTable = newPFTableExporter(config.OSConfig.PFTable)
+	exportPFTable()
+}
+
+// exportPFTable exports the disallowed clients from the configuration into the
+// pf table, if it's enabled.
+func exportPFTable() {
+	e := Context.pfTable
+	if e == nil {
+		return
+	}
+
+	var allowed, disallowed []string
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		allowed = slices.Clone(config.DNS.AllowedClients)
+		disallowed = slices.Clone(config.DNS.DisallowedClients)
+	}()
+
+	e.export(allowed, disallowed)
+}
+
+// pfTableExporter exports the IP addresses and the CIDR networks of the
+// disallowed clients into a pf table.
+type pfTableExporter struct {
+	// replace replaces the contents of the table.  It's [aghos.ReplacePFTable]
+	// shadowed for tests.
+	replace func(name string, prefixes []netip.Prefix) (err error)
+
+	// mu protects exported.
+	mu *sync.Mutex
+
+	// exported are the prefixes exported last time.
+	exported []netip.Prefix
+
+	table string
+}
+
+// newPFTableExporter returns a new properly initialized *pfTableExporter or
+// nil if the export is disabled.
+func newPFTableExporter(conf *pfTableConfig) (e *pfTableExporter) {
+	if conf == nil || !conf.Enabled || conf.Name == "" {
+		return nil
+	}
+
+	return &pfTableExporter{
+		replace: aghos.ReplacePFTable,
+		mu:      &sync.Mutex{},
+		table:   conf.Name,
+	}
+}
+
+// export fills the table with the addresses from the disallowed clients, unless
+// they're the same as the ones exported before.  The ClientIDs are skipped.
+// Since the disallowed clients are ignored when allowed is not empty, the table
+// is emptied in that case.
+func (e *pfTableExporter) export(allowed, disallowed []string) {
+	var prefixes []netip.Prefix
+	if len(allowed) == 0 {
+		prefixes = clientPrefixes(disallowed)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.exported != nil && slices.Equal(e.exported, prefixes) {
+		return
+	}
+
+	err := e.replace(e.table, prefixes)
+	if err != nil {
+		log.Error("pf table: replacing %q: %s", e.table, err)
+
+		return
+	}
+
+	log.Debug("pf table: exported %d addresses to %q", len(prefixes), e.table)
+
+	// Keep the slice non-nil to distinguish the first export.
+	e.exported = append(make([]netip.Prefix, 0, len(prefixes)), prefixes...)
+}
+
+// clientPrefixes returns the IP addresses and the CIDR networks from the client
+// access list as prefixes.  The other entries are skipped.
+func clientPrefixes(clients []string) (prefixes []netip.Prefix) {
+	for _, c := range clients {
+		if ip, err := netip.ParseAddr(c); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		} else if p, err := netip.ParsePrefix(c); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		}
+	}
+
+	return prefixes
+}
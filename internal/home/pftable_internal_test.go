@@ -0,0 +1,98 @@
+package home
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPrefixes(t *testing.T) {
+	got := clientPrefixes([]string{
+		"192.0.2.1",
+		"2001:db8::1",
+		"198.51.100.7/24",
+		"my-client",
+	})
+
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+	}, got)
+}
+
+func TestPFTableExporter_export(t *testing.T) {
+	require.Nil(t, newPFTableExporter(&pfTableConfig{Name: "table", Enabled: false}))
+
+	var (
+		calls   int
+		got     []netip.Prefix
+		errRepl error
+	)
+
+	e := newPFTableExporter(&pfTableConfig{Name: "table", Enabled: true})
+	require.NotNil(t, e)
+
+	e.replace = func(name string, prefixes []netip.Prefix) (err error) {
+		assert.Equal(t, "table", name)
+
+		calls++
+		got = prefixes
+
+		return errRepl
+	}
+
+	disallowed := []string{"192.0.2.1"}
+	want := []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}
+
+	t.Run("first", func(t *testing.T) {
+		e.export(nil, disallowed)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("same", func(t *testing.T) {
+		e.export(nil, disallowed)
+
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		e.export([]string{"192.0.2.2"}, disallowed)
+
+		assert.Equal(t, 2, calls)
+		assert.Empty(t, got)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errRepl = errors.Error("test error")
+		e.export(nil, disallowed)
+		e.export(nil, disallowed)
+
+		assert.Equal(t, 4, calls)
+	})
+}
+
+func TestPFTableExporter_export_empty(t *testing.T) {
+	var calls int
+	e := &pfTableExporter{
+		replace: func(_ string, _ []netip.Prefix) (err error) {
+			calls++
+
+			return nil
+		},
+		mu:    &sync.Mutex{},
+		table: "table",
+	}
+
+	// The table is emptied on the first export, even if there are no clients.
+	e.export(nil, nil)
+	e.export(nil, nil)
+
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,315 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// piholeImportPath is the path of the HTTP API importing the Pi-hole
+// configuration.
+const piholeImportPath = "/control/import/pihole"
+
+// Names of the multipart form fields containing the Pi-hole files.
+const (
+	piholeFieldTeleporter = "teleporter"
+	piholeFieldCustom     = "custom_list"
+	piholeFieldCNAME      = "cname_list"
+	piholeFieldSettings   = "pihole_toml"
+)
+
+// piholeMaxMemory is the maximum number of bytes of the uploaded Pi-hole files
+// kept in memory; the rest is stored in temporary files.
+const piholeMaxMemory = 32 << 20
+
+// piholeImportJSON is the JSON representation of the result of the Pi-hole
+// configuration import.
+type piholeImportJSON struct {
+	// Warnings describe the entries which have been skipped.
+	Warnings []string `json:"warnings"`
+
+	// Filters is the number of the added filter lists.
+	Filters int `json:"filters"`
+
+	// UserRules is the number of the added user rules.
+	UserRules int `json:"user_rules"`
+
+	// Rewrites is the number of the added rewrites.
+	Rewrites int `json:"rewrites"`
+
+	// Clients is the number of the added persistent clients.
+	Clients int `json:"clients"`
+}
+
+// newPiholeImportConfig converts the Pi-hole configuration into the filtering
+// one.
+func newPiholeImportConfig(conf *pihole.Config) (imp *filtering.ImportConfig) {
+	imp = &filtering.ImportConfig{
+		UserRules: conf.Rules,
+	}
+
+	for _, l := range conf.Lists {
+		imp.Filters = append(imp.Filters, &filtering.ImportedFilter{
+			URL:       l.URL,
+			Name:      l.Name,
+			Enabled:   l.Enabled,
+			Allowlist: l.Allowlist,
+		})
+	}
+
+	for _, rw := range conf.Rewrites {
+		imp.Rewrites = append(imp.Rewrites, &filtering.LegacyRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	return imp
+}
+
+// newPiholeClient converts the Pi-hole client into a persistent client object
+// using the global settings.
+func newPiholeClient(c *pihole.Client) (o *clientObject) {
+	return &clientObject{
+		Name:                     c.Name,
+		IDs:                      c.IDs,
+		UseGlobalSettings:        true,
+		FilteringEnabled:         true,
+		UseGlobalBlockedServices: true,
+	}
+}
+
+// appendErrors appends the messages of errs to warnings.
+func appendErrors(warnings []string, errs []error) (res []string) {
+	for _, err := range errs {
+		warnings = append(warnings, err.Error())
+	}
+
+	return warnings
+}
+
+// handleImportPihole is the handler for the POST /control/import/pihole HTTP
+// API.
+func handleImportPihole(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(piholeMaxMemory)
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "parsing form: %s", err)
+
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	src, closeFiles, err := piholeSourceFromForm(r.MultipartForm)
+	defer closeFiles()
+	if err != nil {
+		writeError(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	conf, err := pihole.Import(src)
+	if err != nil {
+		writeError(r, w, http.StatusUnprocessableEntity, "importing: %s", err)
+
+		return
+	}
+
+	res, errs := Context.filters.Import(newPiholeImportConfig(conf))
+	resp := &piholeImportJSON{
+		Warnings:  appendErrors(conf.Warnings, errs),
+		Filters:   res.Filters,
+		UserRules: res.UserRules,
+		Rewrites:  res.Rewrites,
+	}
+
+	resp.Clients, errs = importPiholeClients(r.Context(), conf.Clients)
+	resp.Warnings = appendErrors(resp.Warnings, errs)
+
+	onConfigModified()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// piholeSourceFromForm returns the Pi-hole files from the multipart form.
+// closeFiles must be called even if err is not nil.
+func piholeSourceFromForm(form *multipart.Form) (src *pihole.Source, closeFiles func(), err error) {
+	src = &pihole.Source{}
+
+	var files []multipart.File
+	closeFiles = func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+
+	open := func(field string) (f multipart.File, err error) {
+		hdrs := form.File[field]
+		if len(hdrs) == 0 {
+			return nil, nil
+		}
+
+		f, err = hdrs[0].Open()
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %w", field, err)
+		}
+
+		files = append(files, f)
+
+		return f, nil
+	}
+
+	for _, fr := range []struct {
+		dst   *io.Reader
+		field string
+	}{{
+		dst:   &src.Teleporter,
+		field: piholeFieldTeleporter,
+	}, {
+		dst:   &src.CustomList,
+		field: piholeFieldCustom,
+	}, {
+		dst:   &src.CNAMEList,
+		field: piholeFieldCNAME,
+	}, {
+		dst:   &src.Settings,
+		field: piholeFieldSettings,
+	}} {
+		f, err := open(fr.field)
+		if err != nil {
+			return nil, closeFiles, err
+		} else if f != nil {
+			*fr.dst = f
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, closeFiles, errors.Error("no pi-hole files provided")
+	}
+
+	return src, closeFiles, nil
+}
+
+// importPiholeClients adds the Pi-hole clients to the persistent clients and
+// returns the number of the added ones.  The clients which can't be added are
+// reported in errs.
+func importPiholeClients(ctx context.Context, clients []*pihole.Client) (n int, errs []error) {
+	cc := &Context.clients
+	for _, c := range clients {
+		p, err := newPiholeClient(c).toPersistent(
+			ctx,
+			cc.baseLogger,
+			cc.safeSearchCacheSize,
+			cc.safeSearchCacheTTL,
+		)
+		if err == nil {
+			err = cc.storage.Add(ctx, p)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("client %q: %w", c.Name, err))
+
+			continue
+		}
+
+		n++
+	}
+
+	return n, errs
+}
+
+// importFilteringConfig adds the filtering entities from imp to the global
+// configuration, which must not be used by the running services.
+func importFilteringConfig(
+	imp *filtering.ImportConfig,
+) (res *filtering.ImportResult, errs []error) {
+	filtConf := &filtering.Config{
+		Filters:          config.Filters,
+		WhitelistFilters: config.WhitelistFilters,
+		UserRules:        config.UserRules,
+		Rewrites:         config.Filtering.Rewrites,
+	}
+
+	res, errs = filtConf.Import(imp)
+
+	config.Filters = filtConf.Filters
+	config.WhitelistFilters = filtConf.WhitelistFilters
+	config.UserRules = filtConf.UserRules
+	config.Filtering.Rewrites = filtConf.Rewrites
+
+	return res, errs
+}
+
+// importPihole imports the Pi-hole configuration from p, which is either the
+// configuration directory or the Teleporter archive, into the configuration
+// file.  It must only be called once the configuration file is parsed and
+// before the services are initialized.
+func importPihole(p string) (err error) {
+	conf, err := readPihole(p)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	res, errs := importFilteringConfig(newPiholeImportConfig(conf))
+	warnings := appendErrors(conf.Warnings, errs)
+
+	clients := 0
+	for _, c := range conf.Clients {
+		hasName := func(o *clientObject) (ok bool) { return o.Name == c.Name }
+		if slices.ContainsFunc(config.Clients.Persistent, hasName) {
+			warnings = append(warnings, fmt.Sprintf("client %q: name already exists", c.Name))
+
+			continue
+		}
+
+		config.Clients.Persistent = append(config.Clients.Persistent, newPiholeClient(c))
+		clients++
+	}
+
+	for _, w := range warnings {
+		log.Info("pihole: warning: %s", w)
+	}
+
+	log.Info(
+		"pihole: imported %d filters, %d user rules, %d rewrites, and %d clients",
+		res.Filters,
+		res.UserRules,
+		res.Rewrites,
+		clients,
+	)
+
+	return writeConfigFile()
+}
+
+// readPihole converts the Pi-hole configuration from p, which is either the
+// configuration directory or the Teleporter archive.
+func readPihole(p string) (conf *pihole.Config, err error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	} else if fi.IsDir() {
+		return pihole.ImportDir(p)
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return pihole.Import(&pihole.Source{
+		Teleporter: f,
+	})
+}
@@ -0,0 +1,239 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// privateRDNSDiscovery is the result of discovering the local DNS servers and
+// the private networks from the network configuration of the host.
+type privateRDNSDiscovery struct {
+	// resolvers are the addresses of the local DNS servers, which are the
+	// gateways of the DHCP scope and of the network interfaces.
+	resolvers []netip.AddrPort
+
+	// nets are the networks of the DHCP scopes and the private networks of the
+	// network interfaces.
+	nets []netip.Prefix
+}
+
+// privateRDNSProbeTimeout is the timeout of the query probing a discovered
+// local DNS server.
+const privateRDNSProbeTimeout = 1 * time.Second
+
+// privateRDNSProbeName is the name of the PTR record requested from the
+// discovered local DNS servers to check that they serve DNS.
+const privateRDNSProbeName = "1.0.0.127.in-addr.arpa."
+
+// discoverPrivateRDNS returns the local DNS servers and the private networks
+// found in the DHCP server configuration and the network configuration of the
+// host.  It returns nil if the discovery is disabled in dnsConf.  dnsConf and
+// dhcpConf must not be nil.
+//
+// The discovery is disabled by default, since it assumes that the gateway of
+// each private network serves plain DNS on port 53.  The gateways which don't
+// answer a probe query are skipped.
+func discoverPrivateRDNS(dnsConf *dnsConfig, dhcpConf *dhcpd.ServerConfig) (d *privateRDNSDiscovery) {
+	if !dnsConf.DiscoverPrivateRDNS {
+		return nil
+	}
+
+	ifaces, err := aghnet.GetValidNetInterfacesForWeb()
+	if err != nil {
+		log.Debug("dns: discovering private rdns: %s", err)
+	}
+
+	d = newPrivateRDNSDiscovery(dhcpConf, ifaces, aghnet.GatewayIP)
+	d.probeResolvers(probePrivateRDNSResolver)
+	log.Debug("dns: discovered private rdns resolvers %v and networks %v", d.resolvers, d.nets)
+
+	return d
+}
+
+// newPrivateRDNSDiscovery collects the local DNS servers and the private
+// networks from the DHCP server configuration and the network interfaces.
+// gatewayIP returns the gateway of the interface with the given name, if there
+// is one.  dhcpConf must not be nil.
+func newPrivateRDNSDiscovery(
+	dhcpConf *dhcpd.ServerConfig,
+	ifaces []*aghnet.NetInterface,
+	gatewayIP func(ifaceName string) (ip netip.Addr),
+) (d *privateRDNSDiscovery) {
+	d = &privateRDNSDiscovery{}
+
+	if dhcpConf.Enabled {
+		d.addDHCPScopes(dhcpConf)
+	}
+
+	for _, iface := range ifaces {
+		isPrivate := false
+		for _, p := range iface.Subnets {
+			addr := p.Addr()
+			if addr.IsLoopback() || addr.IsLinkLocalUnicast() || !addr.IsPrivate() {
+				continue
+			}
+
+			isPrivate = true
+			d.addNet(p.Masked())
+		}
+
+		if isPrivate {
+			d.addResolver(gatewayIP(iface.Name))
+		}
+	}
+
+	return d
+}
+
+// addDHCPScopes adds the gateway and the networks of the DHCP scopes from
+// dhcpConf.  The invalid parts of the configuration are ignored, since those
+// are reported by the DHCP server itself.
+func (d *privateRDNSDiscovery) addDHCPScopes(dhcpConf *dhcpd.ServerConfig) {
+	conf4 := &dhcpConf.Conf4
+	gateway, mask := conf4.GatewayIP.Unmap(), conf4.SubnetMask.Unmap()
+	if gateway.Is4() && mask.Is4() {
+		ones, bits := net.IPMask(mask.AsSlice()).Size()
+		if bits != 0 {
+			d.addNet(netip.PrefixFrom(gateway, ones).Masked())
+			d.addResolver(gateway)
+		}
+	}
+
+	// The DHCPv6 scope is always a /64 one, see [dhcpd.V6ServerConf].
+	const v6ScopeLen = 64
+
+	if start, ok := netip.AddrFromSlice(dhcpConf.Conf6.RangeStart); ok && start.Is6() {
+		d.addNet(netip.PrefixFrom(start, v6ScopeLen).Masked())
+	}
+}
+
+// addResolver adds a plain DNS server at ip, unless it's invalid or already
+// added.
+func (d *privateRDNSDiscovery) addResolver(ip netip.Addr) {
+	if !ip.IsValid() || ip.IsUnspecified() {
+		return
+	}
+
+	addr := netip.AddrPortFrom(ip.Unmap(), defaultPortDNS)
+	if !slices.Contains(d.resolvers, addr) {
+		d.resolvers = append(d.resolvers, addr)
+	}
+}
+
+// probeResolvers removes the resolvers for which probe returns an error.  The
+// resolvers are probed concurrently.
+func (d *privateRDNSDiscovery) probeResolvers(probe func(addr netip.AddrPort) (err error)) {
+	errs := make([]error, len(d.resolvers))
+
+	wg := &sync.WaitGroup{}
+	for i, addr := range d.resolvers {
+		wg.Add(1)
+		go func() {
+			defer log.OnPanic("dns: probing private rdns resolver")
+			defer wg.Done()
+
+			errs[i] = probe(addr)
+		}()
+	}
+
+	wg.Wait()
+
+	resolvers := d.resolvers[:0]
+	for i, addr := range d.resolvers {
+		if errs[i] != nil {
+			log.Info("dns: warning: discovered resolver %s: skipping: %s", addr, errs[i])
+
+			continue
+		}
+
+		resolvers = append(resolvers, addr)
+	}
+
+	d.resolvers = resolvers
+}
+
+// probePrivateRDNSResolver returns an error if the plain DNS server at addr
+// doesn't answer the probe query.
+func probePrivateRDNSResolver(addr netip.AddrPort) (err error) {
+	req := (&dns.Msg{}).SetQuestion(privateRDNSProbeName, dns.TypePTR)
+	c := &dns.Client{
+		Timeout: privateRDNSProbeTimeout,
+	}
+
+	_, _, err = c.Exchange(req, addr.String())
+
+	// Don't wrap the error, because it's informative enough as is.
+	return err
+}
+
+// addNet adds p, unless it's already added.
+func (d *privateRDNSDiscovery) addNet(p netip.Prefix) {
+	if !slices.Contains(d.nets, p) {
+		d.nets = append(d.nets, p)
+	}
+}
+
+// privateSubnetSet returns the set of networks considered private.  If nets
+// are set, those are used as is.  Otherwise, the locally served networks and
+// the networks discovered in d, if any, are used.  d may be nil.
+func (d *privateRDNSDiscovery) privateSubnetSet(nets []netutil.Prefix) (s netutil.SubnetSet) {
+	if len(nets) > 0 || d == nil || len(d.nets) == 0 {
+		return parseSubnetSet(nets)
+	}
+
+	discovered := netutil.SliceSubnetSet(d.nets)
+
+	return netutil.SubnetSetFunc(func(ip netip.Addr) (ok bool) {
+		return netutil.IsLocallyServed(ip) || discovered.Contains(ip)
+	})
+}
+
+// ptrResolvers returns the discovered local DNS servers.  d may be nil.
+func (d *privateRDNSDiscovery) ptrResolvers() (addrs []netip.AddrPort) {
+	if d == nil {
+		return nil
+	}
+
+	return d.resolvers
+}
+
+// privateSubnets is the [netutil.SubnetSet] of the private networks used by the
+// DNS server.  The set can't be replaced without recreating the server, so it's
+// updated in place when the DNS configuration is reapplied.
+type privateSubnets struct {
+	// set is the current set of the private networks.  It's never nil.
+	set atomic.Pointer[netutil.SubnetSet]
+}
+
+// type check
+var _ netutil.SubnetSet = (*privateSubnets)(nil)
+
+// newPrivateSubnets returns a new *privateSubnets containing s.  s must not be
+// nil.
+func newPrivateSubnets(s netutil.SubnetSet) (p *privateSubnets) {
+	p = &privateSubnets{}
+	p.set.Store(&s)
+
+	return p
+}
+
+// Contains implements the [netutil.SubnetSet] interface for *privateSubnets.
+func (p *privateSubnets) Contains(ip netip.Addr) (ok bool) {
+	return (*p.set.Load()).Contains(ip)
+}
+
+// update replaces the current set of the private networks with s.  s must not
+// be nil.
+func (p *privateSubnets) update(s netutil.SubnetSet) {
+	p.set.Store(&s)
+}
@@ -0,0 +1,186 @@
+package home
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPrivateRDNSDiscovery(t *testing.T) {
+	gateways := map[string]netip.Addr{
+		"eth0": netip.MustParseAddr("192.168.1.1"),
+		"eth1": netip.MustParseAddr("203.0.113.1"),
+	}
+
+	gatewayIP := func(ifaceName string) (ip netip.Addr) {
+		return gateways[ifaceName]
+	}
+
+	ifaces := []*aghnet.NetInterface{{
+		Name: "lo",
+		Subnets: []netip.Prefix{
+			netip.MustParsePrefix("127.0.0.1/8"),
+		},
+	}, {
+		Name: "eth0",
+		Subnets: []netip.Prefix{
+			netip.MustParsePrefix("192.168.1.2/24"),
+			netip.MustParsePrefix("fd00:1::2/64"),
+			netip.MustParsePrefix("fe80::2/64"),
+		},
+	}, {
+		Name: "eth1",
+		Subnets: []netip.Prefix{
+			netip.MustParsePrefix("203.0.113.2/24"),
+		},
+	}}
+
+	dhcpConf := &dhcpd.ServerConfig{
+		Conf4: dhcpd.V4ServerConf{
+			GatewayIP:  netip.MustParseAddr("10.0.10.1"),
+			SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		},
+		Conf6: dhcpd.V6ServerConf{
+			RangeStart: net.ParseIP("2001:db8:1::100"),
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		wantResolvers []netip.AddrPort
+		wantNets      []netip.Prefix
+		dhcpEnabled   bool
+	}{{
+		name: "interfaces",
+		wantResolvers: []netip.AddrPort{
+			netip.MustParseAddrPort("192.168.1.1:53"),
+		},
+		wantNets: []netip.Prefix{
+			netip.MustParsePrefix("192.168.1.0/24"),
+			netip.MustParsePrefix("fd00:1::/64"),
+		},
+		dhcpEnabled: false,
+	}, {
+		name: "dhcp",
+		wantResolvers: []netip.AddrPort{
+			netip.MustParseAddrPort("10.0.10.1:53"),
+			netip.MustParseAddrPort("192.168.1.1:53"),
+		},
+		wantNets: []netip.Prefix{
+			netip.MustParsePrefix("10.0.10.0/24"),
+			netip.MustParsePrefix("2001:db8:1::/64"),
+			netip.MustParsePrefix("192.168.1.0/24"),
+			netip.MustParsePrefix("fd00:1::/64"),
+		},
+		dhcpEnabled: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := *dhcpConf
+			conf.Enabled = tc.dhcpEnabled
+
+			d := newPrivateRDNSDiscovery(&conf, ifaces, gatewayIP)
+			assert.Equal(t, tc.wantResolvers, d.resolvers)
+			assert.Equal(t, tc.wantNets, d.nets)
+		})
+	}
+}
+
+func TestPrivateRDNSDiscovery_probeResolvers(t *testing.T) {
+	answering := netip.MustParseAddrPort("192.168.1.1:53")
+	silent := netip.MustParseAddrPort("192.168.2.1:53")
+
+	d := &privateRDNSDiscovery{
+		resolvers: []netip.AddrPort{silent, answering},
+	}
+
+	d.probeResolvers(func(addr netip.AddrPort) (err error) {
+		if addr == silent {
+			return errors.Error("i/o timeout")
+		}
+
+		return nil
+	})
+
+	assert.Equal(t, []netip.AddrPort{answering}, d.resolvers)
+}
+
+func TestPrivateRDNSDiscovery_privateSubnetSet(t *testing.T) {
+	d := &privateRDNSDiscovery{
+		nets: []netip.Prefix{netip.MustParsePrefix("2a00:1::/64")},
+	}
+
+	var nilDiscovery *privateRDNSDiscovery
+
+	manual := []netutil.Prefix{{Prefix: netip.MustParsePrefix("192.168.1.0/24")}}
+
+	testCases := []struct {
+		d       *privateRDNSDiscovery
+		name    string
+		nets    []netutil.Prefix
+		ip      netip.Addr
+		wantHas bool
+	}{{
+		d:       d,
+		name:    "discovered",
+		nets:    nil,
+		ip:      netip.MustParseAddr("2a00:1::1"),
+		wantHas: true,
+	}, {
+		d:       d,
+		name:    "locally_served",
+		nets:    nil,
+		ip:      netip.MustParseAddr("10.0.0.1"),
+		wantHas: true,
+	}, {
+		d:       d,
+		name:    "public",
+		nets:    nil,
+		ip:      netip.MustParseAddr("94.140.14.14"),
+		wantHas: false,
+	}, {
+		d:       nilDiscovery,
+		name:    "disabled",
+		nets:    nil,
+		ip:      netip.MustParseAddr("2a00:1::1"),
+		wantHas: false,
+	}, {
+		d:       d,
+		name:    "manual",
+		nets:    manual,
+		ip:      netip.MustParseAddr("2a00:1::1"),
+		wantHas: false,
+	}, {
+		d:       d,
+		name:    "manual_match",
+		nets:    manual,
+		ip:      netip.MustParseAddr("192.168.1.1"),
+		wantHas: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.d.privateSubnetSet(tc.nets)
+			assert.Equal(t, tc.wantHas, s.Contains(tc.ip))
+		})
+	}
+}
+
+func TestPrivateSubnets_update(t *testing.T) {
+	ip := netip.MustParseAddr("2a00:1::1")
+
+	s := newPrivateSubnets((*privateRDNSDiscovery)(nil).privateSubnetSet(nil))
+	assert.False(t, s.Contains(ip))
+
+	s.update((&privateRDNSDiscovery{
+		nets: []netip.Prefix{netip.MustParsePrefix("2a00:1::/64")},
+	}).privateSubnetSet(nil))
+	assert.True(t, s.Contains(ip))
+}
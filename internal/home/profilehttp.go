@@ -43,12 +43,20 @@ type profileJSON struct {
 	Name     string `json:"name"`
 	Language string `json:"language"`
 	Theme    Theme  `json:"theme"`
+
+	// Role is the role of the user.  It's ignored in the update requests.
+	Role userRole `json:"role"`
 }
 
 // handleGetProfile is the handler for GET /control/profile endpoint.
 func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	u := Context.auth.getCurrentUser(r)
 
+	role := u.Role
+	if role == userRoleDefault {
+		role = userRoleAdmin
+	}
+
 	var resp profileJSON
 	func() {
 		config.RLock()
@@ -58,6 +66,7 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 			Name:     u.Name,
 			Language: config.Language,
 			Theme:    config.Theme,
+			Role:     role,
 		}
 	}()
 
@@ -73,14 +82,17 @@ func handlePutProfile(w http.ResponseWriter, r *http.Request) {
 	profileReq := &profileJSON{}
 	err := json.NewDecoder(r.Body).Decode(profileReq)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "reading req: %s", err)
+		writeError(r, w, http.StatusBadRequest, "reading req: %s", err)
 
 		return
 	}
 
 	lang := profileReq.Language
 	if !allowedLanguages.Has(lang) {
-		aghhttp.Error(r, w, http.StatusBadRequest, "unknown language: %q", lang)
+		writeError(r, w, http.StatusBadRequest, "%s", newFieldError(
+			"/language",
+			fmt.Errorf("unknown language: %q", lang),
+		))
 
 		return
 	}
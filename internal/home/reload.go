@@ -0,0 +1,154 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// reloadConfig re-reads the configuration file and applies the changes of the
+// filtering, DNS, and persistent clients settings without restarting AdGuard
+// Home.  All of these settings are validated before applying any of them, so
+// that an invalid section doesn't leave the settings partially applied.  The
+// DNS server keeps serving on its listeners while reloading, so that the
+// in-flight queries are answered.  The other settings, such as the HTTP and TLS
+// ones, require a restart.
+func reloadConfig(ctx context.Context) (err error) {
+	if Context.firstRun {
+		return errors.Error("configuration file has not been created yet")
+	} else if Context.filters == nil || Context.clients.storage == nil {
+		return errors.Error("not initialized yet")
+	}
+
+	conf, err := readReloadedConfig()
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	config.Lock()
+	defer config.Unlock()
+
+	conf.Filtering.Filters = conf.Filters
+	conf.Filtering.WhitelistFilters = conf.WhitelistFilters
+	conf.Filtering.UserRules = conf.UserRules
+	conf.Filtering.UserRulesMeta = conf.UserRulesMeta
+	err = filtering.PrepareReload(conf.Filtering)
+	if err != nil {
+		return fmt.Errorf("applying filtering config: %w", err)
+	}
+
+	clientsSet, err := Context.clients.prepareReload(ctx, conf.Clients.Persistent)
+	if err != nil {
+		return fmt.Errorf("applying clients config: %w", err)
+	}
+
+	// Apply the DNS settings first, since they're only validated by the DNS
+	// server itself and are restored on failure.
+	err = reloadDNSConfig(ctx, &conf.DNS)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	Context.clients.applyReload(ctx, clientsSet)
+
+	err = Context.filters.Reload(conf.Filtering)
+	if err != nil {
+		// Shouldn't happen, since the config is already validated.
+		return fmt.Errorf("applying filtering config: %w", err)
+	}
+
+	config.Filters = slices.Clone(conf.Filters)
+	config.WhitelistFilters = slices.Clone(conf.WhitelistFilters)
+	config.UserRules = slices.Clone(conf.UserRules)
+	config.UserRulesMeta = slices.Clone(conf.UserRulesMeta)
+	config.includes = conf.includes
+
+	log.Info("config: reloaded; http and tls settings require a restart")
+
+	return nil
+}
+
+// readReloadedConfig reads the configuration file anew and returns the
+// configuration decoded from it.  The upgraded configuration isn't written.
+func readReloadedConfig() (conf *configuration, err error) {
+	confPath := configFilePath()
+	log.Debug("config: reloading config file %q", confPath)
+
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	data, _, err = newConfigMigrator().Migrate(data, configmigrate.LastSchemaVersion)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conf = newDefaultConfig()
+	err = decodeConfig(conf, data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// reloadDNSConfig replaces the DNS settings of the global configuration with
+// dnsConf and applies them to the DNS server, if it's running and they have
+// changed.  The listeners of the DNS server are only replaced if their settings
+// have changed, see [reloadDNSServer].  The previous settings are restored if
+// the new ones are invalid.  config must be locked.
+func reloadDNSConfig(ctx context.Context, dnsConf *dnsConfig) (err error) {
+	prev := config.DNS
+	if reflect.DeepEqual(&prev, dnsConf) {
+		return nil
+	}
+
+	config.DNS = *dnsConf
+	if !isRunning() {
+		return nil
+	}
+
+	err = reloadDNSServer(ctx)
+	if err != nil {
+		config.DNS = prev
+
+		// Restart the server with the previous settings, since it could have
+		// been stopped or left draining.
+		if restoreErr := reconfigureDNSServer(); restoreErr != nil {
+			log.Error("config: restoring dns config: %s", restoreErr)
+		}
+
+		return fmt.Errorf("applying dns config: %w", err)
+	}
+
+	return nil
+}
+
+// handleReload is the handler for the POST /control/reload HTTP API.  It
+// applies the changes of the configuration file, the same as SIGHUP does.
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	log.Info("config reload requested by %s", r.RemoteAddr)
+
+	err := reloadConfig(r.Context())
+	if err != nil {
+		writeError(r, w, http.StatusUnprocessableEntity, "reloading config: %s", err)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
@@ -0,0 +1,349 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+const (
+	// sandboxInitialQueries is the number of the synthetic queries generated
+	// right after the start of the sandbox mode, so that the query log and the
+	// statistics aren't empty.
+	sandboxInitialQueries = 1000
+
+	// sandboxQueryIvl is the interval between the synthetic queries generated
+	// after the initial ones.
+	sandboxQueryIvl = 500 * time.Millisecond
+)
+
+// initSandboxWorkDir sets up a temporary working directory with the default
+// configuration file for the sandbox mode, so that neither the existing data
+// are changed nor the setup wizard is required.
+func initSandboxWorkDir() (err error) {
+	Context.workDir, err = os.MkdirTemp("", "AdGuardHome-sandbox-")
+	if err != nil {
+		return fmt.Errorf("creating sandbox working directory: %w", err)
+	}
+
+	log.Info("sandbox: using temporary working directory %q", Context.workDir)
+
+	Context.confFilePath = filepath.Join(Context.workDir, "AdGuardHome.yaml")
+
+	// Don't listen on all interfaces, since there is nothing to protect with
+	// the authentication.
+	config.HTTPConfig.Address = netip.AddrPortFrom(netutil.IPv4Localhost(), defaultPortHTTP)
+	config.Filters = nil
+	config.DHCP.Enabled = false
+
+	// Don't wrap the error since it's informative enough as is.
+	return writeConfigFile()
+}
+
+// startSandbox initializes the DNS modules and starts generating the
+// synthetic data for them, but doesn't start serving DNS.  l must not be nil.
+func startSandbox(l *slog.Logger, statsDir, querylogDir string) (err error) {
+	err = initDNS(l, statsDir, querylogDir)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	Context.filters.EnableFilters(false)
+
+	// TODO(s.chzhen):  Pass context.
+	err = Context.clients.Start(context.TODO())
+	if err != nil {
+		return fmt.Errorf("starting clients container: %w", err)
+	}
+
+	Context.stats.Start()
+	Context.queryLog.Start()
+
+	g := newSandboxGenerator(Context.queryLog, Context.stats, time.Now().UnixNano())
+	go g.run(sandboxInitialQueries, sandboxQueryIvl)
+
+	log.Info("sandbox: generating synthetic data, dns is not served")
+
+	return nil
+}
+
+// sandboxDomain is a domain name queried in the sandbox mode along with the
+// filtering result for it.
+type sandboxDomain struct {
+	// rule is the rule blocking the domain, if any.
+	rule string
+
+	name string
+
+	// reason is the reason of the filtering result.
+	reason filtering.Reason
+
+	// weight is the relative frequency of the queries for the domain.
+	weight uint
+}
+
+// filtered returns true if the queries for the domain are blocked.
+func (d *sandboxDomain) filtered() (ok bool) {
+	return d.reason.In(
+		filtering.FilteredBlockList,
+		filtering.FilteredSafeBrowsing,
+		filtering.FilteredParental,
+	)
+}
+
+// sandboxDomains are the domain names queried in the sandbox mode.
+var sandboxDomains = []*sandboxDomain{{
+	name:   "www.example.com",
+	reason: filtering.NotFilteredNotFound,
+	weight: 30,
+}, {
+	name:   "example.org",
+	reason: filtering.NotFilteredNotFound,
+	weight: 20,
+}, {
+	name:   "cdn.example.net",
+	reason: filtering.NotFilteredNotFound,
+	weight: 20,
+}, {
+	name:   "mail.example.com",
+	reason: filtering.NotFilteredNotFound,
+	weight: 10,
+}, {
+	name:   "api.example.org",
+	reason: filtering.NotFilteredNotFound,
+	weight: 10,
+}, {
+	name:   "time.example.net",
+	reason: filtering.NotFilteredNotFound,
+	weight: 5,
+}, {
+	rule:   "||ads.example.com^",
+	name:   "ads.example.com",
+	reason: filtering.FilteredBlockList,
+	weight: 12,
+}, {
+	rule:   "||tracker.example.net^",
+	name:   "tracker.example.net",
+	reason: filtering.FilteredBlockList,
+	weight: 8,
+}, {
+	rule:   "||telemetry.example.org^",
+	name:   "telemetry.example.org",
+	reason: filtering.FilteredBlockList,
+	weight: 5,
+}, {
+	rule:   "@@||allowed.example.com^",
+	name:   "allowed.example.com",
+	reason: filtering.NotFilteredAllowList,
+	weight: 3,
+}, {
+	name:   "malware.example.net",
+	reason: filtering.FilteredSafeBrowsing,
+	weight: 1,
+}, {
+	name:   "adult.example.org",
+	reason: filtering.FilteredParental,
+	weight: 1,
+}}
+
+// sandboxUpstreams are the upstreams which the synthetic queries are
+// "forwarded" to.
+var sandboxUpstreams = []string{
+	"https://dns.example/dns-query",
+	"tls://dot.example",
+	"192.0.2.53:53",
+}
+
+// sandboxGenerator generates the synthetic DNS queries and feeds them to the
+// query log and the statistics.
+type sandboxGenerator struct {
+	qlog  querylog.QueryLog
+	stats stats.Interface
+	rand  *rand.Rand
+
+	// clients are the addresses of the clients sending the synthetic queries.
+	clients []netip.Addr
+
+	// totalWeight is the total weight of [sandboxDomains].
+	totalWeight uint
+}
+
+// newSandboxGenerator returns a new properly initialized *sandboxGenerator
+// using seed for random numbers.
+func newSandboxGenerator(
+	qlog querylog.QueryLog,
+	sts stats.Interface,
+	seed int64,
+) (g *sandboxGenerator) {
+	g = &sandboxGenerator{
+		qlog:  qlog,
+		stats: sts,
+		rand:  rand.New(rand.NewPCG(uint64(seed), 0)),
+	}
+
+	for i := range byte(8) {
+		g.clients = append(g.clients, netip.AddrFrom4([4]byte{192, 168, 1, 10 + i}))
+	}
+
+	for _, d := range sandboxDomains {
+		g.totalWeight += d.weight
+	}
+
+	return g
+}
+
+// run adds initial queries at once and then one query each ivl.  It's
+// intended to be used as a goroutine.
+func (g *sandboxGenerator) run(initial int, ivl time.Duration) {
+	defer log.OnPanic("sandbox")
+
+	for range initial {
+		g.add()
+	}
+
+	t := time.NewTicker(ivl)
+	defer t.Stop()
+
+	for range t.C {
+		g.add()
+	}
+}
+
+// add generates a single synthetic query and adds it to the query log and the
+// statistics.
+func (g *sandboxGenerator) add() {
+	qp, se := g.generate()
+
+	g.qlog.Add(qp)
+	g.stats.Update(se)
+}
+
+// generate returns the parameters of a single synthetic query for the query
+// log and the statistics.
+func (g *sandboxGenerator) generate() (qp *querylog.AddParams, se *stats.Entry) {
+	d := g.domain()
+	client := g.clients[g.rand.IntN(len(g.clients))]
+	upstream := sandboxUpstreams[g.rand.IntN(len(sandboxUpstreams))]
+
+	qtype := dns.TypeA
+	if g.rand.IntN(3) == 0 {
+		qtype = dns.TypeAAAA
+	}
+
+	req := (&dns.Msg{}).SetQuestion(dns.Fqdn(d.name), qtype)
+	resp := g.answer(req, d)
+
+	res := &filtering.Result{
+		Reason:     d.reason,
+		IsFiltered: d.filtered(),
+	}
+
+	if d.rule != "" {
+		res.Rules = []*filtering.ResultRule{{
+			Text:         d.rule,
+			FilterListID: rulelist.URLFilterIDCustom,
+		}}
+	}
+
+	elapsed := time.Duration(1+g.rand.IntN(80)) * time.Millisecond
+
+	qp = &querylog.AddParams{
+		Question:    req,
+		Answer:      resp,
+		Result:      res,
+		ClientProto: querylog.ClientProtoPlain,
+		ClientIP:    net.IP(client.AsSlice()),
+		Elapsed:     elapsed,
+		Cached:      !res.IsFiltered && g.rand.IntN(4) == 0,
+	}
+
+	se = &stats.Entry{
+		Client:         client.String(),
+		Domain:         d.name,
+		Result:         sandboxStatsResult(d.reason),
+		ProcessingTime: elapsed,
+	}
+
+	if !res.IsFiltered {
+		qp.Upstream = upstream
+		se.Upstream = upstream
+		se.UpstreamTime = elapsed
+	}
+
+	return qp, se
+}
+
+// domain returns a random domain from [sandboxDomains] according to their
+// weights.
+func (g *sandboxGenerator) domain() (d *sandboxDomain) {
+	n := g.rand.UintN(g.totalWeight)
+	for _, d = range sandboxDomains {
+		if n < d.weight {
+			return d
+		}
+
+		n -= d.weight
+	}
+
+	// Shouldn't happen, since n is less than the total weight.
+	return sandboxDomains[0]
+}
+
+// answer returns a synthetic response to req.  The filtered domains are
+// answered with the unspecified addresses.
+func (g *sandboxGenerator) answer(req *dns.Msg, d *sandboxDomain) (resp *dns.Msg) {
+	resp = (&dns.Msg{}).SetReply(req)
+
+	q := req.Question[0]
+	hdr := dns.RR_Header{
+		Name:   q.Name,
+		Rrtype: q.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(60 + g.rand.IntN(3600)),
+	}
+
+	filtered := d.filtered()
+	switch {
+	case q.Qtype == dns.TypeAAAA && filtered:
+		resp.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.IPv6unspecified}}
+	case q.Qtype == dns.TypeAAAA:
+		ip := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: byte(1 + g.rand.IntN(254))})
+		resp.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: ip.AsSlice()}}
+	case filtered:
+		resp.Answer = []dns.RR{&dns.A{Hdr: hdr, A: net.IPv4zero.To4()}}
+	default:
+		ip := netip.AddrFrom4([4]byte{198, 51, 100, byte(1 + g.rand.IntN(254))})
+		resp.Answer = []dns.RR{&dns.A{Hdr: hdr, A: ip.AsSlice()}}
+	}
+
+	return resp
+}
+
+// sandboxStatsResult returns the statistics result for the filtering reason.
+func sandboxStatsResult(reason filtering.Reason) (r stats.Result) {
+	switch reason {
+	case filtering.FilteredBlockList:
+		return stats.RFiltered
+	case filtering.FilteredSafeBrowsing:
+		return stats.RSafeBrowsing
+	case filtering.FilteredParental:
+		return stats.RParental
+	default:
+		return stats.RNotFiltered
+	}
+}
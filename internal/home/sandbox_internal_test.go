@@ -0,0 +1,44 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxGenerator_generate(t *testing.T) {
+	g := newSandboxGenerator(nil, nil, 1)
+
+	var filtered, notFiltered int
+	for range 1000 {
+		qp, se := g.generate()
+		require.NotNil(t, qp.Question)
+		require.NotNil(t, qp.Answer)
+		require.Len(t, qp.Answer.Answer, 1)
+
+		q := qp.Question.Question[0]
+		assert.Equal(t, q.Name, se.Domain+".")
+		assert.Equal(t, qp.ClientIP.String(), se.Client)
+		assert.Equal(t, q.Qtype, qp.Answer.Answer[0].Header().Rrtype)
+
+		if qp.Result.IsFiltered {
+			filtered++
+			assert.NotEqual(t, stats.RNotFiltered, se.Result)
+			assert.Empty(t, qp.Upstream)
+		} else {
+			notFiltered++
+			assert.Equal(t, stats.RNotFiltered, se.Result)
+			assert.NotEmpty(t, qp.Upstream)
+		}
+
+		if qp.Result.Reason == filtering.FilteredBlockList {
+			require.Len(t, qp.Result.Rules, 1)
+		}
+	}
+
+	assert.Positive(t, filtered)
+	assert.Greater(t, notFiltered, filtered)
+}
@@ -0,0 +1,246 @@
+package home
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// cspNoncePlaceholder is replaced with the nonce of the response in the
+// Content-Security-Policy header.
+const cspNoncePlaceholder = "{nonce}"
+
+// defaultContentSecurityPolicy is the Content-Security-Policy of the web
+// interface.  Styles are allowed inline, since the frontend sets the style
+// attributes of the elements.
+const defaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'nonce-" + cspNoncePlaceholder + "' 'strict-dynamic'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: https:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'"
+
+// securityHeadersConfig is the configuration of the security headers of the
+// HTTP responses of the web interface.
+type securityHeadersConfig struct {
+	// ContentSecurityPolicy, if not empty, replaces the default
+	// Content-Security-Policy.  The "{nonce}" placeholder is replaced with the
+	// nonce, which is also added to the script elements of the HTML pages.
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+
+	// FrameAncestors are the sources allowed to embed the web interface, for
+	// example "https://home.example.com".  If empty, only the pages of the web
+	// interface itself may embed it.  Set it to "'none'" to forbid embedding.
+	FrameAncestors []string `yaml:"frame_ancestors"`
+
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header sent
+	// over HTTPS.  If zero, the header is only sent when HTTPS is forced.
+	HSTSMaxAge timeutil.Duration `yaml:"hsts_max_age"`
+
+	// HSTSIncludeSubdomains defines if the includeSubDomains directive is added
+	// to the Strict-Transport-Security header set by HSTSMaxAge.
+	HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains"`
+
+	// Enabled defines if the security headers are sent.
+	Enabled bool `yaml:"enabled"`
+}
+
+// securityHeaders adds the security headers to the HTTP responses.
+type securityHeaders struct {
+	// csp is the Content-Security-Policy header value template with
+	// [cspNoncePlaceholder].
+	csp string
+
+	// hsts is the Strict-Transport-Security header value.  If empty, the
+	// header isn't sent.
+	hsts string
+
+	// frameOptions is the X-Frame-Options header value.  If empty, the header
+	// isn't sent.
+	frameOptions string
+}
+
+// newSecurityHeaders returns a new properly initialized *securityHeaders.  It
+// returns nil if the headers are disabled.
+func newSecurityHeaders(conf *securityHeadersConfig) (h *securityHeaders, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	csp := conf.ContentSecurityPolicy
+	if csp == "" {
+		csp = defaultContentSecurityPolicy
+	} else if strings.ContainsAny(csp, "\r\n") {
+		return nil, errors.Error("content_security_policy: newlines are not allowed")
+	}
+
+	for i, src := range conf.FrameAncestors {
+		if src == "" || strings.ContainsAny(src, " \t\r\n;,") {
+			return nil, fmt.Errorf("frame_ancestors: at index %d: bad source %q", i, src)
+		}
+	}
+
+	if conf.HSTSMaxAge.Duration < 0 {
+		return nil, fmt.Errorf("hsts_max_age: negative value %s", conf.HSTSMaxAge)
+	}
+
+	h = &securityHeaders{}
+
+	ancestors := conf.FrameAncestors
+	if len(ancestors) == 0 {
+		ancestors = []string{"'self'"}
+	}
+
+	// Don't override the directive set by the user.
+	if !strings.Contains(csp, "frame-ancestors") {
+		csp += "; frame-ancestors " + strings.Join(ancestors, " ")
+	}
+
+	h.csp = csp
+
+	// X-Frame-Options can't express a list of origins, so only send it when
+	// embedding is either forbidden or only allowed for the same origin.
+	if len(ancestors) == 1 {
+		switch ancestors[0] {
+		case "'none'":
+			h.frameOptions = "DENY"
+		case "'self'":
+			h.frameOptions = "SAMEORIGIN"
+		default:
+			// Go on.
+		}
+	}
+
+	if maxAge := conf.HSTSMaxAge.Duration; maxAge > 0 {
+		h.hsts = fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+		if conf.HSTSIncludeSubdomains {
+			h.hsts += "; includeSubDomains"
+		}
+	}
+
+	return h, nil
+}
+
+// nonceCtxKey is the context key for the CSP nonce of the response.
+type nonceCtxKey struct{}
+
+// nonceFromContext returns the CSP nonce of the response, if any.
+func nonceFromContext(ctx context.Context) (nonce string, ok bool) {
+	nonce, ok = ctx.Value(nonceCtxKey{}).(string)
+
+	return nonce, ok
+}
+
+// nonceLen is the length of the CSP nonce in bytes.
+const nonceLen = 16
+
+// wrap is a [middleware] that adds the security headers to the responses of h.
+func (sh *securityHeaders) wrap(h http.Handler) (wrapped http.Handler) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respHdr := w.Header()
+		respHdr.Set(httphdr.XContentTypeOptions, aghhttp.HdrValNoSniff)
+		respHdr.Set(aghhttp.HdrNameReferrerPolicy, "same-origin")
+
+		if sh.frameOptions != "" {
+			respHdr.Set(aghhttp.HdrNameXFrameOptions, sh.frameOptions)
+		}
+
+		if sh.hsts != "" && r.TLS != nil {
+			respHdr.Set(httphdr.StrictTransportSecurity, sh.hsts)
+		}
+
+		nonceData := make([]byte, nonceLen)
+		_, err := rand.Read(nonceData)
+		if err != nil {
+			// Serve the response without the nonce, the scripts will be
+			// blocked by the policy, but the API still works.
+			log.Error("web: generating csp nonce: %s", err)
+		} else {
+			nonce := base64.StdEncoding.EncodeToString(nonceData)
+			respHdr.Set(
+				httphdr.ContentSecurityPolicy,
+				strings.ReplaceAll(sh.csp, cspNoncePlaceholder, nonce),
+			)
+
+			r = r.WithContext(context.WithValue(r.Context(), nonceCtxKey{}, nonce))
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// htmlNonceHandler serves the HTML pages of the frontend with the CSP nonce of
+// the response added to their script elements.  Other files are served by the
+// underlying handler.
+type htmlNonceHandler struct {
+	// handler serves all other files.
+	handler http.Handler
+
+	// fsys contains the frontend files.
+	fsys fs.FS
+}
+
+// type check
+var _ http.Handler = (*htmlNonceHandler)(nil)
+
+// ServeHTTP implements the [http.Handler] interface for *htmlNonceHandler.
+func (h *htmlNonceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	nonce, ok := nonceFromContext(r.Context())
+	if !ok {
+		h.handler.ServeHTTP(w, r)
+
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	if path.Ext(name) != ".html" {
+		h.handler.ServeHTTP(w, r)
+
+		return
+	}
+
+	data, err := fs.ReadFile(h.fsys, name)
+	if err != nil {
+		// Let the file server respond with the appropriate error.
+		h.handler.ServeHTTP(w, r)
+
+		return
+	}
+
+	data = bytes.ReplaceAll(data, []byte("<script"), []byte(`<script nonce="`+nonce+`"`))
+
+	// The cached pages would contain the stale nonces, so don't let the
+	// browser cache them.
+	respHdr := w.Header()
+	respHdr.Set(httphdr.ContentType, "text/html; charset=utf-8")
+	respHdr.Set(httphdr.CacheControl, "no-store")
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Debug("web: writing html page %q: %s", name, err)
+	}
+}
@@ -0,0 +1,162 @@
+package home
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSecurityHeaders(t *testing.T) {
+	testCases := []struct {
+		conf       *securityHeadersConfig
+		want       *securityHeaders
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &securityHeadersConfig{
+			Enabled: false,
+		},
+		want:       nil,
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &securityHeadersConfig{
+			HSTSMaxAge: timeutil.Duration{Duration: timeutil.Day},
+			Enabled:    true,
+		},
+		want: &securityHeaders{
+			csp:          defaultContentSecurityPolicy + "; frame-ancestors 'self'",
+			hsts:         "max-age=86400",
+			frameOptions: "SAMEORIGIN",
+		},
+		name:       "default",
+		wantErrMsg: "",
+	}, {
+		conf: &securityHeadersConfig{
+			FrameAncestors:        []string{"'none'"},
+			HSTSMaxAge:            timeutil.Duration{Duration: timeutil.Day},
+			HSTSIncludeSubdomains: true,
+			Enabled:               true,
+		},
+		want: &securityHeaders{
+			csp:          defaultContentSecurityPolicy + "; frame-ancestors 'none'",
+			hsts:         "max-age=86400; includeSubDomains",
+			frameOptions: "DENY",
+		},
+		name:       "strict",
+		wantErrMsg: "",
+	}, {
+		conf: &securityHeadersConfig{
+			ContentSecurityPolicy: "default-src 'self'",
+			FrameAncestors:        []string{"'self'", "https://home.example"},
+			Enabled:               true,
+		},
+		want: &securityHeaders{
+			csp:          "default-src 'self'; frame-ancestors 'self' https://home.example",
+			hsts:         "",
+			frameOptions: "",
+		},
+		name:       "embedding",
+		wantErrMsg: "",
+	}, {
+		conf: &securityHeadersConfig{
+			FrameAncestors: []string{"https://a.example; script-src *"},
+			Enabled:        true,
+		},
+		want:       nil,
+		name:       "bad_frame_ancestor",
+		wantErrMsg: `frame_ancestors: at index 0: bad source "https://a.example; script-src *"`,
+	}, {
+		conf: &securityHeadersConfig{
+			HSTSMaxAge: timeutil.Duration{Duration: -time.Second},
+			Enabled:    true,
+		},
+		want:       nil,
+		name:       "bad_hsts_max_age",
+		wantErrMsg: "hsts_max_age: negative value -1s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := newSecurityHeaders(tc.conf)
+			if tc.wantErrMsg == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantErrMsg)
+			}
+
+			assert.Equal(t, tc.want, h)
+		})
+	}
+}
+
+func TestSecurityHeaders_wrap(t *testing.T) {
+	sh, err := newSecurityHeaders(&securityHeadersConfig{
+		HSTSMaxAge: timeutil.Duration{Duration: timeutil.Day},
+		Enabled:    true,
+	})
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{
+		"index.html": &fstest.MapFile{
+			Data: []byte(`<html><script>init()</script><script src="main.js"></script></html>`),
+		},
+		"main.js": &fstest.MapFile{
+			Data: []byte(`console.log("<script")`),
+		},
+	}
+
+	h := sh.wrap(&htmlNonceHandler{
+		handler: http.FileServer(http.FS(fsys)),
+		fsys:    fsys,
+	})
+
+	nonceRe := regexp.MustCompile(`'nonce-([^']+)'`)
+
+	t.Run("html", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{}
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		hdr := w.Header()
+		assert.Equal(t, "SAMEORIGIN", hdr.Get(aghhttp.HdrNameXFrameOptions))
+		assert.Equal(t, aghhttp.HdrValNoSniff, hdr.Get(httphdr.XContentTypeOptions))
+		assert.Equal(t, "max-age=86400", hdr.Get(httphdr.StrictTransportSecurity))
+		assert.Equal(t, "no-store", hdr.Get(httphdr.CacheControl))
+
+		m := nonceRe.FindStringSubmatch(hdr.Get(httphdr.ContentSecurityPolicy))
+		require.Len(t, m, 2)
+
+		nonce := m[1]
+		assert.Equal(
+			t,
+			`<html><script nonce="`+nonce+`">init()</script>`+
+				`<script nonce="`+nonce+`" src="main.js"></script></html>`,
+			w.Body.String(),
+		)
+	})
+
+	t.Run("other", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/main.js", nil)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Empty(t, w.Header().Get(httphdr.StrictTransportSecurity))
+		assert.Equal(t, `console.log("<script")`, w.Body.String())
+	})
+}
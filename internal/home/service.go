@@ -226,6 +226,7 @@ func handleServiceControlAction(
 
 	runOpts := opts
 	runOpts.serviceControlAction = "run"
+	runOpts.systemResolver = false
 
 	args := optsToArgs(runOpts)
 	log.Debug("service: using args %q", args)
@@ -278,8 +279,19 @@ func handleServiceCommand(s service.Service, action string, opts options) (err e
 		initConfigFilename(opts)
 
 		handleServiceInstallCommand(s)
+
+		if opts.systemResolver {
+			setSystemResolver()
+		}
 	case "uninstall":
 		handleServiceUninstallCommand(s)
+
+		if err = initWorkingDir(opts); err != nil {
+			return fmt.Errorf("failed to init working dir: %w", err)
+		}
+
+		restoreSystemResolver()
+		newDNSPortManager().revert()
 	default:
 		if err = svcAction(s, action); err != nil {
 			return fmt.Errorf("executing action %q: %w", action, err)
@@ -323,6 +335,12 @@ func handleServiceInstallCommand(s service.Service) {
 		}
 	}
 
+	// On FreeBSD the rc.d script only runs if its rc.conf variable is set.
+	err = aghos.EnableService(serviceName)
+	if err != nil {
+		log.Fatalf("service: enabling: %s", err)
+	}
+
 	// Start automatically after install.
 	err = svcAction(s, "start")
 	if err != nil {
@@ -359,6 +377,14 @@ func handleServiceUninstallCommand(s service.Service) {
 		log.Fatalf("service: executing action %q: %s", "uninstall", err)
 	}
 
+	if err := aghos.DisableService(serviceName); err != nil {
+		log.Info("service: warning: disabling: %s", err)
+	}
+
+	if err := aghos.RemoveFirewallRules(firewallRuleGroup); err != nil {
+		log.Info("service: warning: removing firewall rules: %s", err)
+	}
+
 	if runtime.GOOS == "darwin" {
 		// Remove log files on cleanup and log errors.
 		err := os.Remove(launchdStdoutPath)
@@ -384,6 +410,8 @@ func configureService(c *service.Config) {
 	c.Option["LaunchdConfig"] = launchdConfig
 	// This key is used to start the job as soon as it has been loaded. For daemons this means execution at boot time, for agents execution at login.
 	c.Option["RunAtLoad"] = true
+	// Restart the job if it exits with an error or crashes.
+	c.Option["KeepAlive"] = true
 
 	// POSIX / systemd
 
@@ -423,9 +451,19 @@ func runInitdCommand(action string) (int, error) {
 	return code, err
 }
 
-// Basically the same template as the one defined in github.com/kardianos/service
-// but with two additional keys - StandardOutPath and StandardErrorPath
-var launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
+// launchdConfig is the source of the launchd property list for macOS.  It's
+// based on the template from the darwinLaunchdConfig constant in file
+// service_darwin.go in module github.com/kardianos/service.  The following
+// changes have been made:
+//
+//  1. The StandardOutPath and StandardErrorPath keys are added to redirect the
+//     output to the log files.
+//
+//  2. The KeepAlive key restarts the service only if it exits with an error or
+//     crashes, so that it's not restarted after a normal shutdown, and
+//     ThrottleInterval is set to the same value as the RestartSec setting of
+//     the systemd unit.
+const launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
 <!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN"
 "http://www.apple.com/DTDs/PropertyList-1.0.dtd" >
 <plist version='1.0'>
@@ -442,7 +480,13 @@ var launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
 {{if .ChRoot}}<key>RootDirectory</key><string>{{html .ChRoot}}</string>{{end}}
 {{if .WorkingDirectory}}<key>WorkingDirectory</key><string>{{html .WorkingDirectory}}</string>{{end}}
 <key>SessionCreate</key><{{bool .SessionCreate}}/>
-<key>KeepAlive</key><{{bool .KeepAlive}}/>
+{{if .KeepAlive}}<key>KeepAlive</key>
+<dict>
+        <key>SuccessfulExit</key><false/>
+</dict>
+<key>ThrottleInterval</key><integer>10</integer>
+{{else}}<key>KeepAlive</key><false/>
+{{end}}
 <key>RunAtLoad</key><{{bool .RunAtLoad}}/>
 <key>Disabled</key><false/>
 <key>StandardOutPath</key>
@@ -649,16 +693,27 @@ status() {
 
 // freeBSDScript is the source of the daemon script for FreeBSD.  Keep as close
 // as possible to the https://github.com/kardianos/service/blob/18c957a3dc1120a2efe77beb401d476bade9e577/service_freebsd.go#L204.
+//
+// The service is enabled with the {{.Name}}_enable rc.conf(5) variable, which
+// is set on installation.  The user may be changed with {{.Name}}_user.
 const freeBSDScript = `#!/bin/sh
 # PROVIDE: {{.Name}}
-# REQUIRE: networking
+# REQUIRE: DAEMON NETWORKING
+# BEFORE: LOGIN
 # KEYWORD: shutdown
 
 . /etc/rc.subr
 
 name="{{.Name}}"
+rcvar="${name}_enable"
+desc="{{.Description}}"
+
+load_rc_config "$name"
+
+: ${ {{- .Name}}_enable:="NO"}
+: ${ {{- .Name}}_user:="root"}
+
 {{.Name}}_env="IS_DAEMON=1"
-{{.Name}}_user="root"
 pidfile_child="/var/run/${name}.pid"
 pidfile="/var/run/${name}_daemon.pid"
 command="/usr/sbin/daemon"
@@ -0,0 +1,120 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
+)
+
+// systemResolverBackupFile is the name of the file in the working directory
+// containing the DNS servers of the system resolver saved before pointing it at
+// AdGuard Home.
+const systemResolverBackupFile = "system_resolver_backup.json"
+
+// systemResolverBackupPath returns the path to the backup of the system
+// resolver settings.
+func systemResolverBackupPath() (p string) {
+	return filepath.Join(Context.workDir, systemResolverBackupFile)
+}
+
+// setSystemResolver points the system resolver at the DNS server on the
+// loopback address and saves the previous settings to restore them on
+// uninstallation.  AdGuard Home must serve plain DNS on 127.0.0.1:53 for that.
+func setSystemResolver() {
+	if detectFirstRun() {
+		log.Info(
+			"service: warning: not changing the system resolver before the initial setup; " +
+				"reinstall the service with --system-resolver after finishing it",
+		)
+
+		return
+	}
+
+	backupPath := systemResolverBackupPath()
+
+	// Don't overwrite the existing backup with the servers set previously by
+	// AdGuard Home itself.
+	_, err := os.Stat(backupPath)
+	hasBackup := err == nil
+
+	prev, err := aghos.SetSystemResolvers([]netip.Addr{netip.AddrFrom4([4]byte{127, 0, 0, 1})})
+	if err != nil {
+		log.Error("service: setting system resolver: %s", err)
+
+		return
+	}
+
+	log.Printf("service: pointed the system resolver at AdGuard Home")
+
+	if hasBackup {
+		return
+	}
+
+	err = writeSystemResolverBackup(backupPath, prev)
+	if err != nil {
+		log.Error("service: saving system resolver settings: %s", err)
+	}
+}
+
+// writeSystemResolverBackup writes prev to the file at p.
+func writeSystemResolverBackup(p string, prev aghos.SystemResolvers) (err error) {
+	b, err := json.Marshal(prev)
+	if err != nil {
+		// Shouldn't happen, since prev is always serializable.
+		panic(err)
+	}
+
+	return maybe.WriteFile(p, b, aghos.DefaultPermFile)
+}
+
+// restoreSystemResolver restores the settings of the system resolver saved by
+// [setSystemResolver], if any.
+func restoreSystemResolver() {
+	backupPath := systemResolverBackupPath()
+	prev, err := readSystemResolverBackup(backupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Error("service: reading system resolver settings: %s", err)
+
+		return
+	}
+
+	err = aghos.RestoreSystemResolvers(prev)
+	if err != nil {
+		log.Error("service: restoring system resolver: %s", err)
+
+		return
+	}
+
+	log.Printf("service: restored the system resolver settings")
+
+	err = os.Remove(backupPath)
+	if err != nil {
+		log.Info("service: warning: removing system resolver backup: %s", err)
+	}
+}
+
+// readSystemResolverBackup reads the backup of the system resolver settings
+// from the file at p.
+func readSystemResolverBackup(p string) (prev aghos.SystemResolvers, err error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		// Don't wrap the error, since it's checked by the caller.
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &prev)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %q: %w", p, err)
+	}
+
+	return prev, nil
+}
@@ -0,0 +1,29 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemResolverBackup(t *testing.T) {
+	p := filepath.Join(t.TempDir(), systemResolverBackupFile)
+
+	_, err := readSystemResolverBackup(p)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	prev := aghos.SystemResolvers{
+		"Wi-Fi":               {"192.0.2.1", "2001:db8::1"},
+		"USB 10/100/1000 LAN": nil,
+	}
+	require.NoError(t, writeSystemResolverBackup(p, prev))
+
+	got, err := readSystemResolverBackup(p)
+	require.NoError(t, err)
+
+	assert.Equal(t, prev, got)
+}
@@ -0,0 +1,93 @@
+package home
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// timeoutsConfig is the configuration of the deadlines of the requests to the
+// external services AdGuard Home depends on.  The zero values are replaced
+// with the defaults on load.
+type timeoutsConfig struct {
+	// Upstream is the timeout of a single exchange with an upstream DNS
+	// server.
+	Upstream timeutil.Duration `yaml:"upstream"`
+
+	// FilterDownload is the timeout of downloading a filtering-rule list,
+	// including reading its contents.
+	FilterDownload timeutil.Duration `yaml:"filter_download"`
+
+	// SafeBrowsing is the timeout of a single lookup of the safe browsing and
+	// parental control services.
+	SafeBrowsing timeutil.Duration `yaml:"safe_browsing"`
+
+	// WHOIS is the timeout of a single WHOIS request about a client.
+	WHOIS timeutil.Duration `yaml:"whois"`
+
+	// RDNS is the timeout of a single exchange with a private reverse DNS
+	// resolver.
+	RDNS timeutil.Duration `yaml:"rdns"`
+}
+
+// Default timeouts of the requests to the external services.
+const (
+	defaultTimeoutUpstream       = dnsforward.DefaultTimeout
+	defaultTimeoutFilterDownload = 5 * time.Minute
+	defaultTimeoutSafeBrowsing   = 3 * time.Second
+	defaultTimeoutWHOIS          = 5 * time.Second
+	defaultTimeoutRDNS           = 1 * time.Second
+)
+
+// newDefaultTimeoutsConfig returns the timeouts configuration with the default
+// values.
+func newDefaultTimeoutsConfig() (c *timeoutsConfig) {
+	return &timeoutsConfig{
+		Upstream:       timeutil.Duration{Duration: defaultTimeoutUpstream},
+		FilterDownload: timeutil.Duration{Duration: defaultTimeoutFilterDownload},
+		SafeBrowsing:   timeutil.Duration{Duration: defaultTimeoutSafeBrowsing},
+		WHOIS:          timeutil.Duration{Duration: defaultTimeoutWHOIS},
+		RDNS:           timeutil.Duration{Duration: defaultTimeoutRDNS},
+	}
+}
+
+// validate returns an error if any of the timeouts is negative and replaces
+// the zero ones with the defaults.  c must not be nil.
+func (c *timeoutsConfig) validate() (err error) {
+	for _, f := range []struct {
+		val  *timeutil.Duration
+		name string
+		def  time.Duration
+	}{{
+		val:  &c.Upstream,
+		name: "upstream",
+		def:  defaultTimeoutUpstream,
+	}, {
+		val:  &c.FilterDownload,
+		name: "filter_download",
+		def:  defaultTimeoutFilterDownload,
+	}, {
+		val:  &c.SafeBrowsing,
+		name: "safe_browsing",
+		def:  defaultTimeoutSafeBrowsing,
+	}, {
+		val:  &c.WHOIS,
+		name: "whois",
+		def:  defaultTimeoutWHOIS,
+	}, {
+		val:  &c.RDNS,
+		name: "rdns",
+		def:  defaultTimeoutRDNS,
+	}} {
+		switch {
+		case f.val.Duration < 0:
+			return fmt.Errorf("%s: negative value %s", f.name, f.val)
+		case f.val.Duration == 0:
+			f.val.Duration = f.def
+		}
+	}
+
+	return nil
+}
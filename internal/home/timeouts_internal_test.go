@@ -0,0 +1,55 @@
+package home
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutsConfig_validate(t *testing.T) {
+	testCases := []struct {
+		conf       *timeoutsConfig
+		want       *timeoutsConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &timeoutsConfig{},
+		want:       newDefaultTimeoutsConfig(),
+		name:       "empty",
+		wantErrMsg: "",
+	}, {
+		conf: &timeoutsConfig{
+			Upstream: timeutil.Duration{Duration: 2 * time.Second},
+			WHOIS:    timeutil.Duration{Duration: time.Minute},
+		},
+		want: &timeoutsConfig{
+			Upstream:       timeutil.Duration{Duration: 2 * time.Second},
+			FilterDownload: timeutil.Duration{Duration: defaultTimeoutFilterDownload},
+			SafeBrowsing:   timeutil.Duration{Duration: defaultTimeoutSafeBrowsing},
+			WHOIS:          timeutil.Duration{Duration: time.Minute},
+			RDNS:           timeutil.Duration{Duration: defaultTimeoutRDNS},
+		},
+		name:       "partial",
+		wantErrMsg: "",
+	}, {
+		conf: &timeoutsConfig{
+			RDNS: timeutil.Duration{Duration: -time.Second},
+		},
+		want:       nil,
+		name:       "negative",
+		wantErrMsg: "rdns: negative value -1s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.validate()
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.want != nil {
+				assert.Equal(t, tc.want, tc.conf)
+			}
+		})
+	}
+}
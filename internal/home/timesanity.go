@@ -0,0 +1,268 @@
+package home
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// timeSanityConfig is the configuration of checking the system clock, which is
+// often wrong on devices without a battery-backed clock, such as Raspberry Pi,
+// until an NTP client sets it after the boot.
+type timeSanityConfig struct {
+	// NTPServers are the addresses of the NTP servers the system clock is
+	// compared with, for example "pool.ntp.org".  The port defaults to 123.  If
+	// it's empty, which is the default, or none of them respond, the system
+	// clock is only compared with the build time.
+	NTPServers []string `yaml:"ntp_servers"`
+
+	// MaxSkew is the maximum difference between the system clock and the
+	// time of the NTP servers considered sane.
+	MaxSkew timeutil.Duration `yaml:"max_skew"`
+
+	// Enabled defines if the system clock is checked.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Intervals of checking the system clock.
+const (
+	timeCheckIvlInsane = 30 * time.Second
+	timeCheckIvlSane   = 1 * time.Hour
+)
+
+// ntpQueryTimeout is the timeout of a single NTP request.
+const ntpQueryTimeout = 5 * time.Second
+
+// minSaneTime is the earliest time considered sane when the build time is
+// unknown.
+var minSaneTime = time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+// timeChecker checks the system clock in the background, so that the features
+// depending on the validation of TLS certificates and time-bound data, such as
+// the updates of the filter lists, are postponed until the clock is set.
+type timeChecker struct {
+	// query returns the offset of the clock of the NTP server at addr.  It's
+	// [aghnet.QueryNTP] shadowed for tests.
+	query func(ctx context.Context, addr string) (offset time.Duration, err error)
+
+	// now returns the current time.  It's [time.Now] shadowed for tests.
+	now func() (t time.Time)
+
+	// mu protects state.
+	mu *sync.RWMutex
+
+	// state is the result of the last check.
+	state *timeState
+
+	// done is closed to stop the background checks.
+	done chan struct{}
+
+	// warned is true if the wrong clock has been reported.  It's only
+	// accessed in [timeChecker.check] under mu.
+	warned bool
+
+	// minTime is the earliest time considered sane.
+	minTime time.Time
+
+	servers []string
+	maxSkew time.Duration
+}
+
+// timeState is the result of checking the system clock.
+type timeState struct {
+	// checked is the time of the check.
+	checked time.Time
+
+	// source is the address of the NTP server the clock has been compared
+	// with.  It's empty if none of the servers have responded.
+	source string
+
+	// skew is the offset of the NTP server's clock relative to the system
+	// one.  It's only valid if source is not empty.
+	skew time.Duration
+
+	// sane is true if the system clock is considered correct.
+	sane bool
+}
+
+// newTimeChecker returns a new properly initialized *timeChecker or nil if the
+// checks are disabled.
+func newTimeChecker(conf *timeSanityConfig) (c *timeChecker) {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+
+	minTime := version.CommitTime()
+	if minTime.Before(minSaneTime) {
+		minTime = minSaneTime
+	}
+
+	c = &timeChecker{
+		query:   aghnet.QueryNTP,
+		now:     time.Now,
+		mu:      &sync.RWMutex{},
+		done:    make(chan struct{}),
+		minTime: minTime,
+		servers: conf.NTPServers,
+		maxSkew: conf.MaxSkew.Duration,
+	}
+
+	// Consider the clock sane unless it's obviously wrong until the first NTP
+	// check finishes.
+	c.state = &timeState{
+		checked: c.now(),
+		sane:    !c.now().Before(minTime),
+	}
+
+	return c
+}
+
+// start starts checking the system clock in the background.
+func (c *timeChecker) start() {
+	go c.run()
+}
+
+// close stops the background checks.
+func (c *timeChecker) close() {
+	close(c.done)
+}
+
+// run checks the system clock periodically, more frequently while it's wrong.
+func (c *timeChecker) run() {
+	defer log.OnPanic("time sanity: checker")
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			// Go on.
+		case <-c.done:
+			return
+		}
+
+		ivl := timeCheckIvlSane
+		if !c.check(context.Background()) {
+			ivl = timeCheckIvlInsane
+		}
+
+		t.Reset(ivl)
+	}
+}
+
+// check compares the system clock with the NTP servers, updates the state, and
+// returns true if the clock is sane.
+func (c *timeChecker) check(ctx context.Context) (sane bool) {
+	st := &timeState{}
+	for _, srv := range c.servers {
+		offset, err := c.queryServer(ctx, srv)
+		if err != nil {
+			log.Debug("time sanity: querying %q: %s", srv, err)
+
+			continue
+		}
+
+		st.source, st.skew = srv, offset
+		st.sane = offset.Abs() <= c.maxSkew
+
+		break
+	}
+
+	st.checked = c.now()
+	if st.source == "" {
+		st.sane = !st.checked.Before(c.minTime)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = st
+
+	switch {
+	case !st.sane && !c.warned:
+		c.warned = true
+		log.Info(
+			"time sanity: warning: system clock is wrong, postponing filter updates, "+
+				"update checks, and certificate expiry checks; skew: %s, source: %q",
+			st.skew,
+			st.source,
+		)
+	case st.sane && c.warned:
+		c.warned = false
+		log.Info("time sanity: system clock is correct now")
+	}
+
+	return st.sane
+}
+
+// queryServer returns the clock offset of the NTP server at addr.
+func (c *timeChecker) queryServer(ctx context.Context, addr string) (offset time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, ntpQueryTimeout)
+	defer cancel()
+
+	return c.query(ctx, addr)
+}
+
+// status returns the result of the last check.
+func (c *timeChecker) status() (st timeState) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return *c.state
+}
+
+// isSane returns true if the system clock was correct on the last check.
+func (c *timeChecker) isSane() (ok bool) {
+	return c.status().sane
+}
+
+// clockSane returns true if the system clock is considered correct or if it
+// isn't checked.
+func clockSane() (ok bool) {
+	c := Context.timeChecker
+	if c == nil {
+		return true
+	}
+
+	return c.isSane()
+}
+
+// clockStatusJSON is the JSON structure for the state of the system clock.
+type clockStatusJSON struct {
+	// CheckedAt is the time of the last check.
+	CheckedAt time.Time `json:"checked_at"`
+
+	// NTPServer is the NTP server the clock was compared with, if any.
+	NTPServer string `json:"ntp_server,omitempty"`
+
+	// SkewMs is the offset of the NTP server's clock relative to the system
+	// one, in milliseconds.
+	SkewMs int64 `json:"skew_ms"`
+
+	// Sane is true if the system clock is considered correct.
+	Sane bool `json:"sane"`
+}
+
+// clockStatus returns the state of the system clock or nil if it isn't
+// checked.
+func clockStatus() (resp *clockStatusJSON) {
+	c := Context.timeChecker
+	if c == nil {
+		return nil
+	}
+
+	st := c.status()
+
+	return &clockStatusJSON{
+		CheckedAt: st.checked,
+		NTPServer: st.source,
+		SkewMs:    st.skew.Milliseconds(),
+		Sane:      st.sane,
+	}
+}
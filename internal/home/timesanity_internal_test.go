@@ -0,0 +1,104 @@
+package home
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimeChecker(t *testing.T) {
+	assert.Nil(t, newTimeChecker(nil))
+	assert.Nil(t, newTimeChecker(&timeSanityConfig{Enabled: false}))
+
+	c := newTimeChecker(&timeSanityConfig{
+		MaxSkew: timeutil.Duration{Duration: time.Minute},
+		Enabled: true,
+	})
+	require.NotNil(t, c)
+
+	assert.True(t, c.isSane())
+}
+
+func TestTimeChecker_check(t *testing.T) {
+	const (
+		srvBad  = "bad.example"
+		srvGood = "good.example"
+	)
+
+	minTime := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		now    time.Time
+		offset time.Duration
+	)
+
+	c := &timeChecker{
+		query: func(_ context.Context, addr string) (off time.Duration, err error) {
+			if addr == srvBad {
+				return 0, errors.Error("test error")
+			}
+
+			return offset, nil
+		},
+		now:     func() (t time.Time) { return now },
+		mu:      &sync.RWMutex{},
+		state:   &timeState{},
+		minTime: minTime,
+		servers: []string{srvBad, srvGood},
+		maxSkew: time.Minute,
+	}
+
+	testCases := []struct {
+		name       string
+		now        time.Time
+		servers    []string
+		offset     time.Duration
+		wantSource string
+		wantSane   bool
+	}{{
+		name:       "ntp_sane",
+		now:        minTime.Add(time.Hour),
+		servers:    []string{srvBad, srvGood},
+		offset:     -time.Second,
+		wantSource: srvGood,
+		wantSane:   true,
+	}, {
+		name:       "ntp_skew",
+		now:        minTime.Add(time.Hour),
+		servers:    []string{srvGood},
+		offset:     time.Hour,
+		wantSource: srvGood,
+		wantSane:   false,
+	}, {
+		name:       "no_ntp_before_min",
+		now:        time.Unix(0, 0),
+		servers:    []string{srvBad},
+		wantSource: "",
+		wantSane:   false,
+	}, {
+		name:       "no_ntp_after_min",
+		now:        minTime.Add(time.Hour),
+		servers:    nil,
+		wantSource: "",
+		wantSane:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now, offset, c.servers = tc.now, tc.offset, tc.servers
+
+			assert.Equal(t, tc.wantSane, c.check(context.Background()))
+
+			st := c.status()
+			assert.Equal(t, tc.wantSane, st.sane)
+			assert.Equal(t, tc.wantSource, st.source)
+			assert.Equal(t, tc.now, st.checked)
+		})
+	}
+}
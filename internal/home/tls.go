@@ -22,6 +22,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/google/go-cmp/cmp"
@@ -39,6 +40,12 @@ type tlsManager struct {
 	confLock sync.Mutex
 	conf     tlsConfigSettings
 
+	// expiry monitors the expiry of the configured certificates.
+	expiry *certExpiryMonitor
+
+	// done is the shutdown signaling channel.
+	done chan struct{}
+
 	// servePlainDNS defines if plain DNS is allowed for incoming requests.
 	servePlainDNS bool
 }
@@ -50,6 +57,8 @@ func newTLSManager(conf tlsConfigSettings, servePlainDNS bool) (m *tlsManager, e
 	m = &tlsManager{
 		status:        &tlsConfigStatus{},
 		conf:          conf,
+		expiry:        newCertExpiryMonitor(conf.ExpiryAlertDays),
+		done:          make(chan struct{}),
 		servePlainDNS: servePlainDNS,
 	}
 
@@ -74,6 +83,16 @@ func (m *tlsManager) load() (err error) {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
+	if m.conf.Web.isConfigured() {
+		var web *webTLSConfig
+		web, err = m.conf.Web.load()
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+
+		m.conf.Web = web
+	}
+
 	return nil
 }
 
@@ -105,6 +124,8 @@ func (m *tlsManager) setCertFileTime() {
 func (m *tlsManager) start() {
 	m.registerWebHandlers()
 
+	go m.monitorExpiry()
+
 	m.confLock.Lock()
 	tlsConf := m.conf
 	m.confLock.Unlock()
@@ -115,33 +136,44 @@ func (m *tlsManager) start() {
 	Context.web.tlsConfigChanged(context.Background(), tlsConf)
 }
 
+// close stops the background jobs of m.
+func (m *tlsManager) close() {
+	close(m.done)
+}
+
 // reload updates the configuration and restarts t.
 func (m *tlsManager) reload() {
 	m.confLock.Lock()
 	tlsConf := m.conf
 	m.confLock.Unlock()
 
-	if !tlsConf.Enabled || len(tlsConf.CertificatePath) == 0 {
+	if !tlsConf.Enabled {
 		return
 	}
 
-	fi, err := os.Stat(tlsConf.CertificatePath)
-	if err != nil {
-		log.Error("tls: %s", err)
+	var certLastMod time.Time
+	if tlsConf.CertificatePath != "" {
+		fi, err := os.Stat(tlsConf.CertificatePath)
+		if err != nil {
+			log.Error("tls: %s", err)
 
-		return
+			return
+		}
+
+		certLastMod = fi.ModTime().UTC()
 	}
 
-	if fi.ModTime().UTC().Equal(m.certLastMod) {
-		log.Debug("tls: certificate file isn't modified")
+	certModified := !certLastMod.Equal(m.certLastMod)
+	if !certModified && !tlsConf.Web.isModified() {
+		log.Debug("tls: certificate files aren't modified")
 
 		return
 	}
 
-	log.Debug("tls: certificate file is modified")
+	log.Debug("tls: certificate files are modified")
 
 	m.confLock.Lock()
-	err = m.load()
+	err := m.load()
 	m.confLock.Unlock()
 	if err != nil {
 		log.Error("tls: reloading: %s", err)
@@ -149,14 +181,27 @@ func (m *tlsManager) reload() {
 		return
 	}
 
-	m.certLastMod = fi.ModTime().UTC()
+	m.certLastMod = certLastMod
 
 	_ = reconfigureDNSServer()
 
 	m.confLock.Lock()
 	tlsConf = m.conf
+	subject, notAfter := m.status.Subject, m.status.NotAfter
 	m.confLock.Unlock()
 
+	if certModified {
+		publishEvent(&events.Event{
+			Data: map[string]string{
+				"subject":   subject,
+				"not_after": notAfter.Format(time.RFC3339),
+			},
+			Type:     events.TypeCertRenewed,
+			Message:  fmt.Sprintf("certificate %q reloaded, valid until %s", subject, notAfter),
+			Severity: events.SeverityInfo,
+		})
+	}
+
 	// The background context is used because the TLSConfigChanged wraps context
 	// with timeout on its own and shuts down the server, which handles current
 	// request.
@@ -285,6 +330,10 @@ type tlsConfigStatus struct {
 type tlsConfig struct {
 	*tlsConfigStatus     `json:",inline"`
 	tlsConfigSettingsExt `json:",inline"`
+
+	// Certificates is the expiry status of the configured certificates.  It's
+	// only set in the response of the status handler.
+	Certificates []*certExpiry `json:"certificates,omitempty"`
 }
 
 // tlsConfigSettingsExt is used to (un)marshal PrivateKeySaved field and
@@ -315,6 +364,8 @@ func (m *tlsManager) handleTLSStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	m.confLock.Unlock()
 
+	data.Certificates = m.checkExpiry()
+
 	marshalTLS(w, r, data)
 }
 
@@ -322,7 +373,7 @@ func (m *tlsManager) handleTLSStatus(w http.ResponseWriter, r *http.Request) {
 func (m *tlsManager) handleTLSValidate(w http.ResponseWriter, r *http.Request) {
 	setts, err := unmarshalTLS(r)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "Failed to unmarshal TLS config: %s", err)
+		writeError(r, w, http.StatusBadRequest, "Failed to unmarshal TLS config: %s", err)
 
 		return
 	}
@@ -332,7 +383,7 @@ func (m *tlsManager) handleTLSValidate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = validateTLSSettings(setts); err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -358,13 +409,16 @@ func (m *tlsManager) setConfig(
 	m.confLock.Lock()
 	defer m.confLock.Unlock()
 
-	// Reset the DNSCrypt data before comparing, since we currently do not
-	// accept these from the frontend.
+	// Reset the DNSCrypt data, the web interface certificate, and the expiry
+	// alert thresholds before comparing, since we currently do not accept
+	// these from the frontend.
 	//
 	// TODO(a.garipov): Define a custom comparer for dnsforward.TLSConfig.
 	newConf.DNSCryptConfigFile = m.conf.DNSCryptConfigFile
 	newConf.PortDNSCrypt = m.conf.PortDNSCrypt
-	if !cmp.Equal(m.conf, newConf, cmp.AllowUnexported(dnsforward.TLSConfig{})) {
+	newConf.Web = m.conf.Web
+	newConf.ExpiryAlertDays = m.conf.ExpiryAlertDays
+	if !cmp.Equal(m.conf, newConf, cmp.AllowUnexported(dnsforward.TLSConfig{}, webTLSConfig{})) {
 		log.Info("tls config has changed, restarting https server")
 		restartHTTPS = true
 	} else {
@@ -398,7 +452,7 @@ func (m *tlsManager) setConfig(
 func (m *tlsManager) handleTLSConfigure(w http.ResponseWriter, r *http.Request) {
 	req, err := unmarshalTLS(r)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "Failed to unmarshal TLS config: %s", err)
+		writeError(r, w, http.StatusBadRequest, "Failed to unmarshal TLS config: %s", err)
 
 		return
 	}
@@ -407,8 +461,12 @@ func (m *tlsManager) handleTLSConfigure(w http.ResponseWriter, r *http.Request)
 		req.PrivateKey = m.conf.PrivateKey
 	}
 
+	// The certificate of the web interface is only set in the configuration
+	// file.
+	req.Web = m.conf.Web
+
 	if err = validateTLSSettings(req); err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+		writeError(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -442,7 +500,7 @@ func (m *tlsManager) handleTLSConfigure(w http.ResponseWriter, r *http.Request)
 
 	err = reconfigureDNSServer()
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+		writeError(r, w, http.StatusInternalServerError, "%s", err)
 
 		return
 	}
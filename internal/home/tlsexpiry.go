@@ -0,0 +1,287 @@
+package home
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// certExpiryCheckIvl is the interval between the checks of the expiry of the
+// configured certificates.
+const certExpiryCheckIvl = 1 * time.Hour
+
+// Names of the certificates reported by the expiry monitor.
+const (
+	certNameEncryption = "encryption"
+	certNameWeb        = "web"
+)
+
+// certExpiry is the expiry status of a configured certificate.
+type certExpiry struct {
+	// NotAfter is the expiration time of the certificate.
+	NotAfter time.Time `json:"not_after"`
+
+	// Name is the name of the certificate, either [certNameEncryption] or
+	// [certNameWeb].
+	Name string `json:"name"`
+
+	// Subject is the subject of the certificate.
+	Subject string `json:"subject"`
+
+	// DaysToExpiry is the number of whole days left until the expiration.
+	// It's negative if the certificate has expired.
+	DaysToExpiry int64 `json:"days_to_expiry"`
+
+	// AlertThreshold is the smallest configured threshold in days reached by
+	// the certificate, or zero if none is reached.
+	AlertThreshold uint `json:"alert_threshold_days,omitempty"`
+
+	// Expired is true if the certificate has expired.
+	Expired bool `json:"expired"`
+}
+
+// certAlertState is the state of the alerts about a certificate.
+type certAlertState struct {
+	// notAfter is the expiration time of the certificate, which identifies the
+	// certificate being monitored.
+	notAfter time.Time
+
+	// threshold is the last threshold alerted about.
+	threshold uint
+
+	// expired is true if the expiry has been alerted about.
+	expired bool
+}
+
+// certExpiryMonitor tracks the expiry of the configured certificates and emits
+// warnings once they reach the thresholds.  It's safe for concurrent use.
+type certExpiryMonitor struct {
+	// mu protects states.
+	mu *sync.Mutex
+
+	// publish publishes the events about the reached thresholds.
+	publish func(e *events.Event)
+
+	// states maps the names of the certificates to the states of their
+	// alerts.
+	states map[string]*certAlertState
+
+	// thresholds are the alert thresholds in days, sorted in descending
+	// order.
+	thresholds []uint
+}
+
+// newCertExpiryMonitor returns a new properly initialized *certExpiryMonitor.
+// thresholdDays are the thresholds in days, zero values are ignored.
+func newCertExpiryMonitor(thresholdDays []uint) (mon *certExpiryMonitor) {
+	thresholds := slices.DeleteFunc(slices.Clone(thresholdDays), func(d uint) (ok bool) {
+		return d == 0
+	})
+	slices.Sort(thresholds)
+	thresholds = slices.Compact(thresholds)
+	slices.Reverse(thresholds)
+
+	return &certExpiryMonitor{
+		mu:         &sync.Mutex{},
+		publish:    publishEvent,
+		states:     map[string]*certAlertState{},
+		thresholds: thresholds,
+	}
+}
+
+// check returns the expiry status of the certificates and emits the warnings
+// about the newly reached thresholds.  certs maps the names of the
+// certificates to their PEM-encoded chains.  The certificates missing from
+// certs are no longer tracked.
+func (mon *certExpiryMonitor) check(now time.Time, certs map[string][]byte) (res []*certExpiry) {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	for name := range mon.states {
+		if _, ok := certs[name]; !ok {
+			delete(mon.states, name)
+		}
+	}
+
+	for _, name := range []string{certNameEncryption, certNameWeb} {
+		chain, ok := certs[name]
+		if !ok {
+			continue
+		}
+
+		cert, err := leafCertificate(chain)
+		if err != nil {
+			log.Debug("tls: checking expiry of %s certificate: %s", name, err)
+
+			continue
+		}
+
+		exp := mon.expiry(name, cert, now)
+		mon.alert(exp)
+		res = append(res, exp)
+	}
+
+	return res
+}
+
+// expiry returns the expiry status of cert at now.
+func (mon *certExpiryMonitor) expiry(
+	name string,
+	cert *x509.Certificate,
+	now time.Time,
+) (exp *certExpiry) {
+	left := cert.NotAfter.Sub(now)
+	days := int64(left / timeutil.Day)
+	if left < 0 && left%timeutil.Day != 0 {
+		days--
+	}
+
+	exp = &certExpiry{
+		NotAfter:     cert.NotAfter.UTC(),
+		Name:         name,
+		Subject:      cert.Subject.String(),
+		DaysToExpiry: days,
+		Expired:      left <= 0,
+	}
+
+	for _, t := range mon.thresholds {
+		if days < int64(t) {
+			exp.AlertThreshold = t
+		}
+	}
+
+	return exp
+}
+
+// alert emits the warnings and publishes the events about exp, if it reached a
+// threshold or expired since the last check.  mon.mu must be locked.
+func (mon *certExpiryMonitor) alert(exp *certExpiry) {
+	st := mon.states[exp.Name]
+	if st == nil || !st.notAfter.Equal(exp.NotAfter) {
+		// The certificate is new or has been renewed.
+		st = &certAlertState{
+			notAfter: exp.NotAfter,
+		}
+		mon.states[exp.Name] = st
+	}
+
+	var msg string
+	sev := events.SeverityWarning
+	if exp.Expired {
+		if st.expired {
+			return
+		}
+
+		st.expired = true
+		msg = fmt.Sprintf("%s certificate %q has expired on %s", exp.Name, exp.Subject, exp.NotAfter)
+		sev = events.SeverityError
+		log.Error("tls: %s", msg)
+	} else {
+		if exp.AlertThreshold == 0 || (st.threshold != 0 && st.threshold <= exp.AlertThreshold) {
+			return
+		}
+
+		st.threshold = exp.AlertThreshold
+		msg = fmt.Sprintf(
+			"%s certificate %q expires in %d days on %s, threshold is %d days",
+			exp.Name,
+			exp.Subject,
+			exp.DaysToExpiry,
+			exp.NotAfter,
+			exp.AlertThreshold,
+		)
+		log.Info("tls: warning: %s", msg)
+	}
+
+	mon.publish(&events.Event{
+		Data: map[string]string{
+			"name":           exp.Name,
+			"subject":        exp.Subject,
+			"not_after":      exp.NotAfter.Format(time.RFC3339),
+			"days_to_expiry": strconv.FormatInt(exp.DaysToExpiry, 10),
+		},
+		Type:     events.TypeCertExpiring,
+		Message:  msg,
+		Severity: sev,
+	})
+}
+
+// leafCertificate parses the first certificate of the PEM-encoded chain.
+func leafCertificate(chain []byte) (cert *x509.Certificate, err error) {
+	for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate: %w", err)
+		}
+
+		return cert, nil
+	}
+
+	return nil, errors.Error("empty certificate")
+}
+
+// expiryCerts returns the PEM-encoded chains of the configured certificates
+// for [certExpiryMonitor.check].
+func (m *tlsManager) expiryCerts() (certs map[string][]byte) {
+	m.confLock.Lock()
+	defer m.confLock.Unlock()
+
+	certs = map[string][]byte{}
+	if !m.conf.Enabled {
+		return certs
+	}
+
+	if len(m.conf.CertificateChainData) != 0 {
+		certs[certNameEncryption] = m.conf.CertificateChainData
+	}
+
+	if m.conf.Web.isConfigured() && len(m.conf.Web.certificateChainData) != 0 {
+		certs[certNameWeb] = m.conf.Web.certificateChainData
+	}
+
+	return certs
+}
+
+// checkExpiry checks the expiry of the configured certificates and returns
+// their statuses.
+func (m *tlsManager) checkExpiry() (res []*certExpiry) {
+	return m.expiry.check(time.Now(), m.expiryCerts())
+}
+
+// monitorExpiry checks the expiry of the configured certificates right away and
+// then once in [certExpiryCheckIvl] until m is closed.  It is intended to be
+// used as a goroutine.
+func (m *tlsManager) monitorExpiry() {
+	defer log.OnPanic("tls: expiry monitor")
+
+	t := time.NewTicker(certExpiryCheckIvl)
+	defer t.Stop()
+
+	for {
+		// The expiry can't be told with a wrong system clock.  The alerts are
+		// also deferred during the maintenance.
+		if clockSane() && !maintenanceActive() {
+			_ = m.checkExpiry()
+		}
+
+		select {
+		case <-t.C:
+			// Go on.
+		case <-m.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package home
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertPEM returns a PEM-encoded self-signed certificate expiring at
+// notAfter.
+func newTestCertPEM(t *testing.T, notAfter time.Time) (data []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "dns.example",
+		},
+		NotBefore: notAfter.Add(-365 * timeutil.Day),
+		NotAfter:  notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNewCertExpiryMonitor(t *testing.T) {
+	mon := newCertExpiryMonitor([]uint{7, 0, 30, 7, 1})
+
+	assert.Equal(t, []uint{30, 7, 1}, mon.thresholds)
+}
+
+func TestCertExpiryMonitor_check(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := now.Add(40 * timeutil.Day)
+
+	var published []*events.Event
+	mon := newCertExpiryMonitor([]uint{30, 7, 1})
+	mon.publish = func(e *events.Event) { published = append(published, e) }
+
+	certs := map[string][]byte{
+		certNameEncryption: newTestCertPEM(t, notAfter),
+		certNameWeb:        []byte("bad cert"),
+	}
+
+	testCases := []struct {
+		name          string
+		now           time.Time
+		wantSeverity  events.Severity
+		wantDays      int64
+		wantThreshold uint
+		wantAlerted   uint
+		wantExpired   bool
+	}{{
+		name:          "valid",
+		now:           now,
+		wantSeverity:  0,
+		wantDays:      40,
+		wantThreshold: 0,
+		wantAlerted:   0,
+		wantExpired:   false,
+	}, {
+		name:          "first_threshold",
+		now:           now.Add(15 * timeutil.Day),
+		wantSeverity:  events.SeverityWarning,
+		wantDays:      25,
+		wantThreshold: 30,
+		wantAlerted:   30,
+		wantExpired:   false,
+	}, {
+		name:          "second_threshold",
+		now:           now.Add(35 * timeutil.Day),
+		wantSeverity:  events.SeverityWarning,
+		wantDays:      5,
+		wantThreshold: 7,
+		wantAlerted:   7,
+		wantExpired:   false,
+	}, {
+		name:          "expired",
+		now:           now.Add(40*timeutil.Day + time.Hour),
+		wantSeverity:  events.SeverityError,
+		wantDays:      -1,
+		wantThreshold: 1,
+		wantAlerted:   7,
+		wantExpired:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			published = nil
+			res := mon.check(tc.now, certs)
+			require.Len(t, res, 1)
+
+			exp := res[0]
+			assert.Equal(t, certNameEncryption, exp.Name)
+			assert.Equal(t, "CN=dns.example", exp.Subject)
+			assert.Equal(t, notAfter, exp.NotAfter)
+			assert.Equal(t, tc.wantDays, exp.DaysToExpiry)
+			assert.Equal(t, tc.wantThreshold, exp.AlertThreshold)
+			assert.Equal(t, tc.wantExpired, exp.Expired)
+
+			st := mon.states[certNameEncryption]
+			require.NotNil(t, st)
+
+			assert.Equal(t, tc.wantAlerted, st.threshold)
+			assert.Equal(t, tc.wantExpired, st.expired)
+
+			if tc.wantSeverity == 0 {
+				assert.Empty(t, published)
+
+				return
+			}
+
+			require.Len(t, published, 1)
+
+			e := published[0]
+			assert.Equal(t, events.TypeCertExpiring, e.Type)
+			assert.Equal(t, tc.wantSeverity, e.Severity)
+			assert.Equal(t, certNameEncryption, e.Data["name"])
+			assert.Equal(t, strconv.FormatInt(tc.wantDays, 10), e.Data["days_to_expiry"])
+		})
+	}
+
+	t.Run("repeated", func(t *testing.T) {
+		published = nil
+		_ = mon.check(now.Add(40*timeutil.Day+2*time.Hour), certs)
+
+		assert.Empty(t, published)
+	})
+
+	t.Run("renewed", func(t *testing.T) {
+		renewed := map[string][]byte{
+			certNameEncryption: newTestCertPEM(t, notAfter.Add(90*timeutil.Day)),
+		}
+
+		res := mon.check(notAfter, renewed)
+		require.Len(t, res, 1)
+
+		st := mon.states[certNameEncryption]
+		require.NotNil(t, st)
+
+		assert.Zero(t, st.threshold)
+		assert.False(t, st.expired)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		assert.Empty(t, mon.check(now, map[string][]byte{}))
+		assert.Empty(t, mon.states)
+	})
+}
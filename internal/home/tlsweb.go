@@ -0,0 +1,182 @@
+package home
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// webTLSConfig is the configuration of the separate certificate of the HTTPS
+// server of the web interface.  It allows keeping the web interface on an
+// internal hostname while the encrypted DNS listeners use a public one.
+type webTLSConfig struct {
+	// ServerName is the hostname of the web interface.  If empty, the server
+	// name from the encryption settings is used.
+	ServerName string `yaml:"server_name"`
+
+	// CertificateChain is the PEM-encoded certificate chain.
+	CertificateChain string `yaml:"certificate_chain"`
+
+	// PrivateKey is the PEM-encoded private key.
+	PrivateKey string `yaml:"private_key"`
+
+	// CertificatePath is the path to the file with the PEM-encoded
+	// certificate chain.
+	CertificatePath string `yaml:"certificate_path"`
+
+	// PrivateKeyPath is the path to the file with the PEM-encoded private key.
+	PrivateKeyPath string `yaml:"private_key_path"`
+
+	// certLastMod is the last modification time of the certificate file.
+	certLastMod time.Time
+
+	// certificateChainData is the loaded certificate chain.
+	certificateChainData []byte
+
+	// privateKeyData is the loaded private key.
+	privateKeyData []byte
+}
+
+// isConfigured returns true if c contains a certificate.  c may be nil.
+func (c *webTLSConfig) isConfigured() (ok bool) {
+	return c != nil && (c.CertificateChain != "" || c.CertificatePath != "")
+}
+
+// load returns a copy of c with the certificate pair loaded and validated.  c
+// must be configured.
+func (c *webTLSConfig) load() (loaded *webTLSConfig, err error) {
+	conf := &tlsConfigSettings{
+		ServerName: c.ServerName,
+		TLSConfig: dnsforward.TLSConfig{
+			CertificateChain: c.CertificateChain,
+			PrivateKey:       c.PrivateKey,
+			CertificatePath:  c.CertificatePath,
+			PrivateKeyPath:   c.PrivateKeyPath,
+		},
+	}
+
+	err = loadTLSConf(conf, &tlsConfigStatus{})
+	if err != nil {
+		return nil, fmt.Errorf("web certificate: %w", err)
+	}
+
+	loaded = &webTLSConfig{}
+	*loaded = *c
+	loaded.certificateChainData = conf.CertificateChainData
+	loaded.privateKeyData = conf.PrivateKeyData
+
+	if c.CertificatePath != "" {
+		var fi os.FileInfo
+		fi, err = os.Stat(c.CertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("web certificate: %w", err)
+		}
+
+		loaded.certLastMod = fi.ModTime().UTC()
+	}
+
+	return loaded, nil
+}
+
+// isModified returns true if the certificate file of c has been modified since
+// it was loaded.  c may be nil.
+func (c *webTLSConfig) isModified() (ok bool) {
+	if !c.isConfigured() || c.CertificatePath == "" {
+		return false
+	}
+
+	fi, err := os.Stat(c.CertificatePath)
+	if err != nil {
+		log.Error("tls: looking up web certificate path: %s", err)
+
+		return false
+	}
+
+	return !fi.ModTime().UTC().Equal(c.certLastMod)
+}
+
+// webCertPair returns the certificate pair and the server name of the HTTPS
+// server of the web interface from conf.
+func webCertPair(conf *tlsConfigSettings) (certData, keyData []byte, srvName string) {
+	web := conf.Web
+	if !web.isConfigured() {
+		return conf.CertificateChainData, conf.PrivateKeyData, conf.ServerName
+	}
+
+	srvName = web.ServerName
+	if srvName == "" {
+		srvName = conf.ServerName
+	}
+
+	return web.certificateChainData, web.privateKeyData, srvName
+}
+
+// httpsCerts are the certificates of the HTTPS server, which serves both the
+// web interface and the DNS-over-HTTPS endpoints on the same port.
+type httpsCerts struct {
+	// dns is the certificate from the encryption settings.  It's nil if there
+	// is none.
+	dns *tls.Certificate
+
+	// web is the separate certificate of the web interface.  It's nil if
+	// there is none.
+	web *tls.Certificate
+
+	// webName is the server name of the web interface.
+	webName string
+}
+
+// newHTTPSCerts returns the certificates of the HTTPS server from conf.  certs
+// is nil if there are none.
+func newHTTPSCerts(conf *tlsConfigSettings) (certs *httpsCerts, err error) {
+	certs = &httpsCerts{}
+	if len(conf.CertificateChainData) != 0 && len(conf.PrivateKeyData) != 0 {
+		var cert tls.Certificate
+		cert, err = tls.X509KeyPair(conf.CertificateChainData, conf.PrivateKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("certificate: %w", err)
+		}
+
+		certs.dns = &cert
+	}
+
+	if web := conf.Web; web.isConfigured() && len(web.certificateChainData) != 0 {
+		var cert tls.Certificate
+		cert, err = tls.X509KeyPair(web.certificateChainData, web.privateKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("web certificate: %w", err)
+		}
+
+		certs.web = &cert
+		_, _, certs.webName = webCertPair(conf)
+	}
+
+	if certs.dns == nil && certs.web == nil {
+		return nil, nil
+	}
+
+	return certs, nil
+}
+
+// getCertificate is the [tls.Config.GetCertificate] function for the HTTPS
+// server.  It returns the certificate of the web interface for the connections
+// to its server name and the one from the encryption settings for the others,
+// including the DNS-over-HTTPS clients.
+func (c *httpsCerts) getCertificate(
+	hello *tls.ClientHelloInfo,
+) (cert *tls.Certificate, err error) {
+	if c.web == nil {
+		return c.dns, nil
+	}
+
+	if c.dns == nil || strings.EqualFold(strings.TrimSuffix(hello.ServerName, "."), c.webName) {
+		return c.web, nil
+	}
+
+	return c.dns, nil
+}
@@ -0,0 +1,221 @@
+package home
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebTLSConfig_load(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "web.crt")
+	keyPath := filepath.Join(dir, "web.key")
+
+	require.NoError(t, os.WriteFile(certPath, testCertChainData, 0o600))
+	require.NoError(t, os.WriteFile(keyPath, testPrivateKeyData, 0o600))
+
+	t.Run("files", func(t *testing.T) {
+		c := &webTLSConfig{
+			CertificatePath: certPath,
+			PrivateKeyPath:  keyPath,
+		}
+		require.True(t, c.isConfigured())
+
+		loaded, err := c.load()
+		require.NoError(t, err)
+
+		assert.Equal(t, testCertChainData, loaded.certificateChainData)
+		assert.Equal(t, testPrivateKeyData, loaded.privateKeyData)
+		assert.False(t, loaded.isModified())
+
+		modTime := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+
+		assert.True(t, loaded.isModified())
+	})
+
+	t.Run("bad_key", func(t *testing.T) {
+		c := &webTLSConfig{
+			CertificateChain: string(testCertChainData),
+			PrivateKey:       "bad key",
+		}
+
+		_, err := c.load()
+		assert.Error(t, err)
+	})
+
+	t.Run("not_configured", func(t *testing.T) {
+		var c *webTLSConfig
+		assert.False(t, c.isConfigured())
+		assert.False(t, c.isModified())
+	})
+}
+
+func TestWebCertPair(t *testing.T) {
+	conf := &tlsConfigSettings{
+		ServerName: "dns.example",
+		TLSConfig: dnsforward.TLSConfig{
+			CertificateChainData: []byte("dns cert"),
+			PrivateKeyData:       []byte("dns key"),
+		},
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		certData, keyData, srvName := webCertPair(conf)
+		assert.Equal(t, []byte("dns cert"), certData)
+		assert.Equal(t, []byte("dns key"), keyData)
+		assert.Equal(t, "dns.example", srvName)
+	})
+
+	t.Run("separate", func(t *testing.T) {
+		webConf := *conf
+		webConf.Web = &webTLSConfig{
+			ServerName:           "home.internal",
+			CertificateChain:     "web cert",
+			certificateChainData: []byte("web cert"),
+			privateKeyData:       []byte("web key"),
+		}
+
+		certData, keyData, srvName := webCertPair(&webConf)
+		assert.Equal(t, []byte("web cert"), certData)
+		assert.Equal(t, []byte("web key"), keyData)
+		assert.Equal(t, "home.internal", srvName)
+	})
+}
+
+// newTestCertPair returns a PEM-encoded self-signed certificate for name and its
+// private key.
+func newTestCertPair(t *testing.T, name string) (certData, keyData []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		DNSNames:  []string{name},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certData = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyData = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certData, keyData
+}
+
+func TestHTTPSCerts_getCertificate(t *testing.T) {
+	const (
+		dnsName = "dns.example"
+		webName = "home.internal"
+	)
+
+	dnsCert, dnsKey := newTestCertPair(t, dnsName)
+	webCert, webKey := newTestCertPair(t, webName)
+
+	conf := &tlsConfigSettings{
+		ServerName: dnsName,
+		TLSConfig: dnsforward.TLSConfig{
+			CertificateChainData: dnsCert,
+			PrivateKeyData:       dnsKey,
+		},
+		Web: &webTLSConfig{
+			ServerName:           webName,
+			CertificateChain:     string(webCert),
+			certificateChainData: webCert,
+			privateKeyData:       webKey,
+		},
+	}
+
+	certs, err := newHTTPSCerts(conf)
+	require.NoError(t, err)
+	require.NotNil(t, certs)
+
+	// certName returns the common name of the certificate chosen for the
+	// connection to srvName.
+	certName := func(t *testing.T, c *httpsCerts, srvName string) (name string) {
+		t.Helper()
+
+		cert, certErr := c.getCertificate(&tls.ClientHelloInfo{ServerName: srvName})
+		require.NoError(t, certErr)
+		require.NotNil(t, cert)
+
+		leaf, certErr := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, certErr)
+
+		return leaf.Subject.CommonName
+	}
+
+	testCases := []struct {
+		name    string
+		srvName string
+		want    string
+	}{{
+		name:    "web",
+		srvName: webName,
+		want:    webName,
+	}, {
+		name:    "web_case",
+		srvName: "Home.Internal.",
+		want:    webName,
+	}, {
+		name:    "doh",
+		srvName: dnsName,
+		want:    dnsName,
+	}, {
+		name:    "no_sni",
+		srvName: "",
+		want:    dnsName,
+	}, {
+		name:    "other",
+		srvName: "other.example",
+		want:    dnsName,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, certName(t, certs, tc.srvName))
+		})
+	}
+
+	t.Run("web_only", func(t *testing.T) {
+		webOnly := *conf
+		webOnly.CertificateChainData, webOnly.PrivateKeyData = nil, nil
+
+		c, cErr := newHTTPSCerts(&webOnly)
+		require.NoError(t, cErr)
+		require.NotNil(t, c)
+
+		assert.Equal(t, webName, certName(t, c, dnsName))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		c, cErr := newHTTPSCerts(&tlsConfigSettings{})
+		require.NoError(t, cErr)
+
+		assert.Nil(t, c)
+	})
+}
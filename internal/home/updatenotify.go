@@ -0,0 +1,217 @@
+package home
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// updateNotifyIvl is the interval between the checks for the available
+// updates.  The version information is cached by the updater, so the update
+// server is requested less often.
+const updateNotifyIvl = 1 * time.Hour
+
+// updateNotifyTimeout is the timeout of a single webhook request.
+const updateNotifyTimeout = 30 * time.Second
+
+// updateEventAvailable is the type of the event sent when a new version is
+// available.
+const updateEventAvailable = "update_available"
+
+// updateWebhookConfig is the configuration of the webhook notified about the
+// available updates, for example the HTTP API of a tool updating the container
+// images.
+type updateWebhookConfig struct {
+	// URL is the URL to send the events to with POST requests.
+	URL string `yaml:"url"`
+
+	// Enabled defines if the webhook is notified.
+	Enabled bool `yaml:"enabled"`
+}
+
+// updateEvent is the JSON body of a webhook request.
+type updateEvent struct {
+	// Event is the type of the event, currently always
+	// [updateEventAvailable].
+	Event string `json:"event"`
+
+	// CurrentVersion is the version of the running AdGuard Home.
+	CurrentVersion string `json:"current_version"`
+
+	// NewVersion is the available version.
+	NewVersion string `json:"new_version"`
+
+	// AnnouncementURL is the URL of the release notes of the available
+	// version.
+	AnnouncementURL string `json:"announcement_url,omitempty"`
+
+	// SelfUpdateDisabled is true if AdGuard Home doesn't replace its own
+	// executable, so the update must be performed externally.
+	SelfUpdateDisabled bool `json:"self_update_disabled"`
+}
+
+// updateNotifier periodically checks for the available updates and reports
+// each new version once by logging it and sending an event to the webhook.
+type updateNotifier struct {
+	client *http.Client
+	upd    *updater.Updater
+
+	// webhookURL is the URL of the webhook.  If it's empty, the new versions
+	// are only logged.
+	webhookURL string
+
+	// notified is the latest version reported about.  It's only accessed from
+	// the [updateNotifier.run] goroutine.
+	notified string
+
+	// noSelfUpdate is true if AdGuard Home doesn't replace its own executable.
+	noSelfUpdate bool
+}
+
+// newUpdateNotifier returns a new properly initialized *updateNotifier or nil
+// if there is nothing to notify, that is the self-update is allowed and the
+// webhook isn't configured.
+func newUpdateNotifier(
+	conf *updateWebhookConfig,
+	client *http.Client,
+	upd *updater.Updater,
+	noSelfUpdate bool,
+) (n *updateNotifier, err error) {
+	var webhookURL string
+	if conf != nil && conf.Enabled {
+		var u *url.URL
+		u, err = url.Parse(conf.URL)
+		if err != nil {
+			return nil, fmt.Errorf("update_webhook: url: %w", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("update_webhook: url: bad scheme %q", u.Scheme)
+		}
+
+		webhookURL = conf.URL
+	}
+
+	if webhookURL == "" && !noSelfUpdate {
+		return nil, nil
+	}
+
+	return &updateNotifier{
+		client:       client,
+		upd:          upd,
+		webhookURL:   webhookURL,
+		noSelfUpdate: noSelfUpdate,
+	}, nil
+}
+
+// run checks for the available updates right away and then once in
+// [updateNotifyIvl].  It is intended to be used as a goroutine.
+func (n *updateNotifier) run() {
+	defer log.OnPanic("updater: notifier")
+
+	t := time.NewTicker(updateNotifyIvl)
+	defer t.Stop()
+
+	for {
+		n.check(context.Background())
+
+		<-t.C
+	}
+}
+
+// check reports the available version once it's known and differs from the
+// ones reported before.  The failed webhook requests are retried on the next
+// check.
+func (n *updateNotifier) check(ctx context.Context) {
+	if !clockSane() {
+		log.Debug("updater: notifier: system clock is wrong, postponing check")
+
+		return
+	} else if maintenanceActive() {
+		log.Debug("updater: notifier: maintenance window is active, postponing check")
+
+		return
+	}
+
+	info, err := n.upd.VersionInfo(false)
+	if err != nil {
+		log.Debug("updater: notifier: getting version info: %s", err)
+
+		return
+	}
+
+	cur := version.Version()
+	if info.NewVersion == "" || info.NewVersion == cur || info.NewVersion == n.notified {
+		return
+	}
+
+	if n.noSelfUpdate {
+		log.Info(
+			"updater: version %s is available; self-update is disabled, update the image or the package",
+			info.NewVersion,
+		)
+	} else {
+		log.Info("updater: version %s is available", info.NewVersion)
+	}
+
+	if n.webhookURL != "" {
+		err = n.send(ctx, &updateEvent{
+			Event:              updateEventAvailable,
+			CurrentVersion:     cur,
+			NewVersion:         info.NewVersion,
+			AnnouncementURL:    info.AnnouncementURL,
+			SelfUpdateDisabled: n.noSelfUpdate,
+		})
+		if err != nil {
+			log.Error("updater: notifier: sending webhook: %s", err)
+
+			return
+		}
+	}
+
+	n.notified = info.NewVersion
+}
+
+// send sends the event to the webhook.
+func (n *updateNotifier) send(ctx context.Context, ev *updateEvent) (err error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		// Shouldn't happen, since ev is always serializable.
+		panic(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateNotifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set(httphdr.ContentType, aghhttp.HdrValApplicationJSON)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/updater"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateNotifier_check(t *testing.T) {
+	const newVersion = "v999.0.0"
+
+	versionSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"version":          newVersion,
+			"announcement":     "AdGuard Home " + newVersion + " is now available!",
+			"announcement_url": "https://example.com/release",
+			"download_" + runtime.GOOS + "_" + runtime.GOARCH: "https://example.com/pkg",
+		})
+	}))
+	t.Cleanup(versionSrv.Close)
+
+	var (
+		events     []*updateEvent
+		respStatus = http.StatusInternalServerError
+	)
+
+	webhookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		ev := &updateEvent{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(ev))
+
+		events = append(events, ev)
+		w.WriteHeader(respStatus)
+	}))
+	t.Cleanup(webhookSrv.Close)
+
+	upd := updater.NewUpdater(&updater.Config{
+		Client:          versionSrv.Client(),
+		Version:         version.Version(),
+		GOARCH:          runtime.GOARCH,
+		GOOS:            runtime.GOOS,
+		VersionCheckURL: versionSrv.URL,
+		NoSelfUpdate:    true,
+	})
+
+	n, err := newUpdateNotifier(&updateWebhookConfig{
+		URL:     webhookSrv.URL,
+		Enabled: true,
+	}, webhookSrv.Client(), upd, true)
+	require.NoError(t, err)
+	require.NotNil(t, n)
+
+	ctx := context.Background()
+
+	n.check(ctx)
+	require.Len(t, events, 1)
+
+	// The failed request is retried.
+	respStatus = http.StatusNoContent
+	n.check(ctx)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, &updateEvent{
+		Event:              updateEventAvailable,
+		CurrentVersion:     version.Version(),
+		NewVersion:         newVersion,
+		AnnouncementURL:    "https://example.com/release",
+		SelfUpdateDisabled: true,
+	}, events[1])
+
+	// The version is only reported once.
+	n.check(ctx)
+	assert.Len(t, events, 2)
+}
+
+func TestNewUpdateNotifier(t *testing.T) {
+	n, err := newUpdateNotifier(nil, nil, nil, false)
+	require.NoError(t, err)
+
+	assert.Nil(t, n)
+
+	n, err = newUpdateNotifier(&updateWebhookConfig{
+		URL:     "https://example.com/hook",
+		Enabled: false,
+	}, nil, nil, false)
+	require.NoError(t, err)
+
+	assert.Nil(t, n)
+
+	_, err = newUpdateNotifier(&updateWebhookConfig{
+		URL:     "ftp://example.com/hook",
+		Enabled: true,
+	}, nil, nil, false)
+	assert.Error(t, err)
+}
@@ -41,6 +41,14 @@ type webConfig struct {
 
 	clientFS fs.FS
 
+	// securityHeaders adds the security headers to the responses.  It's nil
+	// if the security headers are disabled.
+	securityHeaders *securityHeaders
+
+	// routes restricts the requests to the DNS-over-HTTPS endpoints and the
+	// web interface.  It's nil if no route is restricted.
+	routes *webRoutes
+
 	// BindAddr is the binding address with port for plain HTTP web interface.
 	BindAddr netip.AddrPort
 
@@ -61,6 +69,10 @@ type webConfig struct {
 	// disableUpdate, if true, tells AdGuard Home to not check for updates.
 	disableUpdate bool
 
+	// noSelfUpdate, if true, means that AdGuard Home doesn't replace its own
+	// executable, so the updates are only reported.
+	noSelfUpdate bool
+
 	// runningAsService flag is set to true when options are passed from the
 	// service runner.
 	runningAsService bool
@@ -77,9 +89,13 @@ type httpsServer struct {
 	server3 *http3.Server
 
 	// TODO(a.garipov): Why is there a *sync.Cond here?  Remove.
-	cond       *sync.Cond
-	condLock   sync.Mutex
-	cert       tls.Certificate
+	cond     *sync.Cond
+	condLock sync.Mutex
+
+	// certs are the certificates of the server.  It's not nil if the server
+	// is enabled.
+	certs *httpsCerts
+
 	inShutdown bool
 	enabled    bool
 }
@@ -109,7 +125,10 @@ func newWebAPI(conf *webConfig, l *slog.Logger) (w *webAPI) {
 		logger: l,
 	}
 
-	clientFS := http.FileServer(http.FS(conf.clientFS))
+	clientFS := &htmlNonceHandler{
+		handler: http.FileServer(http.FS(conf.clientFS)),
+		fsys:    conf.clientFS,
+	}
 
 	// if not configured, redirect / to /install.html, otherwise redirect /install.html to /
 	Context.mux.Handle("/", withMiddlewares(clientFS, gziphandler.GzipHandler, optionalAuthHandler, postInstallHandler))
@@ -128,6 +147,20 @@ func newWebAPI(conf *webConfig, l *slog.Logger) (w *webAPI) {
 	return w
 }
 
+// middlewares returns the middlewares wrapping the handlers of all servers.
+func (web *webAPI) middlewares() (mws []middleware) {
+	mws = []middleware{limitRequestBody}
+	if web.conf.securityHeaders != nil {
+		mws = append(mws, web.conf.securityHeaders.wrap)
+	}
+
+	if web.conf.routes != nil {
+		mws = append(mws, web.conf.routes.wrap)
+	}
+
+	return mws
+}
+
 // webCheckPortAvailable checks if port, which is considered an HTTPS port, is
 // available, unless the HTTPS server isn't active.
 //
@@ -154,17 +187,16 @@ func webCheckPortAvailable(port uint16) (ok bool) {
 func (web *webAPI) tlsConfigChanged(ctx context.Context, tlsConf tlsConfigSettings) {
 	log.Debug("web: applying new tls configuration")
 
-	enabled := tlsConf.Enabled &&
-		tlsConf.PortHTTPS != 0 &&
-		len(tlsConf.PrivateKeyData) != 0 &&
-		len(tlsConf.CertificateChainData) != 0
-	var cert tls.Certificate
-	var err error
+	var certs *httpsCerts
+	enabled := tlsConf.Enabled && tlsConf.PortHTTPS != 0
 	if enabled {
-		cert, err = tls.X509KeyPair(tlsConf.CertificateChainData, tlsConf.PrivateKeyData)
+		var err error
+		certs, err = newHTTPSCerts(&tlsConf)
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		enabled = certs != nil
 	}
 
 	web.httpsServer.cond.L.Lock()
@@ -178,7 +210,7 @@ func (web *webAPI) tlsConfigChanged(ctx context.Context, tlsConf tlsConfigSettin
 	}
 
 	web.httpsServer.enabled = enabled
-	web.httpsServer.cert = cert
+	web.httpsServer.certs = certs
 	web.httpsServer.cond.Broadcast()
 	web.httpsServer.cond.L.Unlock()
 }
@@ -196,7 +228,7 @@ func (web *webAPI) start() {
 		errs := make(chan error, 2)
 
 		// Use an h2c handler to support unencrypted HTTP/2, e.g. for proxies.
-		hdlr := h2c.NewHandler(withMiddlewares(Context.mux, limitRequestBody), &http2.Server{})
+		hdlr := h2c.NewHandler(withMiddlewares(Context.mux, web.middlewares()...), &http2.Server{})
 
 		// Create a new instance, because the Web is not usable after Shutdown.
 		web.httpServer = &http.Server{
@@ -210,7 +242,14 @@ func (web *webAPI) start() {
 		go func() {
 			defer log.OnPanic("web: plain")
 
-			errs <- web.httpServer.ListenAndServe()
+			l, err := Context.listeners.listen(web.httpServer.Addr)
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			errs <- web.httpServer.Serve(l)
 		}()
 
 		err := <-errs
@@ -275,12 +314,12 @@ func (web *webAPI) tlsServerLoop() {
 			ErrorLog: log.StdLog("web: https", log.DEBUG),
 			Addr:     addr,
 			TLSConfig: &tls.Config{
-				Certificates: []tls.Certificate{web.httpsServer.cert},
-				RootCAs:      Context.tlsRoots,
-				CipherSuites: Context.tlsCipherIDs,
-				MinVersion:   tls.VersionTLS12,
+				GetCertificate: web.httpsServer.certs.getCertificate,
+				RootCAs:        Context.tlsRoots,
+				CipherSuites:   Context.tlsCipherIDs,
+				MinVersion:     tls.VersionTLS12,
 			},
-			Handler:           withMiddlewares(Context.mux, limitRequestBody),
+			Handler:           withMiddlewares(Context.mux, web.middlewares()...),
 			ReadTimeout:       web.conf.ReadTimeout,
 			ReadHeaderTimeout: web.conf.ReadHeaderTimeout,
 			WriteTimeout:      web.conf.WriteTimeout,
@@ -293,7 +332,7 @@ func (web *webAPI) tlsServerLoop() {
 		}
 
 		log.Debug("web: starting https server")
-		err := web.httpsServer.server.ListenAndServeTLS("", "")
+		err := web.serveTLS(addr)
 		if !errors.Is(err, http.ErrServerClosed) {
 			cleanupAlways()
 			log.Fatalf("web: https: %s", err)
@@ -301,6 +340,18 @@ func (web *webAPI) tlsServerLoop() {
 	}
 }
 
+// serveTLS serves the HTTPS requests on addr, using the listener inherited
+// from the previous process, if there is one.
+func (web *webAPI) serveTLS(addr string) (err error) {
+	l, err := Context.listeners.listen(addr)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return web.httpsServer.server.ServeTLS(l, "", "")
+}
+
 func (web *webAPI) mustStartHTTP3(address string) {
 	defer log.OnPanic("web: http3")
 
@@ -309,12 +360,12 @@ func (web *webAPI) mustStartHTTP3(address string) {
 		// well as timeouts here.
 		Addr: address,
 		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{web.httpsServer.cert},
-			RootCAs:      Context.tlsRoots,
-			CipherSuites: Context.tlsCipherIDs,
-			MinVersion:   tls.VersionTLS12,
+			GetCertificate: web.httpsServer.certs.getCertificate,
+			RootCAs:        Context.tlsRoots,
+			CipherSuites:   Context.tlsCipherIDs,
+			MinVersion:     tls.VersionTLS12,
 		},
-		Handler: withMiddlewares(Context.mux, limitRequestBody),
+		Handler: withMiddlewares(Context.mux, web.middlewares()...),
 	}
 
 	log.Debug("web: starting http/3 server")
@@ -0,0 +1,254 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// webRoutesConfig is the configuration of the access controls and the rate
+// limits of the routes of the web server, which serves both the
+// DNS-over-HTTPS endpoints and the web interface on the same port.
+type webRoutesConfig struct {
+	// DoH is the configuration of the DNS-over-HTTPS endpoints.  These
+	// settings are applied in addition to the access settings of the DNS
+	// server.
+	DoH *webRouteConfig `yaml:"doh"`
+
+	// Web is the configuration of the web interface and its HTTP API.
+	Web *webRouteConfig `yaml:"web"`
+}
+
+// webRouteConfig is the configuration of a single route of the web server.
+type webRouteConfig struct {
+	// AllowedClients are the networks allowed to use the route.  If empty, all
+	// clients are allowed.
+	AllowedClients []netutil.Prefix `yaml:"allowed_clients"`
+
+	// Ratelimit is the maximum number of requests per second from a single
+	// client address.  If zero, the requests aren't limited.
+	Ratelimit uint `yaml:"ratelimit"`
+}
+
+// webRoutes applies the access controls and the rate limits to the routes of
+// the web server.
+//
+// NOTE: The headers set by the proxies are trivially spoofed, so they're only
+// used to get the address of the client if the request comes from one of the
+// trusted proxies.  Otherwise, the address of the connection is used.
+type webRoutes struct {
+	// doh is the route of the DNS-over-HTTPS endpoints.  It's nil if the
+	// route isn't restricted.
+	doh *webRoute
+
+	// web is the route of the web interface.  It's nil if the route isn't
+	// restricted.
+	web *webRoute
+
+	// trustedProxies are the networks of the proxies, the headers of the
+	// requests from which are trusted.  It may be nil.
+	trustedProxies netutil.SubnetSet
+
+	// isDoH returns true if the URL path is served by a DNS-over-HTTPS
+	// endpoint.
+	isDoH func(urlPath string) (ok bool)
+}
+
+// newWebRoutes returns a new properly initialized *webRoutes.  It returns nil
+// if no route is restricted.  endpoints must be valid.  trustedProxies may be
+// nil.
+func newWebRoutes(
+	conf *webRoutesConfig,
+	endpoints []*dnsforward.DoHEndpoint,
+	trustedProxies netutil.SubnetSet,
+) (rs *webRoutes, err error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	doh, err := newWebRoute("doh", conf.DoH)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	web, err := newWebRoute("web", conf.Web)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if doh == nil && web == nil {
+		return nil, nil
+	}
+
+	return &webRoutes{
+		doh:            doh,
+		web:            web,
+		trustedProxies: trustedProxies,
+		isDoH: func(urlPath string) (ok bool) {
+			return dnsforward.IsDoHPath(endpoints, urlPath)
+		},
+	}, nil
+}
+
+// wrap is a [middleware] that restricts the requests to h according to their
+// routes.
+func (rs *webRoutes) wrap(h http.Handler) (wrapped http.Handler) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := rs.web
+		if rs.isDoH(r.URL.Path) {
+			route = rs.doh
+		}
+
+		if route == nil {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		addr, err := clientAddr(r, rs.trustedProxies)
+		if err != nil {
+			// Don't restrict the requests without a proper address, e.g. the
+			// ones from a Unix socket.
+			log.Debug("web: %s route: %s", route.name, err)
+
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		if route.check(w, r, addr, time.Now()) {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// webRoute is a single restricted route of the web server.
+type webRoute struct {
+	// limiter limits the requests by client address.  It's nil if the
+	// requests aren't limited.
+	limiter *requestRateLimiter
+
+	// name is the name of the route used in the logs.
+	name string
+
+	// allowed are the networks allowed to use the route.  If empty, all
+	// clients are allowed.
+	allowed []netip.Prefix
+}
+
+// newWebRoute returns a new properly initialized *webRoute.  It returns nil if
+// conf doesn't restrict the route.
+func newWebRoute(name string, conf *webRouteConfig) (route *webRoute, err error) {
+	if conf == nil || (len(conf.AllowedClients) == 0 && conf.Ratelimit == 0) {
+		return nil, nil
+	}
+
+	route = &webRoute{
+		name: name,
+	}
+
+	for i, p := range conf.AllowedClients {
+		if !p.IsValid() {
+			return nil, fmt.Errorf("%s: allowed_clients: at index %d: bad network", name, i)
+		}
+
+		route.allowed = append(route.allowed, p.Masked())
+	}
+
+	if conf.Ratelimit > 0 {
+		route.limiter = newRequestRateLimiter(conf.Ratelimit)
+	}
+
+	return route, nil
+}
+
+// check returns true if the request r from the client with addr received at
+// now may be served.  Otherwise, it writes the error response to w.
+func (route *webRoute) check(
+	w http.ResponseWriter,
+	r *http.Request,
+	addr netip.Addr,
+	now time.Time,
+) (ok bool) {
+	if !route.isAllowed(addr) {
+		writeError(r, w, http.StatusForbidden, "%s route: client %s is not allowed", route.name, addr)
+
+		return false
+	}
+
+	if route.limiter != nil && !route.limiter.allow(addr, now) {
+		w.Header().Set(httphdr.RetryAfter, "1")
+		writeError(r, w, http.StatusTooManyRequests, "%s route: too many requests", route.name)
+
+		return false
+	}
+
+	return true
+}
+
+// isAllowed returns true if addr is within the allowed networks of the route.
+func (route *webRoute) isAllowed(addr netip.Addr) (ok bool) {
+	if len(route.allowed) == 0 {
+		return true
+	}
+
+	for _, p := range route.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestRateLimiter limits the number of requests per second from each client
+// address using fixed one-second windows.
+type requestRateLimiter struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// counts are the numbers of the requests within the current window.
+	counts map[netip.Addr]uint
+
+	// windowStart is the start of the current window.
+	windowStart time.Time
+
+	// limit is the maximum number of requests within a window.
+	limit uint
+}
+
+// newRequestRateLimiter returns a new properly initialized
+// *requestRateLimiter.  limit must be positive.
+func newRequestRateLimiter(limit uint) (l *requestRateLimiter) {
+	return &requestRateLimiter{
+		mu:     &sync.Mutex{},
+		counts: map[netip.Addr]uint{},
+		limit:  limit,
+	}
+}
+
+// allow counts a request from addr received at now and returns true if it's
+// within the limit.
+func (l *requestRateLimiter) allow(addr netip.Addr, now time.Time) (ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.windowStart) >= time.Second {
+		clear(l.counts)
+		l.windowStart = now
+	}
+
+	n := l.counts[addr] + 1
+	l.counts[addr] = n
+
+	return n <= l.limit
+}
@@ -0,0 +1,119 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRoutes_wrap(t *testing.T) {
+	rs, err := newWebRoutes(&webRoutesConfig{
+		DoH: &webRouteConfig{
+			Ratelimit: 2,
+		},
+		Web: &webRouteConfig{
+			AllowedClients: []netutil.Prefix{{
+				Prefix: netip.MustParsePrefix("192.168.1.0/24"),
+			}},
+		},
+	}, []*dnsforward.DoHEndpoint{{
+		Path: "/family",
+	}}, netutil.SliceSubnetSet{netip.MustParsePrefix("10.0.0.0/8")})
+	require.NoError(t, err)
+	require.NotNil(t, rs)
+
+	h := rs.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	const (
+		lanAddr = "192.168.1.2:1234"
+		wanAddr = "203.0.113.1:1234"
+	)
+
+	const proxyAddr = "10.0.0.1:1234"
+
+	doWithIP := func(remoteAddr, urlPath, realIP string) (rw *httptest.ResponseRecorder) {
+		r := httptest.NewRequest(http.MethodGet, urlPath, nil)
+		r.RemoteAddr = remoteAddr
+		if realIP != "" {
+			r.Header.Set(httphdr.XRealIP, realIP)
+		}
+
+		rw = httptest.NewRecorder()
+
+		h.ServeHTTP(rw, r)
+
+		return rw
+	}
+
+	do := func(remoteAddr, urlPath string) (rw *httptest.ResponseRecorder) {
+		return doWithIP(remoteAddr, urlPath, "")
+	}
+
+	t.Run("web", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(lanAddr, "/control/status").Code)
+		assert.Equal(t, http.StatusOK, do("[::ffff:192.168.1.3]:1234", "/").Code)
+		assert.Equal(t, http.StatusForbidden, do(wanAddr, "/control/status").Code)
+		assert.Equal(t, http.StatusForbidden, do(wanAddr, "/dns-query").Code)
+	})
+
+	t.Run("doh", func(t *testing.T) {
+		const addr = "203.0.113.2:1234"
+
+		assert.Equal(t, http.StatusOK, do(addr, "/family").Code)
+		assert.Equal(t, http.StatusOK, do(addr, "/family/client-1").Code)
+
+		rw := do(addr, "/dns-query-unfiltered")
+		assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+		assert.Equal(t, "1", rw.Header().Get(httphdr.RetryAfter))
+
+		// Other clients aren't limited.
+		assert.Equal(t, http.StatusOK, do(wanAddr, "/family").Code)
+	})
+
+	t.Run("trusted_proxy", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, doWithIP(proxyAddr, "/", "192.168.1.4").Code)
+		assert.Equal(t, http.StatusForbidden, doWithIP(proxyAddr, "/", "203.0.113.3").Code)
+
+		// The headers from the untrusted clients are ignored.
+		assert.Equal(t, http.StatusForbidden, doWithIP(wanAddr, "/", "192.168.1.4").Code)
+
+		// The clients behind the proxy are limited separately.
+		const clientIP = "203.0.113.4"
+
+		assert.Equal(t, http.StatusOK, doWithIP(proxyAddr, "/family", clientIP).Code)
+		assert.Equal(t, http.StatusOK, doWithIP(proxyAddr, "/family", clientIP).Code)
+		assert.Equal(t, http.StatusTooManyRequests, doWithIP(proxyAddr, "/family", clientIP).Code)
+		assert.Equal(t, http.StatusOK, doWithIP(proxyAddr, "/family", "203.0.113.5").Code)
+	})
+}
+
+func TestNewWebRoutes(t *testing.T) {
+	rs, err := newWebRoutes(nil, nil, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, rs)
+
+	rs, err = newWebRoutes(&webRoutesConfig{
+		DoH: &webRouteConfig{},
+		Web: &webRouteConfig{},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, rs)
+
+	_, err = newWebRoutes(&webRoutesConfig{
+		Web: &webRouteConfig{
+			AllowedClients: []netutil.Prefix{{}},
+		},
+	}, nil, nil)
+	assert.EqualError(t, err, "web: allowed_clients: at index 0: bad network")
+}
@@ -0,0 +1,511 @@
+// Package inventory maintains the inventory of the devices on the local
+// networks discovered by periodic scans.
+package inventory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/google/renameio/v2/maybe"
+)
+
+// Source is the way a device has been discovered.
+type Source string
+
+// Source values.
+const (
+	// SourceARP means that the device has been found in the neighbor table.
+	SourceARP Source = "arp"
+
+	// SourceICMP means that the device has replied to an ICMP echo request.
+	SourceICMP Source = "icmp"
+
+	// SourceMDNS means that the device has replied to an mDNS query.
+	SourceMDNS Source = "mdns"
+
+	// SourceSSDP means that the device has replied to an SSDP search request.
+	SourceSSDP Source = "ssdp"
+)
+
+// Observation is a single sighting of a device by a [Prober].
+type Observation struct {
+	// IP is the address of the device.  It must be valid.
+	IP netip.Addr
+
+	// MAC is the hardware address of the device, if known.
+	MAC net.HardwareAddr
+
+	// Name is the hostname of the device, if known.
+	Name string
+
+	// Description is the human-readable description of the device, for
+	// example the SSDP server string, if known.
+	Description string
+
+	// Source is the way the device has been discovered.
+	Source Source
+}
+
+// Prober discovers the devices on the local networks.
+type Prober interface {
+	// Probe returns the devices discovered within subnets.  Probers which
+	// don't scan the addresses one by one may ignore subnets.
+	Probe(ctx context.Context, subnets []netip.Prefix) (obs []*Observation, err error)
+}
+
+// Device is a device on the local network.
+type Device struct {
+	// FirstSeen is the time when the device has been discovered for the
+	// first time.
+	FirstSeen time.Time `json:"first_seen"`
+
+	// LastSeen is the time when the device has been discovered for the last
+	// time.
+	LastSeen time.Time `json:"last_seen"`
+
+	// IP is the most recent address of the device.
+	IP netip.Addr `json:"ip"`
+
+	// MAC is the hardware address of the device, if known.
+	MAC string `json:"mac,omitempty"`
+
+	// Name is the most recent hostname of the device, if known.
+	Name string `json:"name,omitempty"`
+
+	// Description is the most recent description of the device, if known.
+	Description string `json:"description,omitempty"`
+
+	// Sources are the ways the device has been discovered, sorted.
+	Sources []Source `json:"sources"`
+}
+
+// clone returns a deep copy of d.
+func (d *Device) clone() (c *Device) {
+	c = &Device{}
+	*c = *d
+	c.Sources = slices.Clone(d.Sources)
+
+	return c
+}
+
+// Config is the configuration structure for the device inventory.
+type Config struct {
+	// Logger is used to log the operation of the inventory.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// Subnets returns the subnets to scan.  It must not be nil.
+	Subnets func() (subnets []netip.Prefix, err error)
+
+	// FilePath is the path to the file to store the inventory in.  If empty,
+	// the inventory isn't stored.
+	FilePath string
+
+	// Probers are used to discover the devices in the given order.  The
+	// probers reporting the hardware addresses should go first, so that the
+	// observations of the following ones are correlated with the devices by
+	// their IP addresses.
+	Probers []Prober
+
+	// Events, if not nil, receives the events about the newly discovered
+	// devices.
+	Events events.Publisher
+
+	// Interval is the time between the scans.  It must be positive.
+	Interval time.Duration
+}
+
+// maxDevices is the maximum number of devices kept in the inventory.  The
+// least recently seen devices are removed once it's exceeded.
+const maxDevices = 4096
+
+// Inventory is the inventory of the devices on the local networks.  It's safe
+// for concurrent use.
+type Inventory struct {
+	// logger is used to log the operation of the inventory.
+	logger *slog.Logger
+
+	// mu protects devices.
+	mu *sync.Mutex
+
+	// devices are the known devices by their keys, see [deviceKey].
+	devices map[string]*Device
+
+	// scanMu prevents the scans from running concurrently.
+	scanMu *sync.Mutex
+
+	// stopCtx is canceled on shutdown to stop the periodic scans and to
+	// cancel the scan in progress, if any.
+	stopCtx context.Context
+
+	// stop cancels stopCtx.
+	stop context.CancelFunc
+
+	// subnets returns the subnets to scan.
+	subnets func() (subnets []netip.Prefix, err error)
+
+	// filePath is the path to the file to store the inventory in.
+	filePath string
+
+	// probers are used to discover the devices.
+	probers []Prober
+
+	// events, if not nil, receives the events about the new devices.
+	events events.Publisher
+
+	// interval is the time between the scans.
+	interval time.Duration
+}
+
+// New returns a new properly initialized device inventory.  It loads the
+// previously stored devices, if any.  conf must not be nil.
+func New(ctx context.Context, conf *Config) (inv *Inventory, err error) {
+	stopCtx, stop := context.WithCancel(context.Background())
+	inv = &Inventory{
+		logger:   conf.Logger,
+		mu:       &sync.Mutex{},
+		devices:  map[string]*Device{},
+		scanMu:   &sync.Mutex{},
+		stopCtx:  stopCtx,
+		stop:     stop,
+		subnets:  conf.Subnets,
+		filePath: conf.FilePath,
+		probers:  conf.Probers,
+		events:   conf.Events,
+		interval: conf.Interval,
+	}
+
+	err = inv.load(ctx)
+	if err != nil {
+		stop()
+
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// Start starts the goroutine performing the periodic scans.
+func (inv *Inventory) Start(ctx context.Context) (err error) {
+	go inv.periodicScan(ctx)
+
+	return nil
+}
+
+// Shutdown stops the periodic scans, cancels the scan in progress, if any, and
+// waits for it to finish.
+func (inv *Inventory) Shutdown(_ context.Context) (err error) {
+	inv.stop()
+
+	inv.scanMu.Lock()
+	defer inv.scanMu.Unlock()
+
+	return nil
+}
+
+// periodicScan scans the networks right away and then once in the interval.
+// It is intended to be used as a goroutine.
+func (inv *Inventory) periodicScan(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, inv.logger)
+
+	t := time.NewTicker(inv.interval)
+	defer t.Stop()
+
+	for {
+		err := inv.Scan(ctx)
+		if err != nil {
+			inv.logger.ErrorContext(ctx, "scanning", slogutil.KeyError, err)
+		}
+
+		select {
+		case <-t.C:
+			// Go on.
+		case <-inv.stopCtx.Done():
+			return
+		}
+	}
+}
+
+// Scan discovers the devices on the local networks using all probers and
+// updates the inventory.  The failures of single probers are only logged.  The
+// scan is canceled on [Inventory.Shutdown].
+func (inv *Inventory) Scan(ctx context.Context) (err error) {
+	inv.scanMu.Lock()
+	defer inv.scanMu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer context.AfterFunc(inv.stopCtx, cancel)()
+
+	subnets, err := inv.subnets()
+	if err != nil {
+		return fmt.Errorf("getting subnets: %w", err)
+	}
+
+	inv.logger.DebugContext(ctx, "scanning", "subnets", subnets)
+
+	var obs []*Observation
+	for _, p := range inv.probers {
+		var found []*Observation
+		found, err = p.Probe(ctx, subnets)
+		if err != nil {
+			inv.logger.WarnContext(ctx, "probing", "prober", fmt.Sprintf("%T", p), slogutil.KeyError, err)
+
+			continue
+		}
+
+		obs = append(obs, found...)
+	}
+
+	n, added := inv.record(obs, time.Now())
+
+	inv.logger.DebugContext(ctx, "scanned", "observations", len(obs), "devices", n, "new", len(added))
+
+	inv.publishNew(ctx, added)
+
+	return inv.store(ctx)
+}
+
+// record adds the observations made at now to the inventory and returns the
+// resulting number of devices and the copies of the devices discovered for the
+// first time.
+func (inv *Inventory) record(obs []*Observation, now time.Time) (n int, added []*Device) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	var newDevs []*Device
+	for _, o := range obs {
+		if d := inv.recordOne(o, now); d != nil {
+			newDevs = append(newDevs, d)
+		}
+	}
+
+	inv.evictLocked()
+
+	for _, d := range newDevs {
+		added = append(added, d.clone())
+	}
+
+	return len(inv.devices), added
+}
+
+// recordOne adds a single observation made at now to the inventory.  added is
+// the device if it's discovered for the first time.  inv.mu must be locked.
+func (inv *Inventory) recordOne(o *Observation, now time.Time) (added *Device) {
+	key, d := inv.findLocked(o)
+	if d == nil {
+		d = &Device{FirstSeen: now}
+		inv.devices[key] = d
+		added = d
+	}
+
+	d.LastSeen = now
+	d.IP = o.IP
+	if o.MAC != nil {
+		d.MAC = o.MAC.String()
+	}
+
+	if o.Name != "" {
+		d.Name = o.Name
+	}
+
+	if o.Description != "" {
+		d.Description = o.Description
+	}
+
+	if i, found := slices.BinarySearch(d.Sources, o.Source); !found {
+		d.Sources = slices.Insert(d.Sources, i, o.Source)
+	}
+
+	return added
+}
+
+// publishNew publishes the events about the newly discovered devices, if the
+// events are configured.
+func (inv *Inventory) publishNew(ctx context.Context, added []*Device) {
+	if inv.events == nil {
+		return
+	}
+
+	for _, d := range added {
+		ip := d.IP.String()
+		desc := cmp.Or(d.Name, d.MAC, ip)
+		inv.events.Publish(ctx, &events.Event{
+			Time: d.FirstSeen,
+			Data: map[string]string{
+				"ip":   ip,
+				"mac":  d.MAC,
+				"name": d.Name,
+			},
+			Type:     events.TypeNewClient,
+			Message:  fmt.Sprintf("new device %s discovered at %s", desc, ip),
+			Severity: events.SeverityInfo,
+		})
+	}
+}
+
+// findLocked returns the key and the known device for o.  The observations
+// with hardware addresses are matched by those, and the devices previously
+// known only by the IP address are moved under the key of the hardware
+// address.  The others are correlated with the devices by their IP addresses.
+// d is nil if the device is unknown.  inv.mu must be locked.
+func (inv *Inventory) findLocked(o *Observation) (key string, d *Device) {
+	ipKey := deviceKey("", o.IP)
+	if o.MAC == nil {
+		key = ipKey
+		for k, known := range inv.devices {
+			// Prefer the most recently seen device, since the address may
+			// have been reassigned.
+			if known.IP == o.IP && (d == nil || known.LastSeen.After(d.LastSeen)) {
+				key, d = k, known
+			}
+		}
+
+		return key, d
+	}
+
+	key = deviceKey(o.MAC.String(), o.IP)
+	if d = inv.devices[key]; d != nil {
+		return key, d
+	}
+
+	if d = inv.devices[ipKey]; d != nil {
+		delete(inv.devices, ipKey)
+		inv.devices[key] = d
+	}
+
+	return key, d
+}
+
+// deviceKey returns the key of the device in the inventory.  The devices are
+// identified by their hardware addresses, if known, and by their IP addresses
+// otherwise.
+func deviceKey(mac string, ip netip.Addr) (key string) {
+	if mac != "" {
+		return mac
+	}
+
+	return ip.String()
+}
+
+// evictLocked removes the least recently seen devices exceeding maxDevices.
+// inv.mu must be locked.
+func (inv *Inventory) evictLocked() {
+	for len(inv.devices) > maxDevices {
+		var oldestKey string
+		var oldest *Device
+		for k, d := range inv.devices {
+			if oldest == nil || d.LastSeen.Before(oldest.LastSeen) {
+				oldestKey, oldest = k, d
+			}
+		}
+
+		delete(inv.devices, oldestKey)
+	}
+}
+
+// Devices returns the copies of the known devices sorted by their IP
+// addresses.
+func (inv *Inventory) Devices() (devices []*Device) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	devices = make([]*Device, 0, len(inv.devices))
+	for _, d := range inv.devices {
+		devices = append(devices, d.clone())
+	}
+
+	slices.SortFunc(devices, func(a, b *Device) (res int) {
+		return a.IP.Compare(b.IP)
+	})
+
+	return devices
+}
+
+// dataVersion is the current version of the stored inventory structure.
+const dataVersion = 1
+
+// data is the structure of the stored inventory.
+type data struct {
+	// Version is the version of the structure.
+	Version int `json:"version"`
+
+	// Devices are the known devices.
+	Devices []*Device `json:"devices"`
+}
+
+// load reads the stored inventory, if any.
+func (inv *Inventory) load(ctx context.Context) (err error) {
+	if inv.filePath == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(inv.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading inventory: %w", err)
+	}
+
+	d := &data{}
+	err = json.Unmarshal(b, d)
+	if err != nil {
+		return fmt.Errorf("decoding inventory: %w", err)
+	}
+
+	if d.Version != dataVersion {
+		inv.logger.WarnContext(ctx, "unsupported inventory version, discarding", "version", d.Version)
+
+		return nil
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for _, dev := range d.Devices {
+		inv.devices[deviceKey(dev.MAC, dev.IP)] = dev
+	}
+
+	inv.logger.DebugContext(ctx, "loaded inventory", "devices", len(inv.devices))
+
+	return nil
+}
+
+// store writes the inventory to the file, if configured.
+func (inv *Inventory) store(ctx context.Context) (err error) {
+	if inv.filePath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(&data{
+		Version: dataVersion,
+		Devices: inv.Devices(),
+	})
+	if err != nil {
+		return fmt.Errorf("encoding inventory: %w", err)
+	}
+
+	err = maybe.WriteFile(inv.filePath, b, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing inventory: %w", err)
+	}
+
+	inv.logger.DebugContext(ctx, "stored inventory", "path", inv.filePath)
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package inventory_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/events"
+	"github.com/AdguardTeam/AdGuardHome/internal/inventory"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testProber is the [inventory.Prober] for tests.
+type testProber struct {
+	obs []*inventory.Observation
+}
+
+// Probe implements the [inventory.Prober] interface for *testProber.
+func (p *testProber) Probe(
+	_ context.Context,
+	_ []netip.Prefix,
+) (obs []*inventory.Observation, err error) {
+	return p.obs, nil
+}
+
+// testPublisher is the [events.Publisher] for tests.
+type testPublisher struct {
+	evs []*events.Event
+}
+
+// Publish implements the [events.Publisher] interface for *testPublisher.
+func (p *testPublisher) Publish(_ context.Context, e *events.Event) {
+	p.evs = append(p.evs, e)
+}
+
+func TestInventory_Scan(t *testing.T) {
+	var (
+		subnet  = netip.MustParsePrefix("192.168.1.0/24")
+		ip1     = netip.MustParseAddr("192.168.1.2")
+		ip2     = netip.MustParseAddr("192.168.1.3")
+		mac1    = net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+		dbPath  = filepath.Join(t.TempDir(), "inventory.json")
+		subnets = func() (s []netip.Prefix, err error) { return []netip.Prefix{subnet}, nil }
+	)
+
+	arp := &testProber{
+		obs: []*inventory.Observation{{
+			IP:     ip1,
+			MAC:    mac1,
+			Source: inventory.SourceARP,
+		}},
+	}
+
+	mdns := &testProber{
+		obs: []*inventory.Observation{{
+			IP:     ip1,
+			Name:   "printer",
+			Source: inventory.SourceMDNS,
+		}, {
+			IP:          ip2,
+			Description: "Linux UPnP/1.0",
+			Source:      inventory.SourceSSDP,
+		}},
+	}
+
+	pub := &testPublisher{}
+	conf := &inventory.Config{
+		Logger:   slogutil.NewDiscardLogger(),
+		Subnets:  subnets,
+		FilePath: dbPath,
+		Probers:  []inventory.Prober{arp, mdns},
+		Events:   pub,
+		Interval: time.Hour,
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	inv, err := inventory.New(ctx, conf)
+	require.NoError(t, err)
+
+	err = inv.Scan(ctx)
+	require.NoError(t, err)
+
+	devices := inv.Devices()
+	require.Len(t, devices, 2)
+
+	d1, d2 := devices[0], devices[1]
+	assert.Equal(t, ip1, d1.IP)
+	assert.Equal(t, mac1.String(), d1.MAC)
+	assert.Equal(t, "printer", d1.Name)
+	assert.Equal(t, []inventory.Source{inventory.SourceARP, inventory.SourceMDNS}, d1.Sources)
+
+	assert.Equal(t, ip2, d2.IP)
+	assert.Empty(t, d2.MAC)
+	assert.Equal(t, "Linux UPnP/1.0", d2.Description)
+
+	require.Len(t, pub.evs, 2)
+
+	assert.Equal(t, events.TypeNewClient, pub.evs[0].Type)
+	assert.Equal(t, "printer", pub.evs[0].Data["name"])
+	assert.Equal(t, ip2.String(), pub.evs[1].Data["ip"])
+
+	firstSeen := d1.FirstSeen
+
+	// The device previously known only by its IP address is now identified by
+	// its hardware address.
+	arp.obs = append(arp.obs, &inventory.Observation{
+		IP:     ip2,
+		MAC:    net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x00},
+		Source: inventory.SourceARP,
+	})
+	mdns.obs = nil
+
+	err = inv.Scan(ctx)
+	require.NoError(t, err)
+
+	devices = inv.Devices()
+	require.Len(t, devices, 2)
+
+	assert.Equal(t, firstSeen, devices[0].FirstSeen)
+	assert.False(t, devices[0].LastSeen.Before(firstSeen))
+	assert.Equal(t, "aa:bb:cc:dd:ee:00", devices[1].MAC)
+	assert.Equal(t, "Linux UPnP/1.0", devices[1].Description)
+
+	// No devices are new.
+	assert.Len(t, pub.evs, 2)
+
+	t.Run("load", func(t *testing.T) {
+		conf.Probers = nil
+
+		var loaded *inventory.Inventory
+		loaded, err = inventory.New(ctx, conf)
+		require.NoError(t, err)
+
+		got := loaded.Devices()
+		require.Len(t, got, 2)
+
+		assert.Equal(t, devices[0].MAC, got[0].MAC)
+		assert.Equal(t, devices[0].Name, got[0].Name)
+		assert.True(t, devices[0].FirstSeen.Equal(got[0].FirstSeen))
+		assert.Equal(t, devices[1].Sources, got[1].Sources)
+	})
+}
+
+// blockingProber is the [inventory.Prober] for tests, which blocks until the
+// context is canceled.
+type blockingProber struct {
+	// started receives a value when a probe is started.
+	started chan struct{}
+}
+
+// Probe implements the [inventory.Prober] interface for *blockingProber.
+func (p *blockingProber) Probe(
+	ctx context.Context,
+	_ []netip.Prefix,
+) (obs []*inventory.Observation, err error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestInventory_Shutdown(t *testing.T) {
+	p := &blockingProber{started: make(chan struct{}, 1)}
+	conf := &inventory.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Subnets: func() (s []netip.Prefix, err error) {
+			return []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}, nil
+		},
+		Probers:  []inventory.Prober{p},
+		Interval: time.Hour,
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	inv, err := inventory.New(ctx, conf)
+	require.NoError(t, err)
+
+	require.NoError(t, inv.Start(context.Background()))
+	testutil.RequireReceive(t, p.started, testTimeout)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		assert.NoError(t, inv.Shutdown(ctx))
+	}()
+
+	testutil.RequireReceive(t, done, testTimeout)
+}
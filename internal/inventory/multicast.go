@@ -0,0 +1,244 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/miekg/dns"
+)
+
+// maxDatagramSize is the maximum size of the received datagrams.
+const maxDatagramSize = 9000
+
+// multicastAsk sends req to dst from an ephemeral port and calls handle for
+// each datagram received until timeout.
+//
+// TODO: Send the requests through each of the scanned interfaces, not only
+// the default one.
+func multicastAsk(
+	ctx context.Context,
+	dst netip.AddrPort,
+	req []byte,
+	timeout time.Duration,
+	handle func(src netip.Addr, b []byte),
+) (err error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.WriteToUDPAddrPort(req, dst)
+	if err != nil {
+		return fmt.Errorf("sending to %s: %w", dst, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, src, readErr := conn.ReadFromUDPAddrPort(buf)
+		if errors.Is(readErr, os.ErrDeadlineExceeded) {
+			return nil
+		} else if readErr != nil {
+			return fmt.Errorf("receiving: %w", readErr)
+		}
+
+		handle(src.Addr().Unmap(), buf[:n])
+	}
+}
+
+// mdnsAddr is the IPv4 multicast address and port of mDNS.
+var mdnsAddr = netip.AddrPortFrom(netip.MustParseAddr("224.0.0.251"), 5353)
+
+// mdnsServicesName is the name for enumerating the DNS-SD service types, see
+// RFC 6763 Section 9.
+const mdnsServicesName = "_services._dns-sd._udp.local."
+
+// MDNSProber is the [Prober] discovering the hostnames of the devices
+// announcing their services via mDNS.
+type MDNSProber struct {
+	logger  *slog.Logger
+	timeout time.Duration
+}
+
+// NewMDNSProber returns a new *MDNSProber waiting for the replies for timeout.
+// logger must not be nil.
+func NewMDNSProber(logger *slog.Logger, timeout time.Duration) (p *MDNSProber) {
+	return &MDNSProber{
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// type check
+var _ Prober = (*MDNSProber)(nil)
+
+// Probe implements the [Prober] interface for *MDNSProber.  It sends a single
+// DNS-SD service enumeration query, so subnets are only used to filter the
+// replies.
+func (p *MDNSProber) Probe(ctx context.Context, subnets []netip.Prefix) (obs []*Observation, err error) {
+	req := &dns.Msg{}
+	req.SetQuestion(mdnsServicesName, dns.TypePTR)
+
+	b, err := req.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	err = multicastAsk(ctx, mdnsAddr, b, p.timeout, func(src netip.Addr, b []byte) {
+		resp := &dns.Msg{}
+		if unpackErr := resp.Unpack(b); unpackErr != nil {
+			p.logger.DebugContext(ctx, "bad mdns response", "src", src, slogutil.KeyError, unpackErr)
+
+			return
+		}
+
+		for _, o := range parseMDNSResponse(src, resp) {
+			if containsAddr(subnets, o.IP) {
+				obs = append(obs, o)
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mdns: %w", err)
+	}
+
+	return obs, nil
+}
+
+// parseMDNSResponse returns the devices described by the mDNS response from
+// src.  The address records give the hostnames of their addresses, and the
+// service records give the hostname of src.
+func parseMDNSResponse(src netip.Addr, resp *dns.Msg) (obs []*Observation) {
+	names := map[netip.Addr]string{}
+	for _, rr := range slices.Concat(resp.Answer, resp.Extra) {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if ip, ok := netip.AddrFromSlice(rr.A.To4()); ok {
+				names[ip] = mdnsHostname(rr.Hdr.Name)
+			}
+		case *dns.SRV:
+			if _, ok := names[src]; !ok {
+				names[src] = mdnsHostname(rr.Target)
+			}
+		}
+	}
+
+	if _, ok := names[src]; !ok {
+		names[src] = ""
+	}
+
+	for ip, name := range names {
+		obs = append(obs, &Observation{
+			IP:     ip,
+			Name:   name,
+			Source: SourceMDNS,
+		})
+	}
+
+	return obs
+}
+
+// mdnsHostname returns the hostname without the trailing ".local." of an mDNS
+// name.
+func mdnsHostname(fqdn string) (host string) {
+	host = strings.TrimSuffix(dns.Fqdn(fqdn), ".")
+
+	return strings.TrimSuffix(host, ".local")
+}
+
+// ssdpAddr is the IPv4 multicast address and port of SSDP.
+var ssdpAddr = netip.AddrPortFrom(netip.MustParseAddr("239.255.255.250"), 1900)
+
+// ssdpSearch is the SSDP search request for all devices and services.
+const ssdpSearch = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 1\r\n" +
+	"ST: ssdp:all\r\n" +
+	"\r\n"
+
+// SSDPProber is the [Prober] discovering the UPnP devices via SSDP.
+type SSDPProber struct {
+	logger  *slog.Logger
+	timeout time.Duration
+}
+
+// NewSSDPProber returns a new *SSDPProber waiting for the replies for timeout.
+// logger must not be nil.
+func NewSSDPProber(logger *slog.Logger, timeout time.Duration) (p *SSDPProber) {
+	return &SSDPProber{
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// type check
+var _ Prober = (*SSDPProber)(nil)
+
+// Probe implements the [Prober] interface for *SSDPProber.  It sends a single
+// search request, so subnets are only used to filter the replies.
+func (p *SSDPProber) Probe(ctx context.Context, subnets []netip.Prefix) (obs []*Observation, err error) {
+	seen := map[netip.Addr]struct{}{}
+	err = multicastAsk(ctx, ssdpAddr, []byte(ssdpSearch), p.timeout, func(src netip.Addr, b []byte) {
+		if _, ok := seen[src]; ok || !containsAddr(subnets, src) {
+			return
+		}
+
+		o, parseErr := parseSSDPResponse(src, b)
+		if parseErr != nil {
+			p.logger.DebugContext(ctx, "bad ssdp response", "src", src, slogutil.KeyError, parseErr)
+
+			return
+		}
+
+		seen[src] = struct{}{}
+		obs = append(obs, o)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssdp: %w", err)
+	}
+
+	return obs, nil
+}
+
+// parseSSDPResponse returns the device described by the SSDP search response
+// from src.  The description of the device is its server string.
+func parseSSDPResponse(src netip.Addr, b []byte) (o *Observation, err error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return &Observation{
+		IP:          src,
+		Description: resp.Header.Get("Server"),
+		Source:      SourceSSDP,
+	}, nil
+}
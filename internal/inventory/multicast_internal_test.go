@@ -0,0 +1,94 @@
+package inventory
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMDNSResponse(t *testing.T) {
+	var (
+		src   = netip.MustParseAddr("192.168.1.2")
+		other = netip.MustParseAddr("192.168.1.3")
+	)
+
+	hdr := func(name string, rrType uint16) (h dns.RR_Header) {
+		return dns.RR_Header{Name: name, Rrtype: rrType, Class: dns.ClassINET}
+	}
+
+	testCases := []struct {
+		resp *dns.Msg
+		want map[netip.Addr]string
+		name string
+	}{{
+		resp: &dns.Msg{
+			Answer: []dns.RR{&dns.PTR{
+				Hdr: hdr(mdnsServicesName, dns.TypePTR),
+				Ptr: "_ipp._tcp.local.",
+			}},
+		},
+		want: map[netip.Addr]string{src: ""},
+		name: "no_name",
+	}, {
+		resp: &dns.Msg{
+			Answer: []dns.RR{&dns.SRV{
+				Hdr:    hdr("printer._ipp._tcp.local.", dns.TypeSRV),
+				Target: "printer.local.",
+			}},
+		},
+		want: map[netip.Addr]string{src: "printer"},
+		name: "srv",
+	}, {
+		resp: &dns.Msg{
+			Answer: []dns.RR{&dns.SRV{
+				Hdr:    hdr("printer._ipp._tcp.local.", dns.TypeSRV),
+				Target: "printer.local.",
+			}},
+			Extra: []dns.RR{&dns.A{
+				Hdr: hdr("tv.local.", dns.TypeA),
+				A:   net.IP{192, 168, 1, 3},
+			}},
+		},
+		want: map[netip.Addr]string{src: "printer", other: "tv"},
+		name: "address",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := map[netip.Addr]string{}
+			for _, o := range parseMDNSResponse(src, tc.resp) {
+				assert.Equal(t, SourceMDNS, o.Source)
+				got[o.IP] = o.Name
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseSSDPResponse(t *testing.T) {
+	src := netip.MustParseAddr("192.168.1.2")
+
+	const resp = "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"LOCATION: http://192.168.1.2:49152/description.xml\r\n" +
+		"SERVER: Linux/4.9 UPnP/1.0 Router/1.0\r\n" +
+		"ST: upnp:rootdevice\r\n" +
+		"\r\n"
+
+	o, err := parseSSDPResponse(src, []byte(resp))
+	require.NoError(t, err)
+
+	assert.Equal(t, &Observation{
+		IP:          src,
+		Description: "Linux/4.9 UPnP/1.0 Router/1.0",
+		Source:      SourceSSDP,
+	}, o)
+
+	_, err = parseSSDPResponse(src, []byte("not http"))
+	assert.Error(t, err)
+}
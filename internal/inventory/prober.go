@@ -0,0 +1,181 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/go-ping/ping"
+)
+
+// ARPProber is the [Prober] reporting the devices from the neighbor table.  It
+// should go after the [ICMPProber], since the echo requests make the system
+// resolve the probed addresses.
+type ARPProber struct {
+	db arpdb.Interface
+}
+
+// NewARPProber returns a new *ARPProber using db.  db must not be nil.
+func NewARPProber(db arpdb.Interface) (p *ARPProber) {
+	return &ARPProber{
+		db: db,
+	}
+}
+
+// type check
+var _ Prober = (*ARPProber)(nil)
+
+// Probe implements the [Prober] interface for *ARPProber.  It reports the
+// neighbors within subnets.
+func (p *ARPProber) Probe(_ context.Context, subnets []netip.Prefix) (obs []*Observation, err error) {
+	err = p.db.Refresh()
+	if err != nil {
+		return nil, fmt.Errorf("refreshing neighbors: %w", err)
+	}
+
+	for _, n := range p.db.Neighbors() {
+		if !containsAddr(subnets, n.IP) || isZeroMAC(n.MAC) {
+			continue
+		}
+
+		obs = append(obs, &Observation{
+			IP:     n.IP,
+			MAC:    n.MAC,
+			Name:   n.Name,
+			Source: SourceARP,
+		})
+	}
+
+	return obs, nil
+}
+
+// containsAddr returns true if ip is within any of subnets.
+func containsAddr(subnets []netip.Prefix, ip netip.Addr) (ok bool) {
+	ip = ip.Unmap()
+	for _, p := range subnets {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isZeroMAC returns true if mac is empty or consists of zeroes only, as the
+// ones of the incomplete entries of the neighbor table.
+func isZeroMAC(mac []byte) (ok bool) {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// icmpWorkers is the maximum number of the ICMP echo requests in flight.
+const icmpWorkers = 64
+
+// ICMPProber is the [Prober] sending ICMP echo requests to each address of the
+// subnets.  It requires the privileges to open raw sockets.
+type ICMPProber struct {
+	logger  *slog.Logger
+	timeout time.Duration
+}
+
+// NewICMPProber returns a new *ICMPProber waiting for the replies for timeout.
+// logger must not be nil.
+func NewICMPProber(logger *slog.Logger, timeout time.Duration) (p *ICMPProber) {
+	return &ICMPProber{
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// type check
+var _ Prober = (*ICMPProber)(nil)
+
+// Probe implements the [Prober] interface for *ICMPProber.  It only returns an
+// error if none of the requests could be sent.
+func (p *ICMPProber) Probe(ctx context.Context, subnets []netip.Prefix) (obs []*Observation, err error) {
+	var (
+		mu      = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+		sem     = make(chan struct{}, icmpWorkers)
+		errs    []error
+		sent    int
+		replied []netip.Addr
+	)
+
+	for _, subnet := range subnets {
+		rangeHosts(subnet, func(ip netip.Addr) (cont bool) {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+
+				ok, echoErr := p.echo(ip)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				sent++
+				if echoErr != nil {
+					errs = append(errs, echoErr)
+				} else if ok {
+					replied = append(replied, ip)
+				}
+			}()
+
+			return true
+		})
+	}
+
+	wg.Wait()
+
+	if sent > 0 && len(errs) == sent {
+		return nil, fmt.Errorf("sending echo requests: %w", errors.Join(errs...))
+	}
+
+	p.logger.DebugContext(ctx, "icmp sweep", "sent", sent, "replied", len(replied), "failed", len(errs))
+
+	for _, ip := range replied {
+		obs = append(obs, &Observation{
+			IP:     ip,
+			Source: SourceICMP,
+		})
+	}
+
+	return obs, nil
+}
+
+// echo sends a single ICMP echo request to ip and reports if it's replied.
+func (p *ICMPProber) echo(ip netip.Addr) (ok bool, err error) {
+	pinger, err := ping.NewPinger(ip.String())
+	if err != nil {
+		return false, fmt.Errorf("creating pinger: %w", err)
+	}
+
+	pinger.SetPrivileged(true)
+	pinger.Timeout = p.timeout
+	pinger.Count = 1
+	pinger.OnRecv = func(_ *ping.Packet) {
+		ok = true
+	}
+
+	err = pinger.Run()
+	if err != nil {
+		return false, fmt.Errorf("pinging %s: %w", ip, err)
+	}
+
+	return ok, nil
+}
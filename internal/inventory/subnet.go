@@ -0,0 +1,81 @@
+package inventory
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// minScanBits is the minimum length of the prefix of a subnet to scan.  The
+// larger subnets are narrowed down to the part containing the address of the
+// interface, so that a single scan doesn't probe more than 1024 addresses.
+const minScanBits = 22
+
+// LocalSubnets returns the private IPv4 subnets of the network interfaces which
+// are up, except for the loopback ones.
+func LocalSubnets() (subnets []netip.Prefix, err error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("getting interfaces: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		var addrs []net.Addr
+		addrs, err = iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("getting addresses of %q: %w", iface.Name, err)
+		}
+
+		for _, a := range addrs {
+			if p, ok := scanPrefix(a); ok {
+				subnets = append(subnets, p)
+			}
+		}
+	}
+
+	return subnets, nil
+}
+
+// scanPrefix returns the subnet to scan for the interface address a.  ok is
+// false if a isn't a private IPv4 network.
+func scanPrefix(a net.Addr) (p netip.Prefix, ok bool) {
+	ipNet, ok := a.(*net.IPNet)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+
+	ip, ok := netip.AddrFromSlice(ipNet.IP.To4())
+	if !ok || !ip.IsPrivate() {
+		return netip.Prefix{}, false
+	}
+
+	bits, _ := ipNet.Mask.Size()
+
+	return netip.PrefixFrom(ip, max(bits, minScanBits)).Masked(), true
+}
+
+// rangeHosts calls f for each host address of the IPv4 subnet p, excluding the
+// network and the broadcast addresses of the subnets having those, until f
+// returns false.
+func rangeHosts(p netip.Prefix, f func(ip netip.Addr) (cont bool)) {
+	p = p.Masked()
+	ip := p.Addr()
+	if p.Bits() < 31 {
+		ip = ip.Next()
+	}
+
+	for ; ip.IsValid() && p.Contains(ip); ip = ip.Next() {
+		if p.Bits() < 31 && !p.Contains(ip.Next()) {
+			// Skip the broadcast address.
+			return
+		}
+
+		if !f(ip) {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package inventory
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeHosts(t *testing.T) {
+	testCases := []struct {
+		name string
+		want []netip.Addr
+		in   netip.Prefix
+	}{{
+		name: "slash30",
+		want: []netip.Addr{
+			netip.MustParseAddr("192.168.1.1"),
+			netip.MustParseAddr("192.168.1.2"),
+		},
+		in: netip.MustParsePrefix("192.168.1.0/30"),
+	}, {
+		name: "slash31",
+		want: []netip.Addr{
+			netip.MustParseAddr("192.168.1.0"),
+			netip.MustParseAddr("192.168.1.1"),
+		},
+		in: netip.MustParsePrefix("192.168.1.0/31"),
+	}, {
+		name: "unmasked",
+		want: []netip.Addr{
+			netip.MustParseAddr("10.0.0.5"),
+			netip.MustParseAddr("10.0.0.6"),
+		},
+		in: netip.MustParsePrefix("10.0.0.6/30"),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []netip.Addr
+			rangeHosts(tc.in, func(ip netip.Addr) (cont bool) {
+				got = append(got, ip)
+
+				return true
+			})
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	testCases := []struct {
+		in     net.Addr
+		name   string
+		want   netip.Prefix
+		wantOK bool
+	}{{
+		in: &net.IPNet{
+			IP:   net.IP{192, 168, 1, 10},
+			Mask: net.CIDRMask(24, 32),
+		},
+		name:   "private",
+		want:   netip.MustParsePrefix("192.168.1.0/24"),
+		wantOK: true,
+	}, {
+		in: &net.IPNet{
+			IP:   net.IP{10, 1, 2, 3},
+			Mask: net.CIDRMask(8, 32),
+		},
+		name:   "narrowed",
+		want:   netip.MustParsePrefix("10.1.0.0/22"),
+		wantOK: true,
+	}, {
+		in: &net.IPNet{
+			IP:   net.IP{8, 8, 8, 8},
+			Mask: net.CIDRMask(24, 32),
+		},
+		name:   "public",
+		want:   netip.Prefix{},
+		wantOK: false,
+	}, {
+		in: &net.IPNet{
+			IP:   net.ParseIP("fd00::1"),
+			Mask: net.CIDRMask(64, 128),
+		},
+		name:   "ipv6",
+		want:   netip.Prefix{},
+		wantOK: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := scanPrefix(tc.in)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package openwrt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/exp/maps"
+)
+
+// Constants of the blob attributes of libubox.
+const (
+	// blobAttrExtended is the flag of the blobmsg attributes.
+	blobAttrExtended uint32 = 0x80000000
+
+	blobAttrIDMask  uint32 = 0x7f000000
+	blobAttrIDShift        = 24
+	blobAttrLenMask uint32 = 0x00ffffff
+
+	// blobAttrHdrLen is the length of the header of a blob attribute.
+	blobAttrHdrLen = 4
+
+	// blobAttrAlign is the alignment of the blob attributes.
+	blobAttrAlign = 4
+)
+
+// ArgType is the type of a blobmsg value used in the policies of the ubus
+// methods.
+type ArgType uint8
+
+// Blobmsg types.  The boolean values are encoded as [ArgTypeInt8].
+const (
+	ArgTypeUnspec ArgType = 0
+	ArgTypeArray  ArgType = 1
+	ArgTypeTable  ArgType = 2
+	ArgTypeString ArgType = 3
+	ArgTypeInt64  ArgType = 4
+	ArgTypeInt32  ArgType = 5
+	ArgTypeInt16  ArgType = 6
+	ArgTypeInt8   ArgType = 7
+	ArgTypeDouble ArgType = 8
+
+	ArgTypeBool = ArgTypeInt8
+)
+
+// blobAttr is a decoded blob attribute.
+type blobAttr struct {
+	// data is the payload of the attribute without the padding.
+	data []byte
+
+	// id is the identifier of the attribute, which is the type for the
+	// blobmsg attributes.
+	id uint8
+
+	// extended is true for the blobmsg attributes.
+	extended bool
+}
+
+// padLen returns l rounded up to [blobAttrAlign].
+func padLen(l int) (padded int) {
+	return (l + blobAttrAlign - 1) &^ (blobAttrAlign - 1)
+}
+
+// parseBlobAttrs parses the sequence of the padded blob attributes from data.
+func parseBlobAttrs(data []byte) (attrs []*blobAttr, err error) {
+	for len(data) > 0 {
+		if len(data) < blobAttrHdrLen {
+			return nil, fmt.Errorf("attribute header: %w", errors.Error("unexpected end of data"))
+		}
+
+		idLen := binary.BigEndian.Uint32(data)
+		l := int(idLen & blobAttrLenMask)
+		if l < blobAttrHdrLen || l > len(data) {
+			return nil, fmt.Errorf("attribute length: bad value %d", l)
+		}
+
+		attrs = append(attrs, &blobAttr{
+			data:     data[blobAttrHdrLen:l],
+			id:       uint8((idLen & blobAttrIDMask) >> blobAttrIDShift),
+			extended: idLen&blobAttrExtended != 0,
+		})
+
+		data = data[min(padLen(l), len(data)):]
+	}
+
+	return attrs, nil
+}
+
+// appendBlobAttr appends the blob attribute with the payload to b and pads it.
+func appendBlobAttr(b []byte, id uint8, extended bool, payload []byte) (res []byte) {
+	idLen := uint32(id)<<blobAttrIDShift | uint32(blobAttrHdrLen+len(payload))
+	if extended {
+		idLen |= blobAttrExtended
+	}
+
+	b = binary.BigEndian.AppendUint32(b, idLen)
+	b = append(b, payload...)
+
+	return append(b, make([]byte, padLen(len(payload))-len(payload))...)
+}
+
+// appendBlobU32 appends the blob attribute with the 32-bit value to b.
+func appendBlobU32(b []byte, id uint8, v uint32) (res []byte) {
+	return appendBlobAttr(b, id, false, binary.BigEndian.AppendUint32(nil, v))
+}
+
+// appendBlobString appends the blob attribute with the NUL-terminated string
+// to b.
+func appendBlobString(b []byte, id uint8, s string) (res []byte) {
+	return appendBlobAttr(b, id, false, append([]byte(s), 0))
+}
+
+// appendBlobmsg appends the blobmsg attribute with the name and the value to
+// b.  The supported value types are bool, string, int, int32, int64, uint32,
+// uint64, float64, map[string]any, and []any.
+func appendBlobmsg(b []byte, name string, val any) (res []byte, err error) {
+	// The header consists of the big-endian length of the name and the
+	// NUL-terminated name padded to the alignment.
+	hdrLen := padLen(2 + len(name) + 1)
+	payload := make([]byte, hdrLen, hdrLen+8)
+	binary.BigEndian.PutUint16(payload, uint16(len(name)))
+	copy(payload[2:], name)
+
+	var typ ArgType
+	switch v := val.(type) {
+	case bool:
+		typ = ArgTypeBool
+		payload = append(payload, boolToByte(v))
+	case string:
+		typ = ArgTypeString
+		payload = append(append(payload, v...), 0)
+	case int32:
+		typ = ArgTypeInt32
+		payload = binary.BigEndian.AppendUint32(payload, uint32(v))
+	case uint32:
+		typ = ArgTypeInt32
+		payload = binary.BigEndian.AppendUint32(payload, v)
+	case int:
+		typ = ArgTypeInt64
+		payload = binary.BigEndian.AppendUint64(payload, uint64(v))
+	case int64:
+		typ = ArgTypeInt64
+		payload = binary.BigEndian.AppendUint64(payload, uint64(v))
+	case uint64:
+		typ = ArgTypeInt64
+		payload = binary.BigEndian.AppendUint64(payload, v)
+	case float64:
+		typ = ArgTypeDouble
+		payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(v))
+	case map[string]any:
+		typ = ArgTypeTable
+		payload, err = appendBlobmsgTable(payload, v)
+	case []any:
+		typ = ArgTypeArray
+		for _, elem := range v {
+			payload, err = appendBlobmsg(payload, "", elem)
+			if err != nil {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("value of %q: unsupported type %T", name, val)
+	}
+
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return appendBlobAttr(b, uint8(typ), true, payload), nil
+}
+
+// appendBlobmsgTable appends the blobmsg attributes of the table to b sorted
+// by the names.
+func appendBlobmsgTable(b []byte, table map[string]any) (res []byte, err error) {
+	names := maps.Keys(table)
+	slices.Sort(names)
+	for _, name := range names {
+		b, err = appendBlobmsg(b, name, table[name])
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// boolToByte returns 1 if v is true and 0 otherwise.
+func boolToByte(v bool) (b byte) {
+	if v {
+		return 1
+	}
+
+	return 0
+}
+
+// decodeBlobmsg decodes the name and the value of the blobmsg attribute a.
+// The integers are decoded as int64, except the 8-bit ones, which are decoded
+// as bool, since it's how the booleans are encoded.
+func decodeBlobmsg(a *blobAttr) (name string, val any, err error) {
+	if !a.extended {
+		return "", nil, errors.Error("not a blobmsg attribute")
+	} else if len(a.data) < 2 {
+		return "", nil, errors.Error("header: unexpected end of data")
+	}
+
+	nameLen := int(binary.BigEndian.Uint16(a.data))
+	hdrLen := padLen(2 + nameLen + 1)
+	if hdrLen > len(a.data) {
+		return "", nil, fmt.Errorf("name length: bad value %d", nameLen)
+	}
+
+	name = string(a.data[2 : 2+nameLen])
+	data := a.data[hdrLen:]
+
+	val, err = decodeBlobmsgValue(ArgType(a.id), data)
+	if err != nil {
+		return "", nil, fmt.Errorf("value of %q: %w", name, err)
+	}
+
+	return name, val, nil
+}
+
+// decodeBlobmsgValue decodes the blobmsg value of the type from data.
+func decodeBlobmsgValue(typ ArgType, data []byte) (val any, err error) {
+	wantLen := map[ArgType]int{
+		ArgTypeInt64:  8,
+		ArgTypeInt32:  4,
+		ArgTypeInt16:  2,
+		ArgTypeInt8:   1,
+		ArgTypeDouble: 8,
+	}[typ]
+	if len(data) < wantLen {
+		return nil, fmt.Errorf("type %d: unexpected end of data", typ)
+	}
+
+	switch typ {
+	case ArgTypeString:
+		return cString(data), nil
+	case ArgTypeInt64:
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case ArgTypeInt32:
+		return int64(int32(binary.BigEndian.Uint32(data))), nil
+	case ArgTypeInt16:
+		return int64(int16(binary.BigEndian.Uint16(data))), nil
+	case ArgTypeInt8:
+		return data[0] != 0, nil
+	case ArgTypeDouble:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case ArgTypeTable:
+		return decodeBlobmsgTable(data)
+	case ArgTypeArray:
+		return decodeBlobmsgArray(data)
+	case ArgTypeUnspec:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %d", typ)
+	}
+}
+
+// decodeBlobmsgTable decodes the blobmsg table from data.
+func decodeBlobmsgTable(data []byte) (table map[string]any, err error) {
+	attrs, err := parseBlobAttrs(data)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	table = make(map[string]any, len(attrs))
+	for _, a := range attrs {
+		var name string
+		var val any
+		name, val, err = decodeBlobmsg(a)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return nil, err
+		}
+
+		table[name] = val
+	}
+
+	return table, nil
+}
+
+// decodeBlobmsgArray decodes the blobmsg array from data.
+func decodeBlobmsgArray(data []byte) (arr []any, err error) {
+	attrs, err := parseBlobAttrs(data)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	arr = make([]any, 0, len(attrs))
+	for i, a := range attrs {
+		var val any
+		_, val, err = decodeBlobmsg(a)
+		if err != nil {
+			return nil, fmt.Errorf("element at index %d: %w", i, err)
+		}
+
+		arr = append(arr, val)
+	}
+
+	return arr, nil
+}
+
+// cString returns the string from the possibly NUL-terminated data.
+func cString(data []byte) (s string) {
+	s, _, _ = strings.Cut(string(data), "\x00")
+
+	return s
+}
@@ -0,0 +1,517 @@
+// Package openwrt contains the integration with the OpenWrt system services:
+// the ubus message bus and the UCI configuration.
+package openwrt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// Ubus message types.
+const (
+	ubusMsgHello     uint8 = 0
+	ubusMsgStatus    uint8 = 1
+	ubusMsgData      uint8 = 2
+	ubusMsgInvoke    uint8 = 5
+	ubusMsgAddObject uint8 = 6
+)
+
+// Ubus message attributes.
+const (
+	ubusAttrStatus    uint8 = 1
+	ubusAttrObjPath   uint8 = 2
+	ubusAttrObjID     uint8 = 3
+	ubusAttrMethod    uint8 = 4
+	ubusAttrSignature uint8 = 6
+	ubusAttrData      uint8 = 7
+	ubusAttrNoReply   uint8 = 10
+)
+
+// Ubus statuses.
+const (
+	ubusStatusOK              uint32 = 0
+	ubusStatusInvalidArgument uint32 = 2
+	ubusStatusMethodNotFound  uint32 = 3
+	ubusStatusUnknownError    uint32 = 9
+)
+
+// ubusMsgHdrLen is the length of the header of a ubus message.
+const ubusMsgHdrLen = 8
+
+// ubusMaxMsgLen is the maximum length of a ubus message accepted.
+const ubusMaxMsgLen = 1 << 20
+
+// DefaultUbusSocketPaths are the paths of the ubus socket in the order they're
+// tried, if the socket path isn't configured.  The latter one is used by the
+// versions of OpenWrt before 21.02.
+var DefaultUbusSocketPaths = []string{
+	"/var/run/ubus/ubus.sock",
+	"/var/run/ubus.sock",
+}
+
+// ErrInvalidArgument is returned by the method handlers when the arguments of
+// the call are invalid.
+const ErrInvalidArgument errors.Error = "invalid argument"
+
+// MethodHandler handles a call of a ubus method with args and returns the data
+// of the reply.  res may be nil.
+type MethodHandler func(ctx context.Context, args map[string]any) (res map[string]any, err error)
+
+// Method is a method of a ubus object.
+type Method struct {
+	// Handler handles the calls of the method.  It must not be nil.
+	Handler MethodHandler
+
+	// Policy maps the names of the arguments of the method to their types.
+	// It's used for the introspection by the ubus clients.
+	Policy map[string]ArgType
+}
+
+// UbusConfig is the configuration of a ubus object.
+type UbusConfig struct {
+	// Logger is used to log the operation of the object.  It must not be nil.
+	Logger *slog.Logger
+
+	// Methods maps the names of the methods to their definitions.  It must not
+	// be empty.
+	Methods map[string]*Method
+
+	// Name is the path of the object, for example "adguardhome".  It must not
+	// be empty.
+	Name string
+
+	// SocketPath is the path of the ubus socket.  If empty,
+	// [DefaultUbusSocketPaths] are tried.
+	SocketPath string
+
+	// RetryIvl is the time between the attempts to connect to ubus after the
+	// connection is lost.  It must be positive.
+	RetryIvl time.Duration
+}
+
+// UbusObject is an object registered on the ubus bus.  It reconnects to the
+// bus, if the connection is lost.
+type UbusObject struct {
+	logger  *slog.Logger
+	methods map[string]*Method
+
+	// done is the shutdown signaling channel.
+	done chan struct{}
+
+	// connMu protects conn.
+	connMu *sync.Mutex
+	conn   net.Conn
+
+	name       string
+	socketPath string
+	retryIvl   time.Duration
+
+	// id is the identifier of the registered object assigned by ubusd.  It's
+	// only accessed from the serving goroutine.
+	id uint32
+
+	// seq is the sequence number of the last request sent.  It's only
+	// accessed from the serving goroutine.
+	seq uint16
+}
+
+// NewUbusObject returns a new properly initialized *UbusObject.  conf must not
+// be nil.
+func NewUbusObject(conf *UbusConfig) (o *UbusObject) {
+	return &UbusObject{
+		logger:     conf.Logger,
+		methods:    conf.Methods,
+		done:       make(chan struct{}),
+		connMu:     &sync.Mutex{},
+		name:       conf.Name,
+		socketPath: conf.SocketPath,
+		retryIvl:   conf.RetryIvl,
+	}
+}
+
+// Start starts the goroutine connecting to ubus and serving the calls.
+func (o *UbusObject) Start(ctx context.Context) (err error) {
+	go o.serve(ctx)
+
+	return nil
+}
+
+// Shutdown disconnects from ubus and stops serving the calls.
+func (o *UbusObject) Shutdown(_ context.Context) (err error) {
+	close(o.done)
+
+	o.connMu.Lock()
+	defer o.connMu.Unlock()
+
+	if o.conn != nil {
+		return o.conn.Close()
+	}
+
+	return nil
+}
+
+// serve connects to ubus, registers the object, and serves the calls, until o
+// is shut down.  It is intended to be used as a goroutine.
+func (o *UbusObject) serve(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, o.logger)
+
+	for {
+		err := o.connectAndServe(ctx)
+		select {
+		case <-o.done:
+			return
+		default:
+			o.logger.WarnContext(ctx, "serving", "retry_ivl", o.retryIvl, slogutil.KeyError, err)
+		}
+
+		select {
+		case <-time.After(o.retryIvl):
+			// Go on.
+		case <-o.done:
+			return
+		}
+	}
+}
+
+// connectAndServe connects to ubus, registers the object, and serves the calls
+// until the connection is closed.
+func (o *UbusObject) connectAndServe(ctx context.Context) (err error) {
+	conn, err := o.dial()
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+
+	if !o.setConn(conn) {
+		return conn.Close()
+	}
+	defer func() { err = errors.WithDeferred(err, o.closeConn(conn)) }()
+
+	err = o.register(conn)
+	if err != nil {
+		return fmt.Errorf("registering object %q: %w", o.name, err)
+	}
+
+	o.logger.InfoContext(ctx, "registered object", "name", o.name, "id", o.id)
+
+	for {
+		var msg *ubusMsg
+		msg, err = readUbusMsg(conn)
+		if err != nil {
+			return fmt.Errorf("reading message: %w", err)
+		}
+
+		if msg.typ != ubusMsgInvoke {
+			o.logger.DebugContext(ctx, "ignoring message", "type", msg.typ)
+
+			continue
+		}
+
+		err = o.handleInvoke(ctx, conn, msg)
+		if err != nil {
+			return fmt.Errorf("handling call: %w", err)
+		}
+	}
+}
+
+// dial connects to the configured ubus socket or the first of the default ones
+// available and consumes the greeting.
+func (o *UbusObject) dial() (conn net.Conn, err error) {
+	paths := DefaultUbusSocketPaths
+	if o.socketPath != "" {
+		paths = []string{o.socketPath}
+	}
+
+	var errs []error
+	for _, p := range paths {
+		conn, err = net.Dial("unix", p)
+		if err == nil {
+			break
+		}
+
+		errs = append(errs, err)
+	}
+
+	if conn == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	msg, err := readUbusMsg(conn)
+	if err != nil {
+		err = fmt.Errorf("reading hello: %w", err)
+	} else if msg.typ != ubusMsgHello {
+		err = fmt.Errorf("reading hello: unexpected message type %d", msg.typ)
+	}
+
+	if err != nil {
+		return nil, errors.WithDeferred(err, conn.Close())
+	}
+
+	return conn, nil
+}
+
+// setConn sets the current connection and returns false if o is shut down.
+func (o *UbusObject) setConn(conn net.Conn) (ok bool) {
+	o.connMu.Lock()
+	defer o.connMu.Unlock()
+
+	select {
+	case <-o.done:
+		return false
+	default:
+		o.conn = conn
+
+		return true
+	}
+}
+
+// closeConn closes the current connection, unless it's already closed by
+// [UbusObject.Shutdown].
+func (o *UbusObject) closeConn(conn net.Conn) (err error) {
+	o.connMu.Lock()
+	defer o.connMu.Unlock()
+
+	o.conn = nil
+
+	select {
+	case <-o.done:
+		return nil
+	default:
+		return conn.Close()
+	}
+}
+
+// register sends the request to add the object with its signature and waits
+// for the result.
+func (o *UbusObject) register(conn net.Conn) (err error) {
+	sig, err := o.signature()
+	if err != nil {
+		return fmt.Errorf("encoding signature: %w", err)
+	}
+
+	var body []byte
+	body = appendBlobString(body, ubusAttrObjPath, o.name)
+	body = appendBlobAttr(body, ubusAttrSignature, false, sig)
+
+	o.seq++
+	seq := o.seq
+	err = writeUbusMsg(conn, &ubusMsg{body: body, typ: ubusMsgAddObject, seq: seq})
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+
+	for {
+		var msg *ubusMsg
+		msg, err = readUbusMsg(conn)
+		if err != nil {
+			return fmt.Errorf("reading response: %w", err)
+		} else if msg.seq != seq {
+			continue
+		}
+
+		switch msg.typ {
+		case ubusMsgData:
+			if id, ok := msg.attrU32(ubusAttrObjID); ok {
+				o.id = id
+			}
+		case ubusMsgStatus:
+			status, _ := msg.attrU32(ubusAttrStatus)
+			if status != ubusStatusOK {
+				return fmt.Errorf("status %d", status)
+			}
+
+			return nil
+		}
+	}
+}
+
+// signature returns the encoded signature of the methods of the object.
+func (o *UbusObject) signature() (sig []byte, err error) {
+	methods := make(map[string]any, len(o.methods))
+	for name, m := range o.methods {
+		policy := make(map[string]any, len(m.Policy))
+		for arg, typ := range m.Policy {
+			policy[arg] = uint32(typ)
+		}
+
+		methods[name] = policy
+	}
+
+	return appendBlobmsgTable(nil, methods)
+}
+
+// handleInvoke calls the method requested by msg and sends the reply.
+func (o *UbusObject) handleInvoke(ctx context.Context, conn net.Conn, msg *ubusMsg) (err error) {
+	status, res := o.call(ctx, msg)
+
+	if _, noReply := msg.attr(ubusAttrNoReply); noReply {
+		return nil
+	}
+
+	if res != nil {
+		var data []byte
+		data, err = appendBlobmsgTable(nil, res)
+		if err != nil {
+			o.logger.ErrorContext(ctx, "encoding reply", slogutil.KeyError, err)
+
+			status = ubusStatusUnknownError
+		} else {
+			var body []byte
+			body = appendBlobU32(body, ubusAttrObjID, o.id)
+			body = appendBlobAttr(body, ubusAttrData, false, data)
+
+			err = writeUbusMsg(conn, &ubusMsg{body: body, typ: ubusMsgData, seq: msg.seq, peer: msg.peer})
+			if err != nil {
+				return fmt.Errorf("sending data: %w", err)
+			}
+		}
+	}
+
+	var body []byte
+	body = appendBlobU32(body, ubusAttrStatus, status)
+	body = appendBlobU32(body, ubusAttrObjID, o.id)
+
+	err = writeUbusMsg(conn, &ubusMsg{body: body, typ: ubusMsgStatus, seq: msg.seq, peer: msg.peer})
+	if err != nil {
+		return fmt.Errorf("sending status: %w", err)
+	}
+
+	return nil
+}
+
+// call calls the method requested by msg and returns the ubus status and the
+// result.
+func (o *UbusObject) call(ctx context.Context, msg *ubusMsg) (status uint32, res map[string]any) {
+	methodAttr, _ := msg.attr(ubusAttrMethod)
+	if methodAttr == nil {
+		return ubusStatusInvalidArgument, nil
+	}
+
+	name := cString(methodAttr.data)
+	m, ok := o.methods[name]
+	if !ok {
+		return ubusStatusMethodNotFound, nil
+	}
+
+	args := map[string]any{}
+	if dataAttr, _ := msg.attr(ubusAttrData); dataAttr != nil {
+		var err error
+		args, err = decodeBlobmsgTable(dataAttr.data)
+		if err != nil {
+			o.logger.DebugContext(ctx, "decoding arguments", "method", name, slogutil.KeyError, err)
+
+			return ubusStatusInvalidArgument, nil
+		}
+	}
+
+	res, err := m.Handler(ctx, args)
+	if errors.Is(err, ErrInvalidArgument) {
+		o.logger.DebugContext(ctx, "calling method", "method", name, slogutil.KeyError, err)
+
+		return ubusStatusInvalidArgument, nil
+	} else if err != nil {
+		o.logger.ErrorContext(ctx, "calling method", "method", name, slogutil.KeyError, err)
+
+		return ubusStatusUnknownError, nil
+	}
+
+	return ubusStatusOK, res
+}
+
+// ubusMsg is a ubus message.
+type ubusMsg struct {
+	// body is the payload of the blob attribute following the header, that
+	// is the sequence of the message attributes.
+	body []byte
+
+	// attrs are the parsed attributes of body.  It's only set for the
+	// received messages.
+	attrs []*blobAttr
+
+	peer uint32
+	seq  uint16
+	typ  uint8
+}
+
+// attr returns the first attribute of the message with the id.
+func (msg *ubusMsg) attr(id uint8) (a *blobAttr, ok bool) {
+	for _, a = range msg.attrs {
+		if a.id == id {
+			return a, true
+		}
+	}
+
+	return nil, false
+}
+
+// attrU32 returns the value of the first 32-bit attribute of the message with
+// the id.
+func (msg *ubusMsg) attrU32(id uint8) (v uint32, ok bool) {
+	a, ok := msg.attr(id)
+	if !ok || len(a.data) < 4 {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(a.data), true
+}
+
+// readUbusMsg reads a ubus message from r.
+func readUbusMsg(r io.Reader) (msg *ubusMsg, err error) {
+	hdr := make([]byte, ubusMsgHdrLen+blobAttrHdrLen)
+	_, err = io.ReadFull(r, hdr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	l := int(binary.BigEndian.Uint32(hdr[ubusMsgHdrLen:]) & blobAttrLenMask)
+	if l < blobAttrHdrLen || l > ubusMaxMsgLen {
+		return nil, fmt.Errorf("message length: bad value %d", l)
+	}
+
+	body := make([]byte, l-blobAttrHdrLen)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	attrs, err := parseBlobAttrs(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing body: %w", err)
+	}
+
+	return &ubusMsg{
+		body:  body,
+		attrs: attrs,
+		peer:  binary.BigEndian.Uint32(hdr[4:]),
+		seq:   binary.BigEndian.Uint16(hdr[2:]),
+		typ:   hdr[1],
+	}, nil
+}
+
+// writeUbusMsg writes msg to w.
+func writeUbusMsg(w io.Writer, msg *ubusMsg) (err error) {
+	b := make([]byte, ubusMsgHdrLen, ubusMsgHdrLen+blobAttrHdrLen+len(msg.body))
+
+	// The first byte is the version of the protocol, which is zero.
+	b[1] = msg.typ
+	binary.BigEndian.PutUint16(b[2:], msg.seq)
+	binary.BigEndian.PutUint32(b[4:], msg.peer)
+
+	// Unlike the nested attributes, the attribute containing the body isn't
+	// padded.
+	b = binary.BigEndian.AppendUint32(b, uint32(blobAttrHdrLen+len(msg.body)))
+	b = append(b, msg.body...)
+
+	_, err = w.Write(b)
+
+	return err
+}
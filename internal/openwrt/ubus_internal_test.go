@@ -0,0 +1,197 @@
+package openwrt
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+func TestBlobmsg_roundTrip(t *testing.T) {
+	want := map[string]any{
+		"bool":   true,
+		"int":    int64(-42),
+		"string": "value",
+		"double": 1.5,
+		"table": map[string]any{
+			"nested": "value",
+		},
+		"array": []any{"a", int64(1)},
+	}
+
+	data, err := appendBlobmsgTable(nil, want)
+	require.NoError(t, err)
+
+	got, err := decodeBlobmsgTable(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, got)
+
+	_, err = appendBlobmsgTable(nil, map[string]any{"bad": struct{}{}})
+	assert.Error(t, err)
+}
+
+// fakeUbusd listens on the socket at path and sends the first accepted
+// connection to conns.
+func fakeUbusd(t *testing.T, path string) (conns <-chan net.Conn) {
+	t.Helper()
+
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	ch := make(chan net.Conn, 1)
+	go func() {
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+
+		ch <- conn
+	}()
+
+	return ch
+}
+
+func TestUbusObject(t *testing.T) {
+	const (
+		peerID = 0x1234
+		objID  = 0x5678
+	)
+
+	sockPath := filepath.Join(t.TempDir(), "ubus.sock")
+	conns := fakeUbusd(t, sockPath)
+
+	var gotArgs map[string]any
+	o := NewUbusObject(&UbusConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		Methods: map[string]*Method{
+			"echo": {
+				Handler: func(_ context.Context, args map[string]any) (res map[string]any, err error) {
+					gotArgs = args
+
+					return map[string]any{"value": args["value"]}, nil
+				},
+				Policy: map[string]ArgType{"value": ArgTypeString},
+			},
+			"fail": {
+				Handler: func(_ context.Context, _ map[string]any) (res map[string]any, err error) {
+					return nil, ErrInvalidArgument
+				},
+			},
+		},
+		Name:       "test",
+		SocketPath: sockPath,
+		RetryIvl:   testTimeout,
+	})
+
+	ctx := context.Background()
+	require.NoError(t, o.Start(ctx))
+	testutil.CleanupAndRequireSuccess(t, func() (err error) { return o.Shutdown(ctx) })
+
+	conn, ok := testutil.RequireReceive(t, conns, testTimeout)
+	require.True(t, ok)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(testTimeout)))
+
+	err := writeUbusMsg(conn, &ubusMsg{typ: ubusMsgHello, peer: peerID})
+	require.NoError(t, err)
+
+	add, err := readUbusMsg(conn)
+	require.NoError(t, err)
+	require.Equal(t, ubusMsgAddObject, add.typ)
+
+	path, ok := add.attr(ubusAttrObjPath)
+	require.True(t, ok)
+
+	assert.Equal(t, "test", cString(path.data))
+
+	sigAttr, ok := add.attr(ubusAttrSignature)
+	require.True(t, ok)
+
+	sig, err := decodeBlobmsgTable(sigAttr.data)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"echo": map[string]any{"value": int64(ArgTypeString)},
+		"fail": map[string]any{},
+	}, sig)
+
+	var body []byte
+	body = appendBlobU32(body, ubusAttrObjID, objID)
+	require.NoError(t, writeUbusMsg(conn, &ubusMsg{body: body, typ: ubusMsgData, seq: add.seq}))
+
+	body = appendBlobU32(nil, ubusAttrStatus, ubusStatusOK)
+	require.NoError(t, writeUbusMsg(conn, &ubusMsg{body: body, typ: ubusMsgStatus, seq: add.seq}))
+
+	invoke := func(t *testing.T, method string, seq uint16, args map[string]any) {
+		t.Helper()
+
+		data, aErr := appendBlobmsgTable(nil, args)
+		require.NoError(t, aErr)
+
+		var b []byte
+		b = appendBlobU32(b, ubusAttrObjID, objID)
+		b = appendBlobString(b, ubusAttrMethod, method)
+		b = appendBlobAttr(b, ubusAttrData, false, data)
+
+		aErr = writeUbusMsg(conn, &ubusMsg{body: b, typ: ubusMsgInvoke, seq: seq, peer: peerID})
+		require.NoError(t, aErr)
+	}
+
+	t.Run("echo", func(t *testing.T) {
+		invoke(t, "echo", 10, map[string]any{"value": "hello"})
+
+		data, rErr := readUbusMsg(conn)
+		require.NoError(t, rErr)
+		require.Equal(t, ubusMsgData, data.typ)
+
+		assert.Equal(t, uint16(10), data.seq)
+		assert.Equal(t, uint32(peerID), data.peer)
+
+		resAttr, ok := data.attr(ubusAttrData)
+		require.True(t, ok)
+
+		res, rErr := decodeBlobmsgTable(resAttr.data)
+		require.NoError(t, rErr)
+
+		assert.Equal(t, map[string]any{"value": "hello"}, res)
+		assert.Equal(t, map[string]any{"value": "hello"}, gotArgs)
+
+		status, rErr := readUbusMsg(conn)
+		require.NoError(t, rErr)
+		require.Equal(t, ubusMsgStatus, status.typ)
+
+		code, _ := status.attrU32(ubusAttrStatus)
+		assert.Equal(t, ubusStatusOK, code)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		invoke(t, "fail", 11, nil)
+
+		status, rErr := readUbusMsg(conn)
+		require.NoError(t, rErr)
+		require.Equal(t, ubusMsgStatus, status.typ)
+
+		code, _ := status.attrU32(ubusAttrStatus)
+		assert.Equal(t, ubusStatusInvalidArgument, code)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		invoke(t, "unknown", 12, nil)
+
+		status, rErr := readUbusMsg(conn)
+		require.NoError(t, rErr)
+
+		code, _ := status.attrU32(ubusAttrStatus)
+		assert.Equal(t, ubusStatusMethodNotFound, code)
+	})
+}
@@ -0,0 +1,424 @@
+package openwrt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// UCISection is a section of a UCI configuration file.
+type UCISection struct {
+	// Options are the values of the options of the section.
+	Options map[string]string
+
+	// Lists are the values of the list options of the section.
+	Lists map[string][]string
+
+	// Type is the type of the section, for example "interface".
+	Type string
+
+	// Name is the name of the section.  It's empty for the anonymous
+	// sections.
+	Name string
+}
+
+// ParseUCI parses the UCI configuration file from r.  See
+// https://openwrt.org/docs/guide-user/base-system/uci#file_syntax.
+func ParseUCI(r io.Reader) (sections []*UCISection, err error) {
+	var cur *UCISection
+
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		var fields []string
+		fields, err = splitUCILine(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		} else if len(fields) == 0 {
+			continue
+		}
+
+		cur, err = parseUCIFields(cur, fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		if cur != nil && (len(sections) == 0 || sections[len(sections)-1] != cur) {
+			sections = append(sections, cur)
+		}
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return sections, nil
+}
+
+// parseUCIFields applies the statement of the fields to the current section
+// cur and returns the new current section.
+func parseUCIFields(cur *UCISection, fields []string) (next *UCISection, err error) {
+	keyword := fields[0]
+	switch keyword {
+	case "package":
+		return cur, nil
+	case "config":
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("config: bad number of fields %d", len(fields))
+		}
+
+		next = &UCISection{
+			Options: map[string]string{},
+			Lists:   map[string][]string{},
+			Type:    fields[1],
+		}
+		if len(fields) == 3 {
+			next.Name = fields[2]
+		}
+
+		return next, nil
+	case "option", "list":
+		if cur == nil {
+			return nil, fmt.Errorf("%s: outside of section", keyword)
+		} else if len(fields) != 3 {
+			return nil, fmt.Errorf("%s: bad number of fields %d", keyword, len(fields))
+		}
+
+		if keyword == "option" {
+			cur.Options[fields[1]] = fields[2]
+		} else {
+			cur.Lists[fields[1]] = append(cur.Lists[fields[1]], fields[2])
+		}
+
+		return cur, nil
+	default:
+		return nil, fmt.Errorf("unknown keyword %q", keyword)
+	}
+}
+
+// splitUCILine splits the UCI line into the fields, removing the quotes and
+// the comments.
+func splitUCILine(line string) (fields []string, err error) {
+	var (
+		sb      strings.Builder
+		quote   rune
+		inField bool
+		escaped bool
+	)
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			sb.WriteRune(c)
+			escaped = false
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inField = c, true
+		case c == '\\':
+			escaped, inField = true, true
+		case c == '#' && !inField:
+			return fields, nil
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, sb.String())
+				sb.Reset()
+				inField = false
+			}
+		default:
+			sb.WriteRune(c)
+			inField = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.Error("unterminated quote")
+	}
+
+	if inField {
+		fields = append(fields, sb.String())
+	}
+
+	return fields, nil
+}
+
+// Default values of the UCI DHCP options.
+const (
+	defaultDHCPStart     = 100
+	defaultDHCPLimit     = 150
+	defaultDHCPLeaseTime = 12 * time.Hour
+)
+
+// LANConfig is the configuration of the LAN interface of an OpenWrt router.
+type LANConfig struct {
+	// Device is the name of the network device of the interface, for example
+	// "br-lan".
+	Device string
+
+	// IPAddr is the IPv4 address of the router on the interface.
+	IPAddr netip.Addr
+
+	// Netmask is the IPv4 subnet mask of the interface.
+	Netmask netip.Addr
+
+	// DHCPStart is the first address of the DHCP range, it's invalid if the
+	// DHCP service is disabled on the interface.
+	DHCPStart netip.Addr
+
+	// DHCPEnd is the last address of the DHCP range, it's invalid if the DHCP
+	// service is disabled on the interface.
+	DHCPEnd netip.Addr
+
+	// LeaseTime is the duration of the DHCP leases.  It's zero if the leases
+	// never expire.
+	LeaseTime time.Duration
+}
+
+// ReadLAN reads the configuration of the interface with the name, typically
+// "lan", from the UCI configuration files network and dhcp located in
+// etc/config of fsys.  A missing dhcp file means that the DHCP service isn't
+// configured.
+func ReadLAN(fsys fs.FS, name string) (lan *LANConfig, err error) {
+	network, err := readUCIFile(fsys, "etc/config/network")
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	iface := findUCISection(network, "interface", func(sec *UCISection) (ok bool) {
+		return sec.Name == name
+	})
+	if iface == nil {
+		return nil, fmt.Errorf("network: no interface %q", name)
+	}
+
+	lan = &LANConfig{
+		Device: iface.Options["device"],
+	}
+	if lan.Device == "" {
+		// The versions of OpenWrt before 21.02 use the ifname option.
+		lan.Device, _, _ = strings.Cut(iface.Options["ifname"], " ")
+	}
+
+	prefix, err := uciIPv4Prefix(iface)
+	if err != nil {
+		return nil, fmt.Errorf("network: interface %q: %w", name, err)
+	}
+
+	lan.IPAddr = prefix.Addr()
+	lan.Netmask = netmaskFromBits(prefix.Bits())
+
+	dhcp, err := readUCIFile(fsys, "etc/config/dhcp")
+	if errors.Is(err, fs.ErrNotExist) {
+		return lan, nil
+	} else if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	pool := findUCISection(dhcp, "dhcp", func(sec *UCISection) (ok bool) {
+		return sec.Options["interface"] == name
+	})
+	if pool == nil || pool.Options["ignore"] == "1" {
+		return lan, nil
+	}
+
+	err = lan.setDHCP(pool, prefix.Masked())
+	if err != nil {
+		return nil, fmt.Errorf("dhcp: interface %q: %w", name, err)
+	}
+
+	return lan, nil
+}
+
+// setDHCP sets the DHCP settings of lan from the UCI section of the pool on
+// the subnet.
+func (lan *LANConfig) setDHCP(pool *UCISection, subnet netip.Prefix) (err error) {
+	start, err := uciUint(pool, "start", defaultDHCPStart)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	limit, err := uciUint(pool, "limit", defaultDHCPLimit)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	} else if limit == 0 {
+		return errors.Error("limit: must be positive")
+	}
+
+	base := subnet.Addr().As4()
+	first := binary.BigEndian.Uint32(base[:]) + uint32(start)
+
+	lan.DHCPStart = netip.AddrFrom4([4]byte(binary.BigEndian.AppendUint32(nil, first)))
+	lan.DHCPEnd = netip.AddrFrom4([4]byte(binary.BigEndian.AppendUint32(nil, first+uint32(limit)-1)))
+	if !subnet.Contains(lan.DHCPStart) || !subnet.Contains(lan.DHCPEnd) {
+		return fmt.Errorf("range %s-%s: not within subnet %s", lan.DHCPStart, lan.DHCPEnd, subnet)
+	}
+
+	lan.LeaseTime, err = parseUCILeaseTime(pool.Options["leasetime"])
+	if err != nil {
+		return fmt.Errorf("leasetime: %w", err)
+	}
+
+	return nil
+}
+
+// readUCIFile parses the UCI configuration file at path within fsys.
+func readUCIFile(fsys fs.FS, path string) (sections []*UCISection, err error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	sections, err = ParseUCI(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+
+	return sections, nil
+}
+
+// findUCISection returns the first section of the type matched by match or nil
+// if there is none.
+func findUCISection(
+	sections []*UCISection,
+	typ string,
+	match func(sec *UCISection) (ok bool),
+) (sec *UCISection) {
+	for _, sec = range sections {
+		if sec.Type == typ && match(sec) {
+			return sec
+		}
+	}
+
+	return nil
+}
+
+// uciIPv4Prefix returns the IPv4 address of the interface section and its
+// subnet.  The newer versions of OpenWrt may set the address in the CIDR
+// notation or as a list.
+func uciIPv4Prefix(iface *UCISection) (prefix netip.Prefix, err error) {
+	ipaddr := iface.Options["ipaddr"]
+	if ipaddr == "" && len(iface.Lists["ipaddr"]) > 0 {
+		ipaddr = iface.Lists["ipaddr"][0]
+	}
+
+	if ipaddr == "" {
+		return netip.Prefix{}, errors.Error("ipaddr: empty value")
+	}
+
+	if strings.Contains(ipaddr, "/") {
+		prefix, err = netip.ParsePrefix(ipaddr)
+	} else {
+		prefix, err = prefixFromNetmask(ipaddr, iface.Options["netmask"])
+	}
+
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("ipaddr: %w", err)
+	} else if !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("ipaddr: %s is not an ipv4 address", prefix.Addr())
+	}
+
+	return prefix, nil
+}
+
+// prefixFromNetmask returns the prefix of the address and the subnet mask.
+func prefixFromNetmask(addr, netmask string) (prefix netip.Prefix, err error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return netip.Prefix{}, err
+	}
+
+	if netmask == "" {
+		return netip.Prefix{}, errors.Error("no netmask")
+	}
+
+	mask, err := netip.ParseAddr(netmask)
+	if err != nil || !mask.Is4() {
+		return netip.Prefix{}, fmt.Errorf("bad netmask %q", netmask)
+	}
+
+	// Size returns zero bits for the non-canonical masks.
+	ones, bits := net.IPMask(mask.AsSlice()).Size()
+	if bits == 0 {
+		return netip.Prefix{}, fmt.Errorf("bad netmask %q", netmask)
+	}
+
+	return netip.PrefixFrom(ip, ones), nil
+}
+
+// netmaskFromBits returns the IPv4 subnet mask with the number of leading
+// ones.
+func netmaskFromBits(bits int) (mask netip.Addr) {
+	return netip.AddrFrom4([4]byte(net.CIDRMask(bits, 32)))
+}
+
+// uciUint returns the unsigned integer value of the option of the section or
+// def if it's not set.
+func uciUint(sec *UCISection, name string, def uint64) (v uint64, err error) {
+	s, ok := sec.Options[name]
+	if !ok {
+		return def, nil
+	}
+
+	v, err = strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return v, nil
+}
+
+// parseUCILeaseTime parses the duration of the DHCP leases in the dnsmasq
+// format used by UCI, for example "12h" or "3600".  It returns zero for
+// infinite leases.
+func parseUCILeaseTime(s string) (d time.Duration, err error) {
+	if s == "" {
+		return defaultDHCPLeaseTime, nil
+	} else if s == "infinite" {
+		return 0, nil
+	}
+
+	mul := time.Second
+	switch s[len(s)-1] {
+	case 'w':
+		mul = 7 * 24 * time.Hour
+	case 'd':
+		mul = 24 * time.Hour
+	case 'h':
+		mul = time.Hour
+	case 'm':
+		mul = time.Minute
+	case 's':
+		// Go on.
+	default:
+		s += "s"
+	}
+
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return 0, err
+	}
+
+	return time.Duration(n) * mul, nil
+}
@@ -0,0 +1,161 @@
+package openwrt_test
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/openwrt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork is the typical network configuration of an OpenWrt router.
+const testNetwork = `
+config interface 'loopback'
+	option device 'lo'
+	option proto 'static'
+	option ipaddr '127.0.0.1'
+	option netmask '255.0.0.0'
+
+config device
+	option name 'br-lan'
+	option type 'bridge'
+	list ports 'lan1'
+	list ports 'lan2'
+
+config interface 'lan'
+	option device 'br-lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+	option netmask '255.255.255.0'
+	option ip6assign '60'
+`
+
+// testDHCP is the typical DHCP configuration of an OpenWrt router.
+const testDHCP = `
+config dnsmasq
+	option domainneeded '1'
+	option local '/lan/'
+	option domain 'lan'
+
+config dhcp 'lan'
+	option interface 'lan'
+	option start '100'
+	option limit '150'
+	option leasetime '12h'
+
+config dhcp 'wan'
+	option interface 'wan'
+	option ignore '1'
+`
+
+func TestParseUCI(t *testing.T) {
+	const data = `package network
+# Comment
+config interface "lan" # Trailing comment
+	option ipaddr 192.168.1.1
+	option name 'with spaces'
+	option escaped "a \"quoted\" word"
+	list dns '1.1.1.1'
+	list dns "8.8.8.8"
+
+config globals
+	option ula_prefix 'fd00::/48'
+`
+
+	sections, err := openwrt.ParseUCI(strings.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*openwrt.UCISection{{
+		Options: map[string]string{
+			"ipaddr":  "192.168.1.1",
+			"name":    "with spaces",
+			"escaped": `a "quoted" word`,
+		},
+		Lists: map[string][]string{
+			"dns": {"1.1.1.1", "8.8.8.8"},
+		},
+		Type: "interface",
+		Name: "lan",
+	}, {
+		Options: map[string]string{
+			"ula_prefix": "fd00::/48",
+		},
+		Lists: map[string][]string{},
+		Type:  "globals",
+		Name:  "",
+	}}, sections)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err = openwrt.ParseUCI(strings.NewReader("option a 'b'\n"))
+		assert.Error(t, err)
+
+		_, err = openwrt.ParseUCI(strings.NewReader("config a\n\toption b 'c\n"))
+		assert.Error(t, err)
+
+		_, err = openwrt.ParseUCI(strings.NewReader("bad a b\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestReadLAN(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/config/network": &fstest.MapFile{Data: []byte(testNetwork)},
+		"etc/config/dhcp":    &fstest.MapFile{Data: []byte(testDHCP)},
+	}
+
+	lan, err := openwrt.ReadLAN(fsys, "lan")
+	require.NoError(t, err)
+
+	assert.Equal(t, &openwrt.LANConfig{
+		Device:    "br-lan",
+		IPAddr:    netip.MustParseAddr("192.168.1.1"),
+		Netmask:   netip.MustParseAddr("255.255.255.0"),
+		DHCPStart: netip.MustParseAddr("192.168.1.100"),
+		DHCPEnd:   netip.MustParseAddr("192.168.1.249"),
+		LeaseTime: 12 * time.Hour,
+	}, lan)
+
+	t.Run("cidr_no_dhcp", func(t *testing.T) {
+		const network = `
+config interface 'lan'
+	option ifname 'eth0 eth1'
+	option proto 'static'
+	list ipaddr '10.0.0.1/16'
+`
+
+		lan, err = openwrt.ReadLAN(fstest.MapFS{
+			"etc/config/network": &fstest.MapFile{Data: []byte(network)},
+		}, "lan")
+		require.NoError(t, err)
+
+		assert.Equal(t, &openwrt.LANConfig{
+			Device:  "eth0",
+			IPAddr:  netip.MustParseAddr("10.0.0.1"),
+			Netmask: netip.MustParseAddr("255.255.0.0"),
+		}, lan)
+	})
+
+	t.Run("no_interface", func(t *testing.T) {
+		_, err = openwrt.ReadLAN(fsys, "guest")
+		assert.Error(t, err)
+	})
+
+	t.Run("bad_range", func(t *testing.T) {
+		const dhcp = `
+config dhcp 'lan'
+	option interface 'lan'
+	option start '200'
+	option limit '100'
+`
+
+		_, err = openwrt.ReadLAN(fstest.MapFS{
+			"etc/config/network": &fstest.MapFile{Data: []byte(testNetwork)},
+			"etc/config/dhcp":    &fstest.MapFile{Data: []byte(dhcp)},
+		}, "lan")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,101 @@
+package pihole
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DefaultDir is the default directory of the Pi-hole configuration.
+const DefaultDir = "/etc/pihole"
+
+// Names of the Pi-hole files.
+const (
+	gravityFileName    = "gravity.db"
+	customListFileName = "custom.list"
+	cnameListFileName  = "05-pihole-custom-cname.conf"
+	settingsFileName   = "pihole.toml"
+)
+
+// ImportDir converts the local DNS and CNAME records from the files in dir,
+// usually [DefaultDir].  The missing files are skipped.  The CNAME records file
+// is also looked up in the dnsmasq.d directory next to dir.  The gravity
+// database isn't read, so the lists and the clients must be imported from the
+// Teleporter archive.
+func ImportDir(dir string) (conf *Config, err error) {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			err = errors.WithDeferred(err, f.Close())
+		}
+	}()
+
+	open := func(paths ...string) (r *os.File, err error) {
+		for _, p := range paths {
+			r, err = os.Open(p)
+			if err == nil {
+				files = append(files, r)
+
+				return r, nil
+			} else if !errors.Is(err, os.ErrNotExist) {
+				// Don't wrap the error, because it's informative enough as
+				// is.
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	src := &Source{}
+
+	readers := []struct {
+		dst   *io.Reader
+		paths []string
+	}{{
+		dst:   &src.CustomList,
+		paths: []string{filepath.Join(dir, customListFileName)},
+	}, {
+		dst: &src.CNAMEList,
+		paths: []string{
+			filepath.Join(dir, cnameListFileName),
+			filepath.Join(dir, "..", "dnsmasq.d", cnameListFileName),
+		},
+	}, {
+		dst:   &src.Settings,
+		paths: []string{filepath.Join(dir, settingsFileName)},
+	}}
+
+	for _, r := range readers {
+		var f *os.File
+		f, err = open(r.paths...)
+		if err != nil {
+			return nil, err
+		} else if f != nil {
+			*r.dst = f
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no pi-hole files in %q", dir)
+	}
+
+	conf, err = Import(src)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	_, err = os.Stat(filepath.Join(dir, gravityFileName))
+	if err == nil {
+		conf.warn(
+			"%s: the gravity database is not supported, import a teleporter archive",
+			gravityFileName,
+		)
+	}
+
+	return conf, nil
+}
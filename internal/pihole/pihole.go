@@ -0,0 +1,382 @@
+// Package pihole converts the filtering configuration of Pi-hole into the one
+// of AdGuard Home.
+package pihole
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Config is the filtering configuration converted from Pi-hole.
+type Config struct {
+	// Lists are the filter lists from the adlists.
+	Lists []*List
+
+	// Rules are the filtering rules converted from the domain lists.
+	Rules []string
+
+	// Rewrites are the rewrites converted from the local DNS and CNAME
+	// records.
+	Rewrites []*Rewrite
+
+	// Clients are the persistent clients converted from the clients.
+	Clients []*Client
+
+	// Warnings describe the entries which couldn't be converted and have been
+	// skipped.
+	Warnings []string
+}
+
+// List is a filter list.
+type List struct {
+	// URL is the URL of the list.
+	URL string
+
+	// Name is the name of the list.
+	Name string
+
+	// Enabled defines if the list is enabled.
+	Enabled bool
+
+	// Allowlist is true if the list is an allowlist.
+	Allowlist bool
+}
+
+// Rewrite is a DNS rewrite.
+type Rewrite struct {
+	// Domain is the domain name to rewrite.
+	Domain string
+
+	// Answer is the IP address or the domain name of the response.
+	Answer string
+}
+
+// Client is a persistent client.
+type Client struct {
+	// Name is the name of the client.
+	Name string
+
+	// IDs are the IP addresses, CIDRs, or MAC addresses of the client.
+	IDs []string
+}
+
+// Source contains the Pi-hole files to import.  All fields are optional.
+type Source struct {
+	// Teleporter is the Teleporter archive of Pi-hole v5, which contains the
+	// adlists, the domain lists, the clients, and the local DNS and CNAME
+	// records.
+	Teleporter io.Reader
+
+	// CustomList contains the local DNS records of Pi-hole v5, usually
+	// /etc/pihole/custom.list.
+	CustomList io.Reader
+
+	// CNAMEList contains the local CNAME records of Pi-hole v5, usually
+	// /etc/dnsmasq.d/05-pihole-custom-cname.conf.
+	CNAMEList io.Reader
+
+	// Settings is the configuration file of Pi-hole v6, usually
+	// /etc/pihole/pihole.toml, which contains the local DNS and CNAME records.
+	Settings io.Reader
+}
+
+// Import converts the Pi-hole configuration from src.
+func Import(src *Source) (conf *Config, err error) {
+	conf = &Config{}
+
+	if src.Teleporter != nil {
+		err = conf.importTeleporter(src.Teleporter)
+		if err != nil {
+			return nil, fmt.Errorf("teleporter archive: %w", err)
+		}
+	}
+
+	if src.CustomList != nil {
+		err = conf.importCustomList(src.CustomList)
+		if err != nil {
+			return nil, fmt.Errorf("custom list: %w", err)
+		}
+	}
+
+	if src.CNAMEList != nil {
+		err = conf.importCNAMEList(src.CNAMEList)
+		if err != nil {
+			return nil, fmt.Errorf("cname list: %w", err)
+		}
+	}
+
+	if src.Settings != nil {
+		err = conf.importSettings(src.Settings)
+		if err != nil {
+			return nil, fmt.Errorf("settings: %w", err)
+		}
+	}
+
+	return conf, nil
+}
+
+// warn adds a formatted warning to conf.
+func (conf *Config) warn(format string, args ...any) {
+	conf.Warnings = append(conf.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Types of the adlists.
+const (
+	adlistTypeBlock int64 = 0
+	adlistTypeAllow int64 = 1
+)
+
+// Types of the domain list entries.
+const (
+	domainTypeExactAllow int64 = 0
+	domainTypeExactDeny  int64 = 1
+	domainTypeRegexAllow int64 = 2
+	domainTypeRegexDeny  int64 = 3
+)
+
+// importAdlist converts a row of the adlist table.
+func (conf *Config) importAdlist(row *adlistRow) {
+	addr := row.Address
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		conf.warn("adlist %q: only http and https urls are supported", addr)
+
+		return
+	}
+
+	typ := row.Type
+	if typ != adlistTypeBlock && typ != adlistTypeAllow {
+		conf.warn("adlist %q: unsupported type %d", addr, typ)
+
+		return
+	}
+
+	name := row.Comment
+	if name == "" {
+		name = addr
+	}
+
+	conf.Lists = append(conf.Lists, &List{
+		URL:       addr,
+		Name:      name,
+		Enabled:   row.Enabled != 0,
+		Allowlist: typ == adlistTypeAllow,
+	})
+}
+
+// regexOptionsRe matches the Pi-hole extensions of the regular expression
+// syntax, which AdGuard Home doesn't support.
+var regexOptionsRe = regexp.MustCompile(`;(querytype|invert|reply)\b`)
+
+// importDomain converts a row of the domainlist table into a filtering rule.
+// The disabled entries are skipped.
+func (conf *Config) importDomain(row *domainRow) {
+	if row.Enabled == 0 {
+		return
+	}
+
+	domain := row.Domain
+	switch typ := row.Type; typ {
+	case domainTypeExactAllow:
+		conf.Rules = append(conf.Rules, "@@|"+domain+"^")
+	case domainTypeExactDeny:
+		conf.Rules = append(conf.Rules, "|"+domain+"^")
+	case domainTypeRegexAllow, domainTypeRegexDeny:
+		if regexOptionsRe.MatchString(domain) {
+			conf.warn("regex %q: pi-hole regex options are not supported", domain)
+
+			return
+		}
+
+		_, err := regexp.Compile(domain)
+		if err != nil {
+			conf.warn("regex %q: %s", domain, err)
+
+			return
+		}
+
+		rule := "/" + domain + "/"
+		if typ == domainTypeRegexAllow {
+			rule = "@@" + rule
+		}
+
+		conf.Rules = append(conf.Rules, rule)
+	default:
+		conf.warn("domain %q: unsupported type %d", domain, typ)
+	}
+}
+
+// importClient converts a row of the client table.
+func (conf *Config) importClient(row *clientRow) {
+	id := row.IP
+	if strings.HasPrefix(id, ":") {
+		conf.warn("client %q: interface clients are not supported", id)
+
+		return
+	}
+
+	name := row.Comment
+	if name == "" {
+		name = id
+	}
+
+	conf.Clients = append(conf.Clients, &Client{
+		Name: name,
+		IDs:  []string{id},
+	})
+}
+
+// importCustomList converts the local DNS records from the hosts-like file.
+func (conf *Config) importCustomList(r io.Reader) (err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		conf.importHostsLine(s.Text())
+	}
+
+	return s.Err()
+}
+
+// importHostsLine converts the hosts-like line with a local DNS record.
+func (conf *Config) importHostsLine(line string) {
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	} else if len(fields) == 1 {
+		conf.warn("dns record %q: no hostnames", line)
+
+		return
+	}
+
+	ip, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		conf.warn("dns record %q: %s", line, err)
+
+		return
+	}
+
+	for _, host := range fields[1:] {
+		conf.Rewrites = append(conf.Rewrites, &Rewrite{
+			Domain: host,
+			Answer: ip.String(),
+		})
+	}
+}
+
+// importCNAMEList converts the local CNAME records from the dnsmasq
+// configuration file.
+func (conf *Config) importCNAMEList(r io.Reader) (err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if rec, ok := strings.CutPrefix(line, "cname="); ok {
+			conf.importCNAME(rec)
+		}
+	}
+
+	return s.Err()
+}
+
+// importCNAME converts the CNAME record in the dnsmasq format, which is the
+// aliases and the target separated by commas, optionally followed by the TTL.
+func (conf *Config) importCNAME(rec string) {
+	parts := strings.Split(rec, ",")
+	if _, err := strconv.ParseUint(parts[len(parts)-1], 10, 32); err == nil {
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) < 2 {
+		conf.warn("cname record %q: no target", rec)
+
+		return
+	}
+
+	target := strings.TrimSpace(parts[len(parts)-1])
+	for _, alias := range parts[:len(parts)-1] {
+		conf.Rewrites = append(conf.Rewrites, &Rewrite{
+			Domain: strings.TrimSpace(alias),
+			Answer: target,
+		})
+	}
+}
+
+// importSettings converts the local DNS and CNAME records from the dns table
+// of the TOML configuration file of Pi-hole v6.  Only the string arrays of the
+// records are parsed.
+func (conf *Config) importSettings(r io.Reader) (err error) {
+	var (
+		table string
+		key   string
+	)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if key != "" {
+			if !conf.importSettingsValues(key, line) {
+				key = ""
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			table = strings.Trim(line, "[] ")
+
+			continue
+		} else if table != "dns" {
+			continue
+		}
+
+		k, val, ok := strings.Cut(line, "=")
+		k, val = strings.TrimSpace(k), strings.TrimSpace(val)
+		if !ok || (k != "hosts" && k != "cnameRecords") || !strings.HasPrefix(val, "[") {
+			continue
+		}
+
+		if conf.importSettingsValues(k, val[1:]) {
+			key = k
+		}
+	}
+
+	return s.Err()
+}
+
+// importSettingsValues converts the quoted strings in the part of the array
+// value of key from line.  more is true if the array continues on the next
+// line.
+func (conf *Config) importSettingsValues(key, line string) (more bool) {
+	for {
+		line = strings.TrimLeft(line, " \t,")
+		switch {
+		case line == "", line[0] == '#':
+			return true
+		case line[0] == ']':
+			return false
+		case line[0] != '"':
+			conf.warn("%s: unexpected value %q", key, line)
+
+			return false
+		}
+
+		end := strings.IndexByte(line[1:], '"') + 1
+		if end == 0 {
+			conf.warn("%s: unterminated string %q", key, line)
+
+			return false
+		}
+
+		val := line[1:end]
+		line = line[end+1:]
+
+		if key == "hosts" {
+			conf.importHostsLine(val)
+		} else {
+			conf.importCNAME(val)
+		}
+	}
+}
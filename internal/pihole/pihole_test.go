@@ -0,0 +1,261 @@
+package pihole_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTeleporter returns the gzipped tarball with files for tests.
+func newTestTeleporter(t *testing.T, files map[string]string) (data []byte) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(files[name])),
+		})
+		require.NoError(t, err)
+
+		_, err = io.WriteString(tw, files[name])
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func TestImport_teleporter(t *testing.T) {
+	data := newTestTeleporter(t, map[string]string{
+		"adlist.json": `[{
+			"id": 1,
+			"address": "https://raw.githubusercontent.com/StevenBlack/hosts/master/hosts",
+			"enabled": 1,
+			"comment": "Migrated from /etc/pihole/adlists.list"
+		}, {
+			"id": 2,
+			"address": "https://example.com/disabled.txt",
+			"enabled": 0,
+			"comment": null
+		}, {
+			"id": 3,
+			"address": "file:///etc/pihole/local.txt",
+			"enabled": 1,
+			"comment": ""
+		}]`,
+		"blacklist.exact.json": `[{"id": 1, "type": 1, "domain": "ads.example.com", "enabled": 1}]`,
+		"whitelist.exact.json": `[
+			{"id": 2, "type": 0, "domain": "allowed.example.com", "enabled": 1},
+			{"id": 3, "type": 0, "domain": "disabled.example.com", "enabled": 0}
+		]`,
+		"blacklist.regex.json": `[
+			{"id": 4, "type": 3, "domain": "(\\.|^)tracker\\.example$", "enabled": 1},
+			{"id": 5, "type": 3, "domain": "^aaaa\\.example;querytype=AAAA", "enabled": 1}
+		]`,
+		"whitelist.regex.json": `[
+			{"id": 6, "type": 2, "domain": "^cdn[0-9]+\\.example\\.net$", "enabled": 1}
+		]`,
+		"client.json": `[
+			{"id": 1, "ip": "192.168.1.10", "comment": "Laptop"},
+			{"id": 2, "ip": "aa:bb:cc:dd:ee:ff", "comment": null},
+			{"id": 3, "ip": ":eth0", "comment": "Interface"}
+		]`,
+		"custom.list":                           "192.168.1.1 router.lan\n",
+		"dnsmasq.d/05-pihole-custom-cname.conf": "cname=alias.lan,router.lan\n",
+		"group.json":                            `[{"id": 0, "name": "Default"}]`,
+		"setupVars.conf":                        "PIHOLE_INTERFACE=eth0\n",
+	})
+
+	conf, err := pihole.Import(&pihole.Source{
+		Teleporter: bytes.NewReader(data),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []*pihole.List{{
+		URL:       "https://raw.githubusercontent.com/StevenBlack/hosts/master/hosts",
+		Name:      "Migrated from /etc/pihole/adlists.list",
+		Enabled:   true,
+		Allowlist: false,
+	}, {
+		URL:       "https://example.com/disabled.txt",
+		Name:      "https://example.com/disabled.txt",
+		Enabled:   false,
+		Allowlist: false,
+	}}, conf.Lists)
+
+	assert.Equal(t, []string{
+		"|ads.example.com^",
+		`/(\.|^)tracker\.example$/`,
+		"@@|allowed.example.com^",
+		`@@/^cdn[0-9]+\.example\.net$/`,
+	}, conf.Rules)
+
+	assert.Equal(t, []*pihole.Client{{
+		Name: "Laptop",
+		IDs:  []string{"192.168.1.10"},
+	}, {
+		Name: "aa:bb:cc:dd:ee:ff",
+		IDs:  []string{"aa:bb:cc:dd:ee:ff"},
+	}}, conf.Clients)
+
+	assert.Equal(t, []*pihole.Rewrite{{
+		Domain: "router.lan",
+		Answer: "192.168.1.1",
+	}, {
+		Domain: "alias.lan",
+		Answer: "router.lan",
+	}}, conf.Rewrites)
+
+	assert.Len(t, conf.Warnings, 3)
+}
+
+func TestImport_records(t *testing.T) {
+	const customList = `# Local DNS records
+192.168.1.1 router.lan
+192.168.1.2 nas.lan files.lan
+bad.ip host.lan
+`
+
+	const cnameList = `cname=alias.lan,router.lan
+cname=a.lan,b.lan,nas.lan,300
+`
+
+	const settings = `[dns]
+  upstreams = [
+    "8.8.8.8"
+  ]
+  hosts = [
+    "192.168.1.3 printer.lan", # Printer
+    "fd00::1 v6.lan"
+  ] ### CHANGED, default = []
+  cnameRecords = [ "pr.lan,printer.lan" ]
+
+[dhcp]
+  hosts = [ "aa:bb:cc:dd:ee:ff,192.168.1.50" ]
+`
+
+	conf, err := pihole.Import(&pihole.Source{
+		CustomList: strings.NewReader(customList),
+		CNAMEList:  strings.NewReader(cnameList),
+		Settings:   strings.NewReader(settings),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []*pihole.Rewrite{{
+		Domain: "router.lan",
+		Answer: "192.168.1.1",
+	}, {
+		Domain: "nas.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "files.lan",
+		Answer: "192.168.1.2",
+	}, {
+		Domain: "alias.lan",
+		Answer: "router.lan",
+	}, {
+		Domain: "a.lan",
+		Answer: "nas.lan",
+	}, {
+		Domain: "b.lan",
+		Answer: "nas.lan",
+	}, {
+		Domain: "printer.lan",
+		Answer: "192.168.1.3",
+	}, {
+		Domain: "v6.lan",
+		Answer: "fd00::1",
+	}, {
+		Domain: "pr.lan",
+		Answer: "printer.lan",
+	}}, conf.Rewrites)
+
+	assert.Len(t, conf.Warnings, 1)
+}
+
+func TestImportDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "pihole")
+	dnsmasqDir := filepath.Join(root, "dnsmasq.d")
+
+	require.NoError(t, os.Mkdir(dir, 0o700))
+	require.NoError(t, os.Mkdir(dnsmasqDir, 0o700))
+
+	_, err := pihole.ImportDir(dir)
+	assert.Error(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "custom.list"), []byte("192.168.1.1 router.lan\n"), 0o600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(
+		filepath.Join(dnsmasqDir, "05-pihole-custom-cname.conf"),
+		[]byte("cname=alias.lan,router.lan\n"),
+		0o600,
+	)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "gravity.db"), []byte("SQLite format 3\x00"), 0o600)
+	require.NoError(t, err)
+
+	conf, err := pihole.ImportDir(dir)
+	require.NoError(t, err)
+
+	assert.Len(t, conf.Rewrites, 2)
+	assert.Len(t, conf.Warnings, 1)
+}
+
+func TestImport_badTeleporter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		data       []byte
+	}{{
+		name:       "not_gzip",
+		wantErrMsg: "teleporter archive: decompressing archive: gzip: invalid header",
+		data:       []byte(strings.Repeat("not an archive", 64)),
+	}, {
+		name: "zip",
+		wantErrMsg: "teleporter archive: archives of pi-hole v6 are not supported, " +
+			"import its pihole.toml instead",
+		data: []byte("PK\x03\x04rest of the archive"),
+	}, {
+		name: "bad_json",
+		wantErrMsg: `teleporter archive: file "adlist.json": decoding: ` +
+			"unexpected EOF",
+		data: newTestTeleporter(t, map[string]string{"adlist.json": `[{"address": `}),
+	}, {
+		name: "bad_row",
+		wantErrMsg: `teleporter archive: file "client.json": decoding row at index 0: ` +
+			"json: cannot unmarshal number into Go struct field clientRow.ip of type string",
+		data: newTestTeleporter(t, map[string]string{"client.json": `[{"ip": 1}]`}),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pihole.Import(&pihole.Source{
+				Teleporter: bytes.NewReader(tc.data),
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
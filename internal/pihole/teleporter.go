@@ -0,0 +1,155 @@
+package pihole
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+)
+
+// teleporterMaxSize is the maximum total size of the decompressed files of the
+// Teleporter archive.  The archives of Pi-hole v5 don't contain the gravity
+// table, so they're usually much smaller.
+const teleporterMaxSize = 256 << 20
+
+// zipMagic is the signature of the ZIP archives, which are created by the
+// Teleporter of Pi-hole v6.
+var zipMagic = []byte("PK\x03\x04")
+
+// Names of the files of the Teleporter archive.
+const (
+	teleporterAdlist     = "adlist.json"
+	teleporterClient     = "client.json"
+	teleporterAllowExact = "whitelist.exact.json"
+	teleporterDenyExact  = "blacklist.exact.json"
+	teleporterAllowRegex = "whitelist.regex.json"
+	teleporterDenyRegex  = "blacklist.regex.json"
+	teleporterCustomList = customListFileName
+	teleporterCNAMEList  = "dnsmasq.d/" + cnameListFileName
+)
+
+// teleporterDomainFiles maps the names of the domain list files of the
+// Teleporter archive to the types of their entries.
+var teleporterDomainFiles = map[string]int64{
+	teleporterAllowExact: domainTypeExactAllow,
+	teleporterDenyExact:  domainTypeExactDeny,
+	teleporterAllowRegex: domainTypeRegexAllow,
+	teleporterDenyRegex:  domainTypeRegexDeny,
+}
+
+// adlistRow is an entry of the adlist table exported by Teleporter.
+type adlistRow struct {
+	Address string `json:"address"`
+	Comment string `json:"comment"`
+	Enabled int64  `json:"enabled"`
+	Type    int64  `json:"type"`
+}
+
+// domainRow is an entry of the domainlist table exported by Teleporter.
+type domainRow struct {
+	Domain  string `json:"domain"`
+	Enabled int64  `json:"enabled"`
+	Type    int64  `json:"type"`
+}
+
+// clientRow is an entry of the client table exported by Teleporter.
+type clientRow struct {
+	IP      string `json:"ip"`
+	Comment string `json:"comment"`
+}
+
+// importTeleporter converts the adlists, the domain lists, the clients, and
+// the local DNS and CNAME records from the Teleporter archive of Pi-hole v5,
+// which is a gzipped tarball with the tables of the gravity database exported
+// as JSON arrays.  The other files are skipped.
+func (conf *Config) importTeleporter(r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zipMagic))
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	} else if bytes.Equal(magic, zipMagic) {
+		return errors.Error(
+			"archives of pi-hole v6 are not supported, import its pihole.toml instead",
+		)
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return fmt.Errorf("decompressing archive: %w", err)
+	}
+
+	tr := tar.NewReader(ioutil.LimitReader(gz, teleporterMaxSize))
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		err = conf.importTeleporterFile(name, tr)
+		if err != nil {
+			return fmt.Errorf("file %q: %w", name, err)
+		}
+	}
+}
+
+// importTeleporterFile converts the file of the Teleporter archive with name.
+func (conf *Config) importTeleporterFile(name string, r io.Reader) (err error) {
+	if typ, ok := teleporterDomainFiles[name]; ok {
+		return decodeRows(r, func() (row *domainRow) {
+			return &domainRow{Enabled: 1, Type: typ}
+		}, conf.importDomain)
+	}
+
+	switch name {
+	case teleporterAdlist:
+		return decodeRows(r, func() (row *adlistRow) {
+			return &adlistRow{Enabled: 1, Type: adlistTypeBlock}
+		}, conf.importAdlist)
+	case teleporterClient:
+		return decodeRows(r, func() (row *clientRow) { return &clientRow{} }, conf.importClient)
+	case teleporterCustomList:
+		return conf.importCustomList(r)
+	case teleporterCNAMEList:
+		return conf.importCNAMEList(r)
+	default:
+		return nil
+	}
+}
+
+// decodeRows decodes the JSON array of the table rows from r and passes each
+// of them to fn.  newRow must return a new row with the default values set.
+func decodeRows[T any](r io.Reader, newRow func() (row *T), fn func(row *T)) (err error) {
+	var raws []json.RawMessage
+	err = json.NewDecoder(r).Decode(&raws)
+	if err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	}
+
+	for i, raw := range raws {
+		row := newRow()
+		err = json.Unmarshal(raw, row)
+		if err != nil {
+			return fmt.Errorf("decoding row at index %d: %w", i, err)
+		}
+
+		fn(row)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package querylog
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// AggregatesConfig is the configuration for periodically sharing the anonymous
+// aggregates of the blocked requests, such as the top blocked domains and the
+// numbers of hits of the filtering rules, with a third-party endpoint.  The
+// aggregates contain no client data.
+type AggregatesConfig struct {
+	// URL is the URL of the endpoint the aggregates are posted to as JSON.  It
+	// must have the "http" or "https" scheme.
+	URL string `yaml:"url"`
+
+	// Interval is the interval between the posts.  Each post contains the
+	// aggregates collected since the previous one.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// Limit is the maximum number of the domains and the rules in each post.
+	Limit uint `yaml:"limit"`
+
+	// MinCount is the minimum number of the blocked requests for a domain or a
+	// rule to be shared, so that the rarely requested ones, which could
+	// identify a client, aren't.
+	MinCount uint `yaml:"min_count"`
+
+	// Enabled defines if the aggregates are shared.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the aggregates configuration is invalid.  c is
+// assumed to be enabled.
+func (c *AggregatesConfig) validate() (err error) {
+	var errs []error
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("url: bad scheme %q", u.Scheme))
+	}
+
+	if c.Interval.Duration <= 0 {
+		errs = append(errs, errors.Error("interval: not positive"))
+	}
+
+	if c.Limit == 0 {
+		errs = append(errs, errors.Error("limit: not positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// aggregatesMaxKeys is the maximum number of the distinct domains and rules
+// counted during an interval.  The new ones seen after that are ignored to
+// bound the memory usage.
+const aggregatesMaxKeys = 100_000
+
+// aggregatesSharer collects the aggregates of the blocked requests and
+// periodically posts them.
+type aggregatesSharer struct {
+	client *http.Client
+	conf   *AggregatesConfig
+
+	// mu protects domains, rules, and periodStart.
+	mu *sync.Mutex
+
+	// domains are the numbers of the blocked requests by domain name.
+	domains map[string]uint
+
+	// rules are the numbers of hits by rule text.
+	rules map[string]uint
+
+	// periodStart is the start of the current interval.
+	periodStart time.Time
+
+	// done is closed to stop the sharer.
+	done chan struct{}
+}
+
+// newAggregatesSharer returns a new properly initialized *aggregatesSharer or
+// nil if conf is nil or disabled.
+func newAggregatesSharer(
+	conf *AggregatesConfig,
+	client *http.Client,
+) (s *aggregatesSharer, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = conf.validate()
+	if err != nil {
+		return nil, fmt.Errorf("aggregates: %w", err)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &aggregatesSharer{
+		client:      client,
+		conf:        conf,
+		mu:          &sync.Mutex{},
+		domains:     map[string]uint{},
+		rules:       map[string]uint{},
+		periodStart: time.Now(),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// start starts posting the aggregates in the background.
+func (s *aggregatesSharer) start() {
+	go s.run()
+}
+
+// close stops the sharer.  The aggregates collected since the previous post
+// are dropped.  It must only be called once.
+func (s *aggregatesSharer) close() {
+	close(s.done)
+}
+
+// add counts e, if it's been blocked.  Only the rules from the filtering rule
+// lists are counted, since the custom rules and the hosts files may contain
+// private data.
+func (s *aggregatesSharer) add(e *logEntry) {
+	if !e.Result.IsFiltered {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	incKey(s.domains, e.QHost)
+	for _, r := range e.Result.Rules {
+		if r.FilterListID > rulelist.URLFilterIDCustom && r.Text != "" {
+			incKey(s.rules, r.Text)
+		}
+	}
+}
+
+// incKey increments the counter of key in m unless m is full.
+func incKey(m map[string]uint, key string) {
+	if _, ok := m[key]; ok || len(m) < aggregatesMaxKeys {
+		m[key]++
+	}
+}
+
+// run posts the aggregates once in the interval.
+func (s *aggregatesSharer) run() {
+	defer log.OnPanic("querylog: aggregates")
+
+	t := time.NewTicker(s.conf.Interval.Duration)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			rep := s.report(time.Now())
+			if len(rep.TopBlockedDomains) == 0 && len(rep.TopRules) == 0 {
+				continue
+			}
+
+			err := s.post(context.Background(), rep)
+			if err != nil {
+				log.Error("querylog: aggregates: posting: %s", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// aggregatesReport is the JSON body of the posted aggregates.
+type aggregatesReport struct {
+	// Start is the start of the interval of the aggregates.
+	Start time.Time `json:"start"`
+
+	// End is the end of the interval of the aggregates.
+	End time.Time `json:"end"`
+
+	// TopBlockedDomains are the most frequently blocked domains.
+	TopBlockedDomains []*aggregatesItem `json:"top_blocked_domains"`
+
+	// TopRules are the filtering rules with the most hits.
+	TopRules []*aggregatesItem `json:"top_rules"`
+}
+
+// aggregatesItem is a counted domain or rule.
+type aggregatesItem struct {
+	// Name is the domain name or the text of the rule.
+	Name string `json:"name"`
+
+	// Count is the number of the blocked requests.
+	Count uint `json:"count"`
+}
+
+// report returns the aggregates collected since the start of the current
+// interval and starts a new one at now.
+func (s *aggregatesSharer) report(now time.Time) (rep *aggregatesReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rep = &aggregatesReport{
+		Start:             s.periodStart.UTC(),
+		End:               now.UTC(),
+		TopBlockedDomains: topItems(s.domains, s.conf.Limit, s.conf.MinCount),
+		TopRules:          topItems(s.rules, s.conf.Limit, s.conf.MinCount),
+	}
+
+	s.domains = map[string]uint{}
+	s.rules = map[string]uint{}
+	s.periodStart = now
+
+	return rep
+}
+
+// topItems returns at most limit items from m with the greatest counts, which
+// are at least minCount, sorted by count in descending order and then by name.
+func topItems(m map[string]uint, limit, minCount uint) (items []*aggregatesItem) {
+	items = []*aggregatesItem{}
+	for name, count := range m {
+		if count >= minCount {
+			items = append(items, &aggregatesItem{Name: name, Count: count})
+		}
+	}
+
+	slices.SortFunc(items, func(a, b *aggregatesItem) (res int) {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+
+	return items[:min(uint(len(items)), limit)]
+}
+
+// post sends rep to the configured endpoint.
+func (s *aggregatesSharer) post(ctx context.Context, rep *aggregatesReport) (err error) {
+	body := &bytes.Buffer{}
+	err = json.NewEncoder(body).Encode(rep)
+	if err != nil {
+		return fmt.Errorf("encoding report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.conf.URL, body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package querylog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAggregatesEntry returns a new log entry for host blocked by a rule
+// from the filtering rule list with the given ID.
+func newTestAggregatesEntry(host string, listID rulelist.URLFilterID) (e *logEntry) {
+	e = newTestLogEntry(host)
+	e.Result.Rules[0].FilterListID = listID
+
+	return e
+}
+
+func TestAggregatesSharer(t *testing.T) {
+	repCh := make(chan *aggregatesReport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		rep := &aggregatesReport{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(rep))
+
+		repCh <- rep
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := newAggregatesSharer(&AggregatesConfig{
+		URL:      srv.URL,
+		Interval: timeutil.Duration{Duration: time.Hour},
+		Limit:    2,
+		MinCount: 2,
+		Enabled:  true,
+	}, srv.Client())
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	for range 3 {
+		s.add(newTestAggregatesEntry("first.example", 1))
+	}
+
+	for range 2 {
+		s.add(newTestAggregatesEntry("second.example", 2))
+		s.add(newTestAggregatesEntry("custom.example", rulelist.URLFilterIDCustom))
+	}
+
+	s.add(newTestAggregatesEntry("rare.example", 1))
+
+	unfiltered := newTestLogEntry("unfiltered.example")
+	unfiltered.Result.IsFiltered = false
+	for range 5 {
+		s.add(unfiltered)
+	}
+
+	rep := s.report(time.Now())
+	assert.Equal(t, []*aggregatesItem{{
+		Name:  "first.example",
+		Count: 3,
+	}, {
+		Name:  "custom.example",
+		Count: 2,
+	}}, rep.TopBlockedDomains)
+	assert.Equal(t, []*aggregatesItem{{
+		Name:  "||first.example^",
+		Count: 3,
+	}, {
+		Name:  "||second.example^",
+		Count: 2,
+	}}, rep.TopRules)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, s.post(ctx, rep))
+
+	got, ok := testutil.RequireReceive(t, repCh, testTimeout)
+	require.True(t, ok)
+
+	assert.Equal(t, rep.TopBlockedDomains, got.TopBlockedDomains)
+	assert.Equal(t, rep.TopRules, got.TopRules)
+
+	rep = s.report(time.Now())
+	assert.Empty(t, rep.TopBlockedDomains)
+	assert.Empty(t, rep.TopRules)
+}
+
+func TestAggregatesConfig_validate(t *testing.T) {
+	conf := &AggregatesConfig{
+		URL:     "ftp://aggregates.example",
+		Enabled: true,
+	}
+
+	testutil.AssertErrorMsg(
+		t,
+		"url: bad scheme \"ftp\"\ninterval: not positive\nlimit: not positive",
+		conf.validate(),
+	)
+}
@@ -0,0 +1,445 @@
+package querylog
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// ArchiveConfig is the configuration for archiving the rotated query log files
+// to an S3-compatible bucket or a WebDAV server.
+type ArchiveConfig struct {
+	// WebDAV is the configuration of the WebDAV server to upload the files
+	// to.  If not nil, it's used instead of the S3-compatible bucket, and the
+	// S3-specific fields are ignored.
+	WebDAV *WebDAVConfig `yaml:"webdav,omitempty"`
+
+	// Tags are the tags of the uploaded objects, for example the ones matched
+	// by the lifecycle rules of the bucket.
+	Tags map[string]string `yaml:"tags"`
+
+	// Endpoint is the URL of the S3-compatible service, for example
+	// "https://s3.eu-central-1.amazonaws.com".  The path-style requests are
+	// used, so the bucket name must not be a part of it.
+	Endpoint string `yaml:"endpoint"`
+
+	// Bucket is the name of the bucket to upload the files into.
+	Bucket string `yaml:"bucket"`
+
+	// Region is the region of the bucket used for signing the requests.
+	Region string `yaml:"region"`
+
+	// Prefix is prepended to the names of the uploaded objects.
+	Prefix string `yaml:"prefix"`
+
+	// AccessKeyID is the ID of the access key used for signing the requests.
+	AccessKeyID string `yaml:"access_key_id"`
+
+	// SecretAccessKey is the secret of the access key used for signing the
+	// requests.
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// Enabled defines if the rotated files are archived.  If false, the
+	// rotated files are overwritten on the next rotation.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the archiving configuration is invalid.  c is
+// assumed to be enabled.
+func (c *ArchiveConfig) validate() (err error) {
+	if c.WebDAV != nil {
+		return errors.Annotate(c.WebDAV.validate(), "webdav: %w")
+	}
+
+	var errs []error
+	if c.Bucket == "" {
+		errs = append(errs, errors.Error("bucket: empty value"))
+	}
+
+	if c.Region == "" {
+		errs = append(errs, errors.Error("region: empty value"))
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("endpoint: %w", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("endpoint: bad scheme %q", u.Scheme))
+	}
+
+	return errors.Join(errs...)
+}
+
+// archivePendingPrefix is the prefix of the names of the rotated files waiting
+// for being archived, relative to the log file.
+const archivePendingPrefix = ".archive-"
+
+// archiveTimeFormat is the format of the rotation time in the names of the
+// archived files.
+const archiveTimeFormat = "20060102T150405Z"
+
+// archiveUploadTimeout is the timeout of uploading a single file.
+const archiveUploadTimeout = 10 * time.Minute
+
+// archiver uploads the rotated query log files to an S3-compatible bucket or
+// a WebDAV server and removes the uploaded ones.
+type archiver struct {
+	// ctx is the context of the uploads, it's canceled by [archiver.close].
+	ctx context.Context
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// mu prevents the concurrent uploads of the same files.
+	mu *sync.Mutex
+
+	client *http.Client
+	conf   *ArchiveConfig
+
+	// logFile is the path to the log file.
+	logFile string
+}
+
+// newArchiver returns a new properly initialized *archiver or nil if conf is
+// nil or disabled.
+func newArchiver(conf *ArchiveConfig, client *http.Client, logFile string) (a *archiver, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = conf.validate()
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &archiver{
+		ctx:     ctx,
+		cancel:  cancel,
+		mu:      &sync.Mutex{},
+		client:  client,
+		conf:    conf,
+		logFile: logFile,
+	}, nil
+}
+
+// close cancels the uploads in progress.  The files failed to upload are
+// retried after the next start.
+func (a *archiver) close() {
+	a.cancel()
+}
+
+// keep moves the rotated file at path out of the way of the next rotation, so
+// that it's archived later.  It's not an error if there is no file at path.
+func (a *archiver) keep(path string, now time.Time) (err error) {
+	pending := a.logFile + archivePendingPrefix + now.UTC().Format(archiveTimeFormat)
+	err = os.Rename(path, pending)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("keeping rotated file for archiving: %w", err)
+	}
+
+	log.Debug("querylog: archive: renamed %s into %s", path, pending)
+
+	return nil
+}
+
+// uploadPending uploads all the files waiting for being archived and removes
+// the uploaded ones.  The files failed to upload are retried on the next call.
+// It's safe for concurrent use.
+func (a *archiver) uploadPending() {
+	defer log.OnPanic("querylog: archive")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	paths, err := filepath.Glob(a.logFile + archivePendingPrefix + "*")
+	if err != nil {
+		log.Error("querylog: archive: listing pending files: %s", err)
+
+		return
+	}
+
+	for _, p := range paths {
+		if a.ctx.Err() != nil {
+			log.Debug("querylog: archive: closed, not uploading %q", p)
+
+			return
+		}
+
+		err = a.uploadWithTimeout(p)
+		if err != nil {
+			log.Error("querylog: archive: uploading %q: %s", p, err)
+
+			continue
+		}
+
+		err = os.Remove(p)
+		if err != nil {
+			log.Error("querylog: archive: removing uploaded file: %s", err)
+		}
+	}
+}
+
+// uploadWithTimeout uploads the file at p within [archiveUploadTimeout].
+func (a *archiver) uploadWithTimeout(p string) (err error) {
+	ctx, cancel := context.WithTimeout(a.ctx, archiveUploadTimeout)
+	defer cancel()
+
+	return a.upload(ctx, p)
+}
+
+// upload compresses the file at path and uploads it to the configured target.
+func (a *archiver) upload(ctx context.Context, p string) (err error) {
+	gz, sum, err := compressFile(p)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	defer func() {
+		err = errors.WithDeferred(err, gz.Close())
+		err = errors.WithDeferred(err, os.Remove(gz.Name()))
+	}()
+
+	fi, err := gz.Stat()
+	if err != nil {
+		return fmt.Errorf("getting compressed file size: %w", err)
+	}
+
+	name := a.conf.Prefix + strings.Replace(filepath.Base(p), archivePendingPrefix, "-", 1) + ".gz"
+
+	var dst string
+	if a.conf.WebDAV != nil {
+		dst, err = a.uploadWebDAV(ctx, gz, fi.Size(), name)
+	} else {
+		dst, err = a.uploadS3(ctx, gz, fi.Size(), sum, name)
+	}
+
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	log.Info("querylog: archive: uploaded %q as %q", p, dst)
+
+	return nil
+}
+
+// uploadS3 uploads the compressed file gz of the size with the hex-encoded
+// SHA256 sum to the bucket as name.  dst is the path of the uploaded object.
+func (a *archiver) uploadS3(
+	ctx context.Context,
+	gz io.Reader,
+	size int64,
+	sum string,
+	name string,
+) (dst string, err error) {
+	u, err := url.Parse(a.conf.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("endpoint: %w", err)
+	}
+
+	u.Path = path.Join("/", u.Path, a.conf.Bucket, name)
+	u.RawPath = uriEncode(u.Path)
+
+	// Don't let the client close gz, since it's closed and removed by the
+	// caller.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), io.NopCloser(gz))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	if len(a.conf.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range a.conf.Tags {
+			tags.Set(k, v)
+		}
+
+		req.Header.Set("X-Amz-Tagging", tags.Encode())
+	}
+
+	signV4(req, a.conf, sum, time.Now())
+
+	err = a.do(req, http.StatusOK)
+	if err != nil {
+		return "", fmt.Errorf("uploading: %w", err)
+	}
+
+	return u.Path, nil
+}
+
+// do sends req and returns an error if the status code of the response isn't
+// one of codes.
+func (a *archiver) do(req *http.Request, codes ...int) (err error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if !slices.Contains(codes, resp.StatusCode) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return fmt.Errorf("status code %d: %q", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// compressFile writes the gzip-compressed contents of the file at p into a
+// temporary file next to it.  gz is positioned at the start, and sum is the
+// hex-encoded SHA256 of its contents.
+func compressFile(p string) (gz *os.File, sum string, err error) {
+	src, err := os.Open(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening file: %w", err)
+	}
+
+	defer func() { err = errors.WithDeferred(err, src.Close()) }()
+
+	// Don't use the name of the pending file as the prefix, so that the
+	// temporary file doesn't match the pending ones.
+	gz, err = os.CreateTemp(filepath.Dir(p), "querylog.upload-*.gz")
+	if err != nil {
+		return nil, "", fmt.Errorf("creating compressed file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.WithDeferred(err, gz.Close())
+			err = errors.WithDeferred(err, os.Remove(gz.Name()))
+		}
+	}()
+
+	h := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(gz, h))
+	_, err = io.Copy(zw, src)
+	if err != nil {
+		return nil, "", fmt.Errorf("compressing file: %w", err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, "", fmt.Errorf("compressing file: %w", err)
+	}
+
+	_, err = gz.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, "", fmt.Errorf("rewinding compressed file: %w", err)
+	}
+
+	return gz, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signV4 signs req using the AWS Signature Version 4 algorithm.  payloadHash
+// is the hex-encoded SHA256 of the request body.  All the headers of req are
+// signed.
+func signV4(req *http.Request, conf *ArchiveConfig, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	canonHeaders := &strings.Builder{}
+	for _, k := range names {
+		_, _ = fmt.Fprintf(canonHeaders, "%s:%s\n", k, headers[k])
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	canonReq := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	reqHash := sha256.Sum256([]byte(canonReq))
+	scope := date + "/" + conf.Region + "/s3/aws4_request"
+	strToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+
+	key := []byte("AWS4" + conf.SecretAccessKey)
+	for _, part := range []string{date, conf.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	sig := hex.EncodeToString(hmacSHA256(key, strToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		conf.AccessKeyID,
+		scope,
+		signedHeaders,
+		sig,
+	))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) (sum []byte) {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// uriEncode encodes the path the way the AWS Signature Version 4 requires, that
+// is, escaping everything except the unreserved characters and slashes.
+func uriEncode(p string) (enc string) {
+	b := &strings.Builder{}
+	for i := range len(p) {
+		c := p[i]
+		switch {
+		case
+			'A' <= c && c <= 'Z',
+			'a' <= c && c <= 'z',
+			'0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			_ = b.WriteByte(c)
+		default:
+			_, _ = fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,230 @@
+package querylog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/c2h5oh/datasize"
+)
+
+// WebDAVConfig is the configuration for archiving the rotated query log files
+// to a WebDAV server, for example Nextcloud.
+type WebDAVConfig struct {
+	// URL is the URL of the directory to upload the files into, for example
+	// "https://cloud.example/remote.php/dav/files/user/adguardhome".  The
+	// directory must exist.
+	URL string `yaml:"url"`
+
+	// Username is the name of the user for the basic authentication.
+	Username string `yaml:"username"`
+
+	// Password is the password of the user for the basic authentication.  For
+	// Nextcloud, an app password should be used.
+	Password string `yaml:"password"`
+
+	// ChunkSize is the size of the chunks for the Nextcloud chunked upload.
+	// If zero, the files are uploaded with a single request.  Otherwise, URL
+	// must be a Nextcloud files URL, and ChunkSize must not be less than
+	// [webDAVMinChunkSize].
+	ChunkSize datasize.ByteSize `yaml:"chunk_size"`
+}
+
+// webDAVMinChunkSize is the minimum size of a chunk, except the last one,
+// accepted by Nextcloud.
+const webDAVMinChunkSize = 5 * datasize.MB
+
+// Nextcloud DAV path prefixes.
+const (
+	nextcloudFilesPrefix   = "/remote.php/dav/files/"
+	nextcloudUploadsPrefix = "/remote.php/dav/uploads/"
+)
+
+// validate returns an error if the WebDAV configuration is invalid.
+func (c *WebDAVConfig) validate() (err error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: bad scheme %q", u.Scheme)
+	}
+
+	if c.ChunkSize == 0 {
+		return nil
+	} else if c.ChunkSize < webDAVMinChunkSize {
+		return fmt.Errorf("chunk_size: must be at least %s, got %s", webDAVMinChunkSize, c.ChunkSize)
+	}
+
+	_, err = nextcloudUploadsURL(u)
+	if err != nil {
+		return fmt.Errorf("chunk_size: %w", err)
+	}
+
+	return nil
+}
+
+// nextcloudUploadsURL returns the URL of the uploads directory of the
+// Nextcloud user from the files URL u.
+func nextcloudUploadsURL(u *url.URL) (uploads *url.URL, err error) {
+	i := strings.Index(u.Path, nextcloudFilesPrefix)
+	if i < 0 {
+		return nil, fmt.Errorf("url: chunked upload requires a nextcloud url with %q", nextcloudFilesPrefix)
+	}
+
+	user, _, _ := strings.Cut(u.Path[i+len(nextcloudFilesPrefix):], "/")
+	if user == "" {
+		return nil, errors.Error("url: no nextcloud user")
+	}
+
+	return &url.URL{
+		Scheme: u.Scheme,
+		User:   u.User,
+		Host:   u.Host,
+		Path:   u.Path[:i] + nextcloudUploadsPrefix + user,
+	}, nil
+}
+
+// uploadWebDAV uploads the compressed file gz of the size to the WebDAV
+// directory as name.  dst is the URL of the uploaded file.
+func (a *archiver) uploadWebDAV(
+	ctx context.Context,
+	gz *os.File,
+	size int64,
+	name string,
+) (dst string, err error) {
+	c := a.conf.WebDAV
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("url: %w", err)
+	}
+
+	u = u.JoinPath(name)
+	dst = u.String()
+
+	if c.ChunkSize == 0 || size <= int64(c.ChunkSize) {
+		err = a.webDAVPut(ctx, dst, gz, size, nil)
+		if err != nil {
+			return "", fmt.Errorf("uploading: %w", err)
+		}
+
+		return dst, nil
+	}
+
+	err = a.uploadChunked(ctx, gz, size, u)
+	if err != nil {
+		return "", fmt.Errorf("uploading in chunks: %w", err)
+	}
+
+	return dst, nil
+}
+
+// uploadChunked uploads gz of the size to dst using the Nextcloud chunked
+// upload.  See https://docs.nextcloud.com/server/latest/developer_manual/client_apis/WebDAV/chunking.html.
+func (a *archiver) uploadChunked(ctx context.Context, gz *os.File, size int64, dst *url.URL) (err error) {
+	uploads, err := nextcloudUploadsURL(dst)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	dir := uploads.JoinPath("adguardhome-" + path.Base(dst.Path)).String()
+	hdr := http.Header{
+		"Destination":     []string{dst.String()},
+		"Oc-Total-Length": []string{strconv.FormatInt(size, 10)},
+	}
+
+	// Nextcloud responds with 405 Method Not Allowed if the directory already
+	// exists, for example after a failed upload, in which case the uploaded
+	// chunks are overwritten.
+	err = a.webDAVDo(ctx, "MKCOL", dir, hdr, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return fmt.Errorf("creating upload directory: %w", err)
+	}
+
+	chunkSize := int64(a.conf.WebDAV.ChunkSize)
+	for i, off := 1, int64(0); off < size; i, off = i+1, off+chunkSize {
+		n := min(chunkSize, size-off)
+		chunk := fmt.Sprintf("%s/%05d", dir, i)
+		err = a.webDAVPut(ctx, chunk, io.NewSectionReader(gz, off, n), n, hdr)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+
+	err = a.webDAVDo(ctx, "MOVE", dir+"/.file", hdr, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return fmt.Errorf("assembling chunks: %w", err)
+	}
+
+	return nil
+}
+
+// webDAVPut uploads the body of the size to u.  body isn't closed.
+func (a *archiver) webDAVPut(
+	ctx context.Context,
+	u string,
+	body io.Reader,
+	size int64,
+	hdr http.Header,
+) (err error) {
+	req, err := a.newWebDAVRequest(ctx, http.MethodPut, u, io.NopCloser(body), hdr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	req.ContentLength = size
+
+	return a.do(req, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+// webDAVDo sends the request without a body with the method to u and returns an error if the
+// status code of the response isn't one of codes.
+func (a *archiver) webDAVDo(
+	ctx context.Context,
+	method string,
+	u string,
+	hdr http.Header,
+	codes ...int,
+) (err error) {
+	req, err := a.newWebDAVRequest(ctx, method, u, nil, hdr)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	return a.do(req, codes...)
+}
+
+// newWebDAVRequest returns a new authenticated request with the headers from
+// hdr.
+func (a *archiver) newWebDAVRequest(
+	ctx context.Context,
+	method string,
+	u string,
+	body io.ReadCloser,
+	hdr http.Header,
+) (req *http.Request, err error) {
+	req, err = http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+
+	c := a.conf.WebDAV
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,535 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// ClickHouseConfig is the configuration for streaming the query log entries
+// into a ClickHouse table over its HTTP interface.
+//
+// The table must have the columns of [clickHouseRow], for example:
+//
+//	CREATE TABLE querylog (
+//		time DateTime64(3),
+//		client_ip String,
+//		client_id String,
+//		client_proto LowCardinality(String),
+//		host String,
+//		qtype LowCardinality(String),
+//		qclass LowCardinality(String),
+//		upstream String,
+//		elapsed_ms Float64,
+//		filtered Bool,
+//		reason LowCardinality(String),
+//		rule String,
+//		cached Bool,
+//		authenticated_data Bool,
+//		upstream_fallback Bool,
+//		sample_weight UInt32
+//	) ENGINE = MergeTree ORDER BY time;
+type ClickHouseConfig struct {
+	// URL is the URL of the HTTP interface of the ClickHouse server, for
+	// example "https://clickhouse.example:8443".  The "https" scheme enables
+	// TLS.
+	URL string `yaml:"url"`
+
+	// Database is the name of the database containing Table.  If empty, the
+	// default database of the user is used.
+	Database string `yaml:"database"`
+
+	// Table is the name of the table to insert the entries into.
+	Table string `yaml:"table"`
+
+	// Username is the name of the ClickHouse user.  If empty, the default user
+	// is used.
+	Username string `yaml:"username"`
+
+	// Password is the password of the ClickHouse user.
+	Password string `yaml:"password"`
+
+	// TLS is the TLS configuration for the HTTPS connections.  If nil, the
+	// system settings are used.
+	TLS *ClickHouseTLSConfig `yaml:"tls,omitempty"`
+
+	// FlushInterval is the maximum time an entry waits for the batch to be
+	// filled before it's inserted.
+	FlushInterval timeutil.Duration `yaml:"flush_interval"`
+
+	// RetryInterval is the interval before the first retry of a failed insert.
+	// It's doubled with each of the following retries.
+	RetryInterval timeutil.Duration `yaml:"retry_interval"`
+
+	// BatchSize is the maximum number of the entries inserted at once.
+	BatchSize uint `yaml:"batch_size"`
+
+	// MaxRetries is the maximum number of retries of a failed insert, after
+	// which the batch is dropped.
+	MaxRetries uint `yaml:"max_retries"`
+
+	// Enabled defines if the entries are streamed into ClickHouse.
+	Enabled bool `yaml:"enabled"`
+}
+
+// ClickHouseTLSConfig is the TLS configuration of the connections to the
+// ClickHouse server.
+type ClickHouseTLSConfig struct {
+	// CAPath is the path to the PEM-encoded certificates of the authorities
+	// used to verify the server certificate instead of the system ones.
+	CAPath string `yaml:"ca_path"`
+
+	// CertificatePath is the path to the PEM-encoded client certificate.  It
+	// must be set along with PrivateKeyPath.
+	CertificatePath string `yaml:"certificate_path"`
+
+	// PrivateKeyPath is the path to the PEM-encoded private key of the client
+	// certificate.
+	PrivateKeyPath string `yaml:"private_key_path"`
+
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// clickHouseIdentRe matches the valid unquoted ClickHouse identifiers.
+var clickHouseIdentRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validate returns an error if the ClickHouse configuration is invalid.  c is
+// assumed to be enabled.
+func (c *ClickHouseConfig) validate() (err error) {
+	var errs []error
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("url: bad scheme %q", u.Scheme))
+	}
+
+	if c.Database != "" && !clickHouseIdentRe.MatchString(c.Database) {
+		errs = append(errs, fmt.Errorf("database: bad identifier %q", c.Database))
+	}
+
+	if c.Table == "" {
+		errs = append(errs, errors.Error("table: empty value"))
+	} else if !clickHouseIdentRe.MatchString(c.Table) {
+		errs = append(errs, fmt.Errorf("table: bad identifier %q", c.Table))
+	}
+
+	if c.BatchSize == 0 {
+		errs = append(errs, errors.Error("batch_size: not positive"))
+	}
+
+	if c.FlushInterval.Duration <= 0 {
+		errs = append(errs, errors.Error("flush_interval: not positive"))
+	}
+
+	if c.MaxRetries > 0 && c.RetryInterval.Duration <= 0 {
+		errs = append(errs, errors.Error("retry_interval: not positive"))
+	}
+
+	if t := c.TLS; t != nil && (t.CertificatePath == "") != (t.PrivateKeyPath == "") {
+		errs = append(errs, errors.Error(
+			"tls: certificate_path and private_key_path must be set together",
+		))
+	}
+
+	return errors.Join(errs...)
+}
+
+// clickHouseMaxRetryIvl is the maximum interval between the retries of a
+// failed insert.
+const clickHouseMaxRetryIvl = 5 * time.Minute
+
+// clickHouseQueueBatches is the number of batches the queue of the entries
+// waiting for being inserted holds.  The entries added while the queue is full
+// are dropped.
+const clickHouseQueueBatches = 4
+
+// clickHouseSink inserts the query log entries into a ClickHouse table in
+// batches.
+type clickHouseSink struct {
+	client *http.Client
+	conf   *ClickHouseConfig
+
+	// anonymizer processes the IP addresses of the inserted entries.  It may
+	// be nil.
+	anonymizer *aghnet.IPMut
+
+	// entries is the queue of the entries waiting for being inserted.
+	entries chan *logEntry
+
+	// done is closed to stop the sink.
+	done chan struct{}
+
+	// stopped is closed once the remaining entries have been inserted after
+	// done is closed.
+	stopped chan struct{}
+
+	// insertURL is the URL of the insert requests.
+	insertURL string
+}
+
+// newClickHouseSink returns a new properly initialized *clickHouseSink or nil
+// if conf is nil or disabled.
+func newClickHouseSink(
+	conf *ClickHouseConfig,
+	client *http.Client,
+	anonymizer *aghnet.IPMut,
+) (s *clickHouseSink, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = conf.validate()
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+
+	client, err = clickHouseClient(conf.TLS, client)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: tls: %w", err)
+	}
+
+	table := conf.Table
+	if conf.Database != "" {
+		table = conf.Database + "." + table
+	}
+
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		// Shouldn't happen, since the URL is validated.
+		panic(err)
+	}
+
+	q := u.Query()
+	q.Set("query", "INSERT INTO "+table+" FORMAT JSONEachRow")
+	q.Set("date_time_input_format", "best_effort")
+	u.RawQuery = q.Encode()
+
+	return &clickHouseSink{
+		client:     client,
+		conf:       conf,
+		anonymizer: anonymizer,
+		entries:    make(chan *logEntry, conf.BatchSize*clickHouseQueueBatches),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		insertURL:  u.String(),
+	}, nil
+}
+
+// clickHouseClient returns the HTTP client using the TLS settings of conf on
+// top of the ones of base.  If conf is nil, base or [http.DefaultClient] is
+// returned.
+func clickHouseClient(conf *ClickHouseTLSConfig, base *http.Client) (c *http.Client, err error) {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	if conf == nil {
+		return base, nil
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if baseTr, ok := base.Transport.(*http.Transport); ok {
+		tr = baseTr.Clone()
+	}
+
+	tlsConf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if tr.TLSClientConfig != nil {
+		tlsConf = tr.TLSClientConfig.Clone()
+	}
+
+	tlsConf.InsecureSkipVerify = conf.InsecureSkipVerify
+
+	if conf.CAPath != "" {
+		var pem []byte
+		pem, err = os.ReadFile(conf.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca: %w", err)
+		}
+
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca: no certificates in %q", conf.CAPath)
+		}
+	}
+
+	if conf.CertificatePath != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(conf.CertificatePath, conf.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	tr.TLSClientConfig = tlsConf
+
+	return &http.Client{
+		Transport: tr,
+		Timeout:   base.Timeout,
+	}, nil
+}
+
+// start starts inserting the entries in the background.
+func (s *clickHouseSink) start() {
+	go s.run()
+}
+
+// close stops the sink after inserting the queued entries.  It must only be
+// called once and only after [clickHouseSink.start].
+func (s *clickHouseSink) close() {
+	close(s.done)
+	<-s.stopped
+}
+
+// add queues e for being inserted.  If the queue is full, e is dropped.  e
+// must not be modified after that.
+func (s *clickHouseSink) add(e *logEntry) {
+	select {
+	case s.entries <- e:
+		// Go on.
+	default:
+		log.Debug("querylog: clickhouse: queue is full, dropping entry")
+	}
+}
+
+// run collects the entries into batches and inserts them once a batch is full
+// or once in the flush interval.
+func (s *clickHouseSink) run() {
+	defer log.OnPanic("querylog: clickhouse")
+	defer close(s.stopped)
+
+	t := time.NewTicker(s.conf.FlushInterval.Duration)
+	defer t.Stop()
+
+	batch := make([]*logEntry, 0, s.conf.BatchSize)
+	for {
+		select {
+		case e := <-s.entries:
+			batch = append(batch, e)
+			if uint(len(batch)) < s.conf.BatchSize {
+				continue
+			}
+		case <-t.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-s.done:
+			s.drain(batch)
+
+			return
+		}
+
+		s.insertWithRetry(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain inserts batch along with the entries left in the queue without
+// retrying.
+func (s *clickHouseSink) drain(batch []*logEntry) {
+	for {
+		select {
+		case e := <-s.entries:
+			batch = append(batch, e)
+		default:
+			if len(batch) > 0 {
+				s.logInsertErr(s.insert(context.Background(), batch), len(batch))
+			}
+
+			return
+		}
+	}
+}
+
+// insertWithRetry inserts batch, retrying the failed inserts with backoff up to
+// the configured number of times.  The retries are stopped once the sink is
+// closed.
+func (s *clickHouseSink) insertWithRetry(batch []*logEntry) {
+	ivl := s.conf.RetryInterval.Duration
+	for i := uint(0); ; i++ {
+		err := s.insert(context.Background(), batch)
+		if err == nil {
+			return
+		}
+
+		if i >= s.conf.MaxRetries || !isRetriableClickHouseErr(err) {
+			s.logInsertErr(err, len(batch))
+
+			return
+		}
+
+		log.Info("querylog: clickhouse: warning: inserting: %s; retrying in %s", err, ivl)
+
+		select {
+		case <-time.After(ivl):
+			ivl = min(ivl*2, clickHouseMaxRetryIvl)
+		case <-s.done:
+			s.logInsertErr(err, len(batch))
+
+			return
+		}
+	}
+}
+
+// logInsertErr logs err, if any, of inserting n entries, which are dropped.
+func (s *clickHouseSink) logInsertErr(err error, n int) {
+	if err != nil {
+		log.Error("querylog: clickhouse: inserting %d entries: %s, dropping", n, err)
+	}
+}
+
+// clickHouseStatusError is returned when the ClickHouse server responds with
+// an unexpected status code.
+type clickHouseStatusError struct {
+	body []byte
+	code int
+}
+
+// type check
+var _ error = (*clickHouseStatusError)(nil)
+
+// Error implements the [error] interface for *clickHouseStatusError.
+func (err *clickHouseStatusError) Error() (msg string) {
+	return fmt.Sprintf("status code %d: %q", err.code, err.body)
+}
+
+// isRetriableClickHouseErr returns true if the insert failed with err is worth
+// retrying, that is, if it's not a client error except for the rate limiting.
+func isRetriableClickHouseErr(err error) (ok bool) {
+	var statusErr *clickHouseStatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+
+	code := statusErr.code
+
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// insert inserts batch into the table.
+func (s *clickHouseSink) insert(ctx context.Context, batch []*logEntry) (err error) {
+	var anon aghnet.IPMutFunc
+	if s.anonymizer != nil {
+		anon = s.anonymizer.Load()
+	}
+
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, e := range batch {
+		err = enc.Encode(newClickHouseRow(e, anon))
+		if err != nil {
+			return fmt.Errorf("encoding row: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.insertURL, body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.conf.Username != "" {
+		req.Header.Set("X-ClickHouse-User", s.conf.Username)
+	}
+
+	if s.conf.Password != "" {
+		req.Header.Set("X-ClickHouse-Key", s.conf.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return &clickHouseStatusError{
+			body: respBody,
+			code: resp.StatusCode,
+		}
+	}
+
+	return nil
+}
+
+// clickHouseRow is a row of the ClickHouse table.
+type clickHouseRow struct {
+	Time              string  `json:"time"`
+	ClientIP          string  `json:"client_ip"`
+	ClientID          string  `json:"client_id"`
+	ClientProto       string  `json:"client_proto"`
+	Host              string  `json:"host"`
+	QType             string  `json:"qtype"`
+	QClass            string  `json:"qclass"`
+	Upstream          string  `json:"upstream"`
+	Reason            string  `json:"reason"`
+	Rule              string  `json:"rule"`
+	ElapsedMs         float64 `json:"elapsed_ms"`
+	Filtered          bool    `json:"filtered"`
+	Cached            bool    `json:"cached"`
+	AuthenticatedData bool    `json:"authenticated_data"`
+	UpstreamFallback  bool    `json:"upstream_fallback"`
+
+	// SampleWeight is the number of requests the row stands for, if it's been
+	// logged while sampling.  It's zero otherwise.
+	SampleWeight uint `json:"sample_weight"`
+}
+
+// newClickHouseRow returns the row for e.  anon, if not nil, is used to
+// anonymize the client IP address.
+func newClickHouseRow(e *logEntry, anon aghnet.IPMutFunc) (row *clickHouseRow) {
+	ip := e.IP
+	if anon != nil {
+		ip = slices.Clone(ip)
+		anon(ip)
+	}
+
+	var rule string
+	if len(e.Result.Rules) > 0 {
+		rule = e.Result.Rules[0].Text
+	}
+
+	return &clickHouseRow{
+		Time:              e.Time.UTC().Format(time.RFC3339Nano),
+		ClientIP:          ip.String(),
+		ClientID:          e.ClientID,
+		ClientProto:       string(e.ClientProto),
+		Host:              e.QHost,
+		QType:             e.QType,
+		QClass:            e.QClass,
+		Upstream:          e.Upstream,
+		Reason:            e.Result.Reason.String(),
+		Rule:              rule,
+		ElapsedMs:         float64(e.Elapsed) / float64(time.Millisecond),
+		Filtered:          e.Result.IsFiltered,
+		Cached:            e.Cached,
+		AuthenticatedData: e.AuthenticatedData,
+		UpstreamFallback:  e.UpstreamFallback,
+		SampleWeight:      e.SampleWeight,
+	}
+}
@@ -0,0 +1,181 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// newTestClickHouseConfig returns the ClickHouse configuration for tests
+// inserting into the server at srvURL.
+func newTestClickHouseConfig(srvURL string) (conf *ClickHouseConfig) {
+	return &ClickHouseConfig{
+		URL:           srvURL,
+		Database:      "dns",
+		Table:         "querylog",
+		Username:      "user",
+		Password:      "pass",
+		FlushInterval: timeutil.Duration{Duration: time.Hour},
+		RetryInterval: timeutil.Duration{Duration: time.Millisecond},
+		BatchSize:     2,
+		MaxRetries:    1,
+		Enabled:       true,
+	}
+}
+
+// newTestLogEntry returns a new log entry for host.
+func newTestLogEntry(host string) (e *logEntry) {
+	return &logEntry{
+		Time:   time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC),
+		QHost:  host,
+		QType:  "A",
+		QClass: "IN",
+		IP:     net.IP{1, 2, 3, 4},
+		Result: filtering.Result{
+			Rules: []*filtering.ResultRule{{
+				Text: "||" + host + "^",
+			}},
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+		Elapsed: 1500 * time.Microsecond,
+	}
+}
+
+func TestClickHouseSink(t *testing.T) {
+	rowsCh := make(chan []*clickHouseRow, 1)
+	var fail atomic.Bool
+	fail.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "INSERT INTO dns.querylog FORMAT JSONEachRow", r.URL.Query().Get("query"))
+		require.Equal(t, "user", r.Header.Get("X-ClickHouse-User"))
+		require.Equal(t, "pass", r.Header.Get("X-ClickHouse-Key"))
+
+		// Fail the first attempt to check the retries.
+		if fail.Swap(false) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		var rows []*clickHouseRow
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			row := &clickHouseRow{}
+			require.NoError(t, json.Unmarshal(sc.Bytes(), row))
+
+			rows = append(rows, row)
+		}
+
+		require.NoError(t, sc.Err())
+
+		rowsCh <- rows
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := newClickHouseSink(
+		newTestClickHouseConfig(srv.URL),
+		srv.Client(),
+		aghnet.NewIPMut(AnonymizeIP),
+	)
+	require.NoError(t, err)
+
+	s.start()
+
+	s.add(newTestLogEntry("first.example"))
+	s.add(newTestLogEntry("second.example"))
+
+	rows, _ := testutil.RequireReceive(t, rowsCh, testTimeout)
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, &clickHouseRow{
+		Time:        "2026-01-02T03:04:05Z",
+		ClientIP:    "1.2.0.0",
+		Host:        "first.example",
+		QType:       "A",
+		QClass:      "IN",
+		Reason:      filtering.FilteredBlockList.String(),
+		Rule:        "||first.example^",
+		ElapsedMs:   1.5,
+		Filtered:    true,
+		ClientProto: string(ClientProtoPlain),
+	}, rows[0])
+	assert.Equal(t, "second.example", rows[1].Host)
+
+	// The remaining entries are inserted on closing.
+	s.add(newTestLogEntry("third.example"))
+	s.close()
+
+	rows, _ = testutil.RequireReceive(t, rowsCh, testTimeout)
+	require.Len(t, rows, 1)
+
+	assert.Equal(t, "third.example", rows[0].Host)
+}
+
+func TestClickHouseSink_noRetry(t *testing.T) {
+	var reqNum atomic.Uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		reqNum.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := newClickHouseSink(newTestClickHouseConfig(srv.URL), srv.Client(), nil)
+	require.NoError(t, err)
+
+	s.insertWithRetry([]*logEntry{newTestLogEntry("example.org")})
+
+	assert.Equal(t, uint32(1), reqNum.Load())
+}
+
+func TestClickHouseConfig_validate(t *testing.T) {
+	testCases := []struct {
+		conf       *ClickHouseConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       newTestClickHouseConfig("https://clickhouse.example:8443"),
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &ClickHouseConfig{
+			URL:        "ftp://clickhouse.example",
+			Table:      "query-log",
+			MaxRetries: 1,
+			TLS: &ClickHouseTLSConfig{
+				CertificatePath: "cert.pem",
+			},
+			Enabled: true,
+		},
+		name: "bad",
+		wantErrMsg: `url: bad scheme "ftp"` + "\n" +
+			`table: bad identifier "query-log"` + "\n" +
+			"batch_size: not positive\n" +
+			"flush_interval: not positive\n" +
+			"retry_interval: not positive\n" +
+			"tls: certificate_path and private_key_path must be set together",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
@@ -146,6 +147,31 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"UF": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(bool)
+		if !ok {
+			return nil
+		}
+
+		ent.UpstreamFallback = v
+
+		return nil
+	},
+	"SW": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := strconv.ParseUint(string(v), 10, 0)
+		if err != nil {
+			return err
+		}
+
+		ent.SampleWeight = uint(i)
+
+		return nil
+	},
 	"Upstream": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(string)
 		if !ok {
@@ -624,6 +650,16 @@ var resultHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"AnswerFilter": func(t json.Token, ent *logEntry) error {
+		s, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.Result.AnswerFilter = s
+
+		return nil
+	},
 	"CanonName": func(t json.Token, ent *logEntry) error {
 		s, ok := t.(string)
 		if !ok {
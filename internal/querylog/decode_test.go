@@ -38,6 +38,8 @@ func TestDecodeLogEntry(t *testing.T) {
 			`"Answer":"` + ansStr + `",` +
 			`"Cached":true,` +
 			`"AD":true,` +
+			`"UF":true,` +
+			`"SW":10,` +
 			`"Result":{` +
 			`"IsFiltered":true,` +
 			`"Reason":3,` +
@@ -89,6 +91,8 @@ func TestDecodeLogEntry(t *testing.T) {
 			Upstream:          "https://some.upstream",
 			Elapsed:           837429,
 			AuthenticatedData: true,
+			UpstreamFallback:  true,
+			SampleWeight:      10,
 		}
 
 		got := &logEntry{}
@@ -0,0 +1,211 @@
+package querylog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// deleteEntries removes the log entries matching params from the memory buffer
+// and from the log files, including the rotated files waiting for archiving.
+// It returns the number of removed entries.  The archives which are already
+// uploaded aren't affected.  Unlike searching, it also removes the matching
+// entries which are hidden from the log, since those are still stored.
+// l.confMu is expected to be locked.
+func (l *queryLog) deleteEntries(params *searchParams) (n int, err error) {
+	// Prevent flushing the buffer while the files are rewritten, so that the
+	// entries are neither lost nor left undeleted.
+	l.fileFlushLock.Lock()
+	defer l.fileFlushLock.Unlock()
+
+	cache := clientCache{}
+	n = l.deleteFromMemory(params, cache)
+
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	paths, err := l.logFiles()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return n, err
+	}
+
+	var errs []error
+	for _, p := range paths {
+		var fileN int
+		fileN, err = l.deleteFromFile(p, params, cache)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		n += fileN
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// logFiles returns the paths of all the log files from the oldest to the
+// newest, including the rotated files waiting for archiving.  Some of those may
+// not exist.  l.fileWriteLock is expected to be locked.
+func (l *queryLog) logFiles() (paths []string, err error) {
+	// The names of the pending files are sortable, since those contain the
+	// rotation time in the [archiveTimeFormat].
+	paths, err = filepath.Glob(l.logFile + archivePendingPrefix + "*")
+	if err != nil {
+		// Shouldn't happen, since the pattern is valid.
+		return nil, fmt.Errorf("listing files pending for archiving: %w", err)
+	}
+
+	return append(paths, l.logFile+".1", l.logFile), nil
+}
+
+// deleteFromMemory removes the entries matching params from the memory buffer
+// and returns the number of removed ones.  It optionally uses the client cache,
+// if provided.
+func (l *queryLog) deleteFromMemory(params *searchParams, cache clientCache) (n int) {
+	l.bufferLock.Lock()
+	defer l.bufferLock.Unlock()
+
+	var kept []*logEntry
+	l.buffer.Range(func(entry *logEntry) (cont bool) {
+		if l.matchEntry(entry.shallowClone(), params, cache) {
+			n++
+		} else {
+			kept = append(kept, entry)
+		}
+
+		return true
+	})
+
+	if n == 0 {
+		return 0
+	}
+
+	l.buffer.Clear()
+	for _, e := range kept {
+		l.buffer.Push(e)
+	}
+
+	return n
+}
+
+// deleteFromFile rewrites the log file at p without the entries matching
+// params and returns the number of removed ones.  It optionally uses the client
+// cache, if provided.  It does nothing if the file doesn't exist.
+func (l *queryLog) deleteFromFile(
+	p string,
+	params *searchParams,
+	cache clientCache,
+) (n int, err error) {
+	src, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("opening log file %q: %w", p, err)
+	}
+
+	dst, err := aghrenameio.NewPendingFile(p, aghos.DefaultPermFile)
+	if err != nil {
+		err = fmt.Errorf("creating temporary file for %q: %w", p, err)
+
+		return 0, errors.WithDeferred(err, src.Close())
+	}
+
+	n, err = l.filterFile(dst, src, params, cache)
+
+	// Close the source before replacing it, since it may not be possible to
+	// rename over an open file on some operating systems.
+	err = errors.WithDeferred(err, src.Close())
+	err = aghrenameio.WithDeferredCleanup(err, dst)
+	if err != nil {
+		return 0, fmt.Errorf("rewriting log file %q: %w", p, err)
+	}
+
+	log.Debug("querylog: deleted %d entries from %q", n, p)
+
+	return n, nil
+}
+
+// filterFile copies the lines of the log file from src to dst except for the
+// entries matching params and returns the number of skipped entries.
+func (l *queryLog) filterFile(
+	dst io.Writer,
+	src io.Reader,
+	params *searchParams,
+	cache clientCache,
+) (n int, err error) {
+	clientFinder := quickMatchClientFinder{
+		client: l.client,
+		cache:  cache,
+	}
+
+	r := bufio.NewReader(src)
+	for {
+		var line []byte
+		line, err = r.ReadBytes('\n')
+		if len(line) > 0 && l.matchLine(line, params, clientFinder, cache) {
+			n++
+		} else if _, writeErr := dst.Write(line); writeErr != nil {
+			return n, writeErr
+		}
+
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// matchLine returns true if the log file line contains an entry matching
+// params.
+func (l *queryLog) matchLine(
+	line []byte,
+	params *searchParams,
+	clientFinder quickMatchClientFinder,
+	cache clientCache,
+) (ok bool) {
+	str := string(bytes.TrimSpace(line))
+	if str == "" || !params.quickMatch(str, clientFinder.findClient) {
+		return false
+	}
+
+	e := &logEntry{}
+	decodeLogEntry(e, str)
+	if e.Time.IsZero() {
+		// Keep the lines which can't be decoded, since there is no way to tell
+		// if those match.
+		return false
+	}
+
+	return l.matchEntry(e, params, cache)
+}
+
+// matchEntry enriches e with the client information and returns true if it
+// matches params.  e is modified, so it must not be the entry from the memory
+// buffer.
+func (l *queryLog) matchEntry(e *logEntry, params *searchParams, cache clientCache) (ok bool) {
+	var err error
+	e.client, err = l.client(e.ClientID, e.IP.String(), cache)
+	if err != nil {
+		log.Error(
+			"querylog: enriching record at time %s for client %q (clientid %q): %s",
+			e.Time,
+			e.IP,
+			e.ClientID,
+			err,
+		)
+
+		// Go on and try to match anyway.
+	}
+
+	return params.match(e)
+}
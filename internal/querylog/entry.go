@@ -38,8 +38,13 @@ type logEntry struct {
 
 	Elapsed time.Duration
 
+	// SampleWeight is the number of requests the entry stands for, if the
+	// entry has been logged while sampling.  It's zero otherwise.
+	SampleWeight uint `json:"SW,omitempty"`
+
 	Cached            bool `json:",omitempty"`
 	AuthenticatedData bool `json:"AD,omitempty"`
+	UpstreamFallback  bool `json:"UF,omitempty"`
 }
 
 // shallowClone returns a shallow clone of e.
@@ -0,0 +1,143 @@
+package querylog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// ClientEntries implements the [QueryLog] interface for *queryLog.
+func (l *queryLog) ClientEntries(
+	match func(clientID string, ip netip.Addr) (ok bool),
+) (entries []map[string]any, err error) {
+	l.confMu.RLock()
+	defer l.confMu.RUnlock()
+
+	// Prevent flushing the buffer while the files are read, so that the
+	// entries are neither missed nor duplicated.
+	l.fileFlushLock.Lock()
+	defer l.fileFlushLock.Unlock()
+
+	var found []*logEntry
+	found, err = l.clientEntriesFromFiles(match)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	func() {
+		l.bufferLock.Lock()
+		defer l.bufferLock.Unlock()
+
+		l.buffer.Range(func(e *logEntry) (cont bool) {
+			if matchClientEntry(e, match) {
+				found = append(found, e)
+			}
+
+			return true
+		})
+	}()
+
+	anonFunc := l.anonymizer.Load()
+	entries = make([]map[string]any, 0, len(found))
+	for _, e := range found {
+		entries = append(entries, entryToJSON(e, anonFunc))
+	}
+
+	return entries, nil
+}
+
+// clientEntriesFromFiles returns the entries matched by match from all the log
+// files from the oldest to the newest.
+func (l *queryLog) clientEntriesFromFiles(
+	match func(clientID string, ip netip.Addr) (ok bool),
+) (entries []*logEntry, err error) {
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	paths, err := l.logFiles()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	for _, p := range paths {
+		var fileEntries []*logEntry
+		fileEntries, err = clientEntriesFromFile(p, match)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		entries = append(entries, fileEntries...)
+	}
+
+	return entries, nil
+}
+
+// clientEntriesFromFile returns the entries matched by match from the log file
+// at p.  It returns nothing if the file doesn't exist.
+func clientEntriesFromFile(
+	p string,
+	match func(clientID string, ip netip.Addr) (ok bool),
+) (entries []*logEntry, err error) {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening log file %q: %w", p, err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	r := bufio.NewReader(f)
+	for {
+		var line string
+		line, err = r.ReadString('\n')
+		if e := decodeClientLine(line); e != nil && matchClientEntry(e, match) {
+			entries = append(entries, e)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading log file %q: %w", p, err)
+		}
+	}
+}
+
+// decodeClientLine decodes the log file line.  e is nil if the line can't be
+// decoded.
+func decodeClientLine(line string) (e *logEntry) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	e = &logEntry{}
+	decodeLogEntry(e, line)
+	if e.Time.IsZero() {
+		log.Debug("querylog: skipping undecodable line %q", line)
+
+		return nil
+	}
+
+	return e
+}
+
+// matchClientEntry returns true if the entry belongs to the client matched by
+// match.
+func matchClientEntry(e *logEntry, match func(clientID string, ip netip.Addr) (ok bool)) (ok bool) {
+	if e.ClientID != "" && match(e.ClientID, netip.Addr{}) {
+		return true
+	}
+
+	ip, ok := netip.AddrFromSlice(e.IP)
+
+	return ok && match("", ip.Unmap())
+}
@@ -54,12 +54,18 @@ type getConfigResp struct {
 	//
 	// TODO(a.garipov): Consider using separate setting for statistics.
 	AnonymizeClientIP aghalg.NullBool `json:"anonymize_client_ip"`
+
+	// SampleRate is the N such that only one of N unfiltered requests is
+	// logged.  If it's nil in a request, the current value is kept.
+	SampleRate *uint `json:"sample_rate,omitempty"`
 }
 
 // Register web handlers
 func (l *queryLog) initWeb() {
 	l.conf.HTTPRegister(http.MethodGet, "/control/querylog", l.handleQueryLog)
 	l.conf.HTTPRegister(http.MethodPost, "/control/querylog_clear", l.handleQueryLogClear)
+	l.conf.HTTPRegister(http.MethodPost, "/control/querylog/delete", l.handleQueryLogDelete)
+	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/stream", l.handleQueryLogStream)
 	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/config", l.handleGetQueryLogConfig)
 	l.conf.HTTPRegister(
 		http.MethodPut,
@@ -101,6 +107,53 @@ func (l *queryLog) handleQueryLogClear(_ http.ResponseWriter, _ *http.Request) {
 	l.clear()
 }
 
+// deleteResp is the response for the POST /control/querylog/delete HTTP API.
+type deleteResp struct {
+	// Deleted is the number of the deleted log entries.
+	Deleted int `json:"deleted"`
+}
+
+// handleQueryLogDelete is the handler for the POST /control/querylog/delete
+// HTTP API.  It accepts the same filtering query parameters as the search,
+// except for the pagination ones.
+func (l *queryLog) handleQueryLogDelete(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	if !params.hasFilters() {
+		aghhttp.Error(
+			r,
+			w,
+			http.StatusBadRequest,
+			"no filters specified; use /control/querylog_clear to clear the log",
+		)
+
+		return
+	}
+
+	var n int
+	func() {
+		l.confMu.RLock()
+		defer l.confMu.RUnlock()
+
+		n, err = l.deleteEntries(params)
+	}()
+
+	log.Info("querylog: deleted %d entries", n)
+
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "deleting entries: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &deleteResp{Deleted: n})
+}
+
 // handleQueryLogInfo is the handler for the GET /control/querylog_info HTTP
 // API.
 //
@@ -137,6 +190,7 @@ func (l *queryLog) handleGetQueryLogConfig(w http.ResponseWriter, r *http.Reques
 			Enabled:           aghalg.BoolToNullBool(l.conf.Enabled),
 			AnonymizeClientIP: aghalg.BoolToNullBool(l.conf.AnonymizeClientIP),
 			Ignored:           l.conf.Ignored.Values(),
+			SampleRate:        &l.conf.SampleRate,
 		}
 	}()
 
@@ -258,6 +312,9 @@ func (l *queryLog) handlePutQueryLogConfig(w http.ResponseWriter, r *http.Reques
 	conf.Ignored = engine
 	conf.RotationIvl = ivl
 	conf.Enabled = newConf.Enabled == aghalg.NBTrue
+	if newConf.SampleRate != nil {
+		conf.SampleRate = *newConf.SampleRate
+	}
 
 	conf.AnonymizeClientIP = newConf.AnonymizeClientIP == aghalg.NBTrue
 	if conf.AnonymizeClientIP {
@@ -343,6 +400,14 @@ func parseSearchParams(r *http.Request) (p *searchParams, err error) {
 		}
 	}
 
+	newerThan := q.Get("newer_than")
+	if len(newerThan) != 0 {
+		p.newerThan, err = time.Parse(time.RFC3339Nano, newerThan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var limit64 int64
 	if limit64, err = strconv.ParseInt(q.Get("limit"), 10, 64); err == nil {
 		p.limit = int(limit64)
@@ -357,6 +422,17 @@ func parseSearchParams(r *http.Request) (p *searchParams, err error) {
 		p.maxFileScanEntries = 0
 	}
 
+	p.searchCriteria, err = parseSearchCriteria(q)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// parseSearchCriteria parses the search criteria from the query string q.
+func parseSearchCriteria(q url.Values) (criteria []searchCriterion, err error) {
 	for _, v := range []struct {
 		urlField string
 		ct       criterionType
@@ -375,9 +451,9 @@ func parseSearchParams(r *http.Request) (p *searchParams, err error) {
 		}
 
 		if ok {
-			p.searchCriteria = append(p.searchCriteria, c)
+			criteria = append(criteria, c)
 		}
 	}
 
-	return p, nil
+	return criteria, nil
 }
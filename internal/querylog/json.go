@@ -62,15 +62,16 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 	anonFunc(entIP)
 
 	jsonEntry = jobject{
-		"reason":       entry.Result.Reason.String(),
-		"elapsedMs":    strconv.FormatFloat(entry.Elapsed.Seconds()*1000, 'f', -1, 64),
-		"time":         entry.Time.Format(time.RFC3339Nano),
-		"client":       entIP,
-		"client_proto": entry.ClientProto,
-		"cached":       entry.Cached,
-		"upstream":     entry.Upstream,
-		"question":     question,
-		"rules":        resultRulesToJSONRules(entry.Result.Rules),
+		"reason":            entry.Result.Reason.String(),
+		"elapsedMs":         strconv.FormatFloat(entry.Elapsed.Seconds()*1000, 'f', -1, 64),
+		"time":              entry.Time.Format(time.RFC3339Nano),
+		"client":            entIP,
+		"client_proto":      entry.ClientProto,
+		"cached":            entry.Cached,
+		"upstream":          entry.Upstream,
+		"upstream_fallback": entry.UpstreamFallback,
+		"question":          question,
+		"rules":             resultRulesToJSONRules(entry.Result.Rules),
 	}
 
 	if entIP.Equal(entry.IP) {
@@ -85,6 +86,10 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 		jsonEntry["ecs"] = entry.ReqECS
 	}
 
+	if entry.SampleWeight > 0 {
+		jsonEntry["sample_weight"] = entry.SampleWeight
+	}
+
 	if len(entry.Result.Rules) > 0 {
 		if r := entry.Result.Rules[0]; len(r.Text) > 0 {
 			jsonEntry["rule"] = r.Text
@@ -96,6 +101,10 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 		jsonEntry["service_name"] = entry.Result.ServiceName
 	}
 
+	if len(entry.Result.AnswerFilter) != 0 {
+		jsonEntry["answer_filter"] = entry.Result.AnswerFilter
+	}
+
 	setMsgData(entry, jsonEntry)
 	setOrigAns(entry, jsonEntry)
 
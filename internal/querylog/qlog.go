@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -34,6 +35,23 @@ type queryLog struct {
 	// be modified.
 	buffer *container.RingBuffer[*logEntry]
 
+	// archiver uploads the rotated log files, if archiving is enabled.
+	archiver *archiver
+
+	// clickHouse streams the entries into ClickHouse, if it's enabled.
+	clickHouse *clickHouseSink
+
+	// syslog sends the entries to a syslog server, if it's enabled.
+	syslog *syslogSink
+
+	// aggregates shares the aggregates of the blocked requests, if it's
+	// enabled.
+	aggregates *aggregatesSharer
+
+	// stream distributes the added entries among the subscribers of the live
+	// stream.
+	stream *liveStream
+
 	// logFile is the path to the log file.
 	logFile string
 
@@ -44,6 +62,10 @@ type queryLog struct {
 	fileFlushLock sync.Mutex
 	fileWriteLock sync.Mutex
 
+	// sampleCounter is the number of the unfiltered requests seen while
+	// sampling.
+	sampleCounter atomic.Uint64
+
 	flushPending bool
 }
 
@@ -81,10 +103,45 @@ func (l *queryLog) Start() {
 		l.initWeb()
 	}
 
+	if l.archiver != nil {
+		// Upload the files left since the previous run.
+		go l.archiver.uploadPending()
+	}
+
+	if l.clickHouse != nil {
+		l.clickHouse.start()
+	}
+
+	if l.syslog != nil {
+		l.syslog.start()
+	}
+
+	if l.aggregates != nil {
+		l.aggregates.start()
+	}
+
 	go l.periodicRotate()
 }
 
 func (l *queryLog) Close() {
+	l.stream.close()
+
+	if l.archiver != nil {
+		l.archiver.close()
+	}
+
+	if l.clickHouse != nil {
+		l.clickHouse.close()
+	}
+
+	if l.syslog != nil {
+		l.syslog.close()
+	}
+
+	if l.aggregates != nil {
+		l.aggregates.close()
+	}
+
 	l.confMu.RLock()
 	defer l.confMu.RUnlock()
 
@@ -181,6 +238,7 @@ func newLogEntry(params *AddParams) (entry *logEntry) {
 
 		Cached:            params.Cached,
 		AuthenticatedData: params.AuthenticatedData,
+		UpstreamFallback:  params.UpstreamFallback,
 	}
 
 	if params.ReqECS != nil {
@@ -196,13 +254,13 @@ func newLogEntry(params *AddParams) (entry *logEntry) {
 // Add implements the [QueryLog] interface for *queryLog.
 func (l *queryLog) Add(params *AddParams) {
 	var isEnabled, fileIsEnabled bool
-	var memSize uint
+	var memSize, sampleRate uint
 	func() {
 		l.confMu.RLock()
 		defer l.confMu.RUnlock()
 
 		isEnabled, fileIsEnabled = l.conf.Enabled, l.conf.FileEnabled
-		memSize = l.conf.MemSize
+		memSize, sampleRate = l.conf.MemSize, l.conf.SampleRate
 	}()
 
 	if !isEnabled {
@@ -220,7 +278,27 @@ func (l *queryLog) Add(params *AddParams) {
 		params.Result = &filtering.Result{}
 	}
 
+	weight, ok := l.sample(params.Result, sampleRate)
+	if !ok {
+		return
+	}
+
 	entry := newLogEntry(params)
+	entry.SampleWeight = weight
+
+	if l.clickHouse != nil {
+		l.clickHouse.add(entry)
+	}
+
+	if l.syslog != nil {
+		l.syslog.add(entry)
+	}
+
+	if l.aggregates != nil {
+		l.aggregates.add(entry)
+	}
+
+	l.stream.add(entry)
 
 	l.bufferLock.Lock()
 	defer l.bufferLock.Unlock()
@@ -240,6 +318,19 @@ func (l *queryLog) Add(params *AddParams) {
 	}
 }
 
+// sample returns true if the request with the filtering result res should be
+// logged in accordance with rate.  weight is the number of requests the logged
+// entry stands for, or zero if the request isn't subject to sampling.
+func (l *queryLog) sample(res *filtering.Result, rate uint) (weight uint, ok bool) {
+	if rate <= 1 || res.IsFiltered {
+		return 0, true
+	}
+
+	n := l.sampleCounter.Add(1)
+
+	return rate, (n-1)%uint64(rate) == 0
+}
+
 // ShouldLog returns true if request for the host should be logged.
 func (l *queryLog) ShouldLog(host string, _, _ uint16, ids []string) bool {
 	l.confMu.RLock()
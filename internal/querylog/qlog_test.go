@@ -3,6 +3,7 @@ package querylog
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -128,6 +129,97 @@ func TestQueryLog(t *testing.T) {
 	}
 }
 
+func TestQueryLog_deleteEntries(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	// Add entries to the rotated file.
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+	require.NoError(t, l.flushLogBuffer())
+	require.NoError(t, l.rotate())
+
+	// Add entries to the current file.
+	addEntry(l, "example.com", net.IPv4(1, 1, 1, 3), net.IPv4(2, 2, 2, 2))
+	addEntry(l, "example.net", net.IPv4(1, 1, 1, 4), net.IPv4(2, 2, 2, 3))
+	require.NoError(t, l.flushLogBuffer())
+
+	// Add memory entries.
+	addEntry(l, "test.example.org", net.IPv4(1, 1, 1, 5), net.IPv4(2, 2, 2, 2))
+	addEntry(l, "example.com", net.IPv4(1, 1, 1, 6), net.IPv4(2, 2, 2, 3))
+
+	params := newSearchParams()
+	params.searchCriteria = []searchCriterion{{
+		criterionType: ctTerm,
+		strict:        true,
+		value:         "2.2.2.2",
+	}}
+
+	n, err := l.deleteEntries(params)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, n)
+
+	params.searchCriteria = []searchCriterion{{
+		criterionType: ctTerm,
+		strict:        true,
+		value:         "example.com",
+	}}
+
+	n, err = l.deleteEntries(params)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, n)
+
+	entries, _ := l.search(newSearchParams())
+	require.Len(t, entries, 2)
+
+	assertLogEntry(t, entries[0], "example.net", net.IPv4(1, 1, 1, 4), net.IPv4(2, 2, 2, 3))
+	assertLogEntry(t, entries[1], "example.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+}
+
+func TestQueryLog_ClientEntries(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+		Anonymizer:  aghnet.NewIPMut(nil),
+	})
+	require.NoError(t, err)
+
+	cliIP := netip.MustParseAddr("2.2.2.1")
+
+	addEntry(l, "first.example", net.IPv4(1, 1, 1, 1), cliIP.AsSlice())
+	addEntry(l, "other.example", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+	require.NoError(t, l.flushLogBuffer())
+	require.NoError(t, l.rotate())
+
+	addEntry(l, "second.example", net.IPv4(1, 1, 1, 3), cliIP.AsSlice())
+	require.NoError(t, l.flushLogBuffer())
+
+	addEntry(l, "third.example", net.IPv4(1, 1, 1, 4), cliIP.AsSlice())
+	addEntry(l, "other.example", net.IPv4(1, 1, 1, 5), net.IPv4(2, 2, 2, 2))
+
+	entries, err := l.ClientEntries(func(_ string, ip netip.Addr) (ok bool) {
+		return ip == cliIP
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	for i, want := range []string{"first.example", "second.example", "third.example"} {
+		q := testutil.RequireTypeAssert[map[string]any](t, entries[i]["question"])
+		assert.Equal(t, want, q["name"])
+	}
+}
+
 func TestQueryLogOffsetLimit(t *testing.T) {
 	l, err := newQueryLog(Config{
 		Enabled:     true,
@@ -254,6 +346,43 @@ func TestQueryLogFileDisabled(t *testing.T) {
 	assert.Equal(t, "example2.org", ll[1].QHost)
 }
 
+func TestQueryLog_sampling(t *testing.T) {
+	const sampleRate = 3
+
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: false,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		SampleRate:  sampleRate,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	for i := range 2 * sampleRate {
+		l.Add(&AddParams{
+			Question: (&dns.Msg{}).SetQuestion(fmt.Sprintf("unfiltered%d.example.", i), dns.TypeA),
+			Result:   &filtering.Result{},
+			ClientIP: net.IPv4(2, 2, 2, 1),
+		})
+	}
+
+	// The filtered requests are always logged.
+	addEntry(l, "filtered.example", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+
+	ll, _ := l.search(newSearchParams())
+	require.Len(t, ll, 3)
+
+	assert.Equal(t, "filtered.example", ll[0].QHost)
+	assert.Zero(t, ll[0].SampleWeight)
+
+	assert.Equal(t, "unfiltered3.example", ll[1].QHost)
+	assert.Equal(t, uint(sampleRate), ll[1].SampleWeight)
+
+	assert.Equal(t, "unfiltered0.example", ll[2].QHost)
+	assert.Equal(t, uint(sampleRate), ll[2].SampleWeight)
+}
+
 func TestQueryLogShouldLog(t *testing.T) {
 	const (
 		ignored1        = "ignor.ed"
@@ -3,6 +3,8 @@ package querylog
 import (
 	"fmt"
 	"net"
+	"net/http"
+	"net/netip"
 	"path/filepath"
 	"sync"
 	"time"
@@ -30,6 +32,13 @@ type QueryLog interface {
 
 	// ShouldLog returns true if request for the host should be logged.
 	ShouldLog(host string, qType, qClass uint16, ids []string) bool
+
+	// ClientEntries returns all the stored log entries of the client matched by
+	// match, from the oldest to the newest, in the same JSON form as in the
+	// HTTP API.  match is called with either clientID or ip set.
+	ClientEntries(
+		match func(clientID string, ip netip.Addr) (ok bool),
+	) (entries []map[string]any, err error)
 }
 
 // Config is the query log configuration structure.
@@ -53,6 +62,27 @@ type Config struct {
 	// FindClient returns client information by their IDs.
 	FindClient func(ids []string) (c *Client, err error)
 
+	// HTTPClient is the client used for archiving the rotated log files,
+	// streaming the entries into ClickHouse, and sharing the aggregates.  If
+	// nil, [http.DefaultClient] is used.
+	HTTPClient *http.Client
+
+	// Archive is the configuration for archiving the rotated log files.  If
+	// nil or disabled, the rotated files are overwritten on the next rotation.
+	Archive *ArchiveConfig
+
+	// ClickHouse is the configuration for streaming the log entries into
+	// ClickHouse.  If nil or disabled, the entries aren't streamed.
+	ClickHouse *ClickHouseConfig
+
+	// Syslog is the configuration for sending the log entries to a syslog
+	// server.  If nil or disabled, the entries aren't sent.
+	Syslog *SyslogConfig
+
+	// Aggregates is the configuration for sharing the anonymous aggregates of
+	// the blocked requests.  If nil or disabled, nothing is shared.
+	Aggregates *AggregatesConfig
+
 	// BaseDir is the base directory for log files.
 	BaseDir string
 
@@ -65,6 +95,11 @@ type Config struct {
 	// flushed to disk.
 	MemSize uint
 
+	// SampleRate is the N such that only one of N unfiltered requests is
+	// logged, while the filtered ones are always logged.  If it's zero or one,
+	// all requests are logged.
+	SampleRate uint
+
 	// Enabled tells if the query log is enabled.
 	Enabled bool
 
@@ -109,6 +144,10 @@ type AddParams struct {
 	// Cached indicates if the response is served from cache.
 	Cached bool
 
+	// UpstreamFallback indicates if the response is received from a fallback
+	// upstream, since all the upstreams have failed.
+	UpstreamFallback bool
+
 	// AuthenticatedData shows if the response had the AD bit set.
 	AuthenticatedData bool
 }
@@ -160,6 +199,8 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		logFile: filepath.Join(conf.BaseDir, queryLogFileName),
 
 		anonymizer: conf.Anonymizer,
+
+		stream: newLiveStream(),
 	}
 
 	*l.conf = conf
@@ -169,5 +210,29 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		return nil, fmt.Errorf("unsupported interval: %w", err)
 	}
 
+	l.archiver, err = newArchiver(conf.Archive, conf.HTTPClient, l.logFile)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	l.clickHouse, err = newClickHouseSink(conf.ClickHouse, conf.HTTPClient, conf.Anonymizer)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	l.syslog, err = newSyslogSink(conf.Syslog, conf.Anonymizer)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	l.aggregates, err = newAggregatesSharer(conf.Aggregates, conf.HTTPClient)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
 	return l, nil
 }
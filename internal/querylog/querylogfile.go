@@ -88,10 +88,24 @@ func (l *queryLog) flushToFile(b *bytes.Buffer) (err error) {
 	return nil
 }
 
+// rotate renames the current log file to the rotated one keeping the previous
+// rotated file for archiving, if necessary.
 func (l *queryLog) rotate() error {
+	// Prevent rotating the files while those are written or rewritten.
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
 	from := l.logFile
 	to := l.logFile + ".1"
 
+	if l.archiver != nil {
+		err := l.keepForArchive(from, to)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return err
+		}
+	}
+
 	err := os.Rename(from, to)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -105,9 +119,27 @@ func (l *queryLog) rotate() error {
 
 	log.Debug("querylog: renamed %s into %s", from, to)
 
+	if l.archiver != nil {
+		go l.archiver.uploadPending()
+	}
+
 	return nil
 }
 
+// keepForArchive keeps the previously rotated file at to for archiving, if the
+// file at from is going to replace it.
+func (l *queryLog) keepForArchive(from, to string) (err error) {
+	_, err = os.Stat(from)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking log file: %w", err)
+	}
+
+	// Don't wrap the error, because it's informative enough as is.
+	return l.archiver.keep(to, time.Now())
+}
+
 func (l *queryLog) readFileFirstTimeValue() (first time.Time, err error) {
 	var f *os.File
 	f, err = os.Open(l.logFile)
@@ -176,6 +176,10 @@ func (c *searchCriterion) ctFilteringStatusCase(
 		return !reason.In(
 			filtering.FilteredBlockList,
 			filtering.FilteredBlockedService,
+			filtering.FilteredPaused,
+			filtering.FilteredQUIC,
+			filtering.FilteredAnswerIP,
+			filtering.FilteredRebinding,
 			filtering.NotFilteredAllowList,
 		)
 	default:
@@ -194,7 +198,14 @@ func (c *searchCriterion) ctFilteringStatusCase(
 func (c *searchCriterion) isFilteredWithReason(reason filtering.Reason) (matched bool) {
 	switch c.value {
 	case filteringStatusBlocked:
-		return reason.In(filtering.FilteredBlockList, filtering.FilteredBlockedService)
+		return reason.In(
+			filtering.FilteredBlockList,
+			filtering.FilteredBlockedService,
+			filtering.FilteredPaused,
+			filtering.FilteredQUIC,
+			filtering.FilteredAnswerIP,
+			filtering.FilteredRebinding,
+		)
 	case filteringStatusBlockedParental:
 		return reason == filtering.FilteredParental
 	case filteringStatusBlockedSafebrowsing:
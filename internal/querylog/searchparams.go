@@ -8,6 +8,10 @@ type searchParams struct {
 	// parameter value.  If not set, disregard it and return any value.
 	olderThan time.Time
 
+	// newerThan represents a parameter for entries that are newer than this
+	// parameter value.  If not set, disregard it and return any value.
+	newerThan time.Time
+
 	// searchCriteria is a list of search criteria that we use to get filter
 	// results.
 	searchCriteria []searchCriterion
@@ -34,6 +38,11 @@ func newSearchParams() *searchParams {
 	}
 }
 
+// hasFilters returns true if s restricts the entries by their time or contents.
+func (s *searchParams) hasFilters() (ok bool) {
+	return !s.olderThan.IsZero() || !s.newerThan.IsZero() || len(s.searchCriteria) > 0
+}
+
 // quickMatchClientFunc is a simplified client finder for quick matches.
 type quickMatchClientFunc = func(clientID, ip string) (c *Client)
 
@@ -57,6 +66,11 @@ func (s *searchParams) match(entry *logEntry) bool {
 		return false
 	}
 
+	if !s.newerThan.IsZero() && !entry.Time.After(s.newerThan) {
+		// Ignore entries older than what was requested.
+		return false
+	}
+
 	for _, c := range s.searchCriteria {
 		if !c.match(entry) {
 			return false
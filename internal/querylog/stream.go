@@ -0,0 +1,247 @@
+package querylog
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamBufSize is the number of entries buffered for a single subscriber
+	// of the live stream.  The entries are dropped for the subscribers that
+	// fall behind.
+	streamBufSize = 256
+
+	// streamWriteTimeout is the maximum duration of sending a single entry to
+	// a subscriber of the live stream.
+	streamWriteTimeout = 10 * time.Second
+
+	// streamClientCacheSize is the maximum number of cached clients for a
+	// single subscriber of the live stream, after which the cache is reset.
+	streamClientCacheSize = 1000
+)
+
+// streamSubscriber is a single subscriber of the live stream of the query log
+// entries.
+type streamSubscriber struct {
+	// entries receives the added entries.  It's closed when the stream is
+	// closed.  The entries must not be modified.
+	entries chan *logEntry
+}
+
+// liveStream distributes the added query log entries among the subscribers.
+type liveStream struct {
+	// mu protects subs and closed.
+	mu *sync.Mutex
+
+	// subs are the current subscribers of the stream.
+	subs map[*streamSubscriber]struct{}
+
+	// closed is true if the stream is closed and accepts no more subscribers.
+	closed bool
+}
+
+// newLiveStream returns a new properly initialized *liveStream.
+func newLiveStream() (s *liveStream) {
+	return &liveStream{
+		mu:   &sync.Mutex{},
+		subs: map[*streamSubscriber]struct{}{},
+	}
+}
+
+// subscribe adds a new subscriber to the stream.  sub is nil if the stream is
+// closed.
+func (s *liveStream) subscribe() (sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	sub = &streamSubscriber{
+		entries: make(chan *logEntry, streamBufSize),
+	}
+	s.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// unsubscribe removes sub from the stream.
+func (s *liveStream) unsubscribe(sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subs, sub)
+}
+
+// add sends e to all subscribers without blocking.  e must not be modified
+// after that.
+func (s *liveStream) add(e *logEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subs {
+		select {
+		case sub.entries <- e:
+		default:
+			log.Debug("querylog: stream: subscriber is too slow, dropping entry")
+		}
+	}
+}
+
+// close closes the entries channels of all subscribers and prevents new ones
+// from subscribing.
+func (s *liveStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for sub := range s.subs {
+		close(sub.entries)
+		delete(s.subs, sub)
+	}
+}
+
+// handleQueryLogStream is the handler for the GET /control/querylog/stream
+// HTTP API.  It upgrades the connection to WebSocket and sends the JSON
+// objects of the added query log entries matching the search criteria of the
+// request.
+func (l *queryLog) handleQueryLogStream(w http.ResponseWriter, r *http.Request) {
+	criteria, err := parseSearchCriteria(r.URL.Query())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	params := &searchParams{
+		searchCriteria: criteria,
+	}
+
+	srv := &websocket.Server{
+		Handshake: checkStreamOrigin,
+		Handler: func(ws *websocket.Conn) {
+			l.serveStream(ws, params)
+		},
+	}
+
+	srv.ServeHTTP(w, r)
+}
+
+// checkStreamOrigin returns an error if the WebSocket request r comes from a
+// web page of a different host, to prevent cross-site WebSocket hijacking.  The
+// requests without the Origin header, which aren't sent by browsers, are
+// allowed.
+func checkStreamOrigin(conf *websocket.Config, r *http.Request) (err error) {
+	conf.Origin, err = websocket.Origin(conf, r)
+	if err != nil {
+		return fmt.Errorf("parsing origin: %w", err)
+	}
+
+	if conf.Origin != nil && conf.Origin.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", conf.Origin.Host)
+	}
+
+	return nil
+}
+
+// serveStream sends the added query log entries matching params to ws until
+// either the connection or the query log is closed.
+func (l *queryLog) serveStream(ws *websocket.Conn, params *searchParams) {
+	defer func() {
+		err := ws.Close()
+		if err != nil {
+			log.Debug("querylog: stream: closing connection: %s", err)
+		}
+	}()
+
+	// Reset the deadlines possibly set by the HTTP server.
+	err := ws.SetDeadline(time.Time{})
+	if err != nil {
+		log.Debug("querylog: stream: resetting deadline: %s", err)
+
+		return
+	}
+
+	sub := l.stream.subscribe()
+	if sub == nil {
+		return
+	}
+	defer l.stream.unsubscribe(sub)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Discard the incoming messages, only detecting the closing of the
+		// connection.
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	cache := clientCache{}
+	for {
+		select {
+		case <-done:
+			return
+		case e, ok := <-sub.entries:
+			if !ok {
+				return
+			}
+
+			err = l.sendStreamEntry(ws, e, params, cache)
+			if err != nil {
+				log.Debug("querylog: stream: %s", err)
+
+				return
+			}
+		}
+	}
+}
+
+// sendStreamEntry sends the JSON object of entry to ws if it matches params.
+// cache is used to find the clients and is reset when it grows too large.
+// entry isn't modified.
+func (l *queryLog) sendStreamEntry(
+	ws *websocket.Conn,
+	entry *logEntry,
+	params *searchParams,
+	cache clientCache,
+) (err error) {
+	if len(cache) >= streamClientCacheSize {
+		clear(cache)
+	}
+
+	// A shallow clone is enough, since only the client field is modified.
+	e := entry.shallowClone()
+	e.client, err = l.client(e.ClientID, e.IP.String(), cache)
+	if err != nil {
+		msg := "querylog: stream: enriching record for client %q (clientid %q): %s"
+		log.Error(msg, e.IP, e.ClientID, err)
+
+		// Go on and try to match anyway.
+	}
+
+	if !params.match(e) {
+		return nil
+	}
+
+	err = ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil {
+		return fmt.Errorf("setting write deadline: %w", err)
+	}
+
+	err = websocket.JSON.Send(ws, entryToJSON(e, l.anonymizer.Load()))
+	if err != nil {
+		return fmt.Errorf("sending entry: %w", err)
+	}
+
+	return nil
+}
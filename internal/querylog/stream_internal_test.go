@@ -0,0 +1,106 @@
+package querylog
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// testStreamTimeout is the common timeout for the live stream tests.
+const testStreamTimeout = 1 * time.Second
+
+// newTestStreamServer returns a new query log and the URL of the test server
+// serving its live stream.
+func newTestStreamServer(t *testing.T) (l *queryLog, u string) {
+	t.Helper()
+
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+		Anonymizer:  aghnet.NewIPMut(nil),
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(l.handleQueryLogStream))
+	t.Cleanup(srv.Close)
+	t.Cleanup(l.stream.close)
+
+	return l, strings.Replace(srv.URL, "http", "ws", 1)
+}
+
+// requireSubscribers waits until l has n subscribers of the live stream.
+func requireSubscribers(t *testing.T, l *queryLog, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() (ok bool) {
+		l.stream.mu.Lock()
+		defer l.stream.mu.Unlock()
+
+		return len(l.stream.subs) == n
+	}, testStreamTimeout, testStreamTimeout/100)
+}
+
+func TestQueryLog_handleQueryLogStream(t *testing.T) {
+	l, u := newTestStreamServer(t)
+
+	origin := strings.Replace(u, "ws", "http", 1)
+	ws, err := websocket.Dial(u+"?search=example.com", "", origin)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+
+	requireSubscribers(t, l, 1)
+
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	addEntry(l, "test.example.com", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(testStreamTimeout)))
+
+	var entry jobject
+	err = websocket.JSON.Receive(ws, &entry)
+	require.NoError(t, err)
+
+	question, ok := entry["question"].(jobject)
+	require.True(t, ok)
+
+	assert.Equal(t, "test.example.com", question["name"])
+
+	require.NoError(t, ws.Close())
+
+	requireSubscribers(t, l, 0)
+}
+
+func TestQueryLog_handleQueryLogStream_origin(t *testing.T) {
+	_, u := newTestStreamServer(t)
+
+	_, err := websocket.Dial(u, "", "http://evil.example")
+	assert.Error(t, err)
+}
+
+func TestQueryLog_handleQueryLogStream_close(t *testing.T) {
+	l, u := newTestStreamServer(t)
+
+	ws, err := websocket.Dial(u, "", strings.Replace(u, "ws", "http", 1))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+
+	requireSubscribers(t, l, 1)
+
+	l.stream.close()
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(testStreamTimeout)))
+
+	var msg []byte
+	err = websocket.Message.Receive(ws, &msg)
+	assert.Error(t, err)
+}
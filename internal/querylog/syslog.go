@@ -0,0 +1,595 @@
+package querylog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// SyslogProtocol is the transport protocol of the connections to the syslog
+// server.
+type SyslogProtocol string
+
+// Valid SyslogProtocol values.
+const (
+	SyslogProtocolUDP SyslogProtocol = "udp"
+	SyslogProtocolTCP SyslogProtocol = "tcp"
+	SyslogProtocolTLS SyslogProtocol = "tls"
+)
+
+// SyslogFormat is the format of the messages sent to the syslog server.
+type SyslogFormat string
+
+// Valid SyslogFormat values.
+const (
+	// SyslogFormatCEF is the ArcSight Common Event Format.
+	SyslogFormatCEF SyslogFormat = "cef"
+
+	// SyslogFormatLEEF is the QRadar Log Event Extended Format, version 1.0.
+	SyslogFormatLEEF SyslogFormat = "leef"
+)
+
+// SyslogConfig is the configuration for sending the query log entries to a
+// syslog server as RFC 5424 messages, for example to be collected by a SIEM.
+// The messages over TCP and TLS are framed using the octet counting described
+// in RFC 6587.
+type SyslogConfig struct {
+	// Address is the host and the port of the syslog server, for example
+	// "siem.example:6514".
+	Address string `yaml:"address"`
+
+	// Protocol is the transport protocol of the connections to the server.
+	Protocol SyslogProtocol `yaml:"protocol"`
+
+	// Format is the format of the messages.
+	Format SyslogFormat `yaml:"format"`
+
+	// Hostname is the value of the HOSTNAME field of the messages.  If empty,
+	// the hostname of the machine is used.
+	Hostname string `yaml:"hostname"`
+
+	// TLS is the TLS configuration for the connections over TLS.  If nil, the
+	// system settings are used.
+	TLS *SyslogTLSConfig `yaml:"tls,omitempty"`
+
+	// Enabled defines if the entries are sent to the syslog server.
+	Enabled bool `yaml:"enabled"`
+}
+
+// SyslogTLSConfig is the TLS configuration of the connections to the syslog
+// server.
+type SyslogTLSConfig struct {
+	// CAPath is the path to the PEM-encoded certificates of the authorities
+	// used to verify the server certificate instead of the system ones.
+	CAPath string `yaml:"ca_path"`
+
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// validate returns an error if the syslog configuration is invalid.  c is
+// assumed to be enabled.
+func (c *SyslogConfig) validate() (err error) {
+	var errs []error
+
+	_, _, err = net.SplitHostPort(c.Address)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("address: %w", err))
+	}
+
+	switch c.Protocol {
+	case SyslogProtocolUDP, SyslogProtocolTCP, SyslogProtocolTLS:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("protocol: bad value %q", c.Protocol))
+	}
+
+	switch c.Format {
+	case SyslogFormatCEF, SyslogFormatLEEF:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("format: bad value %q", c.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+const (
+	// syslogQueueSize is the number of the entries the queue of the entries
+	// waiting for being sent holds.  The entries added while the queue is
+	// full are dropped.
+	syslogQueueSize = 1024
+
+	// syslogTimeout is the timeout of connecting to the syslog server and of
+	// sending a single message.
+	syslogTimeout = 10 * time.Second
+
+	// syslogFacility is the facility of the messages, local0.
+	syslogFacility = 16
+
+	// Severities of the messages about the filtered and other requests.
+	syslogSeverityWarning = 4
+	syslogSeverityInfo    = 6
+
+	// syslogAppName is the APP-NAME field of the messages.
+	syslogAppName = "AdGuardHome"
+
+	// syslogMsgID is the MSGID field of the messages.
+	syslogMsgID = "dnsquery"
+
+	// syslogTimeFormat is the format of the TIMESTAMP field of the messages,
+	// which allows at most six digits of the fractional seconds.
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// Vendor and product names of the CEF and LEEF messages.
+const (
+	siemVendor  = "AdGuard"
+	siemProduct = "AdGuard Home"
+)
+
+// syslogSink sends the query log entries to a syslog server.
+type syslogSink struct {
+	conf *SyslogConfig
+
+	// tlsConf is the TLS configuration of the connections over TLS.  It's nil
+	// for other protocols.
+	tlsConf *tls.Config
+
+	// anonymizer processes the IP addresses of the sent entries.  It may be
+	// nil.
+	anonymizer *aghnet.IPMut
+
+	// conn is the current connection to the server.  It's only accessed by the
+	// goroutine started by [syslogSink.start] and is nil if there is no
+	// connection.
+	conn net.Conn
+
+	// entries is the queue of the entries waiting for being sent.
+	entries chan *logEntry
+
+	// done is closed to stop the sink.
+	done chan struct{}
+
+	// stopped is closed once the remaining entries have been sent after done
+	// is closed.
+	stopped chan struct{}
+
+	// header is the part of the messages after the timestamp up to the
+	// structured data, inclusive.
+	header string
+}
+
+// newSyslogSink returns a new properly initialized *syslogSink or nil if conf
+// is nil or disabled.
+func newSyslogSink(conf *SyslogConfig, anonymizer *aghnet.IPMut) (s *syslogSink, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = conf.validate()
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+
+	var tlsConf *tls.Config
+	if conf.Protocol == SyslogProtocolTLS {
+		tlsConf, err = newSyslogTLSConfig(conf.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("syslog: tls: %w", err)
+		}
+	}
+
+	hostname := conf.Hostname
+	if hostname == "" {
+		hostname, err = os.Hostname()
+		if err != nil {
+			log.Info("querylog: syslog: warning: getting hostname: %s", err)
+		}
+	}
+
+	return &syslogSink{
+		conf:       conf,
+		tlsConf:    tlsConf,
+		anonymizer: anonymizer,
+		entries:    make(chan *logEntry, syslogQueueSize),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		header: fmt.Sprintf(
+			" %s %s %d %s - ",
+			syslogHeaderField(hostname),
+			syslogAppName,
+			os.Getpid(),
+			syslogMsgID,
+		),
+	}, nil
+}
+
+// newSyslogTLSConfig returns the TLS configuration using the settings from
+// conf, which may be nil.
+func newSyslogTLSConfig(conf *SyslogTLSConfig) (c *tls.Config, err error) {
+	c = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if conf == nil {
+		return c, nil
+	}
+
+	c.InsecureSkipVerify = conf.InsecureSkipVerify
+
+	if conf.CAPath != "" {
+		var pem []byte
+		pem, err = os.ReadFile(conf.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca: %w", err)
+		}
+
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca: no certificates in %q", conf.CAPath)
+		}
+	}
+
+	return c, nil
+}
+
+// syslogHeaderField returns v suitable for a header field of a syslog message,
+// which must consist of the printable ASCII characters.  An empty v is replaced
+// with the NILVALUE.
+func syslogHeaderField(v string) (field string) {
+	field = strings.Map(func(r rune) (res rune) {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+
+		return r
+	}, v)
+
+	if field == "" {
+		return "-"
+	}
+
+	return field
+}
+
+// start starts sending the entries in the background.
+func (s *syslogSink) start() {
+	go s.run()
+}
+
+// close stops the sink after sending the queued entries.  It must only be
+// called once and only after [syslogSink.start].
+func (s *syslogSink) close() {
+	close(s.done)
+	<-s.stopped
+}
+
+// add queues e for being sent.  If the queue is full, e is dropped.  e must not
+// be modified after that.
+func (s *syslogSink) add(e *logEntry) {
+	select {
+	case s.entries <- e:
+		// Go on.
+	default:
+		log.Debug("querylog: syslog: queue is full, dropping entry")
+	}
+}
+
+// run sends the entries until the sink is closed.
+func (s *syslogSink) run() {
+	defer log.OnPanic("querylog: syslog")
+	defer close(s.stopped)
+
+	for {
+		select {
+		case e := <-s.entries:
+			s.send(e)
+		case <-s.done:
+			s.drain()
+
+			return
+		}
+	}
+}
+
+// drain sends the entries left in the queue and closes the connection.
+func (s *syslogSink) drain() {
+	for {
+		select {
+		case e := <-s.entries:
+			s.send(e)
+		default:
+			s.closeConn()
+
+			return
+		}
+	}
+}
+
+// send sends the message about e to the server, reconnecting once if the
+// connection has been broken.  The message is dropped if it fails.
+func (s *syslogSink) send(e *logEntry) {
+	msg := s.frame(s.message(e))
+
+	var err error
+	for range 2 {
+		err = s.write(msg)
+		if err == nil {
+			return
+		}
+
+		s.closeConn()
+	}
+
+	log.Error("querylog: syslog: sending message: %s, dropping", err)
+}
+
+// write writes msg to the current connection, connecting to the server first
+// if there is none.
+func (s *syslogSink) write(msg []byte) (err error) {
+	if s.conn == nil {
+		s.conn, err = s.dial()
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return err
+		}
+	}
+
+	err = s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+
+	_, err = s.conn.Write(msg)
+
+	// Don't wrap the error, because it's informative enough as is.
+	return err
+}
+
+// dial connects to the server using the configured protocol.
+func (s *syslogSink) dial() (conn net.Conn, err error) {
+	d := &net.Dialer{
+		Timeout: syslogTimeout,
+	}
+
+	switch s.conf.Protocol {
+	case SyslogProtocolTLS:
+		conf := s.tlsConf.Clone()
+		if conf.ServerName == "" {
+			conf.ServerName, _, _ = net.SplitHostPort(s.conf.Address)
+		}
+
+		return tls.DialWithDialer(d, "tcp", s.conf.Address, conf)
+	default:
+		return d.Dial(string(s.conf.Protocol), s.conf.Address)
+	}
+}
+
+// closeConn closes the current connection, if any.
+func (s *syslogSink) closeConn() {
+	if s.conn == nil {
+		return
+	}
+
+	err := s.conn.Close()
+	if err != nil {
+		log.Debug("querylog: syslog: closing connection: %s", err)
+	}
+
+	s.conn = nil
+}
+
+// frame returns msg framed for the configured protocol.
+func (s *syslogSink) frame(msg string) (framed []byte) {
+	if s.conf.Protocol == SyslogProtocolUDP {
+		return []byte(msg)
+	}
+
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
+
+// message returns the syslog message about e.
+func (s *syslogSink) message(e *logEntry) (msg string) {
+	ip := e.IP
+	if s.anonymizer != nil {
+		if anon := s.anonymizer.Load(); anon != nil {
+			ip = slices.Clone(ip)
+			anon(ip)
+		}
+	}
+
+	sev := syslogSeverityInfo
+	if e.Result.IsFiltered {
+		sev = syslogSeverityWarning
+	}
+
+	var body string
+	switch s.conf.Format {
+	case SyslogFormatLEEF:
+		body = formatLEEF(e, ip)
+	default:
+		body = formatCEF(e, ip)
+	}
+
+	return "<" + strconv.Itoa(syslogFacility*8+sev) + ">1 " +
+		e.Time.UTC().Format(syslogTimeFormat) + s.header + body
+}
+
+// siemAction returns the action taken on the request of e.
+func siemAction(e *logEntry) (act string) {
+	if e.Result.IsFiltered {
+		return "blocked"
+	}
+
+	return "allowed"
+}
+
+// siemRule returns the text of the first rule matched by the request of e, if
+// any.
+func siemRule(e *logEntry) (rule string) {
+	if len(e.Result.Rules) > 0 {
+		return e.Result.Rules[0].Text
+	}
+
+	return ""
+}
+
+// siemClientProto returns the name of the client protocol of e.
+func siemClientProto(e *logEntry) (proto string) {
+	if e.ClientProto == ClientProtoPlain {
+		return "dns"
+	}
+
+	return string(e.ClientProto)
+}
+
+// cefHeaderReplacer escapes the values of the CEF header fields.
+var cefHeaderReplacer = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+
+// cefExtReplacer escapes the values of the CEF extension fields.
+var cefExtReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// formatCEF returns the CEF representation of e with the client address ip.
+func formatCEF(e *logEntry, ip net.IP) (msg string) {
+	sev := "1"
+	if e.Result.IsFiltered {
+		sev = "5"
+	}
+
+	b := &strings.Builder{}
+	for _, f := range []string{
+		"CEF:0",
+		siemVendor,
+		siemProduct,
+		version.Version(),
+		e.Result.Reason.String(),
+		"DNS query",
+		sev,
+	} {
+		b.WriteString(cefHeaderReplacer.Replace(f))
+		b.WriteByte('|')
+	}
+
+	ext := &cefExtension{b: b}
+	ext.add("rt", strconv.FormatInt(e.Time.UnixMilli(), 10))
+	ext.add("src", ip.String())
+	ext.add("dhost", e.QHost)
+	ext.add("app", siemClientProto(e))
+	ext.add("act", siemAction(e))
+	ext.addCustom("cs1", "qtype", e.QType)
+	ext.addCustom("cs2", "upstream", e.Upstream)
+	ext.addCustom("cs3", "rule", siemRule(e))
+	ext.addCustom("cs4", "clientId", e.ClientID)
+	ext.addCustom("cn1", "elapsedMs", strconv.FormatInt(e.Elapsed.Milliseconds(), 10))
+
+	return b.String()
+}
+
+// cefExtension writes the extension fields of a CEF message.
+type cefExtension struct {
+	b *strings.Builder
+
+	// sep is written before the next field.
+	sep string
+}
+
+// add writes the field with key and val unless val is empty.
+func (ext *cefExtension) add(key, val string) {
+	if val == "" {
+		return
+	}
+
+	ext.b.WriteString(ext.sep)
+	ext.b.WriteString(key)
+	ext.b.WriteByte('=')
+	ext.b.WriteString(cefExtReplacer.Replace(val))
+	ext.sep = " "
+}
+
+// addCustom writes the custom field with key and val along with its label
+// unless val is empty.
+func (ext *cefExtension) addCustom(key, label, val string) {
+	if val != "" {
+		ext.add(key+"Label", label)
+		ext.add(key, val)
+	}
+}
+
+// leefHeaderReplacer removes the delimiters from the values of the LEEF header
+// fields.
+var leefHeaderReplacer = strings.NewReplacer("|", " ", "\n", " ", "\r", " ")
+
+// leefAttrReplacer removes the delimiters from the values of the LEEF event
+// attributes.
+var leefAttrReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// Formats of the devTime attribute of the LEEF messages in the Go and the Java
+// notations, the latter is sent as the devTimeFormat attribute.
+const (
+	leefTimeFormat     = "2006-01-02T15:04:05.000-0700"
+	leefTimeFormatJava = "yyyy-MM-dd'T'HH:mm:ss.SSSZ"
+)
+
+// formatLEEF returns the LEEF 1.0 representation of e with the client address
+// ip.
+func formatLEEF(e *logEntry, ip net.IP) (msg string) {
+	sev := "1"
+	if e.Result.IsFiltered {
+		sev = "5"
+	}
+
+	b := &strings.Builder{}
+	for _, f := range []string{
+		"LEEF:1.0",
+		siemVendor,
+		siemProduct,
+		version.Version(),
+		e.Result.Reason.String(),
+	} {
+		b.WriteString(leefHeaderReplacer.Replace(f))
+		b.WriteByte('|')
+	}
+
+	attrs := [][2]string{
+		{"devTime", e.Time.UTC().Format(leefTimeFormat)},
+		{"devTimeFormat", leefTimeFormatJava},
+		{"cat", "dns"},
+		{"sev", sev},
+		{"src", ip.String()},
+		{"clientProto", siemClientProto(e)},
+		{"action", siemAction(e)},
+		{"qname", e.QHost},
+		{"qtype", e.QType},
+		{"upstream", e.Upstream},
+		{"rule", siemRule(e)},
+		{"clientId", e.ClientID},
+		{"elapsedMs", strconv.FormatInt(e.Elapsed.Milliseconds(), 10)},
+	}
+
+	sep := ""
+	for _, kv := range attrs {
+		if kv[1] == "" {
+			continue
+		}
+
+		b.WriteString(sep)
+		b.WriteString(kv[0])
+		b.WriteByte('=')
+		b.WriteString(leefAttrReplacer.Replace(kv[1]))
+		sep = "\t"
+	}
+
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package querylog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatCEF(t *testing.T) {
+	e := newTestLogEntry("example.org")
+	e.ClientID = "cli=1"
+
+	want := "CEF:0|AdGuard|AdGuard Home|" + version.Version() + "|FilteredBlackList|DNS query|5|" +
+		"rt=1767323045000 src=1.2.3.4 dhost=example.org app=dns act=blocked " +
+		`cs1Label=qtype cs1=A cs3Label=rule cs3=||example.org^ cs4Label=clientId cs4=cli\=1 ` +
+		"cn1Label=elapsedMs cn1=1"
+
+	assert.Equal(t, want, formatCEF(e, e.IP))
+}
+
+func TestFormatLEEF(t *testing.T) {
+	e := newTestLogEntry("example.org")
+	e.Upstream = "tls://dns.example"
+
+	want := "LEEF:1.0|AdGuard|AdGuard Home|" + version.Version() + "|FilteredBlackList|" +
+		strings.Join([]string{
+			"devTime=2026-01-02T03:04:05.000+0000",
+			"devTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ",
+			"cat=dns",
+			"sev=5",
+			"src=1.2.3.4",
+			"clientProto=dns",
+			"action=blocked",
+			"qname=example.org",
+			"qtype=A",
+			"upstream=tls://dns.example",
+			"rule=||example.org^",
+			"elapsedMs=1",
+		}, "\t")
+
+	assert.Equal(t, want, formatLEEF(e, e.IP))
+}
+
+func TestSyslogConfig_validate(t *testing.T) {
+	conf := &SyslogConfig{
+		Address:  "siem.example",
+		Protocol: "http",
+		Format:   "json",
+		Enabled:  true,
+	}
+
+	_, err := newSyslogSink(conf, nil)
+	testutil.AssertErrorMsg(
+		t,
+		"syslog: address: address siem.example: missing port in address\n"+
+			`protocol: bad value "http"`+"\n"+
+			`format: bad value "json"`,
+		err,
+	)
+}
+
+func TestSyslogSink(t *testing.T) {
+	const wantPrefix = "<132>1 2026-01-02T03:04:05.000000Z adguard AdGuardHome "
+
+	newSink := func(t *testing.T, proto SyslogProtocol, addr string) (s *syslogSink) {
+		t.Helper()
+
+		s, err := newSyslogSink(&SyslogConfig{
+			Address:  addr,
+			Protocol: proto,
+			Format:   SyslogFormatCEF,
+			Hostname: "adguard",
+			Enabled:  true,
+		}, nil)
+		require.NoError(t, err)
+
+		s.start()
+		t.Cleanup(s.close)
+
+		return s
+	}
+
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+		e := newTestLogEntry("example.org")
+		s := newSink(t, SyslogProtocolUDP, conn.LocalAddr().String())
+		s.add(e)
+
+		buf := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		msg := string(buf[:n])
+		assert.True(t, strings.HasPrefix(msg, wantPrefix), msg)
+		assert.True(t, strings.HasSuffix(msg, " dnsquery - "+formatCEF(e, e.IP)), msg)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, l.Close)
+
+		msgCh := make(chan string, 2)
+		go func() {
+			conn, lErr := l.Accept()
+			if lErr != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			r := bufio.NewReader(conn)
+			for range 2 {
+				msgCh <- readOctetCounted(r)
+			}
+		}()
+
+		s := newSink(t, SyslogProtocolTCP, l.Addr().String())
+		s.add(newTestLogEntry("example.org"))
+		s.add(newTestLogEntry("example.com"))
+
+		msg, _ := testutil.RequireReceive(t, msgCh, testTimeout)
+		assert.True(t, strings.HasPrefix(msg, wantPrefix), msg)
+		assert.Contains(t, msg, "dhost=example.org")
+
+		msg, _ = testutil.RequireReceive(t, msgCh, testTimeout)
+		assert.Contains(t, msg, "dhost=example.com")
+	})
+}
+
+// readOctetCounted reads a single message framed using the octet counting from
+// r.  It returns an empty string on errors.
+func readOctetCounted(r *bufio.Reader) (msg string) {
+	lenStr, err := r.ReadString(' ')
+	if err != nil {
+		return ""
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+	if err != nil {
+		return ""
+	}
+
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return ""
+	}
+
+	return string(buf)
+}
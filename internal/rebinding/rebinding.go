@@ -0,0 +1,103 @@
+// Package rebinding implements the protection against the DNS rebinding
+// attacks, in which the public domain names are resolved to the addresses on
+// the local networks so that the browsers could be used to access the services
+// on them.
+package rebinding
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// Config is the configuration of the DNS rebinding protection.
+type Config struct {
+	// AllowedDomains are the domains, along with their subdomains, allowed to
+	// be resolved to the internal addresses, for example plex.direct.
+	AllowedDomains []string `yaml:"allowed_domains"`
+
+	// Enabled defines if the protection is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// localSuffixes are the special-use domains the names within which are
+// internal by definition.
+var localSuffixes = []string{
+	"home.arpa",
+	"internal",
+	"local",
+	"localhost",
+}
+
+// Protector tells if the answers to the requests for the public hostnames
+// contain the internal addresses.  It's safe for concurrent use.
+type Protector struct {
+	// allowed are the lowercased allowed domains.
+	allowed *container.MapSet[string]
+}
+
+// New returns a new properly initialized *Protector.  conf must not be nil.
+func New(conf *Config) (p *Protector, err error) {
+	allowed := container.NewMapSet[string]()
+	for i, d := range conf.AllowedDomains {
+		d = normalize(d)
+		err = netutil.ValidateDomainName(d)
+		if err != nil {
+			return nil, fmt.Errorf("allowed domain at index %d: %w", i, err)
+		}
+
+		allowed.Add(d)
+	}
+
+	return &Protector{
+		allowed: allowed,
+	}, nil
+}
+
+// IsRebinding returns true if ip is an internal address while host is a public
+// hostname and isn't within an allowed domain.
+func (p *Protector) IsRebinding(host string, ip netip.Addr) (ok bool) {
+	return IsInternal(ip) && !p.isAllowed(normalize(host))
+}
+
+// isAllowed returns true if the normalized host may be resolved to the
+// internal addresses.
+func (p *Protector) isAllowed(host string) (ok bool) {
+	if !strings.Contains(host, ".") {
+		// Single-label names are never public.
+		return true
+	}
+
+	for _, s := range localSuffixes {
+		if host == s || netutil.IsSubdomain(host, s) {
+			return true
+		}
+	}
+
+	for d := host; d != ""; {
+		if p.allowed.Has(d) {
+			return true
+		}
+
+		_, d, _ = strings.Cut(d, ".")
+	}
+
+	return false
+}
+
+// IsInternal returns true if ip is a private, loopback, or link-local address.
+// The unspecified addresses aren't considered internal, since they are often
+// returned by the upstreams blocking the domains themselves.
+func IsInternal(ip netip.Addr) (ok bool) {
+	ip = ip.Unmap()
+
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// normalize returns the lowercased domain name without the trailing dot.
+func normalize(host string) (norm string) {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
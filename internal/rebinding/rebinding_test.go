@@ -0,0 +1,108 @@
+package rebinding_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/rebinding"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := rebinding.New(&rebinding.Config{
+		AllowedDomains: []string{"plex.direct", "bad domain"},
+		Enabled:        true,
+	})
+	testutil.AssertErrorMsg(
+		t,
+		`allowed domain at index 1: bad domain name "bad domain": `+
+			`bad top-level domain name label "bad domain": `+
+			`bad top-level domain name label rune ' '`,
+		err,
+	)
+}
+
+func TestProtector_IsRebinding(t *testing.T) {
+	p, err := rebinding.New(&rebinding.Config{
+		AllowedDomains: []string{"Plex.Direct."},
+		Enabled:        true,
+	})
+	require.NoError(t, err)
+
+	var (
+		publicIP    = netip.MustParseAddr("203.0.113.1")
+		privateIP   = netip.MustParseAddr("192.168.1.1")
+		loopbackIP  = netip.MustParseAddr("127.0.0.1")
+		linkLocalIP = netip.MustParseAddr("fe80::1")
+	)
+
+	testCases := []struct {
+		ip   netip.Addr
+		name string
+		host string
+		want bool
+	}{{
+		ip:   publicIP,
+		name: "public",
+		host: "example.com",
+		want: false,
+	}, {
+		ip:   privateIP,
+		name: "private",
+		host: "example.com",
+		want: true,
+	}, {
+		ip:   netip.AddrFrom16(privateIP.As16()),
+		name: "private_mapped",
+		host: "example.com",
+		want: true,
+	}, {
+		ip:   loopbackIP,
+		name: "loopback",
+		host: "www.example.com.",
+		want: true,
+	}, {
+		ip:   linkLocalIP,
+		name: "link_local",
+		host: "example.com",
+		want: true,
+	}, {
+		ip:   privateIP,
+		name: "allowed",
+		host: "plex.direct",
+		want: false,
+	}, {
+		ip:   privateIP,
+		name: "allowed_subdomain",
+		host: "192-168-1-1.abcdef.PLEX.direct",
+		want: false,
+	}, {
+		ip:   privateIP,
+		name: "not_allowed_suffix",
+		host: "notplex.direct",
+		want: true,
+	}, {
+		ip:   privateIP,
+		name: "single_label",
+		host: "nas",
+		want: false,
+	}, {
+		ip:   loopbackIP,
+		name: "localhost",
+		host: "app.localhost",
+		want: false,
+	}, {
+		ip:   privateIP,
+		name: "home_arpa",
+		host: "nas.home.arpa",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.IsRebinding(tc.host, tc.ip))
+		})
+	}
+}
@@ -37,12 +37,20 @@ type StatsResp struct {
 	ReplacedSafebrowsing []uint64 `json:"replaced_safebrowsing"`
 	ReplacedParental     []uint64 `json:"replaced_parental"`
 
+	// DHCPPoolUtilization is the peak utilization of each DHCP address pool in
+	// percents per time unit.
+	DHCPPoolUtilization map[string][]float64 `json:"dhcp_pool_utilization"`
+
 	NumDNSQueries           uint64 `json:"num_dns_queries"`
 	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
 	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
 	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
 	NumReplacedParental     uint64 `json:"num_replaced_parental"`
 
+	// NumBlockedRebinding is the number of the responses blocked by the DNS
+	// rebinding protection.
+	NumBlockedRebinding uint64 `json:"num_blocked_rebinding"`
+
 	AvgProcessingTime float64 `json:"avg_processing_time"`
 }
 
@@ -52,16 +60,7 @@ func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
-	var (
-		resp *StatsResp
-		ok   bool
-	)
-	func() {
-		s.confMu.RLock()
-		defer s.confMu.RUnlock()
-
-		resp, ok = s.getData(uint32(s.limit.Hours()))
-	}()
+	resp, ok := s.Data()
 
 	s.logger.DebugContext(
 		ctx,
@@ -93,6 +93,18 @@ type Interface interface {
 	// clients with the most number of requests.
 	TopClientsIP(limit uint) []netip.Addr
 
+	// UpdatePoolUsage collects the current usage of a DHCP address pool.
+	UpdatePoolUsage(u *PoolUsage)
+
+	// ClientRequests returns the number of requests from the client matched by
+	// match for each hour of the statistics period with any, from the oldest to
+	// the newest.  match is called with either clientID or ip set.
+	ClientRequests(match func(clientID string, ip netip.Addr) (ok bool)) (hours []*ClientHour)
+
+	// Data returns the statistics for the whole statistics period.  ok is
+	// false if the data couldn't be loaded.
+	Data() (resp *StatsResp, ok bool)
+
 	// WriteDiskConfig puts the Interface's configuration to the dc.
 	WriteDiskConfig(dc *Config)
 
@@ -107,11 +119,15 @@ type StatsCtx struct {
 	// It must not be nil.
 	logger *slog.Logger
 
-	// currMu protects curr.
+	// currMu protects curr and pools.
 	currMu *sync.RWMutex
 	// curr is the actual statistics collection result.
 	curr *unit
 
+	// pools is the latest usage of each DHCP address pool.  It's carried over
+	// to each new unit, since the usage doesn't change until the leases do.
+	pools map[string]PoolUsage
+
 	// db is the opened statistics database, if any.
 	db atomic.Pointer[bbolt.DB]
 
@@ -163,6 +179,7 @@ func New(conf Config) (s *StatsCtx, err error) {
 	s = &StatsCtx{
 		logger:         conf.Logger,
 		currMu:         &sync.RWMutex{},
+		pools:          map[string]PoolUsage{},
 		httpRegister:   conf.HTTPRegister,
 		configModified: conf.ConfigModified,
 		filename:       conf.Filename,
@@ -296,6 +313,30 @@ func (s *StatsCtx) Update(e *Entry) {
 	s.curr.add(e)
 }
 
+// UpdatePoolUsage implements the [Interface] interface for *StatsCtx.  u must
+// not be nil.
+func (s *StatsCtx) UpdatePoolUsage(u *PoolUsage) {
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+
+	if !s.enabled || s.limit == 0 {
+		return
+	}
+
+	s.currMu.Lock()
+	defer s.currMu.Unlock()
+
+	s.pools[u.Name] = *u
+
+	if s.curr == nil {
+		s.logger.Error("current unit is nil")
+
+		return
+	}
+
+	s.curr.addPoolUsage(*u)
+}
+
 // WriteDiskConfig implements the [Interface] interface for *StatsCtx.
 func (s *StatsCtx) WriteDiskConfig(dc *Config) {
 	s.confMu.RLock()
@@ -341,6 +382,66 @@ func (s *StatsCtx) TopClientsIP(maxCount uint) (ips []netip.Addr) {
 	return ips
 }
 
+// ClientHour is the number of requests from a client during an hour.
+type ClientHour struct {
+	// Time is the start of the hour.
+	Time time.Time `json:"time"`
+
+	// Count is the number of requests from the client.
+	Count uint64 `json:"count"`
+}
+
+// Data implements the [Interface] interface for *StatsCtx.
+func (s *StatsCtx) Data() (resp *StatsResp, ok bool) {
+	s.confMu.RLock()
+	defer s.confMu.RUnlock()
+
+	return s.getData(uint32(s.limit.Hours()))
+}
+
+// ClientRequests implements the [Interface] interface for *StatsCtx.
+func (s *StatsCtx) ClientRequests(
+	match func(clientID string, ip netip.Addr) (ok bool),
+) (hours []*ClientHour) {
+	s.confMu.RLock()
+	defer s.confMu.RUnlock()
+
+	limit := uint32(s.limit.Hours())
+	if !s.enabled || limit == 0 {
+		return nil
+	}
+
+	units, curID := s.loadUnits(limit)
+	firstID := curID - limit + 1
+	for i, u := range units {
+		var n uint64
+		for _, c := range u.Clients {
+			if matchClient(c.Name, match) {
+				n += c.Count
+			}
+		}
+
+		if n > 0 {
+			hours = append(hours, &ClientHour{
+				Time:  unitIDToTime(firstID + uint32(i)),
+				Count: n,
+			})
+		}
+	}
+
+	return hours
+}
+
+// matchClient calls match with the client's primary ID, which is either a
+// ClientID or an IP address.
+func matchClient(id string, match func(clientID string, ip netip.Addr) (ok bool)) (ok bool) {
+	if ip, err := netip.ParseAddr(id); err == nil {
+		return match("", ip)
+	}
+
+	return match(id, netip.Addr{})
+}
+
 // deleteOldUnits walks the buckets available to tx and deletes old units.  It
 // returns the number of deletions performed.
 func (s *StatsCtx) deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
@@ -454,6 +555,9 @@ func (s *StatsCtx) flushDB(id, limit uint32, ptr *unit) (cont bool, sleepFor tim
 	}()
 
 	s.curr = newUnit(id)
+	for _, p := range s.pools {
+		s.curr.addPoolUsage(p)
+	}
 
 	udb := ptr.serialize()
 	flushErr := s.flushUnitToDB(udb, tx, ptr.id)
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"path/filepath"
 	"sync/atomic"
 	"testing"
@@ -112,6 +113,12 @@ func TestStats(t *testing.T) {
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 			},
+			DHCPPoolUtilization: map[string][]float64{
+				"dhcpv4": {
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 75,
+				},
+			},
 			NumDNSQueries:           2,
 			NumBlockedFiltering:     1,
 			NumReplacedSafebrowsing: 0,
@@ -124,6 +131,10 @@ func TestStats(t *testing.T) {
 			s.Update(e)
 		}
 
+		// Only the peak utilization is kept.
+		s.UpdatePoolUsage(&stats.PoolUsage{Name: "dhcpv4", Leased: 3, Size: 4})
+		s.UpdatePoolUsage(&stats.PoolUsage{Name: "dhcpv4", Leased: 1, Size: 4})
+
 		data := &stats.StatsResp{}
 		req := httptest.NewRequest(http.MethodGet, "/control/stats", nil)
 		assertSuccessAndUnmarshal(t, data, handlers["/control/stats"], req)
@@ -138,6 +149,21 @@ func TestStats(t *testing.T) {
 		assert.Equal(t, cliIP, topClients[0])
 	})
 
+	t.Run("client_requests", func(t *testing.T) {
+		hours := s.ClientRequests(func(_ string, ip netip.Addr) (ok bool) {
+			return ip == cliIP
+		})
+		require.Len(t, hours, 1)
+
+		assert.Equal(t, time.Unix(0, 0).UTC(), hours[0].Time)
+		assert.Equal(t, uint64(2), hours[0].Count)
+
+		hours = s.ClientRequests(func(_ string, _ netip.Addr) (ok bool) {
+			return false
+		})
+		assert.Empty(t, hours)
+	})
+
 	t.Run("reset", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/control/stats_reset", nil)
 		assertSuccessAndUnmarshal(t, nil, handlers["/control/stats_reset"], req)
@@ -154,6 +180,7 @@ func TestStats(t *testing.T) {
 			BlockedFiltering:      _24zeroes[:],
 			ReplacedSafebrowsing:  _24zeroes[:],
 			ReplacedParental:      _24zeroes[:],
+			DHCPPoolUtilization:   map[string][]float64{},
 		}
 
 		req = httptest.NewRequest(http.MethodGet, "/control/stats", nil)
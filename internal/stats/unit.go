@@ -6,6 +6,7 @@ import (
 	"encoding/gob"
 	"fmt"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -48,8 +49,9 @@ const (
 	RSafeBrowsing
 	RSafeSearch
 	RParental
+	RRebinding
 
-	resultLast = RParental + 1
+	resultLast = RRebinding + 1
 )
 
 // Entry is a statistics data entry.
@@ -76,6 +78,30 @@ type Entry struct {
 	UpstreamTime time.Duration
 }
 
+// PoolUsage is the usage of a DHCP address pool.
+type PoolUsage struct {
+	// Name is the name of the pool, for example "dhcpv4".  It must not be
+	// empty.
+	Name string
+
+	// Leased is the number of the addresses in the pool which are currently
+	// leased or otherwise unavailable.
+	Leased uint64
+
+	// Size is the total number of the addresses in the pool.  It must not be
+	// zero.
+	Size uint64
+}
+
+// percent returns the utilization of the pool in percents.
+func (u *PoolUsage) percent() (pct float64) {
+	if u.Size == 0 {
+		return 0
+	}
+
+	return float64(u.Leased) * 100 / float64(u.Size)
+}
+
 // validate returns an error if entry is not valid.
 func (e *Entry) validate() (err error) {
 	switch {
@@ -111,6 +137,9 @@ type unit struct {
 	// microseconds to each upstream.
 	upstreamsTimeSum map[string]uint64
 
+	// pools stores the peak usage of each DHCP address pool.
+	pools map[string]PoolUsage
+
 	// nResult stores the number of requests grouped by it's result.
 	nResult []uint64
 
@@ -137,6 +166,7 @@ func newUnit(id uint32) (u *unit) {
 		clients:            map[string]uint64{},
 		upstreamsResponses: map[string]uint64{},
 		upstreamsTimeSum:   map[string]uint64{},
+		pools:              map[string]PoolUsage{},
 		nResult:            make([]uint64, resultLast),
 		id:                 id,
 	}
@@ -149,6 +179,14 @@ type countPair struct {
 	Count uint64
 }
 
+// poolPair is the peak usage of a DHCP address pool for serializing statistics
+// data into the database.
+type poolPair struct {
+	Name   string
+	Leased uint64
+	Size   uint64
+}
+
 // unitDB is the structure for serializing statistics data into the database.
 //
 // NOTE: Do not change the names or types of fields, as this structure is used
@@ -173,6 +211,9 @@ type unitDB struct {
 	// responses from each upstream.
 	UpstreamsTimeSum []countPair
 
+	// Pools is the peak usage of each DHCP address pool.
+	Pools []poolPair
+
 	// NTotal is the total number of requests.
 	NTotal uint64
 
@@ -181,13 +222,20 @@ type unitDB struct {
 	TimeAvg uint32
 }
 
+// secsInHour is the number of seconds in an hour.
+const secsInHour = int64(time.Hour / time.Second)
+
 // newUnitID is the default UnitIDGenFunc that generates the unique id hourly.
 func newUnitID() (id uint32) {
-	const secsInHour = int64(time.Hour / time.Second)
-
 	return uint32(time.Now().Unix() / secsInHour)
 }
 
+// unitIDToTime returns the start of the hour of the unit with id generated by
+// [newUnitID].
+func unitIDToTime(id uint32) (t time.Time) {
+	return time.Unix(int64(id)*secsInHour, 0).UTC()
+}
+
 func finishTxn(tx *bbolt.Tx, commit bool) (err error) {
 	if commit {
 		err = errors.Annotate(tx.Commit(), "committing: %w")
@@ -273,10 +321,26 @@ func (u *unit) serialize() (udb *unitDB) {
 		Clients:            convertMapToSlice(u.clients, maxClients),
 		UpstreamsResponses: convertMapToSlice(u.upstreamsResponses, maxUpstreams),
 		UpstreamsTimeSum:   convertMapToSlice(u.upstreamsTimeSum, maxUpstreams),
+		Pools:              convertPoolsToSlice(u.pools),
 		TimeAvg:            timeAvg,
 	}
 }
 
+// convertPoolsToSlice converts the pools usage into the sorted slice for
+// serializing.
+func convertPoolsToSlice(pools map[string]PoolUsage) (s []poolPair) {
+	s = make([]poolPair, 0, len(pools))
+	for name, p := range pools {
+		s = append(s, poolPair{Name: name, Leased: p.Leased, Size: p.Size})
+	}
+
+	slices.SortFunc(s, func(a, b poolPair) (res int) {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return s
+}
+
 // loadUnitFromDB loads unit by id from the database.
 func (s *StatsCtx) loadUnitFromDB(tx *bbolt.Tx, id uint32) (udb *unitDB) {
 	bkt := tx.Bucket(idToUnitName(id))
@@ -297,6 +361,11 @@ func (s *StatsCtx) loadUnitFromDB(tx *bbolt.Tx, id uint32) (udb *unitDB) {
 		return nil
 	}
 
+	// The units stored by the previous versions have fewer result kinds.
+	if n := len(udb.NResult); n < int(resultLast) {
+		udb.NResult = append(udb.NResult, make([]uint64, int(resultLast)-n)...)
+	}
+
 	return udb
 }
 
@@ -316,6 +385,11 @@ func (u *unit) deserialize(udb *unitDB) {
 	u.upstreamsResponses = convertSliceToMap(udb.UpstreamsResponses)
 	u.upstreamsTimeSum = convertSliceToMap(udb.UpstreamsTimeSum)
 	u.timeSum = uint64(udb.TimeAvg) * udb.NTotal
+
+	u.pools = make(map[string]PoolUsage, len(udb.Pools))
+	for _, p := range udb.Pools {
+		u.pools[p.Name] = PoolUsage{Name: p.Name, Leased: p.Leased, Size: p.Size}
+	}
 }
 
 // add adds new data to u.  It's safe for concurrent use.
@@ -339,6 +413,16 @@ func (u *unit) add(e *Entry) {
 	}
 }
 
+// addPoolUsage updates the peak usage of the pool in u.  It's safe for
+// concurrent use.
+func (u *unit) addPoolUsage(p PoolUsage) {
+	if prev, ok := u.pools[p.Name]; ok && prev.percent() > p.percent() {
+		return
+	}
+
+	u.pools[p.Name] = p
+}
+
 // flushUnitToDB puts udb to the database at id.
 func (s *StatsCtx) flushUnitToDB(udb *unitDB, tx *bbolt.Tx, id uint32) (err error) {
 	s.logger.Debug("flushing unit", "id", id, "req_num", udb.NTotal)
@@ -424,6 +508,8 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 			DNSQueries:           []uint64{},
 			ReplacedParental:     []uint64{},
 			ReplacedSafebrowsing: []uint64{},
+
+			DHCPPoolUtilization: map[string][]float64{},
 		}, true
 	}
 
@@ -464,6 +550,7 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 		sum.NResult[RSafeBrowsing] += u.NResult[RSafeBrowsing]
 		sum.NResult[RSafeSearch] += u.NResult[RSafeSearch]
 		sum.NResult[RParental] += u.NResult[RParental]
+		sum.NResult[RRebinding] += u.NResult[RRebinding]
 	}
 
 	resp.NumDNSQueries = sum.NTotal
@@ -471,6 +558,7 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 	resp.NumReplacedSafebrowsing = sum.NResult[RSafeBrowsing]
 	resp.NumReplacedSafesearch = sum.NResult[RSafeSearch]
 	resp.NumReplacedParental = sum.NResult[RParental]
+	resp.NumBlockedRebinding = sum.NResult[RRebinding]
 
 	if timeN != 0 {
 		resp.AvgProcessingTime = microsecondsToSeconds(float64(sum.TimeAvg / timeN))
@@ -494,6 +582,7 @@ func (s *StatsCtx) fillCollectedStats(data *StatsResp, units []*unitDB, curID ui
 	data.BlockedFiltering = make([]uint64, size)
 	data.ReplacedSafebrowsing = make([]uint64, size)
 	data.ReplacedParental = make([]uint64, size)
+	data.DHCPPoolUtilization = map[string][]float64{}
 
 	if data.TimeUnits == timeUnitsDays {
 		s.fillCollectedStatsDaily(data, units, curID, size)
@@ -506,6 +595,22 @@ func (s *StatsCtx) fillCollectedStats(data *StatsResp, units []*unitDB, curID ui
 		data.BlockedFiltering[i] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[i] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[i] += u.NResult[RParental]
+		addPoolsUtilization(data, u, i, size)
+	}
+}
+
+// addPoolsUtilization sets the utilization of the pools in u at i-th time unit
+// in data, unless it's already higher.  size is the number of time units.
+func addPoolsUtilization(data *StatsResp, u *unitDB, i, size int) {
+	for _, p := range u.Pools {
+		pcts, ok := data.DHCPPoolUtilization[p.Name]
+		if !ok {
+			pcts = make([]float64, size)
+			data.DHCPPoolUtilization[p.Name] = pcts
+		}
+
+		usage := &PoolUsage{Leased: p.Leased, Size: p.Size}
+		pcts[i] = max(pcts[i], usage.percent())
 	}
 }
 
@@ -533,6 +638,7 @@ func (s *StatsCtx) fillCollectedStatsDaily(
 		data.BlockedFiltering[day] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[day] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[day] += u.NResult[RParental]
+		addPoolsUtilization(data, u, day, days)
 	}
 }
 
@@ -18,12 +18,13 @@ func TestUnit_Deserialize(t *testing.T) {
 			domains:            map[string]uint64{},
 			blockedDomains:     map[string]uint64{},
 			clients:            map[string]uint64{},
-			nResult:            []uint64{0, 0, 0, 0, 0, 0},
+			nResult:            []uint64{0, 0, 0, 0, 0, 0, 0},
 			id:                 0,
 			nTotal:             0,
 			timeSum:            0,
 			upstreamsResponses: map[string]uint64{},
 			upstreamsTimeSum:   map[string]uint64{},
+			pools:              map[string]PoolUsage{},
 		},
 		db: &unitDB{
 			NResult:            []uint64{0, 0, 0, 0, 0, 0},
@@ -47,7 +48,7 @@ func TestUnit_Deserialize(t *testing.T) {
 			clients: map[string]uint64{
 				"127.0.0.1": 2,
 			},
-			nResult: []uint64{0, 1, 1, 0, 0, 0},
+			nResult: []uint64{0, 1, 1, 0, 0, 0, 0},
 			id:      0,
 			nTotal:  2,
 			timeSum: 246912,
@@ -57,6 +58,9 @@ func TestUnit_Deserialize(t *testing.T) {
 			upstreamsTimeSum: map[string]uint64{
 				"1.2.3.4": 246912,
 			},
+			pools: map[string]PoolUsage{
+				"dhcpv4": {Name: "dhcpv4", Leased: 50, Size: 100},
+			},
 		},
 		db: &unitDB{
 			NResult: []uint64{0, 1, 1, 0, 0, 0},
@@ -77,6 +81,11 @@ func TestUnit_Deserialize(t *testing.T) {
 			UpstreamsTimeSum: []countPair{{
 				"1.2.3.4", 246912,
 			}},
+			Pools: []poolPair{{
+				Name:   "dhcpv4",
+				Leased: 50,
+				Size:   100,
+			}},
 		},
 	}}
 
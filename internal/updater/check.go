@@ -95,7 +95,7 @@ func (u *Updater) parseVersionResponse(data []byte) (VersionInfo, error) {
 		return info, fmt.Errorf("version.json: no package URL: key %q not found in object", key)
 	}
 
-	info.CanAutoUpdate = aghalg.BoolToNullBool(info.NewVersion != u.version)
+	info.CanAutoUpdate = aghalg.BoolToNullBool(info.NewVersion != u.version && !u.noSelfUpdate)
 
 	u.newVersion = info.NewVersion
 	u.packageURL = packageURL
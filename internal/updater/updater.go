@@ -38,6 +38,9 @@ type Updater struct {
 	execPath        string
 	versionCheckURL string
 
+	// noSelfUpdate, if true, prohibits replacing the executable.
+	noSelfUpdate bool
+
 	// mu protects all fields below.
 	mu *sync.RWMutex
 
@@ -83,8 +86,18 @@ type Config struct {
 
 	// VersionCheckURL is url to the latest version announcement.
 	VersionCheckURL string
+
+	// NoSelfUpdate, if true, prohibits replacing the executable, for example
+	// when running in a container, where the image should be updated instead.
+	// [Updater.Update] returns [ErrNoSelfUpdate] then, and the version
+	// information never reports that the automatic update is possible.
+	NoSelfUpdate bool
 }
 
+// ErrNoSelfUpdate is returned by [Updater.Update] if replacing the executable
+// is prohibited.
+const ErrNoSelfUpdate errors.Error = "self-update is disabled"
+
 // NewUpdater creates a new Updater.
 func NewUpdater(conf *Config) *Updater {
 	return &Updater{
@@ -102,6 +115,8 @@ func NewUpdater(conf *Config) *Updater {
 		execPath:        conf.ExecPath,
 		versionCheckURL: conf.VersionCheckURL,
 
+		noSelfUpdate: conf.NoSelfUpdate,
+
 		mu: &sync.RWMutex{},
 	}
 }
@@ -109,6 +124,10 @@ func NewUpdater(conf *Config) *Updater {
 // Update performs the auto-update.  It returns an error if the update failed.
 // If firstRun is true, it assumes the configuration file doesn't exist.
 func (u *Updater) Update(firstRun bool) (err error) {
+	if u.noSelfUpdate {
+		return ErrNoSelfUpdate
+	}
+
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
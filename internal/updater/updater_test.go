@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/testutil"
@@ -133,3 +134,48 @@ func TestUpdater_Update(t *testing.T) {
 		assert.ErrorAs(t, err, &urlErr)
 	})
 }
+
+func TestUpdater_Update_noSelfUpdate(t *testing.T) {
+	const jsonData = `{
+  "version": "v0.103.0-beta.2",
+  "announcement": "AdGuard Home v0.103.0-beta.2 is now available!",
+  "announcement_url": "https://github.com/AdguardTeam/AdGuardHome/internal/releases",
+  "selfupdate_min_version": "v0.0",
+  "download_linux_amd64": "https://static.adtidy.org/adguardhome/beta/AdGuardHome_linux_amd64.tar.gz"
+}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(jsonData))
+	}))
+	t.Cleanup(srv.Close)
+
+	wd := t.TempDir()
+	exePath := filepath.Join(wd, "AdGuardHome")
+	require.NoError(t, os.WriteFile(exePath, []byte("AdGuardHome"), 0o755))
+
+	u := updater.NewUpdater(&updater.Config{
+		Client:          srv.Client(),
+		GOARCH:          "amd64",
+		GOOS:            "linux",
+		Version:         "v0.103.0",
+		WorkDir:         wd,
+		ExecPath:        exePath,
+		VersionCheckURL: srv.URL,
+		NoSelfUpdate:    true,
+	})
+
+	info, err := u.VersionInfo(false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "v0.103.0-beta.2", info.NewVersion)
+	assert.Equal(t, aghalg.NBFalse, info.CanAutoUpdate)
+	assert.Equal(t, "v0.103.0-beta.2", u.NewVersion())
+
+	err = u.Update(false)
+	assert.ErrorIs(t, err, updater.ErrNoSelfUpdate)
+
+	d, err := os.ReadFile(exePath)
+	require.NoError(t, err)
+
+	assert.Equal(t, "AdGuardHome", string(d))
+}
@@ -48,6 +48,17 @@ func Full() (v string) {
 	return fmt.Sprintf(vFmtFull, version)
 }
 
+// CommitTime returns the time of the commit the current AdGuard Home release is
+// built from or the zero time if it's unknown.
+func CommitTime() (t time.Time) {
+	commitTimeUnix, err := strconv.ParseInt(committime, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(commitTimeUnix, 0)
+}
+
 // GOARM returns the GOARM value used to build the current AdGuard Home release.
 func GOARM() (v string) {
 	return goarm
@@ -0,0 +1,96 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// authFlags are the flags of the authenticator data.
+type authFlags byte
+
+// authFlags values.
+const (
+	// flagUP means that the user was present.
+	flagUP authFlags = 1 << 0
+
+	// flagUV means that the user was verified.
+	flagUV authFlags = 1 << 2
+
+	// flagAT means that the attested credential data is included.
+	flagAT authFlags = 1 << 6
+
+	// flagED means that the extension data is included.
+	flagED authFlags = 1 << 7
+)
+
+// authData is the parsed authenticator data, see
+// https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data.
+type authData struct {
+	// credentialID is the identifier of the attested credential.  It's only
+	// set when flagAT is set.
+	credentialID []byte
+
+	// publicKey is the COSE_Key of the attested credential.  It's only set
+	// when flagAT is set.
+	publicKey []byte
+
+	// rpIDHash is the SHA-256 hash of the relying party identifier.
+	rpIDHash []byte
+
+	// signCount is the signature counter of the credential.
+	signCount uint32
+
+	// flags are the flags of the authenticator data.
+	flags authFlags
+}
+
+// minAuthDataLen is the length of the mandatory part of the authenticator
+// data: rpIdHash, flags, and signCount.
+const minAuthDataLen = 32 + 1 + 4
+
+// parseAuthData parses the authenticator data.  b must not be modified
+// afterwards.
+func parseAuthData(b []byte) (ad *authData, err error) {
+	if len(b) < minAuthDataLen {
+		return nil, fmt.Errorf("auth data: too short: %d bytes", len(b))
+	}
+
+	ad = &authData{
+		rpIDHash:  b[:32],
+		flags:     authFlags(b[32]),
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	if ad.flags&flagAT == 0 {
+		return ad, nil
+	}
+
+	// Skip the AAGUID, since the attestation isn't verified.
+	rest := b[minAuthDataLen:]
+	if len(rest) < 16+2 {
+		return nil, errors.Error("auth data: attested credential data: too short")
+	}
+
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errors.Error("auth data: credential id: too short")
+	}
+
+	ad.credentialID, rest = rest[:idLen], rest[idLen:]
+
+	_, tail, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("auth data: public key: %w", err)
+	}
+
+	ad.publicKey = rest[:len(rest)-len(tail)]
+
+	if ad.flags&flagED == 0 && len(tail) > 0 {
+		return nil, fmt.Errorf("auth data: %d trailing bytes", len(tail))
+	}
+
+	return ad, nil
+}
@@ -0,0 +1,193 @@
+package webauthn
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// maxCBORDepth is the maximum nesting depth of the decoded CBOR values.
+const maxCBORDepth = 16
+
+// errCBORTruncated is returned when the CBOR data ends unexpectedly.
+const errCBORTruncated errors.Error = "cbor: unexpected end of data"
+
+// decodeCBOR decodes a single CBOR value, see RFC 8949, from the beginning of
+// b and returns it along with the rest of b.  Only the definite-length items
+// used by WebAuthn are supported.  The integers are decoded as int64, byte
+// strings as []byte, text strings as string, arrays as []any, and maps as
+// map[any]any.  The tags are ignored.
+func decodeCBOR(b []byte) (v any, rest []byte, err error) {
+	return decodeCBORItem(b, 0)
+}
+
+// decodeCBORItem decodes a single CBOR value at the nesting depth.
+func decodeCBORItem(b []byte, depth int) (v any, rest []byte, err error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.Error("cbor: nesting too deep")
+	}
+
+	major, arg, b, err := decodeCBORHead(b)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer %d overflows", arg)
+		}
+
+		return int64(arg), b, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: negative integer -1-%d overflows", arg)
+		}
+
+		return -1 - int64(arg), b, nil
+	case 2, 3:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBORTruncated
+		}
+
+		data := b[:arg]
+		if major == 3 {
+			return string(data), b[arg:], nil
+		}
+
+		return append([]byte(nil), data...), b[arg:], nil
+	case 4:
+		return decodeCBORArray(b, arg, depth)
+	case 5:
+		return decodeCBORMap(b, arg, depth)
+	case 6:
+		return decodeCBORItem(b, depth+1)
+	default:
+		return decodeCBORSimple(b, arg)
+	}
+}
+
+// decodeCBORHead decodes the initial byte and the argument of a CBOR item.
+func decodeCBORHead(b []byte) (major byte, arg uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), b, nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+
+	if len(b) < n {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	for _, c := range b[:n] {
+		arg = arg<<8 | uint64(c)
+	}
+
+	return major, arg, b[n:], nil
+}
+
+// decodeCBORArray decodes n items of a CBOR array.
+func decodeCBORArray(b []byte, n uint64, depth int) (v any, rest []byte, err error) {
+	// Each item takes at least one byte.
+	if n > uint64(len(b)) {
+		return nil, nil, errCBORTruncated
+	}
+
+	arr := make([]any, 0, n)
+	for range n {
+		var item any
+		item, b, err = decodeCBORItem(b, depth+1)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, nil, err
+		}
+
+		arr = append(arr, item)
+	}
+
+	return arr, b, nil
+}
+
+// decodeCBORMap decodes n pairs of a CBOR map.  The keys must be integers or
+// text strings.
+func decodeCBORMap(b []byte, n uint64, depth int) (v any, rest []byte, err error) {
+	// Each pair takes at least two bytes.
+	if n > uint64(len(b))/2 {
+		return nil, nil, errCBORTruncated
+	}
+
+	m := make(map[any]any, n)
+	for range n {
+		var key, val any
+		key, b, err = decodeCBORItem(b, depth+1)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, nil, err
+		}
+
+		switch key.(type) {
+		case int64, string:
+			// Go on.
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+		}
+
+		val, b, err = decodeCBORItem(b, depth+1)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, nil, err
+		}
+
+		m[key] = val
+	}
+
+	return m, b, nil
+}
+
+// decodeCBORSimple decodes a CBOR simple value with the argument arg.  The
+// floating-point numbers aren't supported, since WebAuthn doesn't use them.
+func decodeCBORSimple(b []byte, arg uint64) (v any, rest []byte, err error) {
+	switch arg {
+	case 20:
+		return false, b, nil
+	case 21:
+		return true, b, nil
+	case 22, 23:
+		return nil, b, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+	}
+}
+
+// cborInt returns the integer value of m under key.
+func cborInt(m map[any]any, key any) (i int64, ok bool) {
+	i, ok = m[key].(int64)
+
+	return i, ok
+}
+
+// cborBytes returns the byte string value of m under key.
+func cborBytes(m map[any]any, key any) (b []byte, ok bool) {
+	b, ok = m[key].([]byte)
+
+	return b, ok
+}
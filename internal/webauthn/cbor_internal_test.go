@@ -0,0 +1,69 @@
+package webauthn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	testCases := []struct {
+		want       any
+		name       string
+		wantErrMsg string
+		in         []byte
+	}{{
+		want:       int64(10),
+		name:       "uint",
+		wantErrMsg: "",
+		in:         []byte{0x0a},
+	}, {
+		want:       int64(-257),
+		name:       "negative",
+		wantErrMsg: "",
+		in:         []byte{0x39, 0x01, 0x00},
+	}, {
+		want:       []byte{1, 2},
+		name:       "bytes",
+		wantErrMsg: "",
+		in:         []byte{0x42, 1, 2},
+	}, {
+		want:       map[any]any{"fmt": "none", int64(1): []any{true, nil}},
+		name:       "map",
+		wantErrMsg: "",
+		in:         []byte{0xa2, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0x01, 0x82, 0xf5, 0xf6},
+	}, {
+		want:       nil,
+		name:       "truncated",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x43, 1, 2},
+	}, {
+		want:       nil,
+		name:       "bad_key",
+		wantErrMsg: "cbor: unsupported map key type []uint8",
+		in:         []byte{0xa1, 0x41, 1, 0x01},
+	}, {
+		want:       nil,
+		name:       "indefinite",
+		wantErrMsg: "cbor: unsupported additional information 31",
+		in:         []byte{0x5f},
+	}, {
+		want:       nil,
+		name:       "too_deep",
+		wantErrMsg: "cbor: nesting too deep",
+		in:         bytes.Repeat([]byte{0x81}, maxCBORDepth+2),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, _, err := decodeCBOR(tc.in)
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, v)
+			} else {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// COSE algorithm identifiers, see the IANA COSE Algorithms registry.
+const (
+	algES256 int64 = -7
+	algEdDSA int64 = -8
+	algRS256 int64 = -257
+)
+
+// supportedAlgs are the COSE algorithms of the credential public keys
+// supported by the relying party, in the order of preference.
+var supportedAlgs = []int64{algES256, algEdDSA, algRS256}
+
+// COSE key types and curves, see RFC 9053.
+const (
+	ktyOKP int64 = 1
+	ktyEC2 int64 = 2
+	ktyRSA int64 = 3
+
+	crvP256    int64 = 1
+	crvEd25519 int64 = 6
+)
+
+// COSE key parameters, see RFC 9052 and RFC 9053.
+const (
+	coseKeyKty int64 = 1
+	coseKeyAlg int64 = 3
+
+	// coseKeyCrv is the curve of the EC2 and OKP keys and the modulus of the
+	// RSA keys.
+	coseKeyCrv int64 = -1
+
+	// coseKeyX is the x coordinate of the EC2 and OKP keys and the exponent of
+	// the RSA keys.
+	coseKeyX int64 = -2
+
+	// coseKeyY is the y coordinate of the EC2 keys.
+	coseKeyY int64 = -3
+)
+
+// publicKey is a parsed COSE public key of a credential.
+type publicKey struct {
+	// key is the public key, either *ecdsa.PublicKey, ed25519.PublicKey, or
+	// *rsa.PublicKey.
+	key crypto.PublicKey
+
+	// alg is the COSE algorithm of the key.
+	alg int64
+}
+
+// parsePublicKey parses the COSE_Key encoded in CBOR.
+func parsePublicKey(b []byte) (pub *publicKey, err error) {
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding key: %w", err)
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("key: want map, got %T", v)
+	}
+
+	kty, _ := cborInt(m, coseKeyKty)
+	alg, _ := cborInt(m, coseKeyAlg)
+
+	pub = &publicKey{alg: alg}
+	switch alg {
+	case algES256:
+		pub.key, err = parseEC2Key(m, kty)
+	case algEdDSA:
+		pub.key, err = parseOKPKey(m, kty)
+	case algRS256:
+		pub.key, err = parseRSAKey(m, kty)
+	default:
+		return nil, fmt.Errorf("key: unsupported algorithm %d", alg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("key: %w", err)
+	}
+
+	return pub, nil
+}
+
+// parseEC2Key returns the P-256 public key of the COSE key m.
+func parseEC2Key(m map[any]any, kty int64) (key *ecdsa.PublicKey, err error) {
+	crv, _ := cborInt(m, coseKeyCrv)
+	if kty != ktyEC2 || crv != crvP256 {
+		return nil, fmt.Errorf("es256: unsupported key type %d or curve %d", kty, crv)
+	}
+
+	x, okX := cborBytes(m, coseKeyX)
+	y, okY := cborBytes(m, coseKeyY)
+	if !okX || !okY || len(x) != 32 || len(y) != 32 {
+		return nil, errors.Error("es256: bad coordinates")
+	}
+
+	// Use the uncompressed form to let the standard library validate that the
+	// point is on the curve.
+	uncompressed := append([]byte{4}, append(x, y...)...)
+	if _, err = ecdh.P256().NewPublicKey(uncompressed); err != nil {
+		return nil, fmt.Errorf("es256: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// parseOKPKey returns the Ed25519 public key of the COSE key m.
+func parseOKPKey(m map[any]any, kty int64) (key ed25519.PublicKey, err error) {
+	crv, _ := cborInt(m, coseKeyCrv)
+	if kty != ktyOKP || crv != crvEd25519 {
+		return nil, fmt.Errorf("eddsa: unsupported key type %d or curve %d", kty, crv)
+	}
+
+	x, ok := cborBytes(m, coseKeyX)
+	if !ok || len(x) != ed25519.PublicKeySize {
+		return nil, errors.Error("eddsa: bad public key")
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+// minRSABits is the minimum size of the RSA keys.
+const minRSABits = 2048
+
+// parseRSAKey returns the RSA public key of the COSE key m.
+func parseRSAKey(m map[any]any, kty int64) (key *rsa.PublicKey, err error) {
+	if kty != ktyRSA {
+		return nil, fmt.Errorf("rs256: unsupported key type %d", kty)
+	}
+
+	n, okN := cborBytes(m, coseKeyCrv)
+	e, okE := cborBytes(m, coseKeyX)
+	if !okN || !okE || len(e) == 0 || len(e) > 4 {
+		return nil, errors.Error("rs256: bad modulus or exponent")
+	}
+
+	key = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("rs256: key size %d is less than %d", key.N.BitLen(), minRSABits)
+	}
+
+	return key, nil
+}
+
+// verify returns an error if sig isn't the valid signature of data made with
+// the private part of pub.
+func (pub *publicKey) verify(data, sig []byte) (err error) {
+	switch key := pub.key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, sum[:], sig) {
+			return errors.Error("bad es256 signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, sig) {
+			return errors.Error("bad eddsa signature")
+		}
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig)
+		if err != nil {
+			return fmt.Errorf("bad rs256 signature: %w", err)
+		}
+	default:
+		panic(fmt.Errorf("webauthn: unexpected key type %T", key))
+	}
+
+	return nil
+}
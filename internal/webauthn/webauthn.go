@@ -0,0 +1,647 @@
+// Package webauthn implements the relying party side of the registration and
+// authentication ceremonies of the Web Authentication API.
+//
+// See https://www.w3.org/TR/webauthn-3.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// UserVerification is the requirement of the relying party on the user
+// verification, for example with a PIN or a biometric sensor.
+type UserVerification string
+
+// UserVerification values.
+const (
+	UserVerificationRequired    UserVerification = "required"
+	UserVerificationPreferred   UserVerification = "preferred"
+	UserVerificationDiscouraged UserVerification = "discouraged"
+)
+
+// DefaultTimeout is the default duration of a ceremony.
+const DefaultTimeout = 5 * time.Minute
+
+// maxCeremonies is the maximum number of the pending ceremonies.
+const maxCeremonies = 1024
+
+// maxCredentialIDLen is the maximum length of a credential identifier.
+const maxCredentialIDLen = 1023
+
+// challengeLen is the length of a ceremony challenge in bytes.
+const challengeLen = 32
+
+// Config is the configuration of a [RelyingParty].
+type Config struct {
+	// RPID is the identifier of the relying party, which is the effective
+	// domain of the web interface or its registrable suffix.  It must not be
+	// empty.
+	RPID string
+
+	// RPName is the human-readable name of the relying party.  If empty,
+	// RPID is used.
+	RPName string
+
+	// Origins are the allowed origins of the web interface, for example
+	// "https://dns.example.com:3000".  It must not be empty.
+	Origins []string
+
+	// Timeout is the duration of a ceremony.  If zero, [DefaultTimeout] is
+	// used.
+	Timeout time.Duration
+
+	// UserVerification is the requirement on the user verification.  If
+	// empty, [UserVerificationPreferred] is used.
+	UserVerification UserVerification
+}
+
+// Base64URL is a byte slice encoded in JSON as an unpadded base64url string, as
+// required by the JSON serialization of the WebAuthn structures.
+type Base64URL []byte
+
+// type check
+var _ json.Marshaler = Base64URL(nil)
+
+// MarshalJSON implements the [json.Marshaler] interface for Base64URL.
+func (b Base64URL) MarshalJSON() (data []byte, err error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// type check
+var _ json.Unmarshaler = (*Base64URL)(nil)
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface for *Base64URL.
+// Padded strings are accepted as well.
+func (b *Base64URL) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	*b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// Credential is a registered public key credential of a user.
+type Credential struct {
+	// Created is the time when the credential has been registered.
+	Created time.Time `json:"created"`
+
+	// UserName is the name of the user owning the credential.
+	UserName string `json:"user_name"`
+
+	// Name is the human-readable name of the credential given by the user.
+	Name string `json:"name"`
+
+	// ID is the identifier of the credential.
+	ID Base64URL `json:"id"`
+
+	// PublicKey is the COSE_Key of the credential encoded in CBOR.
+	PublicKey Base64URL `json:"public_key"`
+
+	// SignCount is the last known signature counter of the credential.
+	SignCount uint32 `json:"sign_count"`
+}
+
+// CredentialDescriptor identifies a credential in the ceremony options.
+type CredentialDescriptor struct {
+	// Type is always "public-key".
+	Type string `json:"type"`
+
+	// ID is the identifier of the credential.
+	ID Base64URL `json:"id"`
+}
+
+// RelyingPartyEntity describes the relying party in the creation options.
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the user in the creation options.
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is a supported type of the credential public key.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// AuthenticatorSelection is the requirements on the authenticator.
+type AuthenticatorSelection struct {
+	ResidentKey        string           `json:"residentKey"`
+	UserVerification   UserVerification `json:"userVerification"`
+	RequireResidentKey bool             `json:"requireResidentKey"`
+}
+
+// CreationOptions are the options of the registration ceremony to pass to
+// navigator.credentials.create in the JSON serialization.
+type CreationOptions struct {
+	RP                     *RelyingPartyEntity     `json:"rp"`
+	User                   *UserEntity             `json:"user"`
+	AuthenticatorSelection *AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                  `json:"attestation"`
+	Challenge              Base64URL               `json:"challenge"`
+	PubKeyCredParams       []*CredentialParameter  `json:"pubKeyCredParams"`
+	ExcludeCredentials     []*CredentialDescriptor `json:"excludeCredentials"`
+	Timeout                int64                   `json:"timeout"`
+}
+
+// RequestOptions are the options of the authentication ceremony to pass to
+// navigator.credentials.get in the JSON serialization.
+type RequestOptions struct {
+	RPID             string                  `json:"rpId"`
+	UserVerification UserVerification        `json:"userVerification"`
+	Challenge        Base64URL               `json:"challenge"`
+	AllowCredentials []*CredentialDescriptor `json:"allowCredentials"`
+	Timeout          int64                   `json:"timeout"`
+}
+
+// AttestationResponse is the response of the authenticator to the
+// registration ceremony.
+type AttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+}
+
+// RegistrationResponse is the JSON serialization of the credential created by
+// navigator.credentials.create.
+type RegistrationResponse struct {
+	Response *AttestationResponse `json:"response"`
+	Type     string               `json:"type"`
+	ID       Base64URL            `json:"id"`
+}
+
+// AssertionResponse is the response of the authenticator to the
+// authentication ceremony.
+type AssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle"`
+}
+
+// AuthenticationResponse is the JSON serialization of the credential returned
+// by navigator.credentials.get.
+type AuthenticationResponse struct {
+	Response *AssertionResponse `json:"response"`
+	Type     string             `json:"type"`
+	ID       Base64URL          `json:"id"`
+}
+
+// credentialType is the only supported type of the credentials.
+const credentialType = "public-key"
+
+// Client data types.
+const (
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+// clientData is the client data collected by the browser, see
+// https://www.w3.org/TR/webauthn-3/#dictdef-collectedclientdata.
+type clientData struct {
+	Type        string    `json:"type"`
+	Origin      string    `json:"origin"`
+	Challenge   Base64URL `json:"challenge"`
+	CrossOrigin bool      `json:"crossOrigin"`
+}
+
+// ceremony is a pending registration or authentication ceremony.
+type ceremony struct {
+	// expire is the time when the ceremony expires.
+	expire time.Time
+
+	// userName is the name of the user performing the ceremony.  It's empty
+	// for the authentication ceremonies with discoverable credentials.
+	userName string
+
+	// typ is the expected type of the client data.
+	typ string
+}
+
+// RelyingParty performs the WebAuthn ceremonies.  It keeps the state of the
+// pending ceremonies in memory.
+type RelyingParty struct {
+	// mu protects ceremonies.
+	mu *sync.Mutex
+
+	// ceremonies are the pending ceremonies by their challenges.
+	ceremonies map[string]*ceremony
+
+	rpID     string
+	rpName   string
+	rpIDHash []byte
+	origins  []string
+	uv       UserVerification
+	timeout  time.Duration
+}
+
+// New returns a new properly initialized *RelyingParty.  conf must not be nil.
+func New(conf *Config) (rp *RelyingParty, err error) {
+	if conf.RPID == "" {
+		return nil, errors.Error("rp id: empty value")
+	} else if len(conf.Origins) == 0 {
+		return nil, errors.Error("origins: empty value")
+	}
+
+	uv := conf.UserVerification
+	switch uv {
+	case "":
+		uv = UserVerificationPreferred
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+		// Go on.
+	default:
+		return nil, fmt.Errorf("user verification: unsupported value %q", uv)
+	}
+
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	} else if timeout < 0 {
+		return nil, fmt.Errorf("timeout: negative value %s", timeout)
+	}
+
+	rpName := conf.RPName
+	if rpName == "" {
+		rpName = conf.RPID
+	}
+
+	sum := sha256.Sum256([]byte(conf.RPID))
+
+	return &RelyingParty{
+		mu:         &sync.Mutex{},
+		ceremonies: map[string]*ceremony{},
+		rpID:       conf.RPID,
+		rpName:     rpName,
+		rpIDHash:   sum[:],
+		origins:    slices.Clone(conf.Origins),
+		uv:         uv,
+		timeout:    timeout,
+	}, nil
+}
+
+// userHandle returns the user handle of the user with the given name.  It
+// doesn't reveal the name itself to the authenticator.
+func userHandle(userName string) (h []byte) {
+	sum := sha256.Sum256([]byte(userName))
+
+	return sum[:16]
+}
+
+// descriptors returns the descriptors of creds.
+func descriptors(creds []*Credential) (ds []*CredentialDescriptor) {
+	ds = make([]*CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		ds = append(ds, &CredentialDescriptor{
+			Type: credentialType,
+			ID:   c.ID,
+		})
+	}
+
+	return ds
+}
+
+// BeginRegistration starts the registration ceremony of a new credential for
+// the user.  exclude are the credentials the user already has, so that the
+// same authenticator isn't registered twice.
+func (rp *RelyingParty) BeginRegistration(
+	userName string,
+	exclude []*Credential,
+) (opts *CreationOptions, err error) {
+	challenge, err := rp.addCeremony(userName, clientDataTypeCreate)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	params := make([]*CredentialParameter, 0, len(supportedAlgs))
+	for _, alg := range supportedAlgs {
+		params = append(params, &CredentialParameter{
+			Type: credentialType,
+			Alg:  alg,
+		})
+	}
+
+	return &CreationOptions{
+		RP: &RelyingPartyEntity{
+			ID:   rp.rpID,
+			Name: rp.rpName,
+		},
+		User: &UserEntity{
+			ID:          userHandle(userName),
+			Name:        userName,
+			DisplayName: userName,
+		},
+		AuthenticatorSelection: &AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.uv,
+		},
+		Attestation:        "none",
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		ExcludeCredentials: descriptors(exclude),
+		Timeout:            rp.timeout.Milliseconds(),
+	}, nil
+}
+
+// FinishRegistration verifies the response of the authenticator to the
+// registration ceremony and returns the new credential.  The attestation
+// statement isn't verified, since the authenticators don't need to be
+// restricted to particular models.
+func (rp *RelyingParty) FinishRegistration(
+	resp *RegistrationResponse,
+) (cred *Credential, err error) {
+	if resp == nil || resp.Response == nil {
+		return nil, errors.Error("no response")
+	} else if resp.Type != credentialType {
+		return nil, fmt.Errorf("type: unsupported value %q", resp.Type)
+	}
+
+	c, err := rp.checkClientData(resp.Response.ClientDataJSON, clientDataTypeCreate)
+	if err != nil {
+		return nil, fmt.Errorf("client data: %w", err)
+	}
+
+	v, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("attestation object: %w", err)
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("attestation object: want map, got %T", v)
+	}
+
+	raw, ok := cborBytes(m, "authData")
+	if !ok {
+		return nil, errors.Error("attestation object: no auth data")
+	}
+
+	ad, err := rp.checkAuthData(raw)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if ad.flags&flagAT == 0 {
+		return nil, errors.Error("auth data: no attested credential data")
+	} else if len(ad.credentialID) > maxCredentialIDLen {
+		return nil, fmt.Errorf("credential id: too long: %d bytes", len(ad.credentialID))
+	} else if !bytes.Equal(ad.credentialID, resp.ID) {
+		return nil, errors.Error("credential id: mismatch")
+	}
+
+	_, err = parsePublicKey(ad.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("auth data: %w", err)
+	}
+
+	return &Credential{
+		Created:   time.Now(),
+		UserName:  c.userName,
+		ID:        slices.Clone(ad.credentialID),
+		PublicKey: slices.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// BeginLogin starts the authentication ceremony.  If userName is empty, the
+// authenticator is asked for a discoverable credential of any user, allow is
+// ignored in that case.  Otherwise, allow are the credentials of the user.
+func (rp *RelyingParty) BeginLogin(
+	userName string,
+	allow []*Credential,
+) (opts *RequestOptions, err error) {
+	challenge, err := rp.addCeremony(userName, clientDataTypeGet)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	ds := []*CredentialDescriptor{}
+	if userName != "" {
+		ds = descriptors(allow)
+	}
+
+	return &RequestOptions{
+		RPID:             rp.rpID,
+		UserVerification: rp.uv,
+		Challenge:        challenge,
+		AllowCredentials: ds,
+		Timeout:          rp.timeout.Milliseconds(),
+	}, nil
+}
+
+// FinishLogin verifies the response of the authenticator to the authentication
+// ceremony.  find must return the registered credential by its identifier.  If
+// err is nil, cred is the copy of the found credential with the updated
+// signature counter, which the caller should store.
+func (rp *RelyingParty) FinishLogin(
+	resp *AuthenticationResponse,
+	find func(id []byte) (c *Credential, ok bool),
+) (cred *Credential, err error) {
+	if resp == nil || resp.Response == nil {
+		return nil, errors.Error("no response")
+	} else if resp.Type != credentialType {
+		return nil, fmt.Errorf("type: unsupported value %q", resp.Type)
+	}
+
+	ar := resp.Response
+	c, err := rp.checkClientData(ar.ClientDataJSON, clientDataTypeGet)
+	if err != nil {
+		return nil, fmt.Errorf("client data: %w", err)
+	}
+
+	ad, err := rp.checkAuthData(ar.AuthenticatorData)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	stored, ok := find(resp.ID)
+	if !ok {
+		return nil, errors.Error("credential: not found")
+	}
+
+	err = checkOwner(stored, c.userName, ar.UserHandle)
+	if err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+
+	pub, err := parsePublicKey(stored.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(ar.ClientDataJSON)
+	signed := append(slices.Clip(ar.AuthenticatorData), clientDataHash[:]...)
+	err = pub.verify(signed, ar.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	// A counter that doesn't increase may mean that the authenticator has
+	// been cloned.  The authenticators that don't support counters always
+	// return zero.
+	if (ad.signCount != 0 || stored.SignCount != 0) && ad.signCount <= stored.SignCount {
+		return nil, fmt.Errorf(
+			"sign count: got %d, want greater than %d",
+			ad.signCount,
+			stored.SignCount,
+		)
+	}
+
+	cred = &Credential{}
+	*cred = *stored
+	cred.SignCount = ad.signCount
+
+	return cred, nil
+}
+
+// checkOwner returns an error if the credential doesn't belong to the user
+// performing the ceremony.  userName is empty for the discoverable
+// credentials.  handle is the optional user handle returned by the
+// authenticator.
+func checkOwner(cred *Credential, userName string, handle []byte) (err error) {
+	if userName != "" && cred.UserName != userName {
+		return errors.Error("belongs to another user")
+	}
+
+	if len(handle) > 0 && !bytes.Equal(handle, userHandle(cred.UserName)) {
+		return errors.Error("user handle mismatch")
+	} else if len(handle) == 0 && userName == "" {
+		return errors.Error("no user handle for discoverable credential")
+	}
+
+	return nil
+}
+
+// addCeremony starts a new ceremony and returns its challenge.
+func (rp *RelyingParty) addCeremony(userName, typ string) (challenge []byte, err error) {
+	challenge = make([]byte, challengeLen)
+	_, err = rand.Read(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("generating challenge: %w", err)
+	}
+
+	now := time.Now()
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if len(rp.ceremonies) >= maxCeremonies {
+		rp.evictCeremoniesLocked(now)
+	}
+
+	rp.ceremonies[string(challenge)] = &ceremony{
+		expire:   now.Add(rp.timeout),
+		userName: userName,
+		typ:      typ,
+	}
+
+	return challenge, nil
+}
+
+// evictCeremoniesLocked removes the expired ceremonies.  If there are none, it
+// removes the oldest one, so that a flood of the unfinished ceremonies can't
+// prevent the new ones from starting.  rp.mu must be locked.
+func (rp *RelyingParty) evictCeremoniesLocked(now time.Time) {
+	var oldestKey string
+	var oldest *ceremony
+	for k, c := range rp.ceremonies {
+		if now.After(c.expire) {
+			delete(rp.ceremonies, k)
+		} else if oldest == nil || c.expire.Before(oldest.expire) {
+			oldestKey, oldest = k, c
+		}
+	}
+
+	if len(rp.ceremonies) >= maxCeremonies && oldest != nil {
+		delete(rp.ceremonies, oldestKey)
+	}
+}
+
+// takeCeremony removes the pending ceremony with the challenge and returns it.
+// The challenges can't be reused, so the ceremony is removed even if the
+// response turns out to be invalid.
+func (rp *RelyingParty) takeCeremony(challenge []byte, typ string) (c *ceremony, err error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	key := string(challenge)
+	c, ok := rp.ceremonies[key]
+	if !ok {
+		return nil, errors.Error("challenge: unknown value")
+	}
+
+	delete(rp.ceremonies, key)
+
+	if time.Now().After(c.expire) {
+		return nil, errors.Error("challenge: expired")
+	} else if c.typ != typ {
+		return nil, errors.Error("challenge: wrong ceremony")
+	}
+
+	return c, nil
+}
+
+// checkClientData verifies the client data and returns the pending ceremony
+// it belongs to.
+func (rp *RelyingParty) checkClientData(raw []byte, typ string) (c *ceremony, err error) {
+	cd := &clientData{}
+	err = json.Unmarshal(raw, cd)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if cd.Type != typ {
+		return nil, fmt.Errorf("type: got %q, want %q", cd.Type, typ)
+	} else if cd.CrossOrigin {
+		return nil, errors.Error("cross-origin requests are not allowed")
+	} else if !slices.Contains(rp.origins, cd.Origin) {
+		return nil, fmt.Errorf("origin: %q is not allowed", cd.Origin)
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return rp.takeCeremony(cd.Challenge, typ)
+}
+
+// checkAuthData parses and verifies the authenticator data.
+func (rp *RelyingParty) checkAuthData(raw []byte) (ad *authData, err error) {
+	ad, err = parseAuthData(raw)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if !bytes.Equal(ad.rpIDHash, rp.rpIDHash) {
+		return nil, errors.Error("auth data: rp id hash mismatch")
+	} else if ad.flags&flagUP == 0 {
+		return nil, errors.Error("auth data: user not present")
+	} else if rp.uv == UserVerificationRequired && ad.flags&flagUV == 0 {
+		return nil, errors.Error("auth data: user not verified")
+	}
+
+	return ad, nil
+}
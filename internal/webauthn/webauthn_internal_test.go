@@ -0,0 +1,45 @@
+package webauthn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelyingParty_addCeremony(t *testing.T) {
+	rp, err := New(&Config{
+		RPID:    "dns.example",
+		Origins: []string{"https://dns.example"},
+	})
+	require.NoError(t, err)
+
+	oldest, err := rp.addCeremony("", clientDataTypeGet)
+	require.NoError(t, err)
+
+	// Make sure the first ceremony is the oldest one.
+	rp.ceremonies[string(oldest)].expire = time.Now().Add(time.Minute)
+
+	for range maxCeremonies {
+		_, err = rp.addCeremony("", clientDataTypeGet)
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, rp.ceremonies, maxCeremonies)
+
+	_, err = rp.takeCeremony(oldest, clientDataTypeGet)
+	assert.EqualError(t, err, "challenge: unknown value")
+
+	for _, c := range rp.ceremonies {
+		c.expire = time.Now().Add(-time.Second)
+	}
+
+	latest, err := rp.addCeremony("", clientDataTypeGet)
+	require.NoError(t, err)
+
+	assert.Len(t, rp.ceremonies, 1)
+
+	_, err = rp.takeCeremony(latest, clientDataTypeGet)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,375 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common test constants.
+const (
+	testRPID     = "dns.example"
+	testOrigin   = "https://dns.example:3000"
+	testUserName = "admin"
+)
+
+// cborHead returns the encoded head of a CBOR item.
+func cborHead(major byte, n int) (b []byte) {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 0x100:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+// cborInt returns the encoded CBOR integer.
+func cborInt(i int) (b []byte) {
+	if i < 0 {
+		return cborHead(1, -1-i)
+	}
+
+	return cborHead(0, i)
+}
+
+// cborBytes returns the encoded CBOR byte string.
+func cborBytes(data []byte) (b []byte) {
+	return append(cborHead(2, len(data)), data...)
+}
+
+// cborText returns the encoded CBOR text string.
+func cborText(s string) (b []byte) {
+	return append(cborHead(3, len(s)), s...)
+}
+
+// cborMap returns the encoded CBOR map of the already encoded keys and values.
+func cborMap(kvs ...[]byte) (b []byte) {
+	b = cborHead(5, len(kvs)/2)
+	for _, kv := range kvs {
+		b = append(b, kv...)
+	}
+
+	return b
+}
+
+// testAuthenticator is a software authenticator with a single ES256
+// credential.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+// newTestAuthenticator returns a new *testAuthenticator with a random key.
+func newTestAuthenticator(tb testing.TB) (a *testAuthenticator) {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(tb, err)
+
+	return &testAuthenticator{
+		key: key,
+		id:  id,
+	}
+}
+
+// coseKey returns the COSE_Key of the credential.
+func (a *testAuthenticator) coseKey() (b []byte) {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	return cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(-7),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+// authData returns the authenticator data.  If attested is true, the attested
+// credential data is included.
+func (a *testAuthenticator) authData(rpID string, attested bool) (b []byte) {
+	sum := sha256.Sum256([]byte(rpID))
+	b = append(b, sum[:]...)
+
+	// UP and UV.
+	flags := byte(0x05)
+	if attested {
+		flags |= 0x40
+	}
+
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.signCount)
+
+	if attested {
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, a.coseKey()...)
+	}
+
+	return b
+}
+
+// clientDataJSON returns the client data of the ceremony.
+func clientDataJSON(tb testing.TB, typ, origin string, challenge []byte) (b []byte) {
+	tb.Helper()
+
+	b, err := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	require.NoError(tb, err)
+
+	return b
+}
+
+// create returns the registration response for the creation options.
+func (a *testAuthenticator) create(
+	tb testing.TB,
+	origin string,
+	opts *webauthn.CreationOptions,
+) (resp *webauthn.RegistrationResponse) {
+	tb.Helper()
+
+	attObj := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(opts.RP.ID, true)),
+	)
+
+	return &webauthn.RegistrationResponse{
+		Response: &webauthn.AttestationResponse{
+			ClientDataJSON:    clientDataJSON(tb, "webauthn.create", origin, opts.Challenge),
+			AttestationObject: attObj,
+		},
+		Type: "public-key",
+		ID:   a.id,
+	}
+}
+
+// get returns the authentication response for the request options.
+func (a *testAuthenticator) get(
+	tb testing.TB,
+	userName string,
+	opts *webauthn.RequestOptions,
+) (resp *webauthn.AuthenticationResponse) {
+	tb.Helper()
+
+	a.signCount++
+
+	ad := a.authData(opts.RPID, false)
+	cd := clientDataJSON(tb, "webauthn.get", testOrigin, opts.Challenge)
+	cdHash := sha256.Sum256(cd)
+	sum := sha256.Sum256(append(append([]byte{}, ad...), cdHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, sum[:])
+	require.NoError(tb, err)
+
+	handle := sha256.Sum256([]byte(userName))
+
+	return &webauthn.AuthenticationResponse{
+		Response: &webauthn.AssertionResponse{
+			ClientDataJSON:    cd,
+			AuthenticatorData: ad,
+			Signature:         sig,
+			UserHandle:        handle[:16],
+		},
+		Type: "public-key",
+		ID:   a.id,
+	}
+}
+
+// newTestRelyingParty is a helper that returns a new *webauthn.RelyingParty
+// for tests.
+func newTestRelyingParty(tb testing.TB) (rp *webauthn.RelyingParty) {
+	tb.Helper()
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:    testRPID,
+		Origins: []string{testOrigin},
+	})
+	require.NoError(tb, err)
+
+	return rp
+}
+
+func TestRelyingParty_registration(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newTestAuthenticator(t)
+
+	opts, err := rp.BeginRegistration(testUserName, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, testRPID, opts.RP.ID)
+	assert.Equal(t, testUserName, opts.User.Name)
+	assert.Len(t, opts.Challenge, 32)
+
+	cred, err := rp.FinishRegistration(a.create(t, testOrigin, opts))
+	require.NoError(t, err)
+
+	assert.Equal(t, testUserName, cred.UserName)
+	assert.Equal(t, webauthn.Base64URL(a.id), cred.ID)
+
+	t.Run("replay", func(t *testing.T) {
+		_, err = rp.FinishRegistration(a.create(t, testOrigin, opts))
+		assert.EqualError(t, err, "client data: challenge: unknown value")
+	})
+
+	t.Run("bad_origin", func(t *testing.T) {
+		opts, err = rp.BeginRegistration(testUserName, nil)
+		require.NoError(t, err)
+
+		_, err = rp.FinishRegistration(a.create(t, "https://evil.example", opts))
+		assert.EqualError(t, err, `client data: origin: "https://evil.example" is not allowed`)
+	})
+
+	t.Run("bad_rp_id", func(t *testing.T) {
+		opts, err = rp.BeginRegistration(testUserName, nil)
+		require.NoError(t, err)
+
+		opts.RP.ID = "evil.example"
+
+		_, err = rp.FinishRegistration(a.create(t, testOrigin, opts))
+		assert.EqualError(t, err, "auth data: rp id hash mismatch")
+	})
+}
+
+func TestRelyingParty_login(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	a := newTestAuthenticator(t)
+
+	regOpts, err := rp.BeginRegistration(testUserName, nil)
+	require.NoError(t, err)
+
+	cred, err := rp.FinishRegistration(a.create(t, testOrigin, regOpts))
+	require.NoError(t, err)
+
+	find := func(id []byte) (c *webauthn.Credential, ok bool) {
+		if string(id) == string(cred.ID) {
+			return cred, true
+		}
+
+		return nil, false
+	}
+
+	t.Run("discoverable", func(t *testing.T) {
+		opts, loginErr := rp.BeginLogin("", []*webauthn.Credential{cred})
+		require.NoError(t, loginErr)
+
+		assert.Empty(t, opts.AllowCredentials)
+
+		got, loginErr := rp.FinishLogin(a.get(t, testUserName, opts), find)
+		require.NoError(t, loginErr)
+
+		assert.Equal(t, a.signCount, got.SignCount)
+		cred = got
+	})
+
+	t.Run("user", func(t *testing.T) {
+		opts, loginErr := rp.BeginLogin(testUserName, []*webauthn.Credential{cred})
+		require.NoError(t, loginErr)
+
+		require.Len(t, opts.AllowCredentials, 1)
+
+		got, loginErr := rp.FinishLogin(a.get(t, testUserName, opts), find)
+		require.NoError(t, loginErr)
+
+		cred = got
+	})
+
+	t.Run("other_user", func(t *testing.T) {
+		opts, loginErr := rp.BeginLogin("other", nil)
+		require.NoError(t, loginErr)
+
+		_, loginErr = rp.FinishLogin(a.get(t, testUserName, opts), find)
+		assert.EqualError(t, loginErr, "credential: belongs to another user")
+	})
+
+	t.Run("cloned", func(t *testing.T) {
+		opts, loginErr := rp.BeginLogin(testUserName, nil)
+		require.NoError(t, loginErr)
+
+		a.signCount = 0
+
+		_, loginErr = rp.FinishLogin(a.get(t, testUserName, opts), find)
+		assert.EqualError(t, loginErr, "sign count: got 1, want greater than 2")
+	})
+
+	t.Run("bad_signature", func(t *testing.T) {
+		opts, loginErr := rp.BeginLogin(testUserName, nil)
+		require.NoError(t, loginErr)
+
+		a.signCount = cred.SignCount
+		resp := a.get(t, testUserName, opts)
+		resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff
+
+		_, loginErr = rp.FinishLogin(resp, find)
+		assert.EqualError(t, loginErr, "signature: bad es256 signature")
+	})
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		conf       *webauthn.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &webauthn.Config{
+			RPID:    testRPID,
+			Origins: []string{testOrigin},
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		conf: &webauthn.Config{
+			Origins: []string{testOrigin},
+		},
+		name:       "no_rp_id",
+		wantErrMsg: "rp id: empty value",
+	}, {
+		conf: &webauthn.Config{
+			RPID: testRPID,
+		},
+		name:       "no_origins",
+		wantErrMsg: "origins: empty value",
+	}, {
+		conf: &webauthn.Config{
+			RPID:             testRPID,
+			Origins:          []string{testOrigin},
+			UserVerification: "always",
+		},
+		name:       "bad_uv",
+		wantErrMsg: `user verification: unsupported value "always"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := webauthn.New(tc.conf)
+			if tc.wantErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.wantErrMsg)
+			}
+		})
+	}
+}
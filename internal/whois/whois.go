@@ -212,6 +212,9 @@ func (w *Default) query(ctx context.Context, target, serverAddr string) (data []
 		target = "n + " + target
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
 	conn, err := w.dialContext(ctx, "tcp", serverAddr)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
@@ -221,7 +224,8 @@ func (w *Default) query(ctx context.Context, target, serverAddr string) (data []
 
 	r := ioutil.LimitReader(conn, w.maxConnReadSize)
 
-	_ = conn.SetDeadline(time.Now().Add(w.timeout))
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
 	_, err = io.WriteString(conn, target+"\r\n")
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.